@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fortunnels/client/internal/announce"
+	"github.com/fortunnels/client/internal/config"
+	ctrl "github.com/fortunnels/client/internal/control"
+)
+
+// startAnnounce publishes the tunnel via mDNS when --announce is set. Errors
+// are logged and never stop the tunnel; the returned func withdraws it.
+func startAnnounce(cfg *config.Config, tun *ctrl.Response) func() {
+	if !cfg.Announce {
+		return func() {}
+	}
+	tr, err := announce.NewMulticastTransport(nil)
+	if err != nil {
+		log.Printf("[WARN] announce: %v", err)
+		return func() {}
+	}
+	a := announce.NewAnnouncer(tr)
+	svc := announce.Service{
+		Instance:  cfg.UserID + "-" + tun.ID,
+		PublicURL: ctrl.DisplayPublicURL(cfg.ServerURL, tun),
+		Protocol:  cfg.Protocol,
+		Owner:     cfg.UserID,
+	}
+	if err := a.Publish(svc); err != nil {
+		log.Printf("[WARN] announce: %v", err)
+	} else {
+		fmt.Println("📣 Announcing public URL on the local network (mDNS)")
+	}
+	return func() {
+		if err := a.Close(); err != nil {
+			log.Printf("[WARN] announce: withdraw: %v", err)
+		}
+	}
+}
+
+func runDiscoverCommand(args []string) int {
+	fs := flag.NewFlagSet("discover", flag.ContinueOnError)
+	wait := fs.Duration("timeout", 3*time.Second, "How long to listen for announcements")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	tr, err := announce.NewMulticastTransport(nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	entries, err := announce.Browse(tr, *wait)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	printDiscoveredTunnels(os.Stdout, entries)
+	return 0
+}
+
+func printDiscoveredTunnels(w io.Writer, entries []announce.Entry) {
+	if len(entries) == 0 {
+		fmt.Fprintln(w, "No tunnels announced on the local network.")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PUBLIC URL\tPROTOCOL\tOWNER\tHOST")
+	for _, e := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.PublicURL, e.Protocol, e.Owner, e.Source)
+	}
+	_ = tw.Flush()
+}
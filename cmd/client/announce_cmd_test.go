@@ -0,0 +1,35 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/fortunnels/client/internal/announce"
+)
+
+func TestPrintDiscoveredTunnels(t *testing.T) {
+	var buf bytes.Buffer
+	printDiscoveredTunnels(&buf, nil)
+	if !strings.Contains(buf.String(), "No tunnels announced") {
+		t.Fatalf("unexpected empty output: %q", buf.String())
+	}
+
+	buf.Reset()
+	printDiscoveredTunnels(&buf, []announce.Entry{{
+		Service: announce.Service{Instance: "alice-t1", PublicURL: "https://t1.example.com", Protocol: "http", Owner: "alice"},
+		Source:  "192.168.1.5:5353",
+	}})
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "PUBLIC URL") {
+		t.Fatalf("unexpected table: %q", buf.String())
+	}
+	for _, want := range []string{"https://t1.example.com", "http", "alice", "192.168.1.5:5353"} {
+		if !strings.Contains(lines[1], want) {
+			t.Fatalf("row %q missing %q", lines[1], want)
+		}
+	}
+}
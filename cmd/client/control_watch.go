@@ -0,0 +1,32 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"net/http"
+
+	"github.com/fortunnels/client/internal/config"
+	ctrl "github.com/fortunnels/client/internal/control"
+	dp "github.com/fortunnels/client/internal/dataplane"
+	clierrors "github.com/fortunnels/client/internal/support"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+// startControlWatch follows the server's control messages while mgr serves
+// the tunnel. Migrate messages move its sessions to the announced node. With
+// --single-connection the messages come over the control stream of mgr's
+// session, and those ending the tunnel call onTerminal. Otherwise a separate
+// control WebSocket carries only migrations, and the lifecycle poller
+// handles the rest. The returned func stops it.
+func startControlWatch(cfg *config.Config, runtime config.RuntimeSettings, watcher *ctrl.Watcher, mgr *dp.Manager, tun *ctrl.Response, httpClient *http.Client, bearer string, onTerminal func()) func() {
+	watcher.WithMigrateHandler(func(p protocolv1.MigratePayload) { migrateTunnel(cfg, mgr, tun, p) })
+	if cfg.SingleConnection {
+		return watcher.ServeControlStream(mgr, tun.ID, runtime.InstanceID, onTerminal)
+	}
+	stop := make(chan struct{})
+	clierrors.Go(clierrors.PanicScope{Role: "control watch", TunnelID: tun.ID}, func() {
+		watcher.WatchControlMessages(httpClient, cfg.ServerURL, tun.ID, bearer, stop)
+	})
+	return func() { close(stop) }
+}
@@ -0,0 +1,144 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+	ctrl "github.com/fortunnels/client/internal/control"
+	dp "github.com/fortunnels/client/internal/dataplane"
+	"github.com/fortunnels/client/internal/support"
+	"github.com/fortunnels/client/internal/testsupport"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+// startSingleConnection serves an http tunnel with --single-connection
+// against a stub announcing features, and returns the stub, the tunnel and
+// handleServing's result.
+func startSingleConnection(t *testing.T, features ...string) (*testsupport.Server, *protocolv1.Tunnel, <-chan error) {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "hello from backend")
+	}))
+	t.Cleanup(backend.Close)
+	caps := &protocolv1.ServerCapabilities{Features: features}
+	stub := testsupport.NewServer(testsupport.Options{Capabilities: caps})
+	t.Cleanup(stub.Close)
+
+	cfg := exitTestConfig(stub.URL)
+	cfg.TargetAddr = backend.Listener.Addr().String()
+	cfg.SingleConnection = true
+	require.NoError(t, applyCapabilities(cfg, config.NewCapabilities(caps)))
+	tun := stub.AddTunnel("http", cfg.TargetAddr)
+	runtime := cfg.RuntimeSettings()
+	mgr := dp.NewTunnelManager(cfg.ServerURL, tun.ID, "", runtime)
+	t.Cleanup(mgr.Close)
+	errCh := make(chan error, 1)
+	go func() { errCh <- handleServing(cfg, runtime, cfg.EncryptionSettings(), mgr, tun, "", nil, "", "") }()
+	require.NoError(t, stub.WaitSessions(tun.ID, 1, 5*time.Second))
+	require.NoError(t, stub.WaitWatchers(tun.ID, 1, 5*time.Second))
+	return stub, tun, errCh
+}
+
+// TestHandleServing_SingleConnection carries the control messages over the
+// data-plane WebSocket: tunnel_closed on the control stream ends serving,
+// and data streams keep working until then.
+func TestHandleServing_SingleConnection(t *testing.T) {
+	stub, tun, errCh := startSingleConnection(t, protocolv1.FeatureControlStream)
+	webSockets, streams := stub.Watchers(tun.ID)
+	assert.Equal(t, 0, webSockets, "no separate control WebSocket")
+	assert.Equal(t, 1, streams)
+	assert.Equal(t, 1, stub.LiveSessions(tun.ID))
+
+	held, err := stub.OpenStream(tun.ID, tun.TargetAddr)
+	require.NoError(t, err)
+	_, err = io.WriteString(held, "GET / HTTP/1.1\r\nHost: backend\r\n")
+	require.NoError(t, err)
+	for range 5 {
+		st, err := stub.OpenStream(tun.ID, tun.TargetAddr)
+		require.NoError(t, err)
+		assert.Contains(t, httpGet(t, st), "hello from backend")
+	}
+	_, err = io.WriteString(held, "Connection: close\r\n\r\n")
+	require.NoError(t, err)
+	b, _ := io.ReadAll(held)
+	held.Close()
+	assert.Contains(t, string(b), "hello from backend", "a stream open across control traffic completes")
+
+	require.NoError(t, stub.SendControl(tun.ID, protocolv1.EventTunnelClosed, protocolv1.LifecycleEventPayload{Reason: "deleted"}))
+	select {
+	case err := <-errCh:
+		require.True(t, errors.Is(err, support.ErrTunnelGone), "err = %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("tunnel_closed on the control stream did not stop serving")
+	}
+}
+
+func TestHandleServing_SingleConnectionFallback(t *testing.T) {
+	stub, tun, errCh := startSingleConnection(t, protocolv1.FeatureKeepalive)
+	webSockets, streams := stub.Watchers(tun.ID)
+	assert.Equal(t, 1, webSockets, "servers without control_stream get a control WebSocket")
+	assert.Equal(t, 0, streams)
+
+	stub.RemoveTunnel(tun.ID)
+	select {
+	case err := <-errCh:
+		require.True(t, errors.Is(err, support.ErrTunnelGone), "err = %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("serving did not stop after the tunnel was removed")
+	}
+}
+
+// panicOnceTransport panics on its first round trip and answers 403 (access
+// revoked, terminal) afterwards.
+type panicOnceTransport struct {
+	calls atomic.Int32
+}
+
+func (p *panicOnceTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if p.calls.Add(1) == 1 {
+		panic("injected poller panic")
+	}
+	return &http.Response{
+		StatusCode: http.StatusForbidden,
+		Body:       io.NopCloser(strings.NewReader("")),
+		Header:     make(http.Header),
+		Request:    r,
+	}, nil
+}
+
+// TestStartLifecyclePoller_RestartsAfterPanic: a panic inside the fallback
+// poller is recovered and the poller restarts, so a later terminal poll still
+// ends the tunnel.
+func TestStartLifecyclePoller_RestartsAfterPanic(t *testing.T) {
+	rt := &panicOnceTransport{}
+	client := &http.Client{Transport: rt, Timeout: 5 * time.Second}
+	before := support.Panics()
+	deleted := make(chan struct{})
+	stop := make(chan struct{})
+	defer close(stop)
+
+	startLifecyclePoller(ctrl.NewWatcher(nil), client, "http://example.invalid", "t1", "token",
+		func() { close(deleted) }, 10*time.Millisecond, stop)
+
+	select {
+	case <-deleted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("poller did not restart after the panic")
+	}
+	assert.Equal(t, before+1, support.Panics())
+	assert.GreaterOrEqual(t, rt.calls.Load(), int32(2))
+}
@@ -0,0 +1,51 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/diagnose"
+)
+
+// runDiagnoseCommand writes a support bundle for the tunnel flags given,
+// resolved like a normal run but without creating a tunnel.
+func runDiagnoseCommand(args []string) int {
+	out := "fortunnels-diagnose-" + time.Now().Format("20060102-150405") + ".tar.gz"
+	if len(args) >= 2 && (args[0] == "-o" || args[0] == "--o") {
+		out, args = args[1], args[2:]
+	}
+	return withCommandLine(args, func() int {
+		cfg, err := config.Parse()
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 2
+		}
+		opts := diagnose.Options{Config: cfg, ConfigErr: config.Validate(cfg), Version: version, Args: os.Args[1:]}
+
+		f, err := os.OpenFile(out, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 1
+		}
+		files, err := diagnose.Write(f, opts)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ write support bundle: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Support bundle written to %s (%d files). Secrets are redacted; review it before sharing.\n", out, len(files))
+		return 0
+	})
+}
@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+)
+
+func TestRunDiagnose_BundleIsRedacted(t *testing.T) {
+	const (
+		token     = "ft_planted_diagnose_token_0001"
+		psk       = "planted-diagnose-psk-from-file-0002"
+		dpSecret  = "planted-diagnose-dp-secret-0003"
+		proxyPass = "planted-proxy-pass-0004"
+	)
+	t.Setenv("FORTUNNELS_CONFIG", filepath.Join(t.TempDir(), "fortunnels.yml"))
+	t.Setenv("FORTUNNELS_DP_AUTH_SECRET", dpSecret)
+	pskFile := filepath.Join(t.TempDir(), "psk")
+	require.NoError(t, os.WriteFile(pskFile, []byte(psk+"\n"), 0o600))
+
+	// A server port nobody listens on: diagnose must work offline.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := "http://" + ln.Addr().String()
+	require.NoError(t, ln.Close())
+
+	out := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	start := time.Now()
+	require.Equal(t, 0, runDiagnoseCommand([]string{"-o", out,
+		"--server", server, "--token", token, "--psk-file", pskFile, "--encrypt",
+		"--backend-proxy", "http://alice:" + proxyPass + "@127.0.0.1:3128",
+		"--rate-limit", "1MiB", "http", "8080",
+	}))
+	assert.Less(t, time.Since(start), 10*time.Second)
+
+	files := readTarGz(t, out)
+	var names []string
+	for name, body := range files {
+		names = append(names, name)
+		for _, secret := range []string{token, psk, dpSecret, proxyPass} {
+			assert.NotContains(t, body, secret, "%s leaks a secret", name)
+		}
+	}
+	assert.ElementsMatch(t, []string{
+		"fortunnels-diagnose/README.txt",
+		"fortunnels-diagnose/version.txt",
+		"fortunnels-diagnose/config.json",
+		"fortunnels-diagnose/connectivity.json",
+		"fortunnels-diagnose/system.txt",
+	}, names)
+
+	var cfgDoc struct {
+		Settings []config.Setting `json:"settings"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(files["fortunnels-diagnose/config.json"]), &cfgDoc))
+	settings := map[string]config.Setting{}
+	for _, s := range cfgDoc.Settings {
+		settings[s.Name] = s
+	}
+	assert.Equal(t, config.Setting{Name: "token", Value: "[redacted]", Source: "flag"}, settings["token"])
+	assert.Equal(t, config.Setting{Name: "psk", Value: "[redacted]", Source: "file " + pskFile}, settings["psk"])
+	assert.Equal(t, "env FORTUNNELS_DP_AUTH_SECRET", settings["dp-auth-secret"].Source)
+	assert.Equal(t, config.Setting{Name: "local", Value: "127.0.0.1:8080", Source: "positional"}, settings["local"])
+	assert.Equal(t, "1MiB", settings["rate-limit"].Value)
+	assert.Equal(t, "default", settings["ping-interval"].Source)
+
+	var probes []struct {
+		Name string `json:"name"`
+		OK   bool   `json:"ok"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(files["fortunnels-diagnose/connectivity.json"]), &probes))
+	var probeNames []string
+	for _, p := range probes {
+		probeNames = append(probeNames, p.Name)
+		if p.Name == "tcp" {
+			assert.False(t, p.OK, "nothing listens on the server port")
+		}
+	}
+	assert.Equal(t, []string{"dns", "tcp", "http", "ws-handshake", "quic-handshake", "dtls-handshake"}, probeNames)
+}
+
+func readTarGz(t *testing.T, path string) map[string]string {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	files := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		require.NoError(t, err)
+		b, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[hdr.Name] = string(b)
+	}
+}
@@ -0,0 +1,429 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+	dp "github.com/fortunnels/client/internal/dataplane"
+	"github.com/fortunnels/client/internal/support"
+	"github.com/fortunnels/client/internal/testsupport"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+// exitTestConfig returns an HTTP-mode config aimed at serverURL.
+func exitTestConfig(serverURL string) *config.Config {
+	return &config.Config{
+		ServerURL:     serverURL,
+		TargetAddr:    "127.0.0.1:3000",
+		Protocol:      protoHTTP,
+		DataPlane:     "ws",
+		UserID:        "default",
+		PingInterval:  time.Second,
+		PingTimeout:   time.Second,
+		SmuxInterval:  10 * time.Second,
+		SmuxTimeout:   30 * time.Second,
+		WatchInterval: 50 * time.Millisecond,
+		// Keep test tunnels out of the user's client ps.
+		NoRegistry: true,
+	}
+}
+
+func statusServer(t *testing.T, status int) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, http.StatusText(status), status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func closedPortURL(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return "http://" + addr
+}
+
+func wantExit(t *testing.T, err error, code int) {
+	t.Helper()
+	if got := support.ExitCode(err); got != code {
+		t.Fatalf("exit code = %d (%s), want %d (%s); err = %v", got, support.ExitReason(got), code, support.ExitReason(code), err)
+	}
+}
+
+func TestExitCode_TunnelCreation(t *testing.T) {
+	tests := []struct {
+		name      string
+		serverURL string
+		want      int
+	}{
+		{"server unreachable", closedPortURL(t), support.ExitServerUnreachable},
+		{"auth rejected", statusServer(t, http.StatusUnauthorized), support.ExitAuth},
+		{"creation rejected", statusServer(t, http.StatusUnprocessableEntity), support.ExitTunnelRejected},
+		{"server error", statusServer(t, http.StatusServiceUnavailable), support.ExitServerUnreachable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wantExit(t, runClientWorkflow(exitTestConfig(tt.serverURL)), tt.want)
+		})
+	}
+}
+
+func TestExitCode_LoginFailure(t *testing.T) {
+	cfg := exitTestConfig(statusServer(t, http.StatusUnauthorized))
+	cfg.Login, cfg.Password = "user", "wrong"
+	wantExit(t, runClientWorkflow(cfg), support.ExitAuth)
+}
+
+func TestCreateTunnel_RetriesRateLimited(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.Header().Set("Retry-After", "4")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"error": {"code": "rate_limited", "message": "slow down"}}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": "t-1", "protocol": "http"}`))
+	}))
+	defer srv.Close()
+	var waits []time.Duration
+	oldSleep := createRetrySleep
+	createRetrySleep = func(d time.Duration) { waits = append(waits, d) }
+	defer func() { createRetrySleep = oldSleep }()
+
+	cfg := exitTestConfig(srv.URL)
+	cfg.CreateRetries = 1
+	_, err := createTunnel(cfg, nil, "", "")
+	wantExit(t, support.HandleTunnelCreationError(err, srv.URL), support.ExitTunnelRejected)
+	if attempts != 2 {
+		t.Fatalf("attempts = %d, want 2 (one retry)", attempts)
+	}
+
+	attempts, waits = 0, nil
+	cfg.CreateRetries = 3
+	tun, err := createTunnel(cfg, nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tun.ID != "t-1" || attempts != 3 {
+		t.Fatalf("tunnel %q after %d attempts, want t-1 after 3", tun.ID, attempts)
+	}
+	if len(waits) != 2 || waits[0] != 4*time.Second {
+		t.Fatalf("waits = %v, want the Retry-After of 4s twice", waits)
+	}
+}
+
+func TestCreateTunnel_NoRetryForOtherErrors(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_, _ = w.Write([]byte(`{"error": {"code": "quota_exceeded", "message": "limit reached"}}`))
+	}))
+	defer srv.Close()
+	cfg := exitTestConfig(srv.URL)
+	cfg.CreateRetries = 3
+	_, err := createTunnel(cfg, nil, "", "")
+	if err == nil || attempts != 1 {
+		t.Fatalf("err = %v after %d attempts, want a quota error after 1", err, attempts)
+	}
+}
+
+func TestExitCode_InvalidConfig(t *testing.T) {
+	oldArgs, oldFlag := os.Args, flag.CommandLine
+	defer func() {
+		os.Args = oldArgs
+		flag.CommandLine = oldFlag
+	}()
+	for _, args := range [][]string{
+		{"client", "-protocol", "ftp"},
+		{"client", "-ping-interval", "soon", "8000"},
+		{"client", "-output", "xml", "8000"},
+	} {
+		flag.CommandLine = flag.NewFlagSet("client", flag.ContinueOnError)
+		os.Args = args
+		_, err := parseConfig()
+		wantExit(t, err, support.ExitConfig)
+	}
+}
+
+func TestExitCode_TunnelRemovedOnServer(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	cfg := exitTestConfig(stub.URL)
+	cfg.Protocol = "tcp"
+	tun := stub.AddTunnel("tcp", cfg.TargetAddr)
+
+	errCh := make(chan error, 1)
+	mgr := dp.NewTunnelManager(cfg.ServerURL, tun.ID, "", cfg.RuntimeSettings())
+	defer mgr.Close()
+	go func() {
+		errCh <- handleServing(cfg, cfg.RuntimeSettings(), cfg.EncryptionSettings(), mgr, tun, "", nil, "", "")
+	}()
+	if err := stub.WaitSessions(tun.ID, 1, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	stub.RemoveTunnel(tun.ID)
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, support.ErrTunnelGone) {
+			t.Fatalf("err = %v, want ErrTunnelGone", err)
+		}
+		wantExit(t, err, support.ExitTunnelGone)
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve mode did not stop after the tunnel was removed")
+	}
+}
+
+func TestExitCode_ListenBindFailure(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	cfg := exitTestConfig(stub.URL)
+	cfg.Protocol = "tcp"
+	cfg.ListenAddr = busy.Addr().String()
+	cfg.Dst = "127.0.0.1:3333"
+	tun := stub.AddTunnel("tcp", "")
+	mgr := dp.NewTunnelManager(cfg.ServerURL, tun.ID, "", cfg.RuntimeSettings())
+	defer mgr.Close()
+	err = handleServing(cfg, cfg.RuntimeSettings(), cfg.EncryptionSettings(), mgr, tun, "", nil, "", "")
+	wantExit(t, err, support.ExitLocalTarget)
+}
+
+func TestServingExit(t *testing.T) {
+	wantExit(t, servingExit(errors.New("session closed")), support.ExitDataPlane)
+	wantExit(t, servingExit(&net.OpError{Op: "listen", Err: errors.New("address already in use")}), support.ExitLocalTarget)
+	wantExit(t, servingExit(fmt.Errorf("udp mode error: %w", dp.ErrByteLimit)), support.ExitQuota)
+}
+
+func TestExitCode_UnsupportedFeatureRefusedBeforeCreate(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{Capabilities: &protocolv1.ServerCapabilities{
+		Version: "1.0.0", Features: []string{protocolv1.FeatureKeepalive},
+	}})
+	defer stub.Close()
+	cfg := exitTestConfig(stub.URL)
+	cfg.Force = true
+	wantExit(t, runClientWorkflow(cfg), support.ExitConfig)
+	if got := stub.AddTunnel("http", "").ID; got != "stub-1" {
+		t.Fatalf("a tunnel was created before the refusal: next ID is %s", got)
+	}
+}
+
+func TestExitCode_UnsupportedFeatureInCreateResponse(t *testing.T) {
+	var deleted string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/tunnels" && r.Method == http.MethodPost:
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(protocolv1.Tunnel{
+				ID: "t-1", Protocol: protoHTTP, PublicURL: "http://t-1.example/", Status: protocolv1.StatusActive,
+				Capabilities: &protocolv1.ServerCapabilities{Features: []string{}},
+			})
+		case r.Method == http.MethodDelete:
+			deleted = r.URL.String()
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	cfg := exitTestConfig(srv.URL)
+	cfg.Force = true
+	wantExit(t, runClientWorkflow(cfg), support.ExitConfig)
+	if deleted == "" {
+		t.Fatal("the tunnel created for a refused run was not deleted")
+	}
+}
+
+// useCauses replaces support.Causes with a collector whose clock starts at
+// 14:00:00 UTC and moves by step per reading, for the test.
+func useCauses(t *testing.T, step time.Duration) {
+	t.Helper()
+	saved := support.Causes
+	now := time.Date(2026, 3, 1, 14, 0, 0, 0, time.UTC)
+	support.Causes = support.NewCauseCollector(func() time.Time {
+		t := now
+		now = now.Add(step)
+		return t
+	})
+	support.SetUTCTimes(true)
+	t.Cleanup(func() {
+		support.Causes = saved
+		support.SetUTCTimes(false)
+	})
+}
+
+func TestExitStatus_PostMortemPerCause(t *testing.T) {
+	tests := []struct {
+		name   string
+		report func()
+		err    error
+		want   string
+		code   int
+		// end is the end of the post-mortem when the report read the clock
+		// besides Start and the cause.
+		end string
+	}{
+		{
+			name:   "signal",
+			report: func() { reportSignal(syscall.SIGTERM) },
+			want:   "exited: received SIGTERM",
+			code:   support.ExitOK,
+		},
+		{
+			name:   "server closed control channel",
+			report: func() { support.Causes.Report(support.CauseServer, 1001, "server closed control channel") },
+			want:   "exited: server closed control channel (code 1001 going away)",
+			code:   support.ExitServerUnreachable,
+		},
+		{
+			name:   "server closed control channel normally",
+			report: func() { support.Causes.Report(support.CauseServer, 1000, "server closed control channel") },
+			want:   "exited: server closed control channel (code 1000 normal closure)",
+			code:   support.ExitOK,
+		},
+		{
+			name:   "tunnel removed",
+			report: func() { support.Causes.Report(support.CauseTunnelGone, 0, "tunnel was deleted on the server") },
+			err:    support.ErrTunnelGone,
+			want:   "exited: tunnel was deleted on the server",
+			code:   support.ExitTunnelGone,
+		},
+		{
+			name: "displaced",
+			report: func() {
+				support.Causes.Report(support.CauseDisplaced, 0, "another client instance took over the tunnel")
+			},
+			want: "exited: another client instance took over the tunnel",
+			code: support.ExitOK,
+		},
+		{
+			name:   "byte limit",
+			report: func() { support.Causes.Report(support.CauseQuota, 0, "tunnel reached --max-bytes-total 1GiB") },
+			err:    support.WithExitCode(support.ExitQuota, errors.New("❌ Tunnel stopped: it moved its --max-bytes-total of 1GiB")),
+			want:   "exited: tunnel reached --max-bytes-total 1GiB",
+			code:   support.ExitQuota,
+		},
+		{
+			name: "data plane closed by the server",
+			report: func() {
+				support.Causes.ObserveClose(1011, "server closed data-plane session")
+			},
+			err:  servingExit(fmt.Errorf("❌ Data-plane serve stopped: %w", errors.New("session closed"))),
+			want: "exited: Data-plane serve stopped: session closed (code 1011 internal error)",
+			code: support.ExitDataPlane,
+			end:  "at 17:00:00 after 3h",
+		},
+		{
+			name:   "local listener",
+			report: func() {},
+			err:    servingExit(fmt.Errorf("❌ Data-plane listen stopped: %w", &net.OpError{Op: "listen", Err: errors.New("address already in use")})),
+			want:   "exited: Data-plane listen stopped: listen: address already in use",
+			code:   support.ExitLocalTarget,
+		},
+		{
+			name:   "auth",
+			report: func() {},
+			err:    support.WithExitCode(support.ExitAuth, errors.New("❌ token revoked")),
+			want:   "exited: token revoked",
+			code:   support.ExitAuth,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useCauses(t, 90*time.Minute)
+			streams := dp.Traffic().Streams()
+			up, down := dp.Traffic().Totals()
+			support.Causes.Start()
+			tt.report()
+
+			var out bytes.Buffer
+			code := exitStatus(&out, tt.err, false)
+			assert.Equal(t, tt.code, code)
+			end := tt.end
+			if end == "" {
+				end = "at 15:30:00 after 1h 30m"
+			}
+			want := fmt.Sprintf("%s %s; %d streams served, %s transferred\n", tt.want, end, streams, support.FormatBytes(up+down))
+			assert.Contains(t, out.String(), want)
+			assert.True(t, strings.HasSuffix(out.String(), fmt.Sprintf("STATUS code=%d reason=%s\n", tt.code, support.ExitReason(tt.code))), out.String())
+		})
+	}
+}
+
+func TestExitStatus_NoPostMortemBeforeServing(t *testing.T) {
+	useCauses(t, time.Second)
+	var out bytes.Buffer
+	code := exitStatus(&out, support.WithExitCode(support.ExitConfig, errors.New("❌ invalid flag")), false)
+	assert.Equal(t, support.ExitConfig, code)
+	assert.Equal(t, "❌ invalid flag\nSTATUS code=2 reason=config\n", out.String())
+}
+
+func TestExitStatus_JSONCarriesCauseWithoutPostMortem(t *testing.T) {
+	useCauses(t, time.Second)
+	support.Causes.Start()
+	support.Causes.Report(support.CauseServer, 1001, "server closed control channel")
+	var out bytes.Buffer
+	code := exitStatus(&out, nil, true)
+	assert.Equal(t, support.ExitServerUnreachable, code)
+	assert.JSONEq(t, `{"status":"exit","code":5,"reason":"server_unreachable","error":"server closed control channel (code 1001 going away)"}`, out.String())
+}
+
+func TestExitStatus_TunnelRemovedOnServer(t *testing.T) {
+	support.Causes.Reset()
+	defer support.Causes.Reset()
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	cfg := exitTestConfig(stub.URL)
+	cfg.Protocol = "tcp"
+	tun := stub.AddTunnel("tcp", cfg.TargetAddr)
+
+	errCh := make(chan error, 1)
+	mgr := dp.NewTunnelManager(cfg.ServerURL, tun.ID, "", cfg.RuntimeSettings())
+	defer mgr.Close()
+	go func() {
+		errCh <- handleServing(cfg, cfg.RuntimeSettings(), cfg.EncryptionSettings(), mgr, tun, "", nil, "", "")
+	}()
+	require.NoError(t, stub.WaitSessions(tun.ID, 1, 5*time.Second))
+	stub.RemoveTunnel(tun.ID)
+	var err error
+	select {
+	case err = <-errCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve mode did not stop after the tunnel was removed")
+	}
+
+	var out bytes.Buffer
+	assert.Equal(t, support.ExitTunnelGone, exitStatus(&out, err, false))
+	assert.Regexp(t, `(?m)^exited: tunnel was deleted on the server at \d\d:\d\d:\d\d after \d+s; \d+ streams served, .+ transferred$`, out.String())
+}
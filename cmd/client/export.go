@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/fortunnels/client/internal/config"
+	ctrl "github.com/fortunnels/client/internal/control"
+)
+
+// tunnelExport keeps the --export-env file in step with the tunnel's public
+// URL. Errors are logged and never stop the tunnel.
+type tunnelExport struct {
+	path   string
+	format string
+}
+
+var (
+	exportMu sync.Mutex
+	// activeExport is the export of the tunnel being served, for
+	// migrateTunnel to update; nil without --export-env.
+	activeExport *tunnelExport
+)
+
+// startExport writes the --export-env file for tun, where the URL block is
+// printed. The returned func removes the file.
+func startExport(cfg *config.Config, tun *ctrl.Response) func() {
+	if cfg.ExportEnv == "" {
+		return func() {}
+	}
+	e := &tunnelExport{path: cfg.ExportEnv, format: cfg.ExportFileFormat()}
+	if e.write(ctrl.NewExportInfo(cfg.ServerURL, tun, cfg.Protocol)) {
+		fmt.Printf("📄 Tunnel info exported to %s\n", e.path)
+	}
+	exportMu.Lock()
+	activeExport = e
+	exportMu.Unlock()
+	return func() {
+		exportMu.Lock()
+		if activeExport == e {
+			activeExport = nil
+		}
+		exportMu.Unlock()
+		if err := os.Remove(e.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("[WARN] --export-env: %v", err)
+		}
+	}
+}
+
+// updateExport rewrites the --export-env file after the tunnel's public URL
+// changed.
+func updateExport(info ctrl.ExportInfo) {
+	exportMu.Lock()
+	e := activeExport
+	exportMu.Unlock()
+	if e != nil {
+		e.write(info)
+	}
+}
+
+func (e *tunnelExport) write(info ctrl.ExportInfo) bool {
+	if err := ctrl.WriteExportFile(e.path, e.format, info); err != nil {
+		log.Printf("[WARN] --export-env: %v", err)
+		return false
+	}
+	return true
+}
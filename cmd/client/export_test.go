@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	dp "github.com/fortunnels/client/internal/dataplane"
+	"github.com/fortunnels/client/internal/support"
+	"github.com/fortunnels/client/internal/testsupport"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+// TestHandleServing_ExportEnv writes --export-env once the tunnel is
+// served, rewrites it when a migration changes the public URL and removes
+// it when serving stops.
+func TestHandleServing_ExportEnv(t *testing.T) {
+	oldNode := testsupport.NewServer(testsupport.Options{})
+	defer oldNode.Close()
+	newNode := testsupport.NewServer(testsupport.Options{})
+	defer newNode.Close()
+	cfg := exitTestConfig(oldNode.URL)
+	cfg.ExportEnv = filepath.Join(t.TempDir(), ".env.tunnel")
+	tun := oldNode.AddTunnel("http", cfg.TargetAddr)
+	newNode.MirrorTunnel(tun)
+	runtime := cfg.RuntimeSettings()
+	mgr := dp.NewTunnelManager(cfg.ServerURL, tun.ID, "", runtime)
+	defer mgr.Close()
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- handleServing(cfg, runtime, cfg.EncryptionSettings(), mgr, tun, "", nil, "", "") }()
+	exported := func() string {
+		b, _ := os.ReadFile(cfg.ExportEnv)
+		return string(b)
+	}
+	require.Eventually(t, func() bool { return exported() != "" }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "FORTUNNELS_PUBLIC_URL="+tun.PublicURL+"\nFORTUNNELS_TUNNEL_ID="+tun.ID+"\nFORTUNNELS_PROTOCOL=http\nFORTUNNELS_EXPIRES_AT=\n", exported())
+
+	require.NoError(t, oldNode.WaitWatchers(tun.ID, 1, 5*time.Second))
+	require.NoError(t, oldNode.SendControl(tun.ID, protocolv1.MessageTypeMigrate, protocolv1.MigratePayload{
+		TunnelID: tun.ID, Endpoint: newNode.URL, PublicURL: "https://moved.example.com/", Deadline: time.Now().Add(time.Second),
+	}))
+	require.Eventually(t, func() bool {
+		return exported() == "FORTUNNELS_PUBLIC_URL=https://moved.example.com/\nFORTUNNELS_TUNNEL_ID="+tun.ID+"\nFORTUNNELS_PROTOCOL=http\nFORTUNNELS_EXPIRES_AT=\n"
+	}, 5*time.Second, 10*time.Millisecond, "got %q", exported())
+
+	oldNode.RemoveTunnel(tun.ID)
+	select {
+	case err := <-errCh:
+		require.True(t, errors.Is(err, support.ErrTunnelGone), "err = %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("serving did not stop after the tunnel was removed")
+	}
+	_, err := os.Stat(cfg.ExportEnv)
+	assert.ErrorIs(t, err, os.ErrNotExist, "removed on shutdown")
+}
@@ -6,30 +6,43 @@ package main
 // Command client provides a CLI to create tunnels and test data-plane.
 // Modes:
 // - HTTP/HTTPS: creates control-plane tunnel and prints usage hints
-// - TCP test: establishes WS→smux session and sends parallel echo messages
-// - TCP listen: accepts local connections and forwards via smux streams
+// - TCP expose-local (default): serves server-opened streams to the local backend
+// - TCP listen (--listen/--dst): accepts local connections and forwards via smux streams
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"maps"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/fortunnels/client/internal/auth"
 	"github.com/fortunnels/client/internal/config"
 	ctrl "github.com/fortunnels/client/internal/control"
 	dp "github.com/fortunnels/client/internal/dataplane"
+	"github.com/fortunnels/client/internal/diagnose"
 	clierrors "github.com/fortunnels/client/internal/support"
+	"github.com/fortunnels/client/internal/telemetry"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
 )
 
 const (
 	protoHTTP  = "http"
 	protoHTTPS = "https"
+	protoTCP   = "tcp"
+	protoUDP   = "udp"
 )
 
 var (
@@ -40,79 +53,184 @@ var (
 func main() {
 	// Check for version flag first
 	if len(os.Args) > 1 && (os.Args[1] == "--version" || os.Args[1] == "-v" || os.Args[1] == "version") {
-		fmt.Printf("fortunnels-client %s\n", version)
-		os.Exit(0)
+		os.Exit(runVersionCommand(os.Args[2:]))
 	}
 
 	if len(os.Args) > 1 && os.Args[1] == "config" {
 		os.Exit(runConfigCommand(os.Args[2:]))
 	}
+	if len(os.Args) > 1 && os.Args[1] == "discover" {
+		os.Exit(runDiscoverCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "profile" {
+		os.Exit(runProfileCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "wrap" {
+		os.Exit(runWrapCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "stats" {
+		os.Exit(runStatsCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "ps" {
+		os.Exit(runPsCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "diagnose" {
+		os.Exit(runDiagnoseCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "smoke" {
+		code := runSmokeCommand(os.Args[2:])
+		clierrors.RepeatLogs.Flush()
+		os.Exit(code)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "run" {
+		code := runRunCommand(os.Args[2:])
+		clierrors.RepeatLogs.Flush()
+		os.Exit(code)
+	}
 
 	cfg, err := parseConfig()
-	if err != nil {
-		if errors.Is(err, flag.ErrHelp) {
-			os.Exit(0)
-		}
-		fmt.Fprintf(os.Stderr, "%v\n", err)
-		os.Exit(1)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err == nil {
+		err = runClientWorkflow(cfg)
 	}
+	exit(err, cfg != nil && cfg.JSONOutput())
+}
+
+// exit is the single exit point of the client workflow: it exits with the
+// code exitStatus reports.
+func exit(err error, jsonOutput bool) {
+	os.Exit(exitStatus(os.Stderr, err, jsonOutput))
+}
 
-	if err := runClientWorkflow(cfg); err != nil {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
-		os.Exit(1)
+// exitStatus writes err, the post-mortem of a run that served (see
+// support.CauseCollector) and the final status line (see
+// support.WriteStatusLine) to w, and returns the exit code: that of the
+// run's terminal cause.
+func exitStatus(w io.Writer, err error, jsonOutput bool) int {
+	if err != nil && !errors.Is(err, clierrors.ErrTunnelGone) {
+		fmt.Fprintf(w, "%v\n", err)
+	}
+	clierrors.RepeatLogs.Flush()
+	if cause, ok := clierrors.Causes.Resolve(err); ok {
+		err = cause.ExitError(err)
+		if !jsonOutput {
+			up, down := dp.Traffic().Totals()
+			fmt.Fprintln(w, cause.PostMortem(clierrors.Causes.Started(), dp.Traffic().Streams(), up+down))
+		}
 	}
+	clierrors.WriteStatusLine(w, err, jsonOutput)
+	return clierrors.ExitCode(err)
 }
 
+// parseConfig parses and validates the CLI configuration. cfg is returned
+// whenever parsing succeeded, so validation errors can honor --output.
 func parseConfig() (*config.Config, error) {
 	config.SetDefaultServerURL(defaultServerURL)
 	cfg, err := config.Parse()
 	if err != nil {
-		return nil, err
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		return nil, clierrors.WithExitCode(clierrors.ExitConfig, err)
+	}
+	applyTimeZone(cfg)
+	if cfg.ProxyCommand {
+		enterProxyCommandMode()
 	}
 	if err := config.Validate(cfg); err != nil {
-		fmt.Println("❌", err.Error())
-		os.Exit(2)
+		return cfg, clierrors.WithExitCode(clierrors.ExitConfig, fmt.Errorf("❌ %w", err))
 	}
 	if err := ensureHTTPHasTarget(cfg); err != nil {
-		return nil, err
+		return cfg, clierrors.WithExitCode(clierrors.ExitConfig, err)
 	}
 	if err := ensureTCPHasTarget(cfg); err != nil {
-		return nil, err
+		return cfg, clierrors.WithExitCode(clierrors.ExitConfig, err)
 	}
 	return cfg, nil
 }
 
+// applyTimeZone renders printed times and log timestamps in UTC under --utc.
+func applyTimeZone(cfg *config.Config) {
+	clierrors.SetUTCTimes(cfg.UTC)
+	if cfg.UTC {
+		log.SetFlags(log.Flags() | log.LUTC)
+	}
+}
+
 func runClientWorkflow(cfg *config.Config) error {
-	fmt.Printf("Creating tunnel for %s://%s\n", cfg.Protocol, cfg.TargetAddr)
+	shutdownTracing, err := setupTracing(cfg.OTelEndpoint)
+	if err != nil {
+		return fmt.Errorf("❌ Tracing setup failed: %w", err)
+	}
+	defer shutdownTracing()
+	startCrashReports(cfg)
+
+	checkTargetTLS(cfg)
+	if cfg.TunnelID != "" {
+		fmt.Printf("Using existing tunnel %s\n", cfg.TunnelID)
+	} else {
+		fmt.Printf("Creating tunnel for %s://%s\n", cfg.Protocol, cfg.TargetAddr)
+	}
+	if len(cfg.LocalTargets) > 1 {
+		fmt.Printf("Backends (%s): %s\n", cfg.LocalBalance, strings.Join(cfg.LocalTargets, ", "))
+	}
 	fmt.Printf("Connecting to server: %s\n", cfg.ServerURL)
+	if err := prepareListen(cfg); err != nil {
+		return err
+	}
+	chains := startTLSChainCache(cfg)
 
-	httpClient, bearer, csrf, err := auth.SetupAuthentication(cfg)
+	httpClient, bearer, csrf, err := auth.SetupAuthentication(cfg, setupControlHTTP(cfg))
 	if err != nil {
-		return fmt.Errorf("❌ Authentication failed: %w", err)
+		explainTLSFailure(cfg, chains, err)
+		return clierrors.WithExitCode(clierrors.ExitAuth, fmt.Errorf("❌ Authentication failed: %w", err))
 	}
 
-	tun, err := ctrl.CreateTunnelWithClient(
-		cfg.ServerURL,
-		cfg.TargetAddr,
-		cfg.Protocol,
-		cfg.UserID,
-		httpClient,
-		bearer,
-		csrf,
-	)
+	if err := negotiateCapabilities(cfg, httpClient, bearer); err != nil {
+		return err
+	}
+	// The data plane is pinned to the IP the tunnel was created or fetched on.
+	pinClient, serverIP := ctrl.RecordRemoteIP(httpClient)
+	tun, err := obtainTunnel(cfg, pinClient, bearer, csrf)
 	if err != nil {
-		return clierrors.HandleTunnelCreationError(err, cfg.ServerURL)
+		explainTLSFailure(cfg, chains, err)
+		return err
+	}
+	if !cfg.Capabilities.Known() && tun.Capabilities != nil {
+		if err := applyCapabilities(cfg, config.NewCapabilities(tun.Capabilities)); err != nil {
+			deleteOwnTunnel(cfg, tun.ID, httpClient, bearer, csrf)
+			return err
+		}
 	}
 
 	runtime := cfg.RuntimeSettings()
+	runtime.InstanceID = clierrors.NewInstanceID()
+	if !cfg.NoIPPinning {
+		runtime.PinnedIP = serverIP.IP()
+	}
 	enc := cfg.EncryptionSettings()
 	authToken := auth.ComputeDataPlaneAuthWithPSK(tun.ID, cfg.DPAuthToken, cfg.DPAuthSecret, cfg.PSK, enc.Enabled)
 
-	ctrl.PrintTunnelInfo(cfg.ServerURL, tun)
-	if err := handleHTTPProtocol(cfg, runtime, tun, httpClient, bearer, csrf, authToken); err != nil {
+	// A tunnel serving incoming streams prints its URL once the data plane
+	// can route requests to it; see handleServing.
+	if incoming, _ := servingModes(cfg); !incoming {
+		defer announceTunnel(cfg, tun)()
+	}
+	defer startReloader(cfg, runtime)()
+	dp.SetByteLimits(runtime.MaxBytesPerStream, runtime.MaxBytesTotal)
+	clierrors.Memory.SetLimit(runtime.MemoryBudget)
+	dp.SetStreamLatencyAlarm(runtime.StreamLatencyWarn, runtime.StreamLatencyWindow)
+	dp.SetDstCommandLimits(runtime.DstCommandMaxProcs, runtime.DstCommandEnv)
+	// One Manager carries every stream of the tunnel, so an http tunnel with
+	// --listen serves both paths over a single data-plane connection.
+	mgr := dp.NewTunnelManager(cfg.ServerURL, tun.ID, authToken, runtime)
+	defer mgr.Close()
+	if err := handleServing(cfg, runtime, enc, mgr, tun, authToken, httpClient, bearer, csrf); err != nil {
 		return err
 	}
-	if err := handleTCPServeIncoming(cfg, runtime, tun, httpClient, bearer, csrf, authToken); err != nil {
+	if err := handleTCPProxyCommand(cfg, runtime, enc, tun, httpClient, bearer, csrf, authToken); err != nil {
 		return err
 	}
 	if err := handleUDPProtocol(cfg, runtime, enc, tun, authToken, httpClient, bearer, csrf); err != nil {
@@ -121,73 +239,751 @@ func runClientWorkflow(cfg *config.Config) error {
 
 	if cfg.WatchWS {
 		fmt.Printf("\n🔌 Connecting to WebSocket for real-time updates...\n")
+		clierrors.Causes.Start()
 		ctrl.ConnectWebSocketWithAuth(httpClient, cfg.ServerURL, tun.ID, bearer, runtime)
 	}
 	return nil
 }
 
-// handleHTTPProtocol delegates to tunnel package and TCP data-plane
-func handleHTTPProtocol(cfg *config.Config, runtime config.RuntimeSettings, tun *ctrl.Response, httpClient *http.Client, bearer, csrf, dpAuthToken string) error {
-	if !isHTTPProtocol(cfg.Protocol) {
+const (
+	// createRetryWait is the wait before retrying a rate-limited creation
+	// when the server sent no Retry-After.
+	createRetryWait = 2 * time.Second
+	// maxCreateRetryWait caps the server's Retry-After.
+	maxCreateRetryWait = time.Minute
+)
+
+// createRetrySleep waits between creation attempts; tests replace it.
+var createRetrySleep = time.Sleep
+
+// createTunnel creates the tunnel, retrying up to --create-retries times
+// while the server answers rate_limited.
+func createTunnel(cfg *config.Config, httpClient *http.Client, bearer, csrf string) (*ctrl.Response, error) {
+	for attempt := 1; ; attempt++ {
+		tun, err := ctrl.CreateTunnelWithClient(
+			cfg.ServerURL,
+			cfg.TargetAddr,
+			cfg.Protocol,
+			cfg.UserID,
+			httpClient,
+			bearer,
+			csrf,
+		)
+		var apiErr *ctrl.APIError
+		if err == nil || attempt > cfg.CreateRetries || !errors.As(err, &apiErr) || apiErr.Code != ctrl.CodeRateLimited {
+			return tun, err
+		}
+		wait := apiErr.RetryAfter
+		if wait <= 0 {
+			wait = createRetryWait
+		}
+		wait = min(wait, maxCreateRetryWait)
+		fmt.Printf("⏳ Rate limited by the server; retrying tunnel creation in %s (%d/%d)\n", wait, attempt, cfg.CreateRetries)
+		createRetrySleep(wait)
+	}
+}
+
+// prepareListen resolves --listen auto to a free loopback port, and checks
+// that an explicit --listen port is free before a tunnel is created for it.
+func prepareListen(cfg *config.Config) error {
+	if cfg.ListenAddr == "" {
 		return nil
 	}
-	reporter := dp.NewBackendStateReporter()
-	errCh := make(chan error, 1)
-	tunnelDeletedCh := make(chan struct{})
-	go func() {
-		errCh <- dp.StartDataPlaneServeIncoming(cfg.ServerURL, tun.ID, runtime, reporter, dpAuthToken)
-	}()
-	go ctrl.RunFallbackLifecyclePoller(httpClient, cfg.ServerURL, tun.ID, bearer, func() { close(tunnelDeletedCh) }, runtime.WatchInterval)
-
-	ctrl.PrintHTTPHints(tun)
-	fmt.Println("💡 Tip: If you see 'Backend unreachable', start your backend on the target address.")
-	fmt.Println("\n🔌 Serving HTTP over data-plane. Press Ctrl+C to stop.")
-	sigc := make(chan os.Signal, 1)
-	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
-	select {
-	case <-sigc:
+	if cfg.ListenAddr == clierrors.ListenAuto {
+		port, err := clierrors.FreePort(autoListenHost)
+		if err != nil {
+			return clierrors.WithExitCode(clierrors.ExitLocalTarget, fmt.Errorf("❌ --listen auto: %w", err))
+		}
+		cfg.ListenAddr = net.JoinHostPort(autoListenHost, strconv.Itoa(port))
+		fmt.Printf("\n📍 --listen auto picked %s\n", cfg.ListenAddr)
+		clierrors.WriteListenLine(os.Stderr, cfg.ListenAddr, cfg.JSONOutput())
 		return nil
-	case <-tunnelDeletedCh:
+	}
+	if err := clierrors.CheckListenAddr(cfg.ListenAddr); err != nil {
+		return clierrors.WithExitCode(clierrors.ExitLocalTarget, fmt.Errorf("❌ --listen %s: %w", cfg.ListenAddr, err))
+	}
+	if warning := clierrors.ShadowWarning(cfg.ListenAddr); warning != "" {
+		fmt.Fprintf(os.Stderr, "⚠️  %s\n", warning)
+	}
+	return nil
+}
+
+// setupControlHTTP makes cfg's --control-* policy the one of every
+// control-plane call and returns a client of it for logging in.
+func setupControlHTTP(cfg *config.Config) *http.Client {
+	policy := ctrl.NewHTTPClient(cfg)
+	ctrl.SetDefaultHTTPClient(policy)
+	return policy.Client(nil)
+}
+
+// autoListenHost is where --listen auto listens: loopback only, since the
+// user has not chosen to expose the port.
+const autoListenHost = "127.0.0.1"
+
+// startTLSChainCache records the server's certificate chains with
+// --tls-chain-cache; it returns nil without the flag or a usable directory.
+func startTLSChainCache(cfg *config.Config) *ctrl.TLSChainCache {
+	if !cfg.TLSChainCache {
 		return nil
-	case err := <-errCh:
+	}
+	dir, err := config.TLSChainCacheDir()
+	if err != nil {
+		log.Printf("[WARN] tls chain cache disabled: %v", err)
+		return nil
+	}
+	chains := ctrl.NewTLSChainCache(dir)
+	ctrl.InstallTLSChainCapture(chains)
+	return chains
+}
+
+// explainTLSFailure prints what changed in the server's certificate chain
+// when err is a TLS verification failure and the chain cache is on.
+func explainTLSFailure(cfg *config.Config, chains *ctrl.TLSChainCache, err error) {
+	if chains == nil {
+		return
+	}
+	ctrl.ExplainTLSFailure(os.Stderr, chains, cfg.ServerURL, err)
+}
+
+// obtainTunnel creates the tunnel, or with --tunnel-id fetches the existing
+// one and adopts its protocol and target.
+func obtainTunnel(cfg *config.Config, httpClient *http.Client, bearer, csrf string) (*ctrl.Response, error) {
+	if cfg.TunnelID == "" {
+		tun, err := createTunnel(cfg, httpClient, bearer, csrf)
 		if err != nil {
-			ctrl.DeleteTunnelWithClient(cfg.ServerURL, tun.ID, httpClient, bearer, csrf)
-			return fmt.Errorf("❌ Data-plane serve stopped: %w", err)
+			return nil, clierrors.HandleTunnelCreationError(err, cfg.ServerURL)
 		}
-		return nil
+		return tun, nil
 	}
+	tun, err := ctrl.GetTunnel(cfg.ServerURL, cfg.TunnelID, httpClient, bearer)
+	switch {
+	case errors.Is(err, ctrl.ErrTunnelNotFound):
+		return nil, clierrors.WithExitCode(clierrors.ExitTunnelGone, fmt.Errorf("❌ --tunnel-id %s: %w", cfg.TunnelID, err))
+	case clierrors.IsConnRefused(err) || clierrors.IsDialTimeout(err):
+		return nil, clierrors.HandleTunnelCreationError(err, cfg.ServerURL)
+	case err != nil:
+		return nil, clierrors.WithExitCode(clierrors.TunnelCreationExitCode(err), fmt.Errorf("❌ Failed to fetch tunnel %s: %w", cfg.TunnelID, err))
+	}
+	if err := adoptTunnel(cfg, tun); err != nil {
+		return nil, clierrors.WithExitCode(clierrors.ExitConfig, fmt.Errorf("❌ %w", err))
+	}
+	return tun, nil
 }
 
-// handleTCPServeIncoming is the default TCP mode: serve incoming streams from server, dial local backend.
-func handleTCPServeIncoming(cfg *config.Config, runtime config.RuntimeSettings, tun *ctrl.Response, httpClient *http.Client, bearer, csrf, dpAuthToken string) error {
-	if cfg.Protocol != "tcp" {
+// adoptTunnel fills the protocol and local target the user left at their
+// defaults from the fetched tunnel, then checks that the resulting mode can
+// serve it.
+func adoptTunnel(cfg *config.Config, tun *ctrl.Response) error {
+	protocol := strings.ToLower(tun.Protocol)
+	if !cfg.IsSet("protocol") {
+		cfg.Protocol = protocol
+	} else if cfg.Protocol != protocol {
+		return fmt.Errorf("--protocol %s does not match tunnel %s, which is %s\n   Example: drop --protocol or pass --protocol %s", cfg.Protocol, tun.ID, protocol, protocol)
+	}
+	if !cfg.IsSet("local") && tun.TargetAddr != "" {
+		cfg.TargetAddr = tun.TargetAddr
+	}
+	if err := config.Validate(cfg); err != nil {
+		return err
+	}
+	if err := ensureHTTPHasTarget(cfg); err != nil {
+		return err
+	}
+	if err := ensureTCPHasTarget(cfg); err != nil {
+		return err
+	}
+	// The server addresses incoming streams to the tunnel's registered
+	// target; a different single --local would never be dialed.
+	if incoming, _ := servingModes(cfg); incoming && len(cfg.LocalTargets) <= 1 && tun.TargetAddr != "" && cfg.TargetAddr != tun.TargetAddr {
+		return fmt.Errorf("--local %s differs from the target %s registered for tunnel %s\n   Example: drop --local to serve %s", cfg.TargetAddr, tun.TargetAddr, tun.ID, tun.TargetAddr)
+	}
+	return nil
+}
+
+// negotiateCapabilities asks the server for its features before a tunnel is
+// created and gates cfg on them. A server that does not answer is assumed to
+// have the baseline features, which is the behavior of older clients.
+func negotiateCapabilities(cfg *config.Config, httpClient *http.Client, bearer string) error {
+	announced, err := ctrl.FetchCapabilities(cfg.ServerURL, httpClient, bearer)
+	if err != nil {
+		log.Printf("[INFO] server capabilities unavailable, assuming the baseline: %v", err)
+	}
+	return applyCapabilities(cfg, config.NewCapabilities(announced))
+}
+
+// applyCapabilities logs the downgrades caps causes, or refuses to run.
+func applyCapabilities(cfg *config.Config, caps config.Capabilities) error {
+	notes, err := cfg.ApplyCapabilities(caps)
+	if err != nil {
+		return clierrors.WithExitCode(clierrors.ExitConfig, fmt.Errorf("❌ %w", err))
+	}
+	for _, note := range notes {
+		log.Printf("[INFO] %s", note)
+	}
+	return nil
+}
+
+// deleteOwnTunnel removes a tunnel this client created; operator-managed
+// tunnels (--tunnel-id) are left alone.
+func deleteOwnTunnel(cfg *config.Config, tunnelID string, httpClient *http.Client, bearer, csrf string) {
+	if cfg.TunnelID != "" {
+		return
+	}
+	ctrl.DeleteTunnelWithClient(cfg.ServerURL, tunnelID, httpClient, bearer, csrf)
+}
+
+// setupTracing installs the OTLP tracer when --otel-endpoint is set and returns
+// a function that flushes pending spans.
+func setupTracing(endpoint string) (func(), error) {
+	if strings.TrimSpace(endpoint) == "" {
+		return func() {}, nil
+	}
+	tracer, err := telemetry.NewOTLPTracer(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	telemetry.SetTracer(tracer)
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := tracer.Shutdown(ctx); err != nil {
+			log.Printf("[WARN] otel shutdown: %v", err)
+		}
+		telemetry.SetTracer(nil)
+	}, nil
+}
+
+// startCrashReports makes every recovered panic write a report to
+// --crash-dir, with the diagnostics summary of this run.
+func startCrashReports(cfg *config.Config) {
+	if cfg.CrashDir == "" {
+		return
+	}
+	clierrors.SetCrashDir(cfg.CrashDir, func() string {
+		var b strings.Builder
+		b.WriteString(diagnose.Summary(cfg, version))
+		dp.WriteSessionInfo(&b)
+		clierrors.Memory.WriteUsage(&b)
+		return b.String()
+	})
+}
+
+// printPanicSummary points at the recovered panics of the run, which the
+// client survived but which are bugs worth reporting.
+func printPanicSummary(cfg *config.Config) {
+	n := clierrors.Panics()
+	if n == 0 {
+		return
+	}
+	where := "the log"
+	if cfg.CrashDir != "" {
+		where = cfg.CrashDir
+	}
+	fmt.Printf("⚠️  Recovered from %d panics while serving; please report them with the details in %s\n", n, where)
+}
+
+// servingModes reports which serving paths the tunnel runs: serving
+// server-initiated streams from the local backend (http/https, and tcp
+// expose-local), and forwarding a local --listen socket to the server (tcp
+// listen mode, and http/https tunnels that also want raw TCP access).
+func servingModes(cfg *config.Config) (incoming, listen bool) {
+	listen = cfg.ListenAddr != ""
+	switch {
+	case isHTTPProtocol(cfg.Protocol):
+		return true, listen
+	case cfg.Protocol == "tcp" && !cfg.ProxyCommand:
+		return !listen, listen
+	default:
+		return false, false
+	}
+}
+
+// listenDst is where listen-mode connections go on the server side:
+// --sni-default or --dst, or for an http tunnel with --listen, its own
+// backend.
+func listenDst(cfg *config.Config) string {
+	if d := strings.TrimSpace(cfg.SNIDefault); d != "" && cfg.SNIRoute != "" {
+		return d
+	}
+	if cfg.Dst != "" {
+		return cfg.Dst
+	}
+	return cfg.TargetAddr
+}
+
+// handleServing runs the tunnel's serving modes on mgr until Ctrl+C, the
+// tunnel ends or a data-plane path stops for good.
+func handleServing(cfg *config.Config, runtime config.RuntimeSettings, enc config.EncryptionSettings, mgr *dp.Manager, tun *ctrl.Response, authToken string, httpClient *http.Client, bearer, csrf string) error {
+	incoming, listen := servingModes(cfg)
+	if !incoming && !listen {
 		return nil
 	}
-	reporter := dp.NewBackendStateReporter()
-	errCh := make(chan error, 1)
+	dp.RecordEncryption(tun.ID, enc)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errCh := make(chan error, 2)
+	var ready <-chan struct{}
+	var mirror *dp.LocalMirror
+	if incoming {
+		reporter := dp.NewBackendStateReporter(cfg.Reporter())
+		stopQueue, err := dp.StartRequestQueue(runtime, reporter)
+		if err != nil {
+			deleteOwnTunnel(cfg, tun.ID, httpClient, bearer, csrf)
+			return servingExit(err)
+		}
+		defer stopQueue()
+		if cfg.LocalMirror != "" {
+			mirror, err = dp.StartLocalMirror(cfg.LocalMirror, tun.ID, cfg.TargetAddr, runtime, reporter)
+			if err != nil {
+				deleteOwnTunnel(cfg, tun.ID, httpClient, bearer, csrf)
+				return servingExit(err)
+			}
+			defer mirror.Close()
+		}
+		serve, dpReady, stop := incomingServe(cfg, runtime, mgr, tun.ID, authToken, reporter)
+		defer stop()
+		ready = dpReady
+		scope := clierrors.PanicScope{Role: "data-plane serve", TunnelID: tun.ID}
+		clierrors.Go(scope, func() {
+			if err := clierrors.Supervise(scope, ctx.Done(), serve); err != nil {
+				errCh <- fmt.Errorf("❌ Data-plane serve stopped: %w", err)
+			}
+		})
+	}
+	// Listen streams are the encrypted ones; DTLS listen streams bypass mgr
+	// and are not encrypted.
+	if listen && enc.Enabled && !isDTLSListen(cfg) {
+		if err := reportEncryption(cfg, runtime, mgr, tun.ID, enc); err != nil {
+			deleteOwnTunnel(cfg, tun.ID, httpClient, bearer, csrf)
+			return err
+		}
+	}
+	if listen {
+		scope := clierrors.PanicScope{Role: "data-plane listen", TunnelID: tun.ID}
+		clierrors.Go(scope, func() {
+			err := clierrors.Supervise(scope, ctx.Done(), func() error {
+				if isDTLSListen(cfg) {
+					return dp.StartDTLSDataPlaneTCPListen(ctx, cfg.ServerURL, runtime.DTLSPortString(), tun.ID, authToken, listenDst(cfg), cfg.ListenAddr)
+				}
+				return dp.ServeListen(mgr, listenDst(cfg), cfg.ListenAddr, enc)
+			})
+			if err != nil && ctx.Err() == nil {
+				errCh <- fmt.Errorf("❌ Data-plane listen stopped: %w", err)
+			}
+		})
+	}
 	tunnelDeletedCh := make(chan struct{})
-	go func() {
-		errCh <- dp.StartDataPlaneServeIncoming(cfg.ServerURL, tun.ID, runtime, reporter, dpAuthToken)
-	}()
-	go ctrl.RunFallbackLifecyclePoller(httpClient, cfg.ServerURL, tun.ID, bearer, func() { close(tunnelDeletedCh) }, runtime.WatchInterval)
-	log.Printf("INFO: TCP expose-local mode active; backend target %s", cfg.TargetAddr)
-	fmt.Printf("\n🔌 Serving TCP over data-plane (expose-local). Backend: %s\n", cfg.TargetAddr)
-	fmt.Println("💡 Tip: If you see 'Backend unreachable', start your backend on the target address.")
-	fmt.Println("\n🔌 Press Ctrl+C to stop.")
+	var endOnce sync.Once
+	tunnelEnd := func() { endOnce.Do(func() { close(tunnelDeletedCh) }) }
+	watcher := ctrl.NewWatcher(cfg.Reporter())
+	// Only a client serving incoming streams can be displaced by another
+	// instance; a listen-only tunnel just opens streams of its own.
+	var conflictCh <-chan error
+	if incoming {
+		watcher.WithInstanceID(runtime.InstanceID)
+		conflictCh = claimTunnelAsync(cfg, runtime, tun, httpClient, bearer, csrf)
+	}
+	startLifecyclePoller(watcher, httpClient, cfg.ServerURL, tun.ID, bearer, tunnelEnd, runtime.WatchInterval, ctx.Done())
+	defer startTunnelKeepalive(cfg, runtime, tun, httpClient, bearer, csrf, tunnelDeletedCh)()
+	// DTLS listen streams bypass mgr and cannot follow a migration.
+	if incoming || !isDTLSListen(cfg) {
+		defer startControlWatch(cfg, runtime, watcher, mgr, tun, httpClient, bearer, tunnelEnd)()
+	}
+
+	if incoming {
+		connected := awaitDataPlane(ready, mgr.Done(), errCh, cfg.ReadyTimeout)
+		defer announceTunnel(cfg, tun)()
+		if !connected {
+			fmt.Printf("⚠️  Data plane not yet connected after %s; requests to the public URL fail until it is\n", cfg.ReadyTimeout)
+		}
+		clierrors.WriteReadyLine(os.Stderr, ctrl.DisplayPublicURL(cfg.ServerURL, tun), connected, cfg.JSONOutput())
+		if cfg.Open {
+			openWhenServed(ctrl.DisplayPublicURL(cfg.ServerURL, tun), ready, ctx.Done())
+		}
+		if mirror != nil {
+			fmt.Printf("🏠 Local mirror: %s (the same service for your LAN, without the round trip through the server)\n", mirror.Addr())
+		}
+	}
+	printServingHints(cfg, tun, incoming, listen)
+	defer startStats(cfg)()
+	defer startRegistry(cfg, tun, incoming, listen)()
+	defer startStatusLine(cfg, tun.ID)()
+	defer dp.StartFDMonitor(cfg.RaiseNoFile)()
+	if incoming {
+		defer dp.StartLeakWatch()()
+	}
+	expiredCh, stopExpiry := startExpiryWatch(tun, cfg.Reporter())
+	defer stopExpiry()
 	sigc := make(chan os.Signal, 1)
 	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+	clierrors.Causes.Start()
+	var err, failed error
 	select {
-	case <-sigc:
-		return nil
+	case sig := <-sigc:
+		reportSignal(sig)
 	case <-tunnelDeletedCh:
-		return nil
+		err = tunnelEnded(watcher)
+	case err = <-conflictCh:
+	case <-expiredCh:
+		clierrors.Causes.Report(clierrors.CauseTunnelGone, 0, "guest tunnel expired")
+		err = guestExpired(cfg, mgr, tun)
+	case <-dp.ByteLimitReached():
+		clierrors.Causes.Report(clierrors.CauseQuota, 0, "tunnel reached --max-bytes-total "+cfg.MaxBytesTotal)
+		err = byteLimitReached(cfg, runtime)
+	case failed = <-errCh:
+	}
+	printTrafficSummary(cfg, tun, httpClient, bearer)
+	dp.WriteStreamSummary(os.Stdout, mgr.ListenerStats(), cfg.MaxStreams)
+	dp.WriteStreamLatencySummary(os.Stdout)
+	dp.WritePingSummary(os.Stdout)
+	dp.WriteDstCommandSummary(os.Stdout)
+	dp.WriteSourceLimitSummary(os.Stdout)
+	dp.WriteTrafficClassSummary(os.Stdout)
+	printPanicSummary(cfg)
+	if failed != nil {
+		deleteOwnTunnel(cfg, tun.ID, httpClient, bearer, csrf)
+		return servingExit(failed)
+	}
+	return err
+}
+
+// incomingServe returns the loop serving the tunnel's incoming streams: on
+// mgr's WebSocket sessions, or with --dp quic or auto on a QUIC connection of
+// their own, which stop closes. ready is closed once a data-plane
+// connection carrying them is up.
+func incomingServe(cfg *config.Config, runtime config.RuntimeSettings, mgr *dp.Manager, tunnelID, authToken string, reporter dp.BackendStateReporter) (serve func() error, ready <-chan struct{}, stop func()) {
+	quic, fallback := cfg.QUICServe()
+	if !quic {
+		return func() error { return dp.ServeIncoming(mgr, reporter) }, mgr.Ready(), func() {}
+	}
+	qm := dp.NewQUICTunnelManager(cfg.ServerURL, tunnelID, authToken, runtime)
+	if fallback && runtime.TransportProbeInterval > 0 {
+		at := dp.NewAutoTransport(qm, mgr, reporter, printTransportSwitch)
+		return at.Serve, eitherReady(qm.Ready(), mgr.Ready()), at.Close
+	}
+	if fallback {
+		return func() error { return dp.ServeIncomingPreferQUIC(qm, mgr, reporter) }, eitherReady(qm.Ready(), mgr.Ready()), qm.Close
+	}
+	return func() error { return dp.ServeIncomingQUIC(qm, reporter) }, qm.Ready(), qm.Close
+}
+
+// printTransportSwitch tells the user that --dp auto moved the tunnel to the
+// other data plane.
+func printTransportSwitch(sw dp.TransportSwitch) {
+	fmt.Printf("🔀 Data plane switched from %s to %s (%s)\n", dataPlaneName(sw.From), dataPlaneName(sw.To), sw.Reason)
+}
+
+func dataPlaneName(dataPlane string) string {
+	if dataPlane == config.DataPlaneQUIC {
+		return "QUIC"
+	}
+	return "WebSocket"
+}
+
+// eitherReady returns a channel that is closed once a or b is.
+func eitherReady(a, b <-chan struct{}) <-chan struct{} {
+	ready := make(chan struct{})
+	clierrors.Go(clierrors.PanicScope{Role: "data-plane ready wait"}, func() {
+		select {
+		case <-a:
+		case <-b:
+		}
+		close(ready)
+	})
+	return ready
+}
+
+// awaitDataPlane waits up to timeout for ready, so that the public URL is
+// printed once requests to it reach this client. It reports false when the
+// data plane did not connect in time, or stopped trying: done is closed or
+// serving failed, in which case the error is put back for handleServing.
+func awaitDataPlane(ready, done <-chan struct{}, errCh chan error, timeout time.Duration) bool {
+	if timeout <= 0 {
+		select {
+		case <-ready:
+			return true
+		default:
+			return false
+		}
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-ready:
+		return true
+	case <-timer.C:
+	case <-done:
 	case err := <-errCh:
-		if err != nil {
-			ctrl.DeleteTunnelWithClient(cfg.ServerURL, tun.ID, httpClient, bearer, csrf)
-			return fmt.Errorf("❌ Data-plane serve stopped: %w", err)
+		errCh <- err
+	}
+	return false
+}
+
+// announceTunnel prints the tunnel's URL block and starts what follows its
+// publication: the --announce mDNS record, the --export-env file and
+// --wait-dns. The returned func stops them.
+func announceTunnel(cfg *config.Config, tun *ctrl.Response) func() {
+	if cfg.TunnelID != "" {
+		ctrl.PrintExistingTunnelInfo(cfg.ServerURL, tun)
+	} else {
+		ctrl.PrintTunnelInfoWithOutput(cfg.Reporter(), cfg.ServerURL, tun)
+	}
+	stopAnnounce := startAnnounce(cfg, tun)
+	stopExport := startExport(cfg, tun)
+	stopDNSWait := startDNSWait(cfg, tun)
+	return func() {
+		stopDNSWait()
+		stopExport()
+		stopAnnounce()
+	}
+}
+
+// printTrafficSummary prints the client's byte accounting next to the
+// server's bytes_used, so that billing disputes have an independent number.
+func printTrafficSummary(cfg *config.Config, tun *ctrl.Response, httpClient *http.Client, bearer string) {
+	serverBytes := int64(-1)
+	if n, ok := ctrl.TunnelBytesUsed(httpClient, cfg.ServerURL, tun.ID, bearer); ok {
+		serverBytes = n
+	}
+	dp.Accounting().WriteSummary(os.Stdout, serverBytes)
+}
+
+// startExpiryWatch runs the remaining-time reminders of a guest tunnel. The
+// returned channel is closed at expiry; it is nil (never ready) for tunnels
+// without an expiry. The func stops the reminders. They are shown on out.
+func startExpiryWatch(tun *ctrl.Response, out clierrors.Reporter) (<-chan struct{}, func()) {
+	if !tun.IsGuest || tun.ExpiresAt.IsZero() {
+		return nil, func() {}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	expired := make(chan struct{})
+	clierrors.Go(clierrors.PanicScope{Role: "expiry watch", TunnelID: tun.ID}, func() {
+		if ctrl.NewExpiryWatch(tun.ExpiresAt, out).Run(ctx) {
+			close(expired)
+		}
+	})
+	return expired, cancel
+}
+
+// guestExpired shuts the data plane down once a guest tunnel's lifetime is
+// over, instead of letting the serving loops reconnect to a tunnel the
+// server no longer knows. Closing mgr ends its sessions and the --listen
+// socket; the serving goroutines then return on their own.
+func guestExpired(cfg *config.Config, mgr *dp.Manager, tun *ctrl.Response) error {
+	mgr.Close()
+	return clierrors.WithExitCode(clierrors.ExitTunnelGone, fmt.Errorf(
+		"⌛ Guest tunnel %s expired at %s.\n   Register at %s and run with --token for longer-lived tunnels",
+		tun.ID, clierrors.FormatTime(tun.ExpiresAt), cfg.ServerURL))
+}
+
+// byteLimitReached ends serving once the tunnel moved its --max-bytes-total.
+// New streams are already refused; open ones get up to --drain-timeout to
+// end before the client exits with ExitQuota.
+func byteLimitReached(cfg *config.Config, runtime config.RuntimeSettings) error {
+	fmt.Printf("\n📏 The tunnel reached --max-bytes-total %s; waiting up to %s for open streams to end\n", cfg.MaxBytesTotal, runtime.DrainTimeout)
+	if open := dp.DrainByteLimited(runtime.DrainTimeout); open > 0 {
+		log.Printf("[WARN] %d streams still open after %s, closing them", open, runtime.DrainTimeout)
+	}
+	return clierrors.WithExitCode(clierrors.ExitQuota, fmt.Errorf("❌ Tunnel stopped: it moved its --max-bytes-total of %s", cfg.MaxBytesTotal))
+}
+
+func printServingHints(cfg *config.Config, tun *ctrl.Response, incoming, listen bool) {
+	switch {
+	case isHTTPProtocol(cfg.Protocol):
+		ctrl.PrintHTTPHintsWithOutput(cfg.Reporter(), tun)
+	case incoming:
+		log.Printf("INFO: TCP expose-local mode active; backend target %s", backendsLabel(cfg))
+		fmt.Printf("\n🔌 Serving TCP over data-plane (expose-local). Backend: %s\n", backendsLabel(cfg))
+	}
+	if incoming {
+		fmt.Println("💡 Tip: If you see 'Backend unreachable', start your backend on the target address.")
+	}
+	if isHTTPProtocol(cfg.Protocol) {
+		fmt.Println("\n🔌 Serving HTTP over data-plane.")
+		switch quic, fallback := cfg.QUICServe(); {
+		case fallback:
+			fmt.Println("📡 Requests are carried over the QUIC data plane when it is reachable, else over WebSocket")
+		case quic:
+			fmt.Println("📡 Requests are carried over the QUIC data plane")
+		}
+	}
+	if listen {
+		fmt.Printf("\n🔌 Listening on %s, forwarding to %s on the server side\n", cfg.ListenAddr, listenDst(cfg))
+		if isDTLSListen(cfg) {
+			fmt.Println("📡 Connections are carried over the DTLS data plane")
+		}
+		if cfg.DstCommand != "" {
+			fmt.Printf("🔀 Per-connection destination from %s (fallback %s)\n", cfg.DstCommand, listenDst(cfg))
+		}
+		if routes := cfg.SNIRoutes(); len(routes) > 0 {
+			fmt.Printf("🔀 Destination by TLS server name: %s (others %s)\n", formatSNIRoutes(routes), listenDst(cfg))
+		}
+	}
+	fmt.Println("\n🔌 Press Ctrl+C to stop.")
+}
+
+// formatSNIRoutes lists routes as name → dst, sorted by name.
+func formatSNIRoutes(routes map[string]string) string {
+	names := slices.Sorted(maps.Keys(routes))
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + " → " + routes[name]
+	}
+	return strings.Join(parts, ", ")
+}
+
+// isDTLSListen reports whether TCP listen mode runs over DTLS (--dp dtls)
+// instead of the WebSocket data plane.
+func isDTLSListen(cfg *config.Config) bool {
+	return cfg.Protocol == "tcp" && strings.EqualFold(cfg.DataPlane, "dtls")
+}
+
+// instanceCheckTimeout bounds how long the server may take to report which
+// client instance serves a freshly connected tunnel.
+const instanceCheckTimeout = 5 * time.Second
+
+// backendsLabel names the backend(s) streams are served from.
+func backendsLabel(cfg *config.Config) string {
+	if len(cfg.LocalTargets) > 1 {
+		return strings.Join(cfg.LocalTargets, ", ")
+	}
+	return cfg.TargetAddr
+}
+
+// claimTunnelAsync runs claimTunnel in the background; the returned channel
+// receives its error, if any, so the serve loop can stop.
+func claimTunnelAsync(cfg *config.Config, runtime config.RuntimeSettings, tun *ctrl.Response, httpClient *http.Client, bearer, csrf string) <-chan error {
+	ch := make(chan error, 1)
+	clierrors.Go(clierrors.PanicScope{Role: "instance claim", TunnelID: tun.ID}, func() {
+		if err := claimTunnel(cfg, runtime, tun, httpClient, bearer, csrf); err != nil {
+			ch <- err
 		}
+	})
+	return ch
+}
+
+// claimTunnel refuses to serve a tunnel that another client instance already
+// serves (the server would split streams between both), or evicts the other
+// instance when --force is set.
+func claimTunnel(cfg *config.Config, runtime config.RuntimeSettings, tun *ctrl.Response, httpClient *http.Client, bearer, csrf string) error {
+	other := ctrl.FindOtherInstance(httpClient, cfg.ServerURL, tun.ID, bearer, runtime.InstanceID, instanceCheckTimeout)
+	if other == nil {
+		return nil
+	}
+	since := clierrors.FormatTimeFrom(other.ConnectedAt, time.Now())
+	if !cfg.Force {
+		return fmt.Errorf("❌ Tunnel %s is already served by client instance %s (connected %s).\n   Stop that client or rerun with --force to take over", tun.ID, clierrors.SanitizeRemote(other.InstanceID), since)
+	}
+	if err := ctrl.TakeOverTunnel(cfg.ServerURL, tun.ID, runtime.InstanceID, httpClient, bearer, csrf); err != nil {
+		return fmt.Errorf("❌ Tunnel takeover failed: %w", err)
+	}
+	fmt.Printf("🔀 Took over tunnel %s from client instance %s (connected %s)\n", tun.ID, clierrors.SanitizeRemote(other.InstanceID), since)
+	return nil
+}
+
+// reportSignal reports sig as the run's terminal cause.
+func reportSignal(sig os.Signal) {
+	name := "SIGTERM"
+	if sig == os.Interrupt {
+		name = "SIGINT"
+	}
+	clierrors.Causes.Report(clierrors.CauseSignal, 0, "received "+name)
+}
+
+// tunnelEnded is the result of a serving mode whose lifecycle watcher fired:
+// a takeover by another instance is a clean exit, deletion or expiry is not.
+func tunnelEnded(watcher *ctrl.Watcher) error {
+	if watcher.Displaced() {
 		return nil
 	}
+	return clierrors.ErrTunnelGone
+}
+
+// servingExit classifies a serving-mode failure: a local listener that could
+// not bind versus a data plane that failed for good.
+func servingExit(err error) error {
+	if clierrors.IsBindError(err) {
+		return clierrors.WithExitCode(clierrors.ExitLocalTarget, err)
+	}
+	if errors.Is(err, dp.ErrByteLimit) {
+		// The one stream of a UDP tunnel reached a byte limit.
+		return clierrors.WithExitCode(clierrors.ExitQuota, err)
+	}
+	return clierrors.WithExitCode(clierrors.ExitDataPlane, err)
+}
+
+// startDNSWait polls a host-based public URL until it resolves when
+// --wait-dns is set. It runs alongside the data plane; the returned func
+// cancels it.
+func startDNSWait(cfg *config.Config, tun *ctrl.Response) func() {
+	publicURL := ctrl.DisplayPublicURL(cfg.ServerURL, tun)
+	host := ctrl.PublicHostname(publicURL)
+	if !cfg.WaitDNS || host == "" {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &ctrl.DNSWaiter{Resolver: ctrl.NewDNSResolver(cfg.DNSServer), Timeout: cfg.WaitDNSTimeout, Out: cfg.Reporter()}
+	clierrors.Go(clierrors.PanicScope{Role: "dns wait", TunnelID: tun.ID}, func() { w.Wait(ctx, host, publicURL) })
+	return cancel
+}
+
+// reportEncryption asks the server to confirm --encrypt and prints the
+// outcome; with --strict an encryption it does not confirm is fatal.
+func reportEncryption(cfg *config.Config, runtime config.RuntimeSettings, mgr *dp.Manager, tunnelID string, enc config.EncryptionSettings) error {
+	status := dp.ConfirmEncryption(mgr, tunnelID, runtime.InstanceID, enc, cfg.Capabilities.Has(protocolv1.FeaturePSKConfirm))
+	fmt.Println(status.Line())
+	clierrors.WriteEncryptionLine(os.Stderr, status.State, status.Cipher, status.KeyID, status.Reason, cfg.JSONOutput())
+	if err := status.Err(); err != nil && cfg.Strict {
+		return clierrors.WithExitCode(clierrors.ExitConfig, fmt.Errorf("❌ %w\n   Example: give the tunnel the same --psk and --psk-kdf on the server, or drop --strict", err))
+	}
+	return nil
+}
+
+// startStatusLine renders live throughput on stderr when --status-line is set
+// and returns the function that stops it. The line starts with the stream
+// encryption marker of tunnelID and, once a buffering feature degraded, the
+// --memory-budget usage.
+func startStatusLine(cfg *config.Config, tunnelID string) func() {
+	if !cfg.StatusLine {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	sampler := dp.NewThroughputSampler(dp.Traffic(), time.Now()).WithBadge(func() string {
+		return strings.TrimSpace(dp.EncryptionStatusOf(tunnelID).Badge() + " " + dp.MemoryBadge())
+	})
+	clierrors.Go(clierrors.PanicScope{Role: "status line"}, func() { sampler.RunStatusLine(cfg.Reporter(), time.Second, stop) })
+	return func() { close(stop) }
+}
+
+// startLifecyclePoller polls the tunnel's lifecycle in the background and
+// calls onTerminal once the tunnel is gone. The tunnel cannot be watched
+// without it, so a panic restarts it until stop is closed.
+func startLifecyclePoller(w *ctrl.Watcher, httpClient *http.Client, serverURL, tunnelID, bearer string, onTerminal func(), interval time.Duration, stop <-chan struct{}) {
+	scope := clierrors.PanicScope{Role: "lifecycle poller", TunnelID: tunnelID}
+	clierrors.Go(scope, func() {
+		_ = clierrors.Supervise(scope, stop, func() error {
+			w.RunFallbackLifecyclePoller(httpClient, serverURL, tunnelID, bearer, onTerminal, interval)
+			return nil
+		})
+	})
+}
+
+// startTunnelKeepalive runs the control-plane keepalive until the returned stop
+// function is called or deleted (the lifecycle poller's channel) is closed.
+func startTunnelKeepalive(cfg *config.Config, runtime config.RuntimeSettings, tun *ctrl.Response, httpClient *http.Client, bearer, csrf string, deleted <-chan struct{}) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	clierrors.Go(clierrors.PanicScope{Role: "tunnel keepalive stop", TunnelID: tun.ID}, func() {
+		select {
+		case <-deleted:
+		case <-stop:
+		}
+		close(done)
+	})
+	clierrors.Go(clierrors.PanicScope{Role: "tunnel keepalive", TunnelID: tun.ID}, func() {
+		ctrl.RunTunnelKeepalive(httpClient, cfg.ServerURL, tun.ID, bearer, csrf, runtime.TunnelKeepalive, !runtime.Capabilities.Has(protocolv1.FeatureKeepalive), done)
+	})
+	return func() { close(stop) }
 }
 
 // handleUDPProtocol delegates to UDP, QUIC, and DTLS packages
@@ -195,16 +991,17 @@ func handleUDPProtocol(cfg *config.Config, runtime config.RuntimeSettings, enc c
 	if cfg.Protocol != "udp" {
 		return nil
 	}
-	if cfg.UDPListen == "" || cfg.UDPDst == "" {
-		return fmt.Errorf("for UDP mode, both --udp-listen and --udp-dst are required")
-	}
-
-	errCh := make(chan error, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	tunnelDeletedCh := make(chan struct{})
-	go ctrl.RunFallbackLifecyclePoller(httpClient, cfg.ServerURL, tun.ID, bearer, func() { close(tunnelDeletedCh) }, runtime.WatchInterval)
+	var deletedOnce sync.Once
+	tunnelDeleted := func() { deletedOnce.Do(func() { close(tunnelDeletedCh) }) }
+	startLifecyclePoller(ctrl.NewWatcher(nil), httpClient, cfg.ServerURL, tun.ID, bearer, tunnelDeleted, runtime.WatchInterval, ctx.Done())
+	defer startTunnelKeepalive(cfg, runtime, tun, httpClient, bearer, csrf, tunnelDeletedCh)()
 	plane := strings.ToLower(cfg.DataPlane)
 
 	strategy := dp.NewStrategy(
+		ctx,
 		plane,
 		cfg.ServerURL,
 		tun.ID,
@@ -218,17 +1015,8 @@ func handleUDPProtocol(cfg *config.Config, runtime config.RuntimeSettings, enc c
 	fmt.Println("\n🔌 Press Ctrl+C to stop.")
 	sigc := make(chan os.Signal, 1)
 	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		errCh <- runUDPStrategy(strategy, cfg.ServerURL, tun.ID, httpClient, bearer, csrf)
-	}()
-	select {
-	case <-sigc:
-		return nil
-	case <-tunnelDeletedCh:
-		return nil
-	case err := <-errCh:
-		return err
-	}
+	defer signal.Stop(sigc)
+	return runUDPStrategy(ctx, strategy, cancel, sigc, tunnelDeletedCh, cfg, tun.ID, httpClient, bearer, csrf)
 }
 
 func isHTTPProtocol(value string) bool {
@@ -254,11 +1042,32 @@ func ensureTCPHasTarget(cfg *config.Config) error {
 
 // --- UDP strategy helpers ----------------------------------------------------
 
-func runUDPStrategy(strategy dp.Strategy, serverURL, tunnelID string, httpClient *http.Client, bearer, csrf string) error {
+// runUDPStrategy runs strategy until it fails, a signal arrives on sigc or
+// the tunnel is deleted. The latter two cancel the strategy and wait for it
+// to close its sockets; only an error the strategy hit on its own is
+// reported with ErrLabel. A panic restarts the strategy until ctx, the
+// strategy's context, is done.
+func runUDPStrategy(ctx context.Context, strategy dp.Strategy, cancel context.CancelFunc, sigc <-chan os.Signal, deleted <-chan struct{}, cfg *config.Config, tunnelID string, httpClient *http.Client, bearer, csrf string) error {
 	fmt.Println(strategy.RunningMessage)
-	if err := strategy.Run(); err != nil {
-		ctrl.DeleteTunnelWithClient(serverURL, tunnelID, httpClient, bearer, csrf)
-		return fmt.Errorf("%s: %w", strategy.ErrLabel, err)
+	done := make(chan error, 1)
+	scope := clierrors.PanicScope{Role: "udp strategy", TunnelID: tunnelID}
+	clierrors.Go(scope, func() { done <- clierrors.Supervise(scope, ctx.Done(), strategy.Run) })
+	clierrors.Causes.Start()
+	var stopErr error
+	select {
+	case err := <-done:
+		if err == nil {
+			return nil
+		}
+		deleteOwnTunnel(cfg, tunnelID, httpClient, bearer, csrf)
+		return servingExit(fmt.Errorf("%s: %w", strategy.ErrLabel, err))
+	case sig := <-sigc:
+		reportSignal(sig)
+	case <-deleted:
+		stopErr = clierrors.ErrTunnelGone
 	}
-	return nil
+	cancel()
+	<-done
+	fmt.Println(strategy.StoppedMessage)
+	return stopErr
 }
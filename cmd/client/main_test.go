@@ -88,3 +88,23 @@ func TestParseUsesEnvSecrets(t *testing.T) {
 		t.Fatalf("Token = %q, want %q", cfg.Token, "env-token")
 	}
 }
+
+func TestParseConfig_ProxyCommandWithPositionalProtocol(t *testing.T) {
+	oldArgs, oldFlag := os.Args, flag.CommandLine
+	oldStdout, oldPayloadOut := os.Stdout, proxyPayloadOut
+	defer func() {
+		os.Args = oldArgs
+		flag.CommandLine = oldFlag
+		os.Stdout, proxyPayloadOut = oldStdout, oldPayloadOut
+	}()
+
+	flag.CommandLine = flag.NewFlagSet("client", flag.ContinueOnError)
+	os.Args = []string{"client", "tcp", "--dst", "example.com:22", "--proxy-command"}
+	cfg, err := parseConfig()
+	if err != nil {
+		t.Fatalf("parseConfig() unexpected error: %v", err)
+	}
+	if cfg.Protocol != "tcp" || cfg.Dst != "example.com:22" || !cfg.ProxyCommand {
+		t.Fatalf("Protocol = %q, Dst = %q, ProxyCommand = %v; want tcp, example.com:22, true", cfg.Protocol, cfg.Dst, cfg.ProxyCommand)
+	}
+}
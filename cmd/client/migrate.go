@@ -0,0 +1,40 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/fortunnels/client/internal/config"
+	ctrl "github.com/fortunnels/client/internal/control"
+	dp "github.com/fortunnels/client/internal/dataplane"
+	clierrors "github.com/fortunnels/client/internal/support"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+// migrateTunnel moves mgr to the node a migrate message names and prints the
+// public URL the tunnel has there. A failed move leaves the tunnel where it
+// is; the old node keeps serving until it drains.
+func migrateTunnel(cfg *config.Config, mgr *dp.Manager, tun *ctrl.Response, p protocolv1.MigratePayload) {
+	if p.TunnelID != "" && p.TunnelID != tun.ID {
+		return
+	}
+	node := clierrors.SanitizeRemote(p.Endpoint)
+	fmt.Printf("🛠️  Server maintenance: moving the tunnel to %s\n", node)
+	if err := mgr.Migrate(p.Endpoint, p.Deadline); err != nil {
+		log.Printf("[WARN] migration to %s failed, staying on the current node: %v", node, err)
+		return
+	}
+	moved := *tun
+	if p.PublicURL != "" {
+		moved.PublicURL = p.PublicURL
+	}
+	publicURL := clierrors.SanitizeRemote(ctrl.DisplayPublicURL(p.Endpoint, &moved))
+	fmt.Printf("✅ Tunnel moved to %s. Public URL: %s\n", node, publicURL)
+	clierrors.WriteMigrateLine(os.Stderr, publicURL, cfg.JSONOutput())
+	updateExport(ctrl.NewExportInfo(p.Endpoint, &moved, cfg.Protocol))
+	updateRegistry(publicURL)
+}
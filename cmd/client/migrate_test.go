@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	dp "github.com/fortunnels/client/internal/dataplane"
+	"github.com/fortunnels/client/internal/support"
+	"github.com/fortunnels/client/internal/testsupport"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+// TestHandleServing_Migrate moves a serving tunnel to another node on a
+// migrate message while requests keep coming in, and checks that none of
+// them fails: new requests reach the new node, a stream opened before the
+// move keeps working on the old one until the deadline.
+func TestHandleServing_Migrate(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "hello from backend")
+	}))
+	defer backend.Close()
+	oldNode := testsupport.NewServer(testsupport.Options{})
+	defer oldNode.Close()
+	newNode := testsupport.NewServer(testsupport.Options{})
+	defer newNode.Close()
+
+	cfg := exitTestConfig(oldNode.URL)
+	cfg.TargetAddr = backend.Listener.Addr().String()
+	tun := oldNode.AddTunnel("http", cfg.TargetAddr)
+	newNode.MirrorTunnel(tun)
+	runtime := cfg.RuntimeSettings()
+	mgr := dp.NewTunnelManager(cfg.ServerURL, tun.ID, "", runtime)
+	defer mgr.Close()
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- handleServing(cfg, runtime, cfg.EncryptionSettings(), mgr, tun, "", nil, "", "") }()
+	require.NoError(t, oldNode.WaitSessions(tun.ID, 1, 5*time.Second))
+	require.NoError(t, oldNode.WaitWatchers(tun.ID, 1, 5*time.Second))
+
+	// The public ingress sends each request to the newest node the tunnel
+	// is connected to.
+	var served, failed atomic.Int64
+	var onNew atomic.Int64
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				node := oldNode
+				if newNode.LiveSessions(tun.ID) > 0 {
+					node = newNode
+					onNew.Add(1)
+				}
+				if err := proxyRequest(node, tun.ID, cfg.TargetAddr); err != nil {
+					failed.Add(1)
+					t.Logf("request failed: %v", err)
+				} else {
+					served.Add(1)
+				}
+			}
+		}()
+	}
+
+	// held is mid-request when the move happens; idle never finishes and
+	// keeps the old session until the deadline.
+	held, err := oldNode.OpenStream(tun.ID, cfg.TargetAddr)
+	require.NoError(t, err)
+	_, err = io.WriteString(held, "GET / HTTP/1.1\r\nHost: backend\r\n")
+	require.NoError(t, err)
+	idle, err := oldNode.OpenStream(tun.ID, cfg.TargetAddr)
+	require.NoError(t, err)
+	defer idle.Close()
+
+	deadline := time.Now().Add(1500 * time.Millisecond)
+	require.NoError(t, oldNode.SendControl(tun.ID, protocolv1.MessageTypeMigrate, protocolv1.MigratePayload{
+		TunnelID: tun.ID, Endpoint: newNode.URL, Deadline: deadline,
+	}))
+	require.NoError(t, newNode.WaitSessions(tun.ID, 1, 5*time.Second))
+	assert.Equal(t, 1, oldNode.LiveSessions(tun.ID), "old session drains instead of closing")
+	_, err = io.WriteString(held, "Connection: close\r\n\r\n")
+	require.NoError(t, err)
+	b, _ := io.ReadAll(held)
+	held.Close()
+	assert.Contains(t, string(b), "hello from backend", "streams opened before the move finish on the old node")
+
+	require.Eventually(t, func() bool { return oldNode.LiveSessions(tun.ID) == 0 }, 5*time.Second, 20*time.Millisecond, "old session closed at the deadline")
+	assert.False(t, time.Now().Before(deadline), "old session closed before the deadline")
+	close(stop)
+	wg.Wait()
+
+	assert.Zero(t, failed.Load(), "failed requests during the move")
+	assert.Positive(t, served.Load())
+	assert.Positive(t, onNew.Load(), "requests reached the new node")
+	assert.Equal(t, 1, newNode.LiveSessions(tun.ID))
+
+	oldNode.RemoveTunnel(tun.ID)
+	select {
+	case err := <-errCh:
+		require.True(t, errors.Is(err, support.ErrTunnelGone), "err = %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("serving did not stop after the tunnel was removed")
+	}
+}
+
+func proxyRequest(node *testsupport.Server, tunnelID, dst string) error {
+	st, err := node.OpenStream(tunnelID, dst)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	if _, err := io.WriteString(st, "GET / HTTP/1.1\r\nHost: backend\r\nConnection: close\r\n\r\n"); err != nil {
+		return err
+	}
+	b, err := io.ReadAll(st)
+	if !strings.Contains(string(b), "hello from backend") {
+		return fmt.Errorf("response %q: %v", b, err)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"errors"
+	"log"
+
+	clierrors "github.com/fortunnels/client/internal/support"
+)
+
+// browser opens the --open URL. It opens one URL per process at most, so
+// reconnects never open another tab; tests replace it to record the call.
+var browser = clierrors.NewBrowser(nil)
+
+// openWhenServed opens url in the default browser once ready is closed, in
+// the background so that startup never waits for it; stop ends the wait.
+// A machine without a browser only gets a log line.
+func openWhenServed(url string, ready, stop <-chan struct{}) {
+	b := browser
+	clierrors.Go(clierrors.PanicScope{Role: "open browser"}, func() {
+		select {
+		case <-ready:
+		case <-stop:
+			return
+		}
+		opened, err := b.OpenOnce(url)
+		switch {
+		case !opened:
+		case errors.Is(err, clierrors.ErrNoBrowser):
+			log.Printf("[INFO] --open: no browser available; open %s yourself", url)
+		case err != nil:
+			log.Printf("[WARN] --open: %v; open %s yourself", err, url)
+		}
+	})
+}
@@ -0,0 +1,75 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	dp "github.com/fortunnels/client/internal/dataplane"
+	"github.com/fortunnels/client/internal/support"
+	"github.com/fortunnels/client/internal/testsupport"
+)
+
+// recordBrowser replaces browser for the test and returns the URLs it was
+// asked to open.
+func recordBrowser(t *testing.T) func() []string {
+	t.Helper()
+	t.Setenv("DISPLAY", ":0")
+	var mu sync.Mutex
+	var urls []string
+	prev := browser
+	browser = support.NewBrowser(func(_ string, args ...string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		urls = append(urls, args[len(args)-1])
+		return nil
+	})
+	t.Cleanup(func() { browser = prev })
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), urls...)
+	}
+}
+
+// TestHandleServing_OpenOnce opens the public URL once the data plane is
+// up, and not again when it reconnects.
+func TestHandleServing_OpenOnce(t *testing.T) {
+	opened := recordBrowser(t)
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	cfg := exitTestConfig(stub.URL)
+	cfg.Open = true
+	tun := stub.AddTunnel("http", cfg.TargetAddr)
+	runtime := cfg.RuntimeSettings()
+	mgr := dp.NewTunnelManager(cfg.ServerURL, tun.ID, "", runtime)
+	defer mgr.Close()
+
+	go func() { _ = handleServing(cfg, runtime, cfg.EncryptionSettings(), mgr, tun, "", nil, "", "") }()
+	require.Eventually(t, func() bool { return len(opened()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{tun.PublicURL}, opened())
+
+	stub.DropSessions(tun.ID)
+	require.NoError(t, stub.WaitSessions(tun.ID, 1, 5*time.Second))
+	openWhenServed("https://recreated.example.com/", mgr.Ready(), nil)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, []string{tun.PublicURL}, opened(), "opened once per process")
+}
+
+func TestOpenWhenServed_WaitsForTheDataPlane(t *testing.T) {
+	opened := recordBrowser(t)
+	ready, stop := make(chan struct{}), make(chan struct{})
+	openWhenServed("https://app.example.com/", ready, stop)
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, opened(), "nothing is served yet")
+
+	close(ready)
+	require.Eventually(t, func() bool { return len(opened()) == 1 }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"https://app.example.com/"}, opened())
+}
@@ -0,0 +1,181 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/fortunnels/client/internal/config"
+)
+
+const profileUsage = "usage: fortunnels profile export <name> [-o file] [tunnel flags] [protocol] [target]\n" +
+	"       fortunnels profile import [--force] <file>"
+
+// profileConfirmIn answers profile import's overwrite question; tests
+// replace it.
+var profileConfirmIn io.Reader = os.Stdin
+
+func runProfileCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, profileUsage)
+		return 2
+	}
+	switch args[0] {
+	case "export":
+		return runProfileExport(args[1:])
+	case "import":
+		return runProfileImport(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown profile command: %s\n", args[0])
+		return 2
+	}
+}
+
+// runProfileExport resolves the tunnel flags that follow the profile name
+// exactly like a normal run would and writes them as a signed profile.
+func runProfileExport(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, profileUsage)
+		return 2
+	}
+	name, rest := args[0], args[1:]
+	out := name + ".profile.json"
+	if len(rest) >= 2 && (rest[0] == "-o" || rest[0] == "--o") {
+		out, rest = rest[1], rest[2:]
+	}
+
+	return withCommandLine(rest, func() int {
+		cfg, err := config.Parse()
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		if err == nil {
+			err = config.Validate(cfg)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 2
+		}
+
+		p, err := config.NewProfile(name, cfg)
+		if err == nil {
+			err = signAndWriteProfile(out, p)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 1
+		}
+		fmt.Printf("Profile %s written to %s (signing key %s)\n", name, out, p.Signature.Fingerprint())
+		printProfileSecrets(p)
+		if _, had := config.StripURLCredentials(cfg.BackendProxy); had {
+			fmt.Println("  backend-proxy: exported without its user and password; add them to --backend-proxy")
+		}
+		return 0
+	})
+}
+
+// withCommandLine runs fn with os.Args and flag.CommandLine set up so that
+// config.Parse reads args as a normal run's command line, and restores both
+// afterwards.
+func withCommandLine(args []string, fn func() int) int {
+	oldArgs, oldFlags := os.Args, flag.CommandLine
+	defer func() { os.Args, flag.CommandLine = oldArgs, oldFlags }()
+	os.Args = append([]string{"fortunnels"}, args...)
+	flag.CommandLine = flag.NewFlagSet("fortunnels", flag.ContinueOnError)
+	config.SetDefaultServerURL(defaultServerURL)
+	return fn()
+}
+
+func signAndWriteProfile(path string, p *config.Profile) error {
+	key, err := config.ProfileSigningKey()
+	if err != nil {
+		return fmt.Errorf("profile signing key: %w", err)
+	}
+	if err := p.Sign(key); err != nil {
+		return err
+	}
+	return config.WriteProfile(path, p)
+}
+
+// runProfileImport verifies a profile file and stores it for --profile.
+// Flags that run a command or write files are listed first, and an existing
+// profile of the same name is only replaced with --force or a confirmation.
+func runProfileImport(args []string) int {
+	force := len(args) > 0 && (args[0] == "--force" || args[0] == "-force")
+	if force {
+		args = args[1:]
+	}
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, profileUsage)
+		return 2
+	}
+	p, err := config.ReadProfile(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	path, err := config.ProfilePath(p.Name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	fmt.Printf("Signed by %s; compare it with the sender's before use.\n", p.Signature.Fingerprint())
+	if sensitive := p.SensitiveFlags(); len(sensitive) > 0 {
+		fmt.Println("⚠️  This profile runs a command or writes files on this machine:")
+		for _, f := range sensitive {
+			fmt.Printf("  %s\n", f)
+		}
+	}
+	if _, statErr := os.Stat(path); statErr == nil && !force && !confirmProfileOverwrite(p.Name) {
+		fmt.Fprintf(os.Stderr, "❌ profile %s already exists at %s; not replaced (use --force)\n", p.Name, path)
+		return 1
+	}
+	if err := config.WriteProfile(path, p); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	fmt.Printf("Profile %s imported to %s\n", p.Name, path)
+	printProfileSecrets(p)
+	fmt.Printf("Run it with: fortunnels --profile %s\n", p.Name)
+	return 0
+}
+
+// confirmProfileOverwrite asks whether to replace the stored profile name;
+// anything but y or yes, including no answer at all, declines.
+func confirmProfileOverwrite(name string) bool {
+	fmt.Printf("Profile %s already exists. Replace it? [y/N] ", name)
+	answer, _ := bufio.NewReader(profileConfirmIn).ReadString('\n')
+	fmt.Println()
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// printProfileSecrets lists where the profile expects its secrets.
+func printProfileSecrets(p *config.Profile) {
+	labels := make([]string, 0, len(p.Secrets))
+	for label := range p.Secrets {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		switch ref := p.Secrets[label]; {
+		case ref.Env != "":
+			fmt.Printf("  %s: set %s\n", label, ref.Env)
+		case ref.File != "":
+			fmt.Printf("  %s: read from %s\n", label, ref.File)
+		case ref.Stdin:
+			fmt.Printf("  %s: read from stdin\n", label)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+)
+
+func TestRunProfileExportImport(t *testing.T) {
+	t.Setenv("FORTUNNELS_CONFIG", filepath.Join(t.TempDir(), "fortunnels.yml"))
+	out := filepath.Join(t.TempDir(), "web.json")
+	const secret = "ft_profile_cmd_secret_token_value"
+	require.Equal(t, 0, runProfileExport([]string{"web", "-o", out, "--token", secret, "--rate-limit", "1MiB", "http", "8080"}))
+	b, err := os.ReadFile(out)
+	require.NoError(t, err)
+	require.NotContains(t, string(b), secret)
+
+	t.Setenv("FORTUNNELS_CONFIG", filepath.Join(t.TempDir(), "fortunnels.yml"))
+	require.Equal(t, 0, runProfileImport([]string{out}))
+	path, err := config.ProfilePath("web")
+	require.NoError(t, err)
+	p, err := config.ReadProfile(path)
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1:8080", p.Flags["local"])
+	require.Equal(t, config.SecretRef{Env: "FORTUNNELS_TOKEN"}, p.Secrets["token"])
+
+	truncated := filepath.Join(t.TempDir(), "bad.json")
+	require.NoError(t, os.WriteFile(truncated, []byte(strings.TrimSuffix(string(b), "}\n")), 0o600))
+	require.Equal(t, 1, runProfileImport([]string{truncated}))
+}
+
+func TestRunProfileImport_ConfirmsOverwrite(t *testing.T) {
+	t.Setenv("FORTUNNELS_CONFIG", filepath.Join(t.TempDir(), "fortunnels.yml"))
+	first := filepath.Join(t.TempDir(), "first.json")
+	second := filepath.Join(t.TempDir(), "second.json")
+	require.Equal(t, 0, runProfileExport([]string{"web", "-o", first, "--rate-limit", "1MiB", "http", "8080"}))
+	require.Equal(t, 0, runProfileExport([]string{"web", "-o", second, "--rate-limit", "2MiB", "http", "8080"}))
+	storedRate := func() string {
+		path, err := config.ProfilePath("web")
+		require.NoError(t, err)
+		p, err := config.ReadProfile(path)
+		require.NoError(t, err)
+		return p.Flags["rate-limit"]
+	}
+	answer := func(s string) {
+		old := profileConfirmIn
+		profileConfirmIn = strings.NewReader(s)
+		t.Cleanup(func() { profileConfirmIn = old })
+	}
+
+	answer("")
+	require.Equal(t, 0, runProfileImport([]string{first}), "a new profile needs no confirmation")
+	require.Equal(t, "1MiB", storedRate())
+
+	answer("")
+	require.Equal(t, 1, runProfileImport([]string{second}), "no answer declines")
+	answer("n\n")
+	require.Equal(t, 1, runProfileImport([]string{second}))
+	require.Equal(t, "1MiB", storedRate())
+
+	answer("y\n")
+	require.Equal(t, 0, runProfileImport([]string{second}))
+	require.Equal(t, "2MiB", storedRate())
+
+	answer("")
+	require.Equal(t, 0, runProfileImport([]string{"--force", first}))
+	require.Equal(t, "1MiB", storedRate())
+}
+
+func TestRunProfileCommandUsage(t *testing.T) {
+	require.Equal(t, 2, runProfileCommand(nil))
+	require.Equal(t, 2, runProfileCommand([]string{"share"}))
+	require.Equal(t, 2, runProfileImport(nil))
+	require.Equal(t, 2, runProfileExport(nil))
+}
@@ -0,0 +1,40 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/fortunnels/client/internal/config"
+	ctrl "github.com/fortunnels/client/internal/control"
+	dp "github.com/fortunnels/client/internal/dataplane"
+)
+
+// proxyPayloadOut receives tunnel payload in --proxy-command mode; it is the
+// real stdout, while os.Stdout is pointed at stderr for all status output.
+var proxyPayloadOut io.Writer = os.Stdout
+
+// enterProxyCommandMode keeps stdout for payload only: every fmt.Print* in
+// the client goes to stderr from here on.
+func enterProxyCommandMode() {
+	proxyPayloadOut = os.Stdout
+	os.Stdout = os.Stderr
+}
+
+// handleTCPProxyCommand bridges stdin/stdout to --dst for ssh's ProxyCommand.
+// A tunnel the client created is removed when the session ends.
+func handleTCPProxyCommand(cfg *config.Config, runtime config.RuntimeSettings, enc config.EncryptionSettings, tun *ctrl.Response, httpClient *http.Client, bearer, csrf, dpAuthToken string) error {
+	if cfg.Protocol != "tcp" || !cfg.ProxyCommand {
+		return nil
+	}
+	defer deleteOwnTunnel(cfg, tun.ID, httpClient, bearer, csrf)
+	defer startTunnelKeepalive(cfg, runtime, tun, httpClient, bearer, csrf, nil)()
+	if err := dp.RunProxyCommand(cfg.ServerURL, tun.ID, cfg.Dst, runtime, enc, dpAuthToken, os.Stdin, proxyPayloadOut); err != nil {
+		return servingExit(fmt.Errorf("❌ Proxy command stopped: %w", err))
+	}
+	return nil
+}
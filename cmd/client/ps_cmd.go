@@ -0,0 +1,231 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fortunnels/client/internal/config"
+	ctrl "github.com/fortunnels/client/internal/control"
+	dp "github.com/fortunnels/client/internal/dataplane"
+	"github.com/fortunnels/client/internal/registry"
+	clierrors "github.com/fortunnels/client/internal/support"
+)
+
+// psCountersTimeout bounds the query of one client's debug endpoint.
+const psCountersTimeout = 500 * time.Millisecond
+
+var (
+	registryMu sync.Mutex
+	// activeRegistry is the registry entry of the tunnel being served, for
+	// migrateTunnel to update; nil with --no-registry.
+	activeRegistry *registry.Entry
+)
+
+// servingMode names the serving modes of a descriptor: the protocol of an
+// incoming tunnel, "listen" for a local listener, both joined by "+".
+func servingMode(cfg *config.Config, incoming, listen bool) (mode, target string) {
+	var modes []string
+	if incoming {
+		modes = append(modes, cfg.Protocol)
+		target = cfg.TargetAddr
+	}
+	if listen {
+		modes = append(modes, "listen")
+		if target == "" {
+			target = cfg.ListenAddr
+		}
+	}
+	return strings.Join(modes, "+"), target
+}
+
+// startRegistry lists the client in the local registry (client ps) with the
+// debug endpoint serving its traffic counters. Errors are logged and never
+// stop the tunnel. The returned func removes the entry.
+func startRegistry(cfg *config.Config, tun *ctrl.Response, incoming, listen bool) func() {
+	if cfg.NoRegistry {
+		return func() {}
+	}
+	dir := registry.Dir()
+	mode, target := servingMode(cfg, incoming, listen)
+	d := registry.Descriptor{
+		TunnelID:  tun.ID,
+		PublicURL: clierrors.SanitizeRemote(ctrl.DisplayPublicURL(cfg.ServerURL, tun)),
+		Mode:      mode,
+		Target:    target,
+	}
+	e, err := registry.Register(dir, d)
+	if err != nil {
+		log.Printf("[WARN] %v; not listed in client ps", err)
+		return func() {}
+	}
+	stopDebug, err := registry.ServeDebug(registry.SocketPath(dir, os.Getpid()), processRegistryCounters)
+	if err != nil {
+		log.Printf("[WARN] registry: %v; client ps shows no traffic for this client", err)
+		stopDebug = func() {}
+	} else if err := e.Update(func(d *registry.Descriptor) { d.DebugSocket = registry.SocketPath(dir, os.Getpid()) }); err != nil {
+		log.Printf("[WARN] %v", err)
+	}
+	registryMu.Lock()
+	activeRegistry = e
+	registryMu.Unlock()
+	return func() {
+		registryMu.Lock()
+		if activeRegistry == e {
+			activeRegistry = nil
+		}
+		registryMu.Unlock()
+		stopDebug()
+		if err := e.Close(); err != nil {
+			log.Printf("[WARN] %v", err)
+		}
+	}
+}
+
+// updateRegistry records the tunnel's new public URL after a migration.
+func updateRegistry(publicURL string) {
+	registryMu.Lock()
+	e := activeRegistry
+	registryMu.Unlock()
+	if e == nil {
+		return
+	}
+	if err := e.Update(func(d *registry.Descriptor) { d.PublicURL = publicURL }); err != nil {
+		log.Printf("[WARN] %v", err)
+	}
+}
+
+// processRegistryCounters are this process's served traffic and memory
+// budget usage for the debug endpoint.
+func processRegistryCounters() registry.Counters {
+	up, down := dp.Traffic().Totals()
+	return registry.Counters{BytesUp: up, BytesDown: down, Streams: dp.Traffic().Streams(), Memory: clierrors.Memory.Usage()}
+}
+
+func runPsCommand(args []string) int {
+	fs := flag.NewFlagSet("ps", flag.ContinueOnError)
+	watch := fs.Bool("watch", false, "Refresh the list every second until Ctrl+C")
+	jsonOut := fs.Bool("json", false, "Print the clients' descriptors as JSON")
+	utc := fs.Bool("utc", false, "Print times in UTC instead of the local zone")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 || (*watch && *jsonOut) {
+		fmt.Fprintln(os.Stderr, "usage: fortunnels ps [--watch | --json] [--utc]")
+		return 2
+	}
+	clierrors.SetUTCTimes(*utc)
+	if *watch {
+		watchClients(os.Stdout, registry.Dir())
+		return 0
+	}
+	clients, err := registry.List(registry.Dir())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	if *jsonOut {
+		if clients == nil {
+			clients = []registry.Descriptor{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(clients); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	printClients(os.Stdout, clients, fetchClientCounters(clients), time.Now())
+	return 0
+}
+
+// watchClients redraws the list of clients in dir on w every second until
+// Ctrl+C.
+func watchClients(w io.Writer, dir string) {
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigc)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		clients, err := registry.List(dir)
+		// Home the cursor and clear the screen before each refresh.
+		fmt.Fprint(w, "\033[H\033[2J")
+		if err != nil {
+			fmt.Fprintf(w, "❌ %v\n", err)
+		} else {
+			printClients(w, clients, fetchClientCounters(clients), time.Now())
+		}
+		select {
+		case <-sigc:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// fetchClientCounters asks each client's debug endpoint for its traffic, in
+// parallel; clients without one, or whose endpoint does not answer, have
+// none.
+func fetchClientCounters(clients []registry.Descriptor) map[int]registry.Counters {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	out := make(map[int]registry.Counters)
+	for _, d := range clients {
+		if d.DebugSocket == "" {
+			continue
+		}
+		wg.Add(1)
+		clierrors.Go(clierrors.PanicScope{Role: "ps counters fetch"}, func() {
+			defer wg.Done()
+			c, err := registry.FetchCounters(d.DebugSocket, psCountersTimeout)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			out[d.PID] = c
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+	return out
+}
+
+// printClients lists the running clients with their traffic where known.
+func printClients(w io.Writer, clients []registry.Descriptor, counters map[int]registry.Counters, now time.Time) {
+	if len(clients) == 0 {
+		fmt.Fprintln(w, "No clients running.")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PID\tTUNNEL\tMODE\tTARGET\tPUBLIC URL\tSTARTED\tUP\tDOWN\tSTREAMS")
+	for _, d := range clients {
+		up, down, streams := "-", "-", "-"
+		if c, ok := counters[d.PID]; ok {
+			up, down, streams = clierrors.FormatBytes(c.BytesUp), clierrors.FormatBytes(c.BytesDown), fmt.Sprint(c.Streams)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", d.PID, d.TunnelID, d.Mode, orDash(d.Target), orDash(d.PublicURL),
+			clierrors.FormatTimeFrom(d.StartedAt, now), up, down, streams)
+	}
+	_ = tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
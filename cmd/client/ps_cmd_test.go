@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+	ctrl "github.com/fortunnels/client/internal/control"
+	"github.com/fortunnels/client/internal/registry"
+)
+
+func TestServingMode(t *testing.T) {
+	cfg := &config.Config{Protocol: "tcp", TargetAddr: "127.0.0.1:22", ListenAddr: "127.0.0.1:5432"}
+	mode, target := servingMode(cfg, true, false)
+	assert.Equal(t, "tcp", mode)
+	assert.Equal(t, "127.0.0.1:22", target)
+	mode, target = servingMode(cfg, false, true)
+	assert.Equal(t, "listen", mode)
+	assert.Equal(t, "127.0.0.1:5432", target)
+	mode, _ = servingMode(cfg, true, true)
+	assert.Equal(t, "tcp+listen", mode)
+}
+
+func TestStartRegistry(t *testing.T) {
+	// Unix socket paths are short; t.TempDir can exceed the limit.
+	runtimeDir, err := os.MkdirTemp("", "ft")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(runtimeDir) })
+	t.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+
+	cfg := &config.Config{ServerURL: "https://fortunnels.ru", Protocol: "http", TargetAddr: "127.0.0.1:3000"}
+	stop := startRegistry(cfg, &ctrl.Response{ID: "t-1", PublicURL: "https://t-1.fortunnels.ru"}, true, false)
+	clients, err := registry.List(registry.Dir())
+	require.NoError(t, err)
+	require.Len(t, clients, 1)
+	d := clients[0]
+	assert.Equal(t, os.Getpid(), d.PID)
+	assert.Equal(t, "t-1", d.TunnelID)
+	assert.Equal(t, "https://t-1.fortunnels.ru", d.PublicURL)
+	assert.Equal(t, "http", d.Mode)
+	require.NotEmpty(t, d.DebugSocket)
+	_, err = registry.FetchCounters(d.DebugSocket, time.Second)
+	require.NoError(t, err)
+
+	updateRegistry("https://moved.fortunnels.ru")
+	clients, err = registry.List(registry.Dir())
+	require.NoError(t, err)
+	require.Len(t, clients, 1)
+	assert.Equal(t, "https://moved.fortunnels.ru", clients[0].PublicURL)
+
+	stop()
+	clients, err = registry.List(registry.Dir())
+	require.NoError(t, err)
+	assert.Empty(t, clients)
+	assert.NoFileExists(t, d.DebugSocket)
+
+	cfg.NoRegistry = true
+	startRegistry(cfg, &ctrl.Response{ID: "t-2"}, true, false)()
+	clients, err = registry.List(registry.Dir())
+	require.NoError(t, err)
+	assert.Empty(t, clients)
+}
+
+func TestPrintClients(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.Local)
+	clients := []registry.Descriptor{
+		{PID: 11, TunnelID: "t-1", Mode: "http", Target: "127.0.0.1:3000", PublicURL: "https://t-1.example", StartedAt: now.Add(-time.Hour)},
+		{PID: 12, TunnelID: "t-2", Mode: "listen", Target: "127.0.0.1:5432", StartedAt: now},
+	}
+	var out bytes.Buffer
+	printClients(&out, clients, map[int]registry.Counters{11: {BytesUp: 2048, BytesDown: 3 << 20, Streams: 4}}, now)
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	require.Len(t, lines, 3)
+	assert.Regexp(t, `^PID\s+TUNNEL\s+MODE\s+TARGET\s+PUBLIC URL\s+STARTED\s+UP\s+DOWN\s+STREAMS$`, string(lines[0]))
+	assert.Regexp(t, `^11\s+t-1\s+http\s+127\.0\.0\.1:3000\s+https://t-1\.example\s+.+\s+2\.0 KiB\s+3\.0 MiB\s+4$`, string(lines[1]))
+	assert.Regexp(t, `^12\s+t-2\s+listen\s+127\.0\.0\.1:5432\s+-\s+.+\s+-\s+-\s+-$`, string(lines[2]), "no debug endpoint")
+
+	out.Reset()
+	printClients(&out, nil, nil, now)
+	assert.Equal(t, "No clients running.\n", out.String())
+}
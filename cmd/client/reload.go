@@ -0,0 +1,178 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fortunnels/client/internal/config"
+	dp "github.com/fortunnels/client/internal/dataplane"
+	clierrors "github.com/fortunnels/client/internal/support"
+)
+
+// reloadFilePollInterval is how often --reload-file's modification time is checked.
+const reloadFilePollInterval = time.Second
+
+// liveSettingsFor returns the reloadable settings as configured at startup.
+func liveSettingsFor(cfg *config.Config, runtime config.RuntimeSettings) dp.LiveSettings {
+	rate, err := config.ParseByteRate(cfg.RateLimit)
+	if err != nil {
+		// Validate already rejected it; never throttle on a bad value.
+		rate = 0
+	}
+	return dp.LiveSettings{
+		RateLimit:        rate,
+		IncomingDstAllow: runtime.IncomingDstAllow,
+		InspectDecode:    runtime.InspectDecode,
+		InspectBodyBytes: runtime.InspectBodyBytes,
+	}
+}
+
+// reloader re-reads the --config file and applies the keys that are safe to
+// change at runtime. Keys missing from the file keep their current value;
+// the tunnel's server, protocol and local target are fixed at startup.
+type reloader struct {
+	cfg     *config.Config
+	startup config.TunnelFileConfig
+	apply   func(dp.LiveSettings)
+
+	mu   sync.Mutex
+	live dp.LiveSettings
+}
+
+func newReloader(cfg *config.Config, live dp.LiveSettings, apply func(dp.LiveSettings)) *reloader {
+	return &reloader{cfg: cfg, startup: cfg.FileTunnel, apply: apply, live: live}
+}
+
+// reload applies the config file's current reloadable keys. An unreadable or
+// invalid file changes nothing.
+func (r *reloader) reload() error {
+	path := r.cfg.ConfigPath
+	fc, err := config.LoadFileConfig(path)
+	if err != nil {
+		return fmt.Errorf("reload %s: %w; keeping the current settings", path, err)
+	}
+	t := fc.Tunnel
+	if err := config.ValidateTunnelFileConfig(t); err != nil {
+		return fmt.Errorf("reload %s: %w; keeping the current settings", path, err)
+	}
+	for _, key := range r.startup.ImmutableChanges(t) {
+		log.Printf("[WARN] reload: ignoring the new tunnel.%s; it identifies the tunnel, restart the client to change it", key)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	next := r.live
+	if strings.TrimSpace(t.RateLimit) != "" {
+		next.RateLimit, _ = config.ParseByteRate(t.RateLimit)
+	}
+	if strings.TrimSpace(t.AllowIncomingDst) != "" {
+		c := *r.cfg
+		c.AllowIncomingDst = t.AllowIncomingDst
+		next.IncomingDstAllow = c.IncomingDstAllowList()
+	}
+	if t.InspectDecode != nil {
+		next.InspectDecode = *t.InspectDecode
+	}
+	if t.InspectBodyBytes != nil {
+		next.InspectBodyBytes = *t.InspectBodyBytes
+	}
+	if level := strings.ToLower(strings.TrimSpace(t.LogLevel)); level != "" {
+		clierrors.SetDebug(level == "debug")
+	}
+	r.live = next
+	r.apply(next)
+	log.Printf("[INFO] config reloaded from %s: rate_limit=%s allow_incoming_dst=%s inspect_decode=%t inspect_body_bytes=%d debug=%t",
+		path, rateLimitLabel(next.RateLimit), strings.Join(next.IncomingDstAllow, ","), next.InspectDecode, next.InspectBodyBytes, clierrors.DebugEnabled())
+	return nil
+}
+
+func rateLimitLabel(bps int64) string {
+	if bps <= 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%dB/s", bps)
+}
+
+// startReloader applies the startup live settings and, when --config is set,
+// reloads it on SIGHUP and whenever --reload-file changes. The returned func
+// stops watching.
+func startReloader(cfg *config.Config, runtime config.RuntimeSettings) func() {
+	live := liveSettingsFor(cfg, runtime)
+	dp.ApplyLiveSettings(live)
+	if cfg.LogLevel != "" {
+		clierrors.SetDebug(cfg.LogLevel == "debug")
+	}
+	if strings.TrimSpace(cfg.ConfigPath) == "" {
+		return func() {}
+	}
+	r := newReloader(cfg, live, dp.ApplyLiveSettings)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	stop := make(chan struct{})
+	scope := clierrors.PanicScope{Role: "reload"}
+	clierrors.Go(scope, func() {
+		// A reload that panics keeps the current settings; SIGHUP keeps working.
+		_ = clierrors.Supervise(scope, stop, func() error {
+			for {
+				select {
+				case <-stop:
+					return nil
+				case <-hup:
+					if err := r.reload(); err != nil {
+						log.Printf("[WARN] %v", err)
+					}
+				}
+			}
+		})
+	})
+	if path := strings.TrimSpace(cfg.ReloadFile); path != "" {
+		clierrors.Go(clierrors.PanicScope{Role: "reload file watch"}, func() {
+			watchReloadFile(path, reloadFilePollInterval, stop, func() {
+				if err := r.reload(); err != nil {
+					log.Printf("[WARN] %v", err)
+				}
+			})
+		})
+	}
+	return func() {
+		signal.Stop(hup)
+		close(stop)
+	}
+}
+
+// watchReloadFile calls onChange whenever path's modification time or size
+// changes, until stop is closed. A missing file is not a change.
+func watchReloadFile(path string, interval time.Duration, stop <-chan struct{}, onChange func()) {
+	stamp := func() (time.Time, int64, bool) {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, 0, false
+		}
+		return fi.ModTime(), fi.Size(), true
+	}
+	lastMod, lastSize, _ := stamp()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		mod, size, ok := stamp()
+		if !ok || (mod.Equal(lastMod) && size == lastSize) {
+			continue
+		}
+		lastMod, lastSize = mod, size
+		onChange()
+	}
+}
@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+	dp "github.com/fortunnels/client/internal/dataplane"
+)
+
+func writeTunnelConfig(t *testing.T, path, tunnel string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte("version: 3\ntunnel:\n"+tunnel), 0o600))
+}
+
+func TestReloader_AppliesReloadableKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fortunnels.yml")
+	writeTunnelConfig(t, path, "  server_url: https://fortunnels.ru\n  rate_limit: 1MiB\n")
+	fc, err := config.LoadFileConfig(path)
+	require.NoError(t, err)
+	cfg := &config.Config{ConfigPath: path, TargetAddr: "127.0.0.1:3000", FileTunnel: fc.Tunnel}
+
+	var applied []dp.LiveSettings
+	r := newReloader(cfg, dp.LiveSettings{RateLimit: 1 << 20, IncomingDstAllow: []string{"127.0.0.1:3000"}}, func(s dp.LiveSettings) {
+		applied = append(applied, s)
+	})
+
+	writeTunnelConfig(t, path, "  server_url: https://other.example\n  rate_limit: 64KiB\n  allow_incoming_dst: 127.0.0.1:9000\n  inspect_decode: true\n")
+	require.NoError(t, r.reload())
+	require.Len(t, applied, 1)
+	require.Equal(t, int64(64<<10), applied[0].RateLimit)
+	require.Equal(t, []string{"127.0.0.1:3000", "127.0.0.1:9000"}, applied[0].IncomingDstAllow)
+	require.True(t, applied[0].InspectDecode)
+
+	// Keys removed from the file keep their current value.
+	writeTunnelConfig(t, path, "  inspect_body_bytes: 128\n")
+	require.NoError(t, r.reload())
+	require.Equal(t, int64(64<<10), applied[1].RateLimit)
+	require.True(t, applied[1].InspectDecode)
+	require.Equal(t, 128, applied[1].InspectBodyBytes)
+}
+
+func TestReloader_InvalidFileKeepsSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fortunnels.yml")
+	writeTunnelConfig(t, path, "  rate_limit: 1MiB\n")
+	cfg := &config.Config{ConfigPath: path}
+	calls := 0
+	r := newReloader(cfg, dp.LiveSettings{RateLimit: 1 << 20}, func(dp.LiveSettings) { calls++ })
+
+	writeTunnelConfig(t, path, "  rate_limit: fast\n")
+	require.ErrorContains(t, r.reload(), "tunnel.rate_limit")
+	require.NoError(t, os.WriteFile(path, []byte("version: [\n"), 0o600))
+	require.ErrorContains(t, r.reload(), "keeping the current settings")
+	require.Zero(t, calls)
+}
+
+func TestWatchReloadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reload")
+	require.NoError(t, os.WriteFile(path, []byte("a"), 0o600))
+	changed := make(chan struct{}, 4)
+	stop := make(chan struct{})
+	defer close(stop)
+	go watchReloadFile(path, 5*time.Millisecond, stop, func() { changed <- struct{}{} })
+
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case <-changed:
+		t.Fatal("reloaded without a change")
+	default:
+	}
+	require.NoError(t, os.WriteFile(path, []byte("ab"), 0o600))
+	select {
+	case <-changed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("change was not noticed")
+	}
+}
@@ -0,0 +1,436 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/fortunnels/client/internal/auth"
+	"github.com/fortunnels/client/internal/config"
+	ctrl "github.com/fortunnels/client/internal/control"
+	dp "github.com/fortunnels/client/internal/dataplane"
+	clierrors "github.com/fortunnels/client/internal/support"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+const runUsage = "usage: fortunnels run <script.yaml> [server and auth flags]"
+
+const (
+	defaultWaitHealthyTimeout = 30 * time.Second
+	healthPollInterval        = 200 * time.Millisecond
+)
+
+// batchScript is a `fortunnels run` script: steps executed in order with one
+// authenticated session.
+type batchScript struct {
+	Steps []batchStep `yaml:"steps"`
+}
+
+// batchStep holds exactly one action. A failed step aborts the run and
+// deletes the tunnels it created, unless ContinueOnError is set; the failure
+// is then only reported.
+type batchStep struct {
+	Name            string           `yaml:"name,omitempty"`
+	ContinueOnError bool             `yaml:"continue_on_error,omitempty"`
+	Create          *createStep      `yaml:"create,omitempty"`
+	WaitHealthy     *waitHealthyStep `yaml:"wait_healthy,omitempty"`
+	Exec            *execStep        `yaml:"exec,omitempty"`
+	Delete          *deleteStep      `yaml:"delete,omitempty"`
+}
+
+// createStep creates a tunnel that later steps refer to by Tunnel.
+type createStep struct {
+	Tunnel   string `yaml:"tunnel"`
+	Protocol string `yaml:"protocol,omitempty"`
+	Local    string `yaml:"local"`
+}
+
+// waitHealthyStep starts serving the tunnel and waits until its data-plane
+// session is up and the server reports it active.
+type waitHealthyStep struct {
+	Tunnel  string `yaml:"tunnel"`
+	Timeout string `yaml:"timeout,omitempty"`
+}
+
+// execStep runs a local command with TUNNEL_URL and TUNNEL_ID of Tunnel, if
+// set, in its environment.
+type execStep struct {
+	Tunnel  string   `yaml:"tunnel,omitempty"`
+	Command []string `yaml:"command"`
+	Timeout string   `yaml:"timeout,omitempty"`
+}
+
+type deleteStep struct {
+	Tunnel string `yaml:"tunnel"`
+}
+
+// action returns the step's kind and the tunnel it refers to; validate has
+// ensured there is exactly one.
+func (s batchStep) action() (kind, tunnel string) {
+	switch {
+	case s.Create != nil:
+		return "create", s.Create.Tunnel
+	case s.WaitHealthy != nil:
+		return "wait_healthy", s.WaitHealthy.Tunnel
+	case s.Exec != nil:
+		return "exec", s.Exec.Tunnel
+	case s.Delete != nil:
+		return "delete", s.Delete.Tunnel
+	}
+	return "", ""
+}
+
+func (s batchStep) label() string {
+	kind, tunnel := s.action()
+	switch {
+	case s.Name != "":
+		return s.Name
+	case tunnel != "":
+		return kind + " " + tunnel
+	}
+	return kind
+}
+
+// loadBatchScript reads and checks a script: one action per step, tunnels
+// created before they are used and valid timeouts.
+func loadBatchScript(path string) (*batchScript, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var script batchScript
+	if err := yaml.Unmarshal(b, &script); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if len(script.Steps) == 0 {
+		return nil, fmt.Errorf("%s: no steps", path)
+	}
+	created := map[string]bool{}
+	for i, s := range script.Steps {
+		if err := s.validate(created); err != nil {
+			return nil, fmt.Errorf("%s: step %d: %w", path, i+1, err)
+		}
+	}
+	return &script, nil
+}
+
+func (s batchStep) validate(created map[string]bool) error {
+	actions := 0
+	for _, set := range []bool{s.Create != nil, s.WaitHealthy != nil, s.Exec != nil, s.Delete != nil} {
+		if set {
+			actions++
+		}
+	}
+	if actions != 1 {
+		return errors.New("needs exactly one of create, wait_healthy, exec, delete")
+	}
+	kind, tunnel := s.action()
+	switch {
+	case s.Create != nil:
+		if tunnel == "" || strings.TrimSpace(s.Create.Local) == "" {
+			return errors.New("create needs tunnel and local")
+		}
+		if created[tunnel] {
+			return fmt.Errorf("tunnel %q is created twice", tunnel)
+		}
+		created[tunnel] = true
+		return nil
+	case s.WaitHealthy != nil:
+		if err := validateStepTimeout(s.WaitHealthy.Timeout); err != nil {
+			return err
+		}
+	case s.Exec != nil:
+		if len(s.Exec.Command) == 0 {
+			return errors.New("exec needs a command")
+		}
+		if err := validateStepTimeout(s.Exec.Timeout); err != nil {
+			return err
+		}
+		if tunnel == "" {
+			return nil
+		}
+	}
+	if !created[tunnel] {
+		return fmt.Errorf("%s refers to tunnel %q, which no earlier step creates", kind, tunnel)
+	}
+	return nil
+}
+
+func validateStepTimeout(value string) error {
+	if value == "" {
+		return nil
+	}
+	if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+		return fmt.Errorf("invalid timeout %q (e.g. 30s)", value)
+	}
+	return nil
+}
+
+// stepTimeout parses a timeout that loadBatchScript has checked.
+func stepTimeout(value string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(value); err == nil {
+		return d
+	}
+	return def
+}
+
+// runRunCommand executes a batch script against the server the flags select.
+func runRunCommand(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintln(os.Stderr, runUsage)
+		return 2
+	}
+	script, err := loadBatchScript(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+	return withCommandLine(args[1:], func() int {
+		cfg, err := config.Parse()
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		if err == nil {
+			applyTimeZone(cfg)
+			err = validateRunServer(cfg)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 2
+		}
+		return clierrors.ExitCode(runBatch(cfg, script, os.Stdout))
+	})
+}
+
+// validateRunServer checks only what a batch run uses of the tunnel flags:
+// the server URL.
+func validateRunServer(cfg *config.Config) error {
+	probe := *cfg
+	probe.Protocol, probe.TargetAddr, probe.ListenAddr = protoHTTP, "127.0.0.1:1", ""
+	return config.Validate(&probe)
+}
+
+// batchRun is the state shared by the steps of one script: the
+// authenticated control-plane session and the tunnels created so far, each
+// with the Manager that serves it once a step needs the data plane.
+type batchRun struct {
+	cfg        *config.Config
+	httpClient *http.Client
+	bearer     string
+	csrf       string
+	out        io.Writer
+
+	tunnels map[string]*batchTunnel
+	// order lists tunnel names in creation order, for cleanup.
+	order []string
+}
+
+type batchTunnel struct {
+	tun     *ctrl.Response
+	cfg     config.Config
+	mgr     *dp.Manager
+	deleted bool
+}
+
+// runBatch authenticates once and runs the steps of script in order. It
+// returns the first error of a step without continue_on_error, after
+// deleting every tunnel the run created.
+func runBatch(cfg *config.Config, script *batchScript, out io.Writer) error {
+	control := setupControlHTTP(cfg)
+	httpClient, bearer, csrf, err := auth.SetupAuthentication(cfg, control)
+	if err != nil {
+		return clierrors.WithExitCode(clierrors.ExitAuth, fmt.Errorf("❌ Authentication failed: %w", err))
+	}
+	if httpClient == nil {
+		httpClient = control
+	}
+	r := &batchRun{cfg: cfg, httpClient: httpClient, bearer: bearer, csrf: csrf, out: out, tunnels: map[string]*batchTunnel{}}
+	defer r.cleanup()
+
+	for i, step := range script.Steps {
+		fmt.Fprintf(out, "▶️  [%d/%d] %s\n", i+1, len(script.Steps), step.label())
+		start := time.Now()
+		err := r.runStep(step)
+		elapsed := time.Since(start).Round(time.Millisecond)
+		switch {
+		case err == nil:
+			fmt.Fprintf(out, "✅ [%d/%d] %s (%s)\n", i+1, len(script.Steps), step.label(), elapsed)
+		case step.ContinueOnError:
+			fmt.Fprintf(out, "⚠️  [%d/%d] %s failed, continuing: %v\n", i+1, len(script.Steps), step.label(), err)
+		default:
+			fmt.Fprintf(out, "❌ [%d/%d] %s failed: %v\n", i+1, len(script.Steps), step.label(), err)
+			return err
+		}
+	}
+	fmt.Fprintf(out, "🏁 %d steps done\n", len(script.Steps))
+	return nil
+}
+
+func (r *batchRun) runStep(step batchStep) error {
+	switch {
+	case step.Create != nil:
+		return r.create(step.Create)
+	case step.WaitHealthy != nil:
+		return r.waitHealthy(step.WaitHealthy)
+	case step.Exec != nil:
+		return r.exec(step.Exec)
+	case step.Delete != nil:
+		return r.delete(step.Delete.Tunnel)
+	}
+	return errors.New("empty step")
+}
+
+func (r *batchRun) create(s *createStep) error {
+	tc := *r.cfg
+	tc.Protocol = protoHTTP
+	if s.Protocol != "" {
+		tc.Protocol = strings.ToLower(s.Protocol)
+	}
+	tc.TargetAddr, tc.LocalTargets = strings.TrimSpace(s.Local), nil
+	tun, err := ctrl.CreateTunnelWithClient(tc.ServerURL, tc.TargetAddr, tc.Protocol, tc.UserID, r.httpClient, r.bearer, r.csrf)
+	if err != nil {
+		return clierrors.HandleTunnelCreationError(err, tc.ServerURL)
+	}
+	r.tunnels[s.Tunnel] = &batchTunnel{tun: tun, cfg: tc}
+	r.order = append(r.order, s.Tunnel)
+	fmt.Fprintf(r.out, "   🔗 %s: %s (%s)\n", s.Tunnel, ctrl.DisplayPublicURL(tc.ServerURL, tun), tun.ID)
+	return nil
+}
+
+// lookup returns a tunnel that was created and not deleted yet.
+func (r *batchRun) lookup(name string) (*batchTunnel, error) {
+	bt := r.tunnels[name]
+	if bt == nil || bt.deleted {
+		return nil, fmt.Errorf("tunnel %q does not exist (creation failed or already deleted)", name)
+	}
+	return bt, nil
+}
+
+// waitHealthy serves the tunnel like a normal run and polls until the
+// data-plane session is up and the server reports the tunnel active.
+func (r *batchRun) waitHealthy(s *waitHealthyStep) error {
+	bt, err := r.lookup(s.Tunnel)
+	if err != nil {
+		return err
+	}
+	if bt.mgr == nil {
+		bt.mgr = serveTunnel(&bt.cfg, bt.tun, r.out)
+	}
+	return waitTunnelHealthy(r.cfg.ServerURL, r.httpClient, r.bearer, bt.mgr, bt.tun.ID, stepTimeout(s.Timeout, defaultWaitHealthyTimeout))
+}
+
+// waitTunnelHealthy polls until the data-plane session of mgr is up and the
+// server reports the tunnel active, for at most timeout.
+func waitTunnelHealthy(serverURL string, httpClient *http.Client, bearer string, mgr *dp.Manager, tunnelID string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	status := "unknown"
+	for {
+		if mgr.Generation() > 0 {
+			tun, err := ctrl.GetTunnel(serverURL, tunnelID, httpClient, bearer)
+			if errors.Is(err, ctrl.ErrTunnelNotFound) {
+				return clierrors.WithExitCode(clierrors.ExitTunnelGone, fmt.Errorf("tunnel %s: %w", tunnelID, err))
+			}
+			if err == nil {
+				if tun.Status == protocolv1.StatusActive {
+					return nil
+				}
+				status = tun.Status
+			}
+		} else {
+			status = "data plane not connected"
+		}
+		if !time.Now().Before(deadline) {
+			return clierrors.WithExitCode(clierrors.ExitDataPlane, fmt.Errorf("tunnel %s not healthy after %s (%s)", tunnelID, timeout, status))
+		}
+		time.Sleep(healthPollInterval)
+	}
+}
+
+// serveTunnel serves the incoming streams of tun like a normal run until the
+// returned Manager is closed. A data plane that stops on its own is reported
+// on out.
+func serveTunnel(cfg *config.Config, tun *ctrl.Response, out io.Writer) *dp.Manager {
+	runtime := cfg.RuntimeSettings()
+	runtime.InstanceID = clierrors.NewInstanceID()
+	authToken := auth.ComputeDataPlaneAuthWithPSK(tun.ID, cfg.DPAuthToken, cfg.DPAuthSecret, cfg.PSK, cfg.EncryptionSettings().Enabled)
+	mgr := dp.NewTunnelManager(cfg.ServerURL, tun.ID, authToken, runtime)
+	clierrors.Go(clierrors.PanicScope{Role: "data-plane serve", TunnelID: tun.ID}, func() {
+		if err := dp.ServeIncoming(mgr, dp.NewBackendStateReporter(cfg.Reporter())); err != nil {
+			select {
+			case <-mgr.Done():
+			default:
+				fmt.Fprintf(out, "   ⚠️  data plane of %s stopped: %v\n", tun.ID, err)
+			}
+		}
+	})
+	return mgr
+}
+
+func (r *batchRun) exec(s *execStep) error {
+	env := os.Environ()
+	if s.Tunnel != "" {
+		bt, err := r.lookup(s.Tunnel)
+		if err != nil {
+			return err
+		}
+		env = append(env, "TUNNEL_URL="+ctrl.DisplayPublicURL(bt.cfg.ServerURL, bt.tun), "TUNNEL_ID="+bt.tun.ID)
+	}
+	ctx := context.Background()
+	if s.Timeout != "" {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, stepTimeout(s.Timeout, 0))
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, s.Command[0], s.Command[1:]...)
+	cmd.Env = env
+	cmd.Stdout, cmd.Stderr = r.out, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w", strings.Join(s.Command, " "), err)
+	}
+	return nil
+}
+
+func (r *batchRun) delete(name string) error {
+	bt, err := r.lookup(name)
+	if err != nil {
+		return err
+	}
+	if bt.mgr != nil {
+		bt.mgr.Close()
+		bt.mgr = nil
+	}
+	if err := ctrl.DeleteTunnel(r.cfg.ServerURL, bt.tun.ID, r.httpClient, r.bearer, r.csrf); err != nil {
+		return fmt.Errorf("delete tunnel %s: %w", bt.tun.ID, err)
+	}
+	bt.deleted = true
+	return nil
+}
+
+// cleanup stops serving and deletes the tunnels the run created and did not
+// delete, newest first.
+func (r *batchRun) cleanup() {
+	for i := len(r.order) - 1; i >= 0; i-- {
+		name := r.order[i]
+		bt := r.tunnels[name]
+		if bt.deleted {
+			continue
+		}
+		if err := r.delete(name); err != nil {
+			fmt.Fprintf(r.out, "⚠️  cleanup of %s failed: %v\n", name, err)
+			continue
+		}
+		fmt.Fprintf(r.out, "🧹 deleted tunnel %s (%s)\n", name, bt.tun.ID)
+	}
+}
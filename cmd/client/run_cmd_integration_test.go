@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+//go:build integration
+
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	ctrl "github.com/fortunnels/client/internal/control"
+	"github.com/fortunnels/client/internal/support"
+	"github.com/fortunnels/client/internal/testsupport"
+)
+
+func runBatchAgainst(t *testing.T, stub *testsupport.Server, path string) (string, error) {
+	t.Helper()
+	t.Setenv("FORTUNNELS_CONFIG", filepath.Join(t.TempDir(), "fortunnels.yml"))
+	script, err := loadBatchScript(path)
+	require.NoError(t, err)
+	cfg := exitTestConfig(stub.URL)
+	var out bytes.Buffer
+	err = runBatch(cfg, script, &out)
+	t.Log(out.String())
+	return out.String(), err
+}
+
+func assertTunnelGone(t *testing.T, stub *testsupport.Server, id string) {
+	t.Helper()
+	_, err := ctrl.GetTunnel(stub.URL, id, nil, "")
+	assert.ErrorIs(t, err, ctrl.ErrTunnelNotFound, "tunnel %s", id)
+}
+
+func TestRunCommand_SampleScriptAgainstStub(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	t.Setenv("FORTUNNELS_CONFIG", filepath.Join(t.TempDir(), "fortunnels.yml"))
+
+	require.Equal(t, 0, runRunCommand([]string{"../../examples/batch-smoke.yaml", "--server", stub.URL}))
+	assert.Equal(t, 1, stub.SessionCount("stub-1"), "wait_healthy served the tunnel over one data-plane session")
+	assertTunnelGone(t, stub, "stub-1")
+}
+
+func TestRunBatch_FailingExecCleansUp(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	path := writeBatchScript(t, `steps:
+  - create: {tunnel: web, local: 127.0.0.1:8000}
+  - create: {tunnel: db, protocol: tcp, local: 127.0.0.1:5432}
+  - wait_healthy: {tunnel: web, timeout: 10s}
+  - name: failing smoke test
+    exec: {tunnel: web, command: [sh, -c, "echo url=$TUNNEL_URL; exit 3"]}
+  - delete: {tunnel: web}
+`)
+	out, err := runBatchAgainst(t, stub, path)
+	require.Error(t, err)
+	assert.Equal(t, support.ExitError, support.ExitCode(err))
+	assert.Contains(t, out, "url="+stub.URL+"/t/stub-1/")
+	assert.Contains(t, out, "❌ [4/5] failing smoke test failed")
+	assert.NotContains(t, out, "[5/5]")
+	assert.Contains(t, out, "🧹 deleted tunnel db (stub-2)")
+	assert.Contains(t, out, "🧹 deleted tunnel web (stub-1)")
+	assertTunnelGone(t, stub, "stub-1")
+	assertTunnelGone(t, stub, "stub-2")
+}
+
+func TestRunBatch_ContinueOnError(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	path := writeBatchScript(t, `steps:
+  - create: {tunnel: web, local: 127.0.0.1:8000}
+  - exec: {command: ["false"]}
+    continue_on_error: true
+  - delete: {tunnel: web}
+`)
+	out, err := runBatchAgainst(t, stub, path)
+	require.NoError(t, err)
+	assert.Contains(t, out, "⚠️  [2/3] exec failed, continuing")
+	assert.Contains(t, out, "✅ [3/3] delete web")
+	assert.NotContains(t, out, "🧹")
+	assertTunnelGone(t, stub, "stub-1")
+}
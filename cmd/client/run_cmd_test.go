@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeBatchScript(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "script.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(body), 0o600))
+	return path
+}
+
+func TestLoadBatchScript_Sample(t *testing.T) {
+	script, err := loadBatchScript("../../examples/batch-smoke.yaml")
+	require.NoError(t, err)
+	var labels []string
+	for _, s := range script.Steps {
+		labels = append(labels, s.label())
+	}
+	assert.Equal(t, []string{"create web", "wait_healthy web", "print the public URL", "smoke test", "delete web"}, labels)
+}
+
+func TestLoadBatchScript_Errors(t *testing.T) {
+	tests := []struct {
+		name, body, want string
+	}{
+		{"no steps", "steps: []\n", "no steps"},
+		{"malformed", "steps: [\n", "parse"},
+		{"no action", "steps:\n  - name: x\n", "exactly one of"},
+		{"two actions", "steps:\n  - create: {tunnel: a, local: ':1'}\n    delete: {tunnel: a}\n", "exactly one of"},
+		{"create without local", "steps:\n  - create: {tunnel: a}\n", "create needs tunnel and local"},
+		{"created twice", "steps:\n  - create: {tunnel: a, local: ':1'}\n  - create: {tunnel: a, local: ':2'}\n", "created twice"},
+		{"unknown tunnel", "steps:\n  - delete: {tunnel: a}\n", `step 1: delete refers to tunnel "a"`},
+		{"used before creation", "steps:\n  - wait_healthy: {tunnel: a}\n  - create: {tunnel: a, local: ':1'}\n", "no earlier step creates"},
+		{"exec without command", "steps:\n  - exec: {command: []}\n", "exec needs a command"},
+		{"bad timeout", "steps:\n  - create: {tunnel: a, local: ':1'}\n  - wait_healthy: {tunnel: a, timeout: soon}\n", `invalid timeout "soon"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadBatchScript(writeBatchScript(t, tt.body))
+			require.ErrorContains(t, err, tt.want)
+		})
+	}
+
+	_, err := loadBatchScript(writeBatchScript(t, "steps:\n  - exec: {command: [true]}\n"))
+	require.NoError(t, err, "exec needs no tunnel")
+}
+
+func TestRunRunCommandUsage(t *testing.T) {
+	assert.Equal(t, 2, runRunCommand(nil))
+	assert.Equal(t, 2, runRunCommand([]string{"--server", "http://127.0.0.1:1"}))
+	assert.Equal(t, 2, runRunCommand([]string{filepath.Join(t.TempDir(), "missing.yaml")}))
+}
@@ -0,0 +1,443 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+	ctrl "github.com/fortunnels/client/internal/control"
+	dp "github.com/fortunnels/client/internal/dataplane"
+	"github.com/fortunnels/client/internal/support"
+	"github.com/fortunnels/client/internal/testsupport"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+func TestServingModes(t *testing.T) {
+	tests := []struct {
+		name             string
+		cfg              config.Config
+		incoming, listen bool
+	}{
+		{"http", config.Config{Protocol: "http"}, true, false},
+		{"https with listen", config.Config{Protocol: "https", ListenAddr: ":4000"}, true, true},
+		{"tcp expose-local", config.Config{Protocol: "tcp"}, true, false},
+		{"tcp listen", config.Config{Protocol: "tcp", ListenAddr: ":4000"}, false, true},
+		{"tcp proxy-command", config.Config{Protocol: "tcp", ProxyCommand: true}, false, false},
+		{"udp", config.Config{Protocol: "udp"}, false, false},
+	}
+	for _, tt := range tests {
+		incoming, listen := servingModes(&tt.cfg)
+		assert.Equal(t, tt.incoming, incoming, tt.name)
+		assert.Equal(t, tt.listen, listen, tt.name)
+	}
+	assert.Equal(t, "127.0.0.1:3000", listenDst(&config.Config{TargetAddr: "127.0.0.1:3000"}))
+	assert.Equal(t, "db:5432", listenDst(&config.Config{TargetAddr: "127.0.0.1:3000", Dst: "db:5432"}))
+}
+
+// TestHandleServing_HTTPWithListen reaches one backend both as an HTTP
+// tunnel (server-opened streams) and through --listen (client-opened
+// streams) over a single data-plane session.
+func TestHandleServing_HTTPWithListen(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "hello from backend")
+	}))
+	defer backend.Close()
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+
+	cfg := exitTestConfig(stub.URL)
+	cfg.TargetAddr = backend.Listener.Addr().String()
+	cfg.ListenAddr = freeTCPAddr(t)
+	tun := stub.AddTunnel("http", cfg.TargetAddr)
+	runtime := cfg.RuntimeSettings()
+	mgr := dp.NewTunnelManager(cfg.ServerURL, tun.ID, "", runtime)
+	defer mgr.Close()
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- handleServing(cfg, runtime, cfg.EncryptionSettings(), mgr, tun, "", nil, "", "") }()
+	require.NoError(t, stub.WaitSessions(tun.ID, 1, 5*time.Second))
+
+	stream, err := stub.OpenStream(tun.ID, cfg.TargetAddr)
+	require.NoError(t, err)
+	assert.Contains(t, httpGet(t, stream), "hello from backend", "HTTP tunnel path")
+
+	var conn net.Conn
+	require.Eventually(t, func() bool {
+		conn, err = net.Dial("tcp", cfg.ListenAddr)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Contains(t, httpGet(t, conn), "hello from backend", "raw TCP path through --listen")
+
+	assert.Equal(t, 1, stub.SessionCount(tun.ID), "both paths share one WebSocket connection")
+
+	stub.RemoveTunnel(tun.ID)
+	select {
+	case err := <-errCh:
+		require.True(t, errors.Is(err, support.ErrTunnelGone), "err = %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("serving did not stop after the tunnel was removed")
+	}
+}
+
+// encryptedListenConfig is a --listen tcp tunnel with --encrypt against a
+// server announcing psk_confirm.
+func encryptedListenConfig(t *testing.T, serverURL string) *config.Config {
+	cfg := exitTestConfig(serverURL)
+	cfg.Protocol = "tcp"
+	cfg.ListenAddr = freeTCPAddr(t)
+	cfg.Encrypt, cfg.PSK, cfg.PSKKDF = true, "correct horse battery staple", "legacy"
+	cfg.Capabilities = config.NewCapabilities(&protocolv1.ServerCapabilities{Features: []string{protocolv1.FeaturePSKKDF, protocolv1.FeaturePSKConfirm}})
+	return cfg
+}
+
+// TestHandleServing_EncryptionConfirmed prints the confirmed encryption with
+// the server's key ID.
+func TestHandleServing_EncryptionConfirmed(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{PSK: "correct horse battery staple", PSKKeyID: 2})
+	defer stub.Close()
+	out := captureStdout(t)
+	cfg := encryptedListenConfig(t, stub.URL)
+	tun := stub.AddTunnel("tcp", cfg.TargetAddr)
+	runtime := cfg.RuntimeSettings()
+	mgr := dp.NewTunnelManager(cfg.ServerURL, tun.ID, "", runtime)
+	defer mgr.Close()
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- handleServing(cfg, runtime, cfg.EncryptionSettings(), mgr, tun, "", nil, "", "") }()
+	require.Eventually(t, func() bool { return out.find("🔒 stream encryption: active (XChaCha20-Poly1305, key id 2)") >= 0 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, dp.EncryptionActive, dp.EncryptionStatusOf(tun.ID).State)
+
+	stub.RemoveTunnel(tun.ID)
+	select {
+	case err := <-errCh:
+		require.True(t, errors.Is(err, support.ErrTunnelGone), "err = %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("serving did not stop after the tunnel was removed")
+	}
+}
+
+// TestHandleServing_StrictEncryption refuses to serve with --strict when the
+// server has no PSK for the tunnel, and only warns without it.
+func TestHandleServing_StrictEncryption(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	out := captureStdout(t)
+
+	cfg := encryptedListenConfig(t, stub.URL)
+	cfg.Strict = true
+	tun := stub.AddTunnel("tcp", cfg.TargetAddr)
+	runtime := cfg.RuntimeSettings()
+	mgr := dp.NewTunnelManager(cfg.ServerURL, tun.ID, "", runtime)
+	defer mgr.Close()
+	err := handleServing(cfg, runtime, cfg.EncryptionSettings(), mgr, tun, "", nil, "", "")
+	require.Error(t, err)
+	assert.Equal(t, support.ExitConfig, support.ExitCode(err))
+	assert.Contains(t, err.Error(), "not acknowledged by the server: server: no PSK is configured for this tunnel")
+	assert.GreaterOrEqual(t, out.find("stream encryption requested but NOT acknowledged by server"), 0)
+
+	cfg.Strict = false
+	tun = stub.AddTunnel("tcp", cfg.TargetAddr)
+	mgr2 := dp.NewTunnelManager(cfg.ServerURL, tun.ID, "", runtime)
+	defer mgr2.Close()
+	errCh := make(chan error, 1)
+	go func() { errCh <- handleServing(cfg, runtime, cfg.EncryptionSettings(), mgr2, tun, "", nil, "", "") }()
+	require.Eventually(t, func() bool { return dp.EncryptionStatusOf(tun.ID).State == dp.EncryptionUnacknowledged }, 5*time.Second, 10*time.Millisecond)
+	stub.RemoveTunnel(tun.ID)
+	select {
+	case err := <-errCh:
+		require.True(t, errors.Is(err, support.ErrTunnelGone), "a warning without --strict; err = %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("serving did not stop after the tunnel was removed")
+	}
+}
+
+// TestHandleServing_GuestExpiry shuts down every serving path of an expired
+// guest tunnel before exiting with ExitTunnelGone.
+func TestHandleServing_GuestExpiry(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+
+	cfg := exitTestConfig(stub.URL)
+	cfg.TargetAddr = "127.0.0.1:1"
+	cfg.ListenAddr = freeTCPAddr(t)
+	tun := stub.AddTunnel("http", cfg.TargetAddr)
+	tun.IsGuest = true
+	tun.ExpiresAt = time.Now().Add(500 * time.Millisecond)
+	runtime := cfg.RuntimeSettings()
+	mgr := dp.NewTunnelManager(cfg.ServerURL, tun.ID, "", runtime)
+	defer mgr.Close()
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- handleServing(cfg, runtime, cfg.EncryptionSettings(), mgr, tun, "", nil, "", "") }()
+	require.NoError(t, stub.WaitSessions(tun.ID, 1, 5*time.Second))
+
+	var err error
+	select {
+	case err = <-errCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("serving did not stop at expiry")
+	}
+	assert.Equal(t, support.ExitTunnelGone, support.ExitCode(err))
+	assert.Contains(t, err.Error(), "--token for longer-lived tunnels")
+	select {
+	case <-mgr.Done():
+	default:
+		t.Fatal("the Manager must be closed before serving returns")
+	}
+	assert.Eventually(t, func() bool {
+		c, err := net.Dial("tcp", cfg.ListenAddr)
+		if err == nil {
+			c.Close()
+		}
+		return err != nil
+	}, 2*time.Second, 10*time.Millisecond, "--listen socket closed")
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, 1, stub.SessionCount(tun.ID), "no reconnect to the expired tunnel")
+}
+
+// TestHandleServing_PrintsURLOnceDataPlaneIsAttached holds the URL block
+// back until the data-plane session is up, so that the first request sent
+// to a freshly copied URL reaches the backend.
+func TestHandleServing_PrintsURLOnceDataPlaneIsAttached(t *testing.T) {
+	const delay = 300 * time.Millisecond
+	stub := testsupport.NewServer(testsupport.Options{UpgradeDelay: delay})
+	defer stub.Close()
+	cfg := exitTestConfig(stub.URL)
+	cfg.ReadyTimeout = 10 * time.Second
+	tun := stub.AddTunnel("http", cfg.TargetAddr)
+	runtime := cfg.RuntimeSettings()
+	mgr := dp.NewTunnelManager(cfg.ServerURL, tun.ID, "", runtime)
+	defer mgr.Close()
+
+	out := captureStdout(t)
+	started := time.Now()
+	errCh := make(chan error, 1)
+	go func() { errCh <- handleServing(cfg, runtime, cfg.EncryptionSettings(), mgr, tun, "", nil, "", "") }()
+	out.wait(t, "Serving HTTP over data-plane")
+
+	url := out.find("🔗 Public URL: ")
+	require.GreaterOrEqual(t, url, 0)
+	assert.GreaterOrEqual(t, out.at(url).Sub(started), delay, "the URL waits for the WebSocket upgrade")
+	assert.Less(t, out.find("✅ Tunnel created successfully!"), url)
+	assert.Less(t, url, out.find("Serving HTTP over data-plane"))
+	assert.Negative(t, out.find("Data plane not yet connected"))
+	assert.Equal(t, 1, stub.SessionCount(tun.ID))
+
+	stopServing(t, stub, tun.ID, errCh)
+}
+
+// TestHandleServing_ReadyTimeoutPrintsURLWithWarning does not keep the user
+// waiting on a data plane that does not connect.
+func TestHandleServing_ReadyTimeoutPrintsURLWithWarning(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{UpgradeDelay: 3 * time.Second})
+	defer stub.Close()
+	cfg := exitTestConfig(stub.URL)
+	cfg.ReadyTimeout = 100 * time.Millisecond
+	tun := stub.AddTunnel("http", cfg.TargetAddr)
+	runtime := cfg.RuntimeSettings()
+	mgr := dp.NewTunnelManager(cfg.ServerURL, tun.ID, "", runtime)
+	defer mgr.Close()
+
+	out := captureStdout(t)
+	errCh := make(chan error, 1)
+	go func() { errCh <- handleServing(cfg, runtime, cfg.EncryptionSettings(), mgr, tun, "", nil, "", "") }()
+	out.wait(t, "Data plane not yet connected after 100ms")
+	assert.Equal(t, 0, stub.SessionCount(tun.ID), "the URL is printed before the upgrade")
+	url := out.find("🔗 Public URL: ")
+	require.GreaterOrEqual(t, url, 0)
+	assert.Less(t, url, out.find("Data plane not yet connected"))
+
+	// The data plane still connects later.
+	require.NoError(t, stub.WaitSessions(tun.ID, 1, 10*time.Second))
+	stopServing(t, stub, tun.ID, errCh)
+}
+
+func stopServing(t *testing.T, stub *testsupport.Server, tunnelID string, errCh <-chan error) {
+	t.Helper()
+	stub.RemoveTunnel(tunnelID)
+	select {
+	case err := <-errCh:
+		require.True(t, errors.Is(err, support.ErrTunnelGone), "err = %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("serving did not stop after the tunnel was removed")
+	}
+}
+
+// stdoutLines records the lines written to os.Stdout while a test runs, with
+// the time each was read.
+type stdoutLines struct {
+	mu    sync.Mutex
+	lines []string
+	times []time.Time
+}
+
+func captureStdout(t *testing.T) *stdoutLines {
+	t.Helper()
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	old := os.Stdout
+	os.Stdout = w
+	out := &stdoutLines{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sc := bufio.NewScanner(r)
+		for sc.Scan() {
+			out.mu.Lock()
+			out.lines = append(out.lines, sc.Text())
+			out.times = append(out.times, time.Now())
+			out.mu.Unlock()
+		}
+	}()
+	t.Cleanup(func() {
+		os.Stdout = old
+		_ = w.Close()
+		<-done
+		_ = r.Close()
+	})
+	return out
+}
+
+// find returns the index of the first line containing s, or -1.
+func (o *stdoutLines) find(s string) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i, line := range o.lines {
+		if strings.Contains(line, s) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (o *stdoutLines) at(i int) time.Time {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.times[i]
+}
+
+func (o *stdoutLines) wait(t *testing.T, s string) {
+	t.Helper()
+	require.Eventually(t, func() bool { return o.find(s) >= 0 }, 10*time.Second, 10*time.Millisecond, "no line containing %q", s)
+}
+
+func httpGet(t *testing.T, rw io.ReadWriteCloser) string {
+	t.Helper()
+	defer rw.Close()
+	_, err := io.WriteString(rw, "GET / HTTP/1.1\r\nHost: backend\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+	b, err := io.ReadAll(rw)
+	if err != nil && !strings.Contains(err.Error(), "closed") {
+		require.NoError(t, err)
+	}
+	return string(b)
+}
+
+func freeTCPAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	require.NoError(t, ln.Close())
+	return addr
+}
+
+// TestRunClientWorkflow_ExistingTunnelID serves a tunnel created out-of-band
+// by operator automation: the client adopts its protocol and target instead
+// of creating a tunnel, and never deletes it.
+func TestRunClientWorkflow_ExistingTunnelID(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer backend.Close()
+	go func() {
+		for {
+			c, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				_, _ = io.Copy(c, c)
+			}()
+		}
+	}()
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	tun := stub.AddTunnel("tcp", backend.Addr().String())
+
+	cfg := exitTestConfig(stub.URL)
+	cfg.TunnelID = tun.ID
+	errCh := make(chan error, 1)
+	go func() { errCh <- runClientWorkflow(cfg) }()
+	require.NoError(t, stub.WaitSessions(tun.ID, 1, 5*time.Second))
+	assert.Equal(t, "tcp", cfg.Protocol, "protocol adopted from the tunnel")
+	assert.Equal(t, backend.Addr().String(), cfg.TargetAddr, "target adopted from the tunnel")
+
+	stream, err := stub.OpenStream(tun.ID, backend.Addr().String())
+	require.NoError(t, err)
+	_, err = io.WriteString(stream, "ping")
+	require.NoError(t, err)
+	got := make([]byte, 4)
+	_, err = io.ReadFull(stream, got)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(got))
+	stream.Close()
+
+	stub.RemoveTunnel(tun.ID)
+	select {
+	case err := <-errCh:
+		require.True(t, errors.Is(err, support.ErrTunnelGone), "err = %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("serving did not stop after the tunnel was removed")
+	}
+}
+
+func TestRunClientWorkflow_UnknownTunnelID(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	cfg := exitTestConfig(stub.URL)
+	cfg.TunnelID = "missing"
+	err := runClientWorkflow(cfg)
+	wantExit(t, err, support.ExitTunnelGone)
+	assert.Contains(t, err.Error(), "tunnel not found — was it deleted or is the ID wrong?")
+}
+
+func TestAdoptTunnel(t *testing.T) {
+	tun := &ctrl.Response{ID: "op-1", Protocol: "tcp", TargetAddr: "127.0.0.1:5432"}
+
+	cfg := exitTestConfig("https://fortunnels.example")
+	require.NoError(t, adoptTunnel(cfg, tun))
+	assert.Equal(t, "tcp", cfg.Protocol)
+	assert.Equal(t, "127.0.0.1:5432", cfg.TargetAddr)
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	os.Args = []string{"client", "-protocol", "http"}
+	cfg = exitTestConfig("https://fortunnels.example")
+	err := adoptTunnel(cfg, tun)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not match tunnel op-1, which is tcp")
+
+	os.Args = []string{"client", "-local", "127.0.0.1:6543"}
+	cfg = exitTestConfig("https://fortunnels.example")
+	cfg.TargetAddr = "127.0.0.1:6543"
+	err = adoptTunnel(cfg, tun)
+	require.Error(t, err, "incoming streams go to the registered target")
+	assert.Contains(t, err.Error(), "differs from the target 127.0.0.1:5432")
+}
@@ -0,0 +1,546 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fortunnels/client/internal/auth"
+	"github.com/fortunnels/client/internal/config"
+	ctrl "github.com/fortunnels/client/internal/control"
+	dp "github.com/fortunnels/client/internal/dataplane"
+	clierrors "github.com/fortunnels/client/internal/support"
+)
+
+const smokeUsage = "usage: fortunnels smoke [--protocols http,tcp,udp] [--phase-timeout 15s] [server and auth flags]"
+
+const (
+	defaultSmokePhaseTimeout = 15 * time.Second
+	// smokeBodyLimit caps what the HTTP check reads of the public response.
+	smokeBodyLimit = 64 << 10
+)
+
+// Outcomes of a smoke phase.
+const (
+	smokePass    = "pass"
+	smokeFail    = "fail"
+	smokeSkipped = "skipped"
+)
+
+// startSmokeBackend starts the throwaway HTTP handler the smoke tunnel points
+// at, answering every request with token. Tests replace it.
+var startSmokeBackend = listenSmokeBackend
+
+// smokeOptions are the flags of `fortunnels smoke` besides the tunnel flags.
+type smokeOptions struct {
+	// protocols are checked in this order; http always comes first.
+	protocols    []string
+	phaseTimeout time.Duration
+}
+
+// smokePhase is the outcome of one step of a smoke run. Reason classifies a
+// failure like the exit codes do (support.ExitReason).
+type smokePhase struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"`
+	DurationMS float64 `json:"duration_ms"`
+	Detail     string  `json:"detail,omitempty"`
+	Error      string  `json:"error,omitempty"`
+	Reason     string  `json:"reason,omitempty"`
+}
+
+// smokeReport is the result of a smoke run: pass only when every phase
+// passed, and the exit code and reason of the first failed phase otherwise.
+type smokeReport struct {
+	Pass       bool         `json:"pass"`
+	Code       int          `json:"code"`
+	Reason     string       `json:"reason"`
+	DurationMS float64      `json:"duration_ms"`
+	Phases     []smokePhase `json:"phases"`
+}
+
+// runSmokeCommand creates a tunnel to a throwaway backend, checks traffic
+// through its public URL, deletes it and reports pass or fail, for canaries.
+func runSmokeCommand(args []string) int {
+	opts, rest, err := parseSmokeArgs(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n%s\n", err, smokeUsage)
+		return clierrors.ExitConfig
+	}
+	return withCommandLine(rest, func() int {
+		cfg, err := config.Parse()
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		if err == nil {
+			applyTimeZone(cfg)
+			err = validateRunServer(cfg)
+		}
+		if err == nil && slices.Contains(opts.protocols, protoUDP) && strings.TrimSpace(cfg.UDPDst) == "" {
+			err = errors.New("the udp probe needs --udp-dst, a server-side UDP service that answers\n   Example: fortunnels smoke --protocols http,udp --udp-dst 127.0.0.1:53")
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return clierrors.ExitConfig
+		}
+		report := runSmoke(cfg, opts)
+		writeSmokeReport(os.Stdout, report, cfg.JSONOutput())
+		return report.Code
+	})
+}
+
+// parseSmokeArgs takes the smoke flags out of args, wherever they are; the
+// rest are tunnel flags for config.Parse.
+func parseSmokeArgs(args []string) (smokeOptions, []string, error) {
+	fs := flag.NewFlagSet("smoke", flag.ContinueOnError)
+	protocols := fs.String("protocols", protoHTTP, "Comma-separated checks: http (always), tcp (echo through a tcp tunnel), udp (probe of --udp-dst)")
+	timeout := fs.Duration("phase-timeout", defaultSmokePhaseTimeout, "Time limit of each phase")
+	var own, rest []string
+	for i := 0; i < len(args); i++ {
+		name, _, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if !strings.HasPrefix(args[i], "-") || fs.Lookup(name) == nil {
+			rest = append(rest, args[i])
+			continue
+		}
+		own = append(own, args[i])
+		if !hasValue && i+1 < len(args) {
+			i++
+			own = append(own, args[i])
+		}
+	}
+	if err := fs.Parse(own); err != nil {
+		return smokeOptions{}, nil, err
+	}
+	if *timeout <= 0 {
+		return smokeOptions{}, nil, fmt.Errorf("invalid --phase-timeout %s", *timeout)
+	}
+	opts := smokeOptions{protocols: []string{protoHTTP}, phaseTimeout: *timeout}
+	for _, p := range strings.Split(*protocols, ",") {
+		switch p = strings.ToLower(strings.TrimSpace(p)); p {
+		case "", protoHTTP:
+		case protoTCP, protoUDP:
+			if !slices.Contains(opts.protocols, p) {
+				opts.protocols = append(opts.protocols, p)
+			}
+		default:
+			return smokeOptions{}, nil, fmt.Errorf("invalid --protocols %q: expected http, tcp or udp", p)
+		}
+	}
+	return opts, rest, nil
+}
+
+// smokeRun is the state of one smoke run: the session, the backends and the
+// tunnels to delete at the end.
+type smokeRun struct {
+	cfg        *config.Config
+	opts       smokeOptions
+	httpClient *http.Client
+	bearer     string
+	csrf       string
+	token      string
+	httpAddr   string
+
+	stops   []func()
+	tunnels []*smokeTunnel
+	report  smokeReport
+}
+
+// smokeStep is a phase of runSmoke; run returns a detail for the report.
+type smokeStep struct {
+	name string
+	run  func(ctx context.Context) (string, error)
+}
+
+type smokeTunnel struct {
+	tun *ctrl.Response
+	mgr *dp.Manager
+}
+
+// runSmoke runs the phases in order. After the first failure the remaining
+// ones are skipped, but the tunnels created so far are always deleted.
+func runSmoke(cfg *config.Config, opts smokeOptions) smokeReport {
+	r := &smokeRun{cfg: cfg, opts: opts}
+	start := time.Now()
+	var web *smokeTunnel
+	phases := []smokeStep{
+		{"backend", r.startBackends},
+		{"auth", r.authenticate},
+		{"create", func(context.Context) (detail string, err error) {
+			web, detail, err = r.createTunnel(protoHTTP, r.httpAddr)
+			return detail, err
+		}},
+		{"connect", func(context.Context) (string, error) { return r.connect(web) }},
+		{"dns", func(ctx context.Context) (string, error) { return r.resolve(ctx, web) }},
+		{"http", func(ctx context.Context) (string, error) { return r.checkHTTP(ctx, web) }},
+	}
+	if slices.Contains(opts.protocols, protoTCP) {
+		phases = append(phases, smokeStep{"tcp", r.checkTCP})
+	}
+	if slices.Contains(opts.protocols, protoUDP) {
+		phases = append(phases, smokeStep{"udp", r.checkUDP})
+	}
+	failed := false
+	for _, p := range phases {
+		if failed {
+			r.report.Phases = append(r.report.Phases, smokePhase{Name: p.name, Status: smokeSkipped})
+			continue
+		}
+		failed = !r.phase(p.name, p.run)
+	}
+	r.phase("delete", func(context.Context) (string, error) { return r.cleanup() })
+	r.report.DurationMS = millis(time.Since(start))
+	r.report.Pass = r.report.Code == clierrors.ExitOK
+	r.report.Reason = clierrors.ExitReason(r.report.Code)
+	return r.report
+}
+
+// phase runs fn under --phase-timeout and records its outcome; the first
+// failure sets the report's exit code.
+func (r *smokeRun) phase(name string, fn func(ctx context.Context) (string, error)) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), r.opts.phaseTimeout)
+	defer cancel()
+	start := time.Now()
+	detail, err := fn(ctx)
+	p := smokePhase{Name: name, Status: smokePass, DurationMS: millis(time.Since(start)), Detail: detail}
+	if err != nil {
+		code := clierrors.ExitCode(err)
+		p.Status, p.Error, p.Reason = smokeFail, strings.TrimSpace(strings.TrimPrefix(err.Error(), "❌")), clierrors.ExitReason(code)
+		if r.report.Code == clierrors.ExitOK {
+			r.report.Code = code
+		}
+	}
+	r.report.Phases = append(r.report.Phases, p)
+	return err == nil
+}
+
+// control returns the session's client with the phase timeout, which bounds
+// the control-plane calls that take no context.
+func (r *smokeRun) control() *http.Client {
+	c := *r.httpClient
+	c.Timeout = r.opts.phaseTimeout
+	return &c
+}
+
+func (r *smokeRun) startBackends(context.Context) (string, error) {
+	r.token = newSmokeToken()
+	addr, stop, err := startSmokeBackend(r.token)
+	if err != nil {
+		return "", clierrors.WithExitCode(clierrors.ExitLocalTarget, fmt.Errorf("start local backend: %w", err))
+	}
+	r.httpAddr = addr
+	r.stops = append(r.stops, stop)
+	return addr, nil
+}
+
+func (r *smokeRun) authenticate(context.Context) (string, error) {
+	control := setupControlHTTP(r.cfg)
+	control.Timeout = r.opts.phaseTimeout
+	httpClient, bearer, csrf, err := auth.SetupAuthentication(r.cfg, control)
+	if err != nil {
+		return "", clierrors.WithExitCode(clierrors.ExitAuth, fmt.Errorf("authentication failed: %w", err))
+	}
+	if httpClient == nil {
+		httpClient = control
+	}
+	r.httpClient, r.bearer, r.csrf = httpClient, bearer, csrf
+	return "", nil
+}
+
+// createTunnel creates a protocol tunnel to local, to be deleted by cleanup.
+func (r *smokeRun) createTunnel(protocol, local string) (*smokeTunnel, string, error) {
+	tun, err := ctrl.CreateTunnelWithClient(r.cfg.ServerURL, local, protocol, r.cfg.UserID, r.control(), r.bearer, r.csrf)
+	if err != nil {
+		return nil, "", clierrors.HandleTunnelCreationError(err, r.cfg.ServerURL)
+	}
+	st := &smokeTunnel{tun: tun}
+	r.tunnels = append(r.tunnels, st)
+	return st, tun.ID + " " + ctrl.DisplayPublicURL(r.cfg.ServerURL, tun), nil
+}
+
+// connect serves st and waits until its data plane is up.
+func (r *smokeRun) connect(st *smokeTunnel) (string, error) {
+	tc := *r.cfg
+	tc.Protocol, tc.TargetAddr, tc.LocalTargets = st.tun.Protocol, st.tun.TargetAddr, nil
+	st.mgr = serveTunnel(&tc, st.tun, io.Discard)
+	if err := waitTunnelHealthy(r.cfg.ServerURL, r.control(), r.bearer, st.mgr, st.tun.ID, r.opts.phaseTimeout); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("data-plane generation %d", st.mgr.Generation()), nil
+}
+
+// resolve waits until the public hostname resolves; URLs without one skip
+// the lookup.
+func (r *smokeRun) resolve(ctx context.Context, st *smokeTunnel) (string, error) {
+	host := ctrl.PublicHostname(ctrl.DisplayPublicURL(r.cfg.ServerURL, st.tun))
+	if host == "" {
+		return "no public hostname to resolve", nil
+	}
+	resolver := ctrl.NewDNSResolver(r.cfg.DNSServer)
+	for {
+		addrs, err := resolver.LookupHost(ctx, host)
+		if err == nil && len(addrs) > 0 {
+			return host + " " + strings.Join(addrs, ", "), nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", clierrors.WithExitCode(clierrors.ExitServerUnreachable, fmt.Errorf("%s does not resolve: %v", host, err))
+		case <-time.After(healthPollInterval):
+		}
+	}
+}
+
+// checkHTTP fetches the public URL and expects the backend's token back.
+func (r *smokeRun) checkHTTP(ctx context.Context, st *smokeTunnel) (string, error) {
+	publicURL := ctrl.DisplayPublicURL(r.cfg.ServerURL, st.tun)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, publicURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", clierrors.WithExitCode(clierrors.ExitServerUnreachable, fmt.Errorf("GET %s: %w", publicURL, err))
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, smokeBodyLimit))
+	switch {
+	case resp.StatusCode == http.StatusBadGateway:
+		return "", clierrors.WithExitCode(clierrors.ExitLocalTarget, fmt.Errorf("GET %s: %s: %s", publicURL, resp.Status, firstLine(body)))
+	case resp.StatusCode != http.StatusOK:
+		return "", clierrors.WithExitCode(clierrors.ExitDataPlane, fmt.Errorf("GET %s: %s: %s", publicURL, resp.Status, firstLine(body)))
+	case err != nil:
+		return "", clierrors.WithExitCode(clierrors.ExitDataPlane, fmt.Errorf("GET %s: %w", publicURL, err))
+	case !bytes.Contains(body, []byte(r.token)):
+		return "", clierrors.WithExitCode(clierrors.ExitDataPlane, fmt.Errorf("GET %s: answered by something other than the smoke backend", publicURL))
+	}
+	return resp.Status, nil
+}
+
+// checkTCP sends the token through a tcp tunnel to a local echo server.
+func (r *smokeRun) checkTCP(ctx context.Context) (string, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", clierrors.WithExitCode(clierrors.ExitLocalTarget, fmt.Errorf("start local echo server: %w", err))
+	}
+	r.stops = append(r.stops, func() { ln.Close() })
+	clierrors.Go(clierrors.PanicScope{Role: "smoke echo server"}, func() { serveEcho(ln) })
+	st, _, err := r.createTunnel(protoTCP, ln.Addr().String())
+	if err != nil {
+		return "", err
+	}
+	if _, err := r.connect(st); err != nil {
+		return "", err
+	}
+	publicURL := ctrl.DisplayPublicURL(r.cfg.ServerURL, st.tun)
+	u, err := url.Parse(publicURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("tcp tunnel has no public address (%s)", publicURL)
+	}
+	var d net.Dialer
+	c, err := d.DialContext(ctx, "tcp", u.Host)
+	if err != nil {
+		return "", clierrors.WithExitCode(clierrors.ExitServerUnreachable, err)
+	}
+	defer c.Close()
+	if err := roundTrip(ctx, c, r.token, true); err != nil {
+		return "", clierrors.WithExitCode(clierrors.ExitDataPlane, fmt.Errorf("echo through %s: %w", u.Host, err))
+	}
+	return "echo through " + u.Host, nil
+}
+
+// checkUDP runs a udp tunnel to --udp-dst on a local port and expects an
+// answer to a datagram sent there.
+func (r *smokeRun) checkUDP(ctx context.Context) (string, error) {
+	listen, err := freeUDPAddr()
+	if err != nil {
+		return "", clierrors.WithExitCode(clierrors.ExitLocalTarget, err)
+	}
+	st, _, err := r.createTunnel(protoUDP, r.cfg.UDPDst)
+	if err != nil {
+		return "", err
+	}
+	tc := *r.cfg
+	tc.Protocol = protoUDP
+	authToken := auth.ComputeDataPlaneAuthWithPSK(st.tun.ID, tc.DPAuthToken, tc.DPAuthSecret, tc.PSK, tc.EncryptionSettings().Enabled)
+	udpCtx, stop := context.WithCancel(context.Background())
+	strategy := dp.NewStrategy(udpCtx, strings.ToLower(tc.DataPlane), tc.ServerURL, st.tun.ID, authToken, tc.UDPDst, listen, tc.RuntimeSettings(), tc.EncryptionSettings())
+	done := make(chan error, 1)
+	clierrors.Go(clierrors.PanicScope{Role: "smoke udp strategy", TunnelID: st.tun.ID}, func() { done <- strategy.Run() })
+	r.stops = append(r.stops, func() { stop(); <-done })
+
+	c, err := net.Dial("udp", listen)
+	if err != nil {
+		return "", clierrors.WithExitCode(clierrors.ExitLocalTarget, err)
+	}
+	defer c.Close()
+	// The strategy may still be binding the port or dialing the data plane;
+	// resend until an answer comes back.
+	for {
+		select {
+		case err := <-done:
+			return "", clierrors.WithExitCode(clierrors.ExitDataPlane, fmt.Errorf("%s: %w", strategy.ErrLabel, err))
+		default:
+		}
+		attempt, cancel := context.WithTimeout(ctx, time.Second)
+		err := roundTrip(attempt, c, r.token, false)
+		cancel()
+		if err == nil {
+			return "answer from " + tc.UDPDst, nil
+		}
+		if ctx.Err() != nil {
+			return "", clierrors.WithExitCode(clierrors.ExitDataPlane, fmt.Errorf("no answer from %s through the tunnel", tc.UDPDst))
+		}
+	}
+}
+
+// cleanup deletes the tunnels and stops the backends, whatever failed
+// before.
+func (r *smokeRun) cleanup() (string, error) {
+	var errs []error
+	deleted := 0
+	for i := len(r.tunnels) - 1; i >= 0; i-- {
+		st := r.tunnels[i]
+		if st.mgr != nil {
+			st.mgr.Close()
+		}
+		if err := ctrl.DeleteTunnel(r.cfg.ServerURL, st.tun.ID, r.control(), r.bearer, r.csrf); err != nil {
+			errs = append(errs, fmt.Errorf("delete tunnel %s: %w", st.tun.ID, err))
+			continue
+		}
+		deleted++
+	}
+	for i := len(r.stops) - 1; i >= 0; i-- {
+		r.stops[i]()
+	}
+	if len(errs) > 0 {
+		return "", errors.Join(errs...)
+	}
+	return fmt.Sprintf("%d tunnel(s) deleted", deleted), nil
+}
+
+// writeSmokeReport prints one line per phase and a final
+// "SMOKE result=<pass|fail> code=<n> reason=<slug>" line or, with
+// jsonOutput, the report as one JSON object.
+func writeSmokeReport(w io.Writer, report smokeReport, jsonOutput bool) {
+	if jsonOutput {
+		b, _ := json.Marshal(report)
+		fmt.Fprintf(w, "%s\n", b)
+		return
+	}
+	icons := map[string]string{smokePass: "✅", smokeFail: "❌", smokeSkipped: "⏭️ "}
+	for _, p := range report.Phases {
+		line := fmt.Sprintf("%s %-8s %7.0fms", icons[p.Status], p.Name, p.DurationMS)
+		switch p.Status {
+		case smokeSkipped:
+			line = fmt.Sprintf("%s %-8s skipped", icons[p.Status], p.Name)
+		case smokeFail:
+			line += fmt.Sprintf("  %s [%s]", p.Error, p.Reason)
+		default:
+			if p.Detail != "" {
+				line += "  " + p.Detail
+			}
+		}
+		fmt.Fprintln(w, line)
+	}
+	result := smokePass
+	if !report.Pass {
+		result = smokeFail
+	}
+	fmt.Fprintf(w, "SMOKE result=%s code=%d reason=%s duration_ms=%.0f\n", result, report.Code, report.Reason, report.DurationMS)
+}
+
+// listenSmokeBackend serves token over HTTP on a loopback port.
+func listenSmokeBackend(token string) (string, func(), error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, err
+	}
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprintln(w, token)
+		}),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	clierrors.Go(clierrors.PanicScope{Role: "smoke http server"}, func() { _ = srv.Serve(ln) })
+	return ln.Addr().String(), func() { _ = srv.Close() }, nil
+}
+
+func newSmokeToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return "fortunnels-smoke-" + hex.EncodeToString(b)
+}
+
+func serveEcho(ln net.Listener) {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		clierrors.Go(clierrors.PanicScope{Role: "smoke echo connection"}, func() {
+			defer c.Close()
+			_, _ = io.Copy(c, c)
+		})
+	}
+}
+
+// roundTrip writes token to c and reads an answer: the token itself when
+// echo is set, anything otherwise.
+func roundTrip(ctx context.Context, c net.Conn, token string, echo bool) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = c.SetDeadline(deadline)
+	}
+	if _, err := c.Write([]byte(token)); err != nil {
+		return err
+	}
+	buf := make([]byte, 2048)
+	if !echo {
+		_, err := c.Read(buf)
+		return err
+	}
+	if _, err := io.ReadFull(c, buf[:len(token)]); err != nil {
+		return err
+	}
+	if string(buf[:len(token)]) != token {
+		return errors.New("echo differs from what was sent")
+	}
+	return nil
+}
+
+// freeUDPAddr returns a loopback UDP address nothing is bound to right now.
+func freeUDPAddr() (string, error) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer pc.Close()
+	return pc.LocalAddr().String(), nil
+}
+
+func firstLine(b []byte) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(string(b)), "\n")
+	return line
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
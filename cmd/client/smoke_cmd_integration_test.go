@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+//go:build integration
+
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/support"
+	"github.com/fortunnels/client/internal/testsupport"
+)
+
+func smokeAgainst(t *testing.T, stub *testsupport.Server) smokeReport {
+	t.Helper()
+	t.Setenv("FORTUNNELS_CONFIG", filepath.Join(t.TempDir(), "fortunnels.yml"))
+	report := runSmoke(exitTestConfig(stub.URL), smokeOptions{protocols: []string{protoHTTP}, phaseTimeout: 10 * time.Second})
+	t.Logf("%+v", report)
+	return report
+}
+
+func smokePhaseStatuses(report smokeReport) map[string]string {
+	out := map[string]string{}
+	for _, p := range report.Phases {
+		out[p.Name] = p.Status
+	}
+	return out
+}
+
+func TestSmoke_PassesAgainstStub(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+
+	report := smokeAgainst(t, stub)
+	assert.True(t, report.Pass)
+	assert.Equal(t, support.ExitOK, report.Code)
+	assert.Equal(t, "ok", report.Reason)
+	var names []string
+	for _, p := range report.Phases {
+		names = append(names, p.Name)
+		assert.Equal(t, smokePass, p.Status, p.Name)
+		assert.Empty(t, p.Error, p.Name)
+		assert.GreaterOrEqual(t, report.DurationMS, p.DurationMS)
+	}
+	assert.Equal(t, []string{"backend", "auth", "create", "connect", "dns", "http", "delete"}, names)
+	assert.Equal(t, "200 OK", report.Phases[5].Detail)
+	assertTunnelGone(t, stub, "stub-1")
+}
+
+func TestSmoke_BackendMissingFailsAndCleansUp(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	orig := startSmokeBackend
+	t.Cleanup(func() { startSmokeBackend = orig })
+	startSmokeBackend = func(string) (string, func(), error) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addr := ln.Addr().String()
+		ln.Close()
+		return addr, func() {}, nil
+	}
+
+	report := smokeAgainst(t, stub)
+	assert.False(t, report.Pass)
+	assert.Equal(t, support.ExitLocalTarget, report.Code)
+	assert.Equal(t, "local_target", report.Reason)
+	assert.Equal(t, map[string]string{
+		"backend": smokePass, "auth": smokePass, "create": smokePass, "connect": smokePass,
+		"dns": smokePass, "http": smokeFail, "delete": smokePass,
+	}, smokePhaseStatuses(report))
+	http := report.Phases[5]
+	assert.Contains(t, http.Error, "502 Bad Gateway")
+	assert.Equal(t, "local_target", http.Reason)
+	assertTunnelGone(t, stub, "stub-1")
+}
+
+func TestSmoke_CreateFailureSkipsTheRest(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	stub.Close()
+
+	report := smokeAgainst(t, stub)
+	assert.False(t, report.Pass)
+	assert.Equal(t, support.ExitServerUnreachable, report.Code)
+	assert.Equal(t, map[string]string{
+		"backend": smokePass, "auth": smokePass, "create": smokeFail, "connect": smokeSkipped,
+		"dns": smokeSkipped, "http": smokeSkipped, "delete": smokePass,
+	}, smokePhaseStatuses(report))
+}
@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSmokeArgs(t *testing.T) {
+	opts, rest, err := parseSmokeArgs([]string{"--server", "https://example.com", "--protocols", "udp,TCP,http,tcp", "--phase-timeout=3s", "--udp-dst", "127.0.0.1:53"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http", "udp", "tcp"}, opts.protocols)
+	assert.Equal(t, 3*time.Second, opts.phaseTimeout)
+	assert.Equal(t, []string{"--server", "https://example.com", "--udp-dst", "127.0.0.1:53"}, rest)
+
+	opts, rest, err = parseSmokeArgs(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http"}, opts.protocols)
+	assert.Equal(t, defaultSmokePhaseTimeout, opts.phaseTimeout)
+	assert.Empty(t, rest)
+
+	_, _, err = parseSmokeArgs([]string{"--protocols", "http,quic"})
+	require.ErrorContains(t, err, `invalid --protocols "quic"`)
+	_, _, err = parseSmokeArgs([]string{"--phase-timeout", "0s"})
+	require.ErrorContains(t, err, "invalid --phase-timeout")
+}
+
+func TestRunSmokeCommand_Usage(t *testing.T) {
+	assert.Equal(t, 2, runSmokeCommand([]string{"--protocols", "sctp"}))
+	assert.Equal(t, 2, runSmokeCommand([]string{"--server", "http://127.0.0.1:1", "--protocols", "udp"}), "udp needs --udp-dst")
+}
+
+func TestWriteSmokeReport(t *testing.T) {
+	report := smokeReport{Code: 8, Reason: "local_target", DurationMS: 42, Phases: []smokePhase{
+		{Name: "create", Status: smokePass, DurationMS: 12, Detail: "stub-1 http://x/t/stub-1/"},
+		{Name: "http", Status: smokeFail, DurationMS: 5, Error: "GET http://x/t/stub-1/: 502 Bad Gateway", Reason: "local_target"},
+		{Name: "tcp", Status: smokeSkipped},
+	}}
+	var out bytes.Buffer
+	writeSmokeReport(&out, report, false)
+	assert.Equal(t, "✅ create        12ms  stub-1 http://x/t/stub-1/\n"+
+		"❌ http           5ms  GET http://x/t/stub-1/: 502 Bad Gateway [local_target]\n"+
+		"⏭️  tcp      skipped\n"+
+		"SMOKE result=fail code=8 reason=local_target duration_ms=42\n", out.String())
+
+	out.Reset()
+	writeSmokeReport(&out, report, true)
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Equal(t, false, decoded["pass"])
+	assert.Equal(t, "local_target", decoded["reason"])
+	assert.Len(t, decoded["phases"], 3)
+}
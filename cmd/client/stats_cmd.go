@@ -0,0 +1,177 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fortunnels/client/internal/config"
+	dp "github.com/fortunnels/client/internal/dataplane"
+	"github.com/fortunnels/client/internal/stats"
+	clierrors "github.com/fortunnels/client/internal/support"
+)
+
+// statsKey is what --stats-file counts a tunnel under: its profile, or its
+// protocol and local target. Tunnel IDs change on every start.
+func statsKey(cfg *config.Config) string {
+	switch {
+	case cfg.Profile != "":
+		return "profile " + cfg.Profile
+	case cfg.Protocol == "tcp" && cfg.ListenAddr != "":
+		return "tcp listen " + cfg.ListenAddr + " -> " + listenDst(cfg)
+	default:
+		return cfg.Protocol + "://" + cfg.TargetAddr
+	}
+}
+
+// processCounters are this process's served traffic for the stats file.
+func processCounters() stats.Counters {
+	up, down := dp.Traffic().Totals()
+	c := stats.Counters{BytesUp: up, BytesDown: down, Connections: dp.Traffic().Streams()}
+	for _, tc := range dp.TrafficClasses() {
+		if c.Classes == nil {
+			c.Classes = map[string]stats.ClassCounters{}
+		}
+		c.Classes[tc.Class] = stats.ClassCounters{Requests: tc.Requests, Bytes: tc.Bytes, DurationMillis: tc.Duration.Milliseconds()}
+	}
+	return c
+}
+
+// startStats checkpoints the tunnel's traffic into --stats-file while it is
+// served. The returned func writes the last checkpoint.
+func startStats(cfg *config.Config) func() {
+	if cfg.StatsFile == "" {
+		return func() {}
+	}
+	key := statsKey(cfg)
+	rec, data, err := stats.Open(cfg.StatsFile, key, processCounters)
+	if err != nil {
+		log.Printf("[WARN] stats: %v; not recording traffic", err)
+		return func() {}
+	}
+	if e := data.Targets[key]; e != nil {
+		fmt.Printf("📈 %s this month so far: %s\n", key, formatCounters(e.Monthly[stats.MonthKey(time.Now())]))
+	}
+	return rec.Start(cfg.StatsFlush)
+}
+
+func runStatsCommand(args []string) int {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	path := fs.String("stats-file", "", "Stats file written by --stats-file")
+	days := fs.Int("days", 7, "How many recent days to list per target")
+	jsonOut := fs.Bool("json", false, "Print the file's data as JSON")
+	utc := fs.Bool("utc", false, "Print times in UTC instead of the local zone")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *path == "" && fs.NArg() == 1 {
+		*path = fs.Arg(0)
+	}
+	if *path == "" {
+		fmt.Fprintln(os.Stderr, "usage: fortunnels stats [--days N] [--json] [--utc] <stats-file>")
+		return 2
+	}
+	data, err := stats.Load(*path)
+	if data == nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  %v\n", err)
+	}
+	if *jsonOut {
+		// JSON carries UTC times, whatever --utc says.
+		for _, e := range data.Targets {
+			e.LastSeen = e.LastSeen.UTC()
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(data); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	clierrors.SetUTCTimes(*utc)
+	printStats(os.Stdout, data, *days, time.Now())
+	return 0
+}
+
+// printStats lists each target's total, its monthly rollups and its last
+// days (today included).
+func printStats(w io.Writer, data *stats.Data, days int, now time.Time) {
+	if len(data.Targets) == 0 {
+		fmt.Fprintln(w, "No traffic recorded yet.")
+		return
+	}
+	for i, key := range data.Keys() {
+		e := data.Targets[key]
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "📈 %s (last seen %s)\n", key, clierrors.FormatTimeFrom(e.LastSeen, now))
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "   PERIOD\tUP\tDOWN\tCONNECTIONS\tUPTIME")
+		writeStatsRow(tw, "total", e.Total)
+		months := make([]string, 0, len(e.Monthly))
+		for m := range e.Monthly {
+			months = append(months, m)
+		}
+		sort.Sort(sort.Reverse(sort.StringSlice(months)))
+		for _, m := range months {
+			writeStatsRow(tw, m, e.Monthly[m])
+		}
+		for d := range days {
+			day := stats.DayKey(now.AddDate(0, 0, -d))
+			if c, ok := e.Daily[day]; ok {
+				writeStatsRow(tw, day, c)
+			}
+		}
+		_ = tw.Flush()
+		writeClassRows(w, e.Total.Classes)
+	}
+}
+
+// writeClassRows lists the --classify breakdown of a target's total by
+// descending bytes.
+func writeClassRows(w io.Writer, classes map[string]stats.ClassCounters) {
+	if len(classes) == 0 {
+		return
+	}
+	names := make([]string, 0, len(classes))
+	for name := range classes {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := classes[names[i]], classes[names[j]]
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		return names[i] < names[j]
+	})
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "   CLASS\tREQUESTS\tBYTES\tMEAN")
+	for _, name := range names {
+		c := classes[name]
+		fmt.Fprintf(tw, "   %s\t%d\t%s\t%s\n", name, c.Requests, clierrors.FormatBytes(c.Bytes), c.Mean())
+	}
+	_ = tw.Flush()
+}
+
+func writeStatsRow(w io.Writer, period string, c stats.Counters) {
+	fmt.Fprintf(w, "   %s\t%s\t%s\t%d\t%s\n", period, clierrors.FormatBytes(c.BytesUp), clierrors.FormatBytes(c.BytesDown), c.Connections, time.Duration(c.UptimeSeconds)*time.Second)
+}
+
+func formatCounters(c stats.Counters) string {
+	return fmt.Sprintf("up %s, down %s, %d connections, served %s",
+		clierrors.FormatBytes(c.BytesUp), clierrors.FormatBytes(c.BytesDown), c.Connections, time.Duration(c.UptimeSeconds)*time.Second)
+}
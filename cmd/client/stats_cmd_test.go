@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/stats"
+	clierrors "github.com/fortunnels/client/internal/support"
+)
+
+func TestStatsKey(t *testing.T) {
+	assert.Equal(t, "profile web", statsKey(&config.Config{Profile: "web", Protocol: "http", TargetAddr: "localhost:3000"}))
+	assert.Equal(t, "http://localhost:3000", statsKey(&config.Config{Protocol: "http", TargetAddr: "localhost:3000"}))
+	assert.Equal(t, "tcp listen 127.0.0.1:5432 -> db:5432",
+		statsKey(&config.Config{Protocol: "tcp", ListenAddr: "127.0.0.1:5432", Dst: "db:5432", TargetAddr: "localhost:1"}))
+}
+
+func TestPrintStats(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.Local)
+	var d stats.Data
+	d.Add("http://localhost:3000", stats.Counters{BytesUp: 2048, BytesDown: 3 << 20, Connections: 4, UptimeSeconds: 90}, now.AddDate(0, 0, -30))
+	d.Add("http://localhost:3000", stats.Counters{BytesUp: 10, Connections: 1, UptimeSeconds: 60}, now)
+
+	var out bytes.Buffer
+	printStats(&out, &d, 7, now)
+	s := out.String()
+	assert.Contains(t, s, "📈 http://localhost:3000 (last seen "+now.Format(time.RFC3339)+" (now))")
+	assert.Regexp(t, `total\s+2\.0 KiB\s+3\.0 MiB\s+5\s+2m30s`, s)
+	assert.Regexp(t, `2026-10\s+10 B\s+0 B\s+1\s+1m0s`, s)
+	assert.Regexp(t, `2026-09\s+2\.0 KiB`, s)
+	assert.Regexp(t, `2026-10-15\s+10 B`, s)
+	assert.NotContains(t, s, "2026-09-15", "older than --days")
+	assert.Less(t, bytes.Index(out.Bytes(), []byte("2026-10 ")), bytes.Index(out.Bytes(), []byte("2026-09 ")), "newest month first")
+	assert.NotContains(t, s, "CLASS", "no --classify breakdown")
+
+	d.Add("http://localhost:3000", stats.Counters{Classes: map[string]stats.ClassCounters{
+		"html": {Requests: 1, Bytes: 100, DurationMillis: 5},
+		"api":  {Requests: 4, Bytes: 4096, DurationMillis: 100},
+	}}, now)
+	out.Reset()
+	printStats(&out, &d, 7, now)
+	s = out.String()
+	assert.Regexp(t, `api\s+4\s+4\.0 KiB\s+25ms`, s)
+	assert.Regexp(t, `html\s+1\s+100 B\s+5ms`, s)
+	assert.Less(t, strings.Index(s, "api "), strings.Index(s, "html "), "most bytes first")
+
+	clierrors.SetUTCTimes(true)
+	defer clierrors.SetUTCTimes(false)
+	out.Reset()
+	printStats(&out, &d, 7, now.Add(3*time.Minute))
+	assert.Contains(t, out.String(), "(last seen "+now.UTC().Format(time.RFC3339)+" (3m ago))", "--utc")
+
+	out.Reset()
+	printStats(&out, &stats.Data{}, 7, now)
+	assert.Equal(t, "No traffic recorded yet.\n", out.String())
+}
+
+func TestRunStatsCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	var d stats.Data
+	d.Add("k", stats.Counters{BytesUp: 1}, time.Now())
+	require.NoError(t, stats.Save(path, &d, time.Now()))
+
+	assert.Equal(t, 0, runStatsCommand([]string{path}))
+	assert.Equal(t, 0, runStatsCommand([]string{"--json", "--stats-file", path}))
+	assert.Equal(t, 2, runStatsCommand(nil))
+}
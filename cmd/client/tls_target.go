@@ -0,0 +1,58 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fortunnels/client/internal/config"
+	clierrors "github.com/fortunnels/client/internal/support"
+)
+
+// targetTLSAction is what a local target that answers with TLS does to the
+// protocol of a new tunnel.
+type targetTLSAction int
+
+const (
+	targetTLSKeep targetTLSAction = iota
+	// targetTLSUpgrade creates an https tunnel instead of an http one.
+	targetTLSUpgrade
+	// targetTLSWarn keeps the http the user asked for and warns that the
+	// server will speak plaintext to a TLS port.
+	targetTLSWarn
+)
+
+// decideTargetTLS picks the action for an http tunnel whose target speaks
+// TLS: an explicit --protocol http is kept (with a warning), a default one
+// becomes https.
+func decideTargetTLS(protocol string, explicit, speaksTLS bool) targetTLSAction {
+	switch {
+	case protocol != protoHTTP || !speaksTLS:
+		return targetTLSKeep
+	case explicit:
+		return targetTLSWarn
+	default:
+		return targetTLSUpgrade
+	}
+}
+
+// checkTargetTLS probes the local target of a new http tunnel for TLS, so
+// `client 8443` against a local HTTPS dev server gets an https tunnel. The
+// https tunnel request then carries the TLS settings for the target (for
+// loopback targets: skip verification, SNI localhost).
+func checkTargetTLS(cfg *config.Config) {
+	if cfg.TunnelID != "" || cfg.Protocol != protoHTTP || cfg.TargetAddr == "" {
+		return
+	}
+	speaksTLS := clierrors.SpeaksTLS(cfg.TargetAddr, clierrors.TLSProbeTimeout)
+	switch decideTargetTLS(cfg.Protocol, cfg.IsSet("protocol"), speaksTLS) {
+	case targetTLSUpgrade:
+		cfg.Protocol = protoHTTPS
+		fmt.Printf("🔒 %s answers with TLS: creating an https tunnel\n", cfg.TargetAddr)
+	case targetTLSWarn:
+		fmt.Fprintf(os.Stderr, "⚠️  %s answers with TLS, but --protocol http makes the server send it plaintext: requests will fail\n   Use --protocol https (or leave --protocol out)\n", cfg.TargetAddr)
+	case targetTLSKeep:
+	}
+}
@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecideTargetTLS(t *testing.T) {
+	tests := []struct {
+		name      string
+		protocol  string
+		explicit  bool
+		speaksTLS bool
+		want      targetTLSAction
+	}{
+		{"default http, TLS target", protoHTTP, false, true, targetTLSUpgrade},
+		{"explicit http, TLS target", protoHTTP, true, true, targetTLSWarn},
+		{"default http, plaintext target", protoHTTP, false, false, targetTLSKeep},
+		{"explicit http, plaintext target", protoHTTP, true, false, targetTLSKeep},
+		{"https, TLS target", protoHTTPS, true, true, targetTLSKeep},
+		{"tcp, TLS target", "tcp", false, true, targetTLSKeep},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, decideTargetTLS(tt.protocol, tt.explicit, tt.speaksTLS), tt.name)
+	}
+}
+
+func TestCheckTargetTLS(t *testing.T) {
+	ok := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	tlsSrv := httptest.NewTLSServer(ok)
+	defer tlsSrv.Close()
+	plain := httptest.NewServer(ok)
+	defer plain.Close()
+
+	cfg := exitTestConfig("https://fortunnels.ru")
+	cfg.TargetAddr = tlsSrv.Listener.Addr().String()
+	checkTargetTLS(cfg)
+	assert.Equal(t, protoHTTPS, cfg.Protocol, "a TLS target upgrades the default protocol")
+
+	cfg = exitTestConfig("https://fortunnels.ru")
+	cfg.TargetAddr = plain.Listener.Addr().String()
+	checkTargetTLS(cfg)
+	assert.Equal(t, protoHTTP, cfg.Protocol)
+
+	cfg = exitTestConfig("https://fortunnels.ru")
+	cfg.TargetAddr, cfg.TunnelID = tlsSrv.Listener.Addr().String(), "t-1"
+	checkTargetTLS(cfg)
+	assert.Equal(t, protoHTTP, cfg.Protocol, "an existing tunnel keeps its protocol")
+}
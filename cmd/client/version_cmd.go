@@ -0,0 +1,41 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/fortunnels/client/internal/config"
+	ctrl "github.com/fortunnels/client/internal/control"
+)
+
+// runVersionCommand prints the client version. With further flags
+// (`-v --server URL`) it also asks that server for its features and prints
+// the compatibility summary.
+func runVersionCommand(args []string) int {
+	fmt.Printf("fortunnels-client %s\n", version)
+	if len(args) == 0 {
+		return 0
+	}
+	return withCommandLine(args, func() int {
+		cfg, err := config.Parse()
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 2
+		}
+		announced, err := ctrl.FetchCapabilities(cfg.ServerURL, nil, "")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Server %s: %v\n", cfg.ServerURL, err)
+			return 1
+		}
+		fmt.Printf("Server %s: %s\n", cfg.ServerURL, config.NewCapabilities(announced).Summary())
+		return 0
+	})
+}
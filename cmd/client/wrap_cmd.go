@@ -0,0 +1,32 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	dp "github.com/fortunnels/client/internal/dataplane"
+)
+
+// runWrapCommand carries local TCP connections over WebSockets to the
+// --raw-path of an http/https tunnel, for networks that only let HTTP out.
+func runWrapCommand(args []string) int {
+	fs := flag.NewFlagSet("wrap", flag.ContinueOnError)
+	listen := fs.String("listen", "", "Local address to accept TCP connections on (e.g. :4000)")
+	via := fs.String("via", "", "Public URL of the tunnel's --raw-path (e.g. https://abc.example.com/raw)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *listen == "" || *via == "" {
+		fmt.Fprintln(os.Stderr, "❌ wrap requires --listen and --via\n   Example: client wrap --listen :4000 --via https://abc.example.com/raw")
+		return 2
+	}
+	if err := dp.ServeWrap(*listen, *via); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	return 0
+}
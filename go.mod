@@ -10,7 +10,9 @@ require (
 	github.com/quic-go/quic-go v0.59.1
 	github.com/stretchr/testify v1.11.1
 	github.com/xtaci/smux v1.5.57
+	go.uber.org/goleak v1.3.0
 	golang.org/x/crypto v0.52.0
+	golang.org/x/net v0.55.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
@@ -21,6 +23,9 @@ require (
 	github.com/pion/transport/v4 v4.0.2 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/rogpeppe/go-internal v1.14.1 // indirect
-	golang.org/x/net v0.55.0 // indirect
 	golang.org/x/sys v0.45.0 // indirect
 )
+
+// Patched to keep buffered data across a mutual half-close; see
+// third_party/smux/PATCHES.md.
+replace github.com/xtaci/smux => ./third_party/smux
@@ -0,0 +1,240 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+// Package announce publishes tunnel URLs on the local network via mDNS/DNS-SD
+// (service type _fortunnels._tcp) and browses for announcements from other
+// clients.
+//
+// Announcing is best-effort: callers log failures and keep the tunnel running.
+package announce
+
+import (
+	"errors"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fortunnels/client/internal/support"
+)
+
+const (
+	// ServiceType is the DNS-SD service type used for tunnel announcements.
+	ServiceType = "_fortunnels._tcp.local."
+
+	defaultTTL             = 120 * time.Second
+	defaultRefreshInterval = defaultTTL / 2
+)
+
+// ErrClosed is returned by a Transport after Close.
+var ErrClosed = errors.New("announce: transport closed")
+
+// Transport sends and receives raw mDNS messages. Send must deliver to every
+// member of the group, including the sender itself when on the same host.
+type Transport interface {
+	Send(msg []byte) error
+	// Receive blocks until a message arrives or the transport is closed.
+	Receive() ([]byte, net.Addr, error)
+	Close() error
+}
+
+// Service describes the tunnel being announced.
+type Service struct {
+	Instance  string
+	PublicURL string
+	Protocol  string
+	Owner     string
+}
+
+// Entry is an announcement seen while browsing.
+type Entry struct {
+	Service
+	Source string
+}
+
+// Announcer keeps a Service published: it announces on Publish, answers
+// queries for ServiceType and re-announces before the records expire.
+type Announcer struct {
+	t       Transport
+	refresh time.Duration
+
+	mu      sync.Mutex
+	current *Service
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewAnnouncer starts answering queries on t. Close releases t.
+func NewAnnouncer(t Transport) *Announcer {
+	a := &Announcer{t: t, refresh: defaultRefreshInterval, done: make(chan struct{})}
+	a.wg.Add(2)
+	support.Go(support.PanicScope{Role: "announce responder"}, a.answerQueries)
+	support.Go(support.PanicScope{Role: "announce refresh"}, a.refreshLoop)
+	return a
+}
+
+// Publish announces s, replacing (and withdrawing) any previously published
+// service, e.g. after the tunnel was recreated.
+func (a *Announcer) Publish(s Service) error {
+	s.Instance = instanceLabel(s.Instance)
+	a.mu.Lock()
+	prev := a.current
+	a.current = &s
+	a.mu.Unlock()
+	if prev != nil && prev.Instance != s.Instance {
+		if err := a.send(*prev, 0); err != nil {
+			log.Printf("[WARN] announce: withdraw %s: %v", prev.Instance, err)
+		}
+	}
+	return a.send(s, defaultTTL)
+}
+
+// Withdraw sends a goodbye (TTL 0) for the current service, if any.
+func (a *Announcer) Withdraw() error {
+	a.mu.Lock()
+	prev := a.current
+	a.current = nil
+	a.mu.Unlock()
+	if prev == nil {
+		return nil
+	}
+	return a.send(*prev, 0)
+}
+
+// Close withdraws the announcement and closes the transport.
+func (a *Announcer) Close() error {
+	werr := a.Withdraw()
+	close(a.done)
+	cerr := a.t.Close()
+	a.wg.Wait()
+	if werr != nil {
+		return werr
+	}
+	return cerr
+}
+
+func (a *Announcer) send(s Service, ttl time.Duration) error {
+	msg, err := buildAnnouncement(s, ttl)
+	if err != nil {
+		return err
+	}
+	return a.t.Send(msg)
+}
+
+func (a *Announcer) answerQueries() {
+	defer a.wg.Done()
+	for {
+		msg, _, err := a.t.Receive()
+		if err != nil {
+			return
+		}
+		if !isServiceQuery(msg) {
+			continue
+		}
+		a.mu.Lock()
+		cur := a.current
+		a.mu.Unlock()
+		if cur == nil {
+			continue
+		}
+		if err := a.send(*cur, defaultTTL); err != nil {
+			log.Printf("[WARN] announce: answer query: %v", err)
+		}
+	}
+}
+
+func (a *Announcer) refreshLoop() {
+	defer a.wg.Done()
+	ticker := time.NewTicker(a.refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+			a.mu.Lock()
+			cur := a.current
+			a.mu.Unlock()
+			if cur == nil {
+				continue
+			}
+			if err := a.send(*cur, defaultTTL); err != nil {
+				log.Printf("[WARN] announce: refresh: %v", err)
+			}
+		}
+	}
+}
+
+// Browse queries for ServiceType and collects announcements for wait. It
+// closes t before returning. Entries are sorted by instance name.
+func Browse(t Transport, wait time.Duration) ([]Entry, error) {
+	var mu sync.Mutex
+	seen := make(map[string]Entry)
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		for {
+			msg, src, err := t.Receive()
+			if err != nil {
+				return
+			}
+			recs, ok := parseAnnouncement(msg)
+			if !ok {
+				continue
+			}
+			mu.Lock()
+			for _, r := range recs {
+				if r.ttl == 0 {
+					delete(seen, r.svc.Instance)
+					continue
+				}
+				e := Entry{Service: r.svc}
+				if src != nil {
+					e.Source = src.String()
+				}
+				seen[r.svc.Instance] = e
+			}
+			mu.Unlock()
+		}
+	}()
+
+	query, err := buildQuery()
+	if err == nil {
+		err = t.Send(query)
+	}
+	if err != nil {
+		_ = t.Close()
+		<-readDone
+		return nil, err
+	}
+	time.Sleep(wait)
+	_ = t.Close()
+	<-readDone
+
+	entries := make([]Entry, 0, len(seen))
+	for _, e := range seen {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Instance < entries[j].Instance })
+	return entries, nil
+}
+
+// instanceLabel turns name into a single DNS label (letters, digits, '-').
+func instanceLabel(name string) string {
+	b := make([]byte, 0, len(name))
+	for i := 0; i < len(name) && len(b) < 63; i++ {
+		c := name[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-':
+			b = append(b, c)
+		default:
+			b = append(b, '-')
+		}
+	}
+	if len(b) == 0 {
+		return "fortunnels"
+	}
+	return string(b)
+}
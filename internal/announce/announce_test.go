@@ -0,0 +1,158 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package announce
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryBus delivers every message to all joined transports, like multicast
+// with loopback enabled.
+type memoryBus struct {
+	mu      sync.Mutex
+	members map[*memoryTransport]struct{}
+}
+
+func newMemoryBus() *memoryBus {
+	return &memoryBus{members: make(map[*memoryTransport]struct{})}
+}
+
+func (b *memoryBus) join() *memoryTransport {
+	t := &memoryTransport{bus: b, in: make(chan []byte, 64), done: make(chan struct{})}
+	b.mu.Lock()
+	b.members[t] = struct{}{}
+	b.mu.Unlock()
+	return t
+}
+
+type memoryTransport struct {
+	bus  *memoryBus
+	in   chan []byte
+	done chan struct{}
+	once sync.Once
+}
+
+func (t *memoryTransport) Send(msg []byte) error {
+	t.bus.mu.Lock()
+	defer t.bus.mu.Unlock()
+	for m := range t.bus.members {
+		select {
+		case m.in <- append([]byte(nil), msg...):
+		default:
+		}
+	}
+	return nil
+}
+
+func (t *memoryTransport) Receive() ([]byte, net.Addr, error) {
+	select {
+	case msg := <-t.in:
+		return msg, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5353}, nil
+	case <-t.done:
+		return nil, nil, ErrClosed
+	}
+}
+
+func (t *memoryTransport) Close() error {
+	t.once.Do(func() {
+		t.bus.mu.Lock()
+		delete(t.bus.members, t)
+		t.bus.mu.Unlock()
+		close(t.done)
+	})
+	return nil
+}
+
+func TestAnnouncement_RoundTrip(t *testing.T) {
+	svc := Service{Instance: "alice-t1", PublicURL: "https://t1.example.com", Protocol: "http", Owner: "alice"}
+	msg, err := buildAnnouncement(svc, defaultTTL)
+	require.NoError(t, err)
+
+	recs, ok := parseAnnouncement(msg)
+	require.True(t, ok)
+	require.Len(t, recs, 1)
+	assert.Equal(t, svc, recs[0].svc)
+	assert.Equal(t, uint32(120), recs[0].ttl)
+	assert.False(t, isServiceQuery(msg), "responses are not queries")
+}
+
+func TestQuery_IsRecognised(t *testing.T) {
+	q, err := buildQuery()
+	require.NoError(t, err)
+	assert.True(t, isServiceQuery(q))
+	_, ok := parseAnnouncement(q)
+	assert.False(t, ok)
+}
+
+func TestBuildAnnouncement_RejectsOversizedTXT(t *testing.T) {
+	long := make([]byte, 300)
+	for i := range long {
+		long[i] = 'a'
+	}
+	_, err := buildAnnouncement(Service{Instance: "x", PublicURL: string(long)}, defaultTTL)
+	require.ErrorContains(t, err, "public_url")
+}
+
+func TestInstanceLabel(t *testing.T) {
+	assert.Equal(t, "alice-t-1", instanceLabel("alice.t 1"))
+	assert.Equal(t, "fortunnels", instanceLabel(""))
+	assert.Len(t, instanceLabel(string(make([]byte, 100))), 63)
+}
+
+func TestBrowse_FindsPublishedService(t *testing.T) {
+	bus := newMemoryBus()
+	a := NewAnnouncer(bus.join())
+	defer a.Close()
+	svc := Service{Instance: "bob-t2", PublicURL: "tcp://edge.example.com:4000", Protocol: "tcp", Owner: "bob"}
+	require.NoError(t, a.Publish(svc))
+
+	entries, err := Browse(bus.join(), 50*time.Millisecond)
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "browser's query is answered by the announcer")
+	assert.Equal(t, svc, entries[0].Service)
+	assert.Equal(t, "127.0.0.1:5353", entries[0].Source)
+}
+
+func TestAnnouncer_RepublishWithdrawsPreviousInstance(t *testing.T) {
+	bus := newMemoryBus()
+	a := NewAnnouncer(bus.join())
+	defer a.Close()
+	require.NoError(t, a.Publish(Service{Instance: "old", PublicURL: "https://old.example.com"}))
+
+	browser := bus.join()
+	done := make(chan []Entry, 1)
+	go func() {
+		entries, _ := Browse(browser, 100*time.Millisecond)
+		done <- entries
+	}()
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, a.Publish(Service{Instance: "new", PublicURL: "https://new.example.com"}))
+
+	entries := <-done
+	require.Len(t, entries, 1)
+	assert.Equal(t, "new", entries[0].Instance)
+}
+
+func TestAnnouncer_CloseSendsGoodbye(t *testing.T) {
+	bus := newMemoryBus()
+	a := NewAnnouncer(bus.join())
+	require.NoError(t, a.Publish(Service{Instance: "gone", PublicURL: "https://gone.example.com"}))
+
+	browser := bus.join()
+	done := make(chan []Entry, 1)
+	go func() {
+		entries, _ := Browse(browser, 100*time.Millisecond)
+		done <- entries
+	}()
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, a.Close())
+
+	assert.Empty(t, <-done, "goodbye removes the entry")
+}
@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package announce
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// cacheFlushClass is class IN with the mDNS cache-flush bit (RFC 6762 §10.2).
+const cacheFlushClass = dnsmessage.ClassINET | 1<<15
+
+const (
+	txtPublicURL = "public_url="
+	txtProtocol  = "protocol="
+	txtOwner     = "owner="
+)
+
+type announcedRecord struct {
+	svc Service
+	ttl uint32
+}
+
+func serviceName() dnsmessage.Name {
+	return dnsmessage.MustNewName(ServiceType)
+}
+
+func instanceName(instance string) (dnsmessage.Name, error) {
+	return dnsmessage.NewName(instance + "." + ServiceType)
+}
+
+func buildQuery() ([]byte, error) {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{})
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(dnsmessage.Question{Name: serviceName(), Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, err
+	}
+	return b.Finish()
+}
+
+// buildAnnouncement encodes PTR and TXT records for s; ttl 0 is a goodbye.
+func buildAnnouncement(s Service, ttl time.Duration) ([]byte, error) {
+	inst, err := instanceName(s.Instance)
+	if err != nil {
+		return nil, fmt.Errorf("announce: instance name: %w", err)
+	}
+	txt := []string{txtPublicURL + s.PublicURL, txtProtocol + s.Protocol, txtOwner + s.Owner}
+	for _, t := range txt {
+		if len(t) > 255 {
+			return nil, fmt.Errorf("announce: TXT record %q exceeds 255 bytes", t[:strings.IndexByte(t, '=')])
+		}
+	}
+	secs := uint32(ttl / time.Second)
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{Response: true, Authoritative: true})
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+	ptrHdr := dnsmessage.ResourceHeader{Name: serviceName(), Class: dnsmessage.ClassINET, TTL: secs}
+	if err := b.PTRResource(ptrHdr, dnsmessage.PTRResource{PTR: inst}); err != nil {
+		return nil, err
+	}
+	txtHdr := dnsmessage.ResourceHeader{Name: inst, Class: cacheFlushClass, TTL: secs}
+	if err := b.TXTResource(txtHdr, dnsmessage.TXTResource{TXT: txt}); err != nil {
+		return nil, err
+	}
+	return b.Finish()
+}
+
+// isServiceQuery reports whether msg asks for ServiceType PTR records.
+func isServiceQuery(msg []byte) bool {
+	var p dnsmessage.Parser
+	h, err := p.Start(msg)
+	if err != nil || h.Response {
+		return false
+	}
+	qs, err := p.AllQuestions()
+	if err != nil {
+		return false
+	}
+	for _, q := range qs {
+		if (q.Type == dnsmessage.TypePTR || q.Type == dnsmessage.TypeALL) && strings.EqualFold(q.Name.String(), ServiceType) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAnnouncement extracts services from a response carrying our TXT records.
+func parseAnnouncement(msg []byte) ([]announcedRecord, bool) {
+	var p dnsmessage.Parser
+	h, err := p.Start(msg)
+	if err != nil || !h.Response {
+		return nil, false
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil, false
+	}
+	suffix := "." + ServiceType
+	var out []announcedRecord
+	for {
+		rh, err := p.AnswerHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return nil, false
+		}
+		name := rh.Name.String()
+		if rh.Type != dnsmessage.TypeTXT || !strings.HasSuffix(strings.ToLower(name), suffix) {
+			if err := p.SkipAnswer(); err != nil {
+				return nil, false
+			}
+			continue
+		}
+		txt, err := p.TXTResource()
+		if err != nil {
+			return nil, false
+		}
+		svc := Service{Instance: name[:len(name)-len(suffix)]}
+		for _, kv := range txt.TXT {
+			switch {
+			case strings.HasPrefix(kv, txtPublicURL):
+				svc.PublicURL = kv[len(txtPublicURL):]
+			case strings.HasPrefix(kv, txtProtocol):
+				svc.Protocol = kv[len(txtProtocol):]
+			case strings.HasPrefix(kv, txtOwner):
+				svc.Owner = kv[len(txtOwner):]
+			}
+		}
+		out = append(out, announcedRecord{svc: svc, ttl: rh.TTL})
+	}
+	return out, len(out) > 0
+}
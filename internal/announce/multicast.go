@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package announce
+
+import (
+	"errors"
+	"net"
+
+	"golang.org/x/net/ipv4"
+)
+
+const maxMessageSize = 9000
+
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+type multicastTransport struct {
+	conn *net.UDPConn
+}
+
+// NewMulticastTransport joins the IPv4 mDNS group on ifi (nil means the
+// system default interface). Multicast loopback is enabled so clients on the
+// same host see each other.
+func NewMulticastTransport(ifi *net.Interface) (Transport, error) {
+	conn, err := net.ListenMulticastUDP("udp4", ifi, mdnsGroup)
+	if err != nil {
+		return nil, err
+	}
+	pc := ipv4.NewPacketConn(conn)
+	if err := pc.SetMulticastLoopback(true); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if ifi != nil {
+		if err := pc.SetMulticastInterface(ifi); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	_ = pc.SetMulticastTTL(255)
+	return &multicastTransport{conn: conn}, nil
+}
+
+func (m *multicastTransport) Send(msg []byte) error {
+	_, err := m.conn.WriteToUDP(msg, mdnsGroup)
+	return err
+}
+
+func (m *multicastTransport) Receive() ([]byte, net.Addr, error) {
+	buf := make([]byte, maxMessageSize)
+	n, src, err := m.conn.ReadFromUDP(buf)
+	if err != nil {
+		if errors.Is(err, net.ErrClosed) {
+			return nil, nil, ErrClosed
+		}
+		return nil, nil, err
+	}
+	return buf[:n], src, nil
+}
+
+func (m *multicastTransport) Close() error { return m.conn.Close() }
@@ -0,0 +1,75 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+//go:build integration
+
+package announce
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const childEnv = "FORTUNNELS_ANNOUNCE_CHILD"
+
+func loopbackTransport(t *testing.T) Transport {
+	t.Helper()
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skipf("no loopback interface: %v", err)
+	}
+	tr, err := NewMulticastTransport(lo)
+	if err != nil {
+		t.Skipf("multicast unavailable on loopback: %v", err)
+	}
+	return tr
+}
+
+// TestHelperAnnounceProcess is the second client process; it only runs when
+// re-executed by TestMulticast_TwoProcessesDiscoverEachOther.
+func TestHelperAnnounceProcess(t *testing.T) {
+	if os.Getenv(childEnv) == "" {
+		t.Skip("helper process")
+	}
+	a := NewAnnouncer(loopbackTransport(t))
+	defer a.Close()
+	require.NoError(t, a.Publish(Service{Instance: "child", PublicURL: "https://child.example.com", Protocol: "http", Owner: "bob"}))
+	entries, err := Browse(loopbackTransport(t), time.Second)
+	require.NoError(t, err)
+	for _, e := range entries {
+		fmt.Printf("found=%s\n", e.Instance)
+	}
+}
+
+func TestMulticast_TwoProcessesDiscoverEachOther(t *testing.T) {
+	a := NewAnnouncer(loopbackTransport(t))
+	defer a.Close()
+	require.NoError(t, a.Publish(Service{Instance: "parent", PublicURL: "https://parent.example.com", Protocol: "http", Owner: "alice"}))
+
+	var out bytes.Buffer
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperAnnounceProcess$", "-test.v")
+	cmd.Env = append(os.Environ(), childEnv+"=1")
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	require.NoError(t, cmd.Start())
+
+	time.Sleep(200 * time.Millisecond)
+	entries, err := Browse(loopbackTransport(t), 500*time.Millisecond)
+	require.NoError(t, err)
+	require.NoError(t, cmd.Wait(), out.String())
+
+	var found []string
+	for _, e := range entries {
+		found = append(found, e.Instance)
+	}
+	require.Contains(t, found, "child", "parent discovers the child's announcement")
+	require.True(t, strings.Contains(out.String(), "found=parent"), "child discovers the parent's announcement:\n%s", out.String())
+}
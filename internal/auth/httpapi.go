@@ -17,15 +17,23 @@ import (
 	"time"
 
 	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/support"
 )
 
-// csrfCookieName matches internal/security/csrf.go (double-submit cookie).
-const csrfCookieName = "csrf_token"
+const (
+	// csrfCookieName matches internal/security/csrf.go (double-submit cookie).
+	csrfCookieName = "csrf_token"
+	// defaultAuthTimeout bounds login requests of a client built without a
+	// base client.
+	defaultAuthTimeout = 10 * time.Second
+)
 
 // SetupAuthentication configures HTTP client and authentication for tunnel creation.
 // Returns (httpClient, bearerToken, csrfToken, error). csrfToken is set after login/password
 // when the server issues a csrf_token cookie (needed for session POST/DELETE when CSRF is enabled).
-func SetupAuthentication(cfg *config.Config) (*http.Client, string, string, error) {
+// The session client is a copy of base (the control-plane client, carrying its
+// timeout and retry policy) with a cookie jar; nil base means a plain client.
+func SetupAuthentication(cfg *config.Config, base *http.Client) (*http.Client, string, string, error) {
 	if strings.TrimSpace(cfg.Token) != "" {
 		bearer := strings.TrimSpace(cfg.Token)
 		return nil, bearer, "", nil
@@ -35,7 +43,12 @@ func SetupAuthentication(cfg *config.Config) (*http.Client, string, string, erro
 		if err != nil {
 			return nil, "", "", fmt.Errorf("create cookie jar: %w", err)
 		}
-		httpClient := &http.Client{Timeout: 10 * time.Second, Jar: jar}
+		httpClient := &http.Client{Timeout: defaultAuthTimeout}
+		if base != nil {
+			c := *base
+			httpClient = &c
+		}
+		httpClient.Jar = jar
 		if err := loginLocal(httpClient, cfg.ServerURL, cfg.Login, cfg.Password); err != nil {
 			return nil, "", "", fmt.Errorf("login failed: %w", err)
 		}
@@ -58,9 +71,11 @@ func loginLocal(client *http.Client, serverURL, login, password string) error {
 	if err != nil {
 		return fmt.Errorf("marshal login payload: %w", err)
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	req, err := http.NewRequestWithContext(ctx, "POST", serverURL+"/auth/login-local", bytes.NewBuffer(b))
+	endpoint, err := support.ServerEndpoint(serverURL, "/auth/login-local", nil)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), "POST", endpoint, bytes.NewBuffer(b))
 	if err != nil {
 		return err
 	}
@@ -78,10 +93,11 @@ func loginLocal(client *http.Client, serverURL, login, password string) error {
 
 // bootstrapCSRFCookie performs a safe GET so the server can set csrf_token (CSRF middleware on GET).
 func bootstrapCSRFCookie(client *http.Client, serverURL string) error {
-	u := strings.TrimRight(serverURL, "/") + "/auth/me"
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	u, err := support.ServerEndpoint(serverURL, "/auth/me", nil)
+	if err != nil {
+		return fmt.Errorf("csrf bootstrap: %w", err)
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, u, nil)
 	if err != nil {
 		return fmt.Errorf("csrf bootstrap: %w", err)
 	}
@@ -24,7 +24,7 @@ func TestSetupAuthentication_WithToken(t *testing.T) {
 		ServerURL: "https://example.com",
 	}
 
-	client, bearer, csrf, err := SetupAuthentication(cfg)
+	client, bearer, csrf, err := SetupAuthentication(cfg, nil)
 	require.NoError(t, err, "SetupAuthentication()")
 	assert.Equal(t, "bearer-token-123", bearer, "SetupAuthentication() bearer")
 	assert.Empty(t, csrf, "SetupAuthentication() csrf with token")
@@ -63,7 +63,7 @@ func TestSetupAuthentication_WithLoginPassword(t *testing.T) {
 		ServerURL: server.URL,
 	}
 
-	client, bearer, csrf, err := SetupAuthentication(cfg)
+	client, bearer, csrf, err := SetupAuthentication(cfg, nil)
 	require.NoError(t, err, "SetupAuthentication()")
 	assert.Empty(t, bearer, "SetupAuthentication() bearer")
 	assert.Equal(t, testCSRF, csrf, "SetupAuthentication() should return CSRF from bootstrap GET")
@@ -91,7 +91,7 @@ func TestSetupAuthentication_WithLoginPassword_InvalidCredentials(t *testing.T)
 		ServerURL: server.URL,
 	}
 
-	_, _, _, err := SetupAuthentication(cfg)
+	_, _, _, err := SetupAuthentication(cfg, nil)
 	require.Error(t, err, "SetupAuthentication() with invalid credentials should return error")
 }
 
@@ -100,7 +100,7 @@ func TestSetupAuthentication_Empty(t *testing.T) {
 		ServerURL: "https://example.com",
 	}
 
-	client, bearer, csrf, err := SetupAuthentication(cfg)
+	client, bearer, csrf, err := SetupAuthentication(cfg, nil)
 	require.NoError(t, err, "SetupAuthentication()")
 	assert.Empty(t, bearer, "SetupAuthentication() bearer")
 	assert.Empty(t, csrf, "SetupAuthentication() csrf")
@@ -113,7 +113,7 @@ func TestSetupAuthentication_WithToken_Whitespace(t *testing.T) {
 		ServerURL: "https://example.com",
 	}
 
-	_, bearer, csrf, err := SetupAuthentication(cfg)
+	_, bearer, csrf, err := SetupAuthentication(cfg, nil)
 	require.NoError(t, err, "SetupAuthentication()")
 	assert.Equal(t, "bearer-token-123", bearer, "SetupAuthentication() bearer")
 	assert.Empty(t, csrf, "SetupAuthentication() csrf with token")
@@ -39,6 +39,19 @@ func ComputeDataPlaneAuthWithPSK(tunnelID, dpAuthTokenFlag, dpAuthSecretFlag, ps
 	return computeHMAC(sec, tunnelID)
 }
 
+// IncomingStreamHMAC returns the HMAC a server puts in the preface of a
+// server-initiated stream: HMAC-SHA256(secret, tunnel_id||dst), hex-encoded.
+func IncomingStreamHMAC(secret, tunnelID, dst string) string {
+	return computeHMAC(secret, tunnelID+dst)
+}
+
+// VerifyIncomingStreamHMAC reports whether mac is the IncomingStreamHMAC for
+// tunnelID and dst, in constant time.
+func VerifyIncomingStreamHMAC(secret, tunnelID, dst, mac string) bool {
+	want := IncomingStreamHMAC(secret, tunnelID, dst)
+	return hmac.Equal([]byte(want), []byte(strings.ToLower(strings.TrimSpace(mac))))
+}
+
 // computeHMAC returns hex-encoded HMAC-SHA256(secret, message)
 func computeHMAC(secret, message string) string {
 	h := hmac.New(sha256.New, []byte(secret))
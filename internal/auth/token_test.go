@@ -74,3 +74,14 @@ func TestComputeHMAC(t *testing.T) {
 	result2 := computeHMAC(secret, message)
 	assert.Equal(t, result2, result, "computeHMAC() should be consistent, got %v and %v")
 }
+
+func TestVerifyIncomingStreamHMAC(t *testing.T) {
+	const secret, tid, dst = "dp-secret", "tunnel-123", "127.0.0.1:8080"
+	mac := computeHMAC(secret, tid+dst)
+	assert.Equal(t, mac, IncomingStreamHMAC(secret, tid, dst))
+	assert.True(t, VerifyIncomingStreamHMAC(secret, tid, dst, mac))
+	assert.False(t, VerifyIncomingStreamHMAC(secret, tid, "127.0.0.1:22", mac), "dst is covered")
+	assert.False(t, VerifyIncomingStreamHMAC(secret, "tunnel-456", dst, mac), "tunnel ID is covered")
+	assert.False(t, VerifyIncomingStreamHMAC("other-secret", tid, dst, mac))
+	assert.False(t, VerifyIncomingStreamHMAC(secret, tid, dst, ""))
+}
@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var byteRateUnits = []struct {
+	suffix string
+	scale  float64
+}{
+	{"kib", 1 << 10}, {"mib", 1 << 20}, {"gib", 1 << 30},
+	{"kb", 1e3}, {"mb", 1e6}, {"gb", 1e9},
+	{"k", 1 << 10}, {"m", 1 << 20}, {"g", 1 << 30},
+	{"b", 1},
+}
+
+// ParseByteRate parses a --rate-limit value in bytes per second: a plain
+// number or one with a unit (512KiB, 10MB, 1.5M; k/m/g are binary), with an
+// optional "/s". Empty and "0" mean unlimited.
+func ParseByteRate(value string) (int64, error) {
+	v := strings.ToLower(strings.TrimSpace(value))
+	v = strings.TrimSuffix(v, "/s")
+	if v == "" || v == "0" || v == "off" {
+		return 0, nil
+	}
+	scale := 1.0
+	for _, u := range byteRateUnits {
+		if strings.HasSuffix(v, u.suffix) {
+			v, scale = strings.TrimSpace(strings.TrimSuffix(v, u.suffix)), u.scale
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid byte rate %q", value)
+	}
+	return int64(n * scale), nil
+}
+
+// ParseByteSize parses a byte count such as --max-bytes-total: the values of
+// ParseByteRate without "/s". Empty and "0" mean unlimited.
+func ParseByteSize(value string) (int64, error) {
+	if strings.HasSuffix(strings.TrimSpace(value), "/s") {
+		return 0, fmt.Errorf("invalid byte size %q", value)
+	}
+	n, err := ParseByteRate(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid byte size %q", value)
+	}
+	return n, nil
+}
@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/fortunnels/client/internal/security"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+// baselineFeatures are the features the client has always used without
+// asking. A server that does not announce its features is assumed to have
+// exactly these, so an unknown server sees today's behavior.
+var baselineFeatures = []string{
+	protocolv1.FeaturePSKKDF,
+	protocolv1.FeatureHops,
+	protocolv1.FeatureTakeover,
+	protocolv1.FeatureKeepalive,
+	protocolv1.FeatureQUIC,
+	protocolv1.FeatureDTLS,
+}
+
+// Capabilities is what the client knows about the server's protocol
+// features. The zero value is the baseline of a server that announced none.
+type Capabilities struct {
+	// Version is the server version, when announced.
+	Version  string
+	known    bool
+	features []string
+}
+
+// NewCapabilities returns the capabilities a server announced; nil (404 on
+// GET /api/version, no capabilities block) is the baseline.
+func NewCapabilities(c *protocolv1.ServerCapabilities) Capabilities {
+	if c == nil {
+		return Capabilities{}
+	}
+	features := make([]string, 0, len(c.Features))
+	for _, f := range c.Features {
+		if f = strings.ToLower(strings.TrimSpace(f)); f != "" && !slices.Contains(features, f) {
+			features = append(features, f)
+		}
+	}
+	return Capabilities{Version: strings.TrimSpace(c.Version), known: true, features: features}
+}
+
+// Known reports whether the server announced its features.
+func (c Capabilities) Known() bool { return c.known }
+
+// Has reports whether the server supports feature.
+func (c Capabilities) Has(feature string) bool {
+	if !c.known {
+		return slices.Contains(baselineFeatures, feature)
+	}
+	return slices.Contains(c.features, feature)
+}
+
+// Summary is the one-line compatibility report of the version command.
+func (c Capabilities) Summary() string {
+	if !c.known {
+		return "server does not announce its features; assuming the baseline (" + strings.Join(baselineFeatures, ", ") + ")"
+	}
+	var missing []string
+	for _, f := range baselineFeatures {
+		if !c.Has(f) {
+			missing = append(missing, f)
+		}
+	}
+	version := c.Version
+	if version == "" {
+		version = "unknown version"
+	}
+	supported := "none"
+	if len(c.features) > 0 {
+		supported = strings.Join(c.features, ", ")
+	}
+	summary := fmt.Sprintf("server %s supports %s", version, supported)
+	if len(missing) > 0 {
+		summary += "; unsupported: " + strings.Join(missing, ", ")
+	}
+	return summary
+}
+
+// ApplyCapabilities gates the features of c on what the server supports. A
+// feature the user asked for explicitly is refused with an error; one the
+// client would only use by default is downgraded, and the returned notes say
+// how. The capabilities are also recorded for RuntimeSettings and
+// EncryptionSettings.
+func (c *Config) ApplyCapabilities(caps Capabilities) (notes []string, err error) {
+	c.Capabilities = caps
+	quicServe, _ := c.QUICServe()
+	for _, dp := range []string{protocolv1.FeatureQUIC, protocolv1.FeatureDTLS} {
+		feature := dp
+		if quicServe && dp == protocolv1.FeatureQUIC {
+			// http/https tunnels need the server to open their streams on QUIC.
+			feature = protocolv1.FeatureQUICServe
+		}
+		if strings.EqualFold(c.DataPlane, dp) && !caps.Has(feature) {
+			return nil, fmt.Errorf("--dp %s is not supported by this server\n   Example: drop --dp to use the WebSocket data plane", dp)
+		}
+	}
+	if quicServe && strings.EqualFold(c.DataPlane, DataPlaneAuto) && !caps.Has(protocolv1.FeatureQUICServe) {
+		c.DataPlane = DataPlaneWS
+		notes = append(notes, "server does not serve http tunnels over QUIC; --dp auto uses the WebSocket data plane")
+	}
+	if c.Redundant && !caps.Has(protocolv1.FeatureRedundant) {
+		return nil, fmt.Errorf("--redundant is not supported by this server\n   Example: drop --redundant to use one data plane")
+	}
+	if c.ResumeGET && !caps.Has(protocolv1.FeatureResumeGET) {
+		return nil, fmt.Errorf("--resume-get is not supported by this server\n   Example: drop --resume-get")
+	}
+	if c.Force && !caps.Has(protocolv1.FeatureTakeover) {
+		return nil, fmt.Errorf("--force needs tunnel takeover, which this server does not support\n   Example: stop the other client instance and rerun without --force")
+	}
+	if c.Encrypt && !caps.Has(protocolv1.FeaturePSKKDF) {
+		// Validate rejects unknown --psk-kdf names before this is called.
+		if kdf, _ := security.ResolveKDF(c.PSKKDF, c.PSK); kdf != security.LegacyKDF {
+			if c.IsSet("psk-kdf") {
+				return nil, fmt.Errorf("--psk-kdf %s is not supported by this server, which only derives legacy keys\n   Example: --psk-kdf legacy", c.PSKKDF)
+			}
+			c.PSKKDF = security.KDFLegacy
+			notes = append(notes, "server does not support the psk_kdf preface field; deriving the --psk key with the legacy KDF")
+		}
+	}
+	if c.TunnelKeepalive > 0 && !caps.Has(protocolv1.FeatureKeepalive) {
+		notes = append(notes, "server has no keepalive endpoint; --tunnel-keepalive uses the tunnel exists-check")
+	}
+	if c.SingleConnection && !caps.Has(protocolv1.FeatureControlStream) {
+		c.SingleConnection = false
+		notes = append(notes, "server has no control stream on the data plane; --single-connection falls back to a separate control WebSocket")
+	}
+	if c.ListenAddr != "" && !caps.Has(protocolv1.FeatureHops) {
+		notes = append(notes, "server does not relay the hops preface field; forwarding loops through it are only caught on this host")
+	}
+	return notes, nil
+}
@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/security"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+const capsPassphrase = "correct horse battery staple on tuesdays"
+
+func partialServer(features ...string) Capabilities {
+	return NewCapabilities(&protocolv1.ServerCapabilities{Version: "1.4.0", Features: features})
+}
+
+func TestCapabilities_Has(t *testing.T) {
+	baseline := NewCapabilities(nil)
+	assert.False(t, baseline.Known())
+	for _, f := range baselineFeatures {
+		assert.True(t, baseline.Has(f), "old servers keep %s", f)
+	}
+	assert.False(t, baseline.Has("compression"), "features newer than the baseline need an announcement")
+
+	caps := partialServer(" HOPS ", "quic", "quic", "")
+	assert.True(t, caps.Known())
+	assert.True(t, caps.Has(protocolv1.FeatureHops))
+	assert.True(t, caps.Has(protocolv1.FeatureQUIC))
+	assert.False(t, caps.Has(protocolv1.FeatureDTLS))
+
+	assert.Equal(t, "server does not announce its features; assuming the baseline (psk_kdf, hops, takeover, keepalive, quic, dtls)", baseline.Summary())
+	assert.Equal(t, "server 1.4.0 supports hops, quic; unsupported: psk_kdf, takeover, keepalive, dtls", caps.Summary())
+	assert.Equal(t, "server unknown version supports none; unsupported: psk_kdf, hops, takeover, keepalive, quic, dtls",
+		NewCapabilities(&protocolv1.ServerCapabilities{Features: []string{}}).Summary())
+}
+
+func TestApplyCapabilities_NewAndOldServers(t *testing.T) {
+	all := append([]string{"compression"}, baselineFeatures...)
+	for name, caps := range map[string]Capabilities{
+		"new server": partialServer(all...),
+		"old server": NewCapabilities(nil),
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := testParseWithArgs(t, []string{"client", "-encrypt", "-psk", capsPassphrase, "-force", "-listen", "127.0.0.1:0", "tcp", "5432"})
+			require.NoError(t, err)
+			notes, err := cfg.ApplyCapabilities(caps)
+			require.NoError(t, err)
+			assert.Empty(t, notes)
+			enc := cfg.EncryptionSettings()
+			assert.Equal(t, security.Argon2idKDF, enc.KDF)
+			assert.False(t, enc.OmitKDFPreface)
+			assert.True(t, cfg.RuntimeSettings().Capabilities.Has(protocolv1.FeatureHops))
+		})
+	}
+}
+
+func TestApplyCapabilities_Refused(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"quic", []string{"client", "-dp", "quic", "udp", "53"}, "--dp quic is not supported"},
+		{"dtls", []string{"client", "-dp", "dtls", "udp", "53"}, "--dp dtls is not supported"},
+		{"force", []string{"client", "-force", "8000"}, "--force needs tunnel takeover"},
+		{"redundant", []string{"client", "-protocol", "tcp", "-dst", "host:22", "-proxy-command", "-redundant"}, "--redundant is not supported"},
+		{"resume get", []string{"client", "-resume-get", "8000"}, "--resume-get is not supported"},
+		{"explicit argon2id", []string{"client", "-encrypt", "-psk", capsPassphrase, "-psk-kdf", "argon2id", "8000"}, "--psk-kdf argon2id is not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := testParseWithArgs(t, tt.args)
+			require.NoError(t, err)
+			_, err = cfg.ApplyCapabilities(partialServer(protocolv1.FeatureHops))
+			require.ErrorContains(t, err, tt.want)
+			require.ErrorContains(t, err, "Example:")
+		})
+	}
+}
+
+// TestApplyCapabilities_QUICServe: an http tunnel needs the server to serve
+// it over QUIC, not only the UDP QUIC data plane.
+func TestApplyCapabilities_QUICServe(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "-dp", "quic", "8000"})
+	require.NoError(t, err)
+	_, err = cfg.ApplyCapabilities(partialServer(protocolv1.FeatureQUIC))
+	require.ErrorContains(t, err, "--dp quic is not supported")
+
+	notes, err := cfg.ApplyCapabilities(partialServer(protocolv1.FeatureKeepalive, protocolv1.FeatureQUICServe))
+	require.NoError(t, err)
+	assert.Empty(t, notes)
+}
+
+func TestApplyCapabilities_Downgrades(t *testing.T) {
+	t.Run("psk kdf", func(t *testing.T) {
+		cfg, err := testParseWithArgs(t, []string{"client", "-encrypt", "-psk", capsPassphrase, "8000"})
+		require.NoError(t, err)
+		notes, err := cfg.ApplyCapabilities(partialServer(protocolv1.FeatureKeepalive))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"server does not support the psk_kdf preface field; deriving the --psk key with the legacy KDF"}, notes)
+		enc := cfg.EncryptionSettings()
+		assert.Equal(t, security.LegacyKDF, enc.KDF)
+		assert.True(t, enc.OmitKDFPreface)
+	})
+	t.Run("legacy kdf needs no note", func(t *testing.T) {
+		cfg, err := testParseWithArgs(t, []string{"client", "-encrypt", "-psk", capsPassphrase, "-psk-kdf", "legacy", "8000"})
+		require.NoError(t, err)
+		notes, err := cfg.ApplyCapabilities(partialServer(protocolv1.FeatureKeepalive))
+		require.NoError(t, err)
+		assert.Empty(t, notes)
+		assert.True(t, cfg.EncryptionSettings().OmitKDFPreface)
+	})
+	t.Run("keepalive", func(t *testing.T) {
+		cfg, err := testParseWithArgs(t, []string{"client", "8000"})
+		require.NoError(t, err)
+		notes, err := cfg.ApplyCapabilities(partialServer())
+		require.NoError(t, err)
+		assert.Equal(t, []string{"server has no keepalive endpoint; --tunnel-keepalive uses the tunnel exists-check"}, notes)
+		assert.False(t, cfg.RuntimeSettings().Capabilities.Has(protocolv1.FeatureKeepalive))
+
+		cfg, err = testParseWithArgs(t, []string{"client", "-tunnel-keepalive", "0", "8000"})
+		require.NoError(t, err)
+		notes, err = cfg.ApplyCapabilities(partialServer())
+		require.NoError(t, err)
+		assert.Empty(t, notes, "no note when the keepalive is off")
+	})
+	t.Run("hops", func(t *testing.T) {
+		cfg, err := testParseWithArgs(t, []string{"client", "-listen", "127.0.0.1:0", "tcp", "5432"})
+		require.NoError(t, err)
+		notes, err := cfg.ApplyCapabilities(partialServer(protocolv1.FeatureKeepalive))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"server does not relay the hops preface field; forwarding loops through it are only caught on this host"}, notes)
+		assert.False(t, cfg.RuntimeSettings().Capabilities.Has(protocolv1.FeatureHops))
+	})
+	t.Run("dp auto", func(t *testing.T) {
+		cfg, err := testParseWithArgs(t, []string{"client", "-dp", "auto", "8000"})
+		require.NoError(t, err)
+		notes, err := cfg.ApplyCapabilities(NewCapabilities(nil))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"server does not serve http tunnels over QUIC; --dp auto uses the WebSocket data plane"}, notes)
+		assert.Equal(t, DataPlaneWS, cfg.DataPlane)
+
+		cfg, err = testParseWithArgs(t, []string{"client", "-dp", "auto", "8000"})
+		require.NoError(t, err)
+		notes, err = cfg.ApplyCapabilities(partialServer(protocolv1.FeatureKeepalive, protocolv1.FeatureQUICServe))
+		require.NoError(t, err)
+		assert.Empty(t, notes)
+		assert.Equal(t, DataPlaneAuto, cfg.DataPlane)
+	})
+	t.Run("single connection", func(t *testing.T) {
+		cfg, err := testParseWithArgs(t, []string{"client", "-single-connection", "8000"})
+		require.NoError(t, err)
+		notes, err := cfg.ApplyCapabilities(NewCapabilities(nil))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"server has no control stream on the data plane; --single-connection falls back to a separate control WebSocket"}, notes)
+		assert.False(t, cfg.SingleConnection)
+
+		cfg, err = testParseWithArgs(t, []string{"client", "-single-connection", "8000"})
+		require.NoError(t, err)
+		notes, err = cfg.ApplyCapabilities(partialServer(protocolv1.FeatureKeepalive, protocolv1.FeatureControlStream))
+		require.NoError(t, err)
+		assert.Empty(t, notes)
+		assert.True(t, cfg.SingleConnection)
+	})
+}
@@ -0,0 +1,160 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Traffic classes every --classify run has besides its own: requests no
+// rule matched, and streams that do not carry HTTP.
+const (
+	TrafficClassOther  = "other"
+	TrafficClassOpaque = "opaque"
+)
+
+// Bounds of --classify. Go regexps run in linear time; the bounds keep the
+// per-request matching cheap.
+const (
+	maxTrafficClassRules   = 32
+	maxTrafficClassPattern = 256
+)
+
+var trafficClassName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// Matchers of a --classify rule besides a bare path pattern.
+const (
+	matchPath        = "path"
+	matchAccept      = "accept"
+	matchContentType = "content-type"
+	matchUpgrade     = "upgrade"
+)
+
+// TrafficClassifier sorts HTTP requests into the classes of --classify.
+type TrafficClassifier struct {
+	rules []trafficClassRule
+}
+
+// trafficClassRule matches the request part named by match against re; an
+// upgrade rule without a pattern matches any Upgrade header.
+type trafficClassRule struct {
+	class string
+	match string
+	re    *regexp.Regexp
+}
+
+// ParseTrafficClasses parses a --classify value: comma-separated
+// class=matcher rules, tried in order, the first match winning. A matcher is
+// a path regexp ("^/api/", or "path:^/api/"), "accept:<regexp>",
+// "content-type:<regexp>", or "upgrade" (any Upgrade header; "upgrade:<regexp>"
+// matches its value). Patterns cannot contain commas. Empty is nil: no
+// classification.
+func ParseTrafficClasses(value string) (*TrafficClassifier, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	var c TrafficClassifier
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		rule, err := parseTrafficClassRule(item)
+		if err != nil {
+			return nil, err
+		}
+		c.rules = append(c.rules, rule)
+	}
+	switch {
+	case len(c.rules) == 0:
+		return nil, nil
+	case len(c.rules) > maxTrafficClassRules:
+		return nil, fmt.Errorf("%d rules, at most %d are allowed", len(c.rules), maxTrafficClassRules)
+	}
+	return &c, nil
+}
+
+func parseTrafficClassRule(item string) (trafficClassRule, error) {
+	class, matcher, ok := strings.Cut(item, "=")
+	class, matcher = strings.TrimSpace(class), strings.TrimSpace(matcher)
+	if !ok || matcher == "" {
+		return trafficClassRule{}, fmt.Errorf("rule %q: expected class=matcher, e.g. api=^/api/", item)
+	}
+	if !trafficClassName.MatchString(class) {
+		return trafficClassRule{}, fmt.Errorf("rule %q: class names are lowercase letters, digits, - and _ (at most 32)", item)
+	}
+	if class == TrafficClassOther || class == TrafficClassOpaque {
+		return trafficClassRule{}, fmt.Errorf("rule %q: %q is a built-in class", item, class)
+	}
+	rule := trafficClassRule{class: class, match: matchPath}
+	pattern := matcher
+	if kind, rest, found := strings.Cut(matcher, ":"); found {
+		switch k := strings.ToLower(kind); k {
+		case matchPath, matchAccept, matchContentType, matchUpgrade:
+			rule.match, pattern = k, rest
+		}
+	} else if strings.EqualFold(matcher, matchUpgrade) {
+		return trafficClassRule{class: class, match: matchUpgrade}, nil
+	}
+	if len(pattern) > maxTrafficClassPattern {
+		return trafficClassRule{}, fmt.Errorf("rule %q: pattern longer than %d bytes", item, maxTrafficClassPattern)
+	}
+	if pattern == "" && rule.match != matchUpgrade {
+		return trafficClassRule{}, fmt.Errorf("rule %q: empty pattern", item)
+	}
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return trafficClassRule{}, fmt.Errorf("rule %q: %v", item, err)
+		}
+		rule.re = re
+	}
+	return rule, nil
+}
+
+// Classify returns the class of the first rule req matches, or
+// TrafficClassOther.
+func (c *TrafficClassifier) Classify(req *http.Request) string {
+	for _, r := range c.rules {
+		if r.matches(req) {
+			return r.class
+		}
+	}
+	return TrafficClassOther
+}
+
+// Classes returns the classes of the rules in their order, without
+// duplicates.
+func (c *TrafficClassifier) Classes() []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, r := range c.rules {
+		if !seen[r.class] {
+			seen[r.class] = true
+			out = append(out, r.class)
+		}
+	}
+	return out
+}
+
+func (r trafficClassRule) matches(req *http.Request) bool {
+	var subject string
+	switch r.match {
+	case matchPath:
+		subject = req.URL.Path
+	case matchAccept:
+		subject = req.Header.Get("Accept")
+	case matchContentType:
+		subject = req.Header.Get("Content-Type")
+	case matchUpgrade:
+		subject = req.Header.Get("Upgrade")
+		if subject == "" {
+			return false
+		}
+	}
+	return r.re == nil || r.re.MatchString(subject)
+}
@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func classifyRequest(t *testing.T, c *TrafficClassifier, path string, headers ...string) string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	return c.Classify(req)
+}
+
+func TestParseTrafficClasses_Matchers(t *testing.T) {
+	c, err := ParseTrafficClasses("ws=upgrade, api=^/api/, json=content-type:^application/json, html=accept:text/html, img=path:\\.(png|jpg)$")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ws", "api", "json", "html", "img"}, c.Classes())
+
+	assert.Equal(t, "ws", classifyRequest(t, c, "/chat", "Upgrade", "websocket"))
+	assert.Equal(t, "api", classifyRequest(t, c, "/api/users"))
+	assert.Equal(t, "json", classifyRequest(t, c, "/submit", "Content-Type", "application/json; charset=utf-8"))
+	assert.Equal(t, "html", classifyRequest(t, c, "/", "Accept", "text/html,application/xhtml+xml"))
+	assert.Equal(t, "img", classifyRequest(t, c, "/logo.png"))
+	assert.Equal(t, TrafficClassOther, classifyRequest(t, c, "/robots.txt", "Accept", "*/*"))
+}
+
+func TestParseTrafficClasses_FirstMatchWins(t *testing.T) {
+	c, err := ParseTrafficClasses("ws=upgrade,api=^/api/,html=accept:text/html,api=accept:json")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ws", "api", "html"}, c.Classes(), "a class of several rules is listed once")
+
+	assert.Equal(t, "ws", classifyRequest(t, c, "/api/socket", "Upgrade", "websocket"), "upgrade comes before the path")
+	assert.Equal(t, "api", classifyRequest(t, c, "/api/page", "Accept", "text/html"), "the path comes before accept")
+	assert.Equal(t, "html", classifyRequest(t, c, "/page", "Accept", "text/html, application/json"))
+	assert.Equal(t, "api", classifyRequest(t, c, "/data", "Accept", "application/json"), "the second api rule")
+}
+
+func TestParseTrafficClasses_UpgradeValue(t *testing.T) {
+	c, err := ParseTrafficClasses("ws=upgrade:(?i)^websocket$,h2c=upgrade:h2c")
+	require.NoError(t, err)
+	assert.Equal(t, "ws", classifyRequest(t, c, "/", "Upgrade", "WebSocket"))
+	assert.Equal(t, "h2c", classifyRequest(t, c, "/", "Upgrade", "h2c"))
+	assert.Equal(t, TrafficClassOther, classifyRequest(t, c, "/"), "no Upgrade header")
+}
+
+func TestParseTrafficClasses_ColonInPathPattern(t *testing.T) {
+	c, err := ParseTrafficClasses("odata=^/odata/items:count$")
+	require.NoError(t, err)
+	assert.Equal(t, "odata", classifyRequest(t, c, "/odata/items:count"))
+}
+
+func TestParseTrafficClasses_Empty(t *testing.T) {
+	for _, v := range []string{"", "  ", ",,"} {
+		c, err := ParseTrafficClasses(v)
+		require.NoError(t, err, "%q", v)
+		assert.Nil(t, c, "%q", v)
+	}
+}
+
+func TestParseTrafficClasses_Rejects(t *testing.T) {
+	tooMany := strings.TrimSuffix(strings.Repeat("a=^/a,", maxTrafficClassRules+1), ",")
+	tests := []struct {
+		value, want string
+	}{
+		{"api", "expected class=matcher"},
+		{"api=", "expected class=matcher"},
+		{"=^/api", "class names are"},
+		{"API=^/api", "class names are"},
+		{strings.Repeat("a", 33) + "=^/a", "class names are"},
+		{"other=^/x", `"other" is a built-in class`},
+		{"opaque=^/x", `"opaque" is a built-in class`},
+		{"api=accept:", "empty pattern"},
+		{"api=^/(api", "missing closing )"},
+		{"api=" + strings.Repeat("x", maxTrafficClassPattern+1), "pattern longer than 256 bytes"},
+		{tooMany, "33 rules, at most 32"},
+	}
+	for _, tt := range tests {
+		_, err := ParseTrafficClasses(tt.value)
+		require.Error(t, err, tt.value)
+		assert.Contains(t, err.Error(), tt.want, tt.value)
+	}
+}
+
+func TestParseTrafficClasses_PatternAtSizeLimit(t *testing.T) {
+	_, err := ParseTrafficClasses("api=" + strings.Repeat("x", maxTrafficClassPattern))
+	require.NoError(t, err)
+	_, err = ParseTrafficClasses(strings.TrimSuffix(strings.Repeat("a=^/a,", maxTrafficClassRules), ","))
+	require.NoError(t, err)
+}
+
+func TestValidateClassify(t *testing.T) {
+	cfg := &Config{Protocol: protoHTTP, Classify: "api=^/api/"}
+	require.NoError(t, validateClassify(cfg))
+	require.NotNil(t, cfg.RuntimeSettings().TrafficClasses)
+
+	cfg.Classify = "api=^/(api"
+	require.ErrorContains(t, validateClassify(cfg), "invalid --classify")
+
+	cfg = &Config{Protocol: "tcp", Classify: "api=^/api/"}
+	require.ErrorContains(t, validateClassify(cfg), "--classify requires an http or https tunnel")
+}
@@ -17,6 +17,8 @@ import (
 const (
 	fileConfigVersion     = 3
 	fileConfigName        = "fortunnels.yml"
+	tlsChainDirName       = "tls-chains"
+	requestQueueDirName   = "queue"
 	envConfigPath         = "FORTUNNELS_CONFIG"
 	errMsgConfigVersion   = "config version must be 3"
 	errMsgConfigAuthtoken = "agent.authtoken is required"
@@ -28,6 +30,57 @@ type FileConfig struct {
 	Agent   struct {
 		Authtoken string `yaml:"authtoken"`
 	} `yaml:"agent"`
+	Tunnel TunnelFileConfig `yaml:"tunnel,omitempty"`
+}
+
+// TunnelFileConfig is the optional tunnel section read with --config. Server,
+// protocol and local describe the tunnel and only apply at startup; the other
+// keys are re-applied on reload (SIGHUP or --reload-file). Empty keys are
+// left alone.
+type TunnelFileConfig struct {
+	ServerURL string `yaml:"server_url,omitempty"`
+	Protocol  string `yaml:"protocol,omitempty"`
+	Local     string `yaml:"local,omitempty"`
+
+	LogLevel         string `yaml:"log_level,omitempty"`
+	RateLimit        string `yaml:"rate_limit,omitempty"`
+	AllowIncomingDst string `yaml:"allow_incoming_dst,omitempty"`
+	InspectDecode    *bool  `yaml:"inspect_decode,omitempty"`
+	InspectBodyBytes *int   `yaml:"inspect_body_bytes,omitempty"`
+}
+
+// ImmutableChanges lists the startup-only keys whose value differs in next.
+func (t TunnelFileConfig) ImmutableChanges(next TunnelFileConfig) []string {
+	var changed []string
+	for _, k := range []struct{ key, old, new string }{
+		{"server_url", t.ServerURL, next.ServerURL},
+		{"protocol", t.Protocol, next.Protocol},
+		{"local", t.Local, next.Local},
+	} {
+		if strings.TrimSpace(k.old) != strings.TrimSpace(k.new) {
+			changed = append(changed, k.key)
+		}
+	}
+	return changed
+}
+
+// ValidateTunnelFileConfig checks the reloadable keys of a tunnel section.
+func ValidateTunnelFileConfig(t TunnelFileConfig) error {
+	switch strings.ToLower(strings.TrimSpace(t.LogLevel)) {
+	case "", "info", "debug":
+	default:
+		return fmt.Errorf("tunnel.log_level %q: use info or debug", t.LogLevel)
+	}
+	if _, err := ParseByteRate(t.RateLimit); err != nil {
+		return fmt.Errorf("tunnel.rate_limit: %w", err)
+	}
+	if err := validateAllowIncomingDst(t.AllowIncomingDst); err != nil {
+		return fmt.Errorf("tunnel.allow_incoming_dst: %w", err)
+	}
+	if t.InspectBodyBytes != nil && *t.InspectBodyBytes < 0 {
+		return fmt.Errorf("tunnel.inspect_body_bytes %d: must be 0 or positive", *t.InspectBodyBytes)
+	}
+	return nil
 }
 
 // DefaultConfigPath returns the platform default config file path.
@@ -43,6 +96,26 @@ func DefaultConfigPath() (string, error) {
 	return filepath.Join(base, "fortunnels", fileConfigName), nil
 }
 
+// TLSChainCacheDir is where --tls-chain-cache keeps server certificate
+// chains: tls-chains next to the default config file.
+func TLSChainCacheDir() (string, error) {
+	cfgPath, err := DefaultConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(cfgPath), tlsChainDirName), nil
+}
+
+// RequestQueueDir is where --queue-requests keeps its queue without
+// --queue-dir: queue next to the default config file.
+func RequestQueueDir() (string, error) {
+	cfgPath, err := DefaultConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(cfgPath), requestQueueDirName), nil
+}
+
 func userConfigBaseDir() (string, error) {
 	if runtime.GOOS == "windows" {
 		local := strings.TrimSpace(os.Getenv("LOCALAPPDATA"))
@@ -100,6 +173,7 @@ func SaveAuthtoken(path, token string) error {
 			if fc.Version == 0 {
 				fc.Version = fileConfigVersion
 			}
+			fc.Tunnel = existing.Tunnel
 		}
 	}
 	out, err := yaml.Marshal(fc)
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v3"
@@ -72,3 +73,73 @@ func TestSaveAuthtokenMergeKeepsVersion(t *testing.T) {
 	require.Equal(t, "ft_newtoken", fc.Agent.Authtoken)
 	require.Equal(t, 3, fc.Version)
 }
+
+func TestSaveAuthtokenKeepsTunnelSection(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fortunnels.yml")
+	require.NoError(t, os.WriteFile(path, []byte("version: 3\ntunnel:\n  rate_limit: 1MiB\n"), 0o600))
+	require.NoError(t, SaveAuthtoken(path, "ft_testtoken1234567890"))
+	fc, err := LoadFileConfig(path)
+	require.NoError(t, err)
+	require.Equal(t, "1MiB", fc.Tunnel.RateLimit)
+}
+
+func TestTunnelFileConfig_ValidateAndImmutableChanges(t *testing.T) {
+	neg := -1
+	require.NoError(t, ValidateTunnelFileConfig(TunnelFileConfig{LogLevel: "DEBUG", RateLimit: "10MB/s", AllowIncomingDst: "127.0.0.1:9000"}))
+	require.ErrorContains(t, ValidateTunnelFileConfig(TunnelFileConfig{LogLevel: "trace"}), "tunnel.log_level")
+	require.ErrorContains(t, ValidateTunnelFileConfig(TunnelFileConfig{RateLimit: "fast"}), "tunnel.rate_limit")
+	require.ErrorContains(t, ValidateTunnelFileConfig(TunnelFileConfig{AllowIncomingDst: "nope"}), "tunnel.allow_incoming_dst")
+	require.ErrorContains(t, ValidateTunnelFileConfig(TunnelFileConfig{InspectBodyBytes: &neg}), "tunnel.inspect_body_bytes")
+
+	old := TunnelFileConfig{ServerURL: "https://fortunnels.ru", Local: "127.0.0.1:3000", RateLimit: "1MiB"}
+	require.Empty(t, old.ImmutableChanges(TunnelFileConfig{ServerURL: "https://fortunnels.ru", Local: "127.0.0.1:3000", RateLimit: "2MiB"}))
+	require.Equal(t, []string{"server_url", "protocol"}, old.ImmutableChanges(TunnelFileConfig{ServerURL: "https://x.example", Protocol: "tcp", Local: "127.0.0.1:3000"}))
+}
+
+func TestParseRequestRate(t *testing.T) {
+	for in, want := range map[string]struct {
+		limit  int
+		window time.Duration
+	}{
+		"":          {0, 0},
+		"off":       {0, 0},
+		"60":        {60, time.Minute},
+		"60/minute": {60, time.Minute},
+		" 5/S ":     {5, time.Second},
+		"100/min":   {100, time.Minute},
+		"1000/hour": {1000, time.Hour},
+		"30 / m":    {30, time.Minute},
+	} {
+		limit, window, err := ParseRequestRate(in)
+		require.NoError(t, err, in)
+		require.Equal(t, want.limit, limit, in)
+		require.Equal(t, want.window, window, in)
+	}
+	for _, bad := range []string{"fast", "-1/minute", "1.5/minute", "10/day", "/minute"} {
+		_, _, err := ParseRequestRate(bad)
+		require.Error(t, err, bad)
+	}
+}
+
+func TestParseByteRate(t *testing.T) {
+	for in, want := range map[string]int64{
+		"":       0,
+		"0":      0,
+		"1000":   1000,
+		"512KiB": 512 << 10,
+		"10MB":   10e6,
+		"1.5M":   3 << 19,
+		"2mib/s": 2 << 20,
+		" 64k ":  64 << 10,
+		"1GiB":   1 << 30,
+		"100b":   100,
+	} {
+		got, err := ParseByteRate(in)
+		require.NoError(t, err, in)
+		require.Equal(t, want, got, in)
+	}
+	for _, bad := range []string{"fast", "-1", "10 parsecs", "MiB"} {
+		_, err := ParseByteRate(bad)
+		require.Error(t, err, bad)
+	}
+}
@@ -6,12 +6,16 @@ package config
 import (
 	"flag"
 	"fmt"
+	"net"
+	"net/netip"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/fortunnels/client/internal/security"
 	"github.com/fortunnels/client/internal/support"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
 )
 
 const (
@@ -22,6 +26,76 @@ const (
 
 	defaultQUICPort = 8443
 	defaultDTLSPort = 443
+
+	defaultUDPQueueSize = 1024
+	// defaultControlRetries is the --control-retries default.
+	defaultControlRetries = 2
+	// defaultHTTPPeekBytes is the --http-peek-bytes default; minHTTPPeekBytes
+	// is one copy buffer, the largest chunk the forwarding path hands to
+	// HTTP-aware processing at once.
+	defaultHTTPPeekBytes = 64 << 10
+	minHTTPPeekBytes     = 32 << 10
+	// defaultQueueMaxBody, defaultQueueMaxEntries and defaultQueueMethods
+	// are the --queue-max-body, --queue-max-entries and --queue-methods
+	// defaults: webhook deliveries.
+	defaultQueueMaxBody    = "1MiB"
+	defaultQueueMaxEntries = 1000
+	defaultQueueMethods    = "POST,PUT"
+	// defaultMemoryBudget is the --memory-budget default.
+	defaultMemoryBudget = "128MiB"
+
+	// defaultPingLossThreshold is the --ping-loss-threshold default: two
+	// missed pongs in a row at the default interval beat the 90s read deadline.
+	defaultPingLossThreshold = 2
+
+	// defaultDstCommandMaxProcs is the --dst-command-max-procs default.
+	defaultDstCommandMaxProcs = 8
+
+	// pingIntervalAuto selects adaptive data-plane pings, starting at adaptivePingStart.
+	pingIntervalAuto  = "auto"
+	adaptivePingStart = 30 * time.Second
+
+	outputText = "text"
+	outputJSON = "json"
+
+	// Formats of the --export-env file.
+	exportDotenv = "dotenv"
+	exportJSON   = "json"
+
+	localBalanceFailover   = "failover"
+	localBalanceRoundRobin = "roundrobin"
+
+	// DataPlaneWS and the other --dp values. DataPlaneAuto serves http/https
+	// tunnels over QUIC when the server supports it, and over WS otherwise.
+	DataPlaneWS   = "ws"
+	DataPlaneQUIC = "quic"
+	DataPlaneDTLS = "dtls"
+	DataPlaneAuto = "auto"
+
+	// HostRewriteTarget is the --host-rewrite value taking the host of
+	// --local.
+	HostRewriteTarget = "target"
+
+	// FallbackPageBuiltin is the --fallback-page value taking the built-in
+	// page instead of a file.
+	FallbackPageBuiltin = "builtin"
+
+	// --backend-timeout-action values.
+	backendTimeoutLog   = "log"
+	backendTimeoutClose = "close"
+	backendTimeout503   = "503"
+
+	// ListenPriorityAuto and the other --listen-priority values: auto
+	// classifies each stream by its send rate, interactive and bulk fix the
+	// class of every stream of the listener.
+	ListenPriorityAuto        = "auto"
+	ListenPriorityInteractive = "interactive"
+	ListenPriorityBulk        = "bulk"
+
+	// smuxMinReceiveBuffer is smux's per-stream window, which the session
+	// buffer must hold; smuxMaxReceiveBuffer keeps it well inside an int32.
+	smuxMinReceiveBuffer = 64 << 10
+	smuxMaxReceiveBuffer = 1 << 30
 )
 
 var defaultServerURL = "https://fortunnels.ru"
@@ -35,26 +109,36 @@ func SetDefaultServerURL(value string) {
 
 // Config aggregates all CLI options after parsing.
 type Config struct {
-	Login                 string
-	Password              string
-	Token                 string
-	ServerURL             string
-	TargetAddr            string
-	Protocol              string
-	DataPlane             string
-	UserID                string
-	BackoffInitial        time.Duration
-	BackoffMax            time.Duration
-	UDPListen             string
-	UDPDst                string
-	PingInterval          time.Duration
-	PingTimeout           time.Duration
-	SmuxInterval          time.Duration
-	SmuxTimeout           time.Duration
+	Login          string
+	Password       string
+	Token          string
+	ServerURL      string
+	TargetAddr     string
+	Protocol       string
+	DataPlane      string
+	UserID         string
+	BackoffInitial time.Duration
+	BackoffMax     time.Duration
+	UDPListen      string
+	UDPDst         string
+	PingInterval   time.Duration
+	AdaptivePing   bool
+	PingTimeout    time.Duration
+	// PingLossThreshold closes a data-plane connection once this many pings
+	// in a row got no pong; 0 leaves dead connections to the read deadline.
+	PingLossThreshold int
+	SmuxInterval      time.Duration
+	SmuxTimeout       time.Duration
+	// SmuxMaxReceiveBuffer is the smux session receive buffer in bytes with
+	// an optional unit (--smux-max-receive-buffer 16MiB); empty keeps smux's.
+	SmuxMaxReceiveBuffer  string
 	WatchInterval         time.Duration
+	TunnelKeepalive       time.Duration
 	WatchWS               bool
 	Encrypt               bool
+	Strict                bool
 	PSK                   string
+	PSKKDF                string
 	DPAuthToken           string
 	DPAuthSecret          string
 	TokenFile             string
@@ -70,8 +154,208 @@ type Config struct {
 	AllowInsecureHTTP     bool
 	QUICPort              int
 	DTLSPort              int
+	MakeBeforeBreak       bool
+	DegradedRTT           time.Duration
+	DrainTimeout          time.Duration
+	OTelEndpoint          string
+	UDPQueueSize          int
+	Announce              bool
+	ListenAddr            string
+	Dst                   string
+	DstCommand            string
+	DstCommandTimeout     time.Duration
+	// DstCommandMaxProcs caps the --dst-command processes running at once;
+	// connections beyond it wait for one to exit, up to the timeout.
+	DstCommandMaxProcs int
+	// DstCommandEnv names variables passed through to --dst-command on top
+	// of PATH, HOME, locale and the FORTUNNELS_* ones (comma-separated).
+	DstCommandEnv string
+	// SNIRoute routes listen-mode connections by the server name of their
+	// TLS ClientHello: comma-separated name=host:port pairs. Others go to
+	// SNIDefault, or --dst without it.
+	SNIRoute         string
+	SNIDefault       string
+	AllowIncomingDst string
+	BackendProxy     string
+	ProxyCommand     bool
+	// Redundant runs the --proxy-command stream on the WebSocket and QUIC
+	// data planes at once (experimental).
+	Redundant bool
+	// TransportProbeInterval is how often --dp auto probes both data planes
+	// to switch away from a degraded one; 0 keeps the first that worked.
+	TransportProbeInterval time.Duration
+	// StreamLatencyWarn logs a warning for each StreamLatencyWindow in
+	// which the p95 of opening client streams, or of their first byte,
+	// exceeds it; 0 disables the warning.
+	StreamLatencyWarn   time.Duration
+	StreamLatencyWindow time.Duration
+	Force               bool
+	// NoPositional rejects positional arguments (client tcp 5433), so
+	// scripts must spell out --protocol and --local; also set by
+	// FORTUNNELS_NO_POSITIONAL.
+	NoPositional bool
+	// NoIPPinning turns off pinning data-plane dials to the control plane's
+	// server IP (RuntimeSettings.PinnedIP).
+	NoIPPinning bool
+	// TLSChainCache records the server's certificate chains under
+	// TLSChainCacheDir and explains TLS verification failures against them.
+	TLSChainCache bool
+	// TunnelID serves an existing, operator-managed tunnel instead of
+	// creating one; the client never deletes it.
+	TunnelID string
+	// CreateRetries is how many times tunnel creation is retried while the
+	// server answers rate_limited, each after its Retry-After delay.
+	CreateRetries int
+	// ControlTimeout bounds a control-plane call including its retries,
+	// ControlAttemptTimeout each attempt; ControlRetries is how many times
+	// idempotent calls are retried (control.NewHTTPClient).
+	ControlTimeout        time.Duration
+	ControlAttemptTimeout time.Duration
+	ControlRetries        int
+	// Capabilities are the server's protocol features, recorded by
+	// ApplyCapabilities; the zero value is the baseline.
+	Capabilities Capabilities
+	// LocalTargets lists every --local backend when several are given
+	// (comma-separated); TargetAddr is then the first, the one registered
+	// with the server.
+	LocalTargets []string
+	LocalBalance string
+	// Output selects the format of the final status line (text or json).
+	Output string
+	// UTC prints times and log timestamps in UTC instead of the local zone.
+	UTC bool
+	// StatusLine renders live throughput on stderr in serving modes.
+	StatusLine bool
+	// RaiseNoFile raises the soft open file limit to the hard one before
+	// serving; either way serving modes watch descriptor usage against it.
+	RaiseNoFile bool
+	// WaitDNS polls a host-based public URL's hostname after creation and
+	// prints "ready to use" only once it resolves (--wait-dns, on by default).
+	WaitDNS        bool
+	WaitDNSTimeout time.Duration
+	// ReadyTimeout bounds how long a tunnel serving incoming streams waits
+	// for its data plane to connect before it prints the public URL anyway,
+	// with a warning (--ready-timeout); 0 prints it right away.
+	ReadyTimeout time.Duration
+	// DNSServer sends those lookups to a specific resolver (host[:port]).
+	DNSServer string
+	// InspectDecode and InspectBodyBytes log each HTTP response served
+	// through the tunnel (see RuntimeSettings).
+	InspectDecode    bool
+	InspectBodyBytes int
+	// HTTPPeekBytes bounds what HTTP-aware processing may buffer per stream
+	// (see RuntimeSettings).
+	HTTPPeekBytes int
+	// RateLimit caps each direction's serving throughput, in bytes per second
+	// with an optional unit (--rate-limit 10MiB); empty is unlimited.
+	RateLimit string
+	// MaxBytesPerStream and MaxBytesTotal are hard caps on the bytes one
+	// stream and the whole tunnel may move, both directions together, with
+	// an optional unit (--max-bytes-total 200MB); empty is unlimited.
+	MaxBytesPerStream string
+	MaxBytesTotal     string
+	// MemoryBudget caps the memory the buffering features hold together
+	// (--memory-budget 128MiB); empty or 0 only accounts it.
+	MemoryBudget string
+	// RateLimitSource caps the HTTP requests each remote source may send
+	// (--rate-limit-source 60/minute); empty is unlimited. RateLimitExempt
+	// lists the CIDRs it does not apply to.
+	RateLimitSource string
+	RateLimitExempt string
+	// Classify sorts the HTTP requests of the tunnel into traffic classes
+	// counted apart (--classify "api=^/api/,ws=upgrade"); empty disables it.
+	Classify string
+	// HostRewrite replaces the Host header of every request before it
+	// reaches the backend (--host-rewrite myapp.local); HostRewriteTarget
+	// takes the host of --local. HostRewriteForwarded keeps the original in
+	// X-Forwarded-Host.
+	HostRewrite          string
+	HostRewriteForwarded bool
+	// MaxStreams caps the streams open at once across the tunnel's listeners
+	// (0 is unlimited); PerListenerRate caps how many new streams each
+	// listener may start per second (0 is unlimited).
+	MaxStreams      int
+	PerListenerRate float64
+	// ListenPriority is the --listen-priority hint of the --listen streams.
+	ListenPriority string
+	// SendPeerInfo names each --listen connection's local peer and listener
+	// address in its stream preface, for server-side logs.
+	SendPeerInfo bool
+	// SingleConnection carries the tunnel's control messages on a stream of
+	// the data-plane WebSocket instead of a second, control WebSocket, on
+	// servers with the control_stream feature.
+	SingleConnection bool
+	// RawPath and RawDst carry raw TCP over an http/https tunnel: WebSocket
+	// upgrades to RawPath are completed by the client and bridged to RawDst
+	// instead of reaching the HTTP backend (see the wrap command).
+	RawPath string
+	RawDst  string
+	// StatsFile keeps cumulative traffic per tunnel target across restarts,
+	// checkpointed every StatsFlush and on shutdown (see internal/stats).
+	StatsFile  string
+	StatsFlush time.Duration
+	// NoRegistry keeps the client out of the local registry `client ps`
+	// lists (see internal/registry).
+	NoRegistry bool
+	// CrashDir receives a crash report for every panic the client recovers
+	// from (see support.SetCrashDir); empty logs the stack instead.
+	CrashDir string
+	// ConfigPath is the --config file whose tunnel section (FileTunnel, as
+	// loaded at startup) fills in unset flags and is re-read on reload.
+	ConfigPath string
+	FileTunnel TunnelFileConfig
+	// ReloadFile triggers a reload whenever its modification time changes,
+	// for platforms without SIGHUP.
+	ReloadFile string
+	// LogLevel is the config file's log_level; empty keeps LOG_LEVEL.
+	LogLevel string
+	// Profile names the stored profile (client profile import) whose flags
+	// are the base configuration; command-line flags override them.
+	Profile string
+	// BackendFirstByteTimeout reports backends that send nothing for this
+	// long after the dial (0 disables); BackendTimeoutAction is log, close
+	// or 503.
+	BackendFirstByteTimeout time.Duration
+	BackendTimeoutAction    string
+	// BackendPoolSize keeps up to this many idle keep-alive connections per
+	// backend for reuse by later streams of http/https tunnels (0 disables);
+	// BackendPoolIdle closes them after this long unused.
+	BackendPoolSize int
+	BackendPoolIdle time.Duration
+	// ResumeGET keeps the interrupted responses of GET requests so that the
+	// server can resume them on a new session (http/https tunnels).
+	ResumeGET bool
+	// FallbackPage is the HTML template answered with a 503 when the
+	// backend cannot be dialed, or FallbackPageBuiltin (http/https tunnels).
+	FallbackPage string
+	// LocalMirror is a local address that serves the tunnel's target as
+	// well, for clients on the LAN (http/https tunnels).
+	LocalMirror string
+	// Open opens the public URL in the default browser once the data plane
+	// serving it is connected (http/https tunnels).
+	Open bool
+	// ExportEnv is a file kept holding the tunnel's public URL, ID, protocol
+	// and expiry in ExportFormat (dotenv or json) while the tunnel is
+	// served, for tooling that watches it; it is removed on shutdown.
+	ExportEnv    string
+	ExportFormat string
+	// QueueRequests answers requests that arrive while the backend cannot
+	// be dialed with a 202 and replays them once it is back (http/https
+	// tunnels). Only QueueMethods requests with bodies up to QueueMaxBody
+	// are queued, at most QueueMaxEntries of them, in QueueDir (default:
+	// RequestQueueDir).
+	QueueRequests   bool
+	QueueDir        string
+	QueueMaxBody    string
+	QueueMaxEntries int
+	QueueMethods    string
+
+	// sources records where Parse took a setting from when it was not a
+	// flag on the command line (see Settings).
+	sources map[string]string
+	// reporter takes the warnings of Parse and Validate (see Reporter).
+	reporter support.Reporter
 
-	ServerFlagProvided       bool
 	TokenFlagProvided        bool
 	PasswordFlagProvided     bool
 	PSKFlagProvided          bool
@@ -79,15 +363,163 @@ type Config struct {
 	DPAuthSecretFlagProvided bool
 }
 
+// SetReporter sends the user output of the run, including the warnings of a
+// later Validate, to r.
+func (c *Config) SetReporter(r support.Reporter) {
+	c.reporter = r
+}
+
+// Reporter is where the run's user output goes; support.StdReporter unless
+// SetReporter chose another.
+func (c *Config) Reporter() support.Reporter {
+	return support.ReporterOr(c.reporter)
+}
+
 // RuntimeSettings bundles frequently used timing knobs.
 type RuntimeSettings struct {
-	PingInterval          time.Duration
-	PingTimeout           time.Duration
+	PingInterval time.Duration
+	// AdaptivePing tunes the data-plane ping interval from pong RTT and loss,
+	// starting at PingInterval (--ping-interval auto).
+	AdaptivePing bool
+	PingTimeout  time.Duration
+	// PingLossThreshold is how many pongs in a row a data-plane connection
+	// may miss before it is closed and redialed; 0 disables the check.
+	PingLossThreshold     int
 	SmuxKeepAliveInterval time.Duration
 	SmuxKeepAliveTimeout  time.Duration
-	WatchInterval         time.Duration
-	QUICPort              int
-	DTLSPort              int
+	// SmuxMaxReceiveBuffer overrides smux's session receive buffer; 0 keeps
+	// the default.
+	SmuxMaxReceiveBuffer int
+	WatchInterval        time.Duration
+	// TunnelKeepalive is the control-plane keepalive interval; 0 disables it.
+	TunnelKeepalive time.Duration
+	QUICPort        int
+	DTLSPort        int
+	// MakeBeforeBreak dials a standby data-plane session when the active one degrades.
+	MakeBeforeBreak bool
+	DegradedRTT     time.Duration
+	DrainTimeout    time.Duration
+	// TransportProbeInterval is how often --dp auto probes the QUIC and
+	// WebSocket data planes, switching when the active one degrades while
+	// the other is healthy; 0 disables switching.
+	TransportProbeInterval time.Duration
+	// StreamLatencyWarn and StreamLatencyWindow are the stream latency
+	// alarm (--stream-latency-warn).
+	StreamLatencyWarn   time.Duration
+	StreamLatencyWindow time.Duration
+	// HTTPAware marks data-plane streams as HTTP/1.x (http/https tunnels).
+	HTTPAware bool
+	// UDPQueueSize bounds in-flight UDP packets per direction (drop-oldest when full).
+	UDPQueueSize int
+	// DstCommand picks the server-side dst per listen-mode connection.
+	DstCommand        string
+	DstCommandTimeout time.Duration
+	// DstCommandMaxProcs and DstCommandEnv bound the --dst-command children.
+	DstCommandMaxProcs int
+	DstCommandEnv      []string
+	// SNIRoutes maps TLS server names (lowercase) to the server-side dst of
+	// listen-mode connections; SNIDefault replaces the dst of the others.
+	SNIRoutes  map[string]string
+	SNIDefault string
+	// InstanceID identifies this client process to the server (random per run).
+	InstanceID string
+	// Capabilities are the server's protocol features (Config.Capabilities).
+	Capabilities Capabilities
+	// PinnedIP is the server IP the control plane connected to; data-plane
+	// dials go there instead of resolving the hostname again. Empty (or
+	// --no-ip-pinning) resolves every dial.
+	PinnedIP string
+	// IncomingDstAllow lists the only dst values server-initiated streams may
+	// dial: the tunnel target plus --allow-incoming-dst. Empty allows any.
+	IncomingDstAllow []string
+	// IncomingHMACSecret, when set, requires server-initiated stream prefaces
+	// to carry a valid HMAC over tunnel_id||dst (--dp-auth-secret).
+	IncomingHMACSecret string
+	// LocalTargets are the backends incoming streams for the tunnel target
+	// fail over between, in --local order; fewer than two disables failover.
+	LocalTargets []string
+	// LocalRoundRobin spreads streams across LocalTargets (--local-balance
+	// roundrobin) instead of always preferring the first healthy one.
+	LocalRoundRobin bool
+	// BackendProxy routes backend dials through an HTTP CONNECT or SOCKS5
+	// proxy (--backend-proxy); empty dials directly.
+	BackendProxy string
+	// InspectDecode logs every HTTP response of http/https tunnels with its
+	// wire and decoded (gzip/deflate) body size; forwarded bytes are untouched.
+	InspectDecode bool
+	// InspectBodyBytes logs up to this many bytes of text-ish response bodies
+	// (decoded when InspectDecode is set); 0 disables the preview.
+	InspectBodyBytes int
+	// HTTPPeekBytes is the memory budget of HTTP-aware processing per
+	// stream: request and response heads are peeked within it and bodies
+	// are only streamed. A feature that would need more disables itself for
+	// that stream.
+	HTTPPeekBytes int
+	// BackendFirstByteTimeout logs a slow-backend event when a dialed backend
+	// sends no byte for this long; 0 disables the check.
+	BackendFirstByteTimeout time.Duration
+	// BackendTimeoutClose drops such streams; BackendTimeout503 answers
+	// them with an HTTP 503 instead (http/https tunnels).
+	BackendTimeoutClose bool
+	BackendTimeout503   bool
+	// BackendPoolSize is the number of idle backend connections kept per
+	// backend address for reuse by HTTPAware streams; 0 dials one per
+	// stream. BackendPoolIdle closes idle ones after this long.
+	BackendPoolSize int
+	BackendPoolIdle time.Duration
+	// ResumeGET keeps the responses of body-less GET requests whose stream
+	// failed for the server to resume with a ranged request to the backend.
+	ResumeGET bool
+	// FallbackPage answers HTTPAware streams whose backend cannot be dialed
+	// with a 503 carrying this page (see Config); empty disables it.
+	FallbackPage string
+	// QueueRequests queues the requests of HTTPAware streams whose backend
+	// cannot be dialed in QueueDir and replays them in order once it
+	// answers; QueueMaxBody, QueueMaxEntries and QueueMethods bound what is
+	// queued (see Config).
+	QueueRequests   bool
+	QueueDir        string
+	QueueMaxBody    int64
+	QueueMaxEntries int
+	QueueMethods    []string
+	// MaxStreams and PerListenerRate bound the streams of a Manager's
+	// listeners, shared between them by weight (see Config).
+	MaxStreams      int
+	PerListenerRate float64
+	// ListenPriority classifies listen-mode streams for pacing bulk ones
+	// while interactive ones are open (auto, interactive or bulk).
+	ListenPriority string
+	// SendPeerInfo adds the src and listen preface fields to listen-mode
+	// streams (see Config).
+	SendPeerInfo bool
+	// RawPath and RawDst bridge WebSocket upgrades to RawPath on HTTP-aware
+	// streams to RawDst (see Config); empty RawPath disables it.
+	RawPath string
+	RawDst  string
+	// SourceRateLimit answers HTTP requests beyond this many per
+	// SourceRateWindow from one source (X-Forwarded-For) with a 429 instead
+	// of forwarding them; 0 disables it. SourceRateExempt is never limited.
+	SourceRateLimit  int
+	SourceRateWindow time.Duration
+	SourceRateExempt []netip.Prefix
+	// TrafficClasses sorts HTTP requests into the classes of --classify;
+	// nil disables the per-class counters.
+	TrafficClasses *TrafficClassifier
+	// HostRewrite is the Host header HTTP requests are forwarded with, with
+	// "target" resolved (see Config); empty leaves it alone.
+	// HostRewriteForwarded adds X-Forwarded-Host with the original.
+	HostRewrite          string
+	HostRewriteForwarded bool
+	// MaxBytesPerStream and MaxBytesTotal cap the bytes a stream and the
+	// tunnel may move, both directions together; 0 is unlimited.
+	MaxBytesPerStream int64
+	MaxBytesTotal     int64
+	// MemoryBudget caps the bytes the buffering features of the data plane
+	// hold together; 0 is unlimited.
+	MemoryBudget int64
+	// Redundant sends the proxy-command stream over the WebSocket and QUIC
+	// data planes at once (--redundant).
+	Redundant bool
 }
 
 // QUICPortString returns the QUIC server port as a dial string.
@@ -110,24 +542,238 @@ func (r RuntimeSettings) DTLSPortString() string {
 type EncryptionSettings struct {
 	Enabled bool
 	PSK     string
+	KDF     security.KDF
+	// OmitKDFPreface leaves the psk_kdf field out of stream prefaces for
+	// servers without that feature; KDF is then legacy.
+	OmitKDFPreface bool
+	// Nonces, when set, gives each encrypted stream its own nonce source;
+	// nil uses the frame counter. Only wire transcripts set it.
+	Nonces func() security.NonceSource
+	// Keys wraps the tunnel's streams. It is shared by every copy of the
+	// settings so the key is derived once, not per stream; nil builds one
+	// per stream.
+	Keys *security.ClientPSK
 }
 
 // RuntimeSettings extracts timing configuration.
 func (c *Config) RuntimeSettings() RuntimeSettings {
-	return RuntimeSettings{
-		PingInterval:          c.PingInterval,
-		PingTimeout:           c.PingTimeout,
-		SmuxKeepAliveInterval: c.SmuxInterval,
-		SmuxKeepAliveTimeout:  c.SmuxTimeout,
-		WatchInterval:         c.WatchInterval,
-		QUICPort:              c.QUICPort,
-		DTLSPort:              c.DTLSPort,
+	rs := RuntimeSettings{
+		PingInterval:            c.PingInterval,
+		AdaptivePing:            c.AdaptivePing,
+		PingTimeout:             c.PingTimeout,
+		PingLossThreshold:       c.PingLossThreshold,
+		SmuxKeepAliveInterval:   c.SmuxInterval,
+		SmuxKeepAliveTimeout:    c.SmuxTimeout,
+		SmuxMaxReceiveBuffer:    c.smuxMaxReceiveBuffer(),
+		WatchInterval:           c.WatchInterval,
+		TunnelKeepalive:         c.TunnelKeepalive,
+		Capabilities:            c.Capabilities,
+		QUICPort:                c.QUICPort,
+		DTLSPort:                c.DTLSPort,
+		MakeBeforeBreak:         c.MakeBeforeBreak,
+		DegradedRTT:             c.DegradedRTT,
+		DrainTimeout:            c.DrainTimeout,
+		TransportProbeInterval:  c.TransportProbeInterval,
+		StreamLatencyWarn:       c.StreamLatencyWarn,
+		StreamLatencyWindow:     c.StreamLatencyWindow,
+		HTTPAware:               c.Protocol == protoHTTP || c.Protocol == protoHTTPS,
+		UDPQueueSize:            c.UDPQueueSize,
+		DstCommand:              c.DstCommand,
+		DstCommandTimeout:       c.DstCommandTimeout,
+		DstCommandMaxProcs:      c.DstCommandMaxProcs,
+		DstCommandEnv:           c.DstCommandEnvList(),
+		SNIRoutes:               c.SNIRoutes(),
+		SNIDefault:              strings.TrimSpace(c.SNIDefault),
+		IncomingDstAllow:        c.IncomingDstAllowList(),
+		IncomingHMACSecret:      strings.TrimSpace(c.DPAuthSecret),
+		BackendProxy:            strings.TrimSpace(c.BackendProxy),
+		LocalTargets:            c.LocalTargets,
+		LocalRoundRobin:         strings.EqualFold(strings.TrimSpace(c.LocalBalance), localBalanceRoundRobin),
+		InspectDecode:           c.InspectDecode,
+		InspectBodyBytes:        c.InspectBodyBytes,
+		HTTPPeekBytes:           c.HTTPPeekBytes,
+		BackendFirstByteTimeout: c.BackendFirstByteTimeout,
+		BackendTimeoutClose:     strings.EqualFold(strings.TrimSpace(c.BackendTimeoutAction), backendTimeoutClose),
+		BackendTimeout503:       strings.TrimSpace(c.BackendTimeoutAction) == backendTimeout503,
+		BackendPoolSize:         c.BackendPoolSize,
+		BackendPoolIdle:         c.BackendPoolIdle,
+		ResumeGET:               c.ResumeGET,
+		FallbackPage:            strings.TrimSpace(c.FallbackPage),
+		MaxStreams:              c.MaxStreams,
+		PerListenerRate:         c.PerListenerRate,
+		ListenPriority:          c.ListenPriority,
+		SendPeerInfo:            c.SendPeerInfo,
+		RawPath:                 c.RawPath,
+		RawDst:                  c.RawDst,
+		Redundant:               c.Redundant,
 	}
+	// Validate rejects malformed values before this is called.
+	rs.MaxBytesPerStream, _ = ParseByteSize(c.MaxBytesPerStream)
+	rs.MaxBytesTotal, _ = ParseByteSize(c.MaxBytesTotal)
+	rs.MemoryBudget, _ = ParseByteSize(c.MemoryBudget)
+	if c.Protocol == protoHTTP || c.Protocol == protoHTTPS {
+		// Validate rejects malformed values before this is called.
+		rs.SourceRateLimit, rs.SourceRateWindow, _ = ParseRequestRate(c.RateLimitSource)
+		rs.SourceRateExempt, _ = ParseCIDRList(c.RateLimitExempt)
+		rs.TrafficClasses, _ = ParseTrafficClasses(c.Classify)
+		rs.HostRewrite = c.hostRewrite()
+		rs.HostRewriteForwarded = c.HostRewriteForwarded && rs.HostRewrite != ""
+		if c.QueueRequests {
+			rs.QueueRequests = true
+			rs.QueueDir = strings.TrimSpace(c.QueueDir)
+			rs.QueueMaxBody, _ = ParseByteSize(c.QueueMaxBody)
+			rs.QueueMaxEntries = c.QueueMaxEntries
+			rs.QueueMethods = c.queueMethods()
+		}
+	}
+	return rs
+}
+
+// queueMethods returns the methods of --queue-methods, upper-cased.
+func (c *Config) queueMethods() []string {
+	var methods []string
+	for _, m := range strings.Split(c.QueueMethods, ",") {
+		if m = strings.ToUpper(strings.TrimSpace(m)); m != "" {
+			methods = append(methods, m)
+		}
+	}
+	return methods
+}
+
+// hostRewrite resolves --host-rewrite: HostRewriteTarget is the host of
+// --local, a bare port meaning 127.0.0.1.
+func (c *Config) hostRewrite() string {
+	v := strings.TrimSpace(c.HostRewrite)
+	if !strings.EqualFold(v, HostRewriteTarget) {
+		return v
+	}
+	target := strings.TrimSpace(c.TargetAddr)
+	if support.ParsePort(target) != "" {
+		return "127.0.0.1"
+	}
+	host, _, err := net.SplitHostPort(target)
+	if err != nil {
+		return ""
+	}
+	if strings.Contains(host, ":") {
+		// An IPv6 address is bracketed in a Host header.
+		return "[" + host + "]"
+	}
+	return host
+}
+
+// smuxMaxReceiveBuffer parses SmuxMaxReceiveBuffer; Validate rejects bad
+// values, so an error here means the default.
+func (c *Config) smuxMaxReceiveBuffer() int {
+	n, err := ParseByteRate(c.SmuxMaxReceiveBuffer)
+	if err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+// IncomingDstAllowList returns the destinations server-initiated streams may
+// dial: TargetAddr followed by the --allow-incoming-dst entries.
+func (c *Config) IncomingDstAllowList() []string {
+	var out []string
+	if t := strings.TrimSpace(c.TargetAddr); t != "" {
+		out = append(out, t)
+	}
+	for _, d := range strings.Split(c.AllowIncomingDst, ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// DstCommandEnvList returns the variable names of --dst-command-env.
+func (c *Config) DstCommandEnvList() []string {
+	var out []string
+	for _, name := range strings.Split(c.DstCommandEnv, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// SNIRoutes parses --sni-route into server name -> host:port, or nil when it
+// is unset or invalid (see validateSNIRoute).
+func (c *Config) SNIRoutes() map[string]string {
+	routes, err := parseSNIRoutes(c.SNIRoute)
+	if err != nil {
+		return nil
+	}
+	return routes
+}
+
+func parseSNIRoutes(s string) (map[string]string, error) {
+	var routes map[string]string
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, dst, ok := strings.Cut(entry, "=")
+		name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+		dst = strings.TrimSpace(dst)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%q is not name=host:port", entry)
+		}
+		if _, _, err := net.SplitHostPort(dst); err != nil {
+			return nil, fmt.Errorf("%q: %v", entry, err)
+		}
+		if _, dup := routes[name]; dup {
+			return nil, fmt.Errorf("%s is routed twice", name)
+		}
+		if routes == nil {
+			routes = make(map[string]string)
+		}
+		routes[name] = dst
+	}
+	return routes, nil
+}
+
+// QUICServe reports whether an http/https tunnel serves its incoming streams
+// over QUIC (--dp quic or auto), and whether a failed first QUIC dial falls
+// back to the WebSocket data plane (auto).
+func (c *Config) QUICServe() (enabled, fallback bool) {
+	if c.Protocol != protoHTTP && c.Protocol != protoHTTPS {
+		return false, false
+	}
+	switch strings.ToLower(strings.TrimSpace(c.DataPlane)) {
+	case DataPlaneQUIC:
+		return true, false
+	case DataPlaneAuto:
+		return true, true
+	default:
+		return false, false
+	}
+}
+
+// ExportFileFormat is --export-format normalized; empty is dotenv.
+func (c *Config) ExportFileFormat() string {
+	if f := strings.ToLower(strings.TrimSpace(c.ExportFormat)); f != "" {
+		return f
+	}
+	return exportDotenv
+}
+
+// JSONOutput reports whether machine-readable output was requested (--output json).
+func (c *Config) JSONOutput() bool {
+	return strings.EqualFold(strings.TrimSpace(c.Output), outputJSON)
 }
 
 // EncryptionSettings extracts encryption configuration.
 func (c *Config) EncryptionSettings() EncryptionSettings {
-	return EncryptionSettings{Enabled: c.Encrypt, PSK: c.PSK}
+	// Validate rejects unknown --psk-kdf names before this is called.
+	kdf, _ := security.ResolveKDF(c.PSKKDF, c.PSK)
+	enc := EncryptionSettings{Enabled: c.Encrypt, PSK: c.PSK, KDF: kdf, OmitKDFPreface: !c.Capabilities.Has(protocolv1.FeaturePSKKDF)}
+	if enc.Enabled {
+		enc.Keys = security.NewClientPSKWithKDF([]byte(c.PSK), kdf)
+	}
+	return enc
 }
 
 // Parse parses command-line flags and positional arguments into Config.
@@ -149,22 +795,56 @@ func Parse() (*Config, error) {
 	fs.BoolVar(&cfg.TokenFromStdin, "token-stdin", cfg.TokenFromStdin, "Read bearer token from stdin")
 	fs.StringVar(&cfg.ServerURL, "server", cfg.ServerURL, "Server URL")
 	fs.BoolVar(&cfg.AllowInsecureHTTP, "allow-insecure-http", cfg.AllowInsecureHTTP, "Allow non-local HTTP server URL (unsafe)")
-	fs.StringVar(&cfg.TargetAddr, "local", cfg.TargetAddr, "Target address to tunnel")
+	fs.StringVar(&cfg.TargetAddr, "local", cfg.TargetAddr, "Target address to tunnel; a comma-separated list fails over between backends")
+	fs.StringVar(&cfg.LocalBalance, "local-balance", cfg.LocalBalance, "How streams pick among several --local targets: failover (first healthy) or roundrobin")
 	fs.StringVar(&cfg.Protocol, "protocol", cfg.Protocol, "Protocol (http, https, tcp)")
-	fs.StringVar(&cfg.DataPlane, "dp", cfg.DataPlane, "Data-plane transport (ws|quic|dtls)")
+	fs.StringVar(&cfg.DataPlane, "dp", cfg.DataPlane, "Data-plane transport (ws|quic|dtls|auto); quic and auto serve http/https tunnels over QUIC, auto falling back to ws")
 	fs.StringVar(&cfg.UserID, "user", cfg.UserID, "User ID")
 	fs.IntVar(&backoffInitialSec, "backoff-initial", backoffInitialSec, "Initial reconnect backoff seconds")
 	fs.IntVar(&backoffMaxSec, "backoff-max", backoffMaxSec, "Max reconnect backoff seconds")
 	fs.StringVar(&cfg.UDPListen, "udp-listen", cfg.UDPListen, "Local UDP listen address (e.g. :5353) for client UDP mode")
 	fs.StringVar(&cfg.UDPDst, "udp-dst", cfg.UDPDst, "Destination UDP address on server side (e.g. 127.0.0.1:53)")
-	fs.StringVar(&durations.PingInterval, "ping-interval", "30s", "WebSocket ping interval")
+	fs.IntVar(&cfg.UDPQueueSize, "udp-queue", cfg.UDPQueueSize, "Max in-flight UDP packets per direction; oldest are dropped when full")
+	fs.StringVar(&cfg.ListenAddr, "listen", cfg.ListenAddr, "Local TCP listen address (e.g. :4000, or auto for a free port); connections are forwarded to --dst on the server side")
+	fs.StringVar(&cfg.Dst, "dst", cfg.Dst, "Server-side TCP destination for --listen or --proxy-command (e.g. localhost:3333)")
+	fs.BoolVar(&cfg.ProxyCommand, "proxy-command", cfg.ProxyCommand, "Bridge stdin/stdout to --dst through the tunnel (SSH ProxyCommand); status goes to stderr")
+	fs.BoolVar(&cfg.Redundant, "redundant", cfg.Redundant, "Experimental: send the --proxy-command stream over the WebSocket and QUIC data planes at once; the first copy of each frame is delivered")
+	fs.StringVar(&cfg.DstCommand, "dst-command", cfg.DstCommand, "Executable that picks --dst per connection from its first bytes (stdin) and peer address (env)")
+	fs.StringVar(&cfg.SNIRoute, "sni-route", cfg.SNIRoute, "Route --listen connections by the server name of their TLS ClientHello, e.g. api.example.com=127.0.0.1:8443,grafana.example.com=127.0.0.1:3000 (TLS passes through untouched)")
+	fs.StringVar(&cfg.SNIDefault, "sni-default", cfg.SNIDefault, "Server-side destination of --sni-route connections without a matching server name, or not speaking TLS (default: --dst)")
+	fs.StringVar(&durations.DstCommandTimeout, "dst-command-timeout", "500ms", "Time limit for --dst-command before falling back to --dst")
+	fs.IntVar(&cfg.DstCommandMaxProcs, "dst-command-max-procs", cfg.DstCommandMaxProcs, "Run at most N --dst-command processes at once; further connections wait for one, up to --dst-command-timeout")
+	fs.StringVar(&cfg.DstCommandEnv, "dst-command-env", cfg.DstCommandEnv, "Comma-separated environment variables passed to --dst-command besides PATH, HOME, locale and FORTUNNELS_* (the rest are withheld)")
+	fs.StringVar(&cfg.AllowIncomingDst, "allow-incoming-dst", cfg.AllowIncomingDst, "Comma-separated extra host:port destinations server-initiated streams may dial besides --local")
+	fs.StringVar(&cfg.BackendProxy, "backend-proxy", cfg.BackendProxy, "Reach the local backend through a proxy: http://[user:pass@]host:port (CONNECT) or socks5://host:port")
+	fs.StringVar(&durations.FirstByteTimeout, "backend-first-byte-timeout", "0", "Log a slow-backend event when a backend sends nothing for this long after the dial (0 disables)")
+	fs.IntVar(&cfg.BackendPoolSize, "backend-pool-size", cfg.BackendPoolSize, "Keep up to N idle keep-alive connections per backend and reuse them for later HTTP requests (http/https tunnels; 0 dials one per stream)")
+	fs.StringVar(&durations.BackendPoolIdle, "backend-pool-idle", "90s", "Close pooled backend connections unused for this long (--backend-pool-size)")
+	fs.BoolVar(&cfg.ResumeGET, "resume-get", cfg.ResumeGET, "Let the server resume GET responses cut off by a data-plane reconnect, re-requesting the rest from range-capable backends (http/https tunnels)")
+	fs.StringVar(&cfg.FallbackPage, "fallback-page", cfg.FallbackPage, "Answer requests with a 503 and this HTML page while the backend cannot be reached, or builtin for a default page (http/https tunnels)")
+	fs.BoolVar(&cfg.QueueRequests, "queue-requests", cfg.QueueRequests, "While the backend cannot be reached, answer small POST/PUT requests with 202 Accepted and replay them in order once it is back (http/https tunnels)")
+	fs.StringVar(&cfg.QueueDir, "queue-dir", cfg.QueueDir, "Directory keeping the --queue-requests queue across restarts (default: queue next to the config file)")
+	fs.StringVar(&cfg.QueueMaxBody, "queue-max-body", cfg.QueueMaxBody, "Largest request body --queue-requests queues, e.g. 1MiB")
+	fs.IntVar(&cfg.QueueMaxEntries, "queue-max-entries", cfg.QueueMaxEntries, "Most requests --queue-requests keeps; later ones get the normal error")
+	fs.StringVar(&cfg.QueueMethods, "queue-methods", cfg.QueueMethods, "Comma-separated methods --queue-requests may queue; list only methods whose requests are safe to deliver late")
+	fs.StringVar(&cfg.LocalMirror, "local-mirror", cfg.LocalMirror, "Also serve the target on this local address (e.g. :8080) with the tunnel's request handling, for clients on the LAN (http/https tunnels)")
+	fs.BoolVar(&cfg.Open, "open", cfg.Open, "Open the public URL in the default browser once the tunnel serves it (http/https tunnels)")
+	fs.StringVar(&cfg.ExportEnv, "export-env", cfg.ExportEnv, "Keep the public URL, tunnel ID, protocol and expiry in this file while serving (rewritten when the URL changes, removed on exit)")
+	fs.StringVar(&cfg.ExportFormat, "export-format", cfg.ExportFormat, "Format of the --export-env file (dotenv|json)")
+	fs.StringVar(&cfg.BackendTimeoutAction, "backend-timeout-action", cfg.BackendTimeoutAction, "What a --backend-first-byte-timeout does besides logging: log, close (drop the stream) or 503 (http/https only)")
+	fs.StringVar(&durations.PingInterval, "ping-interval", "30s", "WebSocket ping interval, or auto to adapt it to link RTT and loss")
 	fs.StringVar(&durations.PingTimeout, "ping-timeout", "10s", "WebSocket ping write deadline")
+	fs.IntVar(&cfg.PingLossThreshold, "ping-loss-threshold", cfg.PingLossThreshold, "Reconnect a data-plane connection after N pings in a row get no pong (0 waits for the 90s read deadline)")
 	fs.StringVar(&durations.SmuxInterval, "smux-keepalive-interval", "25s", "smux keepalive interval")
 	fs.StringVar(&durations.SmuxTimeout, "smux-keepalive-timeout", "60s", "smux keepalive timeout")
+	fs.StringVar(&cfg.SmuxMaxReceiveBuffer, "smux-max-receive-buffer", cfg.SmuxMaxReceiveBuffer, "smux session receive buffer, e.g. 16MiB (empty: smux default of 4MiB)")
 	fs.StringVar(&durations.WatchInterval, "watch-interval", "10s", "HTTP poll interval after WS subscription (fallback monitoring)")
+	fs.StringVar(&durations.Keepalive, "tunnel-keepalive", "5m", "Control-plane keepalive interval so the server does not reap an idle-looking tunnel (0 disables)")
 	fs.BoolVar(&cfg.WatchWS, "watch", cfg.WatchWS, "Watch tunnel updates over WebSocket (runs until closed)")
 	fs.BoolVar(&cfg.Encrypt, "encrypt", cfg.Encrypt, "Enable client-side stream encryption (PSK)")
+	fs.BoolVar(&cfg.Strict, "strict", cfg.Strict, "Exit when the server does not confirm --encrypt instead of warning")
 	fs.StringVar(&cfg.PSK, "psk", cfg.PSK, "Pre-shared key for encryption")
+	fs.StringVar(&cfg.PSKKDF, "psk-kdf", cfg.PSKKDF, "PSK key derivation: auto (argon2id for passphrases, legacy for encoded random keys), argon2id or legacy")
 	fs.StringVar(&cfg.PSKFile, "psk-file", cfg.PSKFile, "Read PSK from file")
 	fs.BoolVar(&cfg.PSKFromStdin, "psk-stdin", cfg.PSKFromStdin, "Read PSK from stdin")
 	fs.StringVar(&cfg.DPAuthToken, "dp-auth-token", cfg.DPAuthToken, "Precomputed data-plane auth token (hex)")
@@ -173,16 +853,78 @@ func Parse() (*Config, error) {
 	fs.StringVar(&cfg.DPAuthSecretFile, "dp-auth-secret-file", cfg.DPAuthSecretFile, "Read data-plane auth secret from file")
 	fs.BoolVar(&cfg.DPAuthTokenFromStdin, "dp-auth-token-stdin", cfg.DPAuthTokenFromStdin, "Read data-plane auth token from stdin")
 	fs.BoolVar(&cfg.DPAuthSecretFromStdin, "dp-auth-secret-stdin", cfg.DPAuthSecretFromStdin, "Read data-plane auth secret from stdin")
-	fs.IntVar(&cfg.QUICPort, "quic-port", defaultQUICPort, "Server QUIC port for UDP data-plane")
+	fs.IntVar(&cfg.QUICPort, "quic-port", defaultQUICPort, "Server QUIC port for the QUIC data plane")
 	fs.IntVar(&cfg.DTLSPort, "dtls-port", defaultDTLSPort, "Server DTLS port for UDP data-plane")
+	fs.BoolVar(&cfg.Force, "force", cfg.Force, "Take over the tunnel when another client instance is already serving it")
+	fs.BoolVar(&cfg.NoPositional, "no-positional", cfg.NoPositional, "Reject positional arguments (client tcp 5433) and require --protocol and --local, for scripts (also "+envNoPositional+"=1)")
+	fs.BoolVar(&cfg.NoIPPinning, "no-ip-pinning", cfg.NoIPPinning, "Resolve the server hostname for every data-plane dial instead of pinning dials to the IP the tunnel was created on")
+	fs.BoolVar(&cfg.TLSChainCache, "tls-chain-cache", cfg.TLSChainCache, "Keep the server's TLS certificate chain on disk and compare against it when TLS verification fails")
+	fs.StringVar(&cfg.TunnelID, "tunnel-id", cfg.TunnelID, "Serve this existing tunnel instead of creating one (operator-managed; never deleted by the client)")
+	fs.IntVar(&cfg.CreateRetries, "create-retries", cfg.CreateRetries, "Retry tunnel creation up to N times when the server rate-limits it, waiting its Retry-After")
+	fs.StringVar(&durations.ControlTimeout, "control-timeout", "30s", "Time limit for one control-plane API call, retries included")
+	fs.StringVar(&durations.ControlAttemptTimeout, "control-attempt-timeout", "10s", "Time limit for each attempt of a control-plane API call")
+	fs.IntVar(&cfg.ControlRetries, "control-retries", cfg.ControlRetries, "Retry idempotent control-plane API calls (GET, DELETE) up to N times on network errors, timeouts, 429 and 5xx gateway errors")
+	fs.BoolVar(&cfg.Announce, "announce", cfg.Announce, "Publish the tunnel's public URL on the local network via mDNS (see the discover command)")
+	fs.BoolVar(&cfg.MakeBeforeBreak, "make-before-break", cfg.MakeBeforeBreak, "Pre-establish a standby data-plane session when the active one degrades")
+	fs.StringVar(&durations.DegradedRTT, "degraded-rtt", "2s", "Ping RTT above which the data-plane session counts as degraded (make-before-break)")
+	fs.StringVar(&durations.TransportProbe, "dp-probe-interval", "30s", "With --dp auto, how often to probe the QUIC and WebSocket data planes and switch away from a degraded one (0 disables switching)")
+	fs.StringVar(&durations.StreamLatencyWarn, "stream-latency-warn", "5s", "Warn when the p95 of opening client streams, or of their first byte back, stays above this for a --stream-latency-window (0 disables)")
+	fs.StringVar(&durations.StreamLatencyWindow, "stream-latency-window", "1m", "Window over which --stream-latency-warn evaluates the p95")
+	fs.StringVar(&durations.DrainTimeout, "drain-timeout", "30s", "How long a replaced data-plane session, or a tunnel past --max-bytes-total, may drain existing streams")
+	fs.BoolVar(&cfg.StatusLine, "status-line", cfg.StatusLine, "Show a live throughput sparkline on stderr while serving")
+	fs.BoolVar(&cfg.RaiseNoFile, "raise-nofile", cfg.RaiseNoFile, "Raise the soft open file limit to the hard limit before serving")
+	fs.BoolVar(&cfg.InspectDecode, "inspect-decode", cfg.InspectDecode, "Log each HTTP response with its wire and gzip/deflate-decoded body size (forwarded bytes are unchanged)")
+	fs.IntVar(&cfg.InspectBodyBytes, "inspect-body-bytes", cfg.InspectBodyBytes, "Log the first N bytes of text-like HTTP response bodies (0 disables)")
+	fs.IntVar(&cfg.HTTPPeekBytes, "http-peek-bytes", cfg.HTTPPeekBytes, "Per-stream buffer budget of HTTP-aware features (inspection, tracing); larger heads are streamed untouched")
+	fs.StringVar(&cfg.RateLimit, "rate-limit", cfg.RateLimit, "Cap serving throughput per direction in bytes/s, e.g. 512KiB or 10MB (empty: unlimited)")
+	fs.StringVar(&cfg.MaxBytesPerStream, "max-bytes-per-stream", cfg.MaxBytesPerStream, "Close a stream once it moved this many bytes in both directions together, e.g. 50MB (empty: unlimited)")
+	fs.StringVar(&cfg.MaxBytesTotal, "max-bytes-total", cfg.MaxBytesTotal, "Stop the tunnel once it moved this many bytes in total, e.g. 200MB; new streams are refused, open ones drain for up to --drain-timeout, then the client exits with code 9 (empty: unlimited)")
+	fs.StringVar(&cfg.MemoryBudget, "memory-budget", cfg.MemoryBudget, "Cap the memory buffering features hold together: kept --resume-get responses degrade first, then HTTP peek buffers, then UDP queues drop packets, e.g. 256MiB (0: unlimited)")
+	fs.StringVar(&cfg.RateLimitSource, "rate-limit-source", cfg.RateLimitSource, "Answer HTTP requests beyond N per window from one client IP (X-Forwarded-For) with 429, e.g. 60/minute (http/https tunnels; empty: unlimited)")
+	fs.StringVar(&cfg.RateLimitExempt, "rate-limit-exempt", cfg.RateLimitExempt, "Comma-separated CIDRs or IPs --rate-limit-source never limits")
+	fs.StringVar(&cfg.Classify, "classify", cfg.Classify, "Count HTTP requests per traffic class: comma-separated class=matcher rules, first match wins; a matcher is a path regexp, accept:<regexp>, content-type:<regexp> or upgrade, e.g. api=^/api/,ws=upgrade (http/https tunnels)")
+	fs.StringVar(&cfg.HostRewrite, "host-rewrite", cfg.HostRewrite, "Forward HTTP requests with this Host header, e.g. myapp.local for a virtual-host backend; target uses the host of --local (http/https tunnels)")
+	fs.BoolVar(&cfg.HostRewriteForwarded, "host-rewrite-forwarded", cfg.HostRewriteForwarded, "With --host-rewrite, keep the original Host in X-Forwarded-Host")
+	fs.IntVar(&cfg.MaxStreams, "max-streams", cfg.MaxStreams, "Cap the streams open at once across all listeners of the tunnel; waiting listeners take turns (0: unlimited)")
+	fs.Float64Var(&cfg.PerListenerRate, "per-listener-rate", cfg.PerListenerRate, "Cap how many new streams each listener may start per second (0: unlimited)")
+	fs.StringVar(&cfg.ListenPriority, "listen-priority", cfg.ListenPriority, "How --listen streams are prioritized: auto (sustained fast senders are bulk), interactive or bulk; bulk streams are paced while interactive ones are open")
+	fs.StringVar(&cfg.RawPath, "raw-path", cfg.RawPath, "Complete WebSocket upgrades to this path of an http/https tunnel locally and bridge them to --raw-dst (raw TCP for client wrap)")
+	fs.StringVar(&cfg.RawDst, "raw-dst", cfg.RawDst, "Local TCP service (host:port) that --raw-path upgrades are bridged to")
+	fs.BoolVar(&cfg.SendPeerInfo, "send-peer-info", cfg.SendPeerInfo, "Tell the server each --listen connection's local peer and listener address (off: the peer is not disclosed)")
+	fs.StringVar(&cfg.StatsFile, "stats-file", cfg.StatsFile, "Keep cumulative traffic per tunnel target in this file across restarts (see client stats)")
+	fs.StringVar(&durations.StatsFlush, "stats-flush", "1m", "How often --stats-file is checkpointed (also on shutdown)")
+	fs.BoolVar(&cfg.NoRegistry, "no-registry", false, "Do not list this client in client ps")
+	fs.StringVar(&cfg.CrashDir, "crash-dir", cfg.CrashDir, "Write a crash report (stack dump and diagnostics summary) to this directory for every panic the client recovers from")
+	fs.BoolVar(&cfg.SingleConnection, "single-connection", cfg.SingleConnection, "Carry control messages over the data-plane WebSocket instead of a second WebSocket (needs server support; falls back otherwise)")
+	fs.StringVar(&cfg.Profile, "profile", cfg.Profile, "Start from a stored tunnel profile (see client profile import); flags override it")
+	fs.StringVar(&cfg.ConfigPath, "config", cfg.ConfigPath, "fortunnels.yml whose tunnel section sets defaults and is re-read on SIGHUP")
+	fs.StringVar(&cfg.ReloadFile, "reload-file", cfg.ReloadFile, "Reload --config whenever this file's modification time changes (alternative to SIGHUP)")
+	fs.BoolVar(&cfg.WaitDNS, "wait-dns", cfg.WaitDNS, "After creating a host-based tunnel, wait until its public hostname resolves before reporting it ready")
+	fs.StringVar(&durations.WaitDNSTimeout, "wait-dns-timeout", "60s", "How long --wait-dns keeps polling before giving up")
+	fs.StringVar(&durations.ReadyTimeout, "ready-timeout", "15s", "How long to wait for the data plane to connect before printing the public URL; after it the URL is printed with a warning (0: print it right away)")
+	fs.StringVar(&cfg.DNSServer, "dns-server", cfg.DNSServer, "Resolver (host[:port]) used by --wait-dns instead of the system one")
+	fs.StringVar(&cfg.Output, "output", cfg.Output, "Format of the final status line on stderr (text|json)")
+	fs.BoolVar(&cfg.UTC, "utc", cfg.UTC, "Print times and log timestamps in UTC instead of the local zone")
+	fs.StringVar(&cfg.OTelEndpoint, "otel-endpoint", cfg.OTelEndpoint, "OTLP/HTTP collector URL for trace export (e.g. http://localhost:4318)")
 
 	if err := fs.Parse(os.Args[1:]); err != nil {
 		return nil, err
 	}
 
-	localProvided, serverProvided, protocolProvided, secretFlags := detectFlagOverrides()
+	localProvided, protocolProvided, secretFlags := detectFlagOverrides()
 	clearSensitiveArgs(secretFlags)
-	cfg.ServerFlagProvided = serverProvided
+	fromProfile := map[string]bool{}
+	if name := strings.TrimSpace(cfg.Profile); name != "" {
+		applied, err := applyProfile(fs, name, cfg.Reporter())
+		if err != nil {
+			return nil, err
+		}
+		fromProfile = applied
+		for n := range applied {
+			cfg.setSource(n, "profile "+name)
+		}
+	}
+	provided := func(name string) bool { return flagProvided(name) || fromProfile[name] }
 	cfg.TokenFlagProvided = secretFlags.token
 	cfg.PasswordFlagProvided = secretFlags.password
 	cfg.PSKFlagProvided = secretFlags.psk
@@ -190,10 +932,35 @@ func Parse() (*Config, error) {
 	cfg.DPAuthSecretFlagProvided = secretFlags.dpAuthSecret
 
 	remaining := fs.Args()
+	if err := applyNoPositionalEnv(cfg, provided("no-positional")); err != nil {
+		return nil, err
+	}
+	if cfg.NoPositional {
+		if err := rejectPositionalArgs(remaining); err != nil {
+			return nil, err
+		}
+	}
 	if err := validatePositionalArgs(remaining); err != nil {
 		return nil, err
 	}
-	processPositionalArgs(remaining, &cfg.Protocol, &cfg.TargetAddr, localProvided, protocolProvided)
+	if err := applyConfigFile(cfg, provided); err != nil {
+		return nil, err
+	}
+	// Positional arguments replace a profile's local target but keep its protocol.
+	protocol, target := cfg.Protocol, cfg.TargetAddr
+	protocolGiven := protocolProvided || fromProfile["protocol"]
+	processPositionalArgs(remaining, &cfg.Protocol, &cfg.TargetAddr, localProvided, protocolGiven)
+	if cfg.Protocol != protocol || (namesProtocol(remaining) && !protocolGiven) {
+		cfg.setSource("protocol", "positional")
+	}
+	if cfg.TargetAddr != target {
+		cfg.setSource("local", "positional")
+	}
+	if !provided("server") && cfg.sources["server"] == "" && support.GetEnvTrimmed(envServerURL) != "" {
+		cfg.setSource("server", "env "+envServerURL)
+	}
+	splitLocalTargets(cfg)
+	normalizeServerURL(cfg)
 
 	if err := applyDurationFlags(cfg, &durations); err != nil {
 		return nil, err
@@ -203,6 +970,9 @@ func Parse() (*Config, error) {
 	if cfg.WatchInterval < time.Second {
 		cfg.WatchInterval = time.Second
 	}
+	if cfg.TunnelKeepalive < 0 {
+		return nil, fmt.Errorf("invalid --tunnel-keepalive %s: use a positive duration, or 0 to disable", cfg.TunnelKeepalive)
+	}
 
 	if err := applySecretSources(cfg); err != nil {
 		return nil, err
@@ -221,17 +991,34 @@ func GetProtocolConstants() (http, https, tcp, udp string) {
 // defaultConfig returns Config populated with CLI defaults.
 func defaultConfig() *Config {
 	return &Config{
-		ServerURL:      support.GetDefaultServerURL(defaultServerURL),
-		TargetAddr:     "localhost:3000",
-		Protocol:       protoHTTP,
-		DataPlane:      "ws",
-		UserID:         "default",
-		BackoffInitial: time.Second,
-		BackoffMax:     30 * time.Second,
-		WatchInterval:  10 * time.Second,
-		PSK:            "",
-		QUICPort:       defaultQUICPort,
-		DTLSPort:       defaultDTLSPort,
+		ServerURL:            support.GetDefaultServerURL(defaultServerURL),
+		TargetAddr:           "localhost:3000",
+		Protocol:             protoHTTP,
+		DataPlane:            DataPlaneWS,
+		UserID:               "default",
+		BackoffInitial:       time.Second,
+		BackoffMax:           30 * time.Second,
+		WatchInterval:        10 * time.Second,
+		PSK:                  "",
+		PSKKDF:               security.KDFAuto,
+		QUICPort:             defaultQUICPort,
+		DTLSPort:             defaultDTLSPort,
+		UDPQueueSize:         defaultUDPQueueSize,
+		HTTPPeekBytes:        defaultHTTPPeekBytes,
+		QueueMaxBody:         defaultQueueMaxBody,
+		MemoryBudget:         defaultMemoryBudget,
+		QueueMaxEntries:      defaultQueueMaxEntries,
+		QueueMethods:         defaultQueueMethods,
+		Output:               outputText,
+		ExportFormat:         exportDotenv,
+		LocalBalance:         localBalanceFailover,
+		BackendTimeoutAction: backendTimeoutLog,
+		ListenPriority:       ListenPriorityAuto,
+		WaitDNS:              true,
+		RaiseNoFile:          true,
+		ControlRetries:       defaultControlRetries,
+		PingLossThreshold:    defaultPingLossThreshold,
+		DstCommandMaxProcs:   defaultDstCommandMaxProcs,
 	}
 }
 
@@ -241,6 +1028,21 @@ type durationFlags struct {
 	SmuxInterval  string
 	SmuxTimeout   string
 	WatchInterval string
+	DegradedRTT   string
+	Keepalive     string
+	DrainTimeout  string
+	StatsFlush    string
+
+	DstCommandTimeout     string
+	WaitDNSTimeout        string
+	ReadyTimeout          string
+	BackendPoolIdle       string
+	FirstByteTimeout      string
+	ControlTimeout        string
+	ControlAttemptTimeout string
+	TransportProbe        string
+	StreamLatencyWarn     string
+	StreamLatencyWindow   string
 }
 
 func applyDurationFlags(cfg *Config, d *durationFlags) error {
@@ -253,7 +1055,10 @@ func applyDurationFlags(cfg *Config, d *durationFlags) error {
 	}
 
 	var err error
-	if cfg.PingInterval, err = parse("--ping-interval", d.PingInterval); err != nil {
+	if strings.EqualFold(strings.TrimSpace(d.PingInterval), pingIntervalAuto) {
+		cfg.AdaptivePing = true
+		cfg.PingInterval = adaptivePingStart
+	} else if cfg.PingInterval, err = parse("--ping-interval", d.PingInterval); err != nil {
 		return err
 	}
 	if cfg.PingTimeout, err = parse("--ping-timeout", d.PingTimeout); err != nil {
@@ -268,6 +1073,48 @@ func applyDurationFlags(cfg *Config, d *durationFlags) error {
 	if cfg.WatchInterval, err = parse("--watch-interval", d.WatchInterval); err != nil {
 		return err
 	}
+	if cfg.TunnelKeepalive, err = parse("--tunnel-keepalive", d.Keepalive); err != nil {
+		return err
+	}
+	if cfg.DegradedRTT, err = parse("--degraded-rtt", d.DegradedRTT); err != nil {
+		return err
+	}
+	if cfg.DrainTimeout, err = parse("--drain-timeout", d.DrainTimeout); err != nil {
+		return err
+	}
+	if cfg.TransportProbeInterval, err = parse("--dp-probe-interval", d.TransportProbe); err != nil {
+		return err
+	}
+	if cfg.StreamLatencyWarn, err = parse("--stream-latency-warn", d.StreamLatencyWarn); err != nil {
+		return err
+	}
+	if cfg.StreamLatencyWindow, err = parse("--stream-latency-window", d.StreamLatencyWindow); err != nil {
+		return err
+	}
+	if cfg.StatsFlush, err = parse("--stats-flush", d.StatsFlush); err != nil {
+		return err
+	}
+	if cfg.DstCommandTimeout, err = parse("--dst-command-timeout", d.DstCommandTimeout); err != nil {
+		return err
+	}
+	if cfg.WaitDNSTimeout, err = parse("--wait-dns-timeout", d.WaitDNSTimeout); err != nil {
+		return err
+	}
+	if cfg.ReadyTimeout, err = parse("--ready-timeout", d.ReadyTimeout); err != nil {
+		return err
+	}
+	if cfg.BackendFirstByteTimeout, err = parse("--backend-first-byte-timeout", d.FirstByteTimeout); err != nil {
+		return err
+	}
+	if cfg.BackendPoolIdle, err = parse("--backend-pool-idle", d.BackendPoolIdle); err != nil {
+		return err
+	}
+	if cfg.ControlTimeout, err = parse("--control-timeout", d.ControlTimeout); err != nil {
+		return err
+	}
+	if cfg.ControlAttemptTimeout, err = parse("--control-attempt-timeout", d.ControlAttemptTimeout); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -314,14 +1161,35 @@ func needsInlineValue(arg string, args []string, idx int) bool {
 }
 
 var booleanCLIArgs = map[string]struct{}{
-	"allow-insecure-http":  {},
-	"pass-stdin":           {},
-	"token-stdin":          {},
-	"watch":                {},
-	"encrypt":              {},
-	"psk-stdin":            {},
-	"dp-auth-token-stdin":  {},
-	"dp-auth-secret-stdin": {},
+	"allow-insecure-http":    {},
+	"pass-stdin":             {},
+	"token-stdin":            {},
+	"watch":                  {},
+	"encrypt":                {},
+	"strict":                 {},
+	"no-registry":            {},
+	"psk-stdin":              {},
+	"dp-auth-token-stdin":    {},
+	"dp-auth-secret-stdin":   {},
+	"make-before-break":      {},
+	"announce":               {},
+	"proxy-command":          {},
+	"redundant":              {},
+	"force":                  {},
+	"utc":                    {},
+	"status-line":            {},
+	"wait-dns":               {},
+	"inspect-decode":         {},
+	"no-ip-pinning":          {},
+	"single-connection":      {},
+	"tls-chain-cache":        {},
+	"resume-get":             {},
+	"queue-requests":         {},
+	"open":                   {},
+	"raise-nofile":           {},
+	"host-rewrite-forwarded": {},
+	"send-peer-info":         {},
+	"no-positional":          {},
 }
 
 func isBooleanCLIArg(arg string) bool {
@@ -374,18 +1242,7 @@ type secretFlagSet struct {
 	dpAuthSecret bool
 }
 
-func detectFlagOverrides() (localProvided, serverProvided, protocolProvided bool, secrets secretFlagSet) {
-	flagProvided := func(name string) bool {
-		for _, a := range os.Args[1:] {
-			if a == "-"+name ||
-				a == "--"+name ||
-				strings.HasPrefix(a, "-"+name+"=") ||
-				strings.HasPrefix(a, "--"+name+"=") {
-				return true
-			}
-		}
-		return false
-	}
+func detectFlagOverrides() (localProvided, protocolProvided bool, secrets secretFlagSet) {
 	secrets = secretFlagSet{
 		token:        flagProvided("token"),
 		password:     flagProvided("pass"),
@@ -393,7 +1250,20 @@ func detectFlagOverrides() (localProvided, serverProvided, protocolProvided bool
 		dpAuthToken:  flagProvided("dp-auth-token"),
 		dpAuthSecret: flagProvided("dp-auth-secret"),
 	}
-	return flagProvided("local"), flagProvided("server"), flagProvided("protocol"), secrets
+	return flagProvided("local"), flagProvided("protocol"), secrets
+}
+
+// flagProvided reports whether --name was given on the command line.
+func flagProvided(name string) bool {
+	for _, a := range os.Args[1:] {
+		if a == "-"+name ||
+			a == "--"+name ||
+			strings.HasPrefix(a, "-"+name+"=") ||
+			strings.HasPrefix(a, "--"+name+"=") {
+			return true
+		}
+	}
+	return false
 }
 
 type secretSource struct {
@@ -402,16 +1272,21 @@ type secretSource struct {
 	file      *string
 	fromStdin *bool
 	envVar    string
+	// provided is set when the value was given as a flag.
+	provided bool
 }
 
-func applySecretSources(cfg *Config) error {
-	sources := []secretSource{
+// secretSources lists cfg's secrets; label is also the flag name, with
+// -file and -stdin variants.
+func secretSources(cfg *Config) []secretSource {
+	return []secretSource{
 		{
 			label:     "token",
 			value:     &cfg.Token,
 			file:      &cfg.TokenFile,
 			fromStdin: &cfg.TokenFromStdin,
 			envVar:    "FORTUNNELS_TOKEN",
+			provided:  cfg.TokenFlagProvided,
 		},
 		{
 			label:     "pass",
@@ -419,6 +1294,7 @@ func applySecretSources(cfg *Config) error {
 			file:      &cfg.PasswordFile,
 			fromStdin: &cfg.PasswordFromStdin,
 			envVar:    "FORTUNNELS_PASSWORD",
+			provided:  cfg.PasswordFlagProvided,
 		},
 		{
 			label:     "psk",
@@ -426,6 +1302,7 @@ func applySecretSources(cfg *Config) error {
 			file:      &cfg.PSKFile,
 			fromStdin: &cfg.PSKFromStdin,
 			envVar:    "FORTUNNELS_PSK",
+			provided:  cfg.PSKFlagProvided,
 		},
 		{
 			label:     "dp-auth-token",
@@ -433,6 +1310,7 @@ func applySecretSources(cfg *Config) error {
 			file:      &cfg.DPAuthTokenFile,
 			fromStdin: &cfg.DPAuthTokenFromStdin,
 			envVar:    "FORTUNNELS_DP_AUTH_TOKEN",
+			provided:  cfg.DPAuthTokenFlagProvided,
 		},
 		{
 			label:     "dp-auth-secret",
@@ -440,9 +1318,13 @@ func applySecretSources(cfg *Config) error {
 			file:      &cfg.DPAuthSecretFile,
 			fromStdin: &cfg.DPAuthSecretFromStdin,
 			envVar:    "FORTUNNELS_DP_AUTH_SECRET",
+			provided:  cfg.DPAuthSecretFlagProvided,
 		},
 	}
+}
 
+func applySecretSources(cfg *Config) error {
+	sources := secretSources(cfg)
 	if err := ensureSingleStdinSource(sources); err != nil {
 		return err
 	}
@@ -501,13 +1383,55 @@ func applyTransportPortEnv(cfg *Config) {
 	if v := support.GetEnvTrimmed("FORTUNNELS_QUIC_PORT"); v != "" {
 		if p, err := strconv.Atoi(v); err == nil && p > 0 && p <= 65535 {
 			cfg.QUICPort = p
+			cfg.setSource("quic-port", "env FORTUNNELS_QUIC_PORT")
 		}
 	}
 	if v := support.GetEnvTrimmed("FORTUNNELS_DTLS_PORT"); v != "" {
 		if p, err := strconv.Atoi(v); err == nil && p > 0 && p <= 65535 {
 			cfg.DTLSPort = p
+			cfg.setSource("dtls-port", "env FORTUNNELS_DTLS_PORT")
+		}
+	}
+}
+
+// applyConfigFile loads the --config tunnel section and uses its keys for the
+// flags that were not given (provided reports flags set on the command line
+// or by --profile). Positional arguments still override local from the file.
+func applyConfigFile(cfg *Config, provided func(name string) bool) error {
+	if strings.TrimSpace(cfg.ConfigPath) == "" {
+		return nil
+	}
+	fc, err := LoadFileConfig(cfg.ConfigPath)
+	if err != nil {
+		return fmt.Errorf("load --config: %w", err)
+	}
+	t := fc.Tunnel
+	if err := ValidateTunnelFileConfig(t); err != nil {
+		return fmt.Errorf("%s: %w", cfg.ConfigPath, err)
+	}
+	cfg.FileTunnel = t
+	source := "config " + cfg.ConfigPath
+	setString := func(dst *string, name, value string) {
+		if !provided(name) && strings.TrimSpace(value) != "" {
+			*dst = strings.TrimSpace(value)
+			cfg.setSource(name, source)
 		}
 	}
+	setString(&cfg.ServerURL, "server", t.ServerURL)
+	setString(&cfg.Protocol, "protocol", strings.ToLower(t.Protocol))
+	setString(&cfg.TargetAddr, "local", t.Local)
+	setString(&cfg.RateLimit, "rate-limit", t.RateLimit)
+	setString(&cfg.AllowIncomingDst, "allow-incoming-dst", t.AllowIncomingDst)
+	cfg.LogLevel = strings.ToLower(strings.TrimSpace(t.LogLevel))
+	if t.InspectDecode != nil && !provided("inspect-decode") {
+		cfg.InspectDecode = *t.InspectDecode
+		cfg.setSource("inspect-decode", source)
+	}
+	if t.InspectBodyBytes != nil && !provided("inspect-body-bytes") {
+		cfg.InspectBodyBytes = *t.InspectBodyBytes
+		cfg.setSource("inspect-body-bytes", source)
+	}
+	return nil
 }
 
 func applyConfigFileAuthtoken(cfg *Config) {
@@ -516,9 +1440,14 @@ func applyConfigFileAuthtoken(cfg *Config) {
 	}
 	if tok := AuthtokenFromFile(); tok != "" {
 		cfg.Token = tok
+		cfg.setSource("token", "config authtoken")
 	}
 }
 
+// validatePositionalArgs accepts at most a protocol and an address (a port
+// or host:port), in that order, or one of them alone. Anything else is an
+// error rather than being ignored, so a typo cannot fall back to the
+// defaults.
 func validatePositionalArgs(args []string) error {
 	if len(args) > 2 {
 		return fmt.Errorf(
@@ -526,6 +1455,12 @@ func validatePositionalArgs(args []string) error {
 			protoHTTP, protoHTTPS, protoTCP, protoUDP,
 		)
 	}
+	if len(args) == 1 && !isSupportedProtocol(strings.ToLower(args[0])) && !isPositionalAddr(args[0]) {
+		return fmt.Errorf(
+			"unrecognized argument %q: expected a port (8000), host:port (localhost:8000) or protocol (%s, %s, %s, %s); or use -protocol and -local",
+			args[0], protoHTTP, protoHTTPS, protoTCP, protoUDP,
+		)
+	}
 	if len(args) != 2 {
 		return nil
 	}
@@ -537,9 +1472,87 @@ func validatePositionalArgs(args []string) error {
 			args[1], args[0],
 		)
 	}
+	if !isSupportedProtocol(a0) {
+		return fmt.Errorf(
+			"unknown protocol %q: supported protocols: %s, %s, %s, %s; or use -protocol and -local",
+			args[0], protoHTTP, protoHTTPS, protoTCP, protoUDP,
+		)
+	}
+	if !isPositionalAddr(args[1]) {
+		return fmt.Errorf(
+			"invalid address %q: expected a port (%s 8000) or host:port (%s localhost:8000); or use -local",
+			args[1], a0, a0,
+		)
+	}
+	return nil
+}
+
+// isPositionalAddr reports whether arg is an address processPositionalArgs
+// takes: a port or host:port.
+func isPositionalAddr(arg string) bool {
+	return support.ParsePort(arg) != "" || support.LooksLikeHostPort(arg)
+}
+
+// applyNoPositionalEnv sets NoPositional from FORTUNNELS_NO_POSITIONAL unless
+// --no-positional was given.
+func applyNoPositionalEnv(cfg *Config, flagGiven bool) error {
+	v := support.GetEnvTrimmed(envNoPositional)
+	if flagGiven || v == "" {
+		return nil
+	}
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("invalid %s=%q: use 1 or 0\n   Example: %s=1", envNoPositional, v, envNoPositional)
+	}
+	cfg.NoPositional = on
+	cfg.setSource("no-positional", "env "+envNoPositional)
 	return nil
 }
 
+// rejectPositionalArgs is --no-positional: any positional argument is an
+// error naming the flags that say the same explicitly.
+func rejectPositionalArgs(args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	msg := fmt.Sprintf("positional arguments are disabled (--no-positional or %s): got %q", envNoPositional, strings.Join(args, " "))
+	var protocol, target string
+	if validatePositionalArgs(args) == nil {
+		processPositionalArgs(args, &protocol, &target, false, false)
+	}
+	var flags []string
+	if protocol != "" {
+		flags = append(flags, "--protocol "+protocol)
+	}
+	if target != "" {
+		flags = append(flags, "--local "+target)
+	}
+	if len(flags) == 0 {
+		return fmt.Errorf("%s\n   Example: --protocol tcp --local 127.0.0.1:5433", msg)
+	}
+	return fmt.Errorf("%s; use the flags instead\n   Example: %s", msg, strings.Join(flags, " "))
+}
+
+// splitLocalTargets expands a comma-separated --local into LocalTargets and
+// keeps the first entry as TargetAddr. Bare ports mean 127.0.0.1; empty entries
+// are kept so validation reports them.
+func splitLocalTargets(cfg *Config) {
+	if !strings.Contains(cfg.TargetAddr, ",") {
+		return
+	}
+	parts := strings.Split(cfg.TargetAddr, ",")
+	targets := make([]string, 0, len(parts))
+	for _, t := range parts {
+		t = strings.TrimSpace(t)
+		if p := support.ParsePort(t); p != "" {
+			t = "127.0.0.1:" + p
+		}
+		targets = append(targets, t)
+	}
+	cfg.LocalTargets = targets
+	cfg.TargetAddr = targets[0]
+}
+
 func processPositionalArgs(args []string, protocol, targetAddr *string, localFlagProvided, protocolFlagProvided bool) {
 	switch len(args) {
 	case 0:
@@ -551,7 +1564,19 @@ func processPositionalArgs(args []string, protocol, targetAddr *string, localFla
 	}
 }
 
+// namesProtocol reports whether the positional arguments spell out the
+// protocol (client http 8000, client tcp) rather than imply it (client 8000).
+func namesProtocol(args []string) bool {
+	return len(args) > 0 && isSupportedProtocol(strings.ToLower(args[0]))
+}
+
+// handleSingleArg takes a lone positional argument: a protocol (client tcp
+// --dst %h:%p --proxy-command), or a port or host:port served over HTTP.
 func handleSingleArg(arg string, protocol, targetAddr *string, localFlagProvided, protocolFlagProvided bool) {
+	if argProto := strings.ToLower(arg); isSupportedProtocol(argProto) {
+		setProtocolIfMissing(protocol, protocolFlagProvided, argProto)
+		return
+	}
 	if p := support.ParsePort(arg); p != "" {
 		setProtocolIfMissing(protocol, protocolFlagProvided, protoHTTP)
 		setTargetIfMissing(targetAddr, localFlagProvided, "127.0.0.1:"+p)
@@ -6,11 +6,14 @@ package config
 import (
 	"flag"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/fortunnels/client/internal/security"
 	"github.com/fortunnels/client/internal/support"
 )
 
@@ -109,7 +112,10 @@ func TestDefaultConfig(t *testing.T) {
 	if cfg.PSK != "" {
 		t.Errorf("defaultConfig() PSK should be empty, got %q", cfg.PSK)
 	}
-	// TCP default mode: expose-local (serve-incoming)
+	// TCP default mode: expose-local (serve-incoming); no implicit server-side dst.
+	if cfg.Dst != "" {
+		t.Errorf("defaultConfig() Dst should be empty, got %q", cfg.Dst)
+	}
 }
 
 func TestProcessPositionalArgs_TCPPort(t *testing.T) {
@@ -120,6 +126,18 @@ func TestProcessPositionalArgs_TCPPort(t *testing.T) {
 	assert.Equal(t, "127.0.0.1:5433", targetAddr, "tcp 5433 should set target_addr to 127.0.0.1:5433")
 }
 
+func TestProcessPositionalArgs_ProtocolAlone(t *testing.T) {
+	protocol := "http"
+	targetAddr := "localhost:3000"
+	processPositionalArgs([]string{"TCP"}, &protocol, &targetAddr, false, false)
+	assert.Equal(t, protoTCP, protocol, "a lone protocol sets the protocol")
+	assert.Equal(t, "localhost:3000", targetAddr, "and leaves the target alone")
+
+	protocol = "udp"
+	processPositionalArgs([]string{"tcp"}, &protocol, &targetAddr, false, true)
+	assert.Equal(t, protoUDP, protocol, "--protocol wins over the positional")
+}
+
 func TestValidatePositionalArgs(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -134,6 +152,13 @@ func TestValidatePositionalArgs(t *testing.T) {
 		{"port then protocol swapped", []string{"5433", "tcp"}, true, "invalid argument order"},
 		{"host:port then protocol swapped", []string{"127.0.0.1:8080", "http"}, true, "invalid argument order"},
 		{"three positionals", []string{"tcp", "5433", "extra"}, true, "too many positional"},
+		{"protocol alone", []string{"tcp"}, false, ""},
+		{"host:port alone", []string{"db.local:5432"}, false, ""},
+		{"typo'd port", []string{"500O"}, true, `unrecognized argument "500O": expected a port (8000)`},
+		{"typo'd port after protocol", []string{"tcp", "500O"}, true, `invalid address "500O": expected a port (tcp 8000)`},
+		{"unknown protocol word", []string{"htp", "8000"}, true, `unknown protocol "htp": supported protocols: http, https, tcp, udp`},
+		{"unknown word alone", []string{"tpc"}, true, `unrecognized argument "tpc"`},
+		{"two addresses", []string{"8000", "9000"}, true, `unknown protocol "8000"`},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -170,6 +195,51 @@ func TestParse_RejectsSwappedPositionalArgs(t *testing.T) {
 	assert.ErrorContains(t, err, "invalid argument order")
 }
 
+func TestParse_RejectsUnrecognizedPositionalArgs(t *testing.T) {
+	_, err := testParseWithArgs(t, []string{"client", "tcp", "500O"})
+	require.ErrorContains(t, err, `invalid address "500O"`)
+	_, err = testParseWithArgs(t, []string{"client", "--open", "tcp", "5433", "--force"})
+	require.NoError(t, err, "a boolean flag does not swallow the next argument")
+}
+
+func TestParse_NoPositional(t *testing.T) {
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"8000"}, "Example: --protocol http --local 127.0.0.1:8000"},
+		{[]string{"tcp", "5433"}, "Example: --protocol tcp --local 127.0.0.1:5433"},
+		{[]string{"https", "app.local:8443"}, "Example: --protocol https --local app.local:8443"},
+		{[]string{"udp"}, "Example: --protocol udp"},
+		{[]string{"tcp", "500O"}, "Example: --protocol tcp --local 127.0.0.1:5433"},
+		{[]string{"tcp", "5433", "extra"}, `got "tcp 5433 extra"`},
+	} {
+		args := append([]string{"client", "--no-positional"}, tt.args...)
+		_, err := testParseWithArgs(t, args)
+		require.ErrorContains(t, err, "positional arguments are disabled", "%v", tt.args)
+		assert.ErrorContains(t, err, tt.want, "%v", tt.args)
+	}
+
+	cfg, err := testParseWithArgs(t, []string{"client", "--no-positional", "--protocol", "tcp", "--local", "127.0.0.1:5433"})
+	require.NoError(t, err)
+	assert.True(t, cfg.NoPositional)
+	assert.Equal(t, "127.0.0.1:5433", cfg.TargetAddr)
+}
+
+func TestParse_NoPositionalEnv(t *testing.T) {
+	t.Setenv(envNoPositional, "1")
+	_, err := testParseWithArgs(t, []string{"client", "tcp", "5433"})
+	require.ErrorContains(t, err, "Example: --protocol tcp --local 127.0.0.1:5433")
+
+	cfg, err := testParseWithArgs(t, []string{"client", "--no-positional=false", "tcp", "5433"})
+	require.NoError(t, err, "the flag overrides the environment")
+	assert.Equal(t, "127.0.0.1:5433", cfg.TargetAddr)
+
+	t.Setenv(envNoPositional, "yes please")
+	_, err = testParseWithArgs(t, []string{"client", "tcp", "5433"})
+	require.ErrorContains(t, err, "invalid "+envNoPositional)
+}
+
 func TestParse_AcceptsProtocolThenPort(t *testing.T) {
 	cfg, err := testParseWithArgs(t, []string{"client", "tcp", "5433"})
 	require.NoError(t, err)
@@ -183,6 +253,358 @@ func TestParse_RejectsTooManyPositionals(t *testing.T) {
 	assert.ErrorContains(t, err, "too many positional")
 }
 
+func TestParse_TCPModes(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "tcp", "5433"})
+	require.NoError(t, err)
+	assert.Empty(t, cfg.ListenAddr)
+	assert.Empty(t, cfg.Dst)
+	require.NoError(t, Validate(cfg), "bare tcp is expose-local")
+
+	cfg, err = testParseWithArgs(t, []string{"client", "-protocol", "tcp", "-listen", ":4000", "-dst", "localhost:3333"})
+	require.NoError(t, err)
+	assert.Equal(t, ":4000", cfg.ListenAddr)
+	assert.Equal(t, "localhost:3333", cfg.Dst)
+	assert.Equal(t, 500*time.Millisecond, cfg.DstCommandTimeout)
+	require.NoError(t, Validate(cfg))
+
+	cfg, err = testParseWithArgs(t, []string{"client", "-protocol", "tcp", "-dst", "localhost:3333"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "only used in TCP listen or proxy-command mode")
+}
+
+func TestParse_DstCommandLimits(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "-protocol", "tcp", "-listen", ":4000", "-dst", "localhost:3333"})
+	require.NoError(t, err)
+	assert.Equal(t, defaultDstCommandMaxProcs, cfg.DstCommandMaxProcs)
+	assert.Empty(t, cfg.RuntimeSettings().DstCommandEnv)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "-protocol", "tcp", "-listen", ":4000", "-dst", "localhost:3333",
+		"-dst-command", "true", "-dst-command-max-procs", "2", "-dst-command-env", "HTTP_PROXY, ROUTES_FILE,"})
+	require.NoError(t, err)
+	require.NoError(t, Validate(cfg))
+	rt := cfg.RuntimeSettings()
+	assert.Equal(t, 2, rt.DstCommandMaxProcs)
+	assert.Equal(t, []string{"HTTP_PROXY", "ROUTES_FILE"}, rt.DstCommandEnv)
+}
+
+func TestParse_Redundant(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "-protocol", "tcp", "-dst", "host:22", "-proxy-command", "-redundant"})
+	require.NoError(t, err)
+	require.NoError(t, Validate(cfg))
+	assert.True(t, cfg.RuntimeSettings().Redundant)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "-redundant", "8000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "--redundant is only supported with --proxy-command")
+}
+
+func TestParse_PingIntervalAuto(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "-ping-interval", "auto", "8000"})
+	require.NoError(t, err)
+	assert.True(t, cfg.AdaptivePing)
+	assert.Equal(t, 30*time.Second, cfg.PingInterval, "auto starts from the default interval")
+	assert.True(t, cfg.RuntimeSettings().AdaptivePing)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "-ping-interval", "15s", "8000"})
+	require.NoError(t, err)
+	assert.False(t, cfg.AdaptivePing)
+	assert.Equal(t, 15*time.Second, cfg.PingInterval)
+}
+
+func TestParse_TunnelKeepalive(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "8000"})
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, cfg.RuntimeSettings().TunnelKeepalive)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "-tunnel-keepalive", "0", "8000"})
+	require.NoError(t, err)
+	assert.Zero(t, cfg.TunnelKeepalive, "0 disables the keepalive")
+
+	_, err = testParseWithArgs(t, []string{"client", "-tunnel-keepalive", "-1m", "8000"})
+	require.ErrorContains(t, err, "invalid --tunnel-keepalive")
+}
+
+func TestParse_NoIPPinning(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "8000"})
+	require.NoError(t, err)
+	assert.False(t, cfg.NoIPPinning, "pinning is on by default")
+
+	// A boolean flag before the positional port must not swallow it.
+	cfg, err = testParseWithArgs(t, []string{"client", "--no-ip-pinning", "8000"})
+	require.NoError(t, err)
+	assert.True(t, cfg.NoIPPinning)
+	assert.Equal(t, "127.0.0.1:8000", cfg.TargetAddr)
+}
+
+func TestParse_AllowIncomingDst(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "-allow-incoming-dst", "127.0.0.1:8081, localhost:9000", "8000"})
+	require.NoError(t, err)
+	require.NoError(t, Validate(cfg))
+	assert.Equal(t, []string{"127.0.0.1:8000", "127.0.0.1:8081", "localhost:9000"}, cfg.RuntimeSettings().IncomingDstAllow)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "-allow-incoming-dst", "8081", "8000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "invalid --allow-incoming-dst")
+}
+
+func TestParse_BackendProxy(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "-backend-proxy", " socks5://10.0.0.1:1080 ", "8000"})
+	require.NoError(t, err)
+	require.NoError(t, Validate(cfg))
+	assert.Equal(t, "socks5://10.0.0.1:1080", cfg.RuntimeSettings().BackendProxy)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "-backend-proxy", "https://proxy:443", "8000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "invalid --backend-proxy")
+}
+
+func TestParse_PSKKDF(t *testing.T) {
+	const passphrase = "correct horse battery staple on tuesdays"
+	cfg, err := testParseWithArgs(t, []string{"client", "-encrypt", "-psk", passphrase, "8000"})
+	require.NoError(t, err)
+	require.NoError(t, Validate(cfg))
+	assert.Equal(t, security.Argon2idKDF, cfg.EncryptionSettings().KDF, "passphrases default to argon2id")
+
+	cfg, err = testParseWithArgs(t, []string{"client", "-encrypt", "-psk", passphrase, "-psk-kdf", "legacy", "8000"})
+	require.NoError(t, err)
+	require.NoError(t, Validate(cfg))
+	assert.Equal(t, security.LegacyKDF, cfg.EncryptionSettings().KDF)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "-encrypt", "-psk", passphrase, "-psk-kdf", "scrypt", "8000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "invalid --psk-kdf")
+}
+
+func TestParse_LocalTargetList(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "-local", "127.0.0.1:8000, 8001", "-local-balance", "roundrobin", "http"})
+	require.NoError(t, err)
+	require.NoError(t, Validate(cfg))
+	assert.Equal(t, "127.0.0.1:8000", cfg.TargetAddr, "the first backend is the tunnel target")
+	rt := cfg.RuntimeSettings()
+	assert.Equal(t, []string{"127.0.0.1:8000", "127.0.0.1:8001"}, rt.LocalTargets)
+	assert.True(t, rt.LocalRoundRobin)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "-local", "127.0.0.1:8000,127.0.0.1:99999", "http"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), `--local entry "127.0.0.1:99999"`)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "-local", "127.0.0.1:8000,", "http"})
+	require.NoError(t, err)
+	require.Error(t, Validate(cfg), "empty entries are rejected")
+
+	cfg, err = testParseWithArgs(t, []string{"client", "-local-balance", "random", "8000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "invalid --local-balance")
+}
+
+func TestParse_WaitDNS(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "8000"})
+	require.NoError(t, err)
+	assert.True(t, cfg.WaitDNS, "on by default")
+	assert.Equal(t, 60*time.Second, cfg.WaitDNSTimeout)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--wait-dns=false", "--wait-dns-timeout", "5s", "--dns-server", "1.1.1.1", "8000"})
+	require.NoError(t, err)
+	require.NoError(t, Validate(cfg))
+	assert.False(t, cfg.WaitDNS)
+	assert.Equal(t, 5*time.Second, cfg.WaitDNSTimeout)
+	assert.Equal(t, "1.1.1.1", cfg.DNSServer)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--wait-dns-timeout", "0s", "8000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "invalid --wait-dns-timeout")
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--dns-server", "udp://1.1.1.1", "8000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "invalid --dns-server")
+}
+
+func TestParse_ReadyTimeout(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "8000"})
+	require.NoError(t, err)
+	assert.Equal(t, 15*time.Second, cfg.ReadyTimeout)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--ready-timeout", "0s", "8000"})
+	require.NoError(t, err)
+	require.NoError(t, Validate(cfg))
+	assert.Zero(t, cfg.ReadyTimeout)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--ready-timeout", "-1s", "8000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "invalid --ready-timeout -1s")
+}
+
+func TestParse_Inspect(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "--inspect-decode", "--inspect-body-bytes", "512", "http", "3000"})
+	require.NoError(t, err)
+	require.NoError(t, Validate(cfg))
+	rt := cfg.RuntimeSettings()
+	assert.True(t, rt.InspectDecode)
+	assert.Equal(t, 512, rt.InspectBodyBytes)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--inspect-decode", "tcp", "5432"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "require an http or https tunnel")
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--inspect-body-bytes", "-1", "http", "3000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "invalid --inspect-body-bytes")
+}
+
+func TestParse_HTTPPeekBytes(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "http", "3000"})
+	require.NoError(t, err)
+	assert.Equal(t, 64<<10, cfg.RuntimeSettings().HTTPPeekBytes)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--http-peek-bytes", "131072", "http", "3000"})
+	require.NoError(t, err)
+	require.NoError(t, Validate(cfg))
+	assert.Equal(t, 131072, cfg.RuntimeSettings().HTTPPeekBytes)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--http-peek-bytes", "4096", "http", "3000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "invalid --http-peek-bytes 4096: must be at least 32768")
+}
+
+func TestParse_BackendFirstByteTimeout(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "--backend-first-byte-timeout", "10s", "--backend-timeout-action", "503", "http", "3000"})
+	require.NoError(t, err)
+	require.NoError(t, Validate(cfg))
+	rt := cfg.RuntimeSettings()
+	assert.Equal(t, 10*time.Second, rt.BackendFirstByteTimeout)
+	assert.True(t, rt.BackendTimeout503)
+	assert.False(t, rt.BackendTimeoutClose)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "8000"})
+	require.NoError(t, err)
+	require.NoError(t, Validate(cfg))
+	assert.Zero(t, cfg.BackendFirstByteTimeout, "off by default")
+	assert.Equal(t, "log", cfg.BackendTimeoutAction)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--backend-first-byte-timeout", "5s", "--backend-timeout-action", "503", "tcp", "5432"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "only applies to http/https tunnels")
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--backend-timeout-action", "close", "8000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "needs --backend-first-byte-timeout")
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--backend-first-byte-timeout", "5s", "--backend-timeout-action", "retry", "8000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "invalid --backend-timeout-action")
+}
+
+func TestParse_SmuxMaxReceiveBuffer(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "--smux-max-receive-buffer", "16MiB", "8000"})
+	require.NoError(t, err)
+	require.NoError(t, Validate(cfg))
+	assert.Equal(t, 16<<20, cfg.RuntimeSettings().SmuxMaxReceiveBuffer)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "8000"})
+	require.NoError(t, err)
+	assert.Zero(t, cfg.RuntimeSettings().SmuxMaxReceiveBuffer, "smux default")
+
+	for _, bad := range []string{"1KiB", "4GiB", "lots"} {
+		cfg, err = testParseWithArgs(t, []string{"client", "--smux-max-receive-buffer", bad, "8000"})
+		require.NoError(t, err)
+		require.ErrorContains(t, Validate(cfg), "invalid --smux-max-receive-buffer", bad)
+	}
+}
+
+func TestParse_StreamBudget(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "--max-streams", "64", "--per-listener-rate", "2.5", "8000"})
+	require.NoError(t, err)
+	require.NoError(t, Validate(cfg))
+	rt := cfg.RuntimeSettings()
+	assert.Equal(t, 64, rt.MaxStreams)
+	assert.InDelta(t, 2.5, rt.PerListenerRate, 1e-9)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--max-streams", "-1", "8000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "invalid --max-streams")
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--per-listener-rate", "-3", "8000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "invalid --per-listener-rate")
+
+	cfg, err = testParseWithArgs(t, []string{"client", "8000"})
+	require.NoError(t, err)
+	assert.Equal(t, ListenPriorityAuto, cfg.RuntimeSettings().ListenPriority)
+	assert.False(t, cfg.RuntimeSettings().SendPeerInfo, "peer info is off by default")
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--send-peer-info", "8000"})
+	require.NoError(t, err)
+	assert.True(t, cfg.RuntimeSettings().SendPeerInfo)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--listen-priority", "bulk", "8000"})
+	require.NoError(t, err)
+	require.NoError(t, Validate(cfg))
+	assert.Equal(t, ListenPriorityBulk, cfg.RuntimeSettings().ListenPriority)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--listen-priority", "urgent", "8000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "--listen-priority")
+}
+
+func TestParse_ControlPolicy(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "8000"})
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, cfg.ControlTimeout)
+	assert.Equal(t, 10*time.Second, cfg.ControlAttemptTimeout)
+	assert.Equal(t, defaultControlRetries, cfg.ControlRetries)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--control-timeout", "1m", "--control-attempt-timeout", "5s", "--control-retries", "0", "8000"})
+	require.NoError(t, err)
+	require.NoError(t, Validate(cfg))
+	assert.Equal(t, time.Minute, cfg.ControlTimeout)
+	assert.Equal(t, 5*time.Second, cfg.ControlAttemptTimeout)
+	assert.Zero(t, cfg.ControlRetries)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--control-retries", "-1", "8000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "invalid --control-retries")
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--control-timeout", "5s", "--control-attempt-timeout", "10s", "8000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "longer than --control-timeout")
+}
+
+func TestParse_ConfigFileTunnelSection(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fortunnels.yml")
+	require.NoError(t, os.WriteFile(path, []byte(`version: 3
+tunnel:
+  protocol: tcp
+  local: 127.0.0.1:5432
+  rate_limit: 1MiB
+  allow_incoming_dst: 127.0.0.1:9000
+  log_level: debug
+`), 0o600))
+
+	cfg, err := testParseWithArgs(t, []string{"client", "--config", path})
+	require.NoError(t, err)
+	require.NoError(t, Validate(cfg))
+	assert.Equal(t, "tcp", cfg.Protocol)
+	assert.Equal(t, "127.0.0.1:5432", cfg.TargetAddr)
+	assert.Equal(t, "1MiB", cfg.RateLimit)
+	assert.Equal(t, "127.0.0.1:9000", cfg.AllowIncomingDst)
+	assert.Equal(t, "debug", cfg.LogLevel)
+	assert.Equal(t, "1MiB", cfg.FileTunnel.RateLimit)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--config", path, "--rate-limit", "64KiB", "http", "3000"})
+	require.NoError(t, err)
+	assert.Equal(t, "64KiB", cfg.RateLimit, "flags win over the file")
+	assert.Equal(t, "http", cfg.Protocol, "positional arguments win over the file")
+	assert.Equal(t, "127.0.0.1:3000", cfg.TargetAddr)
+
+	require.NoError(t, os.WriteFile(path, []byte("version: 3\ntunnel:\n  rate_limit: fast\n"), 0o600))
+	_, err = testParseWithArgs(t, []string{"client", "--config", path, "8000"})
+	require.ErrorContains(t, err, "tunnel.rate_limit")
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--reload-file", path, "8000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "--reload-file needs --config")
+}
+
 func TestParse_BooleanFlagDoesNotConsumePositional(t *testing.T) {
 	cfg, err := testParseWithArgs(t, []string{"client", "--encrypt", "127.0.0.1:9000"})
 	require.NoError(t, err)
@@ -241,3 +663,214 @@ func TestApplySecretSourcesStdinConflict(t *testing.T) {
 		t.Fatalf("applySecretSources() expected error for multiple stdin flags")
 	}
 }
+
+func TestParse_RaiseNoFile(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "8000"})
+	require.NoError(t, err)
+	assert.True(t, cfg.RaiseNoFile, "on by default")
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--raise-nofile=false", "8000"})
+	require.NoError(t, err)
+	assert.False(t, cfg.RaiseNoFile)
+}
+
+func TestParse_RawPath(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "--raw-path", "/raw", "--raw-dst", "127.0.0.1:22", "http", "3000"})
+	require.NoError(t, err)
+	assert.Equal(t, "/raw", cfg.RawPath)
+	assert.Equal(t, "127.0.0.1:22", cfg.RawDst)
+	rt := cfg.RuntimeSettings()
+	assert.Equal(t, "/raw", rt.RawPath)
+	assert.Equal(t, "127.0.0.1:22", rt.RawDst)
+}
+
+func TestParse_PositionalProtocolIsSet(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "8000"})
+	require.NoError(t, err)
+	assert.False(t, cfg.IsSet("protocol"), "a bare port implies http")
+
+	cfg, err = testParseWithArgs(t, []string{"client", "http", "8000"})
+	require.NoError(t, err)
+	assert.True(t, cfg.IsSet("protocol"), "http spelled out even though it is the default")
+}
+
+func TestParse_BackendPool(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "--backend-pool-size", "8", "http", "8000"})
+	require.NoError(t, err)
+	require.NoError(t, Validate(cfg))
+	rs := cfg.RuntimeSettings()
+	assert.Equal(t, 8, rs.BackendPoolSize)
+	assert.Equal(t, 90*time.Second, rs.BackendPoolIdle)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--backend-pool-size", "-1", "http", "8000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "invalid --backend-pool-size -1")
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--backend-pool-size", "4", "--backend-pool-idle", "0s", "http", "8000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "invalid --backend-pool-idle 0s")
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--backend-pool-size", "4", "tcp", "5432"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "--backend-pool-size requires an http or https tunnel")
+}
+
+func TestParse_ResumeGET(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "--resume-get", "http", "8000"})
+	require.NoError(t, err)
+	require.NoError(t, Validate(cfg))
+	assert.True(t, cfg.RuntimeSettings().ResumeGET)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--resume-get", "tcp", "5432"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "--resume-get requires an http or https tunnel")
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--resume-get", "--backend-pool-size", "4", "http", "8000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "--resume-get cannot be combined with --backend-pool-size")
+}
+
+func TestParse_FallbackPage(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "--fallback-page", "builtin", "http", "8000"})
+	require.NoError(t, err)
+	require.NoError(t, Validate(cfg))
+	assert.Equal(t, FallbackPageBuiltin, cfg.RuntimeSettings().FallbackPage)
+
+	page := filepath.Join(t.TempDir(), "down.html")
+	require.NoError(t, os.WriteFile(page, []byte("<p>back soon</p>"), 0o600))
+	cfg, err = testParseWithArgs(t, []string{"client", "--fallback-page", page, "https", "8443"})
+	require.NoError(t, err)
+	require.NoError(t, Validate(cfg))
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--fallback-page", filepath.Join(t.TempDir(), "missing.html"), "http", "8000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "invalid --fallback-page")
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--fallback-page", "builtin", "tcp", "5432"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "--fallback-page requires an http or https tunnel")
+}
+
+func TestParse_TransportProbeInterval(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "--dp", "auto", "http", "8000"})
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, cfg.RuntimeSettings().TransportProbeInterval)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--dp", "auto", "--dp-probe-interval", "0", "http", "8000"})
+	require.NoError(t, err)
+	require.NoError(t, Validate(cfg))
+	assert.Zero(t, cfg.TransportProbeInterval)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--dp-probe-interval", "-1s", "http", "8000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "invalid --dp-probe-interval")
+}
+
+func TestParse_PingLossThreshold(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "http", "8000"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, cfg.RuntimeSettings().PingLossThreshold)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--ping-loss-threshold", "0", "http", "8000"})
+	require.NoError(t, err)
+	require.NoError(t, Validate(cfg))
+	assert.Zero(t, cfg.RuntimeSettings().PingLossThreshold)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--ping-loss-threshold", "-1", "http", "8000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "invalid --ping-loss-threshold -1")
+}
+
+func TestParse_StreamLatencyWarn(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "tcp", "--listen", ":4000", "--dst", "db:5432"})
+	require.NoError(t, err)
+	rs := cfg.RuntimeSettings()
+	assert.Equal(t, 5*time.Second, rs.StreamLatencyWarn)
+	assert.Equal(t, time.Minute, rs.StreamLatencyWindow)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--stream-latency-warn", "0", "--stream-latency-window", "0", "http", "8000"})
+	require.NoError(t, err)
+	require.NoError(t, Validate(cfg), "no window needed without the warning")
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--stream-latency-window", "0", "http", "8000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "invalid --stream-latency-window")
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--stream-latency-warn", "-1s", "http", "8000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "invalid --stream-latency-warn")
+}
+
+func TestParse_LocalMirror(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "--local-mirror", ":8080", "http", "3000"})
+	require.NoError(t, err)
+	require.NoError(t, Validate(cfg))
+	assert.Equal(t, ":8080", cfg.LocalMirror)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--local-mirror", "8080", "http", "3000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "invalid --local-mirror")
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--local-mirror", ":8080", "tcp", "5432"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "--local-mirror requires an http or https tunnel")
+}
+
+func TestParse_Open(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "--open", "http", "3000"})
+	require.NoError(t, err)
+	require.NoError(t, Validate(cfg))
+	assert.True(t, cfg.Open)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--open", "tcp", "5432"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "--open requires an http or https tunnel")
+}
+
+func TestParse_ExportEnv(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := testParseWithArgs(t, []string{"client", "--export-env", filepath.Join(dir, ".env.tunnel"), "--export-format", "JSON", "http", "3000"})
+	require.NoError(t, err)
+	require.NoError(t, Validate(cfg))
+	assert.Equal(t, exportJSON, cfg.ExportFileFormat())
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--export-env", filepath.Join(dir, ".env.tunnel"), "http", "3000"})
+	require.NoError(t, err)
+	assert.Equal(t, exportDotenv, cfg.ExportFileFormat(), "dotenv by default")
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--export-env", filepath.Join(dir, ".env.tunnel"), "--export-format", "yaml", "http", "3000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), `invalid --export-format "yaml"`)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--export-env", dir, "http", "3000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "is a directory")
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--export-env", filepath.Join(dir, "missing", ".env"), "http", "3000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "does not exist")
+}
+
+func TestParse_QueueRequests(t *testing.T) {
+	cfg, err := testParseWithArgs(t, []string{"client", "--queue-requests", "--queue-methods", "post, patch", "--queue-dir", "/tmp/q", "http", "3000"})
+	require.NoError(t, err)
+	require.NoError(t, Validate(cfg))
+	rs := cfg.RuntimeSettings()
+	assert.True(t, rs.QueueRequests)
+	assert.Equal(t, "/tmp/q", rs.QueueDir)
+	assert.Equal(t, int64(1<<20), rs.QueueMaxBody)
+	assert.Equal(t, 1000, rs.QueueMaxEntries)
+	assert.Equal(t, []string{"POST", "PATCH"}, rs.QueueMethods)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--queue-requests", "--queue-methods", "POST,GET", "http", "3000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "GET requests expect an answer")
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--queue-requests", "--queue-max-body", "0", "http", "3000"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "invalid --queue-max-body")
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--queue-requests", "tcp", "5432"})
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(cfg), "--queue-requests requires an http or https tunnel")
+}
@@ -0,0 +1,374 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package config
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fortunnels/client/internal/support"
+)
+
+const (
+	// profileSchemaVersion is the current tunnel profile format.
+	profileSchemaVersion = 1
+	profileDirName       = "profiles"
+	profileKeyName       = "profile-signing.key"
+)
+
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// Profile is a portable tunnel setup (client profile export/import,
+// --profile). It holds the resolved non-secret flags and, for secrets, only
+// where they come from: an environment variable name or a file path.
+type Profile struct {
+	Schema    int       `json:"schema"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	// Flags maps flag names to their values as given on the command line.
+	Flags map[string]string `json:"flags"`
+	// Secrets maps a secret flag (token, pass, psk, dp-auth-token,
+	// dp-auth-secret) to its source.
+	Secrets map[string]SecretRef `json:"secrets,omitempty"`
+	// Checksum is "sha256:" plus the hex digest of the profile without
+	// Checksum and Signature; truncated or edited files fail it.
+	Checksum  string            `json:"checksum,omitempty"`
+	Signature *ProfileSignature `json:"signature,omitempty"`
+}
+
+// SecretRef tells where a secret is read from on the importing machine.
+// Exactly one field is set.
+type SecretRef struct {
+	Env   string `json:"env,omitempty"`
+	File  string `json:"file,omitempty"`
+	Stdin bool   `json:"stdin,omitempty"`
+}
+
+// ProfileSignature is an Ed25519 signature over the checksum by the
+// exporting user's profile key.
+type ProfileSignature struct {
+	PublicKey string `json:"public_key"`
+	Value     string `json:"value"`
+}
+
+// Fingerprint identifies the signing key, for comparing with the sender.
+func (s *ProfileSignature) Fingerprint() string {
+	key, err := base64.StdEncoding.DecodeString(s.PublicKey)
+	if err != nil {
+		return "invalid"
+	}
+	sum := sha256.Sum256(key)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// profileSkippedFlags are never exported: secrets are referenced through
+// Secrets instead, and --profile would refer to itself.
+var profileSkippedFlags = map[string]struct{}{"profile": {}}
+
+// profileCredentialURLFlags take a URL whose userinfo may hold a password;
+// it is exported without the userinfo, which the importing user adds back.
+var profileCredentialURLFlags = map[string]struct{}{"backend-proxy": {}}
+
+// profileSensitiveFlags run a command or write files on the importing
+// machine; profile import lists them before storing the profile.
+var profileSensitiveFlags = []string{"dst-command", "dst-command-env", "export-env", "stats-file", "queue-dir", "crash-dir"}
+
+// profileSecretLabels are the keys Profile.Secrets may use.
+var profileSecretLabels = map[string]struct{}{}
+
+func init() {
+	for _, s := range secretSources(&Config{}) {
+		profileSecretLabels[s.label] = struct{}{}
+		profileSkippedFlags[s.label] = struct{}{}
+		profileSkippedFlags[s.label+"-file"] = struct{}{}
+		profileSkippedFlags[s.label+"-stdin"] = struct{}{}
+	}
+}
+
+// NewProfile captures cfg, as returned by Parse, as a profile named name.
+// Secret values never enter the profile: a secret read from a file or stdin
+// is referenced as such, anything else by its environment variable, which
+// the importing user sets.
+func NewProfile(name string, cfg *Config) (*Profile, error) {
+	if !profileNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid profile name %q: use letters, digits, '.', '_' or '-'", name)
+	}
+	p := &Profile{
+		Schema:    profileSchemaVersion,
+		Name:      name,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		Flags:     map[string]string{},
+		Secrets:   map[string]SecretRef{},
+	}
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		if _, skip := profileSkippedFlags[f.Name]; skip {
+			return
+		}
+		if v := f.Value.String(); v != f.DefValue || flagProvided(f.Name) {
+			if _, ok := profileCredentialURLFlags[f.Name]; ok {
+				v, _ = StripURLCredentials(v)
+			}
+			p.Flags[f.Name] = v
+		}
+	})
+	// Positional arguments and environment defaults resolve into these.
+	p.Flags["server"] = cfg.ServerURL
+	p.Flags["protocol"] = cfg.Protocol
+	if len(cfg.LocalTargets) > 1 {
+		p.Flags["local"] = strings.Join(cfg.LocalTargets, ",")
+	} else if cfg.TargetAddr != "" {
+		p.Flags["local"] = cfg.TargetAddr
+	}
+	for _, s := range secretSources(cfg) {
+		switch {
+		case *s.file != "":
+			p.Secrets[s.label] = SecretRef{File: *s.file}
+		case *s.fromStdin:
+			p.Secrets[s.label] = SecretRef{Stdin: true}
+		case *s.value != "" && (s.provided || support.GetEnvTrimmed(s.envVar) != ""):
+			p.Secrets[s.label] = SecretRef{Env: s.envVar}
+		}
+	}
+	return p, nil
+}
+
+// StripURLCredentials returns raw without the userinfo of its URL, and
+// whether there was any. Values that do not parse are returned unchanged.
+func StripURLCredentials(raw string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.User == nil {
+		return raw, false
+	}
+	u.User = nil
+	return u.String(), true
+}
+
+// SensitiveFlags lists the profile's flags that run a command or write
+// files, as "--name value", for the importing user to review.
+func (p *Profile) SensitiveFlags() []string {
+	var out []string
+	for _, n := range profileSensitiveFlags {
+		if v, ok := p.Flags[n]; ok && v != "" {
+			out = append(out, fmt.Sprintf("--%s %s", n, v))
+		}
+	}
+	return out
+}
+
+// checksum returns the digest of p without its Checksum and Signature.
+func (p *Profile) checksum() (string, error) {
+	body := *p
+	body.Checksum, body.Signature = "", nil
+	b, err := json.Marshal(body)
+	if err != nil {
+		return "", fmt.Errorf("marshal profile: %w", err)
+	}
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// Sign sets the checksum and signs it with key.
+func (p *Profile) Sign(key ed25519.PrivateKey) error {
+	sum, err := p.checksum()
+	if err != nil {
+		return err
+	}
+	p.Checksum = sum
+	p.Signature = &ProfileSignature{
+		PublicKey: base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+		Value:     base64.StdEncoding.EncodeToString(ed25519.Sign(key, []byte(sum))),
+	}
+	return nil
+}
+
+// Verify checks the schema version, the checksum and the signature.
+func (p *Profile) Verify() error {
+	if p.Schema < 1 || p.Schema > profileSchemaVersion {
+		return fmt.Errorf("unsupported profile schema %d (this client reads up to %d)", p.Schema, profileSchemaVersion)
+	}
+	if !profileNamePattern.MatchString(p.Name) {
+		return fmt.Errorf("invalid profile name %q", p.Name)
+	}
+	sum, err := p.checksum()
+	if err != nil {
+		return err
+	}
+	if p.Checksum != sum {
+		return errors.New("profile checksum mismatch: the file is truncated or was edited")
+	}
+	if p.Signature == nil {
+		return errors.New("profile is not signed")
+	}
+	pub, err := base64.StdEncoding.DecodeString(p.Signature.PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return errors.New("profile signature has an invalid public key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(p.Signature.Value)
+	if err != nil || !ed25519.Verify(pub, []byte(sum), sig) {
+		return errors.New("profile signature does not match")
+	}
+	for label, ref := range p.Secrets {
+		if _, ok := profileSecretLabels[label]; !ok {
+			return fmt.Errorf("profile references unknown secret %q", label)
+		}
+		if n := btoi(ref.Env != "") + btoi(ref.File != "") + btoi(ref.Stdin); n != 1 {
+			return fmt.Errorf("profile secret %q must have exactly one source", label)
+		}
+	}
+	return nil
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// MissingEnv lists the environment variables the profile's secrets need
+// that are not set.
+func (p *Profile) MissingEnv() []string {
+	var out []string
+	for _, ref := range p.Secrets {
+		if ref.Env != "" && support.GetEnvTrimmed(ref.Env) == "" {
+			out = append(out, ref.Env)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// ReadProfile reads and verifies a profile file.
+func ReadProfile(path string) (*Profile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read profile: %w", err)
+	}
+	var p Profile
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("%s: not a valid profile: %w", path, err)
+	}
+	if err := p.Verify(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// WriteProfile writes p as indented JSON.
+func WriteProfile(path string, p *Profile) error {
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal profile: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o600)
+}
+
+// ProfilePath is where the profile named name is stored: a profiles
+// directory next to fortunnels.yml.
+func ProfilePath(name string) (string, error) {
+	if !profileNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid profile name %q: use letters, digits, '.', '_' or '-'", name)
+	}
+	cfgPath, err := DefaultConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(cfgPath), profileDirName, name+".json"), nil
+}
+
+// ProfileSigningKey loads the user's profile signing key, creating it on
+// first use.
+func ProfileSigningKey() (ed25519.PrivateKey, error) {
+	cfgPath, err := DefaultConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(filepath.Dir(cfgPath), profileKeyName)
+	if b, err := os.ReadFile(path); err == nil {
+		seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("%s: invalid profile signing key", path)
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key.Seed())+"\n"), 0o600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// applyProfile loads --profile and sets every flag it holds that was not
+// given on the command line. It returns the names of the flags it set.
+func applyProfile(fs *flag.FlagSet, name string, r support.Reporter) (map[string]bool, error) {
+	path, err := ProfilePath(name)
+	if err != nil {
+		return nil, err
+	}
+	p, err := ReadProfile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load --profile: %w", err)
+	}
+	applied := map[string]bool{}
+	names := make([]string, 0, len(p.Flags))
+	for n := range p.Flags {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		if _, skip := profileSkippedFlags[n]; skip || flagProvided(n) {
+			continue
+		}
+		if fs.Lookup(n) == nil {
+			return nil, fmt.Errorf("profile %s: unknown flag --%s (exported by a newer client?)", name, n)
+		}
+		if err := fs.Set(n, p.Flags[n]); err != nil {
+			return nil, fmt.Errorf("profile %s: --%s: %w", name, n, err)
+		}
+		applied[n] = true
+	}
+	for label, ref := range p.Secrets {
+		if flagProvided(label) || flagProvided(label+"-file") || flagProvided(label+"-stdin") {
+			continue
+		}
+		switch {
+		case ref.File != "":
+			err = fs.Set(label+"-file", ref.File)
+		case ref.Stdin:
+			err = fs.Set(label+"-stdin", "true")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %s: %w", name, label, err)
+		}
+	}
+	for _, env := range p.MissingEnv() {
+		r.UserMessage(support.LevelWarn, "⚠️  Profile %s reads a secret from %s, which is not set\n", name, env)
+	}
+	return applied, nil
+}
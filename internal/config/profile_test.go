@@ -0,0 +1,168 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	profileTestToken  = "ft_literal_token_never_exported_1"
+	profileTestPSK    = "file-psk-value-never-exported-0123456789"
+	profileTestSecret = "env-dp-secret-never-exported-42"
+)
+
+// exportTestProfile parses a setup carrying secrets from a flag, a file and
+// the environment, and exports it to a file.
+func exportTestProfile(t *testing.T) (*Config, string) {
+	t.Helper()
+	t.Setenv(envConfigPath, filepath.Join(t.TempDir(), "fortunnels.yml"))
+	t.Setenv("FORTUNNELS_DP_AUTH_SECRET", profileTestSecret)
+	pskFile := filepath.Join(t.TempDir(), "psk")
+	require.NoError(t, os.WriteFile(pskFile, []byte(profileTestPSK+"\n"), 0o600))
+
+	cfg, err := testParseWithArgs(t, []string{"client",
+		"--token", profileTestToken, "--psk-file", pskFile, "--encrypt",
+		"--rate-limit", "1MiB", "--ping-interval", "15s", "--protocol", "tcp",
+		"--local", "127.0.0.1:5432,127.0.0.1:5433",
+	})
+	require.NoError(t, err)
+	p, err := NewProfile("db", cfg)
+	require.NoError(t, err)
+	key, err := ProfileSigningKey()
+	require.NoError(t, err)
+	require.NoError(t, p.Sign(key))
+	out := filepath.Join(t.TempDir(), "db.profile.json")
+	require.NoError(t, WriteProfile(out, p))
+	return cfg, out
+}
+
+func TestProfile_ExportNeverContainsSecrets(t *testing.T) {
+	_, out := exportTestProfile(t)
+	b, err := os.ReadFile(out)
+	require.NoError(t, err)
+	for _, secret := range []string{profileTestToken, profileTestPSK, profileTestSecret} {
+		assert.NotContains(t, string(b), secret)
+	}
+
+	p, err := ReadProfile(out)
+	require.NoError(t, err)
+	assert.Equal(t, SecretRef{Env: "FORTUNNELS_TOKEN"}, p.Secrets["token"], "a literal flag becomes an env reference")
+	assert.Equal(t, "psk", filepath.Base(p.Secrets["psk"].File))
+	assert.Equal(t, SecretRef{Env: "FORTUNNELS_DP_AUTH_SECRET"}, p.Secrets["dp-auth-secret"])
+	assert.NotContains(t, p.Secrets, "pass", "unset secrets are not referenced")
+	for name := range p.Flags {
+		assert.NotContains(t, []string{"token", "psk", "psk-file", "dp-auth-secret", "profile"}, name)
+	}
+	assert.Equal(t, "tcp", p.Flags["protocol"])
+	assert.Equal(t, "127.0.0.1:5432,127.0.0.1:5433", p.Flags["local"])
+	assert.Equal(t, "1MiB", p.Flags["rate-limit"])
+}
+
+func TestProfile_ExportStripsBackendProxyCredentials(t *testing.T) {
+	t.Setenv(envConfigPath, filepath.Join(t.TempDir(), "fortunnels.yml"))
+	const proxyPass = "proxy-pass-never-exported-7"
+	cfg, err := testParseWithArgs(t, []string{"client",
+		"--backend-proxy", "http://alice:" + proxyPass + "@proxy.internal:3128", "http", "8080",
+	})
+	require.NoError(t, err)
+	p, err := NewProfile("web", cfg)
+	require.NoError(t, err)
+	key, err := ProfileSigningKey()
+	require.NoError(t, err)
+	require.NoError(t, p.Sign(key))
+	out := filepath.Join(t.TempDir(), "web.profile.json")
+	require.NoError(t, WriteProfile(out, p))
+
+	b, err := os.ReadFile(out)
+	require.NoError(t, err)
+	assert.NotContains(t, string(b), proxyPass)
+	assert.NotContains(t, string(b), "alice")
+	assert.Equal(t, "http://proxy.internal:3128", p.Flags["backend-proxy"])
+}
+
+func TestProfile_SensitiveFlags(t *testing.T) {
+	p := &Profile{Flags: map[string]string{
+		"dst-command": "/usr/local/bin/route", "export-env": "/tmp/tunnel.env", "rate-limit": "1MiB", "crash-dir": "",
+	}}
+	assert.Equal(t, []string{"--dst-command /usr/local/bin/route", "--export-env /tmp/tunnel.env"}, p.SensitiveFlags())
+	assert.Empty(t, (&Profile{Flags: map[string]string{"rate-limit": "1MiB"}}).SensitiveFlags())
+}
+
+func TestProfile_RejectsTruncatedOrEditedFiles(t *testing.T) {
+	_, out := exportTestProfile(t)
+	b, err := os.ReadFile(out)
+	require.NoError(t, err)
+	dir := t.TempDir()
+
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+	_, err = ReadProfile(write("truncated.json", string(b[:len(b)/2])))
+	require.ErrorContains(t, err, "not a valid profile")
+
+	_, err = ReadProfile(write("edited.json", strings.Replace(string(b), `"1MiB"`, `"9MiB"`, 1)))
+	require.ErrorContains(t, err, "checksum mismatch")
+
+	_, err = ReadProfile(write("future.json", strings.Replace(string(b), `"schema": 1`, `"schema": 99`, 1)))
+	require.ErrorContains(t, err, "unsupported profile schema 99")
+
+	p, err := ReadProfile(out)
+	require.NoError(t, err)
+	other, err := NewProfile("db", &Config{Protocol: protoHTTP})
+	require.NoError(t, err)
+	p.Signature = nil
+	require.NoError(t, other.Sign(mustTestKey(t)))
+	p.Signature = other.Signature
+	require.ErrorContains(t, p.Verify(), "signature does not match")
+}
+
+func TestProfile_ImportReproducesSetup(t *testing.T) {
+	orig, out := exportTestProfile(t)
+	p, err := ReadProfile(out)
+	require.NoError(t, err)
+
+	// The colleague's machine: another config dir and the referenced env vars.
+	t.Setenv(envConfigPath, filepath.Join(t.TempDir(), "fortunnels.yml"))
+	t.Setenv("FORTUNNELS_TOKEN", profileTestToken)
+	path, err := ProfilePath(p.Name)
+	require.NoError(t, err)
+	require.NoError(t, WriteProfile(path, p))
+
+	cfg, err := testParseWithArgs(t, []string{"client", "--profile", "db"})
+	require.NoError(t, err)
+	assert.Equal(t, orig.RuntimeSettings(), cfg.RuntimeSettings())
+	assert.Equal(t, orig.EncryptionSettings(), cfg.EncryptionSettings())
+	assert.Equal(t, orig.Token, cfg.Token)
+	assert.Equal(t, orig.Protocol, cfg.Protocol)
+	assert.Equal(t, orig.TargetAddr, cfg.TargetAddr)
+	assert.Equal(t, orig.LocalTargets, cfg.LocalTargets)
+	assert.Equal(t, orig.RateLimit, cfg.RateLimit)
+	assert.Equal(t, orig.ServerURL, cfg.ServerURL)
+
+	cfg, err = testParseWithArgs(t, []string{"client", "--profile", "db", "--rate-limit", "2MiB", "6000"})
+	require.NoError(t, err)
+	assert.Equal(t, "2MiB", cfg.RateLimit, "flags override the profile")
+	assert.Equal(t, "tcp", cfg.Protocol, "a bare port keeps the profile's protocol")
+	assert.Equal(t, "127.0.0.1:6000", cfg.TargetAddr)
+
+	_, err = testParseWithArgs(t, []string{"client", "--profile", "missing"})
+	require.ErrorContains(t, err, "load --profile")
+}
+
+func mustTestKey(t *testing.T) []byte {
+	t.Helper()
+	t.Setenv(envConfigPath, filepath.Join(t.TempDir(), "fortunnels.yml"))
+	key, err := ProfileSigningKey()
+	require.NoError(t, err)
+	return key
+}
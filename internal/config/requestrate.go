@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package config
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var requestRateUnits = map[string]time.Duration{
+	"s": time.Second, "sec": time.Second, "second": time.Second,
+	"m": time.Minute, "min": time.Minute, "minute": time.Minute,
+	"h": time.Hour, "hour": time.Hour,
+}
+
+// ParseRequestRate parses a --rate-limit-source value: a request count per
+// window, "60/minute" (also /min, /m, /second, /s, /hour, /h). A plain
+// number is per minute. Empty and "0" mean unlimited (0, 0).
+func ParseRequestRate(value string) (limit int, window time.Duration, err error) {
+	v := strings.ToLower(strings.TrimSpace(value))
+	if v == "" || v == "0" || v == "off" {
+		return 0, 0, nil
+	}
+	count, unit, found := strings.Cut(v, "/")
+	window = time.Minute
+	if found {
+		w, ok := requestRateUnits[strings.TrimSpace(unit)]
+		if !ok {
+			return 0, 0, fmt.Errorf("invalid request rate %q: unknown unit %q (second, minute or hour)", value, unit)
+		}
+		window = w
+	}
+	limit, err = strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || limit <= 0 {
+		return 0, 0, fmt.Errorf("invalid request rate %q: expected a positive count such as 60/minute", value)
+	}
+	return limit, window, nil
+}
+
+// ParseCIDRList parses a comma-separated list of CIDRs; a bare IP is a
+// single address.
+func ParseCIDRList(value string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if p, err := netip.ParsePrefix(item); err == nil {
+			out = append(out, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", item)
+		}
+		out = append(out, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return out, nil
+}
@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/fortunnels/client/internal/support"
+)
+
+// NormalizeServerURL returns the canonical form of a --server value, the one
+// every control-plane and data-plane URL is resolved against: scheme://host
+// with https when the value has no scheme, a lowercase scheme and host and
+// no default port. The API lives at the server root, so a path is dropped;
+// so is userinfo, which would otherwise reach log lines. warnings says what
+// was dropped.
+func NormalizeServerURL(raw string) (normalized string, warnings []string, err error) {
+	s := strings.TrimSpace(raw)
+	if s == "" {
+		return "", nil, errors.New("empty server URL\n   Example: --server https://fortunnels.ru")
+	}
+	if !strings.Contains(s, "://") {
+		s = "https://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return "", nil, errors.New("invalid server URL\n   Try: --server http://127.0.0.1:8080")
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return "", nil, fmt.Errorf("unsupported scheme %q in --server (use http:// or https://)\n   Example: --server https://fortunnels.ru", u.Scheme)
+	}
+	if u.RawQuery != "" || u.ForceQuery || u.Fragment != "" {
+		return "", nil, errors.New("--server must not have a query or fragment\n   Example: --server https://fortunnels.ru")
+	}
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if host == "" {
+		return "", nil, errors.New("invalid server URL: missing host\n   Try: --server http://127.0.0.1:8080")
+	}
+	if port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", nil, fmt.Errorf("invalid port %q in --server: use 1-65535", port)
+		}
+	}
+	if (scheme == "https" && port == "443") || (scheme == "http" && port == "80") {
+		port = ""
+	}
+	if u.User != nil {
+		warnings = append(warnings, "--server contained credentials; they were removed and are not sent (use --login/--pass or --token)")
+	}
+	if p := strings.TrimRight(u.EscapedPath(), "/"); p != "" {
+		warnings = append(warnings, fmt.Sprintf("--server path %s is ignored; the API is served from the server root", p))
+	}
+	canonical := url.URL{Scheme: scheme, Host: host}
+	if port != "" {
+		canonical.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		canonical.Host = "[" + host + "]"
+	}
+	return canonical.String(), warnings, nil
+}
+
+// normalizeServerURL stores the canonical --server in cfg. A value that does
+// not parse is left for Validate to report.
+func normalizeServerURL(cfg *Config) {
+	normalized, warnings, err := NormalizeServerURL(cfg.ServerURL)
+	if err != nil {
+		return
+	}
+	for _, w := range warnings {
+		cfg.Reporter().UserMessage(support.LevelWarn, "⚠️  %s\n", w)
+	}
+	cfg.ServerURL = normalized
+}
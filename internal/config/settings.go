@@ -0,0 +1,133 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package config
+
+import (
+	"flag"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fortunnels/client/internal/support"
+)
+
+const envServerURL = "FORTUNNELS_SERVER_URL"
+
+// envNoPositional turns on --no-positional for every run in the environment.
+const envNoPositional = "FORTUNNELS_NO_POSITIONAL"
+
+// Setting is one resolved option with where it came from, as client
+// diagnose reports it. Source is "default", "flag", "positional",
+// "profile <name>", "config <path>", "config authtoken", "env <VAR>",
+// "file <path>" or "stdin".
+type Setting struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+func (c *Config) setSource(name, source string) {
+	if c.sources == nil {
+		c.sources = map[string]string{}
+	}
+	c.sources[name] = source
+}
+
+// IsSet reports whether the option name was given explicitly (flag,
+// positional argument, profile, config file or environment) rather than left
+// at its default.
+func (c *Config) IsSet(name string) bool {
+	return c.sources[name] != "" || flagProvided(name)
+}
+
+// Settings lists every flag of the parsed configuration with its resolved
+// value and source, sorted by name. Secret values are replaced with
+// support.Redacted; only their source is reported.
+func (c *Config) Settings() []Setting {
+	secrets := map[string]secretSource{}
+	for _, s := range secretSources(c) {
+		secrets[s.label] = s
+	}
+	resolved := c.resolvedValues()
+	var out []Setting
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		s := Setting{Name: f.Name, Value: f.Value.String(), Source: "default"}
+		if v, ok := resolved[f.Name]; ok {
+			s.Value = v
+		}
+		if src, ok := secrets[f.Name]; ok {
+			s.Value, s.Source = secretSetting(src, c.sources[f.Name])
+			out = append(out, s)
+			return
+		}
+		switch {
+		case c.sources[f.Name] != "":
+			s.Source = c.sources[f.Name]
+		case flagProvided(f.Name) || s.Value != f.DefValue:
+			s.Source = "flag"
+		}
+		out = append(out, s)
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// resolvedValues are the settings Parse resolves beyond their flag: from
+// positional arguments, the config file or the environment.
+func (c *Config) resolvedValues() map[string]string {
+	local := c.TargetAddr
+	if len(c.LocalTargets) > 1 {
+		local = strings.Join(c.LocalTargets, ",")
+	}
+	return map[string]string{
+		"server":             c.ServerURL,
+		"protocol":           c.Protocol,
+		"local":              local,
+		"rate-limit":         c.RateLimit,
+		"allow-incoming-dst": c.AllowIncomingDst,
+		"inspect-decode":     strconv.FormatBool(c.InspectDecode),
+		"inspect-body-bytes": strconv.Itoa(c.InspectBodyBytes),
+		"http-peek-bytes":    strconv.Itoa(c.HTTPPeekBytes),
+		"quic-port":          strconv.Itoa(c.QUICPort),
+		"dtls-port":          strconv.Itoa(c.DTLSPort),
+	}
+}
+
+// secretSetting reports a secret as Redacted plus its source, in the order
+// applySecretSource reads them.
+func secretSetting(s secretSource, recorded string) (value, source string) {
+	if *s.value == "" {
+		return "", "default"
+	}
+	switch {
+	case s.provided:
+		source = "flag"
+	case recorded != "":
+		source = recorded
+	case *s.file != "":
+		source = "file " + *s.file
+	case *s.fromStdin:
+		source = "stdin"
+	default:
+		source = "env " + s.envVar
+	}
+	return support.Redacted, source
+}
+
+// SecretValues returns the secrets cfg holds, for a support.Redactor.
+func (c *Config) SecretValues() []string {
+	var out []string
+	for _, s := range secretSources(c) {
+		if *s.value != "" {
+			out = append(out, *s.value)
+		}
+	}
+	if u, err := url.Parse(strings.TrimSpace(c.BackendProxy)); err == nil && u.User != nil {
+		if pass, ok := u.User.Password(); ok && pass != "" {
+			out = append(out, pass)
+		}
+	}
+	return out
+}
@@ -5,13 +5,19 @@ package config
 
 import (
 	"fmt"
+	"math"
 	"net"
+	"net/http"
 	"net/url"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 
+	"github.com/fortunnels/client/internal/security"
 	"github.com/fortunnels/client/internal/support"
+	"github.com/fortunnels/client/internal/telemetry"
 )
 
 // Validate ensures CLI configuration is consistent.
@@ -19,22 +25,719 @@ func Validate(cfg *Config) error {
 	if err := validateProtocolFlag(cfg.Protocol); err != nil {
 		return err
 	}
-	if err := validateServerURLFlag(cfg.ServerURL, cfg.ServerFlagProvided, cfg.AllowInsecureHTTP); err != nil {
+	if err := validateServerURLFlag(cfg.ServerURL, cfg.AllowInsecureHTTP); err != nil {
 		return err
 	}
 	if err := validateTargetAddressIfNeeded(cfg); err != nil {
 		return err
 	}
+	if err := validateLocalBalance(cfg.LocalBalance); err != nil {
+		return err
+	}
+	if err := validateDataPlane(cfg.DataPlane); err != nil {
+		return err
+	}
+	if err := validateUDPAddresses(cfg); err != nil {
+		return err
+	}
+	if err := validateTCPListen(cfg); err != nil {
+		return err
+	}
+	if err := validateAllowIncomingDst(cfg.AllowIncomingDst); err != nil {
+		return err
+	}
+	if err := validateTunnelID(cfg.TunnelID); err != nil {
+		return err
+	}
+	if cfg.CreateRetries < 0 {
+		return fmt.Errorf("invalid --create-retries %d: must not be negative\n   Example: --create-retries 3", cfg.CreateRetries)
+	}
+	if err := validateControlPolicy(cfg); err != nil {
+		return err
+	}
+	if err := validateForwardingLoops([]*Config{cfg}); err != nil {
+		return err
+	}
+	if _, err := support.NewBackendDialer(cfg.BackendProxy); err != nil {
+		return fmt.Errorf("invalid --backend-proxy: %v\n   Example: --backend-proxy http://proxy.internal:3128", err)
+	}
 	if err := enforceEncryptionRequirements(cfg); err != nil {
 		return err
 	}
 	if err := validateLoginPasswordPair(cfg); err != nil {
 		return err
 	}
+	if err := validateOTelEndpoint(cfg.OTelEndpoint); err != nil {
+		return err
+	}
+	if err := validateOutput(cfg.Output); err != nil {
+		return err
+	}
+	if err := validateWaitDNS(cfg); err != nil {
+		return err
+	}
+	if err := validateInspect(cfg); err != nil {
+		return err
+	}
+	if err := validateReload(cfg); err != nil {
+		return err
+	}
+	if err := validateBackendPool(cfg); err != nil {
+		return err
+	}
+	if err := validateResumeGET(cfg); err != nil {
+		return err
+	}
+	if err := validateFallbackPage(cfg); err != nil {
+		return err
+	}
+	if err := validateLocalMirror(cfg); err != nil {
+		return err
+	}
+	if err := validateQueueRequests(cfg); err != nil {
+		return err
+	}
+	if err := validateOpen(cfg); err != nil {
+		return err
+	}
+	if err := validateExportEnv(cfg); err != nil {
+		return err
+	}
+	if err := validateBackendFirstByte(cfg); err != nil {
+		return err
+	}
+	if err := validateSmuxReceiveBuffer(cfg.SmuxMaxReceiveBuffer); err != nil {
+		return err
+	}
+	if err := validateStreamBudget(cfg); err != nil {
+		return err
+	}
+	if err := validateRawPath(cfg); err != nil {
+		return err
+	}
+	if err := validateRateLimitSource(cfg); err != nil {
+		return err
+	}
+	if err := validateClassify(cfg); err != nil {
+		return err
+	}
+	if err := validateByteLimits(cfg); err != nil {
+		return err
+	}
+	if cfg.Redundant && !cfg.ProxyCommand {
+		return fmt.Errorf("--redundant is only supported with --proxy-command\n   Example: ProxyCommand client tcp --dst %%h:%%p --proxy-command --redundant")
+	}
+	if err := validateHostRewrite(cfg); err != nil {
+		return err
+	}
+	if cfg.TransportProbeInterval < 0 {
+		return fmt.Errorf("invalid --dp-probe-interval %s: must not be negative (0 disables switching)\n   Example: --dp-probe-interval 30s", cfg.TransportProbeInterval)
+	}
+	if cfg.PingLossThreshold < 0 {
+		return fmt.Errorf("invalid --ping-loss-threshold %d: must not be negative (0 disables the check)\n   Example: --ping-loss-threshold 2", cfg.PingLossThreshold)
+	}
+	if cfg.StreamLatencyWarn < 0 {
+		return fmt.Errorf("invalid --stream-latency-warn %s: must not be negative (0 disables the warning)\n   Example: --stream-latency-warn 5s", cfg.StreamLatencyWarn)
+	}
+	if cfg.StreamLatencyWarn > 0 && cfg.StreamLatencyWindow <= 0 {
+		return fmt.Errorf("invalid --stream-latency-window %s: must be positive\n   Example: --stream-latency-window 1m", cfg.StreamLatencyWindow)
+	}
+	if cfg.ReadyTimeout < 0 {
+		return fmt.Errorf("invalid --ready-timeout %s: must not be negative (0 prints the public URL right away)\n   Example: --ready-timeout 30s", cfg.ReadyTimeout)
+	}
+	if cfg.StatsFile != "" && cfg.StatsFlush <= 0 {
+		return fmt.Errorf("invalid --stats-flush %s: must be positive\n   Example: --stats-flush 1m", cfg.StatsFlush)
+	}
 	warnOnSensitiveFlagUsage(cfg)
 	return nil
 }
 
+// validateTCPListen checks the TCP listen-mode flags (--listen, --dst, --dst-command).
+func validateTCPListen(cfg *Config) error {
+	if strings.TrimSpace(cfg.ListenAddr) == "" {
+		if strings.TrimSpace(cfg.DstCommand) != "" {
+			return fmt.Errorf("--dst-command requires --listen\n   Example: --listen :4000 --dst localhost:3333 --dst-command ./route.sh")
+		}
+		if strings.TrimSpace(cfg.SNIRoute) != "" || strings.TrimSpace(cfg.SNIDefault) != "" {
+			return fmt.Errorf("--sni-route requires --listen\n   Example: --listen :443 --dst 127.0.0.1:8443 --sni-route api.example.com=127.0.0.1:8443")
+		}
+		if cfg.ProxyCommand {
+			return validateProxyCommand(cfg)
+		}
+		if strings.TrimSpace(cfg.Dst) != "" {
+			return fmt.Errorf("--dst is only used in TCP listen or proxy-command mode\n" +
+				"   Expose a local service:    --protocol tcp --local 127.0.0.1:5432\n" +
+				"   Reach a server-side port: --protocol tcp --listen :4000 --dst localhost:3333")
+		}
+		return nil
+	}
+	if cfg.ProxyCommand {
+		return fmt.Errorf("--proxy-command cannot be combined with --listen")
+	}
+	// An http/https tunnel with --listen also reaches its backend as raw TCP;
+	// --dst then defaults to the tunnel target.
+	hybrid := cfg.Protocol == protoHTTP || cfg.Protocol == protoHTTPS
+	if !strings.EqualFold(cfg.Protocol, protoTCP) && !hybrid {
+		return fmt.Errorf("--listen is only supported with --protocol tcp, or with http/https for raw TCP access to the backend\n   Example: --protocol tcp --listen :4000 --dst localhost:3333")
+	}
+	if _, _, err := net.SplitHostPort(cfg.ListenAddr); err != nil && cfg.ListenAddr != support.ListenAuto {
+		return fmt.Errorf("invalid --listen %q: %v\n   Example: --listen :4000, or --listen auto for a free port", cfg.ListenAddr, err)
+	}
+	if err := validateSNIRoute(cfg); err != nil {
+		return err
+	}
+	// --sni-default stands in for --dst when given.
+	if (!hybrid || strings.TrimSpace(cfg.Dst) != "") && (cfg.SNIRoute == "" || strings.TrimSpace(cfg.SNIDefault) == "") {
+		if _, _, err := net.SplitHostPort(cfg.Dst); err != nil {
+			return fmt.Errorf("--listen requires a server-side --dst host:port\n   Example: --listen :4000 --dst localhost:3333")
+		}
+	}
+	if cmd := strings.TrimSpace(cfg.DstCommand); cmd != "" {
+		// The DTLS preface names one dst for every connection.
+		if strings.EqualFold(cfg.DataPlane, "dtls") && !hybrid {
+			return fmt.Errorf("--dst-command is not supported with --dp dtls\n   Example: --dp dtls --listen :4000 --dst localhost:3333")
+		}
+		if _, err := exec.LookPath(cmd); err != nil {
+			return fmt.Errorf("invalid --dst-command: %v", err)
+		}
+	}
+	if cfg.DstCommandTimeout < 0 {
+		return fmt.Errorf("invalid --dst-command-timeout %s", cfg.DstCommandTimeout)
+	}
+	if cfg.DstCommandMaxProcs < 0 {
+		return fmt.Errorf("invalid --dst-command-max-procs %d\n   Example: --dst-command-max-procs 8", cfg.DstCommandMaxProcs)
+	}
+	for _, name := range cfg.DstCommandEnvList() {
+		if strings.ContainsAny(name, "= ") {
+			return fmt.Errorf("invalid --dst-command-env %q: expected variable names\n   Example: --dst-command-env HTTP_PROXY,ROUTES_FILE", name)
+		}
+	}
+	return nil
+}
+
+// validateSNIRoute checks --sni-route and --sni-default of a listen-mode
+// tunnel.
+func validateSNIRoute(cfg *Config) error {
+	if strings.TrimSpace(cfg.SNIRoute) == "" {
+		if strings.TrimSpace(cfg.SNIDefault) != "" {
+			return fmt.Errorf("--sni-default requires --sni-route\n   Example: --listen :443 --sni-route api.example.com=127.0.0.1:8443 --sni-default 127.0.0.1:8443")
+		}
+		return nil
+	}
+	if _, err := parseSNIRoutes(cfg.SNIRoute); err != nil {
+		return fmt.Errorf("invalid --sni-route: %v\n   Example: --sni-route api.example.com=127.0.0.1:8443,grafana.example.com=127.0.0.1:3000", err)
+	}
+	if d := strings.TrimSpace(cfg.SNIDefault); d != "" {
+		if _, _, err := net.SplitHostPort(d); err != nil {
+			return fmt.Errorf("invalid --sni-default %q: %v\n   Example: --sni-default 127.0.0.1:8443", d, err)
+		}
+	}
+	if strings.TrimSpace(cfg.DstCommand) != "" {
+		return fmt.Errorf("--sni-route cannot be combined with --dst-command: both pick the destination of each connection")
+	}
+	// The DTLS preface names one dst for every connection.
+	if strings.EqualFold(cfg.DataPlane, "dtls") && cfg.Protocol == protoTCP {
+		return fmt.Errorf("--sni-route is not supported with --dp dtls\n   Example: --listen :443 --sni-route api.example.com=127.0.0.1:8443")
+	}
+	return nil
+}
+
+// validateForwardingLoops rejects tunnels of one process where a backend the
+// client dials is one of its own local listen addresses: every connection
+// would come straight back in and be forwarded again.
+func validateForwardingLoops(cfgs []*Config) error {
+	for _, dialer := range cfgs {
+		for _, target := range dialer.localDialTargets() {
+			for _, listener := range cfgs {
+				for _, ln := range listener.localListenAddrs() {
+					if addrReachesListener(target.addr, ln.addr) {
+						return fmt.Errorf("forwarding loop: %s %s is this client's own %s %s\n"+
+							"   Point %s at the real backend, or listen on another port", target.flag, target.addr, ln.flag, ln.addr, target.flag)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// flagAddr is an address together with the flag it came from.
+type flagAddr struct{ flag, addr string }
+
+// localListenAddrs returns the local sockets the tunnel listens on.
+func (c *Config) localListenAddrs() []flagAddr {
+	var out []flagAddr
+	if strings.TrimSpace(c.ListenAddr) != "" {
+		out = append(out, flagAddr{"--listen", strings.TrimSpace(c.ListenAddr)})
+	}
+	return out
+}
+
+// localDialTargets returns the local backends incoming streams dial. Listen
+// and proxy-command mode serve no incoming streams.
+func (c *Config) localDialTargets() []flagAddr {
+	switch {
+	case c.Protocol == protoHTTP || c.Protocol == protoHTTPS:
+	case c.Protocol == protoTCP && strings.TrimSpace(c.ListenAddr) == "" && !c.ProxyCommand:
+	default:
+		return nil
+	}
+	var out []flagAddr
+	targets := c.LocalTargets
+	if len(targets) == 0 && strings.TrimSpace(c.TargetAddr) != "" {
+		targets = []string{strings.TrimSpace(c.TargetAddr)}
+	}
+	for _, t := range targets {
+		out = append(out, flagAddr{"--local", t})
+	}
+	if c.RawDst != "" {
+		out = append(out, flagAddr{"--raw-dst", c.RawDst})
+	}
+	for _, d := range strings.Split(c.AllowIncomingDst, ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			out = append(out, flagAddr{"--allow-incoming-dst", d})
+		}
+	}
+	return out
+}
+
+// addrReachesListener reports whether dialing target connects to a socket
+// listening on listen. A wildcard listener (":4000", "0.0.0.0:4000",
+// "[::]:4000") accepts loopback dials; "localhost" means any loopback address.
+func addrReachesListener(target, listen string) bool {
+	th, tp, err := net.SplitHostPort(target)
+	if err != nil {
+		return false
+	}
+	lh, lp, err := net.SplitHostPort(listen)
+	if err != nil {
+		return false
+	}
+	tport, err1 := strconv.Atoi(tp)
+	lport, err2 := strconv.Atoi(lp)
+	if err1 != nil || err2 != nil || tport != lport {
+		return false
+	}
+	if strings.EqualFold(th, lh) {
+		return true
+	}
+	// Dialing a wildcard address reaches the local host too.
+	targetLocal := th == "" || isUnspecifiedHost(th) || isLoopbackHost(th)
+	switch {
+	case lh == "" || isUnspecifiedHost(lh):
+		return targetLocal
+	case strings.EqualFold(lh, "localhost"):
+		return targetLocal
+	case strings.EqualFold(th, "localhost") || th == "" || isUnspecifiedHost(th):
+		return isLoopbackHost(lh)
+	}
+	tip, lip := net.ParseIP(th), net.ParseIP(lh)
+	return tip != nil && lip != nil && tip.Equal(lip)
+}
+
+func isUnspecifiedHost(h string) bool {
+	ip := net.ParseIP(h)
+	return ip != nil && ip.IsUnspecified()
+}
+
+// validateTunnelID checks that --tunnel-id, when set, is a plain ID: it is
+// sent in query strings and data-plane prefaces as is.
+func validateTunnelID(id string) error {
+	if id == "" {
+		return nil
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return fmt.Errorf("invalid --tunnel-id %q: only letters, digits, '-' and '_' are allowed\n   Example: --tunnel-id 3f2b9c1e-7a4d-4e0f-9b8a-1c2d3e4f5a6b", id)
+		}
+	}
+	return nil
+}
+
+// validateAllowIncomingDst checks that every --allow-incoming-dst entry is host:port.
+func validateAllowIncomingDst(list string) error {
+	for _, d := range strings.Split(list, ",") {
+		d = strings.TrimSpace(d)
+		if d == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(d); err != nil {
+			return fmt.Errorf("invalid --allow-incoming-dst %q: %v\n   Example: --allow-incoming-dst 127.0.0.1:8081,localhost:9000", d, err)
+		}
+	}
+	return nil
+}
+
+// validateProxyCommand checks --proxy-command, which needs a TCP --dst (e.g. ssh's %h:%p).
+func validateProxyCommand(cfg *Config) error {
+	if !strings.EqualFold(cfg.Protocol, protoTCP) {
+		return fmt.Errorf("--proxy-command is only supported with --protocol tcp\n   Example: ProxyCommand client tcp --dst %%h:%%p --proxy-command")
+	}
+	if _, _, err := net.SplitHostPort(cfg.Dst); err != nil {
+		return fmt.Errorf("--proxy-command requires a server-side --dst host:port\n   Example: ProxyCommand client tcp --dst %%h:%%p --proxy-command")
+	}
+	return nil
+}
+
+// validateLocalBalance checks --local-balance.
+func validateLocalBalance(balance string) error {
+	switch strings.ToLower(strings.TrimSpace(balance)) {
+	case "", localBalanceFailover, localBalanceRoundRobin:
+		return nil
+	}
+	return fmt.Errorf("invalid --local-balance %q: use failover or roundrobin", balance)
+}
+
+// validateDataPlane checks --dp.
+func validateDataPlane(dp string) error {
+	switch strings.ToLower(strings.TrimSpace(dp)) {
+	case "", DataPlaneWS, DataPlaneQUIC, DataPlaneDTLS, DataPlaneAuto:
+		return nil
+	}
+	return fmt.Errorf("invalid --dp %q: use ws, quic, dtls or auto", dp)
+}
+
+// validateOutput checks --output.
+func validateOutput(output string) error {
+	switch strings.ToLower(strings.TrimSpace(output)) {
+	case "", outputText, outputJSON:
+		return nil
+	}
+	return fmt.Errorf("invalid --output %q: use text or json", output)
+}
+
+// validateWaitDNS checks --wait-dns-timeout and --dns-server.
+func validateWaitDNS(cfg *Config) error {
+	if cfg.WaitDNS && cfg.WaitDNSTimeout <= 0 {
+		return fmt.Errorf("invalid --wait-dns-timeout %s: must be positive (use --wait-dns=false to skip the wait)\n   Example: --wait-dns-timeout 90s", cfg.WaitDNSTimeout)
+	}
+	server := strings.TrimSpace(cfg.DNSServer)
+	if server == "" {
+		return nil
+	}
+	host, port := server, "53"
+	if h, p, err := net.SplitHostPort(server); err == nil {
+		host, port = h, p
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 || strings.Trim(host, "[]") == "" || strings.ContainsAny(host, "/ ") {
+		return fmt.Errorf("invalid --dns-server %q: expected host or host:port\n   Example: --dns-server 1.1.1.1", cfg.DNSServer)
+	}
+	return nil
+}
+
+// validateSmuxReceiveBuffer checks --smux-max-receive-buffer: smux needs
+// room for at least one stream window, and the value must fit an int32.
+func validateSmuxReceiveBuffer(value string) error {
+	n, err := ParseByteRate(value)
+	if err == nil && n != 0 && (n < smuxMinReceiveBuffer || n > smuxMaxReceiveBuffer) {
+		err = fmt.Errorf("must be between 64KiB and 1GiB")
+	}
+	if err != nil {
+		return fmt.Errorf("invalid --smux-max-receive-buffer: %v\n   Example: --smux-max-receive-buffer 16MiB", err)
+	}
+	return nil
+}
+
+// validateStreamBudget checks --max-streams, --per-listener-rate and
+// --listen-priority.
+func validateStreamBudget(cfg *Config) error {
+	if cfg.MaxStreams < 0 {
+		return fmt.Errorf("invalid --max-streams %d: must be 0 (unlimited) or positive\n   Example: --max-streams 64", cfg.MaxStreams)
+	}
+	if cfg.PerListenerRate < 0 || math.IsNaN(cfg.PerListenerRate) || math.IsInf(cfg.PerListenerRate, 0) {
+		return fmt.Errorf("invalid --per-listener-rate %v: must be 0 (unlimited) or a positive number of streams per second\n   Example: --per-listener-rate 20", cfg.PerListenerRate)
+	}
+	switch cfg.ListenPriority {
+	case "", ListenPriorityAuto, ListenPriorityInteractive, ListenPriorityBulk:
+	default:
+		return fmt.Errorf("invalid --listen-priority %q: use auto, interactive or bulk\n   Example: --listen-priority bulk", cfg.ListenPriority)
+	}
+	return nil
+}
+
+// validateBackendPool checks --backend-pool-size and --backend-pool-idle.
+// Connections are only reused at HTTP request boundaries, so the pool needs
+// an http or https tunnel.
+func validateBackendPool(cfg *Config) error {
+	if cfg.BackendPoolSize < 0 {
+		return fmt.Errorf("invalid --backend-pool-size %d: must be 0 or positive\n   Example: --backend-pool-size 8", cfg.BackendPoolSize)
+	}
+	if cfg.BackendPoolSize == 0 {
+		return nil
+	}
+	if cfg.BackendPoolIdle <= 0 {
+		return fmt.Errorf("invalid --backend-pool-idle %s: must be positive\n   Example: --backend-pool-idle 90s", cfg.BackendPoolIdle)
+	}
+	if cfg.Protocol != protoHTTP && cfg.Protocol != protoHTTPS {
+		return fmt.Errorf("--backend-pool-size requires an http or https tunnel: raw %s streams have no request boundary to reuse a connection at", cfg.Protocol)
+	}
+	return nil
+}
+
+// validateResumeGET checks --resume-get.
+func validateResumeGET(cfg *Config) error {
+	if !cfg.ResumeGET {
+		return nil
+	}
+	if cfg.Protocol != protoHTTP && cfg.Protocol != protoHTTPS {
+		return fmt.Errorf("--resume-get requires an http or https tunnel: raw %s streams carry no request to repeat", cfg.Protocol)
+	}
+	if cfg.BackendPoolSize > 0 {
+		return fmt.Errorf("--resume-get cannot be combined with --backend-pool-size: a pooled stream forwards several requests\n   Example: drop --backend-pool-size")
+	}
+	return nil
+}
+
+// validateFallbackPage checks --fallback-page. The page itself is read when
+// the data plane starts.
+func validateFallbackPage(cfg *Config) error {
+	page := strings.TrimSpace(cfg.FallbackPage)
+	if page == "" {
+		return nil
+	}
+	if cfg.Protocol != protoHTTP && cfg.Protocol != protoHTTPS {
+		return fmt.Errorf("--fallback-page requires an http or https tunnel: raw %s streams cannot carry a page", cfg.Protocol)
+	}
+	if page == FallbackPageBuiltin {
+		return nil
+	}
+	info, err := os.Stat(page)
+	if err != nil {
+		return fmt.Errorf("invalid --fallback-page: %v\n   Example: --fallback-page ./maintenance.html, or --fallback-page builtin", err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("invalid --fallback-page %s: not a regular file\n   Example: --fallback-page ./maintenance.html, or --fallback-page builtin", page)
+	}
+	return nil
+}
+
+// validateLocalMirror checks --local-mirror.
+func validateLocalMirror(cfg *Config) error {
+	if cfg.LocalMirror == "" {
+		return nil
+	}
+	if cfg.Protocol != protoHTTP && cfg.Protocol != protoHTTPS {
+		return fmt.Errorf("--local-mirror requires an http or https tunnel: raw %s streams get none of the request handling it mirrors", cfg.Protocol)
+	}
+	if _, _, err := net.SplitHostPort(cfg.LocalMirror); err != nil {
+		return fmt.Errorf("invalid --local-mirror %q: %v\n   Example: --local-mirror :8080, or --local-mirror 192.168.1.20:8080", cfg.LocalMirror, err)
+	}
+	return nil
+}
+
+// validateOpen checks --open.
+func validateOpen(cfg *Config) error {
+	if cfg.Open && cfg.Protocol != protoHTTP && cfg.Protocol != protoHTTPS {
+		return fmt.Errorf("--open requires an http or https tunnel: a browser cannot open the %s tunnel's public URL", cfg.Protocol)
+	}
+	return nil
+}
+
+// validateExportEnv checks --export-env and --export-format.
+func validateExportEnv(cfg *Config) error {
+	switch cfg.ExportFileFormat() {
+	case exportDotenv, exportJSON:
+	default:
+		return fmt.Errorf("invalid --export-format %q: use dotenv or json\n   Example: --export-env .env.tunnel --export-format dotenv", cfg.ExportFormat)
+	}
+	if cfg.ExportEnv == "" {
+		return nil
+	}
+	if info, err := os.Stat(cfg.ExportEnv); err == nil && info.IsDir() {
+		return fmt.Errorf("invalid --export-env %s: is a directory\n   Example: --export-env %s", cfg.ExportEnv, filepath.Join(cfg.ExportEnv, ".env.tunnel"))
+	}
+	if info, err := os.Stat(filepath.Dir(cfg.ExportEnv)); err != nil || !info.IsDir() {
+		return fmt.Errorf("invalid --export-env %s: directory %s does not exist\n   Example: --export-env .env.tunnel", cfg.ExportEnv, filepath.Dir(cfg.ExportEnv))
+	}
+	return nil
+}
+
+// validateQueueRequests checks --queue-requests and its bounds.
+func validateQueueRequests(cfg *Config) error {
+	if !cfg.QueueRequests {
+		return nil
+	}
+	if cfg.Protocol != protoHTTP && cfg.Protocol != protoHTTPS {
+		return fmt.Errorf("--queue-requests requires an http or https tunnel: raw %s streams carry no request to replay", cfg.Protocol)
+	}
+	if n, err := ParseByteSize(cfg.QueueMaxBody); err != nil || n <= 0 {
+		return fmt.Errorf("invalid --queue-max-body %q: must be a positive size\n   Example: --queue-max-body 1MiB", cfg.QueueMaxBody)
+	}
+	if cfg.QueueMaxEntries <= 0 {
+		return fmt.Errorf("invalid --queue-max-entries %d: must be positive\n   Example: --queue-max-entries 1000", cfg.QueueMaxEntries)
+	}
+	methods := cfg.queueMethods()
+	if len(methods) == 0 {
+		return fmt.Errorf("--queue-methods lists no method\n   Example: --queue-methods POST,PUT")
+	}
+	for _, m := range methods {
+		switch m {
+		case http.MethodGet, http.MethodHead, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+			return fmt.Errorf("invalid --queue-methods: %s requests expect an answer and cannot be queued\n   Example: --queue-methods POST,PUT", m)
+		}
+	}
+	return nil
+}
+
+// validateBackendFirstByte checks --backend-first-byte-timeout and
+// --backend-timeout-action.
+func validateBackendFirstByte(cfg *Config) error {
+	if cfg.BackendFirstByteTimeout < 0 {
+		return fmt.Errorf("invalid --backend-first-byte-timeout %s\n   Example: --backend-first-byte-timeout 10s", cfg.BackendFirstByteTimeout)
+	}
+	switch action := strings.TrimSpace(cfg.BackendTimeoutAction); strings.ToLower(action) {
+	case "", backendTimeoutLog:
+		return nil
+	case backendTimeoutClose, backendTimeout503:
+		if cfg.BackendFirstByteTimeout == 0 {
+			return fmt.Errorf("--backend-timeout-action %s needs --backend-first-byte-timeout\n   Example: --backend-first-byte-timeout 10s --backend-timeout-action %s", action, action)
+		}
+		if action == backendTimeout503 && cfg.Protocol != protoHTTP && cfg.Protocol != protoHTTPS {
+			return fmt.Errorf("--backend-timeout-action 503 only applies to http/https tunnels\n   Use --backend-timeout-action close for %s", cfg.Protocol)
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid --backend-timeout-action %q: expected log, close or 503", cfg.BackendTimeoutAction)
+	}
+}
+
+// validateRawPath checks that --raw-path and --raw-dst come together, on an
+// http or https tunnel.
+func validateRawPath(cfg *Config) error {
+	if cfg.RawPath == "" && cfg.RawDst == "" {
+		return nil
+	}
+	if cfg.Protocol != protoHTTP && cfg.Protocol != protoHTTPS {
+		return fmt.Errorf("--raw-path and --raw-dst require an http or https tunnel\n   Example: client --raw-path /raw --raw-dst 127.0.0.1:22 http 3000")
+	}
+	if !strings.HasPrefix(cfg.RawPath, "/") {
+		return fmt.Errorf("invalid --raw-path %q: must start with /\n   Example: --raw-path /raw", cfg.RawPath)
+	}
+	if _, _, err := net.SplitHostPort(cfg.RawDst); err != nil {
+		return fmt.Errorf("invalid --raw-dst %q: expected host:port\n   Example: --raw-dst 127.0.0.1:22", cfg.RawDst)
+	}
+	return nil
+}
+
+// validateRateLimitSource checks --rate-limit-source and its
+// --rate-limit-exempt list, which only apply to http/https tunnels.
+func validateRateLimitSource(cfg *Config) error {
+	limit, _, err := ParseRequestRate(cfg.RateLimitSource)
+	if err != nil {
+		return fmt.Errorf("invalid --rate-limit-source: %v\n   Example: --rate-limit-source 60/minute", err)
+	}
+	if _, err := ParseCIDRList(cfg.RateLimitExempt); err != nil {
+		return fmt.Errorf("invalid --rate-limit-exempt: %v\n   Example: --rate-limit-exempt 10.0.0.0/8,203.0.113.7", err)
+	}
+	if limit > 0 && cfg.Protocol != protoHTTP && cfg.Protocol != protoHTTPS {
+		return fmt.Errorf("--rate-limit-source requires an http or https tunnel: it counts HTTP requests\n   Example: client --rate-limit-source 60/minute http 3000")
+	}
+	return nil
+}
+
+// validateClassify checks --classify.
+func validateClassify(cfg *Config) error {
+	classes, err := ParseTrafficClasses(cfg.Classify)
+	if err != nil {
+		return fmt.Errorf("invalid --classify: %v\n   Example: --classify \"api=^/api/,ws=upgrade,html=accept:text/html\"", err)
+	}
+	if classes != nil && cfg.Protocol != protoHTTP && cfg.Protocol != protoHTTPS {
+		return fmt.Errorf("--classify requires an http or https tunnel: it classifies HTTP requests\n   Example: client --classify api=^/api/ http 3000")
+	}
+	return nil
+}
+
+// validateByteLimits checks --max-bytes-per-stream, --max-bytes-total and
+// --memory-budget.
+func validateByteLimits(cfg *Config) error {
+	if _, err := ParseByteSize(cfg.MaxBytesPerStream); err != nil {
+		return fmt.Errorf("invalid --max-bytes-per-stream: %v\n   Example: --max-bytes-per-stream 50MB", err)
+	}
+	if _, err := ParseByteSize(cfg.MaxBytesTotal); err != nil {
+		return fmt.Errorf("invalid --max-bytes-total: %v\n   Example: --max-bytes-total 200MB", err)
+	}
+	if _, err := ParseByteSize(cfg.MemoryBudget); err != nil {
+		return fmt.Errorf("invalid --memory-budget: %v\n   Example: --memory-budget 256MiB", err)
+	}
+	return nil
+}
+
+// validateHostRewrite checks --host-rewrite and --host-rewrite-forwarded,
+// which only apply to http/https tunnels.
+func validateHostRewrite(cfg *Config) error {
+	v := strings.TrimSpace(cfg.HostRewrite)
+	if v == "" {
+		if cfg.HostRewriteForwarded {
+			return fmt.Errorf("--host-rewrite-forwarded requires --host-rewrite\n   Example: --host-rewrite myapp.local --host-rewrite-forwarded")
+		}
+		return nil
+	}
+	if cfg.Protocol != protoHTTP && cfg.Protocol != protoHTTPS {
+		return fmt.Errorf("--host-rewrite requires an http or https tunnel: it edits HTTP requests\n   Example: client --host-rewrite myapp.local http 3000")
+	}
+	host := cfg.hostRewrite()
+	if host == "" {
+		return fmt.Errorf("--host-rewrite %s needs a --local host:port\n   Example: --local myapp.local:8080 --host-rewrite %s", v, HostRewriteTarget)
+	}
+	if !validHostHeader(host) {
+		return fmt.Errorf("invalid --host-rewrite %q: expected a host, optionally with :port\n   Example: --host-rewrite myapp.local", v)
+	}
+	return nil
+}
+
+// validHostHeader reports whether v is a host[:port] usable as a Host header.
+func validHostHeader(v string) bool {
+	if strings.ContainsAny(v, "/@?#%\\\"") {
+		return false
+	}
+	for _, r := range v {
+		if r <= ' ' || r == 0x7f {
+			return false
+		}
+	}
+	if host, port, err := net.SplitHostPort(v); err == nil {
+		return host != "" && support.ParsePort(port) != ""
+	}
+	// Without a port: a name, an IPv4 address or a bracketed IPv6 one.
+	return !strings.Contains(v, ":") || strings.HasPrefix(v, "[") && strings.HasSuffix(v, "]")
+}
+
+// validateInspect checks --inspect-decode and --inspect-body-bytes, which only
+// apply to HTTP tunnels, and their --http-peek-bytes budget.
+func validateInspect(cfg *Config) error {
+	if cfg.InspectBodyBytes < 0 {
+		return fmt.Errorf("invalid --inspect-body-bytes %d: must be 0 or positive\n   Example: --inspect-body-bytes 512", cfg.InspectBodyBytes)
+	}
+	if cfg.HTTPPeekBytes != 0 && cfg.HTTPPeekBytes < minHTTPPeekBytes {
+		return fmt.Errorf("invalid --http-peek-bytes %d: must be at least %d (one copy buffer)\n   Example: --http-peek-bytes 65536", cfg.HTTPPeekBytes, minHTTPPeekBytes)
+	}
+	if (cfg.InspectDecode || cfg.InspectBodyBytes > 0) && cfg.Protocol != protoHTTP && cfg.Protocol != protoHTTPS {
+		return fmt.Errorf("--inspect-decode and --inspect-body-bytes require an http or https tunnel\n   Example: client --inspect-decode --inspect-body-bytes 512 http 3000")
+	}
+	return nil
+}
+
+// validateReload checks --rate-limit and that --reload-file has a --config
+// to reload.
+func validateReload(cfg *Config) error {
+	if _, err := ParseByteRate(cfg.RateLimit); err != nil {
+		return fmt.Errorf("invalid --rate-limit: %v\n   Example: --rate-limit 10MiB", err)
+	}
+	if strings.TrimSpace(cfg.ReloadFile) != "" && strings.TrimSpace(cfg.ConfigPath) == "" {
+		return fmt.Errorf("--reload-file needs --config: it reloads that file\n   Example: --config fortunnels.yml --reload-file fortunnels.yml")
+	}
+	return nil
+}
+
+// validateOTelEndpoint checks --otel-endpoint when tracing is requested.
+func validateOTelEndpoint(endpoint string) error {
+	if strings.TrimSpace(endpoint) == "" {
+		return nil
+	}
+	_, err := telemetry.NormalizeOTLPEndpoint(endpoint)
+	return err
+}
+
 // validateLoginPasswordPair returns an error if --login is provided without a password.
 // Password may come from --pass, --pass-file, --pass-stdin, or FORTUNNELS_PASSWORD.
 func validateLoginPasswordPair(cfg *Config) error {
@@ -59,17 +762,16 @@ func validateProtocolFlag(protocol string) error {
 	}
 }
 
-func validateServerURLFlag(serverURL string, serverFlagProvided, allowInsecureHTTP bool) error {
-	if serverFlagProvided &&
-		!strings.HasPrefix(serverURL, "http://") &&
-		!strings.HasPrefix(serverURL, "https://") {
-		return fmt.Errorf("missing protocol in --server (use http:// or https://)\n   Example: --server http://127.0.0.1:8080")
+func validateServerURLFlag(serverURL string, allowInsecureHTTP bool) error {
+	normalized, _, err := NormalizeServerURL(serverURL)
+	if err != nil {
+		return err
 	}
-	u, err := url.Parse(serverURL)
-	if err != nil || u.Scheme == "" || u.Host == "" {
+	u, err := url.Parse(normalized)
+	if err != nil {
 		return fmt.Errorf("invalid server URL\n   Try: --server http://127.0.0.1:8080")
 	}
-	if strings.EqualFold(u.Scheme, "http") && !allowInsecureHTTP && !isLocalServerHost(u.Host) {
+	if u.Scheme == "http" && !allowInsecureHTTP && !isLocalServerHost(u.Host) {
 		return fmt.Errorf("insecure HTTP server URL is blocked\n   Use https:// or pass --allow-insecure-http for non-local HTTP")
 	}
 	return nil
@@ -79,7 +781,15 @@ func validateTargetAddressIfNeeded(cfg *Config) error {
 	if cfg.Protocol != protoHTTP && cfg.Protocol != protoHTTPS && cfg.Protocol != protoTCP {
 		return nil
 	}
-	return validateTargetAddress(cfg.TargetAddr)
+	if len(cfg.LocalTargets) == 0 {
+		return validateTargetAddress(cfg.TargetAddr)
+	}
+	for _, t := range cfg.LocalTargets {
+		if err := validateTargetAddress(t); err != nil {
+			return fmt.Errorf("--local entry %q: %w", t, err)
+		}
+	}
+	return nil
 }
 
 func validateTargetAddress(addr string) error {
@@ -97,6 +807,90 @@ func validateTargetAddress(addr string) error {
 	return nil
 }
 
+// validateUDPAddresses checks --udp-listen and --udp-dst for UDP tunnels so
+// malformed values are reported before authentication.
+func validateUDPAddresses(cfg *Config) error {
+	if cfg.Protocol != protoUDP {
+		return nil
+	}
+	if strings.TrimSpace(cfg.UDPListen) == "" || strings.TrimSpace(cfg.UDPDst) == "" {
+		return fmt.Errorf("for UDP mode, both --udp-listen and --udp-dst are required\n   Example: --udp-listen :5353 --udp-dst 127.0.0.1:53")
+	}
+	if cfg.UDPQueueSize < 0 {
+		return fmt.Errorf("invalid --udp-queue %d\n   Use a positive number of packets, e.g. --udp-queue 1024", cfg.UDPQueueSize)
+	}
+	if err := validateUDPListen(cfg.UDPListen); err != nil {
+		return err
+	}
+	if err := validateUDPDestination(cfg.UDPDst); err != nil {
+		return err
+	}
+	warnOnPublicUDPListen(cfg)
+	return nil
+}
+
+func validateUDPListen(addr string) error {
+	host, port, err := splitUDPHostPort(addr, "--udp-listen", ":5353")
+	if err != nil {
+		return err
+	}
+	if port == 0 {
+		return fmt.Errorf("invalid --udp-listen port 0\n   Pick a fixed port so clients know where to send, e.g. :5353")
+	}
+	if _, err := net.ResolveUDPAddr("udp", net.JoinHostPort(host, strconv.Itoa(port))); err != nil {
+		return fmt.Errorf("cannot resolve --udp-listen %q\n   Use a local IP or hostname, e.g. 127.0.0.1:5353", addr)
+	}
+	return nil
+}
+
+// validateUDPDestination checks syntax only: the destination is resolved by
+// the server, so its hostname does not have to resolve locally.
+func validateUDPDestination(addr string) error {
+	host, port, err := splitUDPHostPort(addr, "--udp-dst", "127.0.0.1:53")
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		return fmt.Errorf("invalid --udp-dst %q: host is required\n   Example: --udp-dst 127.0.0.1:53", addr)
+	}
+	if port == 0 {
+		return fmt.Errorf("invalid --udp-dst port 0\n   Valid range: 1-65535")
+	}
+	return nil
+}
+
+func splitUDPHostPort(addr, flagName, example string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(strings.TrimSpace(addr))
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid %s %q: expected host:port with an explicit port\n   IPv6 addresses need brackets, e.g. [::1]:53\n   Example: %s %s", flagName, addr, flagName, example)
+	}
+	if strings.Contains(host, ":") && net.ParseIP(host) == nil {
+		return "", 0, fmt.Errorf("invalid %s %q: bad IPv6 address", flagName, addr)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 0 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid %s port %q\n   Valid range: 1-65535", flagName, portStr)
+	}
+	return host, port, nil
+}
+
+// warnOnPublicUDPListen warns when the local UDP socket is reachable from other hosts.
+func warnOnPublicUDPListen(cfg *Config) {
+	host, _, err := net.SplitHostPort(cfg.UDPListen)
+	if err != nil || isLoopbackHost(host) {
+		return
+	}
+	cfg.Reporter().UserMessage(support.LevelWarn, "⚠️  --udp-listen %s accepts packets from other hosts; bind 127.0.0.1 to keep it local\n", cfg.UDPListen)
+}
+
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
 func enforceEncryptionRequirements(cfg *Config) error {
 	if !cfg.Encrypt {
 		return nil
@@ -108,6 +902,16 @@ func enforceEncryptionRequirements(cfg *Config) error {
 	if len(psk) < 32 {
 		return fmt.Errorf("PSK is too short\n   Use at least 32 characters for --psk")
 	}
+	kdf, err := security.ResolveKDF(cfg.PSKKDF, psk)
+	if err != nil {
+		return fmt.Errorf("invalid --psk-kdf: %v\n   Example: --psk-kdf argon2id", err)
+	}
+	if weak, bits := security.WeakPSK(psk); weak {
+		cfg.Reporter().UserMessage(support.LevelWarn, "⚠️  PSK looks weak (about %.0f bits of entropy); use a long random passphrase or key\n", bits)
+		if kdf.Name == security.KDFLegacy {
+			cfg.Reporter().UserMessage(support.LevelWarn, "⚠️  --psk-kdf legacy does not stretch weak PSKs; prefer argon2id when the server supports it\n")
+		}
+	}
 	return nil
 }
 
@@ -148,7 +952,21 @@ func warnOnSensitiveFlagUsage(cfg *Config) {
 	}
 	for _, entry := range entries {
 		if entry.used && strings.TrimSpace(entry.value) != "" {
-			fmt.Fprintf(os.Stderr, "⚠️  %s was provided via CLI and may be visible in process listings\n", entry.label)
+			cfg.Reporter().UserMessage(support.LevelWarn, "⚠️  %s was provided via CLI and may be visible in process listings\n", entry.label)
 		}
 	}
 }
+
+// validateControlPolicy checks the control-plane timeout and retry flags.
+func validateControlPolicy(cfg *Config) error {
+	if cfg.ControlRetries < 0 {
+		return fmt.Errorf("invalid --control-retries %d: must not be negative\n   Example: --control-retries 2", cfg.ControlRetries)
+	}
+	if cfg.ControlTimeout < 0 || cfg.ControlAttemptTimeout < 0 {
+		return fmt.Errorf("invalid --control-timeout %s / --control-attempt-timeout %s: must not be negative", cfg.ControlTimeout, cfg.ControlAttemptTimeout)
+	}
+	if cfg.ControlTimeout > 0 && cfg.ControlAttemptTimeout > cfg.ControlTimeout {
+		return fmt.Errorf("invalid --control-attempt-timeout %s: longer than --control-timeout %s\n   Example: --control-timeout 30s --control-attempt-timeout 10s", cfg.ControlAttemptTimeout, cfg.ControlTimeout)
+	}
+	return nil
+}
@@ -4,8 +4,10 @@
 package config
 
 import (
+	"net/netip"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -69,23 +71,24 @@ func TestEnforceEncryptionRequirements(t *testing.T) {
 
 func TestValidateServerURLFlag(t *testing.T) {
 	tests := []struct {
-		name               string
-		serverURL          string
-		serverFlagProvided bool
-		allowInsecureHTTP  bool
-		wantErr            bool
+		name              string
+		serverURL         string
+		allowInsecureHTTP bool
+		wantErr           bool
 	}{
-		{"default https", "https://example.com", false, false, false},
-		{"local http", "http://127.0.0.1:8080", true, false, false},
-		{"missing protocol", "127.0.0.1:8080", true, false, true},
-		{"invalid url", "http://", true, false, true},
-		{"remote http blocked", "http://example.com", true, false, true},
-		{"remote http allowed", "http://example.com", true, true, false},
+		{"default https", "https://example.com", false, false},
+		{"local http", "http://127.0.0.1:8080", false, false},
+		{"missing protocol means https", "127.0.0.1:8080", false, false},
+		{"invalid url", "http://", false, true},
+		{"remote http blocked", "http://example.com", false, true},
+		{"remote http with userinfo blocked", "http://u:p@example.com/", false, true},
+		{"remote http allowed", "http://example.com", true, false},
+		{"unsupported scheme", "ftp://example.com", false, true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validateServerURLFlag(tt.serverURL, tt.serverFlagProvided, tt.allowInsecureHTTP)
+			err := validateServerURLFlag(tt.serverURL, tt.allowInsecureHTTP)
 			if tt.wantErr {
 				require.Error(t, err)
 			} else {
@@ -216,3 +219,263 @@ func TestValidateLoginRequiresPassword(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateOTelEndpoint(t *testing.T) {
+	require.NoError(t, validateOTelEndpoint(""))
+	require.NoError(t, validateOTelEndpoint("http://localhost:4318"))
+	require.Error(t, validateOTelEndpoint("grpc://localhost:4317"))
+	require.Error(t, validateOTelEndpoint("not a url"))
+}
+
+func TestValidateTunnelID(t *testing.T) {
+	require.NoError(t, validateTunnelID(""))
+	require.NoError(t, validateTunnelID("3f2b9c1e-7a4d_4e0f"))
+	require.Error(t, validateTunnelID("a&id=b"))
+	require.Error(t, validateTunnelID("has space"))
+}
+
+func TestValidate_CreateRetries(t *testing.T) {
+	cfg := &Config{Protocol: protoHTTP, TargetAddr: "127.0.0.1:8000", ServerURL: "http://127.0.0.1:8080", CreateRetries: -1}
+	require.ErrorContains(t, Validate(cfg), "invalid --create-retries -1")
+	cfg.CreateRetries = 3
+	require.NoError(t, Validate(cfg))
+}
+
+func TestValidateUDPAddresses(t *testing.T) {
+	tests := []struct {
+		name    string
+		listen  string
+		dst     string
+		wantErr string
+	}{
+		{"ipv4", "127.0.0.1:5353", "127.0.0.1:53", ""},
+		{"all interfaces", ":5353", "10.0.0.5:53", ""},
+		{"bracketed ipv6", "[::1]:5353", "[2001:db8::1]:53", ""},
+		{"hostname", "localhost:5353", "dns.internal:53", ""},
+		{"missing listen", "", "127.0.0.1:53", "both --udp-listen and --udp-dst are required"},
+		{"missing dst", ":5353", "", "both --udp-listen and --udp-dst are required"},
+		{"dst missing port", ":5353", "127.0.0.1", "explicit port"},
+		{"dst unbracketed ipv6", ":5353", "2001:db8::1:53", "explicit port"},
+		{"dst missing host", ":5353", ":53", "host is required"},
+		{"dst port 0", ":5353", "127.0.0.1:0", "port 0"},
+		{"listen port 0", "127.0.0.1:0", "127.0.0.1:53", "port 0"},
+		{"listen missing port", "127.0.0.1", "127.0.0.1:53", "explicit port"},
+		{"listen port out of range", ":70000", "127.0.0.1:53", "Valid range"},
+		{"listen bad ipv6", "[::zz]:5353", "127.0.0.1:53", "bad IPv6"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Protocol: protoUDP, UDPListen: tt.listen, UDPDst: tt.dst}
+			err := validateUDPAddresses(cfg)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestValidateUDPAddresses_SkipsOtherProtocols(t *testing.T) {
+	require.NoError(t, validateUDPAddresses(&Config{Protocol: protoTCP}))
+}
+
+func TestIsLoopbackHost(t *testing.T) {
+	require.True(t, isLoopbackHost("127.0.0.1"))
+	require.True(t, isLoopbackHost("::1"))
+	require.True(t, isLoopbackHost("localhost"))
+	require.False(t, isLoopbackHost(""))
+	require.False(t, isLoopbackHost("0.0.0.0"))
+	require.False(t, isLoopbackHost("192.168.1.10"))
+}
+
+func TestValidateTCPListen(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{"not used", Config{Protocol: protoHTTP}, ""},
+		{"listen with dst", Config{Protocol: protoTCP, ListenAddr: ":4000", Dst: "localhost:3333"}, ""},
+		{"listen needs tcp or http", Config{Protocol: protoUDP, ListenAddr: ":4000", Dst: "localhost:3333"}, "only supported with --protocol tcp"},
+		{"http with listen", Config{Protocol: protoHTTP, ListenAddr: ":4000"}, ""},
+		{"https with listen and dst", Config{Protocol: protoHTTPS, ListenAddr: ":4000", Dst: "localhost:3333"}, ""},
+		{"http with bad dst", Config{Protocol: protoHTTP, ListenAddr: ":4000", Dst: "3333"}, "requires a server-side --dst"},
+		{"listen needs dst", Config{Protocol: protoTCP, ListenAddr: ":4000"}, "requires a server-side --dst"},
+		{"bad listen", Config{Protocol: protoTCP, ListenAddr: "4000", Dst: "localhost:3333"}, "invalid --listen"},
+		{"expose-local needs no dst", Config{Protocol: protoTCP, TargetAddr: "127.0.0.1:5432"}, ""},
+		{"dst without listen", Config{Protocol: protoTCP, Dst: "localhost:3333"}, "--dst is only used in TCP listen or proxy-command mode"},
+		{"proxy-command", Config{Protocol: protoTCP, Dst: "host:22", ProxyCommand: true}, ""},
+		{"proxy-command needs dst", Config{Protocol: protoTCP, ProxyCommand: true}, "--proxy-command requires a server-side --dst"},
+		{"proxy-command needs tcp", Config{Protocol: protoUDP, Dst: "host:22", ProxyCommand: true}, "only supported with --protocol tcp"},
+		{"proxy-command without listen", Config{Protocol: protoTCP, ListenAddr: ":4000", Dst: "host:22", ProxyCommand: true}, "cannot be combined with --listen"},
+		{"command needs listen", Config{Protocol: protoTCP, DstCommand: "true"}, "--dst-command requires --listen"},
+		{"missing command", Config{Protocol: protoTCP, ListenAddr: ":4000", Dst: "localhost:3333", DstCommand: "/nonexistent/route"}, "invalid --dst-command"},
+		{"listen over dtls", Config{Protocol: protoTCP, DataPlane: "dtls", ListenAddr: ":4000", Dst: "localhost:3333"}, ""},
+		{"negative command max procs", Config{Protocol: protoTCP, ListenAddr: ":4000", Dst: "localhost:3333", DstCommand: "true", DstCommandMaxProcs: -1}, "invalid --dst-command-max-procs"},
+		{"command env with values", Config{Protocol: protoTCP, ListenAddr: ":4000", Dst: "localhost:3333", DstCommand: "true", DstCommandEnv: "HTTP_PROXY=x"}, "invalid --dst-command-env"},
+		{"command over dtls", Config{Protocol: protoTCP, DataPlane: "dtls", ListenAddr: ":4000", Dst: "localhost:3333", DstCommand: "true"}, "not supported with --dp dtls"},
+		{"sni-route", Config{Protocol: protoTCP, ListenAddr: ":443", Dst: "localhost:8443", SNIRoute: "api.example.com=localhost:8443, grafana.example.com=localhost:3000"}, ""},
+		{"sni-default stands in for dst", Config{Protocol: protoTCP, ListenAddr: ":443", SNIRoute: "api.example.com=localhost:8443", SNIDefault: "localhost:8443"}, ""},
+		{"sni-route needs a default", Config{Protocol: protoTCP, ListenAddr: ":443", SNIRoute: "api.example.com=localhost:8443"}, "requires a server-side --dst"},
+		{"sni-route needs listen", Config{Protocol: protoTCP, SNIRoute: "api.example.com=localhost:8443"}, "--sni-route requires --listen"},
+		{"bad sni-route", Config{Protocol: protoTCP, ListenAddr: ":443", Dst: "localhost:8443", SNIRoute: "api.example.com"}, "invalid --sni-route"},
+		{"sni-route twice", Config{Protocol: protoTCP, ListenAddr: ":443", Dst: "localhost:8443", SNIRoute: "a.example=h:1,A.example.=h:2"}, "a.example is routed twice"},
+		{"bad sni-default", Config{Protocol: protoTCP, ListenAddr: ":443", Dst: "localhost:8443", SNIRoute: "a.example=h:1", SNIDefault: "8443"}, "invalid --sni-default"},
+		{"sni-default needs sni-route", Config{Protocol: protoTCP, ListenAddr: ":443", Dst: "localhost:8443", SNIDefault: "h:1"}, "--sni-default requires --sni-route"},
+		{"sni-route and command", Config{Protocol: protoTCP, ListenAddr: ":443", Dst: "localhost:8443", SNIRoute: "a.example=h:1", DstCommand: "true"}, "cannot be combined with --dst-command"},
+		{"sni-route over dtls", Config{Protocol: protoTCP, DataPlane: "dtls", ListenAddr: ":443", Dst: "localhost:8443", SNIRoute: "a.example=h:1"}, "not supported with --dp dtls"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTCPListen(&tt.cfg)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestConfig_SNIRoutes(t *testing.T) {
+	cfg := Config{SNIRoute: "API.example.com.=localhost:8443, grafana.example.com=localhost:3000"}
+	require.Equal(t, map[string]string{"api.example.com": "localhost:8443", "grafana.example.com": "localhost:3000"}, cfg.SNIRoutes())
+	require.Nil(t, (&Config{}).SNIRoutes())
+}
+
+func TestValidateTCPListen_DstErrorListsBothModes(t *testing.T) {
+	err := validateTCPListen(&Config{Protocol: protoTCP, Dst: "localhost:3333"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "--protocol tcp --local 127.0.0.1:5432")
+	require.Contains(t, err.Error(), "--protocol tcp --listen :4000 --dst localhost:3333")
+}
+
+func TestAddrReachesListener(t *testing.T) {
+	for _, tc := range []struct {
+		target, listen string
+		want           bool
+	}{
+		{"127.0.0.1:4000", ":4000", true},
+		{"localhost:4000", "0.0.0.0:4000", true},
+		{"[::1]:4000", "[::]:4000", true},
+		{"127.0.0.1:4000", "127.0.0.1:4000", true},
+		{"localhost:4000", "127.0.0.1:4000", true},
+		{"127.0.0.1:4000", "localhost:4000", true},
+		{"0.0.0.0:4000", "127.0.0.1:4000", true},
+		{"127.0.0.1:4000", ":4001", false},
+		{"127.0.0.2:4000", "127.0.0.1:4000", false},
+		{"10.0.0.5:4000", "127.0.0.1:4000", false},
+		{"db.internal:4000", ":4000", false},
+	} {
+		require.Equal(t, tc.want, addrReachesListener(tc.target, tc.listen), "%s -> %s", tc.target, tc.listen)
+	}
+}
+
+func TestValidateForwardingLoops(t *testing.T) {
+	listen := &Config{Protocol: protoTCP, ListenAddr: ":4000", Dst: "localhost:3333", TargetAddr: "localhost:4000"}
+	expose := &Config{Protocol: protoTCP, TargetAddr: "127.0.0.1:4000"}
+	web := &Config{Protocol: protoHTTP, TargetAddr: "127.0.0.1:3000", AllowIncomingDst: "localhost:4000"}
+
+	require.NoError(t, validateForwardingLoops([]*Config{listen}), "listen mode dials no local backend")
+	require.NoError(t, validateForwardingLoops([]*Config{expose}))
+
+	err := validateForwardingLoops([]*Config{listen, expose})
+	require.ErrorContains(t, err, "forwarding loop: --local 127.0.0.1:4000 is this client's own --listen :4000")
+	err = validateForwardingLoops([]*Config{web, listen})
+	require.ErrorContains(t, err, "--allow-incoming-dst localhost:4000")
+
+	hybrid := &Config{Protocol: protoHTTP, TargetAddr: "127.0.0.1:3000", ListenAddr: ":4000"}
+	require.NoError(t, validateForwardingLoops([]*Config{hybrid}))
+	hybrid.TargetAddr = "localhost:4000"
+	require.ErrorContains(t, validateForwardingLoops([]*Config{hybrid}), "--local localhost:4000 is this client's own --listen :4000")
+}
+
+func TestValidateRawPath(t *testing.T) {
+	require.NoError(t, validateRawPath(&Config{Protocol: protoHTTP}))
+	require.NoError(t, validateRawPath(&Config{Protocol: protoHTTPS, RawPath: "/raw", RawDst: "127.0.0.1:22"}))
+	require.ErrorContains(t, validateRawPath(&Config{Protocol: protoTCP, RawPath: "/raw", RawDst: "127.0.0.1:22"}), "require an http or https tunnel")
+	require.ErrorContains(t, validateRawPath(&Config{Protocol: protoHTTP, RawDst: "127.0.0.1:22"}), "must start with /")
+	require.ErrorContains(t, validateRawPath(&Config{Protocol: protoHTTP, RawPath: "raw", RawDst: "127.0.0.1:22"}), "must start with /")
+	require.ErrorContains(t, validateRawPath(&Config{Protocol: protoHTTP, RawPath: "/raw"}), "invalid --raw-dst")
+	require.ErrorContains(t, validateRawPath(&Config{Protocol: protoHTTP, RawPath: "/raw", RawDst: "127.0.0.1"}), "invalid --raw-dst")
+
+	web := &Config{Protocol: protoHTTP, TargetAddr: "127.0.0.1:3000", RawPath: "/raw", RawDst: "localhost:4000"}
+	listen := &Config{Protocol: protoTCP, ListenAddr: ":4000", Dst: "localhost:3333"}
+	require.ErrorContains(t, validateForwardingLoops([]*Config{web, listen}), "--raw-dst localhost:4000")
+}
+
+func TestValidateRateLimitSource(t *testing.T) {
+	require.NoError(t, validateRateLimitSource(&Config{Protocol: protoTCP}))
+	require.NoError(t, validateRateLimitSource(&Config{Protocol: protoHTTP, RateLimitSource: "60/minute", RateLimitExempt: "10.0.0.0/8, 2001:db8::1"}))
+	require.ErrorContains(t, validateRateLimitSource(&Config{Protocol: protoTCP, RateLimitSource: "60/minute"}), "requires an http or https tunnel")
+	require.ErrorContains(t, validateRateLimitSource(&Config{Protocol: protoHTTP, RateLimitSource: "60/fortnight"}), "unknown unit")
+	require.ErrorContains(t, validateRateLimitSource(&Config{Protocol: protoHTTP, RateLimitExempt: "10.0.0.0/33"}), "invalid --rate-limit-exempt")
+
+	rs := (&Config{Protocol: protoHTTPS, RateLimitSource: "10/s", RateLimitExempt: "192.168.1.7"}).RuntimeSettings()
+	require.Equal(t, 10, rs.SourceRateLimit)
+	require.Equal(t, time.Second, rs.SourceRateWindow)
+	require.Equal(t, []netip.Prefix{netip.MustParsePrefix("192.168.1.7/32")}, rs.SourceRateExempt)
+}
+
+func TestValidateByteLimits(t *testing.T) {
+	require.NoError(t, validateByteLimits(&Config{}))
+	require.NoError(t, validateByteLimits(&Config{MaxBytesPerStream: "50MB", MaxBytesTotal: "1.5GiB"}))
+	require.ErrorContains(t, validateByteLimits(&Config{MaxBytesPerStream: "10MB/s"}), "invalid --max-bytes-per-stream")
+	require.ErrorContains(t, validateByteLimits(&Config{MaxBytesTotal: "lots"}), "invalid --max-bytes-total")
+
+	rs := (&Config{Protocol: protoTCP, MaxBytesPerStream: "50MB", MaxBytesTotal: "200MB"}).RuntimeSettings()
+	require.Equal(t, int64(50e6), rs.MaxBytesPerStream)
+	require.Equal(t, int64(200e6), rs.MaxBytesTotal)
+}
+
+func TestValidateDataPlane(t *testing.T) {
+	for _, dp := range []string{"", "ws", "QUIC", "dtls", "auto"} {
+		require.NoError(t, validateDataPlane(dp), dp)
+	}
+	require.ErrorContains(t, validateDataPlane("tcp"), "use ws, quic, dtls or auto")
+
+	for _, tt := range []struct {
+		protocol, dp      string
+		enabled, fallback bool
+	}{
+		{protoHTTP, "quic", true, false},
+		{protoHTTPS, "auto", true, true},
+		{protoHTTP, "ws", false, false},
+		{protoTCP, "quic", false, false},
+		{protoUDP, "auto", false, false},
+	} {
+		enabled, fallback := (&Config{Protocol: tt.protocol, DataPlane: tt.dp}).QUICServe()
+		require.Equal(t, tt.enabled, enabled, "%s --dp %s", tt.protocol, tt.dp)
+		require.Equal(t, tt.fallback, fallback, "%s --dp %s", tt.protocol, tt.dp)
+	}
+}
+
+func TestValidateHostRewrite(t *testing.T) {
+	web := func(local, rewrite string) *Config {
+		return &Config{Protocol: protoHTTP, TargetAddr: local, HostRewrite: rewrite}
+	}
+	require.NoError(t, validateHostRewrite(&Config{Protocol: protoTCP}))
+	for _, v := range []string{"myapp.local", "myapp.local:8080", "10.0.0.5", "[::1]", "[::1]:8080", "target", "TARGET"} {
+		require.NoError(t, validateHostRewrite(web("127.0.0.1:3000", v)), v)
+	}
+	for _, v := range []string{"my app", "myapp.local/x", "user@myapp", "::1", "myapp.local:http", "a\r\nX-Evil: 1"} {
+		require.ErrorContains(t, validateHostRewrite(web("127.0.0.1:3000", v)), "invalid --host-rewrite", v)
+	}
+	require.ErrorContains(t, validateHostRewrite(&Config{Protocol: protoTCP, HostRewrite: "myapp.local"}), "requires an http or https tunnel")
+	require.ErrorContains(t, validateHostRewrite(&Config{Protocol: protoHTTP, HostRewriteForwarded: true}), "requires --host-rewrite")
+
+	for local, want := range map[string]string{
+		"myapp.local:8080": "myapp.local",
+		"3000":             "127.0.0.1",
+		"[::1]:3000":       "[::1]",
+	} {
+		rs := (&Config{Protocol: protoHTTPS, TargetAddr: local, HostRewrite: "target", HostRewriteForwarded: true}).RuntimeSettings()
+		require.Equal(t, want, rs.HostRewrite, local)
+		require.True(t, rs.HostRewriteForwarded)
+	}
+	rs := (&Config{Protocol: protoTCP, TargetAddr: "127.0.0.1:3000", HostRewrite: "myapp.local"}).RuntimeSettings()
+	require.Empty(t, rs.HostRewrite, "only HTTP requests are rewritten")
+}
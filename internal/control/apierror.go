@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error codes of the server's JSON error envelope that the client reacts to.
+const (
+	CodeQuotaExceeded  = "quota_exceeded"
+	CodeSubdomainTaken = "subdomain_taken"
+	CodeAuthExpired    = "auth_expired"
+	CodeRateLimited    = "rate_limited"
+)
+
+// maxAPIErrorBody bounds how much of an error response is read.
+const maxAPIErrorBody = 64 << 10
+
+// APIError is a non-success response of the control-plane API. Code and
+// Message come from the server's error envelope
+// {"error": {"code": "...", "message": "..."}}; when the body is not such an
+// envelope, Code is empty and Message is the (truncated) raw body.
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+	// RetryAfter is the server's Retry-After delay; zero when absent.
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	switch {
+	case e.Message != "" && e.Code != "":
+		return fmt.Sprintf("server returned status %d: %s (%s)", e.StatusCode, e.Message, e.Code)
+	case e.Message != "":
+		return fmt.Sprintf("server returned status %d: %s", e.StatusCode, e.Message)
+	case e.Code != "":
+		return fmt.Sprintf("server returned status %d: %s", e.StatusCode, e.Code)
+	}
+	return fmt.Sprintf("server returned status %d", e.StatusCode)
+}
+
+// APIErrorCode, APIStatusCode and APIRetryAfter let packages that cannot
+// import control (support) classify the error.
+func (e *APIError) APIErrorCode() string { return e.Code }
+
+func (e *APIError) APIStatusCode() int { return e.StatusCode }
+
+func (e *APIError) APIRetryAfter() time.Duration { return e.RetryAfter }
+
+// newAPIError reads the error response resp, which the caller still closes.
+func newAPIError(resp *http.Response) *APIError {
+	//nolint:errcheck // best-effort read of error body
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxAPIErrorBody))
+	e := parseAPIErrorBody(resp.StatusCode, body)
+	e.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	return e
+}
+
+// parseAPIErrorBody decodes the error envelope, also accepting
+// {"error": "message"}, and falls back to the raw body.
+func parseAPIErrorBody(status int, body []byte) *APIError {
+	e := &APIError{StatusCode: status}
+	var envelope struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(body, &envelope) == nil && len(envelope.Error) > 0 {
+		var detail struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		var msg string
+		switch {
+		case json.Unmarshal(envelope.Error, &detail) == nil && (detail.Code != "" || detail.Message != ""):
+			e.Code = strings.TrimSpace(detail.Code)
+			e.Message = truncateErrorBody(strings.TrimSpace(detail.Message))
+			return e
+		case json.Unmarshal(envelope.Error, &msg) == nil && strings.TrimSpace(msg) != "":
+			e.Message = truncateErrorBody(strings.TrimSpace(msg))
+			return e
+		}
+	}
+	e.Message = truncateErrorBody(strings.TrimSpace(string(body)))
+	return e
+}
+
+// parseRetryAfter accepts both Retry-After forms: delay seconds and an
+// HTTP date. Invalid or past values are zero.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs <= 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package control
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/support"
+)
+
+func TestParseAPIErrorBody(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		code, message string
+		text          string
+	}{
+		{"envelope", `{"error": {"code": "quota_exceeded", "message": "limit of 5 tunnels reached"}}`,
+			CodeQuotaExceeded, "limit of 5 tunnels reached", "server returned status 422: limit of 5 tunnels reached (quota_exceeded)"},
+		{"code only", `{"error": {"code": "rate_limited"}}`, CodeRateLimited, "", "server returned status 422: rate_limited"},
+		{"message only", `{"error": {"message": "nope"}}`, "", "nope", "server returned status 422: nope"},
+		{"string error", `{"error": "subdomain in use"}`, "", "subdomain in use", "server returned status 422: subdomain in use"},
+		{"empty envelope", `{"error": {}}`, "", `{"error": {}}`, `server returned status 422: {"error": {}}`},
+		{"other json", `{"detail": "x"}`, "", `{"detail": "x"}`, `server returned status 422: {"detail": "x"}`},
+		{"malformed json", `{"error": {"code": "quota_exceeded"`, "", `{"error": {"code": "quota_exceeded"`, `server returned status 422: {"error": {"code": "quota_exceeded"`},
+		{"wrong types", `{"error": {"code": 42}}`, "", `{"error": {"code": 42}}`, `server returned status 422: {"error": {"code": 42}}`},
+		{"plain text", "  forbidden\n", "", "forbidden", "server returned status 422: forbidden"},
+		{"empty", "", "", "", "server returned status 422"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := parseAPIErrorBody(http.StatusUnprocessableEntity, []byte(tt.body))
+			assert.Equal(t, http.StatusUnprocessableEntity, e.StatusCode)
+			assert.Equal(t, tt.code, e.Code)
+			assert.Equal(t, tt.message, e.Message)
+			assert.Equal(t, tt.text, e.Error())
+		})
+	}
+
+	long := `{"error": {"code": "x", "message": "` + strings.Repeat("m", 500) + `"}}`
+	assert.Len(t, []rune(parseAPIErrorBody(400, []byte(long)).Message), maxTunnelErrorBodyRunes+3)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.Equal(t, 7*time.Second, parseRetryAfter("7", now))
+	assert.Equal(t, 30*time.Second, parseRetryAfter(now.Add(30*time.Second).Format(http.TimeFormat), now))
+	assert.Zero(t, parseRetryAfter("", now))
+	assert.Zero(t, parseRetryAfter("0", now))
+	assert.Zero(t, parseRetryAfter("-3", now))
+	assert.Zero(t, parseRetryAfter("soon", now))
+	assert.Zero(t, parseRetryAfter(now.Add(-time.Minute).Format(http.TimeFormat), now), "a date in the past")
+}
+
+func TestCreateTunnelWithClient_APIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Retry-After", "12")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"error": {"code": "rate_limited", "message": "slow down"}}`))
+	}))
+	defer srv.Close()
+	clock := support.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	SetDefaultHTTPClient(&HTTPClient{AttemptTimeout: 5 * time.Second, MaxRetries: 2, clock: clock})
+	t.Cleanup(func() { SetDefaultHTTPClient(nil) })
+
+	_, err := CreateTunnelWithClient(srv.URL, "127.0.0.1:8000", "http", "default", nil, "", "")
+	var apiErr *APIError
+	require.True(t, errors.As(err, &apiErr), "err = %v", err)
+	assert.Equal(t, &APIError{StatusCode: http.StatusTooManyRequests, Code: CodeRateLimited, Message: "slow down", RetryAfter: 12 * time.Second}, apiErr)
+
+	// GetTunnel is retried twice, each after the 12s of Retry-After.
+	go func() {
+		for range 2 {
+			clock.BlockUntil(1)
+			clock.Advance(12 * time.Second)
+		}
+	}()
+	_, err = GetTunnel(srv.URL, "t-1", nil, "")
+	require.True(t, errors.As(err, &apiErr), "err = %v", err)
+	assert.Equal(t, CodeRateLimited, apiErr.Code)
+}
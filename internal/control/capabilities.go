@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/fortunnels/client/internal/support"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+// maxCapabilitiesBody bounds the GET /api/version response.
+const maxCapabilitiesBody = 64 << 10
+
+// FetchCapabilities asks the server for its version and feature list with
+// GET /api/version. Servers that predate the endpoint answer 404, which is
+// (nil, nil): the caller falls back to the baseline feature set.
+func FetchCapabilities(serverURL string, client *http.Client, bearer string) (*protocolv1.ServerCapabilities, error) {
+	endpoint, err := support.ServerEndpoint(serverURL, "/api/version", nil)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, endpoint, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(bearer) != "" {
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(bearer))
+	}
+	resp, err := controlClient(client).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+	var caps protocolv1.ServerCapabilities
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxCapabilitiesBody)).Decode(&caps); err != nil {
+		return nil, err
+	}
+	if caps.Features == nil {
+		// A version without a feature list says nothing about features.
+		return nil, nil
+	}
+	return &caps, nil
+}
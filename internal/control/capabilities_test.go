@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package control
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+func TestFetchCapabilities(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   *protocolv1.ServerCapabilities
+	}{
+		{"new server", http.StatusOK, `{"version": "2.0.1", "features": ["psk_kdf", "hops", "compression"]}`,
+			&protocolv1.ServerCapabilities{Version: "2.0.1", Features: []string{"psk_kdf", "hops", "compression"}}},
+		{"partial server", http.StatusOK, `{"version": "1.2.0", "features": []}`,
+			&protocolv1.ServerCapabilities{Version: "1.2.0", Features: []string{}}},
+		{"old server", http.StatusNotFound, "404 page not found", nil},
+		{"version without features", http.StatusOK, `{"version": "1.0.0"}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/api/version", r.URL.Path)
+				assert.Equal(t, "Bearer tok", r.Header.Get("Authorization"))
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+			got, err := FetchCapabilities(srv.URL, nil, "tok")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFetchCapabilities_Errors(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	_, err := FetchCapabilities(failing.URL, nil, "")
+	var apiErr *APIError
+	require.True(t, errors.As(err, &apiErr), "err = %v", err)
+	assert.Equal(t, http.StatusInternalServerError, apiErr.StatusCode)
+
+	garbled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("<html>"))
+	}))
+	defer garbled.Close()
+	_, err = FetchCapabilities(garbled.URL, nil, "")
+	require.Error(t, err)
+}
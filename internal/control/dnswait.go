@@ -0,0 +1,117 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package control
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fortunnels/client/internal/support"
+)
+
+const (
+	// dnsWaitInterval is the pause between lookups of a new public hostname.
+	dnsWaitInterval = time.Second
+	// dnsLookupTimeout bounds a single lookup so a stalled resolver cannot
+	// hold up the loop.
+	dnsLookupTimeout = 2 * time.Second
+	// dnsPropagationHint is the delay new hostnames usually need.
+	dnsPropagationHint = "10-30 s"
+)
+
+// Resolver looks up a hostname; *net.Resolver satisfies it.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// NewDNSResolver returns the system resolver, or one that sends every query
+// to server (host or host:port, port 53 by default) for --dns-server.
+func NewDNSResolver(server string) Resolver {
+	server = strings.TrimSpace(server)
+	if server == "" {
+		return net.DefaultResolver
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// PublicHostname returns the hostname of a host-based public URL
+// (https://name.fortunnels.ru/), or "" for URLs that need no DNS wait:
+// tcp:// and udp:// ingress, IP literals and localhost.
+func PublicHostname(publicURL string) string {
+	u, err := url.Parse(publicURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	host := u.Hostname()
+	if host == "" || net.ParseIP(host) != nil || strings.EqualFold(host, "localhost") {
+		return ""
+	}
+	return host
+}
+
+// DNSWaiter polls a freshly created public hostname until it resolves, so
+// the "ready to use" line is not printed while the link still gives NXDOMAIN.
+type DNSWaiter struct {
+	Resolver Resolver
+	Timeout  time.Duration
+	Out      support.Reporter
+	// interval is dnsWaitInterval; tests shorten it.
+	interval time.Duration
+}
+
+// Wait resolves host until it succeeds, Timeout passes or ctx is done,
+// printing a dot per failed attempt. It reports whether host resolved.
+func (w *DNSWaiter) Wait(ctx context.Context, host, publicURL string) bool {
+	out := w.Out
+	if out == nil {
+		out = support.StdReporter{}
+	}
+	interval := w.interval
+	if interval <= 0 {
+		interval = dnsWaitInterval
+	}
+	ctx, cancel := context.WithTimeout(ctx, w.Timeout)
+	defer cancel()
+
+	if w.lookup(ctx, host) {
+		out.UserMessage(support.LevelInfo, "🌐 %s is ready to use\n", publicURL)
+		return true
+	}
+	out.UserMessage(support.LevelInfo, "⏳ Waiting for DNS of %s ", host)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		out.UserMessage(support.LevelInfo, ".")
+		select {
+		case <-ctx.Done():
+			out.UserMessage(support.LevelInfo, "\n⚠️  %s does not resolve yet after %s; new hostnames usually take %s to propagate, the link will start working shortly\n",
+				host, w.Timeout, dnsPropagationHint)
+			return false
+		case <-ticker.C:
+		}
+		if w.lookup(ctx, host) {
+			out.UserMessage(support.LevelInfo, " ok\n🌐 %s is ready to use\n", publicURL)
+			return true
+		}
+	}
+}
+
+func (w *DNSWaiter) lookup(ctx context.Context, host string) bool {
+	ctx, cancel := context.WithTimeout(ctx, dnsLookupTimeout)
+	defer cancel()
+	addrs, err := w.Resolver.LookupHost(ctx, host)
+	return err == nil && len(addrs) > 0
+}
@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package control
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/support"
+)
+
+// fakeResolver fails the first failures lookups with NXDOMAIN, then resolves.
+type fakeResolver struct {
+	mu       sync.Mutex
+	failures int
+	calls    int
+}
+
+func (r *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	if r.calls <= r.failures {
+		return nil, errors.New("no such host")
+	}
+	return []string{"203.0.113.7"}, nil
+}
+
+type bufferOutput struct{ strings.Builder }
+
+func (b *bufferOutput) UserMessage(_ support.Level, id string, args ...any) {
+	fmt.Fprintf(&b.Builder, id, args...)
+}
+func (b *bufferOutput) Event(string, map[string]any) {}
+func (b *bufferOutput) Progress(string)              {}
+
+func TestPublicHostname(t *testing.T) {
+	assert.Equal(t, "abc.fortunnels.ru", PublicHostname("https://abc.fortunnels.ru/"))
+	assert.Equal(t, "abc.fortunnels.ru", PublicHostname("http://abc.fortunnels.ru:8080/x"))
+	assert.Empty(t, PublicHostname("tcp://fortunnels.ru:40001"))
+	assert.Empty(t, PublicHostname("http://127.0.0.1:8080/t/abc/"))
+	assert.Empty(t, PublicHostname("http://localhost/t/abc/"))
+	assert.Empty(t, PublicHostname("::not a url"))
+}
+
+func TestDNSWaiter_ImmediateSuccess(t *testing.T) {
+	res := &fakeResolver{}
+	out := &bufferOutput{}
+	w := &DNSWaiter{Resolver: res, Timeout: time.Second, Out: out, interval: time.Millisecond}
+	assert.True(t, w.Wait(context.Background(), "abc.fortunnels.ru", "https://abc.fortunnels.ru/"))
+	assert.Equal(t, 1, res.calls)
+	assert.Equal(t, "🌐 https://abc.fortunnels.ru/ is ready to use\n", out.String())
+}
+
+func TestDNSWaiter_DelayedSuccess(t *testing.T) {
+	res := &fakeResolver{failures: 3}
+	out := &bufferOutput{}
+	w := &DNSWaiter{Resolver: res, Timeout: 5 * time.Second, Out: out, interval: time.Millisecond}
+	assert.True(t, w.Wait(context.Background(), "abc.fortunnels.ru", "https://abc.fortunnels.ru/"))
+	assert.Equal(t, 4, res.calls)
+	assert.Equal(t, "⏳ Waiting for DNS of abc.fortunnels.ru ... ok\n🌐 https://abc.fortunnels.ru/ is ready to use\n", out.String())
+}
+
+func TestDNSWaiter_Timeout(t *testing.T) {
+	res := &fakeResolver{failures: 1 << 30}
+	out := &bufferOutput{}
+	w := &DNSWaiter{Resolver: res, Timeout: 30 * time.Millisecond, Out: out, interval: 5 * time.Millisecond}
+	assert.False(t, w.Wait(context.Background(), "abc.fortunnels.ru", "https://abc.fortunnels.ru/"))
+	assert.Contains(t, out.String(), "abc.fortunnels.ru does not resolve yet after 30ms")
+	assert.Contains(t, out.String(), dnsPropagationHint)
+	assert.NotContains(t, out.String(), "ready to use")
+}
+
+func TestNewDNSResolver_QueriesOverrideServer(t *testing.T) {
+	assert.Equal(t, Resolver(net.DefaultResolver), NewDNSResolver(""))
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer pc.Close()
+	got := make(chan struct{}, 1)
+	go func() {
+		buf := make([]byte, 512)
+		if _, _, err := pc.ReadFrom(buf); err == nil {
+			got <- struct{}{}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, _ = NewDNSResolver(pc.LocalAddr().String()).LookupHost(ctx, "abc.fortunnels.ru")
+	select {
+	case <-got:
+	case <-time.After(time.Second):
+		t.Fatal("query did not reach the --dns-server resolver")
+	}
+}
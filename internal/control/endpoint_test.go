@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package control
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+)
+
+// TestRequestURLs_NormalizedServer checks the exact URLs the control
+// functions request for --server values users get wrong: none of them turns
+// into a doubled slash or a request under the stray path.
+func TestRequestURLs_NormalizedServer(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		seen []string
+	)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, r.Method+" "+r.URL.RequestURI())
+		mu.Unlock()
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+	hostPort := strings.TrimPrefix(srv.URL, "https://")
+
+	tests := []struct {
+		name, server string
+	}{
+		{"canonical", "https://" + hostPort},
+		{"trailing slash", "https://" + hostPort + "/"},
+		{"trailing slashes", "https://" + hostPort + "///"},
+		{"no scheme", hostPort + "/"},
+		{"upper-case scheme", "HTTPS://" + hostPort},
+		{"userinfo", "https://admin:secret@" + hostPort + "/"},
+		{"path", "https://" + hostPort + "/api/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverURL, _, err := config.NormalizeServerURL(tt.server)
+			require.NoError(t, err)
+			mu.Lock()
+			seen = nil
+			mu.Unlock()
+
+			client := srv.Client()
+			_, _ = CreateTunnelWithClient(serverURL, "127.0.0.1:3000", "http", "", client, "", "")
+			_, _ = GetTunnel(serverURL, "t 1", client, "")
+			_ = DeleteTunnel(serverURL, "t 1", client, "", "")
+			_ = TakeOverTunnel(serverURL, "t 1", "i-1", client, "", "")
+			_, _ = FetchCapabilities(serverURL, client, "")
+			_ = pollTunnel(client, serverURL, "t 1", "")
+			k := &tunnelKeepalive{client: ensurePollClient(client), serverURL: serverURL, tunnelID: "t 1"}
+			_, _ = k.post()
+
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, []string{
+				"POST /api/tunnels",
+				"GET /api/tunnels?id=t+1",
+				"DELETE /api/tunnels?id=t+1",
+				"PATCH /api/tunnels",
+				"GET /api/version",
+				"GET /api/tunnels?id=t+1",
+				"POST /api/tunnels/t%201/keepalive",
+			}, seen)
+
+			wsURL, err := buildControlWebSocketURL(serverURL, "t 1")
+			require.NoError(t, err)
+			assert.Equal(t, "wss://"+hostPort+"/ws?watch=t+1", wsURL)
+		})
+	}
+}
@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package control
+
+import (
+	"context"
+	"time"
+
+	"github.com/fortunnels/client/internal/support"
+)
+
+const (
+	// expiryReminderEvery spaces the remaining-time reminders of a guest
+	// tunnel until the final stretch, where they come every minute.
+	expiryReminderEvery = 15 * time.Minute
+	expiryFinalStretch  = 5 * time.Minute
+	// expiryWarnBefore is when the "new connections may fail" warning is
+	// printed: the server may refuse new streams shortly before expiry.
+	expiryWarnBefore = 30 * time.Second
+	// expiryMaxSleep caps every wait so that a laptop waking from sleep
+	// recomputes the remaining time within this long instead of trusting
+	// a timer armed before the suspend.
+	expiryMaxSleep = 30 * time.Second
+)
+
+// ExpiryWatch prints the remaining lifetime of a guest tunnel at
+// expiryReminderEvery and every minute of the final stretch, warns shortly
+// before expiry and reports the expiry itself.
+type ExpiryWatch struct {
+	ExpiresAt time.Time
+	Out       support.Reporter
+
+	// now and sleep are replaced by tests; sleep returns false when ctx is
+	// done first.
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) bool
+}
+
+// NewExpiryWatch returns the ExpiryWatch of a tunnel expiring at expiresAt.
+func NewExpiryWatch(expiresAt time.Time, out support.Reporter) *ExpiryWatch {
+	if out == nil {
+		out = support.StdReporter{}
+	}
+	return &ExpiryWatch{ExpiresAt: expiresAt, Out: out, now: time.Now, sleep: sleepContext}
+}
+
+// Run prints reminders until the tunnel expires, then returns true; it
+// returns false as soon as ctx is done. The remaining time is recomputed
+// from the wall clock after every wait (ExpiresAt comes from the server and
+// has no monotonic reading), so marks slept through are collapsed into one
+// reminder with the actual remaining time.
+func (w *ExpiryWatch) Run(ctx context.Context) bool {
+	for {
+		remaining := w.ExpiresAt.Sub(w.now())
+		if remaining <= 0 {
+			return true
+		}
+		mark := nextExpiryMark(remaining)
+		wait := min(remaining-mark, expiryMaxSleep)
+		if !w.sleep(ctx, wait) {
+			return false
+		}
+		remaining = w.ExpiresAt.Sub(w.now())
+		if remaining <= 0 || remaining > mark || mark == 0 {
+			continue
+		}
+		if mark == expiryWarnBefore {
+			w.Out.UserMessage(support.LevelInfo, "⚠️ Guest tunnel expires in %s; new connections may fail soon.\n", support.FormatDuration(remaining))
+			continue
+		}
+		w.Out.UserMessage(support.LevelInfo, "⏳ %s remaining (guest tunnel expires at %s)\n", support.FormatDuration(remaining), support.FormatTime(w.ExpiresAt))
+	}
+}
+
+// nextExpiryMark is the next reminder point below remaining: a multiple of
+// expiryReminderEvery, a whole minute of the final stretch, the pre-expiry
+// warning, or 0 for the expiry itself.
+func nextExpiryMark(remaining time.Duration) time.Duration {
+	switch {
+	case remaining > expiryReminderEvery:
+		return (remaining - 1) / expiryReminderEvery * expiryReminderEvery
+	case remaining > expiryFinalStretch:
+		return expiryFinalStretch
+	case remaining > time.Minute:
+		return (remaining - 1) / time.Minute * time.Minute
+	case remaining > expiryWarnBefore:
+		return expiryWarnBefore
+	default:
+		return 0
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package control
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeExpiryClock advances only when the watch sleeps; jumps add extra time
+// to the sleep with the same index, like a system suspend.
+type fakeExpiryClock struct {
+	now    time.Time
+	sleeps []time.Duration
+	jumps  map[int]time.Duration
+}
+
+func (c *fakeExpiryClock) install(w *ExpiryWatch) {
+	w.now = func() time.Time { return c.now }
+	w.sleep = func(_ context.Context, d time.Duration) bool {
+		c.now = c.now.Add(d + c.jumps[len(c.sleeps)])
+		c.sleeps = append(c.sleeps, d)
+		return true
+	}
+}
+
+func reminderLines(out *bufferOutput) []string {
+	var lines []string
+	for _, l := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		lines = append(lines, strings.SplitN(l, " (", 2)[0])
+	}
+	return lines
+}
+
+func TestExpiryWatch_ReminderSequence(t *testing.T) {
+	start := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	out := &bufferOutput{}
+	w := NewExpiryWatch(start.Add(47*time.Minute), out)
+	clock := &fakeExpiryClock{now: start}
+	clock.install(w)
+
+	require.True(t, w.Run(context.Background()))
+	assert.Equal(t, []string{
+		"⏳ 45m remaining",
+		"⏳ 30m remaining",
+		"⏳ 15m remaining",
+		"⏳ 5m remaining",
+		"⏳ 4m remaining",
+		"⏳ 3m remaining",
+		"⏳ 2m remaining",
+		"⏳ 1m remaining",
+		"⚠️ Guest tunnel expires in 30s; new connections may fail soon.",
+	}, reminderLines(out))
+	for _, d := range clock.sleeps {
+		assert.LessOrEqual(t, d, expiryMaxSleep, "no wait may outlast a suspend unchecked")
+	}
+	assert.Equal(t, start.Add(47*time.Minute), clock.now)
+}
+
+func TestExpiryWatch_RecomputesAfterSuspend(t *testing.T) {
+	start := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	out := &bufferOutput{}
+	w := NewExpiryWatch(start.Add(59*time.Minute), out)
+	// The first wait is suspended for 17 minutes: past the 45m mark.
+	clock := &fakeExpiryClock{now: start, jumps: map[int]time.Duration{0: 17 * time.Minute}}
+	clock.install(w)
+
+	require.True(t, w.Run(context.Background()))
+	lines := reminderLines(out)
+	require.NotEmpty(t, lines)
+	assert.Equal(t, "⏳ 42m remaining", lines[0], "one reminder with the real remaining time")
+	assert.Equal(t, "⏳ 30m remaining", lines[1])
+}
+
+func TestExpiryWatch_StopsWithContext(t *testing.T) {
+	w := NewExpiryWatch(time.Now().Add(time.Hour), &bufferOutput{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.False(t, w.Run(ctx))
+}
@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package control
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fortunnels/client/internal/support"
+)
+
+// Formats of the --export-env file.
+const (
+	ExportDotenv = "dotenv"
+	ExportJSON   = "json"
+)
+
+// ExportInfo is what --export-env tells tooling about the tunnel being
+// served. ExpiresAt is zero for tunnels that do not expire.
+type ExportInfo struct {
+	PublicURL string
+	TunnelID  string
+	Protocol  string
+	ExpiresAt time.Time
+}
+
+// NewExportInfo describes tun as served through serverURL; protocol is used
+// when the server did not report the tunnel's.
+func NewExportInfo(serverURL string, tun *Response, protocol string) ExportInfo {
+	if tun.Protocol != "" {
+		protocol = tun.Protocol
+	}
+	return ExportInfo{
+		PublicURL: DisplayPublicURL(serverURL, tun),
+		TunnelID:  tun.ID,
+		Protocol:  protocol,
+		ExpiresAt: tun.ExpiresAt,
+	}
+}
+
+// encode renders info as a dotenv file (FORTUNNELS_PUBLIC_URL=...) or a JSON
+// object.
+func (info ExportInfo) encode(format string) ([]byte, error) {
+	expires := ""
+	if !info.ExpiresAt.IsZero() {
+		expires = support.JSONTime(info.ExpiresAt)
+	}
+	switch format {
+	case ExportJSON:
+		b, err := json.MarshalIndent(struct {
+			PublicURL string `json:"public_url"`
+			TunnelID  string `json:"tunnel_id"`
+			Protocol  string `json:"protocol"`
+			ExpiresAt string `json:"expires_at"`
+		}{info.PublicURL, info.TunnelID, info.Protocol, expires}, "", "  ")
+		return append(b, '\n'), err
+	case ExportDotenv, "":
+		var buf bytes.Buffer
+		for _, kv := range [][2]string{
+			{"FORTUNNELS_PUBLIC_URL", info.PublicURL},
+			{"FORTUNNELS_TUNNEL_ID", info.TunnelID},
+			{"FORTUNNELS_PROTOCOL", info.Protocol},
+			{"FORTUNNELS_EXPIRES_AT", expires},
+		} {
+			fmt.Fprintf(&buf, "%s=%s\n", kv[0], dotenvValue(kv[1]))
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// dotenvValue quotes v when a dotenv parser would otherwise cut or expand it.
+func dotenvValue(v string) string {
+	if !strings.ContainsAny(v, " \t\"'#$\\\n") {
+		return v
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "\n", `\n`).Replace(v) + `"`
+}
+
+// WriteExportFile replaces path with info in format. The new file is renamed
+// into place, so readers see the old or the new contents, never a mix, and
+// a reader holding the old file open keeps reading the old contents.
+func WriteExportFile(path, format string, info ExportInfo) error {
+	data, err := info.encode(format)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
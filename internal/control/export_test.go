@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package control
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewExportInfo(t *testing.T) {
+	expires := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	info := NewExportInfo("https://api.example.com", &Response{ID: "t1", PublicURL: "tcp://127.0.0.1:40001", ExpiresAt: expires}, "tcp")
+	assert.Equal(t, ExportInfo{PublicURL: "tcp://api.example.com:40001", TunnelID: "t1", Protocol: "tcp", ExpiresAt: expires}, info)
+
+	info = NewExportInfo("https://api.example.com", &Response{ID: "t2", Protocol: "https", PublicURL: "https://t2.example.com/"}, "http")
+	assert.Equal(t, "https", info.Protocol, "the server's protocol wins")
+}
+
+func TestWriteExportFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env.tunnel")
+	info := ExportInfo{PublicURL: "https://t1.example.com/", TunnelID: "t1", Protocol: "http"}
+	require.NoError(t, WriteExportFile(path, ExportDotenv, info))
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "FORTUNNELS_PUBLIC_URL=https://t1.example.com/\nFORTUNNELS_TUNNEL_ID=t1\nFORTUNNELS_PROTOCOL=http\nFORTUNNELS_EXPIRES_AT=\n", string(b))
+
+	info.ExpiresAt = time.Date(2026, 10, 15, 14, 0, 0, 0, time.FixedZone("CEST", 2*3600))
+	require.NoError(t, WriteExportFile(path, ExportJSON, info))
+	b, err = os.ReadFile(path)
+	require.NoError(t, err)
+	var got map[string]string
+	require.NoError(t, json.Unmarshal(b, &got))
+	assert.Equal(t, map[string]string{
+		"public_url": "https://t1.example.com/",
+		"tunnel_id":  "t1",
+		"protocol":   "http",
+		"expires_at": "2026-10-15T12:00:00Z",
+	}, got)
+
+	assert.ErrorContains(t, WriteExportFile(path, "yaml", info), `unknown export format "yaml"`)
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "no temporary files are left behind")
+}
+
+// TestWriteExportFile_ReaderKeepsOldContents rewrites the file while a
+// reader holds it open: the reader sees the whole old file, a new open the
+// whole new one.
+func TestWriteExportFile_ReaderKeepsOldContents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tunnel.env")
+	require.NoError(t, WriteExportFile(path, ExportDotenv, ExportInfo{PublicURL: "https://old.example.com/", TunnelID: "t1", Protocol: "http"}))
+	old, err := os.Open(path)
+	require.NoError(t, err)
+	defer old.Close()
+	head := make([]byte, 10)
+	_, err = io.ReadFull(old, head)
+	require.NoError(t, err)
+
+	require.NoError(t, WriteExportFile(path, ExportDotenv, ExportInfo{PublicURL: "https://new.example.com/", TunnelID: "t2", Protocol: "http"}))
+	rest, err := io.ReadAll(old)
+	require.NoError(t, err)
+	assert.Equal(t, "FORTUNNELS_PUBLIC_URL=https://old.example.com/\nFORTUNNELS_TUNNEL_ID=t1\nFORTUNNELS_PROTOCOL=http\nFORTUNNELS_EXPIRES_AT=\n", string(head)+string(rest))
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "FORTUNNELS_PUBLIC_URL=https://new.example.com/\nFORTUNNELS_TUNNEL_ID=t2\n")
+}
+
+func TestDotenvValue(t *testing.T) {
+	assert.Equal(t, "https://t1.example.com/?a=b", dotenvValue("https://t1.example.com/?a=b"))
+	assert.Equal(t, `"a b"`, dotenvValue("a b"))
+	assert.Equal(t, `"\$HOME \"q\" #x"`, dotenvValue(`$HOME "q" #x`))
+}
@@ -0,0 +1,260 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package control
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/support"
+)
+
+const (
+	// Defaults of --control-timeout, --control-attempt-timeout and
+	// --control-retries, for callers that never configured a policy.
+	defaultControlTimeout        = 30 * time.Second
+	defaultControlAttemptTimeout = 10 * time.Second
+	defaultControlRetries        = 2
+
+	// retryBackoffBase and retryBackoffMax bound the jittered exponential
+	// backoff between attempts without a Retry-After.
+	retryBackoffBase = 250 * time.Millisecond
+	retryBackoffMax  = 5 * time.Second
+	// maxRetryAfterWait is the longest Retry-After an attempt waits for;
+	// longer ones end the call with the server's answer.
+	maxRetryAfterWait = 30 * time.Second
+)
+
+// HTTPClient is the timeout and retry policy every control-plane request
+// shares. Client turns it into an *http.Client, so call sites keep their
+// cookie jar and set their own Authorization and CSRF headers, which every
+// attempt resends.
+//
+// Only idempotent requests are retried: GET, HEAD, OPTIONS, PUT and DELETE,
+// and any request carrying an Idempotency-Key header (sent where the server
+// de-duplicates by it). A POST such as tunnel creation or login is sent once.
+// Transport errors, attempt timeouts and 429, 502, 503 and 504 answers are
+// retried, after the server's Retry-After or a jittered backoff.
+type HTTPClient struct {
+	// Timeout bounds a whole call: every attempt, the waits between them
+	// and reading the final body. Zero means no bound beyond the caller's
+	// context.
+	Timeout time.Duration
+	// AttemptTimeout bounds one attempt, including reading its body.
+	AttemptTimeout time.Duration
+	// MaxRetries is how many times a failed idempotent request is resent.
+	MaxRetries int
+	// Transport sends each attempt; nil means http.DefaultTransport. Tests
+	// put a fake here.
+	Transport http.RoundTripper
+
+	// sleep waits d or until ctx ends; tests replace it.
+	sleep func(ctx context.Context, d time.Duration) error
+	// clock times the waits when sleep is nil; nil means support.RealClock.
+	clock support.Clock
+}
+
+// NewHTTPClient returns the policy of cfg's --control-timeout,
+// --control-attempt-timeout and --control-retries. Unset timeouts (a Config
+// not built from flags) take the flag defaults.
+func NewHTTPClient(cfg *config.Config) *HTTPClient {
+	c := &HTTPClient{
+		Timeout:        cfg.ControlTimeout,
+		AttemptTimeout: cfg.ControlAttemptTimeout,
+		MaxRetries:     cfg.ControlRetries,
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultControlTimeout
+	}
+	if c.AttemptTimeout <= 0 {
+		c.AttemptTimeout = min(defaultControlAttemptTimeout, c.Timeout)
+	}
+	return c
+}
+
+// defaultHTTPClient is the policy of control-plane calls made without a
+// client of their own (bearer-token auth passes none).
+var defaultHTTPClient atomic.Pointer[HTTPClient]
+
+// SetDefaultHTTPClient makes c the policy of calls without a client.
+func SetDefaultHTTPClient(c *HTTPClient) { defaultHTTPClient.Store(c) }
+
+// DefaultHTTPClient returns the policy set by SetDefaultHTTPClient, or the
+// flag defaults.
+func DefaultHTTPClient() *HTTPClient {
+	if c := defaultHTTPClient.Load(); c != nil {
+		return c
+	}
+	return &HTTPClient{
+		Timeout:        defaultControlTimeout,
+		AttemptTimeout: defaultControlAttemptTimeout,
+		MaxRetries:     defaultControlRetries,
+	}
+}
+
+// Client returns an *http.Client applying the policy, with jar (may be nil)
+// holding the session cookies.
+func (c *HTTPClient) Client(jar http.CookieJar) *http.Client {
+	return &http.Client{Timeout: c.Timeout, Jar: jar, Transport: c}
+}
+
+// controlClient returns client, or a client of the default policy when the
+// caller has none.
+func controlClient(client *http.Client) *http.Client {
+	if client != nil {
+		return client
+	}
+	return DefaultHTTPClient().Client(nil)
+}
+
+// RoundTrip sends req, retrying it as the policy allows.
+func (c *HTTPClient) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := c.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	retries := c.MaxRetries
+	if !isIdempotent(req) || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		retries = 0
+	}
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+		start := time.Now()
+		resp, err := c.attempt(base, req)
+		if ctx.Err() != nil {
+			// The caller's deadline or cancellation, not the attempt's:
+			// nothing is left to retry with.
+			logDebug("%s %s attempt %d: %v", req.Method, req.URL.Path, attempt+1, ctx.Err())
+			return resp, err
+		}
+		wait, retry := retryDelay(resp, err, attempt)
+		logAttempt(req, attempt, resp, err, time.Since(start), retry && attempt < retries)
+		if !retry || attempt >= retries {
+			return resp, err
+		}
+		if wait > maxRetryAfterWait || exceedsDeadline(ctx, wait) {
+			logDebug("%s %s: retry in %s would outlast the deadline; giving up", req.Method, req.URL.Path, wait)
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+			resp.Body.Close()
+		}
+		if err := c.wait(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// attempt sends req once under AttemptTimeout; the timeout keeps running
+// until the response body is closed.
+func (c *HTTPClient) attempt(base http.RoundTripper, req *http.Request) (*http.Response, error) {
+	if c.AttemptTimeout <= 0 {
+		return base.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), c.AttemptTimeout)
+	resp, err := base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+func (c *HTTPClient) wait(ctx context.Context, d time.Duration) error {
+	if c.sleep != nil {
+		return c.sleep(ctx, d)
+	}
+	clock := c.clock
+	if clock == nil {
+		clock = support.RealClock
+	}
+	t := clock.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// isIdempotent reports whether req may be sent again without a second
+// effect on the server.
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != "" || req.Header.Get("X-Idempotency-Key") != ""
+}
+
+// retryDelay reports whether the outcome of attempt is worth retrying, and
+// after how long: the server's Retry-After, else a jittered backoff.
+func retryDelay(resp *http.Response, err error, attempt int) (time.Duration, bool) {
+	if err == nil {
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		default:
+			return 0, false
+		}
+		if d := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); d > 0 {
+			return d, true
+		}
+	} else if errors.Is(err, context.Canceled) {
+		return 0, false
+	}
+	d := min(retryBackoffBase<<min(attempt, 8), retryBackoffMax)
+	return d/2 + rand.N(d/2+1), true
+}
+
+// exceedsDeadline reports whether waiting d leaves ctx past its deadline.
+func exceedsDeadline(ctx context.Context, d time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	return ok && time.Until(deadline) <= d
+}
+
+// logAttempt logs one control-plane attempt at DEBUG level.
+func logAttempt(req *http.Request, attempt int, resp *http.Response, err error, took time.Duration, retrying bool) {
+	if !support.DebugEnabled() {
+		return
+	}
+	var outcome string
+	if err != nil {
+		outcome = "error: " + err.Error()
+	} else {
+		outcome = "HTTP " + resp.Status
+	}
+	next := ""
+	if retrying {
+		next = "; retrying"
+	}
+	logDebug("%s %s attempt %d: %s in %s%s", req.Method, req.URL.Path, attempt+1, outcome, took.Round(time.Millisecond), next)
+}
@@ -0,0 +1,200 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package control
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+)
+
+// testPolicy returns a policy whose waits are recorded instead of slept.
+func testPolicy(waits *[]time.Duration) *HTTPClient {
+	return &HTTPClient{
+		Timeout:        5 * time.Second,
+		AttemptTimeout: time.Second,
+		MaxRetries:     2,
+		sleep: func(_ context.Context, d time.Duration) error {
+			*waits = append(*waits, d)
+			return nil
+		},
+	}
+}
+
+func TestHTTPClient_RetriesGETOn503WithRetryAfter(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer tok", r.Header.Get("Authorization"), "bearer resent on every attempt")
+		c, err := r.Cookie("session")
+		if assert.NoError(t, err, "jar cookie sent on every attempt") {
+			assert.Equal(t, "s1", c.Value)
+		}
+		if attempts.Add(1) == 1 {
+			w.Header().Set("Retry-After", "3")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"exists":true,"tunnels":[{"id":"t1"}]}`))
+	}))
+	defer srv.Close()
+
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	u, _ := url.Parse(srv.URL)
+	jar.SetCookies(u, []*http.Cookie{{Name: "session", Value: "s1"}})
+	var waits []time.Duration
+	client := testPolicy(&waits).Client(jar)
+
+	tun, err := GetTunnel(srv.URL, "t1", client, "tok")
+	require.NoError(t, err)
+	assert.Equal(t, "t1", tun.ID)
+	assert.EqualValues(t, 2, attempts.Load())
+	assert.Equal(t, []time.Duration{3 * time.Second}, waits, "waited the server's Retry-After")
+}
+
+func TestHTTPClient_BacksOffWithJitterUntilRetriesRunOut(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	var waits []time.Duration
+
+	_, err := FetchCapabilities(srv.URL, testPolicy(&waits).Client(nil), "")
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadGateway, apiErr.StatusCode, "the last answer is returned")
+	assert.EqualValues(t, 3, attempts.Load(), "one attempt plus MaxRetries")
+	require.Len(t, waits, 2)
+	assert.InDelta(t, retryBackoffBase*3/4, waits[0], float64(retryBackoffBase/4))
+	assert.InDelta(t, retryBackoffBase*3/2, waits[1], float64(retryBackoffBase/2))
+}
+
+func TestHTTPClient_NoRetry(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		call   func(serverURL string, client *http.Client) error
+	}{
+		{"GET 400", http.StatusBadRequest, func(serverURL string, client *http.Client) error {
+			_, err := GetTunnel(serverURL, "t1", client, "")
+			return err
+		}},
+		{"POST 503", http.StatusServiceUnavailable, func(serverURL string, client *http.Client) error {
+			_, err := CreateTunnelWithClient(serverURL, "localhost:3000", "http", "u", client, "", "")
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts.Add(1)
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+			var waits []time.Duration
+
+			err := tt.call(srv.URL, testPolicy(&waits).Client(nil))
+			var apiErr *APIError
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, tt.status, apiErr.StatusCode)
+			assert.EqualValues(t, 1, attempts.Load())
+			assert.Empty(t, waits)
+		})
+	}
+}
+
+func TestHTTPClient_RetriesPOSTWithIdempotencyKey(t *testing.T) {
+	var attempts atomic.Int32
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b := make([]byte, 16)
+		n, _ := r.Body.Read(b)
+		bodies = append(bodies, string(b[:n]))
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	var waits []time.Duration
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, srv.URL, strings.NewReader("payload"))
+	require.NoError(t, err)
+	req.Header.Set("Idempotency-Key", "k1")
+	resp, err := testPolicy(&waits).Client(nil).Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"payload", "payload"}, bodies, "body resent")
+}
+
+func TestHTTPClient_TimeoutPropagation(t *testing.T) {
+	block := make(chan struct{})
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		select {
+		case <-block:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(block)
+
+	t.Run("attempt timeout is retried, then reported", func(t *testing.T) {
+		attempts.Store(0)
+		var waits []time.Duration
+		policy := testPolicy(&waits)
+		policy.AttemptTimeout = 50 * time.Millisecond
+		policy.MaxRetries = 1
+
+		_, err := GetTunnel(srv.URL, "t1", policy.Client(nil), "")
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, context.DeadlineExceeded), "got %v", err)
+		var netErr net.Error
+		require.ErrorAs(t, err, &netErr)
+		assert.True(t, netErr.Timeout())
+		assert.EqualValues(t, 2, attempts.Load())
+	})
+
+	t.Run("call timeout ends the retries", func(t *testing.T) {
+		attempts.Store(0)
+		var waits []time.Duration
+		policy := testPolicy(&waits)
+		policy.Timeout = 100 * time.Millisecond
+		policy.MaxRetries = 5
+
+		start := time.Now()
+		_, err := GetTunnel(srv.URL, "t1", policy.Client(nil), "")
+		require.Error(t, err)
+		var netErr net.Error
+		require.ErrorAs(t, err, &netErr)
+		assert.True(t, netErr.Timeout())
+		assert.Less(t, time.Since(start), 2*time.Second)
+		assert.EqualValues(t, 1, attempts.Load(), "the call deadline is not retried")
+	})
+}
+
+func TestNewHTTPClient_DefaultsUnsetTimeouts(t *testing.T) {
+	c := NewHTTPClient(&config.Config{ControlRetries: 4})
+	assert.Equal(t, defaultControlTimeout, c.Timeout)
+	assert.Equal(t, defaultControlAttemptTimeout, c.AttemptTimeout)
+	assert.Equal(t, 4, c.MaxRetries)
+}
@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package control
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fortunnels/client/internal/support"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+// MsgDisplacedExiting is printed when another client instance took over the tunnel.
+const MsgDisplacedExiting = "Another client instance took over this tunnel. Exiting."
+
+const activeClientPollInterval = 200 * time.Millisecond
+
+// FindOtherInstance polls GET /api/tunnels?id=<id> until the server reports
+// which client instance serves tunnelID. It returns that instance when it is
+// not instanceID, and nil when this instance is the active one or the server
+// did not report one within timeout (servers without active_client support).
+func FindOtherInstance(httpClient *http.Client, serverURL, tunnelID, bearer, instanceID string, timeout time.Duration) *protocolv1.ActiveClient {
+	client := ensurePollClient(httpClient)
+	deadline := time.Now().Add(timeout)
+	for {
+		poll := pollTunnel(client, serverURL, tunnelID, bearer)
+		if ac := poll.activeClient; ac != nil && ac.InstanceID != "" {
+			if ac.InstanceID == instanceID {
+				return nil
+			}
+			return ac
+		}
+		if poll.terminal || !time.Now().Before(deadline) {
+			return nil
+		}
+		time.Sleep(activeClientPollInterval)
+	}
+}
+
+// TakeOverTunnel asks the server to evict every other client instance serving
+// tunnelID so that instanceID becomes its only client.
+func TakeOverTunnel(serverURL, tunnelID, instanceID string, client *http.Client, bearer, csrf string) error {
+	body, err := json.Marshal(protocolv1.TunnelPatchRequest{
+		ID:         tunnelID,
+		Action:     protocolv1.PatchActionTakeover,
+		InstanceID: instanceID,
+	})
+	if err != nil {
+		return err
+	}
+	endpoint, err := support.ServerEndpoint(serverURL, "/api/tunnels", nil)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPatch, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if strings.TrimSpace(bearer) != "" {
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(bearer))
+	}
+	if strings.TrimSpace(csrf) != "" {
+		req.Header.Set("X-CSRF-Token", strings.TrimSpace(csrf))
+	}
+	resp, err := controlClient(client).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("takeover: %w", newAPIError(resp))
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package control
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fortunnels/client/internal/support"
+)
+
+// keepaliveRetryInitial is the first retry delay after a failed keepalive; it
+// doubles per consecutive failure, capped at the keepalive interval.
+const keepaliveRetryInitial = 15 * time.Second
+
+// RunTunnelKeepalive refreshes the tunnel's control-plane activity every
+// interval so the server does not garbage-collect a tunnel that only carries
+// data-plane traffic. It sends POST /api/tunnels/{id}/keepalive and, when the
+// server has no such endpoint (404), falls back to the GET exists-check. It
+// blocks until done is closed or the server reports the tunnel gone; a
+// non-positive interval disables it. httpClient, bearer and csrf are the same
+// credentials the rest of the control plane uses. getOnly skips the POST for
+// servers known to lack the endpoint.
+func RunTunnelKeepalive(httpClient *http.Client, serverURL, tunnelID, bearer, csrf string, interval time.Duration, getOnly bool, done <-chan struct{}) {
+	if interval <= 0 {
+		return
+	}
+	k := &tunnelKeepalive{
+		client:      ensurePollClient(httpClient),
+		serverURL:   serverURL,
+		tunnelID:    tunnelID,
+		bearer:      bearer,
+		csrf:        csrf,
+		interval:    interval,
+		after:       time.After,
+		getFallback: getOnly,
+	}
+	k.run(done)
+}
+
+type tunnelKeepalive struct {
+	client    *http.Client
+	serverURL string
+	tunnelID  string
+	bearer    string
+	csrf      string
+	interval  time.Duration
+	// after is time.After; tests substitute a fake clock.
+	after func(time.Duration) <-chan time.Time
+	// getFallback is set once the server answered 404 to the keepalive POST,
+	// or from the start when it lacks the keepalive feature.
+	getFallback bool
+}
+
+func (k *tunnelKeepalive) run(done <-chan struct{}) {
+	wait := k.interval
+	failures := 0
+	for {
+		select {
+		case <-done:
+			return
+		case <-k.after(wait):
+		}
+		gone, err := k.refresh()
+		if gone {
+			logDebug("tunnel keepalive: tunnel gone tunnelID=%s, stopping", k.tunnelID)
+			return
+		}
+		if err != nil {
+			failures++
+			wait = keepaliveBackoff(failures, k.interval)
+			log.Printf("[WARN] tunnel keepalive failed tunnelID=%s (attempt %d, retry in %s): %v",
+				k.tunnelID, failures, wait, err)
+			continue
+		}
+		if failures > 0 {
+			log.Printf("[INFO] tunnel keepalive recovered tunnelID=%s after %d failed attempts", k.tunnelID, failures)
+		}
+		failures = 0
+		wait = k.interval
+	}
+}
+
+// refresh performs one keepalive. gone reports that the tunnel no longer exists.
+func (k *tunnelKeepalive) refresh() (gone bool, err error) {
+	if !k.getFallback {
+		statusCode, err := k.post()
+		switch {
+		case err != nil:
+			return false, err
+		case statusCode >= 200 && statusCode < 300:
+			return false, nil
+		case statusCode == http.StatusGone:
+			return true, nil
+		case statusCode != http.StatusNotFound:
+			return false, &APIError{StatusCode: statusCode}
+		}
+		// 404 means either an older server without the endpoint or an
+		// unknown tunnel; the exists-check tells them apart.
+		logDebug("tunnel keepalive: POST returned 404, falling back to GET exists-check")
+		k.getFallback = true
+	}
+	poll := pollTunnel(k.client, k.serverURL, k.tunnelID, k.bearer)
+	switch {
+	case poll.terminal:
+		return true, nil
+	case poll.statusCode == 0:
+		return false, fmt.Errorf("exists-check request failed")
+	case poll.statusCode >= 400:
+		return false, fmt.Errorf("exists-check returned status %d", poll.statusCode)
+	}
+	return false, nil
+}
+
+func (k *tunnelKeepalive) post() (int, error) {
+	endpoint, err := support.ServerEndpoint(k.serverURL, "/api/tunnels/"+k.tunnelID+"/keepalive", nil)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), k.client.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, http.NoBody)
+	if err != nil {
+		return 0, err
+	}
+	if strings.TrimSpace(k.bearer) != "" {
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(k.bearer))
+	}
+	if strings.TrimSpace(k.csrf) != "" {
+		req.Header.Set("X-CSRF-Token", strings.TrimSpace(k.csrf))
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func keepaliveBackoff(failures int, interval time.Duration) time.Duration {
+	d := keepaliveRetryInitial
+	for i := 1; i < failures && d < interval; i++ {
+		d *= 2
+	}
+	return min(d, interval)
+}
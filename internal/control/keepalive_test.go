@@ -0,0 +1,191 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package control
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAfter is a fake clock for tunnelKeepalive: every wait is recorded and
+// only returns when the test calls tick.
+type fakeAfter struct {
+	waits chan time.Duration
+	fire  chan time.Time
+}
+
+func newFakeAfter() *fakeAfter {
+	return &fakeAfter{waits: make(chan time.Duration, 16), fire: make(chan time.Time)}
+}
+
+func (f *fakeAfter) after(d time.Duration) <-chan time.Time {
+	f.waits <- d
+	return f.fire
+}
+
+// tick waits for the loop to arm its next timer, checks the requested delay
+// and fires it.
+func (f *fakeAfter) tick(t *testing.T, want time.Duration) {
+	t.Helper()
+	select {
+	case d := <-f.waits:
+		require.Equal(t, want, d)
+	case <-time.After(2 * time.Second):
+		t.Fatal("keepalive did not arm a timer")
+	}
+	f.fire <- time.Now()
+}
+
+type keepaliveServer struct {
+	mu       sync.Mutex
+	requests []string
+	post     int // status for POST /keepalive
+	exists   bool
+}
+
+func (s *keepaliveServer) handler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.RequestURI())
+		post, exists := s.post, s.exists
+		s.mu.Unlock()
+		assert.Equal(t, "Bearer tok", r.Header.Get("Authorization"))
+		if r.Method == http.MethodPost {
+			assert.Equal(t, "csrf-1", r.Header.Get("X-CSRF-Token"))
+			w.WriteHeader(post)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if exists {
+			_, _ = w.Write([]byte(`{"exists":true,"tunnels":[{"id":"t-1","status":"active"}]}`))
+		} else {
+			_, _ = w.Write([]byte(`{"exists":false}`))
+		}
+	})
+}
+
+func (s *keepaliveServer) seen() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func startKeepalive(t *testing.T, srv *httptest.Server, interval time.Duration) (*fakeAfter, chan struct{}, chan struct{}) {
+	t.Helper()
+	clock := newFakeAfter()
+	k := &tunnelKeepalive{
+		client:    ensurePollClient(srv.Client()),
+		serverURL: srv.URL,
+		tunnelID:  "t-1",
+		bearer:    "tok",
+		csrf:      "csrf-1",
+		interval:  interval,
+		after:     clock.after,
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		k.run(done)
+	}()
+	return clock, done, stopped
+}
+
+func waitStopped(t *testing.T, stopped <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("keepalive did not stop")
+	}
+}
+
+func TestTunnelKeepalive_PostsEveryInterval(t *testing.T) {
+	state := &keepaliveServer{post: http.StatusNoContent, exists: true}
+	srv := httptest.NewServer(state.handler(t))
+	defer srv.Close()
+
+	clock, done, stopped := startKeepalive(t, srv, 5*time.Minute)
+	for range 3 {
+		clock.tick(t, 5*time.Minute)
+	}
+	<-clock.waits // the fourth wait is armed after the third request completed
+	close(done)
+	waitStopped(t, stopped)
+
+	want := "POST /api/tunnels/t-1/keepalive"
+	assert.Equal(t, []string{want, want, want}, state.seen())
+}
+
+func TestTunnelKeepalive_FallsBackToExistsCheckOn404(t *testing.T) {
+	state := &keepaliveServer{post: http.StatusNotFound, exists: true}
+	srv := httptest.NewServer(state.handler(t))
+	defer srv.Close()
+
+	clock, done, stopped := startKeepalive(t, srv, time.Minute)
+	clock.tick(t, time.Minute)
+	clock.tick(t, time.Minute)
+	<-clock.waits
+	close(done)
+	waitStopped(t, stopped)
+
+	assert.Equal(t, []string{
+		"POST /api/tunnels/t-1/keepalive",
+		"GET /api/tunnels?id=t-1",
+		"GET /api/tunnels?id=t-1",
+	}, state.seen(), "the endpoint is not retried once it answered 404")
+}
+
+func TestTunnelKeepalive_StopsWhenTunnelGone(t *testing.T) {
+	state := &keepaliveServer{post: http.StatusNotFound, exists: false}
+	srv := httptest.NewServer(state.handler(t))
+	defer srv.Close()
+
+	clock, _, stopped := startKeepalive(t, srv, time.Minute)
+	clock.tick(t, time.Minute)
+	waitStopped(t, stopped)
+}
+
+func TestTunnelKeepalive_BacksOffOnFailure(t *testing.T) {
+	state := &keepaliveServer{post: http.StatusInternalServerError, exists: true}
+	srv := httptest.NewServer(state.handler(t))
+	defer srv.Close()
+
+	clock, done, stopped := startKeepalive(t, srv, time.Minute)
+	clock.tick(t, time.Minute)
+	clock.tick(t, 15*time.Second)
+	clock.tick(t, 30*time.Second)
+	require.Equal(t, time.Minute, <-clock.waits, "backoff is capped at the interval")
+	state.mu.Lock()
+	state.post = http.StatusOK
+	state.mu.Unlock()
+	clock.fire <- time.Now()
+	clock.tick(t, time.Minute) // success restores the interval
+	<-clock.waits
+	close(done)
+	waitStopped(t, stopped)
+	assert.Len(t, state.seen(), 5)
+}
+
+func TestRunTunnelKeepalive_DisabledReturns(t *testing.T) {
+	returned := make(chan struct{})
+	go func() {
+		RunTunnelKeepalive(nil, "http://127.0.0.1:1", "t-1", "", "", 0, false, make(chan struct{}))
+		close(returned)
+	}()
+	waitStopped(t, returned)
+}
+
+func TestKeepaliveBackoff(t *testing.T) {
+	assert.Equal(t, 15*time.Second, keepaliveBackoff(1, 5*time.Minute))
+	assert.Equal(t, 60*time.Second, keepaliveBackoff(3, 5*time.Minute))
+	assert.Equal(t, 5*time.Minute, keepaliveBackoff(10, 5*time.Minute))
+	assert.Equal(t, time.Second, keepaliveBackoff(1, time.Second))
+}
@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package control
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+)
+
+// RemoteIPRecorder remembers the server IP the last control-plane request
+// of a RecordRemoteIP client was sent to.
+type RemoteIPRecorder struct {
+	mu sync.Mutex
+	ip string
+}
+
+// IP returns the recorded IP, or "" when no request connected directly (it
+// failed, or went through an HTTP proxy whose address says nothing about
+// the server).
+func (r *RemoteIPRecorder) IP() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ip
+}
+
+func (r *RemoteIPRecorder) record(ip string) {
+	r.mu.Lock()
+	r.ip = ip
+	r.mu.Unlock()
+}
+
+// RecordRemoteIP returns a copy of client, or of the default control-plane
+// client when nil, (cookies, timeout and retry policy shared) whose
+// requests record the remote IP of the connection they used, via
+// httptrace GotConn. The data plane pins its dials to that IP so they reach
+// the load balancer the tunnel was created on.
+func RecordRemoteIP(client *http.Client) (*http.Client, *RemoteIPRecorder) {
+	rec := &RemoteIPRecorder{}
+	c := *controlClient(client)
+	base := c.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	c.Transport = &remoteIPTransport{base: base, rec: rec}
+	return &c, rec
+}
+
+type remoteIPTransport struct {
+	base http.RoundTripper
+	rec  *RemoteIPRecorder
+}
+
+func (t *remoteIPTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if proxy, err := http.ProxyFromEnvironment(req); err != nil || proxy != nil {
+		return t.base.RoundTrip(req)
+	}
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if addr, ok := info.Conn.RemoteAddr().(*net.TCPAddr); ok {
+				t.rec.record(addr.IP.String())
+			}
+		},
+	}
+	return t.base.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
@@ -0,0 +1,40 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package control
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordRemoteIP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": "t-1", "protocol": "http"}`))
+	}))
+	defer srv.Close()
+
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	base := &http.Client{Jar: jar, Timeout: 5 * time.Second}
+	client, rec := RecordRemoteIP(base)
+	assert.Empty(t, rec.IP())
+	assert.Same(t, jar, client.Jar, "the copy keeps the session cookies")
+	assert.Nil(t, base.Transport, "the caller's client is not modified")
+
+	_, err = CreateTunnelWithClient(srv.URL, "127.0.0.1:8000", "http", "default", client, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", rec.IP())
+
+	client, rec = RecordRemoteIP(nil)
+	_, err = GetTunnel("http://127.0.0.1:1", "t-1", client, "")
+	require.Error(t, err)
+	assert.Empty(t, rec.IP(), "nothing is recorded for a failed dial")
+}
@@ -0,0 +1,184 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package control
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/dataplane"
+	"github.com/fortunnels/client/internal/support"
+	"github.com/fortunnels/client/internal/testsupport"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+func TestTunnelLifecycleAgainstStubServer(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	tun, err := CreateTunnelWithClient(stub.URL, "127.0.0.1:8000", "http", "default", client, "", "")
+	require.NoError(t, err)
+	assert.NotEmpty(t, tun.ID)
+	assert.Equal(t, "http", tun.Protocol)
+	assert.Equal(t, "127.0.0.1:8000", tun.TargetAddr)
+
+	terminal, status, code := checkTunnelTerminalWithStatusImpl(client, stub.URL, tun.ID, "")
+	assert.False(t, terminal)
+	assert.Equal(t, statusActive, status)
+	assert.Equal(t, http.StatusOK, code)
+
+	DeleteTunnelWithClient(stub.URL, tun.ID, client, "", "")
+	assert.True(t, checkTunnelTerminal(client, stub.URL, tun.ID, ""), "deleted tunnel is terminal")
+}
+
+// connectInstance opens a data-plane session for tunnelID as client instance id.
+func connectInstance(t *testing.T, stub *testsupport.Server, tunnelID, id string) func() {
+	t.Helper()
+	rt := config.RuntimeSettings{
+		PingInterval:          time.Hour,
+		PingTimeout:           time.Second,
+		SmuxKeepAliveInterval: time.Second,
+		SmuxKeepAliveTimeout:  10 * time.Second,
+		InstanceID:            id,
+	}
+	_, cleanup, err := dataplane.CreateDataPlaneSession(stub.URL, tunnelID, rt, "")
+	require.NoError(t, err)
+	return cleanup
+}
+
+func TestDuplicateInstance_SecondRefuses(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	client := &http.Client{Timeout: 5 * time.Second}
+	tun := stub.AddTunnel("tcp", "127.0.0.1:0")
+
+	defer connectInstance(t, stub, tun.ID, "instance-a")()
+	assert.Nil(t, FindOtherInstance(client, stub.URL, tun.ID, "", "instance-a", time.Second), "first instance is the active one")
+
+	closeB := connectInstance(t, stub, tun.ID, "instance-b")
+	other := FindOtherInstance(client, stub.URL, tun.ID, "", "instance-b", time.Second)
+	require.NotNil(t, other)
+	assert.Equal(t, "instance-a", other.InstanceID)
+	assert.False(t, other.ConnectedAt.IsZero())
+	closeB() // the second client refuses to serve
+
+	require.Eventually(t, func() bool {
+		live := stub.LiveInstances(tun.ID)
+		return len(live) == 1 && live[0] == "instance-a"
+	}, 5*time.Second, 10*time.Millisecond, "exactly one instance keeps serving")
+}
+
+func TestDuplicateInstance_ForceTakesOver(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	client := &http.Client{Timeout: 5 * time.Second}
+	tun := stub.AddTunnel("tcp", "127.0.0.1:0")
+
+	defer connectInstance(t, stub, tun.ID, "instance-a")()
+	exited := make(chan struct{})
+	out := &recordingOutput{}
+	go NewWatcher(out).WithInstanceID("instance-a").RunFallbackLifecyclePoller(client, stub.URL, tun.ID, "", func() { close(exited) }, 20*time.Millisecond)
+
+	defer connectInstance(t, stub, tun.ID, "instance-b")()
+	require.NotNil(t, FindOtherInstance(client, stub.URL, tun.ID, "", "instance-b", time.Second))
+	require.NoError(t, TakeOverTunnel(stub.URL, tun.ID, "instance-b", client, "", ""))
+
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("displaced instance did not exit")
+	}
+	assert.Contains(t, out.String(), MsgDisplacedExiting)
+	assert.Equal(t, []string{"instance-b"}, stub.LiveInstances(tun.ID), "exactly one instance ends up serving")
+	assert.Nil(t, FindOtherInstance(client, stub.URL, tun.ID, "", "instance-b", time.Second))
+
+	_, _, err := dataplane.CreateDataPlaneSession(stub.URL, tun.ID, config.RuntimeSettings{PingInterval: time.Hour, InstanceID: "instance-a"}, "")
+	assert.Error(t, err, "the displaced instance cannot reconnect")
+}
+
+func TestFindOtherInstance_ServerWithoutActiveClient(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	tun := stub.AddTunnel("tcp", "127.0.0.1:0")
+	assert.Nil(t, FindOtherInstance(nil, stub.URL, tun.ID, "", "instance-a", 50*time.Millisecond))
+}
+
+func TestWatchControlMessages_Migrate(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	tun := stub.AddTunnel("tcp", "127.0.0.1:0")
+
+	got := make(chan protocolv1.MigratePayload, 2)
+	stop := make(chan struct{})
+	defer close(stop)
+	w := NewWatcher(&recordingOutput{}).WithMigrateHandler(func(p protocolv1.MigratePayload) { got <- p })
+	go w.WatchControlMessages(nil, stub.URL, tun.ID, "", stop)
+	require.NoError(t, stub.WaitWatchers(tun.ID, 1, 5*time.Second))
+
+	require.NoError(t, stub.SendControl(tun.ID, protocolv1.MessageTypeMigrate, protocolv1.MigratePayload{TunnelID: tun.ID}))
+	deadline := time.Now().Add(time.Minute).UTC().Truncate(time.Second)
+	require.NoError(t, stub.SendControl(tun.ID, protocolv1.MessageTypeMigrate, protocolv1.MigratePayload{
+		TunnelID: tun.ID, Endpoint: "https://node-2.example.com", Deadline: deadline,
+	}))
+	select {
+	case p := <-got:
+		assert.Equal(t, "https://node-2.example.com", p.Endpoint, "a migrate message without an endpoint is ignored")
+		assert.True(t, deadline.Equal(p.Deadline))
+	case <-time.After(5 * time.Second):
+		t.Fatal("migrate handler not called")
+	}
+}
+
+func TestHandleMigrate_WithoutHandler(t *testing.T) {
+	out := &recordingOutput{}
+	NewWatcher(out).handleMigrate(protocolv1.NewEnvelope(protocolv1.MessageTypeMigrate, protocolv1.MigratePayload{Endpoint: "https://node-2.example.com\x1b[2J"}))
+	assert.Contains(t, out.String(), "moving to https://node-2.example.com[2J")
+}
+
+type recordingOutput struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (o *recordingOutput) UserMessage(_ support.Level, id string, args ...any) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	fmt.Fprintf(&o.buf, id, args...)
+}
+
+func (o *recordingOutput) Event(string, map[string]any) {}
+func (o *recordingOutput) Progress(string)              {}
+
+func (o *recordingOutput) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.String()
+}
+
+func TestGetTunnel_AgainstStubServer(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	client := &http.Client{Timeout: 5 * time.Second}
+	created := stub.AddTunnel("tcp", "127.0.0.1:5432")
+
+	tun, err := GetTunnel(stub.URL, created.ID, client, "")
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, tun.ID)
+	assert.Equal(t, "tcp", tun.Protocol)
+	assert.Equal(t, "127.0.0.1:5432", tun.TargetAddr)
+	assert.Equal(t, created.PublicURL, tun.PublicURL)
+
+	_, err = GetTunnel(stub.URL, "no-such-tunnel", client, "")
+	require.ErrorIs(t, err, ErrTunnelNotFound)
+	assert.Contains(t, err.Error(), "was it deleted or is the ID wrong?")
+}
@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package control
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/support"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+// startCauses starts a fresh run of support.Causes, forgotten again when
+// the test ends.
+func startCauses(t *testing.T) {
+	t.Helper()
+	support.Causes.Reset()
+	support.Causes.Start()
+	t.Cleanup(support.Causes.Reset)
+}
+
+func TestTerminalCause_ControlChannelCloseCode(t *testing.T) {
+	startCauses(t)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "restarting")
+		_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		_, _, _ = conn.ReadMessage()
+	}))
+	defer srv.Close()
+
+	conn, resp, err := dialControlWebSocket(nil, srv.URL, "t1", "")
+	require.NoError(t, err)
+	resp.Body.Close()
+	defer conn.Close()
+	done := make(chan struct{})
+	var doneOnce sync.Once
+	NewWatcher(&recordingOutput{}).startControlMessageReader(conn, make(chan struct{}, 1), make(chan time.Duration, 1), done, &doneOnce, time.Second)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("control message reader did not end")
+	}
+
+	cause, ok := support.Causes.Resolve(nil)
+	require.True(t, ok)
+	assert.Equal(t, support.CauseServer, cause.Source)
+	assert.Equal(t, "server closed control channel (code 1001 going away)", cause.String())
+	assert.Equal(t, support.ExitServerUnreachable, cause.ExitCode())
+}
+
+func TestTerminalCause_TerminalPolls(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		payload protocolv1.TunnelListResponse
+		want    string
+	}{
+		{"deleted", http.StatusOK, protocolv1.TunnelListResponse{Exists: false}, "tunnel was deleted on the server"},
+		{"expired", http.StatusOK, protocolv1.TunnelListResponse{Exists: true, Status: StatusExpired}, "tunnel expired on the server"},
+		{"access revoked", http.StatusUnauthorized, protocolv1.TunnelListResponse{}, "server revoked access to the tunnel (HTTP 401)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			startCauses(t)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_ = json.NewEncoder(w).Encode(tt.payload)
+			}))
+			defer srv.Close()
+
+			NewWatcher(&recordingOutput{}).RunFallbackLifecyclePoller(nil, srv.URL, "t1", "", func() {}, 10*time.Millisecond)
+			cause, ok := support.Causes.Resolve(support.ErrTunnelGone)
+			require.True(t, ok)
+			assert.Equal(t, support.CauseTunnelGone, cause.Source)
+			assert.Equal(t, tt.want, cause.String())
+			assert.Equal(t, support.ExitTunnelGone, cause.ExitCode())
+		})
+	}
+}
+
+func TestTerminalCause_ControlMessages(t *testing.T) {
+	tests := []struct {
+		name   string
+		msg    protocolv1.Envelope
+		source string
+		want   string
+	}{
+		{
+			name:   "tunnel closed",
+			msg:    protocolv1.NewEnvelope(protocolv1.EventTunnelClosed, protocolv1.LifecycleEventPayload{Reason: "deleted by admin"}),
+			source: support.CauseTunnelGone,
+			want:   "tunnel was closed on the server: deleted by admin",
+		},
+		{
+			name:   "expired",
+			msg:    protocolv1.NewEnvelope(protocolv1.EventTunnelUpdated, protocolv1.LifecycleEventPayload{Status: StatusExpired}),
+			source: support.CauseTunnelGone,
+			want:   "tunnel expired on the server",
+		},
+		{
+			name:   "displaced",
+			msg:    protocolv1.NewEnvelope(protocolv1.MessageTypeDisplaced, protocolv1.DisplacedPayload{InstanceID: "other"}),
+			source: support.CauseDisplaced,
+			want:   "another client instance took over the tunnel",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			startCauses(t)
+			done := make(chan struct{})
+			var doneOnce sync.Once
+			status := statusActive
+			ended := NewWatcher(&recordingOutput{}).handleControlMessage(tt.msg, nil, nil, done, &doneOnce, 0, &status)
+			require.True(t, ended)
+			cause, ok := support.Causes.Resolve(nil)
+			require.True(t, ok)
+			assert.Equal(t, tt.source, cause.Source)
+			assert.Equal(t, tt.want, cause.String())
+		})
+	}
+}
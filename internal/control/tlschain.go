@@ -0,0 +1,395 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package control
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// tlsChainVerifiedSuffix names the last chain that passed verification,
+	// tlsChainFailedSuffix the last one that did not.
+	tlsChainVerifiedSuffix = ".pem"
+	tlsChainFailedSuffix   = ".failed.pem"
+	// pemHeaderFetched and pemHeaderVerified annotate every cached block.
+	pemHeaderFetched  = "Fetched"
+	pemHeaderVerified = "Verified"
+	// tlsChainFetchTimeout bounds the diagnostic handshake after a failure.
+	tlsChainFetchTimeout = 5 * time.Second
+)
+
+// ChainChange classifies how a server's certificate chain differs from the
+// cached one.
+type ChainChange string
+
+const (
+	// ChainExpired: the leaf is past its NotAfter (or before NotBefore).
+	ChainExpired ChainChange = "expired"
+	// ChainSANMismatch: the leaf does not name the host that was dialed.
+	ChainSANMismatch ChainChange = "san_mismatch"
+	// ChainIssuerChanged: same root, different issuing CA of the leaf.
+	ChainIssuerChanged ChainChange = "issuer_changed"
+	// ChainNew: the chain ends in a different root than the cached one,
+	// which usually means a proxy or appliance intercepts TLS.
+	ChainNew ChainChange = "new_chain"
+)
+
+// CachedChain is a peer certificate chain, leaf first, with when it was
+// fetched and whether it passed verification.
+type CachedChain struct {
+	Certs    []*x509.Certificate
+	Fetched  time.Time
+	Verified bool
+}
+
+// TLSChainCache keeps the last certificate chain each server host presented
+// in dir: <host>.pem for the last verified chain, <host>.failed.pem for the
+// last chain that failed verification. Files are PEM with the fetch time in
+// every block's headers, readable with openssl.
+type TLSChainCache struct {
+	dir string
+
+	mu sync.Mutex
+	// saved remembers the chain last written per file, so reconnects with
+	// the same chain do not rewrite it.
+	saved map[string]string
+}
+
+// NewTLSChainCache returns a cache stored in dir.
+func NewTLSChainCache(dir string) *TLSChainCache {
+	return &TLSChainCache{dir: dir, saved: make(map[string]string)}
+}
+
+func (c *TLSChainCache) path(host, suffix string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		}
+		return '_'
+	}, strings.ToLower(host))
+	return filepath.Join(c.dir, name+suffix)
+}
+
+// Save records chain for host, replacing the previous chain of the same
+// kind (verified or failed).
+func (c *TLSChainCache) Save(host string, chain CachedChain) error {
+	suffix := tlsChainFailedSuffix
+	if chain.Verified {
+		suffix = tlsChainVerifiedSuffix
+	}
+	path := c.path(host, suffix)
+	fp := chainFingerprint(chain.Certs)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.saved[path] == fp {
+		return nil
+	}
+	var buf bytes.Buffer
+	for _, cert := range chain.Certs {
+		block := &pem.Block{
+			Type: "CERTIFICATE",
+			Headers: map[string]string{
+				pemHeaderFetched:  chain.Fetched.UTC().Format(time.RFC3339),
+				pemHeaderVerified: fmt.Sprint(chain.Verified),
+			},
+			Bytes: cert.Raw,
+		}
+		if err := pem.Encode(&buf, block); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(c.dir, 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	c.saved[path] = fp
+	return nil
+}
+
+// Load returns the last verified chain of host; the error wraps
+// os.ErrNotExist when there is none.
+func (c *TLSChainCache) Load(host string) (CachedChain, error) {
+	return readChain(c.path(host, tlsChainVerifiedSuffix))
+}
+
+// Files returns the cached chain files of host that exist.
+func (c *TLSChainCache) Files(host string) []string {
+	var out []string
+	for _, suffix := range []string{tlsChainVerifiedSuffix, tlsChainFailedSuffix} {
+		if p := c.path(host, suffix); fileExists(p) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func readChain(path string) (CachedChain, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return CachedChain{}, err
+	}
+	var chain CachedChain
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return CachedChain{}, fmt.Errorf("%s: %w", path, err)
+		}
+		if chain.Certs == nil {
+			chain.Fetched, _ = time.Parse(time.RFC3339, block.Headers[pemHeaderFetched])
+			chain.Verified = block.Headers[pemHeaderVerified] == "true"
+		}
+		chain.Certs = append(chain.Certs, cert)
+	}
+	if len(chain.Certs) == 0 {
+		return CachedChain{}, fmt.Errorf("%s: no certificates", path)
+	}
+	return chain, nil
+}
+
+// chainFingerprint identifies a chain by the SHA-256 of its certificates.
+func chainFingerprint(certs []*x509.Certificate) string {
+	h := sha256.New()
+	for _, cert := range certs {
+		h.Write(cert.Raw)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// captureTLS wraps tc's VerifyConnection so every verified handshake saves
+// the peer chain. It runs after normal verification, so it never loosens it.
+func (c *TLSChainCache) captureTLS(tc *tls.Config) {
+	next := tc.VerifyConnection
+	tc.VerifyConnection = func(cs tls.ConnectionState) error {
+		if next != nil {
+			if err := next(cs); err != nil {
+				return err
+			}
+		}
+		// The chain as presented (not the verified one with the local root)
+		// compares directly with what a failed handshake presents.
+		if cs.ServerName != "" && len(cs.PeerCertificates) > 0 {
+			if err := c.Save(cs.ServerName, CachedChain{Certs: cs.PeerCertificates, Fetched: time.Now(), Verified: true}); err != nil {
+				log.Printf("[DEBUG] tls chain cache: %v", err)
+			}
+		}
+		return nil
+	}
+}
+
+// InstallTLSChainCapture makes the control-plane HTTP clients (all built on
+// http.DefaultTransport) and the WebSocket dialers (copies of
+// websocket.DefaultDialer) record verified chains in c. Call it before the
+// first request.
+func InstallTLSChainCapture(c *TLSChainCache) {
+	if t, ok := http.DefaultTransport.(*http.Transport); ok {
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{}
+		}
+		c.captureTLS(t.TLSClientConfig)
+	}
+	if websocket.DefaultDialer.TLSClientConfig == nil {
+		websocket.DefaultDialer.TLSClientConfig = &tls.Config{}
+	}
+	c.captureTLS(websocket.DefaultDialer.TLSClientConfig)
+}
+
+// IsTLSVerifyError reports whether err is a failed server certificate
+// verification.
+func IsTLSVerifyError(err error) bool {
+	var (
+		verr  *tls.CertificateVerificationError
+		uaerr x509.UnknownAuthorityError
+		herr  x509.HostnameError
+		cierr x509.CertificateInvalidError
+	)
+	return errors.As(err, &verr) || errors.As(err, &uaerr) || errors.As(err, &herr) || errors.As(err, &cierr)
+}
+
+// FetchPeerChain completes a TLS handshake with addr without verifying it
+// and returns the chain the server presented. It is for diagnostics only:
+// the connection is closed without sending anything over it.
+func FetchPeerChain(ctx context.Context, addr, serverName string) ([]*x509.Certificate, error) {
+	d := tls.Dialer{Config: &tls.Config{
+		ServerName:         serverName,
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true, //nolint:gosec // chain is only inspected, never trusted
+	}}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.(*tls.Conn).ConnectionState().PeerCertificates, nil
+}
+
+// DiffChains classifies how cur, the chain host presents now, differs from
+// prev, the last chain that verified (nil when none is cached).
+func DiffChains(host string, prev, cur []*x509.Certificate, now time.Time) []ChainChange {
+	if len(cur) == 0 {
+		return nil
+	}
+	var changes []ChainChange
+	leaf := cur[0]
+	if now.After(leaf.NotAfter) || now.Before(leaf.NotBefore) {
+		changes = append(changes, ChainExpired)
+	}
+	if leaf.VerifyHostname(hostOnly(host)) != nil {
+		changes = append(changes, ChainSANMismatch)
+	}
+	if len(prev) == 0 {
+		return changes
+	}
+	switch {
+	case chainRoot(cur) != chainRoot(prev):
+		changes = append(changes, ChainNew)
+	case leaf.Issuer.String() != prev[0].Issuer.String():
+		changes = append(changes, ChainIssuerChanged)
+	}
+	return changes
+}
+
+// chainRoot names the CA the chain ends in: the issuer of its last
+// certificate, which servers usually leave out.
+func chainRoot(certs []*x509.Certificate) string {
+	return certs[len(certs)-1].Issuer.String()
+}
+
+func hostOnly(hostport string) string {
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		return h
+	}
+	return hostport
+}
+
+// WriteChainReport prints cur against the cached prev as a diff (- cached,
+// + presented now), the meaning of changes and the openssl command to look
+// closer. prev may be nil.
+func WriteChainReport(w io.Writer, addr string, prev *CachedChain, cur []*x509.Certificate, changes []ChainChange) {
+	host := hostOnly(addr)
+	if prev == nil {
+		fmt.Fprintf(w, "🔐 TLS certificate chain of %s (no earlier chain cached):\n", host)
+		for _, cert := range cur {
+			fmt.Fprintf(w, "   + %s\n", describeCert(cert))
+		}
+	} else {
+		fmt.Fprintf(w, "🔐 TLS certificate chain of %s compared with the one cached at %s:\n", host, prev.Fetched.UTC().Format(time.RFC3339))
+		in := func(certs []*x509.Certificate, c *x509.Certificate) bool {
+			return slices.ContainsFunc(certs, func(o *x509.Certificate) bool { return o.Equal(c) })
+		}
+		for _, cert := range prev.Certs {
+			if !in(cur, cert) {
+				fmt.Fprintf(w, "   - %s\n", describeCert(cert))
+			}
+		}
+		for _, cert := range cur {
+			mark := "+"
+			if in(prev.Certs, cert) {
+				mark = " "
+			}
+			fmt.Fprintf(w, "   %s %s\n", mark, describeCert(cert))
+		}
+	}
+	for _, ch := range changes {
+		fmt.Fprintf(w, "   ⚠️ %s\n", explainChange(ch, host, prev, cur))
+	}
+	if len(changes) == 0 && prev != nil {
+		fmt.Fprintln(w, "   The chain matches the cached one; check the system's trusted CAs and clock.")
+	}
+	fmt.Fprintf(w, "   Inspect it with: openssl s_client -connect %s -servername %s -showcerts </dev/null | openssl x509 -noout -text\n", addr, host)
+}
+
+func describeCert(c *x509.Certificate) string {
+	return fmt.Sprintf("%s (issuer %s, expires %s)", c.Subject, c.Issuer, c.NotAfter.UTC().Format("2006-01-02"))
+}
+
+func explainChange(ch ChainChange, host string, prev *CachedChain, cur []*x509.Certificate) string {
+	leaf := cur[0]
+	switch ch {
+	case ChainExpired:
+		return fmt.Sprintf("Certificate not valid now: valid from %s until %s (check the system clock too)",
+			leaf.NotBefore.UTC().Format(time.RFC3339), leaf.NotAfter.UTC().Format(time.RFC3339))
+	case ChainSANMismatch:
+		return fmt.Sprintf("Certificate is not issued for %s (names: %s)", host, strings.Join(leaf.DNSNames, ", "))
+	case ChainIssuerChanged:
+		return fmt.Sprintf("Issuer changed from %s to %s", prev.Certs[0].Issuer, leaf.Issuer)
+	case ChainNew:
+		return fmt.Sprintf("Entirely new chain under %s instead of %s: likely TLS interception by a proxy or security appliance",
+			chainRoot(cur), chainRoot(prev.Certs))
+	}
+	return string(ch)
+}
+
+// ExplainTLSFailure fetches the chain serverURL presents after a failed
+// verification, saves it as the host's failed chain and prints the report
+// against the cached verified chain. It does nothing for other errors.
+func ExplainTLSFailure(w io.Writer, c *TLSChainCache, serverURL string, err error) {
+	if !IsTLSVerifyError(err) {
+		return
+	}
+	u, perr := url.Parse(serverURL)
+	if perr != nil || u.Hostname() == "" {
+		return
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "443")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), tlsChainFetchTimeout)
+	defer cancel()
+	cur, ferr := FetchPeerChain(ctx, addr, u.Hostname())
+	if ferr != nil || len(cur) == 0 {
+		fmt.Fprintf(w, "🔐 Could not fetch the TLS certificate chain of %s: %v\n", addr, ferr)
+		return
+	}
+	now := time.Now()
+	if serr := c.Save(u.Hostname(), CachedChain{Certs: cur, Fetched: now}); serr != nil {
+		log.Printf("[DEBUG] tls chain cache: %v", serr)
+	}
+	var prev *CachedChain
+	var prevCerts []*x509.Certificate
+	if cached, lerr := c.Load(u.Hostname()); lerr == nil {
+		prev, prevCerts = &cached, cached.Certs
+	}
+	WriteChainReport(w, addr, prev, cur, DiffChains(addr, prevCerts, cur, now))
+}
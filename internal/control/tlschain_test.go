@@ -0,0 +1,186 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package control
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCA is a generated certificate authority for synthetic chains.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+var testSerial int64
+
+func newTestCert(t *testing.T, tmpl *x509.Certificate, parent *testCA) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	testSerial++
+	tmpl.SerialNumber = big.NewInt(testSerial)
+	if tmpl.NotBefore.IsZero() {
+		tmpl.NotBefore = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if tmpl.NotAfter.IsZero() {
+		tmpl.NotAfter = time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key}
+}
+
+func newTestRoot(t *testing.T, name string) *testCA {
+	return newTestCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: name}, IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}, nil)
+}
+
+func newTestIntermediate(t *testing.T, name string, root *testCA) *testCA {
+	return newTestCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: name}, IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}, root)
+}
+
+func newTestLeaf(t *testing.T, issuer *testCA, notAfter time.Time, names ...string) *x509.Certificate {
+	return newTestCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: names[0]}, DNSNames: names, NotAfter: notAfter}, issuer).cert
+}
+
+func TestDiffChains_Classification(t *testing.T) {
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	root := newTestRoot(t, "Test Root X1")
+	r3 := newTestIntermediate(t, "Test R3", root)
+	r10 := newTestIntermediate(t, "Test R10", root)
+	mitm := newTestIntermediate(t, "Corp Inspection CA", newTestRoot(t, "Corp Root"))
+	valid := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	cached := []*x509.Certificate{newTestLeaf(t, r3, valid, "fortunnels.ru"), r3.cert}
+
+	cases := []struct {
+		name string
+		prev []*x509.Certificate
+		cur  []*x509.Certificate
+		want []ChainChange
+	}{
+		{"unchanged", cached, cached, nil},
+		{"renewed under the same issuer", cached, []*x509.Certificate{newTestLeaf(t, r3, valid, "fortunnels.ru"), r3.cert}, nil},
+		{"expired", cached, []*x509.Certificate{newTestLeaf(t, r3, now.Add(-time.Hour), "fortunnels.ru"), r3.cert}, []ChainChange{ChainExpired}},
+		{"san mismatch", cached, []*x509.Certificate{newTestLeaf(t, r3, valid, "other.example"), r3.cert}, []ChainChange{ChainSANMismatch}},
+		{"issuer changed", cached, []*x509.Certificate{newTestLeaf(t, r10, valid, "fortunnels.ru"), r10.cert}, []ChainChange{ChainIssuerChanged}},
+		{"intercepted", cached, []*x509.Certificate{newTestLeaf(t, mitm, valid, "fortunnels.ru"), mitm.cert}, []ChainChange{ChainNew}},
+		{"expired and intercepted", cached, []*x509.Certificate{newTestLeaf(t, mitm, now.Add(-time.Hour), "fortunnels.ru"), mitm.cert}, []ChainChange{ChainExpired, ChainNew}},
+		{"no cache still checks the leaf", nil, []*x509.Certificate{newTestLeaf(t, mitm, now.Add(-time.Hour), "other.example")}, []ChainChange{ChainExpired, ChainSANMismatch}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, DiffChains("fortunnels.ru:443", tc.prev, tc.cur, now))
+		})
+	}
+}
+
+func TestTLSChainCache_SaveLoad(t *testing.T) {
+	root := newTestRoot(t, "Test Root X1")
+	r3 := newTestIntermediate(t, "Test R3", root)
+	chain := []*x509.Certificate{newTestLeaf(t, r3, time.Time{}, "fortunnels.ru"), r3.cert}
+	fetched := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	c := NewTLSChainCache(t.TempDir())
+	_, err := c.Load("fortunnels.ru")
+	require.ErrorIs(t, err, os.ErrNotExist)
+	assert.Empty(t, c.Files("fortunnels.ru"))
+
+	require.NoError(t, c.Save("fortunnels.ru", CachedChain{Certs: chain, Fetched: fetched, Verified: true}))
+	got, err := c.Load("fortunnels.ru")
+	require.NoError(t, err)
+	assert.True(t, got.Verified)
+	assert.Equal(t, fetched, got.Fetched)
+	require.Len(t, got.Certs, 2)
+	assert.True(t, got.Certs[0].Equal(chain[0]))
+
+	// A failed chain goes next to the verified one and does not replace it.
+	require.NoError(t, c.Save("fortunnels.ru", CachedChain{Certs: chain[1:], Fetched: fetched}))
+	got, err = c.Load("fortunnels.ru")
+	require.NoError(t, err)
+	assert.Len(t, got.Certs, 2)
+	files := c.Files("fortunnels.ru")
+	require.Len(t, files, 2)
+	pem, err := os.ReadFile(files[1])
+	require.NoError(t, err)
+	assert.Contains(t, string(pem), "Fetched: 2026-10-01T12:00:00Z")
+	assert.Contains(t, string(pem), "Verified: false")
+}
+
+func TestTLSChainCache_CapturesVerifiedHandshake(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	defer srv.Close()
+	c := NewTLSChainCache(t.TempDir())
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	tc := &tls.Config{RootCAs: pool, ServerName: "example.com"}
+	c.captureTLS(tc)
+	resp, err := (&http.Client{Transport: &http.Transport{TLSClientConfig: tc}}).Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	got, err := c.Load("example.com")
+	require.NoError(t, err)
+	assert.True(t, got.Certs[0].Equal(srv.Certificate()))
+	assert.WithinDuration(t, time.Now(), got.Fetched, time.Minute)
+
+	// Verification failures are not captured as verified chains.
+	other := NewTLSChainCache(t.TempDir())
+	bad := &tls.Config{ServerName: "example.com"}
+	other.captureTLS(bad)
+	_, err = (&http.Client{Transport: &http.Transport{TLSClientConfig: bad}}).Get(srv.URL)
+	require.Error(t, err)
+	assert.True(t, IsTLSVerifyError(err))
+	assert.Empty(t, other.Files("example.com"))
+}
+
+func TestExplainTLSFailure_ReportsNewChain(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	defer srv.Close()
+	c := NewTLSChainCache(t.TempDir())
+	root := newTestRoot(t, "Test Root X1")
+	r3 := newTestIntermediate(t, "Test R3", root)
+	cached := []*x509.Certificate{newTestLeaf(t, r3, time.Now().Add(time.Hour), "127.0.0.1"), r3.cert}
+	require.NoError(t, c.Save("127.0.0.1", CachedChain{Certs: cached, Fetched: time.Now().Add(-time.Hour), Verified: true}))
+
+	_, err := http.Get(srv.URL)
+	require.True(t, IsTLSVerifyError(err), "httptest certificates are not trusted: %v", err)
+
+	var out strings.Builder
+	ExplainTLSFailure(&out, c, srv.URL, err)
+	report := out.String()
+	assert.Contains(t, report, "compared with the one cached at")
+	assert.Contains(t, report, "   - CN=127.0.0.1")
+	assert.Contains(t, report, "   + O=Acme Co")
+	assert.Contains(t, report, "Entirely new chain")
+	assert.Contains(t, report, "openssl s_client -connect "+strings.TrimPrefix(srv.URL, "https://"))
+	assert.Len(t, c.Files("127.0.0.1"), 2, "the presented chain is kept as the failed one")
+
+	out.Reset()
+	ExplainTLSFailure(&out, c, srv.URL, errors.New("connection refused"))
+	assert.Empty(t, out.String(), "other errors are left alone")
+}
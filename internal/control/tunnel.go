@@ -7,23 +7,26 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"net/http"
 	"net/url"
-	"os"
 	"strings"
 	"time"
 	"unicode/utf8"
 
+	"github.com/fortunnels/client/internal/support"
 	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
 )
 
 type Response = protocolv1.Tunnel
 
 // createTunnelWithClient allows passing http.Client (with cookiejar), bearer token, and optional CSRF header for session auth.
+// A rejection by the server is returned as *APIError, a redirect as
+// ErrAPIRedirect. Both 201 and 200 are success (see decodeCreatedTunnel).
 func CreateTunnelWithClient(
 	serverURL, localAddr, protocol, userID string,
 	client *http.Client,
@@ -50,10 +53,12 @@ func CreateTunnelWithClient(
 		return nil, err
 	}
 
-	// Build request
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
-	req, err := http.NewRequestWithContext(ctx, "POST", serverURL+"/api/tunnels", bytes.NewBuffer(jsonData))
+	// Build request; the client's policy bounds it (HTTPClient).
+	endpoint, err := support.ServerEndpoint(serverURL, "/api/tunnels", nil)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), "POST", endpoint, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, err
 	}
@@ -64,36 +69,112 @@ func CreateTunnelWithClient(
 	if strings.TrimSpace(csrf) != "" {
 		req.Header.Set("X-CSRF-Token", strings.TrimSpace(csrf))
 	}
-	// Select client
-	var hc *http.Client
-	if client != nil {
-		hc = client
-	} else {
-		hc = &http.Client{Timeout: 10 * time.Second}
-	}
-	resp, err := hc.Do(req)
+	resp, err := noRedirects(controlClient(client)).Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusCreated {
-		// Try to read error message from response body
-		//nolint:errcheck // best-effort read of error body
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		bodyStr := truncateErrorBody(strings.TrimSpace(string(bodyBytes)))
-		if bodyStr != "" {
-			return nil, fmt.Errorf("server returned status %d: %s", resp.StatusCode, bodyStr)
-		}
-		return nil, fmt.Errorf("server returned status %d", resp.StatusCode)
+	switch {
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		return nil, fmt.Errorf("%w (status %d to %s)", ErrAPIRedirect, resp.StatusCode, support.SanitizeRemote(resp.Header.Get("Location")))
+	case resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK:
+		return nil, newAPIError(resp)
 	}
 
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxTunnelResponseBody))
+	if err != nil {
+		return nil, fmt.Errorf("read tunnel creation response: %w", err)
+	}
+	return decodeCreatedTunnel(body)
+}
+
+// ErrAPIRedirect is returned by CreateTunnelWithClient when the server
+// answers with a redirect, which a POST is not sent on to: usually a gateway
+// adding a trailing slash to a --server with a path.
+var ErrAPIRedirect = errors.New("server redirected the API call — check --server path")
+
+// maxTunnelResponseBody bounds how much of a tunnel creation response is read.
+const maxTunnelResponseBody = 1 << 20
+
+// noRedirects returns a copy of client that hands redirects back to the
+// caller instead of following them.
+func noRedirects(client *http.Client) *http.Client {
+	c := *client
+	c.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	return &c
+}
+
+// decodeCreatedTunnel decodes a tunnel creation response: the tunnel object
+// itself, or one wrapped by a gateway in {"data": ...} or {"tunnel": ...}.
+// A body that yields no tunnel ID is an error quoting it.
+func decodeCreatedTunnel(body []byte) (*Response, error) {
 	var tunnel Response
-	if err := json.NewDecoder(resp.Body).Decode(&tunnel); err != nil {
+	if json.Unmarshal(body, &tunnel) == nil && tunnel.ID != "" {
+		return &tunnel, nil
+	}
+	var envelope struct {
+		Data   *Response `json:"data"`
+		Tunnel *Response `json:"tunnel"`
+	}
+	if json.Unmarshal(body, &envelope) == nil {
+		for _, t := range []*Response{envelope.Data, envelope.Tunnel} {
+			if t != nil && t.ID != "" {
+				return t, nil
+			}
+		}
+	}
+	excerpt := truncateErrorBody(strings.TrimSpace(string(body)))
+	if excerpt == "" {
+		excerpt = "empty body"
+	}
+	return nil, fmt.Errorf("server accepted the tunnel but its response has no tunnel ID: %s", excerpt)
+}
+
+// ErrTunnelNotFound is returned by GetTunnel when the server has no tunnel
+// with the requested ID.
+var ErrTunnelNotFound = errors.New("tunnel not found — was it deleted or is the ID wrong?")
+
+// GetTunnel fetches an existing tunnel via GET /api/tunnels?id=<id>, for
+// tunnels created outside the client (e.g. by operator automation).
+func GetTunnel(serverURL, tunnelID string, client *http.Client, bearer string) (*Response, error) {
+	endpoint, err := support.ServerEndpoint(serverURL, "/api/tunnels", url.Values{"id": {tunnelID}})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), "GET", endpoint, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(bearer) != "" {
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(bearer))
+	}
+	resp, err := controlClient(client).Do(req)
+	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 
-	return &tunnel, nil
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrTunnelNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+
+	var payload protocolv1.TunnelListResponse
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return nil, err
+	}
+	if !payload.Exists {
+		return nil, ErrTunnelNotFound
+	}
+	for i := range payload.Tunnels {
+		if payload.Tunnels[i].ID == tunnelID {
+			return &payload.Tunnels[i], nil
+		}
+	}
+	return nil, ErrTunnelNotFound
 }
 
 const maxTunnelErrorBodyRunes = 200
@@ -103,10 +184,16 @@ func truncateErrorBody(body string) string {
 		return ""
 	}
 	if utf8.RuneCountInString(body) <= maxTunnelErrorBodyRunes {
-		return body
+		return support.SanitizeRemote(body)
 	}
 	runes := []rune(body)
-	return string(runes[:maxTunnelErrorBodyRunes]) + "..."
+	return support.SanitizeRemote(string(runes[:maxTunnelErrorBodyRunes]) + "...")
+}
+
+// DisplayPublicURL returns the public URL as shown to users, with loopback
+// TCP/UDP ingress hosts replaced by the server host.
+func DisplayPublicURL(serverURL string, tunnel *Response) string {
+	return rewriteIngressPublicURL(serverURL, tunnel.PublicURL)
 }
 
 // rewriteIngressPublicURL replaces loopback hosts in tcp:// and udp:// URLs with the API server's
@@ -151,71 +238,144 @@ func DeleteTunnelWithClient(serverURL, tunnelID string, client *http.Client, bea
 	if tunnelID == "" {
 		return
 	}
-	hc := client
-	if hc == nil {
-		hc = &http.Client{Timeout: 5 * time.Second}
-	}
 	log.Printf("[WARN] attempting cleanup of tunnel %s", tunnelID)
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	params := url.Values{}
-	params.Set("id", tunnelID)
-	req, err := http.NewRequestWithContext(ctx, "DELETE", serverURL+"/api/tunnels?"+params.Encode(), http.NoBody)
-	if err != nil {
+	if err := DeleteTunnel(serverURL, tunnelID, client, bearer, csrf); err != nil {
 		log.Printf("[ERROR] cleanup failed tunnelID=%s: %v", tunnelID, err)
 		return
 	}
+	log.Printf("[INFO] cleanup succeeded tunnelID=%s", tunnelID)
+}
+
+// DeleteTunnel sends DELETE /api/tunnels?id=<id>; a rejection by the server
+// is returned as *APIError.
+func DeleteTunnel(serverURL, tunnelID string, client *http.Client, bearer, csrf string) error {
+	endpoint, err := support.ServerEndpoint(serverURL, "/api/tunnels", url.Values{"id": {tunnelID}})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), "DELETE", endpoint, http.NoBody)
+	if err != nil {
+		return err
+	}
 	if strings.TrimSpace(bearer) != "" {
 		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(bearer))
 	}
 	if strings.TrimSpace(csrf) != "" {
 		req.Header.Set("X-CSRF-Token", strings.TrimSpace(csrf))
 	}
-	resp, err := hc.Do(req)
+	resp, err := controlClient(client).Do(req)
 	if err != nil {
-		log.Printf("[ERROR] cleanup failed tunnelID=%s: %v", tunnelID, err)
-		return
+		return err
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		log.Printf("[INFO] cleanup succeeded tunnelID=%s", tunnelID)
-	} else {
-		log.Printf("[ERROR] cleanup failed tunnelID=%s status=%d", tunnelID, resp.StatusCode)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return newAPIError(resp)
 	}
+	return nil
+}
+
+// TunnelBytesUsed returns the traffic the server counted for tunnelID
+// (bytes_used), for comparing with the client's own accounting. ok is false
+// when the tunnel could not be read, e.g. because it was already deleted.
+func TunnelBytesUsed(httpClient *http.Client, serverURL, tunnelID, bearer string) (bytesUsed int64, ok bool) {
+	poll := pollTunnel(ensurePollClient(httpClient), serverURL, tunnelID, bearer)
+	return poll.bytesUsed, poll.found
 }
 
 // printTunnelInfo displays comprehensive information about the created tunnel.
 // serverURL is the API base URL (e.g. https://fortunnels.ru); used to fix tcp/udp loopback public URLs in the CLI.
 func PrintTunnelInfo(serverURL string, tunnel *Response) {
-	PrintTunnelInfoWithOutput(StdOutput{}, serverURL, tunnel)
+	PrintTunnelInfoWithOutput(support.StdReporter{}, serverURL, tunnel)
 }
 
-func PrintTunnelInfoWithOutput(out Output, serverURL string, tunnel *Response) {
+func PrintTunnelInfoWithOutput(out support.Reporter, serverURL string, tunnel *Response) {
 	if out == nil {
-		out = StdOutput{}
+		out = support.StdReporter{}
+	}
+	out.UserMessage(support.LevelInfo, "✅ Tunnel created successfully!\n")
+	printTunnelDetails(out, serverURL, tunnel)
+}
+
+// PrintExistingTunnelInfo is PrintTunnelInfo for a tunnel the client did not
+// create (--tunnel-id).
+func PrintExistingTunnelInfo(serverURL string, tunnel *Response) {
+	out := support.StdReporter{}
+	out.UserMessage(support.LevelInfo, "✅ Using existing tunnel (%s://%s)\n", tunnel.Protocol, tunnel.TargetAddr)
+	printTunnelDetails(out, serverURL, tunnel)
+}
+
+func printTunnelDetails(out support.Reporter, serverURL string, tunnel *Response) {
+	out.UserMessage(support.LevelInfo, "🔗 Public URL: %s\n", DisplayPublicURL(serverURL, tunnel))
+	out.UserMessage(support.LevelInfo, "🆔 Tunnel ID: %s\n", tunnel.ID)
+	out.UserMessage(support.LevelInfo, "📊 Status: %s\n", support.SanitizeRemote(tunnel.Status))
+	printTunnelNotices(out, tunnel)
+}
+
+// printTunnelNotices prints the notices the server sent with tunnel or,
+// without any, a description of its limits.
+func printTunnelNotices(out support.Reporter, tunnel *Response) {
+	for _, n := range tunnel.Notices {
+		icon := "ℹ️"
+		if n.Severity == protocolv1.NoticeWarning {
+			icon = "⚠️ "
+		}
+		out.UserMessage(support.LevelInfo, "%s %s\n", icon, support.SanitizeRemote(n.Text))
+	}
+	if len(tunnel.Notices) > 0 {
+		return
+	}
+	var limits []string
+	var limitsOf protocolv1.TunnelLimits
+	if tunnel.Limits != nil {
+		limitsOf = *tunnel.Limits
+	}
+	switch {
+	case !tunnel.ExpiresAt.IsZero():
+		limits = append(limits, "expires "+support.FormatTimeFrom(tunnel.ExpiresAt, time.Now()))
+	case limitsOf.TTL > 0:
+		limits = append(limits, "lifetime "+(time.Duration(limitsOf.TTL)*time.Second).String())
+	}
+	traffic := limitsOf.TrafficBytes
+	if traffic <= 0 {
+		traffic = tunnel.TrafficLimitBytes
+	}
+	if traffic > 0 {
+		limits = append(limits, "traffic limit "+formatLimitBytes(traffic))
+	}
+	switch {
+	case tunnel.IsGuest && len(limits) > 0:
+		out.UserMessage(support.LevelInfo, "ℹ️ Guest tunnel: %s.\n", strings.Join(limits, ", "))
+	case tunnel.IsGuest:
+		out.UserMessage(support.LevelInfo, "ℹ️ Guest tunnel.\n")
+	case tunnel.Limits != nil && len(limits) > 0:
+		out.UserMessage(support.LevelInfo, "ℹ️ Tunnel limits: %s.\n", strings.Join(limits, ", "))
+	}
+}
+
+// formatLimitBytes renders a byte limit with a binary unit prefix, e.g.
+// "1 GiB" or "1.5 GiB".
+func formatLimitBytes(n int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	unit, i := int64(1), 0
+	for n >= unit*1024 && i < len(units)-1 {
+		unit *= 1024
+		i++
 	}
-	out.Printf("✅ Tunnel created successfully!\n")
-	out.Printf("🔗 Public URL: %s\n", rewriteIngressPublicURL(serverURL, tunnel.PublicURL))
-	out.Printf("🆔 Tunnel ID: %s\n", tunnel.ID)
-	out.Printf("📊 Status: %s\n", tunnel.Status)
-	if tunnel.IsGuest {
-		out.Printf(
-			"ℹ️ Гостевой туннель: срок жизни до %s, лимит трафика 1 GB.\n",
-			tunnel.ExpiresAt.Local().Format("2006-01-02 15:04:05"),
-		)
+	if n%unit == 0 {
+		return fmt.Sprintf("%d %s", n/unit, units[i])
 	}
+	return fmt.Sprintf("%.1f %s", float64(n)/float64(unit), units[i])
 }
 
 // PrintHTTPHints prints host-based public URL usage for HTTP tunnels.
 func PrintHTTPHints(t *Response) {
-	PrintHTTPHintsWithOutput(StdOutput{}, t)
+	PrintHTTPHintsWithOutput(support.StdReporter{}, t)
 }
 
-func PrintHTTPHintsWithOutput(out Output, t *Response) {
+func PrintHTTPHintsWithOutput(out support.Reporter, t *Response) {
 	if out == nil {
-		out = StdOutput{}
+		out = support.StdReporter{}
 	}
-	out.Println("\n💡 Usage hints (HTTP):")
-	out.Printf("- Host-based (most transparent): %s\n", t.PublicURL)
-	_ = os.Stdout.Sync()
+	out.UserMessage(support.LevelInfo, "\n💡 Usage hints (HTTP):\n")
+	out.UserMessage(support.LevelInfo, "- Host-based (most transparent): %s\n", t.PublicURL)
 }
@@ -5,10 +5,18 @@ package control
 
 import (
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/support"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
 )
 
 func TestRewriteIngressPublicURL(t *testing.T) {
@@ -68,3 +76,152 @@ func TestResponseUnmarshalGuestUser(t *testing.T) {
 	assert.Equal(t, int64(0), resp.UserID, "Expected UserID=0 for guest")
 	assert.True(t, resp.IsGuest, "Expected IsGuest=true")
 }
+
+func TestGetTunnel_StatusAndAuth(t *testing.T) {
+	var gotAuth, gotID string
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		gotID = r.URL.Query().Get("id")
+		if status != http.StatusOK {
+			http.Error(w, "nope", status)
+			return
+		}
+		_, _ = w.Write([]byte(`{"exists":true,"tunnels":[{"id":"op-1","protocol":"http","target_addr":"127.0.0.1:3000","public_url":"https://op-1.example"}],"count":1,"total":1}`))
+	}))
+	defer srv.Close()
+
+	tun, err := GetTunnel(srv.URL, "op-1", nil, "tok")
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer tok", gotAuth)
+	assert.Equal(t, "op-1", gotID)
+	assert.Equal(t, "https://op-1.example", tun.PublicURL)
+	assert.Equal(t, "127.0.0.1:3000", tun.TargetAddr)
+
+	_, err = GetTunnel(srv.URL, "other", nil, "tok")
+	assert.ErrorIs(t, err, ErrTunnelNotFound, "a payload without the requested ID")
+
+	status = http.StatusNotFound
+	_, err = GetTunnel(srv.URL, "op-1", nil, "tok")
+	assert.ErrorIs(t, err, ErrTunnelNotFound)
+
+	status = http.StatusForbidden
+	_, err = GetTunnel(srv.URL, "op-1", nil, "tok")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrTunnelNotFound)
+	assert.Equal(t, "server returned status 403: nope", err.Error())
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusForbidden, apiErr.StatusCode)
+	assert.Equal(t, support.ExitAuth, support.TunnelCreationExitCode(fmt.Errorf("fetch: %w", err)))
+}
+
+func TestCreateTunnelWithClient_SuccessShapes(t *testing.T) {
+	const tunnelJSON = `{"id":"t-1","public_url":"https://t-1.example"}`
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{"bare 201", http.StatusCreated, tunnelJSON, ""},
+		{"bare 200", http.StatusOK, tunnelJSON, ""},
+		{"data envelope", http.StatusOK, `{"data":` + tunnelJSON + `}`, ""},
+		{"tunnel envelope", http.StatusCreated, `{"tunnel":` + tunnelJSON + `,"request_id":"r"}`, ""},
+		{"no ID", http.StatusCreated, `{"public_url":"https://t-1.example"}`, `response has no tunnel ID: {"public_url":"https://t-1.example"}`},
+		{"envelope without ID", http.StatusOK, `{"data":{"status":"ok"}}`, `response has no tunnel ID: {"data":{"status":"ok"}}`},
+		{"not JSON", http.StatusOK, `<html>ok</html>`, "response has no tunnel ID: <html>ok</html>"},
+		{"empty", http.StatusOK, ``, "response has no tunnel ID: empty body"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			tun, err := CreateTunnelWithClient(srv.URL, "127.0.0.1:8000", "http", "default", nil, "", "")
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "t-1", tun.ID)
+			assert.Equal(t, "https://t-1.example", tun.PublicURL)
+		})
+	}
+}
+
+func TestCreateTunnelWithClient_Redirect(t *testing.T) {
+	var posts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/tunnels" {
+			http.Redirect(w, r, "/api/tunnels/", http.StatusPermanentRedirect)
+			return
+		}
+		posts++
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	_, err := CreateTunnelWithClient(srv.URL, "127.0.0.1:8000", "http", "default", nil, "", "")
+	require.ErrorIs(t, err, ErrAPIRedirect)
+	assert.Contains(t, err.Error(), "status 308 to /api/tunnels/")
+	assert.Zero(t, posts, "the redirect is not followed")
+}
+
+// TestPrintTunnelInfo_Notices decodes the notices and limits of a tunnel and
+// checks the lines printed for them.
+func TestPrintTunnelInfo_Notices(t *testing.T) {
+	head := "✅ Tunnel created successfully!\n🔗 Public URL: https://g1.example\n🆔 Tunnel ID: g1\n📊 Status: active\n"
+	tests := []struct {
+		name  string
+		extra string
+		want  string
+	}{
+		{
+			name:  "server notices",
+			extra: `"notices":[{"severity":"info","text":"Гостевой туннель: 1 ГБ"},{"severity":"warning","text":"ends soon\u001b[2J"}],"limits":{"traffic_bytes":1073741824,"ttl":7200}`,
+			want:  "ℹ️ Гостевой туннель: 1 ГБ\n⚠️  ends soon[2J\n",
+		},
+		{
+			name:  "limits only",
+			extra: `"limits":{"traffic_bytes":1610612736,"ttl":7200}`,
+			want:  "ℹ️ Guest tunnel: lifetime 2h0m0s, traffic limit 1.5 GiB.\n",
+		},
+		{
+			name:  "legacy traffic limit",
+			extra: `"traffic_limit_bytes":1073741824`,
+			want:  "ℹ️ Guest tunnel: traffic limit 1 GiB.\n",
+		},
+		{
+			name: "neither",
+			want: "ℹ️ Guest tunnel.\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"id":"g1","protocol":"http","public_url":"https://g1.example","status":"active","is_guest":true`
+			if tt.extra != "" {
+				body += "," + tt.extra
+			}
+			var resp Response
+			require.NoError(t, json.Unmarshal([]byte(body+"}"), &resp))
+			out := &recordingOutput{}
+			PrintTunnelInfoWithOutput(out, "https://fortunnels.ru", &resp)
+			assert.Equal(t, head+tt.want, out.String())
+		})
+	}
+}
+
+func TestPrintTunnelInfo_LimitsOfRegisteredTunnel(t *testing.T) {
+	expires := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	out := &recordingOutput{}
+	printTunnelNotices(out, &Response{ExpiresAt: expires, Limits: &protocolv1.TunnelLimits{TrafficBytes: 10 << 30}})
+	assert.Regexp(t, `^ℹ️ Tunnel limits: expires `+regexp.QuoteMeta(support.FormatTime(expires))+` \((in )?\d+d( \d+h)?( ago)?\), traffic limit 10 GiB\.\n$`, out.String())
+
+	out = &recordingOutput{}
+	printTunnelNotices(out, &Response{TrafficLimitBytes: 1 << 30})
+	assert.Empty(t, out.String(), "nothing without limits from the server")
+}
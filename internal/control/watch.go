@@ -7,12 +7,14 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os"
+	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
@@ -20,15 +22,13 @@ import (
 
 	"github.com/fortunnels/client/internal/config"
 	"github.com/fortunnels/client/internal/dataplane"
+	"github.com/fortunnels/client/internal/support"
 )
 
-var debugLogging = strings.Contains(
-	strings.ToLower(strings.TrimSpace(os.Getenv("LOG_LEVEL"))), "debug",
-)
-
-// logDebug logs at DEBUG level when LOG_LEVEL env contains "debug" or "DEBUG".
+// logDebug logs at DEBUG level (LOG_LEVEL=debug, or log_level in a reloaded
+// config file).
 func logDebug(format string, args ...any) {
-	if debugLogging {
+	if support.DebugEnabled() {
 		log.Printf("[DEBUG] "+format, args...)
 	}
 }
@@ -43,14 +43,45 @@ const (
 )
 
 type Watcher struct {
-	out Output
+	out support.Reporter
+	// instanceID, when set, makes the pollers exit once the server reports a
+	// different client instance serving the tunnel (see WithInstanceID).
+	instanceID string
+	// wasDisplaced records that the watcher stopped because of a takeover.
+	wasDisplaced atomic.Bool
+	// onMigrate moves the data plane when the server announces maintenance
+	// of its node (see WithMigrateHandler).
+	onMigrate func(protocolv1.MigratePayload)
+	// clock times the pollers, the control ping and the ACK wait.
+	clock support.Clock
 }
 
-func NewWatcher(out Output) *Watcher {
+func NewWatcher(out support.Reporter) *Watcher {
 	if out == nil {
-		out = StdOutput{}
+		out = support.StdReporter{}
 	}
-	return &Watcher{out: out}
+	return &Watcher{out: out, clock: support.RealClock}
+}
+
+// WithInstanceID makes w treat the tunnel as lost once another client
+// instance takes it over.
+func (w *Watcher) WithInstanceID(id string) *Watcher {
+	w.instanceID = id
+	return w
+}
+
+// WithMigrateHandler makes w call fn for every migrate message, from the
+// goroutine reading control messages. Without a handler the message is only
+// printed.
+func (w *Watcher) WithMigrateHandler(fn func(protocolv1.MigratePayload)) *Watcher {
+	w.onMigrate = fn
+	return w
+}
+
+// Displaced reports whether w stopped because another client instance took
+// over the tunnel, as opposed to the tunnel being deleted or expired.
+func (w *Watcher) Displaced() bool {
+	return w.wasDisplaced.Load()
 }
 
 func detectAuthMode(client *http.Client, bearer string) authMode {
@@ -90,9 +121,9 @@ func (w *Watcher) ConnectWebSocketWithAuth(httpClient *http.Client, serverURL, t
 	}
 	defer conn.Close()
 
-	w.out.Printf("✅ WebSocket connected\n")
+	w.out.UserMessage(support.LevelInfo, "✅ WebSocket connected\n")
 
-	ticker := time.NewTicker(runtime.PingInterval)
+	ticker := w.clock.NewTicker(runtime.PingInterval)
 	defer ticker.Stop()
 
 	done := make(chan struct{})
@@ -110,7 +141,7 @@ func (w *Watcher) ConnectWebSocketWithAuth(httpClient *http.Client, serverURL, t
 
 func runPingLoop(
 	conn *websocket.Conn,
-	ticker *time.Ticker,
+	ticker support.Ticker,
 	pingTimeout time.Duration,
 	done chan struct{},
 	doneOnce *sync.Once,
@@ -120,12 +151,14 @@ func runPingLoop(
 
 func (w *Watcher) warnOnMissingAck(ackCh <-chan struct{}) {
 	go func() {
+		timer := w.clock.NewTimer(5 * time.Second)
+		defer timer.Stop()
 		select {
 		case <-ackCh:
 			return
-		case <-time.After(5 * time.Second):
+		case <-timer.C():
 			logDebug("falling back from WS subscription ACK path to HTTP poll path")
-			w.out.Println("⚠️ No 'subscribed' ACK received from server; relying on fallback monitoring")
+			w.out.UserMessage(support.LevelInfo, "⚠️ No 'subscribed' ACK received from server; relying on fallback monitoring\n")
 		}
 	}()
 }
@@ -146,16 +179,23 @@ func (w *Watcher) startFallbackTunnelWatcherWithAuth(
 	logDebug("fallback tunnel watcher: auth mode=%s tunnelID=%s", mode, tunnelID)
 
 	go func() {
-		ticker := time.NewTicker(initialInterval)
+		defer support.Recover(support.PanicScope{Role: "fallback tunnel watcher", TunnelID: tunnelID})
+		ticker := w.clock.NewTicker(initialInterval)
 		defer ticker.Stop()
 		var consecutiveFailures int
 		lastStatus := statusActive
 		for {
 			select {
-			case <-ticker.C:
-				terminal, status, statusCode := checkTunnelTerminalWithStatusImpl(client, serverURL, tunnelID, bearer)
+			case <-ticker.C():
+				poll := pollTunnel(client, serverURL, tunnelID, bearer)
+				terminal, status, statusCode := poll.terminal, poll.status, poll.statusCode
 				if terminal {
-					w.out.Println(MsgTunnelRemovedExiting)
+					reportTerminalPoll(poll)
+					w.out.UserMessage(support.LevelInfo, MsgTunnelRemovedExiting+"\n")
+					doneOnce.Do(func() { close(done) })
+					return
+				}
+				if w.displaced(poll) {
 					doneOnce.Do(func() { close(done) })
 					return
 				}
@@ -202,16 +242,16 @@ const (
 	statusPaused    = protocolv1.StatusPaused
 )
 
-// ensurePollClient returns a client suitable for polling. If httpClient is nil or
-// has no timeout, a default client with 2s timeout is used. Preserves cookie jar
-// when present for session auth.
+// ensurePollClient returns a client suitable for polling. If httpClient is nil,
+// the default control-plane client is used; one without a timeout gets the
+// default policy's. Preserves cookie jar when present for session auth.
 func ensurePollClient(httpClient *http.Client) *http.Client {
 	if httpClient == nil {
-		return &http.Client{Timeout: 2 * time.Second}
+		return controlClient(nil)
 	}
 	if httpClient.Timeout <= 0 {
 		c := *httpClient
-		c.Timeout = 2 * time.Second
+		c.Timeout = DefaultHTTPClient().Timeout
 		return &c
 	}
 	return httpClient
@@ -230,15 +270,21 @@ func (w *Watcher) RunFallbackLifecyclePoller(httpClient *http.Client, serverURL,
 	mode := detectAuthMode(client, bearer)
 	logDebug("fallback lifecycle poller: auth mode=%s tunnelID=%s", mode, tunnelID)
 
-	ticker := time.NewTicker(interval)
+	ticker := w.clock.NewTicker(interval)
 	defer ticker.Stop()
 	var consecutiveFailures int
 	lastStatus := statusActive
 	for {
-		<-ticker.C
-		terminal, status, statusCode := checkTunnelTerminalWithStatusImpl(client, serverURL, tunnelID, bearer)
+		<-ticker.C()
+		poll := pollTunnel(client, serverURL, tunnelID, bearer)
+		terminal, status, statusCode := poll.terminal, poll.status, poll.statusCode
 		if terminal {
-			w.out.Println(MsgTunnelRemovedExiting)
+			reportTerminalPoll(poll)
+			w.out.UserMessage(support.LevelInfo, MsgTunnelRemovedExiting+"\n")
+			onTerminal()
+			return
+		}
+		if w.displaced(poll) {
 			onTerminal()
 			return
 		}
@@ -276,22 +322,43 @@ func checkTunnelTerminal(client *http.Client, serverURL, tunnelID, bearer string
 }
 
 func checkTunnelTerminalWithStatusImpl(client *http.Client, serverURL, tunnelID, bearer string) (terminal bool, status string, statusCode int) {
+	poll := pollTunnel(client, serverURL, tunnelID, bearer)
+	return poll.terminal, poll.status, poll.statusCode
+}
+
+// tunnelPoll is the outcome of one GET /api/tunnels?id=<id>.
+type tunnelPoll struct {
+	terminal     bool
+	status       string
+	statusCode   int
+	activeClient *protocolv1.ActiveClient
+	// bytesUsed is the server's traffic count; found reports whether the
+	// tunnel was in the response at all.
+	bytesUsed int64
+	found     bool
+}
+
+func pollTunnel(client *http.Client, serverURL, tunnelID, bearer string) tunnelPoll {
 	timeout := client.Timeout
 	if timeout <= 0 {
 		timeout = 5 * time.Second
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
-	req, err := http.NewRequestWithContext(ctx, "GET", serverURL+"/api/tunnels?id="+tunnelID, http.NoBody)
+	endpoint, err := support.ServerEndpoint(serverURL, "/api/tunnels", url.Values{"id": {tunnelID}})
+	if err != nil {
+		return tunnelPoll{}
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, http.NoBody)
 	if err != nil {
-		return false, "", 0
+		return tunnelPoll{}
 	}
 	if strings.TrimSpace(bearer) != "" {
 		req.Header.Set("Authorization", "Bearer "+bearer)
 	}
 	resp, err := client.Do(req)
 	if err != nil {
-		return false, "", 0
+		return tunnelPoll{}
 	}
 	defer resp.Body.Close()
 
@@ -299,22 +366,56 @@ func checkTunnelTerminalWithStatusImpl(client *http.Client, serverURL, tunnelID,
 	// Treat as terminal immediately; no failure counters or WARN spam.
 	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
 		logDebug("%d from GET /api/tunnels → terminal (tunnel removed or access revoked)", resp.StatusCode)
-		return true, "", resp.StatusCode
+		return tunnelPoll{terminal: true, statusCode: resp.StatusCode}
 	}
 
 	var payload protocolv1.TunnelListResponse
 	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
-		return false, "", resp.StatusCode
+		return tunnelPoll{statusCode: resp.StatusCode}
 	}
-	status = tunnelStatusFromPayload(payload)
+	poll := tunnelPoll{status: tunnelStatusFromPayload(payload), statusCode: resp.StatusCode}
+	if len(payload.Tunnels) > 0 {
+		poll.activeClient = payload.Tunnels[0].ActiveClient
+		poll.bytesUsed = payload.Tunnels[0].BytesUsed
+		poll.found = true
+	}
+	poll.terminal = !payload.Exists || poll.status == StatusExpired
+	return poll
+}
 
-	if !payload.Exists {
-		return true, status, resp.StatusCode
+// Messages of the terminal causes the control plane reports.
+const (
+	causeTunnelDeleted = "tunnel was deleted on the server"
+	causeTunnelExpired = "tunnel expired on the server"
+	causeDisplaced     = "another client instance took over the tunnel"
+	causeControlClosed = "server closed control channel"
+	causeControlFailed = "control channel failed"
+)
+
+// reportTerminalPoll reports why a terminal poll ended the tunnel.
+func reportTerminalPoll(poll tunnelPoll) {
+	msg := causeTunnelDeleted
+	switch {
+	case poll.statusCode == http.StatusUnauthorized || poll.statusCode == http.StatusForbidden:
+		msg = fmt.Sprintf("server revoked access to the tunnel (HTTP %d)", poll.statusCode)
+	case poll.status == StatusExpired:
+		msg = causeTunnelExpired
 	}
-	if status == StatusExpired {
-		return true, status, resp.StatusCode
+	support.Causes.Report(support.CauseTunnelGone, 0, msg)
+}
+
+// displaced reports (and announces) that another client instance now serves
+// the tunnel this watcher belongs to.
+func (w *Watcher) displaced(poll tunnelPoll) bool {
+	if w.instanceID == "" || poll.activeClient == nil || poll.activeClient.InstanceID == "" ||
+		poll.activeClient.InstanceID == w.instanceID {
+		return false
 	}
-	return false, status, resp.StatusCode
+	logDebug("displaced by client instance=%s", poll.activeClient.InstanceID)
+	support.Causes.Report(support.CauseDisplaced, 0, causeDisplaced)
+	w.out.UserMessage(support.LevelInfo, MsgDisplacedExiting+"\n")
+	w.wasDisplaced.Store(true)
+	return true
 }
 
 func tunnelStatusFromPayload(payload any) string {
@@ -346,13 +447,13 @@ func (w *Watcher) printTunnelStatusChange(status string) {
 	case StatusExpired:
 		return
 	case statusActive:
-		w.out.Printf("✅ Tunnel status changed to active on server\n")
+		w.out.UserMessage(support.LevelInfo, "✅ Tunnel status changed to active on server\n")
 	case statusPaused:
-		w.out.Printf("⏸️ Tunnel status changed to paused on server\n")
+		w.out.UserMessage(support.LevelInfo, "⏸️ Tunnel status changed to paused on server\n")
 	case statusNotActive:
-		w.out.Printf("⚪ Tunnel status changed to not active on server\n")
+		w.out.UserMessage(support.LevelInfo, "⚪ Tunnel status changed to not active on server\n")
 	default:
-		w.out.Printf("📨 Tunnel status changed on server: %s\n", status)
+		w.out.UserMessage(support.LevelInfo, "📨 Tunnel status changed on server: %s\n", support.SanitizeRemote(status))
 	}
 }
 
@@ -369,11 +470,17 @@ func (w *Watcher) startControlMessageReader(
 	defaultWatchInterval time.Duration,
 ) {
 	go func() {
+		// A panic ends the subscription like a read error does.
+		defer support.RecoverAs(func(p *support.PanicError) {
+			support.ReportPanic(support.PanicScope{Role: "control message reader"}, p)
+			doneOnce.Do(func() { close(done) })
+		})
 		lastStatus := statusActive
 		for {
 			var msg protocolv1.Envelope
 			if err := conn.ReadJSON(&msg); err != nil {
 				logWebSocketReadError(err)
+				reportControlClose(err)
 				doneOnce.Do(func() { close(done) })
 				return
 			}
@@ -401,6 +508,20 @@ func logWebSocketReadError(err error) {
 	}
 }
 
+// reportControlClose reports the end of a control WebSocket that ends the
+// run, with the close code the server sent.
+func reportControlClose(err error) {
+	var ce *websocket.CloseError
+	switch {
+	case errors.As(err, &ce):
+		support.Causes.Report(support.CauseServer, ce.Code, causeControlClosed)
+	case errors.Is(err, io.EOF), strings.Contains(err.Error(), "unexpected EOF"):
+		support.Causes.Report(support.CauseServer, 0, causeControlClosed)
+	default:
+		support.Causes.Report(support.CauseServer, 0, fmt.Sprintf("%s: %v", causeControlFailed, err))
+	}
+}
+
 func (w *Watcher) handleControlMessage(
 	msg protocolv1.Envelope,
 	ackCh chan<- struct{},
@@ -412,18 +533,20 @@ func (w *Watcher) handleControlMessage(
 ) bool {
 	switch msg.Type {
 	case protocolv1.MessageTypePong:
-		w.out.Printf("💓 Ping received at %s\n", time.Now().Format("15:04:05"))
+		w.out.UserMessage(support.LevelInfo, "💓 Ping received at %s\n", support.FormatTime(time.Now()))
 	case protocolv1.EventTunnelClosed:
 		reason := extractTunnelCloseReason(msg)
-		logDebug("tunnel_closed reason=%s", reason)
-		w.out.Println(MsgTunnelRemovedExiting)
+		logDebug("tunnel_closed reason=%s", support.SanitizeRemote(reason))
+		support.Causes.Report(support.CauseTunnelGone, 0, tunnelClosedCause(reason))
+		w.out.UserMessage(support.LevelInfo, MsgTunnelRemovedExiting+"\n")
 		doneOnce.Do(func() { close(done) })
 		return true
 	case protocolv1.EventTunnelUpdated:
 		var payload protocolv1.LifecycleEventPayload
 		if err := msg.DecodePayload(&payload); err == nil {
 			if payload.Status == StatusExpired {
-				w.out.Println(MsgTunnelRemovedExiting)
+				support.Causes.Report(support.CauseTunnelGone, 0, causeTunnelExpired)
+				w.out.UserMessage(support.LevelInfo, MsgTunnelRemovedExiting+"\n")
 				doneOnce.Do(func() { close(done) })
 				return true
 			}
@@ -437,18 +560,122 @@ func (w *Watcher) handleControlMessage(
 	case protocolv1.MessageTypeSubscribed:
 		notifyAckReceived(ackCh)
 		updateFallbackInterval(intervalCh, defaultWatchInterval)
-		w.out.Printf("📨 Message: %s\n", msg.Type)
+		w.out.UserMessage(support.LevelInfo, "📨 Message: %s\n", support.SanitizeRemote(msg.Type))
+	case protocolv1.MessageTypeDisplaced:
+		var payload protocolv1.DisplacedPayload
+		if err := msg.DecodePayload(&payload); err == nil {
+			logDebug("displaced by client instance=%s", support.SanitizeRemote(payload.InstanceID))
+		}
+		support.Causes.Report(support.CauseDisplaced, 0, causeDisplaced)
+		w.out.UserMessage(support.LevelInfo, MsgDisplacedExiting+"\n")
+		w.wasDisplaced.Store(true)
+		doneOnce.Do(func() { close(done) })
+		return true
+	case protocolv1.MessageTypeMigrate:
+		w.handleMigrate(msg)
 	case protocolv1.MessageTypeError:
 		var payload protocolv1.ErrorPayload
 		if err := msg.DecodePayload(&payload); err == nil && payload.Message != "" {
-			w.out.Printf("❌ Error: %s\n", payload.Message)
+			w.out.UserMessage(support.LevelInfo, "❌ Error: %s\n", support.SanitizeRemote(payload.Message))
 		}
 	default:
-		w.out.Printf("📨 Message: %s\n", msg.Type)
+		w.out.UserMessage(support.LevelInfo, "📨 Message: %s\n", support.SanitizeRemote(msg.Type))
 	}
 	return false
 }
 
+// handleMigrate passes a migrate message on to the migrate handler.
+func (w *Watcher) handleMigrate(msg protocolv1.Envelope) {
+	var payload protocolv1.MigratePayload
+	if err := msg.DecodePayload(&payload); err != nil || payload.Endpoint == "" {
+		log.Printf("[WARN] ignoring a migrate message without a node endpoint")
+		return
+	}
+	if w.onMigrate == nil {
+		w.out.UserMessage(support.LevelInfo, "🛠️  Server maintenance: the tunnel is moving to %s\n", support.SanitizeRemote(payload.Endpoint))
+		return
+	}
+	w.onMigrate(payload)
+}
+
+const (
+	// controlRedialMin and controlRedialMax bound the backoff between dials
+	// of WatchControlMessages.
+	controlRedialMin = time.Second
+	controlRedialMax = time.Minute
+)
+
+// WatchControlMessages keeps a control-plane WebSocket open while the client
+// serves, for the messages only it carries: migrate messages go to the migrate
+// handler, everything else is left to the lifecycle poller. It redials with
+// backoff until stop is closed.
+func (w *Watcher) WatchControlMessages(httpClient *http.Client, serverURL, tunnelID, bearer string, stop <-chan struct{}) {
+	wait := controlRedialMin
+	for {
+		conn, resp, err := dialControlWebSocket(httpClient, serverURL, tunnelID, bearer)
+		if resp != nil && resp.Body != nil {
+			resp.Body.Close()
+		}
+		if err == nil {
+			wait = controlRedialMin
+			w.readMigrateMessages(conn, stop)
+		} else {
+			logDebug("control WebSocket dial failed: %v (retry in %s)", err, wait)
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(wait):
+		}
+		wait = min(2*wait, controlRedialMax)
+	}
+}
+
+func (w *Watcher) readMigrateMessages(conn *websocket.Conn, stop <-chan struct{}) {
+	closed := make(chan struct{})
+	defer close(closed)
+	go func() {
+		select {
+		case <-stop:
+		case <-closed:
+		}
+		conn.Close()
+	}()
+	for {
+		var msg protocolv1.Envelope
+		if err := conn.ReadJSON(&msg); err != nil {
+			logDebug("control WebSocket ended: %v", err)
+			return
+		}
+		if msg.Type == protocolv1.MessageTypeMigrate {
+			w.handleMigrate(msg)
+		}
+	}
+}
+
+// ServeControlStream handles the tunnel's control messages from the control
+// stream of mgr's data-plane session (--single-connection), as
+// ConnectWebSocketWithAuth does for a control WebSocket, until the returned
+// func is called. onTerminal runs once the messages end the tunnel (closed,
+// expired or displaced).
+func (w *Watcher) ServeControlStream(mgr *dataplane.Manager, tunnelID, instanceID string, onTerminal func()) func() {
+	done := make(chan struct{})
+	var doneOnce sync.Once
+	ackCh := make(chan struct{}, 1)
+	intervalCh := make(chan time.Duration, 1)
+	lastStatus := statusActive
+	return dataplane.ServeControlStream(mgr, tunnelID, instanceID, func(msg protocolv1.Envelope) {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if w.handleControlMessage(msg, ackCh, intervalCh, done, &doneOnce, 0, &lastStatus) {
+			onTerminal()
+		}
+	})
+}
+
 func handleControlMessage(
 	msg map[string]interface{},
 	ackCh chan<- struct{},
@@ -486,6 +713,14 @@ func extractTunnelCloseReason(msg any) string {
 	return protocolv1.ReasonUnknown
 }
 
+// tunnelClosedCause is the terminal cause message of a tunnel_closed event.
+func tunnelClosedCause(reason string) string {
+	if reason == "" || reason == protocolv1.ReasonUnknown {
+		return "tunnel was closed on the server"
+	}
+	return "tunnel was closed on the server: " + support.SanitizeRemote(reason)
+}
+
 func extractPayload(msg map[string]interface{}) map[string]interface{} {
 	payload, _ := msg["payload"].(map[string]interface{})
 	return payload
@@ -394,6 +394,11 @@ func TestHandleControlMessage(t *testing.T) {
 			msg:          map[string]interface{}{"type": "tunnel_updated", "payload": map[string]interface{}{"status": "paused"}},
 			shouldReturn: false,
 		},
+		{
+			name:         "displaced",
+			msg:          map[string]interface{}{"type": "displaced", "payload": map[string]interface{}{"instance_id": "other"}},
+			shouldReturn: true,
+		},
 		{
 			name:         "unknown type",
 			msg:          map[string]interface{}{"type": "unknown"},
@@ -33,10 +33,7 @@ func buildControlWebSocketURL(serverURL, tunnelID string) (string, error) {
 	}
 
 	u.Scheme = wsScheme
-	u.Path = "/ws"
-	q := u.Query()
-	q.Set("watch", tunnelID)
-	u.RawQuery = q.Encode()
+	u = u.ResolveReference(&url.URL{Path: "/ws", RawQuery: url.Values{"watch": {tunnelID}}.Encode()})
 	return u.String(), nil
 }
 
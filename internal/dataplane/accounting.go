@@ -0,0 +1,117 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/fortunnels/client/internal/config"
+	sec "github.com/fortunnels/client/internal/security"
+)
+
+// wsWriteFrameSize is the payload capacity of one WebSocket frame the
+// client sends: gorilla splits a message at its write buffer, 4 KiB unless
+// the dialer sets another size.
+const wsWriteFrameSize = 4096
+
+// processFraming counts the PSK framing of listen-mode streams, the streams
+// whose payload processTraffic counts on the encrypted side.
+var processFraming sec.OverheadCounter
+
+// processWire counts the bytes of every data-plane WebSocket connection of
+// this process.
+var processWire wireCounter
+
+// wireCounter is what smux sessions wrote to and read from their WebSocket
+// connections, plus an estimate of the WebSocket headers of sent frames.
+type wireCounter struct {
+	up, down  atomic.Int64
+	upHeaders atomic.Int64
+}
+
+// addWrite records one WSConn write of n bytes: one binary message.
+func (c *wireCounter) addWrite(n int) {
+	c.up.Add(int64(n))
+	c.upHeaders.Add(wsMessageOverhead(n))
+}
+
+// wsMessageOverhead is the header bytes of one n-byte binary message sent by
+// a client: 2 bytes, the extended length and the 4-byte mask per frame.
+func wsMessageOverhead(n int) int64 {
+	var total int64
+	for n > 0 || total == 0 {
+		l := min(n, wsWriteFrameSize)
+		total += 2 + 4
+		if l > 125 {
+			total += 2
+		}
+		n -= l
+	}
+	return total
+}
+
+// LayerBytes is traffic in both directions; up is toward the server.
+type LayerBytes struct {
+	Up   int64 `json:"up"`
+	Down int64 `json:"down"`
+}
+
+// Total is Up plus Down.
+func (b LayerBytes) Total() int64 { return b.Up + b.Down }
+
+// ByteAccounting is the tunnel's traffic measured at each layer that adds
+// bytes, so that it can be compared with what the server bills. Each layer
+// contains the one before: Payload <= Encrypted <= Wire.
+type ByteAccounting struct {
+	// Payload is what the bridges copied between local connections and
+	// data-plane streams.
+	Payload LayerBytes `json:"payload"`
+	// Encrypted is Payload plus the PSK frame overhead (equal to Payload
+	// without --encrypt).
+	Encrypted LayerBytes `json:"encrypted"`
+	// Wire is what went over the WebSocket data plane: smux frames of all
+	// streams, prefaces and keepalives, plus the estimated headers of sent
+	// WebSocket frames. Headers of received frames are not visible to the
+	// client and are not included.
+	Wire LayerBytes `json:"wire"`
+}
+
+// Accounting returns the byte accounting of this process so far.
+func Accounting() ByteAccounting {
+	up, down := processTraffic.Totals()
+	a := ByteAccounting{Payload: LayerBytes{Up: up, Down: down}}
+	a.Encrypted = LayerBytes{Up: up + processFraming.Sent.Load(), Down: down + processFraming.Received.Load()}
+	a.Wire = LayerBytes{Up: processWire.up.Load() + processWire.upHeaders.Load(), Down: processWire.down.Load()}
+	return a
+}
+
+// WriteSummary prints the accounting as the shutdown summary. serverBytes
+// is the tunnel's bytes_used as reported by the server, or negative when it
+// could not be fetched.
+func (a ByteAccounting) WriteSummary(w io.Writer, serverBytes int64) {
+	fmt.Fprintf(w, "\n📊 Traffic bytes (up/down): payload %d/%d, encrypted %d/%d, wire %d/%d\n",
+		a.Payload.Up, a.Payload.Down, a.Encrypted.Up, a.Encrypted.Down, a.Wire.Up, a.Wire.Down)
+	fmt.Fprintf(w, "   %s\n", a.Reconcile(serverBytes))
+}
+
+// Reconcile compares the server's bytes_used with the client's payload and
+// wire totals in both directions.
+func (a ByteAccounting) Reconcile(serverBytes int64) string {
+	if serverBytes < 0 {
+		return "server bytes_used unavailable"
+	}
+	return fmt.Sprintf("server bytes_used %d: %+d vs client payload %d, %+d vs client wire %d",
+		serverBytes, serverBytes-a.Payload.Total(), a.Payload.Total(), serverBytes-a.Wire.Total(), a.Wire.Total())
+}
+
+// wrapAccountedStream is WrapClientStream with the PSK framing counted in
+// processFraming.
+func wrapAccountedStream(s io.ReadWriteCloser, tunnelID string, enc config.EncryptionSettings) io.ReadWriteCloser {
+	if !enc.Enabled {
+		return s
+	}
+	return streamPSK(enc).WrapCounted(s, tunnelID, &processFraming)
+}
@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+	sec "github.com/fortunnels/client/internal/security"
+	"github.com/fortunnels/client/internal/testsupport"
+)
+
+func TestWSMessageOverhead(t *testing.T) {
+	assert.Equal(t, int64(6), wsMessageOverhead(0))
+	assert.Equal(t, int64(6), wsMessageOverhead(125))
+	assert.Equal(t, int64(8), wsMessageOverhead(126))
+	assert.Equal(t, int64(8), wsMessageOverhead(wsWriteFrameSize))
+	assert.Equal(t, int64(8+6), wsMessageOverhead(wsWriteFrameSize+1))
+}
+
+func TestByteAccounting_Reconcile(t *testing.T) {
+	a := ByteAccounting{Payload: LayerBytes{Up: 100, Down: 200}, Wire: LayerBytes{Up: 150, Down: 260}}
+	assert.Equal(t, "server bytes_used 320: +20 vs client payload 300, -90 vs client wire 410", a.Reconcile(320))
+	assert.Equal(t, "server bytes_used unavailable", a.Reconcile(-1))
+
+	var out strings.Builder
+	a.WriteSummary(&out, 320)
+	assert.Contains(t, out.String(), "payload 100/200, encrypted 0/0, wire 150/260")
+}
+
+// wsMessages is the wire size of smux frames written as one WebSocket
+// message each: the frames plus their estimated headers.
+func wsMessages(frames ...int) int64 {
+	var total int64
+	for _, n := range frames {
+		total += int64(n) + wsMessageOverhead(n)
+	}
+	return total
+}
+
+// TestAccounting_ListenStack sends a known payload through --listen, the
+// client-opened stream and the WebSocket session to the stub's echo, and
+// checks every layer against the frames that payload must produce.
+func TestAccounting_ListenStack(t *testing.T) {
+	const (
+		psk         = "0123456789abcdef0123456789abcdef"
+		payloadSize = 1000
+		smuxHeader  = 8
+	)
+	for _, encrypt := range []bool{false, true} {
+		name := "plain"
+		if encrypt {
+			name = "encrypted"
+		}
+		t.Run(name, func(t *testing.T) {
+			opts := testsupport.Options{}
+			enc := config.EncryptionSettings{}
+			if encrypt {
+				opts.PSK = psk
+				enc = config.EncryptionSettings{Enabled: true, PSK: psk}
+			}
+			stub := testsupport.NewServer(opts)
+			defer stub.Close()
+			tun := stub.AddTunnel("tcp", "")
+			mgr := NewTunnelManager(stub.URL, tun.ID, "", e2eRuntime())
+			defer mgr.Close()
+			preface, err := clientPreface(encryptionPreface(map[string]string{"dst": testsupport.EchoDst, "proto": "tcp", "tunnel_id": tun.ID}, enc), prefaceMeta{})
+			require.NoError(t, err)
+
+			before := Accounting()
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			go func() { _ = serveListener(ln, mgr, newListenForwarder(tun.ID, testsupport.EchoDst, e2eRuntime(), enc)) }()
+			defer ln.Close()
+
+			c, err := net.Dial("tcp", ln.Addr().String())
+			require.NoError(t, err)
+			payload := bytes.Repeat([]byte("x"), payloadSize)
+			_, err = c.Write(payload)
+			require.NoError(t, err)
+			got := make([]byte, payloadSize)
+			_, err = io.ReadFull(c, got)
+			require.NoError(t, err)
+			require.Equal(t, payload, got)
+			require.NoError(t, c.Close())
+
+			// Up: SYN, preface, the payload frame(s), FIN. The PSK layer
+			// writes each frame in one piece.
+			dataFrames := []int{smuxHeader + payloadSize}
+			encrypted := int64(payloadSize)
+			if encrypt {
+				dataFrames = []int{smuxHeader + payloadSize + sec.FrameOverhead}
+				encrypted += sec.FrameOverhead
+			}
+			frames := append([]int{smuxHeader, smuxHeader + len(preface)}, dataFrames...)
+			frames = append(frames, smuxHeader)
+			want := ByteAccounting{
+				Payload:   LayerBytes{Up: payloadSize, Down: payloadSize},
+				Encrypted: LayerBytes{Up: encrypted, Down: encrypted},
+				Wire:      LayerBytes{Up: wsMessages(frames...)},
+			}
+			var delta ByteAccounting
+			require.Eventually(t, func() bool {
+				delta = accountingDelta(before, Accounting())
+				return delta.Payload == want.Payload && delta.Encrypted == want.Encrypted && delta.Wire.Up == want.Wire.Up
+			}, 5*time.Second, 10*time.Millisecond, "got %+v, want %+v", delta, want)
+
+			// Down: the echoed bytes in however many smux frames the stub
+			// wrote, followed by its FIN.
+			framing := delta.Wire.Down - want.Encrypted.Down
+			assert.GreaterOrEqual(t, framing, int64(2*smuxHeader))
+			assert.Zero(t, framing%smuxHeader, "only whole smux headers on top of the echoed bytes")
+			assert.LessOrEqual(t, delta.Payload.Up, delta.Encrypted.Up)
+			assert.LessOrEqual(t, delta.Encrypted.Up, delta.Wire.Up)
+		})
+	}
+}
+
+func accountingDelta(before, after ByteAccounting) ByteAccounting {
+	sub := func(a, b LayerBytes) LayerBytes { return LayerBytes{Up: a.Up - b.Up, Down: a.Down - b.Down} }
+	return ByteAccounting{
+		Payload:   sub(after.Payload, before.Payload),
+		Encrypted: sub(after.Encrypted, before.Encrypted),
+		Wire:      sub(after.Wire, before.Wire),
+	}
+}
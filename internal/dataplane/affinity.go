@@ -0,0 +1,75 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"net/http"
+	"sync"
+
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+// maxSessionToken bounds the session token kept from the server; a longer
+// one is ignored.
+const maxSessionToken = 512
+
+// sessionAffinity keeps the session token the server issued on a data-plane
+// WS upgrade (protocolv1.HeaderSessionToken) for the Manager's next dials.
+// Without tokens from the server it adds nothing.
+type sessionAffinity struct {
+	mu    sync.Mutex
+	token string
+}
+
+// apply adds the token, if any, to the headers of a dial.
+func (a *sessionAffinity) apply(h http.Header) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" {
+		h.Set(protocolv1.HeaderSessionToken, a.token)
+	}
+}
+
+// observe keeps the token of an accepted upgrade. A response without one
+// leaves the current token: the server need not repeat a token it honored.
+func (a *sessionAffinity) observe(resp *http.Response) {
+	if resp == nil {
+		return
+	}
+	token := resp.Header.Get(protocolv1.HeaderSessionToken)
+	if token == "" || len(token) > maxSessionToken {
+		return
+	}
+	a.mu.Lock()
+	a.token = token
+	a.mu.Unlock()
+}
+
+// tokenRejected reports whether resp refused the upgrade because of its
+// session token, as opposed to any other refusal with the same status.
+func tokenRejected(resp *http.Response) bool {
+	return resp != nil && resp.Header.Get(protocolv1.HeaderSessionTokenRejected) != ""
+}
+
+// reject drops token, which the server refused, unless a newer one replaced
+// it meanwhile.
+func (a *sessionAffinity) reject(token string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token == token {
+		a.token = ""
+	}
+}
+
+func (a *sessionAffinity) clear() {
+	a.mu.Lock()
+	a.token = ""
+	a.mu.Unlock()
+}
+
+func (a *sessionAffinity) current() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.token
+}
@@ -0,0 +1,177 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xtaci/smux"
+
+	"github.com/fortunnels/client/internal/config"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+	"github.com/fortunnels/client/shared/wsconn"
+)
+
+// tokenServer is a data-plane server that issues session tokens and
+// refuses the ones it no longer knows.
+type tokenServer struct {
+	issue bool
+
+	mu sync.Mutex
+	// displaced refuses every upgrade with 409 like the server does for a
+	// displaced client instance, which is not a token rejection.
+	displaced bool
+	valid     map[string]bool
+	issued    int
+	// presented lists the token of every upgrade request, "" for none.
+	presented []string
+}
+
+func (s *tokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := r.Header.Get(protocolv1.HeaderSessionToken)
+	s.mu.Lock()
+	s.presented = append(s.presented, token)
+	if s.displaced {
+		s.mu.Unlock()
+		http.Error(w, "client instance was displaced", http.StatusConflict)
+		return
+	}
+	if token != "" && !s.valid[token] {
+		s.mu.Unlock()
+		w.Header().Set(protocolv1.HeaderSessionTokenRejected, "1")
+		http.Error(w, "unknown session token", http.StatusConflict)
+		return
+	}
+	header := http.Header{}
+	if s.issue && token == "" {
+		s.issued++
+		token = fmt.Sprintf("tok-%d", s.issued)
+		s.valid[token] = true
+		header.Set(protocolv1.HeaderSessionToken, token)
+	}
+	s.mu.Unlock()
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, header)
+	if err != nil {
+		return
+	}
+	sess, err := smux.Server(wsconn.NewWSConn(conn, wsconn.Options{}), smux.DefaultConfig())
+	if err != nil {
+		return
+	}
+	<-sess.CloseChan()
+}
+
+// forget makes the server refuse every token issued so far.
+func (s *tokenServer) forget() {
+	s.mu.Lock()
+	s.valid = map[string]bool{}
+	s.mu.Unlock()
+}
+
+func (s *tokenServer) requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.presented...)
+}
+
+func startTokenManager(t *testing.T, issue bool) (*tokenServer, *Manager) {
+	t.Helper()
+	ts := &tokenServer{issue: issue, valid: map[string]bool{}}
+	srv := httptest.NewServer(ts)
+	t.Cleanup(srv.Close)
+	settings := config.RuntimeSettings{
+		PingInterval:          time.Minute,
+		PingTimeout:           time.Second,
+		SmuxKeepAliveInterval: 10 * time.Second,
+		SmuxKeepAliveTimeout:  30 * time.Second,
+	}
+	mgr := NewManager(srv.URL, "t1", "", 10*time.Millisecond, 50*time.Millisecond, settings)
+	t.Cleanup(mgr.Close)
+	return ts, mgr
+}
+
+// reconnect drops the Manager's session and dials the next one.
+func reconnect(t *testing.T, mgr *Manager) {
+	t.Helper()
+	sess, err := mgr.EnsureSession()
+	require.NoError(t, err)
+	require.NoError(t, sess.Close())
+	_, err = mgr.EnsureSession()
+	require.NoError(t, err)
+}
+
+func TestSessionAffinity_TokenEchoedOnReconnect(t *testing.T) {
+	ts, mgr := startTokenManager(t, true)
+	_, err := mgr.EnsureSession()
+	require.NoError(t, err)
+	assert.Equal(t, "tok-1", mgr.affinity.current())
+
+	reconnect(t, mgr)
+	reconnect(t, mgr)
+	assert.Equal(t, []string{"", "tok-1", "tok-1"}, ts.requests())
+	assert.Equal(t, "tok-1", mgr.affinity.current(), "a reconnect without a new token keeps it")
+}
+
+func TestSessionAffinity_RejectedTokenDropped(t *testing.T) {
+	ts, mgr := startTokenManager(t, true)
+	_, err := mgr.EnsureSession()
+	require.NoError(t, err)
+
+	ts.forget()
+	reconnect(t, mgr)
+	assert.Equal(t, []string{"", "tok-1", ""}, ts.requests(), "the refused token is retried without")
+	assert.Equal(t, "tok-2", mgr.affinity.current(), "the fresh session's token")
+
+	reconnect(t, mgr)
+	assert.Equal(t, "tok-2", ts.requests()[3])
+}
+
+func TestSessionAffinity_DisplacedRefusalKeepsToken(t *testing.T) {
+	ts, mgr := startTokenManager(t, true)
+	sess, err := mgr.EnsureSession()
+	require.NoError(t, err)
+	require.NoError(t, sess.Close())
+
+	ts.mu.Lock()
+	ts.displaced = true
+	ts.mu.Unlock()
+	mgr.mu.Lock()
+	wsURL, headers := mgr.sessionDialParams()
+	mgr.mu.Unlock()
+	_, _, _, err = mgr.dialWSSession(wsURL, headers)
+	require.Error(t, err)
+	assert.Equal(t, []string{"", "tok-1"}, ts.requests(), "no fresh-session retry after a displaced 409")
+	assert.Equal(t, "tok-1", mgr.affinity.current(), "the token survives")
+}
+
+func TestSessionAffinity_InvisibleWithoutTokens(t *testing.T) {
+	ts, mgr := startTokenManager(t, false)
+	_, err := mgr.EnsureSession()
+	require.NoError(t, err)
+	reconnect(t, mgr)
+	assert.Equal(t, []string{"", ""}, ts.requests())
+	_, headers := mgr.sessionDialParams()
+	assert.Empty(t, headers.Values(protocolv1.HeaderSessionToken))
+}
+
+func TestSessionAffinity_IgnoresOversizedToken(t *testing.T) {
+	var a sessionAffinity
+	resp := &http.Response{Header: http.Header{}}
+	resp.Header.Set(protocolv1.HeaderSessionToken, string(make([]byte, maxSessionToken+1)))
+	a.observe(resp)
+	assert.Empty(t, a.current())
+
+	resp.Header.Set(protocolv1.HeaderSessionToken, "tok")
+	a.observe(resp)
+	a.reject("older")
+	assert.Equal(t, "tok", a.current(), "only the refused token is dropped")
+}
@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fortunnels/client/internal/config"
+)
+
+// backendDownCooldown is how long a backend that failed to dial is skipped
+// before streams try it again.
+const backendDownCooldown = 5 * time.Second
+
+// backendPool fails incoming streams for the tunnel target over between the
+// --local backends. A failed dial marks a backend down for
+// backendDownCooldown; down backends are only tried once every healthy one
+// has failed.
+type backendPool struct {
+	targets    []string
+	normalized map[string]bool
+	roundRobin bool
+	next       atomic.Uint64
+	now        func() time.Time
+
+	mu        sync.Mutex
+	downUntil map[string]time.Time
+}
+
+// newBackendPool returns the pool for settings, or nil when fewer than two
+// local targets are configured.
+func newBackendPool(settings config.RuntimeSettings) *backendPool {
+	if len(settings.LocalTargets) < 2 {
+		return nil
+	}
+	p := &backendPool{
+		targets:    settings.LocalTargets,
+		normalized: make(map[string]bool, len(settings.LocalTargets)),
+		roundRobin: settings.LocalRoundRobin,
+		now:        time.Now,
+		downUntil:  make(map[string]time.Time),
+	}
+	for _, t := range p.targets {
+		p.normalized[normalizeIncomingDst(t)] = true
+	}
+	return p
+}
+
+// serves reports whether streams to dst go through the pool. Other allowed
+// destinations (--allow-incoming-dst) are dialed as given.
+func (p *backendPool) serves(dst string) bool {
+	return p != nil && p.normalized[normalizeIncomingDst(dst)]
+}
+
+// candidates returns the targets to dial in order: healthy ones first,
+// starting at the next round-robin position when enabled, then the ones
+// marked down as a last resort.
+func (p *backendPool) candidates() []string {
+	start := 0
+	if p.roundRobin {
+		start = int((p.next.Add(1) - 1) % uint64(len(p.targets)))
+	}
+	now := p.now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	healthy := make([]string, 0, len(p.targets))
+	var down []string
+	for i := range p.targets {
+		t := p.targets[(start+i)%len(p.targets)]
+		if now.Before(p.downUntil[t]) {
+			down = append(down, t)
+			continue
+		}
+		healthy = append(healthy, t)
+	}
+	return append(healthy, down...)
+}
+
+func (p *backendPool) markDown(target string) {
+	p.mu.Lock()
+	p.downUntil[target] = p.now().Add(backendDownCooldown)
+	p.mu.Unlock()
+}
+
+func (p *backendPool) markUp(target string) {
+	p.mu.Lock()
+	delete(p.downUntil, target)
+	p.mu.Unlock()
+}
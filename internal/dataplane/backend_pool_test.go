@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bufio"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/testsupport"
+)
+
+func testPool(t *testing.T, roundRobin bool, targets ...string) (*backendPool, *time.Time) {
+	t.Helper()
+	p := newBackendPool(config.RuntimeSettings{LocalTargets: targets, LocalRoundRobin: roundRobin})
+	require.NotNil(t, p)
+	now := time.Unix(1000, 0)
+	p.now = func() time.Time { return now }
+	return p, &now
+}
+
+func TestNewBackendPool_SingleTargetDisabled(t *testing.T) {
+	assert.Nil(t, newBackendPool(config.RuntimeSettings{LocalTargets: []string{"127.0.0.1:8000"}}))
+	var p *backendPool
+	assert.False(t, p.serves("127.0.0.1:8000"))
+}
+
+func TestBackendPool_Failover(t *testing.T) {
+	p, now := testPool(t, false, "127.0.0.1:8000", "127.0.0.1:8001")
+	assert.True(t, p.serves("localhost:8000"), "loopback names are equivalent")
+	assert.True(t, p.serves("127.0.0.1:8001"))
+	assert.False(t, p.serves("127.0.0.1:9000"))
+
+	assert.Equal(t, []string{"127.0.0.1:8000", "127.0.0.1:8001"}, p.candidates())
+	p.markDown("127.0.0.1:8000")
+	assert.Equal(t, []string{"127.0.0.1:8001", "127.0.0.1:8000"}, p.candidates(), "down backends are a last resort")
+
+	*now = now.Add(backendDownCooldown)
+	assert.Equal(t, []string{"127.0.0.1:8000", "127.0.0.1:8001"}, p.candidates(), "retried after the cooldown")
+
+	p.markDown("127.0.0.1:8000")
+	p.markUp("127.0.0.1:8000")
+	assert.Equal(t, []string{"127.0.0.1:8000", "127.0.0.1:8001"}, p.candidates())
+}
+
+func TestBackendPool_RoundRobin(t *testing.T) {
+	p, _ := testPool(t, true, "a:1", "b:2", "c:3")
+	assert.Equal(t, []string{"a:1", "b:2", "c:3"}, p.candidates())
+	assert.Equal(t, []string{"b:2", "c:3", "a:1"}, p.candidates())
+	p.markDown("c:3")
+	assert.Equal(t, []string{"a:1", "b:2", "c:3"}, p.candidates())
+	assert.Equal(t, []string{"a:1", "b:2", "c:3"}, p.candidates(), "rotation starting at a down backend skips it")
+}
+
+func servedBy(t *testing.T, stub *testsupport.Server, tunnelID, dst string) string {
+	t.Helper()
+	st, err := stub.OpenStream(tunnelID, dst)
+	require.NoError(t, err)
+	defer st.Close()
+	_, err = io.WriteString(st, "ping\n")
+	require.NoError(t, err)
+	line, err := bufio.NewReader(st).ReadString('\n')
+	require.NoError(t, err)
+	return line
+}
+
+func TestE2E_ServeIncoming_LocalFailover(t *testing.T) {
+	primary := startEchoBackend(t, "primary:")
+	spare := startEchoBackend(t, "spare:")
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	tun := stub.AddTunnel("http", primary.Addr().String())
+
+	runtime := e2eRuntime()
+	runtime.LocalTargets = []string{primary.Addr().String(), spare.Addr().String()}
+	mgr := NewManager(stub.URL, tun.ID, "", 10*time.Millisecond, 50*time.Millisecond, runtime)
+	defer mgr.Close()
+	go func() { _ = serveIncomingWithManager(mgr, nil) }()
+	require.NoError(t, stub.WaitSessions(tun.ID, 1, 5*time.Second))
+
+	dst := primary.Addr().String()
+	assert.Equal(t, "primary:ping\n", servedBy(t, stub, tun.ID, dst))
+	assert.Equal(t, "primary:ping\n", servedBy(t, stub, tun.ID, dst), "failover keeps preferring the primary")
+
+	require.NoError(t, primary.Close())
+	assert.Equal(t, "spare:ping\n", servedBy(t, stub, tun.ID, dst), "stream fails over transparently")
+	assert.Equal(t, "spare:ping\n", servedBy(t, stub, tun.ID, dst))
+}
+
+func TestE2E_ServeIncoming_LocalRoundRobin(t *testing.T) {
+	a := startEchoBackend(t, "a:")
+	b := startEchoBackend(t, "b:")
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	tun := stub.AddTunnel("http", a.Addr().String())
+
+	runtime := e2eRuntime()
+	runtime.LocalTargets = []string{a.Addr().String(), b.Addr().String()}
+	runtime.LocalRoundRobin = true
+	mgr := NewManager(stub.URL, tun.ID, "", 10*time.Millisecond, 50*time.Millisecond, runtime)
+	defer mgr.Close()
+	go func() { _ = serveIncomingWithManager(mgr, nil) }()
+	require.NoError(t, stub.WaitSessions(tun.ID, 1, 5*time.Second))
+
+	dst := a.Addr().String()
+	assert.Equal(t, "a:ping\n", servedBy(t, stub, tun.ID, dst))
+	assert.Equal(t, "b:ping\n", servedBy(t, stub, tun.ID, dst))
+	assert.Equal(t, "a:ping\n", servedBy(t, stub, tun.ID, dst))
+}
@@ -4,6 +4,7 @@
 package dataplane
 
 import (
+	"errors"
 	"io"
 	"log"
 	"net"
@@ -11,6 +12,8 @@ import (
 
 	"github.com/fortunnels/client/internal/config"
 	sec "github.com/fortunnels/client/internal/security"
+	"github.com/fortunnels/client/internal/support"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
 )
 
 // SafeClose closes the given io.Closer and logs any error.
@@ -25,22 +28,55 @@ func SafeClose(c io.Closer) {
 
 // PipeStreams bridges two connections with backpressure-aware buffers.
 func PipeStreams(a net.Conn, b io.ReadWriteCloser) {
+	pipeStreams(a, b, nil, connLogger{})
+}
+
+// pipeStreams is PipeStreams with copy errors logged through lg and both
+// directions counted against quota. It returns the bytes copied a->b and
+// b->a; a is the local side, so a->b counts as up traffic.
+//
+// EOF in one direction is passed on as a half-close (CloseWrite on the
+// stream, or on a when it supports it) and the other direction keeps
+// running, so protocols that end a request with FIN still get their full
+// response. Both sides are closed early only when a copy fails.
+func pipeStreams(a net.Conn, b io.ReadWriteCloser, quota *streamQuota, lg connLogger) (aToB, bToA int64) {
 	bufA := make([]byte, 64*1024)
 	bufB := make([]byte, 64*1024)
-	done := make(chan struct{}, 2)
-	startBufferedCopy(a, b, bufB, "b->a", done)
-	startBufferedCopy(b, a, bufA, "a->b", done)
-	<-done
+	done := make(chan bool, 2)
+	startBufferedCopy(quotaWriter{w: countingWriter{throttledWriter{a, &processLimits.down}, &processTraffic.down}, q: quota}, b, bufB, "b->a", lg, &bToA, func() { closeWriteIfPossible(a) }, done)
+	startBufferedCopy(quotaWriter{w: countingWriter{throttledWriter{blockedWriter{b, &processStalls}, &processLimits.up}, &processTraffic.up}, q: quota}, a, bufA, "a->b", lg, &aToB, func() { closeWriteOrClose(b) }, done)
+	if ok := <-done; !ok {
+		// Unblock the other direction; it cannot complete meaningfully.
+		_ = a.Close()
+		_ = b.Close()
+	}
 	<-done
+	return aToB, bToA
 }
 
-func startBufferedCopy(dst io.Writer, src io.Reader, buf []byte, label string, done chan<- struct{}) {
+const copyErrorFormat = "client bridge: copy %s error: %v"
+
+// startBufferedCopy copies src to dst, then runs halfClose after a clean EOF
+// and reports on done whether the copy ended cleanly.
+func startBufferedCopy(dst io.Writer, src io.Reader, buf []byte, label string, lg connLogger, copied *int64, halfClose func(), done chan<- bool) {
 	go func() {
-		_, err := io.CopyBuffer(dst, src, buf)
+		defer support.RecoverAs(func(p *support.PanicError) {
+			support.ReportPanic(support.PanicScope{Role: "copy " + label, ConnID: lg.id}, p)
+			done <- false
+		})
+		n, err := io.CopyBuffer(dst, src, buf)
+		*copied = n
 		if err != nil && err != io.EOF && !isClosedPipe(err) {
-			log.Printf("client bridge: copy %s error: %v", label, err)
+			// A stream cut by its session's shutdown grace is reported
+			// with the shutdown, not as a copy failure.
+			if !errors.Is(err, ErrGraceExpired) {
+				lg.Repeatf(support.LogKey(copyErrorFormat, label, support.ErrorClass(err)), copyErrorFormat, label, err)
+			}
+			done <- false
+			return
 		}
-		done <- struct{}{}
+		halfClose()
+		done <- true
 	}()
 }
 
@@ -53,6 +89,24 @@ func WrapClientStream(s io.ReadWriteCloser, tunnelID string, enc config.Encrypti
 	if !enc.Enabled {
 		return s
 	}
-	mgr := sec.NewClientPSK([]byte(enc.PSK))
-	return mgr.Wrap(s, tunnelID)
+	return streamPSK(enc).Wrap(s, tunnelID)
+}
+
+// streamPSK returns the tunnel's shared ClientPSK with enc's nonce source.
+func streamPSK(enc config.EncryptionSettings) *sec.ClientPSK {
+	psk := enc.Keys
+	if psk == nil {
+		psk = sec.NewClientPSKWithKDF([]byte(enc.PSK), enc.KDF)
+	}
+	return psk.WithNonces(enc.Nonces)
+}
+
+// encryptionPreface declares the PSK key derivation in a client-opened
+// stream preface, so the server derives the same key. Servers without the
+// psk_kdf feature get no declaration and derive the legacy key.
+func encryptionPreface(fields map[string]string, enc config.EncryptionSettings) map[string]string {
+	if enc.Enabled && !enc.OmitKDFPreface {
+		fields[protocolv1.PrefacePSKKDF] = enc.KDF.String()
+	}
+	return fields
 }
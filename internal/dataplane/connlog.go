@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/fortunnels/client/internal/support"
+)
+
+const connIDLen = 6
+
+// logDebug logs at DEBUG level (LOG_LEVEL=debug, or log_level in a reloaded
+// config file).
+func logDebug(format string, args ...any) {
+	if support.DebugEnabled() {
+		log.Printf("[DEBUG] "+format, args...)
+	}
+}
+
+var connIDEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// connLogger prefixes log lines with a per-connection correlation ID so the
+// lifecycle of one stream or local connection can be grepped out of busy logs.
+type connLogger struct {
+	id string
+}
+
+func newConnLogger() connLogger {
+	return connLogger{id: newConnID()}
+}
+
+// newConnID returns a short random base32 identifier (6 chars, lowercase).
+func newConnID() string {
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	return strings.ToLower(connIDEncoding.EncodeToString(b[:])[:connIDLen])
+}
+
+func (l connLogger) Printf(format string, args ...interface{}) {
+	if l.id == "" {
+		log.Printf(format, args...)
+		return
+	}
+	log.Printf("["+l.id+"] "+format, args...)
+}
+
+// Repeatf is Printf through support.RepeatLogs: lines with the same key are
+// collapsed across connections, the first one keeping its connection ID.
+func (l connLogger) Repeatf(key, format string, args ...interface{}) {
+	if l.id != "" {
+		format = "[" + l.id + "] " + format
+	}
+	support.RepeatLogs.Printf(key, format, args...)
+}
+
+// remoteAddrString returns c.RemoteAddr() when c exposes it.
+func remoteAddrString(c interface{}) string {
+	type remoteAddrer interface {
+		RemoteAddr() net.Addr
+	}
+	if ra, ok := c.(remoteAddrer); ok && ra.RemoteAddr() != nil {
+		return ra.RemoteAddr().String()
+	}
+	return "-"
+}
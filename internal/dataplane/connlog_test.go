@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prevOut, prevFlags := log.Writer(), log.Flags()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(prevOut)
+		log.SetFlags(prevFlags)
+	})
+	return &buf
+}
+
+func TestNewConnID(t *testing.T) {
+	re := regexp.MustCompile(`^[a-z2-7]{6}$`)
+	seen := map[string]bool{}
+	for range 100 {
+		id := newConnID()
+		require.Regexp(t, re, id)
+		seen[id] = true
+	}
+	assert.Greater(t, len(seen), 90, "IDs should be effectively unique")
+}
+
+func TestIncomingStream_LogsCarryCorrelationID(t *testing.T) {
+	buf := captureLog(t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	stream := &mockTCPStream{readData: []byte(`{"dst": "` + addr + `", "proto": "tcp"}` + "\n")}
+	lg := connLogger{id: "abc234"}
+	err = incomingStreamServer{}.serve(stream, lg)
+	require.Error(t, err)
+	lg.Printf("incoming stream error: %v", err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3, "open, close and error lines: %q", buf.String())
+	for _, line := range lines {
+		assert.True(t, strings.HasPrefix(line, "[abc234] "), "line %q lacks correlation ID", line)
+	}
+	assert.Contains(t, lines[0], "to "+addr)
+	assert.Contains(t, lines[1], "closed in=0 out=0 duration=")
+}
+
+func TestIncomingStream_UnlabeledLoggerKeepsQuiet(t *testing.T) {
+	buf := captureLog(t)
+	stream := &mockTCPStream{readData: []byte("invalid\n")}
+	require.Error(t, serveIncomingStream(stream, nil))
+	assert.Empty(t, buf.String())
+}
+
+func TestConnLogger_Printf(t *testing.T) {
+	buf := captureLog(t)
+	connLogger{id: "qwerty"}.Printf("hello %d", 1)
+	connLogger{}.Printf("plain")
+	assert.Equal(t, "[qwerty] hello 1\nplain\n", buf.String())
+}
+
+// mockTCPStream is an in-memory stream good enough for preface/dial paths.
+type mockTCPStream struct {
+	readData  []byte
+	writeData []byte
+}
+
+func (m *mockTCPStream) Read(b []byte) (int, error) {
+	if len(m.readData) == 0 {
+		return 0, net.ErrClosed
+	}
+	n := copy(b, m.readData)
+	m.readData = m.readData[n:]
+	return n, nil
+}
+
+func (m *mockTCPStream) Write(b []byte) (int, error) {
+	m.writeData = append(m.writeData, b...)
+	return len(b), nil
+}
+
+func (m *mockTCPStream) Close() error { return nil }
@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/fortunnels/client/internal/support"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+const (
+	// controlQueueSize bounds the control messages read but not yet handled.
+	// An unread stream would stall the whole smux session once its window
+	// fills, so the reader never waits for the handler: past this many the
+	// oldest queued message is dropped, unless it ends the tunnel
+	// (terminalControl).
+	controlQueueSize = 64
+	// controlReopenDelay spaces reopening a control stream that ended while
+	// its session stayed primary.
+	controlReopenDelay = time.Second
+)
+
+const controlDroppedFormat = "[WARN] control stream: handler is behind, dropped the oldest queued message"
+
+// ServeControlStream receives the tunnel's control messages on a stream of
+// mgr's data-plane session instead of a control WebSocket (--single-connection).
+// Every session mgr installs gets its own control stream; handle sees the
+// messages in order, from one goroutine. The returned func stops it.
+func ServeControlStream(mgr *Manager, tunnelID, instanceID string, handle func(protocolv1.Envelope)) func() {
+	q := newControlQueue()
+	stop := make(chan struct{})
+	go func() {
+		// A panicking handler loses its message; the next ones are handled.
+		_ = support.Supervise(support.PanicScope{Role: "control message handler", TunnelID: tunnelID}, stop, func() error {
+			for {
+				msg, ok := q.pop()
+				if !ok {
+					return nil
+				}
+				handle(msg)
+			}
+		})
+	}()
+	go func() {
+		defer q.close()
+		_ = support.Supervise(support.PanicScope{Role: "control stream", TunnelID: tunnelID}, stop, func() error {
+			runControlStream(mgr, tunnelID, instanceID, q, stop)
+			return nil
+		})
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(stop) }) }
+}
+
+// newControlQueue returns the queue between a control stream and its handler.
+func newControlQueue() *packetQueue[protocolv1.Envelope] {
+	return newPacketQueue[protocolv1.Envelope](controlQueueSize, "control").withKeep(terminalControl)
+}
+
+// terminalControl reports whether msg ends the tunnel: a tunnel_closed
+// event, an update to expired or the displacement notice. The handler must
+// see those however far behind it is.
+func terminalControl(msg protocolv1.Envelope) bool {
+	switch msg.Type {
+	case protocolv1.EventTunnelClosed, protocolv1.MessageTypeDisplaced:
+		return true
+	case protocolv1.EventTunnelUpdated:
+		var payload protocolv1.LifecycleEventPayload
+		return msg.DecodePayload(&payload) == nil && payload.Status == protocolv1.StatusExpired
+	}
+	return false
+}
+
+func runControlStream(mgr *Manager, tunnelID, instanceID string, q *packetQueue[protocolv1.Envelope], stop <-chan struct{}) {
+	preface, err := clientPreface(map[string]string{"proto": protocolv1.ProtoControl, "tunnel_id": tunnelID}, prefaceMeta{instanceID: instanceID})
+	if err != nil {
+		log.Printf("[ERROR] control stream: %v", err)
+		return
+	}
+	for {
+		sess, err := mgr.EnsureSession()
+		if err != nil {
+			return
+		}
+		retired := mgr.Retired(sess)
+		if err := readControlStream(sess, preface, q, retired, stop); err != nil && support.DebugEnabled() {
+			log.Printf("[DEBUG] control stream ended: %v", err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-mgr.Done():
+			return
+		case <-retired:
+			// The next session opens its control stream right away.
+		case <-time.After(controlReopenDelay):
+		}
+	}
+}
+
+// readControlStream opens the control stream on sess and queues what the
+// server writes on it until the stream ends, sess is retired or stop closes.
+func readControlStream(sess Session, preface []byte, q *packetQueue[protocolv1.Envelope], retired, stop <-chan struct{}) error {
+	st, err := sess.OpenStream()
+	if err != nil {
+		return fmt.Errorf("open: %w", err)
+	}
+	defer st.Close()
+	if _, err := st.Write(preface); err != nil {
+		return fmt.Errorf("write preface: %w", err)
+	}
+	ended := make(chan error, 1)
+	go func() {
+		defer support.RecoverAs(func(p *support.PanicError) {
+			support.ReportPanic(support.PanicScope{Role: "control stream reader"}, p)
+			ended <- p
+		})
+		dec := json.NewDecoder(st)
+		for {
+			var msg protocolv1.Envelope
+			if err := dec.Decode(&msg); err != nil {
+				ended <- err
+				return
+			}
+			if q.push(msg) {
+				support.RepeatLogs.Printf(support.LogKey(controlDroppedFormat), controlDroppedFormat)
+			}
+		}
+	}()
+	select {
+	case err := <-ended:
+		return err
+	case <-retired:
+	case <-stop:
+	}
+	return nil
+}
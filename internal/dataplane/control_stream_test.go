@@ -0,0 +1,142 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/testsupport"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+// startControlStream serves incoming streams of a new tunnel on the stub and
+// follows its control stream with handle.
+func startControlStream(t *testing.T, handle func(protocolv1.Envelope)) (*testsupport.Server, *protocolv1.Tunnel) {
+	t.Helper()
+	stub := testsupport.NewServer(testsupport.Options{})
+	t.Cleanup(stub.Close)
+	tun := stub.AddTunnel("tcp", "127.0.0.1:0")
+	mgr := NewManager(stub.URL, tun.ID, "", 10*time.Millisecond, 50*time.Millisecond, e2eRuntime())
+	t.Cleanup(mgr.Close)
+	go func() { _ = serveIncomingWithManager(mgr, nil) }()
+	t.Cleanup(ServeControlStream(mgr, tun.ID, "instance-a", handle))
+	require.NoError(t, stub.WaitWatchers(tun.ID, 1, 5*time.Second))
+	return stub, tun
+}
+
+func TestServeControlStream_SlowHandlerDoesNotBlockStreams(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var handled []string
+	stub, tun := startControlStream(t, func(msg protocolv1.Envelope) {
+		<-release
+		mu.Lock()
+		defer mu.Unlock()
+		handled = append(handled, msg.Type)
+	})
+	backend := startTCPEchoBackend(t)
+
+	// Far more than the queue holds, each larger than a typical stream window
+	// share, while the handler is stuck on the first.
+	big := strings.Repeat("x", 8<<10)
+	for i := range 4 * controlQueueSize {
+		require.NoError(t, stub.SendControl(tun.ID, "note", map[string]string{"n": string(rune('a' + i%26)), "pad": big}))
+	}
+	require.NoError(t, stub.SendControl(tun.ID, "last", nil))
+
+	st, err := stub.OpenStream(tun.ID, backend)
+	require.NoError(t, err, "data streams keep flowing while control messages pile up")
+	echoThroughStream(t, st, "while the handler is stuck")
+	st.Close()
+
+	close(release)
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(handled) > 0 && handled[len(handled)-1] == "last"
+	}, 5*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.LessOrEqual(t, len(handled), controlQueueSize+1, "the oldest queued messages were dropped")
+}
+
+// TestControlStream_KeepsTunnelClosedBehindPings: a tunnel_closed queued
+// while the handler is behind survives the pings that fill the queue after
+// it, and the handler gets it.
+func TestControlStream_KeepsTunnelClosedBehindPings(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	t.Cleanup(stub.Close)
+	tun := stub.AddTunnel("tcp", "127.0.0.1:0")
+	mgr := NewManager(stub.URL, tun.ID, "", 10*time.Millisecond, 50*time.Millisecond, e2eRuntime())
+	t.Cleanup(mgr.Close)
+	go func() { _ = serveIncomingWithManager(mgr, nil) }()
+	q := newControlQueue()
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	go runControlStream(mgr, tun.ID, "instance-a", q, stop)
+	require.NoError(t, stub.WaitWatchers(tun.ID, 1, 5*time.Second))
+
+	// Nothing pops: the handler is stuck while subscribed, tunnel_closed,
+	// pings and a last message arrive.
+	require.NoError(t, stub.SendControl(tun.ID, protocolv1.EventTunnelClosed, protocolv1.LifecycleEventPayload{Reason: protocolv1.ReasonDeleted}))
+	pings := 2 * controlQueueSize
+	for range pings {
+		require.NoError(t, stub.SendControl(tun.ID, protocolv1.MessageTypePing, nil))
+	}
+	require.NoError(t, stub.SendControl(tun.ID, "last", nil))
+	sent := 1 + 1 + pings + 1
+	require.Eventually(t, func() bool { return q.Dropped() == uint64(sent-controlQueueSize) }, 5*time.Second, time.Millisecond)
+
+	var handled []string
+	for range controlQueueSize {
+		msg, ok := q.pop()
+		require.True(t, ok)
+		handled = append(handled, msg.Type)
+	}
+	assert.Equal(t, protocolv1.EventTunnelClosed, handled[0], "tunnel_closed was not dropped for newer pings")
+	assert.Equal(t, "last", handled[len(handled)-1])
+}
+
+func TestTerminalControl(t *testing.T) {
+	for _, tc := range []struct {
+		msg  protocolv1.Envelope
+		want bool
+	}{
+		{protocolv1.NewEnvelope(protocolv1.EventTunnelClosed, nil), true},
+		{protocolv1.NewEnvelope(protocolv1.MessageTypeDisplaced, protocolv1.DisplacedPayload{InstanceID: "b"}), true},
+		{protocolv1.NewEnvelope(protocolv1.EventTunnelUpdated, protocolv1.LifecycleEventPayload{Status: protocolv1.StatusExpired}), true},
+		{protocolv1.NewEnvelope(protocolv1.EventTunnelUpdated, protocolv1.LifecycleEventPayload{Status: protocolv1.StatusPaused}), false},
+		{protocolv1.NewEnvelope(protocolv1.MessageTypePing, nil), false},
+		{protocolv1.NewEnvelope(protocolv1.MessageTypeMigrate, nil), false},
+	} {
+		assert.Equal(t, tc.want, terminalControl(tc.msg), tc.msg.Type)
+	}
+}
+
+func TestServeControlStream_ReopensOnNewSession(t *testing.T) {
+	got := make(chan string, 16)
+	stub, tun := startControlStream(t, func(msg protocolv1.Envelope) { got <- msg.Type })
+	assert.Equal(t, protocolv1.MessageTypeSubscribed, <-got)
+	webSockets, streams := stub.Watchers(tun.ID)
+	assert.Equal(t, 0, webSockets)
+	assert.Equal(t, 1, streams)
+	pre := stub.ClientPrefaces(tun.ID)
+	require.Len(t, pre, 1)
+	assert.Equal(t, map[string]string{"proto": "control", "tunnel_id": tun.ID, "client_instance": "instance-a"}, pre[0])
+
+	stub.DropSessions(tun.ID)
+	require.Eventually(t, func() bool {
+		_, streams := stub.Watchers(tun.ID)
+		return stub.LiveSessions(tun.ID) == 1 && streams == 1
+	}, 5*time.Second, 10*time.Millisecond, "the new session gets a control stream")
+	assert.Equal(t, protocolv1.MessageTypeSubscribed, <-got)
+	require.NoError(t, stub.SendControl(tun.ID, protocolv1.EventTunnelClosed, nil))
+	assert.Equal(t, protocolv1.EventTunnelClosed, <-got)
+}
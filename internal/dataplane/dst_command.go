@@ -0,0 +1,177 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/fortunnels/client/internal/support"
+)
+
+const (
+	// dstCommandPeekBytes bounds how much of a connection's first bytes are
+	// handed to --dst-command (enough for a TLS ClientHello with SNI).
+	dstCommandPeekBytes      = 4096
+	defaultDstCommandTimeout = 500 * time.Millisecond
+
+	// Environment passed to --dst-command.
+	dstCommandPeerEnv     = "FORTUNNELS_PEER_ADDR"
+	dstCommandDefaultEnv  = "FORTUNNELS_DEFAULT_DST"
+	dstCommandMaxOutBytes = 1024
+)
+
+// peekedConn is a net.Conn whose reads go through a buffered reader, so bytes
+// peeked before forwarding are still delivered first.
+type peekedConn struct {
+	net.Conn
+	rd *bufio.Reader
+}
+
+func newPeekedConn(c net.Conn, size int) *peekedConn {
+	return &peekedConn{Conn: c, rd: bufio.NewReaderSize(c, size)}
+}
+
+func (p *peekedConn) Read(b []byte) (int, error) { return p.rd.Read(b) }
+
+// WriteTo shadows the embedded conn's WriteTo so io.Copy cannot skip the
+// peeked bytes.
+func (p *peekedConn) WriteTo(w io.Writer) (int64, error) { return p.rd.WriteTo(w) }
+
+// CloseWrite half-closes the wrapped connection when it supports it.
+func (p *peekedConn) CloseWrite() error {
+	if cw, ok := p.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return errors.ErrUnsupported
+}
+
+// peek returns up to limit bytes that arrive before the deadline without
+// consuming them. Protocols where the server speaks first yield no bytes
+// (after waiting for the deadline).
+func (p *peekedConn) peek(limit int, deadline time.Time) []byte {
+	if err := p.Conn.SetReadDeadline(deadline); err != nil {
+		return nil
+	}
+	defer func() { _ = p.Conn.SetReadDeadline(time.Time{}) }()
+	if _, err := p.rd.Peek(1); err != nil {
+		return nil
+	}
+	n := p.rd.Buffered()
+	if n > limit {
+		n = limit
+	}
+	b, _ := p.rd.Peek(n)
+	return b
+}
+
+// dstCommands runs --dst-command for every listener of the process.
+var dstCommands = support.NewChildRunner(support.ChildLimits{MaxOutput: dstCommandMaxOutBytes})
+
+// SetDstCommandLimits bounds --dst-command: at most maxProcs run at once
+// (0: support.DefaultChildProcs), and passEnv are passed through to them
+// besides the FORTUNNELS_* variables and the basic ones like PATH.
+func SetDstCommandLimits(maxProcs int, passEnv []string) {
+	dstCommands.SetLimits(support.ChildLimits{MaxProcs: maxProcs, MaxOutput: dstCommandMaxOutBytes, PassEnv: passEnv})
+}
+
+// WriteDstCommandSummary writes how --dst-command runs went, if any ran.
+func WriteDstCommandSummary(w io.Writer) {
+	st := dstCommands.Stats()
+	if st.Started == 0 && st.Busy == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n🧭 --dst-command: %d runs, %d timed out, %d failed, %d skipped (too many running)\n",
+		st.Started, st.TimedOut, st.Failed, st.Busy)
+}
+
+// dstResolver picks the server-side destination for a listen connection:
+// by the server name of its TLS ClientHello with sniRoutes (--sni-route),
+// else with a command. Without either every connection goes to fallback.
+type dstResolver struct {
+	fallback  string
+	command   string
+	timeout   time.Duration
+	peekMax   int
+	sniRoutes map[string]string
+}
+
+// resolve returns the conn to forward (wrapping c when bytes were peeked) and
+// the destination for its preface.
+func (r dstResolver) resolve(c net.Conn, lg connLogger) (net.Conn, string) {
+	if len(r.sniRoutes) > 0 {
+		return r.resolveSNI(c, lg)
+	}
+	if r.command == "" {
+		return c, r.fallback
+	}
+	timeout := r.timeout
+	if timeout <= 0 {
+		timeout = defaultDstCommandTimeout
+	}
+	peekMax := r.peekMax
+	if peekMax <= 0 {
+		peekMax = dstCommandPeekBytes
+	}
+	pc := newPeekedConn(c, peekMax)
+	head := pc.peek(peekMax, time.Now().Add(timeout))
+	dst, err := r.run(head, remoteAddrString(c), time.Now().Add(timeout))
+	if err != nil {
+		lg.Printf("[WARN] dst-command failed, using %s: %v", r.fallback, err)
+		return pc, r.fallback
+	}
+	return pc, dst
+}
+
+func (r dstResolver) run(stdin []byte, peer string, deadline time.Time) (string, error) {
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	res, err := dstCommands.Run(ctx, support.ChildSpec{
+		Path:  r.command,
+		Stdin: stdin,
+		Env:   []string{dstCommandPeerEnv + "=" + peer, dstCommandDefaultEnv + "=" + r.fallback},
+	})
+	if err != nil {
+		if out := strings.TrimSpace(string(res.Output)); out != "" {
+			return "", fmt.Errorf("%w: %s", err, out)
+		}
+		return "", err
+	}
+	line, _, _ := strings.Cut(string(res.Stdout), "\n")
+	dst := strings.TrimSpace(line)
+	if _, _, err := net.SplitHostPort(dst); err != nil {
+		return "", err
+	}
+	return dst, nil
+}
+
+// limitedBuffer keeps the first max bytes written and discards the rest.
+type limitedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); room > 0 {
+		if len(p) > room {
+			b.Buffer.Write(p[:room])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// ReadFrom shadows bytes.Buffer's ReadFrom so io.Copy (and exec's stdout
+// copier) cannot bypass max.
+func (b *limitedBuffer) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(struct{ io.Writer }{b}, r)
+}
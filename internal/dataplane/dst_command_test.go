@@ -0,0 +1,178 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/testsupport"
+)
+
+func writeScript(t *testing.T, body string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("shell scripts are not available on windows")
+	}
+	path := filepath.Join(t.TempDir(), "route.sh")
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0o700))
+	return path
+}
+
+func tcpPair(t *testing.T) (client, server net.Conn) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, _ := ln.Accept()
+		accepted <- c
+	}()
+	client, err = net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	server = <-accepted
+	require.NotNil(t, server)
+	t.Cleanup(func() { client.Close(); server.Close() })
+	return client, server
+}
+
+func TestPeekedConn_CopyDeliversPeekedBytesFirst(t *testing.T) {
+	client, server := tcpPair(t)
+	_, err := client.Write([]byte("hello world"))
+	require.NoError(t, err)
+	require.NoError(t, client.Close())
+
+	pc := newPeekedConn(server, 64)
+	assert.Equal(t, "hello world", string(pc.peek(64, time.Now().Add(time.Second))))
+
+	var out bytes.Buffer
+	_, err = io.Copy(&out, pc)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", out.String())
+}
+
+func TestPeekedConn_PeekTimesOutWithoutData(t *testing.T) {
+	_, server := tcpPair(t)
+	pc := newPeekedConn(server, 64)
+	assert.Empty(t, pc.peek(64, time.Now().Add(20*time.Millisecond)))
+}
+
+func TestDstResolver_Fallbacks(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"picks output", "echo 10.0.0.1:22\n", "10.0.0.1:22"},
+		{"non-zero exit", "echo 10.0.0.1:22; exit 3\n", "fallback:1"},
+		{"timeout", "sleep 2; echo 10.0.0.1:22\n", "fallback:1"},
+		{"not host:port", "echo nonsense\n", "fallback:1"},
+		{"default dst env", "echo \"$FORTUNNELS_DEFAULT_DST\" | sed s/fallback/picked/\n", "picked:1"},
+		{"peer env", "case \"$FORTUNNELS_PEER_ADDR\" in 127.0.0.1:*) echo peer:1;; esac\n", "peer:1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := tcpPair(t)
+			_, err := client.Write([]byte("x"))
+			require.NoError(t, err)
+			r := dstResolver{fallback: "fallback:1", command: writeScript(t, tt.script), timeout: 300 * time.Millisecond}
+			_, dst := r.resolve(server, connLogger{})
+			assert.Equal(t, tt.want, dst)
+		})
+	}
+}
+
+func TestDstResolver_NoCommandKeepsConn(t *testing.T) {
+	_, server := tcpPair(t)
+	conn, dst := dstResolver{fallback: "db:5432"}.resolve(server, connLogger{})
+	assert.Equal(t, "db:5432", dst)
+	assert.Same(t, server, conn)
+}
+
+func TestListen_DstCommandRoutesConcurrentConnections(t *testing.T) {
+	addrA := startEchoBackend(t, "A:").Addr().String()
+	addrB := startEchoBackend(t, "B:").Addr().String()
+	script := writeScript(t, fmt.Sprintf("prefix=$(head -c 4)\nif [ \"$prefix\" = ALFA ]; then echo %s; else echo %s; fi\n", addrA, addrB))
+
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	tun := stub.AddTunnel("tcp", "127.0.0.1:0")
+
+	rt := e2eRuntime()
+	rt.DstCommand = script
+	rt.DstCommandTimeout = 2 * time.Second
+	mgr := NewManager(stub.URL, tun.ID, "", 10*time.Millisecond, 50*time.Millisecond, rt)
+	defer mgr.Close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		_ = serveListener(ln, mgr, newListenForwarder(tun.ID, "127.0.0.1:1", rt, config.EncryptionSettings{}))
+	}()
+
+	var wg sync.WaitGroup
+	for _, tc := range []struct{ msg, want string }{
+		{"ALFA hello", "A:ALFA hello"},
+		{"BETA hello", "B:BETA hello"},
+	} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := net.Dial("tcp", ln.Addr().String())
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer c.Close()
+			_, err = c.Write([]byte(tc.msg))
+			assert.NoError(t, err)
+			_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+			buf := make([]byte, len(tc.want))
+			_, err = io.ReadFull(c, buf)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, string(buf), "peeked bytes reach the chosen destination first")
+		}()
+	}
+	wg.Wait()
+}
+
+func TestListen_ForwardsToStaticDst(t *testing.T) {
+	backend := startEchoBackend(t, "S:").Addr().String()
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	tun := stub.AddTunnel("tcp", "127.0.0.1:0")
+
+	rt := e2eRuntime()
+	mgr := NewManager(stub.URL, tun.ID, "", 10*time.Millisecond, 50*time.Millisecond, rt)
+	defer mgr.Close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		_ = serveListener(ln, mgr, newListenForwarder(tun.ID, backend, rt, config.EncryptionSettings{}))
+	}()
+
+	c, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer c.Close()
+	_, err = c.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 6)
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.ReadFull(c, buf)
+	require.NoError(t, err)
+	require.Equal(t, "S:ping", string(buf))
+}
@@ -5,6 +5,7 @@ package dataplane
 
 import (
 	"bufio"
+	"context"
 	"net"
 	"net/url"
 	"sync"
@@ -12,8 +13,9 @@ import (
 	dtls "github.com/pion/dtls/v3"
 )
 
-// startDTLSDataPlaneUDP listens on udpListen and forwards via DTLS to server
-func StartDTLSDataPlaneUDP(serverURL, dtlsPort, tunnelID, authToken, udpDst, udpListen string) error {
+// StartDTLSDataPlaneUDP listens on udpListen and forwards via DTLS to server
+// until the connection fails or ctx is done.
+func StartDTLSDataPlaneUDP(ctx context.Context, serverURL, dtlsPort, tunnelID, authToken, udpDst, udpListen string) error {
 	// local UDP listen
 	laddr, err := net.ResolveUDPAddr("udp", udpListen)
 	if err != nil {
@@ -24,27 +26,19 @@ func StartDTLSDataPlaneUDP(serverURL, dtlsPort, tunnelID, authToken, udpDst, udp
 		return err
 	}
 	defer uc.Close()
-	// resolve server host and dtls port (from default config 4444)
-	u, err := url.Parse(serverURL)
+	conn, err := dialDTLS(serverURL, dtlsPort)
 	if err != nil {
 		return err
 	}
-	host := net.JoinHostPort(u.Hostname(), dtlsPort)
-	// DTLS dial with proper certificate validation
-	uaddr, err := net.ResolveUDPAddr("udp", host)
-	if err != nil {
-		return err
-	}
-	conn, err := dtls.DialWithOptions(
-		"udp", uaddr,
-		dtls.WithInsecureSkipVerify(false),
-		dtls.WithExtendedMasterSecret(dtls.RequireExtendedMasterSecret),
-		dtls.WithServerName(u.Hostname()),
-	)
-	if err != nil {
+	defer conn.Close()
+	// Closing both ends stops the handshake and the forwarding loops.
+	defer context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+		_ = uc.Close()
+	})()
+	if err := conn.HandshakeContext(ctx); err != nil {
 		return err
 	}
-	defer conn.Close()
 	// bootstrap with destination
 	b, err := encodePreface(map[string]string{"auth": authToken, "tunnel_id": tunnelID, "dst": udpDst})
 	if err != nil {
@@ -58,5 +52,32 @@ func StartDTLSDataPlaneUDP(serverURL, dtlsPort, tunnelID, authToken, udpDst, udp
 	errCh := make(chan error, 2)
 	startUDPLocalToStream(conn, uc, errCh, &lastSrcMu, &lastSrc)
 	startStreamToUDPLocal(bufio.NewReader(conn), uc, errCh, &lastSrcMu, &lastSrc)
-	return <-errCh
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// dialDTLS dials the server's DTLS port with certificate validation. The
+// handshake happens on first use or via HandshakeContext.
+func dialDTLS(serverURL, dtlsPort string) (*dtls.Conn, error) {
+	// resolve server host and dtls port (from default config 4444)
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	host := net.JoinHostPort(u.Hostname(), dtlsPort)
+	// DTLS dial with proper certificate validation
+	uaddr, err := net.ResolveUDPAddr("udp", host)
+	if err != nil {
+		return nil, err
+	}
+	return dtls.DialWithOptions(
+		"udp", uaddr,
+		dtls.WithInsecureSkipVerify(false),
+		dtls.WithExtendedMasterSecret(dtls.RequireExtendedMasterSecret),
+		dtls.WithServerName(u.Hostname()),
+	)
 }
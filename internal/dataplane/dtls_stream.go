@@ -0,0 +1,262 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	dtls "github.com/pion/dtls/v3"
+
+	"github.com/fortunnels/client/internal/support"
+)
+
+const (
+	// dtlsStreamHeaderSize is a stream frame's header: the uint32 connection
+	// ID and the uint16 payload length, both big-endian.
+	dtlsStreamHeaderSize = 6
+	// dtlsStreamChunk caps a frame's payload so header, payload and DTLS
+	// record overhead fit into one datagram of the default 1200-byte MTU.
+	dtlsStreamChunk = 1024
+	// dtlsLocalWriteTimeout bounds a write to a local connection; one that
+	// stops reading is torn down instead of stalling every other connection
+	// behind it.
+	dtlsLocalWriteTimeout = 10 * time.Second
+)
+
+// StartDTLSDataPlaneTCPListen is TCP listen mode over the DTLS data plane:
+// it accepts local TCP connections on listenAddr and multiplexes them over
+// one DTLS connection to the server-side dst until the connection fails or
+// ctx is done. See serveDTLSStreams for the framing.
+func StartDTLSDataPlaneTCPListen(ctx context.Context, serverURL, dtlsPort, tunnelID, authToken, dst, listenAddr string) error {
+	ln, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return fmt.Errorf("listen tcp: %w", support.ExplainBindError(listenAddr, err))
+	}
+	defer ln.Close()
+	conn, err := dialDTLS(serverURL, dtlsPort)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return startDTLSStreams(ctx, conn, ln, tunnelID, authToken, dst)
+}
+
+// startDTLSStreams completes the handshake of conn, sends the stream-mode
+// preface and serves ln over it.
+func startDTLSStreams(ctx context.Context, conn *dtls.Conn, ln net.Listener, tunnelID, authToken, dst string) error {
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	err := conn.HandshakeContext(ctx)
+	stop()
+	if err != nil {
+		return err
+	}
+	b, err := encodePreface(map[string]string{"auth": authToken, "tunnel_id": tunnelID, "dst": dst, "proto": "tcp"})
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(b); err != nil {
+		return err
+	}
+	return serveDTLSStreams(ctx, conn, ln)
+}
+
+// serveDTLSStreams carries every connection accepted on ln over conn, after
+// the preface. Each one gets a connection ID, never reused; its bytes travel
+// as [connID|len|payload] frames in both directions. The first frame of an ID
+// opens the connection to dst on the server, a zero-length frame closes it
+// from either side. Frames for an ID that is already closed are answered with
+// a close frame and dropped. Loss and reordering are handled by the server per
+// the DTLS framing contract; the client only keeps per-connection state
+// consistent.
+func serveDTLSStreams(ctx context.Context, conn net.Conn, ln net.Listener) error {
+	m := &dtlsStreamMux{w: conn, conns: make(map[uint32]net.Conn)}
+	defer m.closeAll()
+	defer context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+		_ = ln.Close()
+	})()
+	errCh := make(chan error, 2)
+	failed := func(role string) func(*support.PanicError) {
+		return func(p *support.PanicError) {
+			support.ReportPanic(support.PanicScope{Role: role}, p)
+			errCh <- p
+		}
+	}
+	go func() {
+		defer support.RecoverAs(failed("dtls frame reader"))
+		errCh <- m.readFrames(bufio.NewReader(conn))
+	}()
+	go func() {
+		defer support.RecoverAs(failed("dtls accept loop"))
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				errCh <- fmt.Errorf("accept: %w", err)
+				return
+			}
+			id := m.add(c)
+			support.Go(support.PanicScope{Role: "dtls stream"}, func() { m.pump(id, c) })
+		}
+	}()
+	err := <-errCh
+	_ = conn.Close()
+	_ = ln.Close()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// dtlsStreamMux is the per-connection state of serveDTLSStreams.
+type dtlsStreamMux struct {
+	// w is the DTLS connection; wmu keeps each frame in one record.
+	w   io.Writer
+	wmu sync.Mutex
+
+	mu     sync.Mutex
+	conns  map[uint32]net.Conn
+	lastID uint32
+}
+
+// add registers a newly accepted local connection and returns its ID.
+func (m *dtlsStreamMux) add(c net.Conn) uint32 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastID++
+	m.conns[m.lastID] = c
+	processTraffic.streams.Add(1)
+	return m.lastID
+}
+
+// remove drops the state of id and closes its local connection. notify
+// tells the server with a close frame; it is false when the server closed
+// the connection. Only the first remove of an ID has any effect.
+func (m *dtlsStreamMux) remove(id uint32, notify bool) {
+	m.mu.Lock()
+	c := m.conns[id]
+	delete(m.conns, id)
+	m.mu.Unlock()
+	if c == nil {
+		return
+	}
+	_ = c.Close()
+	if notify {
+		_ = m.writeFrame(id, nil)
+	}
+}
+
+func (m *dtlsStreamMux) lookup(id uint32) net.Conn {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.conns[id]
+}
+
+// closeAll closes every local connection once the DTLS connection is gone.
+func (m *dtlsStreamMux) closeAll() {
+	m.mu.Lock()
+	conns := m.conns
+	m.conns = map[uint32]net.Conn{}
+	m.mu.Unlock()
+	for _, c := range conns {
+		_ = c.Close()
+	}
+}
+
+// pump frames what the local connection id sends until it closes.
+func (m *dtlsStreamMux) pump(id uint32, c net.Conn) {
+	defer m.remove(id, true)
+	buf := make([]byte, dtlsStreamChunk)
+	for {
+		n, err := c.Read(buf)
+		if n > 0 {
+			processTraffic.up.Add(int64(n))
+			if werr := m.writeFrame(id, buf[:n]); werr != nil {
+				return
+			}
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("[WARN] dtls tcp conn %d: %v", id, err)
+			}
+			return
+		}
+	}
+}
+
+// readFrames demultiplexes server frames to their local connections until
+// the DTLS connection fails.
+func (m *dtlsStreamMux) readFrames(r io.Reader) error {
+	for {
+		id, payload, err := readDTLSStreamFrame(r)
+		if err != nil {
+			return err
+		}
+		if len(payload) == 0 {
+			m.remove(id, false)
+			continue
+		}
+		c := m.lookup(id)
+		if c == nil {
+			// Closed locally while the server was still sending.
+			_ = m.writeFrame(id, nil)
+			continue
+		}
+		_ = c.SetWriteDeadline(time.Now().Add(dtlsLocalWriteTimeout))
+		if _, err := c.Write(payload); err != nil {
+			m.remove(id, true)
+			continue
+		}
+		processTraffic.down.Add(int64(len(payload)))
+	}
+}
+
+func (m *dtlsStreamMux) writeFrame(id uint32, payload []byte) error {
+	m.wmu.Lock()
+	defer m.wmu.Unlock()
+	return writeDTLSStreamFrame(m.w, id, payload)
+}
+
+// writeDTLSStreamFrame writes one frame with a single Write, so that over
+// DTLS it is a single record. payload must not exceed dtlsStreamChunk.
+func writeDTLSStreamFrame(w io.Writer, id uint32, payload []byte) error {
+	if len(payload) > dtlsStreamChunk {
+		return fmt.Errorf("dtls stream frame of %d bytes exceeds %d", len(payload), dtlsStreamChunk)
+	}
+	length, err := support.ToUint16Size(len(payload))
+	if err != nil {
+		return err
+	}
+	frame := make([]byte, dtlsStreamHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], id)
+	binary.BigEndian.PutUint16(frame[4:6], length)
+	copy(frame[dtlsStreamHeaderSize:], payload)
+	_, err = w.Write(frame)
+	return err
+}
+
+func readDTLSStreamFrame(r io.Reader) (uint32, []byte, error) {
+	var hdr [dtlsStreamHeaderSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	id := binary.BigEndian.Uint32(hdr[0:4])
+	n := int(binary.BigEndian.Uint16(hdr[4:6]))
+	if n > udpMaxPacketSize {
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return id, payload, nil
+}
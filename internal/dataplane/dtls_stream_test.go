@@ -0,0 +1,211 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	dtls "github.com/pion/dtls/v3"
+	"github.com/pion/dtls/v3/pkg/crypto/selfsign"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dtlsStreamEcho is a loopback DTLS server speaking the stream framing: it
+// echoes every data frame to its connection ID, closes an ID when its payload
+// is "close-me" and records the close frames it receives.
+type dtlsStreamEcho struct {
+	addr    *net.UDPAddr
+	preface chan map[string]string
+
+	mu     sync.Mutex
+	closed map[uint32]bool
+}
+
+func startDTLSStreamEcho(t *testing.T) *dtlsStreamEcho {
+	t.Helper()
+	cert, err := selfsign.GenerateSelfSigned()
+	require.NoError(t, err)
+	ln, err := dtls.ListenWithOptions("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)},
+		dtls.WithCertificates(cert),
+		dtls.WithExtendedMasterSecret(dtls.RequireExtendedMasterSecret),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	e := &dtlsStreamEcho{addr: ln.Addr().(*net.UDPAddr), preface: make(chan map[string]string, 1), closed: map[uint32]bool{}}
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		rd := bufio.NewReader(c)
+		line, err := rd.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		var pre map[string]string
+		_ = json.Unmarshal(line, &pre)
+		e.preface <- pre
+		var wmu sync.Mutex
+		for {
+			id, payload, err := readDTLSStreamFrame(rd)
+			if err != nil {
+				return
+			}
+			reply := payload
+			switch {
+			case len(payload) == 0:
+				e.mu.Lock()
+				e.closed[id] = true
+				e.mu.Unlock()
+				continue
+			case string(payload) == "close-me":
+				reply = nil
+			}
+			wmu.Lock()
+			_ = writeDTLSStreamFrame(c, id, reply)
+			wmu.Unlock()
+		}
+	}()
+	return e
+}
+
+func (e *dtlsStreamEcho) sawClose(id uint32) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.closed[id]
+}
+
+// dialDTLSStreams runs startDTLSStreams against e, trusting its self-signed
+// certificate, and returns the local listen address.
+func dialDTLSStreams(t *testing.T, ctx context.Context, e *dtlsStreamEcho) (string, <-chan error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	conn, err := dtls.DialWithOptions("udp", e.addr,
+		dtls.WithInsecureSkipVerify(true),
+		dtls.WithExtendedMasterSecret(dtls.RequireExtendedMasterSecret),
+	)
+	require.NoError(t, err)
+	done := make(chan error, 1)
+	go func() {
+		defer ln.Close()
+		defer conn.Close()
+		done <- startDTLSStreams(ctx, conn, ln, "tid", "auth-token", "127.0.0.1:5432")
+	}()
+	return ln.Addr().String(), done
+}
+
+func TestDTLSStreams_EchoesEachConnection(t *testing.T) {
+	e := startDTLSStreamEcho(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr, done := dialDTLSStreams(t, ctx, e)
+
+	select {
+	case pre := <-e.preface:
+		assert.Equal(t, map[string]string{"auth": "auth-token", "tunnel_id": "tid", "dst": "127.0.0.1:5432", "proto": "tcp"}, pre)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no preface")
+	}
+
+	a, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer a.Close()
+	b, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer b.Close()
+
+	// Larger than one frame, so it is split and reassembled in order.
+	big := bytes.Repeat([]byte("0123456789"), 500)
+	var wg sync.WaitGroup
+	for _, c := range []struct {
+		conn net.Conn
+		data []byte
+	}{{a, big}, {b, []byte("hello from b")}} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.conn.Write(c.data)
+			assert.NoError(t, err)
+			got := make([]byte, len(c.data))
+			require.NoError(t, c.conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+			_, err = io.ReadFull(c.conn, got)
+			assert.NoError(t, err)
+			assert.Equal(t, c.data, got)
+		}()
+	}
+	wg.Wait()
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancel did not stop the DTLS streams")
+	}
+	require.NoError(t, a.SetReadDeadline(time.Now().Add(2*time.Second)))
+	_, err = a.Read(make([]byte, 1))
+	assert.Error(t, err, "local connections are closed with the DTLS connection")
+}
+
+func TestDTLSStreams_TearDownOnEitherSide(t *testing.T) {
+	e := startDTLSStreamEcho(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr, _ := dialDTLSStreams(t, ctx, e)
+	<-e.preface
+
+	// Local close: the server gets a zero-length frame for the first ID.
+	local, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	_, err = local.Write([]byte("ping"))
+	require.NoError(t, err)
+	_, err = io.ReadFull(local, make([]byte, 4))
+	require.NoError(t, err)
+	require.NoError(t, local.Close())
+	assert.Eventually(t, func() bool { return e.sawClose(1) }, 5*time.Second, 10*time.Millisecond)
+
+	// Server close: the local connection sees EOF and is not reported back.
+	remote, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer remote.Close()
+	_, err = remote.Write([]byte("close-me"))
+	require.NoError(t, err)
+	require.NoError(t, remote.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = remote.Read(make([]byte, 1))
+	assert.True(t, errors.Is(err, io.EOF), "err = %v", err)
+	time.Sleep(100 * time.Millisecond)
+	assert.False(t, e.sawClose(2), "a connection the server closed is not closed again")
+}
+
+func TestStartDTLSDataPlaneTCPListen_InvalidURL(t *testing.T) {
+	err := StartDTLSDataPlaneTCPListen(context.Background(), "://bad", "443", "tid", "auth", "127.0.0.1:5432", "127.0.0.1:0")
+	require.Error(t, err)
+}
+
+func TestDTLSStreamFrame_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeDTLSStreamFrame(&buf, 7, []byte("abc")))
+	require.NoError(t, writeDTLSStreamFrame(&buf, 7, nil))
+	assert.Equal(t, []byte{0, 0, 0, 7, 0, 3, 'a', 'b', 'c', 0, 0, 0, 7, 0, 0}, buf.Bytes())
+	id, p, err := readDTLSStreamFrame(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(7), id)
+	assert.Equal(t, "abc", string(p))
+	_, p, err = readDTLSStreamFrame(&buf)
+	require.NoError(t, err)
+	assert.Empty(t, p, "zero-length frame closes the connection")
+	assert.Error(t, writeDTLSStreamFrame(&buf, 1, make([]byte, dtlsStreamChunk+1)))
+}
@@ -3,10 +3,13 @@
 
 package dataplane
 
-import "testing"
+import (
+	"context"
+	"testing"
+)
 
 func TestStartDTLSDataPlaneUDPInvalidURL(t *testing.T) {
-	err := StartDTLSDataPlaneUDP("://bad", "443", "tid", "auth", "127.0.0.1:53", "127.0.0.1:0")
+	err := StartDTLSDataPlaneUDP(context.Background(), "://bad", "443", "tid", "auth", "127.0.0.1:53", "127.0.0.1:0")
 	if err == nil {
 		t.Fatalf("StartDTLSDataPlaneUDP() expected error for invalid URL")
 	}
@@ -0,0 +1,239 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+	sec "github.com/fortunnels/client/internal/security"
+	"github.com/fortunnels/client/internal/testsupport"
+)
+
+func e2eRuntime() config.RuntimeSettings {
+	return config.RuntimeSettings{
+		PingInterval:          time.Second,
+		PingTimeout:           time.Second,
+		SmuxKeepAliveInterval: 10 * time.Second,
+		SmuxKeepAliveTimeout:  30 * time.Second,
+	}
+}
+
+func startTCPEchoBackend(t *testing.T) string {
+	return startEchoBackend(t, "").Addr().String()
+}
+
+// startEchoBackend runs a TCP echo backend that first answers every
+// connection with greeting, so tests can tell backends apart. Closing the
+// returned listener stops it.
+func startEchoBackend(t *testing.T, greeting string) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go serveEcho(ln, greeting)
+	return ln
+}
+
+// serveEcho sends greeting to each connection accepted on ln and then
+// echoes what it reads, until ln is closed.
+func serveEcho(ln net.Listener, greeting string) {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer c.Close()
+			if _, err := io.WriteString(c, greeting); err != nil {
+				return
+			}
+			_, _ = io.Copy(c, c)
+		}()
+	}
+}
+
+func startUDPEchoBackend(t *testing.T) string {
+	t.Helper()
+	uc, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() { uc.Close() })
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, src, err := uc.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			_, _ = uc.WriteToUDP(buf[:n], src)
+		}
+	}()
+	return uc.LocalAddr().String()
+}
+
+func freeUDPAddr(t *testing.T) string {
+	t.Helper()
+	uc, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	addr := uc.LocalAddr().String()
+	uc.Close()
+	return addr
+}
+
+func echoThroughStream(t *testing.T, st io.ReadWriter, msg string) {
+	t.Helper()
+	_, err := st.Write([]byte(msg))
+	require.NoError(t, err)
+	buf := make([]byte, len(msg))
+	_, err = io.ReadFull(st, buf)
+	require.NoError(t, err)
+	require.Equal(t, msg, string(buf))
+}
+
+func TestE2E_ServeIncoming_ReconnectsAfterDrop(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	tun := stub.AddTunnel("tcp", "127.0.0.1:0")
+	backend := startTCPEchoBackend(t)
+
+	mgr := NewManager(stub.URL, tun.ID, "dp-token", 10*time.Millisecond, 50*time.Millisecond, e2eRuntime())
+	errCh := make(chan error, 1)
+	go func() { errCh <- serveIncomingWithManager(mgr, nil) }()
+
+	require.NoError(t, stub.WaitSessions(tun.ID, 1, 5*time.Second))
+	require.Equal(t, "dp-token", stub.SessionAuth(tun.ID))
+	st, err := stub.OpenStream(tun.ID, backend)
+	require.NoError(t, err)
+	echoThroughStream(t, st, "before drop")
+	st.Close()
+
+	stub.DropSessions(tun.ID)
+	require.NoError(t, stub.WaitSessions(tun.ID, 2, 5*time.Second), "client should reconnect after the WS drop")
+
+	require.Eventually(t, func() bool {
+		st, err := stub.OpenStream(tun.ID, backend)
+		if err != nil {
+			return false
+		}
+		defer st.Close()
+		echoThroughStream(t, st, "after drop")
+		return true
+	}, 5*time.Second, 50*time.Millisecond)
+
+	mgr.Close()
+	select {
+	case err := <-errCh:
+		require.EqualError(t, err, "stopped")
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve loop did not stop after Close")
+	}
+}
+
+func TestE2E_ServeIncoming_BackendDownReportsSetupError(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	tun := stub.AddTunnel("tcp", "127.0.0.1:0")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	deadAddr := ln.Addr().String()
+	ln.Close()
+
+	mgr := NewManager(stub.URL, tun.ID, "", 10*time.Millisecond, 50*time.Millisecond, e2eRuntime())
+	defer mgr.Close()
+	go func() { _ = serveIncomingWithManager(mgr, nil) }()
+
+	require.NoError(t, stub.WaitSessions(tun.ID, 1, 5*time.Second))
+	_, err = stub.OpenStream(tun.ID, deadAddr)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "client setup error")
+}
+
+func TestE2E_ServeIncoming_BackendProxy(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	tun := stub.AddTunnel("tcp", "127.0.0.1:0")
+	proxy := testsupport.NewConnectProxy(map[string]string{"echo.internal:7": startTCPEchoBackend(t)}, "user", "pass")
+	defer proxy.Close()
+
+	runtime := e2eRuntime()
+	runtime.BackendProxy = strings.Replace(proxy.URL, "http://", "http://user:pass@", 1)
+	mgr := NewManager(stub.URL, tun.ID, "", 10*time.Millisecond, 50*time.Millisecond, runtime)
+	defer mgr.Close()
+	go func() { _ = serveIncomingWithManager(mgr, nil) }()
+
+	require.NoError(t, stub.WaitSessions(tun.ID, 1, 5*time.Second))
+	st, err := stub.OpenStream(tun.ID, "echo.internal:7")
+	require.NoError(t, err)
+	defer st.Close()
+	echoThroughStream(t, st, "through the proxy")
+	require.Equal(t, []string{"echo.internal:7"}, proxy.Targets(), "the name is resolved by the proxy, not the client")
+}
+
+func runUDPEcho(t *testing.T, stub *testsupport.Server, enc config.EncryptionSettings) {
+	t.Helper()
+	tun := stub.AddTunnel("udp", "")
+	backend := startUDPEchoBackend(t)
+	listen := freeUDPAddr(t)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- StartDataPlaneUDP(context.Background(), stub.URL, tun.ID, backend, listen, e2eRuntime(), enc, "")
+	}()
+	require.NoError(t, stub.WaitSessions(tun.ID, 1, 5*time.Second))
+
+	conn, err := net.Dial("udp", listen)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	buf := make([]byte, 1500)
+	require.Eventually(t, func() bool {
+		if _, err := conn.Write([]byte("dns?")); err != nil {
+			return false
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, err := conn.Read(buf)
+		return err == nil && string(buf[:n]) == "dns?"
+	}, 5*time.Second, 10*time.Millisecond, "datagram should round-trip through the tunnel")
+
+	stub.DropSessions(tun.ID)
+	select {
+	case err := <-errCh:
+		require.Error(t, err, "UDP data-plane ends when the session drops")
+	case <-time.After(5 * time.Second):
+		t.Fatal("StartDataPlaneUDP did not return after the session dropped")
+	}
+}
+
+func TestE2E_UDP_RoundTrip(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	runUDPEcho(t, stub, config.EncryptionSettings{})
+}
+
+func TestE2E_UDP_EncryptedRoundTrip(t *testing.T) {
+	const psk = "0123456789abcdef0123456789abcdef"
+	stub := testsupport.NewServer(testsupport.Options{PSK: psk})
+	defer stub.Close()
+	runUDPEcho(t, stub, config.EncryptionSettings{Enabled: true, PSK: psk})
+}
+
+// TestE2E_UDP_EncryptedRoundTrip_LegacyServer is the psk_kdf downgrade: a
+// server without the feature gets no KDF declaration and derives the legacy
+// key, which the downgraded client uses too.
+func TestE2E_UDP_EncryptedRoundTrip_LegacyServer(t *testing.T) {
+	const passphrase = "correct horse battery staple on tuesdays"
+	stub := testsupport.NewServer(testsupport.Options{PSK: passphrase})
+	defer stub.Close()
+	enc := config.EncryptionSettings{Enabled: true, PSK: passphrase, KDF: sec.LegacyKDF, OmitKDFPreface: true}
+	require.Equal(t, map[string]string{"dst": "x"}, encryptionPreface(map[string]string{"dst": "x"}, enc))
+	runUDPEcho(t, stub, enc)
+}
@@ -0,0 +1,209 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/fortunnels/client/internal/config"
+	sec "github.com/fortunnels/client/internal/security"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+// States of a tunnel's stream encryption (EncryptionStatus.State).
+const (
+	EncryptionOff = "off"
+	// EncryptionActive: the server decrypted the confirmation challenge.
+	EncryptionActive = "active"
+	// EncryptionUnacknowledged: the server did not confirm that it decrypts
+	// the streams; it may not have a PSK for the tunnel at all.
+	EncryptionUnacknowledged = "unacknowledged"
+	// EncryptionMismatch: the server has a PSK for the tunnel but derives a
+	// different key, so encrypted streams fail.
+	EncryptionMismatch = "mismatch"
+)
+
+// encryptionCipher is the AEAD of every encrypted stream (sec.ClientAEAD).
+const encryptionCipher = "XChaCha20-Poly1305"
+
+// encryptionConfirmTimeout bounds the confirmation exchange, including the
+// server's Argon2id key derivation.
+const encryptionConfirmTimeout = 10 * time.Second
+
+// EncryptionStatus is what ConfirmEncryption found out about a tunnel's
+// stream encryption.
+type EncryptionStatus struct {
+	State  string
+	Cipher string
+	KDF    string
+	// KeyID is the server's ID of the key it used; 0 when it does not
+	// version its tunnel keys.
+	KeyID int
+	// Reason says why the encryption is not active.
+	Reason string
+}
+
+// Line is the one-line report printed once the data plane connected; empty
+// when encryption is off.
+func (s EncryptionStatus) Line() string {
+	switch s.State {
+	case EncryptionActive:
+		if s.KeyID > 0 {
+			return fmt.Sprintf("🔒 stream encryption: active (%s, key id %d)", s.Cipher, s.KeyID)
+		}
+		return fmt.Sprintf("🔒 stream encryption: active (%s)", s.Cipher)
+	case EncryptionUnacknowledged:
+		return fmt.Sprintf("⚠️  stream encryption requested but NOT acknowledged by server — payloads may be visible to the server operator (%s)", s.Reason)
+	case EncryptionMismatch:
+		return fmt.Sprintf("⚠️  stream encryption requested but the server derives a different key — encrypted streams will fail (%s)", s.Reason)
+	}
+	return ""
+}
+
+// Badge is the marker of the live status line: a lock when the server
+// confirmed the encryption, a warning when it did not, nothing when off.
+func (s EncryptionStatus) Badge() string {
+	switch s.State {
+	case EncryptionActive:
+		return "🔒"
+	case EncryptionUnacknowledged, EncryptionMismatch:
+		return "⚠️ unconfirmed"
+	}
+	return ""
+}
+
+// Err is the error --strict stops the client with; nil when the encryption
+// is off or active.
+func (s EncryptionStatus) Err() error {
+	switch s.State {
+	case EncryptionUnacknowledged:
+		return fmt.Errorf("stream encryption is not acknowledged by the server: %s", s.Reason)
+	case EncryptionMismatch:
+		return fmt.Errorf("stream encryption key does not match the server's: %s", s.Reason)
+	}
+	return nil
+}
+
+// ConfirmEncryption asks the server, on a stream of mgr's session, whether it
+// decrypts tunnelID's encrypted streams, and records the outcome for
+// EncryptionStatusOf and the session info. supported is whether the server
+// announced protocolv1.FeaturePSKConfirm; a server without it cannot
+// confirm anything, so the encryption stays unacknowledged.
+func ConfirmEncryption(mgr *Manager, tunnelID, instanceID string, enc config.EncryptionSettings, supported bool) EncryptionStatus {
+	status := EncryptionStatus{State: EncryptionOff}
+	switch {
+	case !enc.Enabled:
+	case !supported:
+		status = unconfirmed(enc, "the server does not support encryption confirmation")
+	default:
+		sess, err := mgr.EnsureSession()
+		if err != nil {
+			status = unconfirmed(enc, fmt.Sprintf("no data-plane session: %v", err))
+		} else {
+			status = confirmEncryption(sess, tunnelID, instanceID, enc, encryptionConfirmTimeout)
+		}
+	}
+	processSessions.setEncryptionStatus(tunnelID, status)
+	return status
+}
+
+// EncryptionStatusOf returns the last ConfirmEncryption outcome of tunnelID;
+// the zero value before one.
+func EncryptionStatusOf(tunnelID string) EncryptionStatus {
+	return processSessions.encryptionStatus(tunnelID)
+}
+
+func unconfirmed(enc config.EncryptionSettings, reason string) EncryptionStatus {
+	return EncryptionStatus{State: EncryptionUnacknowledged, Cipher: encryptionCipher, KDF: enc.KDF.String(), Reason: reason}
+}
+
+// confirmEncryption runs the protocolv1.ProtoPSKConfirm exchange on a new
+// stream of sess.
+func confirmEncryption(sess Session, tunnelID, instanceID string, enc config.EncryptionSettings, timeout time.Duration) EncryptionStatus {
+	fields := encryptionPreface(map[string]string{"proto": protocolv1.ProtoPSKConfirm, "tunnel_id": tunnelID}, enc)
+	preface, err := clientPreface(fields, prefaceMeta{instanceID: instanceID})
+	if err != nil {
+		return unconfirmed(enc, err.Error())
+	}
+	st, err := sess.OpenStream()
+	if err != nil {
+		return unconfirmed(enc, fmt.Sprintf("open stream: %v", err))
+	}
+	defer st.Close()
+	_ = st.SetReadDeadline(time.Now().Add(timeout))
+	if _, err := st.Write(preface); err != nil {
+		return unconfirmed(enc, fmt.Sprintf("write preface: %v", err))
+	}
+	rd := bufio.NewReader(st)
+	if err := readSetupAck(rd); err != nil {
+		return unconfirmed(enc, err.Error())
+	}
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return unconfirmed(enc, fmt.Sprintf("challenge: %v", err))
+	}
+	challenge := hex.EncodeToString(raw)
+	wrapped := WrapClientStream(&confirmStream{Reader: rd, Stream: st}, tunnelID, enc)
+	if err := json.NewEncoder(wrapped).Encode(protocolv1.PSKChallenge{Challenge: challenge}); err != nil {
+		return unconfirmed(enc, fmt.Sprintf("write challenge: %v", err))
+	}
+	var answer protocolv1.PSKConfirmation
+	err = json.NewDecoder(wrapped).Decode(&answer)
+	switch {
+	case errors.Is(err, sec.ErrKeyMismatch):
+		status := unconfirmed(enc, err.Error())
+		status.State = EncryptionMismatch
+		return status
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		// The server closes the stream when the challenge does not decrypt.
+		status := unconfirmed(enc, "the server could not decrypt the challenge: "+sec.ErrKeyMismatch.Error())
+		status.State = EncryptionMismatch
+		return status
+	case err != nil:
+		return unconfirmed(enc, fmt.Sprintf("read confirmation: %v", err))
+	case answer.Confirmed != challenge:
+		return unconfirmed(enc, "the server answered without decrypting the challenge")
+	}
+	return EncryptionStatus{State: EncryptionActive, Cipher: encryptionCipher, KDF: enc.KDF.String(), KeyID: answer.KeyID}
+}
+
+// readSetupAck reads the setup line the server answers a client-opened
+// stream with and returns its error, if any.
+func readSetupAck(rd *bufio.Reader) error {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("read setup ack: %w", err)
+	}
+	var ack struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(line)), &ack); err != nil {
+		return fmt.Errorf("invalid setup ack %q", strings.TrimSpace(line))
+	}
+	if !ack.OK {
+		if ack.Error == "" {
+			ack.Error = "refused without a reason"
+		}
+		return fmt.Errorf("server: %s", ack.Error)
+	}
+	return nil
+}
+
+// confirmStream reads a stream through the reader its setup ack was read
+// with, so bytes buffered past the ack are not lost.
+type confirmStream struct {
+	io.Reader
+	Stream
+}
+
+func (c *confirmStream) Read(p []byte) (int, error) { return c.Reader.Read(p) }
@@ -0,0 +1,195 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+	sec "github.com/fortunnels/client/internal/security"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+// pskConfirmPeer is the server side of a psk_confirm stream.
+type pskConfirmPeer struct {
+	// psk is the server's PSK for the tunnel; empty has none.
+	psk string
+	// kdf pins the server's key derivation; zero follows the preface.
+	kdf   sec.KDF
+	keyID int
+	// echo acknowledges, then sends the challenge frame back undecrypted.
+	echo bool
+	// blind answers with a confirmation of its own key without reading the
+	// challenge.
+	blind bool
+}
+
+type readerStream struct {
+	io.Reader
+	io.ReadWriteCloser
+}
+
+func (r *readerStream) Read(p []byte) (int, error) { return r.Reader.Read(p) }
+
+func (p pskConfirmPeer) answer(t *testing.T, st io.ReadWriteCloser) {
+	defer st.Close()
+	rd := bufio.NewReader(st)
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return
+	}
+	var pre map[string]string
+	require.NoError(t, json.Unmarshal([]byte(line), &pre))
+	assert.Equal(t, protocolv1.ProtoPSKConfirm, pre["proto"])
+	if p.psk == "" {
+		writeSetupError(st, errors.New("no PSK is configured for this tunnel"))
+		return
+	}
+	_, _ = st.Write([]byte(setupAckLine))
+	if p.echo {
+		hdr := make([]byte, 4+24)
+		if _, err := io.ReadFull(rd, hdr); err != nil {
+			return
+		}
+		body := make([]byte, binary.BigEndian.Uint32(hdr[:4]))
+		if _, err := io.ReadFull(rd, body); err != nil {
+			return
+		}
+		_, _ = st.Write(append(hdr, body...))
+		return
+	}
+	kdf := p.kdf
+	if kdf.Name == "" {
+		kdf, err = sec.ParseKDF(pre[protocolv1.PrefacePSKKDF])
+		require.NoError(t, err)
+	}
+	wrapped := sec.NewClientPSKWithKDF([]byte(p.psk), kdf).Wrap(&readerStream{Reader: rd, ReadWriteCloser: st}, pre["tunnel_id"])
+	var challenge protocolv1.PSKChallenge
+	if !p.blind {
+		if err := json.NewDecoder(wrapped).Decode(&challenge); err != nil {
+			return
+		}
+	}
+	_ = json.NewEncoder(wrapped).Encode(protocolv1.PSKConfirmation{Confirmed: challenge.Challenge, KeyID: p.keyID})
+	if p.blind {
+		_, _ = io.Copy(io.Discard, rd)
+	}
+}
+
+// confirmWith runs the confirmation of enc against peer on in-memory
+// streams.
+func confirmWith(t *testing.T, peer pskConfirmPeer, enc config.EncryptionSettings) EncryptionStatus {
+	t.Helper()
+	client, server := newMemSessionPair()
+	t.Cleanup(func() { client.Close() })
+	go func() {
+		st, err := server.AcceptStream()
+		if err == nil {
+			peer.answer(t, st)
+		}
+	}()
+	return confirmEncryption(client, "t1", "inst", enc, 5*time.Second)
+}
+
+var legacyEnc = config.EncryptionSettings{Enabled: true, PSK: "correct horse battery staple", KDF: sec.LegacyKDF}
+
+func TestConfirmEncryption_Acknowledged(t *testing.T) {
+	status := confirmWith(t, pskConfirmPeer{psk: legacyEnc.PSK, keyID: 2}, legacyEnc)
+	require.Equal(t, EncryptionActive, status.State, status.Reason)
+	assert.Equal(t, 2, status.KeyID)
+	assert.Equal(t, "🔒 stream encryption: active (XChaCha20-Poly1305, key id 2)", status.Line())
+	assert.Equal(t, "🔒", status.Badge())
+	assert.NoError(t, status.Err())
+
+	status = confirmWith(t, pskConfirmPeer{psk: legacyEnc.PSK}, legacyEnc)
+	require.Equal(t, EncryptionActive, status.State, status.Reason)
+	assert.Equal(t, "🔒 stream encryption: active (XChaCha20-Poly1305)", status.Line(), "no key id from the server")
+}
+
+func TestConfirmEncryption_Unacknowledged(t *testing.T) {
+	tests := []struct {
+		name   string
+		peer   pskConfirmPeer
+		reason string
+	}{
+		{"server without a PSK", pskConfirmPeer{}, "server: no PSK is configured for this tunnel"},
+		{"server echoing the challenge", pskConfirmPeer{psk: legacyEnc.PSK, echo: true}, "answered without decrypting the challenge"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := confirmWith(t, tt.peer, legacyEnc)
+			require.Equal(t, EncryptionUnacknowledged, status.State)
+			assert.Contains(t, status.Reason, tt.reason)
+			assert.True(t, strings.HasPrefix(status.Line(), "⚠️  stream encryption requested but NOT acknowledged by server — payloads may be visible to the server operator"), status.Line())
+			assert.Equal(t, "⚠️ unconfirmed", status.Badge())
+			assert.ErrorContains(t, status.Err(), "not acknowledged by the server")
+		})
+	}
+}
+
+func TestConfirmEncryption_KDFMismatch(t *testing.T) {
+	argon := config.EncryptionSettings{Enabled: true, PSK: legacyEnc.PSK, KDF: sec.Argon2idKDF}
+
+	// A server pinned to the legacy KDF cannot decrypt the challenge and
+	// closes the stream.
+	status := confirmWith(t, pskConfirmPeer{psk: argon.PSK, kdf: sec.LegacyKDF}, argon)
+	require.Equal(t, EncryptionMismatch, status.State, status.Reason)
+	assert.Contains(t, status.Reason, "could not decrypt the challenge")
+	assert.ErrorContains(t, status.Err(), "does not match the server's")
+
+	// One answering in its own key fails to decrypt here.
+	status = confirmWith(t, pskConfirmPeer{psk: argon.PSK, kdf: sec.LegacyKDF, blind: true}, argon)
+	require.Equal(t, EncryptionMismatch, status.State, status.Reason)
+	assert.Contains(t, status.Reason, sec.ErrKeyMismatch.Error())
+	assert.Contains(t, status.Line(), "the server derives a different key")
+}
+
+func TestConfirmEncryption_RecordsStatus(t *testing.T) {
+	mgr, d := newFakeManager(t, config.RuntimeSettings{})
+	RecordEncryption("tunnel-123", legacyEnc)
+	t.Cleanup(func() { processSessions.setEncryptionStatus("tunnel-123", EncryptionStatus{}) })
+	_, err := mgr.EnsureSession()
+	require.NoError(t, err)
+	go func() {
+		if st, err := d.server(0).AcceptStream(); err == nil {
+			pskConfirmPeer{psk: legacyEnc.PSK, keyID: 7}.answer(t, st)
+		}
+	}()
+
+	status := ConfirmEncryption(mgr, "tunnel-123", "inst", legacyEnc, true)
+	require.Equal(t, EncryptionActive, status.State, status.Reason)
+	assert.Equal(t, status, EncryptionStatusOf("tunnel-123"))
+	info, ok := SessionInfoOf("tunnel-123")
+	require.True(t, ok)
+	assert.Contains(t, info.String(), "encryption=on kdf=legacy encryption_status=active")
+
+	status = ConfirmEncryption(mgr, "tunnel-123", "inst", legacyEnc, false)
+	assert.Equal(t, EncryptionUnacknowledged, status.State)
+	assert.Contains(t, status.Reason, "does not support encryption confirmation")
+
+	status = ConfirmEncryption(mgr, "tunnel-123", "inst", config.EncryptionSettings{}, true)
+	assert.Equal(t, EncryptionOff, status.State)
+	assert.Empty(t, status.Line())
+	assert.NoError(t, status.Err())
+}
+
+func TestThroughputSampler_Badge(t *testing.T) {
+	badge := "🔒"
+	start := time.Now()
+	s := NewThroughputSampler(&TrafficCounter{}, start).WithBadge(func() string { return badge })
+	s.Sample(start.Add(time.Second))
+	assert.Equal(t, "🔒 ▁ ↑ 0 B/s ↓ 0 B/s", s.Render())
+	badge = ""
+	assert.Equal(t, "▁ ↑ 0 B/s ↓ 0 B/s", s.Render())
+}
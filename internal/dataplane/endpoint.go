@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// pinnedDialFailures is how many consecutive dials to the pinned IP may fail
+// before the selector drops the pin and resolves the hostname again.
+const pinnedDialFailures = 3
+
+// endpointSelector picks the address data-plane dials connect to. When the
+// server hostname resolves to several load balancers, a tunnel is only
+// known on the one it was created on, so dials are pinned to the IP the
+// control plane used (RuntimeSettings.PinnedIP). The hostname is kept for
+// TLS SNI and the Host header; only the TCP/UDP destination changes.
+type endpointSelector struct {
+	mu sync.Mutex
+	// host is the server hostname; dials to other hosts (proxies) are
+	// untouched.
+	host     string
+	pinnedIP string
+	failures int
+
+	// dialNet is a net.Dialer's DialContext; tests replace it with a fake
+	// resolver and dialer.
+	dialNet func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// newEndpointSelector pins dials to serverURL's host to pinnedIP. Nothing is
+// pinned when pinnedIP is empty or invalid, or when the host already is an
+// IP address.
+func newEndpointSelector(serverURL, pinnedIP string) *endpointSelector {
+	e := &endpointSelector{
+		dialNet: (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+	}
+	if u, err := url.Parse(serverURL); err == nil {
+		e.host = u.Hostname()
+	}
+	if e.host != "" && net.ParseIP(e.host) == nil && net.ParseIP(pinnedIP) != nil {
+		e.pinnedIP = pinnedIP
+	}
+	return e
+}
+
+// pinned returns the IP dials are pinned to, or "".
+func (e *endpointSelector) pinned() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.pinnedIP
+}
+
+// retarget moves e to serverURL's host, unpinned: the control plane's IP
+// says nothing about another node.
+func (e *endpointSelector) retarget(serverURL string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.host, e.pinnedIP, e.failures = "", "", 0
+	if u, err := url.Parse(serverURL); err == nil {
+		e.host = u.Hostname()
+	}
+}
+
+// target returns the server host and the IP its dials are pinned to.
+func (e *endpointSelector) target() (host, ip string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.host, e.pinnedIP
+}
+
+// observe records the outcome of a dial to the pinned IP and drops the pin
+// after pinnedDialFailures failures in a row.
+func (e *endpointSelector) observe(ip string, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if ip == "" || ip != e.pinnedIP {
+		return
+	}
+	if err == nil {
+		e.failures = 0
+		return
+	}
+	e.failures++
+	if e.failures >= pinnedDialFailures {
+		log.Printf("[WARN] data plane: pinned server IP %s failed %d dials in a row; resolving %s again", e.pinnedIP, e.failures, e.host)
+		e.pinnedIP = ""
+		e.failures = 0
+	}
+}
+
+// dialContext is the websocket NetDialContext: addr on the server host goes
+// to the pinned IP; everything else, and all dials once unpinned, resolve
+// as usual.
+func (e *endpointSelector) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		if server, ip := e.target(); host == server && ip != "" {
+			return e.dialNet(ctx, network, net.JoinHostPort(ip, port))
+		}
+	}
+	return e.dialNet(ctx, network, addr)
+}
+
+// wsDialer is websocket.DefaultDialer dialing through e.
+func (e *endpointSelector) wsDialer() *websocket.Dialer {
+	d := *websocket.DefaultDialer
+	d.NetDialContext = e.dialContext
+	return &d
+}
+
+// dialWS dials wsURL through e and records the outcome against the pin. The
+// upgrade response, when there was one, comes with its body closed.
+func (e *endpointSelector) dialWS(wsURL string, headers http.Header) (*websocket.Conn, *http.Response, error) {
+	ip := e.pinned()
+	conn, resp, err := e.wsDialer().Dial(wsURL, headers)
+	if resp != nil && resp.Body != nil {
+		resp.Body.Close()
+	}
+	e.observe(ip, err)
+	return conn, resp, err
+}
+
+// quicAddr is host:port for a QUIC dial to the server, pinned when set.
+func (e *endpointSelector) quicAddr(port string) (addr, ip string) {
+	host, ip := e.target()
+	if ip != "" {
+		return net.JoinHostPort(ip, port), ip
+	}
+	return net.JoinHostPort(host, port), ""
+}
@@ -0,0 +1,146 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/testsupport"
+)
+
+const pinTestServerURL = "http://tunnel.test:8080"
+
+// twoBalancers fakes a hostname with two A records behind independent
+// servers, of which only known has the tunnel. Dials to the hostname
+// alternate between them like DNS round-robin, starting with the wrong one;
+// dials to an IP go to that server.
+type twoBalancers struct {
+	known, other *testsupport.Server
+
+	mu    sync.Mutex
+	rr    int
+	dials []string
+}
+
+func (f *twoBalancers) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	f.dials = append(f.dials, host)
+	var target *testsupport.Server
+	switch host {
+	case "10.0.0.1":
+		target = f.known
+	case "10.0.0.2":
+		target = f.other
+	case "tunnel.test":
+		f.rr++
+		target = f.other
+		if f.rr%2 == 0 {
+			target = f.known
+		}
+	}
+	f.mu.Unlock()
+	if target == nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: syscall.ECONNREFUSED}
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, network, strings.TrimPrefix(target.URL, "http://"))
+}
+
+func (f *twoBalancers) dialed() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.dials...)
+}
+
+func newPinTest(t *testing.T, pinnedIP string) (*twoBalancers, *Manager) {
+	t.Helper()
+	f := &twoBalancers{known: testsupport.NewServer(testsupport.Options{}), other: testsupport.NewServer(testsupport.Options{})}
+	t.Cleanup(f.known.Close)
+	t.Cleanup(f.other.Close)
+	tun := f.known.AddTunnel("tcp", "")
+	rt := e2eRuntime()
+	rt.PinnedIP = pinnedIP
+	m := NewManager(pinTestServerURL, tun.ID, "", 5*time.Millisecond, 20*time.Millisecond, rt)
+	t.Cleanup(m.Close)
+	m.endpoint.dialNet = f.dial
+	return f, m
+}
+
+func TestManager_PinnedDialsReachTheTunnelsServer(t *testing.T) {
+	f, m := newPinTest(t, "10.0.0.1")
+	for range 4 {
+		sess, err := m.EnsureSession()
+		require.NoError(t, err)
+		require.NoError(t, sess.Close())
+	}
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.1", "10.0.0.1", "10.0.0.1"}, f.dialed(),
+		"every redial goes to the pinned IP, never the round-robin hostname")
+}
+
+func TestManager_UnpinnedDialsFollowRoundRobin(t *testing.T) {
+	f, m := newPinTest(t, "")
+	_, err := m.EnsureSession()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tunnel.test", "tunnel.test"}, f.dialed(),
+		"the first dial lands on the balancer that does not know the tunnel")
+}
+
+func TestManager_UnpinsAfterConsecutiveFailures(t *testing.T) {
+	f, m := newPinTest(t, "10.0.0.9")
+	_, err := m.EnsureSession()
+	require.NoError(t, err)
+	dials := f.dialed()
+	require.Greater(t, len(dials), pinnedDialFailures)
+	assert.Equal(t, []string{"10.0.0.9", "10.0.0.9", "10.0.0.9"}, dials[:pinnedDialFailures])
+	for _, host := range dials[pinnedDialFailures:] {
+		assert.Equal(t, "tunnel.test", host, "the hostname is resolved again once the pin is dropped")
+	}
+	assert.Empty(t, m.endpoint.pinned())
+}
+
+func TestEndpointSelector(t *testing.T) {
+	assert.Equal(t, "10.0.0.1", newEndpointSelector(pinTestServerURL, "10.0.0.1").pinned())
+	assert.Empty(t, newEndpointSelector("http://127.0.0.1:8080", "10.0.0.1").pinned(), "an IP server URL needs no pin")
+	assert.Empty(t, newEndpointSelector(pinTestServerURL, "not-an-ip").pinned())
+	assert.Empty(t, newEndpointSelector(pinTestServerURL, "").pinned())
+
+	e := newEndpointSelector("https://tunnel.test", "2001:db8::1")
+	addr, ip := e.quicAddr("4433")
+	assert.Equal(t, "[2001:db8::1]:4433", addr)
+	assert.Equal(t, "2001:db8::1", ip)
+
+	var got []string
+	e.dialNet = func(_ context.Context, _, addr string) (net.Conn, error) {
+		got = append(got, addr)
+		return nil, errors.New("fake")
+	}
+	_, _ = e.dialContext(context.Background(), "tcp", "tunnel.test:443")
+	_, _ = e.dialContext(context.Background(), "tcp", "proxy.local:3128")
+	assert.Equal(t, []string{"[2001:db8::1]:443", "proxy.local:3128"}, got, "only dials to the server host are pinned")
+
+	e.observe("2001:db8::1", errors.New("x"))
+	e.observe("2001:db8::1", nil)
+	e.observe("2001:db8::1", errors.New("x"))
+	e.observe("2001:db8::1", errors.New("x"))
+	assert.NotEmpty(t, e.pinned(), "a success resets the failure count")
+	e.observe("2001:db8::1", errors.New("x"))
+	assert.Empty(t, e.pinned())
+	addr, ip = e.quicAddr("4433")
+	assert.Equal(t, "tunnel.test:4433", addr)
+	assert.Empty(t, ip)
+}
@@ -0,0 +1,251 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+// streamScheduler shares the stream slots of one Manager between its
+// listeners. Each listener starts new streams through its own token bucket
+// (--per-listener-rate), and while the global budget (--max-streams) is used
+// up, freed slots go to the listeners with waiting connections in weighted
+// round-robin order, so a burst on one listener cannot starve the others.
+//
+// The scheduler decides with an explicit clock and no goroutines of its own;
+// acquire is the blocking wrapper used by the listen path.
+type streamScheduler struct {
+	maxStreams int
+	rate       float64
+
+	mu        sync.Mutex
+	open      int
+	listeners []*streamListener
+	cursor    int
+}
+
+// streamListener is one listener's state in a streamScheduler.
+type streamListener struct {
+	name   string
+	weight int
+
+	// credit is how many more grants the listener gets in its current
+	// round-robin turn.
+	credit  int
+	waiting []*streamWaiter
+	bucket  streamBucket
+
+	active    int
+	granted   uint64
+	queued    uint64
+	throttled uint64
+}
+
+// streamWaiter is one connection waiting for a stream slot; ready is closed
+// when the slot is granted.
+type streamWaiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+// streamBucket is a token bucket of new streams; a burst is one second's
+// worth of the rate, at least one stream.
+type streamBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// ListenerStats is the utilization of one listener's stream slots.
+type ListenerStats struct {
+	Name   string
+	Weight int
+	// Active streams are open now; Waiting connections are queued for a slot.
+	Active  int
+	Waiting int
+	// Granted counts streams started, Queued those that had to wait for a
+	// slot, Throttled those delayed by --per-listener-rate.
+	Granted   uint64
+	Queued    uint64
+	Throttled uint64
+}
+
+func newStreamScheduler(maxStreams int, rate float64) *streamScheduler {
+	return &streamScheduler{maxStreams: max(maxStreams, 0), rate: max(rate, 0)}
+}
+
+// register adds a listener with a round-robin weight of at least 1.
+func (s *streamScheduler) register(name string, weight int) *streamListener {
+	weight = max(weight, 1)
+	l := &streamListener{name: name, weight: weight, credit: weight}
+	s.mu.Lock()
+	s.listeners = append(s.listeners, l)
+	s.mu.Unlock()
+	return l
+}
+
+// reserve takes one token from l's bucket at now and returns how long the
+// caller must wait before starting the stream (0 when a token was ready).
+// Tokens are reserved ahead, so concurrent callers queue up behind each other.
+func (s *streamScheduler) reserve(l *streamListener, now time.Time) time.Duration {
+	if s.rate <= 0 {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	burst := math.Max(1, s.rate)
+	b := &l.bucket
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else if now.After(b.last) {
+		b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*s.rate)
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	l.throttled++
+	return time.Duration(-b.tokens / s.rate * float64(time.Second))
+}
+
+// enqueue queues a connection of l for a slot and dispatches; the returned
+// waiter is already granted when a slot was free.
+func (s *streamScheduler) enqueue(l *streamListener) *streamWaiter {
+	w := &streamWaiter{ready: make(chan struct{})}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l.waiting = append(l.waiting, w)
+	s.dispatchLocked()
+	if !w.granted {
+		l.queued++
+	}
+	return w
+}
+
+// cancel drops a waiter that gave up. It reports false when the slot had
+// already been granted; the caller then owns it and must release it.
+func (s *streamScheduler) cancel(l *streamListener, w *streamWaiter) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if w.granted {
+		return false
+	}
+	for i, q := range l.waiting {
+		if q == w {
+			l.waiting = append(l.waiting[:i], l.waiting[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// release frees a slot of l and hands it to the next waiting listener.
+func (s *streamScheduler) release(l *streamListener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.open--
+	l.active--
+	s.dispatchLocked()
+}
+
+// dispatchLocked grants free slots to waiting connections.
+func (s *streamScheduler) dispatchLocked() {
+	for s.maxStreams == 0 || s.open < s.maxStreams {
+		l := s.pickLocked()
+		if l == nil {
+			return
+		}
+		w := l.waiting[0]
+		l.waiting[0] = nil
+		l.waiting = l.waiting[1:]
+		w.granted = true
+		close(w.ready)
+		s.open++
+		l.active++
+		l.granted++
+	}
+}
+
+// pickLocked returns the next listener in weighted round-robin order that
+// has a waiting connection. The listener at the cursor keeps the turn for
+// up to weight grants; a listener without waiters forfeits the rest of its
+// turn, so idle listeners never hold slots back.
+func (s *streamScheduler) pickLocked() *streamListener {
+	n := len(s.listeners)
+	for range n + 1 {
+		l := s.listeners[s.cursor]
+		if l.credit > 0 && len(l.waiting) > 0 {
+			l.credit--
+			return l
+		}
+		l.credit = l.weight
+		s.cursor = (s.cursor + 1) % n
+	}
+	return nil
+}
+
+// acquire blocks until l may open a stream: first for its rate, then for a
+// slot. It returns false when stop is closed first; otherwise the caller
+// must release the slot.
+func (s *streamScheduler) acquire(l *streamListener, stop <-chan struct{}) bool {
+	if wait := s.reserve(l, time.Now()); wait > 0 {
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-stop:
+			t.Stop()
+			return false
+		}
+	}
+	w := s.enqueue(l)
+	select {
+	case <-w.ready:
+		return true
+	case <-stop:
+		if s.cancel(l, w) {
+			return false
+		}
+		return true
+	}
+}
+
+// stats returns the utilization of every listener in registration order.
+func (s *streamScheduler) stats() []ListenerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]ListenerStats, 0, len(s.listeners))
+	for _, l := range s.listeners {
+		out = append(out, ListenerStats{
+			Name:      l.name,
+			Weight:    l.weight,
+			Active:    l.active,
+			Waiting:   len(l.waiting),
+			Granted:   l.granted,
+			Queued:    l.queued,
+			Throttled: l.throttled,
+		})
+	}
+	return out
+}
+
+// WriteStreamSummary prints per-listener stream utilization as part of the
+// shutdown summary; it prints nothing without listeners.
+func WriteStreamSummary(w io.Writer, stats []ListenerStats, maxStreams int) {
+	if len(stats) == 0 {
+		return
+	}
+	budget := "unlimited"
+	if maxStreams > 0 {
+		budget = fmt.Sprintf("max %d", maxStreams)
+	}
+	fmt.Fprintf(w, "\n📊 Listener streams (%s):\n", budget)
+	for _, st := range stats {
+		fmt.Fprintf(w, "   %s (weight %d): started %d, queued %d, throttled %d, active %d, waiting %d\n",
+			st.Name, st.Weight, st.Granted, st.Queued, st.Throttled, st.Active, st.Waiting)
+	}
+}
@@ -0,0 +1,262 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// schedulerRun drives a streamScheduler through synthetic ticks: at every
+// tick each stream opened in the previous tick closes, one at a time, and
+// then arrivals(i, tick) new connections queue on listener i. It returns the
+// listeners in the order they were granted slots.
+func schedulerRun(s *streamScheduler, ls []*streamListener, ticks int, arrivals func(i, tick int) int) []int {
+	var order []int
+	granted := make([]uint64, len(ls))
+	note := func() {
+		for i, l := range ls {
+			for ; granted[i] < l.granted; granted[i]++ {
+				order = append(order, i)
+			}
+		}
+	}
+	for tick := range ticks {
+		open := make([]int, len(ls))
+		for i, l := range ls {
+			open[i] = l.active
+		}
+		for i, l := range ls {
+			for range open[i] {
+				s.release(l)
+				note()
+			}
+		}
+		for i, l := range ls {
+			for range arrivals(i, tick) {
+				s.enqueue(l)
+				note()
+			}
+		}
+	}
+	return order
+}
+
+func TestStreamScheduler_Fairness(t *testing.T) {
+	flood := func(n int) func(int) int { return func(int) int { return n } }
+	cases := []struct {
+		name       string
+		maxStreams int
+		weights    []int
+		arrivals   []func(tick int) int
+		ticks      int
+		// saturated listeners must get their weight share of the grants and
+		// wait at most the other saturated listeners' weights between grants.
+		saturated []bool
+		want      []int // exact grant counts, when set
+	}{
+		{
+			name:       "one flooding listener does not starve a light one",
+			maxStreams: 4,
+			weights:    []int{1, 1},
+			arrivals:   []func(int) int{flood(50), flood(1)},
+			ticks:      100,
+			saturated:  []bool{true, false},
+			// l1's arrival in the last tick is still waiting.
+			want: []int{301, 99},
+		},
+		{
+			name:       "equal weights split a saturated budget evenly",
+			maxStreams: 6,
+			weights:    []int{1, 1, 1},
+			arrivals:   []func(int) int{flood(100), flood(100), flood(100)},
+			ticks:      50,
+			saturated:  []bool{true, true, true},
+		},
+		{
+			name:       "weights set the share under saturation",
+			maxStreams: 8,
+			weights:    []int{3, 1},
+			arrivals:   []func(int) int{flood(100), flood(100)},
+			ticks:      50,
+			saturated:  []bool{true, true},
+		},
+		{
+			name:       "budget not a multiple of the total weight",
+			maxStreams: 5,
+			weights:    []int{1, 2, 1},
+			arrivals:   []func(int) int{flood(40), flood(40), flood(40)},
+			ticks:      60,
+			saturated:  []bool{true, true, true},
+		},
+		{
+			name:       "idle listener does not hold slots back",
+			maxStreams: 4,
+			weights:    []int{1, 5},
+			arrivals:   []func(int) int{flood(10), flood(0)},
+			ticks:      20,
+			saturated:  []bool{true, false},
+			want:       []int{80, 0},
+		},
+		{
+			name:       "bursty listener catches up between bursts",
+			maxStreams: 4,
+			weights:    []int{1, 1},
+			arrivals: []func(int) int{flood(20), func(tick int) int {
+				if tick%10 == 0 {
+					return 12
+				}
+				return 0
+			}},
+			ticks:     40,
+			saturated: []bool{true, false},
+			want:      []int{112, 48},
+		},
+		{
+			name:       "unlimited budget grants every arrival",
+			maxStreams: 0,
+			weights:    []int{1, 1},
+			arrivals:   []func(int) int{flood(7), flood(3)},
+			ticks:      10,
+			saturated:  []bool{false, false},
+			want:       []int{70, 30},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newStreamScheduler(tc.maxStreams, 0)
+			ls := make([]*streamListener, len(tc.weights))
+			for i, w := range tc.weights {
+				ls[i] = s.register(fmt.Sprintf("l%d", i), w)
+			}
+			order := schedulerRun(s, ls, tc.ticks, func(i, tick int) int { return tc.arrivals[i](tick) })
+
+			counts := make([]int, len(ls))
+			for _, i := range order {
+				counts[i]++
+			}
+			if tc.want != nil {
+				assert.Equal(t, tc.want, counts)
+			}
+			if tc.maxStreams > 0 {
+				assert.LessOrEqual(t, s.open, tc.maxStreams)
+			}
+
+			// Under saturation each listener's grants track its weight share
+			// of what the saturated listeners got, once the free slots of the
+			// first tick are taken.
+			saturatedCounts := make([]int, len(ls))
+			for _, i := range order[min(tc.maxStreams, len(order)):] {
+				saturatedCounts[i]++
+			}
+			satWeight, satGrants := 0, 0
+			for i, sat := range tc.saturated {
+				if sat {
+					satWeight += tc.weights[i]
+					satGrants += saturatedCounts[i]
+				}
+			}
+			for i, sat := range tc.saturated {
+				if !sat || satWeight == tc.weights[i] {
+					continue
+				}
+				share := float64(satGrants) * float64(tc.weights[i]) / float64(satWeight)
+				assert.InDelta(t, share, float64(saturatedCounts[i]), float64(satWeight), "listener %d share", i)
+			}
+
+			// Bounded starvation: with every listener saturated, at most the
+			// other listeners' weights are granted between two grants of one.
+			if allTrue(tc.saturated) {
+				last := make([]int, len(ls))
+				for i := range last {
+					last[i] = -1
+				}
+				for pos, i := range order {
+					if last[i] >= 0 {
+						assert.LessOrEqual(t, pos-last[i]-1, satWeight-tc.weights[i], "listener %d waited too long at grant %d", i, pos)
+					}
+					last[i] = pos
+				}
+			}
+		})
+	}
+}
+
+func allTrue(v []bool) bool {
+	for _, b := range v {
+		if !b {
+			return false
+		}
+	}
+	return true
+}
+
+func TestStreamScheduler_ReserveRate(t *testing.T) {
+	s := newStreamScheduler(0, 2)
+	l := s.register("l", 1)
+	t0 := time.Unix(1000, 0)
+
+	assert.Zero(t, s.reserve(l, t0), "burst of one second's worth")
+	assert.Zero(t, s.reserve(l, t0))
+	assert.Equal(t, 500*time.Millisecond, s.reserve(l, t0))
+	assert.Equal(t, time.Second, s.reserve(l, t0), "reservations queue up")
+
+	// Two streams later the bucket is back at zero.
+	assert.Equal(t, 500*time.Millisecond, s.reserve(l, t0.Add(time.Second)))
+	assert.Zero(t, s.reserve(l, t0.Add(10*time.Second)), "refill is capped at the burst")
+	assert.Zero(t, s.reserve(l, t0.Add(10*time.Second)))
+	assert.Positive(t, s.reserve(l, t0.Add(10*time.Second)))
+	assert.Equal(t, uint64(4), s.stats()[0].Throttled)
+
+	slow := newStreamScheduler(0, 0.5)
+	sl := slow.register("slow", 1)
+	assert.Zero(t, slow.reserve(sl, t0), "rates below one still allow one stream")
+	assert.Equal(t, 2*time.Second, slow.reserve(sl, t0))
+
+	unlimited := newStreamScheduler(0, 0)
+	ul := unlimited.register("u", 1)
+	for range 100 {
+		require.Zero(t, unlimited.reserve(ul, t0))
+	}
+}
+
+func TestStreamScheduler_AcquireWaitsAndStops(t *testing.T) {
+	s := newStreamScheduler(1, 0)
+	a := s.register("a", 1)
+	b := s.register("b", 1)
+	stop := make(chan struct{})
+	require.True(t, s.acquire(a, stop))
+
+	got := make(chan bool, 1)
+	go func() { got <- s.acquire(b, stop) }()
+	require.Eventually(t, func() bool { return s.stats()[1].Waiting == 1 }, time.Second, time.Millisecond)
+	s.release(a)
+	require.True(t, <-got, "freed slot goes to the waiting listener")
+
+	go func() { got <- s.acquire(a, stop) }()
+	require.Eventually(t, func() bool { return s.stats()[0].Waiting == 1 }, time.Second, time.Millisecond)
+	close(stop)
+	require.False(t, <-got, "stop abandons the wait")
+
+	st := s.stats()
+	assert.Equal(t, ListenerStats{Name: "a", Weight: 1, Granted: 1, Queued: 1}, st[0])
+	assert.Equal(t, ListenerStats{Name: "b", Weight: 1, Active: 1, Granted: 1, Queued: 1}, st[1])
+	s.release(b)
+	assert.Zero(t, s.open)
+}
+
+func TestWriteStreamSummary(t *testing.T) {
+	var b strings.Builder
+	WriteStreamSummary(&b, nil, 8)
+	assert.Empty(t, b.String(), "nothing without listeners")
+
+	WriteStreamSummary(&b, []ListenerStats{{Name: "127.0.0.1:4000", Weight: 1, Active: 2, Granted: 10, Queued: 3, Throttled: 1}}, 8)
+	assert.Contains(t, b.String(), "Listener streams (max 8)")
+	assert.Contains(t, b.String(), "127.0.0.1:4000 (weight 1): started 10, queued 3, throttled 1, active 2, waiting 0")
+}
@@ -0,0 +1,152 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/fortunnels/client/internal/config"
+)
+
+// maxFallbackPageBytes bounds the --fallback-page file, which is kept in
+// memory for the life of the tunnel.
+const maxFallbackPageBytes = 256 << 10
+
+// fallbackRetryAfter is the Retry-After of the fallback page: a down backend
+// of a pool is skipped for as long.
+const fallbackRetryAfter = backendDownCooldown
+
+// builtinFallbackPage is the page of --fallback-page builtin.
+const builtinFallbackPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.RetryAfter}}">
+<title>Service restarting</title>
+<style>body{font-family:system-ui,sans-serif;max-width:32em;margin:4em auto;padding:0 1em;color:#333}</style>
+</head>
+<body>
+<h1>Service is restarting</h1>
+<p>The service behind this address is not reachable right now. This page retries in {{.RetryAfter}} seconds.</p>
+</body>
+</html>
+`
+
+// fallbackPage is what http tunnels answer instead of a setup error when the
+// backend cannot be dialed (--fallback-page): a 503 with the page, parsed
+// once at startup.
+type fallbackPage struct {
+	tmpl *template.Template
+}
+
+// fallbackPageData are the variables of a --fallback-page template.
+type fallbackPageData struct {
+	// Target is the backend that could not be reached.
+	Target string
+	// RetryAfter is the Retry-After of the response, in seconds.
+	RetryAfter int
+}
+
+// newFallbackPage loads the page of settings.FallbackPage; nil when it is
+// unset or the tunnel is not HTTP.
+func newFallbackPage(settings config.RuntimeSettings) (*fallbackPage, error) {
+	if settings.FallbackPage == "" || !settings.HTTPAware {
+		return nil, nil
+	}
+	text := builtinFallbackPage
+	if settings.FallbackPage != config.FallbackPageBuiltin {
+		b, err := readFallbackPage(settings.FallbackPage)
+		if err != nil {
+			return nil, err
+		}
+		text = string(b)
+	}
+	tmpl, err := template.New("fallback-page").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("--fallback-page: %w", err)
+	}
+	return &fallbackPage{tmpl: tmpl}, nil
+}
+
+func readFallbackPage(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("--fallback-page: %w", err)
+	}
+	defer f.Close()
+	b, err := io.ReadAll(io.LimitReader(f, maxFallbackPageBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("--fallback-page: %w", err)
+	}
+	if len(b) > maxFallbackPageBytes {
+		return nil, fmt.Errorf("--fallback-page %s is larger than %d bytes", path, maxFallbackPageBytes)
+	}
+	return b, nil
+}
+
+// response returns the 503 answering a request for target.
+func (p *fallbackPage) response(target string) []byte {
+	retry := int(fallbackRetryAfter / time.Second)
+	var body bytes.Buffer
+	if err := p.tmpl.Execute(&body, fallbackPageData{Target: target, RetryAfter: retry}); err != nil {
+		// A page that does not render still gets a well-formed response.
+		log.Printf("--fallback-page: %v", err)
+		body.Reset()
+		body.WriteString("service unavailable (503)")
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "HTTP/1.1 503 Service Unavailable\r\n"+
+		"Content-Type: text/html; charset=utf-8\r\n"+
+		"Content-Length: %d\r\n"+
+		"Retry-After: %d\r\n"+
+		"Cache-Control: no-store\r\n"+
+		"Connection: close\r\n"+
+		"\r\n", body.Len(), retry)
+	b.Write(body.Bytes())
+	return b.Bytes()
+}
+
+// failDial answers a stream whose backend could not be dialed: with a 202
+// when --queue-requests takes its request from rd (nil when the request
+// was consumed already), else with the fallback page when there is one,
+// else like failSetup. dst is the stream's destination and target the
+// backend last tried; acked tells whether the stream was acknowledged
+// already.
+func (s incomingStreamServer) failDial(stream io.Writer, rd *bufio.Reader, acked bool, dst, target string, err error, lg connLogger) {
+	if s.queue != nil && rd != nil {
+		// The request only follows the ack.
+		if !acked {
+			if _, wErr := stream.Write([]byte(setupAckLine)); wErr != nil {
+				return
+			}
+			acked = true
+		}
+		if s.queue.offer(rd, dst, lg) {
+			if _, wErr := io.WriteString(stream, queuedResponse); wErr != nil {
+				log.Printf("failDial: %v", wErr)
+			}
+			return
+		}
+	}
+	if s.fallback == nil {
+		failSetup(stream, acked, err)
+		return
+	}
+	if !acked {
+		if _, wErr := stream.Write([]byte(setupAckLine)); wErr != nil {
+			return
+		}
+	}
+	lg.Printf("backend unreachable, answering with the fallback page: %v", err)
+	if _, wErr := stream.Write(s.fallback.response(target)); wErr != nil {
+		log.Printf("failDial: %v", wErr)
+	}
+}
@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+)
+
+// fallbackServer serves streams with the page of --fallback-page.
+func fallbackServer(t *testing.T, page string, settings config.RuntimeSettings) incomingStreamServer {
+	t.Helper()
+	settings.HTTPAware, settings.FallbackPage = true, page
+	fallback, err := newFallbackPage(settings)
+	require.NoError(t, err)
+	return incomingStreamServer{tunnelID: "t1", httpAware: true, fallback: fallback, pool: newBackendPool(settings)}
+}
+
+// getThrough sends a GET to dst on a new stream of server and returns the
+// setup line and the parsed response.
+func getThrough(t *testing.T, server *memSession, dst string) (string, *http.Response, []byte) {
+	t.Helper()
+	st, rd, line := openWithPreface(t, server, dst, nil)
+	t.Cleanup(func() { _ = st.Close() })
+	if line != setupAckLine {
+		return line, nil, nil
+	}
+	// The fallback page does not wait for the request: the stream may be
+	// closed already.
+	_, _ = st.Write([]byte("GET / HTTP/1.1\r\nHost: app.local\r\n\r\n"))
+	resp, err := http.ReadResponse(rd, nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return line, resp, body
+}
+
+func requireFallback(t *testing.T, resp *http.Response, body []byte) {
+	t.Helper()
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "5", resp.Header.Get("Retry-After"))
+	assert.True(t, resp.Close, "Connection: close")
+	assert.Equal(t, int64(len(body)), resp.ContentLength)
+}
+
+func TestFallbackPage_AnswersDialFailure(t *testing.T) {
+	page := filepath.Join(t.TempDir(), "down.html")
+	require.NoError(t, os.WriteFile(page, []byte("<p>{{.Target}} is restarting, retry in {{.RetryAfter}}s</p>"), 0o600))
+	s := fallbackServer(t, page, config.RuntimeSettings{})
+	server, _ := serveSession(t, s)
+	dst := refusedAddr(t)
+
+	line, resp, body := getThrough(t, server, dst)
+	require.Equal(t, setupAckLine, line)
+	requireFallback(t, resp, body)
+	assert.Equal(t, "<p>"+dst+" is restarting, retry in 5s</p>", string(body))
+}
+
+func TestFallbackPage_AnswersWhenEveryPooledBackendIsDown(t *testing.T) {
+	targets := []string{refusedAddr(t), refusedAddr(t)}
+	s := fallbackServer(t, config.FallbackPageBuiltin, config.RuntimeSettings{LocalTargets: targets})
+	server, _ := serveSession(t, s)
+
+	for range 2 {
+		_, resp, body := getThrough(t, server, targets[0])
+		requireFallback(t, resp, body)
+		assert.Contains(t, string(body), "Service is restarting")
+	}
+	assert.Len(t, s.pool.downUntil, 2, "both backends are marked down")
+}
+
+func TestFallbackPage_RecoveredBackendIsServedAtOnce(t *testing.T) {
+	s := fallbackServer(t, config.FallbackPageBuiltin, config.RuntimeSettings{})
+	server, _ := serveSession(t, s)
+	dst := refusedAddr(t)
+
+	_, resp, body := getThrough(t, server, dst)
+	requireFallback(t, resp, body)
+
+	ln, err := net.Listen("tcp", dst)
+	require.NoError(t, err)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "hello")
+	})}
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	_, resp, body = getThrough(t, server, dst)
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "hello", string(body))
+}
+
+func TestFallbackPage_NonHTTPStreamsStillFailSetup(t *testing.T) {
+	fallback, err := newFallbackPage(config.RuntimeSettings{FallbackPage: config.FallbackPageBuiltin})
+	require.NoError(t, err)
+	assert.Nil(t, fallback, "only http tunnels get a page")
+
+	server, _ := serveSession(t, incomingStreamServer{tunnelID: "t1"})
+	line, resp, _ := getThrough(t, server, refusedAddr(t))
+	assert.Nil(t, resp)
+	assert.Contains(t, line, `"ok":false`)
+}
+
+func TestNewFallbackPage_RejectsOversizedFile(t *testing.T) {
+	page := filepath.Join(t.TempDir(), "big.html")
+	require.NoError(t, os.WriteFile(page, make([]byte, maxFallbackPageBytes+1), 0o600))
+	_, err := newFallbackPage(config.RuntimeSettings{HTTPAware: true, FallbackPage: page})
+	require.ErrorContains(t, err, "larger than")
+}
+
+func TestFallbackPage_ResponseParses(t *testing.T) {
+	p, err := newFallbackPage(config.RuntimeSettings{HTTPAware: true, FallbackPage: config.FallbackPageBuiltin})
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(p.response("127.0.0.1:8000"))), nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	requireFallback(t, resp, body)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+}
@@ -0,0 +1,148 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/fortunnels/client/internal/support"
+)
+
+const (
+	// fdWarnShare and fdRefuseShare are the shares of the descriptor limit
+	// at which the monitor warns and at which new connections are refused;
+	// the warning is repeated only after usage fell below fdRearmShare.
+	fdWarnShare   = 0.80
+	fdRefuseShare = 0.95
+	fdRearmShare  = 0.70
+	// fdSampleInterval is how often usage is sampled.
+	fdSampleInterval = 5 * time.Second
+	// fdBaseline stands for the descriptors the counters do not see where
+	// usage cannot be read: stdio, log files, the control-plane client and
+	// the runtime's poller.
+	fdBaseline = 16
+)
+
+// errFDBudgetExhausted is what a connection refused near the descriptor
+// limit fails with.
+var errFDBudgetExhausted = errors.New("fd budget exhausted: the process is near its open file limit (raise ulimit -n)")
+
+// processFDs counts what the serving paths of this process hold open.
+var processFDs fdCounts
+
+// fdCounts is the registry behind the fd monitor's breakdown and its
+// estimate where usage cannot be read.
+type fdCounts struct {
+	// streams are open data-plane streams; they share their session's
+	// socket but each usually pairs with a local connection.
+	streams atomic.Int64
+	// localConns are accepted --listen connections and backend dials.
+	localConns atomic.Int64
+	// sockets are local listeners and data-plane session connections.
+	sockets atomic.Int64
+	// exhausted is set by the monitor at fdRefuseShare of the limit.
+	exhausted atomic.Bool
+}
+
+// track counts one descriptor-holding thing in n and returns its release.
+func track(n *atomic.Int64) (release func()) {
+	n.Add(1)
+	return func() { n.Add(-1) }
+}
+
+// admit returns errFDBudgetExhausted while new connections are refused.
+func (c *fdCounts) admit() error {
+	if c.exhausted.Load() {
+		return errFDBudgetExhausted
+	}
+	return nil
+}
+
+// estimate is the counter-based descriptor usage.
+func (c *fdCounts) estimate() int {
+	return fdBaseline + int(c.localConns.Load()+c.sockets.Load())
+}
+
+func (c *fdCounts) breakdown() string {
+	return fmt.Sprintf("streams=%d local_conns=%d sockets=%d", c.streams.Load(), c.localConns.Load(), c.sockets.Load())
+}
+
+// fdMonitor compares descriptor usage against the limit. check decides from
+// one sample; run calls it every fdSampleInterval.
+type fdMonitor struct {
+	limit int
+	// sample returns the descriptors in use; false falls back to the
+	// estimate of counts. Tests replace it.
+	sample func() (int, bool)
+	counts *fdCounts
+	logf   func(format string, args ...any)
+	warned bool
+}
+
+// check samples usage once, logs crossings of the thresholds and sets
+// counts.exhausted. It returns the usage it saw.
+func (m *fdMonitor) check() int {
+	used, ok := m.sample()
+	how := "open"
+	if !ok {
+		used, how = m.counts.estimate(), "estimated"
+	}
+	share := float64(used) / float64(m.limit)
+	switch {
+	case share >= fdWarnShare && !m.warned:
+		m.warned = true
+		m.logf("[WARN] %d of %d file descriptors %s (%.0f%%): %s", used, m.limit, how, share*100, m.counts.breakdown())
+	case share < fdRearmShare:
+		m.warned = false
+	}
+	exhausted := share >= fdRefuseShare
+	if m.counts.exhausted.Swap(exhausted) != exhausted {
+		if exhausted {
+			m.logf("[ERROR] %d of %d file descriptors %s: refusing new connections until some close (%s)", used, m.limit, how, m.counts.breakdown())
+		} else {
+			m.logf("[INFO] file descriptors back to %d of %d: accepting new connections again", used, m.limit)
+		}
+	}
+	return used
+}
+
+func (m *fdMonitor) run(stop <-chan struct{}) {
+	t := time.NewTicker(fdSampleInterval)
+	defer t.Stop()
+	for {
+		m.check()
+		select {
+		case <-t.C:
+		case <-stop:
+			m.counts.exhausted.Store(false)
+			return
+		}
+	}
+}
+
+// StartFDMonitor watches the process's descriptor usage while it serves and
+// returns the function that stops it. With raise set the soft RLIMIT_NOFILE
+// is first raised to the hard limit (--raise-nofile). Without a limit to
+// read (Windows) nothing is monitored.
+func StartFDMonitor(raise bool) (stop func()) {
+	soft, hard, err := support.NoFileLimit()
+	if err != nil || soft == 0 {
+		return func() {}
+	}
+	if raise && soft < hard {
+		if raised, err := support.RaiseNoFileLimit(); err != nil {
+			log.Printf("[WARN] could not raise the open file limit from %d to %d: %v", soft, hard, err)
+		} else {
+			soft = raised
+		}
+	}
+	done := make(chan struct{})
+	m := &fdMonitor{limit: int(min(soft, 1<<30)), sample: support.OpenFDs, counts: &processFDs, logf: log.Printf}
+	support.Go(support.PanicScope{Role: "fd monitor"}, func() { m.run(done) })
+	return func() { close(done) }
+}
@@ -0,0 +1,128 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/testsupport"
+)
+
+func TestFDMonitor_Thresholds(t *testing.T) {
+	var counts fdCounts
+	var logs []string
+	used := 0
+	m := &fdMonitor{
+		limit:  100,
+		sample: func() (int, bool) { return used, true },
+		counts: &counts,
+		logf:   func(format string, args ...any) { logs = append(logs, fmt.Sprintf(format, args...)) },
+	}
+	counts.streams.Store(3)
+	counts.localConns.Store(3)
+	counts.sockets.Store(2)
+
+	steps := []struct {
+		used      int
+		exhausted bool
+		log       string
+	}{
+		{50, false, ""},
+		{80, false, "[WARN] 80 of 100 file descriptors open (80%): streams=3 local_conns=3 sockets=2"},
+		{85, false, ""},
+		{96, true, "[ERROR] 96 of 100 file descriptors open: refusing new connections until some close (streams=3 local_conns=3 sockets=2)"},
+		{97, true, ""},
+		{90, false, "[INFO] file descriptors back to 90 of 100: accepting new connections again"},
+		{75, false, ""},
+		{82, false, ""},
+		{60, false, ""},
+		{81, false, "[WARN] 81 of 100 file descriptors open (81%): streams=3 local_conns=3 sockets=2"},
+	}
+	for _, s := range steps {
+		logs = nil
+		used = s.used
+		assert.Equal(t, s.used, m.check())
+		assert.Equal(t, s.exhausted, counts.exhausted.Load(), "at %d", s.used)
+		if s.exhausted {
+			assert.ErrorIs(t, counts.admit(), errFDBudgetExhausted)
+		} else {
+			assert.NoError(t, counts.admit())
+		}
+		if s.log == "" {
+			assert.Empty(t, logs, "at %d", s.used)
+		} else {
+			assert.Equal(t, []string{s.log}, logs, "at %d", s.used)
+		}
+	}
+}
+
+func TestFDMonitor_EstimatesWithoutSample(t *testing.T) {
+	var counts fdCounts
+	var logs []string
+	m := &fdMonitor{
+		limit:  fdBaseline + 10,
+		sample: func() (int, bool) { return 0, false },
+		counts: &counts,
+		logf:   func(format string, args ...any) { logs = append(logs, fmt.Sprintf(format, args...)) },
+	}
+	assert.Equal(t, fdBaseline, m.check())
+	release := track(&counts.localConns)
+	for range 9 {
+		track(&counts.sockets)
+	}
+	assert.Equal(t, fdBaseline+10, m.check())
+	assert.True(t, counts.exhausted.Load())
+	require.Len(t, logs, 2)
+	assert.Contains(t, logs[0], "estimated")
+	release()
+	assert.EqualValues(t, 0, counts.localConns.Load())
+}
+
+// TestServeListener_RefusesAcceptsWhenFDsExhausted closes connections as
+// they are accepted while the fd budget is exhausted, without opening a
+// stream, and forwards again once it recovers.
+func TestServeListener_RefusesAcceptsWhenFDsExhausted(t *testing.T) {
+	captureLog(t)
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	tun := stub.AddTunnel("tcp", "127.0.0.1:0")
+	rt := e2eRuntime()
+	mgr := NewManager(stub.URL, tun.ID, "", 10*time.Millisecond, 50*time.Millisecond, rt)
+	defer mgr.Close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		_ = serveListener(ln, mgr, newListenForwarder(tun.ID, testsupport.EchoDst, rt, config.EncryptionSettings{}))
+	}()
+
+	processFDs.exhausted.Store(true)
+	t.Cleanup(func() { processFDs.exhausted.Store(false) })
+	c, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	require.NoError(t, c.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = c.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF, "closed at once")
+	c.Close()
+	assert.Empty(t, stub.ClientPrefaces(tun.ID))
+
+	processFDs.exhausted.Store(false)
+	c, err = net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer c.Close()
+	_, err = c.Write([]byte("ping"))
+	require.NoError(t, err)
+	got := make([]byte, 4)
+	_, err = io.ReadFull(c, got)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(got))
+}
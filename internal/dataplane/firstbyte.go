@@ -0,0 +1,114 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// slowBackendResponse is what http tunnels answer when the backend missed
+// --backend-first-byte-timeout with --backend-timeout-action 503.
+const slowBackendResponse = "HTTP/1.1 503 Service Unavailable\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Length: 37\r\n" +
+	"Connection: close\r\n" +
+	"\r\n" +
+	"backend did not respond in time (503)"
+
+// firstByteConn wraps a dialed backend and records when its first byte
+// arrives. With a timeout it reports backends that stay silent, and can cut
+// the stream short (--backend-first-byte-timeout, --backend-timeout-action).
+type firstByteConn struct {
+	net.Conn
+	dialed time.Time
+
+	mu sync.Mutex
+	// first is the latency of the first backend byte; 0 until it arrived.
+	first time.Duration
+	// expired is set once the timeout acted on the stream; later backend
+	// bytes are dropped so nothing follows the 503 or the close.
+	expired bool
+	timer   *time.Timer
+}
+
+func newFirstByteConn(c net.Conn, dialed time.Time) *firstByteConn {
+	return &firstByteConn{Conn: c, dialed: dialed}
+}
+
+func (c *firstByteConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n == 0 {
+		return n, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.expired {
+		return 0, io.EOF
+	}
+	if c.first == 0 {
+		c.first = max(time.Since(c.dialed), time.Nanosecond)
+		if c.timer != nil {
+			c.timer.Stop()
+		}
+	}
+	return n, err
+}
+
+// CloseWrite keeps half-close working through the wrapper.
+func (c *firstByteConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// firstByte returns the first-byte latency, or 0 when nothing arrived.
+func (c *firstByteConn) firstByte() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.first
+}
+
+// watch logs a slow-backend event when no byte arrived within timeout of the
+// dial, then closes the stream or answers it with a 503, as configured. The
+// returned func stops the watch.
+func (c *firstByteConn) watch(timeout time.Duration, stream io.ReadWriteCloser, dst string, closeStream, send503 bool, lg connLogger) (stop func()) {
+	if timeout <= 0 {
+		return func() {}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timer = time.AfterFunc(time.Until(c.dialed.Add(timeout)), func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.first != 0 || c.expired {
+			return
+		}
+		elapsed := time.Since(c.dialed).Round(time.Millisecond)
+		switch {
+		case send503:
+			lg.Printf("slow backend %s: no response after %s, answering 503", dst, elapsed)
+			c.expired = true
+			// Holding mu keeps backend bytes from racing the response.
+			_, _ = io.WriteString(stream, slowBackendResponse)
+			closeWriteOrClose(stream)
+			_ = c.Conn.Close()
+		case closeStream:
+			lg.Printf("slow backend %s: no response after %s, closing the stream", dst, elapsed)
+			c.expired = true
+			_ = stream.Close()
+			_ = c.Conn.Close()
+		default:
+			lg.Printf("slow backend %s: no response after %s", dst, elapsed)
+		}
+	})
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.timer.Stop()
+	}
+}
@@ -0,0 +1,101 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startSlowBackend answers every request with a small HTTP response after delay.
+func startSlowBackend(t *testing.T, delay time.Duration) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				buf := make([]byte, 1024)
+				if _, err := c.Read(buf); err != nil {
+					return
+				}
+				time.Sleep(delay)
+				_, _ = io.WriteString(c, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// serveSlowBackendStream sends one request through s to the backend and
+// returns what came back and the stream's log lines.
+func serveSlowBackendStream(t *testing.T, s incomingStreamServer, backend string) (resp, logs string) {
+	t.Helper()
+	buf := captureLog(t)
+	remote, local := tcpPair(t)
+	served := make(chan error, 1)
+	go func() { served <- s.serve(local, connLogger{id: "fbtest"}) }()
+
+	_, err := io.WriteString(remote, `{"dst":"`+backend+`","proto":"tcp"}`+"\n"+"GET / HTTP/1.1\r\nHost: x\r\n\r\n")
+	require.NoError(t, err)
+	_ = remote.SetReadDeadline(time.Now().Add(5 * time.Second))
+	rd := bufio.NewReader(remote)
+	ack, err := rd.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, setupAckLine, ack)
+	body, _ := io.ReadAll(rd)
+	remote.Close()
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream was not served to the end")
+	}
+	return string(body), buf.String()
+}
+
+func TestFirstByteTimeout_LogsSlowBackendAndLatency(t *testing.T) {
+	backend := startSlowBackend(t, 200*time.Millisecond)
+	resp, logs := serveSlowBackendStream(t, incomingStreamServer{firstByteTimeout: 50 * time.Millisecond}, backend)
+	assert.Contains(t, resp, "\r\n\r\nok", "log-only keeps the stream")
+	assert.Regexp(t, `\[fbtest\] slow backend 127\.0\.0\.1:\d+: no response after \d+ms\n`, logs)
+	assert.Regexp(t, `closed in=\d+ out=\d+ duration=\d+ms first_byte=(1\d\d|2\d\d|3\d\d)ms`, logs)
+}
+
+func TestFirstByteTimeout_FastBackendIsNotReported(t *testing.T) {
+	backend := startSlowBackend(t, 0)
+	resp, logs := serveSlowBackendStream(t, incomingStreamServer{firstByteTimeout: time.Second, timeoutClose: true}, backend)
+	assert.Contains(t, resp, "ok")
+	assert.NotContains(t, logs, "slow backend")
+	assert.Regexp(t, `first_byte=[0-9.]+m?s\n`, logs)
+}
+
+func TestFirstByteTimeout_Close(t *testing.T) {
+	backend := startSlowBackend(t, time.Second)
+	begin := time.Now()
+	resp, logs := serveSlowBackendStream(t, incomingStreamServer{firstByteTimeout: 50 * time.Millisecond, timeoutClose: true}, backend)
+	assert.Empty(t, resp)
+	assert.Less(t, time.Since(begin), 900*time.Millisecond, "the stream is dropped at the timeout")
+	assert.Contains(t, logs, "no response after")
+	assert.Contains(t, logs, "closing the stream")
+	assert.NotContains(t, logs, "first_byte=")
+}
+
+func TestFirstByteTimeout_503(t *testing.T) {
+	backend := startSlowBackend(t, 300*time.Millisecond)
+	resp, logs := serveSlowBackendStream(t, incomingStreamServer{httpAware: true, firstByteTimeout: 50 * time.Millisecond, timeout503: true}, backend)
+	assert.Equal(t, slowBackendResponse, resp, "late backend bytes never follow the 503")
+	assert.Contains(t, logs, "answering 503")
+}
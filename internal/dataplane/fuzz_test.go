@@ -0,0 +1,168 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"maps"
+	"testing"
+
+	"github.com/fortunnels/client/internal/testsupport/allocs"
+)
+
+// The fuzz targets below run their seeds and testdata/fuzz corpus as regular
+// tests; `make fuzz` explores further.
+
+// firstPrefaceLine is the oracle of FuzzReadStreamDestination: the first
+// non-blank line of data, if it ends in a newline within maxPrefaceSize.
+func firstPrefaceLine(data []byte) ([]byte, bool) {
+	rest := data
+	for len(data)-len(rest) < maxPrefaceSize {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 || len(data)-len(rest)+i+1 > maxPrefaceSize {
+			return nil, false
+		}
+		if line := bytes.TrimSpace(rest[:i]); len(line) > 0 {
+			return line, true
+		}
+		rest = rest[i+1:]
+	}
+	return nil, false
+}
+
+func FuzzReadStreamDestination(f *testing.F) {
+	for _, seed := range []string{
+		`{"dst": "127.0.0.1:8080", "proto": "tcp"}` + "\n",
+		`{"dst": "127.0.0.1:8080", "proto": "tcp"}`,
+		`{"dst": invalid}` + "\n",
+		`{"proto": "tcp"}` + "\n",
+		"\t{\"dst\": \"127.0.0.1:8080\", \"proto\": \"tcp\"}\t\n",
+		"\n{\"dst\": \"127.0.0.1:8080\", \"proto\": \"tcp\"}\n\n",
+		"null\n",
+		"",
+	} {
+		f.Add([]byte(seed))
+	}
+	// A peer that never sends a newline.
+	f.Add(bytes.Repeat([]byte("x"), 64<<10))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var pre map[string]string
+		var err error
+		parse := func() {
+			pre, err = readStreamPreface(bufio.NewReader(bytes.NewReader(data)))
+		}
+		// The reader's buffer, the line and what JSON decoding makes of it.
+		allocs.Check(t, 4096+16*maxPrefaceSize, parse)
+
+		line, complete := firstPrefaceLine(data)
+		if err != nil {
+			if complete && json.Unmarshal(line, &map[string]string{}) == nil && !bytes.Equal(line, []byte("null")) {
+				t.Fatalf("rejected a valid preface %q: %v", line, err)
+			}
+			return
+		}
+		if !complete {
+			t.Fatalf("accepted %q without a complete preface line", data)
+		}
+		if pre == nil {
+			t.Fatal("nil preface without an error")
+		}
+		var want map[string]string
+		if jerr := json.Unmarshal(line, &want); jerr != nil {
+			t.Fatalf("accepted invalid JSON %q", line)
+		}
+		got, _ := json.Marshal(pre)
+		exp, _ := json.Marshal(want)
+		if !bytes.Equal(got, exp) {
+			t.Fatalf("preface %s, want %s", got, exp)
+		}
+	})
+}
+
+// FuzzEncodePreface checks that every preface encodePreface accepts is read
+// back by readStreamPreface as the same fields, leaving the stream data after
+// it untouched.
+func FuzzEncodePreface(f *testing.F) {
+	for _, seed := range [][3]string{
+		{"127.0.0.1:8080", "auth", "token"},
+		{"[::1]:22", "note", "ünïcode"},
+		{"db:5432\n{}", "auth", "x"},
+		{"db:5432", "k\x00", "v"},
+		{"db:5432", "auth", "\u2028"},
+		{"", "proto", "control"},
+	} {
+		f.Add(seed[0], seed[1], seed[2], []byte("GET / HTTP/1.1\r\n"))
+	}
+
+	f.Fuzz(func(t *testing.T, dst, name, value string, rest []byte) {
+		fields := map[string]string{"dst": dst, "proto": "tcp", name: value}
+		b, err := encodePreface(fields)
+		if err != nil {
+			return
+		}
+		if len(b) > maxPrefaceSize || bytes.IndexByte(b, '\n') != len(b)-1 {
+			t.Fatalf("preface %q is not one line within %d bytes", b, maxPrefaceSize)
+		}
+		rd := bufio.NewReader(bytes.NewReader(append(b, rest...)))
+		got, err := readStreamPreface(rd)
+		if err != nil {
+			t.Fatalf("preface %q not read back: %v", b, err)
+		}
+		if !maps.Equal(got, fields) {
+			t.Fatalf("read back %q, want %q", got, fields)
+		}
+		after, _ := io.ReadAll(rd)
+		if !bytes.Equal(after, rest) {
+			t.Fatalf("stream data %q after the preface, want %q", after, rest)
+		}
+	})
+}
+
+func FuzzReadUDPPacket(f *testing.F) {
+	for _, seed := range [][]byte{
+		{0, 5, 'h', 'e', 'l', 'l', 'o'},
+		{0, 1, 0x42},
+		{0, 5, 1, 2},
+		{0, 0},
+		{0},
+		{},
+		append([]byte{0xFF, 0xFF}, make([]byte, 65535)...),
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var packet []byte
+		var err error
+		allocs.Check(t, udpMaxPacketSize+1024, func() {
+			packet, err = readUDPPacket(bytes.NewReader(data))
+		})
+
+		if len(data) < 2 {
+			if err == nil {
+				t.Fatal("packet read without a length")
+			}
+			return
+		}
+		n := int(binary.BigEndian.Uint16(data))
+		valid := n > 0 && len(data) >= 2+n
+		if err != nil {
+			if valid {
+				t.Fatalf("rejected a valid %d byte packet: %v", n, err)
+			}
+			return
+		}
+		if !valid {
+			t.Fatalf("accepted a packet declaring %d bytes from %d", n, len(data)-2)
+		}
+		if !bytes.Equal(packet, data[2:2+n]) {
+			t.Fatalf("packet %x, want %x", packet, data[2:2+n])
+		}
+	})
+}
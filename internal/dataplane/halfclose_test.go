@@ -0,0 +1,241 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/xtaci/smux"
+	"go.uber.org/goleak"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/testsupport"
+)
+
+// finResponseSize is large enough that a response cut short by an early
+// close would be noticed.
+const finResponseSize = 256 * 1024
+
+// startFINBackend serves a protocol that treats the client's FIN as "request
+// complete" (like HTTP/1.0 or git-daemon): it reads to EOF, then answers
+// with the request followed by a large body and closes.
+func startFINBackend(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				req, err := io.ReadAll(c)
+				if err != nil {
+					return
+				}
+				_, _ = c.Write(finResponse(req))
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func finResponse(req []byte) []byte {
+	return append(append([]byte("got:"), req...), bytes.Repeat([]byte{'r'}, finResponseSize)...)
+}
+
+// halfCloseExchange writes req, half-closes and reads until the peer closes.
+func halfCloseExchange(t *testing.T, c io.ReadWriter, req string) []byte {
+	t.Helper()
+	_, err := c.Write([]byte(req))
+	require.NoError(t, err)
+	cw, ok := c.(interface{ CloseWrite() error })
+	require.True(t, ok, "test connection must support half-close")
+	require.NoError(t, cw.CloseWrite())
+	if dc, ok := c.(interface{ SetReadDeadline(time.Time) error }); ok {
+		_ = dc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	}
+	got, err := io.ReadAll(c)
+	require.NoError(t, err)
+	return got
+}
+
+func runListenHalfClose(t *testing.T, opts testsupport.Options, enc config.EncryptionSettings) {
+	t.Helper()
+	backend := startFINBackend(t)
+	stub := testsupport.NewServer(opts)
+	defer stub.Close()
+	tun := stub.AddTunnel("tcp", "127.0.0.1:0")
+
+	rt := e2eRuntime()
+	mgr := NewManager(stub.URL, tun.ID, "", 10*time.Millisecond, 50*time.Millisecond, rt)
+	defer mgr.Close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() { _ = serveListener(ln, mgr, newListenForwarder(tun.ID, backend, rt, enc)) }()
+
+	c, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer c.Close()
+	got := halfCloseExchange(t, c, "want refs")
+	require.Equal(t, len(finResponse([]byte("want refs"))), len(got), "response must not be truncated")
+	require.Equal(t, finResponse([]byte("want refs")), got)
+}
+
+func TestListen_HalfCloseGetsFullResponse(t *testing.T) {
+	runListenHalfClose(t, testsupport.Options{}, config.EncryptionSettings{})
+}
+
+func TestListen_HalfCloseGetsFullResponseEncrypted(t *testing.T) {
+	const psk = "0123456789abcdef0123456789abcdef"
+	runListenHalfClose(t, testsupport.Options{PSK: psk}, config.EncryptionSettings{Enabled: true, PSK: psk})
+}
+
+func TestServeIncoming_HalfCloseGetsFullResponse(t *testing.T) {
+	backend := startFINBackend(t)
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	tun := stub.AddTunnel("tcp", backend)
+
+	mgr := NewManager(stub.URL, tun.ID, "", 10*time.Millisecond, 50*time.Millisecond, e2eRuntime())
+	defer mgr.Close()
+	go func() { _ = serveIncomingWithManager(mgr, nil) }()
+	require.NoError(t, stub.WaitSessions(tun.ID, 1, 5*time.Second))
+
+	st, err := stub.OpenStream(tun.ID, backend)
+	require.NoError(t, err)
+	defer st.Close()
+	got := halfCloseExchange(t, st, "GET / HTTP/1.0\r\n\r\n")
+	require.Equal(t, finResponse([]byte("GET / HTTP/1.0\r\n\r\n")), got)
+}
+
+// startFloodBackend accepts one connection and writes to it until the write
+// fails; backendGone is closed then.
+func startFloodBackend(t *testing.T) (addr string, backendGone <-chan struct{}) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	gone := make(chan struct{})
+	go func() {
+		defer ln.Close()
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		defer close(gone)
+		chunk := bytes.Repeat([]byte{'r'}, 32*1024)
+		for {
+			if _, err := c.Write(chunk); err != nil {
+				return
+			}
+		}
+	}()
+	return ln.Addr().String(), gone
+}
+
+// TestBridge_PeerClosedWithoutReadingReleasesBackend: the server sends a
+// request, never reads the response and closes its stream. The response copy
+// then blocks on a stream window that never opens (smux v2 flow control);
+// the bridge must still close the backend and return with both copy
+// goroutines done.
+func TestBridge_PeerClosedWithoutReadingReleasesBackend(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	gauge := processServe.goroutines.Load()
+
+	addr, backendGone := startFloodBackend(t)
+	cfg := smux.DefaultConfig()
+	cfg.Version = 2
+	a, b := net.Pipe()
+	srv, err := smux.Server(b, cfg)
+	require.NoError(t, err)
+	defer srv.Close()
+	cli, err := smux.Client(a, cfg)
+	require.NoError(t, err)
+	defer cli.Close()
+
+	peer, err := srv.OpenStream()
+	require.NoError(t, err)
+	local, err := cli.AcceptStream()
+	require.NoError(t, err)
+	backend, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+
+	type result struct {
+		out int64
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		_, out, err := bridgeStreamAndBackendStall(local, local, backend, 200*time.Millisecond, nil)
+		done <- result{out, err}
+	}()
+
+	_, err = peer.Write([]byte("GET / HTTP/1.0\r\n\r\n"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return processStalls.pending.Load() > 0 }, 5*time.Second, 10*time.Millisecond, "the response write should block on the full window")
+	require.NoError(t, peer.Close())
+
+	select {
+	case r := <-done:
+		require.ErrorIs(t, r.err, errPeerStoppedReading)
+		require.Positive(t, r.out)
+	case <-time.After(5 * time.Second):
+		t.Fatal("bridge did not return after the peer closed")
+	}
+	select {
+	case <-backendGone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("backend connection was not closed")
+	}
+	require.Equal(t, gauge, processServe.goroutines.Load(), "both copy goroutines exited")
+}
+
+// TestSmux_MutualHalfCloseKeepsBufferedData guards the PATCH(fortunnels)
+// hunk of third_party/smux (see PATCHES.md): a response that is still
+// buffered when the peer's FIN completes a mutual half-close must reach the
+// reader. Upstream smux discards it.
+func TestSmux_MutualHalfCloseKeepsBufferedData(t *testing.T) {
+	cfg := smux.DefaultConfig()
+	cfg.Version = 2
+	a, b := net.Pipe()
+	srv, err := smux.Server(b, cfg)
+	require.NoError(t, err)
+	defer srv.Close()
+	cli, err := smux.Client(a, cfg)
+	require.NoError(t, err)
+	defer cli.Close()
+
+	local, err := cli.OpenStream()
+	require.NoError(t, err)
+	_, err = local.Write([]byte("request"))
+	require.NoError(t, err)
+	require.NoError(t, local.CloseWrite())
+
+	peer, err := srv.AcceptStream()
+	require.NoError(t, err)
+	req, err := io.ReadAll(peer)
+	require.NoError(t, err)
+	require.Equal(t, "request", string(req))
+	resp := bytes.Repeat([]byte("r"), 32*1024)
+	_, err = peer.Write(resp)
+	require.NoError(t, err)
+	require.NoError(t, peer.CloseWrite())
+
+	// Nothing reads local until its session has taken the response and the
+	// FIN after it, so the response sits in the stream's buffer.
+	time.Sleep(100 * time.Millisecond)
+	got, err := io.ReadAll(local)
+	require.NoError(t, err)
+	require.Len(t, got, len(resp), "the buffered response was discarded")
+}
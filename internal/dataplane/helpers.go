@@ -5,10 +5,18 @@ package dataplane
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"net/url"
+	"sort"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
+
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
 )
 
 const (
@@ -18,16 +26,115 @@ const (
 	udpDatagramMaxSize  = 65507
 	schemeHTTP          = "http"
 	schemeHTTPS         = "https"
+	// maxPrefaceSize bounds an encoded stream preface, newline included;
+	// servers read it as one line before anything else of the stream.
+	maxPrefaceSize = 4 << 10
+	// maxPrefaceValue bounds one field of a preface, name or value.
+	maxPrefaceValue = 1 << 10
 )
 
+// encodePreface encodes fields as a preface line. It refuses fields that
+// validatePrefaceField rejects and a line longer than maxPrefaceSize, so a
+// stream never starts with a preface the server cannot read.
 func encodePreface(fields map[string]string) ([]byte, error) {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := validatePrefaceField(name, fields[name]); err != nil {
+			return nil, err
+		}
+	}
 	b, err := json.Marshal(fields)
 	if err != nil {
 		return nil, fmt.Errorf("marshal preface: %w", err)
 	}
+	if len(b)+1 > maxPrefaceSize {
+		return nil, fmt.Errorf("preface of %d bytes exceeds the %d byte limit", len(b)+1, maxPrefaceSize)
+	}
 	return append(b, '\n'), nil
 }
 
+// validatePrefaceField checks one preface field: valid UTF-8 without control
+// characters, at most maxPrefaceValue bytes, and a dst that is host:port.
+// JSON escapes a newline, but the server would still dial or log something
+// other than what the user asked for.
+func validatePrefaceField(name, value string) error {
+	if name == "" {
+		return errors.New("preface field with an empty name")
+	}
+	for _, part := range []struct{ label, s string }{{"name", name}, {"value", value}} {
+		if len(part.s) > maxPrefaceValue {
+			return fmt.Errorf("preface field %q: %s of %d bytes exceeds the %d byte limit", truncateField(name), part.label, len(part.s), maxPrefaceValue)
+		}
+		if !utf8.ValidString(part.s) {
+			return fmt.Errorf("preface field %q: %s is not valid UTF-8", truncateField(name), part.label)
+		}
+		for _, r := range part.s {
+			if unicode.IsControl(r) {
+				return fmt.Errorf("preface field %q: %s contains control character %U", truncateField(name), part.label, r)
+			}
+		}
+	}
+	if name == "dst" && value != "" {
+		if _, port, err := net.SplitHostPort(value); err != nil || port == "" {
+			return fmt.Errorf("preface field \"dst\": %q is not host:port", value)
+		}
+	}
+	return nil
+}
+
+// truncateField shortens a field name for an error message.
+func truncateField(name string) string {
+	const limit = 64
+	if len(name) <= limit {
+		return name
+	}
+	return name[:limit] + "..."
+}
+
+// prefaceMeta is what a client-opened stream preface says about the client
+// side of the stream, whichever transport writes it.
+type prefaceMeta struct {
+	// instanceID tags the stream with the client instance; empty leaves it
+	// out.
+	instanceID string
+	// src and listen are the local peer the stream carries and the listener
+	// it connected to; nil leaves them out (--send-peer-info is off).
+	src    net.Addr
+	listen net.Addr
+}
+
+// clientPreface encodes the preface of a client-opened stream with the fields
+// of meta that are set.
+func clientPreface(fields map[string]string, meta prefaceMeta) ([]byte, error) {
+	if meta.instanceID != "" {
+		fields[protocolv1.PrefaceClientInstance] = meta.instanceID
+	}
+	if meta.src != nil {
+		fields[protocolv1.PrefaceSrc] = meta.src.String()
+	}
+	if meta.listen != nil {
+		fields[protocolv1.PrefaceListen] = meta.listen.String()
+	}
+	return encodePreface(fields)
+}
+
+// dialHeaders returns the data-plane WebSocket dial headers; an empty origin
+// is left unset.
+func dialHeaders(origin, instanceID string) http.Header {
+	h := http.Header{}
+	if origin != "" {
+		h.Set("Origin", origin)
+	}
+	if instanceID != "" {
+		h.Set(protocolv1.HeaderClientInstance, instanceID)
+	}
+	return h
+}
+
 func buildWebSocketURL(serverURL, tunnelID, authToken string) (wsURL, origin string, err error) {
 	u, parseErr := url.Parse(serverURL)
 	if parseErr != nil || u.Scheme == "" || u.Host == "" {
@@ -50,8 +157,8 @@ func buildWebSocketURL(serverURL, tunnelID, authToken string) (wsURL, origin str
 	}
 
 	u.Scheme = wsScheme
-	u.Path = "/ws"
-	q := u.Query()
+	u = u.ResolveReference(&url.URL{Path: "/ws"})
+	q := url.Values{}
 	q.Set("mode", "data")
 	q.Set("tunnel_id", tunnelID)
 	if strings.TrimSpace(authToken) != "" {
@@ -0,0 +1,52 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import "strings"
+
+// rewriteHostHeader returns the request head with its Host header set to
+// host (--host-rewrite), added when the head has none. With forwarded the
+// original Host goes to X-Forwarded-Host, unless the head already has one.
+// Every other line is kept byte for byte.
+func rewriteHostHeader(head []byte, host string, forwarded bool) []byte {
+	lines := strings.Split(strings.TrimSuffix(string(head), "\r\n\r\n"), "\r\n")
+	original, found, hasForwarded := "", false, false
+	for i := 1; i < len(lines); i++ {
+		name, value, ok := strings.Cut(lines[i], ":")
+		switch {
+		case !ok:
+		case strings.EqualFold(name, "Host") && !found:
+			original, found = strings.TrimSpace(value), true
+			lines[i] = name + ": " + host
+		case strings.EqualFold(name, "X-Forwarded-Host"):
+			hasForwarded = true
+		}
+	}
+	if !found {
+		lines = append(lines, "Host: "+host)
+	}
+	if forwarded && original != "" && !hasForwarded {
+		lines = append(lines, "X-Forwarded-Host: "+original)
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n\r\n")
+}
+
+// appendForwardedFor returns the request head with src added as the last hop
+// of X-Forwarded-For, the way the server's edge adds the public client's
+// address (--local-mirror). Every other line is kept byte for byte.
+func appendForwardedFor(head []byte, src string) []byte {
+	lines := strings.Split(strings.TrimSuffix(string(head), "\r\n\r\n"), "\r\n")
+	last := -1
+	for i := 1; i < len(lines); i++ {
+		if name, _, ok := strings.Cut(lines[i], ":"); ok && strings.EqualFold(name, "X-Forwarded-For") {
+			last = i
+		}
+	}
+	if last < 0 {
+		lines = append(lines, "X-Forwarded-For: "+src)
+	} else {
+		lines[last] = strings.TrimRight(lines[last], " \t") + ", " + src
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n\r\n")
+}
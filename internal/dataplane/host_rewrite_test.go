@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteHostHeader(t *testing.T) {
+	tests := []struct {
+		name      string
+		head      string
+		forwarded bool
+		want      string
+	}{
+		{
+			name: "replaced in place",
+			head: "GET /a HTTP/1.1\r\nUser-Agent: x\r\nHost: app.example.com\r\nAccept:  */*\r\n\r\n",
+			want: "GET /a HTTP/1.1\r\nUser-Agent: x\r\nHost: myapp.local\r\nAccept:  */*\r\n\r\n",
+		},
+		{
+			name: "name casing kept",
+			head: "GET / HTTP/1.1\r\nhost:app.example.com\r\n\r\n",
+			want: "GET / HTTP/1.1\r\nhost: myapp.local\r\n\r\n",
+		},
+		{
+			name:      "original forwarded",
+			head:      "GET / HTTP/1.1\r\nHost: app.example.com\r\n\r\n",
+			forwarded: true,
+			want:      "GET / HTTP/1.1\r\nHost: myapp.local\r\nX-Forwarded-Host: app.example.com\r\n\r\n",
+		},
+		{
+			name:      "existing X-Forwarded-Host kept",
+			head:      "GET / HTTP/1.1\r\nHost: app.example.com\r\nX-Forwarded-Host: public.example.com\r\n\r\n",
+			forwarded: true,
+			want:      "GET / HTTP/1.1\r\nHost: myapp.local\r\nX-Forwarded-Host: public.example.com\r\n\r\n",
+		},
+		{
+			name:      "missing Host added",
+			head:      "GET / HTTP/1.0\r\nAccept: */*\r\n\r\n",
+			forwarded: true,
+			want:      "GET / HTTP/1.0\r\nAccept: */*\r\nHost: myapp.local\r\n\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, string(rewriteHostHeader([]byte(tt.head), "myapp.local", tt.forwarded)))
+		})
+	}
+}
+
+func TestAppendForwardedFor(t *testing.T) {
+	head := []byte("GET / HTTP/1.1\r\nHost: a\r\n\r\n")
+	assert.Equal(t, "GET / HTTP/1.1\r\nHost: a\r\nX-Forwarded-For: 10.0.0.7\r\n\r\n", string(appendForwardedFor(head, "10.0.0.7")))
+
+	head = []byte("GET / HTTP/1.1\r\nX-Forwarded-For: 203.0.113.9\r\nHost: a\r\n\r\n")
+	assert.Equal(t, "GET / HTTP/1.1\r\nX-Forwarded-For: 203.0.113.9, 10.0.0.7\r\nHost: a\r\n\r\n", string(appendForwardedFor(head, "10.0.0.7")))
+}
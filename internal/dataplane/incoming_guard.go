@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fortunnels/client/internal/auth"
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/support"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+var (
+	errIncomingDstNotAllowed = errors.New("incoming stream dst not allowed by client")
+	errIncomingHMACInvalid   = errors.New("incoming stream preface hmac missing or invalid")
+)
+
+// incomingGuard vets server-initiated stream prefaces before the client dials
+// their dst, so that a compromised or buggy server cannot use the client to
+// reach arbitrary local addresses. Each kind of rejection is warned about
+// once and counted.
+type incomingGuard struct {
+	tunnelID string
+	// allow is the dst allowlist; nil allows any dst. A reload swaps it.
+	allow  atomic.Pointer[dstAllowlist]
+	secret string
+
+	rejectedDst  atomic.Int64
+	rejectedHMAC atomic.Int64
+	warnDst      sync.Once
+	warnHMAC     sync.Once
+}
+
+// newIncomingGuard returns the guard for settings, or nil when neither a dst
+// allowlist nor an incoming HMAC secret is configured.
+func newIncomingGuard(tunnelID string, settings config.RuntimeSettings) *incomingGuard {
+	secret := strings.TrimSpace(settings.IncomingHMACSecret)
+	if len(settings.IncomingDstAllow) == 0 && secret == "" {
+		return nil
+	}
+	g := &incomingGuard{tunnelID: tunnelID, secret: secret}
+	g.setAllowlist(settings.IncomingDstAllow)
+	return g
+}
+
+// dstAllowlist is an immutable set of normalized host:port destinations.
+type dstAllowlist struct {
+	set map[string]bool
+	msg string
+}
+
+// setAllowlist replaces the dst allowlist; an empty list allows any dst.
+// Streams already past the check are not affected.
+func (g *incomingGuard) setAllowlist(dsts []string) {
+	if len(dsts) == 0 {
+		g.allow.Store(nil)
+		return
+	}
+	a := &dstAllowlist{set: make(map[string]bool, len(dsts)), msg: strings.Join(dsts, ", ")}
+	for _, dst := range dsts {
+		a.set[normalizeIncomingDst(dst)] = true
+	}
+	g.allow.Store(a)
+}
+
+// check returns an error when the stream described by pre must not be dialed.
+func (g *incomingGuard) check(pre map[string]string) error {
+	if g == nil {
+		return nil
+	}
+	dst := pre["dst"]
+	shown := support.SanitizeRemote(dst)
+	if a := g.allow.Load(); a != nil && !a.set[normalizeIncomingDst(dst)] {
+		n := g.rejectedDst.Add(1)
+		g.warnDst.Do(func() {
+			log.Printf("[WARN] Blocked incoming stream to %s: not the tunnel target (allowed: %s). "+
+				"Further blocked streams are only counted; add trusted destinations with --allow-incoming-dst.", shown, a.msg)
+		})
+		logDebug("blocked incoming stream to %s (dst not allowed, total %d)", shown, n)
+		return errIncomingDstNotAllowed
+	}
+	if g.secret != "" && !auth.VerifyIncomingStreamHMAC(g.secret, g.tunnelID, dst, pre[protocolv1.PrefaceHMAC]) {
+		n := g.rejectedHMAC.Add(1)
+		g.warnHMAC.Do(func() {
+			log.Printf("[WARN] Blocked incoming stream to %s: preface has no valid hmac for --dp-auth-secret. "+
+				"The server must sign incoming streams with the same secret; further blocked streams are only counted.", shown)
+		})
+		logDebug("blocked incoming stream to %s (bad hmac, total %d)", shown, n)
+		return errIncomingHMACInvalid
+	}
+	return nil
+}
+
+// rejected returns how many streams were blocked by the dst allowlist and by
+// the HMAC check.
+func (g *incomingGuard) rejected() (dst, hmac int64) {
+	if g == nil {
+		return 0, 0
+	}
+	return g.rejectedDst.Load(), g.rejectedHMAC.Load()
+}
+
+// normalizeIncomingDst lowercases the host and folds loopback names, so that
+// "localhost:3000", "127.0.0.1:3000" and "[::1]:3000" match each other.
+func normalizeIncomingDst(dst string) string {
+	host, port, err := net.SplitHostPort(strings.TrimSpace(dst))
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(dst))
+	}
+	host = strings.ToLower(host)
+	if host == "" || host == "localhost" {
+		host = "127.0.0.1"
+	} else if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
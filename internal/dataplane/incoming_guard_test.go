@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/auth"
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/testsupport"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+func TestNewIncomingGuard_OffWithoutPolicy(t *testing.T) {
+	assert.Nil(t, newIncomingGuard("t-1", config.RuntimeSettings{}))
+	var g *incomingGuard
+	require.NoError(t, g.check(map[string]string{"dst": "10.0.0.1:22"}), "nil guard allows any dst")
+}
+
+func TestIncomingGuard_Dst(t *testing.T) {
+	buf := captureLog(t)
+	g := newIncomingGuard("t-1", config.RuntimeSettings{IncomingDstAllow: []string{"localhost:3000", "10.0.0.5:8080"}})
+
+	for _, dst := range []string{"localhost:3000", "127.0.0.1:3000", "[::1]:3000", "LOCALHOST:3000", "10.0.0.5:8080"} {
+		require.NoError(t, g.check(map[string]string{"dst": dst}), dst)
+	}
+	for _, dst := range []string{"127.0.0.1:22", "169.254.169.254:80", "10.0.0.5:8081"} {
+		require.ErrorIs(t, g.check(map[string]string{"dst": dst}), errIncomingDstNotAllowed, dst)
+	}
+
+	blockedDst, blockedHMAC := g.rejected()
+	assert.Equal(t, int64(3), blockedDst)
+	assert.Zero(t, blockedHMAC)
+	assert.Equal(t, 1, strings.Count(buf.String(), "Blocked incoming stream"), "warn once: %q", buf.String())
+	assert.Contains(t, buf.String(), "127.0.0.1:22")
+	assert.Contains(t, buf.String(), "--allow-incoming-dst")
+}
+
+func TestIncomingGuard_SetAllowlist(t *testing.T) {
+	captureLog(t)
+	g := newIncomingGuard("t-1", config.RuntimeSettings{IncomingDstAllow: []string{"127.0.0.1:3000"}})
+	require.ErrorIs(t, g.check(map[string]string{"dst": "127.0.0.1:9000"}), errIncomingDstNotAllowed)
+
+	g.setAllowlist([]string{"127.0.0.1:3000", "localhost:9000"})
+	require.NoError(t, g.check(map[string]string{"dst": "127.0.0.1:9000"}), "reloaded allowlist applies to new streams")
+
+	g.setAllowlist(nil)
+	require.NoError(t, g.check(map[string]string{"dst": "10.0.0.1:22"}), "an empty allowlist allows any dst")
+}
+
+func TestIncomingGuard_HMAC(t *testing.T) {
+	buf := captureLog(t)
+	const secret, tid, dst = "dp-secret", "t-1", "127.0.0.1:3000"
+	g := newIncomingGuard(tid, config.RuntimeSettings{IncomingDstAllow: []string{dst}, IncomingHMACSecret: secret})
+
+	valid := auth.IncomingStreamHMAC(secret, tid, dst)
+	require.NoError(t, g.check(map[string]string{"dst": dst, protocolv1.PrefaceHMAC: valid}))
+	require.NoError(t, g.check(map[string]string{"dst": dst, protocolv1.PrefaceHMAC: strings.ToUpper(valid)}), "hex case is ignored")
+
+	for name, mac := range map[string]string{
+		"missing":      "",
+		"other secret": auth.IncomingStreamHMAC("other", tid, dst),
+		"other tunnel": auth.IncomingStreamHMAC(secret, "t-2", dst),
+		"garbage":      "zz",
+	} {
+		pre := map[string]string{"dst": dst}
+		if mac != "" {
+			pre[protocolv1.PrefaceHMAC] = mac
+		}
+		require.ErrorIs(t, g.check(pre), errIncomingHMACInvalid, name)
+	}
+	_, blockedHMAC := g.rejected()
+	assert.Equal(t, int64(4), blockedHMAC)
+	assert.Equal(t, 1, strings.Count(buf.String(), "Blocked incoming stream"), "warn once: %q", buf.String())
+	assert.Contains(t, buf.String(), "--dp-auth-secret")
+}
+
+func TestIncomingGuard_DstCheckedBeforeHMAC(t *testing.T) {
+	captureLog(t)
+	const secret, tid = "dp-secret", "t-1"
+	g := newIncomingGuard(tid, config.RuntimeSettings{IncomingDstAllow: []string{"127.0.0.1:3000"}, IncomingHMACSecret: secret})
+	// A correctly signed preface for a dst outside the allowlist is still rejected.
+	pre := map[string]string{"dst": "127.0.0.1:22", protocolv1.PrefaceHMAC: auth.IncomingStreamHMAC(secret, tid, "127.0.0.1:22")}
+	require.ErrorIs(t, g.check(pre), errIncomingDstNotAllowed)
+}
+
+func TestIncomingStream_GuardRejectsWithoutDialing(t *testing.T) {
+	captureLog(t)
+	backend := startTCPEchoBackend(t)
+	server := incomingStreamServer{
+		tunnelID: "t-1",
+		guard:    newIncomingGuard("t-1", config.RuntimeSettings{IncomingDstAllow: []string{"127.0.0.1:1"}}),
+	}
+	stream := &mockTCPStream{readData: []byte(`{"dst": "` + backend + `", "proto": "tcp"}` + "\n")}
+	require.NoError(t, server.serve(stream, connLogger{}))
+	assert.Contains(t, string(stream.writeData), `"ok":false`)
+	assert.Contains(t, string(stream.writeData), errIncomingDstNotAllowed.Error())
+}
+
+func TestE2E_ServeIncoming_EnforcesTargetAndHMAC(t *testing.T) {
+	captureLog(t)
+	const secret = "dp-secret"
+	signed := testsupport.NewServer(testsupport.Options{DPAuthSecret: secret})
+	defer signed.Close()
+	tun := signed.AddTunnel("tcp", "127.0.0.1:0")
+	backend := startTCPEchoBackend(t)
+	other := startTCPEchoBackend(t)
+
+	runtime := e2eRuntime()
+	runtime.IncomingDstAllow = []string{backend}
+	runtime.IncomingHMACSecret = secret
+	mgr := NewManager(signed.URL, tun.ID, "", 10*time.Millisecond, 50*time.Millisecond, runtime)
+	defer mgr.Close()
+	go func() { _ = serveIncomingWithManager(mgr, nil) }()
+	require.NoError(t, signed.WaitSessions(tun.ID, 1, 5*time.Second))
+
+	st, err := signed.OpenStream(tun.ID, backend)
+	require.NoError(t, err, "signed stream to the target is served")
+	echoThroughStream(t, st, "allowed")
+	st.Close()
+
+	_, err = signed.OpenStream(tun.ID, other)
+	require.ErrorContains(t, err, errIncomingDstNotAllowed.Error())
+
+	unsigned := testsupport.NewServer(testsupport.Options{})
+	defer unsigned.Close()
+	tun2 := unsigned.AddTunnel("tcp", "127.0.0.1:0")
+	mgr2 := NewManager(unsigned.URL, tun2.ID, "", 10*time.Millisecond, 50*time.Millisecond, runtime)
+	defer mgr2.Close()
+	go func() { _ = serveIncomingWithManager(mgr2, nil) }()
+	require.NoError(t, unsigned.WaitSessions(tun2.ID, 1, 5*time.Second))
+	_, err = unsigned.OpenStream(tun2.ID, backend)
+	require.ErrorContains(t, err, errIncomingHMACInvalid.Error())
+}
@@ -0,0 +1,297 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/fortunnels/client/internal/support"
+)
+
+// inspectQueueChunks bounds how many response chunks may wait for the
+// inspector. When it falls further behind it gives up on the stream instead
+// of slowing the forwarding path down.
+const inspectQueueChunks = 64
+
+// defaultHTTPPeekBytes is the --http-peek-bytes budget when the settings
+// leave it unset.
+const defaultHTTPPeekBytes = 64 << 10
+
+// peekBudget is the per-stream buffer budget of HTTP-aware processing.
+func peekBudget(n int) int {
+	if n <= 0 {
+		return defaultHTTPPeekBytes
+	}
+	return n
+}
+
+// responseInspector logs the HTTP/1.x responses a backend sends through one
+// stream (--inspect-decode, --inspect-body-bytes). It parses a copy of the
+// bytes in its own goroutine; observe never blocks and never changes what is
+// forwarded. Bodies are streamed through the parser, never accumulated: at
+// most budget bytes wait in the queue and response heads must fit into a
+// budget-sized buffer, otherwise the rest of the stream is not inspected.
+type responseInspector struct {
+	decode    bool
+	bodyBytes int
+	budget    int
+	lg        connLogger
+
+	queue chan []byte
+	mu    sync.Mutex
+	// queued is the size of the chunks in queue.
+	queued int
+	// closed is set once queue is closed: by finish, or when it overflowed.
+	closed bool
+	done   chan struct{}
+}
+
+// inspectOptions are the response logging switches of one stream.
+type inspectOptions struct {
+	decode    bool
+	bodyBytes int
+}
+
+// newResponseInspector returns the inspector for one stream, or nil when
+// response inspection is off. A body preview larger than budget is disabled
+// for the stream rather than buffered.
+func newResponseInspector(decode bool, bodyBytes, budget int, lg connLogger) *responseInspector {
+	budget = peekBudget(budget)
+	if bodyBytes > budget {
+		lg.Printf("inspect: --inspect-body-bytes %d exceeds the %d-byte peek budget (--http-peek-bytes), body preview disabled", bodyBytes, budget)
+		bodyBytes = 0
+	}
+	if !decode && bodyBytes <= 0 {
+		return nil
+	}
+	in := &responseInspector{
+		decode:    decode,
+		bodyBytes: bodyBytes,
+		budget:    budget,
+		lg:        lg,
+		queue:     make(chan []byte, inspectQueueChunks),
+		done:      make(chan struct{}),
+	}
+	support.Go(support.PanicScope{Role: "response inspector", ConnID: lg.id}, in.run)
+	return in
+}
+
+// observe queues a copy of p for parsing. If the queue is full or would hold
+// more than the budget, the rest of the stream is not inspected.
+func (in *responseInspector) observe(p []byte) {
+	if in == nil || len(p) == 0 {
+		return
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if in.closed {
+		return
+	}
+	if in.queued+len(p) > in.budget {
+		in.giveUpLocked(fmt.Sprintf("parser is %d bytes behind, over the %d-byte peek budget", in.queued+len(p), in.budget))
+		return
+	}
+	select {
+	case in.queue <- append([]byte(nil), p...):
+		in.queued += len(p)
+	default:
+		in.giveUpLocked("parser fell behind")
+	}
+}
+
+func (in *responseInspector) giveUpLocked(reason string) {
+	in.closed = true
+	close(in.queue)
+	in.lg.Printf("inspect: %s, skipping the rest of this stream", reason)
+}
+
+// dequeued releases n bytes of the budget once the parser has taken them.
+func (in *responseInspector) dequeued(n int) {
+	in.mu.Lock()
+	in.queued -= n
+	in.mu.Unlock()
+}
+
+// finish ends the inspected byte stream and waits for pending log lines.
+func (in *responseInspector) finish() {
+	if in == nil {
+		return
+	}
+	in.closeQueue()
+	<-in.done
+}
+
+// closeQueue stops further observes; the parser drains what is queued.
+func (in *responseInspector) closeQueue() {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if !in.closed {
+		in.closed = true
+		close(in.queue)
+	}
+}
+
+func (in *responseInspector) run() {
+	defer close(in.done)
+	// Once the parser stops, nothing would take queued chunks any more.
+	defer in.closeQueue()
+	pr, pw := io.Pipe()
+	go func() {
+		defer support.RecoverAs(func(p *support.PanicError) {
+			support.ReportPanic(support.PanicScope{Role: "response inspector queue", ConnID: in.lg.id}, p)
+			_ = pw.CloseWithError(p)
+		})
+		for chunk := range in.queue {
+			in.dequeued(len(chunk))
+			if _, err := pw.Write(chunk); err != nil {
+				break
+			}
+		}
+		// Drain whatever is left so observe never blocks on a full queue.
+		for range in.queue {
+		}
+		_ = pw.Close()
+	}()
+	defer pr.Close()
+	rd := bufio.NewReaderSize(pr, in.budget)
+	for {
+		// ReadResponse would grow its buffers for a huge head; check that it
+		// fits the budget first.
+		if _, err := peekHTTPHead(rd, isHTTPResponseStart); err != nil {
+			if errors.Is(err, errHTTPHeadTooLarge) {
+				in.lg.Printf("inspect: response head exceeds the %d-byte peek budget, skipping the rest of this stream", in.budget)
+			}
+			return
+		}
+		resp, err := http.ReadResponse(rd, nil)
+		if err != nil {
+			return
+		}
+		in.logResponse(resp)
+		resp.Body.Close()
+	}
+}
+
+func isHTTPResponseStart(b []byte) bool { return bytes.HasPrefix(b, []byte("HTTP/")) }
+
+func (in *responseInspector) logResponse(resp *http.Response) {
+	wire := &countingReader{r: resp.Body}
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	contentType := resp.Header.Get("Content-Type")
+	body := io.Reader(wire)
+	decoded := encoding == "" || encoding == "identity"
+	var decodeErr error
+	if in.decode && !decoded {
+		body, decodeErr = newBodyDecoder(encoding, wire)
+		decoded = decodeErr == nil
+	}
+	preview := &limitedBuffer{max: in.bodyBytes}
+	var n int64
+	if decoded {
+		n, decodeErr = io.Copy(preview, body)
+	}
+	// Keep the parser in step with the stream even when decoding failed.
+	_, _ = io.Copy(io.Discard, wire)
+
+	label := contentType
+	if label == "" {
+		label = "-"
+	}
+	if encoding != "" {
+		label += " encoding=" + encoding
+	}
+	switch {
+	case !in.decode || encoding == "" || encoding == "identity":
+		in.lg.Printf("inspect: HTTP %d %s wire=%dB", resp.StatusCode, label, wire.n)
+	case decodeErr != nil:
+		in.lg.Printf("inspect: HTTP %d %s wire=%dB decoded=? (%v)", resp.StatusCode, label, wire.n, decodeErr)
+	default:
+		in.lg.Printf("inspect: HTTP %d %s wire=%dB decoded=%dB", resp.StatusCode, label, wire.n, n)
+	}
+	if decoded && in.bodyBytes > 0 && preview.Len() > 0 && isTextContentType(contentType) {
+		in.lg.Printf("inspect: body %q", preview.String())
+	}
+}
+
+// newBodyDecoder undoes a Content-Encoding for logging. HTTP's "deflate" is
+// meant to be zlib-wrapped but raw deflate is common, so both are accepted.
+// Brotli is not supported.
+func newBodyDecoder(encoding string, r io.Reader) (io.Reader, error) {
+	switch encoding {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		br := bufio.NewReader(r)
+		if head, err := br.Peek(2); err == nil && isZlibHeader(head) {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	default:
+		return nil, errors.New("unsupported content-encoding " + encoding)
+	}
+}
+
+func isZlibHeader(b []byte) bool {
+	return b[0]&0x0f == 8 && (uint16(b[0])<<8|uint16(b[1]))%31 == 0
+}
+
+// isTextContentType reports whether a body of this type is worth previewing.
+func isTextContentType(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(mt, "text/") {
+		return true
+	}
+	for _, suffix := range []string{"json", "xml", "javascript", "x-www-form-urlencoded", "yaml"} {
+		if strings.HasSuffix(mt, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// inspectedStream tees what is written to the stream (the backend's
+// response) into a responseInspector.
+type inspectedStream struct {
+	io.ReadWriteCloser
+	in *responseInspector
+}
+
+func (s inspectedStream) Write(p []byte) (int, error) {
+	n, err := s.ReadWriteCloser.Write(p)
+	s.in.observe(p[:n])
+	return n, err
+}
+
+// CloseWrite keeps half-close working through the wrapper.
+func (s inspectedStream) CloseWrite() error {
+	if cw, ok := s.ReadWriteCloser.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return s.ReadWriteCloser.Close()
+}
@@ -0,0 +1,334 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"runtime"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/testsupport"
+)
+
+// chunkedGzipResponse is a chunked, gzip-encoded JSON response as a backend
+// would put it on the wire, plus the size of the decoded body.
+func chunkedGzipResponse(t *testing.T) ([]byte, int) {
+	t.Helper()
+	body := []byte(`{"items":[` + strings.Repeat(`{"name":"widget","ok":true},`, 2000) + `{}]}`)
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, err := zw.Write(body)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	var resp bytes.Buffer
+	resp.WriteString("HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Encoding: gzip\r\nTransfer-Encoding: chunked\r\n\r\n")
+	for rest := gz.Bytes(); len(rest) > 0; {
+		n := min(len(rest), 97)
+		fmt.Fprintf(&resp, "%x\r\n%s\r\n", n, rest[:n])
+		rest = rest[n:]
+	}
+	resp.WriteString("0\r\n\r\n")
+	return resp.Bytes(), len(body)
+}
+
+// nopStream is an in-memory io.ReadWriteCloser collecting what is written.
+type nopStream struct{ bytes.Buffer }
+
+func (*nopStream) Close() error { return nil }
+
+func TestResponseInspector_LogsWireAndDecodedSize(t *testing.T) {
+	raw, decodedLen := chunkedGzipResponse(t)
+	plain := "HTTP/1.1 404 Not Found\r\nContent-Type: text/plain\r\nContent-Length: 9\r\n\r\nnot found"
+	buf := captureLog(t)
+
+	out := &nopStream{}
+	st := inspectedStream{out, newResponseInspector(true, 24, 0, connLogger{})}
+	wire := append(append([]byte(nil), raw...), plain...)
+	for rest := wire; len(rest) > 0; {
+		n := min(len(rest), 1000)
+		_, err := st.Write(rest[:n])
+		require.NoError(t, err)
+		rest = rest[n:]
+	}
+	st.in.finish()
+
+	assert.Equal(t, wire, out.Bytes(), "forwarded bytes are untouched")
+	logs := buf.String()
+	assert.Regexp(t, fmt.Sprintf(`inspect: HTTP 200 application/json encoding=gzip wire=\d+B decoded=%dB`, decodedLen), logs)
+	assert.Contains(t, logs, `inspect: body "{\"items\":[{\"name\":\"widge"`)
+	assert.Contains(t, logs, "inspect: HTTP 404 text/plain wire=9B")
+	assert.Contains(t, logs, `inspect: body "not found"`)
+}
+
+func TestResponseInspector_WithoutDecodeReportsWireOnly(t *testing.T) {
+	raw, _ := chunkedGzipResponse(t)
+	buf := captureLog(t)
+	st := inspectedStream{&nopStream{}, newResponseInspector(false, 64, 0, connLogger{})}
+	_, err := st.Write(raw)
+	require.NoError(t, err)
+	st.in.finish()
+	assert.Regexp(t, `inspect: HTTP 200 application/json encoding=gzip wire=\d+B\n`, buf.String())
+	assert.NotContains(t, buf.String(), "inspect: body", "compressed bytes are not previewed")
+}
+
+func TestResponseInspector_OverflowNeverBlocks(t *testing.T) {
+	captureLog(t)
+	// No parser goroutine: the queue fills up and observe must give up.
+	in := &responseInspector{lg: connLogger{}, budget: defaultHTTPPeekBytes, queue: make(chan []byte, inspectQueueChunks), done: make(chan struct{})}
+	finished := make(chan struct{})
+	go func() {
+		for range 10 * inspectQueueChunks {
+			in.observe([]byte("x"))
+		}
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(2 * time.Second):
+		t.Fatal("observe blocked on a stalled parser")
+	}
+	assert.True(t, in.closed)
+	assert.Len(t, in.queue, inspectQueueChunks)
+}
+
+func TestResponseInspector_QueueStaysWithinBudget(t *testing.T) {
+	logs := captureLog(t)
+	// No parser goroutine: big chunks exhaust the byte budget long before
+	// the chunk count.
+	in := &responseInspector{lg: connLogger{}, budget: 64 << 10, queue: make(chan []byte, inspectQueueChunks), done: make(chan struct{})}
+	chunk := make([]byte, 20<<10)
+	for range 10 {
+		in.observe(chunk)
+	}
+	assert.True(t, in.closed)
+	assert.Len(t, in.queue, 3)
+	assert.LessOrEqual(t, in.queued, in.budget)
+	assert.Contains(t, logs.String(), "over the 65536-byte peek budget")
+}
+
+func TestResponseInspector_HeadOverBudget(t *testing.T) {
+	logs := captureLog(t)
+	in := newResponseInspector(true, 0, 32<<10, connLogger{})
+	st := inspectedStream{&nopStream{}, in}
+	head := "HTTP/1.1 200 OK\r\nX-Big: " + strings.Repeat("a", 40<<10) + "\r\n\r\n"
+	// Written at the parser's pace, so only the head size can stop it.
+	for chunk := range slices.Chunk([]byte(head), 4<<10) {
+		_, _ = st.Write(chunk)
+		require.Eventually(t, func() bool {
+			in.mu.Lock()
+			defer in.mu.Unlock()
+			return in.queued == 0 || in.closed
+		}, 2*time.Second, time.Millisecond)
+	}
+	in.finish()
+	assert.Contains(t, logs.String(), "response head exceeds the 32768-byte peek budget")
+	assert.NotContains(t, logs.String(), "inspect: HTTP 200")
+}
+
+func TestNewResponseInspector_PreviewOverBudgetDisabled(t *testing.T) {
+	logs := captureLog(t)
+	assert.Nil(t, newResponseInspector(false, 1<<20, 64<<10, connLogger{}), "nothing left to inspect")
+	assert.Contains(t, logs.String(), "body preview disabled")
+	in := newResponseInspector(true, 1<<20, 64<<10, connLogger{})
+	require.NotNil(t, in)
+	assert.Zero(t, in.bodyBytes)
+	in.finish()
+}
+
+func TestNewBodyDecoder_Deflate(t *testing.T) {
+	const msg = "deflate either way"
+	var zl, raw bytes.Buffer
+	zw := zlib.NewWriter(&zl)
+	_, _ = zw.Write([]byte(msg))
+	require.NoError(t, zw.Close())
+	fw, err := flate.NewWriter(&raw, flate.DefaultCompression)
+	require.NoError(t, err)
+	_, _ = fw.Write([]byte(msg))
+	require.NoError(t, fw.Close())
+
+	for name, enc := range map[string][]byte{"zlib": zl.Bytes(), "raw": raw.Bytes()} {
+		r, err := newBodyDecoder("deflate", bytes.NewReader(enc))
+		require.NoError(t, err, name)
+		got, err := io.ReadAll(r)
+		require.NoError(t, err, name)
+		assert.Equal(t, msg, string(got), name)
+	}
+	_, err = newBodyDecoder("br", bytes.NewReader(nil))
+	assert.Error(t, err)
+}
+
+func TestIsTextContentType(t *testing.T) {
+	for ct, want := range map[string]bool{
+		"text/html; charset=utf-8": true,
+		"application/json":         true,
+		"application/problem+json": true,
+		"application/xml":          true,
+		"application/octet-stream": false,
+		"image/png":                false,
+		"":                         false,
+	} {
+		assert.Equal(t, want, isTextContentType(ct), ct)
+	}
+}
+
+func TestE2E_ServeIncoming_InspectForwardsBackendBytes(t *testing.T) {
+	raw, _ := chunkedGzipResponse(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				buf := make([]byte, 4096)
+				if _, err := c.Read(buf); err != nil {
+					return
+				}
+				_, _ = c.Write(raw)
+			}()
+		}
+	}()
+
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	tun := stub.AddTunnel("http", ln.Addr().String())
+	runtime := e2eRuntime()
+	runtime.HTTPAware = true
+	runtime.InspectDecode = true
+	runtime.InspectBodyBytes = 256
+	mgr := NewManager(stub.URL, tun.ID, "", 10*time.Millisecond, 50*time.Millisecond, runtime)
+	defer mgr.Close()
+	go func() { _ = serveIncomingWithManager(mgr, nil) }()
+	require.NoError(t, stub.WaitSessions(tun.ID, 1, 5*time.Second))
+
+	st, err := stub.OpenStream(tun.ID, ln.Addr().String())
+	require.NoError(t, err)
+	defer st.Close()
+	_, err = io.WriteString(st, "GET / HTTP/1.1\r\nHost: example\r\n\r\n")
+	require.NoError(t, err)
+	got, err := io.ReadAll(st)
+	require.NoError(t, err)
+	assert.Equal(t, raw, got, "chunked gzip response is forwarded byte for byte")
+}
+
+// zeroReader is an endless stream of zero bytes: a generated upload body
+// that is never materialized.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// TestInspect_LargeUploadStaysWithinMemoryBudget uploads 1 GiB through an
+// inspected HTTP tunnel to a backend that starts out slow, and checks that
+// the Go heap never grows by more than a fixed bound: the request body is
+// only streamed, never accumulated.
+func TestInspect_LargeUploadStaysWithinMemoryBudget(t *testing.T) {
+	const (
+		uploadSize = 1 << 30
+		heapBound  = 32 << 20
+	)
+	logs := captureLog(t)
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer backend.Close()
+	go func() {
+		c, err := backend.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		rd := bufio.NewReader(c)
+		req, err := http.ReadRequest(rd)
+		if err != nil {
+			return
+		}
+		// Slow for the first 16 MiB, so the remote side outruns the backend.
+		slow := &countingReader{r: req.Body}
+		buf := make([]byte, 32<<10)
+		for slow.n < 16<<20 {
+			if _, err := slow.Read(buf); err != nil {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+		_, _ = io.Copy(io.Discard, req.Body)
+		_, _ = io.WriteString(c, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 8\r\n\r\nuploaded")
+	}()
+
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	tun := stub.AddTunnel("http", backend.Addr().String())
+	rt := e2eRuntime()
+	rt.HTTPAware, rt.InspectDecode, rt.InspectBodyBytes = true, true, 256
+	mgr := NewTunnelManager(stub.URL, tun.ID, "", rt)
+	defer mgr.Close()
+	go func() { _ = ServeIncoming(mgr, nil) }()
+	require.NoError(t, stub.WaitSessions(tun.ID, 1, 5*time.Second))
+
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	base := ms.HeapAlloc
+	var peak atomic.Uint64
+	stopSampling := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		var ms runtime.MemStats
+		for {
+			select {
+			case <-stopSampling:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+			runtime.ReadMemStats(&ms)
+			if ms.HeapAlloc > peak.Load() {
+				peak.Store(ms.HeapAlloc)
+			}
+		}
+	}()
+
+	stream, err := stub.OpenStream(tun.ID, backend.Addr().String())
+	require.NoError(t, err)
+	defer stream.Close()
+	_, err = fmt.Fprintf(stream, "POST /upload HTTP/1.1\r\nHost: backend\r\nContent-Length: %d\r\n\r\n", uploadSize)
+	require.NoError(t, err)
+	n, err := io.CopyN(stream, zeroReader{}, uploadSize)
+	require.NoError(t, err)
+	require.Equal(t, int64(uploadSize), n)
+	resp, err := http.ReadResponse(bufio.NewReader(stream), nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "uploaded", string(body))
+	close(stopSampling)
+	<-sampled
+
+	grown := int64(peak.Load()) - int64(base)
+	t.Logf("peak heap growth %d KiB", grown>>10)
+	assert.Less(t, grown, int64(heapBound), "heap grew by %d MiB during a %d MiB upload", grown>>20, uploadSize>>20)
+	assert.Eventually(t, func() bool { return strings.Contains(logs.String(), "inspect: HTTP 200 text/plain wire=8B") }, 2*time.Second, 10*time.Millisecond, logs.String())
+}
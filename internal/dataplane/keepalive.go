@@ -0,0 +1,642 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/support"
+)
+
+// requestBodyGrace is how long a stream waits for the rest of a request
+// body once the backend answered it. A backend that answers early (a 413,
+// say) may never read the rest, and a connection with part of a body left
+// on it cannot carry another request: both ends are closed.
+const requestBodyGrace = time.Second
+
+// aLongTimeAgo is a read deadline that makes a blocked read return at once.
+var aLongTimeAgo = time.Unix(1, 0)
+
+var (
+	// errStaleBackend is a pooled connection the backend closed before the
+	// request reached it. Requests without a body are retried on a new one.
+	errStaleBackend = errors.New("pooled backend connection was closed by the backend")
+	// errMalformedChunk is a chunked body whose framing cannot be followed.
+	errMalformedChunk = errors.New("malformed chunked body")
+)
+
+// keepAlivePool keeps the idle backend connections of HTTPAware streams for
+// reuse by later streams to the same backend (--backend-pool-size). Streams
+// only put a connection back at a request boundary: every request they
+// forwarded on it got its complete response, with no byte left over.
+type keepAlivePool struct {
+	size int
+	idle time.Duration
+
+	mu    sync.Mutex
+	conns map[string][]*idleConn
+	// closed is set by closeIdle; later connections are not kept.
+	closed bool
+}
+
+// idleConn is a pooled connection. While it waits, watch reads from it: the
+// read returns when the idle timeout is over, when the backend closes it or
+// sends bytes nobody asked for, or when get takes the connection.
+type idleConn struct {
+	conn net.Conn
+	// taken is set by get, under the pool's mu.
+	taken   bool
+	watched chan struct{}
+	// n and err are the watching read's result, set before watched closes.
+	n       int
+	err     error
+	release func()
+}
+
+// newKeepAlivePool returns the pool for settings, or nil when streams dial
+// a connection of their own.
+func newKeepAlivePool(settings config.RuntimeSettings) *keepAlivePool {
+	if settings.BackendPoolSize <= 0 || !settings.HTTPAware {
+		return nil
+	}
+	return &keepAlivePool{
+		size:  settings.BackendPoolSize,
+		idle:  settings.BackendPoolIdle,
+		conns: make(map[string][]*idleConn),
+	}
+}
+
+// get returns the most recently pooled live connection to addr, or nil.
+func (p *keepAlivePool) get(addr string) net.Conn {
+	if p == nil {
+		return nil
+	}
+	for {
+		p.mu.Lock()
+		list := p.conns[addr]
+		if len(list) == 0 {
+			p.mu.Unlock()
+			return nil
+		}
+		ic := list[len(list)-1]
+		p.setLocked(addr, list[:len(list)-1])
+		ic.taken = true
+		p.mu.Unlock()
+
+		// Interrupt the watching read; a deadline error means nothing
+		// happened on the connection while it was idle.
+		_ = ic.conn.SetReadDeadline(aLongTimeAgo)
+		<-ic.watched
+		ic.release()
+		if ic.n == 0 && errors.Is(ic.err, os.ErrDeadlineExceeded) && ic.conn.SetReadDeadline(time.Time{}) == nil {
+			return ic.conn
+		}
+		_ = ic.conn.Close()
+	}
+}
+
+// put keeps conn for the next stream to addr, or closes it when addr already
+// has size idle connections.
+func (p *keepAlivePool) put(addr string, conn net.Conn) {
+	if err := conn.SetReadDeadline(time.Now().Add(p.idle)); err != nil {
+		_ = conn.Close()
+		return
+	}
+	p.mu.Lock()
+	if p.closed || len(p.conns[addr]) >= p.size {
+		p.mu.Unlock()
+		_ = conn.Close()
+		return
+	}
+	ic := &idleConn{conn: conn, watched: make(chan struct{}), release: track(&processFDs.localConns)}
+	p.conns[addr] = append(p.conns[addr], ic)
+	p.mu.Unlock()
+	support.Go(support.PanicScope{Role: "pooled backend connection"}, func() { p.watch(addr, ic) })
+}
+
+// watch waits on ic until get takes it; otherwise the connection is dropped
+// from the pool and closed.
+func (p *keepAlivePool) watch(addr string, ic *idleConn) {
+	var b [1]byte
+	ic.n, ic.err = ic.conn.Read(b[:])
+	p.mu.Lock()
+	taken := ic.taken
+	if !taken {
+		list := p.conns[addr]
+		for i, c := range list {
+			if c == ic {
+				p.setLocked(addr, append(list[:i:i], list[i+1:]...))
+				break
+			}
+		}
+	}
+	p.mu.Unlock()
+	close(ic.watched)
+	if !taken {
+		ic.release()
+		_ = ic.conn.Close()
+	}
+}
+
+func (p *keepAlivePool) setLocked(addr string, list []*idleConn) {
+	if len(list) == 0 {
+		delete(p.conns, addr)
+		return
+	}
+	p.conns[addr] = list
+}
+
+// closeIdle closes the idle connections once the streams they were kept for
+// are no longer served. It is a no-op on a nil pool.
+func (p *keepAlivePool) closeIdle() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.closed = true
+	var idle []*idleConn
+	for _, list := range p.conns {
+		idle = append(idle, list...)
+	}
+	p.mu.Unlock()
+	// The watching reads return, drop the connections and close them.
+	for _, ic := range idle {
+		_ = ic.conn.SetReadDeadline(aLongTimeAgo)
+	}
+}
+
+// idleCount is the number of idle connections to addr.
+func (p *keepAlivePool) idleCount(addr string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.conns[addr])
+}
+
+// pooledBackend returns an idle connection for dst and the address it
+// reaches. Streams for the tunnel target take one of any --local backend,
+// healthy ones first.
+func (s incomingStreamServer) pooledBackend(dst string) (net.Conn, string) {
+	if !s.pool.serves(dst) {
+		return s.keepAlive.get(dst), dst
+	}
+	for _, target := range s.pool.candidates() {
+		if c := s.keepAlive.get(target); c != nil {
+			return c, target
+		}
+	}
+	return nil, dst
+}
+
+// keepAliveStream serves an HTTPAware stream request by request, so that
+// its backend connection can go back to the pool once the stream ends.
+// Requests are read and answered one at a time: pipelined ones wait in the
+// stream's buffer until the response before them is complete. What cannot
+// be framed (an upgrade, a head over the peek budget, not HTTP) is bridged
+// as is, and its connection closed afterwards.
+type keepAliveStream struct {
+	s      incomingStreamServer
+	stream io.ReadWriteCloser
+	rd     *bufio.Reader
+	dst    string
+	hops   int
+	quota  *streamQuota
+	trace  *streamTrace
+	lg     connLogger
+
+	// backend is the address conn reached. fb watches the stream's first
+	// connection for --backend-first-byte-timeout.
+	backend string
+	fb      *firstByteConn
+	conn    net.Conn
+	pc      *peekedConn
+	// used is set once conn carried a request: in an earlier stream, when
+	// it came from the pool, or earlier in this one.
+	used    bool
+	untrack func()
+
+	requests          int
+	bytesIn, bytesOut int64
+}
+
+// serveKeepAlive serves the stream of ka once its preface was read and
+// admitted.
+func (s incomingStreamServer) serveKeepAlive(ka *keepAliveStream) error {
+	if err := ka.acquire(); err != nil {
+		s.failDial(ka.stream, ka.rd, false, ka.dst, ka.dst, err, ka.lg)
+		return err
+	}
+	if _, err := ka.stream.Write([]byte(setupAckLine)); err != nil {
+		ka.release(false)
+		return err
+	}
+	if ka.trace.enabled() {
+		defer func() { ka.trace.firstByte = ka.fb.firstByte() }()
+	}
+	if s.inspect != nil {
+		opts := s.inspect.Load()
+		if insp := newResponseInspector(opts.decode, opts.bodyBytes, s.peekBytes, ka.lg); insp != nil {
+			defer insp.finish()
+			ka.stream = inspectedStream{ka.stream, insp}
+		}
+	}
+	defer ka.fb.watch(s.firstByteTimeout, ka.stream, support.SanitizeRemote(ka.backend), s.timeoutClose, s.timeout503, ka.lg)()
+	return ka.run()
+}
+
+// acquire takes a pooled connection for the stream's dst, or dials one.
+func (k *keepAliveStream) acquire() error {
+	if conn, backend := k.s.pooledBackend(k.dst); conn != nil {
+		k.attach(conn, backend, true)
+		return nil
+	}
+	conn, backend, err := k.s.dialTarget(k.dst, k.lg)
+	if err != nil {
+		return err
+	}
+	k.attach(conn, backend, false)
+	return nil
+}
+
+func (k *keepAliveStream) attach(conn net.Conn, backend string, pooled bool) {
+	k.conn, k.backend, k.used = conn, backend, pooled
+	untrackHops := localHops.track(conn, k.hops)
+	releaseFD := track(&processFDs.localConns)
+	k.untrack = func() {
+		untrackHops()
+		releaseFD()
+	}
+	var c net.Conn = conn
+	if k.fb == nil {
+		k.fb = newFirstByteConn(conn, time.Now())
+		c = k.fb
+	}
+	k.pc = newPeekedConn(c, peekBudget(k.s.peekBytes))
+}
+
+// release returns the stream's connection to the pool when reusable is set
+// and the backend sent nothing beyond its last response, else closes it.
+func (k *keepAliveStream) release(reusable bool) {
+	if k.conn == nil {
+		return
+	}
+	k.untrack()
+	if reusable && k.pc.rd.Buffered() == 0 {
+		k.s.keepAlive.put(k.backend, k.conn)
+	} else {
+		_ = k.conn.Close()
+	}
+	k.conn, k.pc = nil, nil
+}
+
+func (k *keepAliveStream) toBackend() io.Writer {
+	return quotaWriter{countingWriter{throttledWriter{k.conn, &processLimits.down}, &processTraffic.down}, k.quota, false}
+}
+
+func (k *keepAliveStream) toStream() io.Writer {
+	return quotaWriter{countingWriter{throttledWriter{blockedWriter{k.stream, &processStalls}, &processLimits.up}, &processTraffic.up}, k.quota, true}
+}
+
+// run serves the stream's requests until it ends. The caller acquired the
+// first connection and acknowledged the stream.
+func (k *keepAliveStream) run() error {
+	for {
+		if _, err := k.rd.Peek(1); err != nil {
+			if errors.Is(err, io.EOF) {
+				// The stream ended at a request boundary.
+				closeWriteOrClose(k.stream)
+				k.release(true)
+				return nil
+			}
+			k.release(false)
+			return err
+		}
+		head, err := peekHTTPRequestHead(k.rd)
+		if head == nil {
+			class := config.TrafficClassOpaque
+			if errors.Is(err, errHTTPHeadTooLarge) {
+				k.lg.Printf("request head exceeds the %d-byte peek budget (--http-peek-bytes), forwarding the rest of the stream on a connection of its own", k.rd.Size())
+				class = config.TrafficClassOther
+			}
+			return k.counted(class, k.bridgeRest)
+		}
+		req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(head)))
+		if err != nil {
+			return k.counted(config.TrafficClassOpaque, k.bridgeRest)
+		}
+		if req.Method == http.MethodConnect || req.Header.Get("Upgrade") != "" {
+			return k.counted(k.s.classify(req), k.bridgeRest)
+		}
+		if k.conn == nil {
+			if err := k.acquire(); err != nil {
+				k.s.failDial(k.stream, k.rd, true, k.dst, k.dst, err, k.lg)
+				return err
+			}
+		}
+		var next bool
+		err = k.counted(k.s.classify(req), func() (err error) {
+			next, err = k.exchange(head, req)
+			return err
+		})
+		if err != nil || !next {
+			return err
+		}
+	}
+}
+
+// counted runs serve, which forwards one request or the rest of the stream,
+// and books what it moved under class with --classify.
+func (k *keepAliveStream) counted(class string, serve func() error) error {
+	if k.s.classes == nil {
+		return serve()
+	}
+	if k.trace != nil && k.trace.class == "" {
+		k.trace.class = class
+	}
+	begin, before := time.Now(), k.bytesIn+k.bytesOut
+	err := serve()
+	processClasses.record(class, k.bytesIn+k.bytesOut-before, time.Since(begin))
+	return err
+}
+
+// exchange forwards the request whose head is at rd, and its response. It
+// reports whether the stream goes on with its next request.
+func (k *keepAliveStream) exchange(head []byte, req *http.Request) (next bool, err error) {
+	out := append([]byte(nil), head...)
+	if _, err := k.rd.Discard(len(head)); err != nil {
+		k.release(false)
+		return false, err
+	}
+	if k.requests == 0 && k.trace.enabled() {
+		out = traceHTTPRequestHead(out, k.trace)
+	}
+	k.requests++
+	chunked := isChunked(req.TransferEncoding)
+	for {
+		next, err = k.roundTrip(out, req, chunked)
+		if !errors.Is(err, errStaleBackend) {
+			return next, err
+		}
+		k.release(false)
+		if chunked || req.ContentLength > 0 {
+			// Part of the body may be gone with the connection.
+			return false, err
+		}
+		k.lg.Printf("pooled connection to %s was closed by the backend, retrying on a new one", support.SanitizeRemote(k.backend))
+		conn, backend, dialErr := k.s.dialTarget(k.dst, k.lg)
+		if dialErr != nil {
+			// The request was sent on the stale connection already.
+			k.s.failDial(k.stream, nil, true, k.dst, k.dst, dialErr, k.lg)
+			return false, dialErr
+		}
+		k.attach(conn, backend, false)
+	}
+}
+
+// roundTrip writes the request head and body to the backend and copies the
+// response back. The body is written while the response is read, since a
+// backend may answer before it read the body (100-continue, or an early
+// error).
+func (k *keepAliveStream) roundTrip(head []byte, req *http.Request, chunked bool) (next bool, err error) {
+	toBackend := k.toBackend()
+	n, err := toBackend.Write(head)
+	k.bytesIn += int64(n)
+	if err != nil {
+		return false, k.failed(err, true)
+	}
+	bodyDone := make(chan copyResult, 1)
+	if chunked || req.ContentLength > 0 {
+		go func() {
+			defer track(&processServe.goroutines)()
+			defer support.RecoverAs(func(p *support.PanicError) { bodyDone <- copyResult{err: p} })
+			n, err := copyHTTPBody(toBackend, k.rd, chunked, req.ContentLength)
+			bodyDone <- copyResult{n: n, err: err}
+		}()
+	} else {
+		bodyDone <- copyResult{}
+	}
+
+	for first := true; ; first = false {
+		if _, err := k.pc.rd.Peek(1); err != nil {
+			k.awaitBody(bodyDone, true)
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return false, k.failed(fmt.Errorf("backend response: %w", err), first)
+		}
+		respHead, _ := peekHTTPHead(k.pc.rd, isHTTPResponseStart)
+		if respHead == nil {
+			// Not a response this loop can frame: pass the rest through.
+			if !k.awaitBody(bodyDone, false) {
+				return false, nil
+			}
+			return false, k.bridgeRest()
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(respHead)), req)
+		if err != nil {
+			if !k.awaitBody(bodyDone, false) {
+				return false, nil
+			}
+			return false, k.bridgeRest()
+		}
+		n, err := k.toStream().Write(respHead)
+		k.bytesOut += int64(n)
+		if err != nil {
+			k.awaitBody(bodyDone, true)
+			k.release(false)
+			return false, err
+		}
+		if _, err := k.pc.rd.Discard(len(respHead)); err != nil {
+			k.awaitBody(bodyDone, true)
+			k.release(false)
+			return false, err
+		}
+		switch {
+		case resp.StatusCode == http.StatusSwitchingProtocols:
+			if !k.awaitBody(bodyDone, false) {
+				return false, nil
+			}
+			return false, k.bridgeRest()
+		case resp.StatusCode < 200:
+			// An interim response (100 Continue); the final one follows.
+			continue
+		}
+		noBody := responseHasNoBody(req, resp)
+		closeDelimited := !noBody && !isChunked(resp.TransferEncoding) && resp.ContentLength < 0
+		if !noBody {
+			n, err := copyHTTPBody(k.toStream(), k.pc.rd, isChunked(resp.TransferEncoding), resp.ContentLength)
+			k.bytesOut += n
+			if err != nil {
+				k.awaitBody(bodyDone, true)
+				k.release(false)
+				return false, err
+			}
+		}
+		if !k.awaitBody(bodyDone, false) {
+			return false, nil
+		}
+		keep := !req.Close && !resp.Close && !closeDelimited
+		if closeDelimited {
+			// The backend's EOF ended the body; pass it on.
+			closeWriteOrClose(k.stream)
+		}
+		if keep {
+			k.used = true
+		} else {
+			k.release(false)
+		}
+		return !closeDelimited, nil
+	}
+}
+
+// failed releases the connection after a failed exchange. One that carried
+// requests before and failed before the backend sent a byte was closed by
+// the backend while idle, which exchange retries.
+func (k *keepAliveStream) failed(err error, beforeResponse bool) error {
+	if k.used && beforeResponse && k.pc != nil && k.pc.rd.Buffered() == 0 {
+		k.release(false)
+		return fmt.Errorf("%w: %w", errStaleBackend, err)
+	}
+	k.release(false)
+	return err
+}
+
+// awaitBody waits for the request body copy once the response is complete.
+// With force the connection is being given up anyway: it is closed so that
+// the copy ends. It reports false when the body could not be sent, in
+// which case the stream is closed as well.
+func (k *keepAliveStream) awaitBody(bodyDone <-chan copyResult, force bool) bool {
+	if force && k.conn != nil {
+		_ = k.conn.Close()
+	}
+	timer := time.NewTimer(requestBodyGrace)
+	defer timer.Stop()
+	var r copyResult
+	select {
+	case r = <-bodyDone:
+	case <-timer.C:
+		k.lg.Printf("backend %s answered before it read the whole request body, closing the stream", support.SanitizeRemote(k.backend))
+		_ = k.stream.Close()
+		if k.conn != nil {
+			_ = k.conn.Close()
+		}
+		r = <-bodyDone
+		r.err = errors.New("backend answered before the request body was sent")
+	}
+	k.bytesIn += r.n
+	if r.err != nil && !force {
+		_ = k.stream.Close()
+		k.release(false)
+		return false
+	}
+	return r.err == nil
+}
+
+// bridgeRest forwards the rest of the stream as is on the stream's
+// connection, which is closed afterwards.
+func (k *keepAliveStream) bridgeRest() error {
+	if k.conn == nil {
+		if err := k.acquire(); err != nil {
+			failSetup(k.stream, true, err)
+			return err
+		}
+	}
+	defer k.release(false)
+	in, out, err := bridgeStreamAndBackendCounted(k.stream, k.rd, k.pc, k.quota)
+	k.bytesIn += in
+	k.bytesOut += out
+	return err
+}
+
+type copyResult struct {
+	n   int64
+	err error
+}
+
+func isChunked(te []string) bool {
+	return len(te) > 0 && te[len(te)-1] == "chunked"
+}
+
+// responseHasNoBody reports whether resp ends with its head: the answer to a
+// HEAD request, a 1xx, 204 or 304.
+func responseHasNoBody(req *http.Request, resp *http.Response) bool {
+	return req.Method == http.MethodHead || resp.StatusCode < 200 ||
+		resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified
+}
+
+// copyHTTPBody copies one HTTP/1.x message body from src to dst as it is
+// on the wire: length bytes, a chunked body through its trailer, or with a
+// negative length everything up to EOF.
+func copyHTTPBody(dst io.Writer, src *bufio.Reader, chunked bool, length int64) (int64, error) {
+	switch {
+	case chunked:
+		return copyChunkedBody(dst, src)
+	case length < 0:
+		return io.Copy(dst, src)
+	default:
+		n, err := io.CopyN(dst, src, length)
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return n, err
+	}
+}
+
+// copyChunkedBody copies a chunked body, its chunk-size lines and trailer
+// included. Lines must fit into src's buffer.
+func copyChunkedBody(dst io.Writer, src *bufio.Reader) (int64, error) {
+	var written int64
+	trailer := false
+	for {
+		line, err := src.ReadSlice('\n')
+		switch {
+		case errors.Is(err, bufio.ErrBufferFull):
+			return written, errMalformedChunk
+		case errors.Is(err, io.EOF):
+			return written, io.ErrUnexpectedEOF
+		case err != nil:
+			return written, err
+		}
+		n, err := dst.Write(line)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+		if trailer {
+			if len(bytes.TrimRight(line, "\r\n")) == 0 {
+				return written, nil
+			}
+			continue
+		}
+		field, _, _ := strings.Cut(strings.TrimSpace(string(line)), ";")
+		size, err := strconv.ParseInt(strings.TrimSpace(field), 16, 64)
+		if err != nil || size < 0 {
+			return written, errMalformedChunk
+		}
+		if size == 0 {
+			trailer = true
+			continue
+		}
+		// The chunk and its CRLF.
+		m, err := io.CopyN(dst, src, size+2)
+		written += m
+		if errors.Is(err, io.EOF) {
+			return written, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
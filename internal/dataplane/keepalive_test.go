@@ -0,0 +1,317 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+)
+
+// countingDialer dials directly and counts the dials.
+type countingDialer struct{ dials atomic.Int64 }
+
+func (d *countingDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	d.dials.Add(1)
+	var nd net.Dialer
+	return nd.DialContext(ctx, network, addr)
+}
+
+// serveKeepAlive serves incoming streams of an http tunnel with a backend
+// pool of size (none for 0) and returns the server end of the session.
+func serveKeepAlive(t *testing.T, size int) (*memSession, *incomingStreamServer, *countingDialer) {
+	t.Helper()
+	d := &countingDialer{}
+	s := incomingStreamServer{
+		tunnelID:  "t1",
+		httpAware: true,
+		dialer:    d,
+		keepAlive: newKeepAlivePool(config.RuntimeSettings{HTTPAware: true, BackendPoolSize: size, BackendPoolIdle: time.Minute}),
+	}
+	client, server := newMemSessionPair()
+	t.Cleanup(func() {
+		client.Close()
+		s.keepAlive.closeIdle()
+	})
+	go acceptIncomingStreams(client, s, make(chan struct{}))
+	return server, &s, d
+}
+
+// keepAliveBackend answers /echo with the request body, /chunked with a
+// chunked body and anything else with "ok".
+func keepAliveBackend(t *testing.T) string {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/echo":
+			body, _ := io.ReadAll(r.Body)
+			_, _ = w.Write(body)
+		case "/chunked":
+			for _, part := range []string{"ab", "cd", "ef"} {
+				_, _ = io.WriteString(w, part)
+				w.(http.Flusher).Flush()
+			}
+		default:
+			_, _ = io.WriteString(w, "ok")
+		}
+	}))
+	t.Cleanup(backend.Close)
+	return backend.Listener.Addr().String()
+}
+
+// rawBackend runs handle for every connection accepted on a new listener.
+func rawBackend(t *testing.T, handle func(c net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	var wg sync.WaitGroup
+	accepting := make(chan struct{})
+	t.Cleanup(func() {
+		ln.Close()
+		<-accepting
+		wg.Wait()
+	})
+	go func() {
+		defer close(accepting)
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer c.Close()
+				handle(c)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// exchangeRequests sends raw requests on a new stream to dst and returns the
+// bodies of the responses, reading one per method. The stream is closed.
+func exchangeRequests(t *testing.T, server *memSession, dst, raw string, methods ...string) []string {
+	t.Helper()
+	st, rd, line := openIncoming(t, server, dst)
+	defer st.Close()
+	require.Equal(t, setupAckLine, line)
+	_, err := io.WriteString(st, raw)
+	require.NoError(t, err)
+	var bodies []string
+	for _, m := range methods {
+		resp, err := http.ReadResponse(rd, &http.Request{Method: m})
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		bodies = append(bodies, string(body))
+	}
+	return bodies
+}
+
+func get(path string) string {
+	return "GET " + path + " HTTP/1.1\r\nHost: backend\r\n\r\n"
+}
+
+func TestKeepAlive_ReusesBackendConnectionAcrossStreams(t *testing.T) {
+	dst := keepAliveBackend(t)
+	server, s, d := serveKeepAlive(t, 4)
+
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, []string{"ok"}, exchangeRequests(t, server, dst, get("/"), http.MethodGet))
+		require.Eventually(t, func() bool { return s.keepAlive.idleCount(dst) == 1 }, 2*time.Second, 5*time.Millisecond)
+	}
+	assert.EqualValues(t, 1, d.dials.Load())
+}
+
+func TestKeepAlive_PipelinedAndChunkedTraffic(t *testing.T) {
+	dst := keepAliveBackend(t)
+	server, s, d := serveKeepAlive(t, 4)
+
+	raw := "POST /echo HTTP/1.1\r\nHost: backend\r\nContent-Length: 5\r\n\r\nhello" +
+		"POST /echo HTTP/1.1\r\nHost: backend\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nwor\r\n2;ext=1\r\nld\r\n0\r\nX-Trailer: 1\r\n\r\n" +
+		"HEAD / HTTP/1.1\r\nHost: backend\r\n\r\n" +
+		get("/chunked")
+	bodies := exchangeRequests(t, server, dst, raw, http.MethodPost, http.MethodPost, http.MethodHead, http.MethodGet)
+	assert.Equal(t, []string{"hello", "world", "", "abcdef"}, bodies)
+	require.Eventually(t, func() bool { return s.keepAlive.idleCount(dst) == 1 }, 2*time.Second, 5*time.Millisecond)
+
+	assert.Equal(t, []string{"ok"}, exchangeRequests(t, server, dst, get("/"), http.MethodGet))
+	assert.EqualValues(t, 1, d.dials.Load(), "one connection carried both streams")
+}
+
+func TestKeepAlive_ConnectionCloseIsNotReused(t *testing.T) {
+	dst := keepAliveBackend(t)
+	server, s, d := serveKeepAlive(t, 4)
+
+	raw := "GET / HTTP/1.1\r\nHost: backend\r\nConnection: close\r\n\r\n" + get("/")
+	assert.Equal(t, []string{"ok", "ok"}, exchangeRequests(t, server, dst, raw, http.MethodGet, http.MethodGet))
+	require.Eventually(t, func() bool { return s.keepAlive.idleCount(dst) == 1 }, 2*time.Second, 5*time.Millisecond)
+	assert.EqualValues(t, 2, d.dials.Load(), "the request after Connection: close dials anew")
+}
+
+// TestKeepAlive_EarlyResponseIsNotReused: a backend that answers before it
+// read the request body leaves part of it on the connection, which must not
+// carry another request.
+func TestKeepAlive_EarlyResponseIsNotReused(t *testing.T) {
+	logs := captureLog(t)
+	dst := rawBackend(t, func(c net.Conn) {
+		if _, err := http.ReadRequest(bufio.NewReader(c)); err != nil {
+			return
+		}
+		_, _ = io.WriteString(c, "HTTP/1.1 413 Request Entity Too Large\r\nContent-Length: 0\r\n\r\n")
+		// Never read the body.
+		_, _ = c.Read(make([]byte, 1))
+	})
+	server, s, d := serveKeepAlive(t, 4)
+
+	st, rd, line := openIncoming(t, server, dst)
+	defer st.Close()
+	require.Equal(t, setupAckLine, line)
+	_, err := io.WriteString(st, "POST / HTTP/1.1\r\nHost: backend\r\nContent-Length: 1000000\r\n\r\npartial")
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(rd, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	_, err = io.ReadAll(rd)
+	require.NoError(t, err, "the stream ends after the response")
+
+	assert.Zero(t, s.keepAlive.idleCount(dst))
+	assert.EqualValues(t, 1, d.dials.Load())
+	assert.Contains(t, logs.String(), "answered before it read the whole request body")
+}
+
+func TestKeepAlive_BrokenResponseDropsConnection(t *testing.T) {
+	dst := rawBackend(t, func(c net.Conn) {
+		if _, err := http.ReadRequest(bufio.NewReader(c)); err != nil {
+			return
+		}
+		_, _ = io.WriteString(c, "HTTP/1.1 200 OK\r\nContent-Length: 100\r\n\r\nshort")
+	})
+	server, _, d := serveKeepAlive(t, 4)
+
+	st, rd, line := openIncoming(t, server, dst)
+	require.Equal(t, setupAckLine, line)
+	_, err := io.WriteString(st, get("/"))
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(rd, nil)
+	require.NoError(t, err)
+	_, err = io.ReadAll(resp.Body)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	st.Close()
+
+	st, _, line = openIncoming(t, server, dst)
+	st.Close()
+	require.Equal(t, setupAckLine, line)
+	assert.EqualValues(t, 2, d.dials.Load(), "the broken connection was not pooled")
+}
+
+// TestKeepAlive_RetriesStaleConnection retries a request without body on a
+// new connection when the pooled one turns out to be closed.
+func TestKeepAlive_RetriesStaleConnection(t *testing.T) {
+	logs := captureLog(t)
+	dst := rawBackend(t, func(c net.Conn) {
+		rd := bufio.NewReader(c)
+		if _, err := http.ReadRequest(rd); err != nil {
+			return
+		}
+		_, _ = io.WriteString(c, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")
+		// Drop the connection when the next request arrives, like a
+		// backend whose keep-alive timeout just passed.
+		_, _ = rd.Peek(1)
+	})
+	server, s, d := serveKeepAlive(t, 4)
+
+	assert.Equal(t, []string{"ok"}, exchangeRequests(t, server, dst, get("/"), http.MethodGet))
+	require.Eventually(t, func() bool { return s.keepAlive.idleCount(dst) == 1 }, 2*time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"ok"}, exchangeRequests(t, server, dst, get("/"), http.MethodGet))
+	assert.EqualValues(t, 2, d.dials.Load())
+	assert.Contains(t, logs.String(), "was closed by the backend, retrying on a new one")
+}
+
+func TestKeepAlivePool_DropsConnectionsClosedWhileIdle(t *testing.T) {
+	dst := rawBackend(t, func(c net.Conn) {
+		if _, err := http.ReadRequest(bufio.NewReader(c)); err != nil {
+			return
+		}
+		_, _ = io.WriteString(c, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")
+		time.Sleep(100 * time.Millisecond)
+	})
+	server, s, _ := serveKeepAlive(t, 4)
+
+	assert.Equal(t, []string{"ok"}, exchangeRequests(t, server, dst, get("/"), http.MethodGet))
+	require.Eventually(t, func() bool { return s.keepAlive.idleCount(dst) == 1 }, 2*time.Second, 5*time.Millisecond)
+	require.Eventually(t, func() bool { return s.keepAlive.idleCount(dst) == 0 }, 2*time.Second, 5*time.Millisecond)
+	assert.Nil(t, s.keepAlive.get(dst))
+}
+
+func TestKeepAlivePool_IdleTimeoutAndSize(t *testing.T) {
+	p := newKeepAlivePool(config.RuntimeSettings{HTTPAware: true, BackendPoolSize: 1, BackendPoolIdle: 50 * time.Millisecond})
+	a1, b1 := net.Pipe()
+	defer b1.Close()
+	a2, b2 := net.Pipe()
+	defer b2.Close()
+	p.put("x:1", a1)
+	p.put("x:1", a2)
+	assert.Equal(t, 1, p.idleCount("x:1"), "the pool holds size connections per backend")
+	_, err := b2.Write([]byte("x"))
+	require.Error(t, err, "the surplus connection was closed")
+
+	require.Eventually(t, func() bool { return p.idleCount("x:1") == 0 }, 2*time.Second, 5*time.Millisecond, "idle timeout")
+	assert.Nil(t, p.get("x:1"))
+	assert.Nil(t, newKeepAlivePool(config.RuntimeSettings{BackendPoolSize: 1}), "raw tunnels have no pool")
+}
+
+// TestKeepAlive_LoadReducesDials runs the same sequential request load with
+// and without a pool and compares the backend dials.
+func TestKeepAlive_LoadReducesDials(t *testing.T) {
+	const workers, perWorker = 8, 25
+	dst := keepAliveBackend(t)
+	run := func(size int) int64 {
+		server, _, d := serveKeepAlive(t, size)
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < perWorker; i++ {
+					body := fmt.Sprintf("w%d-%d", w, i)
+					raw := fmt.Sprintf("POST /echo HTTP/1.1\r\nHost: backend\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+					got := exchangeRequests(t, server, dst, raw, http.MethodPost)
+					if !assert.Equal(t, []string{body}, got) {
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		return d.dials.Load()
+	}
+	assert.EqualValues(t, workers*perWorker, run(0), "without a pool every stream dials")
+	pooled := run(workers)
+	t.Logf("%d dials for %d streams with a pool", pooled, workers*perWorker)
+	assert.LessOrEqual(t, pooled, int64(workers*perWorker/4))
+}
+
+func TestCopyChunkedBody_RejectsMalformedFraming(t *testing.T) {
+	for _, body := range []string{"zz\r\nab\r\n", "-1\r\n", "3\r\nab"} {
+		var out strings.Builder
+		_, err := copyChunkedBody(&out, bufio.NewReader(strings.NewReader(body)))
+		assert.Error(t, err, "%q", body)
+	}
+}
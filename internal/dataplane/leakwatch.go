@@ -0,0 +1,161 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"path/filepath"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/fortunnels/client/internal/support"
+)
+
+const (
+	// leakSampleInterval is how often the leak watch samples the gauge.
+	leakSampleInterval = 30 * time.Second
+	// leakGrowthSamples consecutive samples must see the gauge grow, by
+	// leakMinGrowth goroutines in total, before the warning is logged.
+	leakGrowthSamples = 6
+	leakMinGrowth     = 64
+	// leakStackGroups is how many of the largest stack groups the warning
+	// names.
+	leakStackGroups = 3
+)
+
+// processServe counts the goroutines serving incoming streams of this
+// process.
+var processServe serveCounts
+
+type serveCounts struct {
+	// goroutines is the gauge of live serve and bridge copy goroutines.
+	goroutines atomic.Int64
+	// accepted counts the incoming streams accepted so far.
+	accepted atomic.Int64
+}
+
+// leakWatch looks for the leak signature in processServe: the gauge keeps
+// growing while streams are not accepted any faster. Steady traffic keeps
+// the gauge level; goroutines that never exit make it climb.
+type leakWatch struct {
+	counts *serveCounts
+	// stacks returns the goroutine hints of the warning. Tests replace it.
+	stacks func() string
+	logf   func(format string, args ...any)
+
+	primed       bool
+	lastGauge    int64
+	lastAccepted int64
+	lastRate     int64
+	// rising counts the consecutive growing samples; base is the gauge
+	// before the first of them.
+	rising int
+	base   int64
+	warned bool
+}
+
+// check takes one sample and logs the warning when the signature has held
+// for leakGrowthSamples samples. It is repeated only after the gauge fell
+// back to where the growth began.
+func (w *leakWatch) check() {
+	gauge, accepted := w.counts.goroutines.Load(), w.counts.accepted.Load()
+	rate := accepted - w.lastAccepted
+	grew := w.primed && gauge > w.lastGauge && rate <= w.lastRate
+	switch {
+	case grew && w.rising == 0:
+		w.rising, w.base = 1, w.lastGauge
+	case grew:
+		w.rising++
+	default:
+		w.rising = 0
+	}
+	if w.warned && gauge <= w.base {
+		w.warned = false
+	}
+	if w.rising >= leakGrowthSamples && gauge-w.base >= leakMinGrowth && !w.warned {
+		w.warned = true
+		w.logf("[WARN] %d goroutines serve incoming streams, up %d in %s while no more streams were accepted (%d in the last %s): likely a leak; largest stacks: %s",
+			gauge, gauge-w.base, time.Duration(w.rising)*leakSampleInterval, rate, leakSampleInterval, w.stacks())
+	}
+	w.primed, w.lastGauge, w.lastAccepted, w.lastRate = true, gauge, accepted, rate
+}
+
+func (w *leakWatch) run(stop <-chan struct{}) {
+	t := time.NewTicker(leakSampleInterval)
+	defer t.Stop()
+	for {
+		w.check()
+		select {
+		case <-t.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// StartLeakWatch watches the goroutines serving incoming streams and returns
+// the function that stops it.
+func StartLeakWatch() (stop func()) {
+	done := make(chan struct{})
+	w := &leakWatch{counts: &processServe, stacks: goroutineStacks, logf: log.Printf}
+	support.Go(support.PanicScope{Role: "leak watch"}, func() { w.run(done) })
+	return func() { close(done) }
+}
+
+// goroutineStacks returns the stack hints of the process's goroutines.
+func goroutineStacks() string {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		return "unavailable"
+	}
+	return stackHints(buf.String(), leakStackGroups)
+}
+
+// stackHints names the n largest groups of a goroutine profile (debug=1)
+// by their innermost frame in this module, e.g. "120x
+// dataplane.bridgeStreamAndBackend.func1 (tcp.go:430)". Groups without
+// such a frame are runtime or library goroutines and are skipped.
+func stackHints(profile string, n int) string {
+	type group struct {
+		count int
+		frame string
+	}
+	var groups []group
+	for _, block := range strings.Split(profile, "\n\n") {
+		lines := strings.Split(strings.TrimSpace(block), "\n")
+		countField, _, ok := strings.Cut(lines[0], " @ ")
+		if !ok {
+			continue
+		}
+		count, err := strconv.Atoi(countField)
+		if err != nil {
+			continue
+		}
+		for _, line := range lines[1:] {
+			// "#\t0x4a1b2c\tgithub.com/fortunnels/client/internal/dataplane.f+0x2c\t/src/tcp.go:430"
+			fields := strings.Split(line, "\t")
+			if len(fields) < 4 || !strings.Contains(fields[2], "fortunnels/client/") {
+				continue
+			}
+			fn, _, _ := strings.Cut(fields[2], "+")
+			groups = append(groups, group{count, fmt.Sprintf("%s (%s)", filepath.Base(fn), filepath.Base(fields[3]))})
+			break
+		}
+	}
+	if len(groups) == 0 {
+		return "none in this module"
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].count > groups[j].count })
+	hints := make([]string, 0, n)
+	for _, g := range groups[:min(n, len(groups))] {
+		hints = append(hints, fmt.Sprintf("%dx %s", g.count, g.frame))
+	}
+	return strings.Join(hints, ", ")
+}
@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeakWatch_WarnsOnGrowthWithFlatAccepts(t *testing.T) {
+	var counts serveCounts
+	var logs []string
+	w := &leakWatch{
+		counts: &counts,
+		stacks: func() string { return "120x dataplane.f (tcp.go:1)" },
+		logf:   func(format string, args ...any) { logs = append(logs, fmt.Sprintf(format, args...)) },
+	}
+	sample := func(gauge, accepted int64) {
+		counts.goroutines.Store(gauge)
+		counts.accepted.Store(accepted)
+		w.check()
+	}
+
+	// Steady traffic: streams come and go, the gauge stays level.
+	for i := int64(1); i <= 10; i++ {
+		sample(30, i*100)
+	}
+	assert.Empty(t, logs)
+
+	// Rising traffic explains a rising gauge.
+	accepted := int64(1000)
+	for i := int64(1); i <= leakGrowthSamples+2; i++ {
+		accepted += 100 * i
+		sample(30+i*20, accepted)
+	}
+	assert.Empty(t, logs)
+	sample(30, accepted+100)
+
+	// Flat accept rate with a climbing gauge is the leak signature.
+	accepted += 100
+	for i := int64(1); i <= leakGrowthSamples; i++ {
+		accepted += 100
+		sample(30+i*20, accepted)
+	}
+	require.Len(t, logs, 1)
+	assert.Contains(t, logs[0], "[WARN] 150 goroutines serve incoming streams, up 120 in 3m0s")
+	assert.Contains(t, logs[0], "largest stacks: 120x dataplane.f (tcp.go:1)")
+
+	// No repeat while the leak persists, again once it drained and recurred.
+	for i := int64(1); i <= leakGrowthSamples; i++ {
+		accepted += 100
+		sample(150+i*20, accepted)
+	}
+	assert.Len(t, logs, 1)
+	sample(20, accepted+100)
+	accepted += 100
+	for i := int64(1); i <= leakGrowthSamples; i++ {
+		accepted += 100
+		sample(20+i*20, accepted)
+	}
+	assert.Len(t, logs, 2)
+}
+
+func TestLeakWatch_IgnoresSmallGrowth(t *testing.T) {
+	var counts serveCounts
+	var logs []string
+	w := &leakWatch{counts: &counts, stacks: func() string { return "" }, logf: func(format string, args ...any) { logs = append(logs, format) }}
+	for i := int64(0); i <= 3*leakGrowthSamples; i++ {
+		counts.goroutines.Store(10 + i)
+		w.check()
+	}
+	assert.Empty(t, logs, "growth below leakMinGrowth is noise")
+}
+
+func TestStackHints(t *testing.T) {
+	profile := `goroutine profile: total 128
+
+120 @ 0x43e0ce 0x4a1b2c
+#	0x43e0cd	runtime.gopark+0xcd							/usr/local/go/src/runtime/proc.go:402
+#	0x4a1b2b	github.com/fortunnels/client/internal/dataplane.bridgeStreamAndBackendStall.func2+0x8b	/src/internal/dataplane/tcp.go:452
+#	0x4a1c00	io.Copy+0x20								/usr/local/go/src/io/io.go:388
+
+5 @ 0x43e0ce
+#	0x43e0cd	runtime.gopark+0xcd	/usr/local/go/src/runtime/proc.go:402
+
+3 @ 0x43e0ce 0x4b0000
+#	0x4b0000	github.com/fortunnels/client/internal/dataplane.(*Manager).EnsureSession+0x40	/src/internal/dataplane/session.go:210
+`
+	assert.Equal(t, "120x dataplane.bridgeStreamAndBackendStall.func2 (tcp.go:452), 3x dataplane.(*Manager).EnsureSession (session.go:210)", stackHints(profile, 3))
+	assert.Equal(t, "120x dataplane.bridgeStreamAndBackendStall.func2 (tcp.go:452)", stackHints(profile, 1))
+	assert.Equal(t, "none in this module", stackHints("goroutine profile: total 0\n", 3))
+}
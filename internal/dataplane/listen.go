@@ -0,0 +1,200 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/support"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+// StartDataPlaneListen accepts local TCP connections on listenAddr and
+// forwards each one over a client-opened smux stream to the server-side dst.
+// With runtime.DstCommand set, dst is picked per connection (see dstResolver).
+func StartDataPlaneListen(serverURL, tunnelID, dst, listenAddr string, runtime config.RuntimeSettings, enc config.EncryptionSettings, dpAuthToken string) error {
+	mgr := NewTunnelManager(serverURL, tunnelID, dpAuthToken, runtime)
+	defer mgr.Close()
+	return ServeListen(mgr, dst, listenAddr, enc)
+}
+
+// ServeListen is StartDataPlaneListen on the sessions of mgr, which may
+// serve incoming streams at the same time (http tunnels with --listen).
+func ServeListen(mgr *Manager, dst, listenAddr string, enc config.EncryptionSettings) error {
+	scope := support.PanicScope{Role: "listen loop", TunnelID: mgr.tunnelID}
+	return support.Supervise(scope, mgr.Done(), func() error {
+		return serveListen(mgr, dst, listenAddr, enc)
+	})
+}
+
+// serveListen is ServeListen without the supervision.
+func serveListen(mgr *Manager, dst, listenAddr string, enc config.EncryptionSettings) error {
+	ln, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return fmt.Errorf("listen tcp: %w", support.ExplainBindError(listenAddr, err))
+	}
+	defer ln.Close()
+	// Closing mgr, e.g. when a guest tunnel expires, stops accepting.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-mgr.Done():
+			ln.Close()
+		case <-stop:
+		}
+	}()
+	err = serveListener(ln, mgr, newListenForwarder(mgr.tunnelID, dst, mgr.settings, enc))
+	if mgr.isStopped() {
+		return nil
+	}
+	return err
+}
+
+// listenForwarder carries one accepted local connection to the server.
+type listenForwarder struct {
+	tunnelID   string
+	instanceID string
+	enc        config.EncryptionSettings
+	resolver   dstResolver
+	// sendHops declares the hop count in the preface; servers without the
+	// hops feature do not relay it.
+	sendHops bool
+	// priority is the --listen-priority hint of the forwarded streams.
+	priority string
+	// sendPeerInfo names the local peer and listener in the preface
+	// (--send-peer-info); off by default so the addresses of a LAN the
+	// client fronts stay private.
+	sendPeerInfo bool
+	// quota holds the byte limits of the forwarded connections; nil is
+	// unlimited.
+	quota *byteQuota
+}
+
+func newListenForwarder(tunnelID, dst string, runtime config.RuntimeSettings, enc config.EncryptionSettings) listenForwarder {
+	if runtime.SNIDefault != "" {
+		dst = runtime.SNIDefault
+	}
+	return listenForwarder{
+		tunnelID:     tunnelID,
+		instanceID:   runtime.InstanceID,
+		enc:          enc,
+		sendHops:     runtime.Capabilities.Has(protocolv1.FeatureHops),
+		priority:     runtime.ListenPriority,
+		sendPeerInfo: runtime.SendPeerInfo,
+		resolver: dstResolver{
+			fallback:  dst,
+			command:   runtime.DstCommand,
+			timeout:   runtime.DstCommandTimeout,
+			peekMax:   dstCommandPeekBytes,
+			sniRoutes: runtime.SNIRoutes,
+		},
+		quota: &processQuota,
+	}
+}
+
+// refusedAcceptFormat logs connections closed at once near the fd limit.
+const refusedAcceptFormat = "[WARN] listen: closed connection from %s: %v"
+
+// serveListener forwards the connections accepted on ln. Each one waits for
+// a stream slot of mgr's budget, shared fairly with its other listeners.
+// Near the process's descriptor limit, or once the tunnel moved its
+// --max-bytes-total, connections are closed as soon as they are accepted.
+func serveListener(ln net.Listener, mgr *Manager, fwd listenForwarder) error {
+	defer track(&processFDs.sockets)()
+	slot := mgr.streams.register(ln.Addr().String(), 1)
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return fmt.Errorf("accept: %w", err)
+		}
+		if err := admitListen(fwd); err != nil {
+			support.RepeatLogs.Printf(support.LogKey(refusedAcceptFormat), refusedAcceptFormat, c.RemoteAddr(), err)
+			c.Close()
+			continue
+		}
+		release := track(&processFDs.localConns)
+		go func() {
+			lg := newConnLogger()
+			defer support.Recover(support.PanicScope{Role: "listen connection", TunnelID: fwd.tunnelID, ConnID: lg.id})
+			defer release()
+			if !mgr.streams.acquire(slot, mgr.Done()) {
+				c.Close()
+				return
+			}
+			defer mgr.streams.release(slot)
+			if err := fwd.forward(c, mgr, lg); err != nil && !support.IsBenignCopyError(err) {
+				lg.Printf("listen connection error: %v", err)
+			}
+		}()
+	}
+}
+
+// admitListen returns why a new connection is refused, if it is.
+func admitListen(fwd listenForwarder) error {
+	if err := processFDs.admit(); err != nil {
+		return err
+	}
+	return fwd.quota.admit()
+}
+
+// forward tunnels one accepted connection over a new stream of mgr.
+func (f listenForwarder) forward(c net.Conn, mgr *Manager, lg connLogger) (err error) {
+	defer c.Close()
+	trace := newStreamTrace(f.tunnelID)
+	trace.connID = lg.id
+	trace.role = roleListen
+	var in, out int64
+	if trace.enabled() {
+		defer func() { trace.finish(in, out, err) }()
+	}
+	// A connection this process dialed for an incoming stream is coming
+	// back in: it is one hop further down a possible loop.
+	hops := 0
+	if h, ok := localHops.lookup(c.RemoteAddr()); ok {
+		hops = h + 1
+	}
+	conn, dst := f.resolver.resolve(c, lg)
+	trace.dst = dst
+	if err := checkHops(hops, dst); err != nil {
+		return err
+	}
+	fields := map[string]string{"dst": dst, "proto": "tcp", "tunnel_id": f.tunnelID}
+	if hops > 0 && f.sendHops {
+		fields[protocolv1.PrefaceHops] = strconv.Itoa(hops)
+	}
+	meta := prefaceMeta{instanceID: f.instanceID}
+	if f.sendPeerInfo {
+		meta.src, meta.listen = c.RemoteAddr(), c.LocalAddr()
+	}
+	// Encoded first: a preface the server could not read opens no stream.
+	preface, err := clientPreface(encryptionPreface(fields, f.enc), meta)
+	if err != nil {
+		return err
+	}
+	stream, err := mgr.OpenStream()
+	if err != nil {
+		return fmt.Errorf("open stream: %w", err)
+	}
+	defer stream.Close()
+	defer track(&processFDs.streams)()
+	processTraffic.streams.Add(1)
+	if _, err := stream.Write(preface); err != nil {
+		return fmt.Errorf("write preface: %w", err)
+	}
+	lg.Printf("listen connection from %s to %s", remoteAddrString(c), dst)
+	timed := processLatency.firstByte(f.tunnelID, stream)
+	wrapped := newPrioritizedStream(wrapAccountedStream(timed, f.tunnelID, f.enc), mgr.priority, f.priority)
+	defer wrapped.done()
+	quota := f.quota.newStream()
+	defer quota.release()
+	begin := time.Now()
+	out, in = pipeStreams(conn, wrapped, quota, lg)
+	lg.Printf("listen connection to %s closed in=%d out=%d duration=%s", dst, in, out, time.Since(begin).Round(time.Millisecond))
+	return nil
+}
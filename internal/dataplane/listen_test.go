@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/testsupport"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+func decodePreface(t *testing.T, b []byte) map[string]string {
+	t.Helper()
+	require.True(t, strings.HasSuffix(string(b), "\n"))
+	var pre map[string]string
+	require.NoError(t, json.Unmarshal(b, &pre))
+	return pre
+}
+
+func TestClientPreface_Meta(t *testing.T) {
+	b, err := clientPreface(map[string]string{"dst": "db:5432"}, prefaceMeta{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"dst": "db:5432"}, decodePreface(t, b), "nothing set, nothing added")
+
+	b, err = clientPreface(map[string]string{"dst": "db:5432"}, prefaceMeta{
+		instanceID: "inst",
+		src:        &net.TCPAddr{IP: net.ParseIP("fe80::1"), Port: 51234, Zone: "eth0"},
+		listen:     &net.TCPAddr{IP: net.IPv6unspecified, Port: 2222},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"dst":                            "db:5432",
+		protocolv1.PrefaceClientInstance: "inst",
+		protocolv1.PrefaceSrc:            "[fe80::1%eth0]:51234",
+		protocolv1.PrefaceListen:         "[::]:2222",
+	}, decodePreface(t, b))
+
+	_, err = clientPreface(map[string]string{"dst": strings.Repeat("x", maxPrefaceSize)}, prefaceMeta{})
+	require.ErrorContains(t, err, "exceeds")
+}
+
+func TestEncodePreface_RejectsInvalidFields(t *testing.T) {
+	long := strings.Repeat("x", maxPrefaceValue)
+	tests := []struct {
+		name   string
+		fields map[string]string
+		err    string
+	}{
+		{"newline in dst", map[string]string{"dst": "db:5432\n{\"dst\":\"evil:22\"}"}, `preface field "dst": value contains control character U+000A`},
+		{"control character", map[string]string{"dst": "db:5432", "auth": "tok\x00en"}, `preface field "auth": value contains control character U+0000`},
+		{"control character in name", map[string]string{"a\tb": "x"}, `preface field "a\tb": name contains control character U+0009`},
+		{"invalid UTF-8", map[string]string{"tunnel_id": "t\xff1"}, `preface field "tunnel_id": value is not valid UTF-8`},
+		{"oversized value", map[string]string{"auth": long + "x"}, `preface field "auth": value of 1025 bytes exceeds the 1024 byte limit`},
+		{"oversized name", map[string]string{long + "x": "v"}, `name of 1025 bytes exceeds the 1024 byte limit`},
+		{"empty name", map[string]string{"": "v"}, "preface field with an empty name"},
+		{"dst without port", map[string]string{"dst": "db"}, `preface field "dst": "db" is not host:port`},
+		{"dst with empty port", map[string]string{"dst": "db:"}, `preface field "dst": "db:" is not host:port`},
+		{"total size", map[string]string{"a": long, "b": long, "c": long, "d": long}, "exceeds the 4096 byte limit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := encodePreface(tt.fields)
+			require.ErrorContains(t, err, tt.err)
+			assert.Nil(t, b)
+		})
+	}
+
+	b, err := encodePreface(map[string]string{"dst": "[fe80::1%eth0]:22", "proto": "tcp", "note": "ünïcode"})
+	require.NoError(t, err)
+	assert.Equal(t, "ünïcode", decodePreface(t, b)["note"])
+	_, err = encodePreface(map[string]string{"dst": "", "proto": "control"})
+	require.NoError(t, err, "an empty dst is left to the server")
+}
+
+// TestListenForward_InvalidDstOpensNoStream checks that a dst the preface
+// refuses ends the local connection before a stream is opened.
+func TestListenForward_InvalidDstOpensNoStream(t *testing.T) {
+	mgr, d := newMemManager(t)
+	defer mgr.Close()
+	c, peer := net.Pipe()
+	defer peer.Close()
+	fwd := newListenForwarder("t1", "db", config.RuntimeSettings{}, config.EncryptionSettings{})
+
+	err := fwd.forward(c, mgr, newConnLogger())
+	require.EqualError(t, err, `preface field "dst": "db" is not host:port`)
+	assert.Zero(t, d.dialCount(), "no session was needed")
+}
+
+// TestE2E_ListenPeerInfo checks the listen-mode preface the server receives,
+// with and without --send-peer-info.
+func TestE2E_ListenPeerInfo(t *testing.T) {
+	tests := []struct {
+		name     string
+		network  string
+		addr     string
+		peerInfo bool
+	}{
+		{"default redacts", "tcp4", "127.0.0.1:0", false},
+		{"ipv4", "tcp4", "127.0.0.1:0", true},
+		{"ipv6", "tcp6", "[::1]:0", true},
+		{"ipv6 default redacts", "tcp6", "[::1]:0", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			captureLog(t)
+			ln, err := net.Listen(tt.network, tt.addr)
+			if err != nil {
+				t.Skipf("no %s loopback: %v", tt.network, err)
+			}
+			defer ln.Close()
+			stub := testsupport.NewServer(testsupport.Options{})
+			defer stub.Close()
+			tun := stub.AddTunnel("tcp", "127.0.0.1:0")
+			rt := e2eRuntime()
+			rt.SendPeerInfo = tt.peerInfo
+			mgr := NewManager(stub.URL, tun.ID, "", 10*time.Millisecond, 50*time.Millisecond, rt)
+			defer mgr.Close()
+			go func() {
+				_ = serveListener(ln, mgr, newListenForwarder(tun.ID, testsupport.EchoDst, rt, config.EncryptionSettings{}))
+			}()
+
+			c, err := net.Dial(tt.network, ln.Addr().String())
+			require.NoError(t, err)
+			defer c.Close()
+			_, err = c.Write([]byte("ping"))
+			require.NoError(t, err)
+			got := make([]byte, 4)
+			_, err = io.ReadFull(c, got)
+			require.NoError(t, err)
+
+			prefaces := stub.ClientPrefaces(tun.ID)
+			require.Len(t, prefaces, 1)
+			pre := prefaces[0]
+			assert.Equal(t, testsupport.EchoDst, pre["dst"])
+			if !tt.peerInfo {
+				assert.NotContains(t, pre, protocolv1.PrefaceSrc)
+				assert.NotContains(t, pre, protocolv1.PrefaceListen)
+				return
+			}
+			assert.Equal(t, c.LocalAddr().String(), pre[protocolv1.PrefaceSrc])
+			assert.Equal(t, ln.Addr().String(), pre[protocolv1.PrefaceListen])
+		})
+	}
+}
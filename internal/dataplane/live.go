@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import "sync"
+
+// LiveSettings are the serving settings a config reload may change while
+// streams keep running. Components read them through atomic holders, so
+// streams in flight pick up a new rate limit on their next write and new
+// streams see the new allowlist and inspect options.
+type LiveSettings struct {
+	// RateLimit caps each direction in bytes per second; 0 is unlimited.
+	RateLimit int64
+	// IncomingDstAllow replaces the dst allowlist of incoming streams.
+	IncomingDstAllow []string
+	InspectDecode    bool
+	InspectBodyBytes int
+}
+
+// liveHooks are the running serving modes' holders for LiveSettings.
+var liveHooks struct {
+	mu   sync.Mutex
+	next int
+	fns  map[int]func(LiveSettings)
+}
+
+// ApplyLiveSettings publishes s to the rate limiter and every running serving
+// mode.
+func ApplyLiveSettings(s LiveSettings) {
+	processLimits.up.setRate(s.RateLimit)
+	processLimits.down.setRate(s.RateLimit)
+	liveHooks.mu.Lock()
+	fns := make([]func(LiveSettings), 0, len(liveHooks.fns))
+	for _, fn := range liveHooks.fns {
+		fns = append(fns, fn)
+	}
+	liveHooks.mu.Unlock()
+	for _, fn := range fns {
+		fn(s)
+	}
+}
+
+// onLiveSettings registers fn for ApplyLiveSettings until cancel is called.
+func onLiveSettings(fn func(LiveSettings)) (cancel func()) {
+	liveHooks.mu.Lock()
+	defer liveHooks.mu.Unlock()
+	if liveHooks.fns == nil {
+		liveHooks.fns = make(map[int]func(LiveSettings))
+	}
+	id := liveHooks.next
+	liveHooks.next++
+	liveHooks.fns[id] = fn
+	return func() {
+		liveHooks.mu.Lock()
+		delete(liveHooks.fns, id)
+		liveHooks.mu.Unlock()
+	}
+}
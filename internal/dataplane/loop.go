@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/fortunnels/client/internal/support"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+// maxForwardingHops is how many times one connection may re-enter this
+// process (an incoming stream dialing the client's own --listen socket)
+// before it is refused as a forwarding loop.
+const maxForwardingHops = 2
+
+var errForwardingLoop = errors.New("forwarding loop detected")
+
+// localHops remembers the hop count of every backend connection dialed for an
+// incoming stream, keyed by the connection's local address. When the
+// process's own listener accepts one of them, the connection is re-entering
+// the client and the listener knows how often it already did.
+var localHops = hopTable{m: make(map[string]int)}
+
+type hopTable struct {
+	mu sync.Mutex
+	m  map[string]int
+}
+
+// track records c's hop count until the returned func is called.
+func (t *hopTable) track(c net.Conn, hops int) (untrack func()) {
+	if c == nil || c.LocalAddr() == nil {
+		return func() {}
+	}
+	key := c.LocalAddr().String()
+	t.mu.Lock()
+	t.m[key] = hops
+	t.mu.Unlock()
+	return func() {
+		t.mu.Lock()
+		delete(t.m, key)
+		t.mu.Unlock()
+	}
+}
+
+// lookup returns the hop count of the connection this process dialed from
+// remote, if it did.
+func (t *hopTable) lookup(remote net.Addr) (int, bool) {
+	if remote == nil {
+		return 0, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	hops, ok := t.m[remote.String()]
+	return hops, ok
+}
+
+// prefaceHops returns the hop count a stream preface declares; absent or
+// malformed values count as 0.
+func prefaceHops(pre map[string]string) int {
+	hops, err := strconv.Atoi(pre[protocolv1.PrefaceHops])
+	if err != nil || hops < 0 {
+		return 0
+	}
+	return hops
+}
+
+// checkHops refuses a connection that looped through this process too often.
+func checkHops(hops int, dst string) error {
+	if hops > maxForwardingHops {
+		return fmt.Errorf("%w: %s passed through this client %d times", errForwardingLoop, support.SanitizeRemote(dst), hops)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/testsupport"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+func TestPrefaceHops(t *testing.T) {
+	assert.Zero(t, prefaceHops(map[string]string{}))
+	assert.Zero(t, prefaceHops(map[string]string{protocolv1.PrefaceHops: "x"}))
+	assert.Zero(t, prefaceHops(map[string]string{protocolv1.PrefaceHops: "-3"}))
+	assert.Equal(t, 2, prefaceHops(map[string]string{protocolv1.PrefaceHops: "2"}))
+	require.NoError(t, checkHops(maxForwardingHops, "127.0.0.1:4000"))
+	require.ErrorIs(t, checkHops(maxForwardingHops+1, "127.0.0.1:4000"), errForwardingLoop)
+}
+
+func TestE2E_ServeIncoming_RefusesLoopingStream(t *testing.T) {
+	captureLog(t)
+	dialed := make(chan struct{}, 1)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		if c, err := ln.Accept(); err == nil {
+			dialed <- struct{}{}
+			c.Close()
+		}
+	}()
+
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	tun := stub.AddTunnel("tcp", ln.Addr().String())
+	mgr := NewManager(stub.URL, tun.ID, "", 10*time.Millisecond, 50*time.Millisecond, e2eRuntime())
+	defer mgr.Close()
+	go func() { _ = serveIncomingWithManager(mgr, nil) }()
+	require.NoError(t, stub.WaitSessions(tun.ID, 1, 5*time.Second))
+
+	_, err = stub.OpenStreamWithPreface(tun.ID, ln.Addr().String(), map[string]string{
+		protocolv1.PrefaceHops: strconv.Itoa(maxForwardingHops + 1),
+	})
+	require.ErrorContains(t, err, "forwarding loop detected")
+	select {
+	case <-dialed:
+		t.Fatal("backend dialed for a looping stream")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestE2E_ListenRefusesReenteringConnection points an incoming stream at the
+// client's own --listen socket: the listener counts the extra hop and refuses
+// once the limit is exceeded.
+func TestE2E_ListenRefusesReenteringConnection(t *testing.T) {
+	captureLog(t)
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+
+	rt := e2eRuntime()
+	listenTun := stub.AddTunnel("tcp", "127.0.0.1:0")
+	listenMgr := NewManager(stub.URL, listenTun.ID, "", 10*time.Millisecond, 50*time.Millisecond, rt)
+	defer listenMgr.Close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		_ = serveListener(ln, listenMgr, newListenForwarder(listenTun.ID, testsupport.EchoDst, rt, config.EncryptionSettings{}))
+	}()
+
+	exposeTun := stub.AddTunnel("tcp", ln.Addr().String())
+	exposeMgr := NewManager(stub.URL, exposeTun.ID, "", 10*time.Millisecond, 50*time.Millisecond, rt)
+	defer exposeMgr.Close()
+	go func() { _ = serveIncomingWithManager(exposeMgr, nil) }()
+	require.NoError(t, stub.WaitSessions(exposeTun.ID, 1, 5*time.Second))
+
+	// First pass through the process: forwarded with hops=1, echoed back.
+	st, err := stub.OpenStream(exposeTun.ID, ln.Addr().String())
+	require.NoError(t, err)
+	defer st.Close()
+	_, err = st.Write([]byte("ping"))
+	require.NoError(t, err)
+	got := make([]byte, 4)
+	_, err = io.ReadFull(st, got)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(got))
+
+	// The stream already looped maxForwardingHops times: the listener refuses.
+	st2, err := stub.OpenStreamWithPreface(exposeTun.ID, ln.Addr().String(), map[string]string{
+		protocolv1.PrefaceHops: strconv.Itoa(maxForwardingHops),
+	})
+	require.NoError(t, err)
+	defer st2.Close()
+	_, _ = st2.Write([]byte("ping"))
+	rest, err := io.ReadAll(st2)
+	require.NoError(t, err)
+	assert.Empty(t, rest, "the re-entering connection is closed instead of forwarded")
+}
+
+func TestNewListenForwarder_HopsFeature(t *testing.T) {
+	rt := e2eRuntime()
+	assert.True(t, newListenForwarder("t", "echo", rt, config.EncryptionSettings{}).sendHops, "baseline servers relay hops")
+	rt.Capabilities = config.NewCapabilities(&protocolv1.ServerCapabilities{Features: []string{protocolv1.FeatureKeepalive}})
+	assert.False(t, newListenForwarder("t", "echo", rt, config.EncryptionSettings{}).sendHops, "the field is left out for servers without the feature")
+}
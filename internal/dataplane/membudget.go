@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/fortunnels/client/internal/support"
+)
+
+// The buffering features of the data plane hold their buffers against
+// --memory-budget. Their ceilings set the order in which they degrade as the
+// budget fills: kept resumable responses first, then HTTP peek buffers, UDP
+// queues last.
+var (
+	resumeMemory   = support.Memory.Component("resume", "interrupted responses are not kept for --resume-get", 50)
+	peekMemory     = support.Memory.Component("http_peek", "streams get a default-size reader; heads past it skip tracing, classify and --resume-get", 75)
+	udpQueueMemory = support.Memory.Component("udp_queue", "new packets are dropped", 100)
+)
+
+const peekDeniedFormat = "[WARN] memory budget: no room for a %d-byte HTTP peek buffer (--memory-budget), serving the stream with a default-size reader"
+
+// peekReader returns the reader of a stream's preface and requests. When
+// peek is set it is sized to the peek budget if peekMemory has room for it;
+// peeked reports that it is. release returns the memory.
+func peekReader(stream io.Reader, peek bool, budget int) (rd *bufio.Reader, peeked bool, release func()) {
+	if !peek {
+		return bufio.NewReader(stream), false, func() {}
+	}
+	size := peekBudget(budget)
+	if !peekMemory.Reserve(int64(size)) {
+		support.RepeatLogs.Printf(support.LogKey(peekDeniedFormat), peekDeniedFormat, size)
+		return bufio.NewReader(stream), false, func() {}
+	}
+	return bufio.NewReaderSize(stream, size), true, func() { peekMemory.Release(int64(size)) }
+}
+
+// datagramSize weighs a queued packet for udpQueueMemory.
+func datagramSize(p []byte) int64 { return int64(cap(p)) }
+
+// udpDatagramSize is datagramSize for a packet with its peer.
+func udpDatagramSize(d udpDatagram) int64 { return int64(cap(d.data)) }
+
+// MemoryBadge returns the status line marker of a --memory-budget under
+// pressure, e.g. "⚠️ mem 97%": shown once a component had to degrade, ""
+// before or without a budget.
+func MemoryBadge() string {
+	limit := support.Memory.Limit()
+	if limit == 0 || support.Memory.Denied() == 0 {
+		return ""
+	}
+	return fmt.Sprintf("⚠️ mem %d%%", support.Memory.Used()*100/limit)
+}
@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bytes"
+	"crypto/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/support"
+)
+
+// useMemoryBudget sets --memory-budget to limit once the components hold
+// nothing, and removes it when the test ends.
+func useMemoryBudget(t *testing.T, limit int64) {
+	t.Helper()
+	require.Eventually(t, func() bool { return support.Memory.Used() == 0 }, 5*time.Second, 10*time.Millisecond, "memory left held by earlier tests")
+	support.Memory.SetLimit(limit)
+	t.Cleanup(func() { support.Memory.SetLimit(0) })
+}
+
+func TestMemoryBudget_DegradationOrder(t *testing.T) {
+	const peek = defaultHTTPPeekBytes
+	useMemoryBudget(t, 4*peek)
+	deniedBefore := map[string]int64{"resume": resumeMemory.Denied(), "http_peek": peekMemory.Denied(), "udp_queue": udpQueueMemory.Denied()}
+	var order []string
+	seen := map[string]bool{}
+	var mu sync.Mutex
+	checkBudget := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		require.LessOrEqual(t, support.Memory.Used(), support.Memory.Limit())
+		for name, c := range map[string]*support.MemoryComponent{"resume": resumeMemory, "http_peek": peekMemory, "udp_queue": udpQueueMemory} {
+			if !seen[name] && c.Denied() > deniedBefore[name] {
+				seen[name] = true
+				order = append(order, name)
+			}
+		}
+	}
+
+	// Together the features would want 1 MiB of queued packets, 8 peek
+	// buffers and 16 kept responses: far more than the budget. The queue
+	// fills the budget step by step while streams and interrupted
+	// responses keep asking for theirs.
+	q := newPacketQueue[[]byte](64, "local->tunnel").withMemory(udpQueueMemory, datagramSize)
+	resume := newResumeRegistry(config.RuntimeSettings{ResumeGET: true, HTTPAware: true})
+	var releases []func()
+	var kept int
+	for i := range 64 {
+		p := make([]byte, 16<<10)
+		_, _ = rand.Read(p)
+		q.push(p)
+		checkBudget()
+		if i%8 == 0 {
+			_, peeked, release := peekReader(bytes.NewReader(nil), true, 0)
+			releases = append(releases, release)
+			if !peeked {
+				assert.Positive(t, peekMemory.Denied()-deniedBefore["http_peek"])
+			}
+			checkBudget()
+		}
+		if i%4 == 0 {
+			if resume.keep(string(rune('a'+i)), &resumeRecord{head: make([]byte, 8<<10)}) == nil {
+				kept++
+			}
+			checkBudget()
+		}
+	}
+	assert.Equal(t, []string{"resume", "http_peek", "udp_queue"}, order)
+	assert.Positive(t, kept, "responses are kept while the budget has room")
+	assert.Positive(t, q.Dropped(), "the full budget drops packets")
+
+	for _, release := range releases {
+		release()
+	}
+	q.close()
+	for token := range resume.pending {
+		resume.take(token)
+	}
+	assert.Zero(t, support.Memory.Used(), "everything held was released")
+}
+
+func TestMemoryBudget_DeniedPeekStillServesStream(t *testing.T) {
+	useMemoryBudget(t, 4*defaultHTTPPeekBytes)
+	// UDP queues fill the budget past the peek buffers' ceiling.
+	q := newPacketQueue[[]byte](64, "local->tunnel").withMemory(udpQueueMemory, datagramSize)
+	defer q.close()
+	for range 14 {
+		q.push(make([]byte, 16<<10))
+	}
+	require.Greater(t, support.Memory.Used(), support.Memory.Limit()*3/4-defaultHTTPPeekBytes)
+	denied := peekMemory.Denied()
+
+	body := make([]byte, 256<<10)
+	dst, _, _ := stallingBackend(t, body, true)
+	s := resumeServer()
+	head, _ := interruptGET(t, s, dst, "tok-mem", 1000)
+	assert.Contains(t, head, "HTTP/1.1 200 OK\r\n", "the stream is served with a default-size reader")
+	assert.Empty(t, s.resume.pending, "its response is not kept without a peek buffer")
+	assert.Greater(t, peekMemory.Denied(), denied)
+}
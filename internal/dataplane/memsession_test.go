@@ -0,0 +1,315 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newMemSessionPair returns the two ends of an in-memory Session: client is
+// served by the code under test, server plays the data-plane server. Streams
+// opened on one end are accepted on the other.
+func newMemSessionPair() (client, server *memSession) {
+	client = &memSession{incoming: make(chan *memStream, 16), closed: make(chan struct{})}
+	server = &memSession{incoming: make(chan *memStream, 16), closed: make(chan struct{})}
+	client.peer, server.peer = server, client
+	return client, server
+}
+
+// memSession is a Session whose streams are in-memory pipes. Failures are
+// injected with failOpen and fail.
+type memSession struct {
+	peer     *memSession
+	incoming chan *memStream
+	closed   chan struct{}
+
+	mu      sync.Mutex
+	openErr error
+	streams map[*memStream]struct{}
+}
+
+// failOpen makes the next OpenStream calls fail with err; nil clears it.
+func (s *memSession) failOpen(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.openErr = err
+}
+
+// fail closes both ends like a broken transport: streams fail with err.
+func (s *memSession) fail(err error) {
+	s.closeWith(err)
+	s.peer.closeWith(err)
+}
+
+func (s *memSession) OpenStream() (Stream, error) {
+	s.mu.Lock()
+	err := s.openErr
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if s.IsClosed() {
+		return nil, io.ErrClosedPipe
+	}
+	local, remote := newMemStreamPair(s, s.peer)
+	select {
+	case s.peer.incoming <- remote:
+		return local, nil
+	case <-s.peer.closed:
+		return nil, io.ErrClosedPipe
+	case <-s.closed:
+		return nil, io.ErrClosedPipe
+	}
+}
+
+func (s *memSession) AcceptStream() (Stream, error) {
+	select {
+	case st := <-s.incoming:
+		return st, nil
+	case <-s.closed:
+		return nil, io.ErrClosedPipe
+	}
+}
+
+func (s *memSession) IsClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *memSession) Close() error {
+	s.closeWith(io.EOF)
+	return nil
+}
+
+// NumStreams reports the open streams, for draining.
+func (s *memSession) NumStreams() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.streams)
+}
+
+func (s *memSession) closeWith(err error) {
+	s.mu.Lock()
+	if s.IsClosed() {
+		s.mu.Unlock()
+		return
+	}
+	close(s.closed)
+	streams := make([]*memStream, 0, len(s.streams))
+	for st := range s.streams {
+		streams = append(streams, st)
+	}
+	s.mu.Unlock()
+	for _, st := range streams {
+		st.abort(err)
+	}
+}
+
+func (s *memSession) track(st *memStream) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.streams == nil {
+		s.streams = make(map[*memStream]struct{})
+	}
+	s.streams[st] = struct{}{}
+}
+
+func (s *memSession) untrack(st *memStream) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.streams, st)
+}
+
+// memDialer hands out client ends of memSession pairs as Manager sessions.
+// A dial fails while errs has entries left; each failure consumes one.
+type memDialer struct {
+	mu      sync.Mutex
+	errs    []error
+	dials   int
+	servers chan *memSession
+}
+
+func newMemDialer() *memDialer {
+	return &memDialer{servers: make(chan *memSession, 16)}
+}
+
+func (d *memDialer) dial(string, http.Header) (*websocket.Conn, Session, *pongWaiter, error) {
+	d.mu.Lock()
+	d.dials++
+	if len(d.errs) > 0 {
+		err := d.errs[0]
+		d.errs = d.errs[1:]
+		d.mu.Unlock()
+		return nil, nil, nil, err
+	}
+	d.mu.Unlock()
+	client, server := newMemSessionPair()
+	d.servers <- server
+	return nil, client, newPongWaiter(), nil
+}
+
+func (d *memDialer) dialCount() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.dials
+}
+
+// nextServer returns the server end of the next session dialed.
+func (d *memDialer) nextServer(timeout time.Duration) (*memSession, error) {
+	select {
+	case s := <-d.servers:
+		return s, nil
+	case <-time.After(timeout):
+		return nil, errors.New("no session was dialed")
+	}
+}
+
+// newMemStreamPair returns the two ends of a stream between sessions a and b.
+func newMemStreamPair(a, b *memSession) (*memStream, *memStream) {
+	ab, ba := newMemPipe(), newMemPipe()
+	x := &memStream{in: ba, out: ab, sess: a}
+	y := &memStream{in: ab, out: ba, sess: b}
+	x.peer, y.peer = y, x
+	a.track(x)
+	b.track(y)
+	return x, y
+}
+
+// memStream is a Stream over two memPipes, one per direction. Like an smux
+// stream, CloseWrite lets the peer read EOF while it still receives, and
+// Close ends both directions.
+type memStream struct {
+	in, out *memPipe
+	sess    *memSession
+	peer    *memStream
+}
+
+func (s *memStream) Read(p []byte) (int, error) { return s.in.read(p) }
+
+func (s *memStream) Write(p []byte) (int, error) { return s.out.write(p) }
+
+func (s *memStream) SetReadDeadline(t time.Time) error {
+	s.in.setDeadline(t)
+	return nil
+}
+
+func (s *memStream) CloseWrite() error {
+	s.out.closeWrite()
+	return nil
+}
+
+func (s *memStream) Close() error {
+	s.out.closeWrite()
+	s.in.fail(io.ErrClosedPipe)
+	s.sess.untrack(s)
+	// The peer sees EOF; once both ends closed it is gone.
+	if s.peer.in.isFailed() {
+		s.peer.sess.untrack(s.peer)
+	}
+	return nil
+}
+
+// abort fails both directions with err, as a broken session does.
+func (s *memStream) abort(err error) {
+	s.in.fail(err)
+	s.out.fail(err)
+	s.sess.untrack(s)
+}
+
+// memPipe is an unbounded in-memory byte queue with EOF, failure and read
+// deadlines.
+type memPipe struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	buf      bytes.Buffer
+	eof      bool
+	err      error
+	deadline time.Time
+}
+
+func newMemPipe() *memPipe {
+	p := &memPipe{}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+func (p *memPipe) read(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		switch {
+		case p.err != nil:
+			return 0, p.err
+		case p.buf.Len() > 0:
+			return p.buf.Read(b)
+		case p.eof:
+			return 0, io.EOF
+		case !p.deadline.IsZero() && !time.Now().Before(p.deadline):
+			return 0, os.ErrDeadlineExceeded
+		}
+		p.cond.Wait()
+	}
+}
+
+func (p *memPipe) write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case p.err != nil:
+		return 0, p.err
+	case p.eof:
+		return 0, io.ErrClosedPipe
+	}
+	p.buf.Write(b)
+	p.cond.Broadcast()
+	return len(b), nil
+}
+
+func (p *memPipe) closeWrite() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.eof = true
+	p.cond.Broadcast()
+}
+
+func (p *memPipe) fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == nil {
+		p.err = err
+	}
+	p.cond.Broadcast()
+}
+
+func (p *memPipe) isFailed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err != nil
+}
+
+func (p *memPipe) setDeadline(t time.Time) {
+	p.mu.Lock()
+	p.deadline = t
+	p.cond.Broadcast()
+	p.mu.Unlock()
+	if !t.IsZero() {
+		time.AfterFunc(time.Until(t), func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.cond.Broadcast()
+		})
+	}
+}
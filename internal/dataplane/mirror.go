@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/support"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+// LocalMirror serves an http/https tunnel's target on a local address as
+// well (--local-mirror), so that clients on the LAN skip the round trip
+// through the server. Each connection is served like an incoming stream of
+// the tunnel, with the same per-request handling: rate limits, Host
+// rewriting, logging, backend pool and fallback page.
+type LocalMirror struct {
+	ln     net.Listener
+	server incomingStreamServer
+	target string
+	stop   func()
+}
+
+// StartLocalMirror listens on addr and serves its connections to target, the
+// tunnel's target, in the background until Close.
+func StartLocalMirror(addr, tunnelID, target string, settings config.RuntimeSettings, reporter BackendStateReporter) (*LocalMirror, error) {
+	server, err := newIncomingStreamServer(tunnelID, settings, reporter)
+	if err != nil {
+		return nil, err
+	}
+	// Mirror connections do not come from the server: there is no preface
+	// to vet and nothing for the server to resume.
+	server.guard = nil
+	server.resume = nil
+	server.forwardedFor = true
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("--local-mirror: %w", support.ExplainBindError(addr, err))
+	}
+	m := &LocalMirror{ln: ln, server: server, target: target, stop: server.followLiveSettings()}
+	support.Go(support.PanicScope{Role: "local mirror accept loop", TunnelID: tunnelID}, m.serve)
+	return m, nil
+}
+
+// Addr returns the address the mirror listens on.
+func (m *LocalMirror) Addr() net.Addr {
+	return m.ln.Addr()
+}
+
+// Close stops accepting connections; the ones open are served to the end.
+func (m *LocalMirror) Close() {
+	_ = m.ln.Close()
+	m.stop()
+	m.server.keepAlive.closeIdle()
+}
+
+func (m *LocalMirror) serve() {
+	for {
+		c, err := m.ln.Accept()
+		if err != nil {
+			return
+		}
+		go m.server.serveLogged(newMirrorStream(c, m.target))
+	}
+}
+
+// mirrorStream makes a mirror connection look like an incoming stream of
+// the tunnel: reads start with a preface for target, and the setup reply to
+// it is turned into what the server would send the public client.
+type mirrorStream struct {
+	net.Conn
+	rd      io.Reader
+	replied bool
+}
+
+func newMirrorStream(c net.Conn, target string) *mirrorStream {
+	pre := map[string]string{"dst": target}
+	if host, _, err := net.SplitHostPort(c.RemoteAddr().String()); err == nil {
+		pre[protocolv1.PrefaceSrc] = host
+	}
+	b, _ := json.Marshal(pre)
+	return &mirrorStream{Conn: c, rd: io.MultiReader(strings.NewReader(string(b)+"\n"), c)}
+}
+
+func (s *mirrorStream) Read(p []byte) (int, error) {
+	return s.rd.Read(p)
+}
+
+// Write drops the setup ack, the stream's first write, and answers a setup
+// error with a 502 like the server does.
+func (s *mirrorStream) Write(p []byte) (int, error) {
+	if s.replied {
+		return s.Conn.Write(p)
+	}
+	s.replied = true
+	if string(p) != setupAckLine {
+		if _, err := io.WriteString(s.Conn, rawBackendUnavailable); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (s *mirrorStream) CloseWrite() error {
+	if tc, ok := s.Conn.(*net.TCPConn); ok {
+		return tc.CloseWrite()
+	}
+	return s.Conn.Close()
+}
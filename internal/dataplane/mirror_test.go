@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/testsupport"
+)
+
+// mirrorResult is what a request did: the response, and the request the
+// backend saw (none for a refused one).
+type mirrorResult struct {
+	status  int
+	body    string
+	retry   string
+	backend string
+}
+
+// roundTrip sends one request on a new connection to addr. The stub's
+// public endpoint relays bytes unchanged, so requests sent there carry the
+// X-Forwarded-For the server's edge would add.
+func roundTrip(t *testing.T, addr, path, forwardedFor string, seen <-chan string) mirrorResult {
+	t.Helper()
+	c, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	require.NoError(t, err)
+	defer c.Close()
+	require.NoError(t, c.SetDeadline(time.Now().Add(5*time.Second)))
+	req := "GET " + path + " HTTP/1.1\r\nHost: app.example.com\r\nConnection: close\r\n"
+	if forwardedFor != "" {
+		req += "X-Forwarded-For: " + forwardedFor + "\r\n"
+	}
+	_, err = io.WriteString(c, req+"\r\n")
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(c), nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	r := mirrorResult{status: resp.StatusCode, body: string(body), retry: resp.Header.Get("Retry-After")}
+	select {
+	case r.backend = <-seen:
+	default:
+	}
+	return r
+}
+
+// TestE2E_LocalMirror_MatchesTheTunnel sends the same requests through the
+// tunnel's public endpoint and through --local-mirror: responses, the
+// requests the backend sees and the rate limit are the same either way.
+func TestE2E_LocalMirror_MatchesTheTunnel(t *testing.T) {
+	seen := make(chan string, 16)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen <- strings.Join([]string{r.URL.Path, r.Host, r.Header.Get("X-Forwarded-Host"), r.Header.Get("X-Forwarded-For")}, " ")
+		_, _ = io.WriteString(w, "page "+r.URL.Path)
+	}))
+	defer backend.Close()
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	tun := stub.AddTunnel("http", backend.Listener.Addr().String())
+
+	rt := e2eRuntime()
+	rt.HTTPAware = true
+	rt.HostRewrite = "myapp.local"
+	rt.HostRewriteForwarded = true
+	rt.SourceRateLimit = 2
+	rt.SourceRateWindow = time.Minute
+	mgr := NewManager(stub.URL, tun.ID, "", 10*time.Millisecond, 50*time.Millisecond, rt)
+	defer mgr.Close()
+	go func() { _ = serveIncomingWithManager(mgr, nil) }()
+	require.NoError(t, stub.WaitSessions(tun.ID, 1, 5*time.Second))
+	public, err := stub.ServePublic(tun.ID)
+	require.NoError(t, err)
+	defer public.Close()
+
+	mirror, err := StartLocalMirror("127.0.0.1:0", tun.ID, backend.Listener.Addr().String(), rt, nil)
+	require.NoError(t, err)
+	defer mirror.Close()
+
+	var results []mirrorResult
+	for _, path := range []string{"/a", "/b", "/c"} {
+		viaTunnel := roundTrip(t, public.Addr().String(), path, "127.0.0.1", seen)
+		viaMirror := roundTrip(t, mirror.Addr().String(), path, "", seen)
+		assert.Equal(t, viaTunnel, viaMirror, path)
+		results = append(results, viaMirror)
+	}
+	assert.Equal(t, mirrorResult{status: http.StatusOK, body: "page /a", backend: "/a myapp.local app.example.com 127.0.0.1"}, results[0])
+	assert.Equal(t, http.StatusTooManyRequests, results[2].status, "the third request is over the limit")
+	assert.Empty(t, results[2].backend)
+}
+
+func TestE2E_LocalMirror_RateLimited(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+	rt := e2eRuntime()
+	rt.HTTPAware = true
+	rt.SourceRateLimit = 1
+	rt.SourceRateWindow = time.Minute
+	mirror, err := StartLocalMirror("127.0.0.1:0", "t1", backend.Listener.Addr().String(), rt, nil)
+	require.NoError(t, err)
+	defer mirror.Close()
+
+	seen := make(chan string)
+	assert.Equal(t, http.StatusOK, roundTrip(t, mirror.Addr().String(), "/", "", seen).status)
+	limited := roundTrip(t, mirror.Addr().String(), "/", "", seen)
+	assert.Equal(t, http.StatusTooManyRequests, limited.status)
+	assert.NotEmpty(t, limited.retry)
+}
+
+func TestE2E_LocalMirror_BackendDown(t *testing.T) {
+	mirror, err := StartLocalMirror("127.0.0.1:0", "t1", refusedAddr(t), e2eRuntime(), nil)
+	require.NoError(t, err)
+	defer mirror.Close()
+
+	got := roundTrip(t, mirror.Addr().String(), "/", "", make(chan string))
+	assert.Equal(t, http.StatusBadGateway, got.status)
+}
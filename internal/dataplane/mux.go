@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"io"
+	"time"
+
+	"github.com/xtaci/smux"
+
+	"github.com/fortunnels/client/internal/support"
+)
+
+// Session is the stream multiplexer of one data-plane connection. The
+// WebSocket data plane runs smux on it (smuxSession); tests serve the same
+// code on in-memory sessions.
+type Session interface {
+	// OpenStream opens a client-initiated stream.
+	OpenStream() (Stream, error)
+	// AcceptStream waits for the next server-initiated stream.
+	AcceptStream() (Stream, error)
+	IsClosed() bool
+	Close() error
+}
+
+// Stream is one stream of a Session. CloseWrite half-closes it: the peer
+// reads EOF while the stream still receives.
+type Stream interface {
+	io.ReadWriteCloser
+	SetReadDeadline(t time.Time) error
+	CloseWrite() error
+}
+
+// smuxSession is a Session on an smux session. Its streams are kept in a
+// registry so that a drain or shutdown can bound their writes.
+type smuxSession struct {
+	*smux.Session
+	streams *streamRegistry
+}
+
+// clock tells its registry when a write deadline passed.
+func newSmuxSession(sess *smux.Session, clock support.Clock) smuxSession {
+	return smuxSession{Session: sess, streams: newStreamRegistry(clock)}
+}
+
+func (s smuxSession) OpenStream() (Stream, error) {
+	st, err := s.Session.OpenStream()
+	if err != nil {
+		return nil, err
+	}
+	return s.streams.add(st), nil
+}
+
+func (s smuxSession) AcceptStream() (Stream, error) {
+	st, err := s.Session.AcceptStream()
+	if err != nil {
+		return nil, err
+	}
+	return s.streams.add(st), nil
+}
+
+func (s smuxSession) boundWrites(deadline time.Time) int {
+	return s.streams.boundWrites(deadline)
+}
+
+// openStreams reports how many streams sess carries, or 0 when it cannot
+// tell; a draining session is closed once it reaches 0.
+func openStreams(sess Session) int {
+	if c, ok := sess.(interface{ NumStreams() int }); ok {
+		return c.NumStreams()
+	}
+	return 0
+}
@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/support"
+)
+
+// panickyDialer panics while dialing "dial-panic:1" and returns backends
+// whose Read panics for "read-panic:1"; other dsts are dialed.
+type panickyDialer struct{}
+
+func (panickyDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	switch addr {
+	case "dial-panic:1":
+		panic("dialer exploded")
+	case "read-panic:1":
+		c1, c2 := net.Pipe()
+		go func() { <-ctx.Done(); _ = c2.Close() }()
+		return panicReadConn{c1}, nil
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, network, addr)
+}
+
+type panicReadConn struct{ net.Conn }
+
+func (panicReadConn) Read([]byte) (int, error) {
+	panic("backend read exploded")
+}
+
+func TestServeIncoming_PanicClosesOnlyItsStream(t *testing.T) {
+	dir := t.TempDir()
+	support.SetCrashDir(dir, func() string { return "version: test\n" })
+	defer support.SetCrashDir("", nil)
+	logs := captureLog(t)
+	before := support.Panics()
+
+	client, server := newMemSessionPair()
+	defer client.Close()
+	s := incomingStreamServer{tunnelID: "t1", dialer: panickyDialer{}}
+	served := make(chan struct{}, 3)
+	go func() {
+		for {
+			st, err := client.AcceptStream()
+			if err != nil {
+				return
+			}
+			go func() {
+				s.serveLogged(st)
+				served <- struct{}{}
+			}()
+		}
+	}()
+
+	// 1. A panic in the serving goroutine itself ends its stream.
+	st, err := server.OpenStream()
+	require.NoError(t, err)
+	require.NoError(t, sendTCPPreface(st, "dial-panic:1", "t1"))
+	require.NoError(t, st.SetReadDeadline(time.Now().Add(5*time.Second)))
+	rest, err := io.ReadAll(st)
+	require.NoError(t, err, "the stream is closed")
+	assert.Empty(t, rest)
+
+	// 2. So does one in a copy goroutine of the bridge.
+	st, _, line := openIncoming(t, server, "read-panic:1")
+	require.Equal(t, setupAckLine, line)
+	_, err = io.ReadAll(st)
+	require.NoError(t, err)
+
+	// 3. Other streams are still served.
+	echo, rd, line := openIncoming(t, server, startTCPEchoBackend(t))
+	defer echo.Close()
+	require.Equal(t, setupAckLine, line)
+	_, err = echo.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(rd, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+
+	// The echo stream is still open: the two that ended were reported.
+	for i := 0; i < 2; i++ {
+		select {
+		case <-served:
+		case <-time.After(5 * time.Second):
+			t.Fatal("a panicking stream was not served to the end")
+		}
+	}
+	assert.Equal(t, before+2, support.Panics())
+	out := logs.String()
+	assert.Contains(t, out, "[ERROR] panic in incoming stream tunnel=t1 conn=")
+	assert.Contains(t, out, ": dialer exploded at dataplane.panickyDialer.DialContext (panics_test.go:")
+	assert.Contains(t, out, ": backend read exploded at dataplane.panicReadConn.Read (panics_test.go:")
+
+	files, err := filepath.Glob(filepath.Join(dir, "crash-*-incoming-stream.txt"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	for _, f := range files {
+		body, err := os.ReadFile(f)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(body), "fortunnels client crash report, "))
+		assert.Contains(t, string(body), "tunnel: t1\n")
+		assert.Contains(t, string(body), "== diagnostics ==\nversion: test\n")
+	}
+}
@@ -0,0 +1,178 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/fortunnels/client/internal/support"
+)
+
+const (
+	// pingPayloadPrefix tags the data-plane loop's pings; the rest of the
+	// payload is the send time and a sequence number, so a pong carries its
+	// own RTT.
+	pingPayloadPrefix = "ping-"
+	// pingRTTSamples is how many recent RTTs a connection keeps.
+	pingRTTSamples = 16
+)
+
+// processPings totals the pings of every data-plane connection in this
+// process.
+var processPings = &pingTotals{rtt: support.NewQuantileSketch(0)}
+
+type pingTotals struct {
+	// loops is the gauge of running ping loops: one per open data-plane
+	// connection.
+	loops  atomic.Int64
+	sent   atomic.Uint64
+	lost   atomic.Uint64
+	closed atomic.Uint64
+	rtt    *support.QuantileSketch
+}
+
+// WritePingSummary writes how many data-plane pings got no pong, their RTT
+// percentiles and how many connections were closed for missing pongs.
+func WritePingSummary(w io.Writer) {
+	sent := processPings.sent.Load()
+	if sent == 0 {
+		return
+	}
+	pc := processPings.rtt.Percentiles()
+	fmt.Fprintf(w, "\n📶 Data-plane pings: %d sent, %d lost, RTT p50 %s, p95 %s, p99 %s\n", sent, processPings.lost.Load(),
+		pc.P50.Round(time.Millisecond), pc.P95.Round(time.Millisecond), pc.P99.Round(time.Millisecond))
+	if closed := processPings.closed.Load(); closed > 0 {
+		fmt.Fprintf(w, "   %d connection(s) closed after missing --ping-loss-threshold pongs in a row\n", closed)
+	}
+}
+
+// pingHealth follows the pings of one data-plane connection: the RTTs of the
+// last pingRTTSamples pongs and the pings lost in a row since the last one.
+// Once threshold pings in a row are lost the connection counts as dead; 0
+// never gives up on it.
+type pingHealth struct {
+	threshold int
+	clock     support.Clock
+
+	mu sync.Mutex
+	// outstanding is the payload of the ping awaiting its pong, if any.
+	outstanding string
+	seq         uint64
+	rtts        [pingRTTSamples]time.Duration
+	samples     int
+	lostInRow   int
+}
+
+func newPingHealth(threshold int, clock support.Clock) *pingHealth {
+	return &pingHealth{threshold: threshold, clock: clock}
+}
+
+// ping counts the previous ping as lost when its pong has not arrived and
+// returns the payload for the next one. dead reports that the loss reached
+// the threshold; no payload is returned then.
+func (h *pingHealth) ping() (payload string, dead bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.outstanding != "" {
+		h.outstanding = ""
+		if h.loseLocked() {
+			return "", true
+		}
+	}
+	h.seq++
+	h.outstanding = pingPayloadPrefix + strconv.FormatInt(h.clock.Now().UnixNano(), 36) + "." + strconv.FormatUint(h.seq, 36)
+	processPings.sent.Add(1)
+	return h.outstanding, false
+}
+
+// pong records the RTT of the outstanding ping when payload is its pong.
+// Late pongs of pings already counted as lost are ignored.
+func (h *pingHealth) pong(payload string) {
+	sent, ok := pingSentAt(payload)
+	if !ok {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if payload != h.outstanding {
+		return
+	}
+	h.outstanding = ""
+	h.recordLocked(h.clock.Now().Sub(sent))
+}
+
+// observe records the outcome of a ping the caller matched itself (the
+// adaptive loop's probes) and reports whether the connection is dead.
+func (h *pingHealth) observe(rtt time.Duration, lost bool) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	processPings.sent.Add(1)
+	if lost {
+		return h.loseLocked()
+	}
+	h.recordLocked(rtt)
+	return false
+}
+
+func (h *pingHealth) loseLocked() bool {
+	processPings.lost.Add(1)
+	h.lostInRow++
+	return h.threshold > 0 && h.lostInRow >= h.threshold
+}
+
+func (h *pingHealth) recordLocked(rtt time.Duration) {
+	processPings.rtt.Add(rtt)
+	h.rtts[h.samples%pingRTTSamples] = rtt
+	h.samples++
+	h.lostInRow = 0
+}
+
+// recentRTT is the mean of the kept RTT samples, or 0 before any pong.
+func (h *pingHealth) recentRTT() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := min(h.samples, pingRTTSamples)
+	if n == 0 {
+		return 0
+	}
+	var sum time.Duration
+	for _, rtt := range h.rtts[:n] {
+		sum += rtt
+	}
+	return sum / time.Duration(n)
+}
+
+// closeDead closes conn, whose pongs stopped, so its session fails now and
+// is redialed instead of waiting for the read deadline.
+func (h *pingHealth) closeDead(conn *websocket.Conn) {
+	processPings.closed.Add(1)
+	last := "no pong yet"
+	if rtt := h.recentRTT(); rtt > 0 {
+		last = "recent RTT " + rtt.Round(time.Millisecond).String()
+	}
+	log.Printf("[WARN] data-plane connection missed %d pongs in a row (%s); closing it to reconnect", h.threshold, last)
+	_ = conn.Close()
+}
+
+func pingSentAt(payload string) (time.Time, bool) {
+	stamp, ok := strings.CutPrefix(payload, pingPayloadPrefix)
+	if !ok {
+		return time.Time{}, false
+	}
+	stamp, _, _ = strings.Cut(stamp, ".")
+	ns, err := strconv.ParseInt(stamp, 36, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, ns), true
+}
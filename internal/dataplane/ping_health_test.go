@@ -0,0 +1,283 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/support"
+)
+
+// pongSwallower is a WebSocket peer that reports each ping it gets and
+// answers it unless swallow is set.
+type pongSwallower struct {
+	pings   chan string
+	swallow atomic.Bool
+}
+
+func startPongSwallower(t *testing.T) (*pongSwallower, string) {
+	t.Helper()
+	p := &pongSwallower{pings: make(chan string, 16)}
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetPingHandler(func(payload string) error {
+			p.pings <- payload
+			if p.swallow.Load() {
+				return nil
+			}
+			return conn.WriteControl(websocket.PongMessage, []byte(payload), time.Now().Add(time.Second))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return p, "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+// dialPinged dials url and starts the data-plane ping loop on the conn; the
+// returned channel is closed once the conn is closed.
+func dialPinged(t *testing.T, url string, settings config.RuntimeSettings, clock support.Clock) (*pongWaiter, <-chan struct{}) {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	pongs := newPongWaiter()
+	// The read deadline needs the real time; clock only drives the pings.
+	configureWSReadKeepalive(conn, pongs, support.RealClock)
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	ticker := startDataPlanePing(done, conn, settings, pongs, nil, clock)
+	t.Cleanup(func() { stopTicker(ticker) })
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	return pongs, closed
+}
+
+func awaitingPong(h *pingHealth) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.outstanding != ""
+}
+
+func TestPingHealth_ClosesAtTheLossThreshold(t *testing.T) {
+	const interval = time.Second
+	peer, url := startPongSwallower(t)
+	clock := support.NewFakeClock(time.Unix(1_700_000_000, 0))
+	settings := config.RuntimeSettings{PingInterval: interval, PingTimeout: time.Second, PingLossThreshold: 3}
+	before := processPings.closed.Load()
+	pongs, closed := dialPinged(t, url, settings, clock)
+	health := pongs.health
+	require.NotNil(t, health)
+
+	// tick sends the next ping, answered or not, and waits for the peer to
+	// get it (and for its pong, when answered).
+	tick := func(answer bool) {
+		t.Helper()
+		peer.swallow.Store(!answer)
+		clock.Advance(interval)
+		select {
+		case payload := <-peer.pings:
+			require.True(t, strings.HasPrefix(payload, pingPayloadPrefix), payload)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no ping sent")
+		}
+		if answer {
+			require.Eventually(t, func() bool { return !awaitingPong(health) }, 5*time.Second, time.Millisecond)
+		}
+	}
+	stillOpen := func() {
+		t.Helper()
+		select {
+		case <-closed:
+			t.Fatal("closed before the loss threshold")
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+
+	tick(true)
+	tick(false)
+	tick(false)
+	tick(true) // two lost, then a pong: the count starts over
+	tick(false)
+	tick(false)
+	tick(false) // its tick finds the second loss in a row
+	stillOpen()
+
+	clock.Advance(interval) // the third loss in a row
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("not closed at the loss threshold")
+	}
+	assert.Equal(t, before+1, processPings.closed.Load())
+}
+
+func TestPingHealth_RecordsRTTOfMatchingPongs(t *testing.T) {
+	clock := support.NewFakeClock(time.Unix(1_700_000_000, 0))
+	h := newPingHealth(2, clock)
+
+	payload, dead := h.ping()
+	require.False(t, dead)
+	clock.Advance(40 * time.Millisecond)
+	h.pong("probe-123")
+	h.pong(pingPayloadPrefix + "nonsense")
+	assert.True(t, awaitingPong(h), "only the outstanding ping's pong counts")
+	h.pong(payload)
+	assert.Equal(t, 40*time.Millisecond, h.recentRTT())
+
+	late, _ := h.ping()
+	_, dead = h.ping()
+	require.False(t, dead)
+	clock.Advance(10 * time.Millisecond)
+	h.pong(late)
+	assert.Equal(t, 40*time.Millisecond, h.recentRTT(), "a pong after its ping was counted lost is ignored")
+
+	for i := range pingRTTSamples {
+		assert.False(t, h.observe(time.Duration(i+1)*time.Millisecond, false))
+	}
+	assert.Equal(t, 8500*time.Microsecond, h.recentRTT(), "the mean of the last %d samples", pingRTTSamples)
+	assert.False(t, h.observe(0, true))
+	assert.True(t, h.observe(0, true))
+}
+
+func TestPingHealth_ZeroThresholdNeverGivesUp(t *testing.T) {
+	h := newPingHealth(0, support.NewFakeClock(time.Unix(0, 0)))
+	for range 100 {
+		_, dead := h.ping()
+		require.False(t, dead)
+	}
+}
+
+func TestWritePingSummary(t *testing.T) {
+	var out strings.Builder
+	h := newPingHealth(0, support.NewFakeClock(time.Unix(0, 0)))
+	h.observe(20*time.Millisecond, false)
+	WritePingSummary(&out)
+	assert.Contains(t, out.String(), "Data-plane pings:")
+	assert.Contains(t, out.String(), "lost, RTT p50")
+}
+
+// TestManager_OnePingLoopAcrossReconnects drops the data-plane connection
+// five times, with a failed dial before each reconnect: every dropped conn's
+// ping loop must end, so exactly one runs and the dropped conns get no more
+// pings.
+func TestManager_OnePingLoopAcrossReconnects(t *testing.T) {
+	// The loops of earlier tests end shortly after their cleanups.
+	require.Eventually(t, func() bool { return processPings.loops.Load() == 0 }, 5*time.Second, time.Millisecond)
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	var (
+		mu    sync.Mutex
+		conns []*websocket.Conn
+		pings []*atomic.Int64
+	)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		n := &atomic.Int64{}
+		mu.Lock()
+		conns = append(conns, conn)
+		pings = append(pings, n)
+		mu.Unlock()
+		conn.SetPingHandler(func(payload string) error {
+			n.Add(1)
+			return conn.WriteControl(websocket.PongMessage, []byte(payload), time.Now().Add(time.Second))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+	pingsOf := func(i int) int64 {
+		mu.Lock()
+		defer mu.Unlock()
+		return pings[i].Load()
+	}
+
+	mgr := NewManager(srv.URL, "tunnel-123", "", time.Millisecond, 10*time.Millisecond, config.RuntimeSettings{
+		PingInterval:          10 * time.Millisecond,
+		PingTimeout:           time.Second,
+		SmuxKeepAliveInterval: 10 * time.Second,
+		SmuxKeepAliveTimeout:  30 * time.Second,
+	})
+	defer mgr.Close()
+	var dials atomic.Int64
+	dial := mgr.dial
+	mgr.dial = func(wsURL string, headers http.Header) (*websocket.Conn, Session, *pongWaiter, error) {
+		if dials.Add(1)%2 == 0 {
+			return nil, nil, nil, errors.New("flaky network")
+		}
+		return dial(wsURL, headers)
+	}
+
+	const cycles = 5
+	for i := range cycles + 1 {
+		sess, err := mgr.EnsureSession()
+		require.NoError(t, err)
+		require.Eventually(t, func() bool { return pingsOf(i) > 0 }, 5*time.Second, time.Millisecond, "conn %d is pinged", i)
+		require.Eventually(t, func() bool { return processPings.loops.Load() == 1 }, 5*time.Second, time.Millisecond,
+			"one ping loop after %d reconnects, got %d", i, processPings.loops.Load())
+		if i == cycles {
+			break
+		}
+		mu.Lock()
+		_ = conns[i].Close()
+		mu.Unlock()
+		// Like serveIncomingUntil: the accept fails and the session is
+		// closed so that EnsureSession redials.
+		_, err = sess.AcceptStream()
+		require.Error(t, err)
+		require.NoError(t, sess.Close())
+		require.Eventually(t, func() bool { return processPings.loops.Load() == 0 }, 5*time.Second, time.Millisecond,
+			"the ping loop of dropped conn %d ends before the reconnect", i)
+	}
+	assert.Equal(t, int64(2*cycles+1), dials.Load())
+
+	stale := make([]int64, cycles)
+	for i := range stale {
+		stale[i] = pingsOf(i)
+	}
+	time.Sleep(100 * time.Millisecond)
+	for i := range stale {
+		assert.Equal(t, stale[i], pingsOf(i), "dropped conn %d was pinged", i)
+	}
+	assert.Greater(t, pingsOf(cycles), int64(5), "the live conn keeps being pinged")
+
+	mgr.Close()
+	require.Eventually(t, func() bool { return processPings.loops.Load() == 0 }, 5*time.Second, time.Millisecond)
+}
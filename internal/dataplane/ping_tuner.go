@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/fortunnels/client/internal/config"
+)
+
+// Adaptive ping (--ping-interval auto) bounds and tuning constants.
+const (
+	adaptivePingFloor   = 5 * time.Second
+	adaptivePingCeiling = 60 * time.Second
+
+	pingEWMAAlpha = 0.2
+	// A lost ping or relative RTT jitter above pingUnstableJitter shrinks the
+	// interval; it grows only once smoothed loss and jitter are below the
+	// stable pair, and holds in between (e.g. while a past loss decays).
+	pingUnstableJitter = 0.5
+	pingStableLoss     = 0.01
+	pingStableJitter   = 0.2
+	pingShrinkFactor   = 0.5
+	pingGrowFactor     = 1.25
+)
+
+// PingStats is a snapshot of the adaptive ping controller.
+type PingStats struct {
+	Interval time.Duration
+	RTT      time.Duration
+	Jitter   time.Duration
+	Loss     float64
+}
+
+// pingTuner decides the data-plane ping interval from pong RTTs and lost
+// pings. It has no clock or I/O: callers feed observations and read back the
+// next interval.
+type pingTuner struct {
+	mu       sync.Mutex
+	floor    time.Duration
+	ceiling  time.Duration
+	initial  time.Duration
+	interval time.Duration
+	rtt      float64 // EWMA, nanoseconds
+	jitter   float64 // EWMA of |sample - rtt|, nanoseconds
+	loss     float64 // EWMA of lost (1) vs answered (0)
+	samples  int
+}
+
+func newPingTuner(start, floor, ceiling time.Duration) *pingTuner {
+	if start < floor {
+		start = floor
+	}
+	if start > ceiling {
+		start = ceiling
+	}
+	return &pingTuner{floor: floor, ceiling: ceiling, initial: start, interval: start}
+}
+
+// newPingTunerFor returns a tuner for settings, or nil when adaptive ping is off.
+func newPingTunerFor(settings config.RuntimeSettings) *pingTuner {
+	if !settings.AdaptivePing {
+		return nil
+	}
+	return newPingTuner(settings.PingInterval, adaptivePingFloor, adaptivePingCeiling)
+}
+
+// observe records one ping outcome and returns the interval until the next ping.
+func (t *pingTuner) observe(rtt time.Duration, lost bool) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if lost {
+		t.loss = pingEWMAAlpha + (1-pingEWMAAlpha)*t.loss
+	} else {
+		t.loss *= 1 - pingEWMAAlpha
+		sample := float64(rtt)
+		if t.samples == 0 {
+			t.rtt = sample
+		} else {
+			t.jitter = pingEWMAAlpha*math.Abs(sample-t.rtt) + (1-pingEWMAAlpha)*t.jitter
+			t.rtt = pingEWMAAlpha*sample + (1-pingEWMAAlpha)*t.rtt
+		}
+		t.samples++
+	}
+	relJitter := 0.0
+	if t.rtt > 0 {
+		relJitter = t.jitter / t.rtt
+	}
+	switch {
+	case lost || relJitter > pingUnstableJitter:
+		t.interval = t.clamp(time.Duration(float64(t.interval) * pingShrinkFactor))
+	case t.loss < pingStableLoss && relJitter < pingStableJitter:
+		t.interval = t.clamp(time.Duration(float64(t.interval) * pingGrowFactor))
+	}
+	return t.interval
+}
+
+func (t *pingTuner) clamp(d time.Duration) time.Duration {
+	return min(max(d, t.floor), t.ceiling)
+}
+
+func (t *pingTuner) current() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.interval
+}
+
+func (t *pingTuner) stats() PingStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return PingStats{
+		Interval: t.interval,
+		RTT:      time.Duration(t.rtt),
+		Jitter:   time.Duration(t.jitter),
+		Loss:     t.loss,
+	}
+}
+
+// scaleKeepAlive scales the smux keepalive settings by the same factor the
+// ping interval moved from its start value, so both layers probe at a
+// consistent rate. smux fixes keepalive per session, so this applies to newly
+// dialed sessions.
+func (t *pingTuner) scaleKeepAlive(settings config.RuntimeSettings) config.RuntimeSettings {
+	if t == nil {
+		return settings
+	}
+	t.mu.Lock()
+	ratio := float64(t.interval) / float64(t.initial)
+	t.mu.Unlock()
+	settings.SmuxKeepAliveInterval = time.Duration(float64(settings.SmuxKeepAliveInterval) * ratio)
+	settings.SmuxKeepAliveTimeout = time.Duration(float64(settings.SmuxKeepAliveTimeout) * ratio)
+	return settings
+}
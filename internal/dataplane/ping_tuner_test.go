@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+)
+
+func testTuner() *pingTuner {
+	return newPingTuner(30*time.Second, adaptivePingFloor, adaptivePingCeiling)
+}
+
+func feed(t *pingTuner, n int, rtt time.Duration, lost bool) []time.Duration {
+	out := make([]time.Duration, 0, n)
+	for range n {
+		out = append(out, t.observe(rtt, lost))
+	}
+	return out
+}
+
+func TestPingTuner_StableLinkRelaxesToCeiling(t *testing.T) {
+	tuner := testTuner()
+	trajectory := feed(tuner, 10, 40*time.Millisecond, false)
+	prev := 30 * time.Second
+	for i, d := range trajectory {
+		assert.GreaterOrEqual(t, d, prev, "step %d must not shrink on a stable link", i)
+		prev = d
+	}
+	assert.Equal(t, adaptivePingCeiling, trajectory[len(trajectory)-1])
+	assert.Equal(t, 40*time.Millisecond, tuner.stats().RTT)
+}
+
+func TestPingTuner_LossShrinksToFloor(t *testing.T) {
+	tuner := testTuner()
+	assert.Equal(t, []time.Duration{
+		15 * time.Second, 7500 * time.Millisecond, adaptivePingFloor, adaptivePingFloor,
+	}, feed(tuner, 4, 0, true))
+	assert.Greater(t, tuner.stats().Loss, pingStableLoss)
+}
+
+func TestPingTuner_RecoversWithHysteresis(t *testing.T) {
+	tuner := testTuner()
+	feed(tuner, 3, 0, true)
+	require.Equal(t, adaptivePingFloor, tuner.current())
+
+	// Answered pings first decay the smoothed loss; the interval holds at the
+	// floor until loss drops below the stable threshold, then grows again.
+	trajectory := feed(tuner, 30, 40*time.Millisecond, false)
+	firstGrowth := -1
+	for i, d := range trajectory {
+		if d > adaptivePingFloor {
+			firstGrowth = i
+			break
+		}
+	}
+	require.Positive(t, firstGrowth, "interval must not grow right after losses")
+	assert.Equal(t, adaptivePingCeiling, trajectory[len(trajectory)-1])
+}
+
+func TestPingTuner_JitterShrinks(t *testing.T) {
+	tuner := testTuner()
+	var last time.Duration
+	for i := range 12 {
+		rtt := 20 * time.Millisecond
+		if i%2 == 1 {
+			rtt = 400 * time.Millisecond
+		}
+		last = tuner.observe(rtt, false)
+	}
+	assert.Equal(t, adaptivePingFloor, last)
+	assert.Greater(t, tuner.stats().Jitter, time.Duration(0))
+}
+
+func TestPingTuner_SingleLossOnStableLinkIsBounded(t *testing.T) {
+	tuner := testTuner()
+	feed(tuner, 10, 40*time.Millisecond, false)
+	require.Equal(t, adaptivePingCeiling, tuner.current())
+	assert.Equal(t, adaptivePingCeiling/2, tuner.observe(0, true), "one loss halves the interval once")
+	assert.Equal(t, adaptivePingCeiling/2, tuner.observe(40*time.Millisecond, false), "answered pings hold while the loss decays")
+}
+
+func TestPingTuner_StartIsClamped(t *testing.T) {
+	assert.Equal(t, adaptivePingFloor, newPingTuner(time.Second, adaptivePingFloor, adaptivePingCeiling).current())
+	assert.Equal(t, adaptivePingCeiling, newPingTuner(time.Hour, adaptivePingFloor, adaptivePingCeiling).current())
+}
+
+func TestPingTuner_ScaleKeepAlive(t *testing.T) {
+	settings := config.RuntimeSettings{SmuxKeepAliveInterval: 20 * time.Second, SmuxKeepAliveTimeout: 60 * time.Second}
+	var off *pingTuner
+	assert.Equal(t, settings, off.scaleKeepAlive(settings), "nil tuner keeps settings")
+
+	tuner := testTuner()
+	feed(tuner, 1, 0, true) // 30s -> 15s
+	scaled := tuner.scaleKeepAlive(settings)
+	assert.Equal(t, 10*time.Second, scaled.SmuxKeepAliveInterval)
+	assert.Equal(t, 30*time.Second, scaled.SmuxKeepAliveTimeout)
+}
+
+func TestNewPingTunerFor(t *testing.T) {
+	assert.Nil(t, newPingTunerFor(config.RuntimeSettings{PingInterval: 30 * time.Second}))
+	tuner := newPingTunerFor(config.RuntimeSettings{PingInterval: 30 * time.Second, AdaptivePing: true})
+	require.NotNil(t, tuner)
+	assert.Equal(t, 30*time.Second, tuner.current())
+}
@@ -0,0 +1,308 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/fortunnels/client/internal/config"
+)
+
+const (
+	// bulkThreshold is the send rate (bytes/s) above which a stream counts
+	// as bulk once it has kept it up for bulkWindows windows in a row; it
+	// turns interactive again in a window below a quarter of it.
+	bulkThreshold = 256 << 10
+	bulkWindows   = 4
+	// priorityWindow is the measuring window of the classifier and of the
+	// session throughput the bulk cap follows.
+	priorityWindow = 250 * time.Millisecond
+	// bulkShare is the share of the session's recent throughput bulk
+	// streams may use while an interactive stream is open; bulkMinRate
+	// keeps them moving however low the estimate falls.
+	bulkShare   = 0.8
+	bulkMinRate = 64 << 10
+	// bulkProbe is how much an unlearned estimate grows per window in which
+	// bulk streams waited on the cap.
+	bulkProbe = 1.25
+	// congestedShare is how much of a window bulk writes may spend blocked
+	// in smux before the session counts as congested.
+	congestedShare = 0.25
+	// priorityChunk splits writes so that pacing stays smooth.
+	priorityChunk = 16 << 10
+	// priorityMaxSleep caps one pacing wait so a released cap takes effect
+	// quickly.
+	priorityMaxSleep = 50 * time.Millisecond
+)
+
+// streamClass is how the priority layer treats a stream.
+type streamClass int
+
+const (
+	classInteractive streamClass = iota
+	classBulk
+)
+
+// streamClassifier tells bulk streams from interactive ones by the rate they
+// send at. It only keeps counters and decides with an explicit clock.
+type streamClassifier struct {
+	// fixed pins class, from a hint.
+	fixed bool
+	class streamClass
+
+	start time.Time
+	bytes int64
+	// hot counts consecutive windows at or above bulkThreshold.
+	hot int
+}
+
+// newStreamClassifier returns a classifier for the --listen-priority hint;
+// unknown hints classify automatically.
+func newStreamClassifier(hint string) streamClassifier {
+	switch hint {
+	case config.ListenPriorityInteractive:
+		return streamClassifier{fixed: true, class: classInteractive}
+	case config.ListenPriorityBulk:
+		return streamClassifier{fixed: true, class: classBulk}
+	}
+	return streamClassifier{}
+}
+
+// observe counts n bytes sent at now and returns the stream's class.
+func (c *streamClassifier) observe(n int, now time.Time) streamClass {
+	if c.fixed {
+		return c.class
+	}
+	if c.start.IsZero() {
+		c.start = now
+	}
+	c.bytes += int64(n)
+	elapsed := now.Sub(c.start)
+	if elapsed < priorityWindow {
+		return c.class
+	}
+	rate := float64(c.bytes) / elapsed.Seconds()
+	switch {
+	case rate >= bulkThreshold:
+		c.hot++
+		if c.hot >= bulkWindows {
+			c.class = classBulk
+		}
+	case rate < bulkThreshold/4:
+		c.hot = 0
+		c.class = classInteractive
+	default:
+		c.hot = 0
+	}
+	c.start, c.bytes = now, 0
+	return c.class
+}
+
+// priorityPacer paces the bulk streams of one Manager so that interactive
+// streams on the same session are not queued behind them. While at least one
+// interactive stream is open, bulk writes go through a shared leaky bucket
+// at bulkShare of the throughput the session delivered recently; with none
+// open the cap is released.
+//
+// The estimate follows the session's throughput while uncapped, and holds
+// while capped: a capped session cannot show what the link would carry. It
+// drops to what was delivered when bulk writes block in smux (the link is
+// slower than estimated). When bulk traffic starts while an interactive
+// stream is already open, nothing has been learned yet, so the estimate
+// grows by bulkProbe per window until the writes first block.
+//
+// Like streamScheduler it decides with an explicit clock; prioritizedStream
+// is the blocking wrapper.
+type priorityPacer struct {
+	mu          sync.Mutex
+	interactive int
+	estimate    float64
+	// learned reports that estimate was measured rather than probed.
+	learned bool
+
+	// Current window: bytes sent by every stream, time bulk writes spent
+	// blocked, and whether any bulk write waited on the bucket.
+	start   time.Time
+	bytes   int64
+	blocked time.Duration
+	paced   bool
+
+	tokens float64
+	last   time.Time
+}
+
+// add counts delta streams of class c; only interactive ones matter.
+func (p *priorityPacer) add(c streamClass, delta int) {
+	if c != classInteractive {
+		return
+	}
+	p.mu.Lock()
+	p.interactive += delta
+	p.mu.Unlock()
+}
+
+// bulkRate returns the current cap of bulk streams in bytes/s; 0 means
+// uncapped.
+func (p *priorityPacer) bulkRate() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.bulkRateLocked()
+}
+
+func (p *priorityPacer) bulkRateLocked() float64 {
+	if p.interactive <= 0 {
+		return 0
+	}
+	return math.Max(bulkMinRate, bulkShare*p.estimate)
+}
+
+// reserve takes n bytes for a bulk write at now and returns how long the
+// writer must wait before sending them.
+func (p *priorityPacer) reserve(n int, now time.Time) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tickLocked(now)
+	rate := p.bulkRateLocked()
+	if rate <= 0 {
+		p.tokens, p.last = 0, time.Time{}
+		return 0
+	}
+	// A burst of a tenth of a second, like rateLimiter.
+	burst := math.Max(rate/10, priorityChunk)
+	if p.last.IsZero() {
+		p.tokens = burst
+	} else if now.After(p.last) {
+		p.tokens = math.Min(burst, p.tokens+now.Sub(p.last).Seconds()*rate)
+	}
+	p.last = now
+	p.tokens -= float64(n)
+	if p.tokens >= 0 {
+		return 0
+	}
+	p.paced = true
+	return time.Duration(-p.tokens / rate * float64(time.Second))
+}
+
+// record counts n bytes a stream sent at now; blocked is how long the write
+// took when the stream is bulk.
+func (p *priorityPacer) record(n int, blocked time.Duration, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tickLocked(now)
+	p.bytes += int64(n)
+	p.blocked += blocked
+}
+
+// tickLocked closes the current window when it is over and updates the
+// throughput estimate from it.
+func (p *priorityPacer) tickLocked(now time.Time) {
+	if p.start.IsZero() {
+		p.start = now
+		return
+	}
+	elapsed := now.Sub(p.start)
+	if elapsed < priorityWindow {
+		return
+	}
+	delivered := float64(p.bytes) / elapsed.Seconds()
+	switch {
+	case p.interactive <= 0:
+		// Uncapped: follow the session, falling slowly when it idles.
+		p.estimate = math.Max(delivered, p.estimate*0.75)
+		p.learned = p.estimate >= bulkThreshold
+	case float64(p.blocked) > congestedShare*float64(elapsed):
+		p.estimate = math.Min(p.estimate, delivered)
+		p.learned = true
+	case p.paced && !p.learned:
+		p.estimate = math.Max(p.estimate, bulkMinRate/bulkShare) * bulkProbe
+	}
+	p.start, p.bytes, p.blocked, p.paced = now, 0, 0, false
+}
+
+// prioritizedStream paces the writes of one stream through its Manager's
+// priorityPacer once its classifier calls it bulk. Only the data the client
+// sends is paced: reading a stream slowly would fill the shared smux receive
+// buffer and stall every stream of the session.
+type prioritizedStream struct {
+	io.ReadWriteCloser
+	pacer *priorityPacer
+	cls   streamClassifier
+	class streamClass
+
+	// now and sleep are the clock; tests replace them.
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// newPrioritizedStream registers s with pacer under the given hint; the
+// caller must call done when the stream ends.
+func newPrioritizedStream(s io.ReadWriteCloser, pacer *priorityPacer, hint string) *prioritizedStream {
+	ps := &prioritizedStream{
+		ReadWriteCloser: s,
+		pacer:           pacer,
+		cls:             newStreamClassifier(hint),
+		now:             time.Now,
+		sleep:           time.Sleep,
+	}
+	ps.class = ps.cls.class
+	pacer.add(ps.class, 1)
+	return ps
+}
+
+// done uncounts the stream from its pacer.
+func (s *prioritizedStream) done() {
+	s.pacer.add(s.class, -1)
+}
+
+func (s *prioritizedStream) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		chunk := p[written:min(len(p), written+priorityChunk)]
+		now := s.now()
+		if c := s.cls.observe(len(chunk), now); c != s.class {
+			s.pacer.add(s.class, -1)
+			s.pacer.add(c, 1)
+			s.class = c
+		}
+		bulk := s.class == classBulk
+		if bulk {
+			s.pace(len(chunk), now)
+		}
+		start := s.now()
+		n, err := s.ReadWriteCloser.Write(chunk)
+		end := s.now()
+		var blocked time.Duration
+		if bulk {
+			blocked = end.Sub(start)
+		}
+		s.pacer.record(n, blocked, end)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// pace waits until a bulk write of n bytes may go out, or until the cap is
+// released because the last interactive stream closed.
+func (s *prioritizedStream) pace(n int, now time.Time) {
+	for wait := s.pacer.reserve(n, now); wait > 0; wait -= priorityMaxSleep {
+		s.sleep(min(wait, priorityMaxSleep))
+		if s.pacer.bulkRate() == 0 {
+			return
+		}
+	}
+}
+
+// CloseWrite keeps half-close working through the wrapper.
+func (s *prioritizedStream) CloseWrite() error {
+	if cw, ok := s.ReadWriteCloser.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return s.ReadWriteCloser.Close()
+}
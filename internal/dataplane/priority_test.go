@@ -0,0 +1,344 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"context"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/testsupport"
+)
+
+// feedClassifier sends rate bytes/s through c in 10ms ticks for d, starting at t0,
+// and returns the class after each tick.
+func feedClassifier(c *streamClassifier, t0 time.Time, rate float64, d time.Duration) ([]streamClass, time.Time) {
+	const tick = 10 * time.Millisecond
+	var classes []streamClass
+	now := t0
+	for elapsed := time.Duration(0); elapsed < d; elapsed += tick {
+		now = now.Add(tick)
+		classes = append(classes, c.observe(int(rate*tick.Seconds()), now))
+	}
+	return classes, now
+}
+
+func TestStreamClassifier(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+	tests := []struct {
+		name  string
+		hint  string
+		rate  float64
+		after time.Duration
+		want  streamClass
+	}{
+		{"keystrokes stay interactive", config.ListenPriorityAuto, 2 << 10, 5 * time.Second, classInteractive},
+		{"just under the threshold", config.ListenPriorityAuto, bulkThreshold * 0.9, 5 * time.Second, classInteractive},
+		{"a short burst is not bulk yet", config.ListenPriorityAuto, 4 << 20, bulkWindows*priorityWindow - 50*time.Millisecond, classInteractive},
+		{"sustained transfer turns bulk", config.ListenPriorityAuto, 4 << 20, bulkWindows*priorityWindow + 10*time.Millisecond, classBulk},
+		{"interactive hint", config.ListenPriorityInteractive, 4 << 20, 5 * time.Second, classInteractive},
+		{"bulk hint", config.ListenPriorityBulk, 0, time.Second, classBulk},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newStreamClassifier(tt.hint)
+			classes, _ := feedClassifier(&c, t0, tt.rate, tt.after)
+			assert.Equal(t, tt.want, classes[len(classes)-1])
+		})
+	}
+
+	t.Run("bulk turns interactive when it slows down", func(t *testing.T) {
+		c := newStreamClassifier(config.ListenPriorityAuto)
+		classes, now := feedClassifier(&c, t0, 4<<20, 2*time.Second)
+		require.Equal(t, classBulk, classes[len(classes)-1])
+		classes, now = feedClassifier(&c, now, bulkThreshold/2, time.Second)
+		assert.Equal(t, classBulk, classes[len(classes)-1], "hysteresis between a quarter of the threshold and the threshold")
+		classes, _ = feedClassifier(&c, now, 1<<10, 2*priorityWindow)
+		assert.Equal(t, classInteractive, classes[len(classes)-1])
+	})
+}
+
+// pacedSend has one bulk writer send at up to offered bytes/s through p for
+// d, in priorityChunk writes starting at t0, each delayed as reserve asks,
+// and returns the bytes it got through.
+func pacedSend(p *priorityPacer, t0 time.Time, offered float64, d time.Duration) (int, time.Time) {
+	gap := time.Duration(float64(priorityChunk) / offered * float64(time.Second))
+	sent := 0
+	now := t0
+	for now.Sub(t0) < d {
+		now = now.Add(p.reserve(priorityChunk, now))
+		p.record(priorityChunk, 0, now)
+		sent += priorityChunk
+		now = now.Add(gap)
+	}
+	return sent, now
+}
+
+func TestPriorityPacer_CapsBulkOnlyWhileInteractiveOpen(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+	p := &priorityPacer{}
+	const link = 4 << 20
+
+	// Alone, bulk runs at whatever it offers and teaches the estimate.
+	sent, now := pacedSend(p, t0, link, 2*time.Second)
+	assert.InDelta(t, 2*link, sent, link*0.05)
+	assert.Zero(t, p.bulkRate())
+
+	p.add(classInteractive, 1)
+	assert.InDelta(t, bulkShare*link, p.bulkRate(), link*0.05)
+	sent, now = pacedSend(p, now, link, 4*time.Second)
+	assert.InDelta(t, 4*bulkShare*link, sent, link*0.1, "bulk capped at bulkShare of the learned throughput")
+
+	p.add(classInteractive, -1)
+	assert.Zero(t, p.bulkRate())
+	sent, _ = pacedSend(p, now, link, 2*time.Second)
+	assert.InDelta(t, 2*link, sent, link*0.05, "cap released with the last interactive stream")
+}
+
+func TestPriorityPacer_BlockingLowersEstimate(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+	p := &priorityPacer{}
+	pacedSend(p, t0, 4<<20, time.Second)
+	p.add(classInteractive, 1)
+	require.InDelta(t, bulkShare*(4<<20), p.bulkRate(), 1<<18)
+
+	// The link turns out to carry 1 MiB/s: writes block most of each window.
+	now := t0.Add(2 * time.Second)
+	for range 4 {
+		p.record(1<<20/4, 200*time.Millisecond, now)
+		now = now.Add(priorityWindow)
+	}
+	p.record(0, 0, now)
+	assert.InDelta(t, bulkShare*(1<<20), p.bulkRate(), 1<<16)
+}
+
+func TestPriorityPacer_ProbesWithoutHistory(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+	p := &priorityPacer{}
+	p.add(classInteractive, 1)
+	assert.Equal(t, float64(bulkMinRate), p.bulkRate(), "no history: start at the floor")
+	_, now := pacedSend(p, t0, 8<<20, 3*time.Second)
+	assert.Greater(t, p.bulkRate(), float64(8*bulkMinRate), "grows while writes do not block")
+
+	p.record(64<<10, 200*time.Millisecond, now.Add(priorityWindow))
+	p.record(0, 0, now.Add(2*priorityWindow))
+	probed := p.bulkRate()
+	_, _ = pacedSend(p, now.Add(2*priorityWindow), 8<<20, 2*time.Second)
+	assert.InDelta(t, probed, p.bulkRate(), 1, "learned once writes blocked")
+}
+
+// recordingConn records the writes a prioritizedStream lets through.
+type recordingConn struct {
+	io.ReadWriteCloser
+	writes []int
+}
+
+func (c *recordingConn) Write(p []byte) (int, error) {
+	c.writes = append(c.writes, len(p))
+	return len(p), nil
+}
+
+func TestPrioritizedStream_ChunksAndCounts(t *testing.T) {
+	p := &priorityPacer{}
+	now := time.Unix(1000, 0)
+	var slept time.Duration
+	rc := &recordingConn{}
+	s := newPrioritizedStream(rc, p, config.ListenPriorityBulk)
+	s.now = func() time.Time { return now }
+	s.sleep = func(d time.Duration) { slept += d; now = now.Add(d) }
+
+	_, err := s.Write(make([]byte, 3*priorityChunk+1))
+	require.NoError(t, err)
+	assert.Equal(t, []int{priorityChunk, priorityChunk, priorityChunk, 1}, rc.writes)
+	assert.Zero(t, slept, "no interactive stream, no pacing")
+
+	other := newPrioritizedStream(&recordingConn{}, p, config.ListenPriorityAuto)
+	assert.Equal(t, 1, p.interactive)
+	_, err = s.Write(make([]byte, 64*priorityChunk))
+	require.NoError(t, err)
+	assert.Positive(t, slept, "paced while the other stream is interactive")
+
+	other.done()
+	s.done()
+	assert.Zero(t, p.interactive)
+}
+
+// slowLink emulates an uplink of rate bytes/s behind a queue of queueBytes:
+// writes return as soon as they fit the queue, as they do into a socket
+// buffer, and the queue drains to the real connection at the link rate.
+type slowLink struct {
+	net.Conn
+	rate      int
+	queueSize int
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []byte
+	closed bool
+}
+
+func newSlowLink(c net.Conn, rate, queueBytes int) *slowLink {
+	l := &slowLink{Conn: c, rate: rate, queueSize: queueBytes}
+	l.cond = sync.NewCond(&l.mu)
+	go l.drain()
+	return l
+}
+
+func (l *slowLink) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	written := 0
+	for written < len(p) {
+		for len(l.queue) >= l.queueSize && !l.closed {
+			l.cond.Wait()
+		}
+		if l.closed {
+			return written, net.ErrClosed
+		}
+		n := min(len(p)-written, l.queueSize-len(l.queue))
+		l.queue = append(l.queue, p[written:written+n]...)
+		written += n
+		l.cond.Broadcast()
+	}
+	return written, nil
+}
+
+func (l *slowLink) drain() {
+	const tick = 5 * time.Millisecond
+	per := l.rate * int(tick/time.Millisecond) / 1000
+	for range time.Tick(tick) {
+		l.mu.Lock()
+		if l.closed {
+			l.mu.Unlock()
+			return
+		}
+		n := min(per, len(l.queue))
+		out := append([]byte(nil), l.queue[:n]...)
+		l.queue = l.queue[n:]
+		l.cond.Broadcast()
+		l.mu.Unlock()
+		if n > 0 {
+			if _, err := l.Conn.Write(out); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (l *slowLink) Close() error {
+	l.mu.Lock()
+	l.closed = true
+	l.cond.Broadcast()
+	l.mu.Unlock()
+	return l.Conn.Close()
+}
+
+// startSinkBackend discards what it receives.
+func startSinkBackend(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				_, _ = io.Copy(io.Discard, c)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// TestListen_InteractiveRTTDuringBulkUpload runs an upload and an echo
+// session through one listen-mode session over a 2 MiB/s uplink with a
+// 512 KiB queue, which alone would hold each keystroke for a quarter of a
+// second.
+func TestListen_InteractiveRTTDuringBulkUpload(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs a timed transfer")
+	}
+	const (
+		link  = 2 << 20
+		queue = 512 << 10
+		bound = 100 * time.Millisecond
+	)
+	echo := startTCPEchoBackend(t)
+	sink := startSinkBackend(t)
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	tun := stub.AddTunnel("tcp", "127.0.0.1:0")
+
+	rt := e2eRuntime()
+	mgr := NewManager(stub.URL, tun.ID, "", 10*time.Millisecond, 50*time.Millisecond, rt)
+	defer mgr.Close()
+	dial := mgr.endpoint.dialNet
+	mgr.endpoint.dialNet = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		c, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return newSlowLink(c, link, queue), nil
+	}
+
+	listen := func(dst string) string {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		t.Cleanup(func() { ln.Close() })
+		go func() { _ = serveListener(ln, mgr, newListenForwarder(tun.ID, dst, rt, config.EncryptionSettings{})) }()
+		return ln.Addr().String()
+	}
+	bulkAddr, echoAddr := listen(sink), listen(echo)
+
+	bulk, err := net.Dial("tcp", bulkAddr)
+	require.NoError(t, err)
+	defer bulk.Close()
+	go func() {
+		buf := make([]byte, 64<<10)
+		for {
+			if _, err := bulk.Write(buf); err != nil {
+				return
+			}
+		}
+	}()
+	// Let the upload turn bulk and teach the pacer the link rate.
+	time.Sleep(2 * time.Second)
+
+	c, err := net.Dial("tcp", echoAddr)
+	require.NoError(t, err)
+	defer c.Close()
+	rtt := func() time.Duration {
+		start := time.Now()
+		_, err := c.Write([]byte("k"))
+		require.NoError(t, err)
+		require.NoError(t, c.SetReadDeadline(time.Now().Add(10*time.Second)))
+		_, err = io.ReadFull(c, make([]byte, 1))
+		require.NoError(t, err)
+		return time.Since(start)
+	}
+	rtt() // opens the stream; the queue drains from here
+	time.Sleep(2 * time.Second)
+	var samples []time.Duration
+	for range 30 {
+		samples = append(samples, rtt())
+		time.Sleep(30 * time.Millisecond)
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	p90 := samples[len(samples)*9/10]
+	t.Logf("echo RTT during upload: median %s, p90 %s, bulk cap %.0f KiB/s", samples[len(samples)/2], p90, mgr.priority.bulkRate()/1024)
+	assert.Less(t, p90, bound, "keystrokes are not queued behind the upload")
+	assert.Positive(t, mgr.priority.bulkRate(), "the upload is capped while the echo session is open")
+}
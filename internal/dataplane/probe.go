@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/gorilla/websocket"
+	dtls "github.com/pion/dtls/v3"
+)
+
+// diagnoseTunnelID is the tunnel_id of probe handshakes; no tunnel has it,
+// so a server that completes the upgrade closes the session right away.
+const diagnoseTunnelID = "diagnose-probe"
+
+// ProbeWS attempts the data-plane WebSocket upgrade without a tunnel. A
+// refused upgrade still proves the path works up to HTTP; status is the
+// response code when the server answered.
+func ProbeWS(ctx context.Context, serverURL string) (status int, err error) {
+	wsURL, origin, err := buildWebSocketURL(serverURL, diagnoseTunnelID, "")
+	if err != nil {
+		return 0, err
+	}
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, wsURL, dialHeaders(origin, ""))
+	if resp != nil {
+		status = resp.StatusCode
+		if resp.Body != nil {
+			resp.Body.Close()
+		}
+	}
+	if err != nil {
+		return status, fmt.Errorf("ws dial: %w", err)
+	}
+	conn.Close()
+	return status, nil
+}
+
+// ProbeQUIC completes a QUIC handshake with the server's UDP data plane.
+func ProbeQUIC(ctx context.Context, serverURL, port string) error {
+	qc, err := dialQUICConnectionContext(ctx, newEndpointSelector(serverURL, ""), port, true)
+	if err != nil {
+		return err
+	}
+	return qc.CloseWithError(0, "diagnose")
+}
+
+// ProbeDTLS completes a DTLS handshake with the server's UDP data plane.
+func ProbeDTLS(ctx context.Context, serverURL, port string) error {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return err
+	}
+	uaddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return err
+	}
+	conn, err := dtls.DialWithOptions(
+		"udp", uaddr,
+		dtls.WithInsecureSkipVerify(false),
+		dtls.WithExtendedMasterSecret(dtls.RequireExtendedMasterSecret),
+		dtls.WithServerName(u.Hostname()),
+	)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.HandshakeContext(ctx)
+}
@@ -0,0 +1,37 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/testsupport"
+)
+
+func TestProbeWS_ReportsServerAnswer(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+
+	status, err := ProbeWS(context.Background(), stub.URL)
+	require.Error(t, err, "no tunnel has the probe's id")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	_, err = ProbeWS(context.Background(), "ftp://example.com")
+	require.ErrorContains(t, err, "unsupported server scheme")
+}
+
+func TestProbeQUICAndDTLS_HonorContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	require.Error(t, ProbeQUIC(ctx, "https://127.0.0.1", "1"))
+	require.Error(t, ProbeDTLS(ctx, "https://127.0.0.1", "1"))
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
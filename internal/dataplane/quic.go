@@ -7,18 +7,25 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"log"
 	"net"
-	"net/url"
 	"time"
 
 	"github.com/quic-go/quic-go"
+
+	"github.com/fortunnels/client/internal/support"
 )
 
 const udpReadPollInterval = time.Second
 
-// startQUICDataPlaneUDP listens on udpListen and forwards via QUIC datagrams, receiving replies
-func StartQUICDataPlaneUDP(serverURL, quicPort, tunnelID, authToken, udpDst, udpListen string) error {
+// quicALPN is the ALPN protocol of the server's QUIC listener.
+const quicALPN = "fortunnels-quic"
+
+// StartQUICDataPlaneUDP listens on udpListen and forwards via QUIC datagrams,
+// receiving replies, until the connection fails or ctx is done. The QUIC
+// connection goes to pinnedIP when set (see RuntimeSettings.PinnedIP).
+func StartQUICDataPlaneUDP(ctx context.Context, serverURL, pinnedIP, quicPort, tunnelID, authToken, udpDst, udpListen string, queueSize int) error {
 	laddr, err := net.ResolveUDPAddr("udp", udpListen)
 	if err != nil {
 		return err
@@ -29,7 +36,7 @@ func StartQUICDataPlaneUDP(serverURL, quicPort, tunnelID, authToken, udpDst, udp
 	}
 	defer uc.Close()
 
-	qc, err := dialQUICConnection(serverURL, quicPort, true)
+	qc, err := dialQUICConnectionContext(ctx, newEndpointSelector(serverURL, pinnedIP), quicPort, true)
 	if err != nil {
 		return err
 	}
@@ -39,23 +46,73 @@ func StartQUICDataPlaneUDP(serverURL, quicPort, tunnelID, authToken, udpDst, udp
 		}
 	}()
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
+	// Unblock the local read right away instead of at its next poll.
+	defer context.AfterFunc(ctx, func() { _ = uc.SetReadDeadline(time.Now()) })()
 
 	flows := newFlowRegistry()
-	startQUICDatagramReceiver(ctx, cancel, qc, uc, flows)
-	return forwardUDPPacketsOverQUIC(ctx, cancel, qc, uc, tunnelID, authToken, udpDst, flows)
+	toTunnel := newPacketQueue[[]byte](queueSize, "local->tunnel").withMemory(udpQueueMemory, datagramSize)
+	toLocal := newPacketQueue[udpDatagram](queueSize, "tunnel->local").withMemory(udpQueueMemory, udpDatagramSize)
+	defer toTunnel.close()
+	defer toLocal.close()
+	go toTunnel.reportDrops(udpDropReportInterval)
+	go toLocal.reportDrops(udpDropReportInterval)
+	startQUICDatagramSender(cancel, qc, toTunnel)
+	startQUICDatagramReceiver(ctx, cancel, qc, flows, toLocal)
+	startUDPLocalWriter(uc, toLocal)
+	return forwardUDPPacketsOverQUIC(ctx, cancel, uc, tunnelID, authToken, udpDst, flows, toTunnel)
+}
+
+const quicSendErrorFormat = "[WARN] quic send datagram: %v"
+
+// startQUICDatagramSender drains encoded frames from q into the QUIC connection.
+func startQUICDatagramSender(cancel context.CancelFunc, qc *quic.Conn, q *packetQueue[[]byte]) {
+	go func() {
+		defer support.RecoverAs(func(p *support.PanicError) {
+			support.ReportPanic(support.PanicScope{Role: "quic datagram sender"}, p)
+			cancel()
+		})
+		for {
+			b, ok := q.pop()
+			if !ok {
+				return
+			}
+			if err := qc.SendDatagram(b); err != nil {
+				support.RepeatLogs.Printf(support.LogKey(quicSendErrorFormat, support.ErrorClass(err)), quicSendErrorFormat, err)
+				q.close()
+				cancel()
+				return
+			}
+		}
+	}()
+}
+
+// startUDPLocalWriter delivers queued replies to their local peers.
+func startUDPLocalWriter(uc *net.UDPConn, q *packetQueue[udpDatagram]) {
+	go func() {
+		defer support.Recover(support.PanicScope{Role: "udp local writer"})
+		for {
+			d, ok := q.pop()
+			if !ok {
+				return
+			}
+			//nolint:errcheck // best-effort UDP forward
+			_, _ = uc.WriteToUDP(d.data, d.addr)
+		}
+	}()
 }
 
 func startQUICDatagramReceiver(
 	ctx context.Context,
 	cancel context.CancelFunc,
 	qc *quic.Conn,
-	uc *net.UDPConn,
 	flows *flowRegistry,
+	q *packetQueue[udpDatagram],
 ) {
 	go func() {
 		defer cancel()
+		defer support.Recover(support.PanicScope{Role: "quic datagram receiver"})
 		for {
 			if ctx.Err() != nil {
 				return
@@ -72,21 +129,22 @@ func startQUICDatagramReceiver(
 			}
 			if json.Unmarshal(b, &fr) == nil && fr.Protocol == "udp" && len(fr.Data) > 0 {
 				if ra, ok := flows.get(fr.FlowID); ok {
-					//nolint:errcheck // best-effort UDP forward
-					_, _ = uc.WriteToUDP(fr.Data, ra)
+					q.push(udpDatagram{data: fr.Data, addr: ra})
 				}
 			}
 		}
 	}()
 }
 
+// forwardUDPPacketsOverQUIC reads local datagrams and queues them as QUIC
+// frames on q; when the sender falls behind the oldest frames are dropped.
 func forwardUDPPacketsOverQUIC(
 	ctx context.Context,
 	cancel context.CancelFunc,
-	qc *quic.Conn,
 	uc *net.UDPConn,
 	tunnelID, authToken, udpDst string,
 	flows *flowRegistry,
+	q *packetQueue[[]byte],
 ) error {
 	buf := make([]byte, udpDatagramMaxSize)
 	for {
@@ -109,26 +167,28 @@ func forwardUDPPacketsOverQUIC(
 		}
 		flowID := raddr.String()
 		flows.set(flowID, raddr)
-		frame := map[string]interface{}{
-			"tunnel_id": tunnelID,
-			"flow_id":   flowID,
-			"protocol":  "udp",
-			"data":      buf[:n],
-			"dst":       udpDst,
-			"auth":      authToken,
-		}
-		b, err := json.Marshal(frame)
+		b, err := encodeQUICDatagram(tunnelID, flowID, authToken, udpDst, buf[:n])
 		if err != nil {
 			cancel()
 			return err
 		}
-		if err := qc.SendDatagram(b); err != nil {
-			cancel()
-			return err
-		}
+		q.push(b)
 	}
 }
 
+// encodeQUICDatagram encodes one local datagram of flowID as a QUIC
+// datagram frame.
+func encodeQUICDatagram(tunnelID, flowID, authToken, udpDst string, data []byte) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"tunnel_id": tunnelID,
+		"flow_id":   flowID,
+		"protocol":  "udp",
+		"data":      data,
+		"dst":       udpDst,
+		"auth":      authToken,
+	})
+}
+
 func timeFromContext(ctx context.Context) time.Time {
 	if deadline, ok := ctx.Deadline(); ok {
 		return deadline
@@ -137,20 +197,38 @@ func timeFromContext(ctx context.Context) time.Time {
 }
 
 func dialQUICConnection(serverURL, port string, enableDatagrams bool) (*quic.Conn, error) {
-	u, err := url.Parse(serverURL)
-	if err != nil {
-		return nil, err
+	return dialQUICConnectionContext(context.Background(), newEndpointSelector(serverURL, ""), port, enableDatagrams)
+}
+
+// dialQUICConnectionContext dials the server's QUIC port through ep. A QUIC
+// connection is dialed once per run, so failed dials to a pinned IP are
+// retried right away until ep drops the pin.
+func dialQUICConnectionContext(ctx context.Context, ep *endpointSelector, port string, enableDatagrams bool) (*quic.Conn, error) {
+	quicCfg := &quic.Config{}
+	if enableDatagrams {
+		quicCfg.EnableDatagrams = true
+	}
+	return dialQUICWithConfig(ctx, ep, port, quicCfg)
+}
+
+// dialQUICWithConfig is dialQUICConnectionContext with the QUIC settings of
+// the caller.
+func dialQUICWithConfig(ctx context.Context, ep *endpointSelector, port string, quicCfg *quic.Config) (*quic.Conn, error) {
+	if ep.host == "" {
+		return nil, errors.New("invalid server url")
 	}
-	host := net.JoinHostPort(u.Hostname(), port)
 	tlsConf := &tls.Config{
 		InsecureSkipVerify: false,
 		MinVersion:         tls.VersionTLS12,
-		NextProtos:         []string{"fortunnels-quic"},
-		ServerName:         u.Hostname(),
+		NextProtos:         []string{quicALPN},
+		ServerName:         ep.host,
 	}
-	quicCfg := &quic.Config{}
-	if enableDatagrams {
-		quicCfg.EnableDatagrams = true
+	for {
+		addr, ip := ep.quicAddr(port)
+		qc, err := quic.DialAddr(ctx, addr, tlsConf, quicCfg)
+		ep.observe(ip, err)
+		if err == nil || ip == "" || ctx.Err() != nil {
+			return qc, err
+		}
 	}
-	return quic.DialAddr(context.Background(), host, tlsConf, quicCfg)
 }
@@ -0,0 +1,290 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/support"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+// quicServeDialTimeout bounds dialing and registering one QUIC connection.
+const quicServeDialTimeout = 10 * time.Second
+
+const quicServeRetryFormat = "[WARN] QUIC data-plane dial failed: %v (retry in %s)"
+
+// QUICManager keeps the QUIC connection an http/https tunnel is served on
+// (--dp quic). It is the QUIC counterpart of Manager: a failed connection is
+// redialed with the same backoff.
+type QUICManager struct {
+	tunnelID    string
+	dpAuthToken string
+	settings    config.RuntimeSettings
+	boInit      time.Duration
+	boMax       time.Duration
+	// endpoint pins dials to the control plane's server IP.
+	endpoint *endpointSelector
+	// clock times reconnect backoff.
+	clock support.Clock
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu   sync.Mutex
+	conn *quic.Conn
+	// ready is closed once the first connection is registered.
+	ready chan struct{}
+
+	// dial is replaced by tests to reach a server with a self-signed
+	// certificate.
+	dial func(ctx context.Context) (*quic.Conn, error)
+}
+
+// NewQUICTunnelManager returns the QUICManager of a tunnel, with reconnect
+// backoff from 1s to 30s like NewTunnelManager.
+func NewQUICTunnelManager(serverURL, tunnelID, dpAuthToken string, settings config.RuntimeSettings) *QUICManager {
+	return NewQUICManager(serverURL, tunnelID, dpAuthToken, time.Second, 30*time.Second, settings)
+}
+
+func NewQUICManager(serverURL, tunnelID, dpAuthToken string, boInit, boMax time.Duration, settings config.RuntimeSettings) *QUICManager {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &QUICManager{
+		tunnelID:    tunnelID,
+		dpAuthToken: dpAuthToken,
+		settings:    settings,
+		boInit:      boInit,
+		boMax:       boMax,
+		endpoint:    newEndpointSelector(serverURL, settings.PinnedIP),
+		clock:       support.RealClock,
+		ctx:         ctx,
+		cancel:      cancel,
+		ready:       make(chan struct{}),
+	}
+	m.dial = func(ctx context.Context) (*quic.Conn, error) {
+		// The connection idles between requests; keep it alive like the
+		// smux session of the WebSocket data plane.
+		return dialQUICWithConfig(ctx, m.endpoint, settings.QUICPortString(), &quic.Config{
+			KeepAlivePeriod: settings.SmuxKeepAliveInterval,
+			MaxIdleTimeout:  settings.SmuxKeepAliveTimeout,
+		})
+	}
+	return m
+}
+
+// Connect dials and registers a connection once, without retrying; --dp auto
+// uses it to find out whether the server can be reached over QUIC.
+func (m *QUICManager) Connect() error {
+	_, err := m.connect()
+	return err
+}
+
+// EnsureConn returns the registered connection, dialing a new one with
+// backoff while there is none.
+func (m *QUICManager) EnsureConn() (*quic.Conn, error) {
+	backoff := m.boInit
+	failures := 0
+	for {
+		if m.ctx.Err() != nil {
+			return nil, errors.New("stopped")
+		}
+		if qc := m.current(); qc != nil {
+			return qc, nil
+		}
+		qc, err := m.connect()
+		if err == nil {
+			if failures > 0 {
+				support.RepeatLogs.Transition(support.LogKey(quicServeRetryFormat), "[INFO] QUIC data-plane connection re-established after %d failed attempts", failures)
+			}
+			return qc, nil
+		}
+		if m.ctx.Err() != nil {
+			return nil, errors.New("stopped")
+		}
+		failures++
+		wait := backoff
+		backoff = nextBackoff(backoff, m.boMax)
+		support.RepeatLogs.Printf(support.LogKey(quicServeRetryFormat, support.ErrorClass(err)), quicServeRetryFormat, err, wait)
+		sleepReconnectBackoff(m.clock, m.ctx.Done(), wait)
+	}
+}
+
+// current returns the registered connection while it is alive.
+func (m *QUICManager) current() *quic.Conn {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.conn != nil && m.conn.Context().Err() == nil {
+		return m.conn
+	}
+	return nil
+}
+
+func (m *QUICManager) connect() (*quic.Conn, error) {
+	ctx, cancel := context.WithTimeout(m.ctx, quicServeDialTimeout)
+	defer cancel()
+	qc, err := m.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := registerQUICServe(ctx, qc, m.tunnelID, m.dpAuthToken, m.settings.InstanceID); err != nil {
+		_ = qc.CloseWithError(0, "")
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ctx.Err() != nil {
+		_ = qc.CloseWithError(0, "")
+		return nil, errors.New("stopped")
+	}
+	if m.conn != nil {
+		_ = m.conn.CloseWithError(0, "")
+	}
+	m.conn = qc
+	info := processSessions.established(quicSessionInfo(m.tunnelID, m.settings))
+	logDebug("data-plane session established: %s", info)
+	select {
+	case <-m.ready:
+	default:
+		close(m.ready)
+	}
+	return qc, nil
+}
+
+// registerQUICServe asks the server to serve tunnelID on qc and waits for its
+// setup ack.
+func registerQUICServe(ctx context.Context, qc *quic.Conn, tunnelID, authToken, instanceID string) error {
+	preface, err := clientPreface(map[string]string{"proto": protocolv1.ProtoServe, "tunnel_id": tunnelID, "auth": authToken}, prefaceMeta{instanceID: instanceID})
+	if err != nil {
+		return err
+	}
+	st, err := qc.OpenStreamSync(ctx)
+	if err != nil {
+		return fmt.Errorf("open serve stream: %w", err)
+	}
+	defer quicStream{st}.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = st.SetDeadline(deadline)
+	}
+	if _, err := st.Write(preface); err != nil {
+		return fmt.Errorf("write serve preface: %w", err)
+	}
+	line, err := bufio.NewReader(st).ReadBytes('\n')
+	if err != nil {
+		return fmt.Errorf("read serve ack: %w", err)
+	}
+	var ack struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(line, &ack); err != nil {
+		return fmt.Errorf("decode serve ack: %w", err)
+	}
+	if !ack.OK {
+		return fmt.Errorf("server refused QUIC serving: %s", support.SanitizeRemote(ack.Error))
+	}
+	return nil
+}
+
+// Done is closed once m is closed.
+func (m *QUICManager) Done() <-chan struct{} {
+	return m.ctx.Done()
+}
+
+// Ready is closed once m registered its first connection.
+func (m *QUICManager) Ready() <-chan struct{} {
+	return m.ready
+}
+
+func (m *QUICManager) isStopped() bool {
+	return m.ctx.Err() != nil
+}
+
+// Close stops redialing and closes the connection with its streams.
+func (m *QUICManager) Close() {
+	m.cancel()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.conn != nil {
+		_ = m.conn.CloseWithError(0, "")
+		m.conn = nil
+	}
+}
+
+// ServeIncomingQUIC serves the incoming streams of an http/https tunnel on
+// mgr's QUIC connection: the server opens one stream per public connection,
+// with the same preface as on the WebSocket data plane. A failed connection
+// is redialed until mgr is closed.
+func ServeIncomingQUIC(mgr *QUICManager, reporter BackendStateReporter) error {
+	scope := support.PanicScope{Role: "QUIC incoming stream loop", TunnelID: mgr.tunnelID}
+	return support.Supervise(scope, mgr.Done(), func() error {
+		return serveIncomingQUIC(mgr, reporter)
+	})
+}
+
+// serveIncomingQUIC is ServeIncomingQUIC without the supervision.
+func serveIncomingQUIC(mgr *QUICManager, reporter BackendStateReporter) error {
+	server, err := newIncomingStreamServer(mgr.tunnelID, mgr.settings, reporter)
+	if err != nil {
+		return err
+	}
+	defer server.followLiveSettings()()
+	defer server.keepAlive.closeIdle()
+	for {
+		qc, err := mgr.EnsureConn()
+		if err != nil {
+			return err
+		}
+		for {
+			st, err := qc.AcceptStream(mgr.ctx)
+			if err != nil {
+				break
+			}
+			go server.serveLogged(quicStream{st})
+		}
+		if mgr.isStopped() {
+			return errors.New("stopped")
+		}
+		// Make sure EnsureConn redials even if only accepting failed.
+		_ = qc.CloseWithError(0, "")
+		mgr.clock.Sleep(reconnectRetryDelay)
+	}
+}
+
+// ServeIncomingPreferQUIC is ServeIncomingQUIC when the first QUIC dial
+// succeeds, and ServeIncoming on mgr's WebSocket sessions when it fails
+// (--dp auto). Once a QUIC connection worked, later failures are redialed
+// over QUIC.
+func ServeIncomingPreferQUIC(qm *QUICManager, mgr *Manager, reporter BackendStateReporter) error {
+	if err := qm.Connect(); err != nil {
+		log.Printf("[INFO] QUIC data plane unavailable (%v); serving over the WebSocket data plane", err)
+		qm.Close()
+		return ServeIncoming(mgr, reporter)
+	}
+	return ServeIncomingQUIC(qm, reporter)
+}
+
+// quicStream gives a QUIC stream the close semantics of an smux stream:
+// Close ends both directions, CloseWrite only the sending one.
+type quicStream struct {
+	*quic.Stream
+}
+
+func (s quicStream) Close() error {
+	s.CancelRead(0)
+	return s.Stream.Close()
+}
+
+func (s quicStream) CloseWrite() error {
+	return s.Stream.Close()
+}
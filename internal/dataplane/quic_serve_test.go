@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/testsupport"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+// insecureQUICDial dials the stub's QUIC listener, whose certificate is
+// self-signed.
+func insecureQUICDial(port int) func(ctx context.Context) (*quic.Conn, error) {
+	return func(ctx context.Context) (*quic.Conn, error) {
+		return quic.DialAddr(ctx, net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), &tls.Config{
+			InsecureSkipVerify: true, //nolint:gosec // the stub's self-signed certificate
+			NextProtos:         []string{quicALPN},
+		}, &quic.Config{KeepAlivePeriod: time.Second})
+	}
+}
+
+func startPageBackend(t *testing.T) string {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "page "+r.URL.Path)
+	}))
+	t.Cleanup(backend.Close)
+	return backend.Listener.Addr().String()
+}
+
+func getPage(t *testing.T, public net.Listener, path string) string {
+	t.Helper()
+	client := &http.Client{Timeout: 5 * time.Second}
+	defer client.CloseIdleConnections()
+	resp, err := client.Get("http://" + public.Addr().String() + path)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	return string(body)
+}
+
+func TestE2E_ServeIncomingQUIC_ServesAndReconnects(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	port, err := stub.ServeQUIC()
+	require.NoError(t, err)
+	tun := stub.AddTunnel("http", startPageBackend(t))
+
+	rt := e2eRuntime()
+	rt.InstanceID = "instance-a"
+	qm := NewQUICManager(stub.URL, tun.ID, "dp-token", 10*time.Millisecond, 50*time.Millisecond, rt)
+	qm.dial = insecureQUICDial(port)
+	errCh := make(chan error, 1)
+	go func() { errCh <- ServeIncomingQUIC(qm, nil) }()
+
+	require.NoError(t, stub.WaitQUICConns(tun.ID, 1, 5*time.Second))
+	assert.Equal(t, "dp-token", stub.QUICAuth(tun.ID))
+	pre := stub.ClientPrefaces(tun.ID)[0]
+	assert.Equal(t, protocolv1.ProtoServe, pre["proto"])
+	assert.Equal(t, "instance-a", pre[protocolv1.PrefaceClientInstance])
+
+	public, err := stub.ServePublic(tun.ID)
+	require.NoError(t, err)
+	defer public.Close()
+	assert.Equal(t, "page /index.html", getPage(t, public, "/index.html"))
+	assert.Equal(t, 0, stub.SessionCount(tun.ID), "no WebSocket data plane is dialed")
+
+	stub.DropQUICConns(tun.ID)
+	require.NoError(t, stub.WaitQUICConns(tun.ID, 2, 5*time.Second), "client should redial after the drop")
+	assert.Equal(t, "page /after", getPage(t, public, "/after"))
+
+	qm.Close()
+	select {
+	case err := <-errCh:
+		require.EqualError(t, err, "stopped")
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve loop did not stop after Close")
+	}
+}
+
+func TestQUICManager_RegistrationRefused(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	port, err := stub.ServeQUIC()
+	require.NoError(t, err)
+
+	qm := NewQUICManager(stub.URL, "no-such-tunnel", "", 10*time.Millisecond, 50*time.Millisecond, e2eRuntime())
+	defer qm.Close()
+	qm.dial = insecureQUICDial(port)
+	require.ErrorContains(t, qm.Connect(), "server refused QUIC serving: unknown tunnel")
+	assert.Nil(t, qm.current())
+}
+
+// TestE2E_ServeIncomingPreferQUIC_FallsBackToWS: the stub's certificate does
+// not verify, so the QUIC dial fails and --dp auto serves over WS instead.
+func TestE2E_ServeIncomingPreferQUIC_FallsBackToWS(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	port, err := stub.ServeQUIC()
+	require.NoError(t, err)
+	tun := stub.AddTunnel("http", startPageBackend(t))
+
+	rt := e2eRuntime()
+	rt.QUICPort = port
+	qm := NewQUICManager(stub.URL, tun.ID, "", 10*time.Millisecond, 50*time.Millisecond, rt)
+	mgr := NewManager(stub.URL, tun.ID, "", 10*time.Millisecond, 50*time.Millisecond, rt)
+	defer mgr.Close()
+	go func() { _ = ServeIncomingPreferQUIC(qm, mgr, nil) }()
+
+	require.NoError(t, stub.WaitSessions(tun.ID, 1, 5*time.Second))
+	public, err := stub.ServePublic(tun.ID)
+	require.NoError(t, err)
+	defer public.Close()
+	assert.Equal(t, "page /", getPage(t, public, "/"))
+	assert.Equal(t, 0, stub.QUICConns(tun.ID))
+	select {
+	case <-qm.Done():
+	default:
+		t.Fatal("the QUIC manager is closed after falling back")
+	}
+}
@@ -28,7 +28,7 @@ func TestForwardUDPPacketsOverQUIC_ContextCancel(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	done := make(chan error, 1)
 	go func() {
-		done <- forwardUDPPacketsOverQUIC(ctx, cancel, nil, uc, "t1", "auth", "127.0.0.1:53", newFlowRegistry())
+		done <- forwardUDPPacketsOverQUIC(ctx, cancel, uc, "t1", "auth", "127.0.0.1:53", newFlowRegistry(), newPacketQueue[[]byte](8, "test"))
 	}()
 
 	time.Sleep(20 * time.Millisecond)
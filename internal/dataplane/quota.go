@@ -0,0 +1,301 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// quotaDrainPoll is how often a drain checks whether the open streams ended.
+const quotaDrainPoll = 50 * time.Millisecond
+
+// payloadTooLarge is what an http tunnel answers when a request hits a byte
+// limit before its response began.
+const payloadTooLarge = "HTTP/1.1 413 Payload Too Large\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Length: 45\r\n" +
+	"Connection: close\r\n" +
+	"\r\n" +
+	"request exceeds the tunnel's byte limit (413)"
+
+// ErrByteLimit is matched by the errors of streams ended by
+// --max-bytes-per-stream or --max-bytes-total.
+var ErrByteLimit = errors.New("byte limit reached")
+
+// byteLimitError names the flag whose limit ended a stream.
+type byteLimitError struct {
+	flag  string
+	limit int64
+}
+
+func (e *byteLimitError) Error() string {
+	return fmt.Sprintf("%s limit of %d bytes reached", e.flag, e.limit)
+}
+
+func (e *byteLimitError) Unwrap() error { return ErrByteLimit }
+
+// processQuota enforces --max-bytes-per-stream and --max-bytes-total on
+// every serving-mode stream of this process; like processTraffic it is the
+// per-tunnel counter.
+var processQuota byteQuota
+
+// SetByteLimits sets the hard byte limits of the serving modes: perStream for
+// each stream and total for the tunnel, both directions together; 0 is
+// unlimited.
+func SetByteLimits(perStream, total int64) {
+	processQuota.setLimits(perStream, total)
+}
+
+// ByteLimitReached returns a channel closed once the tunnel moved its
+// --max-bytes-total; from then on new streams are refused.
+func ByteLimitReached() <-chan struct{} {
+	return processQuota.reached()
+}
+
+// DrainByteLimited waits up to grace for the streams open when the total
+// limit was reached to end, and reports how many are still open.
+func DrainByteLimited(grace time.Duration) int64 {
+	return processQuota.drain(grace)
+}
+
+// byteQuota counts the bytes of its streams against the limits. A nil
+// byteQuota is unlimited.
+type byteQuota struct {
+	perStream atomic.Int64
+	total     atomic.Int64
+	// used is the tunnel's bytes so far; active is the gauge of open streams.
+	used   atomic.Int64
+	active atomic.Int64
+
+	// hit is set once used reached total; exhausted is closed then.
+	hit atomic.Bool
+
+	mu        sync.Mutex
+	exhausted chan struct{}
+}
+
+func (q *byteQuota) setLimits(perStream, total int64) {
+	q.perStream.Store(perStream)
+	q.total.Store(total)
+	q.used.Store(0)
+	q.hit.Store(false)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.exhausted = make(chan struct{})
+}
+
+func (q *byteQuota) reached() <-chan struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.exhausted == nil {
+		q.exhausted = make(chan struct{})
+	}
+	return q.exhausted
+}
+
+// markReached sets hit and closes the exhausted channel, once.
+func (q *byteQuota) markReached() {
+	if !q.hit.CompareAndSwap(false, true) {
+		return
+	}
+	q.mu.Lock()
+	if q.exhausted == nil {
+		q.exhausted = make(chan struct{})
+	}
+	close(q.exhausted)
+	q.mu.Unlock()
+	log.Printf("[WARN] tunnel moved %d bytes, its --max-bytes-total limit: refusing new streams, draining %d open", q.used.Load(), q.active.Load())
+}
+
+// admit returns the total limit's error once the tunnel reached it.
+func (q *byteQuota) admit() error {
+	if q == nil || !q.hit.Load() {
+		return nil
+	}
+	return &byteLimitError{flag: "--max-bytes-total", limit: q.total.Load()}
+}
+
+// newStream counts one stream until its release; nil for a nil quota.
+func (q *byteQuota) newStream() *streamQuota {
+	if q == nil {
+		return nil
+	}
+	q.active.Add(1)
+	return &streamQuota{quota: q}
+}
+
+// drain polls until no stream is open or grace is over and returns the
+// streams still open.
+func (q *byteQuota) drain(grace time.Duration) int64 {
+	deadline := time.Now().Add(grace)
+	for {
+		open := q.active.Load()
+		if open <= 0 || !time.Now().Before(deadline) {
+			return max(open, 0)
+		}
+		time.Sleep(min(quotaDrainPoll, time.Until(deadline)))
+	}
+}
+
+// Response states of a streamQuota with a reply writer.
+const (
+	replyNone int32 = iota
+	replyStarted
+	replyRefused
+)
+
+// streamQuota is one stream's share of a byteQuota. A nil streamQuota is
+// unlimited.
+type streamQuota struct {
+	quota    *byteQuota
+	used     atomic.Int64
+	released atomic.Bool
+	// reply, when set, receives payloadTooLarge if the request direction
+	// hits a limit before the response began; state tracks which came first.
+	reply io.Writer
+	state atomic.Int32
+	err   atomic.Pointer[byteLimitError]
+}
+
+// release ends the stream's count in the quota's gauge.
+func (s *streamQuota) release() {
+	if s != nil && s.released.CompareAndSwap(false, true) {
+		s.quota.active.Add(-1)
+	}
+}
+
+// take reserves up to n bytes and returns how many it got; fewer than n come
+// with the error of the limit that was reached.
+func (s *streamQuota) take(n int) (int, error) {
+	if s == nil {
+		return n, nil
+	}
+	if err := s.limitErr(); err != nil {
+		return 0, err
+	}
+	want := int64(n)
+	got := reserve(&s.used, s.quota.perStream.Load(), want)
+	var limit *byteLimitError
+	if got < want {
+		limit = &byteLimitError{flag: "--max-bytes-per-stream", limit: s.quota.perStream.Load()}
+	}
+	total := s.quota.total.Load()
+	if all := reserve(&s.quota.used, total, got); all < got {
+		s.used.Add(all - got)
+		got, limit = all, &byteLimitError{flag: "--max-bytes-total", limit: total}
+	}
+	if total > 0 && s.quota.used.Load() >= total {
+		s.quota.markReached()
+	}
+	if limit != nil {
+		s.err.CompareAndSwap(nil, limit)
+		return int(got), limit
+	}
+	return n, nil
+}
+
+// takePacket reserves all n bytes of a datagram or none: one that does not
+// fit fails with the limit's error.
+func (s *streamQuota) takePacket(n int) error {
+	k, err := s.take(n)
+	if err != nil {
+		s.giveBack(k)
+	}
+	return err
+}
+
+// limitErr is the error of the limit the stream reached, if any.
+func (s *streamQuota) limitErr() error {
+	if err := s.err.Load(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// giveBack returns n reserved bytes that were not written.
+func (s *streamQuota) giveBack(n int) {
+	if s != nil && n > 0 {
+		s.used.Add(-int64(n))
+		s.quota.used.Add(-int64(n))
+	}
+}
+
+// reserve adds up to n to used without passing limit (0 is unlimited) and
+// returns what it added.
+func reserve(used *atomic.Int64, limit, n int64) int64 {
+	if limit <= 0 {
+		used.Add(n)
+		return n
+	}
+	for {
+		cur := used.Load()
+		got := min(n, max(limit-cur, 0))
+		if got == 0 || used.CompareAndSwap(cur, cur+got) {
+			return got
+		}
+	}
+}
+
+// refuse answers the request with payloadTooLarge unless its response
+// already began.
+func (s *streamQuota) refuse() {
+	if s.reply == nil || !s.state.CompareAndSwap(replyNone, replyRefused) {
+		return
+	}
+	if _, err := io.WriteString(s.reply, payloadTooLarge); err != nil {
+		log.Printf("byte limit refusal: %v", err)
+	}
+}
+
+// startReply reports whether the response may be written: false once the
+// request was refused.
+func (s *streamQuota) startReply() bool {
+	if s == nil || s.reply == nil {
+		return true
+	}
+	return s.state.CompareAndSwap(replyNone, replyStarted) || s.state.Load() == replyStarted
+}
+
+// noReply marks the response as begun by other means, e.g. a WebSocket
+// upgrade, so that a limit no longer answers with payloadTooLarge.
+func (s *streamQuota) noReply() {
+	if s != nil {
+		s.state.Store(replyStarted)
+	}
+}
+
+// quotaWriter counts the bytes written to w in q. A write that would pass a
+// limit writes up to it and fails with the limit's error. toStream marks the
+// response direction of a stream with a reply writer.
+type quotaWriter struct {
+	w        io.Writer
+	q        *streamQuota
+	toStream bool
+}
+
+func (qw quotaWriter) Write(p []byte) (int, error) {
+	if qw.toStream && !qw.q.startReply() {
+		return 0, qw.q.limitErr()
+	}
+	k, limitErr := qw.q.take(len(p))
+	if limitErr != nil && !qw.toStream {
+		qw.q.refuse()
+	}
+	n := 0
+	if k > 0 {
+		var err error
+		n, err = qw.w.Write(p[:k])
+		qw.q.giveBack(k - n)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, limitErr
+}
@@ -0,0 +1,285 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestQuota(perStream, total int64) *byteQuota {
+	q := &byteQuota{}
+	q.setLimits(perStream, total)
+	return q
+}
+
+// startCountingSink accepts TCP connections that read everything and report
+// how many bytes each one received once it ends.
+func startCountingSink(t *testing.T) (addr string, received <-chan int64) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+	ch := make(chan int64, 8)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				n, _ := io.Copy(io.Discard, c)
+				ch <- n
+			}()
+		}
+	}()
+	return ln.Addr().String(), ch
+}
+
+// serveQuotaStreams serves the streams opened on the returned server end
+// with s and reports each serve's result on errs.
+func serveQuotaStreams(t *testing.T, s incomingStreamServer) (server *memSession, errs <-chan error) {
+	t.Helper()
+	client, server := newMemSessionPair()
+	t.Cleanup(func() { _ = client.Close() })
+	ch := make(chan error, 8)
+	go func() {
+		for {
+			st, err := client.AcceptStream()
+			if err != nil {
+				return
+			}
+			go func() { ch <- s.serve(st, newConnLogger()) }()
+		}
+	}()
+	return server, ch
+}
+
+func waitInt(t *testing.T, ch <-chan int64) int64 {
+	t.Helper()
+	select {
+	case n := <-ch:
+		return n
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+		return 0
+	}
+}
+
+func waitErr(t *testing.T, ch <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-ch:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+		return nil
+	}
+}
+
+func TestQuotaWriter_StopsAtPerStreamLimit(t *testing.T) {
+	q := newTestQuota(100, 0)
+	sq := q.newStream()
+	var buf bytes.Buffer
+	w := quotaWriter{w: &buf, q: sq}
+
+	n, err := w.Write(make([]byte, 60))
+	require.NoError(t, err)
+	assert.Equal(t, 60, n)
+	n, err = w.Write(make([]byte, 60))
+	assert.Equal(t, 40, n, "the write is cut at the limit")
+	require.ErrorIs(t, err, ErrByteLimit)
+	assert.EqualError(t, err, "--max-bytes-per-stream limit of 100 bytes reached")
+	n, err = w.Write([]byte{1})
+	assert.Zero(t, n)
+	require.ErrorIs(t, err, ErrByteLimit)
+	assert.Equal(t, 100, buf.Len())
+
+	// The other direction shares the stream's count.
+	_, err = quotaWriter{w: io.Discard, q: sq, toStream: true}.Write([]byte{1})
+	require.ErrorIs(t, err, ErrByteLimit)
+	assert.NoError(t, q.admit(), "a stream limit leaves the tunnel open")
+}
+
+func TestQuotaWriter_TotalSharedByConcurrentStreams(t *testing.T) {
+	const total = 100_000
+	q := newTestQuota(0, total)
+	var written atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sq := q.newStream()
+			defer sq.release()
+			w := quotaWriter{w: io.Discard, q: sq}
+			for {
+				n, err := w.Write(make([]byte, 7))
+				written.Add(int64(n))
+				if err != nil {
+					assert.EqualError(t, err, "--max-bytes-total limit of 100000 bytes reached")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(total), written.Load())
+	select {
+	case <-q.reached():
+	default:
+		t.Fatal("reached is not closed")
+	}
+	require.ErrorIs(t, q.admit(), ErrByteLimit)
+	assert.Zero(t, q.drain(0))
+}
+
+func TestQuotaWriter_NoRefusalOnceResponseBegan(t *testing.T) {
+	sq := newTestQuota(10, 0).newStream()
+	var reply bytes.Buffer
+	sq.reply = &reply
+	_, err := quotaWriter{w: &reply, q: sq, toStream: true}.Write([]byte("HTTP/1.1"))
+	require.NoError(t, err)
+	_, err = quotaWriter{w: io.Discard, q: sq}.Write([]byte("body"))
+	require.ErrorIs(t, err, ErrByteLimit)
+	assert.Equal(t, "HTTP/1.1", reply.String(), "a begun response is not followed by a 413")
+}
+
+func TestPayloadTooLarge_ContentLength(t *testing.T) {
+	_, body, ok := strings.Cut(payloadTooLarge, "\r\n\r\n")
+	require.True(t, ok)
+	assert.Contains(t, payloadTooLarge, "Content-Length: 45\r\n")
+	assert.Len(t, body, 45)
+}
+
+func TestServeIncoming_StreamClosedAtByteLimit(t *testing.T) {
+	backend, received := startCountingSink(t)
+	server, errs := serveQuotaStreams(t, incomingStreamServer{quota: newTestQuota(1000, 0)})
+
+	st, rd, line := openIncoming(t, server, backend)
+	defer st.Close()
+	require.Equal(t, setupAckLine, line)
+	_, err := st.Write(make([]byte, 2500))
+	require.NoError(t, err)
+
+	err = waitErr(t, errs)
+	require.ErrorIs(t, err, ErrByteLimit)
+	assert.Contains(t, err.Error(), "--max-bytes-per-stream limit of 1000 bytes reached")
+	assert.Equal(t, int64(1000), waitInt(t, received), "the backend gets exactly the limit")
+	rest, err := io.ReadAll(rd)
+	require.NoError(t, err, "the stream is closed")
+	assert.Empty(t, rest, "a tcp stream gets no HTTP refusal")
+}
+
+func TestServeIncoming_HTTPRequestOverLimitGets413(t *testing.T) {
+	backend, received := startCountingSink(t)
+	server, errs := serveQuotaStreams(t, incomingStreamServer{httpAware: true, quota: newTestQuota(1000, 0)})
+
+	st, rd, line := openIncoming(t, server, backend)
+	defer st.Close()
+	require.Equal(t, setupAckLine, line)
+	_, err := st.Write([]byte("POST /upload HTTP/1.1\r\nHost: app\r\nContent-Length: 4000\r\n\r\n"))
+	require.NoError(t, err)
+	_, err = st.Write(make([]byte, 4000))
+	require.NoError(t, err)
+
+	require.ErrorIs(t, waitErr(t, errs), ErrByteLimit)
+	resp, err := io.ReadAll(rd)
+	require.NoError(t, err)
+	assert.Equal(t, payloadTooLarge, string(resp))
+	assert.Equal(t, int64(1000), waitInt(t, received))
+}
+
+func TestServeIncoming_TotalLimitRefusesThenDrains(t *testing.T) {
+	backend, received := startCountingSink(t)
+	q := newTestQuota(0, 600)
+	server, errs := serveQuotaStreams(t, incomingStreamServer{quota: q})
+
+	// 1. The first stream moves exactly the total and stays open.
+	first, _, line := openIncoming(t, server, backend)
+	defer first.Close()
+	require.Equal(t, setupAckLine, line)
+	_, err := first.Write(make([]byte, 600))
+	require.NoError(t, err)
+	select {
+	case <-q.reached():
+	case <-time.After(5 * time.Second):
+		t.Fatal("reaching the total did not close reached")
+	}
+
+	// 2. New streams are refused before they reach a backend.
+	second, _, line := openIncoming(t, server, backend)
+	defer second.Close()
+	assert.Contains(t, line, `"ok":false`)
+	assert.Contains(t, line, "--max-bytes-total limit of 600 bytes reached")
+	require.ErrorIs(t, waitErr(t, errs), ErrByteLimit)
+
+	// 3. The drain waits for the open stream, which cannot move more bytes.
+	drained := make(chan int64, 1)
+	go func() { drained <- q.drain(5 * time.Second) }()
+	select {
+	case <-drained:
+		t.Fatal("drain returned while a stream is open")
+	case <-time.After(100 * time.Millisecond):
+	}
+	_, err = first.Write([]byte{1})
+	require.NoError(t, err)
+	require.ErrorIs(t, waitErr(t, errs), ErrByteLimit)
+	assert.Zero(t, waitInt(t, drained))
+	assert.Equal(t, int64(600), waitInt(t, received))
+}
+
+func TestByteQuota_DrainGivesUpAfterGrace(t *testing.T) {
+	q := newTestQuota(0, 10)
+	sq := q.newStream()
+	begin := time.Now()
+	assert.Equal(t, int64(1), q.drain(60*time.Millisecond))
+	assert.GreaterOrEqual(t, time.Since(begin), 60*time.Millisecond)
+	sq.release()
+	sq.release()
+	assert.Zero(t, q.drain(time.Second), "a stream is released once")
+}
+
+func TestStreamToUDPLocal_StopsAtPacketThatPassesLimit(t *testing.T) {
+	uc, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer uc.Close()
+	peer, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer peer.Close()
+
+	var frames bytes.Buffer
+	for i := 0; i < 4; i++ {
+		require.NoError(t, writeUDPPacket(&frames, bytes.Repeat([]byte{byte('a' + i)}, 30)))
+	}
+	errCh := make(chan error, 2)
+	var lastSrcMu sync.RWMutex
+	lastSrc := peer.LocalAddr().(*net.UDPAddr)
+	q := newTestQuota(100, 0)
+	startStreamToUDPLocalQueued(&frames, uc, errCh, &lastSrcMu, &lastSrc, newPacketQueue[[]byte](8, "tunnel->local"), q.newStream())
+
+	require.ErrorIs(t, waitErr(t, errCh), ErrByteLimit)
+	require.NoError(t, peer.SetReadDeadline(time.Now().Add(2*time.Second)))
+	buf := make([]byte, 64)
+	for i := 0; i < 3; i++ {
+		n, _, err := peer.ReadFromUDP(buf)
+		require.NoError(t, err)
+		assert.Equal(t, bytes.Repeat([]byte{byte('a' + i)}, 30), buf[:n])
+	}
+	require.NoError(t, peer.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+	_, _, err = peer.ReadFromUDP(buf)
+	var ne net.Error
+	require.True(t, errors.As(err, &ne) && ne.Timeout(), "the fourth datagram would pass the limit and is not sent: %v", err)
+}
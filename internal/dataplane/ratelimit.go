@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// rateLimitMinBurst and rateLimitMaxBurst bound the bucket size, which is
+	// a tenth of a second's worth of the rate.
+	rateLimitMinBurst = 1024
+	rateLimitMaxBurst = 1 << 20
+	// rateLimitMaxSleep caps one wait so a reloaded rate takes effect quickly.
+	rateLimitMaxSleep = 100 * time.Millisecond
+)
+
+// processLimits throttles every serving-mode stream of this process
+// (--rate-limit), one bucket per direction like processTraffic.
+var processLimits struct {
+	up   rateLimiter
+	down rateLimiter
+}
+
+// rateLimiter is a token bucket whose rate can be swapped while writers are
+// blocked in it.
+type rateLimiter struct {
+	rate atomic.Int64 // bytes per second; 0 is unlimited
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func (l *rateLimiter) setRate(bps int64) { l.rate.Store(bps) }
+
+// take blocks until it may hand out up to n bytes and returns how many.
+func (l *rateLimiter) take(n int) int {
+	for {
+		rate := l.rate.Load()
+		if rate <= 0 {
+			return n
+		}
+		burst := min(max(rate/10, rateLimitMinBurst), rateLimitMaxBurst)
+		want := float64(min(int64(n), burst))
+
+		l.mu.Lock()
+		now := time.Now()
+		if l.last.IsZero() {
+			l.tokens = float64(burst)
+		} else {
+			l.tokens = math.Min(float64(burst), l.tokens+now.Sub(l.last).Seconds()*float64(rate))
+		}
+		l.last = now
+		if l.tokens >= want {
+			l.tokens -= want
+			l.mu.Unlock()
+			return int(want)
+		}
+		wait := time.Duration((want - l.tokens) / float64(rate) * float64(time.Second))
+		l.mu.Unlock()
+		time.Sleep(min(wait, rateLimitMaxSleep))
+	}
+}
+
+// throttledWriter writes through l, splitting large writes into bucket-sized
+// pieces.
+type throttledWriter struct {
+	w io.Writer
+	l *rateLimiter
+}
+
+func (tw throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		n := tw.l.take(len(p) - written)
+		m, err := tw.w.Write(p[written : written+n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,101 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/testsupport"
+)
+
+func TestRateLimiter_Unlimited(t *testing.T) {
+	var l rateLimiter
+	assert.Equal(t, 1<<20, l.take(1<<20))
+}
+
+func TestThrottledWriter_PacesWrites(t *testing.T) {
+	var l rateLimiter
+	l.setRate(100 << 10)
+	var out bytes.Buffer
+	start := time.Now()
+	n, err := throttledWriter{&out, &l}.Write(make([]byte, 40<<10))
+	require.NoError(t, err)
+	assert.Equal(t, 40<<10, n)
+	assert.Equal(t, 40<<10, out.Len())
+	// A 10 KiB burst, then 30 KiB at 100 KiB/s.
+	assert.GreaterOrEqual(t, time.Since(start), 250*time.Millisecond)
+}
+
+// startFirehoseBackend writes 'x' to every connection until it breaks.
+func startFirehoseBackend(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	chunk := bytes.Repeat([]byte{'x'}, 32<<10)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				for {
+					if _, err := c.Write(chunk); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// readFor counts the bytes r delivers within d.
+func readFor(t *testing.T, r io.Reader, d time.Duration) int {
+	t.Helper()
+	deadline := time.Now().Add(d)
+	buf := make([]byte, 32<<10)
+	total := 0
+	for time.Now().Before(deadline) {
+		n, err := r.Read(buf)
+		require.NoError(t, err)
+		total += n
+	}
+	return total
+}
+
+func TestE2E_ServeIncoming_RateLimitReloadKeepsStream(t *testing.T) {
+	backend := startFirehoseBackend(t)
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	tun := stub.AddTunnel("tcp", backend)
+
+	ApplyLiveSettings(LiveSettings{RateLimit: 32 << 10})
+	t.Cleanup(func() { ApplyLiveSettings(LiveSettings{}) })
+	mgr := NewManager(stub.URL, tun.ID, "", 10*time.Millisecond, 50*time.Millisecond, e2eRuntime())
+	defer mgr.Close()
+	go func() { _ = serveIncomingWithManager(mgr, nil) }()
+	require.NoError(t, stub.WaitSessions(tun.ID, 1, 5*time.Second))
+
+	st, err := stub.OpenStream(tun.ID, backend)
+	require.NoError(t, err)
+	defer st.Close()
+	readFor(t, st, 100*time.Millisecond) // drain the initial burst and buffers
+	slow := readFor(t, st, 500*time.Millisecond)
+	assert.Less(t, slow, 64<<10, "32 KiB/s for half a second")
+
+	ApplyLiveSettings(LiveSettings{RateLimit: 4 << 20})
+	readFor(t, st, 150*time.Millisecond)
+	fast := readFor(t, st, 500*time.Millisecond)
+	assert.Greater(t, fast, 512<<10, "the same stream speeds up after the reload")
+}
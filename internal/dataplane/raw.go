@@ -0,0 +1,224 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/fortunnels/client/internal/support"
+	"github.com/fortunnels/client/shared/wsconn"
+)
+
+// rawBackendUnavailable is what a --raw-path stream answers when its backend
+// cannot be reached: the stream was acknowledged before the dial, so the
+// server no longer reads a setup error.
+const rawBackendUnavailable = "HTTP/1.1 502 Bad Gateway\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Length: 30\r\n" +
+	"Connection: close\r\n" +
+	"\r\n" +
+	"backend is not reachable (502)"
+
+// failSetup tells the server why a stream could not be set up: as a setup
+// error, or as a 502 once the stream was acknowledged (--raw-path).
+func failSetup(stream io.Writer, acked bool, err error) {
+	if !acked {
+		writeSetupError(stream, err)
+		return
+	}
+	if _, wErr := io.WriteString(stream, rawBackendUnavailable); wErr != nil {
+		log.Printf("failSetup: %v", wErr)
+	}
+}
+
+// rawUpgrade returns the request in rd's buffer when it is a WebSocket
+// upgrade to s.rawPath, or nil for anything else.
+func (s incomingStreamServer) rawUpgrade(rd *bufio.Reader) *http.Request {
+	head, err := peekHTTPRequestHead(rd)
+	if head == nil || err != nil {
+		return nil
+	}
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(head)))
+	if err != nil || req.URL.Path != s.rawPath || !websocket.IsWebSocketUpgrade(req) {
+		return nil
+	}
+	if _, err := rd.Discard(len(head)); err != nil {
+		return nil
+	}
+	return req
+}
+
+// bridgeRaw completes the WebSocket upgrade req on the stream and bridges
+// its binary frames to --raw-dst.
+func (s incomingStreamServer) bridgeRaw(stream io.ReadWriteCloser, rd *bufio.Reader, req *http.Request, quota *streamQuota, lg connLogger) (bytesIn, bytesOut int64, err error) {
+	backend, err := s.dialBackend(s.rawDst)
+	s.report(s.rawDst, err)
+	if err != nil {
+		failSetup(stream, true, err)
+		return 0, 0, err
+	}
+	defer backend.Close()
+	defer track(&processFDs.localConns)()
+	conn := &rawStreamConn{Reader: rd, stream: stream}
+	ws, err := (&websocket.Upgrader{}).Upgrade(&rawResponseWriter{conn: conn, header: http.Header{}}, req, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("raw upgrade: %w", err)
+	}
+	lg.Printf("raw stream bridged to %s", s.rawDst)
+	wsc := wsconn.NewWSConn(ws, wsconn.Options{})
+	defer wsc.Close()
+	// The upgrade answered the request: a limit closes the bridge without a 413.
+	quota.noReply()
+	return bridgeStreamAndBackendCounted(wsc, wsc, backend, quota)
+}
+
+// rawStreamConn is the net.Conn the upgrader hijacks: it reads the stream
+// through the reader that already holds its preface and writes to the stream.
+type rawStreamConn struct {
+	io.Reader
+	stream io.ReadWriteCloser
+}
+
+func (c *rawStreamConn) Write(p []byte) (int, error) { return c.stream.Write(p) }
+func (c *rawStreamConn) Close() error                { return c.stream.Close() }
+func (c *rawStreamConn) LocalAddr() net.Addr         { return rawAddr{} }
+func (c *rawStreamConn) RemoteAddr() net.Addr        { return rawAddr{} }
+
+func (c *rawStreamConn) SetDeadline(t time.Time) error {
+	if d, ok := c.stream.(interface{ SetDeadline(time.Time) error }); ok {
+		return d.SetDeadline(t)
+	}
+	return nil
+}
+
+func (c *rawStreamConn) SetReadDeadline(t time.Time) error {
+	if d, ok := c.stream.(interface{ SetReadDeadline(time.Time) error }); ok {
+		return d.SetReadDeadline(t)
+	}
+	return nil
+}
+
+func (c *rawStreamConn) SetWriteDeadline(t time.Time) error {
+	if d, ok := c.stream.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		return d.SetWriteDeadline(t)
+	}
+	return nil
+}
+
+type rawAddr struct{}
+
+func (rawAddr) Network() string { return "stream" }
+func (rawAddr) String() string  { return "stream" }
+
+// rawResponseWriter hands conn to the upgrader, which writes the handshake
+// response itself.
+type rawResponseWriter struct {
+	conn   net.Conn
+	header http.Header
+	status int
+}
+
+func (w *rawResponseWriter) Header() http.Header { return w.header }
+
+// Write and WriteHeader only see the upgrader's error responses.
+func (w *rawResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.conn.Write(p)
+}
+
+func (w *rawResponseWriter) WriteHeader(status int) {
+	w.status = status
+	_, _ = fmt.Fprintf(w.conn, "HTTP/1.1 %d %s\r\nConnection: close\r\n", status, http.StatusText(status))
+	_ = w.header.Write(w.conn)
+	_, _ = io.WriteString(w.conn, "\r\n")
+}
+
+func (w *rawResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.conn, bufio.NewReadWriter(bufio.NewReader(w.conn), bufio.NewWriter(w.conn)), nil
+}
+
+// rawWrapURL turns the public URL of a --raw-path into the WebSocket URL the
+// wrap command dials; without a path it is /raw.
+func rawWrapURL(via string) (string, error) {
+	u, err := url.Parse(via)
+	if err != nil {
+		return "", fmt.Errorf("invalid --via %q: %w", via, err)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "ws":
+		u.Scheme = "ws"
+	case "https", "wss":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("invalid --via %q: expected an http, https, ws or wss URL", via)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid --via %q: missing host", via)
+	}
+	if u.Path == "" {
+		u.Path = "/raw"
+	}
+	return u.String(), nil
+}
+
+// ServeWrap accepts TCP connections on listenAddr and carries each over its
+// own WebSocket to via, the public URL of a tunnel's --raw-path. Half-closes
+// are not carried: the first side to finish ends the connection.
+func ServeWrap(listenAddr, via string) error {
+	wsURL, err := rawWrapURL(via)
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return fmt.Errorf("listen tcp: %w", support.ExplainBindError(listenAddr, err))
+	}
+	defer ln.Close()
+	log.Printf("[INFO] wrap: forwarding %s over %s", ln.Addr(), wsURL)
+	return serveWrapListener(ln, wsURL)
+}
+
+func serveWrapListener(ln net.Listener, wsURL string) error {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return fmt.Errorf("accept: %w", err)
+		}
+		go func() {
+			lg := newConnLogger()
+			defer support.Recover(support.PanicScope{Role: "wrap connection", ConnID: lg.id})
+			if err := wrapConn(c, wsURL, lg); err != nil {
+				lg.Printf("[WARN] wrap connection from %s: %v", c.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+func wrapConn(c net.Conn, wsURL string, lg connLogger) error {
+	defer c.Close()
+	ws, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		if resp != nil {
+			return fmt.Errorf("dial %s: %w (HTTP %s)", wsURL, err, resp.Status)
+		}
+		return fmt.Errorf("dial %s: %w", wsURL, err)
+	}
+	wsc := wsconn.NewWSConn(ws, wsconn.Options{})
+	defer wsc.Close()
+	pipeStreams(c, wsc, nil, lg)
+	return nil
+}
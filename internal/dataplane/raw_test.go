@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/testsupport"
+)
+
+func TestRawWrapURL(t *testing.T) {
+	tests := []struct {
+		via  string
+		want string
+	}{
+		{"https://abc.example.com/raw", "wss://abc.example.com/raw"},
+		{"http://abc.example.com", "ws://abc.example.com/raw"},
+		{"wss://abc.example.com/ssh", "wss://abc.example.com/ssh"},
+		{"HTTP://abc.example.com:8080/raw?x=1", "ws://abc.example.com:8080/raw?x=1"},
+	}
+	for _, tt := range tests {
+		got, err := rawWrapURL(tt.via)
+		require.NoError(t, err, tt.via)
+		assert.Equal(t, tt.want, got, tt.via)
+	}
+	for _, bad := range []string{"ftp://abc.example.com/raw", "abc.example.com/raw", "https:///raw", "://"} {
+		_, err := rawWrapURL(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+// startRawTunnel serves an http tunnel to an HTTP backend with --raw-path
+// /raw bridged to rawDst, and returns the stub's public endpoint for it.
+func startRawTunnel(t *testing.T, rawDst string) string {
+	t.Helper()
+	web := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "web:"+r.URL.Path)
+	}))
+	t.Cleanup(web.Close)
+	stub := testsupport.NewServer(testsupport.Options{})
+	t.Cleanup(stub.Close)
+	tun := stub.AddTunnel("http", web.Listener.Addr().String())
+
+	rt := e2eRuntime()
+	rt.HTTPAware = true
+	rt.RawPath = "/raw"
+	rt.RawDst = rawDst
+	mgr := NewManager(stub.URL, tun.ID, "", 10*time.Millisecond, 50*time.Millisecond, rt)
+	t.Cleanup(mgr.Close)
+	go func() { _ = serveIncomingWithManager(mgr, nil) }()
+	require.NoError(t, stub.WaitSessions(tun.ID, 1, 5*time.Second))
+
+	public, err := stub.ServePublic(tun.ID)
+	require.NoError(t, err)
+	t.Cleanup(func() { public.Close() })
+	return public.Addr().String()
+}
+
+// TestE2E_RawWrap carries a TCP connection through client wrap, the public
+// endpoint and the serving client's --raw-path to --raw-dst.
+func TestE2E_RawWrap(t *testing.T) {
+	public := startRawTunnel(t, startTCPEchoBackend(t))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	wsURL, err := rawWrapURL("http://" + public + "/raw")
+	require.NoError(t, err)
+	go func() { _ = serveWrapListener(ln, wsURL) }()
+
+	for range 2 {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		require.NoError(t, err)
+		require.NoError(t, c.SetDeadline(time.Now().Add(5*time.Second)))
+		for _, msg := range []string{"ping", string(make([]byte, 100<<10))} {
+			_, err = io.WriteString(c, msg)
+			require.NoError(t, err)
+			got := make([]byte, len(msg))
+			_, err = io.ReadFull(c, got)
+			require.NoError(t, err)
+			assert.Equal(t, msg, string(got))
+		}
+		c.Close()
+	}
+
+	// Other requests still reach the HTTP backend.
+	resp, err := http.Get("http://" + public + "/hello")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "web:/hello", string(body))
+}
+
+func TestE2E_RawPath_BackendDown(t *testing.T) {
+	dead, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	rawDst := dead.Addr().String()
+	dead.Close()
+	public := startRawTunnel(t, rawDst)
+
+	_, resp, err := websocket.DefaultDialer.Dial("ws://"+public+"/raw", nil)
+	require.Error(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+}
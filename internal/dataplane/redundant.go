@@ -0,0 +1,542 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/fortunnels/client/internal/support"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+// A redundant stream (--redundant) sends every frame over each of its legs,
+// one stream per transport, and delivers the first copy of each sequence
+// number it receives. A frame on the wire is a 13-byte header (flags, 8-byte
+// sequence number, 4-byte payload length) followed by the payload; the FIN
+// frame has no payload and takes a sequence number of its own.
+const (
+	redundantHeaderSize = 13
+	// redundantMaxFrame is the largest payload of one frame.
+	redundantMaxFrame = 16 << 10
+	// redundantWindow is how far ahead of the next undelivered sequence
+	// number a frame may be; a leg that sends one further ahead is dropped.
+	redundantWindow = 1024
+	// redundantLegQueue is how many frames a leg may lag behind the fastest
+	// one before it is dropped as stalled.
+	redundantLegQueue = 512
+	// redundantReadBuffer bounds the delivered bytes waiting for Read; the
+	// legs stop reading while it is full.
+	redundantReadBuffer = 1 << 20
+)
+
+const (
+	redundantFlagData byte = 0
+	redundantFlagFin  byte = 1
+)
+
+var (
+	errRedundantClosed  = errors.New("redundant stream closed")
+	errRedundantStalled = errors.New("stalled: fell too far behind the other transports")
+)
+
+// redundantFrame is one decoded frame.
+type redundantFrame struct {
+	seq     uint64
+	fin     bool
+	payload []byte
+}
+
+func encodeRedundantFrame(seq uint64, fin bool, payload []byte) []byte {
+	b := make([]byte, redundantHeaderSize+len(payload))
+	if fin {
+		b[0] = redundantFlagFin
+	}
+	binary.BigEndian.PutUint64(b[1:9], seq)
+	binary.BigEndian.PutUint32(b[9:13], uint32(len(payload))) //nolint:gosec // payloads are at most redundantMaxFrame
+	copy(b[redundantHeaderSize:], payload)
+	return b
+}
+
+func readRedundantFrame(r io.Reader) (redundantFrame, error) {
+	var hdr [redundantHeaderSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return redundantFrame{}, err
+	}
+	f := redundantFrame{seq: binary.BigEndian.Uint64(hdr[1:9]), fin: hdr[0] == redundantFlagFin}
+	n := binary.BigEndian.Uint32(hdr[9:13])
+	switch {
+	case hdr[0] > redundantFlagFin:
+		return redundantFrame{}, fmt.Errorf("invalid redundant frame flags %#x", hdr[0])
+	case n > redundantMaxFrame:
+		return redundantFrame{}, fmt.Errorf("redundant frame of %d bytes exceeds %d", n, redundantMaxFrame)
+	case f.fin && n != 0:
+		return redundantFrame{}, errors.New("redundant FIN frame with a payload")
+	}
+	if n > 0 {
+		f.payload = make([]byte, n)
+		if _, err := io.ReadFull(r, f.payload); err != nil {
+			return redundantFrame{}, err
+		}
+	}
+	return f, nil
+}
+
+// reorderBuffer puts the frames of all legs back in sequence order. It keeps
+// the frames ahead of the next expected one, within redundantWindow, and
+// drops the copies it already has.
+type reorderBuffer struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	next    uint64
+	pending map[uint64]redundantFrame
+	ready   bytes.Buffer
+	// eof is set once the FIN frame is next in sequence; err once the
+	// stream failed or was closed.
+	eof bool
+	err error
+}
+
+func newReorderBuffer() *reorderBuffer {
+	b := &reorderBuffer{pending: make(map[uint64]redundantFrame)}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// add takes one received frame and reports whether it was the first copy of
+// its sequence number. A frame beyond the window fails.
+func (b *reorderBuffer) add(f redundantFrame) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for {
+		if _, dup := b.pending[f.seq]; dup || f.seq < b.next || b.eof || b.err != nil {
+			return false, nil
+		}
+		if f.seq-b.next >= redundantWindow {
+			return false, fmt.Errorf("sequence %d outside the reorder window [%d, %d)", f.seq, b.next, b.next+redundantWindow)
+		}
+		if b.ready.Len() < redundantReadBuffer {
+			break
+		}
+		b.cond.Wait()
+	}
+	b.pending[f.seq] = f
+	for {
+		g, ok := b.pending[b.next]
+		if !ok {
+			break
+		}
+		delete(b.pending, b.next)
+		b.next++
+		if g.fin {
+			b.eof = true
+			clear(b.pending)
+			break
+		}
+		b.ready.Write(g.payload)
+	}
+	b.cond.Broadcast()
+	return true, nil
+}
+
+// read returns delivered bytes in order, then io.EOF after the FIN frame or
+// the stream's error.
+func (b *reorderBuffer) read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.ready.Len() == 0 && !b.eof && b.err == nil {
+		b.cond.Wait()
+	}
+	switch {
+	case b.ready.Len() > 0:
+		n, _ := b.ready.Read(p)
+		b.cond.Broadcast()
+		return n, nil
+	case b.eof:
+		return 0, io.EOF
+	}
+	return 0, b.err
+}
+
+// finished reports whether the FIN frame was delivered.
+func (b *reorderBuffer) finished() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.eof
+}
+
+// fail ends the stream with err; bytes already delivered are still read.
+func (b *reorderBuffer) fail(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err == nil {
+		b.err = err
+	}
+	b.cond.Broadcast()
+}
+
+// redundantLeg is the stream of a redundant stream on one transport.
+type redundantLeg struct {
+	name string
+	// r reads the leg's frames; it is the stream or a reader buffering it.
+	r      io.Reader
+	stream io.WriteCloser
+	out    chan *redundantSend
+
+	dropOnce sync.Once
+	dead     chan struct{}
+	err      error
+	// first counts the frames this leg delivered before any other leg.
+	first atomic.Int64
+}
+
+func newRedundantLeg(name string, r io.Reader, stream io.WriteCloser) *redundantLeg {
+	return &redundantLeg{name: name, r: r, stream: stream, out: make(chan *redundantSend, redundantLegQueue), dead: make(chan struct{})}
+}
+
+func (l *redundantLeg) isDead() bool {
+	select {
+	case <-l.dead:
+		return true
+	default:
+		return false
+	}
+}
+
+// redundantSend is one encoded frame queued on the legs; written is closed
+// once a leg wrote it.
+type redundantSend struct {
+	data    []byte
+	once    sync.Once
+	written chan struct{}
+}
+
+// redundantStream is one logical stream over several legs. Write returns once
+// every frame was written on at least one leg; the slower legs catch up in
+// the background, and a leg that falls redundantLegQueue frames behind or
+// fails is dropped. The stream fails once every leg is gone.
+type redundantStream struct {
+	legs []*redundantLeg
+	in   *reorderBuffer
+
+	// mu orders the frames: they take sequence numbers and enter each leg's
+	// queue under it.
+	mu  sync.Mutex
+	seq uint64
+
+	live      atomic.Int32
+	allDead   chan struct{}
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newRedundantStream(legs []*redundantLeg) *redundantStream {
+	s := &redundantStream{legs: legs, in: newReorderBuffer(), allDead: make(chan struct{}), closed: make(chan struct{})}
+	s.live.Store(int32(len(legs))) //nolint:gosec // a stream has a handful of legs
+	for _, l := range legs {
+		go s.send(l)
+		go s.receive(l)
+	}
+	return s
+}
+
+func (s *redundantStream) send(l *redundantLeg) {
+	defer support.RecoverAs(s.dropPanicked(l))
+	for {
+		select {
+		case f := <-l.out:
+			if _, err := l.stream.Write(f.data); err != nil {
+				s.drop(l, err)
+				return
+			}
+			f.once.Do(func() { close(f.written) })
+		case <-l.dead:
+			return
+		}
+	}
+}
+
+func (s *redundantStream) receive(l *redundantLeg) {
+	defer support.RecoverAs(s.dropPanicked(l))
+	for {
+		f, err := readRedundantFrame(l.r)
+		if err != nil {
+			s.drop(l, err)
+			return
+		}
+		first, err := s.in.add(f)
+		if err != nil {
+			s.drop(l, err)
+			return
+		}
+		if first {
+			l.first.Add(1)
+		}
+	}
+}
+
+// dropPanicked returns the panic handler of l's goroutines: a panic drops
+// only that leg.
+func (s *redundantStream) dropPanicked(l *redundantLeg) func(*support.PanicError) {
+	return func(p *support.PanicError) {
+		support.ReportPanic(support.PanicScope{Role: "redundant " + l.name + " leg"}, p)
+		s.drop(l, p)
+	}
+}
+
+// drop stops using l after err. The stream fails with the errors of all legs
+// once the last one is dropped.
+func (s *redundantStream) drop(l *redundantLeg, err error) {
+	dropped := false
+	l.dropOnce.Do(func() {
+		l.err = err
+		close(l.dead)
+		_ = l.stream.Close()
+		dropped = true
+	})
+	if !dropped {
+		return
+	}
+	if s.live.Add(-1) == 0 {
+		s.in.fail(s.legsErr())
+		close(s.allDead)
+		return
+	}
+	if !s.isClosed() && !s.in.finished() {
+		log.Printf("[WARN] redundant stream: %s transport dropped (%v); continuing on %s", l.name, err, s.liveNames())
+	}
+}
+
+func (s *redundantStream) liveNames() string {
+	var names []string
+	for _, l := range s.legs {
+		if !l.isDead() {
+			names = append(names, l.name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// legsErr is the error of a stream whose legs are all gone.
+func (s *redundantStream) legsErr() error {
+	if s.isClosed() {
+		return errRedundantClosed
+	}
+	parts := make([]string, 0, len(s.legs))
+	for _, l := range s.legs {
+		parts = append(parts, fmt.Sprintf("%s: %v", l.name, l.err))
+	}
+	return fmt.Errorf("all transports failed (%s)", strings.Join(parts, "; "))
+}
+
+func (s *redundantStream) isClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *redundantStream) Read(p []byte) (int, error) {
+	return s.in.read(p)
+}
+
+func (s *redundantStream) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), redundantMaxFrame)
+		if err := s.sendFrame(false, p[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// CloseWrite sends the FIN frame: the peer reads EOF once it delivered every
+// frame before it.
+func (s *redundantStream) CloseWrite() error {
+	return s.sendFrame(true, nil)
+}
+
+// sendFrame queues one frame on every live leg and waits until a leg wrote it.
+func (s *redundantStream) sendFrame(fin bool, payload []byte) error {
+	s.mu.Lock()
+	f := &redundantSend{data: encodeRedundantFrame(s.seq, fin, payload), written: make(chan struct{})}
+	s.seq++
+	for _, l := range s.legs {
+		s.enqueue(l, f)
+	}
+	s.mu.Unlock()
+	select {
+	case <-f.written:
+		return nil
+	case <-s.allDead:
+		return s.legsErr()
+	case <-s.closed:
+		return errRedundantClosed
+	}
+}
+
+// enqueue queues f on l. A full queue drops l while another leg is live;
+// the last one is waited for.
+func (s *redundantStream) enqueue(l *redundantLeg, f *redundantSend) {
+	select {
+	case l.out <- f:
+		return
+	case <-l.dead:
+		return
+	default:
+	}
+	if s.live.Load() > 1 {
+		s.drop(l, errRedundantStalled)
+		return
+	}
+	select {
+	case l.out <- f:
+	case <-l.dead:
+	case <-s.closed:
+	}
+}
+
+// Close ends the stream on every leg. Every frame Write returned for was
+// already written on a leg, so the copies still queued are not waited for.
+func (s *redundantStream) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		s.in.fail(errRedundantClosed)
+		for _, l := range s.legs {
+			s.drop(l, errRedundantClosed)
+		}
+		s.logStats()
+	})
+	return nil
+}
+
+// logStats reports which transport delivered the stream's frames first.
+func (s *redundantStream) logStats() {
+	parts := make([]string, 0, len(s.legs))
+	total := int64(0)
+	for _, l := range s.legs {
+		n := l.first.Load()
+		total += n
+		parts = append(parts, fmt.Sprintf("%s %d", l.name, n))
+	}
+	if total > 0 {
+		log.Printf("[INFO] redundant stream: first copies delivered by %s", strings.Join(parts, ", "))
+	}
+}
+
+// redundantTransport is a transport a redundant stream opens a leg on.
+type redundantTransport struct {
+	name string
+	sess Session
+	// auth is sent in the leg's preface on a transport that carries no
+	// data-plane credentials of its own (QUIC).
+	auth string
+}
+
+// openRedundantStream opens a leg on each transport, each with the stream
+// preface fields plus the redundancy group and its leg name. A transport
+// whose leg fails to open is left out; it fails only when none opened.
+func openRedundantStream(transports []redundantTransport, fields map[string]string, meta prefaceMeta) (*redundantStream, error) {
+	group, err := newRedundantGroup()
+	if err != nil {
+		return nil, err
+	}
+	var legs []*redundantLeg
+	var errs []string
+	for _, t := range transports {
+		l, err := openRedundantLeg(t, fields, meta, group)
+		if err != nil {
+			log.Printf("[WARN] redundant stream: %s transport unavailable: %v", t.name, err)
+			errs = append(errs, fmt.Sprintf("%s: %v", t.name, err))
+			continue
+		}
+		legs = append(legs, l)
+	}
+	if len(legs) == 0 {
+		return nil, fmt.Errorf("open redundant stream: %s", strings.Join(errs, "; "))
+	}
+	return newRedundantStream(legs), nil
+}
+
+func openRedundantLeg(t redundantTransport, fields map[string]string, meta prefaceMeta, group string) (*redundantLeg, error) {
+	legFields := make(map[string]string, len(fields)+3)
+	for k, v := range fields {
+		legFields[k] = v
+	}
+	legFields[protocolv1.PrefaceRedundant] = group
+	legFields[protocolv1.PrefaceRedundantLeg] = t.name
+	if t.auth != "" {
+		legFields["auth"] = t.auth
+	}
+	preface, err := clientPreface(legFields, meta)
+	if err != nil {
+		return nil, err
+	}
+	st, err := t.sess.OpenStream()
+	if err != nil {
+		return nil, fmt.Errorf("open stream: %w", err)
+	}
+	if _, err := st.Write(preface); err != nil {
+		_ = st.Close()
+		return nil, fmt.Errorf("write preface: %w", err)
+	}
+	return newRedundantLeg(t.name, st, st), nil
+}
+
+// newRedundantGroup returns the random ID that ties the legs of one stream
+// together on the server.
+func newRedundantGroup() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("redundancy group: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// quicSession is a Session on a QUIC connection, whose streams are opened by
+// the client like those of the WebSocket data plane.
+type quicSession struct {
+	conn *quic.Conn
+}
+
+func (s quicSession) OpenStream() (Stream, error) {
+	st, err := s.conn.OpenStreamSync(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return quicStream{st}, nil
+}
+
+func (s quicSession) AcceptStream() (Stream, error) {
+	st, err := s.conn.AcceptStream(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return quicStream{st}, nil
+}
+
+func (s quicSession) IsClosed() bool {
+	return s.conn.Context().Err() != nil
+}
+
+func (s quicSession) Close() error {
+	return s.conn.CloseWithError(0, "")
+}
@@ -0,0 +1,304 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/pion/dtls/v3/pkg/crypto/selfsign"
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+// acceptRedundant plays the server of a redundant stream: it accepts one leg
+// on each session, checks that the prefaces belong to one group, and joins
+// the legs.
+func acceptRedundant(t *testing.T, sessions map[string]Session) *redundantStream {
+	t.Helper()
+	var legs []*redundantLeg
+	group := ""
+	for name, sess := range sessions {
+		st, err := sess.AcceptStream()
+		require.NoError(t, err)
+		rd := bufio.NewReader(st)
+		line, err := rd.ReadBytes('\n')
+		require.NoError(t, err)
+		var fields map[string]string
+		require.NoError(t, json.Unmarshal(line, &fields))
+		assert.Equal(t, name, fields[protocolv1.PrefaceRedundantLeg])
+		assert.Equal(t, "db:5432", fields["dst"])
+		require.NotEmpty(t, fields[protocolv1.PrefaceRedundant])
+		if group == "" {
+			group = fields[protocolv1.PrefaceRedundant]
+		}
+		assert.Equal(t, group, fields[protocolv1.PrefaceRedundant], "the legs share one group")
+		legs = append(legs, newRedundantLeg(name, rd, st))
+	}
+	return newRedundantStream(legs)
+}
+
+// sequencedPayload is n bytes of consecutive big-endian uint64 counters.
+func sequencedPayload(n int) []byte {
+	b := make([]byte, n)
+	for i := 0; i+8 <= n; i += 8 {
+		binary.BigEndian.PutUint64(b[i:], uint64(i/8))
+	}
+	return b
+}
+
+// requireSequenced fails at the first counter of got that is out of order.
+func requireSequenced(t *testing.T, got []byte) {
+	t.Helper()
+	for i := 0; i+8 <= len(got); i += 8 {
+		if v := binary.BigEndian.Uint64(got[i:]); v != uint64(i/8) {
+			t.Fatalf("counter %d at offset %d, want %d", v, i, i/8)
+		}
+	}
+}
+
+// echoRedundant echoes everything the test sends on the server's end of a
+// redundant stream, then half-closes it.
+func echoRedundant(server *redundantStream) {
+	go func() {
+		_, _ = io.Copy(server, server)
+		_ = server.CloseWrite()
+	}()
+}
+
+// transferKilling sends payload through an echoing redundant stream, calling
+// kill once half of it was written, and returns what came back.
+func transferKilling(t *testing.T, client *redundantStream, payload []byte, kill func()) []byte {
+	t.Helper()
+	const chunk = 32 << 10
+	writeErr := make(chan error, 1)
+	go func() {
+		for off := 0; off < len(payload); off += chunk {
+			if off == len(payload)/2 {
+				kill()
+			}
+			if _, err := client.Write(payload[off:min(off+chunk, len(payload))]); err != nil {
+				writeErr <- err
+				return
+			}
+		}
+		writeErr <- client.CloseWrite()
+	}()
+	got, err := io.ReadAll(client)
+	require.NoError(t, err)
+	require.NoError(t, waitErr(t, writeErr))
+	return got
+}
+
+func TestRedundantFrame_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	buf.Write(encodeRedundantFrame(7, false, []byte("hello")))
+	buf.Write(encodeRedundantFrame(8, true, nil))
+
+	f, err := readRedundantFrame(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, redundantFrame{seq: 7, payload: []byte("hello")}, f)
+	f, err = readRedundantFrame(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, redundantFrame{seq: 8, fin: true}, f)
+	_, err = readRedundantFrame(&buf)
+	require.ErrorIs(t, err, io.EOF)
+
+	oversized := encodeRedundantFrame(1, false, nil)
+	binary.BigEndian.PutUint32(oversized[9:], redundantMaxFrame+1)
+	_, err = readRedundantFrame(bytes.NewReader(oversized))
+	require.ErrorContains(t, err, "exceeds")
+	badFlags := encodeRedundantFrame(1, false, nil)
+	badFlags[0] = 7
+	_, err = readRedundantFrame(bytes.NewReader(badFlags))
+	require.ErrorContains(t, err, "invalid redundant frame flags")
+}
+
+func TestReorderBuffer_DeliversInOrderAndDropsDuplicates(t *testing.T) {
+	b := newReorderBuffer()
+	add := func(seq uint64, fin bool, payload string) bool {
+		first, err := b.add(redundantFrame{seq: seq, fin: fin, payload: []byte(payload)})
+		require.NoError(t, err)
+		return first
+	}
+	assert.True(t, add(2, false, "c"))
+	assert.True(t, add(1, false, "b"))
+	assert.False(t, add(2, false, "c"), "a pending copy is a duplicate")
+	assert.True(t, add(0, false, "a"))
+	assert.False(t, add(1, false, "b"), "a delivered copy is a duplicate")
+	assert.True(t, add(3, true, ""))
+	assert.False(t, add(4, false, "late"), "nothing follows the FIN")
+
+	got, err := io.ReadAll(readerFunc(b.read))
+	require.NoError(t, err)
+	assert.Equal(t, "abc", string(got))
+}
+
+func TestReorderBuffer_RejectsFrameBeyondWindow(t *testing.T) {
+	b := newReorderBuffer()
+	_, err := b.add(redundantFrame{seq: redundantWindow - 1})
+	require.NoError(t, err)
+	_, err = b.add(redundantFrame{seq: redundantWindow})
+	require.ErrorContains(t, err, "outside the reorder window [0, 1024)")
+}
+
+func TestRedundantStream_SurvivesTransportKilledMidTransfer(t *testing.T) {
+	for _, victim := range []string{"ws", "quic"} {
+		t.Run(victim, func(t *testing.T) {
+			wsClient, wsServer := newMemSessionPair()
+			quicClient, quicServer := newMemSessionPair()
+			clients := map[string]*memSession{"ws": wsClient, "quic": quicClient}
+
+			client, err := openRedundantStream([]redundantTransport{
+				{name: "ws", sess: wsClient},
+				{name: "quic", sess: quicClient, auth: "dp-token"},
+			}, map[string]string{"dst": "db:5432", "proto": "tcp", "tunnel_id": "t1"}, prefaceMeta{})
+			require.NoError(t, err)
+			defer client.Close()
+			server := acceptRedundant(t, map[string]Session{"ws": wsServer, "quic": quicServer})
+			defer server.Close()
+			echoRedundant(server)
+
+			payload := sequencedPayload(4 << 20)
+			got := transferKilling(t, client, payload, func() {
+				clients[victim].fail(errors.New("transport reset"))
+			})
+
+			require.Len(t, got, len(payload), "no payload is lost")
+			assert.Equal(t, sha256.Sum256(payload), sha256.Sum256(got))
+			requireSequenced(t, got)
+			for _, l := range client.legs {
+				assert.Equal(t, l.name == victim, l.isDead(), "leg %s", l.name)
+			}
+		})
+	}
+}
+
+func TestRedundantStream_RealQUICLegKilled(t *testing.T) {
+	cert, err := selfsign.GenerateSelfSigned()
+	require.NoError(t, err)
+	ln, err := quic.ListenAddr("127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{quicALPN},
+		MinVersion:   tls.VersionTLS13,
+	}, nil)
+	require.NoError(t, err)
+	defer ln.Close()
+	accepted := make(chan *quic.Conn, 1)
+	go func() {
+		if qc, err := ln.Accept(context.Background()); err == nil {
+			accepted <- qc
+		}
+	}()
+	qc, err := quic.DialAddr(context.Background(), ln.Addr().String(), &tls.Config{
+		InsecureSkipVerify: true, //nolint:gosec // the test listener's self-signed certificate
+		NextProtos:         []string{quicALPN},
+	}, nil)
+	require.NoError(t, err)
+	serverQC := <-accepted
+	defer serverQC.CloseWithError(0, "")
+
+	wsClient, wsServer := newMemSessionPair()
+	client, err := openRedundantStream([]redundantTransport{
+		{name: "ws", sess: wsClient},
+		{name: "quic", sess: quicSession{qc}},
+	}, map[string]string{"dst": "db:5432", "proto": "tcp"}, prefaceMeta{})
+	require.NoError(t, err)
+	defer client.Close()
+	server := acceptRedundant(t, map[string]Session{"ws": wsServer, "quic": quicSession{serverQC}})
+	defer server.Close()
+	echoRedundant(server)
+
+	payload := sequencedPayload(2 << 20)
+	got := transferKilling(t, client, payload, func() {
+		_ = qc.CloseWithError(1, "transport reset")
+	})
+	require.Len(t, got, len(payload))
+	assert.Equal(t, sha256.Sum256(payload), sha256.Sum256(got))
+	requireSequenced(t, got)
+}
+
+func TestRedundantStream_StalledLegIsDropped(t *testing.T) {
+	fastR, fastIn := io.Pipe()
+	slowR, slowIn := io.Pipe()
+	defer fastIn.Close()
+	defer slowIn.Close()
+	// Nothing reads the slow leg's outgoing pipe, so its writes block.
+	_, slowW := io.Pipe()
+	fast := newRedundantLeg("ws", fastR, nopWriteCloser{io.Discard})
+	slow := newRedundantLeg("quic", slowR, slowW)
+	s := newRedundantStream([]*redundantLeg{fast, slow})
+	defer s.Close()
+
+	for i := 0; i < redundantLegQueue+2; i++ {
+		_, err := s.Write([]byte{byte(i)})
+		require.NoError(t, err)
+	}
+	require.True(t, slow.isDead())
+	require.ErrorIs(t, slow.err, errRedundantStalled)
+	assert.False(t, fast.isDead())
+}
+
+func TestRedundantStream_FailsWhenEveryLegIsGone(t *testing.T) {
+	wsClient, _ := newMemSessionPair()
+	quicClient, _ := newMemSessionPair()
+	client, err := openRedundantStream([]redundantTransport{
+		{name: "ws", sess: wsClient},
+		{name: "quic", sess: quicClient},
+	}, map[string]string{"dst": "db:5432"}, prefaceMeta{})
+	require.NoError(t, err)
+	defer client.Close()
+
+	wsClient.fail(errors.New("ws reset"))
+	quicClient.fail(errors.New("quic reset"))
+	_, err = io.ReadAll(client)
+	require.ErrorContains(t, err, "all transports failed")
+	require.ErrorContains(t, err, "ws: ws reset")
+	require.ErrorContains(t, err, "quic: quic reset")
+	_, err = client.Write([]byte("x"))
+	require.ErrorContains(t, err, "all transports failed")
+}
+
+func TestOpenRedundantStream_SkipsUnavailableTransport(t *testing.T) {
+	wsClient, wsServer := newMemSessionPair()
+	quicClient, _ := newMemSessionPair()
+	quicClient.failOpen(errors.New("no route"))
+	client, err := openRedundantStream([]redundantTransport{
+		{name: "ws", sess: wsClient},
+		{name: "quic", sess: quicClient},
+	}, map[string]string{"dst": "db:5432"}, prefaceMeta{})
+	require.NoError(t, err)
+	defer client.Close()
+	require.Len(t, client.legs, 1)
+
+	server := acceptRedundant(t, map[string]Session{"ws": wsServer})
+	defer server.Close()
+	echoRedundant(server)
+	got := transferKilling(t, client, sequencedPayload(64<<10), func() {})
+	requireSequenced(t, got)
+	assert.Len(t, got, 64<<10)
+
+	wsClient.failOpen(errors.New("refused"))
+	_, err = openRedundantStream([]redundantTransport{{name: "ws", sess: wsClient}}, map[string]string{}, prefaceMeta{})
+	require.ErrorContains(t, err, "open redundant stream: ws: open stream: refused")
+}
+
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,334 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fortunnels/client/internal/support"
+)
+
+const sourceLimitedFormat = "[WARN] rate-limit-source: %s exceeded %d requests per %s, answering 429"
+
+// tooManyRequests is the response to a request --rate-limit-source refuses.
+func tooManyRequests(retryAfter time.Duration) []byte {
+	const body = "too many requests from this address (429)"
+	secs := int64((retryAfter + time.Second - 1) / time.Second)
+	return []byte("HTTP/1.1 429 Too Many Requests\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Retry-After: " + strconv.FormatInt(max(secs, 1), 10) + "\r\n" +
+		"Content-Length: " + strconv.Itoa(len(body)) + "\r\n" +
+		"Connection: close\r\n" +
+		"\r\n" +
+		body)
+}
+
+// requestSource is the client IP of a tunneled request: the last
+// X-Forwarded-For entry, the one the tunnel server appended. Earlier entries
+// come from the caller and could be forged.
+func requestSource(h http.Header) (netip.Addr, bool) {
+	values := h.Values("X-Forwarded-For")
+	if len(values) == 0 {
+		return netip.Addr{}, false
+	}
+	last := values[len(values)-1]
+	if i := strings.LastIndexByte(last, ','); i >= 0 {
+		last = last[i+1:]
+	}
+	addr, err := netip.ParseAddr(strings.TrimSpace(last))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+type gateState int
+
+const (
+	// gateHead: the next bytes start a request.
+	gateHead gateState = iota
+	// gateChunkSize and gateTrailer: inside a chunked request body.
+	gateChunkSize
+	gateTrailer
+	// gatePassthrough: the rest of the stream is forwarded unchecked (an
+	// upgrade, a head beyond the peek budget, or not HTTP).
+	gatePassthrough
+	// gateRefused: a request was refused; nothing more is forwarded.
+	gateRefused
+)
+
+// requestGate is the request side of an HTTP stream with
+// --rate-limit-source or --host-rewrite, or of a --local-mirror connection:
+// it forwards the stream's requests one at a time, checking each head with
+// the limiter, if any, and ends the stream at the first refused request. Heads are peeked within rd's buffer;
+// bodies are copied through without being buffered.
+type requestGate struct {
+	rd      *bufio.Reader
+	limiter *sourceLimiter
+	lg      connLogger
+	// rewriteFirst, when set, replaces the first request head (traceparent
+	// propagation); rewrite, when set, replaces every one (--host-rewrite,
+	// X-Forwarded-For of --local-mirror) before the limiter checks it.
+	rewriteFirst func(head []byte) []byte
+	rewrite      func(head []byte) []byte
+
+	state gateState
+	// admitted is set when the head at rd was already checked (admitFirst).
+	admitted bool
+	// pending is read out before rd; remaining counts body bytes to copy.
+	pending   []byte
+	remaining int64
+
+	mu      sync.Mutex
+	refusal []byte
+}
+
+func newRequestGate(rd *bufio.Reader, limiter *sourceLimiter, lg connLogger) *requestGate {
+	return &requestGate{rd: rd, limiter: limiter, lg: lg}
+}
+
+// admitFirst checks the stream's first request before the backend is
+// dialed, so a refused one never costs a backend connection. It returns the
+// response to send instead, or nil.
+func (g *requestGate) admitFirst() []byte {
+	if g.limiter == nil {
+		return nil
+	}
+	head, _ := peekHTTPRequestHead(g.rd)
+	if head == nil {
+		return nil
+	}
+	if g.rewrite != nil {
+		head = g.rewrite(append([]byte(nil), head...))
+	}
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(head)))
+	if err != nil {
+		return nil
+	}
+	if !g.admit(req) {
+		g.state = gateRefused
+		return g.takeRefusal()
+	}
+	g.admitted = true
+	return nil
+}
+
+func (g *requestGate) Read(p []byte) (int, error) {
+	for {
+		if len(g.pending) > 0 {
+			n := copy(p, g.pending)
+			g.pending = g.pending[n:]
+			return n, nil
+		}
+		if g.remaining > 0 {
+			n, err := g.rd.Read(p[:min(int64(len(p)), g.remaining)])
+			g.remaining -= int64(n)
+			return n, err
+		}
+		var err error
+		switch g.state {
+		case gateHead:
+			err = g.nextRequest()
+		case gateChunkSize:
+			err = g.chunkSize()
+		case gateTrailer:
+			err = g.trailerLine()
+		case gatePassthrough:
+			return g.rd.Read(p)
+		case gateRefused:
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// nextRequest checks the request head at rd and queues it with its body.
+func (g *requestGate) nextRequest() error {
+	head, err := peekHTTPRequestHead(g.rd)
+	if head == nil {
+		if errors.Is(err, errHTTPHeadTooLarge) {
+			g.lg.Printf("request head exceeds the %d-byte peek budget (--http-peek-bytes), forwarding the rest of the stream unchecked", g.rd.Size())
+		}
+		// Not HTTP, or the end of the stream.
+		g.state = gatePassthrough
+		return nil
+	}
+	out := append([]byte(nil), head...)
+	if g.rewrite != nil {
+		out = g.rewrite(out)
+	}
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(out)))
+	if err != nil {
+		g.lg.Printf("unparsable request head (%v), forwarding the rest of the stream unchecked", err)
+		g.state = gatePassthrough
+		return nil
+	}
+	if !g.admitted && !g.admit(req) {
+		g.state = gateRefused
+		return io.EOF
+	}
+	g.admitted = false
+	if _, err := g.rd.Discard(len(head)); err != nil {
+		return err
+	}
+	if g.rewriteFirst != nil {
+		out = g.rewriteFirst(out)
+		g.rewriteFirst = nil
+	}
+	g.pending = out
+	switch {
+	case req.Method == http.MethodConnect || req.Header.Get("Upgrade") != "":
+		g.state = gatePassthrough
+	case len(req.TransferEncoding) > 0 && req.TransferEncoding[len(req.TransferEncoding)-1] == "chunked":
+		g.state = gateChunkSize
+	default:
+		g.remaining = max(req.ContentLength, 0)
+		g.state = gateHead
+	}
+	return nil
+}
+
+// admit reports whether req may be forwarded; a refusal is counted and
+// kept for takeRefusal.
+func (g *requestGate) admit(req *http.Request) bool {
+	if g.limiter == nil {
+		return true
+	}
+	src, ok := requestSource(req.Header)
+	if !ok {
+		g.limiter.warnNoSource.Do(func() {
+			log.Printf("[WARN] rate-limit-source: request without a usable X-Forwarded-For header; such requests are not limited")
+		})
+		return true
+	}
+	allowed, retryAfter := g.limiter.allow(src)
+	if allowed {
+		return true
+	}
+	processTraffic.limited.Add(1)
+	support.RepeatLogs.Printf(support.LogKey(sourceLimitedFormat, src), sourceLimitedFormat, src, g.limiter.limit, g.limiter.window)
+	g.mu.Lock()
+	g.refusal = tooManyRequests(retryAfter)
+	g.mu.Unlock()
+	return false
+}
+
+// takeRefusal returns the 429 of a refused request once, or nil.
+func (g *requestGate) takeRefusal() []byte {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	r := g.refusal
+	g.refusal = nil
+	return r
+}
+
+// chunkSize queues a chunk-size line and the chunk that follows it.
+func (g *requestGate) chunkSize() error {
+	line, err := g.readLine()
+	if line == nil || g.state == gatePassthrough {
+		return err
+	}
+	field, _, _ := strings.Cut(strings.TrimSpace(string(line)), ";")
+	size, perr := strconv.ParseInt(strings.TrimSpace(field), 16, 64)
+	switch {
+	case perr != nil || size < 0:
+		g.lg.Printf("malformed chunked request body, forwarding the rest of the stream unchecked")
+		g.state = gatePassthrough
+	case size == 0:
+		g.state = gateTrailer
+	default:
+		// The chunk and its CRLF.
+		g.remaining = size + 2
+	}
+	return nil
+}
+
+// trailerLine queues one line of a chunked body's trailer; the blank line
+// ends the request.
+func (g *requestGate) trailerLine() error {
+	line, err := g.readLine()
+	if line == nil || g.state == gatePassthrough {
+		return err
+	}
+	if len(bytes.TrimRight(line, "\r\n")) == 0 {
+		g.state = gateHead
+	}
+	return nil
+}
+
+// readLine queues one line read within rd's buffer and returns it; nil
+// when the stream ended. A partial line (too long, or cut off by the end of
+// the stream) is queued too and the rest of the stream is passed through.
+func (g *requestGate) readLine() ([]byte, error) {
+	frag, err := g.rd.ReadSlice('\n')
+	if len(frag) == 0 {
+		return nil, err
+	}
+	if err != nil {
+		g.state = gatePassthrough
+	}
+	g.pending = append([]byte(nil), frag...)
+	return g.pending, nil
+}
+
+// gatedBackend is the backend of a gated stream. When the gate refuses a
+// request mid-stream it stops forwarding and half-closes the backend; once
+// the backend has finished the responses before it and closed, the 429
+// follows them.
+type gatedBackend struct {
+	net.Conn
+	gate *requestGate
+	tail []byte
+	done bool
+}
+
+func (b *gatedBackend) Read(p []byte) (int, error) {
+	if !b.done {
+		n, err := b.Conn.Read(p)
+		if !errors.Is(err, io.EOF) {
+			return n, err
+		}
+		if n > 0 {
+			// The next read reports the EOF again.
+			return n, nil
+		}
+		b.done = true
+		b.tail = b.gate.takeRefusal()
+	}
+	if len(b.tail) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, b.tail)
+	b.tail = b.tail[n:]
+	return n, nil
+}
+
+func (b *gatedBackend) CloseWrite() error {
+	if cw, ok := b.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// WriteSourceLimitSummary prints how many requests --rate-limit-source
+// refused, as part of the shutdown summary; nothing when none were.
+func WriteSourceLimitSummary(w io.Writer) {
+	if n := processTraffic.Limited(); n > 0 {
+		fmt.Fprintf(w, "🚦 Rate limit per source: %d requests answered with 429\n", n)
+	}
+}
@@ -0,0 +1,276 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/testsupport"
+)
+
+func TestRequestSource(t *testing.T) {
+	for header, want := range map[string]string{
+		"203.0.113.7":               "203.0.113.7",
+		"198.51.100.1, 203.0.113.7": "203.0.113.7",
+		" 2001:db8::7 ":             "2001:db8::7",
+		"::ffff:203.0.113.7":        "203.0.113.7",
+		"203.0.113.7, not-an-ip":    "",
+		"":                          "",
+	} {
+		h := http.Header{}
+		if header != "" {
+			h.Set("X-Forwarded-For", header)
+		}
+		addr, ok := requestSource(h)
+		if want == "" {
+			assert.False(t, ok, header)
+			continue
+		}
+		require.True(t, ok, header)
+		assert.Equal(t, netip.MustParseAddr(want), addr, header)
+	}
+	h := http.Header{"X-Forwarded-For": {"198.51.100.1", "203.0.113.9"}}
+	addr, _ := requestSource(h)
+	assert.Equal(t, netip.MustParseAddr("203.0.113.9"), addr, "the last of several headers")
+}
+
+func gateRequest(xff, extra, body string) string {
+	return "POST /x HTTP/1.1\r\nHost: t\r\nX-Forwarded-For: " + xff + "\r\n" + extra + "\r\n" + body
+}
+
+// TestRequestGate_ForwardsRequestsUntilRefused runs pipelined requests with
+// Content-Length and chunked bodies through a gate: the allowed ones come
+// out byte for byte, the stream ends at the first refused one.
+func TestRequestGate_ForwardsRequestsUntilRefused(t *testing.T) {
+	l, _ := fakeClockLimiter()
+	allowed := gateRequest("203.0.113.1", "Content-Length: 5\r\n", "hello") +
+		gateRequest("203.0.113.2", "Transfer-Encoding: chunked\r\n", "3;ext=1\r\nabc\r\n0\r\nX-Trailer: 1\r\n\r\n") +
+		gateRequest("203.0.113.1", "", "") +
+		gateRequest("203.0.113.1", "Content-Length: 3\r\n", "GET")
+	refused := gateRequest("203.0.113.1", "Content-Length: 5\r\n", "never")
+
+	g := newRequestGate(bufio.NewReaderSize(strings.NewReader(allowed+refused), defaultHTTPPeekBytes), l, connLogger{})
+	got, err := io.ReadAll(g)
+	require.NoError(t, err)
+	assert.Equal(t, allowed, string(got))
+	assert.Contains(t, string(g.takeRefusal()), "HTTP/1.1 429 Too Many Requests\r\n")
+	assert.Nil(t, g.takeRefusal(), "taken once")
+}
+
+func TestRequestGate_AdmitFirst(t *testing.T) {
+	l, _ := fakeClockLimiter()
+	req := gateRequest("203.0.113.1", "", "")
+	for range 3 {
+		g := newRequestGate(bufio.NewReader(strings.NewReader(req)), l, connLogger{})
+		require.Nil(t, g.admitFirst())
+		got, err := io.ReadAll(g)
+		require.NoError(t, err)
+		assert.Equal(t, req, string(got), "an admitted head is not counted twice")
+	}
+	g := newRequestGate(bufio.NewReader(strings.NewReader(req)), l, connLogger{})
+	assert.Contains(t, string(g.admitFirst()), "429")
+	got, err := io.ReadAll(g)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func TestRequestGate_PassesThroughUpgradesAndUnknownSources(t *testing.T) {
+	l, _ := fakeClockLimiter()
+	upgrade := "GET /ws HTTP/1.1\r\nHost: t\r\nX-Forwarded-For: 203.0.113.1\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n"
+	frames := strings.Repeat("GET / HTTP/1.1\r\nX-Forwarded-For: 203.0.113.1\r\n\r\n", 5)
+	g := newRequestGate(bufio.NewReader(strings.NewReader(upgrade+frames)), l, connLogger{})
+	got, err := io.ReadAll(g)
+	require.NoError(t, err)
+	assert.Equal(t, upgrade+frames, string(got), "after an upgrade the bytes are not HTTP")
+
+	anonymous := strings.Repeat("GET / HTTP/1.1\r\nHost: t\r\n\r\n", 5)
+	g = newRequestGate(bufio.NewReader(strings.NewReader(anonymous)), l, connLogger{})
+	got, err = io.ReadAll(g)
+	require.NoError(t, err)
+	assert.Equal(t, anonymous, string(got))
+}
+
+// TestRequestGate_RewritesHostOfEveryRequest: with --host-rewrite and no
+// limiter, each pipelined head gets the new Host while bodies, chunk framing
+// and trailers come out byte for byte.
+func TestRequestGate_RewritesHostOfEveryRequest(t *testing.T) {
+	request := func(host, extra, body string) string {
+		return "POST /x HTTP/1.1\r\nHost: " + host + "\r\n" + extra + "\r\n" + body
+	}
+	fixed := "Content-Length: 25\r\n"
+	fixedBody := "Host: app.example.com\r\n\r\n"
+	chunked := "Transfer-Encoding: chunked\r\n"
+	chunkedBody := "5\r\nHost:\r\n0\r\nX-Trailer: Host: t\r\n\r\n"
+	in := request("app.example.com", fixed, fixedBody) +
+		request("app.example.com", chunked, chunkedBody) +
+		request("app.example.com", "", "")
+	want := request("myapp.local", fixed+"X-Forwarded-Host: app.example.com\r\n", fixedBody) +
+		request("myapp.local", chunked+"X-Forwarded-Host: app.example.com\r\n", chunkedBody) +
+		request("myapp.local", "X-Forwarded-Host: app.example.com\r\n", "")
+
+	g := newRequestGate(bufio.NewReaderSize(strings.NewReader(in), defaultHTTPPeekBytes), nil, connLogger{})
+	g.rewrite = func(head []byte) []byte { return rewriteHostHeader(head, "myapp.local", true) }
+	require.Nil(t, g.admitFirst())
+	got, err := io.ReadAll(g)
+	require.NoError(t, err)
+	assert.Equal(t, want, string(got))
+
+	notHTTP := "\x16\x03\x01 not a request\r\nHost: app.example.com\r\n\r\n"
+	g = newRequestGate(bufio.NewReader(strings.NewReader(notHTTP)), nil, connLogger{})
+	g.rewrite = func(head []byte) []byte { return rewriteHostHeader(head, "myapp.local", true) }
+	got, err = io.ReadAll(g)
+	require.NoError(t, err)
+	assert.Equal(t, notHTTP, string(got), "not HTTP: passed through untouched")
+}
+
+func TestGatedBackend_RefusalFollowsResponses(t *testing.T) {
+	l, _ := fakeClockLimiter()
+	g := newRequestGate(bufio.NewReader(strings.NewReader("")), l, connLogger{})
+	g.refusal = tooManyRequests(time.Second)
+	client, server := net.Pipe()
+	go func() {
+		_, _ = io.WriteString(server, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n")
+		server.Close()
+	}()
+	got, err := io.ReadAll(&gatedBackend{Conn: client, gate: g})
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"+string(tooManyRequests(time.Second)), string(got))
+}
+
+// TestE2E_RateLimitSource sends bursts from several X-Forwarded-For sources
+// through the public endpoint of an http tunnel with --rate-limit-source
+// 3/minute: only the source over the limit gets 429s, and the backend never
+// sees its excess requests.
+func TestE2E_RateLimitSource(t *testing.T) {
+	var mu sync.Mutex
+	seen := map[string]int{}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen[r.Header.Get("X-Forwarded-For")]++
+		mu.Unlock()
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	tun := stub.AddTunnel("http", backend.Listener.Addr().String())
+
+	rt := e2eRuntime()
+	rt.HTTPAware = true
+	rt.SourceRateLimit = 3
+	rt.SourceRateWindow = time.Minute
+	rt.SourceRateExempt = []netip.Prefix{netip.MustParsePrefix("198.51.100.0/24")}
+	mgr := NewManager(stub.URL, tun.ID, "", 10*time.Millisecond, 50*time.Millisecond, rt)
+	defer mgr.Close()
+	go func() { _ = serveIncomingWithManager(mgr, nil) }()
+	require.NoError(t, stub.WaitSessions(tun.ID, 1, 5*time.Second))
+	public, err := stub.ServePublic(tun.ID)
+	require.NoError(t, err)
+	defer public.Close()
+
+	// Keep-alive connections, so later requests share a stream with earlier ones.
+	client := &http.Client{Timeout: 5 * time.Second}
+	defer client.CloseIdleConnections()
+	status := func(xff string) int {
+		req, err := http.NewRequest(http.MethodGet, "http://"+public.Addr().String()+"/", nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Forwarded-For", xff)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		_, _ = io.Copy(io.Discard, resp.Body)
+		if resp.StatusCode == http.StatusTooManyRequests {
+			assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+		}
+		return resp.StatusCode
+	}
+	limitedBefore := Traffic().Limited()
+	codes := map[string][]int{}
+	for round := range 6 {
+		for _, src := range []string{"203.0.113.66", "203.0.113.67", "198.51.100.5"} {
+			if src == "203.0.113.67" && round >= 2 {
+				continue
+			}
+			codes[src] = append(codes[src], status(src))
+		}
+	}
+	assert.Equal(t, []int{200, 200, 200, 429, 429, 429}, codes["203.0.113.66"])
+	assert.Equal(t, []int{200, 200}, codes["203.0.113.67"])
+	assert.Equal(t, []int{200, 200, 200, 200, 200, 200}, codes["198.51.100.5"], "exempt")
+	mu.Lock()
+	assert.Equal(t, map[string]int{"203.0.113.66": 3, "203.0.113.67": 2, "198.51.100.5": 6}, seen)
+	mu.Unlock()
+	assert.Equal(t, int64(3), Traffic().Limited()-limitedBefore)
+
+	var summary bytes.Buffer
+	WriteSourceLimitSummary(&summary)
+	assert.Contains(t, summary.String(), fmt.Sprintf("%d requests answered with 429", Traffic().Limited()))
+}
+
+// TestE2E_HostRewrite sends keep-alive requests through the public endpoint
+// of an http tunnel with --host-rewrite: every one reaches the backend with
+// the new Host and its body unchanged.
+func TestE2E_HostRewrite(t *testing.T) {
+	type seen struct{ host, forwarded, body string }
+	var mu sync.Mutex
+	var got []seen
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		got = append(got, seen{r.Host, r.Header.Get("X-Forwarded-Host"), string(body)})
+		mu.Unlock()
+		_, _ = w.Write(body)
+	}))
+	defer backend.Close()
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	tun := stub.AddTunnel("http", backend.Listener.Addr().String())
+
+	rt := e2eRuntime()
+	rt.HTTPAware = true
+	rt.HostRewrite = "myapp.local"
+	rt.HostRewriteForwarded = true
+	mgr := NewManager(stub.URL, tun.ID, "", 10*time.Millisecond, 50*time.Millisecond, rt)
+	defer mgr.Close()
+	go func() { _ = serveIncomingWithManager(mgr, nil) }()
+	require.NoError(t, stub.WaitSessions(tun.ID, 1, 5*time.Second))
+	public, err := stub.ServePublic(tun.ID)
+	require.NoError(t, err)
+	defer public.Close()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	defer client.CloseIdleConnections()
+	bodies := []string{"first", "", strings.Repeat("Host: x\r\n", 1000)}
+	for _, body := range bodies {
+		req, err := http.NewRequest(http.MethodPost, "http://"+public.Addr().String()+"/", strings.NewReader(body))
+		require.NoError(t, err)
+		req.Host = "app.example.com"
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		echoed, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		assert.Equal(t, body, string(echoed))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, got, len(bodies))
+	for i, s := range got {
+		assert.Equal(t, seen{"myapp.local", "app.example.com", bodies[i]}, s)
+	}
+}
@@ -0,0 +1,450 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/support"
+)
+
+const (
+	// queueReplayInterval is how often the queue retries its oldest request
+	// while the backend is down; a successful dial of a stream retries at
+	// once.
+	queueReplayInterval = backendDownCooldown
+	// queueReplayTimeout bounds one replayed request, response included.
+	queueReplayTimeout = 30 * time.Second
+	// queueReplayedKeep is how many replayed entries the queue remembers.
+	queueReplayedKeep = 4096
+
+	queueEntryExt     = ".req"
+	queueReplayedLog  = "replayed"
+	queueReplayFormat = "[WARN] queue: replaying %s failed, retrying in %s: %v"
+)
+
+// queuedResponse answers a request --queue-requests queued.
+const queuedResponse = "HTTP/1.1 202 Accepted\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Length: 70\r\n" +
+	"Connection: close\r\n" +
+	"\r\n" +
+	"queued: the service is restarting and receives this request once back\n"
+
+var errQueueFull = errors.New("the request queue is full (--queue-max-entries)")
+
+// processQueue is the --queue-requests queue of this process, shared by the
+// stream servers of every transport; nil when the flag is off.
+var processQueue atomic.Pointer[requestQueue]
+
+// StartRequestQueue opens the --queue-requests queue and replays what it
+// holds, including requests queued by an earlier run, whenever the backend
+// answers. The returned func stops the replay.
+func StartRequestQueue(settings config.RuntimeSettings, reporter BackendStateReporter) (func(), error) {
+	if !settings.QueueRequests {
+		return func() {}, nil
+	}
+	q, err := openRequestQueue(settings)
+	if err != nil {
+		return nil, err
+	}
+	server, err := newIncomingStreamServer("", settings, reporter)
+	if err != nil {
+		return nil, err
+	}
+	q.dial = func(dst string) (net.Conn, error) {
+		conn, _, err := server.dialTarget(dst, connLogger{})
+		return conn, err
+	}
+	if n := q.pending(); n > 0 {
+		log.Printf("[INFO] queue: %d requests from an earlier run wait in %s", n, q.dir)
+	}
+	processQueue.Store(q)
+	stop := make(chan struct{})
+	support.Go(support.PanicScope{Role: "request queue replay"}, func() { q.run(stop) })
+	return func() {
+		processQueue.CompareAndSwap(q, nil)
+		close(stop)
+	}, nil
+}
+
+// queueFor returns the process queue for the stream servers of an
+// HTTPAware tunnel.
+func queueFor(settings config.RuntimeSettings) *requestQueue {
+	if !settings.HTTPAware {
+		return nil
+	}
+	return processQueue.Load()
+}
+
+// requestQueue keeps the requests that arrived while the backend could not
+// be dialed (--queue-requests), one file per request, and replays them in
+// arrival order once it answers. A replayed request is recorded by sequence
+// number and content hash before its file is removed, so that a crash in
+// between does not deliver it twice.
+type requestQueue struct {
+	dir        string
+	maxBody    int64
+	maxEntries int
+	methods    map[string]bool
+	clock      support.Clock
+	// dial reaches the backend of a queued request.
+	dial func(dst string) (net.Conn, error)
+	// wake makes run replay at once.
+	wake chan struct{}
+
+	mu       sync.Mutex
+	next     uint64
+	entries  int
+	replayed map[string]bool
+	order    []string
+}
+
+// queuedHeader is the first line of a queue file; the request follows.
+type queuedHeader struct {
+	Dst      string    `json:"dst"`
+	QueuedAt time.Time `json:"queued_at"`
+}
+
+func openRequestQueue(settings config.RuntimeSettings) (*requestQueue, error) {
+	dir := settings.QueueDir
+	if dir == "" {
+		var err error
+		if dir, err = config.RequestQueueDir(); err != nil {
+			return nil, fmt.Errorf("--queue-dir: %w", err)
+		}
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("--queue-dir: %w", err)
+	}
+	q := &requestQueue{
+		dir:        dir,
+		maxBody:    settings.QueueMaxBody,
+		maxEntries: settings.QueueMaxEntries,
+		methods:    map[string]bool{},
+		clock:      support.RealClock,
+		wake:       make(chan struct{}, 1),
+		replayed:   map[string]bool{},
+	}
+	for _, m := range settings.QueueMethods {
+		q.methods[m] = true
+	}
+	if err := q.load(); err != nil {
+		return nil, fmt.Errorf("--queue-dir: %w", err)
+	}
+	return q, nil
+}
+
+// load reads the replayed log and counts the queued requests. Sequence
+// numbers continue after the highest one seen in either, so that a new
+// request never takes the number of one replayed before.
+func (q *requestQueue) load() error {
+	b, err := os.ReadFile(filepath.Join(q.dir, queueReplayedLog))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		seq, _, ok := strings.Cut(line, " ")
+		n, err := strconv.ParseUint(seq, 10, 64)
+		if !ok || err != nil {
+			continue
+		}
+		q.remember(line)
+		q.next = max(q.next, n+1)
+	}
+	names, err := q.list()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		n, _ := strconv.ParseUint(strings.TrimSuffix(name, queueEntryExt), 10, 64)
+		q.next = max(q.next, n+1)
+	}
+	q.entries = len(names)
+	return q.rewriteReplayed()
+}
+
+// list returns the queued files, oldest first.
+func (q *requestQueue) list() ([]string, error) {
+	des, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, de := range des {
+		name := de.Name()
+		if _, err := strconv.ParseUint(strings.TrimSuffix(name, queueEntryExt), 10, 64); err == nil && strings.HasSuffix(name, queueEntryExt) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (q *requestQueue) pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.entries
+}
+
+// offer reads the request at br and queues it for dst when its method may
+// be queued and its body fits into --queue-max-body. It reports whether it
+// did; br may then have been read from either way.
+func (q *requestQueue) offer(br *bufio.Reader, dst string, lg connLogger) bool {
+	req, err := http.ReadRequest(br)
+	if err != nil || !q.methods[req.Method] || req.ContentLength > q.maxBody {
+		return false
+	}
+	body, err := io.ReadAll(io.LimitReader(req.Body, q.maxBody+1))
+	if err != nil || int64(len(body)) > q.maxBody {
+		return false
+	}
+	req.Body, req.ContentLength, req.TransferEncoding = io.NopCloser(bytes.NewReader(body)), int64(len(body)), nil
+	// The request is replayed on a connection of its own; Write adds no
+	// User-Agent of its own to a request that had none.
+	req.Close = true
+	if _, ok := req.Header["User-Agent"]; !ok {
+		req.Header["User-Agent"] = []string{""}
+	}
+	var raw bytes.Buffer
+	if err := req.Write(&raw); err != nil {
+		return false
+	}
+	if err := q.enqueue(dst, raw.Bytes()); err != nil {
+		lg.Printf("backend unreachable, not queueing %s %s: %v", req.Method, support.SanitizeRemote(req.URL.Path), err)
+		return false
+	}
+	lg.Printf("backend unreachable, queued %s %s for replay", req.Method, support.SanitizeRemote(req.URL.Path))
+	return true
+}
+
+// enqueue writes a queue file for the request raw to dst.
+func (q *requestQueue) enqueue(dst string, raw []byte) error {
+	head, err := json.Marshal(queuedHeader{Dst: dst, QueuedAt: q.clock.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.entries >= q.maxEntries {
+		return errQueueFull
+	}
+	name := fmt.Sprintf("%020d%s", q.next, queueEntryExt)
+	tmp := filepath.Join(q.dir, name+".tmp")
+	if err := writeSynced(tmp, append(append(head, '\n'), raw...)); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(q.dir, name)); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	q.next++
+	q.entries++
+	return nil
+}
+
+func writeSynced(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// kick makes the replay loop try the queue now.
+func (q *requestQueue) kick() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *requestQueue) run(stop <-chan struct{}) {
+	ticker := q.clock.NewTicker(queueReplayInterval)
+	defer ticker.Stop()
+	for {
+		q.replay()
+		select {
+		case <-stop:
+			return
+		case <-q.wake:
+		case <-ticker.C():
+		}
+	}
+}
+
+// replay delivers the queued requests in order, stopping at the first one
+// the backend does not take.
+func (q *requestQueue) replay() {
+	for {
+		names, err := q.list()
+		if err != nil {
+			log.Printf("[WARN] queue: %v", err)
+			return
+		}
+		if len(names) == 0 || !q.replayOne(names[0]) {
+			return
+		}
+	}
+}
+
+// replayOne delivers the queue file name. It reports false when the backend
+// could not be reached or answered with a 5xx: the file stays for the next
+// try.
+func (q *requestQueue) replayOne(name string) bool {
+	path := filepath.Join(q.dir, name)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("[WARN] queue: %v", err)
+		return false
+	}
+	seq := strings.TrimSuffix(name, queueEntryExt)
+	sum := sha256.Sum256(data)
+	key := seq + " " + hex.EncodeToString(sum[:])
+	if q.wasReplayed(key) {
+		// Replayed before a crash removed the file.
+		return q.remove(path) == nil
+	}
+	line, raw, _ := bytes.Cut(data, []byte("\n"))
+	var hdr queuedHeader
+	if err := json.Unmarshal(line, &hdr); err != nil || hdr.Dst == "" {
+		log.Printf("[WARN] queue: dropping unreadable %s", name)
+		return q.remove(path) == nil
+	}
+	what := requestLine(raw)
+	status, err := q.deliver(hdr.Dst, raw)
+	if err == nil && status >= http.StatusInternalServerError {
+		err = fmt.Errorf("backend answered %d", status)
+	}
+	if err != nil {
+		support.RepeatLogs.Printf(support.LogKey(queueReplayFormat), queueReplayFormat, what, queueReplayInterval, err)
+		return false
+	}
+	if err := q.markReplayed(key); err != nil {
+		log.Printf("[WARN] queue: %v", err)
+		return false
+	}
+	if err := q.remove(path); err != nil {
+		log.Printf("[WARN] queue: %v", err)
+		return false
+	}
+	support.RepeatLogs.Transition(support.LogKey(queueReplayFormat), "[INFO] queue: replayed %s: %d %s (queued %s ago)",
+		what, status, http.StatusText(status), q.clock.Now().Sub(hdr.QueuedAt).Round(time.Second))
+	return true
+}
+
+// deliver sends raw to the backend of dst and returns the response status.
+func (q *requestQueue) deliver(dst string, raw []byte) (int, error) {
+	conn, err := q.dial(dst)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(queueReplayTimeout))
+	if _, err := conn.Write(raw); err != nil {
+		return 0, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return 0, err
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func (q *requestQueue) remove(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	q.mu.Lock()
+	q.entries--
+	q.mu.Unlock()
+	return nil
+}
+
+func (q *requestQueue) wasReplayed(key string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.replayed[key]
+}
+
+// markReplayed records key in the replayed log before the file is removed.
+func (q *requestQueue) markReplayed(key string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.remember(key)
+	f, err := os.OpenFile(filepath.Join(q.dir, queueReplayedLog), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(key + "\n"); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// remember adds key to the replayed set, forgetting the oldest beyond
+// queueReplayedKeep: only entries still queued can be replayed again, and
+// those are the newest.
+func (q *requestQueue) remember(key string) {
+	q.replayed[key] = true
+	q.order = append(q.order, key)
+	if len(q.order) > queueReplayedKeep {
+		delete(q.replayed, q.order[0])
+		q.order = q.order[1:]
+	}
+}
+
+// rewriteReplayed trims the replayed log to the entries remembered.
+func (q *requestQueue) rewriteReplayed() error {
+	if len(q.order) == 0 {
+		return nil
+	}
+	path := filepath.Join(q.dir, queueReplayedLog)
+	if err := writeSynced(path+".tmp", []byte(strings.Join(q.order, "\n")+"\n")); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// requestLine returns the method and path of the request raw for logs.
+func requestLine(raw []byte) string {
+	line, _, _ := bytes.Cut(raw, []byte("\r\n"))
+	method, rest, _ := strings.Cut(string(line), " ")
+	target, _, _ := strings.Cut(rest, " ")
+	return method + " " + support.SanitizeRemote(target)
+}
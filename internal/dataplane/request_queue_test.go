@@ -0,0 +1,168 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+)
+
+// testQueue opens a queue in dir that takes POST and PUT requests with up
+// to 64 body bytes, and dials backends directly.
+func testQueue(t *testing.T, dir string, maxEntries int) *requestQueue {
+	t.Helper()
+	q, err := openRequestQueue(config.RuntimeSettings{
+		QueueRequests:   true,
+		QueueDir:        dir,
+		QueueMaxBody:    64,
+		QueueMaxEntries: maxEntries,
+		QueueMethods:    []string{http.MethodPost, http.MethodPut},
+	})
+	require.NoError(t, err)
+	q.dial = func(dst string) (net.Conn, error) { return net.Dial("tcp", dst) }
+	return q
+}
+
+// sendThrough sends a request to dst on a new stream of server and returns
+// the response status.
+func sendThrough(t *testing.T, server *memSession, dst, method, path, body string) int {
+	t.Helper()
+	st, rd, line := openWithPreface(t, server, dst, nil)
+	defer st.Close()
+	require.Equal(t, setupAckLine, line)
+	req, err := http.NewRequest(method, "http://app.local"+path, strings.NewReader(body))
+	require.NoError(t, err)
+	require.NoError(t, req.Write(st))
+	resp, err := http.ReadResponse(rd, req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode
+}
+
+// hookBackend listens on addr and records the requests it gets; it answers
+// each with status.
+type hookBackend struct {
+	mu     sync.Mutex
+	got    []string
+	status int
+}
+
+func startHookBackend(t *testing.T, addr string, status int) *hookBackend {
+	t.Helper()
+	b := &hookBackend{status: status}
+	ln, err := net.Listen("tcp", addr)
+	require.NoError(t, err)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		b.mu.Lock()
+		b.got = append(b.got, r.Method+" "+r.URL.Path+" "+string(body))
+		b.mu.Unlock()
+		w.WriteHeader(b.status)
+	})}
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(func() { _ = srv.Close() })
+	return b
+}
+
+func (b *hookBackend) requests() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.got...)
+}
+
+func TestRequestQueue_QueuesDuringOutageAndReplaysInOrder(t *testing.T) {
+	q := testQueue(t, t.TempDir(), 10)
+	server, _ := serveSession(t, incomingStreamServer{tunnelID: "t1", httpAware: true, queue: q})
+	dst := refusedAddr(t)
+
+	assert.Equal(t, http.StatusAccepted, sendThrough(t, server, dst, http.MethodPost, "/hook", "one"))
+	assert.Equal(t, http.StatusAccepted, sendThrough(t, server, dst, http.MethodPut, "/hook", "two"))
+	assert.Equal(t, http.StatusBadGateway, sendThrough(t, server, dst, http.MethodGet, "/page", ""), "GET is not queued")
+	assert.Equal(t, http.StatusBadGateway, sendThrough(t, server, dst, http.MethodPost, "/big", strings.Repeat("x", 65)), "over --queue-max-body")
+	assert.Equal(t, http.StatusAccepted, sendThrough(t, server, dst, http.MethodPost, "/hook", "three"))
+	assert.Equal(t, 3, q.pending())
+
+	q.replay()
+	assert.Equal(t, 3, q.pending(), "the backend is still down")
+
+	backend := startHookBackend(t, dst, http.StatusOK)
+	q.replay()
+	assert.Equal(t, []string{"POST /hook one", "PUT /hook two", "POST /hook three"}, backend.requests())
+	assert.Zero(t, q.pending())
+}
+
+func TestRequestQueue_FullQueueGetsTheNormalError(t *testing.T) {
+	q := testQueue(t, t.TempDir(), 1)
+	server, _ := serveSession(t, incomingStreamServer{tunnelID: "t1", httpAware: true, queue: q})
+	dst := refusedAddr(t)
+
+	assert.Equal(t, http.StatusAccepted, sendThrough(t, server, dst, http.MethodPost, "/hook", "one"))
+	assert.Equal(t, http.StatusBadGateway, sendThrough(t, server, dst, http.MethodPost, "/hook", "two"))
+	assert.Equal(t, 1, q.pending())
+}
+
+func TestRequestQueue_SurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	dst := refusedAddr(t)
+	q := testQueue(t, dir, 10)
+	require.NoError(t, q.enqueue(dst, []byte("POST /a HTTP/1.1\r\nHost: app\r\nContent-Length: 1\r\nConnection: close\r\n\r\na")))
+	require.NoError(t, q.enqueue(dst, []byte("POST /b HTTP/1.1\r\nHost: app\r\nContent-Length: 1\r\nConnection: close\r\n\r\nb")))
+
+	restarted := testQueue(t, dir, 10)
+	assert.Equal(t, 2, restarted.pending())
+	backend := startHookBackend(t, dst, http.StatusOK)
+	restarted.replay()
+	assert.Equal(t, []string{"POST /a a", "POST /b b"}, backend.requests())
+
+	again := testQueue(t, dir, 10)
+	require.NoError(t, again.enqueue(dst, []byte("POST /a HTTP/1.1\r\nHost: app\r\nContent-Length: 1\r\nConnection: close\r\n\r\na")))
+	again.replay()
+	assert.Len(t, backend.requests(), 3, "the same request sent again is a new delivery")
+}
+
+func TestRequestQueue_NeverReplaysTwice(t *testing.T) {
+	dir := t.TempDir()
+	dst := refusedAddr(t)
+	q := testQueue(t, dir, 10)
+	require.NoError(t, q.enqueue(dst, []byte("POST /a HTTP/1.1\r\nHost: app\r\nContent-Length: 1\r\nConnection: close\r\n\r\na")))
+	names, err := q.list()
+	require.NoError(t, err)
+	require.Len(t, names, 1)
+
+	// A crash after the delivery was recorded, before the file was removed:
+	// put the file back.
+	backend := startHookBackend(t, dst, http.StatusOK)
+	data, err := os.ReadFile(filepath.Join(dir, names[0]))
+	require.NoError(t, err)
+	require.True(t, q.replayOne(names[0]))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, names[0]), data, 0o600))
+
+	restarted := testQueue(t, dir, 10)
+	restarted.replay()
+	assert.Len(t, backend.requests(), 1)
+	assert.Zero(t, restarted.pending())
+}
+
+func TestRequestQueue_ServerErrorKeepsTheRequest(t *testing.T) {
+	q := testQueue(t, t.TempDir(), 10)
+	dst := refusedAddr(t)
+	require.NoError(t, q.enqueue(dst, []byte("POST /a HTTP/1.1\r\nHost: app\r\nContent-Length: 1\r\nConnection: close\r\n\r\na")))
+	backend := startHookBackend(t, dst, http.StatusServiceUnavailable)
+
+	q.replay()
+	assert.Len(t, backend.requests(), 1)
+	assert.Equal(t, 1, q.pending(), "a 5xx is retried later")
+}
@@ -0,0 +1,300 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fortunnels/client/internal/config"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+// resumeKeep is how long an interrupted response stays resumable: the server
+// resumes it once the client is back on a new session.
+const resumeKeep = time.Minute
+
+// maxResumable bounds the interrupted responses kept at a time.
+const maxResumable = 256
+
+var (
+	// errNotResumable answers a resuming stream whose response is unknown,
+	// expired or not at the offset the server asks for.
+	errNotResumable = errors.New("response cannot be resumed")
+	// errRangeRefused is a backend that did not answer the ranged request
+	// with the rest of the same response.
+	errRangeRefused = errors.New("backend did not serve the remaining range")
+	// errResumeFull and errResumeMemory are why an interrupted response was
+	// not kept: too many are kept already, or --memory-budget has no room.
+	errResumeFull   = fmt.Errorf("%d responses are waiting already", maxResumable)
+	errResumeMemory = errors.New("no room in --memory-budget")
+)
+
+// resumeRegistry keeps the interrupted GET responses of HTTPAware streams by
+// resume token (--resume-get). It spans sessions: the server resumes a
+// response on a stream of the session that replaced the failed one.
+type resumeRegistry struct {
+	mu      sync.Mutex
+	pending map[string]*resumeRecord
+}
+
+// resumeRecord is what a resuming stream needs of an interrupted response:
+// the request to repeat with a Range header, the backend that answered it
+// and how the response was framed.
+type resumeRecord struct {
+	backend string
+	head    []byte
+	// headLen is the size of the response head; length is the
+	// Content-Length of its body and written what reached the stream.
+	headLen int64
+	length  int64
+	written int64
+	// validator is the If-Range value: a strong ETag or Last-Modified.
+	validator string
+	expires   time.Time
+}
+
+func newResumeRegistry(settings config.RuntimeSettings) *resumeRegistry {
+	if !settings.ResumeGET || !settings.HTTPAware {
+		return nil
+	}
+	return &resumeRegistry{pending: make(map[string]*resumeRecord)}
+}
+
+// keep makes rec resumable with token until resumeKeep has passed. It fails
+// when too many responses are kept already or resumeMemory has no room for
+// the record.
+func (r *resumeRegistry) keep(token string, rec *resumeRecord) error {
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for t, old := range r.pending {
+		if now.After(old.expires) {
+			r.dropLocked(t, old)
+		}
+	}
+	if len(r.pending) >= maxResumable {
+		return errResumeFull
+	}
+	if !resumeMemory.Reserve(rec.size()) {
+		return errResumeMemory
+	}
+	if old := r.pending[token]; old != nil {
+		r.dropLocked(token, old)
+	}
+	rec.expires = now.Add(resumeKeep)
+	r.pending[token] = rec
+	return nil
+}
+
+// take removes and returns the response kept with token, nil when there is
+// none or it expired.
+func (r *resumeRegistry) take(token string) *resumeRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec := r.pending[token]
+	if rec == nil {
+		return nil
+	}
+	r.dropLocked(token, rec)
+	if time.Now().After(rec.expires) {
+		return nil
+	}
+	return rec
+}
+
+// dropLocked removes the record kept with token and returns its memory.
+func (r *resumeRegistry) dropLocked(token string, rec *resumeRecord) {
+	delete(r.pending, token)
+	resumeMemory.Release(rec.size())
+}
+
+// size is what a kept record holds for resumeMemory.
+func (rec *resumeRecord) size() int64 { return int64(len(rec.head)) }
+
+// resumeTracker follows the response to a stream's first request, a GET
+// without a body, as it is written to the stream: the response is
+// resumable while it is a 200 with Accept-Ranges: bytes and a
+// Content-Length whose body has not been written in full.
+type resumeTracker struct {
+	req    *http.Request
+	head   []byte
+	budget int
+
+	// buf collects the response head until it is complete; parsed is set
+	// once it was, gaveUp when the response cannot be resumed.
+	buf       []byte
+	parsed    bool
+	gaveUp    bool
+	written   int64
+	headLen   int64
+	length    int64
+	validator string
+}
+
+// newResumeTracker peeks at the stream's first request head in rd and
+// returns its tracker, or nil unless it is a GET without a body or Range.
+func newResumeTracker(rd *bufio.Reader, budget int) *resumeTracker {
+	head, err := peekHTTPRequestHead(rd)
+	if head == nil || err != nil {
+		return nil
+	}
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(head)))
+	if err != nil || req.Method != http.MethodGet || req.ContentLength != 0 || len(req.TransferEncoding) > 0 ||
+		req.Header.Get("Range") != "" || req.Header.Get("Upgrade") != "" {
+		return nil
+	}
+	return &resumeTracker{req: req, head: bytes.Clone(head), budget: budget}
+}
+
+// observe counts p, written to the stream, and parses the response head.
+func (t *resumeTracker) observe(p []byte) {
+	t.written += int64(len(p))
+	if t.parsed || t.gaveUp {
+		return
+	}
+	t.buf = append(t.buf, p...)
+	i := bytes.Index(t.buf, []byte("\r\n\r\n"))
+	if i < 0 {
+		if len(t.buf) > t.budget {
+			t.gaveUp, t.buf = true, nil
+		}
+		return
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(t.buf[:i+4])), t.req)
+	t.buf = nil
+	if err != nil || resp.StatusCode != http.StatusOK || resp.ContentLength < 0 || len(resp.TransferEncoding) > 0 ||
+		!strings.EqualFold(strings.TrimSpace(resp.Header.Get("Accept-Ranges")), "bytes") {
+		t.gaveUp = true
+		return
+	}
+	t.parsed = true
+	t.headLen, t.length = int64(i+4), resp.ContentLength
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		t.validator = etag
+	} else {
+		t.validator = resp.Header.Get("Last-Modified")
+	}
+}
+
+// interrupted returns the record of a resumable response that was cut off,
+// nil for one that ended or cannot be resumed.
+func (t *resumeTracker) interrupted(backend string) *resumeRecord {
+	if !t.parsed || t.written >= t.headLen+t.length {
+		return nil
+	}
+	return &resumeRecord{backend: backend, head: t.head, headLen: t.headLen, length: t.length, written: t.written, validator: t.validator}
+}
+
+// resumeStream tees what is written to the stream into a resumeTracker.
+type resumeStream struct {
+	io.ReadWriteCloser
+	t *resumeTracker
+}
+
+func (s resumeStream) Write(p []byte) (int, error) {
+	n, err := s.ReadWriteCloser.Write(p)
+	s.t.observe(p[:n])
+	return n, err
+}
+
+// CloseWrite keeps half-close working through the wrapper.
+func (s resumeStream) CloseWrite() error {
+	if cw, ok := s.ReadWriteCloser.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return s.ReadWriteCloser.Close()
+}
+
+// keepInterrupted keeps the response t followed for resumption with token
+// when the stream ended before it did.
+func (s incomingStreamServer) keepInterrupted(token, backend string, t *resumeTracker, lg connLogger) {
+	rec := t.interrupted(backend)
+	if rec == nil {
+		return
+	}
+	if err := s.resume.keep(token, rec); err != nil {
+		lg.Printf("resume: %v, not keeping this one", err)
+		return
+	}
+	lg.Printf("resume: response interrupted after %d of %d body bytes, resumable for %s", max(rec.written-rec.headLen, 0), rec.length, resumeKeep)
+}
+
+// serveResume serves a stream resuming a response (PrefaceResumeOffset): it
+// requests the rest of the body from the backend with a Range header and
+// sends it from the offset the server asks for. It returns the backend and
+// the bytes sent.
+func (s incomingStreamServer) serveResume(stream io.ReadWriteCloser, pre map[string]string, hops int, quota *streamQuota, lg connLogger) (string, int64, error) {
+	rec := s.resume.take(pre[protocolv1.PrefaceResume])
+	offset, err := strconv.ParseInt(pre[protocolv1.PrefaceResumeOffset], 10, 64)
+	if rec == nil || err != nil || offset < rec.headLen || offset > rec.written || offset > rec.headLen+rec.length {
+		writeSetupError(stream, errNotResumable)
+		return "", 0, errNotResumable
+	}
+	from := offset - rec.headLen
+	if from == rec.length {
+		// The server got the whole body but not the end of the stream.
+		if _, err := stream.Write([]byte(setupAckLine)); err != nil {
+			return rec.backend, 0, err
+		}
+		closeWriteOrClose(stream)
+		return rec.backend, 0, nil
+	}
+	conn, err := s.dialBackend(rec.backend)
+	s.report(rec.backend, err)
+	if err != nil {
+		failSetup(stream, false, err)
+		return rec.backend, 0, err
+	}
+	defer conn.Close()
+	defer track(&processFDs.localConns)()
+	defer localHops.track(conn, hops)()
+	if _, err := conn.Write(rangeRequestHead(rec.head, from, rec.validator)); err != nil {
+		failSetup(stream, false, err)
+		return rec.backend, 0, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		failSetup(stream, false, err)
+		return rec.backend, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent || resp.Header.Get("Content-Range") != fmt.Sprintf("bytes %d-%d/%d", from, rec.length-1, rec.length) {
+		err := fmt.Errorf("%w: %s", errRangeRefused, resp.Status)
+		writeSetupError(stream, err)
+		return rec.backend, 0, err
+	}
+	if _, err := stream.Write([]byte(setupAckLine)); err != nil {
+		return rec.backend, 0, err
+	}
+	toStream := quotaWriter{countingWriter{throttledWriter{blockedWriter{stream, &processStalls}, &processLimits.up}, &processTraffic.up}, quota, true}
+	n, err := io.CopyN(toStream, resp.Body, rec.length-from)
+	if err == nil {
+		closeWriteOrClose(stream)
+	}
+	lg.Printf("resume: sent %d body bytes from byte %d of %d", n, from, rec.length)
+	return rec.backend, n, err
+}
+
+// rangeRequestHead returns head, a request head, asking for the body from
+// byte from on; validator, when set, makes a changed resource fail the
+// range instead of splicing another body onto the first part.
+func rangeRequestHead(head []byte, from int64, validator string) []byte {
+	var b bytes.Buffer
+	b.Write(head[:len(head)-2])
+	fmt.Fprintf(&b, "Range: bytes=%d-\r\n", from)
+	if validator != "" {
+		fmt.Fprintf(&b, "If-Range: %s\r\n", validator)
+	}
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
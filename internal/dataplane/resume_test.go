@@ -0,0 +1,216 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+// stallingBackend serves body. The first request without a Range header
+// gets its head and half the body, then nothing until the connection
+// closes; ranged requests are served by http.ServeContent when ranges is
+// set, and answered in full otherwise.
+func stallingBackend(t *testing.T, body []byte, ranges bool) (addr string, requests *atomic.Int32, ranged *atomic.Int32) {
+	t.Helper()
+	requests, ranged = new(atomic.Int32), new(atomic.Int32)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("Range") != "" {
+			ranged.Add(1)
+		}
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("Range") == "" && requests.Load() == 1 {
+			if ranges {
+				w.Header().Set("Accept-Ranges", "bytes")
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			_, _ = w.Write(body[:len(body)/2])
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		if !ranges {
+			_, _ = w.Write(body)
+			return
+		}
+		http.ServeContent(w, r, "blob", time.Time{}, bytes.NewReader(body))
+	}))
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://"), requests, ranged
+}
+
+// resumeServer serves the streams of client sessions with --resume-get.
+func resumeServer() incomingStreamServer {
+	return incomingStreamServer{
+		tunnelID:  "t1",
+		httpAware: true,
+		resume:    newResumeRegistry(config.RuntimeSettings{ResumeGET: true, HTTPAware: true}),
+	}
+}
+
+// serveSession accepts the streams of a new session pair with s and returns
+// its server end and a channel receiving one value per stream served.
+func serveSession(t *testing.T, s incomingStreamServer) (*memSession, <-chan struct{}) {
+	t.Helper()
+	client, server := newMemSessionPair()
+	t.Cleanup(func() { _ = client.Close() })
+	served := make(chan struct{}, 4)
+	go func() {
+		for {
+			st, err := client.AcceptStream()
+			if err != nil {
+				return
+			}
+			go func() {
+				s.serveLogged(st)
+				served <- struct{}{}
+			}()
+		}
+	}()
+	return server, served
+}
+
+// openWithPreface opens a stream to dst with the extra preface fields and
+// returns it with its reader and the setup line.
+func openWithPreface(t *testing.T, server *memSession, dst string, extra map[string]string) (Stream, *bufio.Reader, string) {
+	t.Helper()
+	fields := map[string]string{"dst": dst, "proto": "tcp", "tunnel_id": "t1"}
+	for k, v := range extra {
+		fields[k] = v
+	}
+	preface, err := encodePreface(fields)
+	require.NoError(t, err)
+	st, err := server.OpenStream()
+	require.NoError(t, err)
+	_, err = st.Write(preface)
+	require.NoError(t, err)
+	require.NoError(t, st.SetReadDeadline(time.Now().Add(5*time.Second)))
+	rd := bufio.NewReader(st)
+	line, err := rd.ReadString('\n')
+	require.NoError(t, err)
+	return st, rd, line
+}
+
+// interruptGET sends a GET on a stream with resume token, reads the
+// response head and keep body bytes, then fails the session. It returns
+// the head and the body bytes read.
+func interruptGET(t *testing.T, s incomingStreamServer, dst, token string, keep int) (head string, body []byte) {
+	t.Helper()
+	server, served := serveSession(t, s)
+	st, rd, line := openWithPreface(t, server, dst, map[string]string{protocolv1.PrefaceResume: token})
+	require.Equal(t, setupAckLine, line)
+	_, err := st.Write([]byte("GET /blob HTTP/1.1\r\nHost: app.local\r\n\r\n"))
+	require.NoError(t, err)
+	for !strings.HasSuffix(head, "\r\n\r\n") {
+		l, err := rd.ReadString('\n')
+		require.NoError(t, err)
+		head += l
+	}
+	body = make([]byte, keep)
+	_, err = io.ReadFull(rd, body)
+	require.NoError(t, err)
+
+	server.fail(errors.New("websocket: close 1006 (abnormal closure)"))
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the interrupted stream was not served to the end")
+	}
+	return head, body
+}
+
+func TestResumeGET_SplicesRangeOntoResumedStream(t *testing.T) {
+	body := make([]byte, 1<<20)
+	_, _ = rand.Read(body)
+	dst, requests, ranged := stallingBackend(t, body, true)
+	s := resumeServer()
+
+	head, got := interruptGET(t, s, dst, "tok-1", 10000)
+	assert.Contains(t, head, "HTTP/1.1 200 OK\r\n")
+
+	// The server resumes on a new session from the bytes it received.
+	server, _ := serveSession(t, s)
+	offset := strconv.Itoa(len(head) + len(got))
+	st, rd, line := openWithPreface(t, server, dst, map[string]string{protocolv1.PrefaceResume: "tok-1", protocolv1.PrefaceResumeOffset: offset})
+	defer st.Close()
+	require.Equal(t, setupAckLine, line)
+	rest, err := io.ReadAll(rd)
+	require.NoError(t, err)
+	got = append(got, rest...)
+
+	assert.Equal(t, sha256.Sum256(body), sha256.Sum256(got))
+	assert.Equal(t, int32(2), requests.Load())
+	assert.Equal(t, int32(1), ranged.Load())
+
+	// A token resumes once.
+	_, _, line = openWithPreface(t, server, dst, map[string]string{protocolv1.PrefaceResume: "tok-1", protocolv1.PrefaceResumeOffset: offset})
+	assert.Equal(t, `{"error":"response cannot be resumed","ok":false}`+"\n", line)
+}
+
+func TestResumeGET_LeavesBackendsWithoutRangesAlone(t *testing.T) {
+	body := bytes.Repeat([]byte("0123456789abcdef"), 1<<14)
+	dst, requests, ranged := stallingBackend(t, body, false)
+	s := resumeServer()
+
+	head, got := interruptGET(t, s, dst, "tok-2", 10000)
+	assert.NotContains(t, head, "Accept-Ranges")
+	assert.Empty(t, s.resume.pending, "nothing is kept for a backend without ranges")
+
+	server, _ := serveSession(t, s)
+	offset := strconv.Itoa(len(head) + len(got))
+	_, _, line := openWithPreface(t, server, dst, map[string]string{protocolv1.PrefaceResume: "tok-2", protocolv1.PrefaceResumeOffset: offset})
+	assert.Equal(t, `{"error":"response cannot be resumed","ok":false}`+"\n", line)
+	assert.Equal(t, int32(1), requests.Load())
+	assert.Zero(t, ranged.Load())
+}
+
+func TestResumeGET_RefusesOffsetsOutsideTheBody(t *testing.T) {
+	body := make([]byte, 64<<10)
+	dst, _, _ := stallingBackend(t, body, true)
+	s := resumeServer()
+
+	head, _ := interruptGET(t, s, dst, "tok-3", 1000)
+	server, _ := serveSession(t, s)
+	// Past what reached the stream: the server cannot have received it.
+	beyond := strconv.Itoa(len(head) + len(body))
+	_, _, line := openWithPreface(t, server, dst, map[string]string{protocolv1.PrefaceResume: "tok-3", protocolv1.PrefaceResumeOffset: beyond})
+	assert.Equal(t, `{"error":"response cannot be resumed","ok":false}`+"\n", line)
+}
+
+func TestRangeRequestHead(t *testing.T) {
+	head := []byte("GET /blob HTTP/1.1\r\nHost: app.local\r\n\r\n")
+	assert.Equal(t, "GET /blob HTTP/1.1\r\nHost: app.local\r\nRange: bytes=100-\r\nIf-Range: \"v1\"\r\n\r\n", string(rangeRequestHead(head, 100, `"v1"`)))
+	assert.Equal(t, "GET /blob HTTP/1.1\r\nHost: app.local\r\nRange: bytes=5-\r\n\r\n", string(rangeRequestHead(head, 5, "")))
+}
+
+func TestNewResumeTracker_OnlyBodylessGET(t *testing.T) {
+	for head, want := range map[string]bool{
+		"GET / HTTP/1.1\r\nHost: a\r\n\r\n":                                    true,
+		"POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 2\r\n\r\nhi":            false,
+		"GET / HTTP/1.1\r\nHost: a\r\nRange: bytes=0-1\r\n\r\n":                false,
+		"GET / HTTP/1.1\r\nHost: a\r\nUpgrade: websocket\r\n\r\n":              false,
+		"GET / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n": false,
+	} {
+		tr := newResumeTracker(bufio.NewReader(strings.NewReader(head)), defaultHTTPPeekBytes)
+		assert.Equal(t, want, tr != nil, head)
+	}
+}
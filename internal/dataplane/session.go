@@ -6,20 +6,24 @@ package dataplane
 import (
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
-	"github.com/xtaci/smux"
 
 	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/support"
+	"github.com/fortunnels/client/internal/telemetry"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
 )
 
 type Client struct {
 	conn       *websocket.Conn
-	sess       *smux.Session
-	pingTicker *time.Ticker
+	sess       Session
+	pingTicker support.Ticker
 	done       chan struct{}
 	closeOnce  sync.Once
 }
@@ -29,21 +33,18 @@ func NewWSSmuxClient(serverURL, tunnelID string, settings config.RuntimeSettings
 	if err != nil {
 		return nil, err
 	}
-	conn, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
-	if resp != nil && resp.Body != nil {
-		defer resp.Body.Close()
-	}
+	conn, _, err := newEndpointSelector(serverURL, settings.PinnedIP).dialWS(wsURL, dialHeaders("", settings.InstanceID))
 	if err != nil {
 		return nil, fmt.Errorf("ws dial: %w", err)
 	}
 
 	done := make(chan struct{})
-	pingTicker := time.NewTicker(settings.PingInterval)
-	StartPingLoop(done, conn, pingTicker, settings.PingTimeout)
+	pongs := newPongWaiter()
+	pingTicker := startDataPlanePing(done, conn, settings, pongs, newPingTunerFor(settings), support.RealClock)
 
-	sess, err := setupWSSmuxSession(conn, settings)
+	sess, err := setupWSSmuxSessionWithPongs(conn, settings, pongs, support.RealClock)
 	if err != nil {
-		pingTicker.Stop()
+		stopTicker(pingTicker)
 		close(done)
 		conn.Close()
 		return nil, fmt.Errorf("smux client: %w", err)
@@ -51,7 +52,7 @@ func NewWSSmuxClient(serverURL, tunnelID string, settings config.RuntimeSettings
 
 	return &Client{
 		conn:       conn,
-		sess:       sess,
+		sess:       newSmuxSession(sess, support.RealClock),
 		pingTicker: pingTicker,
 		done:       done,
 	}, nil
@@ -81,36 +82,31 @@ func (c *Client) Close() {
 	})
 }
 
-// Session exposes the underlying smux session.
-func (c *Client) Session() *smux.Session { return c.sess }
+// Session exposes the client's data-plane session.
+func (c *Client) Session() Session { return c.sess }
 
 // Conn exposes the underlying websocket connection.
 func (c *Client) Conn() *websocket.Conn { return c.conn }
 
-// createDataPlaneSession creates a WebSocket connection and smux session for data plane operations.
+// CreateDataPlaneSession creates a WebSocket connection and smux session for data plane operations.
 // Returns the session and a cleanup function that should be called when done.
-func CreateDataPlaneSession(serverURL, tunnelID string, settings config.RuntimeSettings, dpAuthToken string) (*smux.Session, func(), error) {
+func CreateDataPlaneSession(serverURL, tunnelID string, settings config.RuntimeSettings, dpAuthToken string) (Session, func(), error) {
 	wsURL, origin, err := buildWebSocketURL(serverURL, tunnelID, dpAuthToken)
 	if err != nil {
 		return nil, nil, err
 	}
-	h := http.Header{}
-	h.Set("Origin", origin)
-	conn, resp, err := websocket.DefaultDialer.Dial(wsURL, h)
-	if resp != nil && resp.Body != nil {
-		defer resp.Body.Close()
-	}
+	conn, _, err := newEndpointSelector(serverURL, settings.PinnedIP).dialWS(wsURL, dialHeaders(origin, settings.InstanceID))
 	if err != nil {
 		return nil, nil, fmt.Errorf("ws dial: %w", err)
 	}
 
 	pingDone := make(chan struct{})
-	pingTicker := time.NewTicker(settings.PingInterval)
-	StartPingLoop(pingDone, conn, pingTicker, settings.PingTimeout)
+	pongs := newPongWaiter()
+	pingTicker := startDataPlanePing(pingDone, conn, settings, pongs, newPingTunerFor(settings), support.RealClock)
 
-	sess, err := setupWSSmuxSession(conn, settings)
+	sess, err := setupWSSmuxSessionWithPongs(conn, settings, pongs, support.RealClock)
 	if err != nil {
-		pingTicker.Stop()
+		stopTicker(pingTicker)
 		close(pingDone)
 		conn.Close()
 		return nil, nil, fmt.Errorf("smux client: %w", err)
@@ -119,42 +115,111 @@ func CreateDataPlaneSession(serverURL, tunnelID string, settings config.RuntimeS
 	cleanup := func() {
 		_ = sess.Close()
 		close(pingDone)
-		pingTicker.Stop()
+		stopTicker(pingTicker)
 		conn.Close()
 	}
 
-	return sess, cleanup, nil
+	return newSmuxSession(sess, support.RealClock), cleanup, nil
 }
 
 // Reconnectable session manager ensures there is a live smux session and
 // reconnects with exponential backoff on failures.
+//
+// With settings.MakeBeforeBreak the Manager also watches the health of the
+// active session and, once it degrades, dials a standby session in the
+// background. The standby becomes the primary (next generation) while the old
+// session keeps serving its existing streams until they finish or the drain
+// timeout expires.
 type Manager struct {
 	serverURL   string
 	tunnelID    string
 	dpAuthToken string
 	mu          sync.Mutex
 	conn        *websocket.Conn
-	sess        *smux.Session
+	sess        Session
+	pongs       *pongWaiter
 	pingDone    chan struct{}
-	pingTicker  *time.Ticker
+	pingTicker  support.Ticker
 	stopped     bool
+	done        chan struct{}
 	boInit      time.Duration
 	boMax       time.Duration
 	settings    config.RuntimeSettings
+
+	generation  uint64
+	retired     chan struct{}
+	ready       chan struct{} // closed once the first session is installed
+	draining    []*drainingSession
+	standbyBusy bool
+	health      *sessionHealth
+	monitorDone chan struct{}
+	// pingTune drives the ping interval with --ping-interval auto; it outlives
+	// sessions since it describes the link, not one connection.
+	pingTune *pingTuner
+	// endpoint pins session dials to the control plane's server IP.
+	endpoint *endpointSelector
+	// affinity is the server's session token for the next dials.
+	affinity sessionAffinity
+	// streams shares the stream budget between the listeners serving on
+	// the Manager's sessions.
+	streams *streamScheduler
+	// priority paces bulk listen-mode streams while interactive ones are
+	// open.
+	priority *priorityPacer
+	// clock times reconnect backoff, pings and health probes.
+	clock support.Clock
+	// closeGrace bounds Close: the writes of open streams fail and stuck
+	// sessions are force-closed once it passed.
+	closeGrace time.Duration
+
+	// dial and probe are replaced by tests to run against in-memory sessions.
+	dial  func(wsURL string, headers http.Header) (*websocket.Conn, Session, *pongWaiter, error)
+	probe func(conn *websocket.Conn, sess Session, pongs *pongWaiter) (time.Duration, error)
+}
+
+// drainingSession is a replaced session that still carries in-flight streams.
+type drainingSession struct {
+	conn       *websocket.Conn
+	sess       Session
+	pingDone   chan struct{}
+	pingTicker support.Ticker
+}
+
+// NewTunnelManager returns the Manager of a tunnel's serving modes, with
+// reconnect backoff from 1s to 30s.
+func NewTunnelManager(serverURL, tunnelID, dpAuthToken string, settings config.RuntimeSettings) *Manager {
+	return NewManager(serverURL, tunnelID, dpAuthToken, time.Second, 30*time.Second, settings)
 }
 
 func NewManager(serverURL, tunnelID, dpAuthToken string, boInit, boMax time.Duration, settings config.RuntimeSettings) *Manager {
-	return &Manager{
+	m := &Manager{
 		serverURL:   serverURL,
 		tunnelID:    tunnelID,
 		dpAuthToken: dpAuthToken,
 		boInit:      boInit,
 		boMax:       boMax,
 		settings:    settings,
+		retired:     make(chan struct{}),
+		done:        make(chan struct{}),
+		ready:       make(chan struct{}),
+		health:      newSessionHealth(settings.DegradedRTT),
+		pingTune:    newPingTunerFor(settings),
+		endpoint:    newEndpointSelector(serverURL, settings.PinnedIP),
+		streams:     newStreamScheduler(settings.MaxStreams, settings.PerListenerRate),
+		priority:    &priorityPacer{},
+		clock:       support.RealClock,
+		closeGrace:  defaultCloseGrace,
+	}
+	m.dial = m.dialWSSession
+	m.probe = func(conn *websocket.Conn, _ Session, pongs *pongWaiter) (time.Duration, error) {
+		return probeWSPing(conn, pongs, m.settings.PingTimeout)
 	}
+	return m
 }
 
-func (m *Manager) EnsureSession() (*smux.Session, error) {
+const ensureSessionRetryFormat = "[WARN] data-plane session dial failed: %v (retry in %s)"
+
+func (m *Manager) EnsureSession() (Session, error) {
 	m.mu.Lock()
 	if m.stopped {
 		m.mu.Unlock()
@@ -171,26 +236,27 @@ func (m *Manager) EnsureSession() (*smux.Session, error) {
 		return nil, errors.New("invalid websocket url")
 	}
 	backoff := m.boInit
+	failures := 0
 	for {
 		if m.stopped {
 			m.mu.Unlock()
 			return nil, errors.New("stopped")
 		}
-		conn, resp, err := websocket.DefaultDialer.Dial(wsURL, headers)
-		if resp != nil && resp.Body != nil {
-			resp.Body.Close()
-		}
+		conn, sess, pongs, err := m.dialTraced(wsURL, headers, "primary")
 		if err == nil {
-			sess, initErr := m.initializeSession(conn)
-			if initErr == nil {
-				m.mu.Unlock()
-				return sess, nil
+			m.installPrimary(conn, sess, pongs, time.Time{})
+			m.mu.Unlock()
+			if failures > 0 {
+				support.RepeatLogs.Transition(support.LogKey(ensureSessionRetryFormat), "[INFO] data-plane session re-established after %d failed attempts", failures)
 			}
+			return sess, nil
 		}
+		failures++
 		wait := backoff
 		backoff = nextBackoff(backoff, m.boMax)
+		support.RepeatLogs.Printf(support.LogKey(ensureSessionRetryFormat, support.ErrorClass(err)), ensureSessionRetryFormat, err, wait)
 		m.mu.Unlock()
-		sleepReconnectBackoff(m.isStopped, wait)
+		sleepReconnectBackoff(m.clock, m.done, wait)
 		m.mu.Lock()
 		if m.sess != nil && !m.sess.IsClosed() {
 			sess := m.sess
@@ -200,41 +266,362 @@ func (m *Manager) EnsureSession() (*smux.Session, error) {
 	}
 }
 
+// OpenStream opens a client-initiated stream on the newest healthy session.
+// The open itself, not the wait for a session, counts towards the tunnel's
+// stream latency.
+func (m *Manager) OpenStream() (Stream, error) {
+	sess, err := m.EnsureSession()
+	if err != nil {
+		return nil, err
+	}
+	return processLatency.open(m.tunnelID, sess.OpenStream)
+}
+
+// Retired returns a channel that is closed once sess stops being the session
+// new streams are routed to (it was replaced by a standby or the Manager closed).
+// Accept loops use it to start serving the next generation without waiting for
+// the old session to die.
+func (m *Manager) Retired(sess Session) <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if sess == nil || sess != m.sess {
+		closed := make(chan struct{})
+		close(closed)
+		return closed
+	}
+	return m.retired
+}
+
+// Generation reports how many sessions the Manager has installed so far.
+func (m *Manager) Generation() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.generation
+}
+
+// PingStats reports the adaptive ping controller state; ok is false unless
+// --ping-interval auto is in effect.
+func (m *Manager) PingStats() (PingStats, bool) {
+	if m.pingTune == nil {
+		return PingStats{}, false
+	}
+	return m.pingTune.stats(), true
+}
+
+// ListenerStats reports the stream utilization of the listeners serving on
+// the Manager, in the order they started.
+func (m *Manager) ListenerStats() []ListenerStats {
+	return m.streams.stats()
+}
+
+// Done returns a channel that is closed once the Manager is closed.
+func (m *Manager) Done() <-chan struct{} {
+	return m.done
+}
+
+// Ready returns a channel that is closed once the Manager connected its first
+// session, i.e. the server can route streams of the tunnel to this client.
+func (m *Manager) Ready() <-chan struct{} {
+	return m.ready
+}
+
 func (m *Manager) isStopped() bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	return m.stopped
 }
 
+// sessionDialParams returns the session URL and headers, with the session
+// token the server issued last. The caller holds m.mu, since Migrate changes
+// the server URL.
 func (m *Manager) sessionDialParams() (string, http.Header) {
 	wsURL, origin, err := buildWebSocketURL(m.serverURL, m.tunnelID, m.dpAuthToken)
 	if err != nil {
 		return "", http.Header{}
 	}
-	h := http.Header{}
-	h.Set("Origin", origin)
-	return wsURL, h
+	headers := dialHeaders(origin, m.settings.InstanceID)
+	m.affinity.apply(headers)
+	return wsURL, headers
 }
 
-func (m *Manager) initializeSession(conn *websocket.Conn) (*smux.Session, error) {
-	sess, err := setupWSSmuxSession(conn, m.settings)
+// dialWSSession dials a session. A session token the server refuses is
+// dropped and the session dialed again without it.
+func (m *Manager) dialWSSession(wsURL string, headers http.Header) (*websocket.Conn, Session, *pongWaiter, error) {
+	conn, resp, err := m.endpoint.dialWS(wsURL, headers)
+	if token := headers.Get(protocolv1.HeaderSessionToken); token != "" && err != nil && tokenRejected(resp) {
+		m.affinity.reject(token)
+		log.Printf("[INFO] the server no longer honors the data-plane session token; dialing a fresh session")
+		fresh := headers.Clone()
+		fresh.Del(protocolv1.HeaderSessionToken)
+		conn, resp, err = m.endpoint.dialWS(wsURL, fresh)
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	m.affinity.observe(resp)
+	pongs := newPongWaiter()
+	sess, err := setupWSSmuxSessionWithPongs(conn, m.pingTune.scaleKeepAlive(m.settings), pongs, m.clock)
 	if err != nil {
 		conn.Close()
-		return nil, fmt.Errorf("smux client: %w", err)
+		return nil, nil, nil, fmt.Errorf("smux client: %w", err)
+	}
+	return conn, newSmuxSession(sess, m.clock), pongs, nil
+}
+
+// dialTraced wraps m.dial in a session-establishment span.
+func (m *Manager) dialTraced(wsURL string, headers http.Header, role string) (*websocket.Conn, Session, *pongWaiter, error) {
+	span := telemetry.Start("tunnel.session.connect", telemetry.SpanContext{})
+	conn, sess, pongs, err := m.dial(wsURL, headers)
+	span.SetString("tunnel_id", m.tunnelID)
+	span.SetString("transport", "ws")
+	span.SetString("role", role)
+	if err != nil {
+		span.RecordError(err)
+		span.SetString("error", err.Error())
 	}
+	span.End()
+	return conn, sess, pongs, err
+}
 
+// installPrimary makes the given session the routing target. The caller holds m.mu.
+// A still-open previous primary is moved to the draining list instead of being
+// closed; it is closed at drainBy at the latest, or after the drain timeout
+// when drainBy is zero.
+func (m *Manager) installPrimary(conn *websocket.Conn, sess Session, pongs *pongWaiter, drainBy time.Time) {
+	if m.sess != nil && !m.sess.IsClosed() {
+		if drainBy.IsZero() {
+			timeout := m.settings.DrainTimeout
+			if timeout <= 0 {
+				timeout = defaultDrainTimeout
+			}
+			drainBy = time.Now().Add(timeout)
+		}
+		m.drainLocked(&drainingSession{conn: m.conn, sess: m.sess, pingDone: m.pingDone, pingTicker: m.pingTicker}, drainBy)
+	} else {
+		if m.pingDone != nil {
+			close(m.pingDone)
+		}
+		if m.pingTicker != nil {
+			m.pingTicker.Stop()
+		}
+		// The session died on its own; its conn may not have.
+		if m.conn != nil {
+			_ = m.conn.Close()
+		}
+	}
 	m.conn = conn
 	m.sess = sess
-	if m.pingDone != nil {
-		close(m.pingDone)
+	m.pongs = pongs
+	m.generation++
+	select {
+	case <-m.ready:
+	default:
+		close(m.ready)
 	}
-	if m.pingTicker != nil {
-		m.pingTicker.Stop()
+	close(m.retired)
+	m.retired = make(chan struct{})
+	m.health.reset()
+	m.pingDone = nil
+	m.pingTicker = nil
+	if conn != nil {
+		m.pingDone = make(chan struct{})
+		m.pingTicker = startDataPlanePing(m.pingDone, conn, m.settings, pongs, m.pingTune, m.clock)
+	}
+	if sess != nil {
+		ping := m.settings.PingInterval
+		if m.pingTune != nil {
+			ping = m.pingTune.current()
+		}
+		info := processSessions.established(wsSessionInfo(m.tunnelID, m.pingTune.scaleKeepAlive(m.settings), m.generation, ping))
+		logDebug("data-plane session established: %s", info)
+	}
+	if m.settings.MakeBeforeBreak && m.monitorDone == nil {
+		m.monitorDone = make(chan struct{})
+		done := m.monitorDone
+		go func() {
+			_ = support.Supervise(support.PanicScope{Role: "session health monitor", TunnelID: m.tunnelID}, done, func() error {
+				m.monitorHealth(done)
+				return nil
+			})
+		}()
+	}
+}
+
+// drainLocked keeps ds open until its streams finish or deadline passes.
+// Writes of its streams fail at deadline, and a session whose close is stuck
+// behind one of them gets its WebSocket force-closed then.
+func (m *Manager) drainLocked(ds *drainingSession, deadline time.Time) {
+	m.draining = append(m.draining, ds)
+	boundWrites(ds.sess, deadline)
+	support.Go(support.PanicScope{Role: "session drain", TunnelID: m.tunnelID}, func() {
+		for m.clock.Now().Before(deadline) && !ds.sess.IsClosed() && openStreams(ds.sess) > 0 {
+			m.clock.Sleep(min(drainPollInterval, deadline.Sub(m.clock.Now())))
+		}
+		open := 0
+		if !ds.sess.IsClosed() {
+			open = openStreams(ds.sess)
+		}
+		m.mu.Lock()
+		for i, d := range m.draining {
+			if d == ds {
+				m.draining = append(m.draining[:i], m.draining[i+1:]...)
+				break
+			}
+		}
+		m.mu.Unlock()
+		forced := ds.closeWithin(deadline.Sub(m.clock.Now()), m.clock)
+		switch {
+		case forced:
+			log.Printf("[WARN] drain: previous session did not close by its deadline; force-closed its connection with %d stream(s) open", open)
+		case open > 0:
+			log.Printf("[INFO] drain: deadline passed; closed the previous session with %d stream(s) open", open)
+		}
+	})
+}
+
+func (ds *drainingSession) close(clock support.Clock) {
+	ds.closeWithin(defaultCloseGrace, clock)
+}
+
+// closeWithin stops ds's pings and closes it, force-closing its WebSocket
+// after grace on clock; it reports whether that was needed.
+func (ds *drainingSession) closeWithin(grace time.Duration, clock support.Clock) bool {
+	if ds.pingTicker != nil {
+		ds.pingTicker.Stop()
+	}
+	if ds.pingDone != nil {
+		close(ds.pingDone)
+	}
+	return closeWithin(ds.sess, ds.conn, grace, clock)
+}
+
+// monitorHealth probes the primary session and pre-establishes a standby once
+// the session is considered degraded.
+func (m *Manager) monitorHealth(done <-chan struct{}) {
+	interval := m.settings.PingInterval
+	if interval <= 0 {
+		interval = defaultHealthInterval
+	}
+	ticker := m.clock.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C():
+		}
+		m.mu.Lock()
+		conn, sess, pongs := m.conn, m.sess, m.pongs
+		m.mu.Unlock()
+		if sess == nil || sess.IsClosed() {
+			continue
+		}
+		rtt, err := m.probe(conn, sess, pongs)
+		m.mu.Lock()
+		if sess != m.sess {
+			m.mu.Unlock()
+			continue
+		}
+		m.health.observe(rtt, err)
+		degraded := m.health.degraded()
+		startStandby := degraded && !m.standbyBusy && !m.stopped
+		if startStandby {
+			m.standbyBusy = true
+		}
+		m.mu.Unlock()
+		if degraded {
+			log.Printf("[WARN] data-plane session degraded (rtt=%s err=%v)", rtt, err)
+		}
+		if startStandby {
+			go func() {
+				defer support.RecoverAs(func(p *support.PanicError) {
+					support.ReportPanic(support.PanicScope{Role: "standby session", TunnelID: m.tunnelID}, p)
+					m.mu.Lock()
+					m.standbyBusy = false
+					m.mu.Unlock()
+				})
+				m.prepareStandby(sess)
+			}()
+		}
 	}
-	m.pingDone = make(chan struct{})
-	m.pingTicker = time.NewTicker(m.settings.PingInterval)
-	StartPingLoop(m.pingDone, conn, m.pingTicker, m.settings.PingTimeout)
-	return sess, nil
+}
+
+// prepareStandby dials a second session and promotes it unless the primary
+// recovered (or was replaced) in the meantime, in which case the standby is closed.
+func (m *Manager) prepareStandby(degraded Session) {
+	m.mu.Lock()
+	wsURL, headers := m.sessionDialParams()
+	m.mu.Unlock()
+	var (
+		conn  *websocket.Conn
+		sess  Session
+		pongs *pongWaiter
+		err   error
+	)
+	if wsURL == "" {
+		err = errors.New("invalid websocket url")
+	} else {
+		conn, sess, pongs, err = m.dialTraced(wsURL, headers, "standby")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.standbyBusy = false
+	if err != nil {
+		log.Printf("[WARN] make-before-break: standby dial failed: %v", err)
+		return
+	}
+	if m.stopped || m.sess != degraded || !m.health.degraded() {
+		(&drainingSession{conn: conn, sess: sess}).close(m.clock)
+		return
+	}
+	m.installPrimary(conn, sess, pongs, time.Time{})
+	log.Printf("[INFO] make-before-break: switched new streams to standby session (generation %d)", m.generation)
+}
+
+// Migrate moves the Manager to the data-plane node at serverURL, which the
+// server announces before maintenance of the current one. A session to the
+// new node is dialed and must answer a ping before new streams are routed to
+// it; the old session keeps serving its streams until they finish or drainBy
+// passes (the drain timeout when zero). Redials go to serverURL from then on.
+func (m *Manager) Migrate(serverURL string, drainBy time.Time) error {
+	wsURL, origin, err := buildWebSocketURL(serverURL, m.tunnelID, m.dpAuthToken)
+	if err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	m.mu.Lock()
+	current := m.serverURL
+	m.mu.Unlock()
+	// The data-plane token goes along; it must not leave TLS.
+	if strings.HasPrefix(current, "https:") && !strings.HasPrefix(serverURL, "https:") {
+		return fmt.Errorf("migrate: refusing to move from %s to the unencrypted %s", current, serverURL)
+	}
+	// The token routes within the current node's cluster only.
+	m.affinity.clear()
+	conn, sess, pongs, err := m.dialTraced(wsURL, dialHeaders(origin, m.settings.InstanceID), "migrate")
+	if err != nil {
+		return fmt.Errorf("migrate: dial %s: %w", serverURL, err)
+	}
+	standby := &drainingSession{conn: conn, sess: sess}
+	if _, err := m.probe(conn, sess, pongs); err != nil {
+		standby.close(m.clock)
+		return fmt.Errorf("migrate: new session did not answer a ping: %w", err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopped {
+		standby.close(m.clock)
+		return errors.New("stopped")
+	}
+	m.serverURL = serverURL
+	m.endpoint.retarget(serverURL)
+	m.installPrimary(conn, sess, pongs, drainBy)
+	until := ""
+	if !drainBy.IsZero() {
+		until = " until " + support.FormatTime(drainBy)
+	}
+	log.Printf("[INFO] migrate: switched new streams to %s (generation %d); the previous session drains%s", support.SanitizeRemote(serverURL), m.generation, until)
+	return nil
 }
 
 func nextBackoff(current, limit time.Duration) time.Duration {
@@ -245,10 +632,18 @@ func nextBackoff(current, limit time.Duration) time.Duration {
 	return next
 }
 
+// Close stops the Manager and closes its sessions, draining ones included,
+// within its close grace (see shutdownSessions).
 func (m *Manager) Close() {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	if !m.stopped {
+		close(m.done)
+	}
 	m.stopped = true
+	if m.monitorDone != nil {
+		close(m.monitorDone)
+		m.monitorDone = nil
+	}
 	if m.pingDone != nil {
 		close(m.pingDone)
 		m.pingDone = nil
@@ -257,12 +652,26 @@ func (m *Manager) Close() {
 		m.pingTicker.Stop()
 		m.pingTicker = nil
 	}
-	if m.sess != nil {
-		_ = m.sess.Close()
-	}
-	if m.conn != nil {
+	var closing []*drainingSession
+	switch {
+	case m.sess != nil:
+		closing = append(closing, &drainingSession{conn: m.conn, sess: m.sess})
+	case m.conn != nil:
 		_ = m.conn.Close()
 	}
+	// The drain goroutines still own the rest of their sessions' teardown.
+	for _, ds := range m.draining {
+		closing = append(closing, &drainingSession{conn: ds.conn, sess: ds.sess})
+	}
 	m.sess = nil
 	m.conn = nil
+	m.pongs = nil
+	select {
+	case <-m.retired:
+	default:
+		close(m.retired)
+	}
+	grace := m.closeGrace
+	m.mu.Unlock()
+	shutdownSessions(closing, grace, m.clock)
 }
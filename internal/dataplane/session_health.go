@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultDrainTimeout   = 30 * time.Second
+	defaultHealthInterval = 5 * time.Second
+	drainPollInterval     = 250 * time.Millisecond
+
+	// degradedProbeFailures is the number of consecutive failed probes after
+	// which a session counts as degraded regardless of the measured RTT.
+	degradedProbeFailures = 2
+	rttSmoothing          = 0.3
+)
+
+var errProbeTimeout = errors.New("ping probe timed out")
+
+// pongWaiter matches pong frames to the probe pings that requested them.
+// Other pongs go to the connection's ping loop (track).
+type pongWaiter struct {
+	mu      sync.Mutex
+	pending map[string]chan struct{}
+	health  *pingHealth
+}
+
+func newPongWaiter() *pongWaiter {
+	return &pongWaiter{pending: make(map[string]chan struct{})}
+}
+
+func (p *pongWaiter) expect(payload string) <-chan struct{} {
+	ch := make(chan struct{})
+	p.mu.Lock()
+	p.pending[payload] = ch
+	p.mu.Unlock()
+	return ch
+}
+
+// track hands pongs no probe waits for to h.
+func (p *pongWaiter) track(h *pingHealth) {
+	p.mu.Lock()
+	p.health = h
+	p.mu.Unlock()
+}
+
+func (p *pongWaiter) deliver(payload string) {
+	p.mu.Lock()
+	ch, ok := p.pending[payload]
+	delete(p.pending, payload)
+	health := p.health
+	p.mu.Unlock()
+	if ok {
+		close(ch)
+		return
+	}
+	if health != nil {
+		health.pong(payload)
+	}
+}
+
+func (p *pongWaiter) cancel(payload string) {
+	p.mu.Lock()
+	delete(p.pending, payload)
+	p.mu.Unlock()
+}
+
+// probeWSPing sends a ping carrying a unique payload and waits for the matching pong.
+func probeWSPing(conn *websocket.Conn, pongs *pongWaiter, timeout time.Duration) (time.Duration, error) {
+	if conn == nil || pongs == nil {
+		return 0, errors.New("no websocket connection")
+	}
+	if timeout <= 0 {
+		timeout = defaultHealthInterval
+	}
+	start := time.Now()
+	payload := "probe-" + strconv.FormatInt(start.UnixNano(), 36)
+	ch := pongs.expect(payload)
+	if err := conn.WriteControl(websocket.PingMessage, []byte(payload), start.Add(timeout)); err != nil {
+		pongs.cancel(payload)
+		return 0, err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-ch:
+		return time.Since(start), nil
+	case <-timer.C:
+		pongs.cancel(payload)
+		return timeout, errProbeTimeout
+	}
+}
+
+// sessionHealth tracks probe results for one session and decides when it is degraded.
+type sessionHealth struct {
+	threshold time.Duration
+	rtt       time.Duration
+	failures  int
+}
+
+func newSessionHealth(threshold time.Duration) *sessionHealth {
+	return &sessionHealth{threshold: threshold}
+}
+
+func (h *sessionHealth) observe(rtt time.Duration, err error) {
+	if err != nil {
+		h.failures++
+		return
+	}
+	h.failures = 0
+	if h.rtt == 0 {
+		h.rtt = rtt
+		return
+	}
+	h.rtt = time.Duration(rttSmoothing*float64(rtt) + (1-rttSmoothing)*float64(h.rtt))
+}
+
+func (h *sessionHealth) degraded() bool {
+	if h.failures >= degradedProbeFailures {
+		return true
+	}
+	return h.threshold > 0 && h.rtt > h.threshold
+}
+
+func (h *sessionHealth) reset() {
+	h.rtt = 0
+	h.failures = 0
+}
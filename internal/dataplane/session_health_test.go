@@ -0,0 +1,244 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+	"github.com/xtaci/smux"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/support"
+)
+
+// fakeSessionDialer hands out in-memory smux client sessions backed by net.Pipe
+// and keeps the matching server sides for the test.
+type fakeSessionDialer struct {
+	mu      sync.Mutex
+	servers []*smux.Session
+	clients []*smux.Session
+}
+
+func (d *fakeSessionDialer) dial(string, http.Header) (*websocket.Conn, Session, *pongWaiter, error) {
+	a, b := net.Pipe()
+	srv, err := smux.Server(b, smux.DefaultConfig())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cli, err := smux.Client(a, smux.DefaultConfig())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	d.mu.Lock()
+	d.servers = append(d.servers, srv)
+	d.clients = append(d.clients, cli)
+	d.mu.Unlock()
+	return nil, newSmuxSession(cli, support.RealClock), newPongWaiter(), nil
+}
+
+func (d *fakeSessionDialer) server(i int) *smux.Session {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.servers[i]
+}
+
+func newFakeManager(t *testing.T, settings config.RuntimeSettings) (*Manager, *fakeSessionDialer) {
+	t.Helper()
+	mgr := NewManager("http://example.com", "tunnel-123", "", time.Millisecond, 10*time.Millisecond, settings)
+	d := &fakeSessionDialer{}
+	mgr.dial = d.dial
+	t.Cleanup(mgr.Close)
+	return mgr, d
+}
+
+func TestSessionHealth_Degraded(t *testing.T) {
+	h := newSessionHealth(100 * time.Millisecond)
+	require.False(t, h.degraded())
+
+	h.observe(10*time.Millisecond, nil)
+	require.False(t, h.degraded())
+
+	h.observe(0, errProbeTimeout)
+	require.False(t, h.degraded(), "a single failed probe is not enough")
+	h.observe(0, errProbeTimeout)
+	require.True(t, h.degraded())
+
+	h.reset()
+	require.False(t, h.degraded())
+	for range 10 {
+		h.observe(time.Second, nil)
+	}
+	require.True(t, h.degraded(), "smoothed RTT above threshold")
+}
+
+func TestPongWaiter_DeliverAndCancel(t *testing.T) {
+	p := newPongWaiter()
+	ch := p.expect("a")
+	p.deliver("unknown")
+	p.deliver("a")
+	select {
+	case <-ch:
+	default:
+		t.Fatal("pong for expected payload was not delivered")
+	}
+
+	ch = p.expect("b")
+	p.cancel("b")
+	p.deliver("b")
+	select {
+	case <-ch:
+		t.Fatal("cancelled payload must not be delivered")
+	default:
+	}
+}
+
+func TestManager_MakeBeforeBreak_PromotesStandbyAndDrains(t *testing.T) {
+	mgr, d := newFakeManager(t, config.RuntimeSettings{
+		MakeBeforeBreak: true,
+		PingInterval:    10 * time.Millisecond,
+		DegradedRTT:     100 * time.Millisecond,
+		DrainTimeout:    5 * time.Second,
+	})
+
+	var slowMu sync.Mutex
+	slow := map[Session]bool{}
+	mgr.probe = func(_ *websocket.Conn, sess Session, _ *pongWaiter) (time.Duration, error) {
+		slowMu.Lock()
+		defer slowMu.Unlock()
+		if slow[sess] {
+			return time.Second, nil
+		}
+		return time.Millisecond, nil
+	}
+
+	first, err := mgr.EnsureSession()
+	require.NoError(t, err)
+	retired := mgr.Retired(first)
+
+	// An in-flight stream opened by the server on the first session.
+	inflight, err := d.server(0).OpenStream()
+	require.NoError(t, err)
+	_, err = inflight.Write([]byte("x"))
+	require.NoError(t, err)
+	accepted, err := first.AcceptStream()
+	require.NoError(t, err)
+
+	slowMu.Lock()
+	slow[first] = true
+	slowMu.Unlock()
+
+	select {
+	case <-retired:
+	case <-time.After(2 * time.Second):
+		t.Fatal("degraded session was not replaced by a standby")
+	}
+	require.Equal(t, uint64(2), mgr.Generation())
+
+	// New streams go to the second session.
+	st, err := mgr.OpenStream()
+	require.NoError(t, err)
+	defer st.Close()
+	_, err = st.Write([]byte("y"))
+	require.NoError(t, err)
+	got, err := d.server(1).AcceptStream()
+	require.NoError(t, err)
+	got.Close()
+
+	// The old session keeps its in-flight stream alive while draining.
+	require.False(t, first.IsClosed())
+	buf := make([]byte, 1)
+	_, err = io.ReadFull(accepted, buf)
+	require.NoError(t, err)
+	_, err = inflight.Write([]byte("z"))
+	require.NoError(t, err)
+	_, err = io.ReadFull(accepted, buf)
+	require.NoError(t, err)
+	require.Equal(t, "z", string(buf))
+
+	accepted.Close()
+	inflight.Close()
+	require.Eventually(t, first.IsClosed, 3*time.Second, 20*time.Millisecond,
+		"drained session should close once its streams finish")
+}
+
+func TestManager_MakeBeforeBreak_DiscardsStandbyWhenPrimaryRecovers(t *testing.T) {
+	mgr, d := newFakeManager(t, config.RuntimeSettings{
+		MakeBeforeBreak: true,
+		PingInterval:    10 * time.Millisecond,
+		DegradedRTT:     100 * time.Millisecond,
+	})
+
+	var recovered sync.Once
+	probes := make(chan struct{})
+	mgr.probe = func(*websocket.Conn, Session, *pongWaiter) (time.Duration, error) {
+		select {
+		case <-probes:
+			return time.Millisecond, nil
+		default:
+			return 0, errors.New("probe lost")
+		}
+	}
+	standbyDialed := make(chan struct{})
+	var dialMu sync.Mutex
+	dials := 0
+	mgr.dial = func(u string, h http.Header) (*websocket.Conn, Session, *pongWaiter, error) {
+		dialMu.Lock()
+		dials++
+		n := dials
+		dialMu.Unlock()
+		if n == 2 {
+			// Primary recovers while the standby is being dialed.
+			recovered.Do(func() { close(probes) })
+			require.Eventually(t, func() bool {
+				mgr.mu.Lock()
+				defer mgr.mu.Unlock()
+				return !mgr.health.degraded()
+			}, 2*time.Second, 5*time.Millisecond)
+			defer close(standbyDialed)
+		}
+		return d.dial(u, h)
+	}
+
+	first, err := mgr.EnsureSession()
+	require.NoError(t, err)
+
+	select {
+	case <-standbyDialed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("standby was never dialed")
+	}
+	require.Eventually(t, func() bool {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return len(d.clients) == 2 && d.clients[1].IsClosed()
+	}, 2*time.Second, 10*time.Millisecond, "unused standby should be closed")
+	require.Equal(t, uint64(1), mgr.Generation())
+
+	sess, err := mgr.EnsureSession()
+	require.NoError(t, err)
+	require.Equal(t, first, sess)
+}
+
+func TestManager_CloseRetiresPrimary(t *testing.T) {
+	mgr, _ := newFakeManager(t, config.RuntimeSettings{})
+	sess, err := mgr.EnsureSession()
+	require.NoError(t, err)
+	retired := mgr.Retired(sess)
+
+	mgr.Close()
+	select {
+	case <-retired:
+	case <-time.After(time.Second):
+		t.Fatal("Close should retire the primary session")
+	}
+	require.True(t, sess.IsClosed())
+}
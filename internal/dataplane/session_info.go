@@ -0,0 +1,277 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/support"
+	"github.com/fortunnels/client/shared/wsconn"
+)
+
+// SessionInfo is what a tunnel's data-plane session runs with: the data
+// plane carrying it, the smux and WebSocket tuning, stream encryption and
+// the ping cadence. It is recorded when a session is established and on
+// every transport switch, for support: throughput reports are hard to read
+// without it.
+type SessionInfo struct {
+	TunnelID string
+	// DataPlane is config.DataPlaneWS or config.DataPlaneQUIC.
+	DataPlane string
+	// Generation counts the WebSocket sessions of the tunnel's Manager.
+	Generation  uint64
+	Established time.Time
+
+	// The smux and WebSocket settings; zero on QUIC.
+	SmuxVersion      int
+	MaxFrameSize     int
+	MaxReceiveBuffer int
+	MaxStreamBuffer  int
+	WSReadLimit      int64
+	WSCompression    bool
+
+	// KeepAliveInterval and KeepAliveTimeout are smux's keepalive on the
+	// WebSocket data plane, and the keepalive period and idle timeout on
+	// QUIC.
+	KeepAliveInterval time.Duration
+	KeepAliveTimeout  time.Duration
+
+	Encryption bool
+	KDF        string
+	// EncryptionStatus is the EncryptionStatus.State the server confirmed;
+	// empty before ConfirmEncryption ran.
+	EncryptionStatus string
+
+	// PingInterval is the WebSocket ping interval in effect when the
+	// session was established; AdaptivePing is --ping-interval auto.
+	PingInterval time.Duration
+	AdaptivePing bool
+}
+
+// String is the one-line form of the debug log and the crash report.
+func (i SessionInfo) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "data_plane=%s", i.DataPlane)
+	if i.Generation > 0 {
+		fmt.Fprintf(&b, " generation=%d", i.Generation)
+	}
+	if i.DataPlane == config.DataPlaneWS {
+		fmt.Fprintf(&b, " smux=v%d frame=%d receive_buffer=%d stream_buffer=%d ws_read_limit=%d ws_compression=%t",
+			i.SmuxVersion, i.MaxFrameSize, i.MaxReceiveBuffer, i.MaxStreamBuffer, i.WSReadLimit, i.WSCompression)
+	}
+	fmt.Fprintf(&b, " keepalive=%s/%s", i.KeepAliveInterval, i.KeepAliveTimeout)
+	if i.Encryption {
+		fmt.Fprintf(&b, " encryption=on kdf=%s", i.KDF)
+		if i.EncryptionStatus != "" {
+			fmt.Fprintf(&b, " encryption_status=%s", i.EncryptionStatus)
+		}
+	} else {
+		b.WriteString(" encryption=off")
+	}
+	if i.PingInterval > 0 {
+		fmt.Fprintf(&b, " ping=%s", i.PingInterval)
+		if i.AdaptivePing {
+			b.WriteString(" (auto)")
+		}
+	}
+	fmt.Fprintf(&b, " established=%s", support.FormatTime(i.Established))
+	return b.String()
+}
+
+// wsSessionInfo is the SessionInfo of a WebSocket session dialed with
+// settings (keepalive already scaled for adaptive pings).
+func wsSessionInfo(tunnelID string, settings config.RuntimeSettings, generation uint64, ping time.Duration) SessionInfo {
+	cfg := smuxConfig(settings)
+	ws, _ := wsOptions(cfg.MaxFrameSize, wsconn.Options{})
+	return SessionInfo{
+		TunnelID:          tunnelID,
+		DataPlane:         config.DataPlaneWS,
+		Generation:        generation,
+		Established:       time.Now(),
+		SmuxVersion:       cfg.Version,
+		MaxFrameSize:      cfg.MaxFrameSize,
+		MaxReceiveBuffer:  cfg.MaxReceiveBuffer,
+		MaxStreamBuffer:   cfg.MaxStreamBuffer,
+		WSReadLimit:       ws.MaxMessageSize,
+		WSCompression:     websocket.DefaultDialer.EnableCompression,
+		KeepAliveInterval: cfg.KeepAliveInterval,
+		KeepAliveTimeout:  cfg.KeepAliveTimeout,
+		PingInterval:      ping,
+		AdaptivePing:      settings.AdaptivePing,
+	}
+}
+
+// quicSessionInfo is the SessionInfo of a QUIC connection dialed with
+// settings.
+func quicSessionInfo(tunnelID string, settings config.RuntimeSettings) SessionInfo {
+	return SessionInfo{
+		TunnelID:          tunnelID,
+		DataPlane:         config.DataPlaneQUIC,
+		Established:       time.Now(),
+		KeepAliveInterval: settings.SmuxKeepAliveInterval,
+		KeepAliveTimeout:  settings.SmuxKeepAliveTimeout,
+	}
+}
+
+// processSessions keeps the latest SessionInfo of every tunnel served by
+// this process.
+var processSessions = sessionInfos{tunnels: make(map[string]*tunnelSessions)}
+
+// sessionInfos is the SessionInfo table. Readers get a copy of an
+// immutable value swapped in whole, so an update never tears it.
+type sessionInfos struct {
+	mu      sync.Mutex
+	tunnels map[string]*tunnelSessions
+}
+
+// tunnelSessions are one tunnel's infos: current is the data plane serving
+// new streams, planes the latest of each data plane. pinned is the data
+// plane --dp auto serves on; without it the latest session is current.
+type tunnelSessions struct {
+	current atomic.Pointer[SessionInfo]
+	planes  map[string]SessionInfo
+	pinned  string
+	enc     config.EncryptionSettings
+	status  EncryptionStatus
+}
+
+func (t *sessionInfos) tunnelLocked(tunnelID string) *tunnelSessions {
+	ts := t.tunnels[tunnelID]
+	if ts == nil {
+		ts = &tunnelSessions{planes: make(map[string]SessionInfo)}
+		t.tunnels[tunnelID] = ts
+	}
+	return ts
+}
+
+// established records info of a new session and returns it with the
+// tunnel's encryption filled in.
+func (t *sessionInfos) established(info SessionInfo) SessionInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ts := t.tunnelLocked(info.TunnelID)
+	ts.fillEncryption(&info)
+	ts.planes[info.DataPlane] = info
+	if ts.pinned == "" || ts.pinned == info.DataPlane {
+		ts.current.Store(&info)
+	}
+	return info
+}
+
+// activate makes dataPlane the one serving tunnelID's new streams.
+func (t *sessionInfos) activate(tunnelID, dataPlane string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ts := t.tunnelLocked(tunnelID)
+	ts.pinned = dataPlane
+	if info, ok := ts.planes[dataPlane]; ok {
+		ts.current.Store(&info)
+	}
+}
+
+func (t *sessionInfos) setEncryption(tunnelID string, enc config.EncryptionSettings) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ts := t.tunnelLocked(tunnelID)
+	ts.enc = enc
+	ts.refillEncryption()
+}
+
+func (t *sessionInfos) setEncryptionStatus(tunnelID string, status EncryptionStatus) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ts := t.tunnelLocked(tunnelID)
+	ts.status = status
+	ts.refillEncryption()
+}
+
+func (t *sessionInfos) encryptionStatus(tunnelID string) EncryptionStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if ts := t.tunnels[tunnelID]; ts != nil {
+		return ts.status
+	}
+	return EncryptionStatus{}
+}
+
+// fillEncryption sets the encryption fields of info from the tunnel's.
+func (ts *tunnelSessions) fillEncryption(info *SessionInfo) {
+	info.Encryption, info.KDF = ts.enc.Enabled, encryptionKDF(ts.enc)
+	info.EncryptionStatus = ts.status.State
+}
+
+// refillEncryption updates the encryption fields of every recorded info.
+// The caller holds the table's lock.
+func (ts *tunnelSessions) refillEncryption() {
+	for plane, info := range ts.planes {
+		ts.fillEncryption(&info)
+		ts.planes[plane] = info
+	}
+	if cur := ts.current.Load(); cur != nil {
+		info := ts.planes[cur.DataPlane]
+		ts.current.Store(&info)
+	}
+}
+
+func (t *sessionInfos) get(tunnelID string) (SessionInfo, bool) {
+	t.mu.Lock()
+	ts := t.tunnels[tunnelID]
+	t.mu.Unlock()
+	if ts == nil {
+		return SessionInfo{}, false
+	}
+	if info := ts.current.Load(); info != nil {
+		return *info, true
+	}
+	return SessionInfo{}, false
+}
+
+func (t *sessionInfos) ids() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ids := make([]string, 0, len(t.tunnels))
+	for id := range t.tunnels {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func encryptionKDF(enc config.EncryptionSettings) string {
+	if !enc.Enabled {
+		return ""
+	}
+	return enc.KDF.String()
+}
+
+// RecordEncryption sets the stream encryption reported in tunnelID's
+// SessionInfo.
+func RecordEncryption(tunnelID string, enc config.EncryptionSettings) {
+	processSessions.setEncryption(tunnelID, enc)
+}
+
+// SessionInfoOf returns the SessionInfo of the session serving tunnelID's
+// new streams; ok is false before one was established.
+func SessionInfoOf(tunnelID string) (SessionInfo, bool) {
+	return processSessions.get(tunnelID)
+}
+
+// WriteSessionInfo writes one "session <tunnel>: ..." line per tunnel with
+// an established session, for the crash report's diagnostics.
+func WriteSessionInfo(w io.Writer) {
+	for _, id := range processSessions.ids() {
+		if info, ok := processSessions.get(id); ok {
+			fmt.Fprintf(w, "session %s: %s\n", id, info)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xtaci/smux"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/security"
+	"github.com/fortunnels/client/shared/wsconn"
+)
+
+func TestManager_SessionInfoFollowsSettings(t *testing.T) {
+	base := config.RuntimeSettings{
+		PingInterval:          20 * time.Second,
+		SmuxKeepAliveInterval: 10 * time.Second,
+		SmuxKeepAliveTimeout:  30 * time.Second,
+	}
+	withBuffer := base
+	withBuffer.SmuxMaxReceiveBuffer = 16 << 20
+	adaptive := base
+	adaptive.AdaptivePing = true
+	argon := config.EncryptionSettings{Enabled: true, KDF: security.Argon2idKDF}
+
+	tests := []struct {
+		name     string
+		settings config.RuntimeSettings
+		enc      config.EncryptionSettings
+		check    func(t *testing.T, info SessionInfo)
+	}{
+		{"defaults", base, config.EncryptionSettings{}, func(t *testing.T, info SessionInfo) {
+			def := smux.DefaultConfig()
+			assert.Equal(t, def.MaxReceiveBuffer, info.MaxReceiveBuffer)
+			assert.Equal(t, def.MaxFrameSize, info.MaxFrameSize)
+			assert.Equal(t, def.Version, info.SmuxVersion)
+			assert.Equal(t, 10*time.Second, info.KeepAliveInterval)
+			assert.Equal(t, 20*time.Second, info.PingInterval)
+			assert.False(t, info.Encryption)
+		}},
+		{"receive buffer", withBuffer, config.EncryptionSettings{}, func(t *testing.T, info SessionInfo) {
+			assert.Equal(t, 16<<20, info.MaxReceiveBuffer)
+		}},
+		{"adaptive ping", adaptive, config.EncryptionSettings{}, func(t *testing.T, info SessionInfo) {
+			scaled := newPingTunerFor(adaptive).scaleKeepAlive(adaptive)
+			assert.True(t, info.AdaptivePing)
+			assert.Equal(t, scaled.SmuxKeepAliveInterval, info.KeepAliveInterval, "the keepalive actually used")
+			assert.Equal(t, scaled.SmuxKeepAliveTimeout, info.KeepAliveTimeout)
+			assert.Contains(t, info.String(), " (auto)")
+		}},
+		{"encryption", base, argon, func(t *testing.T, info SessionInfo) {
+			assert.True(t, info.Encryption)
+			assert.Equal(t, security.Argon2idKDF.String(), info.KDF)
+			assert.Contains(t, info.String(), "encryption=on kdf=argon2id;t=2")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tunnelID := "info-" + t.Name()
+			mgr := NewManager("http://example.com", tunnelID, "", time.Millisecond, 10*time.Millisecond, tt.settings)
+			mgr.dial = (&fakeSessionDialer{}).dial
+			t.Cleanup(mgr.Close)
+			RecordEncryption(tunnelID, tt.enc)
+			_, err := mgr.EnsureSession()
+			require.NoError(t, err)
+
+			info, ok := SessionInfoOf(tunnelID)
+			require.True(t, ok)
+			assert.Equal(t, config.DataPlaneWS, info.DataPlane)
+			assert.Equal(t, uint64(1), info.Generation)
+			assert.EqualValues(t, wsconn.MaxWebSocketMessageSize, info.WSReadLimit)
+			tt.check(t, info)
+		})
+	}
+}
+
+func TestSessionInfos_PinnedDataPlane(t *testing.T) {
+	infos := sessionInfos{tunnels: make(map[string]*tunnelSessions)}
+	_, ok := infos.get("t")
+	assert.False(t, ok, "nothing before a session")
+
+	infos.established(quicSessionInfo("t", config.RuntimeSettings{}))
+	infos.activate("t", config.DataPlaneQUIC)
+	infos.established(wsSessionInfo("t", config.RuntimeSettings{}, 1, 0))
+	info, _ := infos.get("t")
+	assert.Equal(t, config.DataPlaneQUIC, info.DataPlane, "a standby session does not replace the active data plane")
+
+	infos.activate("t", config.DataPlaneWS)
+	info, _ = infos.get("t")
+	assert.Equal(t, config.DataPlaneWS, info.DataPlane)
+
+	infos.setEncryption("t", config.EncryptionSettings{Enabled: true, KDF: security.LegacyKDF})
+	info, _ = infos.get("t")
+	assert.True(t, info.Encryption)
+	assert.Equal(t, security.KDFLegacy, info.KDF)
+}
+
+func TestWriteSessionInfo(t *testing.T) {
+	processSessions.established(wsSessionInfo("info-dump", config.RuntimeSettings{}, 3, time.Second))
+	var b bytes.Buffer
+	WriteSessionInfo(&b)
+	assert.Contains(t, b.String(), "session info-dump: data_plane=ws generation=3 smux=v1 ")
+	assert.Contains(t, b.String(), " ping=1s established=")
+}
@@ -10,6 +10,8 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/support"
+	"github.com/fortunnels/client/internal/testsupport"
 )
 
 func TestManagerEnsureSession_StoppedAfterClose(t *testing.T) {
@@ -23,20 +25,49 @@ func TestManagerEnsureSession_StoppedAfterClose(t *testing.T) {
 
 func TestManagerEnsureSession_ReleasesLockDuringBackoff(t *testing.T) {
 	mgr := NewManager("http://127.0.0.1:1", "tunnel-123", "", 2*time.Second, 2*time.Second, config.RuntimeSettings{})
+	clock := support.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	mgr.clock = clock
+	returned := make(chan struct{})
 	go func() {
 		_, _ = mgr.EnsureSession()
+		close(returned)
 	}()
 
-	time.Sleep(300 * time.Millisecond)
-
-	start := time.Now()
+	clock.BlockUntil(1)
 	acquired := mgr.mu.TryLock()
-	elapsed := time.Since(start)
 	if acquired {
 		mgr.mu.Unlock()
 	}
 	mgr.Close()
 
 	require.True(t, acquired, "lock should be available while reconnect sleeps")
-	require.Less(t, elapsed, 50*time.Millisecond)
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not end the backoff")
+	}
+}
+
+func TestManagerMigrate_RefusesDowngrade(t *testing.T) {
+	mgr := NewManager("https://example.com", "tunnel-123", "dp-token", time.Millisecond, 10*time.Millisecond, config.RuntimeSettings{})
+	defer mgr.Close()
+
+	err := mgr.Migrate("http://other.example.com", time.Time{})
+	require.ErrorContains(t, err, "unencrypted")
+	require.Equal(t, "https://example.com", mgr.serverURL)
+}
+
+func TestManagerMigrate_UnreachableKeepsSession(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	tun := stub.AddTunnel("tcp", "127.0.0.1:1")
+	mgr := NewManager(stub.URL, tun.ID, "", 10*time.Millisecond, 50*time.Millisecond, e2eRuntime())
+	defer mgr.Close()
+	_, err := mgr.EnsureSession()
+	require.NoError(t, err)
+
+	require.Error(t, mgr.Migrate("http://127.0.0.1:1", time.Now().Add(time.Second)))
+	require.Equal(t, uint64(1), mgr.Generation())
+	require.Equal(t, 1, stub.LiveSessions(tun.ID))
+	require.Equal(t, stub.URL, mgr.serverURL)
 }
@@ -0,0 +1,164 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/xtaci/smux"
+
+	"github.com/fortunnels/client/internal/support"
+)
+
+// defaultCloseGrace is how long Manager.Close, and the close of a session
+// that is not draining, wait for a clean close before the WebSocket is
+// force-closed.
+const defaultCloseGrace = 2 * time.Second
+
+// ErrGraceExpired is matched by the write errors of streams cut because
+// their session's shutdown or drain deadline passed, as opposed to a
+// transport failure.
+var ErrGraceExpired = errors.New("shutdown grace period expired")
+
+// streamRegistry is the set of open streams of one smux session. Once the
+// session got a deadline (a drain or shutdown began), every write of its
+// streams, including streams opened later, fails at that deadline instead of
+// waiting for window updates from a peer that may be gone.
+type streamRegistry struct {
+	mu       sync.Mutex
+	clock    support.Clock
+	streams  map[*graceStream]struct{}
+	deadline time.Time
+}
+
+func newStreamRegistry(clock support.Clock) *streamRegistry {
+	return &streamRegistry{clock: clock, streams: make(map[*graceStream]struct{})}
+}
+
+func (r *streamRegistry) add(st *smux.Stream) *graceStream {
+	gs := &graceStream{Stream: st, reg: r}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.streams[gs] = struct{}{}
+	if !r.deadline.IsZero() {
+		_ = st.SetWriteDeadline(r.deadline)
+	}
+	return gs
+}
+
+func (r *streamRegistry) remove(gs *graceStream) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.streams, gs)
+}
+
+// boundWrites makes every write of the registry's streams fail at deadline,
+// keeping an earlier deadline, and returns how many streams are open.
+func (r *streamRegistry) boundWrites(deadline time.Time) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.deadline.IsZero() || deadline.Before(r.deadline) {
+		r.deadline = deadline
+	}
+	for gs := range r.streams {
+		_ = gs.SetWriteDeadline(r.deadline)
+	}
+	return len(r.streams)
+}
+
+// expired reports whether the registry's deadline passed.
+func (r *streamRegistry) expired() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !r.deadline.IsZero() && !r.clock.Now().Before(r.deadline)
+}
+
+// graceStream is an smux stream of a streamRegistry. Its write errors past
+// the registry's deadline match ErrGraceExpired.
+type graceStream struct {
+	*smux.Stream
+	reg *streamRegistry
+}
+
+func (s *graceStream) Write(p []byte) (int, error) {
+	n, err := s.Stream.Write(p)
+	if err != nil && s.reg.expired() {
+		err = fmt.Errorf("%w: %w", ErrGraceExpired, err)
+	}
+	return n, err
+}
+
+func (s *graceStream) Close() error {
+	s.reg.remove(s)
+	return s.Stream.Close()
+}
+
+// boundWrites gives the open streams of sess a write deadline when sess
+// supports it and returns how many streams it carries.
+func boundWrites(sess Session, deadline time.Time) int {
+	if b, ok := sess.(interface{ boundWrites(time.Time) int }); ok {
+		return b.boundWrites(deadline)
+	}
+	return openStreams(sess)
+}
+
+// closeWithin closes sess and conn, waiting up to grace for sess to close
+// cleanly. A write blocked on a dead peer holds the WebSocket's write lock
+// that the clean close needs; once grace is over conn is force-closed, which
+// fails that write and lets the close finish on its own. It reports whether
+// grace, timed on clock, expired.
+func closeWithin(sess Session, conn *websocket.Conn, grace time.Duration, clock support.Clock) bool {
+	closed := make(chan struct{})
+	go func() {
+		_ = sess.Close()
+		close(closed)
+	}()
+	timer := clock.NewTimer(max(grace, 0))
+	defer timer.Stop()
+	expired := false
+	select {
+	case <-closed:
+	case <-timer.C():
+		expired = true
+	}
+	if conn != nil {
+		_ = conn.Close()
+	}
+	return expired
+}
+
+// shutdownSessions closes sessions within grace: writes of their streams
+// fail at the deadline and sessions still closing then get their WebSocket
+// force-closed. Streams cut that way are reported apart from errors.
+func shutdownSessions(sessions []*drainingSession, grace time.Duration, clock support.Clock) {
+	deadline := clock.Now().Add(grace)
+	for _, ds := range sessions {
+		boundWrites(ds.sess, deadline)
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	forced, cut := 0, 0
+	for _, ds := range sessions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			open := openStreams(ds.sess)
+			if closeWithin(ds.sess, ds.conn, deadline.Sub(clock.Now()), clock) {
+				mu.Lock()
+				forced++
+				cut += open
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if forced > 0 {
+		log.Printf("[WARN] data plane: %d session(s) did not close within %s; force-closed their connections with %d stream(s) open", forced, grace, cut)
+	}
+}
@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/support"
+)
+
+// dialSilentPeer returns a WebSocket to a peer that never reads, as a dead
+// server behind a live TCP connection.
+func dialSilentPeer(t *testing.T) *websocket.Conn {
+	t.Helper()
+	release := make(chan struct{})
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		<-release
+	}))
+	t.Cleanup(func() {
+		close(release)
+		srv.Close()
+	})
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	require.NoError(t, err)
+	return conn
+}
+
+// stuckSession is a Session whose close is stuck behind writes to a dead
+// peer: Close returns only when the test ends. It records the write
+// deadline a drain or shutdown gave its streams.
+type stuckSession struct {
+	open     int
+	release  chan struct{}
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+func newStuckSession(t *testing.T, open int) *stuckSession {
+	s := &stuckSession{open: open, release: make(chan struct{})}
+	t.Cleanup(func() { close(s.release) })
+	return s
+}
+
+func (s *stuckSession) OpenStream() (Stream, error)   { return nil, errors.New("stuck") }
+func (s *stuckSession) AcceptStream() (Stream, error) { return nil, errors.New("stuck") }
+func (s *stuckSession) IsClosed() bool                { return false }
+func (s *stuckSession) NumStreams() int               { return s.open }
+
+func (s *stuckSession) Close() error {
+	<-s.release
+	return nil
+}
+
+func (s *stuckSession) boundWrites(deadline time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deadline = deadline
+	return s.open
+}
+
+func (s *stuckSession) writeDeadline() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.deadline
+}
+
+// requireForceClosed checks that conn was closed under its session.
+func requireForceClosed(t *testing.T, conn *websocket.Conn) {
+	t.Helper()
+	assert.Error(t, conn.WriteMessage(websocket.BinaryMessage, []byte("x")), "the WebSocket was force-closed")
+}
+
+func TestManager_CloseWithinGraceWhileWritesBlock(t *testing.T) {
+	clock := support.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	conn := dialSilentPeer(t)
+	sess := newStuckSession(t, 2)
+	mgr := NewManager("http://example.com", "tunnel-123", "", time.Millisecond, 10*time.Millisecond, config.RuntimeSettings{PingInterval: time.Minute})
+	mgr.clock = clock
+	mgr.closeGrace = 300 * time.Millisecond
+	mgr.mu.Lock()
+	mgr.conn, mgr.sess = conn, sess
+	mgr.mu.Unlock()
+
+	closed := make(chan struct{})
+	go func() {
+		mgr.Close()
+		close(closed)
+	}()
+	clock.BlockUntil(1)
+	assert.Equal(t, clock.Now().Add(mgr.closeGrace), sess.writeDeadline())
+
+	clock.Advance(mgr.closeGrace - time.Millisecond)
+	select {
+	case <-closed:
+		t.Fatal("Close returned before its grace ran out")
+	case <-time.After(50 * time.Millisecond):
+	}
+	clock.Advance(time.Millisecond)
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return at the end of its grace")
+	}
+	requireForceClosed(t, conn)
+}
+
+func TestManager_DrainEndsAtDeadlineWhileWritesBlock(t *testing.T) {
+	clock := support.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	conn := dialSilentPeer(t)
+	sess := newStuckSession(t, 1)
+	mgr := NewManager("http://example.com", "tunnel-123", "", time.Millisecond, 10*time.Millisecond, config.RuntimeSettings{})
+	mgr.clock = clock
+	t.Cleanup(mgr.Close)
+
+	deadline := clock.Now().Add(drainPollInterval + 50*time.Millisecond)
+	mgr.mu.Lock()
+	mgr.drainLocked(&drainingSession{conn: conn, sess: sess}, deadline)
+	mgr.mu.Unlock()
+	assert.Equal(t, deadline, sess.writeDeadline())
+
+	// The drain polls its open streams until the deadline.
+	clock.BlockUntil(1)
+	clock.Advance(drainPollInterval)
+	clock.BlockUntil(1)
+	mgr.mu.Lock()
+	assert.Len(t, mgr.draining, 1, "still draining before the deadline")
+	mgr.mu.Unlock()
+	clock.Advance(50 * time.Millisecond)
+
+	require.Eventually(t, func() bool {
+		mgr.mu.Lock()
+		defer mgr.mu.Unlock()
+		return len(mgr.draining) == 0
+	}, 5*time.Second, time.Millisecond)
+	requireForceClosed(t, conn)
+}
+
+// TestStreamRegistry_ExpiredFollowsClock: write errors count as a grace
+// expiry from the registry's deadline on, as its clock tells.
+func TestStreamRegistry_ExpiredFollowsClock(t *testing.T) {
+	clock := support.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	r := newStreamRegistry(clock)
+	assert.False(t, r.expired(), "no deadline yet")
+
+	r.boundWrites(clock.Now().Add(time.Second))
+	r.boundWrites(clock.Now().Add(time.Minute))
+	assert.False(t, r.expired())
+	clock.Advance(time.Second - time.Millisecond)
+	assert.False(t, r.expired())
+	clock.Advance(time.Millisecond)
+	assert.True(t, r.expired(), "the earlier deadline holds")
+}
@@ -0,0 +1,244 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	// maxClientHelloSize bounds the ClientHello handshake message --sni-route
+	// reads; larger ones are refused rather than buffered.
+	maxClientHelloSize = 16 << 10
+	// sniPeekBytes bounds the records peeked for one ClientHello: the
+	// message plus the headers of the records it is fragmented into.
+	sniPeekBytes = 2 * maxClientHelloSize
+	// sniPeekTimeout is how long --sni-route waits for a ClientHello.
+	// Protocols where the server speaks first go to the default after it.
+	sniPeekTimeout = time.Second
+
+	tlsRecordHeader      = 5
+	tlsRecordHandshake   = 22
+	tlsMaxRecordPayload  = 16384 + 2048
+	tlsClientHello       = 1
+	tlsExtServerName     = 0
+	tlsServerNameHost    = 0
+	tlsHandshakeHeader   = 4
+	tlsClientRandomBytes = 32
+)
+
+var (
+	// errNotClientHello is returned for bytes that do not start a TLS
+	// ClientHello.
+	errNotClientHello = errors.New("not a TLS ClientHello")
+	// errClientHelloTooLarge is returned for a ClientHello declaring more
+	// than maxClientHelloSize bytes.
+	errClientHelloTooLarge = errors.New("TLS ClientHello too large")
+	// errClientHelloShort is returned while the ClientHello is not complete
+	// yet; more bytes may complete it.
+	errClientHelloShort = errors.New("TLS ClientHello incomplete")
+)
+
+// resolveSNI peeks the ClientHello of c and returns the conn to forward,
+// with every byte still unread, and the route of its server name: the
+// default for connections that send no ClientHello or name no route.
+func (r dstResolver) resolveSNI(c net.Conn, lg connLogger) (net.Conn, string) {
+	pc := newPeekedConn(c, sniPeekBytes)
+	name, err := pc.peekServerName(time.Now().Add(sniPeekTimeout))
+	if err != nil {
+		lg.Printf("sni-route: %v, using %s", err, r.fallback)
+		return pc, r.fallback
+	}
+	if dst, ok := r.sniRoutes[name]; ok {
+		return pc, dst
+	}
+	return pc, r.fallback
+}
+
+// peekServerName waits until the buffered bytes hold a whole ClientHello,
+// however many records and reads it arrives in, and returns its server name
+// ("" without one). Nothing is consumed.
+func (p *peekedConn) peekServerName(deadline time.Time) (string, error) {
+	if err := p.Conn.SetReadDeadline(deadline); err != nil {
+		return "", err
+	}
+	defer func() { _ = p.Conn.SetReadDeadline(time.Time{}) }()
+	for n := 1; ; n = p.rd.Buffered() + 1 {
+		if n > sniPeekBytes {
+			return "", errClientHelloTooLarge
+		}
+		if _, err := p.rd.Peek(n); err != nil {
+			return "", err
+		}
+		buf, _ := p.rd.Peek(p.rd.Buffered())
+		name, err := parseClientHelloSNI(buf)
+		if !errors.Is(err, errClientHelloShort) {
+			return name, err
+		}
+	}
+}
+
+// parseClientHelloSNI returns the server name of the TLS ClientHello at the
+// start of data, which may span several handshake records. It returns
+// errClientHelloShort when data ends before the ClientHello does.
+func parseClientHelloSNI(data []byte) (string, error) {
+	var msg []byte
+	for {
+		if len(data) < tlsRecordHeader {
+			return "", errClientHelloShort
+		}
+		if data[0] != tlsRecordHandshake || data[1] != 3 {
+			return "", errNotClientHello
+		}
+		n := int(binary.BigEndian.Uint16(data[3:5]))
+		if n == 0 || n > tlsMaxRecordPayload {
+			return "", errNotClientHello
+		}
+		if len(data) < tlsRecordHeader+n {
+			// Check the declared size as soon as the header is in, so an
+			// oversized handshake is refused before it is buffered.
+			msg = append(msg, data[tlsRecordHeader:]...)
+			if err := checkHandshakeHeader(msg); err != nil {
+				return "", err
+			}
+			return "", errClientHelloShort
+		}
+		msg = append(msg, data[tlsRecordHeader:tlsRecordHeader+n]...)
+		data = data[tlsRecordHeader+n:]
+		if err := checkHandshakeHeader(msg); err != nil {
+			return "", err
+		}
+		if len(msg) >= tlsHandshakeHeader {
+			if size := handshakeSize(msg); len(msg) >= tlsHandshakeHeader+size {
+				return serverName(msg[tlsHandshakeHeader : tlsHandshakeHeader+size])
+			}
+		}
+	}
+}
+
+func handshakeSize(msg []byte) int {
+	return int(msg[1])<<16 | int(msg[2])<<8 | int(msg[3])
+}
+
+// checkHandshakeHeader validates the handshake header at the start of msg,
+// once it is complete.
+func checkHandshakeHeader(msg []byte) error {
+	if len(msg) == 0 {
+		return nil
+	}
+	if msg[0] != tlsClientHello {
+		return errNotClientHello
+	}
+	if len(msg) >= tlsHandshakeHeader && handshakeSize(msg) > maxClientHelloSize {
+		return errClientHelloTooLarge
+	}
+	return nil
+}
+
+// serverName returns the host_name of the server_name extension of the
+// ClientHello body hello.
+func serverName(hello []byte) (string, error) {
+	s := helloReader(hello)
+	if !s.skip(2+tlsClientRandomBytes) || !s.skipVector(1) || !s.skipVector(2) || !s.skipVector(1) {
+		return "", errNotClientHello
+	}
+	if s.empty() {
+		return "", nil // no extensions
+	}
+	exts, ok := s.vector(2)
+	if !ok {
+		return "", errNotClientHello
+	}
+	for !exts.empty() {
+		typ, ok1 := exts.uint16()
+		body, ok2 := exts.vector(2)
+		if !ok1 || !ok2 {
+			return "", errNotClientHello
+		}
+		if typ != tlsExtServerName {
+			continue
+		}
+		names, ok := body.vector(2)
+		if !ok {
+			return "", errNotClientHello
+		}
+		for !names.empty() {
+			kind, ok1 := names.uint8()
+			name, ok2 := names.vector(2)
+			if !ok1 || !ok2 {
+				return "", errNotClientHello
+			}
+			if kind == tlsServerNameHost {
+				return normalizeServerName(string(name)), nil
+			}
+		}
+		return "", nil
+	}
+	return "", nil
+}
+
+// normalizeServerName lowercases name and drops a trailing dot, as routes
+// are keyed.
+func normalizeServerName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
+
+// helloReader reads the big-endian fields and length-prefixed vectors of a
+// ClientHello.
+type helloReader []byte
+
+func (s *helloReader) empty() bool { return len(*s) == 0 }
+
+func (s *helloReader) skip(n int) bool {
+	if len(*s) < n {
+		return false
+	}
+	*s = (*s)[n:]
+	return true
+}
+
+func (s *helloReader) uint8() (uint8, bool) {
+	if len(*s) < 1 {
+		return 0, false
+	}
+	v := (*s)[0]
+	*s = (*s)[1:]
+	return v, true
+}
+
+func (s *helloReader) uint16() (uint16, bool) {
+	if len(*s) < 2 {
+		return 0, false
+	}
+	v := binary.BigEndian.Uint16(*s)
+	*s = (*s)[2:]
+	return v, true
+}
+
+// vector reads a vector with a lenBytes-byte length prefix.
+func (s *helloReader) vector(lenBytes int) (helloReader, bool) {
+	if len(*s) < lenBytes {
+		return nil, false
+	}
+	n := 0
+	for _, b := range (*s)[:lenBytes] {
+		n = n<<8 | int(b)
+	}
+	*s = (*s)[lenBytes:]
+	if len(*s) < n {
+		return nil, false
+	}
+	v := (*s)[:n]
+	*s = (*s)[n:]
+	return v, true
+}
+
+func (s *helloReader) skipVector(lenBytes int) bool {
+	_, ok := s.vector(lenBytes)
+	return ok
+}
@@ -0,0 +1,206 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/testsupport"
+)
+
+// captureClientHello returns the first flight of a crypto/tls client for
+// serverName: one handshake record with its ClientHello.
+func captureClientHello(t *testing.T, serverName string) []byte {
+	t.Helper()
+	client, server := net.Pipe()
+	go func() {
+		_ = tls.Client(client, &tls.Config{ServerName: serverName, InsecureSkipVerify: true}).Handshake() //nolint:gosec // only the ClientHello is used
+	}()
+	defer client.Close()
+	defer server.Close()
+	hdr := make([]byte, tlsRecordHeader)
+	_, err := io.ReadFull(server, hdr)
+	require.NoError(t, err)
+	body := make([]byte, int(hdr[3])<<8|int(hdr[4]))
+	_, err = io.ReadFull(server, body)
+	require.NoError(t, err)
+	return append(hdr, body...)
+}
+
+// refragment splits the handshake of the single record hello into records
+// of at most size bytes each.
+func refragment(hello []byte, size int) []byte {
+	msg := hello[tlsRecordHeader:]
+	var out []byte
+	for len(msg) > 0 {
+		n := min(size, len(msg))
+		out = append(out, tlsRecordHandshake, 3, 1, byte(n>>8), byte(n))
+		out = append(out, msg[:n]...)
+		msg = msg[n:]
+	}
+	return out
+}
+
+func TestParseClientHelloSNI(t *testing.T) {
+	hello := captureClientHello(t, "API.example.com")
+	name, err := parseClientHelloSNI(hello)
+	require.NoError(t, err)
+	assert.Equal(t, "api.example.com", name)
+
+	// Anything after the ClientHello is left alone.
+	name, err = parseClientHelloSNI(append(append([]byte{}, hello...), "trailing"...))
+	require.NoError(t, err)
+	assert.Equal(t, "api.example.com", name)
+
+	for i := range hello {
+		_, err := parseClientHelloSNI(hello[:i])
+		require.ErrorIs(t, err, errClientHelloShort, "prefix of %d bytes", i)
+	}
+
+	name, err = parseClientHelloSNI(captureClientHello(t, ""))
+	require.NoError(t, err)
+	assert.Empty(t, name, "no server_name extension")
+
+	_, err = parseClientHelloSNI([]byte("GET / HTTP/1.1\r\nHost: api.example.com\r\n\r\n"))
+	require.ErrorIs(t, err, errNotClientHello)
+	_, err = parseClientHelloSNI([]byte{tlsRecordHandshake, 3, 1, 0, 4, 2, 0, 0, 0})
+	require.ErrorIs(t, err, errNotClientHello, "a ServerHello")
+}
+
+func TestParseClientHelloSNI_Fragmented(t *testing.T) {
+	hello := captureClientHello(t, "grafana.example.com")
+	for _, size := range []int{1, 3, 50, 200} {
+		frags := refragment(hello, size)
+		name, err := parseClientHelloSNI(frags)
+		require.NoError(t, err, "records of %d bytes", size)
+		assert.Equal(t, "grafana.example.com", name)
+		_, err = parseClientHelloSNI(frags[:len(frags)-1])
+		require.ErrorIs(t, err, errClientHelloShort)
+	}
+}
+
+func TestParseClientHelloSNI_Oversized(t *testing.T) {
+	// The header alone is enough to refuse it.
+	huge := []byte{tlsRecordHandshake, 3, 1, 0x40, 0, tlsClientHello, 0x01, 0, 0}
+	_, err := parseClientHelloSNI(huge)
+	require.ErrorIs(t, err, errClientHelloTooLarge)
+	// Split over records, too.
+	_, err = parseClientHelloSNI([]byte{tlsRecordHandshake, 3, 1, 0, 2, tlsClientHello, 0x01, tlsRecordHandshake, 3, 1, 0, 2, 0, 0})
+	require.ErrorIs(t, err, errClientHelloTooLarge)
+	_, err = parseClientHelloSNI([]byte{tlsRecordHandshake, 3, 1, 0xff, 0xff})
+	require.ErrorIs(t, err, errNotClientHello, "a record over the TLS maximum")
+}
+
+// TestPeekServerName_AcrossReads delivers a fragmented ClientHello in small
+// writes and checks that routing sees the name and the conn still yields
+// every byte.
+func TestPeekServerName_AcrossReads(t *testing.T) {
+	frags := refragment(captureClientHello(t, "api.example.com"), 40)
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		for rest := frags; len(rest) > 0; {
+			n := min(7, len(rest))
+			if _, err := client.Write(rest[:n]); err != nil {
+				return
+			}
+			rest = rest[n:]
+		}
+		_, _ = client.Write([]byte("after"))
+	}()
+
+	r := dstResolver{fallback: "default:443", sniRoutes: map[string]string{"api.example.com": "api:8443"}}
+	conn, dst := r.resolve(server, newConnLogger())
+	assert.Equal(t, "api:8443", dst)
+	got := make([]byte, len(frags)+len("after"))
+	_, err := io.ReadFull(conn, got)
+	require.NoError(t, err)
+	assert.Equal(t, append(append([]byte{}, frags...), "after"...), got)
+}
+
+func TestResolveSNI_Fallbacks(t *testing.T) {
+	r := dstResolver{fallback: "default:443", sniRoutes: map[string]string{"api.example.com": "api:8443"}}
+	for name, first := range map[string][]byte{
+		"other name": captureClientHello(t, "www.example.com"),
+		"no name":    captureClientHello(t, ""),
+		"plaintext":  []byte("GET / HTTP/1.1\r\n\r\n"),
+	} {
+		client, server := net.Pipe()
+		go func() { _, _ = client.Write(first) }()
+		conn, dst := r.resolve(server, newConnLogger())
+		assert.Equal(t, "default:443", dst, name)
+		got := make([]byte, len(first))
+		_, err := io.ReadFull(conn, got)
+		require.NoError(t, err)
+		assert.Equal(t, first, got, name)
+		client.Close()
+	}
+}
+
+// startTLSEcho runs a TLS server that answers every connection with its
+// name and then echoes what it reads.
+func startTLSEcho(t *testing.T, name string) string {
+	t.Helper()
+	certs := httptest.NewUnstartedServer(nil)
+	certs.StartTLS()
+	cert := certs.TLS.Certificates[0]
+	certs.Close()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go serveEcho(ln, name+"\n")
+	return ln.Addr().String()
+}
+
+func TestE2E_SNIRoute(t *testing.T) {
+	api := startTLSEcho(t, "api")
+	grafana := startTLSEcho(t, "grafana")
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	tun := stub.AddTunnel("tcp", "")
+	rt := e2eRuntime()
+	rt.SNIRoutes = map[string]string{"api.example.com": api, "grafana.example.com": grafana}
+	rt.SNIDefault = grafana
+	mgr := NewTunnelManager(stub.URL, tun.ID, "", rt)
+	defer mgr.Close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		_ = serveListener(ln, mgr, newListenForwarder(tun.ID, "127.0.0.1:1", rt, config.EncryptionSettings{}))
+	}()
+
+	for serverName, want := range map[string]string{"api.example.com": "api", "GRAFANA.example.com": "grafana", "unknown.example.com": "grafana"} {
+		c, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{ServerName: serverName, InsecureSkipVerify: true}) //nolint:gosec // test servers
+		require.NoError(t, err, serverName)
+		require.NoError(t, c.SetDeadline(time.Now().Add(5*time.Second)))
+		rd := bufio.NewReader(c)
+		line, err := rd.ReadString('\n')
+		require.NoError(t, err, serverName)
+		assert.Equal(t, want, strings.TrimSpace(line), serverName)
+		_, err = io.WriteString(c, "ping\n")
+		require.NoError(t, err)
+		line, err = rd.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "ping\n", line, "TLS passes through end to end")
+		c.Close()
+	}
+
+	var dsts []string
+	for _, pre := range stub.ClientPrefaces(tun.ID) {
+		dsts = append(dsts, pre["dst"])
+	}
+	assert.ElementsMatch(t, []string{api, grafana, grafana}, dsts)
+}
@@ -0,0 +1,141 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"container/list"
+	"math"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/fortunnels/client/internal/config"
+)
+
+// sourceLimitTableSize bounds how many sources the limiter tracks; the
+// least recently seen one is forgotten to make room.
+const sourceLimitTableSize = 10000
+
+// sourceLimiter counts the HTTP requests of each remote source in a sliding
+// window (--rate-limit-source). The window is approximated from two fixed
+// windows: the previous one's count weighted by how much of it still
+// overlaps the sliding window, plus the current one's.
+type sourceLimiter struct {
+	limit  int
+	window time.Duration
+	exempt []netip.Prefix
+	size   int
+	// now is time.Now; tests substitute a clock.
+	now func() time.Time
+	// warnNoSource warns once about requests without X-Forwarded-For.
+	warnNoSource sync.Once
+
+	mu      sync.Mutex
+	sources map[netip.Addr]*list.Element
+	// lru holds *sourceWindow values, most recently seen first.
+	lru list.List
+}
+
+type sourceWindow struct {
+	addr  netip.Addr
+	start time.Time
+	prev  int
+	cur   int
+}
+
+// newSourceLimiter returns the limiter for settings, or nil when
+// --rate-limit-source is off.
+func newSourceLimiter(settings config.RuntimeSettings) *sourceLimiter {
+	if settings.SourceRateLimit <= 0 || settings.SourceRateWindow <= 0 {
+		return nil
+	}
+	return &sourceLimiter{
+		limit:   settings.SourceRateLimit,
+		window:  settings.SourceRateWindow,
+		exempt:  settings.SourceRateExempt,
+		size:    sourceLimitTableSize,
+		now:     time.Now,
+		sources: map[netip.Addr]*list.Element{},
+	}
+}
+
+// allow counts one request from src and reports whether it is within the
+// limit; when it is not, retryAfter is how long until one would be.
+// Refused requests are not counted, so a source that keeps retrying is let
+// through again as soon as its earlier requests age out.
+func (l *sourceLimiter) allow(src netip.Addr) (ok bool, retryAfter time.Duration) {
+	src = src.Unmap()
+	for _, p := range l.exempt {
+		if p.Contains(src) {
+			return true, 0
+		}
+	}
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	w := l.lookup(src, now)
+	w.advance(now, l.window)
+	elapsed := now.Sub(w.start)
+	if w.estimate(elapsed, l.window) < float64(l.limit) {
+		w.cur++
+		return true, 0
+	}
+	return false, w.retryAfter(elapsed, l.window, l.limit)
+}
+
+// lookup returns src's window, tracking it if it is new.
+func (l *sourceLimiter) lookup(src netip.Addr, now time.Time) *sourceWindow {
+	if e, ok := l.sources[src]; ok {
+		l.lru.MoveToFront(e)
+		return e.Value.(*sourceWindow)
+	}
+	if l.lru.Len() >= l.size {
+		oldest := l.lru.Back()
+		delete(l.sources, oldest.Value.(*sourceWindow).addr)
+		l.lru.Remove(oldest)
+	}
+	w := &sourceWindow{addr: src, start: now}
+	l.sources[src] = l.lru.PushFront(w)
+	return w
+}
+
+// tracked reports how many sources the limiter currently remembers.
+func (l *sourceLimiter) tracked() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lru.Len()
+}
+
+// advance moves the fixed window forward to the one containing now.
+func (w *sourceWindow) advance(now time.Time, window time.Duration) {
+	switch n := now.Sub(w.start) / window; {
+	case n == 1:
+		w.prev, w.cur = w.cur, 0
+		w.start = w.start.Add(window)
+	case n > 1:
+		w.prev, w.cur = 0, 0
+		w.start = w.start.Add(n * window)
+	}
+}
+
+// estimate is the request count of the sliding window ending elapsed into
+// the current fixed window.
+func (w *sourceWindow) estimate(elapsed, window time.Duration) float64 {
+	overlap := 1 - float64(elapsed)/float64(window)
+	return float64(w.prev)*overlap + float64(w.cur)
+}
+
+// retryAfter is how long until estimate drops below limit with no further
+// requests counted.
+func (w *sourceWindow) retryAfter(elapsed, window time.Duration, limit int) time.Duration {
+	var wait float64
+	if w.cur < limit {
+		// Within this window, as the previous one's share shrinks.
+		wait = float64(window)*(1-float64(limit-w.cur)/float64(w.prev)) - float64(elapsed)
+	} else {
+		// Only once the current count has become the previous one.
+		wait = float64(window-elapsed) + float64(window)*(1-float64(limit)/float64(w.cur))
+	}
+	return time.Duration(math.Max(wait, 0)) + time.Nanosecond
+}
@@ -0,0 +1,127 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+)
+
+// fakeClockLimiter returns a 3 requests/minute limiter on a clock the test
+// advances.
+func fakeClockLimiter(exempt ...string) (*sourceLimiter, *time.Time) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	var prefixes []netip.Prefix
+	for _, e := range exempt {
+		prefixes = append(prefixes, netip.MustParsePrefix(e))
+	}
+	l := newSourceLimiter(config.RuntimeSettings{SourceRateLimit: 3, SourceRateWindow: time.Minute, SourceRateExempt: prefixes})
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestNewSourceLimiter_Off(t *testing.T) {
+	assert.Nil(t, newSourceLimiter(config.RuntimeSettings{}))
+}
+
+func TestSourceLimiter_LimitAndRetryAfter(t *testing.T) {
+	l, now := fakeClockLimiter()
+	a := netip.MustParseAddr("203.0.113.1")
+	for i := range 3 {
+		ok, _ := l.allow(a)
+		require.True(t, ok, "request %d", i)
+	}
+	*now = now.Add(15 * time.Second)
+	ok, retry := l.allow(a)
+	require.False(t, ok)
+	// The window must roll over (45s) and the 3 requests must weigh less than
+	// the limit: right after it, 3*(1-e/60) < 3 for any e > 0.
+	assert.Equal(t, 45*time.Second+time.Nanosecond, retry)
+
+	ok, _ = l.allow(netip.MustParseAddr("203.0.113.2"))
+	assert.True(t, ok, "other sources are counted apart")
+	ok, _ = l.allow(netip.MustParseAddr("::ffff:203.0.113.1"))
+	assert.False(t, ok, "an IPv4-mapped address is the same source")
+}
+
+func TestSourceLimiter_SlidingWindow(t *testing.T) {
+	l, now := fakeClockLimiter()
+	a := netip.MustParseAddr("2001:db8::1")
+	for range 3 {
+		ok, _ := l.allow(a)
+		require.True(t, ok)
+	}
+	// 20s into the next window the previous one weighs 3*40/60 = 2, so one
+	// more request fits.
+	*now = now.Add(80 * time.Second)
+	ok, _ := l.allow(a)
+	require.True(t, ok)
+	ok, retry := l.allow(a)
+	require.False(t, ok, "2 + 1 = 3")
+	// 3*(1-x/60) + 1 < 3 once x > 20s into the window: 0s from now.
+	assert.Equal(t, time.Nanosecond, retry)
+
+	*now = now.Add(10 * time.Second)
+	ok, _ = l.allow(a)
+	require.True(t, ok, "3*30/60 + 1 = 2.5")
+	ok, retry = l.allow(a)
+	require.False(t, ok, "3*30/60 + 2 = 3.5")
+	// 3*(1-x/60) + 2 < 3 once x > 40s: 10s from now.
+	assert.Equal(t, 10*time.Second+time.Nanosecond, retry)
+	assert.Equal(t, "Retry-After: 11\r\n", retryAfterLine(tooManyRequests(retry)))
+}
+
+func TestSourceLimiter_IdleSourceStartsOver(t *testing.T) {
+	l, now := fakeClockLimiter()
+	a := netip.MustParseAddr("203.0.113.1")
+	for range 3 {
+		l.allow(a)
+	}
+	*now = now.Add(2 * time.Minute)
+	for i := range 3 {
+		ok, _ := l.allow(a)
+		require.True(t, ok, "request %d", i)
+	}
+}
+
+func TestSourceLimiter_Exempt(t *testing.T) {
+	l, _ := fakeClockLimiter("10.0.0.0/8")
+	for range 10 {
+		ok, _ := l.allow(netip.MustParseAddr("10.1.2.3"))
+		require.True(t, ok)
+	}
+	assert.Zero(t, l.tracked(), "exempt sources are not tracked")
+}
+
+func TestSourceLimiter_TableIsBounded(t *testing.T) {
+	l, _ := fakeClockLimiter()
+	l.size = 2
+	a, b, c := netip.MustParseAddr("203.0.113.1"), netip.MustParseAddr("203.0.113.2"), netip.MustParseAddr("203.0.113.3")
+	for range 3 {
+		l.allow(a)
+	}
+	l.allow(b)
+	l.allow(c)
+	assert.Equal(t, 2, l.tracked())
+	ok, _ := l.allow(a)
+	assert.True(t, ok, "a was the least recently seen source and was forgotten")
+	ok, _ = l.allow(c)
+	assert.True(t, ok)
+}
+
+func retryAfterLine(resp []byte) string {
+	for _, line := range strings.SplitAfter(string(resp), "\r\n") {
+		if strings.HasPrefix(line, "Retry-After:") {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,153 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"io"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/xtaci/smux"
+)
+
+const (
+	// stallSampleTick is how often a session checks for blocked writes.
+	stallSampleTick = 100 * time.Millisecond
+	// stallInterval is one reporting window; stallThreshold is how much of
+	// it may pass stalled before the hint is logged.
+	stallInterval  = 10 * time.Second
+	stallThreshold = 2 * time.Second
+	// stallHintGap rate-limits the hint across sessions of the process.
+	stallHintGap = 10 * time.Minute
+)
+
+// processStalls times writes into the data-plane streams of this process.
+var processStalls stallMeter
+
+// stallMeter accumulates how long stream writes spent blocked. A write that
+// has not returned yet is local data smux could not send.
+type stallMeter struct {
+	pending  atomic.Int32
+	blocked  atomic.Int64 // nanoseconds, cumulative
+	lastHint atomic.Int64 // unix nanoseconds of the last hint
+}
+
+// allowHint reports whether the hint may be logged at now and, if so,
+// records it.
+func (m *stallMeter) allowHint(now time.Time) bool {
+	last := m.lastHint.Load()
+	if last != 0 && now.Sub(time.Unix(0, last)) < stallHintGap {
+		return false
+	}
+	return m.lastHint.CompareAndSwap(last, now.UnixNano())
+}
+
+// blockedWriter times each write to a stream. smux returns from Write once
+// the frame is queued, so the time spent inside it is time the session could
+// not send: its peer's receive window was full or the link was congested.
+type blockedWriter struct {
+	w io.Writer
+	m *stallMeter
+}
+
+func (b blockedWriter) Write(p []byte) (int, error) {
+	b.m.pending.Add(1)
+	start := time.Now()
+	n, err := b.w.Write(p)
+	b.m.blocked.Add(int64(time.Since(start)))
+	b.m.pending.Add(-1)
+	return n, err
+}
+
+// meteredConn counts the bytes an smux session reads from and writes to
+// its WebSocket connection, and adds them to wire when set.
+type meteredConn struct {
+	io.ReadWriteCloser
+	in, out atomic.Int64
+	wire    *wireCounter
+}
+
+func (c *meteredConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	c.in.Add(int64(n))
+	if c.wire != nil {
+		c.wire.down.Add(int64(n))
+	}
+	return n, err
+}
+
+func (c *meteredConn) Write(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Write(p)
+	c.out.Add(int64(n))
+	if c.wire != nil && n > 0 {
+		c.wire.addWrite(n)
+	}
+	return n, err
+}
+
+// stallDetector looks for window exhaustion: ticks where a stream write was
+// pending while the WebSocket connection sent nothing. Network congestion
+// still moves bytes; a full smux window moves none.
+type stallDetector struct {
+	meter   *stallMeter
+	tick    time.Duration
+	stalled time.Duration
+	lastOut int64
+}
+
+func newStallDetector(meter *stallMeter, tick time.Duration) *stallDetector {
+	return &stallDetector{meter: meter, tick: tick}
+}
+
+// observe records one tick given the connection's cumulative out bytes.
+func (d *stallDetector) observe(out int64) {
+	if d.meter.pending.Load() > 0 && out == d.lastOut {
+		d.stalled += d.tick
+	}
+	d.lastOut = out
+}
+
+// roll ends the current interval and returns its stalled time and whether
+// the hint is due: the stalled time reached threshold and no hint was
+// logged in the last stallHintGap.
+func (d *stallDetector) roll(now time.Time, threshold time.Duration) (stalled time.Duration, hint bool) {
+	stalled, d.stalled = d.stalled, 0
+	return stalled, stalled >= threshold && d.meter.allowHint(now)
+}
+
+// monitorStalls samples sess and conn until the session closes, logging
+// per-interval stream and byte counts at debug level and the receive-buffer
+// hint when writes stall on an idle link. receiveBuffer is the session's
+// configured smux receive buffer.
+func monitorStalls(sess *smux.Session, conn *meteredConn, meter *stallMeter, receiveBuffer int) {
+	ticker := time.NewTicker(stallSampleTick)
+	defer ticker.Stop()
+	d := newStallDetector(meter, stallSampleTick)
+	ticksPerInterval := int(stallInterval / stallSampleTick)
+	var ticks int
+	var lastIn, lastOut, lastBlocked int64
+	for {
+		select {
+		case <-sess.CloseChan():
+			return
+		case now := <-ticker.C:
+			d.observe(conn.out.Load())
+			if ticks++; ticks < ticksPerInterval {
+				continue
+			}
+			ticks = 0
+			in, out, blocked := conn.in.Load(), conn.out.Load(), meter.blocked.Load()
+			stalled, hint := d.roll(now, stallThreshold)
+			logDebug("smux session: streams=%d in=%d out=%d blocked=%s stalled=%s",
+				sess.NumStreams(), in-lastIn, out-lastOut, time.Duration(blocked-lastBlocked).Round(time.Millisecond), stalled)
+			lastIn, lastOut, lastBlocked = in, out, blocked
+			if hint {
+				log.Printf("[WARN] smux flow control: stream writes waited %s of the last %s while the data-plane link sent nothing. "+
+					"The smux receive window, not the network, is capping throughput; try a larger --smux-max-receive-buffer (now %dKiB)",
+					stalled, stallInterval, receiveBuffer>>10)
+			}
+		}
+	}
+}
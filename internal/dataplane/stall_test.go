@@ -0,0 +1,152 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gatedStream is a fake smux stream whose writes block until release is
+// closed, like a stream whose peer window is exhausted.
+type gatedStream struct {
+	release chan struct{}
+	delay   time.Duration
+}
+
+func (s *gatedStream) Write(p []byte) (int, error) {
+	if s.release != nil {
+		<-s.release
+	}
+	time.Sleep(s.delay)
+	return len(p), nil
+}
+
+func TestBlockedWriter_TimesBlockedWrites(t *testing.T) {
+	var m stallMeter
+	stream := &gatedStream{release: make(chan struct{})}
+	w := blockedWriter{stream, &m}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		n, err := w.Write([]byte("hello"))
+		assert.NoError(t, err)
+		assert.Equal(t, 5, n)
+	}()
+	require.Eventually(t, func() bool { return m.pending.Load() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	close(stream.release)
+	<-done
+
+	assert.Equal(t, int32(0), m.pending.Load())
+	assert.GreaterOrEqual(t, time.Duration(m.blocked.Load()), 50*time.Millisecond)
+
+	// A fast write adds next to nothing.
+	before := m.blocked.Load()
+	_, err := blockedWriter{&gatedStream{}, &m}.Write([]byte("x"))
+	require.NoError(t, err)
+	assert.Less(t, time.Duration(m.blocked.Load()-before), 20*time.Millisecond)
+}
+
+func TestStallDetector_IdleLinkWithPendingWrite(t *testing.T) {
+	var m stallMeter
+	d := newStallDetector(&m, 100*time.Millisecond)
+	now := time.Unix(1_700_000_000, 0)
+
+	// No pending write: an idle link is just idle.
+	for range 50 {
+		d.observe(0)
+	}
+	stalled, hint := d.roll(now, 2*time.Second)
+	assert.Zero(t, stalled)
+	assert.False(t, hint)
+
+	// A pending write while bytes still flow is the network, not the window.
+	m.pending.Store(1)
+	var out int64
+	for range 50 {
+		out += 1500
+		d.observe(out)
+	}
+	stalled, hint = d.roll(now, 2*time.Second)
+	assert.Zero(t, stalled)
+	assert.False(t, hint)
+
+	// A pending write while nothing is sent is window exhaustion.
+	for range 30 {
+		d.observe(out)
+	}
+	stalled, hint = d.roll(now, 2*time.Second)
+	assert.Equal(t, 3*time.Second, stalled)
+	assert.True(t, hint)
+
+	// The hint is rate-limited, also for a new session's detector.
+	d = newStallDetector(&m, 100*time.Millisecond)
+	d.lastOut = out
+	for range 30 {
+		d.observe(out)
+	}
+	stalled, hint = d.roll(now.Add(time.Minute), 2*time.Second)
+	assert.Equal(t, 3*time.Second, stalled)
+	assert.False(t, hint)
+	for range 30 {
+		d.observe(out)
+	}
+	_, hint = d.roll(now.Add(stallHintGap), 2*time.Second)
+	assert.True(t, hint)
+}
+
+func TestStallDetector_BelowThreshold(t *testing.T) {
+	var m stallMeter
+	d := newStallDetector(&m, 100*time.Millisecond)
+	m.pending.Store(1)
+	for range 10 {
+		d.observe(0)
+	}
+	stalled, hint := d.roll(time.Now(), 2*time.Second)
+	assert.Equal(t, time.Second, stalled)
+	assert.False(t, hint)
+}
+
+// TestStallDetector_WithBlockingStream drives the detector from real writes
+// that a fake stream holds for a controlled duration.
+func TestStallDetector_WithBlockingStream(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		delay   time.Duration
+		stalled bool
+	}{
+		{"short stall", 20 * time.Millisecond, false},
+		{"long stall", 400 * time.Millisecond, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var m stallMeter
+			const tick = 10 * time.Millisecond
+			d := newStallDetector(&m, tick)
+			w := blockedWriter{&gatedStream{delay: tc.delay}, &m}
+
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, _ = w.Write([]byte("payload"))
+			}()
+			require.Eventually(t, func() bool { return m.pending.Load() == 1 }, time.Second, time.Millisecond)
+			for m.pending.Load() > 0 {
+				d.observe(0)
+				time.Sleep(tick)
+			}
+			wg.Wait()
+
+			stalled, hint := d.roll(time.Now(), 200*time.Millisecond)
+			assert.Equal(t, tc.stalled, hint, "stalled %s", stalled)
+			assert.GreaterOrEqual(t, time.Duration(m.blocked.Load()), tc.delay)
+		})
+	}
+}
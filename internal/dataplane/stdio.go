@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/fortunnels/client/internal/config"
+)
+
+// RunProxyCommand bridges stdin/stdout to one stream to the server-side dst,
+// for use as an SSH ProxyCommand. Only payload bytes are written to stdout.
+// Closing stdin half-closes the stream; it returns nil once the remote side
+// closes and an error when the tunnel fails.
+func RunProxyCommand(serverURL, tunnelID, dst string, runtime config.RuntimeSettings, enc config.EncryptionSettings, dpAuthToken string, stdin io.Reader, stdout io.Writer) error {
+	sess, cleanup, err := CreateDataPlaneSession(serverURL, tunnelID, runtime, dpAuthToken)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	if runtime.Redundant {
+		return proxyRedundant(serverURL, sess, tunnelID, dst, runtime, enc, dpAuthToken, stdin, stdout)
+	}
+	return proxyOverSession(sess, tunnelID, dst, runtime, enc, stdin, stdout)
+}
+
+// proxyRedundant is RunProxyCommand with --redundant: the stream runs on sess
+// and on a QUIC connection at once. Without QUIC it runs on sess alone.
+func proxyRedundant(serverURL string, sess Session, tunnelID, dst string, runtime config.RuntimeSettings, enc config.EncryptionSettings, dpAuthToken string, stdin io.Reader, stdout io.Writer) error {
+	transports := []redundantTransport{{name: config.DataPlaneWS, sess: sess}}
+	ctx, cancel := context.WithTimeout(context.Background(), quicServeDialTimeout)
+	qc, err := dialQUICWithConfig(ctx, newEndpointSelector(serverURL, runtime.PinnedIP), runtime.QUICPortString(), &quic.Config{
+		KeepAlivePeriod: runtime.SmuxKeepAliveInterval,
+		MaxIdleTimeout:  runtime.SmuxKeepAliveTimeout,
+	})
+	cancel()
+	if err != nil {
+		log.Printf("[WARN] redundant stream: QUIC data plane unavailable (%v); continuing on the WebSocket data plane only", err)
+	} else {
+		defer func() { _ = qc.CloseWithError(0, "") }()
+		transports = append(transports, redundantTransport{name: config.DataPlaneQUIC, sess: quicSession{qc}, auth: dpAuthToken})
+	}
+	return proxyOverTransports(transports, tunnelID, dst, runtime, enc, stdin, stdout)
+}
+
+// proxyOverTransports is proxyOverSession on a redundant stream over
+// transports.
+func proxyOverTransports(transports []redundantTransport, tunnelID, dst string, runtime config.RuntimeSettings, enc config.EncryptionSettings, stdin io.Reader, stdout io.Writer) error {
+	fields := encryptionPreface(map[string]string{"dst": dst, "proto": "tcp", "tunnel_id": tunnelID}, enc)
+	stream, err := openRedundantStream(transports, fields, prefaceMeta{instanceID: runtime.InstanceID})
+	if err != nil {
+		return err
+	}
+	return bridgeStdio(WrapClientStream(stream, tunnelID, enc), stdin, stdout)
+}
+
+// proxyOverSession is RunProxyCommand on sess.
+func proxyOverSession(sess Session, tunnelID, dst string, runtime config.RuntimeSettings, enc config.EncryptionSettings, stdin io.Reader, stdout io.Writer) error {
+	stream, err := processLatency.open(tunnelID, sess.OpenStream)
+	if err != nil {
+		return fmt.Errorf("open stream: %w", err)
+	}
+	preface, err := clientPreface(encryptionPreface(map[string]string{"dst": dst, "proto": "tcp", "tunnel_id": tunnelID}, enc), prefaceMeta{instanceID: runtime.InstanceID})
+	if err != nil {
+		return err
+	}
+	if _, err := stream.Write(preface); err != nil {
+		_ = stream.Close()
+		return fmt.Errorf("write preface: %w", err)
+	}
+	return bridgeStdio(WrapClientStream(processLatency.firstByte(tunnelID, stream), tunnelID, enc), stdin, stdout)
+}
+
+// bridgeStdio copies stdin to stream and stream to stdout. EOF on stdin is
+// propagated as a half-close, so replies keep draining until the remote closes.
+func bridgeStdio(stream io.ReadWriteCloser, stdin io.Reader, stdout io.Writer) error {
+	defer stream.Close()
+	go func() {
+		if _, err := io.Copy(stream, stdin); err != nil {
+			log.Printf("[WARN] proxy-command: stdin -> tunnel: %v", err)
+		}
+		closeWriteOrClose(stream)
+	}()
+	// smux reports the remote FIN as io.EOF from WriteTo, or io.ErrClosedPipe
+	// once both sides have half-closed; both mean the remote side is done.
+	if _, err := io.Copy(stdout, stream); err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrClosedPipe) {
+		return fmt.Errorf("tunnel -> stdout: %w", err)
+	}
+	return nil
+}
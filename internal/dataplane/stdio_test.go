@@ -0,0 +1,150 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+	sec "github.com/fortunnels/client/internal/security"
+	"github.com/fortunnels/client/internal/testsupport"
+)
+
+func TestBridgeStdio_HalfCloseDrainsReply(t *testing.T) {
+	local, remote := tcpPair(t)
+	got := make(chan string, 1)
+	go func() {
+		// The remote answers only after it sees EOF from the client.
+		req, _ := io.ReadAll(remote)
+		got <- string(req)
+		_, _ = remote.Write([]byte("reply to " + string(req)))
+		_ = remote.Close()
+	}()
+
+	var stdout bytes.Buffer
+	require.NoError(t, bridgeStdio(local, strings.NewReader("request"), &stdout))
+	assert.Equal(t, "request", <-got)
+	assert.Equal(t, "reply to request", stdout.String(), "stdout carries payload only")
+}
+
+// startBannerBackend behaves like sshd for the test: it sends a banner, reads
+// until the client half-closes and reports what it received.
+func startBannerBackend(t *testing.T, banner string) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	got := make(chan string, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		_, _ = c.Write([]byte(banner))
+		req, _ := io.ReadAll(c)
+		got <- string(req)
+	}()
+	return ln.Addr().String(), got
+}
+
+func runProxyBanner(t *testing.T, opts testsupport.Options, enc config.EncryptionSettings) {
+	t.Helper()
+	stub := testsupport.NewServer(opts)
+	defer stub.Close()
+	tun := stub.AddTunnel("tcp", "127.0.0.1:0")
+	const banner = "SSH-2.0-server\r\n"
+	backend, received := startBannerBackend(t, banner)
+
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW := io.Pipe()
+	errCh := make(chan error, 1)
+	go func() {
+		err := RunProxyCommand(stub.URL, tun.ID, backend, e2eRuntime(), enc, "", stdinR, stdoutW)
+		_ = stdoutW.Close()
+		errCh <- err
+	}()
+
+	buf := make([]byte, len(banner))
+	_, err := io.ReadFull(stdoutR, buf)
+	require.NoError(t, err)
+	require.Equal(t, banner, string(buf))
+	_, err = stdinW.Write([]byte("SSH-2.0-client\r\n"))
+	require.NoError(t, err)
+	require.NoError(t, stdinW.Close())
+
+	select {
+	case req := <-received:
+		require.Equal(t, "SSH-2.0-client\r\n", req, "closing stdin half-closes the stream")
+	case <-time.After(5 * time.Second):
+		t.Fatal("backend did not see EOF after stdin closed")
+	}
+	rest, err := io.ReadAll(stdoutR)
+	require.NoError(t, err)
+	assert.Empty(t, rest, "stdout carries payload only")
+	require.NoError(t, <-errCh, "remote close exits cleanly")
+}
+
+func TestRunProxyCommand_HalfCloseAndRemoteClose(t *testing.T) {
+	runProxyBanner(t, testsupport.Options{}, config.EncryptionSettings{})
+}
+
+func TestRunProxyCommand_Encrypted(t *testing.T) {
+	const psk = "0123456789abcdef0123456789abcdef"
+	runProxyBanner(t, testsupport.Options{PSK: psk}, config.EncryptionSettings{Enabled: true, PSK: psk})
+}
+
+func TestRunProxyCommand_EncryptedArgon2id(t *testing.T) {
+	const psk = "correct horse battery staple on tuesdays"
+	runProxyBanner(t, testsupport.Options{PSK: psk}, config.EncryptionSettings{Enabled: true, PSK: psk, KDF: sec.Argon2idKDF})
+}
+
+func TestRunProxyCommand_KDFMismatchFailsLoudly(t *testing.T) {
+	const psk = "correct horse battery staple on tuesdays"
+	stub := testsupport.NewServer(testsupport.Options{PSK: psk, PSKKDF: sec.KDFLegacy})
+	defer stub.Close()
+	tun := stub.AddTunnel("tcp", "127.0.0.1:0")
+	backend, _ := startBannerBackend(t, "SSH-2.0-server\r\n")
+
+	stdin, stdinW := io.Pipe()
+	defer stdinW.Close()
+	enc := config.EncryptionSettings{Enabled: true, PSK: psk, KDF: sec.Argon2idKDF}
+	var stdout bytes.Buffer
+	err := RunProxyCommand(stub.URL, tun.ID, backend, e2eRuntime(), enc, "", stdin, &stdout)
+	require.ErrorIs(t, err, sec.ErrKeyMismatch)
+	assert.Empty(t, stdout.String(), "no garbage reaches stdout")
+}
+
+func TestRunProxyCommand_SessionDropIsAnError(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	tun := stub.AddTunnel("tcp", "127.0.0.1:0")
+	backend := startTCPEchoBackend(t)
+
+	stdinR, stdinW := io.Pipe()
+	defer stdinW.Close()
+	var stdout bytes.Buffer
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- RunProxyCommand(stub.URL, tun.ID, backend, e2eRuntime(), config.EncryptionSettings{}, "", stdinR, &stdout)
+	}()
+	require.NoError(t, stub.WaitSessions(tun.ID, 1, 5*time.Second))
+	stub.DropSessions(tun.ID)
+
+	select {
+	case err := <-errCh:
+		require.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("proxy command did not stop after the session dropped")
+	}
+	assert.Empty(t, stdout.String())
+}
@@ -4,6 +4,7 @@
 package dataplane
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/fortunnels/client/internal/config"
@@ -15,10 +16,12 @@ const (
 	wsDescription   = "\n📡 UDP mode: listening on %s and forwarding to %s over WS→smux (preface proto=udp) ...\n"
 )
 
-// Strategy encapsulates a UDP data-plane mode.
+// Strategy encapsulates a UDP data-plane mode. It runs until it fails or
+// the context it was built with is cancelled.
 type Strategy struct {
 	Description    string
 	RunningMessage string
+	StoppedMessage string
 	ErrLabel       string
 	runner         func() error
 }
@@ -31,8 +34,11 @@ func (s Strategy) Run() error {
 	return s.runner()
 }
 
-// NewStrategy builds a strategy for the requested UDP mode.
+// NewStrategy builds a strategy for the requested UDP mode. Cancelling ctx
+// stops it: the runner closes its local UDP socket and server connection
+// and returns ctx's error.
 func NewStrategy(
+	ctx context.Context,
 	kind string,
 	serverURL, tunnelID, authToken, dst, listen string,
 	runtime config.RuntimeSettings,
@@ -43,36 +49,40 @@ func NewStrategy(
 		return simpleStrategy(
 			fmt.Sprintf(quicDescription, listen, dst),
 			"🔌 UDP QUIC tunnel running. Press Ctrl+C to stop.",
+			"🛑 UDP QUIC tunnel stopped.",
 			"udp quic mode error",
 			func() error {
-				return StartQUICDataPlaneUDP(serverURL, runtime.QUICPortString(), tunnelID, authToken, dst, listen)
+				return StartQUICDataPlaneUDP(ctx, serverURL, runtime.PinnedIP, runtime.QUICPortString(), tunnelID, authToken, dst, listen, runtime.UDPQueueSize)
 			},
 		)
 	case "dtls":
 		return simpleStrategy(
 			fmt.Sprintf(dtlsDescription, listen, dst),
 			"🔌 UDP DTLS tunnel running. Press Ctrl+C to stop.",
+			"🛑 UDP DTLS tunnel stopped.",
 			"udp dtls mode error",
 			func() error {
-				return StartDTLSDataPlaneUDP(serverURL, runtime.DTLSPortString(), tunnelID, authToken, dst, listen)
+				return StartDTLSDataPlaneUDP(ctx, serverURL, runtime.DTLSPortString(), tunnelID, authToken, dst, listen)
 			},
 		)
 	default:
 		return simpleStrategy(
 			fmt.Sprintf(wsDescription, listen, dst),
 			"🔌 UDP tunnel running. Press Ctrl+C to stop.",
+			"🛑 UDP tunnel stopped.",
 			"udp mode error",
 			func() error {
-				return StartDataPlaneUDP(serverURL, tunnelID, dst, listen, runtime, enc, authToken)
+				return StartDataPlaneUDP(ctx, serverURL, tunnelID, dst, listen, runtime, enc, authToken)
 			},
 		)
 	}
 }
 
-func simpleStrategy(description, running, errLabel string, runner func() error) Strategy {
+func simpleStrategy(description, running, stopped, errLabel string, runner func() error) Strategy {
 	return Strategy{
 		Description:    description,
 		RunningMessage: running,
+		StoppedMessage: stopped,
 		ErrLabel:       errLabel,
 		runner:         runner,
 	}
@@ -4,12 +4,18 @@
 package dataplane
 
 import (
+	"context"
 	"errors"
+	"net"
+	"runtime"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/testsupport"
 )
 
 func TestNewStrategy(t *testing.T) {
@@ -78,7 +84,7 @@ func TestNewStrategy(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			strategy := NewStrategy(tt.kind, tt.serverURL, tt.tunnelID, tt.authToken, tt.dst, tt.listen, runtime, enc)
+			strategy := NewStrategy(context.Background(), tt.kind, tt.serverURL, tt.tunnelID, tt.authToken, tt.dst, tt.listen, runtime, enc)
 
 			if strategy.Description == "" {
 				t.Error("NewStrategy() should set Description")
@@ -89,6 +95,9 @@ func TestNewStrategy(t *testing.T) {
 			if strategy.RunningMessage == "" {
 				t.Error("NewStrategy() should set RunningMessage")
 			}
+			if strategy.StoppedMessage == "" {
+				t.Error("NewStrategy() should set StoppedMessage")
+			}
 			if strategy.ErrLabel == "" {
 				t.Error("NewStrategy() should set ErrLabel")
 			}
@@ -137,6 +146,7 @@ func TestStrategyRun(t *testing.T) {
 func TestSimpleStrategy(t *testing.T) {
 	description := "test description"
 	running := "running message"
+	stopped := "stopped message"
 	errLabel := "error label"
 	runnerErr := errors.New("runner error")
 
@@ -144,7 +154,7 @@ func TestSimpleStrategy(t *testing.T) {
 		return runnerErr
 	}
 
-	strategy := simpleStrategy(description, running, errLabel, runner)
+	strategy := simpleStrategy(description, running, stopped, errLabel, runner)
 
 	if strategy.Description != description {
 		t.Errorf("simpleStrategy() Description = %q, want %q", strategy.Description, description)
@@ -152,6 +162,9 @@ func TestSimpleStrategy(t *testing.T) {
 	if strategy.RunningMessage != running {
 		t.Errorf("simpleStrategy() RunningMessage = %q, want %q", strategy.RunningMessage, running)
 	}
+	if strategy.StoppedMessage != stopped {
+		t.Errorf("simpleStrategy() StoppedMessage = %q, want %q", strategy.StoppedMessage, stopped)
+	}
 	if strategy.ErrLabel != errLabel {
 		t.Errorf("simpleStrategy() ErrLabel = %q, want %q", strategy.ErrLabel, errLabel)
 	}
@@ -163,6 +176,70 @@ func TestSimpleStrategy(t *testing.T) {
 	assert.Equal(t, runnerErr, err, "simpleStrategy() runner = %v, want %v")
 }
 
+// TestStrategy_CancelStopsRunners cancels each UDP runner mid-flight: the
+// WS runner with a live session, QUIC and DTLS while their handshake waits on
+// a server that never answers. Each must return promptly, release its local
+// socket and leave no goroutines behind.
+func TestStrategy_CancelStopsRunners(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	silent, err := listenTestUDP("127.0.0.1:0")
+	require.NoError(t, err)
+	defer silent.Close()
+	rs := e2eRuntime()
+	rs.QUICPort = silent.LocalAddr().(*net.UDPAddr).Port
+	rs.DTLSPort = rs.QUICPort
+
+	for _, kind := range []string{"ws", "quic", "dtls"} {
+		t.Run(kind, func(t *testing.T) {
+			tun := stub.AddTunnel("udp", "")
+			listen := freeUDPAddr(t)
+			serverURL := stub.URL
+			if kind != "ws" {
+				serverURL = "https://127.0.0.1"
+			}
+			baseline := runtime.NumGoroutine()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			strategy := NewStrategy(ctx, kind, serverURL, tun.ID, "", "127.0.0.1:53", listen, rs, config.EncryptionSettings{})
+			done := make(chan error, 1)
+			go func() { done <- strategy.Run() }()
+			if kind == "ws" {
+				require.NoError(t, stub.WaitSessions(tun.ID, 1, 5*time.Second))
+			} else {
+				time.Sleep(200 * time.Millisecond)
+			}
+
+			cancel()
+			select {
+			case err := <-done:
+				require.ErrorIs(t, err, context.Canceled)
+			case <-time.After(time.Second):
+				t.Fatal("runner did not return within a second of cancellation")
+			}
+			uc, err := listenTestUDP(listen)
+			require.NoError(t, err, "the local UDP socket is closed")
+			uc.Close()
+			assertNoGoroutineLeak(t, baseline)
+		})
+	}
+}
+
+// assertNoGoroutineLeak waits for the goroutine count to fall back to
+// baseline. It polls in the test goroutine: assert.Eventually would add
+// goroutines of its own to the count.
+func assertNoGoroutineLeak(t *testing.T, baseline int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			t.Fatalf("%d goroutines left, baseline %d:\n%s", runtime.NumGoroutine(), baseline, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || substr == "" ||
 		(len(s) > len(substr) && (s[:len(substr)] == substr || s[len(s)-len(substr):] == substr ||
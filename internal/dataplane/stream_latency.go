@@ -0,0 +1,188 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fortunnels/client/internal/support"
+)
+
+// minLatencyWindowStreams is how many streams a window needs before its p95
+// can raise the --stream-latency-warn alarm: one slow stream is not a
+// degraded server.
+const minLatencyWindowStreams = 5
+
+// Phases of a client-opened stream whose latency is tracked.
+const (
+	// phaseOpen is the OpenStream call itself.
+	phaseOpen = "stream open"
+	// phaseFirstByte is from writing the preface to the first byte back.
+	phaseFirstByte = "first byte"
+)
+
+// latencyHints says what a slow phase points at.
+var latencyHints = map[string]string{
+	phaseOpen:      "the data-plane session is slow to take new streams",
+	phaseFirstByte: "the server is slow to connect streams to their destination",
+}
+
+// processLatency times the client-opened streams (listen mode,
+// --proxy-command) of every tunnel in this process.
+var processLatency = newStreamLatency(support.RealClock)
+
+// SetStreamLatencyAlarm makes a warning be logged for each window in which
+// the p95 of a stream phase exceeds warn; 0 disables the warning.
+func SetStreamLatencyAlarm(warn, window time.Duration) {
+	processLatency.setAlarm(warn, window)
+}
+
+// WriteStreamLatencySummary writes the percentiles of each tunnel's stream
+// phases, if it opened any streams.
+func WriteStreamLatencySummary(w io.Writer) {
+	processLatency.writeSummary(w)
+}
+
+// streamLatency keeps the per-tunnel percentiles of each stream phase, for
+// the run and for the current alarm window.
+type streamLatency struct {
+	clock support.Clock
+
+	mu      sync.Mutex
+	warn    time.Duration
+	window  time.Duration
+	tunnels map[string]map[string]*latencyPhase
+}
+
+type latencyPhase struct {
+	run *support.QuantileSketch
+
+	mu          sync.Mutex
+	current     *support.QuantileSketch
+	windowStart time.Time
+}
+
+func newStreamLatency(clock support.Clock) *streamLatency {
+	return &streamLatency{clock: clock, window: time.Minute, tunnels: make(map[string]map[string]*latencyPhase)}
+}
+
+func (l *streamLatency) setAlarm(warn, window time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.warn = warn
+	if window > 0 {
+		l.window = window
+	}
+}
+
+func (l *streamLatency) phase(tunnelID, name string) *latencyPhase {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	phases := l.tunnels[tunnelID]
+	if phases == nil {
+		phases = make(map[string]*latencyPhase)
+		l.tunnels[tunnelID] = phases
+	}
+	p := phases[name]
+	if p == nil {
+		p = &latencyPhase{run: support.NewQuantileSketch(0), current: support.NewQuantileSketch(0)}
+		phases[name] = p
+	}
+	return p
+}
+
+// observe records d for the phase of tunnelID. The first stream after a
+// window ended evaluates it, so an alarm is logged at most once per window
+// and phase.
+func (l *streamLatency) observe(tunnelID, name string, d time.Duration) {
+	p := l.phase(tunnelID, name)
+	p.run.Add(d)
+	l.mu.Lock()
+	warn, window := l.warn, l.window
+	l.mu.Unlock()
+	now := l.clock.Now()
+
+	p.mu.Lock()
+	var ended support.Percentiles
+	if p.windowStart.IsZero() {
+		p.windowStart = now
+	} else if now.Sub(p.windowStart) >= window {
+		ended = p.current.Percentiles()
+		p.current.Reset()
+		p.windowStart = now
+	}
+	p.current.Add(d)
+	p.mu.Unlock()
+
+	if warn > 0 && ended.Count >= minLatencyWindowStreams && ended.P95 > warn {
+		log.Printf("[WARN] tunnel %s: %s p95 was %s over the last %s (%d streams, p50 %s, p99 %s), above --stream-latency-warn %s; %s",
+			tunnelID, name, ended.P95.Round(time.Millisecond), window, ended.Count,
+			ended.P50.Round(time.Millisecond), ended.P99.Round(time.Millisecond), warn, latencyHints[name])
+	}
+}
+
+// open calls open and records how long it took for tunnelID.
+func (l *streamLatency) open(tunnelID string, open func() (Stream, error)) (Stream, error) {
+	begin := l.clock.Now()
+	st, err := open()
+	if err == nil {
+		l.observe(tunnelID, phaseOpen, l.clock.Now().Sub(begin))
+	}
+	return st, err
+}
+
+// firstByte returns st recording, for tunnelID, the time from now (the
+// preface was just written) to the first byte read from it.
+func (l *streamLatency) firstByte(tunnelID string, st Stream) Stream {
+	sent := l.clock.Now()
+	return &firstByteStream{Stream: st, record: func() {
+		l.observe(tunnelID, phaseFirstByte, l.clock.Now().Sub(sent))
+	}}
+}
+
+func (l *streamLatency) writeSummary(w io.Writer) {
+	l.mu.Lock()
+	ids := make([]string, 0, len(l.tunnels))
+	phases := make(map[string]map[string]*latencyPhase, len(l.tunnels))
+	for id, ph := range l.tunnels {
+		ids = append(ids, id)
+		phases[id] = maps.Clone(ph)
+	}
+	l.mu.Unlock()
+	sort.Strings(ids)
+	for _, id := range ids {
+		fmt.Fprintf(w, "\n⏱️  Stream latency (tunnel %s):\n", id)
+		for _, name := range []string{phaseOpen, phaseFirstByte} {
+			p := phases[id][name]
+			if p == nil {
+				continue
+			}
+			pc := p.run.Percentiles()
+			fmt.Fprintf(w, "   %s: p50 %s, p95 %s, p99 %s (%d streams)\n", name,
+				pc.P50.Round(time.Microsecond), pc.P95.Round(time.Microsecond), pc.P99.Round(time.Microsecond), pc.Count)
+		}
+	}
+}
+
+// firstByteStream is a Stream that calls record when its first byte
+// arrives.
+type firstByteStream struct {
+	Stream
+	record func()
+	once   sync.Once
+}
+
+func (s *firstByteStream) Read(p []byte) (int, error) {
+	n, err := s.Stream.Read(p)
+	if n > 0 {
+		s.once.Do(s.record)
+	}
+	return n, err
+}
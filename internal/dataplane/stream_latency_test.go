@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/support"
+	"github.com/fortunnels/client/internal/testsupport"
+)
+
+func TestStreamLatency_WarnsOncePerSlowWindow(t *testing.T) {
+	buf := captureLog(t)
+	clock := support.NewFakeClock(time.Unix(1_700_000_000, 0))
+	l := newStreamLatency(clock)
+	l.setAlarm(time.Second, time.Minute)
+
+	for range 6 {
+		l.observe("t1", phaseFirstByte, 3*time.Second)
+		l.observe("t1", phaseOpen, time.Millisecond)
+	}
+	assert.Empty(t, buf.String(), "the window is still open")
+
+	clock.Advance(time.Minute)
+	l.observe("t1", phaseFirstByte, 10*time.Millisecond)
+	l.observe("t1", phaseOpen, time.Millisecond)
+	out := buf.String()
+	assert.Equal(t, 1, strings.Count(out, "[WARN]"), out)
+	assert.Contains(t, out, "tunnel t1: first byte p95 was 3s over the last 1m0s (6 streams")
+	assert.Contains(t, out, "the server is slow to connect streams to their destination")
+	buf.Reset()
+
+	// The next window is fast again.
+	for range 5 {
+		l.observe("t1", phaseFirstByte, 10*time.Millisecond)
+	}
+	clock.Advance(time.Minute)
+	l.observe("t1", phaseFirstByte, 10*time.Millisecond)
+	assert.Empty(t, buf.String())
+}
+
+func TestStreamLatency_FewSlowStreamsAreNoAlarm(t *testing.T) {
+	buf := captureLog(t)
+	clock := support.NewFakeClock(time.Unix(1_700_000_000, 0))
+	l := newStreamLatency(clock)
+	l.setAlarm(time.Second, time.Minute)
+	for range minLatencyWindowStreams - 1 {
+		l.observe("t1", phaseOpen, 5*time.Second)
+	}
+	clock.Advance(time.Minute)
+	l.observe("t1", phaseOpen, 5*time.Second)
+	assert.Empty(t, buf.String())
+
+	l.setAlarm(0, time.Minute)
+	for range 10 {
+		l.observe("t1", phaseOpen, 5*time.Second)
+	}
+	clock.Advance(time.Minute)
+	l.observe("t1", phaseOpen, 5*time.Second)
+	assert.Empty(t, buf.String(), "the warning is off")
+}
+
+func TestStreamLatency_Summary(t *testing.T) {
+	l := newStreamLatency(support.NewFakeClock(time.Unix(1_700_000_000, 0)))
+	var out bytes.Buffer
+	l.writeSummary(&out)
+	assert.Empty(t, out.String(), "no streams, no summary")
+
+	for i := range 100 {
+		l.observe("t1", phaseOpen, time.Duration(i+1)*time.Millisecond)
+	}
+	l.writeSummary(&out)
+	assert.Equal(t, "\n⏱️  Stream latency (tunnel t1):\n   stream open: p50 50ms, p95 95ms, p99 99ms (100 streams)\n", out.String())
+}
+
+// TestStreamLatency_ListenStreams checks that listen-mode streams are timed
+// from the open and from the preface to the first echoed byte.
+func TestStreamLatency_ListenStreams(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	tun := stub.AddTunnel("tcp", "")
+	mgr := NewTunnelManager(stub.URL, tun.ID, "", e2eRuntime())
+	defer mgr.Close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	// Stub tunnel IDs repeat across tests; count from here.
+	opens := processLatency.phase(tun.ID, phaseOpen).run
+	firstByte := processLatency.phase(tun.ID, phaseFirstByte).run
+	opensBefore, firstBefore := opens.Count(), firstByte.Count()
+	go func() {
+		_ = serveListener(ln, mgr, newListenForwarder(tun.ID, testsupport.EchoDst, e2eRuntime(), config.EncryptionSettings{}))
+	}()
+
+	for range 3 {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		require.NoError(t, err)
+		_, err = io.WriteString(c, "ping")
+		require.NoError(t, err)
+		got := make([]byte, 4)
+		_, err = io.ReadFull(c, got)
+		require.NoError(t, err)
+		require.NoError(t, c.Close())
+	}
+
+	assert.Equal(t, opensBefore+3, opens.Count())
+	assert.Equal(t, firstBefore+3, firstByte.Count())
+	assert.Positive(t, firstByte.Quantile(0.5))
+}
@@ -5,17 +5,22 @@ package dataplane
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
-	"strings"
+	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fortunnels/client/internal/config"
 	"github.com/fortunnels/client/internal/support"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
 )
 
 // BackendStateReporter is called on backend dial success/failure for CLI transition messages.
@@ -23,9 +28,11 @@ import (
 // If nil, no reporting is done.
 type BackendStateReporter func(dst string, err error)
 
-// NewBackendStateReporter returns a reporter that prints one-time messages on backend dial
-// down/up transitions. Messages reflect transport-level reachability only, not full proxy readiness.
-func NewBackendStateReporter() BackendStateReporter {
+// NewBackendStateReporter returns a reporter that tells r, once per change,
+// when a backend's dial goes down or up (nil r prints them). Messages reflect
+// transport-level reachability only, not full proxy readiness.
+func NewBackendStateReporter(r support.Reporter) BackendStateReporter {
+	r = support.ReporterOr(r)
 	var mu sync.Mutex
 	state := make(map[string]bool) // dst -> wasDown
 	return func(dst string, err error) {
@@ -33,13 +40,18 @@ func NewBackendStateReporter() BackendStateReporter {
 		defer mu.Unlock()
 		wasDown := state[dst]
 		if err != nil {
-			if !wasDown {
-				fmt.Printf("⚠️  Backend unreachable for %s — start your backend\n", dst)
+			var proxyErr *support.BackendDialError
+			switch {
+			case wasDown:
+			case errors.As(err, &proxyErr) && proxyErr.ProxyFailed:
+				r.UserMessage(support.LevelInfo, "⚠️  Backend proxy unreachable for %s — %v\n", support.SanitizeRemote(dst), support.SanitizeRemote(err.Error()))
+			default:
+				r.UserMessage(support.LevelInfo, "⚠️  Backend unreachable for %s — start your backend\n", support.SanitizeRemote(dst))
 			}
 			state[dst] = true
 		} else {
 			if wasDown {
-				fmt.Printf("✅ Backend reachable for %s\n", dst)
+				r.UserMessage(support.LevelInfo, "✅ Backend reachable for %s\n", support.SanitizeRemote(dst))
 			}
 			state[dst] = false
 		}
@@ -47,25 +59,147 @@ func NewBackendStateReporter() BackendStateReporter {
 }
 
 func StartDataPlaneServeIncoming(serverURL, tunnelID string, runtime config.RuntimeSettings, reporter BackendStateReporter, dpAuthToken string) error {
-	mgr := NewManager(serverURL, tunnelID, dpAuthToken, time.Second, 30*time.Second, runtime)
+	mgr := NewTunnelManager(serverURL, tunnelID, dpAuthToken, runtime)
 	defer mgr.Close()
+	return serveIncomingWithManager(mgr, reporter)
+}
+
+// ServeIncoming is StartDataPlaneServeIncoming on the sessions of mgr, which
+// may forward a local listener at the same time (http tunnels with --listen).
+func ServeIncoming(mgr *Manager, reporter BackendStateReporter) error {
+	scope := support.PanicScope{Role: "incoming stream loop", TunnelID: mgr.tunnelID}
+	return support.Supervise(scope, mgr.Done(), func() error {
+		return serveIncomingWithManager(mgr, reporter)
+	})
+}
+
+// serveIncomingWithManager accepts server-initiated streams on every session
+// generation of mgr. When a standby session is promoted the accept loop of the
+// old session keeps running until it drains, so there is no accept downtime.
+func serveIncomingWithManager(mgr *Manager, reporter BackendStateReporter) error {
+	return serveIncomingUntil(mgr, reporter, nil)
+}
+
+// serveIncomingUntil is serveIncomingWithManager stopping once stop is
+// closed as well; a nil stop serves until mgr is closed.
+func serveIncomingUntil(mgr *Manager, reporter BackendStateReporter, stop <-chan struct{}) error {
+	server, err := newIncomingStreamServer(mgr.tunnelID, mgr.settings, reporter)
+	if err != nil {
+		return err
+	}
+	defer server.followLiveSettings()()
+	defer server.keepAlive.closeIdle()
 	for {
+		select {
+		case <-stop:
+			return errors.New("stopped")
+		default:
+		}
 		// ensure session alive
 		sess, err := mgr.EnsureSession()
 		if err != nil {
 			return err
 		}
+		retired := mgr.Retired(sess)
+		acceptDone := make(chan struct{})
+		support.Go(support.PanicScope{Role: "stream accept loop", TunnelID: mgr.tunnelID}, func() {
+			acceptIncomingStreams(sess, server, acceptDone)
+		})
+		select {
+		case <-stop:
+			return errors.New("stopped")
+		case <-retired:
+		case <-acceptDone:
+			// The transport failed. smux only marks the session closed after
+			// its keepalive timeout, so close it now to make EnsureSession redial.
+			_ = sess.Close()
+			mgr.clock.Sleep(reconnectRetryDelay)
+		}
+	}
+}
+
+// newIncomingStreamServer returns the server of a tunnel's incoming streams,
+// whichever transport carries them.
+func newIncomingStreamServer(tunnelID string, settings config.RuntimeSettings, reporter BackendStateReporter) (incomingStreamServer, error) {
+	dialer, err := support.NewBackendDialer(settings.BackendProxy)
+	if err != nil {
+		return incomingStreamServer{}, err
+	}
+	fallback, err := newFallbackPage(settings)
+	if err != nil {
+		return incomingStreamServer{}, err
+	}
+	server := incomingStreamServer{
+		tunnelID:  tunnelID,
+		httpAware: settings.HTTPAware,
+		reporter:  reporter,
+		guard:     newIncomingGuard(tunnelID, settings),
+		dialer:    dialer,
+		pool:      newBackendPool(settings),
+		keepAlive: newKeepAlivePool(settings),
+		resume:    newResumeRegistry(settings),
+		fallback:  fallback,
+		queue:     queueFor(settings),
+		inspect:   new(atomic.Pointer[inspectOptions]),
+		peekBytes: settings.HTTPPeekBytes,
+		rawPath:   settings.RawPath,
+		rawDst:    settings.RawDst,
+		sources:   newSourceLimiter(settings),
+
+		hostRewrite:   settings.HostRewrite,
+		forwardedHost: settings.HostRewriteForwarded,
+
+		firstByteTimeout: settings.BackendFirstByteTimeout,
+		timeoutClose:     settings.BackendTimeoutClose,
+		timeout503:       settings.BackendTimeout503 && settings.HTTPAware,
+
+		quota:   &processQuota,
+		classes: settings.TrafficClasses,
+	}
+	server.inspect.Store(&inspectOptions{decode: settings.InspectDecode, bodyBytes: settings.InspectBodyBytes})
+	return server, nil
+}
+
+// followLiveSettings applies setting reloads to s; the returned func stops.
+func (s incomingStreamServer) followLiveSettings() func() {
+	return onLiveSettings(func(ls LiveSettings) {
+		s.inspect.Store(&inspectOptions{decode: ls.InspectDecode, bodyBytes: ls.InspectBodyBytes})
+		// Without a guard nothing was restricted at startup (no allowlist, no
+		// HMAC secret); a reload does not add one.
+		if s.guard != nil {
+			s.guard.setAllowlist(ls.IncomingDstAllow)
+		}
+	})
+}
+
+const incomingStreamErrorFormat = "incoming stream error: %v"
+
+func acceptIncomingStreams(sess Session, server incomingStreamServer, done chan<- struct{}) {
+	defer close(done)
+	for {
 		st, err := sess.AcceptStream()
 		if err != nil {
-			// session likely closed; retry loop will recreate
-			time.Sleep(reconnectRetryDelay)
-			continue
+			return
 		}
-		go func(s io.ReadWriteCloser) {
-			if err := serveIncomingStream(s, reporter); err != nil && !support.IsBenignCopyError(err) {
-				log.Printf("incoming stream error: %v", err)
-			}
-		}(st)
+		go server.serveLogged(st)
+	}
+}
+
+// serveLogged serves one accepted stream under its own correlation ID.
+func (s incomingStreamServer) serveLogged(stream io.ReadWriteCloser) {
+	processServe.accepted.Add(1)
+	defer track(&processServe.goroutines)()
+	lg := newConnLogger()
+	scope := support.PanicScope{Role: "incoming stream", TunnelID: s.tunnelID, ConnID: lg.id}
+	defer support.Recover(scope)
+	err := s.serve(stream, lg)
+	var p *support.PanicError
+	switch {
+	case errors.As(err, &p):
+		// A copy goroutine of the bridge panicked; the stream is closed.
+		support.ReportPanic(scope, p)
+	case err != nil && !support.IsBenignCopyError(err):
+		lg.Repeatf(support.LogKey(incomingStreamErrorFormat, support.ErrorClass(err)), incomingStreamErrorFormat, support.SanitizeRemote(err.Error()))
 	}
 }
 
@@ -82,75 +216,488 @@ func writeSetupError(stream io.Writer, err error) {
 }
 
 func serveIncomingStream(stream io.ReadWriteCloser, reporter BackendStateReporter) error {
+	return incomingStreamServer{reporter: reporter}.serve(stream, connLogger{})
+}
+
+// incomingStreamServer serves server-initiated streams: read the preface, dial
+// the local backend and bridge the two.
+type incomingStreamServer struct {
+	tunnelID string
+	// httpAware marks streams that carry HTTP/1.x (http/https tunnels), which
+	// enables traceparent propagation when tracing is on.
+	httpAware bool
+	reporter  BackendStateReporter
+	// guard vets the preface before dialing; nil accepts every dst.
+	guard *incomingGuard
+	// dialer reaches the backend (--backend-proxy); nil dials directly.
+	dialer support.BackendDialer
+	// pool fails over between several --local backends; nil dials dst.
+	pool *backendPool
+	// keepAlive keeps backend connections of httpAware streams for reuse
+	// (--backend-pool-size); nil dials one per stream.
+	keepAlive *keepAlivePool
+	// resume keeps interrupted GET responses of httpAware streams for the
+	// server to resume (--resume-get); nil disables it.
+	resume *resumeRegistry
+	// fallback answers httpAware streams whose backend cannot be dialed
+	// (--fallback-page); nil sends the server a setup error.
+	fallback *fallbackPage
+	// queue takes the requests of httpAware streams whose backend cannot
+	// be dialed for a later replay (--queue-requests); nil disables it.
+	queue *requestQueue
+	// inspect holds the response logging options of httpAware streams
+	// (--inspect-decode, --inspect-body-bytes); nil disables it.
+	inspect *atomic.Pointer[inspectOptions]
+	// peekBytes is the buffer budget of the HTTP-aware features above
+	// (--http-peek-bytes); 0 is defaultHTTPPeekBytes.
+	peekBytes int
+	// firstByteTimeout flags backends that send nothing for this long after
+	// the dial; timeoutClose or timeout503 also end the stream.
+	firstByteTimeout time.Duration
+	timeoutClose     bool
+	timeout503       bool
+	// rawPath and rawDst bridge WebSocket upgrades to rawPath on
+	// httpAware streams to rawDst (--raw-path, --raw-dst); "" disables it.
+	rawPath string
+	rawDst  string
+	// sources limits the requests per source of httpAware streams
+	// (--rate-limit-source); nil disables it.
+	sources *sourceLimiter
+	// hostRewrite replaces the Host header of httpAware streams' requests
+	// (--host-rewrite), keeping the original in X-Forwarded-Host with
+	// forwardedHost; empty disables it.
+	hostRewrite   string
+	forwardedHost bool
+	// forwardedFor adds the preface's src to the requests of httpAware
+	// streams as X-Forwarded-For, as the server's edge does for public
+	// connections (--local-mirror).
+	forwardedFor bool
+	// quota holds the byte limits of the streams (--max-bytes-per-stream,
+	// --max-bytes-total); nil is unlimited.
+	quota *byteQuota
+	// classes sorts the requests of httpAware streams into the traffic
+	// classes counted in processClasses (--classify); nil disables it.
+	classes *config.TrafficClassifier
+}
+
+func (s incomingStreamServer) dialBackend(dst string) (net.Conn, error) {
+	if s.dialer == nil {
+		return net.Dial("tcp", dst)
+	}
+	return s.dialer.DialContext(context.Background(), "tcp", dst)
+}
+
+// dialTarget dials the backend for dst and returns the address it reached.
+// Streams for the tunnel target go through the pool when one is configured,
+// trying each backend until one answers. Every attempt is reported.
+func (s incomingStreamServer) dialTarget(dst string, lg connLogger) (net.Conn, string, error) {
+	if !s.pool.serves(dst) {
+		bc, err := s.dialBackend(dst)
+		s.report(dst, err)
+		return bc, dst, err
+	}
+	var lastErr error
+	for _, target := range s.pool.candidates() {
+		bc, err := s.dialBackend(target)
+		s.report(target, err)
+		if err == nil {
+			s.pool.markUp(target)
+			return bc, target, nil
+		}
+		s.pool.markDown(target)
+		lg.Printf("backend %s unreachable: %v", target, err)
+		lastErr = err
+	}
+	return nil, dst, lastErr
+}
+
+// classify returns the traffic class of req with --classify.
+func (s incomingStreamServer) classify(req *http.Request) string {
+	if s.classes == nil {
+		return ""
+	}
+	return s.classes.Classify(req)
+}
+
+func (s incomingStreamServer) report(dst string, err error) {
+	if s.reporter != nil {
+		s.reporter(dst, err)
+	}
+	if err == nil && s.queue != nil {
+		// The backend is back: replay what was queued while it was down.
+		s.queue.kick()
+	}
+}
+
+// serve handles one stream; lifecycle log lines go through lg so they carry
+// the stream's correlation ID.
+func (s incomingStreamServer) serve(stream io.ReadWriteCloser, lg connLogger) (err error) {
 	defer stream.Close()
-	rd := bufio.NewReader(stream)
-	dst, err := readStreamDestination(rd)
+	trace := newStreamTrace(s.tunnelID)
+	trace.connID = lg.id
+	trace.role = roleIncoming
+	var bytesIn, bytesOut int64
+	if trace.enabled() {
+		defer func() { trace.finish(bytesIn, bytesOut, err) }()
+	}
+	// Only a traced, --raw-path, --rate-limit-source, --host-rewrite,
+	// --local-mirror, --resume-get or --classify HTTP stream peeks past the
+	// preface: its request heads must fit into the reader, which is sized to
+	// the peek budget.
+	rawAware := s.rawPath != "" && s.httpAware
+	gated := (s.sources != nil || s.hostRewrite != "" || s.forwardedFor) && s.httpAware
+	classified := s.classes != nil && s.httpAware
+	// Without room in --memory-budget for the peek buffer, the stream is
+	// served with a default-size reader and responses are not resumable.
+	rd, peeked, releasePeek := peekReader(stream, trace.enabled() && s.httpAware || rawAware || gated || s.resume != nil || classified, s.peekBytes)
+	defer releasePeek()
+	pre, err := readStreamPreface(rd)
 	if err != nil {
-		return err
+		return fmt.Errorf("stream preface: %w", err)
 	}
+	dst := pre["dst"]
 	if dst == "" {
 		return fmt.Errorf("stream preface missing or empty dst")
 	}
-	bc, err := net.Dial("tcp", dst)
+	if err := s.guard.check(pre); err != nil {
+		// Already reported by the guard; tell the server why and drop the stream.
+		writeSetupError(stream, err)
+		return nil
+	}
+	hops := prefaceHops(pre)
+	if err := checkHops(hops, dst); err != nil {
+		writeSetupError(stream, err)
+		return err
+	}
+	trace.dst = dst
+	backend := dst
+	// dst comes from the server; only its sanitized form is logged.
+	shown := support.SanitizeRemote(dst)
+	var fb *firstByteConn
+	if lg.id != "" {
+		started := time.Now()
+		lg.Printf("incoming stream from %s to %s", remoteAddrString(stream), shown)
+		defer func() {
+			firstByte := ""
+			if fb != nil && fb.firstByte() > 0 {
+				firstByte = " first_byte=" + fb.firstByte().Round(time.Millisecond).String()
+			}
+			if s.pool != nil {
+				lg.Printf("incoming stream to %s closed backend=%s in=%d out=%d duration=%s%s", shown, support.SanitizeRemote(backend), bytesIn, bytesOut, time.Since(started).Round(time.Millisecond), firstByte)
+				return
+			}
+			lg.Printf("incoming stream to %s closed in=%d out=%d duration=%s%s", shown, bytesIn, bytesOut, time.Since(started).Round(time.Millisecond), firstByte)
+		}()
+	}
+	defer track(&processFDs.streams)()
+	if err := processFDs.admit(); err != nil {
+		writeSetupError(stream, err)
+		return err
+	}
+	if err := s.quota.admit(); err != nil {
+		writeSetupError(stream, err)
+		return err
+	}
+	quota := s.quota.newStream()
+	defer quota.release()
+	if quota != nil && s.httpAware {
+		quota.reply = stream
+	}
+	processTraffic.streams.Add(1)
+	// Streams without a pooled backend connection count as one request of
+	// their first request's class; pooled ones count each request.
+	var class string
+	if classified {
+		begin := time.Now()
+		defer func() {
+			if class != "" {
+				processClasses.record(class, bytesIn+bytesOut, time.Since(begin))
+			}
+		}()
+	}
+	if _, ok := pre[protocolv1.PrefaceResumeOffset]; ok && s.resume != nil {
+		backend, bytesOut, err = s.serveResume(stream, pre, hops, quota, lg)
+		return err
+	}
+	// The request head only follows the ack, so a stream whose first request
+	// decides what to dial, or whether to dial at all, is acknowledged before
+	// the backend is known; failures are then answered with a 502.
+	acked := rawAware || gated
+	if acked {
+		if _, err := stream.Write([]byte(setupAckLine)); err != nil {
+			return err
+		}
+	}
+	var gate *requestGate
+	if gated {
+		gate = newRequestGate(rd, s.sources, lg)
+		if s.hostRewrite != "" {
+			gate.rewrite = func(head []byte) []byte { return rewriteHostHeader(head, s.hostRewrite, s.forwardedHost) }
+		}
+		if src := pre[protocolv1.PrefaceSrc]; s.forwardedFor && src != "" {
+			rewrite := gate.rewrite
+			gate.rewrite = func(head []byte) []byte {
+				if rewrite != nil {
+					head = rewrite(head)
+				}
+				return appendForwardedFor(head, src)
+			}
+		}
+		if refusal := gate.admitFirst(); refusal != nil {
+			_, err := stream.Write(refusal)
+			return err
+		}
+	}
+	if rawAware {
+		if req := s.rawUpgrade(rd); req != nil {
+			backend = s.rawDst
+			if classified {
+				class = s.classify(req)
+				trace.class = class
+			}
+			bytesIn, bytesOut, err = s.bridgeRaw(stream, rd, req, quota, lg)
+			return err
+		}
+	}
+	// Streams whose requests the gate or --raw-path look at keep a backend
+	// connection of their own.
+	if s.keepAlive != nil && !acked {
+		ka := &keepAliveStream{s: s, stream: stream, rd: rd, dst: dst, hops: hops, quota: quota, trace: &trace, lg: lg}
+		defer func() { backend, fb, bytesIn, bytesOut = ka.backend, ka.fb, ka.bytesIn, ka.bytesOut }()
+		return s.serveKeepAlive(ka)
+	}
+	conn, backend, err := s.dialTarget(dst, lg)
 	if err != nil {
-		if reporter != nil {
-			reporter(dst, err)
+		requests := rd
+		if gate != nil {
+			requests = bufio.NewReader(gate)
 		}
-		writeSetupError(stream, err)
+		s.failDial(stream, requests, acked, dst, backend, err, lg)
 		return err
 	}
-	defer bc.Close()
+	defer conn.Close()
+	defer track(&processFDs.localConns)()
+	defer localHops.track(conn, hops)()
+	fb = newFirstByteConn(conn, time.Now())
+	if trace.enabled() {
+		defer func() { trace.firstByte = fb.firstByte() }()
+	}
+	var bc net.Conn = fb
 
-	if reporter != nil {
-		reporter(dst, nil)
+	if !acked {
+		if _, err := stream.Write([]byte(setupAckLine)); err != nil {
+			return err
+		}
 	}
-	if _, err := stream.Write([]byte(setupAckLine)); err != nil {
-		return err
+	if classified {
+		class = classifyHead(s.classes, rd)
+		trace.class = class
 	}
 
-	if err := flushBufferedBytes(rd, bc); err != nil {
-		return err
+	// The response to a GET is kept when the stream fails before it ended,
+	// for the server to resume it on a new session. The head is peeked at
+	// before tracing rewrites it; a gated stream is not resumed.
+	var resumable *resumeTracker
+	if token := pre[protocolv1.PrefaceResume]; s.resume != nil && peeked && token != "" && gate == nil {
+		if resumable = newResumeTracker(rd, s.peekBytes); resumable != nil {
+			defer func() { s.keepInterrupted(token, backend, resumable, lg) }()
+		}
+	}
+
+	// A gated stream's requests, the first one's traceparent included, are
+	// forwarded by the gate as the bridge reads it.
+	var streamReader io.Reader = rd
+	if gate != nil {
+		if trace.enabled() {
+			gate.rewriteFirst = func(head []byte) []byte { return traceHTTPRequestHead(head, &trace) }
+		}
+		streamReader = gate
+		bc = &gatedBackend{Conn: bc, gate: gate}
+	}
+	if trace.enabled() && s.httpAware && gate == nil {
+		head, err := peekHTTPRequestHead(rd)
+		if errors.Is(err, errHTTPHeadTooLarge) {
+			lg.Printf("trace: request head exceeds the %d-byte peek budget (--http-peek-bytes), forwarding it without traceparent", rd.Size())
+		}
+		if head != nil {
+			n := len(head)
+			rewritten := traceHTTPRequestHead(head, &trace)
+			if _, err := rd.Discard(n); err != nil {
+				return err
+			}
+			if _, err := (quotaWriter{w: bc, q: quota}).Write(rewritten); err != nil {
+				return err
+			}
+			bytesIn += int64(n)
+			processTraffic.down.Add(int64(n))
+		}
 	}
-	return bridgeStreamAndBackend(stream, rd, bc)
+	if gate == nil {
+		bytesIn += int64(rd.Buffered())
+		processTraffic.down.Add(int64(rd.Buffered()))
+		if err := flushBufferedBytes(rd, quotaWriter{w: bc, q: quota}); err != nil {
+			return err
+		}
+	}
+	if s.httpAware && s.inspect != nil {
+		opts := s.inspect.Load()
+		if insp := newResponseInspector(opts.decode, opts.bodyBytes, s.peekBytes, lg); insp != nil {
+			defer insp.finish()
+			stream = inspectedStream{stream, insp}
+		}
+	}
+	if resumable != nil {
+		stream = resumeStream{stream, resumable}
+	}
+	defer fb.watch(s.firstByteTimeout, stream, support.SanitizeRemote(backend), s.timeoutClose, s.timeout503, lg)()
+	in, out, err := bridgeStreamAndBackendCounted(stream, streamReader, bc, quota)
+	bytesIn += in
+	bytesOut += out
+	return err
 }
 
 func bridgeStreamAndBackend(stream io.ReadWriteCloser, streamReader io.Reader, backendConn net.Conn) error {
-	errCh := make(chan error, 2)
+	_, _, err := bridgeStreamAndBackendCounted(stream, streamReader, backendConn, nil)
+	return err
+}
+
+// finWriteStall bounds how long a write to the stream may stay blocked once
+// the stream's peer has finished sending. A peer that closed its stream
+// discards what arrives and never opens the window again, so without it the
+// response copy would block for good and keep its backend connection open.
+const finWriteStall = 60 * time.Second
+
+// errPeerStoppedReading ends a bridge whose stream peer finished sending and
+// then stopped reading for finWriteStall.
+var errPeerStoppedReading = errors.New("stream peer closed and stopped reading the response")
+
+// bridgeStreamAndBackendCounted bridges both directions and reports the bytes
+// copied from the stream to the backend (in) and back (out). Both count
+// against quota; the direction that reaches a limit fails and ends the
+// bridge.
+func bridgeStreamAndBackendCounted(stream io.ReadWriteCloser, streamReader io.Reader, backendConn net.Conn, quota *streamQuota) (bytesIn, bytesOut int64, err error) {
+	return bridgeStreamAndBackendStall(stream, streamReader, backendConn, finWriteStall, quota)
+}
+
+// bridgeResult is how one copy direction of a bridge ended.
+type bridgeResult struct {
+	toStream bool
+	err      error
+}
+
+// bridgeStreamAndBackendStall is bridgeStreamAndBackendCounted with the
+// finWriteStall bound as a parameter. It returns only after both copy
+// goroutines have: a failed direction closes both ends, and so does a
+// response write stuck for writeStall after the stream's EOF.
+func bridgeStreamAndBackendStall(stream io.ReadWriteCloser, streamReader io.Reader, backendConn net.Conn, writeStall time.Duration, quota *streamQuota) (bytesIn, bytesOut int64, err error) {
+	results := make(chan bridgeResult, 2)
+	var closeOnce sync.Once
+	closeBoth := func() {
+		closeOnce.Do(func() {
+			_ = backendConn.Close()
+			_ = stream.Close()
+		})
+	}
+	var writing writeClock
 
 	go func() {
-		_, err := io.Copy(stream, backendConn)
+		defer track(&processServe.goroutines)()
+		defer support.RecoverAs(func(p *support.PanicError) { results <- bridgeResult{toStream: true, err: p} })
+		n, err := io.Copy(quotaWriter{countingWriter{throttledWriter{blockedWriter{timedWriter{stream, &writing}, &processStalls}, &processLimits.up}, &processTraffic.up}, quota, true}, backendConn)
+		bytesOut = n
 		// Propagate response EOF to the server-side proxy. Without this, HTTP/1.0
 		// responses without Content-Length can hang until client timeout.
 		closeWriteOrClose(stream)
-		if err != nil && !support.IsBenignCopyError(err) {
-			errCh <- err
-			return
-		}
-		errCh <- nil
+		results <- bridgeResult{toStream: true, err: err}
 	}()
 
 	go func() {
-		_, err := io.Copy(backendConn, streamReader)
+		defer track(&processServe.goroutines)()
+		defer support.RecoverAs(func(p *support.PanicError) { results <- bridgeResult{err: p} })
+		n, err := io.Copy(quotaWriter{countingWriter{throttledWriter{backendConn, &processLimits.down}, &processTraffic.down}, quota, false}, streamReader)
+		bytesIn = n
 		closeWriteIfPossible(backendConn)
-		if err != nil && !support.IsBenignCopyError(err) {
-			errCh <- err
-			return
-		}
-		errCh <- nil
+		results <- bridgeResult{err: err}
 	}()
 
-	first := <-errCh
-	second := <-errCh
-	if first != nil {
-		if second != nil && !support.IsBenignCopyError(second) {
-			log.Printf("bridgeStreamAndBackend secondary error: %v", second)
+	first := <-results
+	var second bridgeResult
+	if failedCopy(first.err) {
+		// A failed direction cannot finish cleanly; close both ends so the
+		// other copy returns instead of waiting for a FIN that never comes.
+		closeBoth()
+		second = <-results
+	} else {
+		var stalled bool
+		second, stalled = awaitResponseCopy(results, first.toStream, &writing, writeStall, closeBoth)
+		if stalled {
+			first.err = errPeerStoppedReading
+		}
+	}
+	if failedCopy(first.err) {
+		if failedCopy(second.err) {
+			log.Printf("bridgeStreamAndBackend secondary error: %v", second.err)
+		}
+		return bytesIn, bytesOut, first.err
+	}
+	if failedCopy(second.err) {
+		log.Printf("bridgeStreamAndBackend secondary error: %v", second.err)
+		return bytesIn, bytesOut, second.err
+	}
+	return bytesIn, bytesOut, nil
+}
+
+// awaitResponseCopy waits for the second result of a bridge whose first
+// direction ended cleanly. When the stream side finished first, a response
+// write blocked for writeStall means its peer is gone: closeBoth ends the
+// copy and stalled is set.
+func awaitResponseCopy(results <-chan bridgeResult, firstToStream bool, writing *writeClock, writeStall time.Duration, closeBoth func()) (second bridgeResult, stalled bool) {
+	if firstToStream || writeStall <= 0 {
+		return <-results, false
+	}
+	tick := time.NewTicker(max(writeStall/4, time.Millisecond))
+	defer tick.Stop()
+	for {
+		select {
+		case second = <-results:
+			return second, stalled
+		case now := <-tick.C:
+			if !stalled && writing.blockedFor(now) >= writeStall {
+				stalled = true
+				closeBoth()
+			}
 		}
-		return first
 	}
-	if second != nil && !support.IsBenignCopyError(second) {
-		log.Printf("bridgeStreamAndBackend secondary error: %v", second)
+}
+
+func failedCopy(err error) bool {
+	return err != nil && !support.IsBenignCopyError(err)
+}
+
+// writeClock records when the write in progress started.
+type writeClock struct {
+	since atomic.Int64 // unix nanoseconds, 0 between writes
+}
+
+// blockedFor is how long the write in progress has been blocked at now.
+func (c *writeClock) blockedFor(now time.Time) time.Duration {
+	since := c.since.Load()
+	if since == 0 {
+		return 0
 	}
-	return second
+	return now.Sub(time.Unix(0, since))
+}
+
+// timedWriter keeps c up to date with the writes to w.
+type timedWriter struct {
+	w io.Writer
+	c *writeClock
+}
+
+func (t timedWriter) Write(p []byte) (int, error) {
+	t.c.since.Store(time.Now().UnixNano())
+	defer t.c.since.Store(0)
+	return t.w.Write(p)
 }
 
 func closeWriteIfPossible(c interface{}) {
@@ -199,19 +746,47 @@ func flushBufferedBytes(rd *bufio.Reader, dst io.Writer) error {
 }
 
 func readStreamDestination(rd *bufio.Reader) (string, error) {
+	pre, err := readStreamPreface(rd)
+	if err != nil {
+		return "", err
+	}
+	return pre["dst"], nil
+}
+
+// errPrefaceTooLong is returned for a stream whose preface, with any blank
+// lines before it, exceeds maxPrefaceSize.
+var errPrefaceTooLong = fmt.Errorf("preface exceeds %d bytes", maxPrefaceSize)
+
+// readStreamPreface reads the first non-empty JSON line of a stream. It never
+// buffers more than maxPrefaceSize bytes, whatever the peer sends.
+func readStreamPreface(rd *bufio.Reader) (map[string]string, error) {
+	var line []byte
+	read := 0
 	for {
-		line, err := rd.ReadString('\n')
+		frag, err := rd.ReadSlice('\n')
+		read += len(frag)
+		if read > maxPrefaceSize {
+			return nil, errPrefaceTooLong
+		}
+		line = append(line, frag...)
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		line = strings.TrimSpace(line)
-		if line == "" {
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) == 0 {
+			line = line[:0]
 			continue
 		}
 		var pre map[string]string
-		if err := json.Unmarshal([]byte(line), &pre); err != nil {
-			return "", err
+		if err := json.Unmarshal(trimmed, &pre); err != nil {
+			return nil, err
+		}
+		if pre == nil {
+			return nil, errors.New("preface is not a JSON object")
 		}
-		return pre["dst"], nil
+		return pre, nil
 	}
 }
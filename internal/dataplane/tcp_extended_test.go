@@ -1,13 +1,14 @@
 // SPDX-License-Identifier: PROPRIETARY
 // Copyright (c) 2026 ForTunnels
 
-//go:build integration
-
 package dataplane
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net"
 	"strings"
@@ -19,99 +20,401 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/support"
 )
 
-func TestStartUDPLocalToStream_WithMocks(t *testing.T) {
-	// Test the UDP to stream forwarding logic
-	// This function starts a goroutine that reads from UDP and writes to stream
-	// We test that it handles errors correctly
-	writer := &mockWriter{
-		data: make([]byte, 0),
+// newMemManager returns a Manager whose sessions are in-memory pairs, with
+// fast backoff.
+func newMemManager(t *testing.T) (*Manager, *memDialer) {
+	t.Helper()
+	mgr := NewManager("http://example.com", "tunnel-123", "", 10*time.Millisecond, 40*time.Millisecond, e2eRuntime())
+	d := newMemDialer()
+	mgr.dial = d.dial
+	t.Cleanup(mgr.Close)
+	return mgr, d
+}
+
+// refusedAddr returns a local TCP address nothing listens on.
+func refusedAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	require.NoError(t, ln.Close())
+	return addr
+}
+
+// openIncoming opens a stream from the server end with a tcp preface to dst
+// and returns it with its setup reply line.
+func openIncoming(t *testing.T, server *memSession, dst string) (Stream, *bufio.Reader, string) {
+	t.Helper()
+	st, err := server.OpenStream()
+	require.NoError(t, err)
+	require.NoError(t, sendTCPPreface(st, dst, "tunnel-123"))
+	require.NoError(t, st.SetReadDeadline(time.Now().Add(5*time.Second)))
+	rd := bufio.NewReader(st)
+	line, err := rd.ReadString('\n')
+	require.NoError(t, err)
+	return st, rd, line
+}
+
+func TestManager_EnsureSession_Stopped(t *testing.T) {
+	mgr, d := newMemManager(t)
+	mgr.Close()
+
+	_, err := mgr.EnsureSession()
+	require.EqualError(t, err, "stopped")
+	assert.Zero(t, d.dialCount())
+}
+
+func TestManager_EnsureSession_BacksOffFailedDials(t *testing.T) {
+	mgr, d := newMemManager(t)
+	clock := support.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	mgr.clock = clock
+	d.errs = []error{errors.New("dial refused"), errors.New("dial refused"), errors.New("dial refused")}
+
+	type result struct {
+		sess Session
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		sess, err := mgr.EnsureSession()
+		done <- result{sess, err}
+	}()
+	// 10ms, 20ms, then the 40ms cap; no redial a moment before each ends.
+	for i, wait := range []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond} {
+		clock.BlockUntil(1)
+		clock.Advance(wait - time.Millisecond)
+		assert.Equal(t, i+1, d.dialCount())
+		clock.Advance(time.Millisecond)
 	}
+	var r result
+	select {
+	case r = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("EnsureSession did not return")
+	}
+	require.NoError(t, r.err)
+	assert.Equal(t, 4, d.dialCount())
+	assert.Equal(t, uint64(1), mgr.Generation())
 
-	// Create a UDP connection that will be closed immediately to trigger error
-	uc, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
-	require.NoError(t, err, "Failed to create UDP listener: %v")
+	again, err := mgr.EnsureSession()
+	require.NoError(t, err)
+	assert.Equal(t, r.sess, again, "a live session is reused")
+	assert.Equal(t, 4, d.dialCount())
+}
 
-	errCh := make(chan error, 1)
-	var lastSrcMu sync.RWMutex
-	var lastSrc *net.UDPAddr
+func TestManager_OpenStreamRedialsClosedSession(t *testing.T) {
+	mgr, d := newMemManager(t)
+	first, err := mgr.EnsureSession()
+	require.NoError(t, err)
+	require.NoError(t, first.Close())
+
+	st, err := mgr.OpenStream()
+	require.NoError(t, err)
+	defer st.Close()
+	assert.Equal(t, 2, d.dialCount())
+	_, err = d.nextServer(time.Second)
+	require.NoError(t, err)
+	server, err := d.nextServer(time.Second)
+	require.NoError(t, err)
+	peer, err := server.AcceptStream()
+	require.NoError(t, err)
+	defer peer.Close()
+}
+
+func TestServeIncoming_PrefaceRoundTrip(t *testing.T) {
+	mgr, d := newMemManager(t)
+	go func() { _ = serveIncomingWithManager(mgr, nil) }()
+	server, err := d.nextServer(5 * time.Second)
+	require.NoError(t, err)
+
+	st, rd, line := openIncoming(t, server, startTCPEchoBackend(t))
+	defer st.Close()
+	require.Equal(t, setupAckLine, line)
+	_, err = st.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, st.CloseWrite())
+	got, err := io.ReadAll(rd)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(got), "the echo arrives and the backend's FIN ends the stream")
+}
+
+func TestServeIncoming_RefusedBackendGetsSetupError(t *testing.T) {
+	mgr, d := newMemManager(t)
+	go func() { _ = serveIncomingWithManager(mgr, nil) }()
+	server, err := d.nextServer(5 * time.Second)
+	require.NoError(t, err)
+
+	st, _, line := openIncoming(t, server, refusedAddr(t))
+	defer st.Close()
+	var reply struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(line), &reply))
+	assert.False(t, reply.OK)
+	assert.Contains(t, reply.Error, "connection refused")
+}
+
+func TestServeIncoming_RedialsAfterAcceptFailure(t *testing.T) {
+	mgr, d := newMemManager(t)
+	go func() { _ = serveIncomingWithManager(mgr, nil) }()
+	first, err := d.nextServer(5 * time.Second)
+	require.NoError(t, err)
+
+	first.fail(errors.New("transport reset"))
+	second, err := d.nextServer(5 * time.Second)
+	require.NoError(t, err, "the accept loop should redial after the session failed")
+	assert.Equal(t, uint64(2), mgr.Generation())
+
+	st, rd, line := openIncoming(t, second, startTCPEchoBackend(t))
+	defer st.Close()
+	require.Equal(t, setupAckLine, line)
+	_, err = st.Write([]byte("again"))
+	require.NoError(t, err)
+	got := make([]byte, 5)
+	_, err = io.ReadFull(rd, got)
+	require.NoError(t, err)
+	assert.Equal(t, "again", string(got))
+}
+
+// TestServeIncoming_ParallelStreamErrors: failures of some streams leave the
+// others alone, each failed stream gets its own setup error, and their log
+// lines collapse into one plus a repeat count.
+func TestServeIncoming_ParallelStreamErrors(t *testing.T) {
+	const streams = 8
+	echo, refused := startTCPEchoBackend(t), refusedAddr(t)
+	var mu sync.Mutex
+	reports := map[string][]bool{}
+	reporter := func(dst string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		reports[dst] = append(reports[dst], err == nil)
+	}
+	mgr, d := newMemManager(t)
+	go func() { _ = serveIncomingWithManager(mgr, reporter) }()
+	server, err := d.nextServer(5 * time.Second)
+	require.NoError(t, err)
+
+	logs := captureLog(t)
+	key := support.LogKey(incomingStreamErrorFormat)
+	support.RepeatLogs.Transition(key, "test: reset")
+	logs.Reset()
+	gauge := processServe.goroutines.Load()
+
+	var wg sync.WaitGroup
+	replies := make([]string, streams)
+	for i := range streams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dst := echo
+			if i%2 == 0 {
+				dst = refused
+			}
+			st, err := server.OpenStream()
+			if err != nil {
+				replies[i] = err.Error()
+				return
+			}
+			defer st.Close()
+			_ = st.SetReadDeadline(time.Now().Add(5 * time.Second))
+			if err := sendTCPPreface(st, dst, "tunnel-123"); err != nil {
+				replies[i] = err.Error()
+				return
+			}
+			line, err := bufio.NewReader(st).ReadString('\n')
+			if err != nil {
+				replies[i] = err.Error()
+				return
+			}
+			replies[i] = line
+		}()
+	}
+	wg.Wait()
+	for i, reply := range replies {
+		if i%2 == 0 {
+			assert.Contains(t, reply, `"ok":false`, "stream %d", i)
+		} else {
+			assert.Equal(t, setupAckLine, reply, "stream %d", i)
+		}
+	}
+	mu.Lock()
+	assert.Equal(t, []bool{false, false, false, false}, reports[refused])
+	assert.Equal(t, []bool{true, true, true, true}, reports[echo])
+	mu.Unlock()
+
+	require.Eventually(t, func() bool { return processServe.goroutines.Load() <= gauge }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, strings.Count(logs.String(), "incoming stream error"), logs.String())
+	support.RepeatLogs.Transition(key, "test: done")
+	assert.Contains(t, logs.String(), "(repeated 3 times in the last")
+}
+
+func TestServeUDP_RoundTrip(t *testing.T) {
+	client, server := newMemSessionPair()
+	defer client.Close()
+	listen := freeUDPAddr(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serveUDP(ctx, client, "tunnel-123", "127.0.0.1:53", listen, e2eRuntime(), config.EncryptionSettings{})
+	}()
 
-	// Start the goroutine
-	startUDPLocalToStream(writer, uc, errCh, &lastSrcMu, &lastSrc)
+	st, err := server.AcceptStream()
+	require.NoError(t, err)
+	rd := bufio.NewReader(st)
+	pre, err := readStreamPreface(rd)
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:53", pre["dst"])
+	assert.Equal(t, "udp", pre["proto"])
+	assert.Equal(t, "tunnel-123", pre["tunnel_id"])
+	// The relay answers every datagram with its upper-case form.
+	go func() {
+		for {
+			pkt, err := readUDPPacket(rd)
+			if err != nil {
+				return
+			}
+			if err := writeUDPPacket(st, bytes.ToUpper(pkt)); err != nil {
+				return
+			}
+		}
+	}()
 
-	// Close immediately to trigger read error
-	uc.Close()
+	uc, err := net.Dial("udp", listen)
+	require.NoError(t, err)
+	defer uc.Close()
+	buf := make([]byte, 64)
+	require.Eventually(t, func() bool {
+		if _, err := uc.Write([]byte("query")); err != nil {
+			return false
+		}
+		_ = uc.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, err := uc.Read(buf)
+		return err == nil && string(buf[:n]) == "QUERY"
+	}, 5*time.Second, 10*time.Millisecond)
 
-	// Wait for error
+	cancel()
 	select {
-	case err := <-errCh:
-		require.Error(t, err, "startUDPLocalToStream() should return error when connection closes")
-	case <-time.After(500 * time.Millisecond):
-		// Timeout is acceptable - function may handle error differently
+	case err := <-done:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("serveUDP did not return after cancellation")
 	}
 }
 
-func TestStartStreamToUDPLocal_WithMocks(t *testing.T) {
-	// Test the stream to UDP forwarding logic
-	reader := &mockReader{
-		data: []byte{0, 5, 'h', 'e', 'l', 'l', 'o'}, // [len=5|"hello"]
+func TestServeUDP_OpenStreamFailure(t *testing.T) {
+	client, _ := newMemSessionPair()
+	client.failOpen(errors.New("stream limit reached"))
+	err := serveUDP(context.Background(), client, "tunnel-123", "127.0.0.1:53", freeUDPAddr(t), e2eRuntime(), config.EncryptionSettings{})
+	require.EqualError(t, err, "open stream: stream limit reached")
+}
+
+func TestServeUDP_StreamFailureEndsForwarding(t *testing.T) {
+	client, server := newMemSessionPair()
+	done := make(chan error, 1)
+	go func() {
+		done <- serveUDP(context.Background(), client, "tunnel-123", "127.0.0.1:53", freeUDPAddr(t), e2eRuntime(), config.EncryptionSettings{})
+	}()
+	_, err := server.AcceptStream()
+	require.NoError(t, err)
+
+	server.fail(errors.New("transport reset"))
+	select {
+	case err := <-done:
+		require.ErrorContains(t, err, "transport reset")
+	case <-time.After(5 * time.Second):
+		t.Fatal("serveUDP did not return after the session failed")
 	}
+}
 
-	uc, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
-	require.NoError(t, err, "Failed to create UDP listener: %v")
+func TestUDPForwarders_FrameBothDirections(t *testing.T) {
+	client, server := newMemSessionPair()
+	defer client.Close()
+	local, err := client.OpenStream()
+	require.NoError(t, err)
+	remote, err := server.AcceptStream()
+	require.NoError(t, err)
+	uc, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
 	defer uc.Close()
 
-	errCh := make(chan error, 1)
+	errCh := make(chan error, 2)
 	var lastSrcMu sync.RWMutex
-	lastSrc := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+	var lastSrc *net.UDPAddr
+	startUDPLocalToStream(local, uc, errCh, &lastSrcMu, &lastSrc)
+	startStreamToUDPLocal(local, uc, errCh, &lastSrcMu, &lastSrc)
 
-	// Start the goroutine
-	startStreamToUDPLocal(reader, uc, errCh, &lastSrcMu, &lastSrc)
+	peer, err := net.DialUDP("udp", nil, uc.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+	defer peer.Close()
+	_, err = peer.Write([]byte("ping"))
+	require.NoError(t, err)
+	require.NoError(t, remote.SetReadDeadline(time.Now().Add(5*time.Second)))
+	pkt, err := readUDPPacket(remote)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(pkt), "a datagram is framed onto the stream")
 
-	// Wait a bit for processing
-	time.Sleep(100 * time.Millisecond)
+	// Replies go to the last local source.
+	require.NoError(t, writeUDPPacket(remote, []byte("pong")))
+	require.NoError(t, peer.SetReadDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, 16)
+	n, err := peer.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "pong", string(buf[:n]))
 
-	// Check for errors
+	require.NoError(t, remote.Close())
 	select {
 	case err := <-errCh:
-		if err != nil && err != io.EOF {
-			t.Errorf("startStreamToUDPLocal() error = %v", err)
-		}
-	default:
-		// No error, which is good
+		require.ErrorIs(t, err, io.EOF)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the end of the stream was not reported")
 	}
 }
 
-func TestManager_EnsureSession_Stopped(t *testing.T) {
-	mgr := NewManager("http://example.com", "tunnel-123", "", time.Second, 30*time.Second, config.RuntimeSettings{})
-	mgr.Close()
+func TestProxyOverSession_HalfCloseGetsReply(t *testing.T) {
+	client, server := newMemSessionPair()
+	defer client.Close()
+	go func() {
+		st, err := server.AcceptStream()
+		if err != nil {
+			return
+		}
+		defer st.Close()
+		rd := bufio.NewReader(st)
+		if _, err := readStreamPreface(rd); err != nil {
+			return
+		}
+		req, _ := io.ReadAll(rd)
+		_, _ = st.Write(append([]byte("reply to "), req...))
+	}()
 
-	_, err := mgr.EnsureSession()
-	require.Error(t, err, "Manager.EnsureSession() should return error when stopped")
+	var stdout bytes.Buffer
+	err := proxyOverSession(client, "tunnel-123", "127.0.0.1:22", e2eRuntime(), config.EncryptionSettings{}, strings.NewReader("SSH-2.0"), &stdout)
+	require.NoError(t, err)
+	assert.Equal(t, "reply to SSH-2.0", stdout.String())
 }
 
-func TestManager_InitializeSession_Error(t *testing.T) {
-	// This tests the error path in initializeSession.
-	// EnsureSession() dials the server and retries with backoff, so run with a timeout
-	// to avoid hanging when the dial is slow or never fails.
-	mgr := NewManager("http://example.com", "tunnel-123", "", time.Second, 30*time.Second, config.RuntimeSettings{})
-
-	done := make(chan struct{})
-	var err error
+func TestProxyOverSession_SessionFailure(t *testing.T) {
+	client, server := newMemSessionPair()
 	go func() {
-		_, err = mgr.EnsureSession()
-		close(done)
+		if _, err := server.AcceptStream(); err == nil {
+			server.fail(errors.New("transport reset"))
+		}
 	}()
+	stdin, stdinW := io.Pipe()
+	defer stdinW.Close()
+	err := proxyOverSession(client, "tunnel-123", "127.0.0.1:22", e2eRuntime(), config.EncryptionSettings{}, stdin, io.Discard)
+	require.EqualError(t, err, "tunnel -> stdout: transport reset")
+}
 
-	select {
-	case <-done:
-		require.Error(t, err, "Manager.EnsureSession() should return error with invalid server")
-	case <-time.After(10 * time.Second):
-		// Do not call mgr.Close() here: EnsureSession holds the manager lock during
-		// dial and backoff sleep, so Close() would block until the goroutine returns.
-		t.Skip("EnsureSession did not return within 10s (dial may be slow or network unavailable)")
-	}
+func TestProxyOverSession_OpenFailure(t *testing.T) {
+	client, _ := newMemSessionPair()
+	client.failOpen(errors.New("stream limit reached"))
+	err := proxyOverSession(client, "tunnel-123", "127.0.0.1:22", e2eRuntime(), config.EncryptionSettings{}, strings.NewReader("x"), io.Discard)
+	require.EqualError(t, err, "open stream: stream limit reached")
 }
 
 func TestReadStreamDestination_EdgeCases(t *testing.T) {
@@ -178,7 +481,7 @@ func TestSendUDPPreface_EdgeCases(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			writer := &mockWriter{}
-			err := sendUDPPreface(writer, tt.dst, tt.tunnelID)
+			err := sendUDPPreface(writer, tt.dst, tt.tunnelID, "", config.EncryptionSettings{})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("sendUDPPreface() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -262,6 +565,3 @@ func TestReadUDPPacket_EdgeCases(t *testing.T) {
 		})
 	}
 }
-
-// mockWriter and mockReader are defined in udp_test.go
-// We need to reference them here
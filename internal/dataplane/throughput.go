@@ -0,0 +1,234 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fortunnels/client/internal/support"
+)
+
+// throughputWindow is how many 1s samples the sampler keeps (one minute).
+const throughputWindow = 60
+
+// TrafficCounter counts data-plane payload bytes while they are copied, so
+// throughput can be sampled without waiting for streams to close. Up is
+// toward the server, down is from the server.
+type TrafficCounter struct {
+	up   atomic.Int64
+	down atomic.Int64
+	// streams counts the streams served: incoming and --listen ones.
+	streams atomic.Int64
+	// limited counts the requests --rate-limit-source answered with 429.
+	limited atomic.Int64
+}
+
+// Totals returns the bytes counted so far in each direction.
+func (c *TrafficCounter) Totals() (up, down int64) {
+	return c.up.Load(), c.down.Load()
+}
+
+// Streams returns how many streams were served so far.
+func (c *TrafficCounter) Streams() int64 {
+	return c.streams.Load()
+}
+
+// Limited returns how many requests --rate-limit-source refused so far.
+func (c *TrafficCounter) Limited() int64 {
+	return c.limited.Load()
+}
+
+// processTraffic counts every serving-mode stream of this process; a client
+// process serves a single tunnel, so it is the per-tunnel counter.
+var processTraffic TrafficCounter
+
+// Traffic returns the live byte counter of the serving modes.
+func Traffic() *TrafficCounter {
+	return &processTraffic
+}
+
+// countingWriter adds every written byte to n.
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (cw countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n.Add(int64(n))
+	return n, err
+}
+
+// throughputSample is one interval's rate in bytes per second.
+type throughputSample struct {
+	up   float64
+	down float64
+}
+
+// throughputRing keeps the last throughputWindow samples in a fixed array.
+type throughputRing struct {
+	buf  [throughputWindow]throughputSample
+	next int
+	n    int
+}
+
+func (r *throughputRing) push(s throughputSample) {
+	r.buf[r.next] = s
+	r.next = (r.next + 1) % len(r.buf)
+	if r.n < len(r.buf) {
+		r.n++
+	}
+}
+
+// last returns the newest sample, or zero when empty.
+func (r *throughputRing) last() throughputSample {
+	if r.n == 0 {
+		return throughputSample{}
+	}
+	return r.buf[(r.next-1+len(r.buf))%len(r.buf)]
+}
+
+// totals appends up+down of every sample, oldest first, to dst.
+func (r *throughputRing) totals(dst []float64) []float64 {
+	start := (r.next - r.n + len(r.buf)) % len(r.buf)
+	for i := range r.n {
+		s := r.buf[(start+i)%len(r.buf)]
+		dst = append(dst, s.up+s.down)
+	}
+	return dst
+}
+
+// sparkBlocks are the sparkline levels; zero always maps to the lowest one
+// and any traffic to at least the second, so trickles stay visible.
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline renders values scaled to their maximum.
+func sparkline(values []float64) string {
+	peak := 0.0
+	for _, v := range values {
+		peak = max(peak, v)
+	}
+	var b strings.Builder
+	b.Grow(len(values) * len(string(sparkBlocks[0])))
+	top := len(sparkBlocks) - 1
+	for _, v := range values {
+		level := 0
+		if v > 0 && peak > 0 {
+			level = max(1, int(math.Ceil(v/peak*float64(top))))
+		}
+		b.WriteRune(sparkBlocks[level])
+	}
+	return b.String()
+}
+
+// formatRate renders bytes per second with a binary unit prefix.
+func formatRate(bps float64) string {
+	units := []string{"B/s", "KiB/s", "MiB/s", "GiB/s"}
+	i := 0
+	for bps >= 1024 && i < len(units)-1 {
+		bps /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", bps, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", bps, units[i])
+}
+
+// ThroughputSampler turns a TrafficCounter into per-second rates and keeps a
+// one-minute history for the status line.
+type ThroughputSampler struct {
+	counter *TrafficCounter
+	badge   func() string
+
+	mu       sync.Mutex
+	ring     throughputRing
+	prevUp   int64
+	prevDown int64
+	prevAt   time.Time
+	scratch  []float64
+}
+
+// NewThroughputSampler starts sampling counter from its current totals.
+func NewThroughputSampler(counter *TrafficCounter, now time.Time) *ThroughputSampler {
+	up, down := counter.Totals()
+	return &ThroughputSampler{
+		counter:  counter,
+		prevUp:   up,
+		prevDown: down,
+		prevAt:   now,
+		scratch:  make([]float64, 0, throughputWindow),
+	}
+}
+
+// WithBadge puts what badge returns in front of every rendered line, e.g.
+// the stream encryption marker; an empty badge adds nothing.
+func (s *ThroughputSampler) WithBadge(badge func() string) *ThroughputSampler {
+	s.badge = badge
+	return s
+}
+
+// Sample records the rate since the previous sample. It does not allocate.
+func (s *ThroughputSampler) Sample(now time.Time) {
+	up, down := s.counter.Totals()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elapsed := now.Sub(s.prevAt).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	s.ring.push(throughputSample{
+		up:   float64(up-s.prevUp) / elapsed,
+		down: float64(down-s.prevDown) / elapsed,
+	})
+	s.prevUp, s.prevDown, s.prevAt = up, down, now
+}
+
+// Current returns the latest up and down rates in bytes per second.
+func (s *ThroughputSampler) Current() (up, down float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last := s.ring.last()
+	return last.up, last.down
+}
+
+// Render returns the status line: a sparkline of total throughput over the
+// window followed by the current rates.
+func (s *ThroughputSampler) Render() string {
+	s.mu.Lock()
+	s.scratch = s.ring.totals(s.scratch[:0])
+	spark := sparkline(s.scratch)
+	last := s.ring.last()
+	s.mu.Unlock()
+	line := fmt.Sprintf("%s ↑ %s ↓ %s", spark, formatRate(last.up), formatRate(last.down))
+	if s.badge != nil {
+		if badge := s.badge(); badge != "" {
+			line = badge + " " + line
+		}
+	}
+	return line
+}
+
+// RunStatusLine samples every interval and shows the rendered line as r's
+// progress line until stop is closed.
+func (s *ThroughputSampler) RunStatusLine(r support.Reporter, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			r.Progress("")
+			return
+		case now := <-ticker.C:
+			s.Sample(now)
+			r.Progress(s.Render())
+		}
+	}
+}
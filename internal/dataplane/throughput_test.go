@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSparkline(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   string
+	}{
+		{"empty", nil, ""},
+		{"all zero", []float64{0, 0, 0, 0}, "▁▁▁▁"},
+		{"single spike", []float64{0, 0, 5000, 0, 0}, "▁▁█▁▁"},
+		{"ramp", []float64{0, 1, 2, 3, 4, 5, 6, 7}, "▁▂▃▄▅▆▇█"},
+		{"trickle stays visible", []float64{1, 1e6}, "▂█"},
+		{"flat traffic", []float64{42, 42, 42}, "███"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, sparkline(tt.values))
+		})
+	}
+}
+
+func TestThroughputRing(t *testing.T) {
+	var r throughputRing
+	assert.Empty(t, r.totals(nil))
+	assert.Equal(t, throughputSample{}, r.last())
+
+	for i := range throughputWindow + 5 {
+		r.push(throughputSample{up: float64(i), down: 1})
+	}
+	got := r.totals(nil)
+	require.Len(t, got, throughputWindow, "ring keeps only the window")
+	assert.Equal(t, float64(5+1), got[0], "oldest samples are overwritten")
+	assert.Equal(t, float64(throughputWindow+4+1), got[len(got)-1])
+	assert.Equal(t, throughputSample{up: float64(throughputWindow + 4), down: 1}, r.last())
+}
+
+func TestFormatRate(t *testing.T) {
+	assert.Equal(t, "0 B/s", formatRate(0))
+	assert.Equal(t, "512 B/s", formatRate(512))
+	assert.Equal(t, "1.5 KiB/s", formatRate(1536))
+	assert.Equal(t, "3.0 MiB/s", formatRate(3*1024*1024))
+}
+
+func TestThroughputSampler_Rates(t *testing.T) {
+	var c TrafficCounter
+	start := time.Unix(1000, 0)
+	s := NewThroughputSampler(&c, start)
+
+	c.up.Add(2048)
+	c.down.Add(512)
+	s.Sample(start.Add(2 * time.Second))
+	up, down := s.Current()
+	assert.InDelta(t, 1024, up, 0.01)
+	assert.InDelta(t, 256, down, 0.01)
+
+	s.Sample(start.Add(3 * time.Second))
+	up, down = s.Current()
+	assert.Zero(t, up)
+	assert.Zero(t, down)
+	assert.Equal(t, "█▁ ↑ 0 B/s ↓ 0 B/s", s.Render())
+
+	s.Sample(start.Add(3 * time.Second)) // no time elapsed: ignored
+	assert.Equal(t, 2, utf8.RuneCountInString(strings.Fields(s.Render())[0]))
+}
+
+func TestThroughputSampler_SampleDoesNotAllocate(t *testing.T) {
+	var c TrafficCounter
+	now := time.Unix(0, 0)
+	s := NewThroughputSampler(&c, now)
+	allocs := testing.AllocsPerRun(200, func() {
+		c.up.Add(100)
+		now = now.Add(time.Second)
+		s.Sample(now)
+	})
+	assert.Zero(t, allocs)
+}
+
+func TestBridge_CountsLiveTraffic(t *testing.T) {
+	up0, down0 := Traffic().Totals()
+	backendLocal, backendRemote := net.Pipe()
+	stream := &mockTCPStream{readData: []byte("request")}
+	go func() {
+		buf := make([]byte, len("request"))
+		_, _ = backendRemote.Read(buf)
+		_, _ = backendRemote.Write([]byte("response!"))
+		backendRemote.Close()
+	}()
+	_, _, err := bridgeStreamAndBackendCounted(stream, bytes.NewReader([]byte("request")), backendLocal, nil)
+	require.NoError(t, err)
+	up, down := Traffic().Totals()
+	assert.Equal(t, int64(len("response!")), up-up0)
+	assert.Equal(t, int64(len("request")), down-down0)
+}
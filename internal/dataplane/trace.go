@@ -0,0 +1,180 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/fortunnels/client/internal/telemetry"
+)
+
+const traceparentHeader = "traceparent"
+
+// streamTrace collects span data for one tunneled stream. With the no-op tracer
+// it stays disabled and records nothing, so untraced streams pay no allocations.
+type streamTrace struct {
+	tracer   telemetry.Tracer
+	span     telemetry.Span
+	begin    time.Time
+	tunnelID string
+	connID   string
+	dst      string
+	// firstByte is the backend's first-byte latency; 0 when none arrived.
+	firstByte time.Duration
+	// class is the --classify traffic class of the stream's first request.
+	class string
+	// role tells the two directions apart: roleIncoming for streams the
+	// server opened, roleListen for connections accepted on --listen.
+	role string
+}
+
+const (
+	roleIncoming = "incoming"
+	roleListen   = "listen"
+)
+
+func newStreamTrace(tunnelID string) streamTrace {
+	tr := telemetry.Current()
+	if !tr.Enabled() {
+		return streamTrace{}
+	}
+	return streamTrace{tracer: tr, begin: time.Now(), tunnelID: tunnelID}
+}
+
+func (st *streamTrace) enabled() bool { return st.tracer != nil }
+
+// start opens the span with the given parent; it is a no-op once started.
+func (st *streamTrace) start(parent telemetry.SpanContext) telemetry.Span {
+	if st.span == nil {
+		st.span = st.tracer.Start("tunnel.stream", parent, st.begin)
+	}
+	return st.span
+}
+
+func (st *streamTrace) finish(bytesIn, bytesOut int64, err error) {
+	if !st.enabled() {
+		return
+	}
+	span := st.start(telemetry.SpanContext{})
+	if st.tunnelID != "" {
+		span.SetString("tunnel_id", st.tunnelID)
+	}
+	if st.connID != "" {
+		span.SetString("conn_id", st.connID)
+	}
+	if st.dst != "" {
+		span.SetString("dst", st.dst)
+	}
+	if st.class != "" {
+		span.SetString("traffic_class", st.class)
+	}
+	if st.role != "" {
+		span.SetString("role", st.role)
+	}
+	span.SetInt("bytes_in", bytesIn)
+	span.SetInt("bytes_out", bytesOut)
+	span.SetInt("duration_ms", time.Since(st.begin).Milliseconds())
+	if st.firstByte > 0 {
+		span.SetInt("first_byte_ms", st.firstByte.Milliseconds())
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetString("error", err.Error())
+	}
+	span.End()
+}
+
+var httpMethodPrefixes = []string{"GET ", "POST ", "PUT ", "HEAD ", "DELETE ", "PATCH ", "OPTIONS ", "TRACE ", "CONNECT "}
+
+// errHTTPHeadTooLarge is returned when an HTTP head does not fit into the
+// --http-peek-bytes budget; the caller then streams it untouched.
+var errHTTPHeadTooLarge = errors.New("HTTP head exceeds the peek budget")
+
+// peekHTTPRequestHead returns the buffered HTTP/1.x request head (including
+// the terminating blank line) without consuming it. It gives up, returning
+// nil, when the stream does not start with an HTTP method, and returns
+// errHTTPHeadTooLarge when the head does not fit into the reader's buffer.
+func peekHTTPRequestHead(rd *bufio.Reader) ([]byte, error) {
+	first, err := rd.Peek(1)
+	if err != nil || !isHTTPMethodStart(first[0]) {
+		return nil, nil
+	}
+	return peekHTTPHead(rd, hasHTTPMethodPrefix)
+}
+
+// peekHTTPHead peeks at rd until the blank line ending an HTTP head, within
+// rd's buffer. valid rejects a stream from its first 8 bytes.
+func peekHTTPHead(rd *bufio.Reader, valid func([]byte) bool) ([]byte, error) {
+	if _, err := rd.Peek(1); err != nil {
+		return nil, nil
+	}
+	for n := rd.Buffered(); ; n = rd.Buffered() + 1 {
+		if n > rd.Size() {
+			return nil, errHTTPHeadTooLarge
+		}
+		buf, err := rd.Peek(n)
+		if err != nil {
+			return nil, nil
+		}
+		if len(buf) >= 8 && !valid(buf) {
+			return nil, nil
+		}
+		if i := bytes.Index(buf, []byte("\r\n\r\n")); i >= 0 {
+			return buf[:i+4], nil
+		}
+	}
+}
+
+func isHTTPMethodStart(b byte) bool {
+	for _, m := range httpMethodPrefixes {
+		if m[0] == b {
+			return true
+		}
+	}
+	return false
+}
+
+func hasHTTPMethodPrefix(buf []byte) bool {
+	for _, m := range httpMethodPrefixes {
+		if bytes.HasPrefix(buf, []byte(m)) {
+			return true
+		}
+	}
+	return false
+}
+
+// traceHTTPRequestHead joins the span to the caller's trace (incoming
+// traceparent header) and returns the head with traceparent rewritten to point
+// at the tunnel span, so the local backend continues the same trace.
+func traceHTTPRequestHead(head []byte, st *streamTrace) []byte {
+	lines := strings.Split(strings.TrimSuffix(string(head), "\r\n\r\n"), "\r\n")
+	var parent telemetry.SpanContext
+	kept := lines[:1]
+	for _, line := range lines[1:] {
+		name, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), traceparentHeader) {
+			if sc, valid := telemetry.ParseTraceparent(value); valid {
+				parent = sc
+			}
+			continue
+		}
+		kept = append(kept, line)
+	}
+	span := st.start(parent)
+	var b strings.Builder
+	b.Grow(len(head) + 64)
+	for _, line := range kept {
+		b.WriteString(line)
+		b.WriteString("\r\n")
+	}
+	b.WriteString(traceparentHeader)
+	b.WriteString(": ")
+	b.WriteString(span.Context().Traceparent())
+	b.WriteString("\r\n\r\n")
+	return []byte(b.String())
+}
@@ -0,0 +1,216 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+//go:build integration
+
+package dataplane
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/telemetry"
+	"github.com/fortunnels/client/internal/testsupport"
+)
+
+// TestIncomingStream_ExportsSpanToOTLPCollector runs an HTTP request through a
+// traced stream and checks the span reaches an OTLP/HTTP test collector and
+// joins the caller's trace.
+func TestIncomingStream_ExportsSpanToOTLPCollector(t *testing.T) {
+	tracer, exportedSpans := startOTLPCollector(t)
+
+	backendHeaders := make(chan http.Header, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendHeaders <- r.Header.Clone()
+		w.Header().Set("Connection", "close")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+	dst := strings.TrimPrefix(backend.URL, "http://")
+
+	clientSide, serverSide := net.Pipe()
+	defer serverSide.Close()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- incomingStreamServer{tunnelID: "tunnel-otel", httpAware: true}.serve(clientSide, newConnLogger())
+	}()
+
+	const callerTrace = "4bf92f3577b34da6a3ce929d0e0e4736"
+	preface := `{"dst": "` + dst + `", "proto": "tcp"}` + "\n"
+	_, err := serverSide.Write([]byte(preface))
+	require.NoError(t, err)
+	rd := bufio.NewReader(serverSide)
+	ack, err := rd.ReadString('\n')
+	require.NoError(t, err)
+	require.Contains(t, ack, `"ok":true`)
+
+	req := "GET / HTTP/1.1\r\nHost: test.local\r\nConnection: close\r\ntraceparent: 00-" + callerTrace + "-00f067aa0ba902b7-01\r\n\r\n"
+	_, err = serverSide.Write([]byte(req))
+	require.NoError(t, err)
+
+	require.NoError(t, serverSide.SetReadDeadline(time.Now().Add(5*time.Second)))
+	resp, err := io.ReadAll(rd)
+	require.NoError(t, err)
+	require.Contains(t, string(resp), "ok")
+
+	select {
+	case h := <-backendHeaders:
+		_, ok := telemetry.ParseTraceparent(h.Get("traceparent"))
+		require.True(t, ok, "backend should receive a traceparent")
+		parts := strings.Split(h.Get("traceparent"), "-")
+		assert.Equal(t, callerTrace, parts[1])
+		assert.NotEqual(t, "00f067aa0ba902b7", parts[2])
+	case <-time.After(5 * time.Second):
+		t.Fatal("backend did not receive the request")
+	}
+	select {
+	case err := <-errCh:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream did not finish")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, tracer.Shutdown(ctx))
+
+	spans := exportedSpans()
+	require.NotEmpty(t, spans)
+	span := spans[0]
+	assert.Equal(t, "tunnel.stream", span.Name)
+	assert.Equal(t, callerTrace, span.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", span.ParentSpanID)
+	assert.Subset(t, span.keys(), []string{"tunnel_id", "dst", "bytes_in", "bytes_out", "duration_ms"})
+	assert.Equal(t, roleIncoming, span.attr("role"))
+}
+
+// TestListenConnection_ExportsSpanToOTLPCollector checks a connection
+// accepted on --listen is traced like a stream the server opened.
+func TestListenConnection_ExportsSpanToOTLPCollector(t *testing.T) {
+	captureLog(t)
+	_, exportedSpans := startOTLPCollector(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	tun := stub.AddTunnel("tcp", "127.0.0.1:0")
+	rt := e2eRuntime()
+	mgr := NewManager(stub.URL, tun.ID, "", 10*time.Millisecond, 50*time.Millisecond, rt)
+	defer mgr.Close()
+	go func() {
+		_ = serveListener(ln, mgr, newListenForwarder(tun.ID, testsupport.EchoDst, rt, config.EncryptionSettings{}))
+	}()
+
+	c, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	_, err = c.Write([]byte("ping"))
+	require.NoError(t, err)
+	got := make([]byte, 4)
+	_, err = io.ReadFull(c, got)
+	require.NoError(t, err)
+	require.NoError(t, c.Close())
+
+	// The stub session's tunnel.session.connect span is exported too.
+	var span exportedSpan
+	require.Eventually(t, func() bool {
+		for _, s := range exportedSpans() {
+			if s.Name == "tunnel.stream" {
+				span = s
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 50*time.Millisecond, "the listen connection should end in an exported span")
+	assert.Equal(t, roleListen, span.attr("role"))
+	assert.Equal(t, tun.ID, span.attr("tunnel_id"))
+	assert.Equal(t, testsupport.EchoDst, span.attr("dst"))
+	assert.Subset(t, span.keys(), []string{"conn_id", "bytes_in", "bytes_out", "duration_ms"})
+}
+
+// exportedSpan is a span as the OTLP/HTTP JSON exporter sends it.
+type exportedSpan struct {
+	Name         string `json:"name"`
+	TraceID      string `json:"traceId"`
+	ParentSpanID string `json:"parentSpanId"`
+	Attributes   []struct {
+		Key   string `json:"key"`
+		Value struct {
+			StringValue string `json:"stringValue"`
+		} `json:"value"`
+	} `json:"attributes"`
+}
+
+func (s exportedSpan) keys() []string {
+	keys := make([]string, 0, len(s.Attributes))
+	for _, a := range s.Attributes {
+		keys = append(keys, a.Key)
+	}
+	return keys
+}
+
+// attr returns the string value of attribute key, or "" when it is missing.
+func (s exportedSpan) attr(key string) string {
+	for _, a := range s.Attributes {
+		if a.Key == key {
+			return a.Value.StringValue
+		}
+	}
+	return ""
+}
+
+// startOTLPCollector installs an OTLP tracer exporting to a test collector
+// for the rest of the test. The returned func lists the spans the collector
+// received so far; the tracer exports them periodically and on Shutdown.
+func startOTLPCollector(t *testing.T) (*telemetry.OTLPTracer, func() []exportedSpan) {
+	t.Helper()
+	var mu sync.Mutex
+	var bodies [][]byte
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, b)
+		mu.Unlock()
+	}))
+	t.Cleanup(collector.Close)
+	tracer, err := telemetry.NewOTLPTracer(collector.URL)
+	require.NoError(t, err)
+	telemetry.SetTracer(tracer)
+	t.Cleanup(func() { telemetry.SetTracer(nil) })
+
+	return tracer, func() []exportedSpan {
+		t.Helper()
+		mu.Lock()
+		defer mu.Unlock()
+		var spans []exportedSpan
+		for _, body := range bodies {
+			var export struct {
+				ResourceSpans []struct {
+					ScopeSpans []struct {
+						Spans []exportedSpan `json:"spans"`
+					} `json:"scopeSpans"`
+				} `json:"resourceSpans"`
+			}
+			require.NoError(t, json.Unmarshal(body, &export))
+			for _, rs := range export.ResourceSpans {
+				for _, ss := range rs.ScopeSpans {
+					spans = append(spans, ss.Spans...)
+				}
+			}
+		}
+		return spans
+	}
+}
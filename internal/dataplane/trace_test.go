@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bufio"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/telemetry"
+)
+
+func TestPeekHTTPRequestHead(t *testing.T) {
+	req := "GET / HTTP/1.1\r\nHost: x\r\n\r\nbody"
+	rd := bufio.NewReader(strings.NewReader(req))
+	head, err := peekHTTPRequestHead(rd)
+	require.NoError(t, err)
+	require.Equal(t, "GET / HTTP/1.1\r\nHost: x\r\n\r\n", string(head))
+	assert.Equal(t, len(req), rd.Buffered(), "peek must not consume data")
+
+	rd = bufio.NewReader(strings.NewReader("SSH-2.0-OpenSSH\r\n"))
+	head, err = peekHTTPRequestHead(rd)
+	assert.Nil(t, head)
+	assert.NoError(t, err)
+
+	rd = bufio.NewReader(strings.NewReader("GARBAGE-DATA-THAT-STARTS-WITH-G"))
+	head, err = peekHTTPRequestHead(rd)
+	assert.Nil(t, head)
+	assert.NoError(t, err)
+
+	huge := "GET / HTTP/1.1\r\nX: " + strings.Repeat("a", 8192) + "\r\n\r\n"
+	rd = bufio.NewReader(strings.NewReader(huge))
+	head, err = peekHTTPRequestHead(rd)
+	assert.Nil(t, head, "heads larger than the buffer are passed through untouched")
+	assert.ErrorIs(t, err, errHTTPHeadTooLarge)
+
+	rd = bufio.NewReaderSize(strings.NewReader(huge), 16<<10)
+	head, err = peekHTTPRequestHead(rd)
+	require.NoError(t, err)
+	assert.Equal(t, huge, string(head), "a larger peek budget fits the head")
+}
+
+func TestTraceHTTPRequestHead_ReplacesTraceparent(t *testing.T) {
+	telemetry.SetTracer(&recordingTracer{})
+	defer telemetry.SetTracer(nil)
+
+	trace := newStreamTrace("tunnel-1")
+	head := "GET / HTTP/1.1\r\nHost: x\r\nTraceParent: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01\r\n\r\n"
+	out := string(traceHTTPRequestHead([]byte(head), &trace))
+
+	assert.True(t, strings.HasPrefix(out, "GET / HTTP/1.1\r\nHost: x\r\ntraceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-"))
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\n"))
+	assert.Equal(t, 1, strings.Count(strings.ToLower(out), "traceparent"))
+	assert.NotContains(t, out, "00f067aa0ba902b7", "backend sees the tunnel span as parent")
+}
+
+func TestStreamTrace_NoopZeroAllocs(t *testing.T) {
+	telemetry.SetTracer(nil)
+	errDial := errors.New("dial")
+	allocs := testing.AllocsPerRun(100, func() {
+		trace := newStreamTrace("tunnel-1")
+		trace.dst = "127.0.0.1:80"
+		trace.finish(10, 20, errDial)
+	})
+	assert.Zero(t, allocs)
+}
+
+func BenchmarkStreamTraceNoop(b *testing.B) {
+	telemetry.SetTracer(nil)
+	b.ReportAllocs()
+	for b.Loop() {
+		trace := newStreamTrace("tunnel-1")
+		trace.finish(10, 20, nil)
+	}
+}
+
+// recordingTracer is a minimal in-memory tracer for assertions.
+type recordingTracer struct {
+	telemetry.Tracer
+}
+
+func (*recordingTracer) Enabled() bool { return true }
+
+func (*recordingTracer) Start(_ string, parent telemetry.SpanContext, _ time.Time) telemetry.Span {
+	sc := parent
+	sc.SpanID = [8]byte{1, 2, 3, 4, 5, 6, 7, 8}
+	if !parent.IsValid() {
+		sc.TraceID = [16]byte{9}
+	}
+	return &recordingSpan{sc: sc}
+}
+
+type recordingSpan struct {
+	telemetry.Span
+	sc telemetry.SpanContext
+}
+
+func (s *recordingSpan) Context() telemetry.SpanContext { return s.sc }
@@ -0,0 +1,127 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fortunnels/client/internal/config"
+)
+
+// processClasses counts the traffic of every --classify tunnel in this
+// process by class.
+var processClasses = newTrafficClassCounters()
+
+// TrafficClassStats is what one --classify traffic class carried: its
+// requests (streams, for config.TrafficClassOpaque), their bytes in both
+// directions and how long they took in total.
+type TrafficClassStats struct {
+	Class    string
+	Requests int64
+	Bytes    int64
+	Duration time.Duration
+}
+
+// Mean is the mean duration of the class's requests.
+func (s TrafficClassStats) Mean() time.Duration {
+	if s.Requests == 0 {
+		return 0
+	}
+	return s.Duration / time.Duration(s.Requests)
+}
+
+type trafficClassCounters struct {
+	mu      sync.Mutex
+	classes map[string]*TrafficClassStats
+}
+
+func newTrafficClassCounters() *trafficClassCounters {
+	return &trafficClassCounters{classes: make(map[string]*TrafficClassStats)}
+}
+
+func (c *trafficClassCounters) record(class string, bytes int64, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.classes[class]
+	if s == nil {
+		s = &TrafficClassStats{Class: class}
+		c.classes[class] = s
+	}
+	s.Requests++
+	s.Bytes += bytes
+	s.Duration += d
+}
+
+// snapshot returns the classes by descending bytes.
+func (c *trafficClassCounters) snapshot() []TrafficClassStats {
+	c.mu.Lock()
+	out := make([]TrafficClassStats, 0, len(c.classes))
+	for _, s := range c.classes {
+		out = append(out, *s)
+	}
+	c.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Bytes != out[j].Bytes {
+			return out[i].Bytes > out[j].Bytes
+		}
+		return out[i].Class < out[j].Class
+	})
+	return out
+}
+
+// TrafficClasses returns the per-class counters of --classify so far, by
+// descending bytes; empty when nothing was classified.
+func TrafficClasses() []TrafficClassStats {
+	return processClasses.snapshot()
+}
+
+// WriteTrafficClassSummary writes the --classify breakdown, as part of the
+// shutdown summary; nothing when nothing was classified.
+func WriteTrafficClassSummary(w io.Writer) {
+	classes := processClasses.snapshot()
+	if len(classes) == 0 {
+		return
+	}
+	var total int64
+	for _, s := range classes {
+		total += s.Bytes
+	}
+	fmt.Fprintf(w, "\n🧮 Traffic by class (--classify):\n")
+	for _, s := range classes {
+		unit := "requests"
+		if s.Class == config.TrafficClassOpaque {
+			unit = "streams"
+		}
+		share := 0.0
+		if total > 0 {
+			share = float64(s.Bytes) * 100 / float64(total)
+		}
+		fmt.Fprintf(w, "   %s: %d %s, %d bytes (%.1f%%), mean %s\n", s.Class, s.Requests, unit, s.Bytes, share, s.Mean().Round(time.Millisecond))
+	}
+}
+
+// classifyHead returns the class of the request whose head is peeked at
+// rd, or config.TrafficClassOpaque when the stream does not start with one.
+// A head beyond the peek budget is other: it is HTTP, but unread.
+func classifyHead(classes *config.TrafficClassifier, rd *bufio.Reader) string {
+	head, err := peekHTTPRequestHead(rd)
+	if head == nil {
+		if err != nil {
+			return config.TrafficClassOther
+		}
+		return config.TrafficClassOpaque
+	}
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(head)))
+	if err != nil {
+		return config.TrafficClassOpaque
+	}
+	return classes.Classify(req)
+}
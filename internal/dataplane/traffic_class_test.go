@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+)
+
+const testClassRules = "ws=upgrade,api=^/api/,api=content-type:^application/json,html=accept:text/html"
+
+// useClassCounters points processClasses at fresh counters for the test.
+func useClassCounters(t *testing.T) *trafficClassCounters {
+	t.Helper()
+	prev := processClasses
+	processClasses = newTrafficClassCounters()
+	t.Cleanup(func() { processClasses = prev })
+	return processClasses
+}
+
+// serveClassified serves incoming streams of an http tunnel with
+// testClassRules and a backend pool of size (none for 0).
+func serveClassified(t *testing.T, size int) *memSession {
+	t.Helper()
+	classes, err := config.ParseTrafficClasses(testClassRules)
+	require.NoError(t, err)
+	s := incomingStreamServer{
+		tunnelID:  "t1",
+		httpAware: true,
+		classes:   classes,
+		keepAlive: newKeepAlivePool(config.RuntimeSettings{HTTPAware: true, BackendPoolSize: size, BackendPoolIdle: time.Minute}),
+	}
+	client, server := newMemSessionPair()
+	t.Cleanup(func() {
+		client.Close()
+		if s.keepAlive != nil {
+			s.keepAlive.closeIdle()
+		}
+	})
+	go acceptIncomingStreams(client, s, make(chan struct{}))
+	return server
+}
+
+// classRequests maps class names to their request counts.
+func classRequests(c *trafficClassCounters) map[string]int64 {
+	out := make(map[string]int64)
+	for _, s := range c.snapshot() {
+		out[s.Class] = s.Requests
+	}
+	return out
+}
+
+func TestTrafficClasses_StreamMix(t *testing.T) {
+	counters := useClassCounters(t)
+	dst := keepAliveBackend(t)
+	server := serveClassified(t, 0)
+
+	requests := []string{
+		get("/api/users"),
+		"POST /submit HTTP/1.1\r\nHost: backend\r\nContent-Type: application/json\r\nContent-Length: 2\r\n\r\n{}",
+		"GET / HTTP/1.1\r\nHost: backend\r\nAccept: text/html\r\n\r\n",
+		"GET /api/socket HTTP/1.1\r\nHost: backend\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n",
+		get("/favicon.ico"),
+	}
+	for _, raw := range requests {
+		assert.Equal(t, []string{"ok"}, exchangeRequests(t, server, dst, raw, http.MethodGet))
+	}
+	st, _, line := openIncoming(t, server, dst)
+	require.Equal(t, setupAckLine, line)
+	_, err := st.Write([]byte{0, 1, 2, 3, '\r', '\n', '\r', '\n'})
+	require.NoError(t, err)
+	_, _ = io.Copy(io.Discard, st)
+	st.Close()
+
+	want := map[string]int64{"api": 2, "html": 1, "ws": 1, config.TrafficClassOther: 1, config.TrafficClassOpaque: 1}
+	require.Eventually(t, func() bool { return assert.ObjectsAreEqual(want, classRequests(counters)) }, 5*time.Second, 5*time.Millisecond,
+		"got %v", classRequests(counters))
+	for _, s := range counters.snapshot() {
+		assert.Positive(t, s.Bytes, s.Class)
+		assert.Positive(t, s.Mean(), s.Class)
+	}
+
+	var out bytes.Buffer
+	WriteTrafficClassSummary(&out)
+	assert.Contains(t, out.String(), "Traffic by class (--classify)")
+	assert.Contains(t, out.String(), "   api: 2 requests, ")
+	assert.Contains(t, out.String(), "   opaque: 1 streams, ")
+}
+
+func TestTrafficClasses_PooledStreamCountsEachRequest(t *testing.T) {
+	counters := useClassCounters(t)
+	dst := keepAliveBackend(t)
+	server := serveClassified(t, 4)
+
+	raw := get("/api/a") + "GET /page HTTP/1.1\r\nHost: backend\r\nAccept: text/html\r\n\r\n" + get("/api/b") + get("/other")
+	bodies := exchangeRequests(t, server, dst, raw, http.MethodGet, http.MethodGet, http.MethodGet, http.MethodGet)
+	assert.Equal(t, []string{"ok", "ok", "ok", "ok"}, bodies)
+
+	want := map[string]int64{"api": 2, "html": 1, config.TrafficClassOther: 1}
+	require.Eventually(t, func() bool { return assert.ObjectsAreEqual(want, classRequests(counters)) }, 5*time.Second, 5*time.Millisecond,
+		"got %v", classRequests(counters))
+	snap := counters.snapshot()
+	assert.Equal(t, "api", snap[0].Class, "sorted by bytes")
+}
+
+func TestTrafficClasses_OffWithoutRules(t *testing.T) {
+	counters := useClassCounters(t)
+	dst := keepAliveBackend(t)
+	server, _, _ := serveKeepAlive(t, 0)
+	assert.Equal(t, []string{"ok"}, exchangeRequests(t, server, dst, get("/api/x"), http.MethodGet))
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, counters.snapshot())
+}
@@ -0,0 +1,353 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/support"
+)
+
+// TransportSwitch describes a switch of --dp auto between the QUIC and the
+// WebSocket data plane; From and To are config.DataPlaneQUIC or
+// config.DataPlaneWS.
+type TransportSwitch struct {
+	From, To string
+	Reason   string
+}
+
+// TransportSwitchHook is called after every switch, e.g. to print it.
+type TransportSwitchHook func(TransportSwitch)
+
+// AutoTransport serves the incoming streams of an http/https tunnel over
+// QUIC or the WebSocket data plane (--dp auto). It starts on QUIC when the
+// first dial succeeds, then probes both every --dp-probe-interval: once the
+// active data plane is degraded while the other one probes healthy, the
+// other one is connected, takes the new streams, and the old one drains.
+type AutoTransport struct {
+	mgr      *Manager
+	reporter BackendStateReporter
+	onSwitch TransportSwitchHook
+	settings config.RuntimeSettings
+	clock    support.Clock
+
+	// active and standby track the probes of the data plane serving and of
+	// the other one; they are only used by the probe loop.
+	active  *sessionHealth
+	standby *sessionHealth
+
+	mu sync.Mutex
+	// qm serves while onQUIC is set; otherwise it is an unconnected
+	// manager that only probes.
+	qm     *QUICManager
+	onQUIC bool
+	// wsStop ends the WebSocket serve loop; nil while on QUIC.
+	wsStop chan struct{}
+
+	done      chan struct{}
+	closeOnce sync.Once
+	errs      chan error
+}
+
+// NewAutoTransport returns the AutoTransport of qm and mgr, which carry the
+// same tunnel. onSwitch may be nil.
+func NewAutoTransport(qm *QUICManager, mgr *Manager, reporter BackendStateReporter, onSwitch TransportSwitchHook) *AutoTransport {
+	return &AutoTransport{
+		mgr:      mgr,
+		reporter: reporter,
+		onSwitch: onSwitch,
+		settings: mgr.settings,
+		clock:    support.RealClock,
+		active:   newSessionHealth(mgr.settings.DegradedRTT),
+		standby:  newSessionHealth(mgr.settings.DegradedRTT),
+		qm:       qm,
+		done:     make(chan struct{}),
+		errs:     make(chan error, 1),
+	}
+}
+
+// Serve serves until Close, or until serving fails.
+func (a *AutoTransport) Serve() error {
+	a.mu.Lock()
+	qm := a.qm
+	a.mu.Unlock()
+	if err := qm.Connect(); err != nil {
+		log.Printf("[INFO] QUIC data plane unavailable (%v); serving over the WebSocket data plane", err)
+		a.serveWS()
+	} else {
+		a.serveQUIC(qm)
+	}
+	var tick <-chan time.Time
+	if interval := a.settings.TransportProbeInterval; interval > 0 {
+		ticker := a.clock.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C()
+	}
+	for {
+		select {
+		case <-a.done:
+			return errors.New("stopped")
+		case err := <-a.errs:
+			return err
+		case <-tick:
+			a.probe()
+		}
+	}
+}
+
+// Close stops serving on both data planes. It does not close the Manager.
+func (a *AutoTransport) Close() {
+	a.closeOnce.Do(func() {
+		close(a.done)
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.qm.Close()
+		if a.wsStop != nil {
+			close(a.wsStop)
+			a.wsStop = nil
+		}
+	})
+}
+
+// serveQUIC serves on qm, which is connected, until it is retired.
+func (a *AutoTransport) serveQUIC(qm *QUICManager) {
+	a.mu.Lock()
+	a.qm, a.onQUIC = qm, true
+	a.mu.Unlock()
+	processSessions.activate(a.mgr.tunnelID, config.DataPlaneQUIC)
+	support.Go(support.PanicScope{Role: "auto transport QUIC loop", TunnelID: a.mgr.tunnelID}, func() {
+		if err := ServeIncomingQUIC(qm, a.reporter); err != nil && !qm.isStopped() {
+			a.fail(err)
+		}
+	})
+}
+
+// serveWS serves on the Manager's sessions until wsStop is closed.
+func (a *AutoTransport) serveWS() {
+	stop := make(chan struct{})
+	a.mu.Lock()
+	a.wsStop, a.onQUIC = stop, false
+	a.mu.Unlock()
+	processSessions.activate(a.mgr.tunnelID, config.DataPlaneWS)
+	scope := support.PanicScope{Role: "auto transport WebSocket loop", TunnelID: a.mgr.tunnelID}
+	support.Go(scope, func() {
+		err := support.Supervise(scope, stop, func() error {
+			return serveIncomingUntil(a.mgr, a.reporter, stop)
+		})
+		select {
+		case <-stop:
+		default:
+			if err != nil {
+				a.fail(err)
+			}
+		}
+	})
+}
+
+func (a *AutoTransport) fail(err error) {
+	select {
+	case a.errs <- err:
+	default:
+	}
+}
+
+// probe measures both data planes and switches when the active one is
+// degraded and the other is not. A failed probe of the active data plane is
+// repeated at once, so that a dead one is noticed within one interval.
+func (a *AutoTransport) probe() {
+	a.mu.Lock()
+	qm, onQUIC := a.qm, a.onQUIC
+	a.mu.Unlock()
+	timeout := a.settings.PingTimeout
+	if timeout <= 0 {
+		timeout = defaultHealthInterval
+	}
+	probeActive, probeStandby := a.mgr.probePrimary, func() (time.Duration, error) { return qm.probeHandshake(timeout) }
+	if onQUIC {
+		probeActive, probeStandby = probeStandby, func() (time.Duration, error) { return a.mgr.probeHandshake(timeout) }
+	}
+	rtt, err := probeActive()
+	a.active.observe(rtt, err)
+	if err != nil && !a.active.degraded() {
+		rtt, err = probeActive()
+		a.active.observe(rtt, err)
+	}
+	a.standby.observe(probeStandby())
+	if !a.active.degraded() {
+		return
+	}
+	from, to := config.DataPlaneWS, config.DataPlaneQUIC
+	if onQUIC {
+		from, to = to, from
+	}
+	if a.standby.failures > 0 || a.standby.degraded() {
+		support.RepeatLogs.Printf(support.LogKey(transportDegradedFormat), transportDegradedFormat, from, healthReason(a.active), to)
+		return
+	}
+	reason := healthReason(a.active)
+	if err := a.switchTransport(onQUIC); err != nil {
+		log.Printf("[WARN] data plane: switching from %s to %s failed: %v", from, to, err)
+		return
+	}
+	support.RepeatLogs.Transition(support.LogKey(transportDegradedFormat), "[INFO] data plane switched from %s to %s (%s)", from, to, reason)
+	a.active.reset()
+	a.standby.reset()
+	if a.onSwitch != nil {
+		a.onSwitch(TransportSwitch{From: from, To: to, Reason: reason})
+	}
+}
+
+const transportDegradedFormat = "[WARN] data plane: %s is degraded (%s) but %s does not probe healthy either"
+
+// healthReason says why h is degraded.
+func healthReason(h *sessionHealth) string {
+	if h.failures >= degradedProbeFailures {
+		return fmt.Sprintf("%d probes failed", h.failures)
+	}
+	return fmt.Sprintf("probe RTT %s above --degraded-rtt", h.rtt.Round(time.Millisecond))
+}
+
+// switchTransport connects the data plane that is not active, moves new
+// streams onto it and drains the other one.
+func (a *AutoTransport) switchTransport(fromQUIC bool) error {
+	drain := a.settings.DrainTimeout
+	if drain <= 0 {
+		drain = defaultDrainTimeout
+	}
+	a.mu.Lock()
+	qm, stop := a.qm, a.wsStop
+	a.mu.Unlock()
+	if fromQUIC {
+		if _, err := a.mgr.EnsureSession(); err != nil {
+			return err
+		}
+		a.serveWS()
+		next := qm.fresh()
+		a.mu.Lock()
+		a.qm = next
+		a.mu.Unlock()
+		qm.retire(drain)
+		return nil
+	}
+	if err := qm.Connect(); err != nil {
+		return err
+	}
+	a.serveQUIC(qm)
+	a.mu.Lock()
+	a.wsStop = nil
+	a.mu.Unlock()
+	close(stop)
+	a.mgr.retirePrimary(time.Now().Add(drain))
+	return nil
+}
+
+// probePrimary pings the primary session like the health monitor does.
+func (m *Manager) probePrimary() (time.Duration, error) {
+	m.mu.Lock()
+	conn, sess, pongs := m.conn, m.sess, m.pongs
+	m.mu.Unlock()
+	if sess == nil || sess.IsClosed() {
+		return 0, errors.New("no data-plane session")
+	}
+	return m.probe(conn, sess, pongs)
+}
+
+// probeHandshake connects to the server over TCP, the first step of a
+// session dial, and reports how long it took.
+func (m *Manager) probeHandshake(timeout time.Duration) (time.Duration, error) {
+	m.mu.Lock()
+	serverURL := m.serverURL
+	m.mu.Unlock()
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return 0, err
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" || u.Scheme == "wss" {
+			port = "443"
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := time.Now()
+	c, err := m.endpoint.dialContext(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return 0, err
+	}
+	_ = c.Close()
+	return time.Since(start), nil
+}
+
+// retirePrimary moves the primary session to the draining ones without a
+// successor: its streams may finish until drainBy, and the next
+// EnsureSession dials a new session.
+func (m *Manager) retirePrimary(drainBy time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopped || m.sess == nil {
+		return
+	}
+	m.drainLocked(&drainingSession{conn: m.conn, sess: m.sess, pingDone: m.pingDone, pingTicker: m.pingTicker}, drainBy)
+	m.conn, m.sess, m.pongs = nil, nil, nil
+	m.pingDone, m.pingTicker = nil, nil
+	m.health.reset()
+	close(m.retired)
+	m.retired = make(chan struct{})
+}
+
+// probeHandshake completes a QUIC handshake with the server on a connection
+// of its own, closed right after, and reports how long it took.
+func (m *QUICManager) probeHandshake(timeout time.Duration) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := time.Now()
+	qc, err := m.dial(ctx)
+	if err != nil {
+		return 0, err
+	}
+	rtt := time.Since(start)
+	_ = qc.CloseWithError(0, "probe")
+	return rtt, nil
+}
+
+// fresh returns an unconnected QUICManager for the same tunnel.
+func (m *QUICManager) fresh() *QUICManager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &QUICManager{
+		tunnelID:    m.tunnelID,
+		dpAuthToken: m.dpAuthToken,
+		settings:    m.settings,
+		boInit:      m.boInit,
+		boMax:       m.boMax,
+		endpoint:    m.endpoint,
+		clock:       m.clock,
+		ctx:         ctx,
+		cancel:      cancel,
+		ready:       make(chan struct{}),
+		dial:        m.dial,
+	}
+}
+
+// retire stops accepting streams on m and closes its connection once drain
+// has passed, so that the streams in flight can finish.
+func (m *QUICManager) retire(drain time.Duration) {
+	m.cancel()
+	m.mu.Lock()
+	qc := m.conn
+	m.conn = nil
+	m.mu.Unlock()
+	if qc != nil {
+		time.AfterFunc(drain, func() { _ = qc.CloseWithError(0, "") })
+	}
+}
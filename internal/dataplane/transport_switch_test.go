@@ -0,0 +1,118 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xtaci/smux"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/testsupport"
+)
+
+// autoRuntime probes every 100ms, giving up on a probe after 200ms.
+func autoRuntime(quicPort int) config.RuntimeSettings {
+	rt := e2eRuntime()
+	rt.QUICPort = quicPort
+	rt.TransportProbeInterval = 100 * time.Millisecond
+	rt.PingTimeout = 200 * time.Millisecond
+	rt.DrainTimeout = time.Second
+	return rt
+}
+
+// TestE2E_AutoTransport_SwitchesToWSWhenQUICIsBlackholed: once UDP stops
+// getting through, new requests are served over the WebSocket data plane.
+func TestE2E_AutoTransport_SwitchesToWSWhenQUICIsBlackholed(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	port, err := stub.ServeQUIC()
+	require.NoError(t, err)
+	tun := stub.AddTunnel("http", startPageBackend(t))
+
+	rt := autoRuntime(port)
+	qm := NewQUICManager(stub.URL, tun.ID, "", 10*time.Millisecond, 50*time.Millisecond, rt)
+	qm.dial = insecureQUICDial(port)
+	mgr := NewManager(stub.URL, tun.ID, "", 10*time.Millisecond, 50*time.Millisecond, rt)
+	defer mgr.Close()
+	switches := make(chan TransportSwitch, 4)
+	at := NewAutoTransport(qm, mgr, nil, func(sw TransportSwitch) { switches <- sw })
+	errCh := make(chan error, 1)
+	go func() { errCh <- at.Serve() }()
+
+	require.NoError(t, stub.WaitQUICConns(tun.ID, 1, 5*time.Second))
+	public, err := stub.ServePublic(tun.ID)
+	require.NoError(t, err)
+	defer public.Close()
+	assert.Equal(t, "page /quic", getPage(t, public, "/quic"))
+	assert.Equal(t, 0, stub.SessionCount(tun.ID))
+	info, ok := SessionInfoOf(tun.ID)
+	require.True(t, ok)
+	assert.Equal(t, config.DataPlaneQUIC, info.DataPlane)
+
+	stub.SetQUICBlackhole(true)
+	select {
+	case sw := <-switches:
+		assert.Equal(t, config.DataPlaneQUIC, sw.From)
+		assert.Equal(t, config.DataPlaneWS, sw.To)
+		assert.Contains(t, sw.Reason, "probes failed")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no switch after QUIC was blackholed")
+	}
+	require.NoError(t, stub.WaitSessions(tun.ID, 1, 5*time.Second))
+	for range 3 {
+		assert.Equal(t, "page /ws", getPage(t, public, "/ws"))
+	}
+	info, ok = SessionInfoOf(tun.ID)
+	require.True(t, ok)
+	assert.Equal(t, config.DataPlaneWS, info.DataPlane, "the switch is in the session info")
+	assert.Equal(t, smux.DefaultConfig().MaxFrameSize, info.MaxFrameSize)
+	assert.Empty(t, switches, "the WebSocket data plane stays healthy")
+
+	at.Close()
+	select {
+	case err := <-errCh:
+		require.EqualError(t, err, "stopped")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after Close")
+	}
+}
+
+// TestE2E_AutoTransport_StaysWhenStandbyIsDown: a degraded data plane is
+// kept when the other one does not probe healthy either.
+func TestE2E_AutoTransport_StaysWhenStandbyIsDown(t *testing.T) {
+	stub := testsupport.NewServer(testsupport.Options{})
+	defer stub.Close()
+	port, err := stub.ServeQUIC()
+	require.NoError(t, err)
+	tun := stub.AddTunnel("http", startPageBackend(t))
+
+	rt := autoRuntime(port)
+	qm := NewQUICManager(stub.URL, tun.ID, "", 10*time.Millisecond, 50*time.Millisecond, rt)
+	qm.dial = insecureQUICDial(port)
+	mgr := NewManager("http://"+refusedAddr(t), tun.ID, "", 10*time.Millisecond, 50*time.Millisecond, rt)
+	defer mgr.Close()
+	switched := make(chan TransportSwitch, 1)
+	at := NewAutoTransport(qm, mgr, nil, func(sw TransportSwitch) { switched <- sw })
+	defer at.Close()
+	go func() { _ = at.Serve() }()
+
+	require.NoError(t, stub.WaitQUICConns(tun.ID, 1, 5*time.Second))
+	stub.SetQUICBlackhole(true)
+	select {
+	case sw := <-switched:
+		t.Fatalf("switched to an unreachable data plane: %+v", sw)
+	case <-time.After(time.Second):
+	}
+
+	stub.SetQUICBlackhole(false)
+	public, err := stub.ServePublic(tun.ID)
+	require.NoError(t, err)
+	defer public.Close()
+	assert.Equal(t, "page /", getPage(t, public, "/"))
+	assert.Equal(t, 0, stub.SessionCount(tun.ID))
+}
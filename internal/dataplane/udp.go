@@ -4,6 +4,7 @@
 package dataplane
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -14,19 +15,25 @@ import (
 	"github.com/fortunnels/client/internal/support"
 )
 
-// StartDataPlaneUDP listens on udpListen and forwards via WS/smux to server.
-func StartDataPlaneUDP(serverURL, tunnelID, dst, listenAddr string, runtime config.RuntimeSettings, enc config.EncryptionSettings, dpAuthToken string) error {
+// StartDataPlaneUDP listens on udpListen and forwards via WS/smux to server
+// until the session fails or ctx is done.
+func StartDataPlaneUDP(ctx context.Context, serverURL, tunnelID, dst, listenAddr string, runtime config.RuntimeSettings, enc config.EncryptionSettings, dpAuthToken string) error {
 	sess, cleanup, err := CreateDataPlaneSession(serverURL, tunnelID, runtime, dpAuthToken)
 	if err != nil {
 		return err
 	}
 	defer cleanup()
+	return serveUDP(ctx, sess, tunnelID, dst, listenAddr, runtime, enc)
+}
+
+// serveUDP forwards the datagrams of listenAddr over one stream of sess.
+func serveUDP(ctx context.Context, sess Session, tunnelID, dst, listenAddr string, runtime config.RuntimeSettings, enc config.EncryptionSettings) error {
 	stream, err := sess.OpenStream()
 	if err != nil {
 		return fmt.Errorf("open stream: %w", err)
 	}
 	defer stream.Close()
-	if prefaceErr := sendUDPPreface(stream, dst, tunnelID); prefaceErr != nil {
+	if prefaceErr := sendUDPPreface(stream, dst, tunnelID, runtime.InstanceID, enc); prefaceErr != nil {
 		return prefaceErr
 	}
 	wrapped := WrapClientStream(stream, tunnelID, enc)
@@ -45,13 +52,27 @@ func StartDataPlaneUDP(serverURL, tunnelID, dst, listenAddr string, runtime conf
 	errCh := make(chan error, 2)
 	var lastSrcMu sync.RWMutex
 	var lastSrc *net.UDPAddr
-	startUDPLocalToStream(wrapped, uc, errCh, &lastSrcMu, &lastSrc)
-	startStreamToUDPLocal(wrapped, uc, errCh, &lastSrcMu, &lastSrc)
-	return <-errCh
+	toTunnel := newPacketQueue[[]byte](runtime.UDPQueueSize, "local->tunnel").withMemory(udpQueueMemory, datagramSize)
+	toLocal := newPacketQueue[[]byte](runtime.UDPQueueSize, "tunnel->local").withMemory(udpQueueMemory, datagramSize)
+	defer toTunnel.close()
+	defer toLocal.close()
+	go toTunnel.reportDrops(udpDropReportInterval)
+	go toLocal.reportDrops(udpDropReportInterval)
+	quota := processQuota.newStream()
+	defer quota.release()
+	startUDPLocalToStreamQueued(wrapped, uc, errCh, &lastSrcMu, &lastSrc, toTunnel, quota)
+	startStreamToUDPLocalQueued(wrapped, uc, errCh, &lastSrcMu, &lastSrc, toLocal, quota)
+	// The deferred closes of the socket, stream and session end both loops.
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-func sendUDPPreface(stream io.Writer, dst, tunnelID string) error {
-	payload, err := encodePreface(map[string]string{"dst": dst, "proto": "udp", "tunnel_id": tunnelID})
+func sendUDPPreface(stream io.Writer, dst, tunnelID, instanceID string, enc config.EncryptionSettings) error {
+	payload, err := clientPreface(encryptionPreface(map[string]string{"dst": dst, "proto": "udp", "tunnel_id": tunnelID}, enc), prefaceMeta{instanceID: instanceID})
 	if err != nil {
 		return err
 	}
@@ -67,25 +88,52 @@ func startUDPLocalToStream(
 	errCh chan<- error,
 	lastSrcMu *sync.RWMutex,
 	lastSrc **net.UDPAddr,
+) {
+	q := newPacketQueue[[]byte](defaultUDPQueueSize, "local->tunnel")
+	startUDPLocalToStreamQueued(wrapped, uc, errCh, lastSrcMu, lastSrc, q, nil)
+}
+
+// startUDPLocalToStreamQueued reads local datagrams into q and writes them to
+// the stream from a separate goroutine, so a stalled stream drops the oldest
+// queued packets instead of blocking the socket reader. Payloads count
+// against quota; the first one past a limit ends forwarding.
+func startUDPLocalToStreamQueued(
+	wrapped io.Writer,
+	uc *net.UDPConn,
+	errCh chan<- error,
+	lastSrcMu *sync.RWMutex,
+	lastSrc **net.UDPAddr,
+	q *packetQueue[[]byte],
+	quota *streamQuota,
 ) {
 	go func() {
-		buf := make([]byte, udpMaxPacketSize)
+		defer support.RecoverAs(failUDPLoop("udp local reader", errCh))
+		defer q.close()
+		// Datagrams are copied out of the (reused) read buffers before they
+		// are queued; every one updates the reply address.
+		err := readUDPLocal(uc, newUDPBatchConn(uc), func(payload []byte, src *net.UDPAddr) {
+			lastSrcMu.Lock()
+			*lastSrc = src
+			lastSrcMu.Unlock()
+			q.push(append([]byte(nil), payload...))
+		})
+		reportUDPError(errCh, err)
+	}()
+	go func() {
+		defer support.RecoverAs(failUDPLoop("udp stream writer", errCh))
 		for {
-			n, src, err := uc.ReadFromUDP(buf)
-			if err != nil {
-				errCh <- err
+			packet, ok := q.pop()
+			if !ok {
 				return
 			}
-			if n <= 0 {
-				continue
+			if limitErr := quota.takePacket(len(packet)); limitErr != nil {
+				reportUDPError(errCh, limitErr)
+				q.close()
+				return
 			}
-
-			lastSrcMu.Lock()
-			*lastSrc = src
-			lastSrcMu.Unlock()
-
-			if writeErr := writeUDPPacket(wrapped, buf[:n]); writeErr != nil {
-				errCh <- writeErr
+			if writeErr := writeUDPPacket(wrapped, packet); writeErr != nil {
+				reportUDPError(errCh, writeErr)
+				q.close()
 				return
 			}
 		}
@@ -98,12 +146,45 @@ func startStreamToUDPLocal(
 	errCh chan<- error,
 	lastSrcMu *sync.RWMutex,
 	lastSrc **net.UDPAddr,
+) {
+	q := newPacketQueue[[]byte](defaultUDPQueueSize, "tunnel->local")
+	startStreamToUDPLocalQueued(wrapped, uc, errCh, lastSrcMu, lastSrc, q, nil)
+}
+
+// startStreamToUDPLocalQueued is the tunnel->local counterpart of
+// startUDPLocalToStreamQueued.
+func startStreamToUDPLocalQueued(
+	wrapped io.Reader,
+	uc *net.UDPConn,
+	errCh chan<- error,
+	lastSrcMu *sync.RWMutex,
+	lastSrc **net.UDPAddr,
+	q *packetQueue[[]byte],
+	quota *streamQuota,
 ) {
 	go func() {
+		defer support.RecoverAs(failUDPLoop("udp stream reader", errCh))
+		defer q.close()
 		for {
 			packet, err := readUDPPacket(wrapped)
+			if err == nil {
+				err = quota.takePacket(len(packet))
+			}
 			if err != nil {
-				errCh <- err
+				reportUDPError(errCh, err)
+				return
+			}
+			q.push(packet)
+		}
+	}()
+	go func() {
+		defer support.RecoverAs(failUDPLoop("udp local writer", errCh))
+		batch := newUDPBatchConn(uc)
+		packets := make([][]byte, 0, udpBatchSize)
+		for {
+			var ok bool
+			packets, ok = q.popBatch(packets)
+			if !ok {
 				return
 			}
 			lastSrcMu.RLock()
@@ -112,14 +193,33 @@ func startStreamToUDPLocal(
 			if dst == nil {
 				continue
 			}
-			if _, writeErr := uc.WriteToUDP(packet, dst); writeErr != nil {
-				errCh <- writeErr
+			if writeErr := writeUDPLocal(uc, batch, packets, dst); writeErr != nil {
+				reportUDPError(errCh, writeErr)
+				q.close()
 				return
 			}
 		}
 	}()
 }
 
+// failUDPLoop returns the panic handler of a UDP forwarding loop: the panic
+// is reported and ends the forwarding like an error of the loop.
+func failUDPLoop(role string, errCh chan<- error) func(*support.PanicError) {
+	return func(p *support.PanicError) {
+		support.ReportPanic(support.PanicScope{Role: role}, p)
+		reportUDPError(errCh, p)
+	}
+}
+
+// reportUDPError delivers the first error of a forwarding pipeline; later
+// errors from the other goroutines are dropped so none of them block.
+func reportUDPError(errCh chan<- error, err error) {
+	select {
+	case errCh <- err:
+	default:
+	}
+}
+
 func writeUDPPacket(w io.Writer, payload []byte) error {
 	length, err := support.ToUint16Size(len(payload))
 	if err != nil {
@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"errors"
+	"net"
+)
+
+// udpBatchSize is how many datagrams one batched syscall moves at most.
+const udpBatchSize = 32
+
+// errUDPBatchUnsupported is returned by the first batched read of a socket
+// that cannot batch; the caller switches to one datagram per syscall.
+var errUDPBatchUnsupported = errors.New("udp batching unsupported")
+
+// udpBatchConn moves several datagrams per syscall (recvmmsg/sendmmsg on
+// Linux). newUDPBatchConn returns nil where batching is not available.
+type udpBatchConn interface {
+	// readBatch reads up to udpBatchSize datagrams and calls fn for each in
+	// arrival order. payload points into a buffer the next readBatch reuses.
+	readBatch(fn func(payload []byte, src *net.UDPAddr)) error
+	// canWrite reports whether writeBatch can address dst.
+	canWrite(dst *net.UDPAddr) bool
+	// writeBatch sends every packet to dst.
+	writeBatch(packets [][]byte, dst *net.UDPAddr) error
+}
+
+// readUDPLocal calls fn for every datagram read from uc until a read fails,
+// batching reads where the platform supports it.
+func readUDPLocal(uc *net.UDPConn, batch udpBatchConn, fn func(payload []byte, src *net.UDPAddr)) error {
+	if batch != nil {
+		for {
+			err := batch.readBatch(fn)
+			if errors.Is(err, errUDPBatchUnsupported) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	buf := make([]byte, udpMaxPacketSize)
+	for {
+		n, src, err := uc.ReadFromUDP(buf)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			fn(buf[:n], src)
+		}
+	}
+}
+
+// writeUDPLocal sends packets to dst, in one syscall per batch where
+// possible.
+func writeUDPLocal(uc *net.UDPConn, batch udpBatchConn, packets [][]byte, dst *net.UDPAddr) error {
+	if batch != nil && batch.canWrite(dst) {
+		return batch.writeBatch(packets, dst)
+	}
+	for _, p := range packets {
+		if _, err := uc.WriteToUDP(p, dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
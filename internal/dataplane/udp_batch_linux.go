@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+//go:build linux
+
+package dataplane
+
+import (
+	"errors"
+	"io"
+	"net"
+	"syscall"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// batchPacketConn is what ipv4.PacketConn and ipv6.PacketConn share; both
+// batch through the same recvmmsg/sendmmsg for either address family.
+type batchPacketConn interface {
+	ReadBatch(ms []ipv4.Message, flags int) (int, error)
+	WriteBatch(ms []ipv4.Message, flags int) (int, error)
+}
+
+// mmsgConn batches with recvmmsg/sendmmsg. Its read buffers are allocated
+// once and reused by every readBatch, so only one goroutine may read and one
+// may write.
+type mmsgConn struct {
+	pc batchPacketConn
+	// ipv6 sockets may be dual-stack; x/net addresses IPv4 peers with an
+	// AF_INET sockaddr, which they reject, so those writes are not batched.
+	ipv6  bool
+	read  []ipv4.Message
+	write []ipv4.Message
+	// batched reports whether a batched read has succeeded, after which
+	// errors are real socket errors rather than a missing syscall.
+	batched bool
+}
+
+func newUDPBatchConn(uc *net.UDPConn) udpBatchConn {
+	laddr, ok := uc.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return nil
+	}
+	c := &mmsgConn{
+		read:  make([]ipv4.Message, udpBatchSize),
+		write: make([]ipv4.Message, udpBatchSize),
+	}
+	if laddr.IP.To4() != nil {
+		c.pc = ipv4.NewPacketConn(uc)
+	} else {
+		c.pc = ipv6.NewPacketConn(uc)
+		c.ipv6 = true
+	}
+	for i := range c.read {
+		c.read[i].Buffers = [][]byte{make([]byte, udpMaxPacketSize)}
+	}
+	for i := range c.write {
+		c.write[i].Buffers = make([][]byte, 1)
+	}
+	return c
+}
+
+func (c *mmsgConn) readBatch(fn func(payload []byte, src *net.UDPAddr)) error {
+	n, err := c.pc.ReadBatch(c.read, 0)
+	if err != nil {
+		if !c.batched && (errors.Is(err, syscall.ENOSYS) || errors.Is(err, syscall.EOPNOTSUPP)) {
+			return errUDPBatchUnsupported
+		}
+		return err
+	}
+	c.batched = true
+	for i := range n {
+		m := &c.read[i]
+		src, _ := m.Addr.(*net.UDPAddr)
+		if m.N > 0 && src != nil {
+			fn(m.Buffers[0][:m.N], src)
+		}
+	}
+	return nil
+}
+
+func (c *mmsgConn) canWrite(dst *net.UDPAddr) bool {
+	return !c.ipv6 || dst.IP.To4() == nil
+}
+
+func (c *mmsgConn) writeBatch(packets [][]byte, dst *net.UDPAddr) error {
+	for len(packets) > 0 {
+		chunk := min(len(packets), len(c.write))
+		for i := range chunk {
+			c.write[i].Buffers[0] = packets[i]
+			c.write[i].Addr = dst
+		}
+		n, err := c.pc.WriteBatch(c.write[:chunk], 0)
+		for i := range chunk {
+			c.write[i].Buffers[0] = nil
+		}
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return io.ErrShortWrite
+		}
+		packets = packets[n:]
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+//go:build !linux
+
+package dataplane
+
+import "net"
+
+// newUDPBatchConn returns nil: outside Linux, x/net reads and writes one
+// datagram per syscall anyway, so the plain path is used.
+func newUDPBatchConn(*net.UDPConn) udpBatchConn { return nil }
@@ -0,0 +1,197 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func listenLoopbackUDP(t testing.TB) *net.UDPConn {
+	t.Helper()
+	uc, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() { uc.Close() })
+	return uc
+}
+
+// udpPaths are the two ways readUDPLocal and writeUDPLocal move datagrams:
+// batched where the platform supports it, and one per syscall.
+func udpPaths(uc *net.UDPConn) map[string]udpBatchConn {
+	paths := map[string]udpBatchConn{"single": nil}
+	if b := newUDPBatchConn(uc); b != nil {
+		paths["batch"] = b
+	}
+	return paths
+}
+
+func TestReadUDPLocal_CopiesOutOfReusedBuffers(t *testing.T) {
+	const perSender = 3 * udpBatchSize
+	for name := range udpPaths(listenLoopbackUDP(t)) {
+		t.Run(name, func(t *testing.T) {
+			uc := listenLoopbackUDP(t)
+			batch := udpPaths(uc)[name]
+			senders := []*net.UDPConn{listenLoopbackUDP(t), listenLoopbackUDP(t)}
+
+			type got struct {
+				payload []byte
+				src     string
+			}
+			ch := make(chan got, 2*perSender)
+			go func() {
+				_ = readUDPLocal(uc, batch, func(payload []byte, src *net.UDPAddr) {
+					// As the forwarding path does: copy before the next read
+					// reuses the buffer.
+					ch <- got{append([]byte(nil), payload...), src.String()}
+				})
+			}()
+
+			var wg sync.WaitGroup
+			for s, sender := range senders {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := range perSender {
+						_, err := sender.WriteToUDP(fmt.Appendf(nil, "sender%d-packet%03d", s, i), uc.LocalAddr().(*net.UDPAddr))
+						assert.NoError(t, err)
+						if i%udpBatchSize == 0 {
+							time.Sleep(time.Millisecond) // stay within the socket buffer
+						}
+					}
+				}()
+			}
+			wg.Wait()
+
+			next := make([]int, len(senders))
+			for range 2 * perSender {
+				select {
+				case g := <-ch:
+					s := 0
+					if g.src == senders[1].LocalAddr().String() {
+						s = 1
+					}
+					require.Equal(t, senders[s].LocalAddr().String(), g.src, "source address kept per datagram")
+					assert.Equal(t, fmt.Sprintf("sender%d-packet%03d", s, next[s]), string(g.payload), "payload intact and in order")
+					next[s]++
+				case <-time.After(5 * time.Second):
+					t.Fatalf("received %v of %d datagrams per sender", next, perSender)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteUDPLocal_SendsEveryPacket(t *testing.T) {
+	src := listenLoopbackUDP(t)
+	dst := listenLoopbackUDP(t)
+	packets := make([][]byte, 0, 2*udpBatchSize+5)
+	for i := range cap(packets) {
+		packets = append(packets, fmt.Appendf(nil, "packet%03d", i))
+	}
+	require.NoError(t, writeUDPLocal(src, newUDPBatchConn(src), packets, dst.LocalAddr().(*net.UDPAddr)))
+
+	buf := make([]byte, 64)
+	require.NoError(t, dst.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for i := range packets {
+		n, from, err := dst.ReadFromUDP(buf)
+		require.NoError(t, err)
+		assert.Equal(t, src.LocalAddr().String(), from.String())
+		assert.Equal(t, fmt.Sprintf("packet%03d", i), string(buf[:n]))
+	}
+}
+
+func TestWriteUDPLocal_DualStackIPv4Peer(t *testing.T) {
+	uc, err := net.ListenUDP("udp", &net.UDPAddr{})
+	require.NoError(t, err)
+	defer uc.Close()
+	peer := listenLoopbackUDP(t)
+	port := uc.LocalAddr().(*net.UDPAddr).Port
+
+	// An IPv4 peer of a dual-stack socket, as reads report it.
+	dst := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: peer.LocalAddr().(*net.UDPAddr).Port}
+	require.NoError(t, writeUDPLocal(uc, newUDPBatchConn(uc), [][]byte{[]byte("a"), []byte("b")}, dst))
+
+	buf := make([]byte, 8)
+	require.NoError(t, peer.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for _, want := range []string{"a", "b"} {
+		n, from, err := peer.ReadFromUDP(buf)
+		require.NoError(t, err)
+		assert.Equal(t, port, from.Port)
+		assert.Equal(t, want, string(buf[:n]))
+	}
+}
+
+// BenchmarkUDPLocalRead compares packets/sec of batched and single reads of
+// small datagrams over loopback.
+func BenchmarkUDPLocalRead(b *testing.B) {
+	for name := range udpPaths(listenLoopbackUDP(b)) {
+		b.Run(name, func(b *testing.B) {
+			uc := listenLoopbackUDP(b)
+			batch := udpPaths(uc)[name]
+			sender := listenLoopbackUDP(b)
+			stop := make(chan struct{})
+			go func() {
+				// 20ms G.711 voice frames, sent as fast as possible.
+				packets := make([][]byte, udpBatchSize)
+				for i := range packets {
+					packets[i] = make([]byte, 160)
+				}
+				sendBatch := newUDPBatchConn(sender)
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+						_ = writeUDPLocal(sender, sendBatch, packets, uc.LocalAddr().(*net.UDPAddr))
+					}
+				}
+			}()
+			done := make(chan struct{})
+			n := 0
+			b.ResetTimer()
+			go func() {
+				_ = readUDPLocal(uc, batch, func([]byte, *net.UDPAddr) {
+					n++
+					if n == b.N {
+						close(done)
+					}
+				})
+			}()
+			<-done
+			b.StopTimer()
+			close(stop)
+			uc.Close()
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "pkts/s")
+		})
+	}
+}
+
+// BenchmarkUDPLocalWrite compares packets/sec of batched and single writes
+// of small datagrams over loopback.
+func BenchmarkUDPLocalWrite(b *testing.B) {
+	for name := range udpPaths(listenLoopbackUDP(b)) {
+		b.Run(name, func(b *testing.B) {
+			uc := listenLoopbackUDP(b)
+			batch := udpPaths(uc)[name]
+			dst := listenLoopbackUDP(b).LocalAddr().(*net.UDPAddr)
+			packets := make([][]byte, udpBatchSize)
+			for i := range packets {
+				packets[i] = make([]byte, 160)
+			}
+			b.ResetTimer()
+			for sent := 0; sent < b.N; sent += len(packets) {
+				if err := writeUDPLocal(uc, batch, packets[:min(len(packets), b.N-sent)], dst); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "pkts/s")
+		})
+	}
+}
@@ -0,0 +1,254 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fortunnels/client/internal/support"
+)
+
+const (
+	defaultUDPQueueSize   = 1024
+	udpDropReportInterval = 10 * time.Second
+)
+
+// udpDatagram is a packet together with the local peer it came from or goes to.
+type udpDatagram struct {
+	data []byte
+	addr *net.UDPAddr
+}
+
+// packetQueue is a bounded single-consumer FIFO between a UDP reader and a
+// slower writer. When full it drops the oldest packet, so a stalled tunnel
+// degrades into counted loss instead of blocking the read loop. A queue with
+// a memory component drops new packets the budget has no room for, too.
+type packetQueue[T any] struct {
+	label string
+	// keep protects the packets it returns true for from eviction; nil
+	// protects none.
+	keep func(T) bool
+	// mem accounts the queued packets as weigh sizes them; nil leaves them
+	// unaccounted. close sets it to nil once it released what was held.
+	mem   *support.MemoryComponent
+	weigh func(T) int64
+	held  int64
+
+	mu     sync.Mutex
+	items  []T
+	head   int
+	count  int
+	closed bool
+	ready  chan struct{}
+	// done is closed by close, so reportDrops ends with the queue.
+	done chan struct{}
+
+	dropped atomic.Uint64
+}
+
+func newPacketQueue[T any](size int, label string) *packetQueue[T] {
+	if size <= 0 {
+		size = defaultUDPQueueSize
+	}
+	return &packetQueue[T]{
+		label: label,
+		items: make([]T, size),
+		ready: make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+}
+
+// withMemory accounts the queued packets to mem, each weighing what weigh
+// returns. It must be called before the queue is used.
+func (q *packetQueue[T]) withMemory(mem *support.MemoryComponent, weigh func(T) int64) *packetQueue[T] {
+	q.mem, q.weigh = mem, weigh
+	return q
+}
+
+// withKeep protects the packets keep returns true for: a full queue evicts
+// its oldest unprotected packet instead. It must be called before the queue
+// is used.
+func (q *packetQueue[T]) withKeep(keep func(T) bool) *packetQueue[T] {
+	q.keep = keep
+	return q
+}
+
+// push enqueues v, evicting the oldest packet when the queue is full; when
+// the memory budget has no room for v, v is dropped instead. It reports
+// whether a packet was dropped.
+func (q *packetQueue[T]) push(v T) bool {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return false
+	}
+	dropped := false
+	if q.count == len(q.items) {
+		if !q.evictLocked(v) {
+			q.mu.Unlock()
+			q.dropped.Add(1)
+			return true
+		}
+		dropped = true
+	}
+	if q.mem != nil {
+		n := q.weigh(v)
+		if !q.mem.Reserve(n) {
+			q.mu.Unlock()
+			if dropped {
+				q.dropped.Add(1)
+			}
+			q.dropped.Add(1)
+			return true
+		}
+		q.held += n
+	}
+	q.items[(q.head+q.count)%len(q.items)] = v
+	q.count++
+	q.mu.Unlock()
+	if dropped {
+		q.dropped.Add(1)
+	}
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return dropped
+}
+
+// evictLocked makes room in the full queue for v by removing its oldest
+// packet that keep does not protect. When every queued packet is protected
+// the oldest goes for a protected v, and nothing for any other v, which
+// push drops instead; evictLocked reports whether it made room.
+func (q *packetQueue[T]) evictLocked(v T) bool {
+	n := len(q.items)
+	off := 0
+	if q.keep != nil {
+		for off < q.count && q.keep(q.items[(q.head+off)%n]) {
+			off++
+		}
+		if off == q.count {
+			if !q.keep(v) {
+				return false
+			}
+			off = 0
+		}
+	}
+	q.releaseLocked(q.items[(q.head+off)%n])
+	// The protected packets ahead of the evicted one move up a slot.
+	for i := off; i > 0; i-- {
+		q.items[(q.head+i)%n] = q.items[(q.head+i-1)%n]
+	}
+	var zero T
+	q.items[q.head] = zero
+	q.head = (q.head + 1) % n
+	q.count--
+	return true
+}
+
+// pop blocks until a packet is available or the queue is closed and drained.
+func (q *packetQueue[T]) pop() (T, bool) {
+	for {
+		q.mu.Lock()
+		if q.count > 0 {
+			v := q.items[q.head]
+			q.releaseLocked(v)
+			var zero T
+			q.items[q.head] = zero
+			q.head = (q.head + 1) % len(q.items)
+			q.count--
+			q.mu.Unlock()
+			return v, true
+		}
+		if q.closed {
+			q.mu.Unlock()
+			var zero T
+			return zero, false
+		}
+		q.mu.Unlock()
+		<-q.ready
+	}
+}
+
+// popBatch is pop for up to cap(dst) packets: it blocks for the first and
+// appends whatever else is queued at that moment to dst[:0].
+func (q *packetQueue[T]) popBatch(dst []T) ([]T, bool) {
+	dst = dst[:0]
+	for {
+		q.mu.Lock()
+		if q.count > 0 {
+			var zero T
+			for q.count > 0 && len(dst) < cap(dst) {
+				dst = append(dst, q.items[q.head])
+				q.releaseLocked(q.items[q.head])
+				q.items[q.head] = zero
+				q.head = (q.head + 1) % len(q.items)
+				q.count--
+			}
+			q.mu.Unlock()
+			return dst, true
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return dst, false
+		}
+		q.mu.Unlock()
+		<-q.ready
+	}
+}
+
+// releaseLocked returns the memory of v as it leaves the queue.
+func (q *packetQueue[T]) releaseLocked(v T) {
+	if q.mem == nil {
+		return
+	}
+	n := q.weigh(v)
+	q.held -= n
+	q.mem.Release(n)
+}
+
+// close ends the queue. What it still holds is released from the memory
+// budget at once; pops draining it afterwards release nothing.
+func (q *packetQueue[T]) close() {
+	q.mu.Lock()
+	if !q.closed {
+		close(q.done)
+	}
+	q.closed = true
+	if q.mem != nil {
+		q.mem.Release(q.held)
+		q.mem, q.held = nil, 0
+	}
+	q.mu.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Dropped returns the number of packets evicted so far.
+func (q *packetQueue[T]) Dropped() uint64 { return q.dropped.Load() }
+
+// reportDrops logs newly dropped packets once per interval until the queue closes.
+func (q *packetQueue[T]) reportDrops(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var last uint64
+	for {
+		select {
+		case <-ticker.C:
+		case <-q.done:
+			return
+		}
+		total := q.Dropped()
+		if total > last {
+			log.Printf("[WARN] udp %s queue full: dropped %d packets in the last %s (total %d)", q.label, total-last, interval, total)
+			last = total
+		}
+	}
+}
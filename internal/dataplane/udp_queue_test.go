@@ -0,0 +1,182 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacketQueue_DropsOldestWhenFull(t *testing.T) {
+	q := newPacketQueue[int](3, "test")
+	for i := 1; i <= 5; i++ {
+		q.push(i)
+	}
+	assert.Equal(t, uint64(2), q.Dropped())
+
+	q.close()
+	var got []int
+	for {
+		v, ok := q.pop()
+		if !ok {
+			break
+		}
+		got = append(got, v)
+	}
+	assert.Equal(t, []int{3, 4, 5}, got, "closed queue drains survivors in order")
+}
+
+func TestPacketQueue_KeepsProtectedWhenFull(t *testing.T) {
+	q := newPacketQueue[int](3, "test").withKeep(func(v int) bool { return v < 0 })
+	for _, v := range []int{1, -1, 2, 3, 4, -2, 5, -3, 6} {
+		q.push(v)
+	}
+	assert.Equal(t, uint64(6), q.Dropped())
+
+	q.close()
+	var got []int
+	for {
+		v, ok := q.pop()
+		if !ok {
+			break
+		}
+		got = append(got, v)
+	}
+	assert.Equal(t, []int{-1, -2, -3}, got, "protected packets survive in order; 6 found no room")
+}
+
+func TestPacketQueue_PopBlocksUntilPush(t *testing.T) {
+	q := newPacketQueue[string](2, "test")
+	got := make(chan string, 1)
+	go func() {
+		v, _ := q.pop()
+		got <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+	q.push("a")
+	select {
+	case v := <-got:
+		assert.Equal(t, "a", v)
+	case <-time.After(time.Second):
+		t.Fatal("pop did not wake up after push")
+	}
+}
+
+func TestPacketQueue_PushAfterCloseIsIgnored(t *testing.T) {
+	q := newPacketQueue[int](1, "test")
+	q.close()
+	q.push(1)
+	_, ok := q.pop()
+	assert.False(t, ok)
+	assert.Zero(t, q.Dropped())
+}
+
+func TestPacketQueue_PopBatchTakesWhatIsQueued(t *testing.T) {
+	q := newPacketQueue[int](8, "test")
+	for i := 1; i <= 5; i++ {
+		q.push(i)
+	}
+	batch := make([]int, 0, 3)
+	batch, ok := q.popBatch(batch)
+	require.True(t, ok)
+	assert.Equal(t, []int{1, 2, 3}, batch, "at most cap(dst) packets")
+	batch, ok = q.popBatch(batch)
+	require.True(t, ok)
+	assert.Equal(t, []int{4, 5}, batch, "does not wait to fill the batch")
+
+	got := make(chan []int, 1)
+	go func() {
+		b, _ := q.popBatch(make([]int, 0, 3))
+		got <- b
+	}()
+	q.push(6)
+	assert.Equal(t, []int{6}, <-got)
+
+	q.close()
+	_, ok = q.popBatch(batch)
+	assert.False(t, ok)
+}
+
+// blockingWriter records writes and blocks until release is closed.
+type blockingWriter struct {
+	release chan struct{}
+	mu      sync.Mutex
+	data    []byte
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	w.mu.Lock()
+	w.data = append(w.data, p...)
+	w.mu.Unlock()
+	return len(p), nil
+}
+
+func (w *blockingWriter) packets(t *testing.T) []uint32 {
+	t.Helper()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var seqs []uint32
+	for rest := w.data; len(rest) >= 2; {
+		n := int(binary.BigEndian.Uint16(rest[:2]))
+		require.GreaterOrEqual(t, len(rest), 2+n)
+		seqs = append(seqs, binary.BigEndian.Uint32(rest[2:2+n]))
+		rest = rest[2+n:]
+	}
+	return seqs
+}
+
+func TestUDPLocalToStream_BlockedWriterCountsDropsAndKeepsOrder(t *testing.T) {
+	uc, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer uc.Close()
+	sender, err := net.DialUDP("udp", nil, uc.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+	defer sender.Close()
+
+	w := &blockingWriter{release: make(chan struct{})}
+	q := newPacketQueue[[]byte](4, "local->tunnel")
+	errCh := make(chan error, 2)
+	var lastSrcMu sync.RWMutex
+	var lastSrc *net.UDPAddr
+	startUDPLocalToStreamQueued(w, uc, errCh, &lastSrcMu, &lastSrc, q, nil)
+
+	const total = 64
+	for i := uint32(0); i < total; i++ {
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], i)
+		_, err := sender.Write(b[:])
+		require.NoError(t, err)
+	}
+	require.Eventually(t, func() bool { return q.Dropped() > 0 }, 2*time.Second, 5*time.Millisecond)
+	// Let the reader consume whatever is still in the socket buffer.
+	time.Sleep(50 * time.Millisecond)
+	close(w.release)
+
+	require.Eventually(t, func() bool {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return q.count == 0
+	}, 2*time.Second, 5*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+
+	seqs := w.packets(t)
+	require.NotEmpty(t, seqs)
+	for i := 1; i < len(seqs); i++ {
+		assert.Less(t, seqs[i-1], seqs[i], "surviving packets keep their order")
+	}
+	assert.Equal(t, uint32(total-1), seqs[len(seqs)-1], "newest packet survives")
+	assert.LessOrEqual(t, uint64(len(seqs))+q.Dropped(), uint64(total))
+	select {
+	case err := <-errCh:
+		t.Fatalf("unexpected forwarding error: %v", err)
+	default:
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
 )
 
 // mockWriter implements io.Writer for testing
@@ -225,7 +227,7 @@ func TestSendUDPPreface(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			writer := &mockWriter{}
-			err := sendUDPPreface(writer, tt.dst, tt.tunnelID)
+			err := sendUDPPreface(writer, tt.dst, tt.tunnelID, "", config.EncryptionSettings{})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("sendUDPPreface() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -265,6 +267,18 @@ func TestSendUDPPreface_WriteError(t *testing.T) {
 	writer := &mockWriter{
 		writeErr: io.ErrClosedPipe,
 	}
-	err := sendUDPPreface(writer, "127.0.0.1:8080", "tunnel-123")
+	err := sendUDPPreface(writer, "127.0.0.1:8080", "tunnel-123", "", config.EncryptionSettings{})
 	require.Error(t, err, "sendUDPPreface() with write error should return error")
 }
+
+func TestSendUDPPreface_ClientInstance(t *testing.T) {
+	writer := &mockWriter{}
+	require.NoError(t, sendUDPPreface(writer, "127.0.0.1:53", "tunnel-123", "instance-a", config.EncryptionSettings{}))
+	var preface map[string]string
+	require.NoError(t, json.Unmarshal(bytes.TrimSpace(writer.data), &preface))
+	require.Equal(t, "instance-a", preface["client_instance"])
+
+	writer = &mockWriter{}
+	require.NoError(t, sendUDPPreface(writer, "127.0.0.1:53", "tunnel-123", "", config.EncryptionSettings{}))
+	require.NotContains(t, string(writer.data), "client_instance", "no instance, no field")
+}
@@ -0,0 +1,131 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortunnels/client/internal/config"
+	sec "github.com/fortunnels/client/internal/security"
+	"github.com/fortunnels/client/internal/wiretest"
+)
+
+// The golden transcripts under internal/wiretest/testdata are what these
+// canonical scenarios put on the wire, byte for byte.
+
+const (
+	wireTunnelID   = "tun-wire-0001"
+	wireInstanceID = "instance-wire-0001"
+	wireDst        = "127.0.0.1:8080"
+	wirePSK        = "wire-transcript-psk-0001"
+)
+
+var wirePayload = []byte("GET / HTTP/1.1\r\nHost: wire\r\n\r\n")
+
+// wireEncryption is a legacy-KDF PSK whose frames take their nonces from a
+// counter starting at a fixed, recognizable value.
+func wireEncryption() config.EncryptionSettings {
+	return config.EncryptionSettings{
+		Enabled: true,
+		PSK:     wirePSK,
+		KDF:     sec.LegacyKDF,
+		Nonces:  func() sec.NonceSource { return sec.CounterNonces(0x0102030405060708) },
+	}
+}
+
+// listenTranscript forwards one local connection that sends payload through
+// a listen forwarder over an in-memory session, and returns what the server
+// side of the stream received.
+func listenTranscript(t *testing.T, enc config.EncryptionSettings, payload []byte) []byte {
+	t.Helper()
+	mgr, d := newFakeManager(t, config.RuntimeSettings{InstanceID: wireInstanceID})
+	_, err := mgr.EnsureSession()
+	require.NoError(t, err)
+
+	local, app := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- newListenForwarder(wireTunnelID, wireDst, mgr.settings, enc).forward(local, mgr, newConnLogger())
+	}()
+	st, err := d.server(0).AcceptStream()
+	require.NoError(t, err)
+	require.NoError(t, st.SetDeadline(time.Now().Add(5*time.Second)))
+	var rec wiretest.Recorder
+	recorded := make(chan error, 1)
+	go func() {
+		_, err := rec.ReadFrom(st)
+		recorded <- err
+	}()
+
+	_, err = app.Write(payload)
+	require.NoError(t, err)
+	require.NoError(t, app.Close())
+	require.NoError(t, <-recorded)
+	require.NoError(t, st.Close())
+	require.NoError(t, <-done)
+	return rec.Bytes()
+}
+
+// nopCloser adapts a reader or writer to the io.ReadWriteCloser the stream
+// wrappers take.
+type nopCloser struct{ rw any }
+
+func (c nopCloser) Read(p []byte) (int, error)  { return c.rw.(io.Reader).Read(p) }
+func (c nopCloser) Write(p []byte) (int, error) { return c.rw.(io.Writer).Write(p) }
+func (nopCloser) Close() error                  { return nil }
+
+func TestWireTranscript_TCPListen(t *testing.T) {
+	wiretest.Check(t, "tcp_listen", listenTranscript(t, config.EncryptionSettings{}, wirePayload))
+}
+
+func TestWireTranscript_TCPListenEncrypted(t *testing.T) {
+	got := listenTranscript(t, wireEncryption(), wirePayload)
+	wiretest.Check(t, "tcp_listen_encrypted", got)
+
+	// The transcript is the preface line plus frames the peer can open.
+	preface, frames, ok := bytes.Cut(got, []byte("\n"))
+	require.True(t, ok)
+	require.Contains(t, string(preface), `"psk_kdf":"legacy"`)
+	r := sec.NewClientPSK([]byte(wirePSK)).Wrap(nopCloser{bytes.NewReader(frames)}, wireTunnelID)
+	buf := make([]byte, len(wirePayload))
+	n, err := r.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, string(wirePayload), string(buf[:n]))
+}
+
+func TestWireTranscript_UDP(t *testing.T) {
+	var rec wiretest.Recorder
+	require.NoError(t, sendUDPPreface(&rec, "127.0.0.1:53", wireTunnelID, wireInstanceID, config.EncryptionSettings{}))
+	for _, packet := range [][]byte{{0xde, 0xad, 0xbe, 0xef}, bytes.Repeat([]byte{0x5a}, 300)} {
+		require.NoError(t, writeUDPPacket(&rec, packet))
+	}
+	wiretest.Check(t, "udp", rec.Bytes())
+}
+
+func TestWireTranscript_UDPEncrypted(t *testing.T) {
+	var rec wiretest.Recorder
+	enc := wireEncryption()
+	require.NoError(t, sendUDPPreface(&rec, "127.0.0.1:53", wireTunnelID, wireInstanceID, enc))
+	w := WrapClientStream(nopCloser{&rec}, wireTunnelID, enc)
+	require.NoError(t, writeUDPPacket(w, []byte{0xde, 0xad, 0xbe, 0xef}))
+	wiretest.Check(t, "udp_encrypted", rec.Bytes())
+}
+
+// TestWireTranscript_QUICDatagram records one datagram frame per line.
+func TestWireTranscript_QUICDatagram(t *testing.T) {
+	var rec wiretest.Recorder
+	for _, data := range [][]byte{{0xde, 0xad, 0xbe, 0xef}, []byte("second datagram")} {
+		b, err := encodeQUICDatagram(wireTunnelID, "127.0.0.1:40000", "dp-token-0001", "127.0.0.1:53", data)
+		require.NoError(t, err)
+		_, _ = rec.Write(b)
+		_, _ = rec.Write([]byte("\n"))
+	}
+	wiretest.Check(t, "quic_datagram", rec.Bytes())
+}
@@ -0,0 +1,58 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"errors"
+	"io"
+	"log"
+	"runtime/debug"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/fortunnels/client/internal/support"
+)
+
+// errDeadlineOwned is returned to code that tries to move the read deadline
+// of a session's WebSocket conn: a short one would end the whole session, not
+// just the caller's stream.
+var errDeadlineOwned = errors.New("the read deadline of a data-plane WebSocket belongs to its session; set a stream deadline instead")
+
+// wsDeadline is the one owner of the read deadline of a session's WebSocket
+// conn. Stream-level timeouts use smux stream deadlines.
+type wsDeadline struct {
+	conn  *websocket.Conn
+	clock support.Clock
+}
+
+// ExtendDeadline moves the read deadline wsReadTimeout past now; reason is
+// logged at DEBUG.
+func (d *wsDeadline) ExtendDeadline(reason string) {
+	//nolint:errcheck // best-effort read deadline
+	_ = d.conn.SetReadDeadline(d.clock.Now().Add(wsReadTimeout))
+	logDebug("data-plane read deadline extended by %s (%s)", wsReadTimeout, reason)
+}
+
+// deadlineGuard is a session's conn as smux sees it. It refuses deadlines,
+// which belong to the conn's wsDeadline, and at DEBUG logs the stack of the
+// caller that tried.
+type deadlineGuard struct {
+	io.ReadWriteCloser
+}
+
+func (g deadlineGuard) SetReadDeadline(time.Time) error {
+	return deadlineViolation("SetReadDeadline")
+}
+
+func (g deadlineGuard) SetDeadline(time.Time) error {
+	return deadlineViolation("SetDeadline")
+}
+
+func deadlineViolation(method string) error {
+	if support.DebugEnabled() {
+		log.Printf("[DEBUG] %s on a session-owned WebSocket refused: %v\n%s", method, errDeadlineOwned, debug.Stack())
+	}
+	return errDeadlineOwned
+}
@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xtaci/smux"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/support"
+	"github.com/fortunnels/client/shared/wsconn"
+)
+
+func TestDeadlineGuard_RefusesDeadlines(t *testing.T) {
+	logs := captureLog(t)
+	g := deadlineGuard{}
+	support.SetDebug(false)
+	assert.ErrorIs(t, g.SetReadDeadline(time.Now()), errDeadlineOwned)
+	assert.Empty(t, logs.String(), "only logged at DEBUG")
+
+	support.SetDebug(true)
+	t.Cleanup(func() { support.SetDebug(false) })
+	assert.ErrorIs(t, g.SetDeadline(time.Now()), errDeadlineOwned)
+	assert.Contains(t, logs.String(), "[DEBUG] SetDeadline on a session-owned WebSocket refused")
+	assert.Contains(t, logs.String(), "TestDeadlineGuard_RefusesDeadlines", "the stack of the caller")
+}
+
+// startEchoSmuxServer serves smux over WebSocket, echoing every stream.
+func startEchoSmuxServer(t *testing.T) string {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		sess, err := smux.Server(wsconn.NewWSConn(conn, wsconn.Options{}), smux.DefaultConfig())
+		if err != nil {
+			return
+		}
+		defer sess.Close()
+		for {
+			st, err := sess.AcceptStream()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer st.Close()
+				_, _ = io.Copy(st, st)
+			}()
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func echo(t *testing.T, sess *smux.Session, msg string) {
+	t.Helper()
+	st, err := sess.OpenStream()
+	require.NoError(t, err)
+	defer st.Close()
+	_, err = st.Write([]byte(msg))
+	require.NoError(t, err)
+	require.NoError(t, st.SetReadDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, len(msg))
+	_, err = io.ReadFull(st, buf)
+	require.NoError(t, err)
+	assert.Equal(t, msg, string(buf))
+}
+
+func TestWSSession_StreamDeadlineLeavesSessionDeadline(t *testing.T) {
+	conn, _, err := websocket.DefaultDialer.Dial(startEchoSmuxServer(t), nil)
+	require.NoError(t, err)
+	settings := config.RuntimeSettings{SmuxKeepAliveInterval: 10 * time.Second, SmuxKeepAliveTimeout: 30 * time.Second}
+	sess, err := setupWSSmuxSessionWithPongs(conn, settings, nil, support.RealClock)
+	require.NoError(t, err)
+	t.Cleanup(func() { sess.Close() })
+
+	// A short stream deadline, like an echo check's, expires on its stream
+	// only.
+	st, err := sess.OpenStream()
+	require.NoError(t, err)
+	require.NoError(t, st.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	_, err = st.Read(make([]byte, 1))
+	require.True(t, errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, smux.ErrTimeout), "err = %v", err)
+	st.Close()
+
+	time.Sleep(100 * time.Millisecond)
+	assert.False(t, sess.IsClosed(), "the session outlives the stream deadline")
+	echo(t, sess, "still alive")
+}
@@ -4,6 +4,9 @@
 package dataplane
 
 import (
+	"errors"
+	"fmt"
+	"net"
 	"sync"
 	"time"
 
@@ -11,61 +14,218 @@ import (
 	"github.com/xtaci/smux"
 
 	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/support"
 	"github.com/fortunnels/client/shared/wsconn"
 )
 
-func configureWSReadKeepalive(conn *websocket.Conn) {
-	//nolint:errcheck // best-effort read deadline
-	_ = conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
-	conn.SetPongHandler(func(string) error {
-		//nolint:errcheck // pong handler best-effort deadline refresh
-		_ = conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+// configureWSReadKeepalive sets the read deadline of conn wsReadTimeout from
+// clock's now and pushes it back with every pong, through the conn's
+// wsDeadline. The deadline is a socket one: a fake clock must start at the
+// wall-clock time for a real conn. The server's close code is observed for
+// the exit post-mortem.
+func configureWSReadKeepalive(conn *websocket.Conn, pongs *pongWaiter, clock support.Clock) {
+	closeHandler := conn.CloseHandler()
+	conn.SetCloseHandler(func(code int, text string) error {
+		support.Causes.ObserveClose(code, "server closed data-plane session")
+		return closeHandler(code, text)
+	})
+	deadline := &wsDeadline{conn: conn, clock: clock}
+	deadline.ExtendDeadline("session start")
+	conn.SetPongHandler(func(appData string) error {
+		deadline.ExtendDeadline("pong")
+		if pongs != nil {
+			pongs.deliver(appData)
+		}
 		return nil
 	})
 }
 
-func setupWSSmuxSession(conn *websocket.Conn, settings config.RuntimeSettings) (*smux.Session, error) {
-	configureWSReadKeepalive(conn)
+// smuxFrameOverhead is the header smux puts before every frame's payload:
+// version, command, stream ID and length. A frame travels as one WebSocket
+// message.
+const smuxFrameOverhead = 8
 
+// smuxConfig is the smux configuration of a WebSocket session dialed with
+// settings.
+func smuxConfig(settings config.RuntimeSettings) *smux.Config {
 	cfg := smux.DefaultConfig()
 	cfg.KeepAliveInterval = settings.SmuxKeepAliveInterval
 	cfg.KeepAliveTimeout = settings.SmuxKeepAliveTimeout
+	if settings.SmuxMaxReceiveBuffer > 0 {
+		cfg.MaxReceiveBuffer = settings.SmuxMaxReceiveBuffer
+	}
+	return cfg
+}
+
+// wsOptions completes opts for a WebSocket carrying smux frames of up to
+// frameSize bytes: an unset message cap fits the largest frame and its
+// header, and never goes below wsconn's default since the server's frames
+// may be larger than ours. A cap that cannot hold such a frame is an error:
+// writes of it would be rejected and reads of it would kill the connection.
+func wsOptions(frameSize int, opts wsconn.Options) (wsconn.Options, error) {
+	need := int64(frameSize + smuxFrameOverhead)
+	if opts.MaxMessageSize <= 0 {
+		opts.MaxMessageSize = max(wsconn.MaxWebSocketMessageSize, need)
+	}
+	if need > opts.MaxMessageSize {
+		return opts, fmt.Errorf("smux frame size %d plus its %d-byte header exceeds the WebSocket message cap of %d bytes", frameSize, smuxFrameOverhead, opts.MaxMessageSize)
+	}
+	return opts, nil
+}
+
+// setupWSSmuxSessionWithPongs starts an smux client over conn with pong frames
+// routed to pongs so health probes and adaptive ping can measure RTT.
+func setupWSSmuxSessionWithPongs(conn *websocket.Conn, settings config.RuntimeSettings, pongs *pongWaiter, clock support.Clock) (*smux.Session, error) {
+	configureWSReadKeepalive(conn, pongs, clock)
 
-	sess, err := smux.Client(wsconn.NewWSConn(conn), cfg)
+	cfg := smuxConfig(settings)
+	opts, err := wsOptions(cfg.MaxFrameSize, wsconn.Options{})
 	if err != nil {
 		return nil, err
 	}
+	mc := &meteredConn{ReadWriteCloser: wsconn.NewWSConn(conn, opts), wire: &processWire}
+	// Stream timeouts must not reach the conn (see wsDeadline).
+	sess, err := smux.Client(deadlineGuard{mc}, cfg)
+	if err != nil {
+		return nil, err
+	}
+	support.Go(support.PanicScope{Role: "stall monitor"}, func() {
+		monitorStalls(sess, mc, &processStalls, cfg.MaxReceiveBuffer)
+	})
+	release := track(&processFDs.sockets)
+	go func() {
+		<-sess.CloseChan()
+		release()
+	}()
 	return sess, nil
 }
 
-// StartPingLoop sends WebSocket ping frames until done is closed.
-func StartPingLoop(done <-chan struct{}, conn *websocket.Conn, ticker *time.Ticker, pingTimeout time.Duration) {
+// StartPingLoop sends WebSocket ping frames until done is closed or conn is.
+func StartPingLoop(done <-chan struct{}, conn *websocket.Conn, ticker support.Ticker, pingTimeout time.Duration) {
 	go func() {
+		defer support.Recover(support.PanicScope{Role: "ping loop"})
+		defer track(&processPings.loops)()
 		for {
 			select {
-			case <-ticker.C:
+			case <-ticker.C():
 				deadline := time.Now().Add(pingTimeout)
-				//nolint:errcheck // best-effort ping
-				_ = conn.WriteControl(websocket.PingMessage, nil, deadline)
+				if err := conn.WriteControl(websocket.PingMessage, nil, deadline); connClosed(err) {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// connClosed reports whether a write failed because the conn is closed, for
+// good: a ping loop ends with its conn rather than with the session that
+// replaces it. Other write errors, such as a timeout behind a large frame,
+// leave the conn usable.
+func connClosed(err error) bool {
+	return errors.Is(err, net.ErrClosed) || errors.Is(err, websocket.ErrCloseSent)
+}
+
+// startDataPlanePing starts the ping loop for a data-plane connection: fixed
+// interval pings, or tuner-driven ones when tuner is set, timed by clock.
+// With pongs the loop matches pongs to its pings and closes conn once
+// settings.PingLossThreshold of them in a row went missing. The returned
+// ticker (nil in adaptive mode) is stopped by the caller.
+func startDataPlanePing(done <-chan struct{}, conn *websocket.Conn, settings config.RuntimeSettings, pongs *pongWaiter, tuner *pingTuner, clock support.Clock) support.Ticker {
+	if pongs == nil {
+		ticker := clock.NewTicker(settings.PingInterval)
+		StartPingLoop(done, conn, ticker, settings.PingTimeout)
+		return ticker
+	}
+	health := newPingHealth(settings.PingLossThreshold, clock)
+	pongs.track(health)
+	if tuner != nil {
+		startAdaptivePingLoop(done, conn, pongs, tuner, health, settings.PingTimeout, clock)
+		return nil
+	}
+	ticker := clock.NewTicker(settings.PingInterval)
+	startTrackedPingLoop(done, conn, ticker, health, settings.PingTimeout)
+	return ticker
+}
+
+// startTrackedPingLoop sends a timestamped ping on every tick; a ping whose
+// pong has not arrived by the next tick is lost.
+func startTrackedPingLoop(done <-chan struct{}, conn *websocket.Conn, ticker support.Ticker, health *pingHealth, pingTimeout time.Duration) {
+	go func() {
+		defer support.Recover(support.PanicScope{Role: "ping loop"})
+		defer track(&processPings.loops)()
+		for {
+			select {
+			case <-ticker.C():
+			case <-done:
+				return
+			}
+			payload, dead := health.ping()
+			if dead {
+				health.closeDead(conn)
+				return
+			}
+			deadline := time.Now().Add(pingTimeout)
+			// Other write errors surface as a missing pong.
+			if err := conn.WriteControl(websocket.PingMessage, []byte(payload), deadline); connClosed(err) {
+				return
+			}
+		}
+	}()
+}
+
+// startAdaptivePingLoop sends pings whose pongs are matched by payload: a pong
+// within pingTimeout is an RTT sample, a missing one a loss. tuner picks the
+// delay before the next ping.
+func startAdaptivePingLoop(done <-chan struct{}, conn *websocket.Conn, pongs *pongWaiter, tuner *pingTuner, health *pingHealth, pingTimeout time.Duration, clock support.Clock) {
+	go func() {
+		defer support.Recover(support.PanicScope{Role: "adaptive ping loop"})
+		defer track(&processPings.loops)()
+		timer := clock.NewTimer(tuner.current())
+		defer timer.Stop()
+		for {
+			select {
+			case <-timer.C():
 			case <-done:
 				return
 			}
+			rtt, err := probeWSPing(conn, pongs, pingTimeout)
+			if connClosed(err) {
+				return
+			}
+			if health.observe(rtt, err != nil) {
+				health.closeDead(conn)
+				return
+			}
+			next := tuner.observe(rtt, err != nil)
+			st := tuner.stats()
+			logDebug("data-plane ping rtt=%s jitter=%s loss=%.2f next=%s err=%v",
+				st.RTT.Round(time.Millisecond), st.Jitter.Round(time.Millisecond), st.Loss, next, err)
+			timer.Reset(next)
 		}
 	}()
 }
 
+func stopTicker(t support.Ticker) {
+	if t != nil {
+		t.Stop()
+	}
+}
+
 // StartControlPingLoop sends pings and closes done when a ping write fails.
 func StartControlPingLoop(
 	done chan struct{},
 	doneOnce *sync.Once,
 	conn *websocket.Conn,
-	ticker *time.Ticker,
+	ticker support.Ticker,
 	pingTimeout time.Duration,
 ) {
 	go func() {
+		defer support.Recover(support.PanicScope{Role: "control ping loop"})
 		for {
 			select {
-			case <-ticker.C:
+			case <-ticker.C():
 				deadline := time.Now().Add(pingTimeout)
 				if err := conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
 					doneOnce.Do(func() { close(done) })
@@ -78,15 +238,15 @@ func StartControlPingLoop(
 	}()
 }
 
-func sleepReconnectBackoff(stopped func() bool, d time.Duration) {
+// sleepReconnectBackoff waits d on clock, or until stopped is closed.
+func sleepReconnectBackoff(clock support.Clock, stopped <-chan struct{}, d time.Duration) {
 	if d <= 0 {
 		return
 	}
-	deadline := time.Now().Add(d)
-	for time.Now().Before(deadline) {
-		if stopped() {
-			return
-		}
-		time.Sleep(50 * time.Millisecond)
+	timer := clock.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+	case <-stopped:
 	}
 }
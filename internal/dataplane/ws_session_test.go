@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package dataplane
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xtaci/smux"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/support"
+	"github.com/fortunnels/client/shared/wsconn"
+)
+
+func TestWSOptions_FitSmuxFrames(t *testing.T) {
+	opts, err := wsOptions(smuxConfig(config.RuntimeSettings{}).MaxFrameSize, wsconn.Options{})
+	require.NoError(t, err)
+	assert.EqualValues(t, wsconn.MaxWebSocketMessageSize, opts.MaxMessageSize, "the default cap holds smux's frames")
+
+	opts, err = wsOptions(65535, wsconn.Options{MaxMessageSize: 65535 + smuxFrameOverhead})
+	require.NoError(t, err, "a cap of exactly frame and header")
+	assert.EqualValues(t, 65535+smuxFrameOverhead, opts.MaxMessageSize)
+
+	_, err = wsOptions(65535, wsconn.Options{MaxMessageSize: 65535 + smuxFrameOverhead - 1})
+	require.EqualError(t, err, "smux frame size 65535 plus its 8-byte header exceeds the WebSocket message cap of 65542 bytes")
+}
+
+// writeSizes records the size of every write to a connection.
+type writeSizes struct {
+	net.Conn
+	mu    sync.Mutex
+	sizes []int
+}
+
+func (w *writeSizes) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	w.sizes = append(w.sizes, len(p))
+	w.mu.Unlock()
+	return w.Conn.Write(p)
+}
+
+func (w *writeSizes) largest() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return slices.Max(w.sizes)
+}
+
+func TestWSOptions_OverheadIsSmuxHeader(t *testing.T) {
+	a, b := net.Pipe()
+	rec := &writeSizes{Conn: a}
+	cfg := smux.DefaultConfig()
+	cli, err := smux.Client(rec, cfg)
+	require.NoError(t, err)
+	defer cli.Close()
+	srv, err := smux.Server(b, cfg)
+	require.NoError(t, err)
+	defer srv.Close()
+	go func() {
+		st, err := srv.AcceptStream()
+		if err == nil {
+			_, _ = io.Copy(io.Discard, st)
+		}
+	}()
+
+	st, err := cli.OpenStream()
+	require.NoError(t, err)
+	_, err = st.Write(make([]byte, 4*cfg.MaxFrameSize))
+	require.NoError(t, err)
+	// Each write is one WebSocket message: a full frame is its payload and
+	// the header wsOptions makes room for.
+	assert.Equal(t, cfg.MaxFrameSize+smuxFrameOverhead, rec.largest())
+}
+
+func TestWSReadKeepalive_ObservesServerCloseCode(t *testing.T) {
+	support.Causes.Reset()
+	support.Causes.Start()
+	defer support.Causes.Reset()
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		msg := websocket.FormatCloseMessage(websocket.CloseServiceRestart, "draining")
+		_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		_, _, _ = conn.ReadMessage()
+	}))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	configureWSReadKeepalive(conn, nil, support.RealClock)
+	_, _, err = conn.ReadMessage()
+	var ce *websocket.CloseError
+	require.ErrorAs(t, err, &ce, "the close is still answered and returned")
+
+	// The session is redialed; once the data plane fails for good its
+	// error carries the last close code.
+	cause, ok := support.Causes.Resolve(support.WithExitCode(support.ExitDataPlane, errors.New("❌ Data-plane serve stopped: session closed")))
+	require.True(t, ok)
+	assert.Equal(t, support.CauseDataPlane, cause.Source)
+	assert.Equal(t, "Data-plane serve stopped: session closed (code 1012 service restart)", cause.String())
+	assert.Equal(t, support.ExitDataPlane, cause.ExitCode())
+}
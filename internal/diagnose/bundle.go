@@ -0,0 +1,200 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+// Package diagnose builds the support bundle of client diagnose: one
+// tar.gz with the resolved configuration, connectivity probes and system
+// details, all passed through a support.Redactor.
+package diagnose
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/fortunnels/client/internal/config"
+	"github.com/fortunnels/client/internal/control"
+	"github.com/fortunnels/client/internal/support"
+)
+
+// bundleDir is the directory every file of the archive sits in.
+const bundleDir = "fortunnels-diagnose/"
+
+// Options describes what goes into a bundle.
+type Options struct {
+	// Config is the configuration as parsed for a normal run.
+	Config *config.Config
+	// ConfigErr is Config's validation error, if any.
+	ConfigErr error
+	Version   string
+	// Args is the command line after secret flags were cleared.
+	Args []string
+	// ProbeTimeout bounds each connectivity probe; 0 means 3s.
+	ProbeTimeout time.Duration
+}
+
+type bundleFile struct {
+	name string
+	body []byte
+}
+
+// Write runs the probes and writes the bundle to w as a gzip-compressed
+// tar. It returns the names of the files in the archive.
+func Write(w io.Writer, opts Options) ([]string, error) {
+	timeout := opts.ProbeTimeout
+	if timeout <= 0 {
+		timeout = defaultProbeTimeout
+	}
+	now := time.Now().UTC()
+	probes := runProbes(context.Background(), opts.Config, timeout)
+
+	cfgDoc := struct {
+		Args            []string         `json:"args"`
+		ValidationError string           `json:"validation_error,omitempty"`
+		Settings        []config.Setting `json:"settings"`
+	}{Args: opts.Args, Settings: opts.Config.Settings()}
+	if opts.ConfigErr != nil {
+		cfgDoc.ValidationError = opts.ConfigErr.Error()
+	}
+	cfgJSON, err := json.MarshalIndent(cfgDoc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal config: %w", err)
+	}
+	probesJSON, err := json.MarshalIndent(probes, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal probes: %w", err)
+	}
+
+	files := []bundleFile{
+		{"README.txt", []byte(readme(now))},
+		{"version.txt", []byte(versionInfo(opts.Version))},
+		{"config.json", append(cfgJSON, '\n')},
+		{"connectivity.json", append(probesJSON, '\n')},
+		{"system.txt", []byte(systemInfo())},
+	}
+	files = append(files, tlsChainFiles(opts.Config.ServerURL)...)
+	return writeArchive(w, files, support.NewRedactor(opts.Config.SecretValues()...), now)
+}
+
+// tlsChainFiles adds the server's chains cached by --tls-chain-cache, if any,
+// so certificate problems can be looked at offline.
+func tlsChainFiles(serverURL string) []bundleFile {
+	u, err := url.Parse(serverURL)
+	if err != nil || u.Hostname() == "" {
+		return nil
+	}
+	dir, err := config.TLSChainCacheDir()
+	if err != nil {
+		return nil
+	}
+	var files []bundleFile
+	for _, path := range control.NewTLSChainCache(dir).Files(u.Hostname()) {
+		body, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		files = append(files, bundleFile{"tls-chains/" + filepath.Base(path), body})
+	}
+	return files
+}
+
+// writeArchive redacts every file and writes them as a tar.gz.
+func writeArchive(w io.Writer, files []bundleFile, r *support.Redactor, now time.Time) ([]string, error) {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		body := []byte(r.Redact(string(f.body)))
+		hdr := &tar.Header{Name: bundleDir + f.name, Mode: 0o600, Size: int64(len(body)), ModTime: now}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(body); err != nil {
+			return nil, err
+		}
+		names = append(names, hdr.Name)
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return names, gz.Close()
+}
+
+func readme(now time.Time) string {
+	return "fortunnels client support bundle, generated " + now.Format(time.RFC3339) + "\n\n" +
+		"version.txt        client version and build information\n" +
+		"config.json        resolved settings with their source; secrets are redacted\n" +
+		"connectivity.json  DNS, TCP, TLS, HTTP and WS/QUIC/DTLS handshake probes against the server\n" +
+		"system.txt         OS and network interface summary\n\n" +
+		"Not included: the client logs to stderr only, so attach the output of the failing run,\n" +
+		"preferably with LOG_LEVEL=debug. No tunnel was created and no state of a running client\n" +
+		"is captured.\n"
+}
+
+// Summary describes the client, its settings and the system for a crash
+// report: version.txt, the non-default settings of config.json and
+// system.txt of a bundle, redacted the same way.
+func Summary(cfg *config.Config, version string) string {
+	var b strings.Builder
+	b.WriteString(versionInfo(version))
+	b.WriteString("settings:\n")
+	for _, s := range cfg.Settings() {
+		if s.Source != "default" {
+			fmt.Fprintf(&b, "  %s=%s (%s)\n", s.Name, s.Value, s.Source)
+		}
+	}
+	b.WriteString(systemInfo())
+	return support.NewRedactor(cfg.SecretValues()...).Redact(b.String())
+}
+
+func versionInfo(version string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "fortunnels-client %s\n", version)
+	fmt.Fprintf(&b, "go %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	if info, ok := debug.ReadBuildInfo(); ok {
+		fmt.Fprintf(&b, "module %s %s\n", info.Main.Path, info.Main.Version)
+		for _, s := range info.Settings {
+			if strings.HasPrefix(s.Key, "vcs.") || s.Key == "CGO_ENABLED" || s.Key == "-tags" {
+				fmt.Fprintf(&b, "%s=%s\n", s.Key, s.Value)
+			}
+		}
+	}
+	return b.String()
+}
+
+func systemInfo() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "os: %s/%s, %d CPUs\n", runtime.GOOS, runtime.GOARCH, runtime.NumCPU())
+	if h, err := os.Hostname(); err == nil {
+		fmt.Fprintf(&b, "hostname: %s\n", h)
+	}
+	for _, env := range []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy"} {
+		if v := os.Getenv(env); v != "" {
+			fmt.Fprintf(&b, "%s=%s\n", env, v)
+		}
+	}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		fmt.Fprintf(&b, "interfaces: %v\n", err)
+		return b.String()
+	}
+	b.WriteString("interfaces:\n")
+	for _, ifc := range ifaces {
+		fmt.Fprintf(&b, "  %s mtu=%d flags=%s\n", ifc.Name, ifc.MTU, ifc.Flags)
+		addrs, _ := ifc.Addrs()
+		for _, a := range addrs {
+			fmt.Fprintf(&b, "    %s\n", a)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,173 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package diagnose
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fortunnels/client/internal/config"
+	dp "github.com/fortunnels/client/internal/dataplane"
+	"github.com/fortunnels/client/internal/support"
+)
+
+// defaultProbeTimeout bounds each probe; they run in parallel, so the whole
+// set takes about as long as the slowest one.
+const defaultProbeTimeout = 3 * time.Second
+
+// Probe is the outcome of one connectivity check against the server.
+type Probe struct {
+	Name       string  `json:"name"`
+	Target     string  `json:"target"`
+	OK         bool    `json:"ok"`
+	DurationMS float64 `json:"duration_ms"`
+	Detail     string  `json:"detail,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+type probeFunc func(ctx context.Context) (detail string, err error)
+
+// runProbes checks each layer on the way to the server, from DNS to the
+// data-plane handshakes, and returns the results in that order.
+func runProbes(ctx context.Context, cfg *config.Config, timeout time.Duration) []Probe {
+	u, err := url.Parse(strings.TrimSpace(cfg.ServerURL))
+	if err != nil || u.Hostname() == "" {
+		return []Probe{{Name: "server-url", Target: cfg.ServerURL, Error: "invalid server URL"}}
+	}
+	host := u.Hostname()
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	addr := net.JoinHostPort(host, port)
+	healthURL, err := support.ServerEndpoint(cfg.ServerURL, "/api/health", nil)
+	if err != nil {
+		return []Probe{{Name: "server-url", Target: cfg.ServerURL, Error: "invalid server URL"}}
+	}
+	rt := cfg.RuntimeSettings()
+
+	type check struct {
+		name, target string
+		run          probeFunc
+	}
+	checks := []check{
+		{"dns", host, func(ctx context.Context) (string, error) {
+			addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+			return strings.Join(addrs, ", "), err
+		}},
+		{"tcp", addr, func(ctx context.Context) (string, error) {
+			var d net.Dialer
+			c, err := d.DialContext(ctx, "tcp", addr)
+			if err != nil {
+				return "", err
+			}
+			defer c.Close()
+			return "local " + c.LocalAddr().String(), nil
+		}},
+	}
+	if u.Scheme == "https" {
+		checks = append(checks, check{"tls", addr, func(ctx context.Context) (string, error) {
+			d := tls.Dialer{Config: &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}}
+			c, err := d.DialContext(ctx, "tcp", addr)
+			if err != nil {
+				return "", err
+			}
+			defer c.Close()
+			return tlsDetail(c.(*tls.Conn).ConnectionState()), nil
+		}})
+	}
+	checks = append(checks,
+		check{"http", healthURL, func(ctx context.Context) (string, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, healthURL, nil)
+			if err != nil {
+				return "", err
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return "", err
+			}
+			resp.Body.Close()
+			return resp.Status, nil
+		}},
+		check{"ws-handshake", cfg.ServerURL, func(ctx context.Context) (string, error) {
+			status, err := dp.ProbeWS(ctx, cfg.ServerURL)
+			if status != 0 {
+				return "HTTP " + strconv.Itoa(status), err
+			}
+			return "", err
+		}},
+		check{"quic-handshake", net.JoinHostPort(host, rt.QUICPortString()), func(ctx context.Context) (string, error) {
+			return "", dp.ProbeQUIC(ctx, cfg.ServerURL, rt.QUICPortString())
+		}},
+		check{"dtls-handshake", net.JoinHostPort(host, rt.DTLSPortString()), func(ctx context.Context) (string, error) {
+			return "", dp.ProbeDTLS(ctx, cfg.ServerURL, rt.DTLSPortString())
+		}},
+	)
+
+	out := make([]Probe, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out[i] = runProbe(ctx, c.name, c.target, timeout, c.run)
+		}()
+	}
+	wg.Wait()
+	return out
+}
+
+// runProbe times run under its own deadline. run must honor ctx; a probe
+// that does not is still abandoned at the deadline.
+func runProbe(ctx context.Context, name, target string, timeout time.Duration, run probeFunc) Probe {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	type result struct {
+		detail string
+		err    error
+	}
+	done := make(chan result, 1)
+	start := time.Now()
+	go func() {
+		detail, err := run(ctx)
+		done <- result{detail, err}
+	}()
+	var r result
+	select {
+	case r = <-done:
+	case <-ctx.Done():
+		r = result{err: fmt.Errorf("no answer within %s", timeout)}
+	}
+	p := Probe{
+		Name:       name,
+		Target:     target,
+		OK:         r.err == nil,
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+		Detail:     r.detail,
+	}
+	if r.err != nil {
+		p.Error = r.err.Error()
+	}
+	return p
+}
+
+func tlsDetail(st tls.ConnectionState) string {
+	detail := tls.VersionName(st.Version) + " " + tls.CipherSuiteName(st.CipherSuite)
+	if len(st.PeerCertificates) > 0 {
+		cert := st.PeerCertificates[0]
+		detail += fmt.Sprintf(", certificate %s expires %s", cert.Subject.CommonName, cert.NotAfter.UTC().Format(time.RFC3339))
+	}
+	return detail
+}
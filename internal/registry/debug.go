@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/fortunnels/client/internal/support"
+)
+
+// countersPath is the debug endpoint's route of the live Counters.
+const countersPath = "/counters"
+
+// Counters are a client's live traffic: payload bytes in each direction (up
+// is toward the server) and streams served. Memory is what each buffering
+// feature holds of its --memory-budget.
+type Counters struct {
+	BytesUp   int64                 `json:"bytes_up"`
+	BytesDown int64                 `json:"bytes_down"`
+	Streams   int64                 `json:"streams"`
+	Memory    []support.MemoryUsage `json:"memory,omitempty"`
+}
+
+// ServeDebug serves the debug endpoint on the Unix socket path, answering
+// GET /counters with sample(). A socket left at path by a dead client is
+// replaced. The returned func stops the endpoint and removes the socket.
+func ServeDebug(path string, sample func() Counters) (func(), error) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("debug endpoint: %w", err)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("debug endpoint: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+countersPath, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(sample())
+	})
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() { _ = srv.Serve(ln) }()
+	return func() { _ = srv.Close() }, nil
+}
+
+// FetchCounters asks the debug endpoint on the Unix socket path for the
+// client's counters, giving up after timeout.
+func FetchCounters(path string, timeout time.Duration) (Counters, error) {
+	var c Counters
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		},
+	}
+	defer client.CloseIdleConnections()
+	req, err := http.NewRequestWithContext(context.Background(), "GET", "http://client"+countersPath, http.NoBody)
+	if err != nil {
+		return c, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return c, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return c, fmt.Errorf("debug endpoint returned status %d", resp.StatusCode)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&c)
+	return c, err
+}
@@ -0,0 +1,18 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+//go:build !windows
+
+package registry
+
+import (
+	"errors"
+	"syscall"
+)
+
+// pidAlive probes pid with signal 0; EPERM means it exists under another
+// user.
+func pidAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
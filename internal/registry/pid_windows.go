@@ -0,0 +1,18 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+//go:build windows
+
+package registry
+
+import "os"
+
+// pidAlive opens pid, which fails once the process is gone.
+func pidAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = p.Release()
+	return true
+}
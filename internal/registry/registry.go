@@ -0,0 +1,202 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+// Package registry lists the clients running on this machine. Each serving
+// client keeps a descriptor <pid>.json in Dir, next to the Unix socket of its
+// debug endpoint <pid>.sock, and removes both on shutdown; List reads them
+// back for `client ps` and collects the ones of processes that are gone.
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// corruptGrace is how long a descriptor that does not decode is left alone
+// before List removes it; a writer may still be replacing it.
+const corruptGrace = time.Minute
+
+// Descriptor describes one running client.
+type Descriptor struct {
+	PID       int    `json:"pid"`
+	TunnelID  string `json:"tunnel_id"`
+	PublicURL string `json:"public_url,omitempty"`
+	// Mode is the tunnel protocol for a served target, "listen" for a
+	// local listener.
+	Mode string `json:"mode"`
+	// Target is the local address: the served target or the listener.
+	Target    string    `json:"target,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// DebugSocket is the Unix socket of the client's debug endpoint
+	// (ServeDebug); empty when it has none.
+	DebugSocket string `json:"debug_socket,omitempty"`
+}
+
+// processAlive reports whether a process with pid exists; tests substitute
+// it.
+var processAlive = pidAlive
+
+// Dir is the registry directory: fortunnels under $XDG_RUNTIME_DIR, or a
+// per-user directory under the temporary directory without one.
+func Dir() string {
+	if d := os.Getenv("XDG_RUNTIME_DIR"); d != "" {
+		return filepath.Join(d, "fortunnels")
+	}
+	name := "fortunnels"
+	if uid := os.Getuid(); uid >= 0 {
+		name += "-" + strconv.Itoa(uid)
+	}
+	return filepath.Join(os.TempDir(), name)
+}
+
+// ensureDir creates dir for this user only and refuses one other users can
+// write to.
+func ensureDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("registry: %w", err)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("registry: %w", err)
+	}
+	if info.Mode().Perm()&0o022 != 0 {
+		return fmt.Errorf("registry: %s is writable by other users", dir)
+	}
+	return nil
+}
+
+// Entry is this process's descriptor in the registry.
+type Entry struct {
+	path string
+
+	mu sync.Mutex
+	d  Descriptor
+}
+
+// Register writes d, with this process's PID, into dir. Close removes it.
+func Register(dir string, d Descriptor) (*Entry, error) {
+	if err := ensureDir(dir); err != nil {
+		return nil, err
+	}
+	d.PID = os.Getpid()
+	if d.StartedAt.IsZero() {
+		d.StartedAt = time.Now()
+	}
+	e := &Entry{path: filepath.Join(dir, strconv.Itoa(d.PID)+".json"), d: d}
+	if err := e.write(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// SocketPath is the path of the debug endpoint socket of pid in dir.
+func SocketPath(dir string, pid int) string {
+	return filepath.Join(dir, strconv.Itoa(pid)+".sock")
+}
+
+// Update changes the descriptor with fn and rewrites it.
+func (e *Entry) Update(fn func(*Descriptor)) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fn(&e.d)
+	return e.write()
+}
+
+// write replaces the descriptor file through a rename, so readers never see
+// it half written. e.mu is held (or e not yet shared).
+func (e *Entry) write() error {
+	e.d.UpdatedAt = time.Now()
+	data, err := json.Marshal(e.d)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(e.path), "."+filepath.Base(e.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("registry: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("registry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("registry: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), e.path); err != nil {
+		return fmt.Errorf("registry: %w", err)
+	}
+	return nil
+}
+
+// Close removes the descriptor.
+func (e *Entry) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := os.Remove(e.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("registry: %w", err)
+	}
+	return nil
+}
+
+// List returns the descriptors of the live clients in dir, oldest first. It
+// removes the descriptors and sockets of processes that are gone, and
+// descriptors that have not decoded for corruptGrace. A missing dir lists
+// nothing.
+func List(dir string) ([]Descriptor, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("registry: %w", err)
+	}
+	now := time.Now()
+	var out []Descriptor
+	for _, ent := range entries {
+		name := ent.Name()
+		pid, err := strconv.Atoi(strings.TrimSuffix(name, ".json"))
+		if !strings.HasSuffix(name, ".json") || err != nil || pid <= 0 {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if !processAlive(pid) {
+			_ = os.Remove(path)
+			_ = os.Remove(SocketPath(dir, pid))
+			continue
+		}
+		d, err := readDescriptor(path)
+		if err != nil || d.PID != pid {
+			if info, statErr := os.Stat(path); statErr == nil && now.Sub(info.ModTime()) > corruptGrace {
+				_ = os.Remove(path)
+			}
+			continue
+		}
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].StartedAt.Equal(out[j].StartedAt) {
+			return out[i].StartedAt.Before(out[j].StartedAt)
+		}
+		return out[i].PID < out[j].PID
+	})
+	return out, nil
+}
+
+func readDescriptor(path string) (Descriptor, error) {
+	var d Descriptor
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return d, err
+	}
+	err = json.Unmarshal(data, &d)
+	return d, err
+}
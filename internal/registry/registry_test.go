@@ -0,0 +1,144 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package registry
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// alivePIDs makes processAlive report only pids as running.
+func alivePIDs(t *testing.T, pids ...int) {
+	t.Helper()
+	prev := processAlive
+	processAlive = func(pid int) bool {
+		for _, p := range pids {
+			if p == pid {
+				return true
+			}
+		}
+		return false
+	}
+	t.Cleanup(func() { processAlive = prev })
+}
+
+func writeDescriptor(t *testing.T, dir string, d Descriptor) string {
+	t.Helper()
+	data, err := json.Marshal(d)
+	require.NoError(t, err)
+	path := filepath.Join(dir, strconv.Itoa(d.PID)+".json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func writeRaw(t *testing.T, dir, name, data string, age time.Duration) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+	at := time.Now().Add(-age)
+	require.NoError(t, os.Chtimes(path, at, at))
+	return path
+}
+
+func TestList_LiveStaleAndCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	writeDescriptor(t, dir, Descriptor{PID: 101, TunnelID: "t-b", Mode: "http", StartedAt: start.Add(time.Minute)})
+	writeDescriptor(t, dir, Descriptor{PID: 102, TunnelID: "t-a", Mode: "listen", StartedAt: start})
+	stale := writeDescriptor(t, dir, Descriptor{PID: 201, TunnelID: "t-gone", StartedAt: start})
+	staleSock := writeRaw(t, dir, "201.sock", "", 0)
+	partial := writeRaw(t, dir, "103.json", `{"pid":103,"tunnel_`, 0)
+	corrupt := writeRaw(t, dir, "104.json", `not json`, 2*corruptGrace)
+	foreign := writeRaw(t, dir, "105.json", `{"pid":999}`, 2*corruptGrace)
+	tmp := writeRaw(t, dir, ".106.json.tmp123", `{"pid":106}`, 0)
+	other := writeRaw(t, dir, "notes.txt", "keep", 0)
+	alivePIDs(t, 101, 102, 103, 104, 105, 106)
+
+	got, err := List(dir)
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, "t-a", got[0].TunnelID, "oldest first")
+	assert.Equal(t, "t-b", got[1].TunnelID)
+
+	assert.NoFileExists(t, stale, "the process is gone")
+	assert.NoFileExists(t, staleSock)
+	assert.FileExists(t, partial, "may still be written")
+	assert.NoFileExists(t, corrupt, "undecodable for longer than corruptGrace")
+	assert.NoFileExists(t, foreign, "names another process")
+	assert.FileExists(t, tmp)
+	assert.FileExists(t, other)
+}
+
+func TestList_MissingDir(t *testing.T) {
+	got, err := List(filepath.Join(t.TempDir(), "none"))
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func TestRegister_UpdateAndClose(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "fortunnels")
+	e, err := Register(dir, Descriptor{TunnelID: "t-1", PublicURL: "https://a.example", Mode: "http", Target: "127.0.0.1:3000"})
+	require.NoError(t, err)
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(dir)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o700), info.Mode().Perm())
+	}
+
+	got, err := List(dir)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, os.Getpid(), got[0].PID)
+	assert.Equal(t, "https://a.example", got[0].PublicURL)
+	assert.False(t, got[0].StartedAt.IsZero())
+
+	require.NoError(t, e.Update(func(d *Descriptor) { d.PublicURL = "https://b.example" }))
+	got, err = List(dir)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, "https://b.example", got[0].PublicURL)
+
+	require.NoError(t, e.Close())
+	got, err = List(dir)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func TestRegister_RefusesSharedDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no Unix permissions")
+	}
+	dir := t.TempDir()
+	require.NoError(t, os.Chmod(dir, 0o777))
+	_, err := Register(dir, Descriptor{TunnelID: "t-1"})
+	assert.ErrorContains(t, err, "writable by other users")
+}
+
+func TestDebugEndpoint(t *testing.T) {
+	// Unix socket paths are short; t.TempDir can exceed the limit.
+	dir, err := os.MkdirTemp("", "ft")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := SocketPath(dir, 42)
+	require.NoError(t, os.WriteFile(path, nil, 0o600), "a socket left by a dead client")
+
+	stop, err := ServeDebug(path, func() Counters { return Counters{BytesUp: 10, BytesDown: 20, Streams: 3} })
+	require.NoError(t, err)
+	c, err := FetchCounters(path, 5*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, Counters{BytesUp: 10, BytesDown: 20, Streams: 3}, c)
+
+	stop()
+	assert.NoFileExists(t, path)
+	_, err = FetchCounters(path, time.Second)
+	assert.Error(t, err)
+}
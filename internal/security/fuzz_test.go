@@ -0,0 +1,127 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package security
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/fortunnels/client/internal/testsupport/allocs"
+)
+
+const fuzzTunnelID = "tunnel-123"
+
+var fuzzPSK = NewClientPSK([]byte("test-secret"))
+
+// sealFrames is the helper encoder of FuzzClientAEADRead: it splits payload
+// into up to three messages and seals each into a frame, as a peer would.
+func sealFrames(t *testing.T, payload []byte) (stream []byte, msgs [][]byte) {
+	t.Helper()
+	base := &mockReadWriteCloser{}
+	w := fuzzPSK.Wrap(base, fuzzTunnelID)
+	third := (len(payload) + 2) / 3
+	for rest := payload; ; {
+		msg := rest[:min(len(rest), third)]
+		if _, err := w.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, msg)
+		rest = rest[len(msg):]
+		if len(rest) == 0 {
+			return base.writeData, msgs
+		}
+	}
+}
+
+// mutateFrames applies edits to stream: each three bytes XOR the byte at a
+// big-endian position with a mask, and a last lone byte truncates that many
+// bytes from the end.
+func mutateFrames(stream, edits []byte) []byte {
+	out := bytes.Clone(stream)
+	for ; len(edits) >= 3 && len(out) > 0; edits = edits[3:] {
+		pos := int(binary.BigEndian.Uint16(edits)) % len(out)
+		out[pos] ^= edits[2]
+	}
+	if len(edits) == 1 {
+		out = out[:len(out)-min(len(out), int(edits[0]))]
+	}
+	return out
+}
+
+// readAllFrames reads r until it fails and returns every plaintext it gave
+// out, with the error that ended it.
+func readAllFrames(r io.Reader, bufSize int) ([][]byte, error) {
+	var got [][]byte
+	for {
+		buf := make([]byte, bufSize)
+		n, err := r.Read(buf)
+		if n > 0 || err == nil {
+			got = append(got, buf[:n])
+		}
+		if err != nil {
+			return got, err
+		}
+	}
+}
+
+func FuzzClientAEADRead(f *testing.F) {
+	// The vectors of the ClientAEAD tests, intact and with the frame length,
+	// nonce and tag damaged or cut short.
+	for _, payload := range []string{"hello, world", "round trip test data", "firstsecondthird", ""} {
+		f.Add([]byte(payload), []byte{})
+		f.Add([]byte(payload), []byte{0, 0, 0x80})
+		f.Add([]byte(payload), []byte{0, 3, 0x01})
+		f.Add([]byte(payload), []byte{0, 10, 0xff})
+		f.Add([]byte(payload), []byte{0, 40, 0x01})
+		f.Add([]byte(payload), []byte{5})
+	}
+
+	f.Fuzz(func(t *testing.T, payload, edits []byte) {
+		valid, msgs := sealFrames(t, payload)
+		stream := mutateFrames(valid, edits)
+
+		var got [][]byte
+		var err error
+		// Only authentic frames are read past, at most one per message, and
+		// each allocates a header, its ciphertext and plaintext and the
+		// caller's buffer; the frame that fails may declare up to
+		// MaxFramePayload before it does.
+		reads := len(msgs) + 1
+		limit := MaxFramePayload + FrameOverhead + 2*len(stream) + reads*(len(payload)+256) + 4096
+		allocs.Check(t, uint64(limit), func() {
+			got, err = readAllFrames(fuzzPSK.Wrap(&mockReadWriteCloser{readData: stream}, fuzzTunnelID), len(payload)+1)
+		})
+
+		if err == nil {
+			t.Fatal("reading ended without an error")
+		}
+		// Only sealed messages come out, whatever was done to the frames.
+		for _, pt := range got {
+			if !containsMsg(msgs, pt) {
+				t.Fatalf("returned unauthenticated plaintext %q", pt)
+			}
+		}
+		if bytes.Equal(stream, valid) {
+			if err != io.EOF || len(got) != len(msgs) {
+				t.Fatalf("intact frames: read %d of %d messages, then %v", len(got), len(msgs), err)
+			}
+			for i := range msgs {
+				if !bytes.Equal(got[i], msgs[i]) {
+					t.Fatalf("message %d is %q, want %q", i, got[i], msgs[i])
+				}
+			}
+		}
+	})
+}
+
+func containsMsg(msgs [][]byte, pt []byte) bool {
+	for _, m := range msgs {
+		if bytes.Equal(m, pt) {
+			return true
+		}
+	}
+	return false
+}
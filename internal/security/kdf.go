@@ -0,0 +1,233 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package security
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// KDF names accepted by --psk-kdf and declared in stream prefaces.
+const (
+	KDFAuto     = "auto"
+	KDFLegacy   = "legacy"
+	KDFArgon2id = "argon2id"
+)
+
+// argon2idSaltContext domain-separates the per-tunnel Argon2id salt.
+const argon2idSaltContext = "fortunnels-psk-argon2id-v1"
+
+// Bounds on peer-declared Argon2id parameters, so a preface cannot make the
+// receiver burn unbounded memory or CPU.
+const (
+	maxArgon2Time      = 10
+	maxArgon2MemoryKiB = 256 * 1024
+	maxArgon2Threads   = 16
+)
+
+// weakPSKBits is the entropy estimate below which a PSK draws a warning.
+const weakPSKBits = 80
+
+// KDF selects how the per-tunnel stream key is derived from the PSK.
+// Legacy is sha256(secret||tunnelID), for servers that predate Argon2id.
+type KDF struct {
+	Name      string
+	Time      uint32
+	MemoryKiB uint32
+	Threads   uint8
+}
+
+// LegacyKDF is the original sha256(secret||tunnelID) derivation.
+var LegacyKDF = KDF{Name: KDFLegacy}
+
+// Argon2idKDF uses the OWASP-recommended Argon2id minimum (19 MiB, t=2, p=1).
+var Argon2idKDF = KDF{Name: KDFArgon2id, Time: 2, MemoryKiB: 19 * 1024, Threads: 1}
+
+// String encodes k the way it is declared in the stream preface, e.g.
+// "argon2id;t=2;m=19456;p=1".
+func (k KDF) String() string {
+	if k.Name != KDFArgon2id {
+		return k.Name
+	}
+	return fmt.Sprintf("%s;t=%d;m=%d;p=%d", k.Name, k.Time, k.MemoryKiB, k.Threads)
+}
+
+// ParseKDF decodes a preface KDF declaration produced by KDF.String.
+func ParseKDF(s string) (KDF, error) {
+	parts := strings.Split(strings.TrimSpace(s), ";")
+	switch parts[0] {
+	case KDFLegacy:
+		if len(parts) != 1 {
+			return KDF{}, fmt.Errorf("kdf %q: legacy takes no parameters", s)
+		}
+		return LegacyKDF, nil
+	case KDFArgon2id:
+	default:
+		return KDF{}, fmt.Errorf("kdf %q: unknown algorithm", s)
+	}
+	k := KDF{Name: KDFArgon2id}
+	seen := map[string]bool{}
+	for _, p := range parts[1:] {
+		key, val, ok := strings.Cut(p, "=")
+		if !ok || seen[key] {
+			return KDF{}, fmt.Errorf("kdf %q: malformed parameter %q", s, p)
+		}
+		seen[key] = true
+		n, err := strconv.ParseUint(val, 10, 32)
+		if err != nil {
+			return KDF{}, fmt.Errorf("kdf %q: parameter %q: %w", s, p, err)
+		}
+		switch key {
+		case "t":
+			k.Time = uint32(n)
+		case "m":
+			k.MemoryKiB = uint32(n)
+		case "p":
+			if n > math.MaxUint8 {
+				return KDF{}, fmt.Errorf("kdf %q: too many threads", s)
+			}
+			k.Threads = uint8(n)
+		default:
+			return KDF{}, fmt.Errorf("kdf %q: unknown parameter %q", s, key)
+		}
+	}
+	if err := k.validate(); err != nil {
+		return KDF{}, fmt.Errorf("kdf %q: %w", s, err)
+	}
+	return k, nil
+}
+
+func (k KDF) validate() error {
+	switch {
+	case k.Time < 1 || k.Time > maxArgon2Time:
+		return fmt.Errorf("t must be 1..%d", maxArgon2Time)
+	case k.Threads < 1 || k.Threads > maxArgon2Threads:
+		return fmt.Errorf("p must be 1..%d", maxArgon2Threads)
+	case k.MemoryKiB < 8*uint32(k.Threads) || k.MemoryKiB > maxArgon2MemoryKiB:
+		return fmt.Errorf("m must be %d..%d KiB", 8*uint32(k.Threads), maxArgon2MemoryKiB)
+	}
+	return nil
+}
+
+// DeriveKey returns the 32-byte stream key for tunnelID.
+func (k KDF) DeriveKey(secret []byte, tunnelID string) []byte {
+	if k.Name != KDFArgon2id {
+		h := sha256.New()
+		h.Write(secret)
+		h.Write([]byte(tunnelID))
+		return h.Sum(nil)
+	}
+	salt := sha256.Sum256([]byte(argon2idSaltContext + "\x00" + tunnelID))
+	return argon2.IDKey(secret, salt[:], k.Time, k.MemoryKiB, k.Threads, 32)
+}
+
+// ResolveKDF maps a --psk-kdf value to a KDF. Auto picks Argon2id for
+// passphrases and legacy for PSKs that already are encoded random keys, which
+// keeps existing key-file deployments working unchanged.
+func ResolveKDF(name, psk string) (KDF, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", KDFAuto:
+		if isEncodedKey(strings.TrimSpace(psk)) {
+			return LegacyKDF, nil
+		}
+		return Argon2idKDF, nil
+	case KDFLegacy:
+		return LegacyKDF, nil
+	case KDFArgon2id:
+		return Argon2idKDF, nil
+	default:
+		return KDF{}, fmt.Errorf("unknown kdf %q (use auto, argon2id or legacy)", name)
+	}
+}
+
+// isEncodedKey reports whether psk is hex or base64 of at least 32 bytes that
+// looks random rather than typed.
+func isEncodedKey(psk string) bool {
+	var raw []byte
+	if b, err := hex.DecodeString(psk); err == nil {
+		raw = b
+	} else if b, err := base64.StdEncoding.DecodeString(psk); err == nil {
+		raw = b
+	} else if b, err := base64.RawURLEncoding.DecodeString(psk); err == nil {
+		raw = b
+	}
+	return len(raw) >= 32 && EstimatePSKEntropy(psk) >= 128
+}
+
+// EstimatePSKEntropy is a rough upper bound on the entropy of psk in bits: the
+// smaller of length times the log2 of the character classes used and length
+// times the observed per-character Shannon entropy, over the shortest period
+// psk repeats. It catches short keys, single-class keys and repetition, not
+// dictionary words.
+func EstimatePSKEntropy(psk string) float64 {
+	psk = shortestPeriod(psk)
+	if psk == "" {
+		return 0
+	}
+	var lower, upper, digit, other bool
+	counts := map[rune]int{}
+	n := 0
+	for _, r := range psk {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		default:
+			other = true
+		}
+		counts[r]++
+		n++
+	}
+	pool := 0
+	for _, c := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {other, 33}} {
+		if c.used {
+			pool += c.size
+		}
+	}
+	byPool := float64(n) * math.Log2(float64(pool))
+	var shannon float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		shannon -= p * math.Log2(p)
+	}
+	return math.Min(byPool, shannon*float64(n))
+}
+
+// shortestPeriod returns the shortest prefix that psk repeats, e.g. "abc" for
+// "abcabcab", or psk itself when it does not repeat.
+func shortestPeriod(psk string) string {
+	for p := 1; p <= len(psk)/2; p++ {
+		repeats := true
+		for i := p; i < len(psk); i++ {
+			if psk[i] != psk[i%p] {
+				repeats = false
+				break
+			}
+		}
+		if repeats {
+			return psk[:p]
+		}
+	}
+	return psk
+}
+
+// WeakPSK reports whether psk's entropy estimate is below the warning
+// threshold, with the estimate.
+func WeakPSK(psk string) (bool, float64) {
+	bits := EstimatePSKEntropy(psk)
+	return bits < weakPSKBits, bits
+}
@@ -0,0 +1,164 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package security
+
+import (
+	"encoding/hex"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKDF_DeriveKeyVectors(t *testing.T) {
+	const pass = "correct horse battery staple"
+	tests := []struct {
+		name     string
+		kdf      KDF
+		secret   string
+		tunnelID string
+		want     string
+	}{
+		// sha256("correct horse battery staple" || "tun-1")
+		{"legacy", LegacyKDF, pass, "tun-1", "a5fd4c881b47c096a67c724f4353b0662f719e98cc277b9077908cc25dfc0cc6"},
+		{"argon2id default", Argon2idKDF, pass, "tun-1", "6f467bf47a5c24276ab62de8e6624ae9319aba5890c0013e4c014668ce88355c"},
+		{"argon2id salt bound to tunnel", Argon2idKDF, pass, "tun-2", "229ae8b6b77ee0a64eae44e4300e60516c984ff7228d8adb75d5c746faa15c40"},
+		{"argon2id explicit params", KDF{Name: KDFArgon2id, Time: 1, MemoryKiB: 64, Threads: 1}, "password", "tun-1", "f5cd9eaf70d76a7ad4d21651e0c461a86b6bea7befd2d91607d88799a6dc6b1f"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, hex.EncodeToString(tt.kdf.DeriveKey([]byte(tt.secret), tt.tunnelID)))
+		})
+	}
+}
+
+func TestParseKDF(t *testing.T) {
+	for _, k := range []KDF{LegacyKDF, Argon2idKDF, {Name: KDFArgon2id, Time: 3, MemoryKiB: 65536, Threads: 4}} {
+		got, err := ParseKDF(k.String())
+		require.NoError(t, err, k.String())
+		assert.Equal(t, k, got)
+	}
+	assert.Equal(t, "argon2id;t=2;m=19456;p=1", Argon2idKDF.String())
+
+	for _, bad := range []string{
+		"",
+		"scrypt",
+		"legacy;t=1",
+		"argon2id",
+		"argon2id;t=2;m=19456",
+		"argon2id;t=2;m=19456;p=1;x=1",
+		"argon2id;t=2;t=3;m=19456;p=1",
+		"argon2id;t=0;m=19456;p=1",
+		"argon2id;t=2;m=4;p=1",
+		"argon2id;t=2;m=99999999;p=1",
+		"argon2id;t=2;m=19456;p=300",
+		"argon2id;t=two;m=19456;p=1",
+	} {
+		_, err := ParseKDF(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestResolveKDF(t *testing.T) {
+	const hexKey = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	tests := []struct {
+		flag, psk string
+		want      KDF
+	}{
+		{"auto", "correct horse battery staple on tuesdays", Argon2idKDF},
+		{"auto", hexKey, LegacyKDF},
+		{"auto", "0123456789abcdef0123456789abcdef", Argon2idKDF},
+		{"", hexKey, LegacyKDF},
+		{"legacy", "correct horse battery staple on tuesdays", LegacyKDF},
+		{"ARGON2ID", hexKey, Argon2idKDF},
+	}
+	for _, tt := range tests {
+		got, err := ResolveKDF(tt.flag, tt.psk)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, got, "%s / %s", tt.flag, tt.psk)
+	}
+	_, err := ResolveKDF("pbkdf2", "x")
+	assert.ErrorContains(t, err, "unknown kdf")
+}
+
+func TestWeakPSK(t *testing.T) {
+	weak, bits := WeakPSK("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	assert.True(t, weak, "repetition is weak despite the length")
+	assert.Zero(t, bits)
+
+	weak, bits = WeakPSK("0123456789abcdef0123456789abcdef")
+	assert.True(t, weak, "a repeated half counts once")
+	assert.InDelta(t, 64, bits, 0.01)
+
+	weak, _ = WeakPSK("Tr0ub4dor&3-xk9!Qz_mP2#vLw8$eR5")
+	assert.False(t, weak)
+
+	weak, _ = WeakPSK("hunter2hunter2hunter2hunter2hunter2")
+	assert.True(t, weak)
+
+	weak, _ = WeakPSK("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
+	assert.False(t, weak)
+}
+
+// kdfPipe writes msg through a stream keyed with writer and reads it back with
+// a stream keyed with reader.
+func kdfPipe(t *testing.T, writer, reader KDF, msg string) (string, error) {
+	t.Helper()
+	const secret, tunnelID = "correct horse battery staple", "tun-1"
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	tx := NewClientPSKWithKDF([]byte(secret), writer).Wrap(a, tunnelID)
+	rx := NewClientPSKWithKDF([]byte(secret), reader).Wrap(b, tunnelID)
+	go func() { _, _ = tx.Write([]byte(msg)) }()
+	buf := make([]byte, len(msg))
+	_, err := io.ReadFull(rx, buf)
+	return string(buf), err
+}
+
+func TestKDF_Interop(t *testing.T) {
+	got, err := kdfPipe(t, LegacyKDF, LegacyKDF, "legacy to legacy")
+	require.NoError(t, err)
+	assert.Equal(t, "legacy to legacy", got)
+
+	got, err = kdfPipe(t, Argon2idKDF, Argon2idKDF, "argon2id to argon2id")
+	require.NoError(t, err)
+	assert.Equal(t, "argon2id to argon2id", got)
+
+	_, err = kdfPipe(t, Argon2idKDF, LegacyKDF, "argon2id to legacy")
+	require.ErrorIs(t, err, ErrKeyMismatch)
+
+	_, err = kdfPipe(t, LegacyKDF, Argon2idKDF, "legacy to argon2id")
+	require.ErrorIs(t, err, ErrKeyMismatch)
+
+	other := Argon2idKDF
+	other.Time = 3
+	_, err = kdfPipe(t, Argon2idKDF, other, "parameter mismatch")
+	require.ErrorIs(t, err, ErrKeyMismatch)
+}
+
+func TestClientPSK_DerivesArgon2idKeyOnce(t *testing.T) {
+	psk := NewClientPSKWithKDF([]byte("correct horse battery staple"), Argon2idKDF)
+	const streams = 8
+	keys := make([][]byte, streams)
+	var wg sync.WaitGroup
+	for i := range keys {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			keys[i] = psk.key("tun-cache")
+		}()
+	}
+	wg.Wait()
+	for _, k := range keys[1:] {
+		assert.Same(t, &keys[0][0], &k[0], "concurrent streams share one derivation")
+	}
+	k := psk.WithNonces(func() NonceSource { return CounterNonces(7) }).key("tun-cache")
+	assert.Same(t, &keys[0][0], &k[0], "a WithNonces copy shares the derived keys")
+	assert.NotEqual(t, keys[0], psk.key("other-tunnel"))
+	assert.NotEqual(t, keys[0], NewClientPSKWithKDF([]byte("another passphrase entirely"), Argon2idKDF).key("tun-cache"))
+}
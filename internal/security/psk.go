@@ -5,48 +5,168 @@ package security
 
 import (
 	"crypto/cipher"
-	"crypto/sha256"
 	"encoding/binary"
+	"errors"
 	"io"
+	"sync"
+	"sync/atomic"
 
 	"golang.org/x/crypto/chacha20poly1305"
 
 	"github.com/fortunnels/client/internal/support"
 )
 
+// ErrKeyMismatch is returned when a frame from the peer fails
+// authentication, which in practice means the two ends derived different keys.
+var ErrKeyMismatch = errors.New("stream decryption failed: PSK or --psk-kdf does not match the peer")
+
+// ErrFrameTooLarge is returned for a frame declaring more ciphertext than
+// MaxFramePayload allows; nothing is allocated for it.
+var ErrFrameTooLarge = errors.New("stream decryption failed: frame exceeds the maximum size")
+
 // PSK-based client-side crypto wrapper selector
-type ClientPSK struct{ secret []byte }
+type ClientPSK struct {
+	secret []byte
+	kdf    KDF
+	nonces func() NonceSource
+	// keys holds the derived key of each tunnel, shared by the copies
+	// WithNonces makes.
+	keys *tunnelKeys
+}
+
+// tunnelKeys derives each tunnel's key once, however many streams ask for
+// it at the same time: with Argon2id every derivation costs 19 MiB.
+type tunnelKeys struct {
+	mu   sync.Mutex
+	byID map[string]*tunnelKey
+}
+
+type tunnelKey struct {
+	once sync.Once
+	key  []byte
+}
 
+// ClientAEAD frames a stream with XChaCha20-Poly1305. It is safe for one
+// reader and many writers at once: each frame goes out in a single base
+// Write under writeMu, so frames of concurrent writers never interleave.
 type ClientAEAD struct {
-	base   io.ReadWriteCloser
-	aead   cipher.AEAD
-	encCtr uint64
+	base     io.ReadWriteCloser
+	aead     cipher.AEAD
+	nonces   NonceSource
+	overhead *OverheadCounter
+
+	readMu sync.Mutex
+
+	writeMu sync.Mutex
+	// nonce is drawn from nonces but not yet sent: a frame nothing of which
+	// reached base leaves it for the next frame, so the counter only moves
+	// past frames that went out.
+	nonce []byte
+	// writeErr is set once part of a frame went out; the peer has lost the
+	// frame boundaries, so every later Write fails with it.
+	writeErr error
 }
 
+// NonceSource fills in the 24-byte nonce of each frame a ClientAEAD seals.
+// It must never repeat a nonce for one stream direction.
+type NonceSource func(nonce []byte)
+
+// CounterNonces is the nonce source of every stream unless another is
+// injected: a zero prefix plus a big-endian 8-byte frame counter in the tail,
+// starting at start. This is safe because each ClientAEAD instance is
+// unidirectional (separate encrypt/decrypt streams).
+func CounterNonces(start uint64) NonceSource {
+	ctr := start
+	return func(nonce []byte) {
+		clear(nonce[:16])
+		binary.BigEndian.PutUint64(nonce[16:], ctr)
+		ctr++
+	}
+}
+
+// FrameOverhead is what ClientAEAD adds to every frame on top of the
+// plaintext: the 4-byte length, the 24-byte nonce and the Poly1305 tag.
+const FrameOverhead = 4 + chacha20poly1305.NonceSizeX + chacha20poly1305.Overhead
+
+// MaxFramePayload is the most plaintext one ClientAEAD frame carries; Write
+// splits larger buffers, and Read refuses frames declaring more.
+const MaxFramePayload = 1 << 20
+
+// OverheadCounter accumulates the framing bytes of ClientAEAD frames sent
+// and received, so payload plus overhead is what went into the stream.
+type OverheadCounter struct {
+	Sent     atomic.Int64
+	Received atomic.Int64
+}
+
+// NewClientPSK derives keys with the legacy sha256(secret||tunnelID) KDF.
 func NewClientPSK(secret []byte) *ClientPSK {
-	return &ClientPSK{secret: secret}
+	return NewClientPSKWithKDF(secret, LegacyKDF)
+}
+
+// NewClientPSKWithKDF derives per-tunnel keys with kdf.
+// Keys are derived on first use and kept, so build one ClientPSK per tunnel
+// and share it between the tunnel's streams.
+func NewClientPSKWithKDF(secret []byte, kdf KDF) *ClientPSK {
+	return &ClientPSK{secret: secret, kdf: kdf, keys: &tunnelKeys{byID: map[string]*tunnelKey{}}}
+}
+
+// WithNonces returns a ClientPSK whose streams take their nonces from a
+// source newNonces returns; nil means CounterNonces(0). It shares c's derived
+// keys. Golden transcripts use it to pin the bytes of encrypted streams.
+func (c *ClientPSK) WithNonces(newNonces func() NonceSource) *ClientPSK {
+	cp := *c
+	cp.nonces = newNonces
+	return &cp
+}
+
+// KDF returns the key derivation this PSK uses.
+func (c *ClientPSK) KDF() KDF { return c.kdf }
+
+// key returns the key of tunnelID, deriving it on the first call; concurrent
+// callers wait for that one derivation.
+func (c *ClientPSK) key(tunnelID string) []byte {
+	c.keys.mu.Lock()
+	k, ok := c.keys.byID[tunnelID]
+	if !ok {
+		k = &tunnelKey{}
+		c.keys.byID[tunnelID] = k
+	}
+	c.keys.mu.Unlock()
+	k.once.Do(func() { k.key = c.kdf.DeriveKey(c.secret, tunnelID) })
+	return k.key
 }
 
 func (c *ClientPSK) Wrap(conn io.ReadWriteCloser, tunnelID string) io.ReadWriteCloser {
-	// mirror server derivation: sha256(secret||tunnelID)
-	h := sha256.New()
-	h.Write(c.secret)
-	h.Write([]byte(tunnelID))
-	key := h.Sum(nil)
-	a, err := chacha20poly1305.NewX(key)
+	return c.WrapCounted(conn, tunnelID, nil)
+}
+
+// WrapCounted is Wrap with the framing overhead of every frame added to
+// overhead; nil counts nothing.
+func (c *ClientPSK) WrapCounted(conn io.ReadWriteCloser, tunnelID string, overhead *OverheadCounter) io.ReadWriteCloser {
+	a, err := chacha20poly1305.NewX(c.key(tunnelID))
 	if err != nil {
 		return nil
 	}
-	return &ClientAEAD{base: conn, aead: a}
+	nonces := CounterNonces(0)
+	if c.nonces != nil {
+		nonces = c.nonces()
+	}
+	return &ClientAEAD{base: conn, aead: a, nonces: nonces, overhead: overhead}
 }
 
 func (c *ClientAEAD) Read(p []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
 	// frame: [len(4)|nonce(24)|ct]
 	hdr := make([]byte, 4+24)
 	if _, err := io.ReadFull(c.base, hdr); err != nil {
 		return 0, err
 	}
 	l := binary.BigEndian.Uint32(hdr[:4])
+	if l > MaxFramePayload+chacha20poly1305.Overhead {
+		return 0, ErrFrameTooLarge
+	}
 	nonce := hdr[4:]
 	buf := make([]byte, int(l))
 	if _, err := io.ReadFull(c.base, buf); err != nil {
@@ -54,7 +174,10 @@ func (c *ClientAEAD) Read(p []byte) (int, error) {
 	}
 	pt, err := c.aead.Open(nil, nonce, buf, nil)
 	if err != nil {
-		return 0, err
+		return 0, ErrKeyMismatch
+	}
+	if c.overhead != nil {
+		c.overhead.Received.Add(FrameOverhead)
 	}
 	n := copy(p, pt)
 	if n < len(pt) {
@@ -64,28 +187,65 @@ func (c *ClientAEAD) Read(p []byte) (int, error) {
 }
 
 func (c *ClientAEAD) Write(p []byte) (int, error) {
-	// XChaCha20-Poly1305 requires a 24-byte nonce. We use a zero prefix plus a
-	// monotonic 8-byte counter in the tail. This is safe because each ClientAEAD
-	// instance is unidirectional (separate encrypt/decrypt streams).
-	nonce := make([]byte, 24)
-	binary.BigEndian.PutUint64(nonce[16:], c.encCtr)
-	c.encCtr++
-	ct := c.aead.Seal(nil, nonce, p, nil)
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.writeErr != nil {
+		return 0, c.writeErr
+	}
+	written := 0
+	for {
+		chunk := p[written:min(len(p), written+MaxFramePayload)]
+		if err := c.writeFrame(chunk); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		if written == len(p) {
+			return written, nil
+		}
+	}
+}
+
+// writeFrame seals p into one frame and sends it with a single base Write.
+// The caller holds writeMu.
+func (c *ClientAEAD) writeFrame(p []byte) error {
+	if c.nonce == nil {
+		// XChaCha20-Poly1305 requires a 24-byte nonce.
+		c.nonce = make([]byte, chacha20poly1305.NonceSizeX)
+		c.nonces(c.nonce)
+	}
+	frame := make([]byte, 4+24, FrameOverhead+len(p))
+	copy(frame[4:], c.nonce)
+	frame = c.aead.Seal(frame, c.nonce, p, nil)
 	// ToUint32Size already validates the size limit, no need for duplicate check
-	l, err := support.ToUint32Size(len(ct))
+	l, err := support.ToUint32Size(len(frame) - 4 - 24)
 	if err != nil {
-		return 0, err
+		return err
 	}
-	hdr := make([]byte, 4+24)
-	binary.BigEndian.PutUint32(hdr[:4], l)
-	copy(hdr[4:], nonce)
-	if _, err := c.base.Write(hdr); err != nil {
-		return 0, err
+	binary.BigEndian.PutUint32(frame[:4], l)
+	n, err := c.base.Write(frame)
+	if err == nil && n < len(frame) {
+		err = io.ErrShortWrite
 	}
-	if _, err := c.base.Write(ct); err != nil {
-		return 0, err
+	if err != nil {
+		if n > 0 {
+			c.writeErr = err
+		}
+		return err
+	}
+	c.nonce = nil
+	if c.overhead != nil {
+		c.overhead.Sent.Add(FrameOverhead)
 	}
-	return len(p), nil
+	return nil
 }
 
 func (c *ClientAEAD) Close() error { return c.base.Close() }
+
+// CloseWrite half-closes the underlying stream so the peer sees EOF while
+// replies can still be read. It fails when the stream cannot half-close.
+func (c *ClientAEAD) CloseWrite() error {
+	if cw, ok := c.base.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return errors.ErrUnsupported
+}
@@ -5,7 +5,11 @@ package security
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -115,11 +119,23 @@ func TestClientAEAD_Write(t *testing.T) {
 	}
 
 	// Verify counter increments
-	initialCtr := wrapped.encCtr
 	_, _ = wrapped.Write([]byte("test"))
-	if wrapped.encCtr != initialCtr+1 {
-		t.Errorf("ClientAEAD.Write() counter = %d, want %d", wrapped.encCtr, initialCtr+1)
+	assert.Equal(t, []uint64{0, 1}, frameCounters(t, base.writeData))
+}
+
+// frameCounters returns the counter in the nonce tail of every frame in
+// stream.
+func frameCounters(t *testing.T, stream []byte) []uint64 {
+	t.Helper()
+	var ctrs []uint64
+	for len(stream) > 0 {
+		require.GreaterOrEqual(t, len(stream), 4+24)
+		l := int(binary.BigEndian.Uint32(stream[:4]))
+		ctrs = append(ctrs, binary.BigEndian.Uint64(stream[20:28]))
+		require.GreaterOrEqual(t, len(stream), 4+24+l)
+		stream = stream[4+24+l:]
 	}
+	return ctrs
 }
 
 func TestClientAEAD_Read(t *testing.T) {
@@ -282,12 +298,160 @@ func TestClientAEAD_MultipleWrites(t *testing.T) {
 	_, _ = wrapped.Write(testData3)
 
 	// Verify counter incremented
-	if wrapped.encCtr != 3 {
-		t.Errorf("ClientAEAD multiple writes: counter = %d, want 3", wrapped.encCtr)
-	}
+	assert.Equal(t, []uint64{0, 1, 2}, frameCounters(t, base.writeData))
 
 	// Verify data was written
 	if len(base.writeData) == 0 {
 		t.Error("ClientAEAD multiple writes: no data written")
 	}
 }
+
+func TestClientAEAD_ConcurrentWriters(t *testing.T) {
+	psk := NewClientPSK([]byte("test-secret"))
+	base := &mockReadWriteCloser{}
+	w := psk.Wrap(base, "tunnel-123")
+
+	const writers, frames = 16, 50
+	var wg sync.WaitGroup
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range frames {
+				_, err := fmt.Fprintf(w, "w%02d-%03d", i, j)
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	r := psk.Wrap(&mockReadWriteCloser{readData: base.writeData}, "tunnel-123")
+	buf := make([]byte, 16)
+	next := make(map[string]int)
+	for range writers * frames {
+		n, err := r.Read(buf)
+		require.NoError(t, err, "every frame decrypts")
+		var i, j int
+		_, err = fmt.Sscanf(string(buf[:n]), "w%02d-%03d", &i, &j)
+		require.NoError(t, err)
+		key := fmt.Sprint(i)
+		assert.Equal(t, next[key], j, "frames of one writer stay in order")
+		next[key] = j + 1
+	}
+	_, err := r.Read(buf)
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+// failingWriter accepts the first n bytes of its next Write and fails it
+// with err, then behaves like mockReadWriteCloser.
+type failingWriter struct {
+	mockReadWriteCloser
+	n   int
+	err error
+}
+
+func (f *failingWriter) Write(b []byte) (int, error) {
+	if f.err != nil {
+		err := f.err
+		f.err = nil
+		f.writeData = append(f.writeData, b[:f.n]...)
+		return f.n, err
+	}
+	return f.mockReadWriteCloser.Write(b)
+}
+
+func TestClientAEAD_FailedWriteKeepsNonce(t *testing.T) {
+	psk := NewClientPSK([]byte("test-secret"))
+	var overhead OverheadCounter
+	base := &failingWriter{err: errors.New("busy")}
+	w := psk.WrapCounted(base, "tunnel-123", &overhead)
+
+	_, err := w.Write([]byte("first"))
+	require.Error(t, err)
+	assert.Zero(t, overhead.Sent.Load())
+	_, err = w.Write([]byte("second"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("third"))
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{0, 1}, frameCounters(t, base.writeData), "nothing went out, so no nonce was used")
+	assert.Equal(t, int64(2*FrameOverhead), overhead.Sent.Load())
+}
+
+func TestClientAEAD_PartialWriteBreaksStream(t *testing.T) {
+	psk := NewClientPSK([]byte("test-secret"))
+	broken := errors.New("reset")
+	base := &failingWriter{n: 10, err: broken}
+	w := psk.Wrap(base, "tunnel-123")
+
+	_, err := w.Write([]byte("first"))
+	require.ErrorIs(t, err, broken)
+	_, err = w.Write([]byte("second"))
+	require.ErrorIs(t, err, broken, "the peer lost the frame boundaries")
+	assert.Len(t, base.writeData, 10)
+}
+
+func TestClientAEAD_WrapCountedOverhead(t *testing.T) {
+	psk := NewClientPSK([]byte("test-secret"))
+	var overhead OverheadCounter
+	writerBase := &mockReadWriteCloser{}
+	writer := psk.WrapCounted(writerBase, "tunnel-123", &overhead)
+	for _, msg := range []string{"first", "second frame"} {
+		_, err := writer.Write([]byte(msg))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int64(2*FrameOverhead), overhead.Sent.Load())
+	assert.Len(t, writerBase.writeData, len("first")+len("second frame")+2*FrameOverhead)
+
+	reader := psk.WrapCounted(&mockReadWriteCloser{readData: writerBase.writeData}, "tunnel-123", &overhead)
+	buf := make([]byte, 64)
+	_, err := reader.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, int64(FrameOverhead), overhead.Received.Load())
+}
+
+func TestClientAEAD_SplitsAndBoundsFrames(t *testing.T) {
+	psk := NewClientPSK([]byte("test-secret"))
+	writerBase := &mockReadWriteCloser{}
+	msg := bytes.Repeat([]byte("x"), MaxFramePayload+10)
+	n, err := psk.Wrap(writerBase, "tunnel-123").Write(msg)
+	require.NoError(t, err)
+	assert.Equal(t, len(msg), n)
+	assert.Len(t, writerBase.writeData, len(msg)+2*FrameOverhead, "split into two frames")
+
+	reader := psk.Wrap(&mockReadWriteCloser{readData: writerBase.writeData}, "tunnel-123")
+	buf := make([]byte, MaxFramePayload)
+	var got []byte
+	for len(got) < len(msg) {
+		n, err := reader.Read(buf)
+		require.NoError(t, err)
+		got = append(got, buf[:n]...)
+	}
+	assert.Equal(t, msg, got)
+
+	// A frame declaring more than MaxFramePayload is refused before reading it.
+	huge := make([]byte, 4+24)
+	huge[0] = 0x7f
+	_, err = psk.Wrap(&mockReadWriteCloser{readData: huge}, "tunnel-123").Read(make([]byte, 64))
+	require.ErrorIs(t, err, ErrFrameTooLarge)
+}
+
+func TestClientPSK_WithNonces(t *testing.T) {
+	psk := NewClientPSK([]byte("test-secret")).WithNonces(func() NonceSource { return CounterNonces(1 << 40) })
+	base := &mockReadWriteCloser{}
+	w := psk.Wrap(base, "tunnel-123")
+	_, _ = w.Write([]byte("first"))
+	_, _ = w.Write([]byte("second"))
+	assert.Equal(t, []uint64{1 << 40, 1<<40 + 1}, frameCounters(t, base.writeData))
+
+	// The peer opens frames whatever nonces they carry.
+	r := NewClientPSK([]byte("test-secret")).Wrap(&mockReadWriteCloser{readData: base.writeData}, "tunnel-123")
+	buf := make([]byte, 16)
+	n, err := r.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "first", string(buf[:n]))
+
+	// Every wrapped stream gets its own source.
+	base2 := &mockReadWriteCloser{}
+	_, _ = psk.Wrap(base2, "tunnel-123").Write([]byte("third"))
+	assert.Equal(t, []uint64{1 << 40}, frameCounters(t, base2.writeData))
+}
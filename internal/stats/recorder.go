@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package stats
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/fortunnels/client/internal/support"
+)
+
+const checkpointFailedFormat = "[WARN] stats: checkpoint failed: %v"
+
+// Recorder books the traffic of this process under one target key of a
+// stats file. Each checkpoint re-reads the file and adds what was counted
+// since the previous one, so several clients can share a file as long as
+// their checkpoints do not collide.
+type Recorder struct {
+	path, key string
+	// sample returns the process's cumulative counters; UptimeSeconds is
+	// ignored, the recorder measures it.
+	sample func() Counters
+	// now is time.Now; tests substitute a clock.
+	now func() time.Time
+
+	mu       sync.Mutex
+	booked   Counters
+	bookedAt time.Time
+}
+
+// Open checks the stats file at path and returns a recorder for key whose
+// counting starts now. A corrupt file is reported as a warning and replaced
+// by the first checkpoint; a file this client cannot write is an error.
+func Open(path, key string, sample func() Counters) (*Recorder, *Data, error) {
+	d, err := Load(path)
+	if d == nil {
+		return nil, nil, err
+	}
+	if err != nil {
+		log.Printf("[WARN] stats: %v", err)
+	}
+	return newRecorder(path, key, sample, time.Now), d, nil
+}
+
+func newRecorder(path, key string, sample func() Counters, now func() time.Time) *Recorder {
+	return &Recorder{path: path, key: key, sample: sample, now: now, booked: sample(), bookedAt: now()}
+}
+
+// Checkpoint adds the traffic since the previous checkpoint to the file.
+func (r *Recorder) Checkpoint() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	cur := r.sample()
+	uptime := now.Sub(r.bookedAt).Truncate(time.Second)
+	delta := cur.Sub(r.booked)
+	delta.UptimeSeconds = int64(uptime / time.Second)
+	d, err := Load(r.path)
+	if d == nil {
+		return err
+	}
+	if err != nil && !errors.Is(err, ErrCorrupt) {
+		return err
+	}
+	d.Add(r.key, delta, now)
+	if serr := Save(r.path, d, now); serr != nil {
+		return serr
+	}
+	r.booked = cur
+	r.bookedAt = r.bookedAt.Add(uptime)
+	return err
+}
+
+// Start checkpoints every interval (--stats-flush) until the returned func
+// is called, which writes a last checkpoint before it returns.
+func (r *Recorder) Start(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		defer support.Recover(support.PanicScope{Role: "stats recorder"})
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if err := r.Checkpoint(); err != nil {
+					support.RepeatLogs.Printf(support.LogKey(checkpointFailedFormat), checkpointFailedFormat, err)
+				}
+			case <-done:
+				if err := r.Checkpoint(); err != nil {
+					log.Printf(checkpointFailedFormat, err)
+				}
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-stopped
+	}
+}
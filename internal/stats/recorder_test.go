@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package stats
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeProcess struct {
+	now      time.Time
+	counters Counters
+}
+
+func (p *fakeProcess) clock() time.Time { return p.now }
+func (p *fakeProcess) sample() Counters { return p.counters }
+func (p *fakeProcess) serve(up, down int64, d time.Duration) {
+	p.counters.BytesUp += up
+	p.counters.BytesDown += down
+	p.counters.Connections++
+	p.now = p.now.Add(d)
+}
+
+// TestRecorder_RestartKeepsCounting: a second process on the same file adds
+// to what the first one checkpointed, and the booked uptime crosses midnight.
+func TestRecorder_RestartKeepsCounting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	p := &fakeProcess{now: at(10, 14, 23, 30), counters: Counters{BytesUp: 1000}}
+	r := newRecorder(path, "k", p.sample, p.clock)
+
+	p.serve(100, 200, 20*time.Minute)
+	require.NoError(t, r.Checkpoint())
+	p.serve(10, 20, 20*time.Minute)
+	require.NoError(t, r.Checkpoint())
+	require.NoError(t, r.Checkpoint(), "nothing new")
+
+	// Restart: fresh counters.
+	p2 := &fakeProcess{now: p.now.Add(time.Hour)}
+	r2 := newRecorder(path, "k", p2.sample, p2.clock)
+	p2.serve(1, 2, 30*time.Second+500*time.Millisecond)
+	require.NoError(t, r2.Checkpoint())
+
+	d, err := Load(path)
+	require.NoError(t, err)
+	e := d.Targets["k"]
+	assert.Equal(t, Counters{BytesUp: 111, BytesDown: 222, Connections: 3, UptimeSeconds: 40*60 + 30}, e.Total)
+	assert.Equal(t, Counters{BytesUp: 100, BytesDown: 200, Connections: 1, UptimeSeconds: 30 * 60}, e.Daily["2026-10-14"])
+	assert.Equal(t, Counters{BytesUp: 11, BytesDown: 22, Connections: 2, UptimeSeconds: 10*60 + 30}, e.Daily["2026-10-15"])
+
+	// The half second left over is booked by the next checkpoint.
+	p2.now = p2.now.Add(500 * time.Millisecond)
+	require.NoError(t, r2.Checkpoint())
+	d, err = Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(40*60+31), d.Targets["k"].Total.UptimeSeconds)
+}
+
+func TestRecorder_CheckpointReplacesCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"version":1,"sha2`), 0o600))
+	p := &fakeProcess{now: at(10, 15, 12, 0)}
+	r := newRecorder(path, "k", p.sample, p.clock)
+	p.serve(5, 5, time.Minute)
+
+	require.ErrorIs(t, r.Checkpoint(), ErrCorrupt, "reported once")
+	require.NoError(t, r.Checkpoint())
+	d, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), d.Targets["k"].Total.BytesUp)
+}
+
+func TestRecorder_LeavesNewerFileAlone(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	newer := []byte(`{"version":2,"sha256":"","data":{}}`)
+	require.NoError(t, os.WriteFile(path, newer, 0o600))
+	_, _, err := Open(path, "k", func() Counters { return Counters{} })
+	require.ErrorIs(t, err, ErrNewerVersion)
+
+	p := &fakeProcess{now: at(10, 15, 12, 0)}
+	r := newRecorder(path, "k", p.sample, p.clock)
+	p.serve(5, 5, time.Minute)
+	require.ErrorIs(t, r.Checkpoint(), ErrNewerVersion)
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, newer, raw)
+}
+
+func TestRecorder_StopWritesLastCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	p := &fakeProcess{now: at(10, 15, 12, 0)}
+	r := newRecorder(path, "k", p.sample, p.clock)
+	stop := r.Start(time.Hour)
+	r.mu.Lock()
+	p.serve(3, 4, time.Minute)
+	r.mu.Unlock()
+	stop()
+	stop()
+
+	d, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, Counters{BytesUp: 3, BytesDown: 4, Connections: 1, UptimeSeconds: 60}, d.Targets["k"].Total)
+}
+
+// TestRecorder_ClassesInTotalOnly: checkpoints add the --classify breakdown
+// gained since the previous one to the total; rollups do not keep it.
+func TestRecorder_ClassesInTotalOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	p := &fakeProcess{now: at(10, 14, 12, 0)}
+	r := newRecorder(path, "k", p.sample, p.clock)
+
+	p.serve(100, 200, time.Minute)
+	p.counters.Classes = map[string]ClassCounters{"api": {Requests: 2, Bytes: 300, DurationMillis: 40}}
+	require.NoError(t, r.Checkpoint())
+	p.serve(10, 20, time.Minute)
+	p.counters.Classes = map[string]ClassCounters{
+		"api":  {Requests: 3, Bytes: 320, DurationMillis: 60},
+		"html": {Requests: 1, Bytes: 10, DurationMillis: 5},
+	}
+	require.NoError(t, r.Checkpoint())
+
+	d, err := Load(path)
+	require.NoError(t, err)
+	e := d.Targets["k"]
+	assert.Equal(t, map[string]ClassCounters{
+		"api":  {Requests: 3, Bytes: 320, DurationMillis: 60},
+		"html": {Requests: 1, Bytes: 10, DurationMillis: 5},
+	}, e.Total.Classes)
+	assert.Equal(t, 20*time.Millisecond, e.Total.Classes["api"].Mean())
+	assert.Nil(t, e.Daily["2026-10-14"].Classes)
+	assert.Nil(t, e.Monthly["2026-10"].Classes)
+}
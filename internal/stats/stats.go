@@ -0,0 +1,323 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+// Package stats keeps cumulative traffic per tunnel target across client
+// restarts (--stats-file). Counters are keyed by a stable identity (the
+// profile name, or protocol and target) rather than the tunnel ID, which
+// changes on every start, and rolled up per day and per month.
+package stats
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// FormatVersion is the version of the file layout this client writes.
+const FormatVersion = 1
+
+const (
+	dayLayout   = "2006-01-02"
+	monthLayout = "2006-01"
+	// keepDays bounds the daily rollups; monthly ones are kept for good.
+	keepDays = 92
+)
+
+// Counters are the traffic of a target: payload bytes in each direction
+// (up is toward the server), streams served and seconds spent serving.
+type Counters struct {
+	BytesUp       int64 `json:"bytes_up"`
+	BytesDown     int64 `json:"bytes_down"`
+	Connections   int64 `json:"connections"`
+	UptimeSeconds int64 `json:"uptime_seconds"`
+	// Classes breaks the traffic down by --classify traffic class. Only an
+	// entry's total keeps it; the rollups do not.
+	Classes map[string]ClassCounters `json:"classes,omitempty"`
+}
+
+// ClassCounters are the requests of one --classify traffic class: their
+// count, their bytes in both directions and their summed duration.
+type ClassCounters struct {
+	Requests       int64 `json:"requests"`
+	Bytes          int64 `json:"bytes"`
+	DurationMillis int64 `json:"duration_ms"`
+}
+
+// Mean is the mean duration of the class's requests.
+func (c ClassCounters) Mean() time.Duration {
+	if c.Requests == 0 {
+		return 0
+	}
+	return time.Duration(c.DurationMillis/c.Requests) * time.Millisecond
+}
+
+func (c *Counters) add(d Counters) {
+	c.BytesUp += d.BytesUp
+	c.BytesDown += d.BytesDown
+	c.Connections += d.Connections
+	c.UptimeSeconds += d.UptimeSeconds
+	for class, dc := range d.Classes {
+		if c.Classes == nil {
+			c.Classes = map[string]ClassCounters{}
+		}
+		cc := c.Classes[class]
+		cc.Requests += dc.Requests
+		cc.Bytes += dc.Bytes
+		cc.DurationMillis += dc.DurationMillis
+		c.Classes[class] = cc
+	}
+}
+
+// Sub returns the counters c gained over prev.
+func (c Counters) Sub(prev Counters) Counters {
+	d := Counters{
+		BytesUp:       c.BytesUp - prev.BytesUp,
+		BytesDown:     c.BytesDown - prev.BytesDown,
+		Connections:   c.Connections - prev.Connections,
+		UptimeSeconds: c.UptimeSeconds - prev.UptimeSeconds,
+	}
+	for class, cc := range c.Classes {
+		pc := prev.Classes[class]
+		dc := ClassCounters{Requests: cc.Requests - pc.Requests, Bytes: cc.Bytes - pc.Bytes, DurationMillis: cc.DurationMillis - pc.DurationMillis}
+		if dc == (ClassCounters{}) {
+			continue
+		}
+		if d.Classes == nil {
+			d.Classes = map[string]ClassCounters{}
+		}
+		d.Classes[class] = dc
+	}
+	return d
+}
+
+// DayKey and MonthKey are the keys of t's daily and monthly rollups.
+func DayKey(t time.Time) string   { return t.Format(dayLayout) }
+func MonthKey(t time.Time) string { return t.Format(monthLayout) }
+
+// IsZero reports whether nothing was counted.
+func (c Counters) IsZero() bool {
+	return c.BytesUp == 0 && c.BytesDown == 0 && c.Connections == 0 && c.UptimeSeconds == 0 && len(c.Classes) == 0
+}
+
+// Entry is one target's totals and rollups. Daily is keyed by local date
+// (2006-01-02), Monthly by month (2006-01).
+type Entry struct {
+	Total    Counters            `json:"total"`
+	Daily    map[string]Counters `json:"daily,omitempty"`
+	Monthly  map[string]Counters `json:"monthly,omitempty"`
+	LastSeen time.Time           `json:"last_seen"`
+}
+
+// Data is the content of a stats file, by target key.
+type Data struct {
+	Targets map[string]*Entry `json:"targets"`
+}
+
+// Keys returns the target keys in order.
+func (d *Data) Keys() []string {
+	keys := make([]string, 0, len(d.Targets))
+	for k := range d.Targets {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Add books delta to key at now. Bytes and connections go to now's day;
+// the uptime is spread over the days of the interval (now-uptime, now], so
+// a checkpoint after midnight credits the evening to the day before.
+func (d *Data) Add(key string, delta Counters, now time.Time) {
+	if d.Targets == nil {
+		d.Targets = map[string]*Entry{}
+	}
+	e := d.Targets[key]
+	if e == nil {
+		e = &Entry{}
+		d.Targets[key] = e
+	}
+	if e.Daily == nil {
+		e.Daily = map[string]Counters{}
+	}
+	if e.Monthly == nil {
+		e.Monthly = map[string]Counters{}
+	}
+	e.Total.add(delta)
+	day := delta
+	day.UptimeSeconds = 0
+	day.Classes = nil
+	e.book(now, day)
+	for _, span := range splitByDay(now.Add(-time.Duration(delta.UptimeSeconds)*time.Second), now) {
+		e.book(span.day, Counters{UptimeSeconds: span.seconds})
+	}
+	e.LastSeen = now
+	e.prune(now)
+}
+
+func (e *Entry) book(t time.Time, c Counters) {
+	if c.IsZero() {
+		return
+	}
+	day, month := e.Daily[DayKey(t)], e.Monthly[MonthKey(t)]
+	day.add(c)
+	month.add(c)
+	e.Daily[DayKey(t)], e.Monthly[MonthKey(t)] = day, month
+}
+
+// prune drops daily rollups older than keepDays.
+func (e *Entry) prune(now time.Time) {
+	cutoff := DayKey(now.AddDate(0, 0, -keepDays))
+	for day := range e.Daily {
+		if day < cutoff {
+			delete(e.Daily, day)
+		}
+	}
+}
+
+type daySpan struct {
+	day     time.Time
+	seconds int64
+}
+
+// splitByDay cuts (from, to] at local midnights.
+func splitByDay(from, to time.Time) []daySpan {
+	var spans []daySpan
+	for from.Before(to) {
+		y, m, d := from.Date()
+		next := time.Date(y, m, d+1, 0, 0, 0, 0, from.Location())
+		end := to
+		if next.Before(to) {
+			end = next
+		}
+		if s := int64(end.Sub(from) / time.Second); s > 0 {
+			spans = append(spans, daySpan{day: from, seconds: s})
+		}
+		from = end
+	}
+	return spans
+}
+
+// file is the on-disk envelope: the checksum covers the exact bytes of
+// data, so a torn or edited file is detected on load.
+type file struct {
+	Version  int             `json:"version"`
+	SHA256   string          `json:"sha256"`
+	Data     json.RawMessage `json:"data"`
+	Modified time.Time       `json:"modified"`
+}
+
+// ErrCorrupt is returned by Load for a file that does not parse or whose
+// checksum does not match.
+var ErrCorrupt = errors.New("stats file is corrupt")
+
+// ErrNewerVersion is returned by Load for a file written by a newer client;
+// it must not be overwritten.
+var ErrNewerVersion = errors.New("stats file was written by a newer client")
+
+// Load reads the stats file at path; a missing file is empty data. For a
+// corrupt file the previous checkpoint (path.bak), or else empty data, is
+// returned along with an error wrapping ErrCorrupt: the caller can carry on
+// and the next Save replaces the file.
+func Load(path string) (*Data, error) {
+	d, err := loadFile(path)
+	switch {
+	case err == nil:
+		return d, nil
+	case errors.Is(err, os.ErrNotExist):
+		// Between the two renames of Save only the backup exists.
+		if backup, berr := loadFile(backupPath(path)); berr == nil {
+			return backup, nil
+		}
+		return &Data{}, nil
+	case !errors.Is(err, ErrCorrupt):
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if backup, berr := loadFile(backupPath(path)); berr == nil {
+		return backup, fmt.Errorf("%s: %w; using the previous checkpoint", path, err)
+	}
+	return &Data{}, fmt.Errorf("%s: %w; starting over", path, err)
+}
+
+func loadFile(path string) (*Data, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f file
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	if f.Version > FormatVersion {
+		return nil, fmt.Errorf("%w (version %d, this client reads up to %d)", ErrNewerVersion, f.Version, FormatVersion)
+	}
+	if f.Version < 1 {
+		return nil, fmt.Errorf("%w: no version", ErrCorrupt)
+	}
+	// The envelope is indented on disk; the checksum is of the compact form.
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, f.Data); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	sum := sha256.Sum256(compact.Bytes())
+	if hex.EncodeToString(sum[:]) != f.SHA256 {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrCorrupt)
+	}
+	var d Data
+	if err := json.Unmarshal(f.Data, &d); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	return &d, nil
+}
+
+// Save writes d to path atomically: a temporary file is written and synced,
+// the current file becomes path.bak and the temporary file is renamed over
+// path. A crash at any point leaves one complete checkpoint to load. A
+// corrupt current file is kept as path.corrupt rather than the backup.
+func Save(path string, d *Data, now time.Time) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	out, err := json.MarshalIndent(file{Version: FormatVersion, SHA256: hex.EncodeToString(sum[:]), Data: data, Modified: now}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create stats dir: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("write stats: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(out, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write stats: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write stats: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write stats: %w", err)
+	}
+	switch _, err := loadFile(path); {
+	case err == nil:
+		_ = os.Rename(path, backupPath(path))
+	case errors.Is(err, ErrCorrupt):
+		_ = os.Rename(path, path+".corrupt")
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("save stats: %w", err)
+	}
+	return nil
+}
+
+func backupPath(path string) string { return path + ".bak" }
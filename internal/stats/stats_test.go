@@ -0,0 +1,148 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package stats
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// at is a local time in 2026.
+func at(month time.Month, d, h, m int) time.Time {
+	return time.Date(2026, month, d, h, m, 0, 0, time.Local)
+}
+
+func TestData_AddRollsUpByDayAndMonth(t *testing.T) {
+	var d Data
+	d.Add("http://127.0.0.1:3000", Counters{BytesUp: 10, BytesDown: 100, Connections: 1, UptimeSeconds: 60}, at(10, 14, 12, 0))
+	d.Add("http://127.0.0.1:3000", Counters{BytesUp: 5, BytesDown: 50, Connections: 2, UptimeSeconds: 60}, at(10, 15, 12, 0))
+
+	e := d.Targets["http://127.0.0.1:3000"]
+	require.NotNil(t, e)
+	assert.Equal(t, Counters{BytesUp: 15, BytesDown: 150, Connections: 3, UptimeSeconds: 120}, e.Total)
+	assert.Equal(t, Counters{BytesUp: 10, BytesDown: 100, Connections: 1, UptimeSeconds: 60}, e.Daily["2026-10-14"])
+	assert.Equal(t, Counters{BytesUp: 5, BytesDown: 50, Connections: 2, UptimeSeconds: 60}, e.Daily["2026-10-15"])
+	assert.Equal(t, e.Total, e.Monthly["2026-10"])
+	assert.Equal(t, at(10, 15, 12, 0), e.LastSeen)
+}
+
+// TestData_AddSplitsUptimeAtMidnight: a checkpoint shortly after midnight
+// credits the time before it to the previous day, and to the previous month
+// at a month boundary. Bytes go to the day of the checkpoint.
+func TestData_AddSplitsUptimeAtMidnight(t *testing.T) {
+	var d Data
+	d.Add("k", Counters{BytesUp: 7, UptimeSeconds: 3 * 3600}, at(11, 1, 1, 0))
+	e := d.Targets["k"]
+	assert.Equal(t, Counters{UptimeSeconds: 2 * 3600}, e.Daily["2026-10-31"])
+	assert.Equal(t, Counters{BytesUp: 7, UptimeSeconds: 3600}, e.Daily["2026-11-01"])
+	assert.Equal(t, Counters{UptimeSeconds: 2 * 3600}, e.Monthly["2026-10"])
+	assert.Equal(t, Counters{BytesUp: 7, UptimeSeconds: 3600}, e.Monthly["2026-11"])
+	assert.Equal(t, int64(3*3600), e.Total.UptimeSeconds)
+
+	// Spanning two midnights.
+	d.Add("long", Counters{UptimeSeconds: 50 * 3600}, at(10, 15, 2, 0))
+	e = d.Targets["long"]
+	assert.Equal(t, int64(24*3600), e.Daily["2026-10-13"].UptimeSeconds)
+	assert.Equal(t, int64(24*3600), e.Daily["2026-10-14"].UptimeSeconds)
+	assert.Equal(t, int64(2*3600), e.Daily["2026-10-15"].UptimeSeconds)
+	assert.Equal(t, int64(50*3600), e.Monthly["2026-10"].UptimeSeconds)
+}
+
+func TestData_AddPrunesOldDays(t *testing.T) {
+	var d Data
+	d.Add("k", Counters{BytesUp: 1}, at(5, 1, 12, 0))
+	d.Add("k", Counters{BytesUp: 1}, at(10, 15, 12, 0))
+	e := d.Targets["k"]
+	assert.NotContains(t, e.Daily, "2026-05-01")
+	assert.Contains(t, e.Daily, "2026-10-15")
+	assert.Equal(t, int64(1), e.Monthly["2026-05"].BytesUp, "monthly rollups are kept")
+}
+
+func TestSaveLoad_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	d, err := Load(path)
+	require.NoError(t, err)
+	assert.Empty(t, d.Targets, "a missing file is empty")
+
+	d.Add("profile web", Counters{BytesUp: 1, BytesDown: 2, Connections: 3, UptimeSeconds: 4}, at(10, 15, 12, 0))
+	require.NoError(t, Save(path, d, at(10, 15, 12, 0)))
+	got, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, d.Targets["profile web"].Total, got.Targets["profile web"].Total)
+	assert.Equal(t, d.Targets["profile web"].Daily, got.Targets["profile web"].Daily)
+	assert.Equal(t, []string{"profile web"}, got.Keys())
+
+	d.Add("profile web", Counters{BytesUp: 10}, at(10, 15, 13, 0))
+	require.NoError(t, Save(path, d, at(10, 15, 13, 0)))
+	backup, err := loadFile(path + ".bak")
+	require.NoError(t, err, "the previous checkpoint is kept")
+	assert.Equal(t, int64(1), backup.Targets["profile web"].Total.BytesUp)
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "no temporary files are left: %v", entries)
+}
+
+func TestLoad_CorruptFallsBackToBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	var d Data
+	d.Add("k", Counters{BytesUp: 1}, at(10, 15, 12, 0))
+	require.NoError(t, Save(path, &d, at(10, 15, 12, 0)))
+	d.Add("k", Counters{BytesUp: 1}, at(10, 15, 13, 0))
+	require.NoError(t, Save(path, &d, at(10, 15, 13, 0)))
+
+	good, err := os.ReadFile(path)
+	require.NoError(t, err)
+	for name, corrupt := range map[string][]byte{
+		"torn write":     good[:len(good)/2],
+		"edited counter": []byte(strings.Replace(string(good), `"bytes_up": 2`, `"bytes_up": 9`, 1)),
+		"no version":     []byte(`{"data":{}}`),
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, os.WriteFile(path, corrupt, 0o600))
+			got, err := Load(path)
+			require.ErrorIs(t, err, ErrCorrupt)
+			assert.Contains(t, err.Error(), "previous checkpoint")
+			assert.Equal(t, int64(1), got.Targets["k"].Total.BytesUp, "the backup")
+		})
+	}
+
+	require.NoError(t, os.Remove(path+".bak"))
+	got, err := Load(path)
+	require.ErrorIs(t, err, ErrCorrupt)
+	assert.Empty(t, got.Targets, "no backup: start over")
+
+	// The next save keeps the corrupt file aside instead of as the backup.
+	require.NoError(t, Save(path, got, at(10, 15, 14, 0)))
+	_, err = os.Stat(path + ".corrupt")
+	require.NoError(t, err)
+	_, err = Load(path)
+	require.NoError(t, err)
+}
+
+func TestLoad_MissingFileUsesBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	var d Data
+	d.Add("k", Counters{BytesUp: 1}, at(10, 15, 12, 0))
+	require.NoError(t, Save(path, &d, at(10, 15, 12, 0)))
+	require.NoError(t, os.Rename(path, path+".bak"))
+
+	got, err := Load(path)
+	require.NoError(t, err, "a crash between the renames of Save")
+	assert.Equal(t, int64(1), got.Targets["k"].Total.BytesUp)
+}
+
+func TestLoad_NewerVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"version":99,"sha256":"","data":{}}`), 0o600))
+	got, err := Load(path)
+	require.ErrorIs(t, err, ErrNewerVersion)
+	assert.Nil(t, got)
+}
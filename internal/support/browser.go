@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"errors"
+	"os/exec"
+	"sync"
+)
+
+// ErrNoBrowser is returned where no browser can be started, e.g. on a
+// headless server.
+var ErrNoBrowser = errors.New("no browser available")
+
+// BrowserRunner starts the command name with args and returns without
+// waiting for it to exit.
+type BrowserRunner func(name string, args ...string) error
+
+// Browser opens URLs in the platform default browser: xdg-open, open or
+// rundll32's URL handler.
+type Browser struct {
+	run  BrowserRunner
+	once sync.Once
+}
+
+// NewBrowser returns a Browser starting commands with run; nil starts them
+// as child processes.
+func NewBrowser(run BrowserRunner) *Browser {
+	if run == nil {
+		run = startCommand
+	}
+	return &Browser{run: run}
+}
+
+// OpenOnce opens url unless an earlier call already opened (or tried to
+// open) one. It reports whether this call was the one.
+func (b *Browser) OpenOnce(url string) (opened bool, err error) {
+	b.once.Do(func() {
+		opened = true
+		name, args, cmdErr := browserCommand(url)
+		if cmdErr != nil {
+			err = cmdErr
+			return
+		}
+		err = b.run(name, args...)
+	})
+	return opened, err
+}
+
+func startCommand(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	if err := cmd.Start(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return ErrNoBrowser
+		}
+		return err
+	}
+	// Reap the opener; the browser it starts lives on.
+	go func() { _ = cmd.Wait() }()
+	return nil
+}
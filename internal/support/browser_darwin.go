@@ -0,0 +1,9 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+// browserCommand opens url with open(1).
+func browserCommand(url string) (string, []string, error) {
+	return "open", []string{url}, nil
+}
@@ -0,0 +1,17 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+//go:build !darwin && !windows
+
+package support
+
+import "os"
+
+// browserCommand opens url with xdg-open. Without a display there is no
+// browser to open it in.
+func browserCommand(url string) (string, []string, error) {
+	if os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+		return "", nil, ErrNoBrowser
+	}
+	return "xdg-open", []string{url}, nil
+}
@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBrowser_OpensOnce(t *testing.T) {
+	t.Setenv("DISPLAY", ":0")
+	var calls [][]string
+	b := NewBrowser(func(name string, args ...string) error {
+		calls = append(calls, append([]string{name}, args...))
+		return nil
+	})
+
+	opened, err := b.OpenOnce("https://app.example.com/")
+	require.NoError(t, err)
+	assert.True(t, opened)
+	opened, err = b.OpenOnce("https://other.example.com/")
+	require.NoError(t, err)
+	assert.False(t, opened)
+
+	require.Len(t, calls, 1)
+	assert.Equal(t, "https://app.example.com/", calls[0][len(calls[0])-1])
+}
+
+func TestBrowser_RunnerErrorIsReturnedOnce(t *testing.T) {
+	t.Setenv("DISPLAY", ":0")
+	b := NewBrowser(func(string, ...string) error { return ErrNoBrowser })
+	opened, err := b.OpenOnce("https://app.example.com/")
+	assert.True(t, opened)
+	require.ErrorIs(t, err, ErrNoBrowser)
+	opened, err = b.OpenOnce("https://app.example.com/")
+	assert.False(t, opened)
+	require.NoError(t, err, "a failed open is not retried")
+}
+
+func TestBrowser_Headless(t *testing.T) {
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		t.Skip("always has a desktop")
+	}
+	t.Setenv("DISPLAY", "")
+	t.Setenv("WAYLAND_DISPLAY", "")
+	b := NewBrowser(func(string, ...string) error { return errors.New("must not run") })
+	_, err := b.OpenOnce("https://app.example.com/")
+	require.ErrorIs(t, err, ErrNoBrowser)
+}
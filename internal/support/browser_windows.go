@@ -0,0 +1,10 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+// browserCommand opens url with the shell's URL handler; unlike start it
+// needs no cmd.exe quoting of the URL.
+func browserCommand(url string) (string, []string, error) {
+	return "rundll32", []string{"url.dll,FileProtocolHandler", url}, nil
+}
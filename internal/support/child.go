@@ -0,0 +1,265 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultChildProcs is how many children a ChildRunner runs at once
+	// unless told otherwise.
+	DefaultChildProcs = 8
+	// DefaultChildOutput is how many bytes of a child's output are kept
+	// unless told otherwise.
+	DefaultChildOutput = 16 << 10
+	// childKillGrace is how long a timed-out child's process group gets
+	// between SIGTERM and SIGKILL.
+	childKillGrace = 200 * time.Millisecond
+)
+
+var (
+	// ErrChildTimeout is returned for a child killed at its deadline.
+	ErrChildTimeout = errors.New("child process timed out")
+	// ErrChildBusy is returned when no child slot frees up before the
+	// deadline.
+	ErrChildBusy = errors.New("too many child processes running")
+)
+
+// childBaseEnv are the variables every child inherits: what programs need
+// to find their tools, home and locale, on POSIX and on Windows.
+var childBaseEnv = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "SHELL", "LANG", "LC_ALL", "TZ", "TMPDIR",
+	"SYSTEMROOT", "WINDIR", "COMSPEC", "PATHEXT", "TEMP", "TMP", "USERPROFILE",
+}
+
+// ChildLimits bound the children of a ChildRunner. Zero values pick the
+// defaults.
+type ChildLimits struct {
+	// MaxProcs is how many children may run at once.
+	MaxProcs int
+	// MaxOutput caps the bytes of output kept per child.
+	MaxOutput int
+	// PassEnv names variables passed through to children on top of the
+	// base ones (PATH, HOME, locale, ...).
+	PassEnv []string
+}
+
+// ChildSpec is one command for a ChildRunner.
+type ChildSpec struct {
+	Path  string
+	Args  []string
+	Stdin []byte
+	// Env are the documented KEY=VALUE variables of the feature.
+	Env []string
+}
+
+// ChildResult is what a child wrote: Stdout alone, and Output with stdout
+// and stderr interleaved. Each keeps MaxOutput bytes; the rest is replaced
+// by a marker and Truncated is set.
+type ChildResult struct {
+	Stdout    []byte
+	Output    []byte
+	Truncated bool
+}
+
+// ChildStats count the children a ChildRunner started, killed at their
+// deadline, that failed otherwise, or that never got a slot.
+type ChildStats struct {
+	Started  uint64
+	TimedOut uint64
+	Failed   uint64
+	Busy     uint64
+}
+
+// ChildRunner runs user-supplied commands so that a misbehaving one cannot
+// hurt the client: each gets a deadline after which its whole process
+// group is killed, its output is capped, only allow-listed variables reach
+// it, and at most MaxProcs run at once. It is safe for concurrent use.
+type ChildRunner struct {
+	mu     sync.Mutex
+	limits ChildLimits
+	slots  chan struct{}
+
+	started  atomic.Uint64
+	timedOut atomic.Uint64
+	failed   atomic.Uint64
+	busy     atomic.Uint64
+}
+
+// NewChildRunner returns a runner with limits.
+func NewChildRunner(limits ChildLimits) *ChildRunner {
+	r := &ChildRunner{}
+	r.SetLimits(limits)
+	return r
+}
+
+// SetLimits replaces the runner's limits; children already running keep
+// their slots.
+func (r *ChildRunner) SetLimits(limits ChildLimits) {
+	if limits.MaxProcs <= 0 {
+		limits.MaxProcs = DefaultChildProcs
+	}
+	if limits.MaxOutput <= 0 {
+		limits.MaxOutput = DefaultChildOutput
+	}
+	limits.PassEnv = append([]string(nil), limits.PassEnv...)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limits = limits
+	r.slots = make(chan struct{}, limits.MaxProcs)
+}
+
+// Stats returns the runner's counters.
+func (r *ChildRunner) Stats() ChildStats {
+	return ChildStats{
+		Started:  r.started.Load(),
+		TimedOut: r.timedOut.Load(),
+		Failed:   r.failed.Load(),
+		Busy:     r.busy.Load(),
+	}
+}
+
+// Run runs spec until it exits or ctx ends. A child still running when ctx
+// ends is killed with its process group and ErrChildTimeout returned; the
+// output it wrote until then is returned as well.
+func (r *ChildRunner) Run(ctx context.Context, spec ChildSpec) (ChildResult, error) {
+	r.mu.Lock()
+	limits, slots := r.limits, r.slots
+	r.mu.Unlock()
+	select {
+	case slots <- struct{}{}:
+	default:
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			r.busy.Add(1)
+			return ChildResult{}, ErrChildBusy
+		}
+	}
+	defer func() { <-slots }()
+
+	stdout := &cappedBuffer{max: limits.MaxOutput}
+	output := &cappedBuffer{max: limits.MaxOutput}
+	cmd := exec.Command(spec.Path, spec.Args...)
+	cmd.Env = childEnv(os.Environ(), limits.PassEnv, spec.Env)
+	cmd.Stdin = bytes.NewReader(spec.Stdin)
+	cmd.Stdout = io.MultiWriter(stdout, output)
+	cmd.Stderr = output
+	// A grandchild keeping the pipes open must not hold up Wait.
+	cmd.WaitDelay = childKillGrace
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		r.failed.Add(1)
+		return ChildResult{}, err
+	}
+	r.started.Add(1)
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	var err error
+	select {
+	case err = <-done:
+		if errors.Is(err, exec.ErrWaitDelay) {
+			// The child exited fine; something it started still holds
+			// its output open.
+			err = nil
+		}
+	case <-ctx.Done():
+		terminateProcessGroup(cmd.Process)
+		grace := time.NewTimer(childKillGrace)
+		select {
+		case <-done:
+		case <-grace.C:
+			killProcessGroup(cmd.Process)
+			<-done
+		}
+		grace.Stop()
+		err = ErrChildTimeout
+	}
+	res := ChildResult{Stdout: stdout.bytes(), Output: output.bytes(), Truncated: stdout.truncated() || output.truncated()}
+	switch {
+	case errors.Is(err, ErrChildTimeout):
+		r.timedOut.Add(1)
+	case err != nil:
+		r.failed.Add(1)
+	}
+	return res, err
+}
+
+// childEnv keeps the base and passEnv variables of environ and adds extra.
+func childEnv(environ, passEnv, extra []string) []string {
+	allowed := make(map[string]bool, len(childBaseEnv)+len(passEnv))
+	for _, name := range slices.Concat(childBaseEnv, passEnv) {
+		if runtime.GOOS == "windows" {
+			name = strings.ToUpper(name)
+		}
+		allowed[name] = true
+	}
+	env := make([]string, 0, len(allowed)+len(extra))
+	for _, kv := range environ {
+		name, _, _ := strings.Cut(kv, "=")
+		if runtime.GOOS == "windows" {
+			name = strings.ToUpper(name)
+		}
+		if allowed[name] {
+			env = append(env, kv)
+		}
+	}
+	return append(env, extra...)
+}
+
+// cappedBuffer keeps the first max bytes written and counts the rest.
+type cappedBuffer struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	max     int
+	dropped int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	room := b.max - b.buf.Len()
+	switch {
+	case room <= 0:
+		b.dropped += len(p)
+	case len(p) > room:
+		b.buf.Write(p[:room])
+		b.dropped += len(p) - room
+	default:
+		b.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+func (b *cappedBuffer) truncated() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dropped > 0
+}
+
+// bytes returns the kept bytes, followed by a marker when some were
+// discarded.
+func (b *cappedBuffer) bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := bytes.Clone(b.buf.Bytes())
+	if b.dropped > 0 {
+		out = fmt.Appendf(out, "\n[... %d more bytes discarded]\n", b.dropped)
+	}
+	return out
+}
@@ -0,0 +1,32 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+//go:build !windows
+
+package support
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChildRunner_TimeoutKillsProcessGroup(t *testing.T) {
+	r := NewChildRunner(ChildLimits{})
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	res, err := r.Run(ctx, shellChild(t, "sleep 30 & echo $!; wait"))
+	require.ErrorIs(t, err, ErrChildTimeout)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(res.Stdout)))
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return syscall.Kill(pid, 0) != nil
+	}, 2*time.Second, 10*time.Millisecond, "grandchild %d survived", pid)
+}
@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func shellChild(t *testing.T, script string) ChildSpec {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	return ChildSpec{Path: "sh", Args: []string{"-c", script}}
+}
+
+func TestChildRunner_Output(t *testing.T) {
+	r := NewChildRunner(ChildLimits{})
+	spec := shellChild(t, "cat; echo oops >&2; exit 3")
+	spec.Stdin = []byte("hello\n")
+
+	res, err := r.Run(context.Background(), spec)
+	require.Error(t, err)
+	assert.Equal(t, "hello\n", string(res.Stdout))
+	assert.Contains(t, string(res.Output), "oops")
+	assert.False(t, res.Truncated)
+	assert.Equal(t, ChildStats{Started: 1, Failed: 1}, r.Stats())
+}
+
+func TestChildRunner_TimeoutKillsChild(t *testing.T) {
+	r := NewChildRunner(ChildLimits{})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	res, err := r.Run(ctx, shellChild(t, "echo started; trap '' TERM; sleep 30"))
+	require.ErrorIs(t, err, ErrChildTimeout)
+	assert.Less(t, time.Since(start), 5*time.Second, "SIGKILL follows an ignored SIGTERM")
+	assert.Equal(t, "started\n", string(res.Stdout))
+	assert.Equal(t, ChildStats{Started: 1, TimedOut: 1}, r.Stats())
+}
+
+func TestChildRunner_CapsOutput(t *testing.T) {
+	r := NewChildRunner(ChildLimits{MaxOutput: 64})
+
+	res, err := r.Run(context.Background(), shellChild(t, "head -c 100000 /dev/zero | tr '\\0' x"))
+	require.NoError(t, err)
+	assert.True(t, res.Truncated)
+	assert.Equal(t, strings.Repeat("x", 64)+"\n[... 99936 more bytes discarded]\n", string(res.Stdout))
+	assert.Equal(t, string(res.Stdout), string(res.Output))
+}
+
+func TestChildRunner_MaxProcs(t *testing.T) {
+	r := NewChildRunner(ChildLimits{MaxProcs: 2})
+	release := t.TempDir() + "/release"
+
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := r.Run(context.Background(), shellChild(t, "while [ ! -e "+release+" ]; do sleep 0.01; done"))
+			assert.NoError(t, err)
+		}()
+	}
+	require.Eventually(t, func() bool { return r.Stats().Started == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := r.Run(ctx, shellChild(t, "true"))
+	require.ErrorIs(t, err, ErrChildBusy)
+
+	require.NoError(t, os.WriteFile(release, nil, 0o600))
+	wg.Wait()
+	_, err = r.Run(context.Background(), shellChild(t, "true"))
+	require.NoError(t, err)
+	assert.Equal(t, ChildStats{Started: 3, Busy: 1}, r.Stats())
+}
+
+func TestChildRunner_Env(t *testing.T) {
+	t.Setenv("CHILD_TEST_SECRET", "s3cret")
+	t.Setenv("CHILD_TEST_PASSED", "ok")
+	r := NewChildRunner(ChildLimits{PassEnv: []string{"CHILD_TEST_PASSED"}})
+	spec := shellChild(t, "env")
+	spec.Env = []string{"FORTUNNELS_PEER_ADDR=203.0.113.7:5000"}
+
+	res, err := r.Run(context.Background(), spec)
+	require.NoError(t, err)
+	env := string(res.Stdout)
+	assert.NotContains(t, env, "CHILD_TEST_SECRET")
+	assert.Contains(t, env, "CHILD_TEST_PASSED=ok\n")
+	assert.Contains(t, env, "FORTUNNELS_PEER_ADDR=203.0.113.7:5000\n")
+	assert.Contains(t, env, "PATH=")
+}
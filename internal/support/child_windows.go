@@ -0,0 +1,19 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+//go:build windows
+
+package support
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup does nothing on Windows: there are no POSIX process
+// groups, so a timeout kills the child alone.
+func setProcessGroup(*exec.Cmd) {}
+
+func terminateProcessGroup(p *os.Process) { _ = p.Kill() }
+
+func killProcessGroup(p *os.Process) { _ = p.Kill() }
@@ -0,0 +1,229 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the time source of code that waits: reconnect backoff, ping
+// loops, pollers. Production code uses RealClock; tests pass a FakeClock and
+// move it forward by hand, so they run in no time and in the same order on
+// every run.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+	Sleep(d time.Duration)
+}
+
+// Timer is a *time.Timer of a Clock.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker is a *time.Ticker of a Clock.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+	Reset(d time.Duration)
+}
+
+// RealClock is the Clock of the time package.
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                   { return time.Now() }
+func (realClock) NewTimer(d time.Duration) Timer   { return realTimer{time.NewTimer(d)} }
+func (realClock) NewTicker(d time.Duration) Ticker { return realTicker{time.NewTicker(d)} }
+func (realClock) Sleep(d time.Duration)            { time.Sleep(d) }
+
+type realTimer struct{ *time.Timer }
+
+func (t realTimer) C() <-chan time.Time { return t.Timer.C }
+
+type realTicker struct{ *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.Ticker.C }
+
+// FakeClock is a Clock whose time only moves with Advance. Its timers and
+// tickers fire, in order, as Advance passes their deadlines; like the time
+// package's, a tick is dropped when the previous one was not received yet.
+type FakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+// NewFakeClock returns a FakeClock reading start, so that tests printing
+// times get the same output on every run.
+func NewFakeClock(start time.Time) *FakeClock {
+	c := &FakeClock{now: start}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// fakeWaiter is a pending timer or ticker; period is zero for a timer.
+type fakeWaiter struct {
+	when   time.Time
+	period time.Duration
+	c      chan time.Time
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	w := &fakeWaiter{c: make(chan time.Time, 1)}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.scheduleLocked(w, d)
+	return fakeTimer{c, w}
+}
+
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("support: non-positive interval for FakeClock.NewTicker")
+	}
+	w := &fakeWaiter{c: make(chan time.Time, 1), period: d}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.scheduleLocked(w, d)
+	return fakeTicker{c, w}
+}
+
+// Sleep blocks until Advance moved the clock d forward.
+func (c *FakeClock) Sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	<-c.NewTimer(d).C()
+}
+
+// Advance moves the clock d forward, firing the timers and tickers due on
+// the way at their own deadlines.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	target := c.now.Add(d)
+	for {
+		next := -1
+		for i, w := range c.waiters {
+			if !w.when.After(target) && (next < 0 || w.when.Before(c.waiters[next].when)) {
+				next = i
+			}
+		}
+		if next < 0 {
+			break
+		}
+		w := c.waiters[next]
+		c.now = w.when
+		select {
+		case w.c <- c.now:
+		default:
+		}
+		if w.period > 0 {
+			w.when = w.when.Add(w.period)
+		} else {
+			c.removeLocked(w)
+		}
+	}
+	c.now = target
+	c.cond.Broadcast()
+}
+
+// BlockUntil waits until n timers, tickers or sleeps are pending: the code
+// under test has reached the wait that the next Advance is meant for.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
+
+// Waiters reports how many timers, tickers and sleeps are pending.
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// scheduleLocked makes w fire d from now; a timer due already fires at once.
+func (c *FakeClock) scheduleLocked(w *fakeWaiter, d time.Duration) {
+	c.removeLocked(w)
+	w.when = c.now.Add(d)
+	if d <= 0 && w.period == 0 {
+		select {
+		case w.c <- c.now:
+		default:
+		}
+		return
+	}
+	c.waiters = append(c.waiters, w)
+	c.cond.Broadcast()
+}
+
+// removeLocked unschedules w and reports whether it was pending.
+func (c *FakeClock) removeLocked(w *fakeWaiter) bool {
+	for i, p := range c.waiters {
+		if p == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTimer struct {
+	clock *FakeClock
+	w     *fakeWaiter
+}
+
+func (t fakeTimer) C() <-chan time.Time { return t.w.c }
+
+func (t fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.clock.removeLocked(t.w)
+}
+
+func (t fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	pending := t.clock.removeLocked(t.w)
+	t.clock.scheduleLocked(t.w, d)
+	return pending
+}
+
+type fakeTicker struct {
+	clock *FakeClock
+	w     *fakeWaiter
+}
+
+func (t fakeTicker) C() <-chan time.Time { return t.w.c }
+
+func (t fakeTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.clock.removeLocked(t.w)
+}
+
+func (t fakeTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("support: non-positive interval for Ticker.Reset")
+	}
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.w.period = d
+	t.clock.scheduleLocked(t.w, d)
+}
@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var fakeStart = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func received(c <-chan time.Time) (time.Time, bool) {
+	select {
+	case t := <-c:
+		return t, true
+	default:
+		return time.Time{}, false
+	}
+}
+
+func TestFakeClock_TimersFireInOrderAtTheirDeadlines(t *testing.T) {
+	c := NewFakeClock(fakeStart)
+	late := c.NewTimer(3 * time.Second)
+	early := c.NewTimer(time.Second)
+	assert.Equal(t, 2, c.Waiters())
+
+	c.Advance(999 * time.Millisecond)
+	_, fired := received(early.C())
+	assert.False(t, fired)
+
+	c.Advance(5 * time.Second)
+	at, fired := received(early.C())
+	require.True(t, fired)
+	assert.Equal(t, fakeStart.Add(time.Second), at)
+	at, fired = received(late.C())
+	require.True(t, fired)
+	assert.Equal(t, fakeStart.Add(3*time.Second), at)
+	assert.Equal(t, fakeStart.Add(5999*time.Millisecond), c.Now())
+	assert.Zero(t, c.Waiters())
+}
+
+func TestFakeClock_StopAndReset(t *testing.T) {
+	c := NewFakeClock(fakeStart)
+	tm := c.NewTimer(time.Second)
+	assert.True(t, tm.Stop())
+	assert.False(t, tm.Stop())
+	c.Advance(time.Minute)
+	_, fired := received(tm.C())
+	assert.False(t, fired)
+
+	assert.False(t, tm.Reset(time.Second))
+	c.Advance(time.Second)
+	_, fired = received(tm.C())
+	assert.True(t, fired)
+}
+
+func TestFakeClock_TickerDropsTicksNobodyReceived(t *testing.T) {
+	c := NewFakeClock(fakeStart)
+	tk := c.NewTicker(10 * time.Second)
+	c.Advance(35 * time.Second)
+	at, fired := received(tk.C())
+	require.True(t, fired)
+	assert.Equal(t, fakeStart.Add(10*time.Second), at, "later ticks found the channel full")
+	_, fired = received(tk.C())
+	assert.False(t, fired)
+
+	tk.Reset(time.Second)
+	c.Advance(time.Second)
+	at, fired = received(tk.C())
+	require.True(t, fired)
+	assert.Equal(t, fakeStart.Add(36*time.Second), at)
+
+	tk.Stop()
+	assert.Zero(t, c.Waiters())
+}
+
+func TestFakeClock_SleepAndBlockUntil(t *testing.T) {
+	c := NewFakeClock(fakeStart)
+	woke := make(chan time.Time)
+	go func() {
+		c.Sleep(time.Hour)
+		woke <- c.Now()
+	}()
+	c.BlockUntil(1)
+	c.Advance(time.Hour)
+	select {
+	case at := <-woke:
+		assert.Equal(t, fakeStart.Add(time.Hour), at)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the sleep did not end")
+	}
+}
+
+func TestRealClock(t *testing.T) {
+	tm := RealClock.NewTimer(time.Millisecond)
+	select {
+	case <-tm.C():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the real timer did not fire")
+	}
+	tk := RealClock.NewTicker(time.Millisecond)
+	defer tk.Stop()
+	<-tk.C()
+	assert.WithinDuration(t, time.Now(), RealClock.Now(), time.Second)
+}
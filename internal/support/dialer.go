@@ -0,0 +1,199 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// backendDialTimeout bounds each backend (and backend proxy) dial.
+const backendDialTimeout = 10 * time.Second
+
+// BackendDialer dials the local backends the client serves.
+type BackendDialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// BackendDialError reports a failed dial through a backend proxy and whether
+// the proxy itself or the final target was the problem.
+type BackendDialError struct {
+	Proxy       string // proxy URL without credentials
+	Target      string
+	ProxyFailed bool
+	Err         error
+}
+
+func (e *BackendDialError) Error() string {
+	if e.ProxyFailed {
+		return fmt.Sprintf("backend proxy %s unreachable: %v", e.Proxy, e.Err)
+	}
+	return fmt.Sprintf("backend proxy %s could not reach %s: %v", e.Proxy, e.Target, e.Err)
+}
+
+func (e *BackendDialError) Unwrap() error { return e.Err }
+
+// NewBackendDialer returns the dialer for --backend-proxy: a direct dialer
+// when proxyURL is empty, HTTP CONNECT for http:// and SOCKS5 for socks5://
+// or socks5h:// URLs. Through a proxy, target names are resolved by the proxy.
+// User info in the URL is sent as proxy credentials.
+func NewBackendDialer(proxyURL string) (BackendDialer, error) {
+	direct := &net.Dialer{Timeout: backendDialTimeout}
+	if strings.TrimSpace(proxyURL) == "" {
+		return direct, nil
+	}
+	u, err := url.Parse(strings.TrimSpace(proxyURL))
+	if err != nil {
+		return nil, fmt.Errorf("invalid backend proxy URL: %w", err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid backend proxy URL %q: missing host", u.Redacted())
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http":
+		return &connectDialer{proxy: u, forward: direct}, nil
+	case "socks5", "socks5h":
+		return newSOCKS5Dialer(u, direct), nil
+	default:
+		return nil, fmt.Errorf("unsupported backend proxy scheme %q (use http, socks5 or socks5h)", u.Scheme)
+	}
+}
+
+// proxyLabel is the proxy URL as shown in errors: scheme and host only.
+func proxyLabel(u *url.URL) string {
+	return u.Scheme + "://" + u.Host
+}
+
+// connectDialer tunnels TCP through an HTTP proxy with CONNECT.
+type connectDialer struct {
+	proxy   *url.URL
+	forward *net.Dialer
+}
+
+func (d *connectDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	fail := func(proxyFailed bool, err error) error {
+		return &BackendDialError{Proxy: proxyLabel(d.proxy), Target: addr, ProxyFailed: proxyFailed, Err: err}
+	}
+	conn, err := d.forward.DialContext(ctx, "tcp", d.proxy.Host)
+	if err != nil {
+		return nil, fail(true, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	} else {
+		_ = conn.SetDeadline(time.Now().Add(backendDialTimeout))
+	}
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if user := d.proxy.User; user != nil {
+		pass, _ := user.Password()
+		creds := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + pass))
+		req.Header.Set("Proxy-Authorization", "Basic "+creds)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fail(true, err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, fail(true, fmt.Errorf("read CONNECT response: %w", err))
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusProxyAuthRequired:
+		conn.Close()
+		return nil, fail(true, errors.New("proxy authentication required (set user:pass in --backend-proxy)"))
+	case resp.StatusCode != http.StatusOK:
+		// The proxy answered but refused or failed to reach the target.
+		conn.Close()
+		return nil, fail(false, fmt.Errorf("CONNECT returned %s", resp.Status))
+	}
+	_ = conn.SetDeadline(time.Time{})
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn returns bytes the proxy sent right after its CONNECT reply
+// before reading from the connection again.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) { return c.r.Read(p) }
+
+// CloseWrite keeps half-close working for the backend bridge.
+func (c *bufferedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// socks5Dialer wraps x/net/proxy's SOCKS5 client and records whether the
+// proxy connection itself was established, to attribute failures.
+type socks5Dialer struct {
+	proxy   *url.URL
+	forward *net.Dialer
+	auth    *proxy.Auth
+}
+
+func newSOCKS5Dialer(u *url.URL, forward *net.Dialer) *socks5Dialer {
+	d := &socks5Dialer{proxy: u, forward: forward}
+	if u.User != nil {
+		pass, _ := u.User.Password()
+		d.auth = &proxy.Auth{User: u.User.Username(), Password: pass}
+	}
+	return d
+}
+
+func (d *socks5Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	forward := &recordingDialer{d: d.forward}
+	client, err := proxy.SOCKS5("tcp", d.proxy.Host, d.auth, forward)
+	if err != nil {
+		return nil, &BackendDialError{Proxy: proxyLabel(d.proxy), Target: addr, ProxyFailed: true, Err: err}
+	}
+	conn, err := client.(proxy.ContextDialer).DialContext(ctx, network, addr)
+	if err != nil {
+		// After the proxy connection, only an authentication failure is the
+		// proxy's fault; other SOCKS replies describe the target.
+		proxyFailed := !forward.connected || strings.Contains(err.Error(), "authentication")
+		return nil, &BackendDialError{Proxy: proxyLabel(d.proxy), Target: addr, ProxyFailed: proxyFailed, Err: err}
+	}
+	return conn, nil
+}
+
+// recordingDialer notes whether a connection to the proxy succeeded.
+type recordingDialer struct {
+	d         *net.Dialer
+	connected bool
+}
+
+func (r *recordingDialer) Dial(network, addr string) (net.Conn, error) {
+	return r.DialContext(context.Background(), network, addr)
+}
+
+func (r *recordingDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := r.d.DialContext(ctx, network, addr)
+	r.connected = err == nil
+	return conn, err
+}
@@ -0,0 +1,212 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func listenTCP(t *testing.T) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	return ln
+}
+
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func startEcho(t *testing.T) string {
+	t.Helper()
+	ln := listenTCP(t)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				_, _ = io.Copy(c, c)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// cannedConnectProxy answers every CONNECT with status and records the
+// Proxy-Authorization header it saw.
+func cannedConnectProxy(t *testing.T, status int, sawAuth chan<- string) string {
+	t.Helper()
+	ln := listenTCP(t)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			req, err := http.ReadRequest(bufio.NewReader(c))
+			if err == nil {
+				if sawAuth != nil {
+					sawAuth <- req.Header.Get("Proxy-Authorization")
+				}
+				_, _ = io.WriteString(c, "HTTP/1.1 "+strconv.Itoa(status)+" "+http.StatusText(status)+"\r\n\r\n")
+			}
+			c.Close()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// startSOCKS5 runs a no-auth SOCKS5 server that connects domain targets via
+// hosts (falling back to the name itself).
+func startSOCKS5(t *testing.T, hosts map[string]string) string {
+	t.Helper()
+	ln := listenTCP(t)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSOCKS5(c, hosts)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveSOCKS5(c net.Conn, hosts map[string]string) {
+	defer c.Close()
+	hdr := make([]byte, 2)
+	if _, err := io.ReadFull(c, hdr); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(c, make([]byte, hdr[1])); err != nil {
+		return
+	}
+	_, _ = c.Write([]byte{5, 0}) // no authentication
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(c, req); err != nil || req[3] != 3 {
+		return
+	}
+	n := make([]byte, 1)
+	if _, err := io.ReadFull(c, n); err != nil {
+		return
+	}
+	name := make([]byte, n[0]+2)
+	if _, err := io.ReadFull(c, name); err != nil {
+		return
+	}
+	target := net.JoinHostPort(string(name[:n[0]]), strconv.Itoa(int(binary.BigEndian.Uint16(name[n[0]:]))))
+	if mapped, ok := hosts[target]; ok {
+		target = mapped
+	}
+	backend, err := net.Dial("tcp", target)
+	if err != nil {
+		_, _ = c.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0}) // connection refused
+		return
+	}
+	defer backend.Close()
+	_, _ = c.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	go func() { _, _ = io.Copy(backend, c) }()
+	_, _ = io.Copy(c, backend)
+}
+
+func roundTrip(t *testing.T, conn net.Conn, msg string) {
+	t.Helper()
+	defer conn.Close()
+	_, err := conn.Write([]byte(msg))
+	require.NoError(t, err)
+	buf := make([]byte, len(msg))
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, msg, string(buf))
+}
+
+func requireDialError(t *testing.T, err error, proxyFailed bool) {
+	t.Helper()
+	var de *BackendDialError
+	require.True(t, errors.As(err, &de), "want BackendDialError, got %v", err)
+	assert.Equal(t, proxyFailed, de.ProxyFailed, "attribution of %v", err)
+}
+
+func TestNewBackendDialer_Schemes(t *testing.T) {
+	d, err := NewBackendDialer("")
+	require.NoError(t, err)
+	assert.IsType(t, &net.Dialer{}, d)
+
+	for _, bad := range []string{"ftp://proxy:21", "http://", "::not a url"} {
+		_, err := NewBackendDialer(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestConnectDialer_Attribution(t *testing.T) {
+	ctx := context.Background()
+
+	d, err := NewBackendDialer("http://" + closedAddr(t))
+	require.NoError(t, err)
+	_, err = d.DialContext(ctx, "tcp", "backend:80")
+	requireDialError(t, err, true)
+	assert.Contains(t, err.Error(), "backend proxy")
+	assert.Contains(t, err.Error(), "unreachable")
+
+	d, err = NewBackendDialer("http://" + cannedConnectProxy(t, http.StatusBadGateway, nil))
+	require.NoError(t, err)
+	_, err = d.DialContext(ctx, "tcp", "backend:80")
+	requireDialError(t, err, false)
+	assert.Contains(t, err.Error(), "could not reach backend:80")
+
+	sawAuth := make(chan string, 1)
+	d, err = NewBackendDialer("http://alice:s3cret@" + cannedConnectProxy(t, http.StatusProxyAuthRequired, sawAuth))
+	require.NoError(t, err)
+	_, err = d.DialContext(ctx, "tcp", "backend:80")
+	requireDialError(t, err, true)
+	assert.Equal(t, "Basic YWxpY2U6czNjcmV0", <-sawAuth)
+	assert.NotContains(t, err.Error(), "s3cret", "credentials stay out of errors")
+}
+
+func TestSOCKS5Dialer(t *testing.T) {
+	ctx := context.Background()
+	echo := startEcho(t)
+	d, err := NewBackendDialer("socks5://" + startSOCKS5(t, map[string]string{"echo.internal:7": echo}))
+	require.NoError(t, err)
+
+	conn, err := d.DialContext(ctx, "tcp", "echo.internal:7")
+	require.NoError(t, err)
+	roundTrip(t, conn, "via socks")
+
+	_, err = d.DialContext(ctx, "tcp", "localhost:"+portOf(t, closedAddr(t)))
+	requireDialError(t, err, false)
+
+	d, err = NewBackendDialer("socks5://" + closedAddr(t))
+	require.NoError(t, err)
+	_, err = d.DialContext(ctx, "tcp", "echo.internal:7")
+	requireDialError(t, err, true)
+}
+
+func portOf(t *testing.T, addr string) string {
+	t.Helper()
+	_, port, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+	return port
+}
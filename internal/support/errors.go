@@ -11,20 +11,63 @@ import (
 	"os"
 	"strings"
 	"syscall"
+	"time"
 )
 
 // HandleTunnelCreationError formats a user-friendly error for tunnel creation failures.
 // Returns an error for the caller to handle (e.g. main exits); does not call os.Exit.
+// The error carries the exit code from TunnelCreationExitCode.
 func HandleTunnelCreationError(err error, serverURL string) error {
 	if IsConnRefused(err) || IsDialTimeout(err) {
-		return fmt.Errorf("❌ Unable to connect to server: %s\n   Make sure the server is running. Hint: make run-dev", serverURL)
+		return WithExitCode(ExitServerUnreachable, fmt.Errorf("❌ Unable to connect to server: %s\n   Make sure the server is running. Hint: make run-dev", serverURL))
 	}
 	if err != nil {
-		return fmt.Errorf("❌ Failed to create tunnel: %w", err)
+		if hint := apiErrorHint(err); hint != "" {
+			return WithExitCode(TunnelCreationExitCode(err), fmt.Errorf("❌ Failed to create tunnel: %w\n   %s", err, hint))
+		}
+		return WithExitCode(TunnelCreationExitCode(err), fmt.Errorf("❌ Failed to create tunnel: %w", err))
 	}
 	return fmt.Errorf("❌ Failed to create tunnel: unknown error")
 }
 
+// controlAPIError is implemented by control.APIError, which this package
+// cannot import (control imports support).
+type controlAPIError interface {
+	error
+	APIErrorCode() string
+	APIStatusCode() int
+	APIRetryAfter() time.Duration
+}
+
+func asAPIError(err error) (controlAPIError, bool) {
+	var apiErr controlAPIError
+	ok := errors.As(err, &apiErr)
+	return apiErr, ok
+}
+
+// apiErrorHint suggests what to do about the server's error code; "" for
+// codes without a specific remedy.
+func apiErrorHint(err error) string {
+	apiErr, ok := asAPIError(err)
+	if !ok {
+		return ""
+	}
+	switch apiErr.APIErrorCode() {
+	case "quota_exceeded":
+		return "💡 Tunnel quota reached: delete tunnels you no longer need or upgrade your plan."
+	case "subdomain_taken":
+		return "💡 That subdomain is already taken: choose another name."
+	case "auth_expired":
+		return "💡 Your session has expired: log in again (--login/--pass) or pass a fresh --token."
+	case "rate_limited":
+		if wait := apiErr.APIRetryAfter(); wait > 0 {
+			return fmt.Sprintf("💡 Too many requests: retry in %s, or set --create-retries to retry automatically.", wait)
+		}
+		return "💡 Too many requests: retry later, or set --create-retries to retry automatically."
+	}
+	return ""
+}
+
 // isConnRefused returns true if error indicates connection refused
 func IsConnRefused(err error) bool {
 	if err == nil {
@@ -12,6 +12,10 @@ import (
 	"strings"
 	"syscall"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestIsConnRefused(t *testing.T) {
@@ -196,3 +200,45 @@ func TestHandleTunnelCreationError(t *testing.T) {
 		}
 	})
 }
+
+// fakeAPIError stands in for control.APIError.
+type fakeAPIError struct {
+	status     int
+	code       string
+	retryAfter time.Duration
+}
+
+func (e *fakeAPIError) Error() string                { return fmt.Sprintf("server returned status %d", e.status) }
+func (e *fakeAPIError) APIErrorCode() string         { return e.code }
+func (e *fakeAPIError) APIStatusCode() int           { return e.status }
+func (e *fakeAPIError) APIRetryAfter() time.Duration { return e.retryAfter }
+
+func TestHandleTunnelCreationError_APIErrorCodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		hint     string
+		wantExit int
+	}{
+		{"quota", &fakeAPIError{status: 422, code: "quota_exceeded"}, "delete tunnels you no longer need or upgrade", ExitTunnelRejected},
+		{"subdomain", &fakeAPIError{status: 409, code: "subdomain_taken"}, "choose another name", ExitTunnelRejected},
+		{"auth expired", &fakeAPIError{status: 400, code: "auth_expired"}, "log in again", ExitAuth},
+		{"rate limited", &fakeAPIError{status: 429, code: "rate_limited", retryAfter: 5 * time.Second}, "retry in 5s, or set --create-retries", ExitTunnelRejected},
+		{"rate limited without delay", &fakeAPIError{status: 429, code: "rate_limited"}, "retry later", ExitTunnelRejected},
+		{"wrapped", fmt.Errorf("create: %w", &fakeAPIError{status: 422, code: "quota_exceeded"}), "upgrade your plan", ExitTunnelRejected},
+		{"unknown code", &fakeAPIError{status: 500, code: "internal"}, "", ExitServerUnreachable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := HandleTunnelCreationError(tt.err, "http://127.0.0.1:8080")
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "Failed to create tunnel")
+			if tt.hint == "" {
+				assert.NotContains(t, err.Error(), "💡")
+			} else {
+				assert.Contains(t, err.Error(), tt.hint)
+			}
+			assert.Equal(t, tt.wantExit, ExitCode(err))
+		})
+	}
+}
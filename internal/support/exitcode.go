@@ -0,0 +1,215 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// Process exit codes. They are part of the CLI contract (see README) so
+// wrapper scripts can tell failure classes apart without parsing output.
+const (
+	ExitOK                = 0
+	ExitError             = 1 // unclassified failure
+	ExitConfig            = 2 // invalid flags or configuration
+	ExitAuth              = 3 // authentication failed
+	ExitTunnelRejected    = 4 // server rejected tunnel creation (4xx)
+	ExitServerUnreachable = 5 // server could not be reached or is unavailable
+	ExitDataPlane         = 6 // data plane failed after retries
+	ExitTunnelGone        = 7 // tunnel deleted or expired on the server
+	ExitLocalTarget       = 8 // local listen/bind or target failure
+	ExitQuota             = 9 // tunnel reached its --max-bytes-total
+)
+
+var exitReasons = map[int]string{
+	ExitOK:                "ok",
+	ExitError:             "error",
+	ExitConfig:            "config",
+	ExitAuth:              "auth",
+	ExitTunnelRejected:    "tunnel_rejected",
+	ExitServerUnreachable: "server_unreachable",
+	ExitDataPlane:         "dataplane",
+	ExitTunnelGone:        "tunnel_gone",
+	ExitLocalTarget:       "local_target",
+	ExitQuota:             "quota",
+}
+
+// ErrTunnelGone reports that the server deleted or expired the tunnel. The
+// lifecycle watcher has already told the user, so it carries no extra text.
+var ErrTunnelGone = errors.New("tunnel was removed on the server")
+
+// CodedError attaches a process exit code to an error.
+type CodedError struct {
+	Code int
+	Err  error
+}
+
+func (e *CodedError) Error() string { return e.Err.Error() }
+func (e *CodedError) Unwrap() error { return e.Err }
+
+// WithExitCode wraps err so that ExitCode reports code for it. A nil err stays nil.
+func WithExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &CodedError{Code: code, Err: err}
+}
+
+// ExitCode returns the process exit code for err: ExitOK for nil, the code of
+// the outermost CodedError, ExitTunnelGone for ErrTunnelGone and ExitError
+// otherwise.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var ce *CodedError
+	if errors.As(err, &ce) {
+		return ce.Code
+	}
+	if errors.Is(err, ErrTunnelGone) {
+		return ExitTunnelGone
+	}
+	return ExitError
+}
+
+// ExitReason returns the slug printed in the final status line for code.
+func ExitReason(code int) string {
+	if r, ok := exitReasons[code]; ok {
+		return r
+	}
+	return exitReasons[ExitError]
+}
+
+// WriteStatusLine writes the final machine-readable status for err to w:
+// "STATUS code=<n> reason=<slug>" or, when jsonOutput is set, a JSON object
+// with the same fields plus the error text.
+func WriteStatusLine(w io.Writer, err error, jsonOutput bool) {
+	code := ExitCode(err)
+	reason := ExitReason(code)
+	if !jsonOutput {
+		fmt.Fprintf(w, "STATUS code=%d reason=%s\n", code, reason)
+		return
+	}
+	status := struct {
+		Status string `json:"status"`
+		Code   int    `json:"code"`
+		Reason string `json:"reason"`
+		Error  string `json:"error,omitempty"`
+	}{Status: "exit", Code: code, Reason: reason}
+	if err != nil {
+		status.Error = strings.TrimSpace(strings.TrimPrefix(err.Error(), "❌"))
+	}
+	b, _ := json.Marshal(status)
+	fmt.Fprintf(w, "%s\n", b)
+}
+
+// WriteListenLine announces the local address a --listen auto tunnel picked
+// on w: "LISTEN addr=<host:port>" or, with jsonOutput, a JSON object, so
+// scripts can connect without parsing the human-readable output.
+func WriteListenLine(w io.Writer, addr string, jsonOutput bool) {
+	if !jsonOutput {
+		fmt.Fprintf(w, "LISTEN addr=%s\n", addr)
+		return
+	}
+	b, _ := json.Marshal(struct {
+		Status string `json:"status"`
+		Listen string `json:"listen"`
+	}{Status: "listen", Listen: addr})
+	fmt.Fprintf(w, "%s\n", b)
+}
+
+// WriteMigrateLine announces on w that the tunnel moved to another server
+// node: "MIGRATED url=<public-url>" or, with jsonOutput, a JSON object, so
+// scripts notice a changed public URL.
+func WriteMigrateLine(w io.Writer, publicURL string, jsonOutput bool) {
+	if !jsonOutput {
+		fmt.Fprintf(w, "MIGRATED url=%s\n", publicURL)
+		return
+	}
+	b, _ := json.Marshal(struct {
+		Status    string `json:"status"`
+		PublicURL string `json:"public_url"`
+	}{Status: "migrated", PublicURL: publicURL})
+	fmt.Fprintf(w, "%s\n", b)
+}
+
+// WriteReadyLine announces on w that the public URL of the tunnel was
+// printed: "READY url=<public-url> connected=<bool>" or, with jsonOutput, a
+// JSON object. connected is false when the data plane did not connect
+// within --ready-timeout.
+func WriteReadyLine(w io.Writer, publicURL string, connected, jsonOutput bool) {
+	if !jsonOutput {
+		fmt.Fprintf(w, "READY url=%s connected=%t\n", publicURL, connected)
+		return
+	}
+	b, _ := json.Marshal(struct {
+		Status    string `json:"status"`
+		PublicURL string `json:"public_url"`
+		Connected bool   `json:"connected"`
+	}{Status: "ready", PublicURL: publicURL, Connected: connected})
+	fmt.Fprintf(w, "%s\n", b)
+}
+
+// WriteEncryptionLine reports on w whether the server confirmed the stream
+// encryption: "ENCRYPTION status=<state> cipher=<aead> key_id=<n>" or, with
+// jsonOutput, a JSON object that also carries the reason an unconfirmed
+// encryption gives. keyID 0 (the server has none) is left out.
+func WriteEncryptionLine(w io.Writer, state, cipher string, keyID int, reason string, jsonOutput bool) {
+	if !jsonOutput {
+		fmt.Fprintf(w, "ENCRYPTION status=%s cipher=%s", state, cipher)
+		if keyID > 0 {
+			fmt.Fprintf(w, " key_id=%d", keyID)
+		}
+		fmt.Fprint(w, "\n")
+		return
+	}
+	b, _ := json.Marshal(struct {
+		Status     string `json:"status"`
+		Encryption string `json:"encryption"`
+		Cipher     string `json:"cipher"`
+		KeyID      int    `json:"key_id,omitempty"`
+		Reason     string `json:"reason,omitempty"`
+	}{Status: "encryption", Encryption: state, Cipher: cipher, KeyID: keyID, Reason: reason})
+	fmt.Fprintf(w, "%s\n", b)
+}
+
+// TunnelCreationExitCode classifies a tunnel creation failure: unreachable or
+// 5xx servers, authentication (401/403) and other 4xx rejections.
+func TunnelCreationExitCode(err error) int {
+	if IsConnRefused(err) || IsDialTimeout(err) || isDNSError(err) {
+		return ExitServerUnreachable
+	}
+	apiErr, ok := asAPIError(err)
+	if !ok {
+		return ExitError
+	}
+	if apiErr.APIErrorCode() == "auth_expired" {
+		return ExitAuth
+	}
+	switch status := apiErr.APIStatusCode(); {
+	case status == 401 || status == 403:
+		return ExitAuth
+	case status >= 400 && status < 500:
+		return ExitTunnelRejected
+	case status >= 500:
+		return ExitServerUnreachable
+	}
+	return ExitError
+}
+
+// IsBindError reports whether err came from binding a local listener.
+func IsBindError(err error) bool {
+	var op *net.OpError
+	return errors.As(err, &op) && op.Op == "listen"
+}
+
+func isDNSError(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
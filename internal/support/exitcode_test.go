@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, ExitOK, ExitCode(nil))
+	assert.Equal(t, ExitError, ExitCode(errors.New("boom")))
+	assert.Equal(t, ExitTunnelGone, ExitCode(fmt.Errorf("serve: %w", ErrTunnelGone)))
+	assert.Equal(t, ExitAuth, ExitCode(fmt.Errorf("outer: %w", WithExitCode(ExitAuth, errors.New("login failed")))))
+	assert.NoError(t, WithExitCode(ExitAuth, nil))
+}
+
+func TestTunnelCreationExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"refused", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, ExitServerUnreachable},
+		{"dns", &net.DNSError{Err: "no such host", Name: "nope.invalid"}, ExitServerUnreachable},
+		{"unauthorized", &fakeAPIError{status: 401}, ExitAuth},
+		{"forbidden", fmt.Errorf("fetch: %w", &fakeAPIError{status: 403}), ExitAuth},
+		{"rejected", &fakeAPIError{status: 422}, ExitTunnelRejected},
+		{"server error", &fakeAPIError{status: 503}, ExitServerUnreachable},
+		{"other", errors.New("decode: unexpected EOF"), ExitError},
+		{"status only in the message", errors.New("server returned status 401"), ExitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, TunnelCreationExitCode(tt.err))
+			assert.Equal(t, tt.want, ExitCode(HandleTunnelCreationError(tt.err, "http://127.0.0.1:1")))
+		})
+	}
+}
+
+func TestIsBindError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	_, err = net.Listen("tcp", ln.Addr().String())
+	require.Error(t, err)
+	assert.True(t, IsBindError(fmt.Errorf("listen tcp: %w", err)))
+	assert.False(t, IsBindError(&net.OpError{Op: "dial", Err: errors.New("refused")}))
+}
+
+func TestWriteStatusLine(t *testing.T) {
+	var buf bytes.Buffer
+	WriteStatusLine(&buf, nil, false)
+	WriteStatusLine(&buf, WithExitCode(ExitConfig, errors.New("bad flag")), false)
+	WriteStatusLine(&buf, WithExitCode(99, errors.New("odd")), false)
+	assert.Equal(t, "STATUS code=0 reason=ok\nSTATUS code=2 reason=config\nSTATUS code=99 reason=error\n", buf.String())
+
+	buf.Reset()
+	WriteStatusLine(&buf, WithExitCode(ExitDataPlane, errors.New("❌ Data-plane serve stopped: EOF")), true)
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, map[string]any{"status": "exit", "code": float64(6), "reason": "dataplane", "error": "Data-plane serve stopped: EOF"}, got)
+}
+
+func TestWriteListenLine(t *testing.T) {
+	var buf bytes.Buffer
+	WriteListenLine(&buf, "127.0.0.1:41234", false)
+	assert.Equal(t, "LISTEN addr=127.0.0.1:41234\n", buf.String())
+
+	buf.Reset()
+	WriteListenLine(&buf, "127.0.0.1:41234", true)
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, map[string]any{"status": "listen", "listen": "127.0.0.1:41234"}, got)
+}
+
+func TestWriteMigrateLine(t *testing.T) {
+	var buf bytes.Buffer
+	WriteMigrateLine(&buf, "https://abc.example.com/", false)
+	assert.Equal(t, "MIGRATED url=https://abc.example.com/\n", buf.String())
+
+	buf.Reset()
+	WriteMigrateLine(&buf, "https://abc.example.com/", true)
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, map[string]any{"status": "migrated", "public_url": "https://abc.example.com/"}, got)
+}
+
+func TestWriteReadyLine(t *testing.T) {
+	var buf bytes.Buffer
+	WriteReadyLine(&buf, "https://abc.example.com/", true, false)
+	assert.Equal(t, "READY url=https://abc.example.com/ connected=true\n", buf.String())
+
+	buf.Reset()
+	WriteReadyLine(&buf, "https://abc.example.com/", false, true)
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, map[string]any{"status": "ready", "public_url": "https://abc.example.com/", "connected": false}, got)
+}
+
+func TestWriteEncryptionLine(t *testing.T) {
+	var buf bytes.Buffer
+	WriteEncryptionLine(&buf, "active", "XChaCha20-Poly1305", 2, "", false)
+	assert.Equal(t, "ENCRYPTION status=active cipher=XChaCha20-Poly1305 key_id=2\n", buf.String())
+
+	buf.Reset()
+	WriteEncryptionLine(&buf, "unacknowledged", "XChaCha20-Poly1305", 0, "server: no PSK", false)
+	assert.Equal(t, "ENCRYPTION status=unacknowledged cipher=XChaCha20-Poly1305\n", buf.String())
+
+	buf.Reset()
+	WriteEncryptionLine(&buf, "unacknowledged", "XChaCha20-Poly1305", 0, "server: no PSK", true)
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, map[string]any{"status": "encryption", "encryption": "unacknowledged", "cipher": "XChaCha20-Poly1305", "reason": "server: no PSK"}, got)
+}
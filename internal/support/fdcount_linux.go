@@ -0,0 +1,24 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+//go:build linux
+
+package support
+
+import "os"
+
+// OpenFDs returns how many file descriptors the process holds, from the
+// entries of /proc/self/fd.
+func OpenFDs() (int, bool) {
+	d, err := os.Open("/proc/self/fd")
+	if err != nil {
+		return 0, false
+	}
+	defer d.Close()
+	names, err := d.Readdirnames(-1)
+	if err != nil {
+		return 0, false
+	}
+	// The directory itself is open while it is listed.
+	return len(names) - 1, true
+}
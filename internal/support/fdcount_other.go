@@ -0,0 +1,9 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+//go:build !linux
+
+package support
+
+// OpenFDs cannot count descriptors outside Linux; callers estimate instead.
+func OpenFDs() (int, bool) { return 0, false }
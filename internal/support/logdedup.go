@@ -0,0 +1,203 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultLogWindow is how long RepeatLogs collapses identical lines.
+const DefaultLogWindow = 30 * time.Second
+
+// RepeatLogs is the process-wide deduplicating logger for high-frequency
+// error paths (session redials, copy errors, per-stream failures).
+var RepeatLogs = newLogLimiter(DefaultLogWindow, time.Now, func(line string) { log.Print(line) }, true)
+
+// LogLimiter collapses repeated log lines. The first line of a key is written
+// at once and opens a window; further lines of that key within the window are
+// only counted, and when the window ends the last of them is written once
+// with a "(repeated N times in the last 30s)" suffix. A key is the format
+// string plus the fields that tell occurrences apart, see LogKey.
+type LogLimiter struct {
+	window time.Duration
+	now    func() time.Time
+	emit   func(string)
+
+	mu      sync.Mutex
+	entries map[string]*logWindow
+	// flusher starts the background FlushDue loop on the first suppressed
+	// line; nil for limiters whose owner runs FlushDue (tests).
+	flusher *sync.Once
+}
+
+type logWindow struct {
+	start      time.Time
+	suppressed int
+	last       string
+}
+
+// newLogLimiter returns a limiter that writes lines with emit. With
+// autoFlush a background loop writes summaries at window ends; otherwise the
+// caller runs FlushDue.
+func newLogLimiter(window time.Duration, now func() time.Time, emit func(string), autoFlush bool) *LogLimiter {
+	l := &LogLimiter{window: window, now: now, emit: emit, entries: make(map[string]*logWindow)}
+	if autoFlush {
+		l.flusher = new(sync.Once)
+	}
+	return l
+}
+
+const logKeySep = "\x00"
+
+// LogKey builds a LogLimiter key from the format string and the fields that
+// make occurrences different lines, e.g. an ErrorClass or a direction.
+func LogKey(format string, fields ...any) string {
+	var b strings.Builder
+	b.WriteString(format)
+	for _, f := range fields {
+		fmt.Fprintf(&b, logKeySep+"%v", f)
+	}
+	return b.String()
+}
+
+// ErrorClass names the kind of err for LogKey: the type of the innermost
+// error plus its errno, so that "connection refused" and "i/o timeout" are
+// different keys while their addresses and counters are not.
+func ErrorClass(err error) string {
+	if err == nil {
+		return ""
+	}
+	inner := err
+	for {
+		next := errors.Unwrap(inner)
+		if next == nil {
+			break
+		}
+		inner = next
+	}
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return fmt.Sprintf("%T:%d", inner, int(errno))
+	}
+	if _, ok := inner.(interface{ Timeout() bool }); ok {
+		return fmt.Sprintf("%T", inner)
+	}
+	// Untyped errors (errors.New, fmt.Errorf) only differ by text.
+	return fmt.Sprintf("%T:%s", inner, inner.Error())
+}
+
+// Printf writes the line unless key was written within the current window.
+func (l *LogLimiter) Printf(key, format string, args ...any) {
+	line := fmt.Sprintf(format, args...)
+	now := l.now()
+	l.mu.Lock()
+	w := l.entries[key]
+	if w != nil && now.Sub(w.start) < l.window {
+		w.suppressed++
+		w.last = line
+		l.mu.Unlock()
+		l.startFlusher()
+		return
+	}
+	var summary string
+	if w != nil {
+		summary = w.summary(now, l.window)
+	}
+	l.entries[key] = &logWindow{start: now}
+	l.mu.Unlock()
+	if summary != "" {
+		l.emit(summary)
+	}
+	l.emit(line)
+}
+
+// Transition writes a state change at once. It first writes the suppressed
+// counts of prefix and of every key LogKey built from prefix plus fields, and
+// closes those windows, so that nothing collapsed is reported after the
+// change and the next failure is written again.
+func (l *LogLimiter) Transition(prefix, format string, args ...any) {
+	line := fmt.Sprintf(format, args...)
+	for _, s := range l.take(func(key string, _ *logWindow, _ time.Time) bool {
+		return key == prefix || strings.HasPrefix(key, prefix+logKeySep)
+	}) {
+		l.emit(s)
+	}
+	l.emit(line)
+}
+
+// FlushDue writes the summaries of windows that have ended.
+func (l *LogLimiter) FlushDue() {
+	for _, s := range l.take(func(_ string, w *logWindow, now time.Time) bool { return now.Sub(w.start) >= l.window }) {
+		l.emit(s)
+	}
+}
+
+// Flush writes every pending summary; the client calls it before exiting so
+// that the final count is never lost.
+func (l *LogLimiter) Flush() {
+	for _, s := range l.take(func(string, *logWindow, time.Time) bool { return true }) {
+		l.emit(s)
+	}
+}
+
+// take closes the windows match selects and returns their summaries, oldest
+// window first.
+func (l *LogLimiter) take(match func(key string, w *logWindow, now time.Time) bool) []string {
+	now := l.now()
+	l.mu.Lock()
+	var taken []*logWindow
+	for key, w := range l.entries {
+		if match(key, w, now) {
+			taken = append(taken, w)
+			delete(l.entries, key)
+		}
+	}
+	l.mu.Unlock()
+	sort.Slice(taken, func(i, j int) bool { return taken[i].start.Before(taken[j].start) })
+	var summaries []string
+	for _, w := range taken {
+		if s := w.summary(now, l.window); s != "" {
+			summaries = append(summaries, s)
+		}
+	}
+	return summaries
+}
+
+func (l *LogLimiter) startFlusher() {
+	if l.flusher == nil {
+		return
+	}
+	l.flusher.Do(func() {
+		go func() {
+			t := time.NewTicker(time.Second)
+			defer t.Stop()
+			for range t.C {
+				l.FlushDue()
+			}
+		}()
+	})
+}
+
+// summary is the collapsed line of w, or "" when nothing was suppressed.
+func (w *logWindow) summary(now time.Time, window time.Duration) string {
+	if w.suppressed == 0 {
+		return ""
+	}
+	span := min(now.Sub(w.start), window).Round(time.Second)
+	if span < time.Second {
+		span = time.Second
+	}
+	times := "times"
+	if w.suppressed == 1 {
+		times = "time"
+	}
+	return fmt.Sprintf("%s (repeated %d %s in the last %s)", w.last, w.suppressed, times, span)
+}
@@ -0,0 +1,151 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeLogClock drives a LogLimiter without the background flusher.
+type fakeLogClock struct {
+	now   time.Time
+	lines []string
+}
+
+func newTestLimiter() (*LogLimiter, *fakeLogClock) {
+	c := &fakeLogClock{now: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+	l := newLogLimiter(DefaultLogWindow, func() time.Time { return c.now }, func(line string) { c.lines = append(c.lines, line) }, false)
+	return l, c
+}
+
+func (c *fakeLogClock) advance(d time.Duration) { c.now = c.now.Add(d) }
+
+// drain returns the lines written since the last drain.
+func (c *fakeLogClock) drain() []string {
+	lines := c.lines
+	c.lines = nil
+	return lines
+}
+
+const testFormat = "copy %s error: %v"
+
+func TestLogLimiter_CollapsesWithinWindow(t *testing.T) {
+	l, c := newTestLimiter()
+	key := LogKey(testFormat, "a->b")
+
+	l.Printf(key, testFormat, "a->b", "reset 1")
+	assert.Equal(t, []string{"copy a->b error: reset 1"}, c.drain(), "first occurrence passes through")
+	for i := 2; i <= 4; i++ {
+		c.advance(5 * time.Second)
+		l.Printf(key, testFormat, "a->b", fmt.Sprintf("reset %d", i))
+	}
+	assert.Empty(t, c.drain())
+
+	c.advance(10 * time.Second) // 25s into the window
+	l.FlushDue()
+	assert.Empty(t, c.drain(), "the window is still open")
+
+	c.advance(5 * time.Second)
+	l.FlushDue()
+	assert.Equal(t, []string{"copy a->b error: reset 4 (repeated 3 times in the last 30s)"}, c.drain())
+	l.FlushDue()
+	assert.Empty(t, c.drain(), "a summary is written once")
+
+	l.Printf(key, testFormat, "a->b", "reset 5")
+	assert.Equal(t, []string{"copy a->b error: reset 5"}, c.drain(), "a new window starts with a full line")
+}
+
+func TestLogLimiter_SummaryBeforeNextWindow(t *testing.T) {
+	l, c := newTestLimiter()
+	key := LogKey(testFormat, "a->b")
+	l.Printf(key, testFormat, "a->b", "x")
+	c.advance(time.Second)
+	l.Printf(key, testFormat, "a->b", "y")
+	c.advance(40 * time.Second)
+	// No FlushDue ran (the ticker was late): the next line still writes the
+	// previous window's count first.
+	l.Printf(key, testFormat, "a->b", "z")
+	assert.Equal(t, []string{
+		"copy a->b error: x",
+		"copy a->b error: y (repeated 1 time in the last 30s)",
+		"copy a->b error: z",
+	}, c.drain())
+}
+
+func TestLogLimiter_KeysAreIndependent(t *testing.T) {
+	l, c := newTestLimiter()
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+
+	l.Printf(LogKey(testFormat, "a->b", ErrorClass(refused)), testFormat, "a->b", refused)
+	l.Printf(LogKey(testFormat, "a->b", ErrorClass(refused)), testFormat, "a->b", refused)
+	l.Printf(LogKey(testFormat, "a->b", ErrorClass(reset)), testFormat, "a->b", reset)
+	l.Printf(LogKey(testFormat, "b->a", ErrorClass(reset)), testFormat, "b->a", reset)
+	assert.Len(t, c.drain(), 3, "a new error type or field passes through immediately")
+}
+
+func TestLogLimiter_TransitionFlushesPrefix(t *testing.T) {
+	l, c := newTestLimiter()
+	const retry = "dial failed: %v"
+	other := LogKey(testFormat, "a->b")
+	l.Printf(LogKey(retry, "refused"), retry, "refused")
+	l.Printf(LogKey(retry, "refused"), retry, "refused")
+	c.advance(time.Second)
+	l.Printf(LogKey(retry, "timeout"), retry, "timeout")
+	l.Printf(LogKey(retry, "timeout"), retry, "timeout")
+	l.Printf(other, testFormat, "a->b", "x")
+	l.Printf(other, testFormat, "a->b", "x")
+	c.drain()
+
+	c.advance(3 * time.Second)
+	l.Transition(LogKey(retry), "session re-established")
+	assert.Equal(t, []string{
+		"dial failed: refused (repeated 1 time in the last 4s)",
+		"dial failed: timeout (repeated 1 time in the last 3s)",
+		"session re-established",
+	}, c.drain(), "pending counts come before the transition, oldest first")
+
+	l.Printf(LogKey(retry, "refused"), retry, "refused")
+	assert.Equal(t, []string{"dial failed: refused"}, c.drain(), "the first failure after a transition passes through")
+
+	l.Flush()
+	assert.Equal(t, []string{"copy a->b error: x (repeated 1 time in the last 3s)"}, c.drain(), "keys outside the prefix kept their window")
+}
+
+func TestLogLimiter_FlushOnShutdown(t *testing.T) {
+	l, c := newTestLimiter()
+	key := LogKey(testFormat, "a->b")
+	for range 5 {
+		l.Printf(key, testFormat, "a->b", "x")
+	}
+	c.advance(2 * time.Second)
+	l.Printf(LogKey(testFormat, "b->a"), testFormat, "b->a", "y")
+	c.drain()
+
+	l.Flush()
+	assert.Equal(t, []string{"copy a->b error: x (repeated 4 times in the last 2s)"}, c.drain(),
+		"the final count is written even though the window has not ended")
+	l.Flush()
+	assert.Empty(t, c.drain())
+}
+
+func TestErrorClass(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Addr: &net.TCPAddr{Port: 1}, Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	refusedElsewhere := &net.OpError{Op: "dial", Net: "tcp", Addr: &net.TCPAddr{Port: 2}, Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+
+	assert.Equal(t, ErrorClass(refused), ErrorClass(fmt.Errorf("dial backend: %w", refusedElsewhere)), "addresses and wrapping do not matter")
+	assert.NotEqual(t, ErrorClass(refused), ErrorClass(reset))
+	assert.Equal(t, ErrorClass(errors.New("boom")), ErrorClass(fmt.Errorf("x: %w", errors.New("boom"))))
+	assert.NotEqual(t, ErrorClass(errors.New("boom")), ErrorClass(errors.New("bang")))
+	assert.Empty(t, ErrorClass(nil))
+}
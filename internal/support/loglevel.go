@@ -0,0 +1,24 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// debugLogging is the process-wide DEBUG switch. It starts from LOG_LEVEL and
+// a config reload may flip it while the client runs.
+var debugLogging atomic.Bool
+
+func init() {
+	debugLogging.Store(strings.Contains(strings.ToLower(strings.TrimSpace(os.Getenv("LOG_LEVEL"))), "debug"))
+}
+
+// DebugEnabled reports whether [DEBUG] log lines are written.
+func DebugEnabled() bool { return debugLogging.Load() }
+
+// SetDebug turns [DEBUG] log lines on or off.
+func SetDebug(on bool) { debugLogging.Store(on) }
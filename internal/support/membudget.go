@@ -0,0 +1,146 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// Memory is the process's --memory-budget: every buffering feature reserves
+// what it holds here before allocating it.
+var Memory = &MemoryBudget{}
+
+// MemoryBudget accounts the bytes the buffering features of a process hold
+// against one limit. Reserving and releasing are atomic adds; only
+// registering a component takes a lock.
+type MemoryBudget struct {
+	// limit is the budget in bytes, 0 for none; used is what the
+	// components hold together.
+	limit atomic.Int64
+	used  atomic.Int64
+
+	mu         sync.Mutex
+	components []*MemoryComponent
+}
+
+// MemoryComponent is one buffering feature's account in a MemoryBudget.
+// A component may only reserve while the budget's total stays within its
+// ceiling, a share of the limit: components with a lower ceiling degrade
+// first and leave the rest of the budget to those with a higher one.
+type MemoryComponent struct {
+	budget  *MemoryBudget
+	name    string
+	policy  string
+	ceiling int64
+
+	used   atomic.Int64
+	denied atomic.Int64
+}
+
+// MemoryUsage is what a component holds, and how many of its reservations
+// were denied, at one moment.
+type MemoryUsage struct {
+	Name   string `json:"name"`
+	Policy string `json:"policy"`
+	Bytes  int64  `json:"bytes"`
+	Denied int64  `json:"denied"`
+}
+
+// SetLimit sets the budget in bytes; 0 or less removes it, usage is then
+// only accounted.
+func (b *MemoryBudget) SetLimit(limit int64) {
+	b.limit.Store(max(limit, 0))
+}
+
+// Limit returns the budget in bytes, 0 for none.
+func (b *MemoryBudget) Limit() int64 { return b.limit.Load() }
+
+// Used returns the bytes all components hold together.
+func (b *MemoryBudget) Used() int64 { return b.used.Load() }
+
+// Component registers a component named name that may reserve while the
+// total stays within ceilingPercent of the limit. policy says, for the
+// user, what it does when a reservation is denied.
+func (b *MemoryBudget) Component(name, policy string, ceilingPercent int) *MemoryComponent {
+	c := &MemoryComponent{budget: b, name: name, policy: policy, ceiling: int64(min(max(ceilingPercent, 1), 100))}
+	b.mu.Lock()
+	b.components = append(b.components, c)
+	b.mu.Unlock()
+	return c
+}
+
+// Usage returns the usage of every component in registration order.
+func (b *MemoryBudget) Usage() []MemoryUsage {
+	b.mu.Lock()
+	components := append([]*MemoryComponent(nil), b.components...)
+	b.mu.Unlock()
+	out := make([]MemoryUsage, 0, len(components))
+	for _, c := range components {
+		out = append(out, MemoryUsage{Name: c.name, Policy: c.policy, Bytes: c.used.Load(), Denied: c.denied.Load()})
+	}
+	return out
+}
+
+// Denied returns the reservations denied so far across all components.
+func (b *MemoryBudget) Denied() int64 {
+	var n int64
+	for _, u := range b.Usage() {
+		n += u.Denied
+	}
+	return n
+}
+
+// WriteUsage writes the budget and the usage of each component, one per
+// line, for diagnostics.
+func (b *MemoryBudget) WriteUsage(w io.Writer) {
+	if limit := b.Limit(); limit > 0 {
+		fmt.Fprintf(w, "memory budget: %d of %d bytes in use\n", b.Used(), limit)
+	} else {
+		fmt.Fprintf(w, "memory budget: none, %d bytes in use\n", b.Used())
+	}
+	for _, u := range b.Usage() {
+		fmt.Fprintf(w, "  %s: %d bytes, %d denied (%s)\n", u.Name, u.Bytes, u.Denied, u.Policy)
+	}
+}
+
+// Reserve accounts n more bytes to the component and reports whether it
+// may hold them. When they would take the budget's total past the
+// component's ceiling nothing is accounted, the denial is counted and the
+// caller must degrade instead of allocating. A nil component accepts
+// everything.
+func (c *MemoryComponent) Reserve(n int64) bool {
+	if c == nil || n <= 0 {
+		return true
+	}
+	b := c.budget
+	for {
+		used := b.used.Load()
+		if limit := b.limit.Load(); limit > 0 && used+n > limit/100*c.ceiling+limit%100*c.ceiling/100 {
+			c.denied.Add(1)
+			return false
+		}
+		if b.used.CompareAndSwap(used, used+n) {
+			c.used.Add(n)
+			return true
+		}
+	}
+}
+
+// Release returns n bytes an earlier Reserve accounted.
+func (c *MemoryComponent) Release(n int64) {
+	if c == nil || n <= 0 {
+		return
+	}
+	c.used.Add(-n)
+	c.budget.used.Add(-n)
+}
+
+// Used returns the bytes the component holds.
+func (c *MemoryComponent) Used() int64 { return c.used.Load() }
+
+// Denied returns the component's reservations denied so far.
+func (c *MemoryComponent) Denied() int64 { return c.denied.Load() }
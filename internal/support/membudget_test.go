@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryBudget_Ceilings(t *testing.T) {
+	b := &MemoryBudget{}
+	b.SetLimit(1000)
+	low := b.Component("low", "drops", 50)
+	high := b.Component("high", "waits", 100)
+
+	assert.True(t, low.Reserve(400))
+	assert.False(t, low.Reserve(200), "past its half of the budget")
+	assert.True(t, high.Reserve(500))
+	assert.False(t, high.Reserve(101))
+	assert.True(t, high.Reserve(100))
+	assert.Equal(t, int64(1000), b.Used())
+
+	low.Release(400)
+	assert.True(t, low.Reserve(0), "nothing to reserve")
+	assert.Equal(t, []MemoryUsage{
+		{Name: "low", Policy: "drops", Bytes: 0, Denied: 1},
+		{Name: "high", Policy: "waits", Bytes: 600, Denied: 1},
+	}, b.Usage())
+	assert.Equal(t, int64(2), b.Denied())
+
+	var out bytes.Buffer
+	b.WriteUsage(&out)
+	assert.Equal(t, "memory budget: 600 of 1000 bytes in use\n  low: 0 bytes, 1 denied (drops)\n  high: 600 bytes, 1 denied (waits)\n", out.String())
+}
+
+func TestMemoryBudget_UnlimitedOnlyAccounts(t *testing.T) {
+	b := &MemoryBudget{}
+	c := b.Component("queue", "drops", 10)
+	assert.True(t, c.Reserve(1<<40))
+	assert.Equal(t, int64(1<<40), b.Used())
+	c.Release(1 << 40)
+	assert.Zero(t, b.Used())
+
+	var nilComponent *MemoryComponent
+	assert.True(t, nilComponent.Reserve(1))
+	nilComponent.Release(1)
+}
+
+func TestMemoryBudget_ConcurrentAccounting(t *testing.T) {
+	const limit = 16 << 10
+	b := &MemoryBudget{}
+	b.SetLimit(limit)
+	components := []*MemoryComponent{b.Component("a", "", 50), b.Component("b", "", 75), b.Component("c", "", 100)}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var peak int64
+	for g := range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := components[g%len(components)]
+			var held []int64
+			for i := range 2000 {
+				n := int64(1 + (g*131+i*17)%4096)
+				if c.Reserve(n) {
+					held = append(held, n)
+					if used := b.Used(); used > limit {
+						mu.Lock()
+						peak = max(peak, used)
+						mu.Unlock()
+					}
+				}
+				if len(held) > 4 || i%3 == 0 && len(held) > 0 {
+					c.Release(held[0])
+					held = held[1:]
+				}
+			}
+			for _, n := range held {
+				c.Release(n)
+			}
+		}()
+	}
+	wg.Wait()
+	require.Zero(t, peak, "the budget was exceeded")
+	assert.Zero(t, b.Used())
+	for _, u := range b.Usage() {
+		assert.Zero(t, u.Bytes, u.Name)
+	}
+	for _, c := range components {
+		assert.Positive(t, c.Denied(), "every ceiling was reached under contention")
+	}
+}
@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+//go:build linux
+
+package support
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRaiseNoFileLimit(t *testing.T) {
+	var orig syscall.Rlimit
+	require.NoError(t, syscall.Getrlimit(syscall.RLIMIT_NOFILE, &orig))
+	t.Cleanup(func() { _ = syscall.Setrlimit(syscall.RLIMIT_NOFILE, &orig) })
+	used, ok := OpenFDs()
+	require.True(t, ok)
+	lowered := uint64(used) + 64
+	if lowered >= orig.Max {
+		t.Skipf("hard limit %d leaves no room to lower the soft one", orig.Max)
+	}
+	require.NoError(t, syscall.Setrlimit(syscall.RLIMIT_NOFILE, &syscall.Rlimit{Cur: lowered, Max: orig.Max}))
+
+	soft, hard, err := NoFileLimit()
+	require.NoError(t, err)
+	assert.Equal(t, lowered, soft)
+	assert.Equal(t, orig.Max, hard)
+
+	raised, err := RaiseNoFileLimit()
+	require.NoError(t, err)
+	assert.Equal(t, orig.Max, raised)
+	soft, _, err = NoFileLimit()
+	require.NoError(t, err)
+	assert.Equal(t, orig.Max, soft, "the soft limit is the hard one now")
+
+	raised, err = RaiseNoFileLimit()
+	require.NoError(t, err)
+	assert.Equal(t, orig.Max, raised, "raising again is a no-op")
+}
+
+func TestOpenFDs(t *testing.T) {
+	before, ok := OpenFDs()
+	require.True(t, ok)
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	during, _ := OpenFDs()
+	f.Close()
+	assert.Equal(t, before+1, during)
+}
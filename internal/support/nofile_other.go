@@ -0,0 +1,14 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+//go:build !linux && !darwin
+
+package support
+
+import "errors"
+
+// NoFileLimit has no descriptor limit to read outside Linux and macOS.
+func NoFileLimit() (soft, hard uint64, err error) { return 0, 0, errors.ErrUnsupported }
+
+// RaiseNoFileLimit has no descriptor limit to raise outside Linux and macOS.
+func RaiseNoFileLimit() (uint64, error) { return 0, errors.ErrUnsupported }
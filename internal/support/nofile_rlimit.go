@@ -0,0 +1,37 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+//go:build linux || darwin
+
+package support
+
+import "syscall"
+
+// NoFileLimit returns the soft and hard RLIMIT_NOFILE of the process.
+func NoFileLimit() (soft, hard uint64, err error) {
+	var lim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil {
+		return 0, 0, err
+	}
+	return lim.Cur, lim.Max, nil
+}
+
+// RaiseNoFileLimit raises the soft RLIMIT_NOFILE to the hard limit and
+// returns the soft limit in effect afterwards. The Go runtime does the same
+// at start where it can; this covers a limit lowered since, and reports a
+// hard limit the kernel refuses (an unlimited one on macOS) as an error.
+func RaiseNoFileLimit() (uint64, error) {
+	var lim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil {
+		return 0, err
+	}
+	if lim.Cur >= lim.Max {
+		return lim.Cur, nil
+	}
+	raised := lim
+	raised.Cur = lim.Max
+	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &raised); err != nil {
+		return lim.Cur, err
+	}
+	return raised.Cur, nil
+}
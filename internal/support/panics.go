@@ -0,0 +1,248 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// panicRestartInitial and panicRestartMax bound the backoff of Supervise
+// between restarts of a component that panicked. Tests shorten them.
+var (
+	panicRestartInitial = time.Second
+	panicRestartMax     = 30 * time.Second
+)
+
+// PanicScope describes a goroutine in the report of a panic it recovered
+// from.
+type PanicScope struct {
+	// Role is what the goroutine does, e.g. "incoming stream" or "ping loop".
+	Role     string
+	TunnelID string
+	// ConnID is the correlation ID of the connection the goroutine serves,
+	// as in its log lines.
+	ConnID string
+}
+
+func (s PanicScope) String() string {
+	var b strings.Builder
+	b.WriteString(s.Role)
+	if s.TunnelID != "" {
+		b.WriteString(" tunnel=" + s.TunnelID)
+	}
+	if s.ConnID != "" {
+		b.WriteString(" conn=" + s.ConnID)
+	}
+	return b.String()
+}
+
+// PanicError is a recovered panic: its value and the stack of the goroutine
+// that panicked.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// processPanics counts the recovered panics and holds the --crash-dir
+// settings.
+var processPanics struct {
+	count atomic.Int64
+
+	mu      sync.Mutex
+	dir     string
+	summary func() string
+}
+
+// Panics returns how many panics were recovered since the process started.
+func Panics() int64 {
+	return processPanics.count.Load()
+}
+
+// SetCrashDir makes every recovered panic write a crash report to dir: the
+// panic, the stacks of all goroutines and the output of summary, which may
+// be nil. An empty dir writes none.
+func SetCrashDir(dir string, summary func() string) {
+	processPanics.mu.Lock()
+	defer processPanics.mu.Unlock()
+	processPanics.dir = dir
+	processPanics.summary = summary
+}
+
+// Recover is deferred by a goroutine to recover from its panic: the panic is
+// reported with scope and the goroutine ends. Its other deferred calls have
+// already run, so a goroutine serving one connection closes only that
+// connection while the process keeps serving.
+func Recover(scope PanicScope) {
+	if r := recover(); r != nil {
+		ReportPanic(scope, &PanicError{Value: r, Stack: debug.Stack()})
+	}
+}
+
+// RecoverAs is deferred by a goroutine whose result another one waits for:
+// a panic is recovered and handed to fail instead of being reported, so the
+// waiting side ends the connection and reports it as an error.
+func RecoverAs(fail func(*PanicError)) {
+	if r := recover(); r != nil {
+		fail(&PanicError{Value: r, Stack: debug.Stack()})
+	}
+}
+
+// Go runs fn on a new goroutine that recovers from its panic with scope.
+func Go(scope PanicScope, fn func()) {
+	go func() {
+		defer Recover(scope)
+		fn()
+	}()
+}
+
+// Supervise runs fn, a component the process cannot serve without, and
+// restarts it after a panic with backoff from 1s to 30s instead of letting
+// the panic end the process. It returns fn's result once fn returns, or nil
+// when stop is closed while it waits to restart.
+func Supervise(scope PanicScope, stop <-chan struct{}, fn func() error) error {
+	wait := panicRestartInitial
+	for {
+		began := time.Now()
+		p, err := runRecovered(fn)
+		if p == nil {
+			return err
+		}
+		ReportPanic(scope, p)
+		if time.Since(began) > panicRestartMax {
+			// It ran long enough to count as healthy; start over.
+			wait = panicRestartInitial
+		}
+		log.Printf("[WARN] restarting %s in %s after a panic", scope.Role, wait)
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(wait):
+		}
+		wait = min(2*wait, panicRestartMax)
+	}
+}
+
+func runRecovered(fn func() error) (p *PanicError, err error) {
+	defer RecoverAs(func(pe *PanicError) { p = pe })
+	return nil, fn()
+}
+
+// ReportPanic logs p with scope, counts it in Panics and writes the crash
+// report of --crash-dir. Without a crash dir the stack goes to the log.
+func ReportPanic(scope PanicScope, p *PanicError) {
+	n := processPanics.count.Add(1)
+	processPanics.mu.Lock()
+	dir, summary := processPanics.dir, processPanics.summary
+	processPanics.mu.Unlock()
+	where := panicSite(p.Stack)
+	if dir == "" {
+		log.Printf("[ERROR] panic in %s: %v at %s (recovered, %d so far)\n%s", scope, p.Value, where, n, p.Stack)
+		return
+	}
+	path, err := writeCrashReport(dir, scope, p, n, summary)
+	if err != nil {
+		log.Printf("[ERROR] panic in %s: %v at %s (recovered, %d so far); crash report not written: %v\n%s", scope, p.Value, where, n, err, p.Stack)
+		return
+	}
+	log.Printf("[ERROR] panic in %s: %v at %s (recovered, %d so far); crash report: %s", scope, p.Value, where, n, path)
+}
+
+// writeCrashReport writes the crash report of p to a new file in dir and
+// returns its path.
+func writeCrashReport(dir string, scope PanicScope, p *PanicError, n int64, summary func() string) (string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	name := fmt.Sprintf("crash-%s-%d-%s.txt", now.Format("20060102-150405"), n, crashFileRole(scope.Role))
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "fortunnels client crash report, %s\n\n", now.Format(time.RFC3339Nano))
+	fmt.Fprintf(&b, "role: %s\ntunnel: %s\nconn: %s\npanic: %v\nrecovered panics: %d\n", scope.Role, scope.TunnelID, scope.ConnID, p.Value, n)
+	fmt.Fprintf(&b, "\n== panicking goroutine ==\n%s", p.Stack)
+	if summary != nil {
+		fmt.Fprintf(&b, "\n== diagnostics ==\n%s", summary())
+	}
+	fmt.Fprintf(&b, "\n== all goroutines ==\n%s", allStacks())
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, b.Bytes(), 0o600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// crashFileRole turns a role into a file name part, e.g. "incoming-stream".
+func crashFileRole(role string) string {
+	s := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		if r >= 'A' && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return '-'
+	}, role)
+	if s == "" {
+		return "goroutine"
+	}
+	return s
+}
+
+// allStacks returns the stacks of all goroutines, growing the buffer until
+// they fit.
+func allStacks() []byte {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= 64<<20 {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// panicSite names the frame that panicked in a debug.Stack dump, e.g.
+// "dataplane.incomingStreamServer.serve (tcp.go:212)": the first function
+// outside the runtime after the panic frame.
+func panicSite(stack []byte) string {
+	lines := strings.Split(string(stack), "\n")
+	start := -1
+	for i, line := range lines {
+		if strings.HasPrefix(line, "panic(") {
+			start = i + 2
+			break
+		}
+	}
+	for i := start; start >= 0 && i+1 < len(lines); i += 2 {
+		fn := lines[i]
+		if strings.HasPrefix(fn, "runtime.") {
+			continue
+		}
+		if p := strings.LastIndex(fn, "("); p > 0 {
+			fn = fn[:p]
+		}
+		if p := strings.LastIndex(fn, "/"); p >= 0 {
+			fn = fn[p+1:]
+		}
+		file := strings.TrimSpace(lines[i+1])
+		if p := strings.LastIndex(file, " +0x"); p > 0 {
+			file = file[:p]
+		}
+		return fmt.Sprintf("%s (%s)", fn, filepath.Base(file))
+	}
+	return "unknown"
+}
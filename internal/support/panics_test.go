@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// capturePanicLog collects the log while a test runs.
+func capturePanicLog(t *testing.T) *syncBuffer {
+	t.Helper()
+	var buf syncBuffer
+	prev := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(prev) })
+	return &buf
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func explode() {
+	panic("boom")
+}
+
+func TestRecover_IsolatesGoroutineAndCounts(t *testing.T) {
+	logs := capturePanicLog(t)
+	SetCrashDir("", nil)
+	before := Panics()
+
+	closed := make(chan struct{})
+	Go(PanicScope{Role: "copy", TunnelID: "t1", ConnID: "abc234"}, func() {
+		defer close(closed)
+		explode()
+	})
+	<-closed
+	require.Eventually(t, func() bool { return Panics() == before+1 }, 2*time.Second, 10*time.Millisecond)
+	// The process, and this goroutine, keep running.
+	out := logs.String()
+	assert.Contains(t, out, "[ERROR] panic in copy tunnel=t1 conn=abc234: boom at support.explode (panics_test.go:")
+	assert.Contains(t, out, "goroutine ", "without a crash dir the stack is logged")
+}
+
+func TestRecover_WritesCrashReport(t *testing.T) {
+	logs := capturePanicLog(t)
+	dir := filepath.Join(t.TempDir(), "crashes")
+	SetCrashDir(dir, func() string { return "version: test\n" })
+	defer SetCrashDir("", nil)
+
+	done := make(chan struct{})
+	Go(PanicScope{Role: "incoming stream", TunnelID: "t1", ConnID: "xyz"}, func() {
+		defer close(done)
+		var m map[string]int
+		m["x"] = 1
+	})
+	<-done
+	require.Eventually(t, func() bool { return strings.Contains(logs.String(), "crash report: ") }, 2*time.Second, 10*time.Millisecond)
+
+	files, err := filepath.Glob(filepath.Join(dir, "crash-*-incoming-stream.txt"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	body, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	report := string(body)
+	assert.Contains(t, report, "role: incoming stream\ntunnel: t1\nconn: xyz\npanic: assignment to entry in nil map\n")
+	assert.Contains(t, report, "== panicking goroutine ==")
+	assert.Contains(t, report, "== diagnostics ==\nversion: test\n")
+	assert.Contains(t, report, "== all goroutines ==")
+	assert.Contains(t, report, "TestRecover_WritesCrashReport", "other goroutines are dumped too")
+	info, err := os.Stat(files[0])
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	assert.Contains(t, logs.String(), "at support.TestRecover_WritesCrashReport.func2 (panics_test.go:")
+}
+
+func TestRecoverAs_HandsPanicToWaiter(t *testing.T) {
+	before := Panics()
+	results := make(chan error, 1)
+	go func() {
+		defer RecoverAs(func(p *PanicError) { results <- p })
+		explode()
+	}()
+	err := <-results
+	var p *PanicError
+	require.ErrorAs(t, err, &p)
+	assert.Equal(t, "panic: boom", err.Error())
+	assert.Contains(t, string(p.Stack), "support.explode")
+	assert.Equal(t, before, Panics(), "the waiter reports it")
+}
+
+func TestSupervise_RestartsAfterPanicWithBackoff(t *testing.T) {
+	logs := capturePanicLog(t)
+	SetCrashDir("", nil)
+	prevInitial, prevMax := panicRestartInitial, panicRestartMax
+	panicRestartInitial, panicRestartMax = 20*time.Millisecond, 50*time.Millisecond
+	defer func() { panicRestartInitial, panicRestartMax = prevInitial, prevMax }()
+
+	var starts []time.Time
+	err := Supervise(PanicScope{Role: "session loop", TunnelID: "t1"}, nil, func() error {
+		starts = append(starts, time.Now())
+		if len(starts) < 4 {
+			explode()
+		}
+		return errors.New("stopped")
+	})
+	require.EqualError(t, err, "stopped", "a clean return ends the supervision")
+	require.Len(t, starts, 4)
+	assert.GreaterOrEqual(t, starts[1].Sub(starts[0]), 20*time.Millisecond)
+	assert.GreaterOrEqual(t, starts[2].Sub(starts[1]), 40*time.Millisecond)
+	assert.GreaterOrEqual(t, starts[3].Sub(starts[2]), 50*time.Millisecond, "the backoff is capped")
+	assert.Equal(t, 3, strings.Count(logs.String(), "[WARN] restarting session loop in "))
+}
+
+func TestSupervise_StopsWhileWaiting(t *testing.T) {
+	capturePanicLog(t)
+	stop := make(chan struct{})
+	close(stop)
+	runs := 0
+	err := Supervise(PanicScope{Role: "session loop"}, stop, func() error {
+		runs++
+		explode()
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, runs)
+}
+
+func TestPanicSite(t *testing.T) {
+	stack := "goroutine 7 [running]:\n" +
+		"runtime/debug.Stack()\n\t/go/src/runtime/debug/stack.go:26 +0x5e\n" +
+		"panic({0x6b7c20?, 0x8a3f10?})\n\t/go/src/runtime/panic.go:785 +0x132\n" +
+		"runtime.panicmem(...)\n\t/go/src/runtime/panic.go:262\n" +
+		"runtime.sigpanic()\n\t/go/src/runtime/signal_unix.go:917 +0x359\n" +
+		"github.com/fortunnels/client/internal/dataplane.(*incomingStreamServer).serve(0xc000, {0x0, 0x0})\n" +
+		"\t/src/internal/dataplane/tcp.go:212 +0x1a\n"
+	assert.Equal(t, "dataplane.(*incomingStreamServer).serve (tcp.go:212)", panicSite([]byte(stack)))
+	assert.Equal(t, "unknown", panicSite([]byte("goroutine 1 [running]:\n")))
+}
+
+func TestCrashFileRole(t *testing.T) {
+	assert.Equal(t, "incoming-stream", crashFileRole("incoming stream"))
+	assert.Equal(t, "copy-a--b", crashFileRole("copy a->b"))
+	assert.Equal(t, "goroutine", crashFileRole(""))
+}
@@ -0,0 +1,185 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	// ListenAuto is the --listen value that picks a free port.
+	ListenAuto = "auto"
+	// portProbeRange is how many ports above a taken one NextFreePort tries.
+	portProbeRange = 100
+	// portAnswerTimeout bounds the quick connect of PortAnswers.
+	portAnswerTimeout = 300 * time.Millisecond
+)
+
+// wellKnownPorts are local services a --listen port commonly collides with.
+var wellKnownPorts = map[int]string{
+	22:    "SSH",
+	25:    "SMTP",
+	53:    "DNS",
+	80:    "HTTP",
+	443:   "HTTPS",
+	1433:  "SQL Server",
+	3000:  "development web servers",
+	3306:  "MySQL",
+	5000:  "development web servers",
+	5432:  "PostgreSQL",
+	5672:  "RabbitMQ",
+	6379:  "Redis",
+	8080:  "HTTP alternate",
+	8443:  "HTTPS alternate",
+	9200:  "Elasticsearch",
+	11211: "Memcached",
+	27017: "MongoDB",
+}
+
+// WellKnownService names the service usually found on port.
+func WellKnownService(port int) (string, bool) {
+	name, ok := wellKnownPorts[port]
+	return name, ok
+}
+
+// PortOwner is the process listening on a local port, as far as it could be
+// identified.
+type PortOwner struct {
+	PID  int
+	Name string
+}
+
+func (o PortOwner) String() string {
+	if o.Name == "" {
+		return fmt.Sprintf("pid %d", o.PID)
+	}
+	return fmt.Sprintf("%s (pid %d)", o.Name, o.PID)
+}
+
+// FindPortOwner identifies the process listening on the local TCP port. It
+// is best effort: ok is false where the platform offers no lookup or the
+// owner belongs to a user whose processes this one cannot inspect.
+func FindPortOwner(port int) (PortOwner, bool) {
+	return findPortOwner(port)
+}
+
+// IsAddrInUse reports whether err is a bind failing because the address is
+// taken.
+func IsAddrInUse(err error) bool {
+	return errors.Is(err, syscall.EADDRINUSE)
+}
+
+// NextFreePort returns the first port above port that host accepts a TCP
+// listener on, trying up to portProbeRange ports.
+func NextFreePort(host string, port int) (int, bool) {
+	for p := port + 1; p <= min(port+portProbeRange, 65535); p++ {
+		ln, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(p)))
+		if err == nil {
+			ln.Close()
+			return p, true
+		}
+	}
+	return 0, false
+}
+
+// FreePort returns an ephemeral port the system hands out for host.
+func FreePort(host string) (int, error) {
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return 0, err
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
+
+// PortAnswers reports whether something accepts TCP connections on
+// host:port right now.
+func PortAnswers(host string, port int) bool {
+	c, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), portAnswerTimeout)
+	if err != nil {
+		return false
+	}
+	c.Close()
+	return true
+}
+
+// CheckListenAddr binds addr briefly to tell whether a listener could start
+// there. A taken port is reported with its owner, when known, and the next
+// free port; the error still matches IsBindError.
+func CheckListenAddr(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err == nil {
+		ln.Close()
+		return nil
+	}
+	return ExplainBindError(addr, err)
+}
+
+// ExplainBindError adds to a failed bind of addr which process owns the
+// port and which port is free instead. Other errors are returned as they are.
+func ExplainBindError(addr string, err error) error {
+	if !IsAddrInUse(err) {
+		return err
+	}
+	host, portStr, serr := net.SplitHostPort(addr)
+	port, perr := strconv.Atoi(portStr)
+	if serr != nil || perr != nil {
+		return err
+	}
+	owner := "another program"
+	if o, ok := FindPortOwner(port); ok {
+		owner = o.String()
+	} else if svc, ok := WellKnownService(port); ok {
+		owner = "another program (usually " + svc + ")"
+	}
+	hint := "Pick another port, or use --listen auto"
+	if next, ok := NextFreePort(host, port); ok {
+		hint = fmt.Sprintf("Next free port: %d (--listen %s), or use --listen auto", next, net.JoinHostPort(host, strconv.Itoa(next)))
+	}
+	return &portInUseError{err: err, msg: fmt.Sprintf("port %d is already used by %s\n   %s", port, owner, hint)}
+}
+
+// portInUseError keeps the bind error in the chain (IsBindError, exit codes)
+// behind a readable message.
+type portInUseError struct {
+	err error
+	msg string
+}
+
+func (e *portInUseError) Error() string { return e.msg }
+func (e *portInUseError) Unwrap() error { return e.err }
+
+// ShadowWarning describes a listen address that would hide a local service:
+// one that answers on the same port at another loopback address (a listener
+// on [::1] next to one on 127.0.0.1, for instance, catches "localhost"
+// clients), or a well-known service port. "" when there is nothing to say.
+func ShadowWarning(addr string) string {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return ""
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port == 0 {
+		return ""
+	}
+	for _, other := range []string{"127.0.0.1", "::1"} {
+		if other == host || !PortAnswers(other, port) {
+			continue
+		}
+		owner := "a local service"
+		if o, ok := FindPortOwner(port); ok {
+			owner = o.String()
+		}
+		return fmt.Sprintf("--listen %s shadows %s on %s: clients of localhost:%d may reach either", addr, owner, net.JoinHostPort(other, portStr), port)
+	}
+	if svc, ok := WellKnownService(port); ok {
+		return fmt.Sprintf("--listen %s uses the %s port; local clients expecting %s will reach the tunnel instead", addr, svc, svc)
+	}
+	return ""
+}
@@ -0,0 +1,10 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+//go:build !linux
+
+package support
+
+// findPortOwner has no lookup outside Linux; callers fall back to naming
+// the well-known service of the port.
+func findPortOwner(int) (PortOwner, bool) { return PortOwner{}, false }
@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// occupyPort listens on a free loopback port for the rest of the test.
+func occupyPort(t *testing.T) (net.Listener, int) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	return ln, ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestCheckListenAddr_NamesOwnerAndNextFreePort(t *testing.T) {
+	ln, port := occupyPort(t)
+
+	err := CheckListenAddr(ln.Addr().String())
+	require.Error(t, err)
+	assert.True(t, IsBindError(err), "still a bind error for exit codes")
+	assert.True(t, IsAddrInUse(err))
+	msg := err.Error()
+	assert.Contains(t, msg, fmt.Sprintf("port %d is already used by ", port))
+	if runtime.GOOS == "linux" {
+		self, _ := os.ReadFile("/proc/self/comm")
+		assert.Contains(t, msg, fmt.Sprintf("%s (pid %d)", strings.TrimSpace(string(self)), os.Getpid()))
+	}
+	assert.Regexp(t, `Next free port: \d+ \(--listen 127\.0\.0\.1:\d+\), or use --listen auto`, msg)
+
+	next, ok := NextFreePort("127.0.0.1", port)
+	require.True(t, ok)
+	assert.Greater(t, next, port)
+	assert.NoError(t, CheckListenAddr(net.JoinHostPort("127.0.0.1", strconv.Itoa(next))))
+}
+
+func TestFindPortOwner(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("owner lookup is Linux-only")
+	}
+	_, port := occupyPort(t)
+	owner, ok := FindPortOwner(port)
+	require.True(t, ok)
+	assert.Equal(t, os.Getpid(), owner.PID)
+	exe, _ := os.Executable()
+	assert.True(t, strings.HasPrefix(filepath.Base(exe), owner.Name), "comm %q is the (truncated) binary name %q", owner.Name, filepath.Base(exe))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	free := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	_, ok = FindPortOwner(free)
+	assert.False(t, ok, "nobody listens on a closed port")
+}
+
+func TestFreePort_IsBindable(t *testing.T) {
+	port, err := FreePort("127.0.0.1")
+	require.NoError(t, err)
+	assert.Positive(t, port)
+	ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	require.NoError(t, err)
+	ln.Close()
+}
+
+func TestExplainBindError_LeavesOtherErrors(t *testing.T) {
+	err := &net.OpError{Op: "listen", Err: os.ErrPermission}
+	assert.Same(t, err, ExplainBindError("127.0.0.1:80", err))
+}
+
+func TestShadowWarning(t *testing.T) {
+	_, port := occupyPort(t)
+	// Binding [::1] next to a 127.0.0.1 listener succeeds but splits
+	// localhost clients between the two.
+	warning := ShadowWarning(net.JoinHostPort("::1", strconv.Itoa(port)))
+	assert.Contains(t, warning, "shadows")
+	assert.Contains(t, warning, fmt.Sprintf("127.0.0.1:%d", port))
+
+	assert.Contains(t, ShadowWarning("127.0.0.1:5432"), "PostgreSQL port")
+	assert.Empty(t, ShadowWarning("127.0.0.1:0"))
+	assert.Empty(t, ShadowWarning("not-an-address"))
+}
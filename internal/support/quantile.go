@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultQuantileSample is the sample size of a QuantileSketch unless
+// another is asked for: p95 from it is within about 1.5 percentile points
+// of the truth.
+const DefaultQuantileSample = 1024
+
+// Percentiles are the p50, p95 and p99 of the durations a QuantileSketch
+// saw, out of Count of them.
+type Percentiles struct {
+	P50, P95, P99 time.Duration
+	Count         uint64
+}
+
+// QuantileSketch estimates quantiles of an unbounded series of durations
+// from a uniform sample of fixed size (Vitter's algorithm R): exact until the
+// sample is full, an estimate after. Add never allocates. It is safe for
+// concurrent use.
+type QuantileSketch struct {
+	mu     sync.Mutex
+	sample []time.Duration
+	// sorted is the scratch copy Quantile sorts.
+	sorted []time.Duration
+	seen   uint64
+	rng    uint64
+}
+
+// NewQuantileSketch returns a sketch keeping up to size durations; size <= 0
+// is DefaultQuantileSample.
+func NewQuantileSketch(size int) *QuantileSketch {
+	if size <= 0 {
+		size = DefaultQuantileSample
+	}
+	return &QuantileSketch{
+		sample: make([]time.Duration, 0, size),
+		sorted: make([]time.Duration, 0, size),
+		rng:    0x9e3779b97f4a7c15,
+	}
+}
+
+// Add records d.
+func (s *QuantileSketch) Add(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seen++
+	if len(s.sample) < cap(s.sample) {
+		s.sample = append(s.sample, d)
+		return
+	}
+	// Keep d with probability size/seen, in place of a random entry.
+	if i := s.next() % s.seen; i < uint64(len(s.sample)) {
+		s.sample[i] = d
+	}
+}
+
+// next is xorshift64*: enough to pick sample slots, and free of locks and
+// allocations.
+func (s *QuantileSketch) next() uint64 {
+	s.rng ^= s.rng >> 12
+	s.rng ^= s.rng << 25
+	s.rng ^= s.rng >> 27
+	return s.rng * 0x2545f4914f6cdd1d
+}
+
+// Count is how many durations were added since the last Reset.
+func (s *QuantileSketch) Count() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seen
+}
+
+// Quantile returns the q-quantile (0 <= q <= 1) of the durations added, 0
+// when there are none.
+func (s *QuantileSketch) Quantile(q float64) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sort()
+	return s.at(q)
+}
+
+// Percentiles returns the p50, p95 and p99 of the durations added.
+func (s *QuantileSketch) Percentiles() Percentiles {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sort()
+	return Percentiles{P50: s.at(0.50), P95: s.at(0.95), P99: s.at(0.99), Count: s.seen}
+}
+
+// Reset forgets every duration added.
+func (s *QuantileSketch) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sample = s.sample[:0]
+	s.seen = 0
+}
+
+func (s *QuantileSketch) sort() {
+	s.sorted = append(s.sorted[:0], s.sample...)
+	slices.Sort(s.sorted)
+}
+
+// at is the nearest-rank q-quantile of sorted.
+func (s *QuantileSketch) at(q float64) time.Duration {
+	n := len(s.sorted)
+	if n == 0 {
+		return 0
+	}
+	i := int(q*float64(n)+0.5) - 1
+	return s.sorted[min(max(i, 0), n-1)]
+}
@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuantileSketch_ExactUntilFull(t *testing.T) {
+	s := NewQuantileSketch(100)
+	assert.Zero(t, s.Quantile(0.5), "no samples")
+	for _, i := range rand.New(rand.NewSource(1)).Perm(100) {
+		s.Add(time.Duration(i+1) * time.Millisecond)
+	}
+	assert.Equal(t, Percentiles{P50: 50 * time.Millisecond, P95: 95 * time.Millisecond, P99: 99 * time.Millisecond, Count: 100}, s.Percentiles())
+	assert.Equal(t, time.Millisecond, s.Quantile(0))
+	assert.Equal(t, 100*time.Millisecond, s.Quantile(1))
+
+	s.Reset()
+	assert.Zero(t, s.Count())
+	assert.Zero(t, s.Quantile(0.95))
+}
+
+func TestQuantileSketch_Uniform(t *testing.T) {
+	const n = 200_000
+	s := NewQuantileSketch(0)
+	rng := rand.New(rand.NewSource(2))
+	for range n {
+		s.Add(time.Duration(rng.Int63n(int64(10 * time.Second))))
+	}
+	for _, q := range []float64{0.5, 0.95, 0.99} {
+		want := q * float64(10*time.Second)
+		assert.InDelta(t, want, float64(s.Quantile(q)), 0.02*float64(10*time.Second), "q=%v", q)
+	}
+	assert.Equal(t, uint64(n), s.Count())
+}
+
+func TestQuantileSketch_Exponential(t *testing.T) {
+	const mean = 100 * time.Millisecond
+	s := NewQuantileSketch(0)
+	rng := rand.New(rand.NewSource(3))
+	for range 200_000 {
+		s.Add(time.Duration(rng.ExpFloat64() * float64(mean)))
+	}
+	for _, q := range []float64{0.5, 0.95, 0.99} {
+		want := -math.Log(1-q) * float64(mean)
+		assert.InEpsilon(t, want, float64(s.Quantile(q)), 0.1, "q=%v", q)
+	}
+}
+
+// TestQuantileSketch_LateShift checks that the sample follows a shift in
+// the distribution rather than keeping only the early values.
+func TestQuantileSketch_LateShift(t *testing.T) {
+	s := NewQuantileSketch(0)
+	for range 50_000 {
+		s.Add(time.Millisecond)
+	}
+	for range 50_000 {
+		s.Add(time.Second)
+	}
+	assert.Equal(t, time.Second, s.Quantile(0.95))
+	assert.Equal(t, time.Millisecond, s.Quantile(0.25))
+}
+
+func TestQuantileSketch_AddDoesNotAllocate(t *testing.T) {
+	s := NewQuantileSketch(64)
+	d := time.Duration(0)
+	allocs := testing.AllocsPerRun(1000, func() {
+		d += time.Microsecond
+		s.Add(d)
+	})
+	assert.Zero(t, allocs)
+	allocs = testing.AllocsPerRun(100, func() { _ = s.Percentiles() })
+	assert.Zero(t, allocs)
+}
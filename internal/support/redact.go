@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Redacted stands in for a removed secret.
+const Redacted = "[redacted]"
+
+// redactMinSecretLen skips values too short to mask without mangling
+// unrelated text.
+const redactMinSecretLen = 4
+
+var (
+	bearerPattern      = regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]+`)
+	urlPasswordPattern = regexp.MustCompile(`(://[^/\s:@]+:)[^/\s@]+@`)
+	secretQueryPattern = regexp.MustCompile(`(?i)([?&](?:auth|token|password|pass|psk|secret)=)[^&\s"]+`)
+)
+
+// Redactor removes secrets from text that leaves the process, such as a
+// support bundle: the known secret values it was built with, bearer
+// tokens, URL passwords and secret-looking query parameters.
+type Redactor struct {
+	secrets []string
+}
+
+// NewRedactor returns a Redactor for the given secret values.
+func NewRedactor(secrets ...string) *Redactor {
+	r := &Redactor{}
+	seen := map[string]bool{}
+	for _, s := range secrets {
+		s = strings.TrimSpace(s)
+		if len(s) >= redactMinSecretLen && !seen[s] {
+			seen[s] = true
+			r.secrets = append(r.secrets, s)
+		}
+	}
+	// Longest first, so a secret containing another is masked whole.
+	sort.Slice(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+	return r
+}
+
+// Redact returns s with every secret replaced by Redacted.
+func (r *Redactor) Redact(s string) string {
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, Redacted)
+	}
+	s = bearerPattern.ReplaceAllString(s, "${1}"+Redacted)
+	s = urlPasswordPattern.ReplaceAllString(s, "${1}"+Redacted+"@")
+	return secretQueryPattern.ReplaceAllString(s, "${1}"+Redacted)
+}
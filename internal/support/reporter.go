@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Level is where a Reporter message belongs.
+type Level int
+
+const (
+	// LevelInfo is the normal output of a run: progress, URLs, hints and
+	// notices of the server.
+	LevelInfo Level = iota
+	// LevelWarn is a warning about the configuration or the environment,
+	// apart from the normal output.
+	LevelWarn
+)
+
+// Reporter is where packages send what the user sees, so the CLI decides
+// how it is shown. Library code never prints on its own.
+type Reporter interface {
+	// UserMessage shows one message. id is its fmt format, which also
+	// identifies the message; args fill it in. Without args id is the
+	// message itself.
+	UserMessage(level Level, id string, args ...any)
+	// Event reports a machine-readable event, e.g. "listen" with its
+	// "addr".
+	Event(kind string, fields map[string]any)
+	// Progress replaces the transient progress line with line; an empty
+	// line ends it.
+	Progress(line string)
+}
+
+// StdReporter is the Reporter of the CLI's text output: LevelInfo messages
+// go to Out, LevelWarn messages, events and the progress line to Err. Nil
+// writers are os.Stdout and os.Stderr at the time of writing, so the zero
+// value is the CLI's output.
+type StdReporter struct {
+	Out io.Writer
+	Err io.Writer
+}
+
+func (r StdReporter) out() io.Writer {
+	if r.Out != nil {
+		return r.Out
+	}
+	return os.Stdout
+}
+
+func (r StdReporter) err() io.Writer {
+	if r.Err != nil {
+		return r.Err
+	}
+	return os.Stderr
+}
+
+// UserMessage writes id formatted with args; without args id is written as
+// is, so a message holding a URL with %-escapes stays intact.
+func (r StdReporter) UserMessage(level Level, id string, args ...any) {
+	w := r.out()
+	if level == LevelWarn {
+		w = r.err()
+	}
+	if len(args) == 0 {
+		_, _ = io.WriteString(w, id)
+		return
+	}
+	fmt.Fprintf(w, id, args...)
+}
+
+// Event writes "KIND key=value ..." with the keys in order, like the
+// status lines of WriteStatusLine.
+func (r StdReporter) Event(kind string, fields map[string]any) {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(strings.ToUpper(kind))
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%v", k, fields[k])
+	}
+	fmt.Fprintln(r.err(), b.String())
+}
+
+func (r StdReporter) Progress(line string) {
+	if line == "" {
+		fmt.Fprint(r.err(), "\n")
+		return
+	}
+	fmt.Fprintf(r.err(), "\r\033[K%s", line)
+}
+
+// ReporterOr returns r, or the zero StdReporter when r is nil.
+func ReporterOr(r Reporter) Reporter {
+	if r == nil {
+		return StdReporter{}
+	}
+	return r
+}
@@ -0,0 +1,38 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStdReporter(t *testing.T) {
+	var out, errOut bytes.Buffer
+	r := StdReporter{Out: &out, Err: &errOut}
+
+	r.UserMessage(LevelInfo, "🌐 Public URL: %s\n", "https://a.example")
+	r.UserMessage(LevelWarn, "⚠️  %s was provided via CLI and may be visible in process listings\n", "--pass")
+	r.UserMessage(LevelInfo, "✅ Tunnel created successfully!\n")
+	assert.Equal(t, "🌐 Public URL: https://a.example\n✅ Tunnel created successfully!\n", out.String())
+	assert.Equal(t, "⚠️  --pass was provided via CLI and may be visible in process listings\n", errOut.String())
+
+	errOut.Reset()
+	r.Progress("↑ 1 B/s")
+	r.Progress("↑ 2 B/s")
+	r.Progress("")
+	assert.Equal(t, "\r\033[K↑ 1 B/s\r\033[K↑ 2 B/s\n", errOut.String())
+
+	errOut.Reset()
+	r.Event("listen", map[string]any{"proto": "tcp", "addr": "127.0.0.1:8080"})
+	assert.Equal(t, "LISTEN addr=127.0.0.1:8080 proto=tcp\n", errOut.String())
+}
+
+func TestReporterOr(t *testing.T) {
+	assert.Equal(t, StdReporter{}, ReporterOr(nil))
+	r := StdReporter{Out: &bytes.Buffer{}}
+	assert.Equal(t, r, ReporterOr(r))
+}
@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxRemoteLogRunes is the most characters of one remote-controlled string
+// that SanitizeRemote lets into a log line.
+const MaxRemoteLogRunes = 256
+
+// SanitizeRemote makes a string that came from the network (a stream
+// preface dst, a control message reason) safe to print: CR, LF and tab are
+// escaped so it cannot start a spoofed log line, other control and bidi
+// formatting characters are dropped so it cannot drive the terminal, invalid
+// UTF-8 becomes U+FFFD, and anything longer than MaxRemoteLogRunes is cut
+// there and marked with "…".
+func SanitizeRemote(s string) string {
+	clean := true
+	for _, r := range s {
+		if r == utf8.RuneError || isUnsafeRune(r) {
+			clean = false
+			break
+		}
+	}
+	if clean && utf8.RuneCountInString(s) <= MaxRemoteLogRunes {
+		return s
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range strings.ToValidUTF8(s, string(utf8.RuneError)) {
+		var part string
+		switch {
+		case r == '\n':
+			part = `\n`
+		case r == '\r':
+			part = `\r`
+		case r == '\t':
+			part = `\t`
+		case isUnsafeRune(r):
+			continue
+		default:
+			part = string(r)
+		}
+		if n += utf8.RuneCountInString(part); n > MaxRemoteLogRunes {
+			b.WriteString("…")
+			break
+		}
+		b.WriteString(part)
+	}
+	return b.String()
+}
+
+// isUnsafeRune reports C0/C1 controls (ESC starts ANSI sequences) and the
+// bidi overrides and isolates that reorder how a line is displayed.
+func isUnsafeRune(r rune) bool {
+	return unicode.IsControl(r) || (r >= '\u202a' && r <= '\u202e') || (r >= '\u2066' && r <= '\u2069')
+}
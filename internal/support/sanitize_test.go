@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitizeRemote(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"plain", "127.0.0.1:8080", "127.0.0.1:8080"},
+		{"utf-8 kept", "туннель закрыт 🚇", "туннель закрыт 🚇"},
+		{"ansi color", "\x1b[31mred\x1b[0m", "[31mred[0m"},
+		{"ansi clear screen", "a\x1b[2J\x1b[Hb", "a[2J[Hb"},
+		{"spoofed line", "x\n2026/10/15 00:00:00 [ERROR] fake", `x\n2026/10/15 00:00:00 [ERROR] fake`},
+		{"carriage return", "ok\rBAD", `ok\rBAD`},
+		{"tab", "a\tb", `a\tb`},
+		{"bell and nul", "a\x07b\x00c", "abc"},
+		{"c1 csi", "a\u009b31mb", "a31mb"},
+		{"bidi override", "user\u202eexe.txt", "userexe.txt"},
+		{"invalid utf-8", "a\xffb", "a�b"},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, SanitizeRemote(tt.in), tt.name)
+	}
+}
+
+func TestSanitizeRemote_Truncates(t *testing.T) {
+	exact := strings.Repeat("ж", MaxRemoteLogRunes)
+	assert.Equal(t, exact, SanitizeRemote(exact))
+
+	got := SanitizeRemote(exact + "ж")
+	assert.Equal(t, exact+"…", got)
+	assert.True(t, utf8.ValidString(got))
+
+	// Escapes count toward the limit.
+	got = SanitizeRemote(strings.Repeat("\n", MaxRemoteLogRunes))
+	assert.Equal(t, strings.Repeat(`\n`, MaxRemoteLogRunes/2)+"…", got)
+}
+
+// remoteFields are expressions holding network-controlled strings, per
+// package directory and optionally per file, that must only be printed
+// through SanitizeRemote.
+var remoteFields = []struct {
+	dir   string
+	files []string
+	exprs []string
+}{
+	{"../dataplane", nil, []string{`pre["dst"]`}},
+	{"../dataplane", []string{"tcp.go", "incoming_guard.go", "loop.go"}, []string{"dst", "backend"}},
+	{"../control", nil, []string{"msg.Type", "payload.Message", "payload.Reason", "payload.InstanceID", "payload.Status", "payload.Endpoint", "tunnel.Status"}},
+	{"../control", []string{"watch.go"}, []string{"reason", "status"}},
+	{"../../cmd/client", nil, []string{"other.InstanceID", "p.Endpoint", "p.PublicURL"}},
+}
+
+var printFuncs = []string{"Printf", "Println", "Print", "Fprintf", "Fprintln", "Errorf", "Repeatf", "logDebug"}
+
+// TestRemoteFieldsAreSanitized keeps remote-controlled strings from reaching
+// a print or error call without SanitizeRemote.
+func TestRemoteFieldsAreSanitized(t *testing.T) {
+	for _, rf := range remoteFields {
+		paths, err := filepath.Glob(filepath.Join(rf.dir, "*.go"))
+		require.NoError(t, err)
+		require.NotEmpty(t, paths, rf.dir)
+		for _, path := range paths {
+			if strings.HasSuffix(path, "_test.go") || (rf.files != nil && !slices.Contains(rf.files, filepath.Base(path))) {
+				continue
+			}
+			for _, bad := range unsanitizedPrints(t, path, rf.exprs) {
+				t.Errorf("%s prints a remote-controlled value without SanitizeRemote", bad)
+			}
+		}
+	}
+}
+
+// unsanitizedPrints returns the positions of print call arguments in path
+// that are one of exprs.
+func unsanitizedPrints(t *testing.T, path string, exprs []string) []string {
+	t.Helper()
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, nil, 0)
+	require.NoError(t, err)
+	var found []string
+	ast.Inspect(f, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || !slices.Contains(printFuncs, callName(call)) {
+			return true
+		}
+		for _, arg := range call.Args {
+			var buf bytes.Buffer
+			_ = printer.Fprint(&buf, fset, arg)
+			if slices.Contains(exprs, buf.String()) {
+				found = append(found, fset.Position(arg.Pos()).String()+": "+buf.String())
+			}
+		}
+		return true
+	})
+	return found
+}
+
+func callName(call *ast.CallExpr) string {
+	switch fn := call.Fun.(type) {
+	case *ast.Ident:
+		return fn.Name
+	case *ast.SelectorExpr:
+		return fn.Sel.Name
+	}
+	return ""
+}
@@ -0,0 +1,229 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sources of a TerminalCause: what ended the run.
+const (
+	CauseSignal     = "signal"      // SIGINT or SIGTERM
+	CauseServer     = "server"      // the server closed a control or data-plane channel
+	CauseTunnelGone = "tunnel_gone" // tunnel deleted, closed or expired on the server
+	CauseDisplaced  = "displaced"   // another client instance took the tunnel over
+	CauseAuth       = "auth"        // access to the tunnel was revoked
+	CauseLocal      = "local"       // local listener or target
+	CauseQuota      = "quota"       // --max-bytes-total
+	CauseDataPlane  = "dataplane"   // data plane failed after retries
+	CauseError      = "error"       // anything else
+)
+
+// wsCloseNames names the WebSocket close codes a server sends.
+var wsCloseNames = map[int]string{
+	1000: "normal closure",
+	1001: "going away",
+	1002: "protocol error",
+	1003: "unsupported data",
+	1006: "abnormal closure",
+	1008: "policy violation",
+	1009: "message too big",
+	1011: "internal error",
+	1012: "service restart",
+	1013: "try again later",
+}
+
+// TerminalCause is why a run ended, as the component that ended it reported
+// it.
+type TerminalCause struct {
+	Source string
+	// Code is the WebSocket close code the server sent, 0 without one.
+	Code    int
+	Message string
+	At      time.Time
+	// exit is the exit code of the run error a derived cause stands for.
+	exit int
+}
+
+// String renders the cause for people: "server closed control channel
+// (code 1001 going away)".
+func (c TerminalCause) String() string {
+	if c.Code == 0 {
+		return c.Message
+	}
+	if name := wsCloseNames[c.Code]; name != "" {
+		return fmt.Sprintf("%s (code %d %s)", c.Message, c.Code, name)
+	}
+	return fmt.Sprintf("%s (code %d)", c.Message, c.Code)
+}
+
+// ExitCode maps the cause to the process exit codes. A cause derived from
+// the run's error keeps that error's code.
+func (c TerminalCause) ExitCode() int {
+	if c.exit != 0 {
+		return c.exit
+	}
+	switch c.Source {
+	case CauseSignal, CauseDisplaced:
+		return ExitOK
+	case CauseServer:
+		if c.Code == 1000 {
+			return ExitOK
+		}
+		return ExitServerUnreachable
+	case CauseTunnelGone:
+		return ExitTunnelGone
+	case CauseAuth:
+		return ExitAuth
+	case CauseLocal:
+		return ExitLocalTarget
+	case CauseQuota:
+		return ExitQuota
+	case CauseDataPlane:
+		return ExitDataPlane
+	}
+	return ExitError
+}
+
+// PostMortem is the line printed at exit: "exited: <cause> at 14:32:11 after
+// 3h 12m; 42 streams served, 1.2 GiB transferred".
+func (c TerminalCause) PostMortem(started time.Time, streams, bytes int64) string {
+	return fmt.Sprintf("exited: %s at %s after %s; %d streams served, %s transferred",
+		c, c.At.In(displayZone()).Format(time.TimeOnly), FormatDuration(c.At.Sub(started)), streams, FormatBytes(bytes))
+}
+
+// causeSources are the sources of run errors no component reported, by
+// exit code.
+var causeSources = map[int]string{
+	ExitAuth:              CauseAuth,
+	ExitServerUnreachable: CauseServer,
+	ExitDataPlane:         CauseDataPlane,
+	ExitTunnelGone:        CauseTunnelGone,
+	ExitLocalTarget:       CauseLocal,
+	ExitQuota:             CauseQuota,
+}
+
+// CauseCollector is where the components that can end a run report why. The
+// first fatal cause wins; closes of data-plane sessions, which the client
+// redials, are only observed.
+type CauseCollector struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	started   time.Time
+	first     *TerminalCause
+	lastClose *TerminalCause
+}
+
+// Causes is the collector of this process.
+var Causes = NewCauseCollector(time.Now)
+
+// NewCauseCollector returns a collector stamping causes with now.
+func NewCauseCollector(now func() time.Time) *CauseCollector {
+	return &CauseCollector{now: now}
+}
+
+// Start marks the run as serving: only a run that started gets a
+// post-mortem, and its duration counts from here.
+func (c *CauseCollector) Start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.started.IsZero() {
+		c.started = c.now()
+	}
+}
+
+// Started returns when Start was first called, zero before.
+func (c *CauseCollector) Started() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.started
+}
+
+// Report records a cause that ends the run. It reports whether it is the
+// first; later causes are consequences of the first and are dropped.
+func (c *CauseCollector) Report(source string, code int, message string) bool {
+	cause := TerminalCause{Source: source, Code: code, Message: message, At: c.now()}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.first != nil {
+		return false
+	}
+	c.first = &cause
+	return true
+}
+
+// ObserveClose records the close of a data-plane WebSocket session, which
+// the client redials; the last one names the close code of a data plane
+// that fails for good.
+func (c *CauseCollector) ObserveClose(code int, message string) {
+	cause := TerminalCause{Source: CauseDataPlane, Code: code, Message: message, At: c.now()}
+	c.mu.Lock()
+	c.lastClose = &cause
+	c.mu.Unlock()
+}
+
+// Resolve returns why a run that started and ended with err ended: the
+// first reported cause or, without one, a cause derived from err whose
+// data-plane failures carry the last observed close code. It returns false
+// when there is none: the run did not start, or ended without error or
+// cause.
+func (c *CauseCollector) Resolve(err error) (TerminalCause, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.started.IsZero() {
+		return TerminalCause{}, false
+	}
+	if c.first != nil {
+		return *c.first, true
+	}
+	if err == nil {
+		return TerminalCause{}, false
+	}
+	source, ok := causeSources[ExitCode(err)]
+	if !ok {
+		source = CauseError
+	}
+	cause := TerminalCause{Source: source, Message: errorSummary(err), At: c.now(), exit: ExitCode(err)}
+	if source == CauseDataPlane && c.lastClose != nil {
+		cause.Code = c.lastClose.Code
+	}
+	return cause, true
+}
+
+// Reset forgets everything recorded, for tests.
+func (c *CauseCollector) Reset() {
+	c.mu.Lock()
+	c.started, c.first, c.lastClose = time.Time{}, nil, nil
+	c.mu.Unlock()
+}
+
+// errorSummary is the first line of err's text without the leading status
+// emoji.
+func errorSummary(err error) string {
+	msg, _, _ := strings.Cut(err.Error(), "\n")
+	return strings.TrimSpace(strings.TrimLeft(msg, "❌⌛📏 "))
+}
+
+// ExitError returns err as the run's error once cause decides its exit code:
+// err or, when it is nil, an error naming cause. A cause exiting with
+// ExitOK leaves err alone.
+func (c TerminalCause) ExitError(err error) error {
+	code := c.ExitCode()
+	if code == ExitOK {
+		return err
+	}
+	if err == nil {
+		err = errors.New(c.String())
+	}
+	var ce *CodedError
+	if errors.As(err, &ce) && ce.Code == code {
+		return err
+	}
+	return WithExitCode(code, err)
+}
@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// steppingClock returns a now func that starts at start and moves by step
+// on every call.
+func steppingClock(start time.Time, step time.Duration) func() time.Time {
+	now := start
+	return func() time.Time {
+		t := now
+		now = now.Add(step)
+		return t
+	}
+}
+
+func TestTerminalCause_ExitCode(t *testing.T) {
+	tests := []struct {
+		cause TerminalCause
+		want  int
+	}{
+		{TerminalCause{Source: CauseSignal}, ExitOK},
+		{TerminalCause{Source: CauseDisplaced}, ExitOK},
+		{TerminalCause{Source: CauseServer, Code: 1000}, ExitOK},
+		{TerminalCause{Source: CauseServer, Code: 1001}, ExitServerUnreachable},
+		{TerminalCause{Source: CauseServer}, ExitServerUnreachable},
+		{TerminalCause{Source: CauseTunnelGone}, ExitTunnelGone},
+		{TerminalCause{Source: CauseAuth}, ExitAuth},
+		{TerminalCause{Source: CauseLocal}, ExitLocalTarget},
+		{TerminalCause{Source: CauseQuota}, ExitQuota},
+		{TerminalCause{Source: CauseDataPlane, Code: 1011}, ExitDataPlane},
+		{TerminalCause{Source: CauseError}, ExitError},
+		{TerminalCause{Source: "unknown"}, ExitError},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.cause.ExitCode(), "%+v", tt.cause)
+	}
+}
+
+func TestTerminalCause_String(t *testing.T) {
+	assert.Equal(t, "received SIGINT", TerminalCause{Message: "received SIGINT"}.String())
+	assert.Equal(t, "server closed control channel (code 1001 going away)",
+		TerminalCause{Message: "server closed control channel", Code: 1001}.String())
+	assert.Equal(t, "server closed control channel (code 4000)",
+		TerminalCause{Message: "server closed control channel", Code: 4000}.String())
+}
+
+func TestTerminalCause_PostMortem(t *testing.T) {
+	SetUTCTimes(true)
+	defer SetUTCTimes(false)
+	started := time.Date(2026, 3, 1, 11, 20, 0, 0, time.UTC)
+	cause := TerminalCause{Source: CauseServer, Code: 1001, Message: "server closed control channel", At: started.Add(3*time.Hour + 12*time.Minute + 11*time.Second)}
+	assert.Equal(t, "exited: server closed control channel (code 1001 going away) at 14:32:11 after 3h 12m; 42 streams served, 1.2 GiB transferred",
+		cause.PostMortem(started, 42, 1288490189))
+}
+
+func TestCauseCollector_FirstFatalCauseWins(t *testing.T) {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := NewCauseCollector(steppingClock(start, time.Second))
+
+	_, ok := c.Resolve(errors.New("boom"))
+	assert.False(t, ok, "a run that never served gets no post-mortem")
+
+	c.Start()
+	assert.True(t, c.Report(CauseTunnelGone, 0, "tunnel was deleted on the server"))
+	assert.False(t, c.Report(CauseServer, 1006, "server closed control channel"), "the deletion also closes the control channel")
+	assert.False(t, c.Report(CauseSignal, 0, "received SIGINT"))
+
+	cause, ok := c.Resolve(ErrTunnelGone)
+	require.True(t, ok)
+	assert.Equal(t, TerminalCause{Source: CauseTunnelGone, Message: "tunnel was deleted on the server", At: start.Add(time.Second)}, cause)
+	assert.Equal(t, start, c.Started())
+
+	c.Reset()
+	assert.True(t, c.Started().IsZero())
+	c.Start()
+	assert.True(t, c.Report(CauseSignal, 0, "received SIGTERM"), "Reset forgets the earlier cause")
+}
+
+func TestCauseCollector_ResolveDerivesFromRunError(t *testing.T) {
+	c := NewCauseCollector(steppingClock(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC), time.Minute))
+	c.Start()
+	_, ok := c.Resolve(nil)
+	assert.False(t, ok, "a clean exit without a cause")
+
+	c.ObserveClose(1012, "server closed data-plane session")
+	dpErr := WithExitCode(ExitDataPlane, fmt.Errorf("❌ Data-plane serve stopped: %w\n   details", errors.New("session closed")))
+	cause, ok := c.Resolve(dpErr)
+	require.True(t, ok)
+	assert.Equal(t, CauseDataPlane, cause.Source)
+	assert.Equal(t, "Data-plane serve stopped: session closed (code 1012 service restart)", cause.String())
+	assert.Equal(t, ExitDataPlane, cause.ExitCode())
+
+	bindErr := WithExitCode(ExitLocalTarget, errors.New("listen tcp 127.0.0.1:80: bind: permission denied"))
+	cause, ok = c.Resolve(bindErr)
+	require.True(t, ok)
+	assert.Equal(t, CauseLocal, cause.Source)
+	assert.Zero(t, cause.Code, "only data-plane failures carry the observed close code")
+
+	cause, ok = c.Resolve(WithExitCode(ExitConfig, errors.New("❌ invalid flag")))
+	require.True(t, ok)
+	assert.Equal(t, CauseError, cause.Source)
+	assert.Equal(t, ExitConfig, cause.ExitCode(), "a derived cause keeps its error's exit code")
+}
+
+func TestTerminalCause_ExitError(t *testing.T) {
+	signal := TerminalCause{Source: CauseSignal, Message: "received SIGINT"}
+	assert.NoError(t, signal.ExitError(nil))
+
+	server := TerminalCause{Source: CauseServer, Code: 1001, Message: "server closed control channel"}
+	err := server.ExitError(nil)
+	require.Error(t, err)
+	assert.Equal(t, ExitServerUnreachable, ExitCode(err))
+	assert.Equal(t, "server closed control channel (code 1001 going away)", err.Error())
+
+	gone := TerminalCause{Source: CauseTunnelGone, Message: "tunnel was deleted on the server"}
+	err = gone.ExitError(ErrTunnelGone)
+	assert.ErrorIs(t, err, ErrTunnelGone)
+	assert.Equal(t, ExitTunnelGone, ExitCode(err))
+
+	quota := WithExitCode(ExitQuota, errors.New("quota"))
+	assert.Same(t, quota, TerminalCause{Source: CauseQuota}.ExitError(quota))
+
+	// The first cause decides the code of an error that followed from it.
+	assert.Equal(t, ExitTunnelGone, ExitCode(gone.ExitError(WithExitCode(ExitDataPlane, errors.New("session closed")))))
+}
@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// utcTimes makes FormatTime render in UTC instead of the local zone; --utc
+// sets it.
+var utcTimes atomic.Bool
+
+// SetUTCTimes makes FormatTime and FormatTimeFrom render in UTC (on) or in
+// the local zone.
+func SetUTCTimes(on bool) { utcTimes.Store(on) }
+
+// displayZone is the zone printed times are rendered in.
+func displayZone() *time.Location {
+	if utcTimes.Load() {
+		return time.UTC
+	}
+	return time.Local
+}
+
+// FormatTime renders t for people: RFC 3339 with the zone offset spelled
+// out, in the local zone or, under --utc, in UTC.
+func FormatTime(t time.Time) string {
+	return formatTimeIn(t, displayZone())
+}
+
+// FormatTimeFrom renders t like FormatTime followed by how far it is from
+// now: "2026-03-01T18:00:00+03:00 (in 1h 12m)".
+func FormatTimeFrom(t, now time.Time) string {
+	return formatTimeIn(t, displayZone()) + " (" + FormatRelative(t, now) + ")"
+}
+
+// JSONTime renders t for machine-readable output: RFC 3339 in UTC, whatever
+// --utc says.
+func JSONTime(t time.Time) string {
+	return formatTimeIn(t, time.UTC)
+}
+
+func formatTimeIn(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format(time.RFC3339)
+}
+
+// FormatRelative renders how far t is from now: "in 1h 12m", "3m ago",
+// "in 42s", or "now" within half a second.
+func FormatRelative(t, now time.Time) string {
+	d := t.Sub(now)
+	switch {
+	case d > -time.Second/2 && d < time.Second/2:
+		return "now"
+	case d < 0:
+		return FormatDuration(-d) + " ago"
+	default:
+		return "in " + FormatDuration(d)
+	}
+}
+
+// FormatDuration renders d to the precision people read it at: seconds
+// under a minute ("42s"), minutes under a day ("1h 12m", "42m") and hours
+// beyond ("2d 3h"). Negative durations render as their magnitude.
+func FormatDuration(d time.Duration) string {
+	if d < 0 {
+		d = -d
+	}
+	const day = 24 * time.Hour
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int((d+time.Second/2)/time.Second))
+	case d < day:
+		d = d.Round(time.Minute)
+		h, m := d/time.Hour, d%time.Hour/time.Minute
+		switch {
+		case h == 0:
+			return fmt.Sprintf("%dm", m)
+		case m == 0:
+			return fmt.Sprintf("%dh", h)
+		}
+		return fmt.Sprintf("%dh %dm", h, m)
+	default:
+		d = d.Round(time.Hour)
+		days, h := d/day, d%day/time.Hour
+		if h == 0 {
+			return fmt.Sprintf("%dd", days)
+		}
+		return fmt.Sprintf("%dd %dh", days, h)
+	}
+}
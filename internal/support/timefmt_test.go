@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatTimeIn_Offsets(t *testing.T) {
+	at := time.Date(2026, 3, 1, 15, 0, 0, 0, time.UTC)
+	tests := []struct {
+		loc  *time.Location
+		want string
+	}{
+		{time.UTC, "2026-03-01T15:00:00Z"},
+		{time.FixedZone("MSK", 3*3600), "2026-03-01T18:00:00+03:00"},
+		{time.FixedZone("IST", 5*3600+1800), "2026-03-01T20:30:00+05:30"},
+		{time.FixedZone("EST", -5*3600), "2026-03-01T10:00:00-05:00"},
+		{time.FixedZone("NST", -(3*3600 + 1800)), "2026-03-01T11:30:00-03:30"},
+		{time.FixedZone("LINT", 14*3600), "2026-03-02T05:00:00+14:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.loc.String(), func(t *testing.T) {
+			assert.Equal(t, tt.want, formatTimeIn(at, tt.loc))
+			assert.Equal(t, tt.want, formatTimeIn(at.In(time.FixedZone("other", -7*3600)), tt.loc), "the input's zone does not matter")
+		})
+	}
+}
+
+func TestFormatTime_UTCOverride(t *testing.T) {
+	defer SetUTCTimes(false)
+	at := time.Date(2026, 3, 1, 18, 0, 0, 0, time.FixedZone("MSK", 3*3600))
+
+	SetUTCTimes(true)
+	assert.Equal(t, "2026-03-01T15:00:00Z", FormatTime(at))
+	assert.Equal(t, "2026-03-01T15:00:00Z (in 1h 12m)", FormatTimeFrom(at, at.Add(-72*time.Minute)))
+
+	SetUTCTimes(false)
+	assert.Equal(t, formatTimeIn(at, time.Local), FormatTime(at))
+	assert.Equal(t, "2026-03-01T15:00:00Z", JSONTime(at), "JSON ignores the local zone")
+}
+
+func TestFormatRelative(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "now"},
+		{400 * time.Millisecond, "now"},
+		{-400 * time.Millisecond, "now"},
+		{time.Second, "in 1s"},
+		{29800 * time.Millisecond, "in 30s"},
+		{-42 * time.Second, "42s ago"},
+		{-3 * time.Minute, "3m ago"},
+		{41*time.Minute + 40*time.Second, "in 42m"},
+		{72 * time.Minute, "in 1h 12m"},
+		{2 * time.Hour, "in 2h"},
+		{-(26*time.Hour + 10*time.Minute), "1d 2h ago"},
+		{72 * time.Hour, "in 3d"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, FormatRelative(now.Add(tt.d), now), "%v", tt.d)
+	}
+}
@@ -0,0 +1,43 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"time"
+)
+
+// TLSProbeTimeout bounds the connect and handshake of SpeaksTLS.
+const TLSProbeTimeout = time.Second
+
+// SpeaksTLS reports whether the service at addr answers a TLS ClientHello
+// with a ServerHello. The certificate is not checked: a local dev server's
+// self-signed one counts too. A refused connection, a plaintext answer or
+// silence until timeout is false.
+func SpeaksTLS(addr string, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	d := &net.Dialer{}
+	raw, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return false
+	}
+	defer raw.Close()
+	host, _, _ := net.SplitHostPort(addr)
+	// A peer that sent its certificate spoke TLS, even if the handshake
+	// fails afterwards, e.g. for want of a client certificate.
+	var sawCertificate bool
+	conn := tls.Client(raw, &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: true, //nolint:gosec // only asks whether the peer speaks TLS, nothing is sent
+		VerifyPeerCertificate: func([][]byte, [][]*x509.Certificate) error {
+			sawCertificate = true
+			return nil
+		},
+	})
+	return conn.HandshakeContext(ctx) == nil || sawCertificate
+}
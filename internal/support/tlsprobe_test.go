@@ -0,0 +1,45 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package support
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpeaksTLS(t *testing.T) {
+	ok := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	tlsSrv := httptest.NewTLSServer(ok)
+	defer tlsSrv.Close()
+	assert.True(t, SpeaksTLS(tlsSrv.Listener.Addr().String(), TLSProbeTimeout), "self-signed TLS")
+
+	legacy := httptest.NewUnstartedServer(ok)
+	legacy.TLS = &tls.Config{MaxVersion: tls.VersionTLS12, ClientAuth: tls.RequireAnyClientCert}
+	legacy.StartTLS()
+	defer legacy.Close()
+	assert.True(t, SpeaksTLS(legacy.Listener.Addr().String(), TLSProbeTimeout), "TLS 1.2 refusing the handshake for want of a client certificate")
+
+	plain := httptest.NewServer(ok)
+	defer plain.Close()
+	assert.False(t, SpeaksTLS(plain.Listener.Addr().String(), TLSProbeTimeout), "plaintext HTTP")
+}
+
+func TestSpeaksTLS_NoAnswer(t *testing.T) {
+	silent, _ := occupyPort(t) // accepts connections, never writes
+	start := time.Now()
+	assert.False(t, SpeaksTLS(silent.Addr().String(), 200*time.Millisecond))
+	assert.Less(t, time.Since(start), 2*time.Second, "bounded by the timeout")
+
+	port, err := FreePort("127.0.0.1")
+	require.NoError(t, err)
+	assert.False(t, SpeaksTLS(net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), TLSProbeTimeout), "nothing listening")
+}
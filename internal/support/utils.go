@@ -4,11 +4,13 @@
 package support
 
 import (
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"io"
 	"math"
 	"net"
+	"net/url"
 	"os"
 	"strings"
 )
@@ -44,6 +46,19 @@ func GetDefaultServerURL(defaultServerURL string) string {
 	return defaultServerURL
 }
 
+// ServerEndpoint resolves the API path (e.g. "/api/tunnels") against the
+// server URL; query (may be nil) becomes the query string.
+func ServerEndpoint(serverURL, path string, query url.Values) (string, error) {
+	base, err := url.Parse(serverURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid server url: %w", err)
+	}
+	if base.Scheme == "" || base.Host == "" {
+		return "", errors.New("invalid server url")
+	}
+	return base.ResolveReference(&url.URL{Path: path, RawQuery: query.Encode()}).String(), nil
+}
+
 // GetEnvTrimmed returns a trimmed environment variable value or empty string.
 func GetEnvTrimmed(name string) string {
 	if v := os.Getenv(name); strings.TrimSpace(v) != "" {
@@ -86,6 +101,16 @@ func ReadSecretStdin(label string) (string, error) {
 	return secret, nil
 }
 
+// NewInstanceID returns a random RFC 4122 version 4 UUID identifying one
+// client process.
+func NewInstanceID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
 // parsePort parses port from string, accepts forms like 8000 or :8000
 func ParsePort(s string) string {
 	if s == "" {
@@ -148,3 +173,18 @@ func toUintSize[T ~uint16 | ~uint32](n int, limit int64, label string) (T, error
 	}
 	return T(n), nil
 }
+
+// FormatBytes renders a byte count with a binary unit prefix: "512 B",
+// "1.2 GiB".
+func FormatBytes(n int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	v, i := float64(n), 0
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f %s", v, units[i])
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"net"
 	"os"
+	"regexp"
 	"testing"
 )
 
@@ -121,3 +122,14 @@ func TestToUint16Size(t *testing.T) {
 		})
 	}
 }
+
+func TestNewInstanceID(t *testing.T) {
+	uuidV4 := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	a, b := NewInstanceID(), NewInstanceID()
+	if !uuidV4.MatchString(a) {
+		t.Fatalf("NewInstanceID() = %q, want a version 4 UUID", a)
+	}
+	if a == b {
+		t.Fatalf("NewInstanceID() returned %q twice", a)
+	}
+}
@@ -0,0 +1,311 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fortunnels/client/internal/support"
+)
+
+const (
+	otlpTracesPath     = "/v1/traces"
+	otlpQueueSize      = 2048
+	otlpBatchSize      = 256
+	otlpFlushInterval  = 2 * time.Second
+	otlpRequestTimeout = 5 * time.Second
+	serviceName        = "fortunnels-client"
+	scopeName          = "github.com/fortunnels/client"
+
+	spanKindInternal = 1
+	statusCodeError  = 2
+)
+
+// OTLPTracer exports spans in batches to an OTLP/HTTP (JSON) collector.
+type OTLPTracer struct {
+	endpoint string
+	client   *http.Client
+	queue    chan *otlpSpan
+	done     chan struct{}
+	flushed  chan struct{}
+	once     sync.Once
+}
+
+// NewOTLPTracer returns a tracer exporting to endpoint. The endpoint is an
+// http(s) collector URL; when it has no path, /v1/traces is appended.
+// OTLP/gRPC endpoints are not supported.
+func NewOTLPTracer(endpoint string) (*OTLPTracer, error) {
+	target, err := NormalizeOTLPEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	t := &OTLPTracer{
+		endpoint: target,
+		client:   &http.Client{Timeout: otlpRequestTimeout},
+		queue:    make(chan *otlpSpan, otlpQueueSize),
+		done:     make(chan struct{}),
+		flushed:  make(chan struct{}),
+	}
+	support.Go(support.PanicScope{Role: "otlp exporter"}, t.run)
+	return t, nil
+}
+
+// NormalizeOTLPEndpoint validates an --otel-endpoint value and returns the traces URL.
+func NormalizeOTLPEndpoint(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid otel endpoint: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+	case "grpc", "grpcs":
+		return "", errors.New("otel endpoint: OTLP/gRPC is not supported, use the collector's OTLP/HTTP URL (usually port 4318)")
+	default:
+		return "", fmt.Errorf("otel endpoint must be an http(s) URL, got %q", endpoint)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("otel endpoint %q has no host", endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = otlpTracesPath
+	}
+	return u.String(), nil
+}
+
+func (t *OTLPTracer) Enabled() bool { return true }
+
+func (t *OTLPTracer) Start(name string, parent SpanContext, start time.Time) Span {
+	if start.IsZero() {
+		start = time.Now()
+	}
+	s := &otlpSpan{tracer: t, name: name, start: start}
+	if parent.IsValid() {
+		s.sc.TraceID = parent.TraceID
+		s.sc.Flags = parent.Flags
+		s.parent = parent.SpanID
+	} else {
+		s.sc.TraceID = newTraceID()
+		s.sc.Flags = 1
+	}
+	s.sc.SpanID = newSpanID()
+	return s
+}
+
+// Shutdown flushes queued spans and stops the exporter.
+func (t *OTLPTracer) Shutdown(ctx context.Context) error {
+	t.once.Do(func() { close(t.done) })
+	select {
+	case <-t.flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *OTLPTracer) enqueue(s *otlpSpan) {
+	select {
+	case <-t.done:
+		return
+	default:
+	}
+	select {
+	case t.queue <- s:
+	default:
+		// Exporter is behind; tracing must never block the data path.
+	}
+}
+
+func (t *OTLPTracer) run() {
+	defer close(t.flushed)
+	ticker := time.NewTicker(otlpFlushInterval)
+	defer ticker.Stop()
+	batch := make([]*otlpSpan, 0, otlpBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.export(batch); err != nil {
+			log.Printf("[WARN] otel export: %v", err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case s := <-t.queue:
+			batch = append(batch, s)
+			if len(batch) >= otlpBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.done:
+			for {
+				select {
+				case s := <-t.queue:
+					batch = append(batch, s)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (t *OTLPTracer) export(spans []*otlpSpan) error {
+	body, err := json.Marshal(encodeOTLP(spans))
+	if err != nil {
+		return err
+	}
+	resp, err := t.client.Post(t.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+type otlpAttr struct {
+	key string
+	str string
+	num int64
+	isN bool
+}
+
+type otlpSpan struct {
+	tracer *OTLPTracer
+	name   string
+	sc     SpanContext
+	parent [8]byte
+	start  time.Time
+	end    time.Time
+	attrs  []otlpAttr
+	errMsg string
+	ended  bool
+}
+
+func (s *otlpSpan) Context() SpanContext { return s.sc }
+
+func (s *otlpSpan) SetString(key, value string) {
+	s.attrs = append(s.attrs, otlpAttr{key: key, str: value})
+}
+
+func (s *otlpSpan) SetInt(key string, value int64) {
+	s.attrs = append(s.attrs, otlpAttr{key: key, num: value, isN: true})
+}
+
+func (s *otlpSpan) RecordError(err error) {
+	if err != nil {
+		s.errMsg = err.Error()
+	}
+}
+
+func (s *otlpSpan) End() {
+	if s.ended {
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.tracer.enqueue(s)
+}
+
+// OTLP/HTTP JSON payload (opentelemetry-proto, JSON mapping).
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpJSONSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpJSONSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpExportRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func stringKV(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: &value}}
+}
+
+func encodeOTLP(spans []*otlpSpan) otlpExportRequest {
+	scope := otlpScopeSpans{Spans: make([]otlpJSONSpan, 0, len(spans))}
+	scope.Scope.Name = scopeName
+	for _, s := range spans {
+		js := otlpJSONSpan{
+			TraceID:           hex.EncodeToString(s.sc.TraceID[:]),
+			SpanID:            hex.EncodeToString(s.sc.SpanID[:]),
+			Name:              s.name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+		if s.parent != [8]byte{} {
+			js.ParentSpanID = hex.EncodeToString(s.parent[:])
+		}
+		for _, a := range s.attrs {
+			if a.isN {
+				n := strconv.FormatInt(a.num, 10)
+				js.Attributes = append(js.Attributes, otlpKeyValue{Key: a.key, Value: otlpAnyValue{IntValue: &n}})
+				continue
+			}
+			js.Attributes = append(js.Attributes, stringKV(a.key, a.str))
+		}
+		if s.errMsg != "" {
+			js.Status = otlpStatus{Code: statusCodeError, Message: s.errMsg}
+		}
+		scope.Spans = append(scope.Spans, js)
+	}
+	rs := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{scope}}
+	rs.Resource.Attributes = []otlpKeyValue{stringKV("service.name", serviceName)}
+	return otlpExportRequest{ResourceSpans: []otlpResourceSpans{rs}}
+}
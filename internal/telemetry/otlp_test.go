@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeOTLPEndpoint(t *testing.T) {
+	got, err := NormalizeOTLPEndpoint("http://localhost:4318")
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:4318/v1/traces", got)
+
+	got, err = NormalizeOTLPEndpoint("https://collector.example/custom/traces")
+	require.NoError(t, err)
+	assert.Equal(t, "https://collector.example/custom/traces", got)
+
+	_, err = NormalizeOTLPEndpoint("grpc://localhost:4317")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "gRPC")
+
+	_, err = NormalizeOTLPEndpoint("localhost:4318")
+	require.Error(t, err)
+}
+
+func TestOTLPTracer_ExportsSpans(t *testing.T) {
+	var mu sync.Mutex
+	var got []otlpExportRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var req otlpExportRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		mu.Lock()
+		got = append(got, req)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	tr, err := NewOTLPTracer(srv.URL)
+	require.NoError(t, err)
+
+	parent, ok := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.True(t, ok)
+	span := tr.Start("tunnel.stream", parent, time.Now().Add(-time.Second))
+	span.SetString("dst", "127.0.0.1:80")
+	span.SetInt("bytes_in", 42)
+	span.RecordError(errors.New("boom"))
+	span.End()
+	span.End()
+	assert.Equal(t, parent.TraceID, span.Context().TraceID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, tr.Shutdown(ctx))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, got, 1)
+	spans := got[0].ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 1, "End is idempotent")
+	s := spans[0]
+	assert.Equal(t, "tunnel.stream", s.Name)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", s.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", s.ParentSpanID)
+	assert.Equal(t, statusCodeError, s.Status.Code)
+	assert.Equal(t, "boom", s.Status.Message)
+	require.Len(t, s.Attributes, 2)
+	assert.Equal(t, "dst", s.Attributes[0].Key)
+	assert.Equal(t, "42", *s.Attributes[1].Value.IntValue)
+}
@@ -0,0 +1,144 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+// Package telemetry provides optional distributed tracing for tunnel hops.
+//
+// By default a no-op tracer is installed so the data-plane pays nothing for
+// tracing. Calling SetTracer with an OTLP tracer (see NewOTLPTracer) turns on
+// span export.
+package telemetry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// SpanContext identifies a span inside a trace (W3C Trace Context).
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte
+}
+
+// IsValid reports whether both trace and span IDs are non-zero.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Traceparent formats sc as a W3C traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	var b strings.Builder
+	b.Grow(55)
+	b.WriteString("00-")
+	b.WriteString(hex.EncodeToString(sc.TraceID[:]))
+	b.WriteByte('-')
+	b.WriteString(hex.EncodeToString(sc.SpanID[:]))
+	b.WriteByte('-')
+	b.WriteString(hex.EncodeToString([]byte{sc.Flags}))
+	return b.String()
+}
+
+// ParseTraceparent parses a W3C traceparent header value.
+func ParseTraceparent(v string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, false
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return SpanContext{}, false
+	}
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	return sc, true
+}
+
+// Span is a single timed operation. Implementations must be safe to call from
+// the goroutine that started the span; End must be called exactly once.
+type Span interface {
+	Context() SpanContext
+	SetString(key, value string)
+	SetInt(key string, value int64)
+	RecordError(err error)
+	End()
+}
+
+// Tracer creates spans. A zero parent starts a new trace; a zero start time
+// means now.
+type Tracer interface {
+	Enabled() bool
+	Start(name string, parent SpanContext, start time.Time) Span
+	Shutdown(ctx context.Context) error
+}
+
+type noopTracer struct{}
+
+func (noopTracer) Enabled() bool                             { return false }
+func (noopTracer) Start(string, SpanContext, time.Time) Span { return noopSpan{} }
+func (noopTracer) Shutdown(context.Context) error            { return nil }
+
+type noopSpan struct{}
+
+func (noopSpan) Context() SpanContext     { return SpanContext{} }
+func (noopSpan) SetString(string, string) {}
+func (noopSpan) SetInt(string, int64)     {}
+func (noopSpan) RecordError(error)        {}
+func (noopSpan) End()                     {}
+
+// Noop returns a tracer that records nothing.
+func Noop() Tracer { return noopTracer{} }
+
+type tracerHolder struct{ t Tracer }
+
+var current atomic.Pointer[tracerHolder]
+
+func init() {
+	current.Store(&tracerHolder{t: noopTracer{}})
+}
+
+// SetTracer installs t as the process-wide tracer; nil restores the no-op tracer.
+func SetTracer(t Tracer) {
+	if t == nil {
+		t = noopTracer{}
+	}
+	current.Store(&tracerHolder{t: t})
+}
+
+// Current returns the process-wide tracer.
+func Current() Tracer { return current.Load().t }
+
+// Start starts a span on the process-wide tracer.
+func Start(name string, parent SpanContext) Span {
+	return Current().Start(name, parent, time.Time{})
+}
+
+func newSpanID() [8]byte {
+	var id [8]byte
+	_, _ = rand.Read(id[:])
+	return id
+}
+
+func newTraceID() [16]byte {
+	var id [16]byte
+	_, _ = rand.Read(id[:])
+	return id
+}
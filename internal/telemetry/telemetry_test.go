@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package telemetry
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	sc, ok := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.True(t, ok)
+	assert.Equal(t, byte(1), sc.Flags)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sc.Traceparent())
+
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-zzf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		_, ok := ParseTraceparent(bad)
+		assert.False(t, ok, "traceparent %q should be rejected", bad)
+	}
+}
+
+func TestNoopTracer_ZeroAllocs(t *testing.T) {
+	SetTracer(nil)
+	allocs := testing.AllocsPerRun(100, func() {
+		tr := Current()
+		span := tr.Start("tunnel.stream", SpanContext{}, time.Time{})
+		span.SetString("tunnel_id", "t")
+		span.SetInt("bytes_in", 1)
+		span.RecordError(errTest)
+		span.End()
+	})
+	assert.Zero(t, allocs)
+}
+
+var errTest = errors.New("test")
+
+func BenchmarkNoopSpan(b *testing.B) {
+	SetTracer(nil)
+	b.ReportAllocs()
+	for b.Loop() {
+		span := Start("tunnel.stream", SpanContext{})
+		span.SetString("tunnel_id", "t")
+		span.SetInt("bytes_in", 1)
+		span.End()
+	}
+}
@@ -0,0 +1,31 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+// Package allocs bounds the memory a parser allocates, for the fuzz targets
+// of packages that internal/testsupport itself imports.
+package allocs
+
+import (
+	"math"
+	"runtime"
+	"testing"
+)
+
+// Check fails t when parse allocates more than limit bytes. Other
+// goroutines can only add to a measurement, so one over the limit is retaken
+// and the smallest kept; parse must therefore be repeatable.
+func Check(t testing.TB, limit uint64, parse func()) {
+	t.Helper()
+	least := uint64(math.MaxUint64)
+	for range 3 {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		parse()
+		runtime.ReadMemStats(&after)
+		least = min(least, after.TotalAlloc-before.TotalAlloc)
+		if least <= limit {
+			return
+		}
+	}
+	t.Fatalf("allocated %d bytes, limit %d", least, limit)
+}
@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package testsupport
+
+import (
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// ConnectProxy is an HTTP CONNECT proxy for tests. Hosts maps names that only
+// the proxy can resolve (e.g. "echo.internal:7") to real addresses; other
+// targets are dialed as given.
+type ConnectProxy struct {
+	URL string
+
+	http  *httptest.Server
+	hosts map[string]string
+	auth  string // expected Proxy-Authorization, empty for none
+
+	mu      sync.Mutex
+	targets []string
+}
+
+// NewConnectProxy starts a CONNECT proxy. When user is non-empty, requests
+// must carry matching Basic proxy credentials.
+func NewConnectProxy(hosts map[string]string, user, pass string) *ConnectProxy {
+	p := &ConnectProxy{hosts: hosts}
+	if user != "" {
+		p.auth = "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+pass))
+	}
+	p.http = httptest.NewServer(http.HandlerFunc(p.handle))
+	p.URL = p.http.URL
+	return p
+}
+
+// Close stops the proxy.
+func (p *ConnectProxy) Close() { p.http.Close() }
+
+// Targets returns the CONNECT targets requested so far.
+func (p *ConnectProxy) Targets() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.targets...)
+}
+
+func (p *ConnectProxy) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect {
+		http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+		return
+	}
+	if p.auth != "" && r.Header.Get("Proxy-Authorization") != p.auth {
+		w.Header().Set("Proxy-Authenticate", `Basic realm="test"`)
+		w.WriteHeader(http.StatusProxyAuthRequired)
+		return
+	}
+	p.mu.Lock()
+	p.targets = append(p.targets, r.Host)
+	p.mu.Unlock()
+	addr := r.Host
+	if mapped, ok := p.hosts[addr]; ok {
+		addr = mapped
+	}
+	backend, err := net.Dial("tcp", addr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		backend.Close()
+		return
+	}
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		conn.Close()
+		backend.Close()
+		return
+	}
+	go func() {
+		_, _ = io.Copy(backend, conn)
+		if tc, ok := backend.(*net.TCPConn); ok {
+			_ = tc.CloseWrite()
+		}
+	}()
+	go func() {
+		defer conn.Close()
+		defer backend.Close()
+		_, _ = io.Copy(conn, backend)
+	}()
+}
@@ -0,0 +1,267 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package testsupport
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/dtls/v3/pkg/crypto/selfsign"
+	"github.com/quic-go/quic-go"
+
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+)
+
+// quicOpenTimeout bounds opening a server-initiated stream on a QUIC
+// connection.
+const quicOpenTimeout = 5 * time.Second
+
+// quicConn is a QUIC connection a client registered to serve a tunnel.
+type quicConn struct {
+	conn         *quic.Conn
+	auth         string
+	instance     string
+	registeredAt time.Time
+}
+
+// blackholeConn is the UDP socket of the QUIC listener; while drop is set,
+// every datagram in either direction is lost (see SetQUICBlackhole).
+type blackholeConn struct {
+	net.PacketConn
+	drop atomic.Bool
+}
+
+func (c *blackholeConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(p)
+		if err != nil || !c.drop.Load() {
+			return n, addr, err
+		}
+	}
+}
+
+func (c *blackholeConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if c.drop.Load() {
+		return len(p), nil
+	}
+	return c.PacketConn.WriteTo(p, addr)
+}
+
+// ServeQUIC starts the stub's QUIC listener (--dp quic for http/https): a
+// connection is registered for a tunnel with a ProtoServe stream, after which
+// OpenStream opens the tunnel's streams on it instead of on a data-plane
+// WebSocket. The certificate is self-signed, so clients must skip
+// verification. It returns the listener's UDP port.
+func (s *Server) ServeQUIC() (int, error) {
+	cert, err := selfsign.GenerateSelfSigned()
+	if err != nil {
+		return 0, err
+	}
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return 0, err
+	}
+	pc := &blackholeConn{PacketConn: udp}
+	ln, err := quic.Listen(pc, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"fortunnels-quic"},
+		MinVersion:   tls.VersionTLS13,
+	}, nil)
+	if err != nil {
+		_ = udp.Close()
+		return 0, err
+	}
+	s.mu.Lock()
+	s.quic, s.quicPackets = ln, pc
+	s.quicConns = make(map[string][]*quicConn)
+	s.mu.Unlock()
+	go func() {
+		for {
+			qc, err := ln.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go s.registerQUIC(qc)
+		}
+	}()
+	return ln.Addr().(*net.UDPAddr).Port, nil
+}
+
+// SetQUICBlackhole makes the QUIC listener lose every datagram while on is
+// set, simulating a path that stopped carrying UDP: connections stay open on
+// both ends until they time out, and new handshakes do not complete.
+func (s *Server) SetQUICBlackhole(on bool) {
+	s.mu.Lock()
+	pc := s.quicPackets
+	s.mu.Unlock()
+	if pc != nil {
+		pc.drop.Store(on)
+	}
+}
+
+// registerQUIC reads the ProtoServe stream of a new connection and answers
+// it with a setup ack.
+func (s *Server) registerQUIC(qc *quic.Conn) {
+	ctx, cancel := context.WithTimeout(qc.Context(), quicOpenTimeout)
+	defer cancel()
+	st, err := qc.AcceptStream(ctx)
+	if err != nil {
+		_ = qc.CloseWithError(0, "")
+		return
+	}
+	defer st.Close()
+	line, err := bufio.NewReader(st).ReadString('\n')
+	if err != nil {
+		_ = qc.CloseWithError(0, "")
+		return
+	}
+	var pre map[string]string
+	if err := json.Unmarshal([]byte(strings.TrimSpace(line)), &pre); err != nil {
+		_ = qc.CloseWithError(0, "")
+		return
+	}
+	tunnelID := pre["tunnel_id"]
+	s.mu.Lock()
+	s.prefaces[tunnelID] = append(s.prefaces[tunnelID], pre)
+	_, known := s.tunnels[tunnelID]
+	switch {
+	case pre["proto"] != protocolv1.ProtoServe:
+		s.mu.Unlock()
+		writeAck(st, "expected a serve stream")
+		return
+	case !known || s.closed:
+		s.mu.Unlock()
+		writeAck(st, "unknown tunnel")
+		return
+	}
+	s.quicConns[tunnelID] = append(s.quicConns[tunnelID], &quicConn{conn: qc, auth: pre["auth"], instance: pre[protocolv1.PrefaceClientInstance], registeredAt: time.Now()})
+	close(s.changed)
+	s.changed = make(chan struct{})
+	s.mu.Unlock()
+	writeAck(st, "")
+}
+
+// writeAck writes a setup ack line: ok, or the error msg.
+func writeAck(st *quic.Stream, msg string) {
+	ack := map[string]any{"ok": msg == ""}
+	if msg != "" {
+		ack["error"] = msg
+	}
+	b, _ := json.Marshal(ack)
+	_, _ = st.Write(append(b, '\n'))
+}
+
+// liveQUICConn returns the tunnel's latest registered connection that is
+// still open, or nil.
+func (s *Server) liveQUICConn(tunnelID string) *quicConn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := s.quicConns[tunnelID]
+	if len(list) == 0 || list[len(list)-1].conn.Context().Err() != nil {
+		return nil
+	}
+	return list[len(list)-1]
+}
+
+func (qc *quicConn) openStream() (*quicStream, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), quicOpenTimeout)
+	defer cancel()
+	st, err := qc.conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &quicStream{st}, nil
+}
+
+// QUICConns reports how many QUIC connections were registered for
+// tunnelID, including closed ones.
+func (s *Server) QUICConns(tunnelID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.quicConns[tunnelID])
+}
+
+// QUICAuth returns the auth field the latest QUIC registration of tunnelID
+// carried.
+func (s *Server) QUICAuth(tunnelID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := s.quicConns[tunnelID]
+	if len(list) == 0 {
+		return ""
+	}
+	return list[len(list)-1].auth
+}
+
+// WaitQUICConns blocks until at least n QUIC connections were registered for
+// tunnelID.
+func (s *Server) WaitQUICConns(tunnelID string, n int, timeout time.Duration) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		s.mu.Lock()
+		count := len(s.quicConns[tunnelID])
+		changed := s.changed
+		s.mu.Unlock()
+		if count >= n {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return fmt.Errorf("tunnel %s: %d QUIC connections after %s, want %d", tunnelID, count, timeout, n)
+		}
+	}
+}
+
+// DropQUICConns closes every QUIC connection of tunnelID, simulating a
+// network drop.
+func (s *Server) DropQUICConns(tunnelID string) {
+	s.mu.Lock()
+	list := append([]*quicConn(nil), s.quicConns[tunnelID]...)
+	s.mu.Unlock()
+	for _, qc := range list {
+		_ = qc.conn.CloseWithError(0, "dropped")
+	}
+}
+
+func (s *Server) closeQUIC() {
+	s.mu.Lock()
+	ln, pc := s.quic, s.quicPackets
+	var all []*quicConn
+	for _, list := range s.quicConns {
+		all = append(all, list...)
+	}
+	s.mu.Unlock()
+	if ln == nil {
+		return
+	}
+	for _, qc := range all {
+		_ = qc.conn.CloseWithError(0, "")
+	}
+	_ = ln.Close()
+	_ = pc.Close()
+}
+
+// quicStream closes both directions on Close, and only the sending one on
+// CloseWrite, like an smux stream.
+type quicStream struct {
+	*quic.Stream
+}
+
+func (s *quicStream) Close() error {
+	s.CancelRead(0)
+	return s.Stream.Close()
+}
+
+func (s *quicStream) CloseWrite() error {
+	return s.Stream.Close()
+}
@@ -0,0 +1,871 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+// Package testsupport provides an in-process stand-in for the ForTunnels
+// server so client behavior can be tested end to end without external services.
+//
+// The stub speaks the same wire protocol the client expects: the tunnel
+// control API under /api/tunnels and the data-plane WebSocket at /ws
+// (smux over binary frames, JSON preface per stream).
+package testsupport
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/quic-go/quic-go"
+	"github.com/xtaci/smux"
+
+	"github.com/fortunnels/client/internal/auth"
+	sec "github.com/fortunnels/client/internal/security"
+	protocolv1 "github.com/fortunnels/client/shared/protocol/v1"
+	"github.com/fortunnels/client/shared/wsconn"
+)
+
+// Options configures a stub server.
+type Options struct {
+	// PSK enables stream encryption for client-opened UDP streams, mirroring
+	// the server side of --encrypt.
+	PSK string
+	// PSKKDF pins the key derivation, e.g. "legacy" for a server that predates
+	// Argon2id. Empty follows the KDF the client declares in the preface.
+	PSKKDF string
+	// PSKKeyID is the key ID the server confirms a psk_confirm challenge
+	// with; 0 sends none.
+	PSKKeyID int
+	// DPAuthSecret signs server-initiated stream prefaces with the
+	// tunnel_id||dst HMAC, mirroring a server configured with --dp-auth-secret.
+	DPAuthSecret string
+	// Capabilities is served at GET /api/version; nil answers 404 like a
+	// server that predates the endpoint.
+	Capabilities *protocolv1.ServerCapabilities
+	// UpgradeDelay holds each data-plane WebSocket upgrade back, like a
+	// server slow to attach the data plane of a new tunnel.
+	UpgradeDelay time.Duration
+}
+
+// Server is an in-process ForTunnels server stub.
+type Server struct {
+	URL string
+
+	opts     Options
+	http     *httptest.Server
+	upgrader websocket.Upgrader
+
+	mu       sync.Mutex
+	nextID   int
+	tunnels  map[string]*protocolv1.Tunnel
+	sessions map[string][]*dataSession
+	evicted  map[string]map[string]bool // tunnel ID -> displaced client instances
+	prefaces map[string][]map[string]string
+	watchers map[string][]*watchConn
+	changed  chan struct{}
+	closed   bool
+
+	// quic, quicPackets and quicConns are set by ServeQUIC.
+	quic        *quic.Listener
+	quicPackets *blackholeConn
+	quicConns   map[string][]*quicConn
+}
+
+// watchConn is a control channel of a tunnel: a control-plane WebSocket
+// (/ws?watch=<id>) or the control stream of a data-plane session. Writes are
+// serialized since SendControl may run concurrently.
+type watchConn struct {
+	mu     sync.Mutex
+	stream bool
+	send   func(v any) error
+	close  func() error
+}
+
+func (wc *watchConn) writeJSON(v any) error {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	return wc.send(v)
+}
+
+type dataSession struct {
+	conn        *websocket.Conn
+	sess        *smux.Session
+	auth        string
+	instance    string
+	connectedAt time.Time
+}
+
+// NewServer starts a stub server listening on a loopback port.
+func NewServer(opts Options) *Server {
+	s := &Server{
+		opts:     opts,
+		tunnels:  make(map[string]*protocolv1.Tunnel),
+		sessions: make(map[string][]*dataSession),
+		evicted:  make(map[string]map[string]bool),
+		prefaces: make(map[string][]map[string]string),
+		watchers: make(map[string][]*watchConn),
+		changed:  make(chan struct{}),
+		upgrader: websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/tunnels", s.handleTunnels)
+	mux.HandleFunc("/ws", s.handleWS)
+	mux.HandleFunc("/t/", s.handlePublicHTTP)
+	if opts.Capabilities != nil {
+		mux.HandleFunc("/api/version", func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(opts.Capabilities)
+		})
+	}
+	s.http = httptest.NewServer(mux)
+	s.URL = s.http.URL
+	return s
+}
+
+// Close stops the HTTP server and tears down every data-plane session.
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	var all []*dataSession
+	for _, list := range s.sessions {
+		all = append(all, list...)
+	}
+	s.mu.Unlock()
+	for _, ds := range all {
+		ds.close()
+	}
+	s.mu.Lock()
+	for _, list := range s.watchers {
+		for _, wc := range list {
+			_ = wc.close()
+		}
+	}
+	s.mu.Unlock()
+	s.closeQUIC()
+	s.http.CloseClientConnections()
+	s.http.Close()
+}
+
+// AddTunnel registers a tunnel without going through POST /api/tunnels.
+func (s *Server) AddTunnel(protocol, targetAddr string) *protocolv1.Tunnel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addTunnelLocked(protocol, targetAddr)
+}
+
+func (s *Server) addTunnelLocked(protocol, targetAddr string) *protocolv1.Tunnel {
+	s.nextID++
+	id := "stub-" + strconv.Itoa(s.nextID)
+	t := &protocolv1.Tunnel{
+		ID:         id,
+		Protocol:   protocol,
+		TargetAddr: targetAddr,
+		PublicURL:  s.URL + "/t/" + id + "/",
+		Status:     protocolv1.StatusActive,
+		CreatedAt:  time.Now().UTC(),
+	}
+	s.tunnels[id] = t
+	return t
+}
+
+// MirrorTunnel registers t, a tunnel of another stub, on s as well, so s can
+// stand in for the node the tunnel migrates to.
+func (s *Server) MirrorTunnel(t *protocolv1.Tunnel) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mirrored := *t
+	s.tunnels[t.ID] = &mirrored
+}
+
+// RemoveTunnel deletes tunnelID server-side (as an admin or expiry would) and
+// drops its data-plane sessions.
+func (s *Server) RemoveTunnel(tunnelID string) {
+	s.mu.Lock()
+	delete(s.tunnels, tunnelID)
+	s.mu.Unlock()
+	s.DropSessions(tunnelID)
+}
+
+// SessionCount reports how many data-plane sessions have connected for tunnelID.
+func (s *Server) SessionCount(tunnelID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions[tunnelID])
+}
+
+// SessionAuth returns the auth query parameter of the latest session for tunnelID.
+func (s *Server) SessionAuth(tunnelID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := s.sessions[tunnelID]
+	if len(list) == 0 {
+		return ""
+	}
+	return list[len(list)-1].auth
+}
+
+// LiveInstances returns the client instance of every open session for
+// tunnelID, oldest first.
+func (s *Server) LiveInstances(tunnelID string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []string
+	for _, ds := range s.sessions[tunnelID] {
+		if !ds.sess.IsClosed() {
+			out = append(out, ds.instance)
+		}
+	}
+	return out
+}
+
+// ClientPrefaces returns the prefaces of the streams the client opened for
+// tunnelID, in arrival order.
+func (s *Server) ClientPrefaces(tunnelID string) []map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]map[string]string(nil), s.prefaces[tunnelID]...)
+}
+
+// activeClientLocked reports the oldest open session's instance, like the
+// server's active_client field. The caller holds s.mu.
+func (s *Server) activeClientLocked(tunnelID string) *protocolv1.ActiveClient {
+	for _, ds := range s.sessions[tunnelID] {
+		if ds.instance != "" && !ds.sess.IsClosed() {
+			return &protocolv1.ActiveClient{InstanceID: ds.instance, ConnectedAt: ds.connectedAt}
+		}
+	}
+	return nil
+}
+
+// LiveSessions reports how many data-plane sessions of tunnelID are open.
+func (s *Server) LiveSessions(tunnelID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, ds := range s.sessions[tunnelID] {
+		if !ds.sess.IsClosed() {
+			n++
+		}
+	}
+	return n
+}
+
+// Watchers reports how many control WebSockets and data-plane control
+// streams are open for tunnelID.
+func (s *Server) Watchers(tunnelID string) (webSockets, streams int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, wc := range s.watchers[tunnelID] {
+		if wc.stream {
+			streams++
+		} else {
+			webSockets++
+		}
+	}
+	return webSockets, streams
+}
+
+// WaitWatchers blocks until at least n control channels (WebSockets or
+// control streams) watch tunnelID.
+func (s *Server) WaitWatchers(tunnelID string, n int, timeout time.Duration) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		s.mu.Lock()
+		count := len(s.watchers[tunnelID])
+		changed := s.changed
+		s.mu.Unlock()
+		if count >= n {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return fmt.Errorf("tunnel %s: %d control watchers after %s, want %d", tunnelID, count, timeout, n)
+		}
+	}
+}
+
+// SendControl sends a control message of msgType with payload to every
+// control channel watching tunnelID.
+func (s *Server) SendControl(tunnelID, msgType string, payload any) error {
+	env := protocolv1.NewEnvelope(msgType, payload)
+	s.mu.Lock()
+	list := append([]*watchConn(nil), s.watchers[tunnelID]...)
+	s.mu.Unlock()
+	if len(list) == 0 {
+		return fmt.Errorf("tunnel %s has no control watchers", tunnelID)
+	}
+	for _, wc := range list {
+		if err := wc.writeJSON(env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WaitSessions blocks until at least n sessions have connected for tunnelID.
+func (s *Server) WaitSessions(tunnelID string, n int, timeout time.Duration) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		s.mu.Lock()
+		count := len(s.sessions[tunnelID])
+		changed := s.changed
+		s.mu.Unlock()
+		if count >= n {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return fmt.Errorf("tunnel %s: %d data-plane sessions after %s, want %d", tunnelID, count, timeout, n)
+		}
+	}
+}
+
+// DropSessions closes the WebSocket of every live session for tunnelID,
+// simulating a network drop.
+func (s *Server) DropSessions(tunnelID string) {
+	s.mu.Lock()
+	list := append([]*dataSession(nil), s.sessions[tunnelID]...)
+	s.mu.Unlock()
+	for _, ds := range list {
+		ds.close()
+	}
+}
+
+// OpenStream opens a server-initiated stream on the latest session for
+// tunnelID, sends the TCP preface for dst and waits for the client's setup ack.
+// The returned stream carries raw backend bytes.
+func (s *Server) OpenStream(tunnelID, dst string) (io.ReadWriteCloser, error) {
+	return s.OpenStreamWithPreface(tunnelID, dst, nil)
+}
+
+// OpenStreamWithPreface is OpenStream with extra preface fields, e.g. the
+// hop count a real server copies from the stream that caused this one.
+func (s *Server) OpenStreamWithPreface(tunnelID, dst string, extra map[string]string) (io.ReadWriteCloser, error) {
+	st, err := s.openTunnelStream(tunnelID)
+	if err != nil {
+		return nil, err
+	}
+	pre := map[string]string{"dst": dst, "proto": "tcp"}
+	for k, v := range extra {
+		pre[k] = v
+	}
+	if s.opts.DPAuthSecret != "" {
+		pre[protocolv1.PrefaceHMAC] = auth.IncomingStreamHMAC(s.opts.DPAuthSecret, tunnelID, dst)
+	}
+	preface, _ := json.Marshal(pre)
+	if _, err := st.Write(append(preface, '\n')); err != nil {
+		st.Close()
+		return nil, err
+	}
+	rd := bufio.NewReader(st)
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		st.Close()
+		return nil, fmt.Errorf("read setup ack: %w", err)
+	}
+	var ack struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(line), &ack); err != nil {
+		st.Close()
+		return nil, fmt.Errorf("decode setup ack: %w", err)
+	}
+	if !ack.OK {
+		st.Close()
+		return nil, fmt.Errorf("client setup error: %s", ack.Error)
+	}
+	return &bufferedStream{Reader: rd, ReadWriteCloser: st}, nil
+}
+
+// openTunnelStream opens a stream on the tunnel's latest QUIC connection or
+// data-plane session, whichever was registered last: a client that switched
+// data planes serves on the new one while the old one may still be open.
+func (s *Server) openTunnelStream(tunnelID string) (io.ReadWriteCloser, error) {
+	s.mu.Lock()
+	list := s.sessions[tunnelID]
+	var ds *dataSession
+	if len(list) > 0 {
+		ds = list[len(list)-1]
+	}
+	s.mu.Unlock()
+	if qc := s.liveQUICConn(tunnelID); qc != nil && (ds == nil || ds.sess.IsClosed() || qc.registeredAt.After(ds.connectedAt)) {
+		return qc.openStream()
+	}
+	if ds == nil || ds.sess.IsClosed() {
+		return nil, fmt.Errorf("tunnel %s has no live data-plane session", tunnelID)
+	}
+	return ds.sess.OpenStream()
+}
+
+// ServePublic stands in for the public endpoint of tunnelID: every connection
+// to the returned listener gets its own stream to the tunnel's target, and
+// its bytes are relayed unchanged. Close the listener when done.
+func (s *Server) ServePublic(tunnelID string) (net.Listener, error) {
+	s.mu.Lock()
+	tun := s.tunnels[tunnelID]
+	s.mu.Unlock()
+	if tun == nil {
+		return nil, fmt.Errorf("unknown tunnel %s", tunnelID)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.relayPublic(c, tunnelID, tun.TargetAddr)
+		}
+	}()
+	return ln, nil
+}
+
+func (s *Server) relayPublic(c net.Conn, tunnelID, dst string) {
+	defer c.Close()
+	st, err := s.OpenStream(tunnelID, dst)
+	if err != nil {
+		return
+	}
+	defer st.Close()
+	done := make(chan struct{}, 2)
+	go func() { _, _ = io.Copy(st, c); closeWrite(st); done <- struct{}{} }()
+	go func() { _, _ = io.Copy(c, st); closeWrite(c); done <- struct{}{} }()
+	<-done
+	<-done
+}
+
+// handlePublicHTTP stands in for the public URL of an http/https tunnel:
+// /t/<id>/<path> is sent as /<path> over a stream to the tunnel's target and
+// the backend's response relayed back. Like a real server it answers 502
+// when the client cannot reach its backend.
+func (s *Server) handlePublicHTTP(w http.ResponseWriter, r *http.Request) {
+	id, path, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/t/"), "/")
+	s.mu.Lock()
+	tun := s.tunnels[id]
+	s.mu.Unlock()
+	if tun == nil {
+		http.NotFound(w, r)
+		return
+	}
+	st, err := s.OpenStream(id, tun.TargetAddr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer st.Close()
+	req := r.Clone(r.Context())
+	req.URL.Path, req.RequestURI, req.Close = "/"+path, "", true
+	if err := req.Write(st); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(st), req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
+
+type bufferedStream struct {
+	io.Reader
+	io.ReadWriteCloser
+}
+
+func (b *bufferedStream) Read(p []byte) (int, error) { return b.Reader.Read(p) }
+
+func (b *bufferedStream) CloseWrite() error {
+	if cw, ok := b.ReadWriteCloser.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return b.Close()
+}
+
+func (ds *dataSession) close() {
+	_ = ds.sess.Close()
+	_ = ds.conn.Close()
+}
+
+func (s *Server) handleTunnels(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var req protocolv1.TunnelCreateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		t := s.AddTunnel(req.Protocol, req.TargetAddr)
+		writeJSON(w, http.StatusCreated, t)
+	case http.MethodGet:
+		id := r.URL.Query().Get("id")
+		s.mu.Lock()
+		t, ok := s.tunnels[id]
+		var resp protocolv1.TunnelListResponse
+		if ok {
+			view := *t
+			view.ActiveClient = s.activeClientLocked(id)
+			resp = protocolv1.TunnelListResponse{Exists: true, Status: t.Status, Tunnels: []protocolv1.Tunnel{view}, Count: 1, Total: 1}
+		}
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, resp)
+	case http.MethodPatch:
+		var req protocolv1.TunnelPatchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		if req.Action != protocolv1.PatchActionTakeover || req.InstanceID == "" {
+			http.Error(w, "unsupported action", http.StatusBadRequest)
+			return
+		}
+		if !s.takeOver(req.ID, req.InstanceID) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		s.mu.Lock()
+		_, ok := s.tunnels[id]
+		delete(s.tunnels, id)
+		s.mu.Unlock()
+		if !ok {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		s.DropSessions(id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// takeOver closes every session of tunnelID not owned by instance and refuses
+// their instances from reconnecting.
+func (s *Server) takeOver(tunnelID, instance string) bool {
+	s.mu.Lock()
+	if _, ok := s.tunnels[tunnelID]; !ok {
+		s.mu.Unlock()
+		return false
+	}
+	if s.evicted[tunnelID] == nil {
+		s.evicted[tunnelID] = make(map[string]bool)
+	}
+	var losers []*dataSession
+	for _, ds := range s.sessions[tunnelID] {
+		if ds.instance != instance {
+			s.evicted[tunnelID][ds.instance] = true
+			losers = append(losers, ds)
+		}
+	}
+	delete(s.evicted[tunnelID], instance)
+	s.mu.Unlock()
+	for _, ds := range losers {
+		ds.close()
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// handleWatch serves a control WebSocket for tunnelID: it acknowledges the
+// subscription and then only carries what SendControl sends.
+func (s *Server) handleWatch(w http.ResponseWriter, r *http.Request, tunnelID string) {
+	s.mu.Lock()
+	_, known := s.tunnels[tunnelID]
+	s.mu.Unlock()
+	if !known {
+		http.Error(w, "unknown tunnel", http.StatusNotFound)
+		return
+	}
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	wc := &watchConn{send: conn.WriteJSON, close: conn.Close}
+	if err := wc.writeJSON(protocolv1.Envelope{Type: protocolv1.MessageTypeSubscribed}); err != nil {
+		return
+	}
+	defer s.addWatcher(tunnelID, wc)()
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// serveControlStream is handleWatch for a client-opened control stream: the
+// client writes nothing after the preface, so reading only detects its end.
+func (s *Server) serveControlStream(tunnelID string, stream io.ReadWriteCloser) {
+	enc := json.NewEncoder(stream)
+	wc := &watchConn{stream: true, send: enc.Encode, close: stream.Close}
+	if err := wc.writeJSON(protocolv1.Envelope{Type: protocolv1.MessageTypeSubscribed}); err != nil {
+		return
+	}
+	defer s.addWatcher(tunnelID, wc)()
+	_, _ = io.Copy(io.Discard, stream)
+}
+
+// addWatcher registers wc as a control channel of tunnelID; the returned
+// func deregisters it.
+func (s *Server) addWatcher(tunnelID string, wc *watchConn) func() {
+	s.mu.Lock()
+	s.watchers[tunnelID] = append(s.watchers[tunnelID], wc)
+	close(s.changed)
+	s.changed = make(chan struct{})
+	s.mu.Unlock()
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		list := s.watchers[tunnelID]
+		for i, c := range list {
+			if c == wc {
+				s.watchers[tunnelID] = append(list[:i:i], list[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func (s *Server) handleWS(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if id := q.Get("watch"); id != "" {
+		s.handleWatch(w, r, id)
+		return
+	}
+	if q.Get("mode") != "data" {
+		http.Error(w, "only data-plane mode is stubbed", http.StatusBadRequest)
+		return
+	}
+	tunnelID := q.Get("tunnel_id")
+	instance := r.Header.Get(protocolv1.HeaderClientInstance)
+	s.mu.Lock()
+	_, known := s.tunnels[tunnelID]
+	closed := s.closed
+	displaced := s.evicted[tunnelID][instance]
+	s.mu.Unlock()
+	if !known || closed {
+		http.Error(w, "unknown tunnel", http.StatusNotFound)
+		return
+	}
+	if displaced {
+		http.Error(w, "client instance was displaced", http.StatusConflict)
+		return
+	}
+	if s.opts.UpgradeDelay > 0 {
+		select {
+		case <-time.After(s.opts.UpgradeDelay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	sess, err := smux.Server(wsconn.NewWSConn(conn, wsconn.Options{}), smux.DefaultConfig())
+	if err != nil {
+		conn.Close()
+		return
+	}
+	ds := &dataSession{conn: conn, sess: sess, auth: q.Get("auth"), instance: instance, connectedAt: time.Now().UTC()}
+	s.mu.Lock()
+	s.sessions[tunnelID] = append(s.sessions[tunnelID], ds)
+	close(s.changed)
+	s.changed = make(chan struct{})
+	s.mu.Unlock()
+
+	go s.acceptClientStreams(tunnelID, ds)
+}
+
+func (s *Server) acceptClientStreams(tunnelID string, ds *dataSession) {
+	defer ds.close()
+	for {
+		st, err := ds.sess.AcceptStream()
+		if err != nil {
+			return
+		}
+		go s.serveClientStream(tunnelID, st)
+	}
+}
+
+// EchoDst is the preface dst of client-opened TCP streams the server echoes
+// instead of dialing.
+const EchoDst = "echo:7"
+
+// serveClientStream handles a client-opened stream: UDP relays datagrams to
+// the preface dst; TCP dials dst, or echoes when dst is EchoDst; a control
+// stream carries what SendControl sends.
+func (s *Server) serveClientStream(tunnelID string, st *smux.Stream) {
+	defer st.Close()
+	rd := bufio.NewReader(st)
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return
+	}
+	var pre map[string]string
+	if err := json.Unmarshal([]byte(strings.TrimSpace(line)), &pre); err != nil {
+		return
+	}
+	s.mu.Lock()
+	s.prefaces[tunnelID] = append(s.prefaces[tunnelID], pre)
+	s.mu.Unlock()
+	var stream io.ReadWriteCloser = &bufferedStream{Reader: rd, ReadWriteCloser: st}
+	if pre["proto"] == protocolv1.ProtoControl {
+		s.serveControlStream(tunnelID, stream)
+		return
+	}
+	if s.opts.PSK != "" {
+		declared := s.opts.PSKKDF
+		if declared == "" {
+			declared = pre[protocolv1.PrefacePSKKDF]
+		}
+		kdf := sec.LegacyKDF
+		if declared != "" {
+			if kdf, err = sec.ParseKDF(declared); err != nil {
+				return
+			}
+		}
+		stream = sec.NewClientPSKWithKDF([]byte(s.opts.PSK), kdf).Wrap(stream, tunnelID)
+	}
+	if pre["proto"] == protocolv1.ProtoPSKConfirm {
+		s.servePSKConfirm(st, stream)
+		return
+	}
+	switch pre["proto"] {
+	case "udp":
+		relayUDP(stream, pre["dst"])
+	default:
+		relayTCP(stream, pre["dst"])
+	}
+}
+
+// servePSKConfirm answers a psk_confirm stream: a setup error without a
+// PSK, otherwise the decrypted challenge, or nothing when it does not
+// decrypt.
+func (s *Server) servePSKConfirm(st io.Writer, stream io.ReadWriteCloser) {
+	if s.opts.PSK == "" {
+		_, _ = st.Write([]byte(`{"ok":false,"error":"no PSK is configured for this tunnel"}` + "\n"))
+		return
+	}
+	if _, err := st.Write([]byte(`{"ok":true}` + "\n")); err != nil {
+		return
+	}
+	var challenge protocolv1.PSKChallenge
+	if err := json.NewDecoder(stream).Decode(&challenge); err != nil {
+		return
+	}
+	_ = json.NewEncoder(stream).Encode(protocolv1.PSKConfirmation{Confirmed: challenge.Challenge, KeyID: s.opts.PSKKeyID})
+}
+
+func relayTCP(stream io.ReadWriteCloser, dst string) {
+	if dst == EchoDst {
+		_, _ = io.Copy(stream, stream)
+		return
+	}
+	bc, err := net.Dial("tcp", dst)
+	if err != nil {
+		return
+	}
+	defer bc.Close()
+	// Propagate half-close both ways and return once both directions finish,
+	// so responses still drain after the client stops writing.
+	done := make(chan struct{}, 2)
+	go func() { _, _ = io.Copy(bc, stream); closeWrite(bc); done <- struct{}{} }()
+	go func() { _, _ = io.Copy(stream, bc); closeWrite(stream); done <- struct{}{} }()
+	<-done
+	<-done
+}
+
+func closeWrite(c any) {
+	if cw, ok := c.(interface{ CloseWrite() error }); ok {
+		_ = cw.CloseWrite()
+	}
+}
+
+func relayUDP(stream io.ReadWriteCloser, dst string) {
+	uc, err := net.Dial("udp", dst)
+	if err != nil {
+		return
+	}
+	defer uc.Close()
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, err := uc.Read(buf)
+			if err != nil {
+				return
+			}
+			if err := writeFrame(stream, buf[:n]); err != nil {
+				return
+			}
+		}
+	}()
+	for {
+		packet, err := readFrame(stream)
+		if err != nil {
+			return
+		}
+		if _, err := uc.Write(packet); err != nil {
+			return
+		}
+	}
+}
+
+// writeFrame writes header and payload separately, like the client does, so
+// encrypted records line up with the reader on the other side.
+func writeFrame(w io.Writer, payload []byte) error {
+	var hdr [2]byte
+	binary.BigEndian.PutUint16(hdr[:], uint16(len(payload))) //nolint:gosec // UDP payloads fit in 16 bits
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// readFrame reads one [len(2)|payload] UDP frame. Encrypted streams deliver
+// each client Write as a separate record, so the header and payload may
+// arrive in different reads.
+func readFrame(r io.Reader) ([]byte, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	n := int(binary.BigEndian.Uint16(hdr[:]))
+	if n == 0 {
+		return nil, errors.New("empty udp frame")
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
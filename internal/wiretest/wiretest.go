@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+// Package wiretest pins the client's wire format with golden transcripts: the
+// exact bytes the client writes for a canonical scenario are compared with a
+// hex dump checked in under testdata. The transcripts are the authoritative
+// definition of what the client puts on the wire; an intentional change
+// regenerates them with
+//
+//	go test ./internal/dataplane -run TestWireTranscript -update
+//
+// and shows up as a reviewed diff of testdata.
+package wiretest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden wire transcripts under internal/wiretest/testdata")
+
+// Recorder is an in-memory peer that keeps every byte written to it.
+type Recorder struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (r *Recorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.buf.Write(p)
+}
+
+// ReadFrom records everything read from src until EOF.
+func (r *Recorder) ReadFrom(src io.Reader) (int64, error) {
+	var b bytes.Buffer
+	n, err := b.ReadFrom(src)
+	_, _ = r.Write(b.Bytes())
+	return n, err
+}
+
+// Bytes returns a copy of what was recorded so far.
+func (r *Recorder) Bytes() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return bytes.Clone(r.buf.Bytes())
+}
+
+// Check compares got with the golden transcript name and fails t with a diff
+// of the hex dumps on mismatch; with -update it rewrites the transcript
+// instead.
+func Check(t testing.TB, name string, got []byte) {
+	t.Helper()
+	if err := check(goldenDir(), name, got, *update); err != nil {
+		t.Error(err)
+	}
+}
+
+// goldenDir is testdata next to this file, whichever package's test runs.
+func goldenDir() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "testdata")
+}
+
+func check(dir, name string, got []byte, rewrite bool) error {
+	path := filepath.Join(dir, name+".golden")
+	dump := hex.Dump(got)
+	if rewrite {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		return os.WriteFile(path, []byte(dump), 0o644)
+	}
+	want, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("no golden transcript %s; run the test with -update to create it", path)
+	}
+	if err != nil {
+		return err
+	}
+	if string(want) == dump {
+		return nil
+	}
+	return fmt.Errorf("wire transcript %s changed (-golden +got); if intended, rerun with -update and review the diff:\n%s", name, diffLines(string(want), dump))
+}
+
+// diffLines lists the lines that differ between two hex dumps. The dumps
+// share offsets, so lines are compared pairwise.
+func diffLines(want, got string) string {
+	w := strings.Split(strings.TrimSuffix(want, "\n"), "\n")
+	g := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+	var b strings.Builder
+	for i := range max(len(w), len(g)) {
+		var wl, gl string
+		if i < len(w) {
+			wl = w[i]
+		}
+		if i < len(g) {
+			gl = g[i]
+		}
+		if wl == gl {
+			continue
+		}
+		if wl != "" {
+			fmt.Fprintf(&b, "-%s\n", wl)
+		}
+		if gl != "" {
+			fmt.Fprintf(&b, "+%s\n", gl)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,32 @@
+// SPDX-License-Identifier: PROPRIETARY
+// Copyright (c) 2026 ForTunnels
+
+package wiretest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	err := check(dir, "preface", []byte("{\"dst\":\"a\"}\n"), false)
+	require.ErrorContains(t, err, "-update")
+
+	require.NoError(t, check(dir, "preface", []byte("{\"dst\":\"a\"}\n"), true))
+	require.NoError(t, check(dir, "preface", []byte("{\"dst\":\"a\"}\n"), false))
+
+	err = check(dir, "preface", []byte("{\"dst\":\"b\"}\n"), false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "-00000000  7b 22 64 73 74 22 3a 22  61 22 7d 0a")
+	assert.Contains(t, err.Error(), "+00000000  7b 22 64 73 74 22 3a 22  62 22 7d 0a")
+}
+
+func TestDiffLines(t *testing.T) {
+	assert.Empty(t, diffLines("a\nb\n", "a\nb\n"))
+	assert.Equal(t, "-b\n+c\n", diffLines("a\nb\n", "a\nc\n"))
+	assert.Equal(t, "+c\n", diffLines("a\n", "a\nc\n"), "a longer transcript")
+	assert.Equal(t, "-b\n", diffLines("a\nb\n", "a\n"), "a shorter transcript")
+}
@@ -86,6 +86,11 @@ const (
 	MessageTypeSubscribe     = "subscribe"
 	MessageTypeSubscribed    = "subscribed"
 	MessageTypeError         = "error"
+	// MessageTypeDisplaced tells a client that another instance took over its tunnel.
+	MessageTypeDisplaced = "displaced"
+	// MessageTypeMigrate tells a client to move its data plane to another
+	// node before the current one goes into maintenance.
+	MessageTypeMigrate = "migrate"
 )
 
 type Envelope struct {
@@ -136,6 +141,185 @@ type Tunnel struct {
 	IsGuest           bool             `json:"is_guest,omitempty"`
 	IsPublic          bool             `json:"is_public"`
 	LimitIndicators   *LimitIndicators `json:"limit_indicators,omitempty"`
+	// ActiveClient is the client instance currently serving the tunnel's data plane.
+	ActiveClient *ActiveClient `json:"active_client,omitempty"`
+	// Capabilities is set by servers that announce their features with the
+	// tunnel instead of (or as well as) GET /api/version.
+	Capabilities *ServerCapabilities `json:"capabilities,omitempty"`
+	// Notices are texts the server wants shown with the tunnel, e.g. the
+	// terms of a guest tunnel, in the language the server chose for them.
+	Notices []Notice `json:"notices,omitempty"`
+	// Limits are the plan limits of the tunnel, for clients to describe
+	// when the server sends no notices.
+	Limits *TunnelLimits `json:"limits,omitempty"`
+}
+
+// Notice severities; clients show an unknown one as NoticeInfo.
+const (
+	NoticeInfo    = "info"
+	NoticeWarning = "warning"
+)
+
+// Notice is a message for the user of a tunnel.
+type Notice struct {
+	Severity string `json:"severity,omitempty"`
+	Text     string `json:"text"`
+}
+
+// TunnelLimits are the limits of a tunnel's plan; zero means none.
+type TunnelLimits struct {
+	TrafficBytes int64 `json:"traffic_bytes,omitempty"`
+	// TTL is the lifetime of the tunnel in seconds.
+	TTL int64 `json:"ttl,omitempty"`
+}
+
+// ServerCapabilities is the body of GET /api/version: the server version and
+// the versioned protocol features it supports.
+type ServerCapabilities struct {
+	Version  string   `json:"version,omitempty"`
+	Features []string `json:"features"`
+}
+
+// Versioned features a server lists in ServerCapabilities.Features.
+const (
+	// FeaturePSKKDF: the server derives stream keys with the KDF named in the
+	// psk_kdf preface field (otherwise only the legacy KDF).
+	FeaturePSKKDF = "psk_kdf"
+	// FeatureHops: the server copies the hops preface field to the
+	// server-initiated streams it causes.
+	FeatureHops = "hops"
+	// FeatureTakeover: PATCH /api/tunnels accepts the takeover action.
+	FeatureTakeover = "takeover"
+	// FeatureKeepalive: POST /api/tunnels/{id}/keepalive exists.
+	FeatureKeepalive = "keepalive"
+	// FeatureQUIC and FeatureDTLS: the UDP data-plane transports.
+	FeatureQUIC = "quic"
+	FeatureDTLS = "dtls"
+	// FeatureQUICServe: the server opens the streams of an http/https tunnel
+	// on a QUIC connection the client registered with a ProtoServe stream.
+	FeatureQUICServe = "quic_serve"
+	// FeatureControlStream: a client-opened data-plane stream with proto
+	// ProtoControl carries the tunnel's control messages, as the control
+	// WebSocket does.
+	FeatureControlStream = "control_stream"
+	// FeatureRedundant: the server joins client-opened streams with the same
+	// redundant preface field, one on the WebSocket and one on the QUIC data
+	// plane, into one stream of redundancy frames.
+	FeatureRedundant = "redundant"
+	// FeatureResumeGET: the server keeps the public connection of a GET
+	// whose stream failed with its session and resumes the response on a
+	// new one (see PrefaceResume).
+	FeatureResumeGET = "resume_get"
+	// FeaturePSKConfirm: the server answers ProtoPSKConfirm streams, so
+	// clients can tell that it decrypts their encrypted streams.
+	FeaturePSKConfirm = "psk_confirm"
+)
+
+// ProtoControl is the preface proto of the control stream: after the preface
+// the server writes Envelope JSON values on it and the client writes nothing.
+const ProtoControl = "control"
+
+// ProtoServe is the preface proto of the stream that registers a QUIC
+// connection to serve a tunnel: the server answers with a setup ack line,
+// then opens a stream per public connection, each with the preface of a
+// server-initiated data-plane stream.
+const ProtoServe = "serve"
+
+// ProtoPSKConfirm is the preface proto of the stream confirming stream
+// encryption; the preface carries psk_kdf like any encrypted stream. The
+// server answers with a setup ack line, or a setup error when it has no PSK
+// for the tunnel. After the ack both directions carry PSK frames: the client
+// sends a PSKChallenge, the server answers with a PSKConfirmation, or closes
+// the stream when the challenge does not decrypt.
+const ProtoPSKConfirm = "psk_confirm"
+
+// PSKChallenge is the client's frame on a ProtoPSKConfirm stream: random
+// hex bytes only a server deriving the same key can read.
+type PSKChallenge struct {
+	Challenge string `json:"challenge"`
+}
+
+// PSKConfirmation is the server's answer to a PSKChallenge: the challenge
+// it decrypted and, when the server versions its tunnel keys, the ID of the
+// key it used (0 for none).
+type PSKConfirmation struct {
+	Confirmed string `json:"confirmed"`
+	KeyID     int    `json:"key_id,omitempty"`
+}
+
+// Client instance identification: every client process sends a random
+// instance ID in the data-plane WS dial header and client-opened stream prefaces.
+const (
+	HeaderClientInstance  = "X-Client-Instance"
+	PrefaceClientInstance = "client_instance"
+)
+
+// Session affinity: the server may answer a data-plane WS upgrade with an
+// opaque token in the HeaderSessionToken response header. The client sends
+// it back in the same request header on its next dials of the tunnel, so
+// that the server routes a reconnect to the worker holding the tunnel's warm
+// state. A server that no longer honors a token refuses the upgrade with a
+// non-empty HeaderSessionTokenRejected response header, whatever the status;
+// the client then drops it and dials a fresh session. Other refusals, such as
+// the 409 for a displaced client instance, leave the token alone.
+const (
+	HeaderSessionToken         = "X-Session-Token"
+	HeaderSessionTokenRejected = "X-Session-Token-Rejected"
+)
+
+// PrefaceHMAC is the server-initiated stream preface field carrying
+// hex HMAC-SHA256(dp-auth secret, tunnel_id||dst).
+const PrefaceHMAC = "hmac"
+
+// PrefacePSKKDF is the client-opened stream preface field declaring the PSK
+// key derivation of an encrypted stream, e.g. "legacy" or
+// "argon2id;t=2;m=19456;p=1". Absent means legacy.
+const PrefacePSKKDF = "psk_kdf"
+
+// PrefaceHops is the stream preface field counting how many times a
+// connection has already passed through the same client process, e.g. "1".
+// Absent means 0. Servers copy it from the client-opened stream that caused a
+// server-initiated one, so forwarding loops are refused instead of spinning.
+const PrefaceHops = "hops"
+
+// PrefaceSrc and PrefaceListen are the listen-mode stream preface fields
+// naming the local peer whose connection the stream carries and the client
+// listener it connected to, e.g. "192.168.1.20:51234" and "0.0.0.0:2222".
+// Clients send them only when asked to (--send-peer-info); absent means the
+// peer is not disclosed.
+const (
+	PrefaceSrc    = "src"
+	PrefaceListen = "listen"
+)
+
+// PrefaceRedundant and PrefaceRedundantLeg are the preface fields of the legs
+// of a redundant stream (--redundant): a random group ID shared by the legs,
+// e.g. "9f86d081884c7d65...", and the transport of this leg, "ws" or "quic".
+// After the preface both directions carry redundancy frames: a flags byte
+// (0 data, 1 FIN), a big-endian uint64 sequence number and uint32 payload
+// length, then the payload. The receiver delivers the first copy of each
+// sequence number.
+const (
+	PrefaceRedundant    = "redundant"
+	PrefaceRedundantLeg = "redundant_leg"
+)
+
+// PrefaceResume and PrefaceResumeOffset resume a response (FeatureResumeGET).
+// A server-initiated stream carries a random token in PrefaceResume, e.g.
+// "3q2-7w"; when the stream fails with its session before the response
+// ended, the server opens a stream on a new session with the same token and
+// PrefaceResumeOffset, the number of response bytes it received, e.g.
+// "65536". The client acknowledges it and sends the rest of the response
+// from that offset, or answers with a setup error when it cannot.
+const (
+	PrefaceResume       = "resume"
+	PrefaceResumeOffset = "resume_offset"
+)
+
+// ActiveClient identifies the client instance serving a tunnel.
+type ActiveClient struct {
+	InstanceID  string    `json:"instance_id"`
+	ConnectedAt time.Time `json:"connected_at"`
 }
 
 type TunnelCreateRequest struct {
@@ -149,9 +333,14 @@ type TunnelCreateRequest struct {
 	IsPublic              *bool  `json:"is_public,omitempty"`
 }
 
+// PatchActionTakeover asks the server to evict the sessions of every other
+// client instance serving the tunnel (see TunnelPatchRequest.InstanceID).
+const PatchActionTakeover = "takeover"
+
 type TunnelPatchRequest struct {
 	ID                    string `json:"id"`
 	Action                string `json:"action"`
+	InstanceID            string `json:"instance_id,omitempty"`
 	RedirectHTTP          *bool  `json:"redirect_http,omitempty"`
 	Transport             string `json:"transport,omitempty"`
 	DisableSPAShim        *bool  `json:"disable_spa_shim,omitempty"`
@@ -208,6 +397,22 @@ type ErrorPayload struct {
 	Message string `json:"message"`
 }
 
+// DisplacedPayload is sent with MessageTypeDisplaced; InstanceID is the new owner.
+type DisplacedPayload struct {
+	TunnelID   string `json:"tunnel_id"`
+	InstanceID string `json:"instance_id"`
+}
+
+// MigratePayload is sent with MessageTypeMigrate. Endpoint is the server URL
+// of the node to move to; streams may stay on the old node until Deadline.
+// PublicURL is set when the tunnel's public URL changes with the move.
+type MigratePayload struct {
+	TunnelID  string    `json:"tunnel_id"`
+	Endpoint  string    `json:"endpoint"`
+	Deadline  time.Time `json:"deadline,omitempty"`
+	PublicURL string    `json:"public_url,omitempty"`
+}
+
 type LifecycleEventPayload struct {
 	TunnelID  string `json:"tunnel_id"`
 	Status    string `json:"status,omitempty"`
@@ -5,6 +5,7 @@ package wsconn
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"strings"
 	"sync"
@@ -18,25 +19,50 @@ const (
 	MaxWebSocketFrameSize   = 64 * 1024   // 64KB per frame
 )
 
+// Options are the limits of a WSConn; zero fields take the defaults.
+type Options struct {
+	// MaxMessageSize caps the WebSocket messages read and written, in bytes
+	// (default MaxWebSocketMessageSize). A larger message read kills the
+	// connection.
+	MaxMessageSize int64
+	// MaxDiscard caps how much of a non-binary message is read before it is
+	// skipped (default MaxWebSocketFrameSize).
+	MaxDiscard int64
+}
+
+func (o Options) withDefaults() Options {
+	if o.MaxMessageSize <= 0 {
+		o.MaxMessageSize = MaxWebSocketMessageSize
+	}
+	if o.MaxDiscard <= 0 {
+		o.MaxDiscard = MaxWebSocketFrameSize
+	}
+	return o
+}
+
 // WSConn adapts a *websocket.Conn to an io.ReadWriteCloser suitable for smux.
 // It reads and writes only binary frames, ignoring non-binary messages.
 // SECURITY: Includes message size validation to prevent DoS attacks.
 type WSConn struct {
 	conn       *websocket.Conn
+	opts       Options
 	readMu     sync.Mutex
 	writeMu    sync.Mutex
 	currReader io.Reader
 }
 
-// NewWSConn constructs a new WSConn adapter for the provided *websocket.Conn.
-func NewWSConn(c *websocket.Conn) *WSConn {
+// NewWSConn constructs a new WSConn adapter for the provided *websocket.Conn
+// with the limits of opts.
+func NewWSConn(c *websocket.Conn, opts Options) *WSConn {
+	opts = opts.withDefaults()
 	// SECURITY: Set maximum message size limits
-	c.SetReadLimit(MaxWebSocketMessageSize)
-	return &WSConn{conn: c}
+	c.SetReadLimit(opts.MaxMessageSize)
+	return &WSConn{conn: c, opts: opts}
 }
 
-// NewClientWSConn mirrors NewWSConn but keeps backwards compatibility.
-func NewClientWSConn(c *websocket.Conn) *WSConn { return NewWSConn(c) }
+// NewClientWSConn mirrors NewWSConn with the default limits but keeps
+// backwards compatibility.
+func NewClientWSConn(c *websocket.Conn) *WSConn { return NewWSConn(c, Options{}) }
 
 // Read returns data from the current binary message reader, advancing to the
 // next binary frame as needed. It skips non-binary frames transparently.
@@ -63,12 +89,12 @@ func (w *WSConn) Read(p []byte) (int, error) {
 				if isConnClosed(err) {
 					return 0, io.EOF
 				}
-				return 0, err
+				return 0, w.readErr(err)
 			}
 			if mt != websocket.BinaryMessage {
 				// SECURITY: Limit the amount of data we discard from non-binary messages.
 				//nolint:errcheck // best-effort discard of oversized frame
-				_, _ = io.CopyN(io.Discard, r, MaxWebSocketFrameSize)
+				_, _ = io.CopyN(io.Discard, r, w.opts.MaxDiscard)
 				continue
 			}
 			w.currReader = r
@@ -86,8 +112,16 @@ func (w *WSConn) Read(p []byte) (int, error) {
 		if err != nil && isConnClosed(err) {
 			return n, io.EOF
 		}
-		return n, err
+		return n, w.readErr(err)
+	}
+}
+
+// readErr names the message cap in read limit errors.
+func (w *WSConn) readErr(err error) error {
+	if errors.Is(err, websocket.ErrReadLimit) {
+		return fmt.Errorf("message exceeds the %d-byte WebSocket message cap: %w", w.opts.MaxMessageSize, err)
 	}
+	return err
 }
 
 // Write emits a single binary frame containing p. Each call produces a single
@@ -95,8 +129,8 @@ func (w *WSConn) Read(p []byte) (int, error) {
 // SECURITY: Validates message size before sending.
 func (w *WSConn) Write(p []byte) (int, error) {
 	// SECURITY: Check message size before sending
-	if len(p) > MaxWebSocketMessageSize {
-		return 0, errors.New("message size exceeds maximum allowed")
+	if int64(len(p)) > w.opts.MaxMessageSize {
+		return 0, fmt.Errorf("message size %d exceeds the %d-byte WebSocket message cap", len(p), w.opts.MaxMessageSize)
 	}
 
 	w.writeMu.Lock()
@@ -6,6 +6,7 @@
 package wsconn
 
 import (
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -35,7 +36,7 @@ func TestWSConnReadSkipsNonBinaryFrames(t *testing.T) {
 	require.NoError(t, err, "dial ws")
 	defer conn.Close()
 
-	wsc := NewWSConn(conn)
+	wsc := NewWSConn(conn, Options{})
 	buf := make([]byte, MaxWebSocketFrameSize)
 	n, err := wsc.Read(buf)
 	require.NoError(t, err, "Read()")
@@ -59,7 +60,7 @@ func TestWSConnReadRejectsLargeBuffer(t *testing.T) {
 	require.NoError(t, err, "dial ws")
 	defer conn.Close()
 
-	wsc := NewWSConn(conn)
+	wsc := NewWSConn(conn, Options{})
 	buf := make([]byte, MaxWebSocketFrameSize+1)
 	_, err = wsc.Read(buf)
 	require.Error(t, err, "Read() expected error for oversized buffer")
@@ -82,8 +83,83 @@ func TestWSConnWriteRejectsLargeMessage(t *testing.T) {
 	require.NoError(t, err, "dial ws")
 	defer conn.Close()
 
-	wsc := NewWSConn(conn)
+	wsc := NewWSConn(conn, Options{})
 	msg := make([]byte, MaxWebSocketMessageSize+1)
 	_, err = wsc.Write(msg)
 	require.Error(t, err, "Write() expected error for oversized message")
 }
+
+// dialServer connects to a server that hands its side of the connection to
+// serve and returns the client side.
+func dialServer(t *testing.T, serve func(*websocket.Conn)) *websocket.Conn {
+	t.Helper()
+	upgrader := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		serve(conn)
+	}))
+	t.Cleanup(server.Close)
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.NoError(t, err, "dial ws")
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func TestWSConnWriteAtMessageCap(t *testing.T) {
+	const limit = 4096
+	received := make(chan int, 2)
+	conn := dialServer(t, func(c *websocket.Conn) {
+		for {
+			_, msg, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- len(msg)
+		}
+	})
+	wsc := NewWSConn(conn, Options{MaxMessageSize: limit})
+
+	n, err := wsc.Write(make([]byte, limit))
+	require.NoError(t, err, "a message of exactly the cap is written")
+	require.Equal(t, limit, n)
+	select {
+	case got := <-received:
+		require.Equal(t, limit, got)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server did not receive the message")
+	}
+
+	_, err = wsc.Write(make([]byte, limit+1))
+	require.ErrorContains(t, err, "exceeds the 4096-byte WebSocket message cap")
+}
+
+func TestWSConnReadAtMessageCap(t *testing.T) {
+	const limit = 4096
+	conn := dialServer(t, func(c *websocket.Conn) {
+		_ = c.WriteMessage(websocket.BinaryMessage, make([]byte, limit))
+		_ = c.WriteMessage(websocket.BinaryMessage, make([]byte, limit+1))
+		time.Sleep(100 * time.Millisecond)
+	})
+	wsc := NewWSConn(conn, Options{MaxMessageSize: limit})
+
+	buf := make([]byte, limit)
+	n, err := io.ReadFull(wsc, buf)
+	require.NoError(t, err, "a message of exactly the cap is read")
+	require.Equal(t, limit, n)
+
+	_, err = io.ReadFull(wsc, buf)
+	require.ErrorIs(t, err, websocket.ErrReadLimit, "one byte over the cap")
+	require.ErrorContains(t, err, "4096-byte WebSocket message cap")
+}
+
+func TestWSConnDefaultOptions(t *testing.T) {
+	conn := dialServer(t, func(*websocket.Conn) { time.Sleep(50 * time.Millisecond) })
+	wsc := NewWSConn(conn, Options{})
+	require.Equal(t, Options{MaxMessageSize: MaxWebSocketMessageSize, MaxDiscard: MaxWebSocketFrameSize}, wsc.opts)
+}